@@ -0,0 +1,183 @@
+//! Compiling a guest project to a WASM module with its own toolchain.
+//!
+//! The toolchain is picked from the files in the project directory:
+//! - `Cargo.toml`: `cargo build --target wasm32-unknown-unknown`; the module is
+//!   `<target>/wasm32-unknown-unknown/<profile>/<crate>.wasm`, looked up in `CARGO_TARGET_DIR` or
+//!   the nearest `target` directory (workspace members build into the workspace's);
+//! - `build.zig`: `zig build`; the module is the newest `.wasm` in `zig-out/bin`;
+//! - `go.mod`: `tinygo build -target wasm`; the module is `<dir name>.wasm`;
+//! - `Makefile`: `make`; the module is the newest `.wasm` in the directory.
+
+use std::fs;
+use std::path::{Path, PathBuf};
+use std::process::Command;
+use std::time::SystemTime;
+
+/// Rust guests are built for this target.
+pub const RUST_TARGET: &str = "wasm32-unknown-unknown";
+
+/// A guest build system.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Toolchain {
+    Cargo,
+    Zig,
+    TinyGo,
+    Make,
+}
+
+impl Toolchain {
+    /// The toolchain for the project in `dir`, by its build file.
+    pub fn detect(dir: &Path) -> Option<Toolchain> {
+        [
+            ("Cargo.toml", Toolchain::Cargo),
+            ("build.zig", Toolchain::Zig),
+            ("go.mod", Toolchain::TinyGo),
+            ("Makefile", Toolchain::Make),
+        ]
+        .into_iter()
+        .find(|(file, _)| dir.join(file).is_file())
+        .map(|(_, toolchain)| toolchain)
+    }
+}
+
+/// Build the project in `dir` and return the path of the module it produced. `release` picks
+/// an optimized build where the toolchain has one.
+pub fn build(dir: &Path, release: bool) -> Result<PathBuf, String> {
+    let toolchain = Toolchain::detect(dir).ok_or_else(|| {
+        format!(
+            "{}: no Cargo.toml, build.zig, go.mod or Makefile to build with",
+            dir.display()
+        )
+    })?;
+    match toolchain {
+        Toolchain::Cargo => {
+            let mut cmd = Command::new("cargo");
+            cmd.args(["build", "--target", RUST_TARGET]);
+            if release {
+                cmd.arg("--release");
+            }
+            run(cmd.current_dir(dir))?;
+            let manifest = fs::read_to_string(dir.join("Cargo.toml"))
+                .map_err(|e| format!("reading Cargo.toml: {e}"))?;
+            let name = crate_name(&manifest).ok_or("Cargo.toml has no package name")?;
+            let profile = if release { "release" } else { "debug" };
+            let file = Path::new(RUST_TARGET)
+                .join(profile)
+                .join(format!("{name}.wasm"));
+            cargo_target_dirs(dir)
+                .into_iter()
+                .map(|target| target.join(&file))
+                .find(|path| path.is_file())
+                .ok_or_else(|| format!("cargo built no {}", file.display()))
+        }
+        Toolchain::Zig => {
+            let mut cmd = Command::new("zig");
+            cmd.arg("build");
+            if release {
+                cmd.arg("-Doptimize=ReleaseSmall");
+            }
+            run(cmd.current_dir(dir))?;
+            newest_wasm(&dir.join("zig-out").join("bin"))
+        }
+        Toolchain::TinyGo => {
+            let name = dir
+                .canonicalize()
+                .ok()
+                .and_then(|d| d.file_name().map(|n| n.to_string_lossy().into_owned()))
+                .unwrap_or_else(|| "cart".to_string());
+            let out = dir.join(format!("{name}.wasm"));
+            let mut cmd = Command::new("tinygo");
+            cmd.args(["build", "-target", "wasm", "-o"]).arg(&out);
+            if !release {
+                cmd.args(["-opt", "1"]);
+            }
+            run(cmd.arg(".").current_dir(dir))?;
+            Ok(out)
+        }
+        Toolchain::Make => {
+            run(Command::new("make").current_dir(dir))?;
+            newest_wasm(dir)
+        }
+    }
+}
+
+fn run(cmd: &mut Command) -> Result<(), String> {
+    let program = cmd.get_program().to_string_lossy().into_owned();
+    let status = cmd
+        .status()
+        .map_err(|e| format!("couldn't run {program}: {e}"))?;
+    if status.success() {
+        Ok(())
+    } else {
+        Err(format!("{program} failed ({status})"))
+    }
+}
+
+/// The library name cargo gives the package in `manifest`: `[lib] name`, else `[package] name`
+/// with `-` turned into `_`.
+pub fn crate_name(manifest: &str) -> Option<String> {
+    let mut table = "";
+    let (mut package, mut lib) = (None, None);
+    for line in manifest.lines() {
+        let line = line.trim();
+        if line.starts_with('[') {
+            table = line;
+            continue;
+        }
+        let Some((key, value)) = line.split_once('=') else {
+            continue;
+        };
+        if key.trim() != "name" {
+            continue;
+        }
+        let value = value.trim().trim_matches('"').to_string();
+        match table {
+            "[package]" => package = Some(value),
+            "[lib]" => lib = Some(value),
+            _ => {}
+        }
+    }
+    lib.or(package).map(|name| name.replace('-', "_"))
+}
+
+/// Where cargo may have put the build: `CARGO_TARGET_DIR`, then `target` in `dir` and each of
+/// its parents.
+fn cargo_target_dirs(dir: &Path) -> Vec<PathBuf> {
+    let mut dirs: Vec<PathBuf> = std::env::var_os("CARGO_TARGET_DIR")
+        .map(PathBuf::from)
+        .into_iter()
+        .collect();
+    let dir = dir.canonicalize().unwrap_or_else(|_| dir.to_path_buf());
+    dirs.extend(dir.ancestors().map(|d| d.join("target")));
+    dirs
+}
+
+/// The most recently modified `.wasm` file directly in `dir`.
+fn newest_wasm(dir: &Path) -> Result<PathBuf, String> {
+    let entries = fs::read_dir(dir).map_err(|e| format!("{}: {e}", dir.display()))?;
+    entries
+        .filter_map(|e| e.ok().map(|e| e.path()))
+        .filter(|path| path.extension().is_some_and(|ext| ext == "wasm"))
+        .max_by_key(|path| {
+            fs::metadata(path)
+                .and_then(|m| m.modified())
+                .unwrap_or(SystemTime::UNIX_EPOCH)
+        })
+        .ok_or_else(|| format!("no .wasm file in {}", dir.display()))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn crate_names_follow_cargo() {
+        let manifest = "[package]\nname = \"rust-guest-3d\"\n\n[dependencies]\nname = 1\n";
+        assert_eq!(crate_name(manifest).as_deref(), Some("rust_guest_3d"));
+
+        let manifest = "[package]\nname = \"game\"\n[lib]\nname = \"my-cart\"\n";
+        assert_eq!(crate_name(manifest).as_deref(), Some("my_cart"));
+
+        assert_eq!(crate_name("[workspace]\nmembers = []\n"), None);
+    }
+}
@@ -0,0 +1,316 @@
+//! `wasm96`: build, pack and run wasm96 carts.
+//!
+//! ```text
+//! wasm96 new DIR [--lang rust|zig] [--sdk CHECKOUT]
+//!     Create a guest project in DIR, named after it.
+//! wasm96 build [DIR] [--debug]
+//!     Compile the guest project in DIR (default `.`) and print the module's path.
+//! wasm96 verify [DIR | MODULE] [--debug]
+//!     Build the project (or take a built .wasm/.wat) and check its exports, imports and memory
+//!     against the core's ABI.
+//! wasm96 pack [DIR | MODULE] [-o OUT] [--assets DIR] [--meta KEY=VALUE]... [--debug]
+//!     Build and verify the project (or take a built .wasm/.wat) and pack it with its assets
+//!     and metadata into a .w96 cart.
+//! wasm96 run [DIR | CART] [--watch] [--core PATH] [--frontend CMD] [pack options]
+//!     Pack a project (or take a cart) and play it in a libretro frontend. With `--watch` the
+//!     core hot-reloads the cart, and a project is packed again whenever its files change.
+//! ```
+//!
+//! See `scaffold` for new projects, `compile` for the supported toolchains, `verify` for the
+//! checks and `pack` for what goes into a cart.
+
+mod compile;
+mod pack;
+mod scaffold;
+mod verify;
+mod wasm;
+mod watch;
+
+use std::path::{Path, PathBuf};
+use std::process::{Command, ExitCode};
+
+const USAGE: &str = "\
+usage: wasm96 <command> [options]
+
+commands:
+  new DIR [options]                      create a guest project in DIR, named after it
+      --lang rust|zig                    language (default rust)
+      --sdk CHECKOUT                     wasm96 checkout with the SDKs (default: this tool's)
+  build [DIR] [--debug]                  compile the guest project in DIR (default .)
+  verify [DIR | MODULE] [--debug]        check exports, imports and memory against the core
+  pack [DIR | MODULE] [options]          build, check and pack a .w96 cart
+      -o, --out FILE                     cart path (default <name>.w96 next to the project)
+      --assets DIR                       asset directory (default <project>/assets)
+      --meta KEY=VALUE                   add a metadata line (repeatable)
+      --debug                            unoptimized build
+  run [DIR | CART] [options]             pack if needed, then play in a libretro frontend
+      --core PATH                        core library (default $WASM96_CORE, then target/release)
+      --frontend CMD                     frontend (default $WASM96_FRONTEND, then retroarch)
+      --watch                            repack on changes; the core hot-reloads the cart
+      plus the pack options
+";
+
+/// Parsed command line.
+#[derive(Debug, Default)]
+struct Options {
+    command: String,
+    input: Option<PathBuf>,
+    out: Option<PathBuf>,
+    assets: Option<PathBuf>,
+    meta: Vec<String>,
+    debug: bool,
+    watch: bool,
+    core: Option<PathBuf>,
+    frontend: Option<String>,
+    lang: Option<String>,
+    sdk: Option<PathBuf>,
+}
+
+fn parse_args(args: impl IntoIterator<Item = String>) -> Result<Options, String> {
+    let mut args = args.into_iter();
+    let mut options = Options {
+        command: args.next().ok_or("missing command")?,
+        ..Options::default()
+    };
+    while let Some(arg) = args.next() {
+        let mut value = |flag: &str| args.next().ok_or_else(|| format!("{flag} needs a value"));
+        match arg.as_str() {
+            "-o" | "--out" => options.out = Some(value(&arg)?.into()),
+            "--assets" => options.assets = Some(value(&arg)?.into()),
+            "--meta" => options.meta.push(value(&arg)?),
+            "--core" => options.core = Some(value(&arg)?.into()),
+            "--frontend" => options.frontend = Some(value(&arg)?),
+            "--lang" => options.lang = Some(value(&arg)?),
+            "--sdk" => options.sdk = Some(value(&arg)?.into()),
+            "--debug" => options.debug = true,
+            "--watch" => options.watch = true,
+            flag if flag.starts_with('-') => return Err(format!("unknown option {flag}")),
+            _ if options.input.is_none() => options.input = Some(arg.into()),
+            _ => return Err(format!("unexpected argument {arg}")),
+        }
+    }
+    Ok(options)
+}
+
+fn main() -> ExitCode {
+    let result =
+        parse_args(std::env::args().skip(1)).and_then(|options| match options.command.as_str() {
+            "new" => new(&options),
+            "build" => build(&options),
+            "verify" => verify(&options).map(|_| println!("ok")),
+            "pack" => pack(&options).map(|_| ()),
+            "run" => run(&options),
+            "help" | "-h" | "--help" => {
+                print!("{USAGE}");
+                Ok(())
+            }
+            other => Err(format!("unknown command {other}\n\n{USAGE}")),
+        });
+    match result {
+        Ok(()) => ExitCode::SUCCESS,
+        Err(e) => {
+            eprintln!("wasm96: {e}");
+            ExitCode::FAILURE
+        }
+    }
+}
+
+fn input(options: &Options) -> &Path {
+    options.input.as_deref().unwrap_or(Path::new("."))
+}
+
+fn new(options: &Options) -> Result<(), String> {
+    let dir = options
+        .input
+        .as_deref()
+        .ok_or("new needs a project directory")?;
+    let lang = options.lang.as_deref().unwrap_or("rust");
+    let lang = scaffold::Lang::parse(lang).ok_or_else(|| format!("unknown language {lang}"))?;
+    let sdk = options.sdk.clone().or_else(scaffold::default_sdk_root);
+    let name = scaffold::create(dir, lang, sdk.as_deref())?;
+    println!(
+        "created {name} in {}; `wasm96 run {}` builds and plays it",
+        dir.display(),
+        dir.display()
+    );
+    Ok(())
+}
+
+fn build(options: &Options) -> Result<(), String> {
+    let module = compile::build(input(options), !options.debug)?;
+    println!("{}", module.display());
+    Ok(())
+}
+
+/// Whether `path` is a file with one of `extensions`.
+fn is_file_with(path: &Path, extensions: &[&str]) -> bool {
+    path.is_file()
+        && path
+            .extension()
+            .is_some_and(|ext| extensions.iter().any(|e| ext == *e))
+}
+
+/// Build (unless given a module) and verify; returns the project directory and the module.
+fn verify(options: &Options) -> Result<(PathBuf, Vec<u8>), String> {
+    let input = input(options);
+    let (project, module_path) = if is_file_with(input, &["wasm", "wat"]) {
+        let dir = input.parent().unwrap_or(Path::new(".")).to_path_buf();
+        (dir, input.to_path_buf())
+    } else {
+        (input.to_path_buf(), compile::build(input, !options.debug)?)
+    };
+    let module =
+        std::fs::read(&module_path).map_err(|e| format!("{}: {e}", module_path.display()))?;
+    let host = wasm96_core::host_signatures().map_err(|e| e.to_string())?;
+    let report = verify::verify(&module, &host)?;
+    for warning in &report.warnings {
+        eprintln!("wasm96: warning: {warning}");
+    }
+    for error in &report.errors {
+        eprintln!("wasm96: error: {error}");
+    }
+    match report.errors.len() {
+        0 => Ok((project, module)),
+        n => Err(format!(
+            "{} has {n} problem{}",
+            module_path.display(),
+            if n == 1 { "" } else { "s" }
+        )),
+    }
+}
+
+/// Build (unless given a module), verify and pack; returns the cart's path.
+fn pack(options: &Options) -> Result<PathBuf, String> {
+    let input = input(options);
+    let (project, module) = verify(options)?;
+
+    let assets_dir = options
+        .assets
+        .clone()
+        .unwrap_or_else(|| project.join(pack::ASSETS_DIR));
+    let cart = pack::Cart {
+        module,
+        meta: pack::read_meta(&project, &options.meta)?,
+        assets: pack::collect_assets(&assets_dir)?,
+    };
+    let out = match &options.out {
+        Some(out) => out.clone(),
+        None => {
+            let name = if input.is_file() {
+                input.file_stem().map(|s| s.to_string_lossy().into_owned())
+            } else {
+                project
+                    .canonicalize()
+                    .ok()
+                    .and_then(|d| d.file_name().map(|n| n.to_string_lossy().into_owned()))
+            };
+            project.join(format!("{}.w96", name.as_deref().unwrap_or("cart")))
+        }
+    };
+    std::fs::write(&out, cart.to_bundle()).map_err(|e| format!("{}: {e}", out.display()))?;
+    println!(
+        "{} ({} asset{})",
+        out.display(),
+        cart.assets.len(),
+        if cart.assets.len() == 1 { "" } else { "s" }
+    );
+    Ok(out)
+}
+
+/// File names of the core library on Linux, macOS and Windows.
+const CORE_LIBRARIES: [&str; 3] = [
+    "libwasm96_core.so",
+    "libwasm96_core.dylib",
+    "wasm96_core.dll",
+];
+
+/// The core library: `--core`, `WASM96_CORE`, else a release build in the nearest `target`.
+fn find_core(options: &Options) -> Result<PathBuf, String> {
+    if let Some(core) = options
+        .core
+        .clone()
+        .or_else(|| std::env::var_os("WASM96_CORE").map(PathBuf::from))
+    {
+        return Ok(core);
+    }
+    let cwd = std::env::current_dir().map_err(|e| e.to_string())?;
+    cwd.ancestors()
+        .flat_map(|dir| CORE_LIBRARIES.map(|lib| dir.join("target/release").join(lib)))
+        .find(|path| path.is_file())
+        .ok_or_else(|| {
+            "no core library found; build it with `cargo build -p wasm96-core --release` or pass \
+             --core"
+                .to_string()
+        })
+}
+
+fn run(options: &Options) -> Result<(), String> {
+    let input = input(options);
+    let prebuilt = is_file_with(input, &["w96", "wasm", "wat"]) && options.out.is_none();
+    let cart = if prebuilt {
+        input.to_path_buf()
+    } else {
+        pack(options)?
+    };
+    let core = find_core(options)?;
+    let frontend = options
+        .frontend
+        .clone()
+        .or_else(|| std::env::var("WASM96_FRONTEND").ok())
+        .unwrap_or_else(|| "retroarch".to_string());
+    let mut cmd = Command::new(&frontend);
+    cmd.arg("-L").arg(&core).arg(&cart);
+    if options.watch {
+        cmd.env(watch::HOT_RELOAD_ENV, "1");
+    }
+    let mut child = cmd
+        .spawn()
+        .map_err(|e| format!("couldn't run {frontend}: {e}"))?;
+    let status = if options.watch && !prebuilt {
+        let mut packed = watch::newest_change(input);
+        loop {
+            if let Some(status) = child.try_wait().map_err(|e| e.to_string())? {
+                break status;
+            }
+            std::thread::sleep(watch::INTERVAL);
+            if watch::newest_change(input) != packed {
+                // A failed build leaves the running cart as it is.
+                if let Err(e) = pack(options) {
+                    eprintln!("wasm96: {e}");
+                }
+                packed = watch::newest_change(input);
+            }
+        }
+    } else {
+        child.wait().map_err(|e| e.to_string())?
+    };
+    if status.success() {
+        Ok(())
+    } else {
+        Err(format!("{frontend} exited with {status}"))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn args(line: &str) -> Result<Options, String> {
+        parse_args(line.split_whitespace().map(String::from))
+    }
+
+    #[test]
+    fn options_parse_in_any_order() {
+        let o = args("pack game --meta title=Rocks -o out.w96 --debug --meta version=2").unwrap();
+        assert_eq!(o.command, "pack");
+        assert_eq!(o.input.as_deref(), Some(Path::new("game")));
+        assert_eq!(o.out.as_deref(), Some(Path::new("out.w96")));
+        assert_eq!(o.meta, ["title=Rocks", "version=2"]);
+        assert!(o.debug);
+
+        assert!(args("pack -o").is_err());
+        assert!(args("pack --fast").is_err());
+        assert!(args("pack a b").is_err());
+        assert!(args("").is_err());
+    }
+}
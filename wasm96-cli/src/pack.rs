@@ -0,0 +1,139 @@
+//! Packing a guest module with its assets and metadata into a `.w96` cart bundle.
+//!
+//! Every file under the project's `assets/` directory becomes an asset named by its path below
+//! it (`assets/sprites/ship.png` is read as `sprites/ship.png`); dotfiles are skipped. The
+//! project's `wasm96.meta` file, followed by any `--meta key=value` lines, becomes the bundle's
+//! metadata entry.
+
+use std::fs;
+use std::path::Path;
+
+use wasm96_core::loader::{self, bundle};
+
+/// Directory of a project whose files are packed as assets.
+pub const ASSETS_DIR: &str = "assets";
+
+/// What goes into a cart.
+#[derive(Debug, Default)]
+pub struct Cart {
+    /// WASM or WAT bytes.
+    pub module: Vec<u8>,
+    /// `key=value` metadata lines.
+    pub meta: String,
+    /// `(path, data)` for each asset, sorted by path.
+    pub assets: Vec<(String, Vec<u8>)>,
+}
+
+impl Cart {
+    /// The cart as `.w96` bundle bytes.
+    pub fn to_bundle(&self) -> Vec<u8> {
+        let module_entry = match loader::detect_format(&self.module) {
+            Some(loader::DetectedFormat::Wat) => bundle::MODULE_ENTRIES[1],
+            _ => bundle::MODULE_ENTRIES[0],
+        };
+        let mut entries: Vec<(&str, &[u8])> = vec![(module_entry, &self.module)];
+        if !self.meta.trim().is_empty() {
+            entries.push((bundle::META_ENTRY, self.meta.as_bytes()));
+        }
+        entries.extend(
+            self.assets
+                .iter()
+                .map(|(path, data)| (path.as_str(), &data[..])),
+        );
+        bundle::Bundle::write(&entries)
+    }
+}
+
+/// Every file under `dir`, as `(path relative to dir, data)` sorted by path. A missing `dir`
+/// has no assets.
+pub fn collect_assets(dir: &Path) -> Result<Vec<(String, Vec<u8>)>, String> {
+    let mut assets = Vec::new();
+    if dir.is_dir() {
+        collect_into(dir, "", &mut assets)?;
+    }
+    assets.sort_by(|a, b| a.0.cmp(&b.0));
+    Ok(assets)
+}
+
+fn collect_into(dir: &Path, prefix: &str, out: &mut Vec<(String, Vec<u8>)>) -> Result<(), String> {
+    let entries = fs::read_dir(dir).map_err(|e| format!("{}: {e}", dir.display()))?;
+    for entry in entries {
+        let entry = entry.map_err(|e| format!("{}: {e}", dir.display()))?;
+        let name = entry.file_name().to_string_lossy().into_owned();
+        if name.starts_with('.') {
+            continue;
+        }
+        let path = entry.path();
+        let asset = format!("{prefix}{name}");
+        if path.is_dir() {
+            collect_into(&path, &format!("{asset}/"), out)?;
+        } else {
+            let data = fs::read(&path).map_err(|e| format!("{}: {e}", path.display()))?;
+            out.push((asset, data));
+        }
+    }
+    Ok(())
+}
+
+/// Metadata for a cart: the `wasm96.meta` file in `dir` if there is one, then `extra`
+/// `key=value` lines, which win over the file's.
+pub fn read_meta(dir: &Path, extra: &[String]) -> Result<String, String> {
+    let path = dir.join(bundle::META_ENTRY);
+    let mut meta = if path.is_file() {
+        fs::read_to_string(&path).map_err(|e| format!("{}: {e}", path.display()))?
+    } else {
+        String::new()
+    };
+    for line in extra {
+        if !line.contains('=') {
+            return Err(format!("metadata `{line}` isn't a key=value pair"));
+        }
+        if !meta.is_empty() && !meta.ends_with('\n') {
+            meta.push('\n');
+        }
+        meta.push_str(line);
+        meta.push('\n');
+    }
+    Ok(meta)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::wasm::tests::module_exporting;
+
+    fn scratch(name: &str) -> std::path::PathBuf {
+        let dir = std::env::temp_dir().join(format!("wasm96-cli-{name}-{}", std::process::id()));
+        let _ = fs::remove_dir_all(&dir);
+        fs::create_dir_all(&dir).unwrap();
+        dir
+    }
+
+    #[test]
+    fn assets_and_meta_round_trip_through_the_bundle() {
+        let dir = scratch("pack");
+        fs::create_dir_all(dir.join("assets/sprites")).unwrap();
+        fs::write(dir.join("assets/sprites/ship.png"), b"png").unwrap();
+        fs::write(dir.join("assets/level1.txt"), b"#..#").unwrap();
+        fs::write(dir.join("assets/.DS_Store"), b"junk").unwrap();
+        fs::write(dir.join("wasm96.meta"), "title=Rocks").unwrap();
+
+        let cart = Cart {
+            module: module_exporting(&["setup", "draw"]),
+            meta: read_meta(&dir, &["version=1.2".to_string()]).unwrap(),
+            assets: collect_assets(&dir.join(ASSETS_DIR)).unwrap(),
+        };
+        assert_eq!(cart.meta, "title=Rocks\nversion=1.2\n");
+        assert!(read_meta(&dir, &["oops".to_string()]).is_err());
+
+        let bundle = bundle::Bundle::parse(&cart.to_bundle()).unwrap();
+        assert_eq!(bundle.module(), Some(&cart.module[..]));
+        assert_eq!(bundle.get(bundle::META_ENTRY), Some(cart.meta.as_bytes()));
+        assert_eq!(
+            bundle.asset_paths("").collect::<Vec<_>>(),
+            ["level1.txt", "sprites/ship.png"]
+        );
+        assert_eq!(bundle.asset("sprites/ship.png"), Some(&b"png"[..]));
+        fs::remove_dir_all(&dir).unwrap();
+    }
+}
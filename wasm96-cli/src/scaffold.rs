@@ -0,0 +1,312 @@
+//! `wasm96 new`: a ready-to-build guest project.
+//!
+//! A project has `setup`/`update`/`draw` stubs using the SDK, an `assets/` folder that
+//! `wasm96 pack` bundles (read back with `system::asset_read`), a `wasm96.meta` file, and a
+//! justfile running `wasm96 build`, `pack`, `run` and `run --watch`.
+//!
+//! The SDK comes from a wasm96 checkout: `--sdk DIR`, else the one this tool was built from.
+//! Rust projects without a checkout use the published `wasm96-sdk` crate instead.
+
+use std::fs;
+use std::path::{Path, PathBuf};
+
+/// Guest languages `new` can set up.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Lang {
+    Rust,
+    Zig,
+}
+
+impl Lang {
+    pub fn parse(name: &str) -> Option<Lang> {
+        match name {
+            "rust" | "rs" => Some(Lang::Rust),
+            "zig" => Some(Lang::Zig),
+            _ => None,
+        }
+    }
+}
+
+/// The wasm96 checkout this tool was built from, if it's still there.
+pub fn default_sdk_root() -> Option<PathBuf> {
+    let root = Path::new(env!("CARGO_MANIFEST_DIR")).parent()?;
+    root.join("wasm96-sdk").is_dir().then(|| root.to_path_buf())
+}
+
+/// Whether `name` works as a crate, module and file name.
+pub fn valid_name(name: &str) -> bool {
+    name.starts_with(|c: char| c.is_ascii_alphabetic())
+        && name
+            .chars()
+            .all(|c| c.is_ascii_alphanumeric() || c == '-' || c == '_')
+}
+
+/// `path` with `/` separators, for build files.
+fn slashed(path: &Path) -> String {
+    path.display().to_string().replace('\\', "/")
+}
+
+/// `(path, contents)` of every file in a new `lang` project called `name`, with the SDK taken
+/// from the checkout at `sdk_root`.
+pub fn files(
+    name: &str,
+    lang: Lang,
+    sdk_root: Option<&Path>,
+) -> Result<Vec<(String, String)>, String> {
+    let mut files = match lang {
+        Lang::Rust => {
+            let sdk = match sdk_root {
+                Some(root) => format!("{{ path = '{}' }}", slashed(&root.join("wasm96-sdk"))),
+                None => "\"0.1\"".to_string(),
+            };
+            vec![
+                ("Cargo.toml", RUST_MANIFEST.replace("{sdk}", &sdk)),
+                ("src/lib.rs", RUST_MAIN.to_string()),
+                (".gitignore", "target/\n*.w96\n".to_string()),
+            ]
+        }
+        Lang::Zig => {
+            let root = sdk_root
+                .ok_or("Zig projects need the wasm96 Zig SDK; pass --sdk with a wasm96 checkout")?;
+            let sdk = slashed(&root.join("wasm96-zig-sdk").join("src").join("main.zig"));
+            vec![
+                ("build.zig", ZIG_BUILD.replace("{sdk}", &sdk)),
+                ("src/main.zig", ZIG_MAIN.to_string()),
+                (".gitignore", "zig-out/\n.zig-cache/\n*.w96\n".to_string()),
+            ]
+        }
+    };
+    files.extend([
+        ("assets/hello.txt", "Hello from {name}!\n".to_string()),
+        (
+            "wasm96.meta",
+            "title=\"{name}\"\nversion=0.1.0\n".to_string(),
+        ),
+        ("justfile", JUSTFILE.to_string()),
+    ]);
+    Ok(files
+        .into_iter()
+        .map(|(path, text)| (path.to_string(), text.replace("{name}", name)))
+        .collect())
+}
+
+/// Create a `lang` project in `dir` (which must not exist yet or be empty), named after it.
+/// Returns the project name.
+pub fn create(dir: &Path, lang: Lang, sdk_root: Option<&Path>) -> Result<String, String> {
+    let name = dir
+        .file_name()
+        .map(|n| n.to_string_lossy().into_owned())
+        .unwrap_or_default();
+    if !valid_name(&name) {
+        return Err(format!(
+            "`{name}` isn't a usable project name: start with a letter and use letters, digits, \
+             `-` and `_`"
+        ));
+    }
+    if fs::read_dir(dir).is_ok_and(|mut entries| entries.next().is_some()) {
+        return Err(format!("{} already exists and isn't empty", dir.display()));
+    }
+    for (path, text) in files(&name, lang, sdk_root)? {
+        let path = dir.join(path);
+        if let Some(parent) = path.parent() {
+            fs::create_dir_all(parent).map_err(|e| format!("{}: {e}", parent.display()))?;
+        }
+        fs::write(&path, text).map_err(|e| format!("{}: {e}", path.display()))?;
+    }
+    Ok(name)
+}
+
+const JUSTFILE: &str = "\
+# Build, pack and run {name} with the `wasm96` tool.
+
+build:
+    wasm96 build
+
+pack:
+    wasm96 pack
+
+run:
+    wasm96 run
+
+# Play, repacking and hot-reloading on every change.
+watch:
+    wasm96 run --watch
+";
+
+const RUST_MANIFEST: &str = r#"[package]
+name = "{name}"
+version = "0.1.0"
+edition = "2024"
+publish = false
+
+[lib]
+# The cart is a WASM module loaded by the wasm96 core.
+crate-type = ["cdylib"]
+
+[dependencies]
+wasm96-sdk = {sdk}
+
+[profile.release]
+panic = "abort"
+lto = true
+codegen-units = 1
+strip = true
+
+# A standalone project, even inside another workspace.
+[workspace]
+"#;
+
+const RUST_MAIN: &str = r#"// {name}: a wasm96 cart.
+//
+// The host calls `setup` once, then `update` and `draw` every frame.
+
+use std::sync::OnceLock;
+
+use wasm96_sdk::prelude::*;
+
+const FONT: &str = "font/spleen/16";
+
+static GREETING: OnceLock<String> = OnceLock::new();
+static mut X: i32 = 0;
+
+#[unsafe(no_mangle)]
+pub extern "C" fn setup() {
+    graphics::set_size(320, 240);
+    graphics::font_register_spleen(FONT, 16);
+
+    // Files under `assets/` are packed into the cart by `wasm96 pack`.
+    let greeting = system::asset_read("hello.txt")
+        .and_then(|bytes| String::from_utf8(bytes).ok())
+        .unwrap_or_else(|| "Hello!".to_string());
+    let _ = GREETING.set(greeting.trim().to_string());
+}
+
+#[unsafe(no_mangle)]
+pub extern "C" fn update() {
+    unsafe { X = (X + 1) % 320 };
+}
+
+#[unsafe(no_mangle)]
+pub extern "C" fn draw() {
+    graphics::background(20, 20, 40);
+    graphics::set_color(255, 100, 100, 255);
+    graphics::rect(unsafe { X }, 150, 20, 20);
+    graphics::set_color(255, 255, 255, 255);
+    graphics::text_key(16, 16, FONT, GREETING.get().map_or("Hello!", String::as_str));
+}
+"#;
+
+const ZIG_BUILD: &str = r#"const std = @import("std");
+
+pub fn build(b: *std.Build) void {
+    // A freestanding module exporting `setup`, `update` and `draw`, with no WASI `_start`.
+    const target = b.resolveTargetQuery(.{
+        .cpu_arch = .wasm32,
+        .os_tag = .freestanding,
+    });
+    const optimize = b.standardOptimizeOption(.{});
+
+    const sdk_mod = b.createModule(.{
+        .root_source_file = .{ .cwd_relative = "{sdk}" },
+        .target = target,
+        .optimize = optimize,
+    });
+
+    const exe_mod = b.createModule(.{
+        .root_source_file = b.path("src/main.zig"),
+        .target = target,
+        .optimize = optimize,
+        .imports = &.{
+            .{ .name = "wasm96", .module = sdk_mod },
+        },
+    });
+
+    const exe = b.addExecutable(.{
+        .name = "{name}",
+        .root_module = exe_mod,
+    });
+    exe.entry = .disabled;
+    exe.rdynamic = true;
+
+    b.installArtifact(exe);
+}
+"#;
+
+const ZIG_MAIN: &str = r#"// {name}: a wasm96 cart.
+//
+// The host calls `setup` once, then `update` and `draw` every frame.
+
+const std = @import("std");
+const wasm96 = @import("wasm96");
+
+const font = "font/spleen/16";
+
+var greeting: []const u8 = "Hello!";
+var x: i32 = 0;
+
+export fn setup() void {
+    wasm96.graphics.setSize(320, 240);
+    _ = wasm96.graphics.fontRegisterSpleen(font, 16);
+
+    // Files under `assets/` are packed into the cart by `wasm96 pack`.
+    const text = wasm96.system.assetRead(std.heap.wasm_allocator, "hello.txt") catch null;
+    if (text) |t| greeting = std.mem.trim(u8, t, " \r\n");
+}
+
+export fn update() void {
+    x = @mod(x + 1, 320);
+}
+
+export fn draw() void {
+    wasm96.graphics.background(20, 20, 40);
+    wasm96.graphics.setColor(255, 100, 100, 255);
+    wasm96.graphics.rect(x, 150, 20, 20);
+    wasm96.graphics.setColor(255, 255, 255, 255);
+    wasm96.graphics.textKey(16, 16, font, greeting);
+}
+"#;
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn names_must_start_with_a_letter() {
+        assert!(valid_name("space-rocks_2"));
+        assert!(!valid_name("2rocks"));
+        assert!(!valid_name("space rocks"));
+        assert!(!valid_name(""));
+    }
+
+    #[test]
+    fn projects_fill_in_the_name_and_sdk() {
+        let root = Path::new("/src/wasm96");
+        let rust = files("rocks", Lang::Rust, Some(root)).unwrap();
+        let manifest = &rust.iter().find(|f| f.0 == "Cargo.toml").unwrap().1;
+        assert!(manifest.contains("name = \"rocks\""));
+        assert!(manifest.contains("path = '/src/wasm96/wasm96-sdk'"));
+        assert!(rust.iter().all(|(_, text)| !text.contains("{name}")));
+        assert!(rust.iter().any(|f| f.0 == "assets/hello.txt"));
+
+        let published = files("rocks", Lang::Rust, None).unwrap();
+        assert!(published[0].1.contains("wasm96-sdk = \"0.1\""));
+
+        let zig = files("rocks", Lang::Zig, Some(root)).unwrap();
+        let build = &zig.iter().find(|f| f.0 == "build.zig").unwrap().1;
+        assert!(build.contains("\"/src/wasm96/wasm96-zig-sdk/src/main.zig\""));
+        assert!(build.contains(".name = \"rocks\""));
+        assert!(files("rocks", Lang::Zig, None).is_err());
+    }
+
+    #[test]
+    fn create_refuses_bad_names_and_busy_directories() {
+        let base = std::env::temp_dir().join(format!("wasm96-cli-new-{}", std::process::id()));
+        let _ = fs::remove_dir_all(&base);
+        let dir = base.join("rocks");
+        assert_eq!(create(&dir, Lang::Rust, None).unwrap(), "rocks");
+        assert!(dir.join("src/lib.rs").is_file());
+        assert!(create(&dir, Lang::Rust, None).is_err());
+        assert!(create(&base.join("9lives"), Lang::Rust, None).is_err());
+        fs::remove_dir_all(&base).unwrap();
+    }
+}
@@ -0,0 +1,251 @@
+//! Checking a compiled guest against the core's ABI before it ships.
+//!
+//! Errors are problems that stop the cart loading or running: a missing `setup`, an entry point
+//! the core can't call as `() -> ()`, imports the core doesn't define (or defines with another
+//! type), and a memory the host can't address. Warnings are carts that load but may not work as
+//! meant, like one with nothing to run after `setup` or no exported `memory` for the host to
+//! read strings and buffers from.
+
+use wasm96_core::HostSignature;
+use wasm96_core::abi::{IMPORT_MODULE, guest_exports};
+use wasm96_core::loader;
+
+use crate::wasm::{self, ExportKind, FuncType, ImportKind};
+
+/// Exports the core calls with no arguments, expecting no results.
+const ENTRY_POINTS: [&str; 9] = [
+    guest_exports::SETUP,
+    guest_exports::UPDATE,
+    guest_exports::DRAW,
+    guest_exports::ON_PAUSE,
+    guest_exports::ON_RESUME,
+    guest_exports::ON_QUIT,
+    guest_exports::ON_ROLLBACK,
+    guest_exports::WASI_START,
+    guest_exports::MAIN,
+];
+
+/// Exports the core calls every frame; a cart needs at least one.
+const PER_FRAME: [&str; 4] = [
+    guest_exports::UPDATE,
+    guest_exports::DRAW,
+    guest_exports::WASI_START,
+    guest_exports::MAIN,
+];
+
+/// The memory export host calls read guest strings and buffers from.
+const MEMORY_EXPORT: &str = "memory";
+
+/// Initial memories above this many 64 KiB pages (256 MiB) get a warning.
+const LARGE_MEMORY_PAGES: u64 = 4096;
+
+/// What `verify` found.
+#[derive(Debug, Default)]
+pub struct Report {
+    /// Problems that stop the cart loading or running.
+    pub errors: Vec<String>,
+    /// Things that may not work as meant.
+    pub warnings: Vec<String>,
+}
+
+/// Check `module` (WASM or WAT bytes) against the core's `host` imports. Fails only if the
+/// module can't be read.
+pub fn verify(module: &[u8], host: &[HostSignature]) -> Result<Report, String> {
+    let detected = loader::normalize_to_wasm(module).map_err(|e| e.to_string())?;
+    let module = wasm::parse(&detected.wasm_bytes)?;
+    let mut report = Report::default();
+    check_exports(&module, &mut report);
+    check_imports(&module, host, &mut report);
+    check_memory(&module, &mut report);
+    Ok(report)
+}
+
+fn check_exports(module: &wasm::Module, report: &mut Report) {
+    if !wasm::exports_func(&module.exports, guest_exports::SETUP) {
+        report.errors.push(format!(
+            "the module doesn't export `{}`, so the core can't start it",
+            guest_exports::SETUP
+        ));
+    }
+    let unit = FuncType::default();
+    for name in ENTRY_POINTS {
+        let Some(export) = module.export(name) else {
+            continue;
+        };
+        if export.kind != ExportKind::Func {
+            let kind = format!("{:?}", export.kind).to_lowercase();
+            report
+                .errors
+                .push(format!("`{name}` is exported as a {kind}, not a function"));
+            continue;
+        }
+        match module.func_type(export.index) {
+            Some(ty) if *ty != unit => report.errors.push(format!(
+                "`{name}` has type {ty}, but the core calls it as {unit}"
+            )),
+            Some(_) => {}
+            None => report.errors.push(format!(
+                "`{name}` exports a function the module doesn't have"
+            )),
+        }
+    }
+    if !PER_FRAME
+        .iter()
+        .any(|name| wasm::exports_func(&module.exports, name))
+    {
+        report.warnings.push(format!(
+            "the module exports none of {}; nothing runs after `setup`",
+            PER_FRAME.map(|name| format!("`{name}`")).join(", ")
+        ));
+    }
+}
+
+fn check_imports(module: &wasm::Module, host: &[HostSignature], report: &mut Report) {
+    for import in &module.imports {
+        let name = format!("{}.{}", import.module, import.name);
+        if import.module != IMPORT_MODULE {
+            report.errors.push(format!(
+                "imports `{name}`, but the core only provides `{IMPORT_MODULE}` imports (WASI \
+                 isn't available; build for a freestanding target)"
+            ));
+            continue;
+        }
+        let kind = match import.kind {
+            ImportKind::Func(ty) => Ok(ty),
+            ImportKind::Table => Err("table"),
+            ImportKind::Memory(_) => Err("memory"),
+            ImportKind::Global => Err("global"),
+            ImportKind::Tag => Err("tag"),
+        };
+        let ty = match kind {
+            Ok(ty) => ty,
+            Err(kind) => {
+                report.errors.push(format!(
+                    "imports `{name}` as a {kind}, but the core only provides functions"
+                ));
+                continue;
+            }
+        };
+        let Some(host) = host.iter().find(|h| h.name == import.name) else {
+            report.errors.push(format!(
+                "imports `{name}`, which this core doesn't define; the SDK may be newer than \
+                 the core"
+            ));
+            continue;
+        };
+        let expected = FuncType {
+            params: host.params.clone(),
+            results: host.results.clone(),
+        };
+        match module.types.get(ty as usize) {
+            Some(ty) if *ty != expected => report.errors.push(format!(
+                "imports `{name}` as {ty}, but the core defines it as {expected}"
+            )),
+            Some(_) => {}
+            None => report.errors.push(format!(
+                "imports `{name}` with a type the module doesn't have"
+            )),
+        }
+    }
+}
+
+fn check_memory(module: &wasm::Module, report: &mut Report) {
+    let memory = module
+        .export(MEMORY_EXPORT)
+        .filter(|e| e.kind == ExportKind::Memory)
+        .and_then(|e| module.memories.get(e.index as usize));
+    let Some(memory) = memory else {
+        report.warnings.push(format!(
+            "the module doesn't export a memory called `{MEMORY_EXPORT}`, so host calls that \
+             pass strings or buffers can't read them"
+        ));
+        return;
+    };
+    if memory.memory64 {
+        report.errors.push(format!(
+            "`{MEMORY_EXPORT}` is a 64-bit memory, but guest pointers in the ABI are 32-bit"
+        ));
+    }
+    if memory.shared {
+        report.warnings.push(format!(
+            "`{MEMORY_EXPORT}` is shared; the host doesn't synchronize with guest threads"
+        ));
+    }
+    if memory.min > LARGE_MEMORY_PAGES {
+        report.warnings.push(format!(
+            "`{MEMORY_EXPORT}` starts at {} MiB",
+            memory.min * 64 / 1024
+        ));
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::wasm::tests::{module, module_exporting};
+
+    const I32: u8 = 0x7F;
+    const F32: u8 = 0x7D;
+
+    fn host() -> Vec<HostSignature> {
+        vec![HostSignature {
+            name: "wasm96_graphics_set_size".to_string(),
+            params: vec!["i32".to_string(), "i32".to_string()],
+            results: vec![],
+        }]
+    }
+
+    #[test]
+    fn carts_need_setup_and_warn_without_a_frame_export() {
+        let report = verify(&module_exporting(&["draw"]), &host()).unwrap();
+        assert_eq!(report.errors.len(), 1);
+        let report = verify(&module_exporting(&["setup", "update"]), &host()).unwrap();
+        assert!(report.errors.is_empty() && report.warnings.is_empty());
+        let report = verify(&module_exporting(&["setup"]), &host()).unwrap();
+        assert_eq!(report.warnings.len(), 1);
+    }
+
+    #[test]
+    fn entry_points_and_imports_must_match_their_types() {
+        let wasm = module(
+            &[(&[], &[]), (&[I32, I32], &[]), (&[F32], &[I32])],
+            &[
+                ("wasm96_graphics_set_size", 1),
+                ("wasm96_graphics_set_depth", 0),
+                ("wasm96_input_axis", 0),
+            ],
+            &[("setup", 0), ("draw", 2)],
+            Some(&[0, 1]),
+        );
+        let host = [
+            host(),
+            vec![HostSignature {
+                name: "wasm96_input_axis".to_string(),
+                params: vec!["i32".to_string()],
+                results: vec!["f32".to_string()],
+            }],
+        ]
+        .concat();
+        let report = verify(&wasm, &host).unwrap();
+        assert_eq!(report.errors.len(), 3, "{:?}", report.errors);
+        assert!(report.errors[0].contains("`draw` has type (f32) -> (i32)"));
+        assert!(report.errors[1].contains("env.wasm96_graphics_set_depth"));
+        assert!(report.errors[2].contains("defines it as (i32) -> (f32)"));
+    }
+
+    #[test]
+    fn memory_must_be_exported_and_32_bit() {
+        let wasm = module(&[(&[], &[])], &[], &[("setup", 0), ("draw", 0)], None);
+        assert_eq!(verify(&wasm, &host()).unwrap().warnings.len(), 1);
+
+        let wasm = module(
+            &[(&[], &[])],
+            &[],
+            &[("setup", 0), ("draw", 0)],
+            Some(&[7, 0x81, 0x40, 0x81, 0x40]),
+        );
+        let report = verify(&wasm, &host()).unwrap();
+        assert_eq!(report.errors.len(), 1);
+        assert_eq!(report.warnings.len(), 2, "{:?}", report.warnings);
+    }
+}
@@ -0,0 +1,432 @@
+//! Just enough of the WebAssembly binary format to list a module's imports, exports, function
+//! types and memories.
+
+/// Kind of an exported item.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ExportKind {
+    Func,
+    Table,
+    Memory,
+    Global,
+    Tag,
+}
+
+/// One entry of the export section.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Export {
+    pub name: String,
+    pub kind: ExportKind,
+    /// Index into the module's functions, memories, ... of `kind`.
+    pub index: u32,
+}
+
+/// A function type, with value types written as in WAT (`i32`, `f64`, ...).
+#[derive(Debug, Clone, Default, PartialEq, Eq)]
+pub struct FuncType {
+    pub params: Vec<String>,
+    pub results: Vec<String>,
+}
+
+impl std::fmt::Display for FuncType {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        write!(
+            f,
+            "({}) -> ({})",
+            self.params.join(", "),
+            self.results.join(", ")
+        )
+    }
+}
+
+/// A memory's limits, in 64 KiB pages.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Memory {
+    pub min: u64,
+    pub max: Option<u64>,
+    pub shared: bool,
+    pub memory64: bool,
+}
+
+/// What an import brings in.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum ImportKind {
+    /// A function of the module's type at this index.
+    Func(u32),
+    Table,
+    Memory(Memory),
+    Global,
+    Tag,
+}
+
+/// One entry of the import section.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Import {
+    pub module: String,
+    pub name: String,
+    pub kind: ImportKind,
+}
+
+/// The parts of a module `wasm96 verify` looks at.
+#[derive(Debug, Default)]
+pub struct Module {
+    pub types: Vec<FuncType>,
+    pub imports: Vec<Import>,
+    /// Type index of every function, imported ones first.
+    pub funcs: Vec<u32>,
+    /// Every memory, imported ones first.
+    pub memories: Vec<Memory>,
+    pub exports: Vec<Export>,
+}
+
+impl Module {
+    /// The type of the function at `index`, if the module has it.
+    pub fn func_type(&self, index: u32) -> Option<&FuncType> {
+        let ty = *self.funcs.get(index as usize)?;
+        self.types.get(ty as usize)
+    }
+
+    /// The export called `name`.
+    pub fn export(&self, name: &str) -> Option<&Export> {
+        self.exports.iter().find(|e| e.name == name)
+    }
+}
+
+const TYPE_SECTION: u8 = 1;
+const IMPORT_SECTION: u8 = 2;
+const FUNCTION_SECTION: u8 = 3;
+const MEMORY_SECTION: u8 = 5;
+const EXPORT_SECTION: u8 = 7;
+
+/// Decode an unsigned LEB128 `u32`, returning it and the bytes after it.
+fn read_leb_u32(data: &[u8]) -> Option<(u32, &[u8])> {
+    let mut value = 0u32;
+    for (i, &byte) in data.iter().enumerate().take(5) {
+        value |= ((byte & 0x7F) as u32) << (7 * i);
+        if byte & 0x80 == 0 {
+            return Some((value, &data[i + 1..]));
+        }
+    }
+    None
+}
+
+/// Decode an unsigned LEB128 `u64`, returning it and the bytes after it.
+fn read_leb_u64(data: &[u8]) -> Option<(u64, &[u8])> {
+    let mut value = 0u64;
+    for (i, &byte) in data.iter().enumerate().take(10) {
+        value |= ((byte & 0x7F) as u64) << (7 * i);
+        if byte & 0x80 == 0 {
+            return Some((value, &data[i + 1..]));
+        }
+    }
+    None
+}
+
+fn read_name(data: &[u8]) -> Option<(String, &[u8])> {
+    let (len, rest) = read_leb_u32(data)?;
+    let bytes = rest.get(..len as usize)?;
+    let name = String::from_utf8(bytes.to_vec()).ok()?;
+    Some((name, &rest[len as usize..]))
+}
+
+/// Payloads of the sections with `id`, in module order.
+fn sections(wasm: &[u8], id: u8) -> Result<Vec<&[u8]>, String> {
+    if !wasm.starts_with(b"\0asm") || wasm.len() < 8 {
+        return Err("not a WebAssembly binary".to_string());
+    }
+    let mut found = Vec::new();
+    let mut rest = &wasm[8..];
+    while let Some((&section_id, after_id)) = rest.split_first() {
+        let (size, body) = read_leb_u32(after_id).ok_or("truncated section header")?;
+        let payload = body.get(..size as usize).ok_or("truncated section")?;
+        rest = &body[size as usize..];
+        if section_id == id {
+            found.push(payload);
+        }
+    }
+    Ok(found)
+}
+
+/// A value type, by its WAT name.
+fn read_val_type(data: &[u8]) -> Result<(String, &[u8]), String> {
+    let (&code, rest) = data.split_first().ok_or("truncated value type")?;
+    let name = match code {
+        0x7F => "i32",
+        0x7E => "i64",
+        0x7D => "f32",
+        0x7C => "f64",
+        0x7B => "v128",
+        0x70 => "funcref",
+        0x6F => "externref",
+        other => {
+            return Err(format!(
+                "value type 0x{other:02x} isn't supported by this check"
+            ));
+        }
+    };
+    Ok((name.to_string(), rest))
+}
+
+fn read_val_types(data: &[u8]) -> Result<(Vec<String>, &[u8]), String> {
+    let (count, mut rest) = read_leb_u32(data).ok_or("bad type list")?;
+    let mut types = Vec::new();
+    for _ in 0..count {
+        let (ty, after) = read_val_type(rest)?;
+        types.push(ty);
+        rest = after;
+    }
+    Ok((types, rest))
+}
+
+/// Table or memory limits: flags (bit 0: has a maximum, bit 1: shared, bit 2: 64-bit), then
+/// the minimum and maybe the maximum.
+fn read_limits(data: &[u8]) -> Result<(Memory, &[u8]), String> {
+    let (&flags, rest) = data.split_first().ok_or("truncated limits")?;
+    let (min, mut rest) = read_leb_u64(rest).ok_or("bad limits")?;
+    let mut max = None;
+    if flags & 1 != 0 {
+        let (value, after) = read_leb_u64(rest).ok_or("bad limits")?;
+        max = Some(value);
+        rest = after;
+    }
+    let memory = Memory {
+        min,
+        max,
+        shared: flags & 2 != 0,
+        memory64: flags & 4 != 0,
+    };
+    Ok((memory, rest))
+}
+
+/// The sections of `wasm` that `wasm96 verify` checks.
+pub fn parse(wasm: &[u8]) -> Result<Module, String> {
+    let mut module = Module {
+        exports: exports(wasm)?,
+        ..Module::default()
+    };
+    for payload in sections(wasm, TYPE_SECTION)? {
+        let (count, mut rest) = read_leb_u32(payload).ok_or("bad type section")?;
+        for _ in 0..count {
+            match rest.split_first() {
+                Some((0x60, after)) => {
+                    let (params, after) = read_val_types(after)?;
+                    let (results, after) = read_val_types(after)?;
+                    module.types.push(FuncType { params, results });
+                    rest = after;
+                }
+                _ => return Err("the module defines GC types, which this check can't read".into()),
+            }
+        }
+    }
+    for payload in sections(wasm, IMPORT_SECTION)? {
+        let (count, mut rest) = read_leb_u32(payload).ok_or("bad import section")?;
+        for _ in 0..count {
+            let (module_name, after) = read_name(rest).ok_or("bad import module")?;
+            let (name, after) = read_name(after).ok_or("bad import name")?;
+            let (&kind, after) = after.split_first().ok_or("bad import kind")?;
+            let (kind, after) = match kind {
+                0 => {
+                    let (ty, after) = read_leb_u32(after).ok_or("bad import type")?;
+                    module.funcs.push(ty);
+                    (ImportKind::Func(ty), after)
+                }
+                1 => {
+                    let (_, after) = read_val_type(after)?;
+                    (ImportKind::Table, read_limits(after)?.1)
+                }
+                2 => {
+                    let (memory, after) = read_limits(after)?;
+                    module.memories.push(memory);
+                    (ImportKind::Memory(memory), after)
+                }
+                3 => {
+                    let (_, after) = read_val_type(after)?;
+                    (
+                        ImportKind::Global,
+                        after.get(1..).ok_or("bad import global")?,
+                    )
+                }
+                4 => {
+                    let after = after.get(1..).ok_or("bad import tag")?;
+                    (
+                        ImportKind::Tag,
+                        read_leb_u32(after).ok_or("bad import tag")?.1,
+                    )
+                }
+                other => return Err(format!("unknown import kind {other}")),
+            };
+            module.imports.push(Import {
+                module: module_name,
+                name,
+                kind,
+            });
+            rest = after;
+        }
+    }
+    for payload in sections(wasm, FUNCTION_SECTION)? {
+        let (count, mut rest) = read_leb_u32(payload).ok_or("bad function section")?;
+        for _ in 0..count {
+            let (ty, after) = read_leb_u32(rest).ok_or("bad function type")?;
+            module.funcs.push(ty);
+            rest = after;
+        }
+    }
+    for payload in sections(wasm, MEMORY_SECTION)? {
+        let (count, mut rest) = read_leb_u32(payload).ok_or("bad memory section")?;
+        for _ in 0..count {
+            let (memory, after) = read_limits(rest)?;
+            module.memories.push(memory);
+            rest = after;
+        }
+    }
+    Ok(module)
+}
+
+/// Every export of the module in `wasm`.
+pub fn exports(wasm: &[u8]) -> Result<Vec<Export>, String> {
+    let mut exports = Vec::new();
+    for payload in sections(wasm, EXPORT_SECTION)? {
+        let (count, mut rest) = read_leb_u32(payload).ok_or("bad export section")?;
+        for _ in 0..count {
+            let (name, after_name) = read_name(rest).ok_or("bad export name")?;
+            let (&kind, after_kind) = after_name.split_first().ok_or("bad export kind")?;
+            let (index, after_index) = read_leb_u32(after_kind).ok_or("bad export index")?;
+            rest = after_index;
+            let kind = match kind {
+                0 => ExportKind::Func,
+                1 => ExportKind::Table,
+                2 => ExportKind::Memory,
+                3 => ExportKind::Global,
+                4 => ExportKind::Tag,
+                other => return Err(format!("unknown export kind {other}")),
+            };
+            exports.push(Export { name, kind, index });
+        }
+    }
+    Ok(exports)
+}
+
+/// Whether `exports` include a function called `name`.
+pub fn exports_func(exports: &[Export], name: &str) -> bool {
+    exports
+        .iter()
+        .any(|e| e.name == name && e.kind == ExportKind::Func)
+}
+
+#[cfg(test)]
+pub(crate) mod tests {
+    use super::*;
+
+    /// A module with one `() -> ()` function per name in `funcs`, exported under that name, and
+    /// an exported memory.
+    pub(crate) fn module_exporting(funcs: &[&str]) -> Vec<u8> {
+        let funcs: Vec<_> = funcs.iter().map(|name| (*name, 0)).collect();
+        module(&[(&[], &[])], &[], &funcs, Some(&[0, 1]))
+    }
+
+    /// A module with function `types` as `(params, results)` value type codes, functions
+    /// imported from `env` as `(name, type)`, functions defined and exported as `(name, type)`,
+    /// and a memory with the `memory` limits bytes exported as `memory`.
+    pub(crate) fn module(
+        types: &[(&[u8], &[u8])],
+        imports: &[(&str, u8)],
+        funcs: &[(&str, u8)],
+        memory: Option<&[u8]>,
+    ) -> Vec<u8> {
+        let section = |id: u8, body: Vec<u8>| {
+            let mut s = vec![id, body.len() as u8];
+            s.extend(body);
+            s
+        };
+        let name = |name: &str| [&[name.len() as u8], name.as_bytes()].concat();
+        let mut wasm = b"\0asm\x01\0\0\0".to_vec();
+
+        let mut type_section = vec![types.len() as u8];
+        for (params, results) in types {
+            type_section.push(0x60);
+            type_section.extend([&[params.len() as u8], *params].concat());
+            type_section.extend([&[results.len() as u8], *results].concat());
+        }
+        wasm.extend(section(1, type_section));
+
+        let mut import_section = vec![imports.len() as u8];
+        for (field, ty) in imports {
+            import_section.extend(name("env"));
+            import_section.extend(name(field));
+            import_section.extend([0, *ty]);
+        }
+        wasm.extend(section(2, import_section));
+
+        let n = funcs.len() as u8;
+        let func_types = funcs.iter().map(|f| f.1);
+        wasm.extend(section(3, [n].into_iter().chain(func_types).collect()));
+        if let Some(limits) = memory {
+            wasm.extend(section(5, [&[1], limits].concat()));
+        }
+
+        let mut exports = vec![n + memory.is_some() as u8];
+        for (i, (field, _)) in funcs.iter().enumerate() {
+            exports.extend(name(field));
+            exports.extend([0, (imports.len() + i) as u8]);
+        }
+        if memory.is_some() {
+            exports.extend(name("memory"));
+            exports.extend([2, 0]);
+        }
+        wasm.extend(section(7, exports));
+
+        // `unreachable` bodies are valid for any signature.
+        let mut code = vec![n];
+        for _ in 0..n {
+            code.extend([3, 0, 0x00, 0x0B]);
+        }
+        wasm.extend(section(10, code));
+        wasm
+    }
+
+    #[test]
+    fn lists_exports_with_their_kinds() {
+        let wasm = module_exporting(&["setup", "draw"]);
+        let exports = exports(&wasm).unwrap();
+        assert_eq!(exports.len(), 3);
+        assert!(exports_func(&exports, "setup"));
+        assert!(exports_func(&exports, "draw"));
+        assert!(!exports_func(&exports, "update"));
+        assert!(!exports_func(&exports, "memory"));
+        assert_eq!(exports[2].kind, ExportKind::Memory);
+    }
+
+    #[test]
+    fn reads_types_imports_and_memories() {
+        let wasm = module(
+            &[(&[], &[]), (&[0x7F, 0x7C], &[0x7E])],
+            &[("wasm96_graphics_point", 1)],
+            &[("setup", 0), ("score", 1)],
+            Some(&[5, 2, 4]),
+        );
+        let module = parse(&wasm).unwrap();
+        assert_eq!(module.imports[0].module, "env");
+        assert_eq!(module.imports[0].kind, ImportKind::Func(1));
+        assert_eq!(module.funcs, [1, 0, 1]);
+        let score = module.export("score").unwrap();
+        assert_eq!(score.index, 2);
+        assert_eq!(
+            module.func_type(score.index).unwrap().to_string(),
+            "(i32, f64) -> (i64)"
+        );
+        assert_eq!(
+            module.memories,
+            [Memory {
+                min: 2,
+                max: Some(4),
+                shared: false,
+                memory64: true,
+            }]
+        );
+    }
+
+    #[test]
+    fn rejects_non_modules() {
+        assert!(exports(b"(module)").is_err());
+        assert!(exports(b"\0asm\x01\0\0\0\x07\x05\x01").is_err());
+    }
+}
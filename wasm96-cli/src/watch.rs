@@ -0,0 +1,66 @@
+//! `wasm96 run --watch`: noticing when a project's sources change.
+//!
+//! The frontend runs with `WASM96_HOT_RELOAD=1`, so the core swaps in the cart file whenever
+//! it's rewritten; `run` packs the project again each time `newest_change` moves.
+
+use std::fs;
+use std::path::Path;
+use std::time::{Duration, SystemTime};
+
+/// How often the project is checked for changes.
+pub const INTERVAL: Duration = Duration::from_millis(500);
+
+/// Environment variable turning on the core's hot reload.
+pub const HOT_RELOAD_ENV: &str = "WASM96_HOT_RELOAD";
+
+/// Build output and tool directories whose changes don't need a rebuild.
+const SKIPPED_DIRS: [&str; 4] = ["target", "zig-out", "zig-cache", "node_modules"];
+
+/// The latest modification time of the project's sources and assets under `dir`. Dotfiles,
+/// build output, built modules and packed carts are skipped, so packing doesn't trigger
+/// another pack.
+pub fn newest_change(dir: &Path) -> Option<SystemTime> {
+    let mut newest = None;
+    for entry in fs::read_dir(dir).ok()?.flatten() {
+        let name = entry.file_name().to_string_lossy().into_owned();
+        if name.starts_with('.') || name.ends_with(".w96") || name.ends_with(".wasm") {
+            continue;
+        }
+        let path = entry.path();
+        let modified = if path.is_dir() {
+            if SKIPPED_DIRS.contains(&name.as_str()) {
+                continue;
+            }
+            newest_change(&path)
+        } else {
+            entry.metadata().and_then(|m| m.modified()).ok()
+        };
+        newest = newest.max(modified);
+    }
+    newest
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn ignores_build_output_and_carts() {
+        let dir = std::env::temp_dir().join(format!("wasm96-cli-watch-{}", std::process::id()));
+        let _ = fs::remove_dir_all(&dir);
+        fs::create_dir_all(dir.join("src")).unwrap();
+        fs::create_dir_all(dir.join("target")).unwrap();
+        fs::write(dir.join("src/lib.rs"), "").unwrap();
+        let before = newest_change(&dir).unwrap();
+
+        std::thread::sleep(Duration::from_millis(20));
+        fs::write(dir.join("target/out.wasm"), "").unwrap();
+        fs::write(dir.join("game.w96"), "").unwrap();
+        fs::write(dir.join("game.wasm"), "").unwrap();
+        assert_eq!(newest_change(&dir), Some(before));
+
+        fs::write(dir.join("src/lib.rs"), "// edited").unwrap();
+        assert!(newest_change(&dir).unwrap() > before);
+        fs::remove_dir_all(&dir).unwrap();
+    }
+}
@@ -13,7 +13,32 @@
 //!
 //! ### Graphics
 //! - `wasm96_graphics_set_size(width: u32, height: u32)`
+//!   - callable at any time; clears the framebuffer; clamped to 1920x1080
 //! - `wasm96_graphics_set_color(r: u32, g: u32, b: u32, a: u32)`
+//! - `wasm96_graphics_set_tint(r: u32, g: u32, b: u32, a: u32)`
+//!   - multiplies image/GIF/SVG pixels; alpha < 255 blends them (255,255,255,255 = off)
+//! - `wasm96_graphics_set_post_effect(effect: u32, strength: f32)`
+//!   - filter for the presented frame: 0 none, 1 scanlines, 2 CRT, 3 bloom, 4 grayscale,
+//!     5 dither; strength 0..=1 (2D frames only)
+//! - `wasm96_graphics_color_grade_set(ptr: u32, len: u32) -> u32`
+//!   - color grade for the presented frame, after the post effect: 256 bytes (one remap table for
+//!     every channel), 768 bytes (256 RGB entries, each channel remapped through its own
+//!     column), or size^3 RGB triples with red varying fastest (a 3D LUT, size 2..=64); len 0
+//!     removes it; 1 = set, 0 = not a grade (2D frames only)
+//! - `wasm96_graphics_set_scaling_mode(mode: u32)`
+//!   - how the framebuffer fits a fixed window size: 0 fit (letterboxed), 1 integer scale,
+//!     2 stretch (2D frames only)
+//! - `wasm96_graphics_window_size() -> u64` (`(width << 32) | height`)
+//!   - the window size core option; the framebuffer size when it is `native`
+//! - `wasm96_graphics_set_fullscreen(enabled: u32)`
+//!   - present at the full display size (1920x1080) instead of the window size option
+//! - `wasm96_graphics_fullscreen() -> u32` (1 if fullscreen was asked for)
+//! - `wasm96_graphics_resized() -> u32`
+//!   - 1 during the first tick after the framebuffer or window changed size
+//! - `wasm96_graphics_set_line_width(px: u32)`
+//!   - stroke width for lines and outlines (clamped to 1..=64)
+//! - `wasm96_graphics_set_line_style(style: u32)`
+//!   - 0 = solid, 1 = dashed, 2 = dotted (unknown values = solid)
 //! - `wasm96_graphics_background(r: u32, g: u32, b: u32)`
 //! - `wasm96_graphics_point(x: i32, y: i32)`
 //! - `wasm96_graphics_line(x1: i32, y1: i32, x2: i32, y2: i32)`
@@ -21,28 +46,174 @@
 //! - `wasm96_graphics_rect_outline(x: i32, y: i32, w: u32, h: u32)`
 //! - `wasm96_graphics_circle(x: i32, y: i32, r: u32)`
 //! - `wasm96_graphics_circle_outline(x: i32, y: i32, r: u32)`
+//! - `wasm96_graphics_rect_gradient(x: i32, y: i32, w: u32, h: u32, tl: u32, tr: u32, bl: u32, br: u32)`
+//! - `wasm96_graphics_circle_gradient(x: i32, y: i32, r: u32, inner: u32, outer: u32)`
+//!   - gradient colors are packed 0xRRGGBBAA
+//! - `wasm96_graphics_ellipse(x: i32, y: i32, rx: u32, ry: u32)`
+//! - `wasm96_graphics_ellipse_outline(x: i32, y: i32, rx: u32, ry: u32)`
+//! - `wasm96_graphics_arc(x: i32, y: i32, r: u32, start: f32, end: f32)`
+//! - `wasm96_graphics_arc_filled(x: i32, y: i32, r: u32, start: f32, end: f32)` (pie slice)
+//!   - angles in radians, clockwise from +x (screen y points down)
+//!
+//! Vertex buffers (`ptr` points to `count` pairs of little-endian `i32` x, y):
+//! - `wasm96_graphics_polygon(ptr: u32, count: u32)`
+//!   - filled, even-odd rule
+//! - `wasm96_graphics_polyline(ptr: u32, count: u32, closed: u32)`
 //!
 //! Raw RGBA blit:
 //! - `wasm96_graphics_image(x: i32, y: i32, w: u32, h: u32, ptr: u32, len: u32)`
 //!
+//! Direct framebuffer access (RGBA8888, alpha = framebuffer overlay alpha):
+//! - `wasm96_graphics_framebuffer_write(x: i32, y: i32, w: u32, h: u32, ptr: u32, len: u32)`
+//!   - copies every pixel, so a block read back with `framebuffer_read` round-trips exactly
+//! - `wasm96_graphics_framebuffer_read(x: i32, y: i32, w: u32, h: u32, ptr: u32, len: u32) -> u32`
+//!   - fills the guest buffer; returns bytes written (0 if `len < w*h*4`)
+//!
 //! One-shot (decode and draw at natural size):
 //! - `wasm96_graphics_image_png(x: i32, y: i32, ptr: u32, len: u32)`
 //! - `wasm96_graphics_image_jpeg(x: i32, y: i32, ptr: u32, len: u32)`
 //!
 //! Keyed resources (no numeric ids required in the guest):
+//! - `wasm96_graphics_last_error() -> u32` (why the last register call failed: 0 none, 1 guest
+//!   memory, 2 invalid data, 3 missing dependency, 4 unsupported)
 //! - `wasm96_graphics_svg_register(key: u64, data_ptr: u32, data_len: u32) -> u32` (bool)
 //! - `wasm96_graphics_svg_draw_key(key: u64, x: i32, y: i32, w: u32, h: u32)`
 //! - `wasm96_graphics_svg_unregister(key: u64)`
+//! - `wasm96_graphics_svg_size(key: u64) -> u64` (intrinsic size: `(width << 32) | height`;
+//!   0 if unknown)
+//! - `wasm96_graphics_svg_set_fill(key: u64, selector_ptr: u32, selector_len: u32, color: u32) -> u32`
+//!   (`#id`, `.class` or a bare name matching either; color 0xRRGGBBAA; returns elements recolored)
 //!
 //! - `wasm96_graphics_gif_register(key: u64, data_ptr: u32, data_len: u32) -> u32` (bool)
 //! - `wasm96_graphics_gif_draw_key(key: u64, x: i32, y: i32)`
 //! - `wasm96_graphics_gif_draw_key_scaled(key: u64, x: i32, y: i32, w: u32, h: u32)`
 //! - `wasm96_graphics_gif_unregister(key: u64)`
+//! - `wasm96_graphics_gif_frame_count(key: u64) -> u32`
+//! - `wasm96_graphics_gif_frame_delay(key: u64, frame: u32) -> u32` (milliseconds)
+//! - `wasm96_graphics_gif_draw_frame(key: u64, frame: u32, x: i32, y: i32, w: u32, h: u32)`
+//!   (`w`/`h` of 0 = natural size)
+//! - `wasm96_graphics_gif_draw_ex(key: u64, x: i32, y: i32, w: u32, h: u32, angle: f32, flags: u32, pivot_x: i32, pivot_y: i32)`
+//!   (see `image_draw_ex`; frame chosen by the host clock)
+//! - `wasm96_graphics_gif_set_frame(key: u64, frame: u32)` (jump playback to a frame's start)
+//! - `wasm96_graphics_gif_set_speed(key: u64, multiplier: f32)` (1 = normal, 0 = frozen)
+//! - `wasm96_graphics_gif_pause(key: u64, paused: u32)` (bool)
+//!
+//! - `wasm96_graphics_aseprite_register(key: u64, data_ptr: u32, data_len: u32) -> u32` (bool;
+//!   `.ase`/`.aseprite` with RGBA, grayscale or indexed color; see `av::aseprite`)
+//! - `wasm96_graphics_aseprite_unregister(key: u64)`
+//! - `wasm96_graphics_aseprite_size(key: u64) -> u64` (`(width << 32) | height`; 0 if unknown)
+//! - `wasm96_graphics_aseprite_frame_count(key: u64) -> u32`
+//! - `wasm96_graphics_aseprite_frame_duration(key: u64, frame: u32) -> u32` (milliseconds)
+//! - `wasm96_graphics_aseprite_tag_duration(key: u64, tag_ptr: u32, tag_len: u32) -> u32`
+//!   (milliseconds of one pass; 0 = no such tag; the empty name means every frame)
+//! - `wasm96_graphics_aseprite_draw_frame(key: u64, frame: u32, x: i32, y: i32)` (wraps around)
+//! - `wasm96_graphics_aseprite_draw_tag(key: u64, tag_ptr: u32, tag_len: u32, millis: u32, x: i32, y: i32) -> u32`
+//!   (draws the frame the tag shows `millis` after it started, following its direction and
+//!   repeat count; returns that frame, or `u32::MAX` if there is no such sprite or tag)
+//! - `wasm96_graphics_aseprite_set_layer_visible(key: u64, name_ptr: u32, name_len: u32, visible: u32) -> u32`
+//!   (layers with that name matched; every frame is re-composited)
+//!
+//! - `wasm96_graphics_map_load(key: u64, path_ptr: u32, path_len: u32, level_ptr: u32, level_len: u32) -> u32`
+//!   (bool; a Tiled `.tmx`/`.tmj` or LDtk `.ldtk` file in the cart bundle, with the tileset
+//!   images it uses; `level` picks an LDtk level, empty = the first; see `av::tilemap`)
+//! - `wasm96_graphics_map_register(key: u64, data_ptr: u32, data_len: u32, level_ptr: u32, level_len: u32) -> u32`
+//!   (bool; the same from guest memory, with paths relative to the bundle root)
+//! - `wasm96_graphics_map_unregister(key: u64)`
+//! - `wasm96_graphics_map_size(key: u64) -> u64` (`(columns << 32) | rows`; 0 if unknown)
+//! - `wasm96_graphics_map_tile_size(key: u64) -> u64` (`(width << 32) | height`; 0 if unknown)
+//! - `wasm96_graphics_map_layer_count(key: u64) -> u32` (tile layers, bottom to top)
+//! - `wasm96_graphics_map_layer_index(key: u64, name_ptr: u32, name_len: u32) -> i32` (-1 if none)
+//! - `wasm96_graphics_map_tile(key: u64, layer: u32, column: u32, row: u32) -> u32`
+//!   (tile id without flip flags, or the LDtk IntGrid value; 0 = empty)
+//! - `wasm96_graphics_map_objects(key: u64) -> u32` (blob id of the object layers' objects; 0
+//!   if none)
+//! - `wasm96_graphics_map_draw(key: u64, x: i32, y: i32)` (visible tile layers)
+//! - `wasm96_graphics_map_draw_layer(key: u64, layer: u32, x: i32, y: i32)`
 //!
 //! - `wasm96_graphics_png_register(key: u64, data_ptr: u32, data_len: u32) -> u32` (bool)
 //! - `wasm96_graphics_png_draw_key(key: u64, x: i32, y: i32)`
 //! - `wasm96_graphics_png_draw_key_scaled(key: u64, x: i32, y: i32, w: u32, h: u32)`
 //! - `wasm96_graphics_png_unregister(key: u64)`
+//! - `wasm96_graphics_image_draw_region(key: u64, sx: i32, sy: i32, sw: u32, sh: u32, x: i32, y: i32, w: u32, h: u32)`
+//!   (any keyed PNG/JPEG; `w`/`h` of 0 = region size)
+//! - `wasm96_graphics_image_draw_ex(key: u64, x: i32, y: i32, w: u32, h: u32, angle: f32, flags: u32, pivot_x: i32, pivot_y: i32)`
+//!   (any keyed PNG/JPEG scaled to `w`x`h`, 0 = natural; `flags`: 1 = flip x, 2 = flip y; rotated
+//!   `angle` radians clockwise around the pivot, measured from the unrotated top-left at (x, y))
+//! - `wasm96_graphics_image_draw_nine_slice(key: u64, x: i32, y: i32, w: u32, h: u32, left: u32, top: u32, right: u32, bottom: u32)`
+//!   (corners keep their size, edges and center stretch; insets are in source pixels)
+//! - `wasm96_graphics_image_draw_batch(key: u64, ptr: u32, count: u32)`
+//!   (`count` packed 32-byte instances: x `i32`, y `i32`, sx `i32`, sy `i32`, sw `u32`, sh `u32`,
+//!   angle `f32`, tint `u32` 0xRRGGBBAA; sw/sh of 0 = whole image; rotation is about the center)
+//!
+//! Palette mode (indexed images are colored through the palette when drawn):
+//! - `wasm96_graphics_palette_set(index: u32, r: u32, g: u32, b: u32)`
+//! - `wasm96_graphics_palette_swap(from: u32, to: u32)` (draw `from` with `to`'s color)
+//! - `wasm96_graphics_palette_set_transparent(index: u32, transparent: u32)` (index 0 by default)
+//! - `wasm96_graphics_palette_reset()` (undo swaps and transparency; colors are kept)
+//! - `wasm96_graphics_set_color_index(index: u32)` (draw color from the palette)
+//! - `wasm96_graphics_indexed_register(key: u64, width: u32, height: u32, data_ptr: u32, data_len: u32) -> u32`
+//!   (bool; one index byte per pixel, row-major)
+//! - `wasm96_graphics_indexed_draw(key: u64, x: i32, y: i32)`
+//! - `wasm96_graphics_indexed_unregister(key: u64)`
+//!
+//! Particles (keyed host-simulated systems):
+//! - `wasm96_graphics_particles_create(key: u64, config_ptr: u32, config_len: u32) -> u32` (bool)
+//!   (60-byte config: life min/max ms `u32`, speed min/max `f32`, direction `f32`, spread `f32`,
+//!   gravity x/y `f32`, drag `f32`, start/end color `u32` 0xRRGGBBAA, start/end size `f32`,
+//!   max particles `u32`, shape `u32` 0 square / 1 circle)
+//! - `wasm96_graphics_particles_emit(key: u64, x: i32, y: i32, count: u32)`
+//! - `wasm96_graphics_particles_update_and_draw(key: u64)` (steps by the tick's delta time)
+//! - `wasm96_graphics_particles_count(key: u64) -> u32`
+//! - `wasm96_graphics_particles_clear(key: u64)`
+//! - `wasm96_graphics_particles_destroy(key: u64)`
+//!
+//! 2D camera (world-space drawing until reset; applies to every 2D draw import):
+//! - `wasm96_graphics_camera_set(x: f32, y: f32, zoom: f32, rotation: f32)` (world point at
+//!   the screen center; zoom 0.25..=64; rotation in radians, clockwise)
+//! - `wasm96_graphics_camera_set_bounds(x: i32, y: i32, w: u32, h: u32)` (keep the view inside;
+//!   0 width/height removes the bounds)
+//! - `wasm96_graphics_camera_shake(magnitude: f32, duration_ms: u32)` (screen pixels, decaying)
+//! - `wasm96_graphics_camera_reset()` (back to screen coordinates)
+//! - `wasm96_graphics_screen_to_world(x: f32, y: f32) -> u64` (world point under a screen
+//!   position, packed as `f32` bits: x high, y low; identity without a camera)
+//! - `wasm96_graphics_world_to_screen(x: f32, y: f32) -> u64` (same packing)
+//!
+//! Draw layers (composited over the screen when `draw` returns; 16 layers):
+//! - `wasm96_graphics_layer_begin(index: u32)` (following 2D draws go to the layer, which
+//!   starts each frame empty)
+//! - `wasm96_graphics_layer_end()` (back to the screen)
+//! - `wasm96_graphics_layer_set_visible(index: u32, visible: u32)`
+//! - `wasm96_graphics_layer_set_parallax(index: u32, factor: f32)` (fraction of the 2D camera
+//!   position the layer follows; default 1)
+//! - `wasm96_graphics_layer_set_order(index: u32, order: i32)` (lower is further back; default
+//!   the index)
+//!
+//! Clip masks (in screen pixels; 2D draws only):
+//! - `wasm96_graphics_mask_begin()` (following 2D draws mark the mask's pixels instead of
+//!   drawing; replaces the previous mask)
+//! - `wasm96_graphics_mask_end()` (back to drawing)
+//! - `wasm96_graphics_mask_use(invert: u32)` (clip following 2D draws to the mask, or to outside
+//!   it when `invert` is 1)
+//! - `wasm96_graphics_mask_off()` (stop clipping; the mask is kept)
+//!
+//! Vector paths (built in world coordinates like other 2D draws; curves are flattened by the
+//! host; the path is kept after drawing until the next `path_begin`):
+//! - `wasm96_graphics_path_begin()` (clear the path)
+//! - `wasm96_graphics_path_move_to(x: f32, y: f32)` (start a subpath)
+//! - `wasm96_graphics_path_line_to(x: f32, y: f32)`
+//! - `wasm96_graphics_path_curve_to(cx1: f32, cy1: f32, cx2: f32, cy2: f32, x: f32, y: f32)`
+//!   (cubic Bézier)
+//! - `wasm96_graphics_path_close()` (join the subpath back to its start)
+//! - `wasm96_graphics_path_fill(even_odd: u32)` (fill with the draw color; 0 = nonzero winding,
+//!   1 = even-odd; every subpath is closed for filling)
+//! - `wasm96_graphics_path_stroke()` (outline with the current line width and style)
+//!
+//! Screen transitions (cover the presented frame with the draw color, then reveal it; 2D frames
+//! only):
+//! - `wasm96_graphics_transition_start(kind: u32, duration_ms: u32)` (0 fade, 1 dither wipe,
+//!   2 pixelate, 3 iris)
+//! - `wasm96_graphics_transition_active() -> u32` (bool)
+//! - `wasm96_graphics_transition_midpoint() -> u32` (bool; the tick the screen is fully covered)
 //!
 //! - `wasm96_graphics_jpeg_register(key: u64, data_ptr: u32, data_len: u32) -> u32` (bool)
 //! - `wasm96_graphics_jpeg_draw_key(key: u64, x: i32, y: i32)`
@@ -54,30 +225,219 @@
 //! - `wasm96_graphics_jpeg_draw_key_scaled(key: u64, x: i32, y: i32, w: u32, h: u32)`
 //! - `wasm96_graphics_jpeg_unregister(key: u64)`
 //!
+//! - `wasm96_graphics_image_register_async(key: u64, data_ptr: u32, data_len: u32) -> u32`
+//!   - PNG or JPEG (detected by magic), decoded in the background; returns a load handle for
+//!     `wasm96_system_load_status` (0 = unreadable memory). The key draws nothing until ready.
+//!
 //! Fonts (keyed; special key `"spleen"` refers to the built-in Spleen font):
 //! - `wasm96_graphics_font_register_ttf(key: u64, data_ptr: u32, data_len: u32) -> u32` (bool)
 //! - `wasm96_graphics_font_register_bdf(key: u64, data_ptr: u32, data_len: u32) -> u32` (bool)
+//! - `wasm96_graphics_font_register_fnt(key: u64, data_ptr: u32, data_len: u32, atlas_key: u64) -> u32`
+//!   (bool; AngelCode text `.fnt`, atlas registered as a PNG/JPEG)
 //! - `wasm96_graphics_font_register_spleen(key: u64, size: u32) -> u32` (bool)
 //! - `wasm96_graphics_font_unregister(key: u64)`
+//! - `wasm96_graphics_font_add_fallback(primary: u64, fallback: u64) -> u32` (bool)
+//!   (characters `primary` lacks are drawn with `fallback`; tried in the order added)
 //! - `wasm96_graphics_text_key(x: i32, y: i32, font_key: u64, text_ptr: u32, text_len: u32)`
 //! - `wasm96_graphics_text_measure_key(font_key: u64, text_ptr: u32, text_len: u32) -> u64`
+//! - `wasm96_graphics_text_sized_key(x: i32, y: i32, font_key: u64, size_px: u32, text_ptr: u32, text_len: u32)`
+//! - `wasm96_graphics_text_measure_sized_key(font_key: u64, size_px: u32, text_ptr: u32, text_len: u32) -> u64`
+//!   (draw/measure at `size_px`; TTF is rasterized at that size, bitmap fonts are scaled; `0` =
+//!   native size)
+//! - `wasm96_graphics_text_measure_up_to_key(font_key: u64, text_ptr: u32, text_len: u32, byte_offset: u32) -> u32`
+//!   (width of the text before `byte_offset`)
+//! - `wasm96_graphics_font_metrics_key(font_key: u64) -> u64`
+//!   (`(ascent << 32) | (descent << 16) | line_gap`)
+//! - `wasm96_graphics_set_text_scale(multiplier: f32)`
+//!   (multiplies the size of all text drawn and measured afterwards, and the font metrics;
+//!   clamped to 0.25..=8, non-positive or non-finite resets to 1)
+//! - `wasm96_graphics_font_register_ttf_sdf(key: u64, data_ptr: u32, data_len: u32) -> u32`
+//!   (bool; a TTF/OTF drawn through signed distance fields, so large sizes stay sharp; works
+//!   with every keyed text import)
+//! - `wasm96_graphics_text_sdf_key(x: f32, y: f32, font_key: u64, size_px: f32, angle: f32, text_ptr: u32, text_len: u32, style_ptr: u32)`
+//!   (SDF fonts only; rotated `angle` radians clockwise around the top-left; `style_ptr` = 0 or
+//!   24 bytes: outline width `f32`, outline color `u32` 0xRRGGBBAA, shadow x `f32`, shadow y
+//!   `f32`, shadow softness `f32`, shadow color `u32`)
 //!
 //! ### Input
 //! - `wasm96_input_is_button_down(port: u32, btn: u32) -> u32` (bool)
 //! - `wasm96_input_is_key_down(key: u32) -> u32` (bool)
+//!   - libretro `RETROK_*` key codes, as reported by the frontend's keyboard callback
 //! - `wasm96_input_get_mouse_x() -> i32`
 //! - `wasm96_input_get_mouse_y() -> i32`
 //! - `wasm96_input_is_mouse_down(btn: u32) -> u32` (bool)
+//! - `wasm96_input_get_connected_ports() -> u32`
+//!   - bitmask of ports with a controller assigned by the frontend (bit N = port N)
+//! - `wasm96_input_snapshot(ptr: u32, len: u32) -> u32`
+//!   - write the tick's whole input state to guest memory in one call: buttons held and newly
+//!     pressed on every port, connected ports, mouse, and held / newly pressed key bitmaps
+//!     (144 bytes; layout in `input::snapshot`). Returns the bytes written, 0 if `len` is too
+//!     small
+//! - `wasm96_input_get_controller_name(port: u32) -> u32`
+//!   - blob id of the controller's name (e.g. `RetroPad`); 0 if nothing is connected
+//! - `wasm96_input_ports_changed() -> u32` (bool)
+//!   - true for the one frame after a controller was plugged in, removed, or swapped
+//! - `wasm96_input_button_held_millis(port: u32, btn: u32) -> u32`
+//! - `wasm96_input_key_held_millis(key: u32) -> u32`
+//!   - how long the input has been held, summed from tick delta times
+//!   - 0 on the tick it went down and while it's released
+//! - `wasm96_input_get_touch_count() -> u32`
+//!   - touches reported this frame, including ones that ended since the last frame
+//! - `wasm96_input_get_touch_id(index: u32) -> u32` (0 = no such touch)
+//! - `wasm96_input_get_touch_x(index: u32) -> i32`
+//! - `wasm96_input_get_touch_y(index: u32) -> i32`
+//! - `wasm96_input_get_touch_phase(index: u32) -> u32`
+//!   - 0 = began, 1 = moved, 2 = stationary, 3 = ended
+//! - `wasm96_input_set_touch_mouse(enabled: u32)`
+//!   - mirror the first touch to the mouse position/left button (default on)
+//! - `wasm96_input_text_input_start()`
+//!   - start queueing typed characters (clears the queue)
+//! - `wasm96_input_text_input_stop()`
+//!   - stop queueing and clear the queue
+//! - `wasm96_input_get_text_input() -> u32`
+//!   - blob id of the UTF-8 text typed since the last call (0 = nothing); drains the queue
+//!   - backspace arrives as U+0008 and enter as `\n`
+//! - `wasm96_input_record_start()`
+//!   - start recording per-tick input (buttons, mouse, touches, delta time); reseeds the host RNG
+//! - `wasm96_input_record_stop() -> u32`
+//!   - blob id of the recorded trace (0 if not recording)
+//! - `wasm96_input_replay(ptr: u32, len: u32) -> u32`
+//!   - replay a trace from the next tick instead of live input; restores its RNG seed
+//!   - returns 1 if accepted, 0 if the data isn't a trace
+//! - `wasm96_input_is_replaying() -> u32`
+//!   - 1 while a trace is playing; live input resumes when it ends
 //!
 //! ### Audio
 //! - `wasm96_audio_init(sample_rate: u32) -> u32`
 //! - `wasm96_audio_push_samples(ptr: u32, len: u32)`
+//!   - samples beyond the queue capacity are dropped
+//! - `wasm96_audio_get_queued_samples() -> u32`
+//!   - i16 samples pushed but not yet played
+//! - `wasm96_audio_get_buffer_capacity() -> u32`
+//!   - queue capacity in i16 samples (200 ms of stereo)
 //!
 //! // Higher-level audio playback (host-mixed "channels/voices"):
 //! - `wasm96_audio_play_wav(ptr: u32, len: u32)`
 //! - `wasm96_audio_play_qoa(ptr: u32, len: u32)`
 //! - `wasm96_audio_play_xm(ptr: u32, len: u32)`
 //!
+//! // XM music with playback control (positions are tracker order-table index + row):
+//! - `wasm96_audio_xm_play(ptr: u32, len: u32) -> u32`
+//!   - returns a song handle (0 = decode failed); loops by default
+//! - `wasm96_audio_xm_pause(handle: u32, paused: u32)`
+//! - `wasm96_audio_xm_stop(handle: u32)`
+//! - `wasm96_audio_xm_set_position(handle: u32, order: u32, row: u32) -> u32` (bool)
+//! - `wasm96_audio_xm_get_position(handle: u32) -> u32`
+//!   - `order << 16 | row`; `u32::MAX` for an unknown handle
+//! - `wasm96_audio_xm_set_loop(handle: u32, start_order: u32, start_row: u32, end_order: u32, end_row: u32) -> u32` (bool)
+//!   - loops from the start of the end row back to the start row; an unreachable end row means the song's end
+//! - `wasm96_audio_xm_set_looping(handle: u32, enabled: u32)`
+//! - `wasm96_audio_xm_set_group(handle: u32, group: u32)`
+//!
+//! // Streamed music (decoded while playing; for long tracks):
+//! - `wasm96_audio_music_create(ptr: u32, len: u32, format: u32) -> u32`
+//!   - format: 0 = Ogg Vorbis; the data is copied
+//!   - returns a paused, looping handle in the music group (0 = unsupported or undecodable)
+//! - `wasm96_audio_music_play(handle: u32)`
+//! - `wasm96_audio_music_pause(handle: u32)`
+//! - `wasm96_audio_music_stop(handle: u32)`
+//!   - stops and rewinds; the handle stays valid
+//! - `wasm96_audio_music_destroy(handle: u32)`
+//! - `wasm96_audio_music_seek(handle: u32, millis: u32) -> u32` (bool)
+//!   - Vorbis seeks land on the page containing the target, slightly before it
+//! - `wasm96_audio_music_position(handle: u32) -> u32`
+//!   - milliseconds; `u32::MAX` for an unknown handle
+//! - `wasm96_audio_music_set_volume(handle: u32, vol: f32)`
+//! - `wasm96_audio_music_set_looping(handle: u32, enabled: u32)`
+//! - `wasm96_audio_music_set_group(handle: u32, group: u32)`
+//! - `wasm96_audio_music_crossfade(from: u32, to: u32, millis: u32)`
+//!   - fades `from` out and stops it while starting `to` and fading it in; either may be 0
+//!
+//! // MIDI songs through a SoundFont (see `av::midi`):
+//! - `wasm96_audio_soundfont_create(ptr: u32, len: u32) -> u32`
+//!   - a SoundFont 2 (`.sf2`) bank; returns its id (0 = not a SoundFont)
+//! - `wasm96_audio_soundfont_destroy(id: u32)`
+//!   - songs already using it keep playing
+//! - `wasm96_audio_midi_play(ptr: u32, len: u32, soundfont: u32) -> u32`
+//!   - a Standard MIDI File (format 0 or 1); returns a playing, looping music handle controlled
+//!     with the `wasm96_audio_music_*` imports (0 = bad file or unknown SoundFont)
+//! - `wasm96_audio_midi_set_tempo(handle: u32, scale: f32)`
+//!   - 1.0 = as written; clamped to 0.1..=4.0
+//! - `wasm96_audio_midi_set_channel_volume(handle: u32, channel: u32, vol: f32)`
+//!   - channels 0..16 (9 = percussion); applied on top of the file's own volume
+//!
+//! // Sound pools (one decoded effect, a capped number of voices; for rapid-fire SFX):
+//! - `wasm96_audio_sound_pool_create(ptr: u32, len: u32, max_voices: u32, steal_policy: u32) -> u32`
+//!   - WAV or QOA data (detected by magic); max_voices is clamped to 1..=32
+//!   - steal_policy when every voice is busy: 0 = restart the oldest, 1 = restart the quietest, 2 = drop the new play
+//!   - returns a handle in the SFX group (0 = undecodable data or unknown policy)
+//! - `wasm96_audio_sound_pool_create_async(ptr: u32, len: u32, max_voices: u32, steal_policy: u32) -> u32`
+//!   - same, but decodes in the background; the pool handle is also its load handle for
+//!     `wasm96_system_load_status`, and plays are dropped until it's ready
+//! - `wasm96_audio_sound_pool_play(pool: u32, vol: f32, pan: f32) -> u32` (bool)
+//!   - pan is -1.0 (left) ..= 1.0 (right); returns 0 if the play was dropped
+//! - `wasm96_audio_sound_pool_set_pitch_variation(pool: u32, amount: f32)`
+//!   - each play's pitch is picked from `1.0 ± amount` (clamped to 0.0..=0.5) using the replayable host RNG
+//! - `wasm96_audio_sound_pool_set_group(pool: u32, group: u32)`
+//! - `wasm96_audio_sound_pool_active(pool: u32) -> u32`
+//!   - voices currently playing
+//! - `wasm96_audio_sound_pool_stop(pool: u32)`
+//! - `wasm96_audio_sound_pool_destroy(pool: u32)`
+//!
+//! // Mixer (volumes are 0.0..=1.0; groups are 0..8, 0 = SFX by default, 1 = music by default):
+//! - `wasm96_audio_set_master_volume(vol: f32)`
+//! - `wasm96_audio_get_master_volume() -> f32`
+//! - `wasm96_audio_set_group_volume(group: u32, vol: f32)`
+//! - `wasm96_audio_get_group_volume(group: u32) -> f32`
+//! - `wasm96_audio_synth_set_group(voice: u32, group: u32)`
+//!
+//! // Panning and positional playback (pan: -1.0 = left, 0.0 = centre, 1.0 = right):
+//! - `wasm96_audio_set_pan(handle: u32, pan: f32)`
+//!   - for channel handles (XM songs, positional sounds)
+//! - `wasm96_audio_synth_set_pan(voice: u32, pan: f32)`
+//! - `wasm96_audio_set_listener(x: f32, y: f32)`
+//!   - listener position in screen coordinates (default: centre of the screen)
+//! - `wasm96_audio_play_wav_at(ptr: u32, len: u32, x: f32, y: f32) -> u32`
+//!   - plays a WAV once, panned/attenuated relative to the listener; returns a channel handle
+//!
+//! // Pitch (playback speed ratio: 2.0 = an octave up and twice as fast; clamped to 0.125..=8.0):
+//! - `wasm96_audio_set_pitch(handle: u32, ratio: f32)`
+//!   - for channel handles (XM songs, positional and pitched sounds)
+//! - `wasm96_audio_play_wav_pitched(ptr: u32, len: u32, ratio: f32) -> u32`
+//!   - plays a WAV once at `ratio`; returns a channel handle (0 = undecodable)
+//!
+//! // Effects (effect: 0 = low-pass, 1 = reverb; send levels are 0.0..=1.0):
+//! - `wasm96_audio_effect_enable(effect: u32, a: f32, b: f32) -> u32` (bool)
+//!   - low-pass: `a` = cutoff in Hz (20..=20000), `b` unused
+//!   - reverb: `a` = room size, `b` = damping, both 0.0..=1.0
+//!   - calling it again on an enabled effect re-tunes it without resetting it
+//! - `wasm96_audio_effect_disable(effect: u32)`
+//! - `wasm96_audio_set_send(handle: u32, effect: u32, level: f32)`
+//!   - for channel handles (XM songs, positional and pitched sounds)
+//! - `wasm96_audio_synth_set_send(voice: u32, effect: u32, level: f32)`
+//! - `wasm96_audio_group_set_send(group: u32, effect: u32, level: f32)`
+//!   - applies to everything in the group, added to each source's own send
+//! - a low-pass send crossfades the source to its filtered version (1.0 = fully filtered);
+//!   a reverb send adds reverb on top of the dry source
+//!
+//! // Microphone capture (mono i16; needs the player's `WASM96_MICROPHONE=1` and frontend support):
+//! - `wasm96_audio_capture_start(sample_rate: u32) -> u32`
+//!   - sample_rate 0 = the frontend's default; returns the actual rate (0 = not permitted or unavailable)
+//! - `wasm96_audio_capture_read(ptr: u32, max_samples: u32) -> u32`
+//!   - copies up to `max_samples` (at most 48000) samples to `ptr`; returns how many were written
+//! - `wasm96_audio_capture_stop()`
+//!
+//! // Chiptune synth voices (host-rendered oscillators with an ADSR envelope):
+//! - `wasm96_audio_synth_voice_create(waveform: u32) -> u32`
+//!   - waveform: 0 = square, 1 = triangle, 2 = saw, 3 = noise; returns a voice id (0 = invalid)
+//! - `wasm96_audio_synth_voice_destroy(voice: u32)`
+//! - `wasm96_audio_synth_set_envelope(voice: u32, attack_ms: u32, decay_ms: u32, sustain: f32, release_ms: u32)`
+//!   - sustain is a level in 0.0..=1.0
+//! - `wasm96_audio_synth_note_on(voice: u32, freq: f32, volume: f32)`
+//!   - freq in Hz; volume in 0.0..=1.0; (re)starts the envelope
+//! - `wasm96_audio_synth_note_off(voice: u32)`
+//!   - enters the release stage
+//!
 //! ### Storage
 //! - `wasm96_storage_save(key: u64, data_ptr: u32, data_len: u32)`
 //! - `wasm96_storage_load(key: u64) -> u64`
@@ -86,7 +446,198 @@
 //!
 //! ### System
 //! - `wasm96_system_log(ptr: u32, len: u32)`
+//!   - logs at info level
+//! - `wasm96_system_log_at(level: u32, ptr: u32, len: u32)`
+//!   - level: 0 = debug, 1 = info, 2 = warn, 3 = error; forwarded to the frontend's log
+//! - `wasm96_system_set_log_level(level: u32)`
+//!   - drop messages below `level` (default 0: everything)
+//! - `wasm96_system_report_error(msg_ptr: u32, msg_len: u32, stack_ptr: u32, stack_len: u32)`
+//!   - log a guest crash (e.g. from a panic hook) at error level; `stack` may be empty
+//!   - a trap in `setup`/`update`/`draw` is also logged, and the guest is not ticked again
+//!     until reset or reload
 //! - `wasm96_system_millis() -> u64`
+//! - `wasm96_system_unix_time() -> i64`
+//!   - wall-clock seconds since 1970-01-01 UTC, for calendar-based features
+//! - `wasm96_system_local_time_offset_minutes() -> i32`
+//!   - the player's current UTC offset in minutes east of UTC (`WASM96_UTC_OFFSET_MINUTES`
+//!     overrides it; 0 where the host time zone is unknown)
+//! - `wasm96_system_get_locale() -> u32`
+//!   - the player's language as a BCP-47 tag (e.g. `en-US`), as a blob id; from
+//!     `WASM96_LOCALE`, else the frontend's language, else the host locale, else `en`
+//! - `wasm96_system_delta_millis() -> u64`
+//!   - milliseconds between the previous guest tick and the current one (0 on the first tick,
+//!     clamped to 250ms after stalls)
+//! - `wasm96_system_set_target_fps(fps: u32)`
+//!   - tick the guest at most `fps` times per second (`0` = every host frame)
+//! - `wasm96_system_get_fps() -> u32`
+//!   - guest ticks per second measured over the last full second
+//! - `wasm96_system_set_update_rate(hz: u32)`
+//!   - run `update` at a fixed `hz`, independently of `draw`: each tick runs the updates that
+//!     have come due (none, one, or up to 8 after a stall) before drawing once (`0` = one
+//!     `update` per tick, the default; netplay sessions always run one)
+//! - `wasm96_system_interpolation_alpha() -> f32`
+//!   - how far this tick's `draw` is between the last `update` and the next, in `0.0..1.0`,
+//!     for interpolating rendered positions (1.0 without a fixed update rate)
+//! - `wasm96_system_random() -> u64`
+//!   - next value from the host PRNG (seeded from OS entropy when the cart loads)
+//! - `wasm96_system_random_seed() -> u64`
+//!   - fresh 64-bit entropy for seeding a guest-side generator
+//! - `wasm96_system_quit()`
+//!   - ask the frontend to shut down once the current tick returns (`on_quit` runs first)
+//! - `wasm96_system_reset()`
+//!   - restart the cart once the current tick returns: fresh instance and memory, `setup` again
+//! - `wasm96_system_clipboard_get() -> u32`
+//!   - starts reading the clipboard in the background; returns a read id (0 = not allowed by
+//!     the player's `WASM96_CLIPBOARD` permission (`read`, `write`, or both), or 4 reads
+//!     already pending)
+//! - `wasm96_system_clipboard_poll(id: u32) -> u32`
+//!   - 0 = unknown id, 1 = pending, 2 = done, 3 = failed (no clipboard tool worked, or the text
+//!     isn't UTF-8 or is over 1 MiB)
+//! - `wasm96_system_clipboard_take(id: u32) -> u32`
+//!   - blob id of the text once done (0 if pending, failed or empty); forgets a finished read
+//! - `wasm96_system_clipboard_cancel(id: u32)`
+//! - `wasm96_system_clipboard_set(ptr: u32, len: u32) -> u32`
+//!   - copy UTF-8 text to the clipboard; 1 if allowed and started, else 0
+//! - `wasm96_system_cart_meta(key_ptr: u32, key_len: u32) -> u32`
+//!   - blob id of a value from the cart's `wasm96.meta` custom section (`title`, `version`,
+//!     `author`, ...); 0 if it isn't set
+//! - `wasm96_system_launch_arg(key_ptr: u32, key_len: u32) -> u32`
+//!   - blob id of a launch parameter (frontend content meta, then `WASM96_LAUNCH_ARGS`); 0 if
+//!     it isn't set
+//! - `wasm96_system_asset_read(path_ptr: u32, path_len: u32) -> u32`
+//!   - blob id of the bytes of an asset in the cart's `.w96` bundle (a leading `/` or `./` is
+//!     ignored); 0 if there is no such asset
+//! - `wasm96_system_asset_list(prefix_ptr: u32, prefix_len: u32) -> u32`
+//!   - blob id of the sorted, newline-separated paths of the bundle assets starting with the
+//!     prefix (empty = all); 0 if none match
+//! - `wasm96_system_stats(ptr: u32, len: u32) -> u32`
+//!   - write the previous tick's profiling stats (36 bytes, see `system::stats`) to `ptr`;
+//!     returns bytes written (0 if `len` < 36)
+//! - `wasm96_system_accessibility_settings(ptr: u32, len: u32) -> u32`
+//!   - write the player's accessibility preferences from the core options (12 bytes: flags
+//!     with bit 0 = reduce flashing and bit 1 = high contrast, text scale `f32`, color-blind
+//!     mode 0 off / 1 protanopia / 2 deuteranopia / 3 tritanopia; see `system::accessibility`)
+//!     to `ptr`; returns bytes written (0 if `len` < 12)
+//! - `wasm96_system_load_status(handle: u32) -> u32`
+//!   - async load status: 0 = unknown handle, 1 = pending, 2 = ready, 3 = failed; decoded
+//!     assets become ready at the start of a tick
+//! - `wasm96_system_load_progress() -> f32`
+//!   - finished fraction (0.0..=1.0) of the loads started since nothing was last pending; 1.0
+//!     when idle
+//!
+//! Background jobs (an export run on a worker instance of the cart; see `system::jobs`):
+//! - `wasm96_system_job_spawn(name_ptr: u32, name_len: u32, arg: u32, data_ptr: u32, data_len: u32) -> u32`
+//!   - run export `name` (`(u32) -> u32` or `(u32)`) with `arg` and the input bytes (up to
+//!     16 MiB); returns a job id (0 = no such export, 64 jobs already running, or bad memory)
+//! - `wasm96_system_job_status(id: u32) -> u32`
+//!   - 0 = unknown id, 1 = running, 2 = done, 3 = failed (trapped, wrong signature, or called
+//!     an import jobs don't get)
+//! - `wasm96_system_job_result(id: u32) -> u32` (the export's return value once done)
+//! - `wasm96_system_job_output(id: u32) -> u32` (blob id of the bytes the job wrote; 0 if none)
+//! - `wasm96_system_job_free(id: u32)` (forget the job; a running one is stopped)
+//! - Inside a job (the only imports a worker gets; outside one, the input is empty and output
+//!   is discarded):
+//!   - `wasm96_system_job_input_len() -> u32`
+//!   - `wasm96_system_job_input_read(ptr: u32, len: u32) -> u32` (bytes copied)
+//!   - `wasm96_system_job_output_write(ptr: u32, len: u32) -> u32` (append; 1 on success)
+//!
+//! Achievements (declared by the `achievements` cart metadata; see `system::achievements`):
+//! - `wasm96_system_achievement_unlock(id_ptr: u32, id_len: u32) -> u32`
+//!   - 1 if the achievement is unlocked (now or before); 0 if the manifest doesn't list the id
+//!   - a new unlock is shown as a frontend notification after the tick
+//! - `wasm96_system_achievement_progress(id_ptr: u32, id_len: u32, value: u32, max: u32) -> u32`
+//!   - 1 if accepted (0 = unknown id or `max` is 0); `value >= max` unlocks, and every quarter
+//!     of the way is announced
+//!
+//! Development hot reload (with `WASM96_HOT_RELOAD` set; see `system::reload`):
+//! - `wasm96_system_dev_reload_requested() -> u32`
+//!   - 1 from a reload of the cart file until the first tick after it ends, else 0; a new
+//!     module re-runs `setup` on a fresh instance, new assets alone keep the guest running
+//!
+//! Blobs (variable-length host results; id `0` means "no result"):
+//! - `wasm96_system_blob_len(id: u32) -> u32`
+//! - `wasm96_system_blob_read(id: u32, ptr: u32, len: u32) -> u32`
+//!   - copies the blob into guest memory; returns bytes copied (0 if missing or `len` too small)
+//! - `wasm96_system_blob_free(id: u32)`
+//!
+//! Capture (software framebuffer only; the 3D layer is not included):
+//! - `wasm96_system_screenshot() -> u32`
+//!   - blob id of a PNG of the current framebuffer
+//! - `wasm96_system_record_gif_start()`
+//! - `wasm96_system_record_gif_stop() -> u32`
+//!   - blob id of a looping GIF of the frames drawn since `start`
+//!
+//! Save states (guest linear memory + drawing state, framebuffer, host RNG, mixer volumes):
+//! - `wasm96_system_state_save() -> u32`
+//!   - blob id of a snapshot of the current state
+//! - `wasm96_system_state_load(ptr: u32, len: u32) -> u32`
+//!   - restore a snapshot once the current tick returns; 1 if it is a valid snapshot, else 0
+//!   - the same format backs the frontend's save states and rewind
+//!
+//! ### Net
+//! Outbound HTTP(S), restricted to hosts in the `WASM96_NET_ALLOW` allowlist (see `crate::net`).
+//! - `wasm96_net_fetch(method_ptr, method_len, url_ptr, url_len, headers_ptr, headers_len, body_ptr, body_len) -> u32`
+//!   - starts a request in the background; returns a request id (0 = rejected)
+//!   - empty method means `GET`; headers are `Name: value` lines separated by `\n`
+//! - `wasm96_net_poll(id: u32) -> u32`
+//!   - 0 = unknown id, 1 = pending, 2 = done, 3 = failed (transport error)
+//! - `wasm96_net_status(id: u32) -> u32`
+//!   - HTTP status code once done
+//! - `wasm96_net_take_body(id: u32) -> u32`
+//!   - blob id of the response body; also forgets the request
+//! - `wasm96_net_cancel(id: u32)`
+//! - `wasm96_net_ws_open(url_ptr: u32, url_len: u32) -> u32`
+//!   - opens a `ws://` / `wss://` connection in the background; returns a socket id (0 = rejected)
+//! - `wasm96_net_ws_state(id: u32) -> u32`
+//!   - 0 = unknown id, 1 = connecting, 2 = open, 3 = closed
+//! - `wasm96_net_ws_send(id: u32, ptr: u32, len: u32, text: u32) -> u32`
+//!   - queues a binary (or, if `text` != 0, UTF-8 text) message; 1 = queued, 0 = closed/unknown
+//! - `wasm96_net_ws_receive(id: u32) -> u32`
+//!   - blob id of the oldest received message (0 = none queued)
+//! - `wasm96_net_ws_close(id: u32)`
+//!   - closes the connection and drops unread messages
+//! - `wasm96_net_session_create(players: u32, input_delay: u32, local_player: u32, port: u32) -> u32`
+//!   - opens the rollback netplay session on UDP `port` (0 = any); returns its id (0 = invalid),
+//!     replacing an existing session (see `crate::net::session`)
+//! - `wasm96_net_session_add_peer(id: u32, player: u32, addr_ptr: u32, addr_len: u32) -> u32`
+//!   - `player`'s inputs come from the allowlisted `host:port` address; 1 = added
+//! - `wasm96_net_session_add_local_input(id: u32, ptr: u32, len: u32) -> u32`
+//!   - this tick's local input (at most 64 bytes), applied after the input delay; 1 = accepted
+//! - `wasm96_net_session_synced_inputs(id: u32) -> u32`
+//!   - blob id of every player's input for this tick: per player `u8` confirmed flag, `u8`
+//!     length, bytes (0 = not running)
+//! - `wasm96_net_session_status(id: u32) -> u32`
+//!   - 0 = unknown id, 1 = connecting, 2 = running, 3 = running with a peer dropped
+//! - `wasm96_net_session_frame(id: u32) -> u32`
+//! - `wasm96_net_session_is_resimulating(id: u32) -> u32`
+//!   - 1 while the core re-runs `update` for ticks being rolled back
+//! - `wasm96_net_session_local_port(id: u32) -> u32`
+//! - `wasm96_net_session_close(id: u32)`
+//! - `wasm96_net_session_add_lan_peer(id: u32, player: u32, conn: u32) -> u32`
+//!   - `player`'s inputs travel over LAN connection `conn`; 1 = added
+//! - `wasm96_net_lan_discover() -> u32`
+//!   - probes the local network for machines running this cart; blob id listing the peers
+//!     heard so far, per peer `u32` id, `u8` address length, `ip:port` (0 = LAN play off or
+//!     unavailable; see `crate::net::lan`)
+//! - `wasm96_net_lan_connect(peer: u32) -> u32`
+//!   - connects to a discovered peer; returns a connection id (0 = unknown peer)
+//! - `wasm96_net_lan_accept() -> u32`
+//!   - the next incoming connection id (0 = none)
+//! - `wasm96_net_lan_state(conn: u32) -> u32`
+//!   - 0 = unknown id, 1 = connecting, 2 = open, 3 = closed
+//! - `wasm96_net_lan_send(conn: u32, ptr: u32, len: u32, reliable: u32) -> u32`
+//!   - sends a message (at most 1200 bytes), unreliable or, if `reliable` != 0, resent until
+//!     acknowledged and delivered in order; 1 = sent or queued
+//! - `wasm96_net_lan_receive(conn: u32) -> u32`
+//!   - blob id of the oldest received message (0 = none queued)
+//! - `wasm96_net_lan_close(conn: u32)`
+//! - `wasm96_net_score_submit(board_ptr: u32, board_len: u32, score: i64, meta_ptr: u32, meta_len: u32) -> u32`
+//!   - submits a score (meta at most 1 KiB) to a leaderboard; returns a request id polled with
+//!     `wasm96_net_poll` (0 = rejected). The host owns the backend (see `crate::net::scores`)
+//! - `wasm96_net_score_fetch(board_ptr: u32, board_len: u32, count: u32) -> u32`
+//!   - fetches the top `count` entries (at most 100); the body taken with
+//!     `wasm96_net_take_body` holds per entry `u32` rank, `i64` score, `u32` name length, name,
+//!     `u32` meta length, meta
 //!
 //! ## Exports (host -> guest)
 //!
@@ -96,6 +647,18 @@
 //! The guest module **may** export:
 //! - `update()`
 //! - `draw()`
+//! - `on_pause()` / `on_resume()`
+//!   - `on_pause` runs on the first frame a paused frontend steps (libretro's frame-stepping
+//!     throttle state) and `on_resume` on the first normal frame after it
+//!   - frontends that stop calling the core while paused (menu open, focus lost) can't run the
+//!     guest then: after at least `ABSENCE_MILLIS` without frames, only `on_resume` is called,
+//!     before the next tick (see `system::lifecycle`)
+//! - `on_quit()`
+//!   - called before the cart is unloaded (the player closed the content or the frontend), so
+//!     the guest can flush saves
+//! - `on_rollback()`
+//!   - called when a netplay session rolls back, after the snapshot is restored and before
+//!     `update` runs again for the rolled-back ticks
 //!
 //! WASI-style modules are also supported:
 //! - If `draw()` is missing, `_start()` or `main()` will be treated as the draw function (in that order).
@@ -111,6 +674,7 @@
 //! This module intentionally avoids embedding a specific runtime (Wasmer/Wasmtime) in its public API.
 //! Runtime-specific helpers should be implemented in runtime glue modules.
 
+use crate::runtime::GuestLimits;
 use wasmtime::{Instance, Store};
 
 /// Wasmer import module name used by the guest.
@@ -125,6 +689,12 @@ pub mod guest_exports {
     /// Called once per frame to draw.
     pub const DRAW: &str = "draw";
 
+    /// Optional lifecycle hooks.
+    pub const ON_PAUSE: &str = "on_pause";
+    pub const ON_RESUME: &str = "on_resume";
+    pub const ON_QUIT: &str = "on_quit";
+    pub const ON_ROLLBACK: &str = "on_rollback";
+
     /// WASI entrypoint (common for wasi modules).
     pub const WASI_START: &str = "_start";
     /// Conventional "main" export (non-standard in Wasm, but common in toolchains).
@@ -136,6 +706,16 @@ pub mod host_imports {
     // Graphics
     pub const GRAPHICS_SET_SIZE: &str = "wasm96_graphics_set_size";
     pub const GRAPHICS_SET_COLOR: &str = "wasm96_graphics_set_color";
+    pub const GRAPHICS_SET_TINT: &str = "wasm96_graphics_set_tint";
+    pub const GRAPHICS_SET_POST_EFFECT: &str = "wasm96_graphics_set_post_effect";
+    pub const GRAPHICS_COLOR_GRADE_SET: &str = "wasm96_graphics_color_grade_set";
+    pub const GRAPHICS_SET_SCALING_MODE: &str = "wasm96_graphics_set_scaling_mode";
+    pub const GRAPHICS_WINDOW_SIZE: &str = "wasm96_graphics_window_size";
+    pub const GRAPHICS_SET_FULLSCREEN: &str = "wasm96_graphics_set_fullscreen";
+    pub const GRAPHICS_FULLSCREEN: &str = "wasm96_graphics_fullscreen";
+    pub const GRAPHICS_RESIZED: &str = "wasm96_graphics_resized";
+    pub const GRAPHICS_SET_LINE_WIDTH: &str = "wasm96_graphics_set_line_width";
+    pub const GRAPHICS_SET_LINE_STYLE: &str = "wasm96_graphics_set_line_style";
     pub const GRAPHICS_BACKGROUND: &str = "wasm96_graphics_background";
     pub const GRAPHICS_POINT: &str = "wasm96_graphics_point";
     pub const GRAPHICS_LINE: &str = "wasm96_graphics_line";
@@ -143,31 +723,123 @@ pub mod host_imports {
     pub const GRAPHICS_RECT_OUTLINE: &str = "wasm96_graphics_rect_outline";
     pub const GRAPHICS_CIRCLE: &str = "wasm96_graphics_circle";
     pub const GRAPHICS_CIRCLE_OUTLINE: &str = "wasm96_graphics_circle_outline";
+    pub const GRAPHICS_RECT_GRADIENT: &str = "wasm96_graphics_rect_gradient";
+    pub const GRAPHICS_CIRCLE_GRADIENT: &str = "wasm96_graphics_circle_gradient";
 
     // Raw RGBA blit / one-shot decode+draw
     pub const GRAPHICS_IMAGE: &str = "wasm96_graphics_image";
     pub const GRAPHICS_IMAGE_PNG: &str = "wasm96_graphics_image_png";
     pub const GRAPHICS_IMAGE_JPEG: &str = "wasm96_graphics_image_jpeg";
 
+    // Direct framebuffer access
+    pub const GRAPHICS_FRAMEBUFFER_WRITE: &str = "wasm96_graphics_framebuffer_write";
+    pub const GRAPHICS_FRAMEBUFFER_READ: &str = "wasm96_graphics_framebuffer_read";
+
+    // Keyed resources: registration errors
+    pub const GRAPHICS_LAST_ERROR: &str = "wasm96_graphics_last_error";
+
     // Keyed resources: SVG
     pub const GRAPHICS_SVG_REGISTER: &str = "wasm96_graphics_svg_register";
     pub const GRAPHICS_SVG_DRAW_KEY: &str = "wasm96_graphics_svg_draw_key";
     pub const GRAPHICS_SVG_UNREGISTER: &str = "wasm96_graphics_svg_unregister";
+    pub const GRAPHICS_SVG_SIZE: &str = "wasm96_graphics_svg_size";
+    pub const GRAPHICS_SVG_SET_FILL: &str = "wasm96_graphics_svg_set_fill";
 
     // Keyed resources: GIF
     pub const GRAPHICS_GIF_REGISTER: &str = "wasm96_graphics_gif_register";
     pub const GRAPHICS_GIF_DRAW_KEY: &str = "wasm96_graphics_gif_draw_key";
     pub const GRAPHICS_GIF_DRAW_KEY_SCALED: &str = "wasm96_graphics_gif_draw_key_scaled";
     pub const GRAPHICS_GIF_UNREGISTER: &str = "wasm96_graphics_gif_unregister";
+    pub const GRAPHICS_GIF_FRAME_COUNT: &str = "wasm96_graphics_gif_frame_count";
+    pub const GRAPHICS_GIF_FRAME_DELAY: &str = "wasm96_graphics_gif_frame_delay";
+    pub const GRAPHICS_GIF_DRAW_FRAME: &str = "wasm96_graphics_gif_draw_frame";
+    pub const GRAPHICS_GIF_DRAW_EX: &str = "wasm96_graphics_gif_draw_ex";
+    pub const GRAPHICS_GIF_SET_FRAME: &str = "wasm96_graphics_gif_set_frame";
+    pub const GRAPHICS_GIF_SET_SPEED: &str = "wasm96_graphics_gif_set_speed";
+    pub const GRAPHICS_GIF_PAUSE: &str = "wasm96_graphics_gif_pause";
+
+    // Keyed resources: Aseprite
+    pub const GRAPHICS_ASEPRITE_REGISTER: &str = "wasm96_graphics_aseprite_register";
+    pub const GRAPHICS_ASEPRITE_UNREGISTER: &str = "wasm96_graphics_aseprite_unregister";
+    pub const GRAPHICS_ASEPRITE_SIZE: &str = "wasm96_graphics_aseprite_size";
+    pub const GRAPHICS_ASEPRITE_FRAME_COUNT: &str = "wasm96_graphics_aseprite_frame_count";
+    pub const GRAPHICS_ASEPRITE_FRAME_DURATION: &str = "wasm96_graphics_aseprite_frame_duration";
+    pub const GRAPHICS_ASEPRITE_TAG_DURATION: &str = "wasm96_graphics_aseprite_tag_duration";
+    pub const GRAPHICS_ASEPRITE_DRAW_FRAME: &str = "wasm96_graphics_aseprite_draw_frame";
+    pub const GRAPHICS_ASEPRITE_DRAW_TAG: &str = "wasm96_graphics_aseprite_draw_tag";
+    pub const GRAPHICS_ASEPRITE_SET_LAYER_VISIBLE: &str =
+        "wasm96_graphics_aseprite_set_layer_visible";
+
+    // Keyed resources: tile maps
+    pub const GRAPHICS_MAP_LOAD: &str = "wasm96_graphics_map_load";
+    pub const GRAPHICS_MAP_REGISTER: &str = "wasm96_graphics_map_register";
+    pub const GRAPHICS_MAP_UNREGISTER: &str = "wasm96_graphics_map_unregister";
+    pub const GRAPHICS_MAP_SIZE: &str = "wasm96_graphics_map_size";
+    pub const GRAPHICS_MAP_TILE_SIZE: &str = "wasm96_graphics_map_tile_size";
+    pub const GRAPHICS_MAP_LAYER_COUNT: &str = "wasm96_graphics_map_layer_count";
+    pub const GRAPHICS_MAP_LAYER_INDEX: &str = "wasm96_graphics_map_layer_index";
+    pub const GRAPHICS_MAP_TILE: &str = "wasm96_graphics_map_tile";
+    pub const GRAPHICS_MAP_OBJECTS: &str = "wasm96_graphics_map_objects";
+    pub const GRAPHICS_MAP_DRAW: &str = "wasm96_graphics_map_draw";
+    pub const GRAPHICS_MAP_DRAW_LAYER: &str = "wasm96_graphics_map_draw_layer";
 
     // Keyed resources: PNG
     pub const GRAPHICS_PNG_REGISTER: &str = "wasm96_graphics_png_register";
     pub const GRAPHICS_PNG_DRAW_KEY: &str = "wasm96_graphics_png_draw_key";
     pub const GRAPHICS_PNG_DRAW_KEY_SCALED: &str = "wasm96_graphics_png_draw_key_scaled";
     pub const GRAPHICS_PNG_UNREGISTER: &str = "wasm96_graphics_png_unregister";
+    pub const GRAPHICS_IMAGE_DRAW_REGION: &str = "wasm96_graphics_image_draw_region";
+    pub const GRAPHICS_IMAGE_DRAW_EX: &str = "wasm96_graphics_image_draw_ex";
+    pub const GRAPHICS_IMAGE_DRAW_NINE_SLICE: &str = "wasm96_graphics_image_draw_nine_slice";
+    pub const GRAPHICS_IMAGE_DRAW_BATCH: &str = "wasm96_graphics_image_draw_batch";
+
+    // Palette mode
+    pub const GRAPHICS_PALETTE_SET: &str = "wasm96_graphics_palette_set";
+    pub const GRAPHICS_PALETTE_SWAP: &str = "wasm96_graphics_palette_swap";
+    pub const GRAPHICS_PALETTE_SET_TRANSPARENT: &str = "wasm96_graphics_palette_set_transparent";
+    pub const GRAPHICS_PALETTE_RESET: &str = "wasm96_graphics_palette_reset";
+    pub const GRAPHICS_SET_COLOR_INDEX: &str = "wasm96_graphics_set_color_index";
+    pub const GRAPHICS_INDEXED_REGISTER: &str = "wasm96_graphics_indexed_register";
+    pub const GRAPHICS_INDEXED_DRAW: &str = "wasm96_graphics_indexed_draw";
+    pub const GRAPHICS_INDEXED_UNREGISTER: &str = "wasm96_graphics_indexed_unregister";
+
+    // Particles
+    pub const GRAPHICS_PARTICLES_CREATE: &str = "wasm96_graphics_particles_create";
+    pub const GRAPHICS_PARTICLES_EMIT: &str = "wasm96_graphics_particles_emit";
+    pub const GRAPHICS_PARTICLES_UPDATE_AND_DRAW: &str =
+        "wasm96_graphics_particles_update_and_draw";
+    pub const GRAPHICS_PARTICLES_COUNT: &str = "wasm96_graphics_particles_count";
+    pub const GRAPHICS_PARTICLES_CLEAR: &str = "wasm96_graphics_particles_clear";
+    pub const GRAPHICS_PARTICLES_DESTROY: &str = "wasm96_graphics_particles_destroy";
+    pub const GRAPHICS_CAMERA_SET: &str = "wasm96_graphics_camera_set";
+    pub const GRAPHICS_CAMERA_SET_BOUNDS: &str = "wasm96_graphics_camera_set_bounds";
+    pub const GRAPHICS_CAMERA_SHAKE: &str = "wasm96_graphics_camera_shake";
+    pub const GRAPHICS_CAMERA_RESET: &str = "wasm96_graphics_camera_reset";
+    pub const GRAPHICS_SCREEN_TO_WORLD: &str = "wasm96_graphics_screen_to_world";
+    pub const GRAPHICS_WORLD_TO_SCREEN: &str = "wasm96_graphics_world_to_screen";
+    pub const GRAPHICS_LAYER_BEGIN: &str = "wasm96_graphics_layer_begin";
+    pub const GRAPHICS_LAYER_END: &str = "wasm96_graphics_layer_end";
+    pub const GRAPHICS_LAYER_SET_VISIBLE: &str = "wasm96_graphics_layer_set_visible";
+    pub const GRAPHICS_LAYER_SET_PARALLAX: &str = "wasm96_graphics_layer_set_parallax";
+    pub const GRAPHICS_LAYER_SET_ORDER: &str = "wasm96_graphics_layer_set_order";
+    pub const GRAPHICS_MASK_BEGIN: &str = "wasm96_graphics_mask_begin";
+    pub const GRAPHICS_MASK_END: &str = "wasm96_graphics_mask_end";
+    pub const GRAPHICS_MASK_USE: &str = "wasm96_graphics_mask_use";
+    pub const GRAPHICS_MASK_OFF: &str = "wasm96_graphics_mask_off";
+    pub const GRAPHICS_PATH_BEGIN: &str = "wasm96_graphics_path_begin";
+    pub const GRAPHICS_PATH_MOVE_TO: &str = "wasm96_graphics_path_move_to";
+    pub const GRAPHICS_PATH_LINE_TO: &str = "wasm96_graphics_path_line_to";
+    pub const GRAPHICS_PATH_CURVE_TO: &str = "wasm96_graphics_path_curve_to";
+    pub const GRAPHICS_PATH_CLOSE: &str = "wasm96_graphics_path_close";
+    pub const GRAPHICS_PATH_FILL: &str = "wasm96_graphics_path_fill";
+    pub const GRAPHICS_PATH_STROKE: &str = "wasm96_graphics_path_stroke";
+    pub const GRAPHICS_TRANSITION_START: &str = "wasm96_graphics_transition_start";
+    pub const GRAPHICS_TRANSITION_ACTIVE: &str = "wasm96_graphics_transition_active";
+    pub const GRAPHICS_TRANSITION_MIDPOINT: &str = "wasm96_graphics_transition_midpoint";
 
     // Keyed resources: JPEG
     pub const GRAPHICS_JPEG_REGISTER: &str = "wasm96_graphics_jpeg_register";
+    pub const GRAPHICS_IMAGE_REGISTER_ASYNC: &str = "wasm96_graphics_image_register_async";
     pub const GRAPHICS_JPEG_DRAW_KEY: &str = "wasm96_graphics_jpeg_draw_key";
     pub const GRAPHICS_JPEG_DRAW_KEY_SCALED: &str = "wasm96_graphics_jpeg_draw_key_scaled";
     pub const GRAPHICS_JPEG_UNREGISTER: &str = "wasm96_graphics_jpeg_unregister";
@@ -179,6 +851,12 @@ pub mod host_imports {
     pub const GRAPHICS_BEZIER_CUBIC: &str = "wasm96_graphics_bezier_cubic";
     pub const GRAPHICS_PILL: &str = "wasm96_graphics_pill";
     pub const GRAPHICS_PILL_OUTLINE: &str = "wasm96_graphics_pill_outline";
+    pub const GRAPHICS_POLYGON: &str = "wasm96_graphics_polygon";
+    pub const GRAPHICS_POLYLINE: &str = "wasm96_graphics_polyline";
+    pub const GRAPHICS_ELLIPSE: &str = "wasm96_graphics_ellipse";
+    pub const GRAPHICS_ELLIPSE_OUTLINE: &str = "wasm96_graphics_ellipse_outline";
+    pub const GRAPHICS_ARC: &str = "wasm96_graphics_arc";
+    pub const GRAPHICS_ARC_FILLED: &str = "wasm96_graphics_arc_filled";
 
     // 3D Graphics
     pub const GRAPHICS_SET_3D: &str = "wasm96_graphics_set_3d";
@@ -196,10 +874,19 @@ pub mod host_imports {
     // Fonts (keyed)
     pub const GRAPHICS_FONT_REGISTER_TTF: &str = "wasm96_graphics_font_register_ttf";
     pub const GRAPHICS_FONT_REGISTER_BDF: &str = "wasm96_graphics_font_register_bdf";
+    pub const GRAPHICS_FONT_REGISTER_FNT: &str = "wasm96_graphics_font_register_fnt";
     pub const GRAPHICS_FONT_REGISTER_SPLEEN: &str = "wasm96_graphics_font_register_spleen";
     pub const GRAPHICS_FONT_UNREGISTER: &str = "wasm96_graphics_font_unregister";
+    pub const GRAPHICS_FONT_ADD_FALLBACK: &str = "wasm96_graphics_font_add_fallback";
     pub const GRAPHICS_TEXT_KEY: &str = "wasm96_graphics_text_key";
     pub const GRAPHICS_TEXT_MEASURE_KEY: &str = "wasm96_graphics_text_measure_key";
+    pub const GRAPHICS_TEXT_SIZED_KEY: &str = "wasm96_graphics_text_sized_key";
+    pub const GRAPHICS_TEXT_MEASURE_SIZED_KEY: &str = "wasm96_graphics_text_measure_sized_key";
+    pub const GRAPHICS_TEXT_MEASURE_UP_TO_KEY: &str = "wasm96_graphics_text_measure_up_to_key";
+    pub const GRAPHICS_FONT_METRICS_KEY: &str = "wasm96_graphics_font_metrics_key";
+    pub const GRAPHICS_SET_TEXT_SCALE: &str = "wasm96_graphics_set_text_scale";
+    pub const GRAPHICS_FONT_REGISTER_TTF_SDF: &str = "wasm96_graphics_font_register_ttf_sdf";
+    pub const GRAPHICS_TEXT_SDF_KEY: &str = "wasm96_graphics_text_sdf_key";
 
     // Input
     pub const INPUT_IS_BUTTON_DOWN: &str = "wasm96_input_is_button_down";
@@ -207,10 +894,31 @@ pub mod host_imports {
     pub const INPUT_GET_MOUSE_X: &str = "wasm96_input_get_mouse_x";
     pub const INPUT_GET_MOUSE_Y: &str = "wasm96_input_get_mouse_y";
     pub const INPUT_IS_MOUSE_DOWN: &str = "wasm96_input_is_mouse_down";
+    pub const INPUT_GET_CONNECTED_PORTS: &str = "wasm96_input_get_connected_ports";
+    pub const INPUT_SNAPSHOT: &str = "wasm96_input_snapshot";
+    pub const INPUT_GET_CONTROLLER_NAME: &str = "wasm96_input_get_controller_name";
+    pub const INPUT_PORTS_CHANGED: &str = "wasm96_input_ports_changed";
+    pub const INPUT_BUTTON_HELD_MILLIS: &str = "wasm96_input_button_held_millis";
+    pub const INPUT_KEY_HELD_MILLIS: &str = "wasm96_input_key_held_millis";
+    pub const INPUT_GET_TOUCH_COUNT: &str = "wasm96_input_get_touch_count";
+    pub const INPUT_GET_TOUCH_ID: &str = "wasm96_input_get_touch_id";
+    pub const INPUT_GET_TOUCH_X: &str = "wasm96_input_get_touch_x";
+    pub const INPUT_GET_TOUCH_Y: &str = "wasm96_input_get_touch_y";
+    pub const INPUT_GET_TOUCH_PHASE: &str = "wasm96_input_get_touch_phase";
+    pub const INPUT_SET_TOUCH_MOUSE: &str = "wasm96_input_set_touch_mouse";
+    pub const INPUT_TEXT_INPUT_START: &str = "wasm96_input_text_input_start";
+    pub const INPUT_TEXT_INPUT_STOP: &str = "wasm96_input_text_input_stop";
+    pub const INPUT_GET_TEXT_INPUT: &str = "wasm96_input_get_text_input";
+    pub const INPUT_RECORD_START: &str = "wasm96_input_record_start";
+    pub const INPUT_RECORD_STOP: &str = "wasm96_input_record_stop";
+    pub const INPUT_REPLAY: &str = "wasm96_input_replay";
+    pub const INPUT_IS_REPLAYING: &str = "wasm96_input_is_replaying";
 
     // Audio
     pub const AUDIO_INIT: &str = "wasm96_audio_init";
     pub const AUDIO_PUSH_SAMPLES: &str = "wasm96_audio_push_samples";
+    pub const AUDIO_GET_QUEUED_SAMPLES: &str = "wasm96_audio_get_queued_samples";
+    pub const AUDIO_GET_BUFFER_CAPACITY: &str = "wasm96_audio_get_buffer_capacity";
 
     // High-level audio playback (decoded + mixed on host)
     // Fire-and-forget (no ids/handles returned).
@@ -218,14 +926,169 @@ pub mod host_imports {
     pub const AUDIO_PLAY_QOA: &str = "wasm96_audio_play_qoa";
     pub const AUDIO_PLAY_XM: &str = "wasm96_audio_play_xm";
 
+    // XM music with playback control
+    pub const AUDIO_XM_PLAY: &str = "wasm96_audio_xm_play";
+    pub const AUDIO_XM_PAUSE: &str = "wasm96_audio_xm_pause";
+    pub const AUDIO_XM_STOP: &str = "wasm96_audio_xm_stop";
+    pub const AUDIO_XM_SET_POSITION: &str = "wasm96_audio_xm_set_position";
+    pub const AUDIO_XM_GET_POSITION: &str = "wasm96_audio_xm_get_position";
+    pub const AUDIO_XM_SET_LOOP: &str = "wasm96_audio_xm_set_loop";
+    pub const AUDIO_XM_SET_LOOPING: &str = "wasm96_audio_xm_set_looping";
+    pub const AUDIO_XM_SET_GROUP: &str = "wasm96_audio_xm_set_group";
+
+    // Streamed music
+    pub const AUDIO_MUSIC_CREATE: &str = "wasm96_audio_music_create";
+    pub const AUDIO_MUSIC_PLAY: &str = "wasm96_audio_music_play";
+    pub const AUDIO_MUSIC_PAUSE: &str = "wasm96_audio_music_pause";
+    pub const AUDIO_MUSIC_STOP: &str = "wasm96_audio_music_stop";
+    pub const AUDIO_MUSIC_DESTROY: &str = "wasm96_audio_music_destroy";
+    pub const AUDIO_MUSIC_SEEK: &str = "wasm96_audio_music_seek";
+    pub const AUDIO_MUSIC_POSITION: &str = "wasm96_audio_music_position";
+    pub const AUDIO_MUSIC_SET_VOLUME: &str = "wasm96_audio_music_set_volume";
+    pub const AUDIO_MUSIC_SET_LOOPING: &str = "wasm96_audio_music_set_looping";
+    pub const AUDIO_MUSIC_SET_GROUP: &str = "wasm96_audio_music_set_group";
+    pub const AUDIO_MUSIC_CROSSFADE: &str = "wasm96_audio_music_crossfade";
+
+    // MIDI + SoundFont
+    pub const AUDIO_SOUNDFONT_CREATE: &str = "wasm96_audio_soundfont_create";
+    pub const AUDIO_SOUNDFONT_DESTROY: &str = "wasm96_audio_soundfont_destroy";
+    pub const AUDIO_MIDI_PLAY: &str = "wasm96_audio_midi_play";
+    pub const AUDIO_MIDI_SET_TEMPO: &str = "wasm96_audio_midi_set_tempo";
+    pub const AUDIO_MIDI_SET_CHANNEL_VOLUME: &str = "wasm96_audio_midi_set_channel_volume";
+
+    // Sound pools
+    pub const AUDIO_SOUND_POOL_CREATE: &str = "wasm96_audio_sound_pool_create";
+    pub const AUDIO_SOUND_POOL_CREATE_ASYNC: &str = "wasm96_audio_sound_pool_create_async";
+    pub const AUDIO_SOUND_POOL_PLAY: &str = "wasm96_audio_sound_pool_play";
+    pub const AUDIO_SOUND_POOL_SET_PITCH_VARIATION: &str =
+        "wasm96_audio_sound_pool_set_pitch_variation";
+    pub const AUDIO_SOUND_POOL_SET_GROUP: &str = "wasm96_audio_sound_pool_set_group";
+    pub const AUDIO_SOUND_POOL_ACTIVE: &str = "wasm96_audio_sound_pool_active";
+    pub const AUDIO_SOUND_POOL_STOP: &str = "wasm96_audio_sound_pool_stop";
+    pub const AUDIO_SOUND_POOL_DESTROY: &str = "wasm96_audio_sound_pool_destroy";
+
+    // Mixer
+    pub const AUDIO_SET_MASTER_VOLUME: &str = "wasm96_audio_set_master_volume";
+    pub const AUDIO_GET_MASTER_VOLUME: &str = "wasm96_audio_get_master_volume";
+    pub const AUDIO_SET_GROUP_VOLUME: &str = "wasm96_audio_set_group_volume";
+    pub const AUDIO_GET_GROUP_VOLUME: &str = "wasm96_audio_get_group_volume";
+    pub const AUDIO_SYNTH_SET_GROUP: &str = "wasm96_audio_synth_set_group";
+
+    // Panning and positional playback
+    pub const AUDIO_SET_PAN: &str = "wasm96_audio_set_pan";
+    pub const AUDIO_SYNTH_SET_PAN: &str = "wasm96_audio_synth_set_pan";
+    pub const AUDIO_SET_LISTENER: &str = "wasm96_audio_set_listener";
+    pub const AUDIO_PLAY_WAV_AT: &str = "wasm96_audio_play_wav_at";
+
+    // Pitch
+    pub const AUDIO_SET_PITCH: &str = "wasm96_audio_set_pitch";
+    pub const AUDIO_PLAY_WAV_PITCHED: &str = "wasm96_audio_play_wav_pitched";
+
+    // Effects
+    pub const AUDIO_EFFECT_ENABLE: &str = "wasm96_audio_effect_enable";
+    pub const AUDIO_EFFECT_DISABLE: &str = "wasm96_audio_effect_disable";
+    pub const AUDIO_SET_SEND: &str = "wasm96_audio_set_send";
+    pub const AUDIO_SYNTH_SET_SEND: &str = "wasm96_audio_synth_set_send";
+    pub const AUDIO_GROUP_SET_SEND: &str = "wasm96_audio_group_set_send";
+
+    // Microphone capture
+    pub const AUDIO_CAPTURE_START: &str = "wasm96_audio_capture_start";
+    pub const AUDIO_CAPTURE_READ: &str = "wasm96_audio_capture_read";
+    pub const AUDIO_CAPTURE_STOP: &str = "wasm96_audio_capture_stop";
+
+    // Chiptune synth voices
+    pub const AUDIO_SYNTH_VOICE_CREATE: &str = "wasm96_audio_synth_voice_create";
+    pub const AUDIO_SYNTH_VOICE_DESTROY: &str = "wasm96_audio_synth_voice_destroy";
+    pub const AUDIO_SYNTH_SET_ENVELOPE: &str = "wasm96_audio_synth_set_envelope";
+    pub const AUDIO_SYNTH_NOTE_ON: &str = "wasm96_audio_synth_note_on";
+    pub const AUDIO_SYNTH_NOTE_OFF: &str = "wasm96_audio_synth_note_off";
+
     // Storage
     pub const STORAGE_SAVE: &str = "wasm96_storage_save";
     pub const STORAGE_LOAD: &str = "wasm96_storage_load";
     pub const STORAGE_FREE: &str = "wasm96_storage_free";
 
+    // Net
+    pub const NET_FETCH: &str = "wasm96_net_fetch";
+    pub const NET_POLL: &str = "wasm96_net_poll";
+    pub const NET_STATUS: &str = "wasm96_net_status";
+    pub const NET_TAKE_BODY: &str = "wasm96_net_take_body";
+    pub const NET_CANCEL: &str = "wasm96_net_cancel";
+    pub const NET_WS_OPEN: &str = "wasm96_net_ws_open";
+    pub const NET_WS_STATE: &str = "wasm96_net_ws_state";
+    pub const NET_WS_SEND: &str = "wasm96_net_ws_send";
+    pub const NET_WS_RECEIVE: &str = "wasm96_net_ws_receive";
+    pub const NET_WS_CLOSE: &str = "wasm96_net_ws_close";
+    pub const NET_SESSION_CREATE: &str = "wasm96_net_session_create";
+    pub const NET_SESSION_ADD_PEER: &str = "wasm96_net_session_add_peer";
+    pub const NET_SESSION_ADD_LOCAL_INPUT: &str = "wasm96_net_session_add_local_input";
+    pub const NET_SESSION_SYNCED_INPUTS: &str = "wasm96_net_session_synced_inputs";
+    pub const NET_SESSION_STATUS: &str = "wasm96_net_session_status";
+    pub const NET_SESSION_FRAME: &str = "wasm96_net_session_frame";
+    pub const NET_SESSION_IS_RESIMULATING: &str = "wasm96_net_session_is_resimulating";
+    pub const NET_SESSION_LOCAL_PORT: &str = "wasm96_net_session_local_port";
+    pub const NET_SESSION_CLOSE: &str = "wasm96_net_session_close";
+    pub const NET_SESSION_ADD_LAN_PEER: &str = "wasm96_net_session_add_lan_peer";
+    pub const NET_LAN_DISCOVER: &str = "wasm96_net_lan_discover";
+    pub const NET_LAN_CONNECT: &str = "wasm96_net_lan_connect";
+    pub const NET_LAN_ACCEPT: &str = "wasm96_net_lan_accept";
+    pub const NET_LAN_STATE: &str = "wasm96_net_lan_state";
+    pub const NET_LAN_SEND: &str = "wasm96_net_lan_send";
+    pub const NET_LAN_RECEIVE: &str = "wasm96_net_lan_receive";
+    pub const NET_LAN_CLOSE: &str = "wasm96_net_lan_close";
+    pub const NET_SCORE_SUBMIT: &str = "wasm96_net_score_submit";
+    pub const NET_SCORE_FETCH: &str = "wasm96_net_score_fetch";
+
     // System
     pub const SYSTEM_LOG: &str = "wasm96_system_log";
+    pub const SYSTEM_LOG_AT: &str = "wasm96_system_log_at";
+    pub const SYSTEM_SET_LOG_LEVEL: &str = "wasm96_system_set_log_level";
+    pub const SYSTEM_REPORT_ERROR: &str = "wasm96_system_report_error";
     pub const SYSTEM_MILLIS: &str = "wasm96_system_millis";
+    pub const SYSTEM_UNIX_TIME: &str = "wasm96_system_unix_time";
+    pub const SYSTEM_LOCAL_TIME_OFFSET_MINUTES: &str = "wasm96_system_local_time_offset_minutes";
+    pub const SYSTEM_GET_LOCALE: &str = "wasm96_system_get_locale";
+    pub const SYSTEM_DELTA_MILLIS: &str = "wasm96_system_delta_millis";
+    pub const SYSTEM_SET_TARGET_FPS: &str = "wasm96_system_set_target_fps";
+    pub const SYSTEM_GET_FPS: &str = "wasm96_system_get_fps";
+    pub const SYSTEM_SET_UPDATE_RATE: &str = "wasm96_system_set_update_rate";
+    pub const SYSTEM_INTERPOLATION_ALPHA: &str = "wasm96_system_interpolation_alpha";
+    pub const SYSTEM_RANDOM: &str = "wasm96_system_random";
+    pub const SYSTEM_RANDOM_SEED: &str = "wasm96_system_random_seed";
+    pub const SYSTEM_QUIT: &str = "wasm96_system_quit";
+    pub const SYSTEM_RESET: &str = "wasm96_system_reset";
+    pub const SYSTEM_CLIPBOARD_GET: &str = "wasm96_system_clipboard_get";
+    pub const SYSTEM_CLIPBOARD_POLL: &str = "wasm96_system_clipboard_poll";
+    pub const SYSTEM_CLIPBOARD_TAKE: &str = "wasm96_system_clipboard_take";
+    pub const SYSTEM_CLIPBOARD_CANCEL: &str = "wasm96_system_clipboard_cancel";
+    pub const SYSTEM_CLIPBOARD_SET: &str = "wasm96_system_clipboard_set";
+    pub const SYSTEM_CART_META: &str = "wasm96_system_cart_meta";
+    pub const SYSTEM_LAUNCH_ARG: &str = "wasm96_system_launch_arg";
+    pub const SYSTEM_ASSET_READ: &str = "wasm96_system_asset_read";
+    pub const SYSTEM_ASSET_LIST: &str = "wasm96_system_asset_list";
+    pub const SYSTEM_STATS: &str = "wasm96_system_stats";
+    pub const SYSTEM_ACCESSIBILITY_SETTINGS: &str = "wasm96_system_accessibility_settings";
+    pub const SYSTEM_LOAD_STATUS: &str = "wasm96_system_load_status";
+    pub const SYSTEM_LOAD_PROGRESS: &str = "wasm96_system_load_progress";
+    pub const SYSTEM_JOB_SPAWN: &str = "wasm96_system_job_spawn";
+    pub const SYSTEM_JOB_STATUS: &str = "wasm96_system_job_status";
+    pub const SYSTEM_JOB_RESULT: &str = "wasm96_system_job_result";
+    pub const SYSTEM_JOB_OUTPUT: &str = "wasm96_system_job_output";
+    pub const SYSTEM_JOB_FREE: &str = "wasm96_system_job_free";
+    pub const SYSTEM_JOB_INPUT_LEN: &str = "wasm96_system_job_input_len";
+    pub const SYSTEM_JOB_INPUT_READ: &str = "wasm96_system_job_input_read";
+    pub const SYSTEM_JOB_OUTPUT_WRITE: &str = "wasm96_system_job_output_write";
+    pub const SYSTEM_ACHIEVEMENT_UNLOCK: &str = "wasm96_system_achievement_unlock";
+    pub const SYSTEM_ACHIEVEMENT_PROGRESS: &str = "wasm96_system_achievement_progress";
+    pub const SYSTEM_DEV_RELOAD_REQUESTED: &str = "wasm96_system_dev_reload_requested";
+    pub const SYSTEM_BLOB_LEN: &str = "wasm96_system_blob_len";
+    pub const SYSTEM_BLOB_READ: &str = "wasm96_system_blob_read";
+    pub const SYSTEM_BLOB_FREE: &str = "wasm96_system_blob_free";
+    pub const SYSTEM_SCREENSHOT: &str = "wasm96_system_screenshot";
+    pub const SYSTEM_RECORD_GIF_START: &str = "wasm96_system_record_gif_start";
+    pub const SYSTEM_RECORD_GIF_STOP: &str = "wasm96_system_record_gif_stop";
+    pub const SYSTEM_STATE_SAVE: &str = "wasm96_system_state_save";
+    pub const SYSTEM_STATE_LOAD: &str = "wasm96_system_state_load";
 }
 
 /// Joypad button ids.
@@ -252,7 +1115,7 @@ pub enum Button {
 
 /// Helpers for validating guest exports.
 pub mod validate {
-    use super::guest_exports;
+    use super::{GuestLimits, guest_exports};
     use wasmtime::{Instance, Store};
 
     /// Validate that the required guest exports exist (Wasmtime).
@@ -262,7 +1125,7 @@ pub mod validate {
     /// - WASI-style guests may export `_start` or `main` instead of `draw`
     pub fn required_exports_present_wasmtime(
         instance: &Instance,
-        store: &mut Store<()>,
+        store: &mut Store<GuestLimits>,
     ) -> Result<(), MissingExport> {
         if instance.get_func(store, guest_exports::SETUP).is_none() {
             return Err(MissingExport::Setup);
@@ -285,6 +1148,10 @@ pub struct GuestEntrypoints {
     pub setup: wasmtime::Func,
     pub update: Option<wasmtime::Func>,
     pub draw: Option<wasmtime::Func>,
+    pub on_pause: Option<wasmtime::Func>,
+    pub on_resume: Option<wasmtime::Func>,
+    pub on_quit: Option<wasmtime::Func>,
+    pub on_rollback: Option<wasmtime::Func>,
 }
 
 impl GuestEntrypoints {
@@ -294,9 +1161,10 @@ impl GuestEntrypoints {
     /// - `setup` is required.
     /// - `draw` is preferred if exported; otherwise `_start`, otherwise `main`.
     /// - `update` is used if exported; otherwise it's `None`.
+    /// - Lifecycle hooks (`on_pause`, `on_resume`, `on_quit`, `on_rollback`) are used if exported.
     pub fn resolve_wasmtime(
         instance: &Instance,
-        store: &mut Store<()>,
+        store: &mut Store<GuestLimits>,
     ) -> Result<Self, anyhow::Error> {
         // Wasmtime APIs take `impl AsContextMut`, and passing `store` directly into multiple
         // calls can lead to "use of moved value" errors due to how the reborrow is inferred.
@@ -309,11 +1177,19 @@ impl GuestEntrypoints {
             .get_func(&mut *store, guest_exports::DRAW)
             .or_else(|| instance.get_func(&mut *store, guest_exports::WASI_START))
             .or_else(|| instance.get_func(&mut *store, guest_exports::MAIN));
+        let on_pause = instance.get_func(&mut *store, guest_exports::ON_PAUSE);
+        let on_resume = instance.get_func(&mut *store, guest_exports::ON_RESUME);
+        let on_quit = instance.get_func(&mut *store, guest_exports::ON_QUIT);
+        let on_rollback = instance.get_func(&mut *store, guest_exports::ON_ROLLBACK);
 
         Ok(Self {
             setup,
             update,
             draw,
+            on_pause,
+            on_resume,
+            on_quit,
+            on_rollback,
         })
     }
 }
@@ -323,9 +1199,9 @@ mod entrypoint_tests {
     use super::*;
     use wasmtime::{Engine, Module, Store};
 
-    fn instantiate(wat_src: &str) -> (Store<()>, Instance) {
+    fn instantiate(wat_src: &str) -> (Store<GuestLimits>, Instance) {
         let engine = Engine::default();
-        let mut store = Store::new(&engine, ());
+        let mut store = Store::new(&engine, GuestLimits::default());
         let wasm = wat::parse_str(wat_src).unwrap();
         let module = Module::new(&engine, wasm).unwrap();
         let instance = wasmtime::Instance::new(&mut store, &module, &[]).unwrap();
@@ -423,4 +1299,23 @@ mod entrypoint_tests {
         let ep = GuestEntrypoints::resolve_wasmtime(&instance, &mut store).unwrap();
         assert!(ep.update.is_some());
     }
+
+    #[test]
+    fn lifecycle_hooks_resolve_when_exported() {
+        let (mut store, instance) = instantiate(
+            r#"
+            (module
+              (func (export "setup"))
+              (func (export "draw"))
+              (func (export "on_pause"))
+              (func (export "on_quit"))
+            )
+            "#,
+        );
+
+        let ep = GuestEntrypoints::resolve_wasmtime(&instance, &mut store).unwrap();
+        assert!(ep.on_pause.is_some());
+        assert!(ep.on_resume.is_none());
+        assert!(ep.on_quit.is_some());
+    }
 }
@@ -0,0 +1,800 @@
+//! Aseprite (`.ase`/`.aseprite`) sprites: frames with their own durations, tags and layers.
+//!
+//! The file is parsed once at registration into layers, cels, per-frame durations and tags
+//! (named frame ranges with a direction and a repeat count). Frames are composited from the
+//! visible layers using layer and cel opacity; every blend mode draws as normal. Toggling a layer
+//! re-composites all frames, so do it when the look changes rather than every draw. RGBA,
+//! grayscale and indexed sprites load; tilemap cels are skipped.
+//!
+//! Tags play on the guest's clock: `draw_tag` takes the milliseconds since the animation started
+//! and follows the tag's direction (forward, reverse, ping-pong or ping-pong reverse; one pass of
+//! a ping-pong goes there and back). A tag with a repeat count holds its last frame once the
+//! passes are done; 0 loops forever. The empty tag name plays every frame forward, looping.
+
+use std::io::Read;
+
+use crate::runtime::GuestLimits;
+use wasmtime::Caller;
+
+use super::resources::{RESOURCES, ResourceError, registration_failed};
+use super::utils::{graphics_image_from_host, read_guest_bytes};
+
+const HEADER_MAGIC: u16 = 0xA5E0;
+const FRAME_MAGIC: u16 = 0xF1FA;
+
+const CHUNK_OLD_PALETTE: u16 = 0x0004;
+const CHUNK_LAYER: u16 = 0x2004;
+const CHUNK_CEL: u16 = 0x2005;
+const CHUNK_TAGS: u16 = 0x2018;
+const CHUNK_PALETTE: u16 = 0x2019;
+
+const LAYER_VISIBLE: u16 = 1;
+const LAYER_BACKGROUND: u16 = 8;
+const LAYER_GROUP: u16 = 1;
+
+/// Largest sprite canvas side accepted.
+pub const MAX_SIZE: u32 = 4096;
+
+/// Tag playback directions, as stored in the file.
+pub const DIRECTION_FORWARD: u8 = 0;
+pub const DIRECTION_REVERSE: u8 = 1;
+pub const DIRECTION_PING_PONG: u8 = 2;
+pub const DIRECTION_PING_PONG_REVERSE: u8 = 3;
+
+/// One layer. Groups hold no cels but hide their children when hidden.
+#[derive(Debug, Clone)]
+pub struct Layer {
+    pub name: String,
+    pub visible: bool,
+    pub group: bool,
+    pub opacity: u8,
+    pub parent: Option<usize>,
+}
+
+/// A layer's image in one frame, already converted to RGBA8888.
+#[derive(Debug, Clone)]
+pub struct Cel {
+    pub layer: usize,
+    pub z_index: i16,
+    pub x: i32,
+    pub y: i32,
+    pub width: u32,
+    pub height: u32,
+    pub opacity: u8,
+    pub rgba: Vec<u8>,
+}
+
+/// A named frame range.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Tag {
+    pub name: String,
+    pub from: u16,
+    pub to: u16,
+    pub direction: u8,
+    pub repeat: u16,
+}
+
+/// A parsed sprite plus its frames composited with the current layer visibility.
+pub struct Aseprite {
+    pub width: u32,
+    pub height: u32,
+    pub layers: Vec<Layer>,
+    /// Cels per frame, in draw order.
+    pub cels: Vec<Vec<Cel>>,
+    /// Milliseconds per frame.
+    pub durations: Vec<u16>,
+    pub tags: Vec<Tag>,
+    pub frames: Vec<Vec<u8>>,
+}
+
+struct Reader<'a> {
+    data: &'a [u8],
+    pos: usize,
+}
+
+impl<'a> Reader<'a> {
+    fn new(data: &'a [u8]) -> Self {
+        Self { data, pos: 0 }
+    }
+
+    fn bytes(&mut self, n: usize) -> Option<&'a [u8]> {
+        let end = self.pos.checked_add(n)?;
+        let out = self.data.get(self.pos..end)?;
+        self.pos = end;
+        Some(out)
+    }
+
+    fn u8(&mut self) -> Option<u8> {
+        Some(self.bytes(1)?[0])
+    }
+
+    fn u16(&mut self) -> Option<u16> {
+        Some(u16::from_le_bytes(self.bytes(2)?.try_into().ok()?))
+    }
+
+    fn i16(&mut self) -> Option<i16> {
+        Some(self.u16()? as i16)
+    }
+
+    fn u32(&mut self) -> Option<u32> {
+        Some(u32::from_le_bytes(self.bytes(4)?.try_into().ok()?))
+    }
+
+    fn string(&mut self) -> Option<String> {
+        let len = self.u16()? as usize;
+        Some(String::from_utf8_lossy(self.bytes(len)?).into_owned())
+    }
+}
+
+/// Cel pixels as stored, before palette lookup.
+struct RawCel {
+    layer: usize,
+    z_index: i16,
+    x: i32,
+    y: i32,
+    width: u32,
+    height: u32,
+    opacity: u8,
+    pixels: Vec<u8>,
+}
+
+/// Parse an Aseprite file. `None` if it's malformed or uses an unsupported color depth.
+pub fn parse(data: &[u8]) -> Option<Aseprite> {
+    let mut r = Reader::new(data);
+    let _file_size = r.u32()?;
+    if r.u16()? != HEADER_MAGIC {
+        return None;
+    }
+    let frame_count = r.u16()? as usize;
+    let width = r.u16()? as u32;
+    let height = r.u16()? as u32;
+    let depth = r.u16()?;
+    let flags = r.u32()?;
+    r.bytes(2 + 4 + 4)?;
+    let transparent_index = r.u8()?;
+    r.bytes(3 + 2 + 1 + 1 + 2 + 2 + 2 + 2 + 84)?;
+    if width == 0 || height == 0 || width > MAX_SIZE || height > MAX_SIZE {
+        return None;
+    }
+    let bytes_per_pixel = match depth {
+        32 => 4,
+        16 => 2,
+        8 => 1,
+        _ => return None,
+    };
+    let layer_opacity_valid = flags & 1 != 0;
+
+    let mut layers: Vec<Layer> = Vec::new();
+    let mut background: Vec<bool> = Vec::new();
+    // Last layer seen at each child level, to find parents.
+    let mut levels: Vec<usize> = Vec::new();
+    let mut palette = vec![[0u8, 0, 0, 255]; 256];
+    let mut tags = Vec::new();
+    let mut durations = Vec::with_capacity(frame_count);
+    let mut raw: Vec<Vec<RawCel>> = Vec::with_capacity(frame_count);
+
+    for _ in 0..frame_count {
+        let frame_start = r.pos;
+        let frame_len = r.u32()? as usize;
+        if r.u16()? != FRAME_MAGIC || frame_len < 16 {
+            return None;
+        }
+        let old_chunks = r.u16()? as usize;
+        durations.push(r.u16()?);
+        r.bytes(2)?;
+        let new_chunks = r.u32()? as usize;
+        let chunks = if new_chunks == 0 {
+            old_chunks
+        } else {
+            new_chunks
+        };
+
+        let mut cels: Vec<RawCel> = Vec::new();
+        for _ in 0..chunks {
+            let chunk_start = r.pos;
+            let chunk_len = r.u32()? as usize;
+            let kind = r.u16()?;
+            let body = data.get(chunk_start + 6..chunk_start.checked_add(chunk_len)?)?;
+            let mut c = Reader::new(body);
+            match kind {
+                CHUNK_LAYER => {
+                    let layer_flags = c.u16()?;
+                    let layer_type = c.u16()?;
+                    let level = c.u16()? as usize;
+                    c.bytes(2 + 2 + 2)?;
+                    let opacity = c.u8()?;
+                    c.bytes(3)?;
+                    let name = c.string()?;
+                    levels.truncate(level);
+                    let parent = level.checked_sub(1).and_then(|l| levels.get(l).copied());
+                    levels.push(layers.len());
+                    background.push(layer_flags & LAYER_BACKGROUND != 0);
+                    layers.push(Layer {
+                        name,
+                        visible: layer_flags & LAYER_VISIBLE != 0,
+                        group: layer_type == LAYER_GROUP,
+                        opacity: if layer_opacity_valid { opacity } else { 255 },
+                        parent,
+                    });
+                }
+                CHUNK_CEL => {
+                    let layer = c.u16()? as usize;
+                    let x = c.i16()? as i32;
+                    let y = c.i16()? as i32;
+                    let opacity = c.u8()?;
+                    let cel_type = c.u16()?;
+                    let z_index = c.i16()?;
+                    c.bytes(5)?;
+                    let cel = match cel_type {
+                        0 | 2 => {
+                            let w = c.u16()? as u32;
+                            let h = c.u16()? as u32;
+                            let len = (w as usize * h as usize).checked_mul(bytes_per_pixel)?;
+                            let rest = &body[c.pos..];
+                            let pixels = if cel_type == 0 {
+                                rest.get(..len)?.to_vec()
+                            } else {
+                                let mut out = Vec::with_capacity(len);
+                                flate2::read::ZlibDecoder::new(rest)
+                                    .take(len as u64)
+                                    .read_to_end(&mut out)
+                                    .ok()?;
+                                out
+                            };
+                            if pixels.len() < len {
+                                return None;
+                            }
+                            RawCel {
+                                layer,
+                                z_index,
+                                x,
+                                y,
+                                width: w,
+                                height: h,
+                                opacity,
+                                pixels,
+                            }
+                        }
+                        // Linked: the same pixels as this layer's cel in an earlier frame.
+                        1 => {
+                            let source = c.u16()? as usize;
+                            let linked = raw.get(source)?.iter().find(|cel| cel.layer == layer)?;
+                            RawCel {
+                                layer,
+                                z_index,
+                                x,
+                                y,
+                                width: linked.width,
+                                height: linked.height,
+                                opacity,
+                                pixels: linked.pixels.clone(),
+                            }
+                        }
+                        _ => {
+                            r.pos = chunk_start + chunk_len;
+                            continue;
+                        }
+                    };
+                    cels.push(cel);
+                }
+                CHUNK_TAGS => {
+                    let count = c.u16()?;
+                    c.bytes(8)?;
+                    for _ in 0..count {
+                        let from = c.u16()?;
+                        let to = c.u16()?;
+                        let direction = c.u8()?;
+                        let repeat = c.u16()?;
+                        c.bytes(6 + 3 + 1)?;
+                        let name = c.string()?;
+                        tags.push(Tag {
+                            name,
+                            from: from.min(to),
+                            to: from.max(to),
+                            direction,
+                            repeat,
+                        });
+                    }
+                }
+                CHUNK_PALETTE => {
+                    let _size = c.u32()?;
+                    let first = c.u32()? as usize;
+                    let last = c.u32()? as usize;
+                    c.bytes(8)?;
+                    for i in first..=last {
+                        let entry_flags = c.u16()?;
+                        let rgba = c.bytes(4)?;
+                        if entry_flags & 1 != 0 {
+                            c.string()?;
+                        }
+                        if let Some(slot) = palette.get_mut(i) {
+                            slot.copy_from_slice(rgba);
+                        }
+                    }
+                }
+                CHUNK_OLD_PALETTE => {
+                    let packets = c.u16()?;
+                    let mut index = 0usize;
+                    for _ in 0..packets {
+                        index += c.u8()? as usize;
+                        let count = match c.u8()? {
+                            0 => 256,
+                            n => n as usize,
+                        };
+                        for _ in 0..count {
+                            let rgb = c.bytes(3)?;
+                            if let Some(slot) = palette.get_mut(index) {
+                                *slot = [rgb[0], rgb[1], rgb[2], 255];
+                            }
+                            index += 1;
+                        }
+                    }
+                }
+                _ => {}
+            }
+            r.pos = chunk_start + chunk_len;
+        }
+        raw.push(cels);
+        r.pos = frame_start + frame_len;
+    }
+
+    let cels = raw
+        .into_iter()
+        .map(|frame| {
+            let mut cels: Vec<Cel> = frame
+                .into_iter()
+                .filter(|cel| cel.layer < layers.len())
+                .map(|cel| {
+                    let opaque_index = background[cel.layer];
+                    let rgba = match bytes_per_pixel {
+                        4 => cel.pixels,
+                        2 => cel
+                            .pixels
+                            .chunks_exact(2)
+                            .flat_map(|p| [p[0], p[0], p[0], p[1]])
+                            .collect(),
+                        _ => cel
+                            .pixels
+                            .iter()
+                            .flat_map(|&i| {
+                                if i == transparent_index && !opaque_index {
+                                    [0, 0, 0, 0]
+                                } else {
+                                    palette[i as usize]
+                                }
+                            })
+                            .collect(),
+                    };
+                    Cel {
+                        layer: cel.layer,
+                        z_index: cel.z_index,
+                        x: cel.x,
+                        y: cel.y,
+                        width: cel.width,
+                        height: cel.height,
+                        opacity: cel.opacity,
+                        rgba,
+                    }
+                })
+                .collect();
+            // Aseprite's order: layer index shifted by z-index, ties broken by z-index.
+            cels.sort_by_key(|cel| (cel.layer as i64 + cel.z_index as i64, cel.z_index));
+            cels
+        })
+        .collect();
+
+    let mut sprite = Aseprite {
+        width,
+        height,
+        layers,
+        cels,
+        durations,
+        tags,
+        frames: Vec::new(),
+    };
+    sprite.composite();
+    Some(sprite)
+}
+
+/// Blend `src` over `dst` (both RGBA8888) with an extra `opacity` (0..=255).
+fn blend(dst: &mut [u8], src: &[u8], opacity: u32) {
+    let sa = src[3] as u32 * opacity / 255;
+    if sa == 0 {
+        return;
+    }
+    let da = dst[3] as u32 * (255 - sa) / 255;
+    let out_a = sa + da;
+    for c in 0..3 {
+        dst[c] = ((src[c] as u32 * sa + dst[c] as u32 * da) / out_a) as u8;
+    }
+    dst[3] = out_a as u8;
+}
+
+impl Aseprite {
+    /// Whether a layer and all the groups above it are visible.
+    pub fn layer_shown(&self, mut layer: usize) -> bool {
+        loop {
+            let Some(l) = self.layers.get(layer) else {
+                return false;
+            };
+            if !l.visible {
+                return false;
+            }
+            match l.parent {
+                Some(parent) => layer = parent,
+                None => return true,
+            }
+        }
+    }
+
+    /// Rebuild `frames` from the cels of the visible layers.
+    pub fn composite(&mut self) {
+        let (w, h) = (self.width as i32, self.height as i32);
+        let frames = self
+            .cels
+            .iter()
+            .map(|cels| {
+                let mut canvas = vec![0u8; w as usize * h as usize * 4];
+                for cel in cels.iter().filter(|cel| self.layer_shown(cel.layer)) {
+                    let opacity = cel.opacity as u32 * self.layers[cel.layer].opacity as u32 / 255;
+                    for cy in 0..cel.height as i32 {
+                        let y = cel.y + cy;
+                        if y < 0 || y >= h {
+                            continue;
+                        }
+                        for cx in 0..cel.width as i32 {
+                            let x = cel.x + cx;
+                            if x < 0 || x >= w {
+                                continue;
+                            }
+                            let s = (cy as usize * cel.width as usize + cx as usize) * 4;
+                            let d = (y as usize * w as usize + x as usize) * 4;
+                            blend(&mut canvas[d..d + 4], &cel.rgba[s..s + 4], opacity);
+                        }
+                    }
+                }
+                canvas
+            })
+            .collect();
+        self.frames = frames;
+    }
+
+    /// Show or hide every layer named `name`. Returns how many layers matched.
+    pub fn set_layer_visible(&mut self, name: &str, visible: bool) -> u32 {
+        let mut matched = 0;
+        for layer in self.layers.iter_mut().filter(|l| l.name == name) {
+            layer.visible = visible;
+            matched += 1;
+        }
+        if matched > 0 {
+            self.composite();
+        }
+        matched
+    }
+
+    /// Milliseconds `frame` is shown for (0 if it doesn't exist).
+    pub fn duration(&self, frame: usize) -> u64 {
+        self.durations.get(frame).map_or(0, |&d| d.max(1) as u64)
+    }
+
+    /// The tag named `name`; the empty name is a tag covering every frame.
+    pub fn tag(&self, name: &str) -> Option<Tag> {
+        if name.is_empty() {
+            return Some(Tag {
+                name: String::new(),
+                from: 0,
+                to: self.frames.len().checked_sub(1)? as u16,
+                direction: DIRECTION_FORWARD,
+                repeat: 0,
+            });
+        }
+        self.tags.iter().find(|t| t.name == name).cloned()
+    }
+
+    /// Frames of one pass through `tag`, in play order.
+    pub fn sequence(&self, tag: &Tag) -> Vec<usize> {
+        let last = self.frames.len().saturating_sub(1);
+        let (from, to) = ((tag.from as usize).min(last), (tag.to as usize).min(last));
+        let forward: Vec<usize> = (from..=to).collect();
+        let inner = || from + 1..to;
+        match tag.direction {
+            DIRECTION_REVERSE => forward.into_iter().rev().collect(),
+            DIRECTION_PING_PONG => forward.iter().copied().chain(inner().rev()).collect(),
+            DIRECTION_PING_PONG_REVERSE => forward.iter().rev().copied().chain(inner()).collect(),
+            _ => forward,
+        }
+    }
+
+    /// Milliseconds of one pass through `tag`.
+    pub fn pass_millis(&self, tag: &Tag) -> u64 {
+        self.sequence(tag).iter().map(|&f| self.duration(f)).sum()
+    }
+
+    /// The frame `tag` shows `millis` after it started.
+    pub fn frame_at(&self, tag: &Tag, millis: u64) -> Option<usize> {
+        let sequence = self.sequence(tag);
+        let last = *sequence.last()?;
+        let pass = self.pass_millis(tag);
+        if pass == 0 || (tag.repeat > 0 && millis >= pass * tag.repeat as u64) {
+            return Some(last);
+        }
+        let mut rem = millis % pass;
+        for &frame in &sequence {
+            let d = self.duration(frame);
+            if rem < d {
+                return Some(frame);
+            }
+            rem -= d;
+        }
+        Some(last)
+    }
+}
+
+fn read_name(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> Option<String> {
+    read_guest_bytes(env, ptr, len)
+        .ok()
+        .and_then(|b| String::from_utf8(b).ok())
+}
+
+/// Register an Aseprite file under a key. Returns 1 on success, 0 on failure (see
+/// `graphics_last_error`).
+pub fn graphics_aseprite_register(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    data_ptr: u32,
+    data_len: u32,
+) -> u32 {
+    let Ok(data) = read_guest_bytes(env, data_ptr, data_len) else {
+        return registration_failed(ResourceError::Memory);
+    };
+    let Some(sprite) = parse(&data) else {
+        return registration_failed(ResourceError::Invalid);
+    };
+    let mut res = RESOURCES.lock().unwrap();
+    res.keyed_aseprites.insert(key, sprite);
+    1
+}
+
+/// Unregister a keyed Aseprite sprite.
+pub fn graphics_aseprite_unregister(key: u64) {
+    let mut res = RESOURCES.lock().unwrap();
+    res.keyed_aseprites.remove(&key);
+}
+
+/// Canvas size as `(width << 32) | height` (0 if not registered).
+pub fn graphics_aseprite_size(key: u64) -> u64 {
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_aseprites
+        .get(&key)
+        .map_or(0, |s| ((s.width as u64) << 32) | s.height as u64)
+}
+
+/// Number of frames (0 if not registered).
+pub fn graphics_aseprite_frame_count(key: u64) -> u32 {
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_aseprites
+        .get(&key)
+        .map_or(0, |s| s.frames.len() as u32)
+}
+
+/// Milliseconds one frame is shown for (0 if the sprite or frame doesn't exist).
+pub fn graphics_aseprite_frame_duration(key: u64, frame: u32) -> u32 {
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_aseprites
+        .get(&key)
+        .map_or(0, |s| s.duration(frame as usize) as u32)
+}
+
+/// Milliseconds of one pass through the tag named at `tag_ptr` (0 if there is no such tag).
+pub fn graphics_aseprite_tag_duration(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    tag_ptr: u32,
+    tag_len: u32,
+) -> u32 {
+    let Some(name) = read_name(env, tag_ptr, tag_len) else {
+        return 0;
+    };
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_aseprites
+        .get(&key)
+        .and_then(|s| Some(s.pass_millis(&s.tag(&name)?)))
+        .map_or(0, |ms| ms.min(u32::MAX as u64) as u32)
+}
+
+/// Draw one frame at natural size. Frame indices wrap around.
+pub fn graphics_aseprite_draw_frame(key: u64, frame: u32, x: i32, y: i32) {
+    let res = RESOURCES.lock().unwrap();
+    let Some(sprite) = res.keyed_aseprites.get(&key) else {
+        return;
+    };
+    if sprite.frames.is_empty() {
+        return;
+    }
+    let rgba = &sprite.frames[frame as usize % sprite.frames.len()];
+    graphics_image_from_host(x, y, sprite.width, sprite.height, rgba);
+}
+
+/// Draw the frame the tag named at `tag_ptr` shows `millis` after it started. Returns the frame
+/// drawn, or `u32::MAX` if the sprite or tag doesn't exist.
+pub fn graphics_aseprite_draw_tag(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    tag_ptr: u32,
+    tag_len: u32,
+    millis: u32,
+    x: i32,
+    y: i32,
+) -> u32 {
+    let Some(name) = read_name(env, tag_ptr, tag_len) else {
+        return u32::MAX;
+    };
+    let res = RESOURCES.lock().unwrap();
+    let Some(sprite) = res.keyed_aseprites.get(&key) else {
+        return u32::MAX;
+    };
+    let Some(frame) = sprite
+        .tag(&name)
+        .and_then(|tag| sprite.frame_at(&tag, millis as u64))
+    else {
+        return u32::MAX;
+    };
+    graphics_image_from_host(x, y, sprite.width, sprite.height, &sprite.frames[frame]);
+    frame as u32
+}
+
+/// Show (`visible != 0`) or hide the layers named at `name_ptr`. Returns how many matched.
+pub fn graphics_aseprite_set_layer_visible(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    name_ptr: u32,
+    name_len: u32,
+    visible: u32,
+) -> u32 {
+    let Some(name) = read_name(env, name_ptr, name_len) else {
+        return 0;
+    };
+    let mut res = RESOURCES.lock().unwrap();
+    res.keyed_aseprites
+        .get_mut(&key)
+        .map_or(0, |s| s.set_layer_visible(&name, visible != 0))
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn chunk(kind: u16, body: &[u8]) -> Vec<u8> {
+        let mut out = ((body.len() + 6) as u32).to_le_bytes().to_vec();
+        out.extend_from_slice(&kind.to_le_bytes());
+        out.extend_from_slice(body);
+        out
+    }
+
+    fn string(s: &str) -> Vec<u8> {
+        let mut out = (s.len() as u16).to_le_bytes().to_vec();
+        out.extend_from_slice(s.as_bytes());
+        out
+    }
+
+    fn layer(name: &str, flags: u16, opacity: u8) -> Vec<u8> {
+        let mut body = Vec::new();
+        body.extend_from_slice(&flags.to_le_bytes());
+        body.extend_from_slice(&[0; 2 + 2 + 6]);
+        body.push(opacity);
+        body.extend_from_slice(&[0; 3]);
+        body.extend_from_slice(&string(name));
+        chunk(CHUNK_LAYER, &body)
+    }
+
+    fn cel(layer: u16, x: i16, w: u16, pixels: &[[u8; 4]]) -> Vec<u8> {
+        let mut body = Vec::new();
+        body.extend_from_slice(&layer.to_le_bytes());
+        body.extend_from_slice(&x.to_le_bytes());
+        body.extend_from_slice(&0i16.to_le_bytes());
+        body.push(255);
+        body.extend_from_slice(&0u16.to_le_bytes());
+        body.extend_from_slice(&[0; 2 + 5]);
+        body.extend_from_slice(&w.to_le_bytes());
+        body.extend_from_slice(&1u16.to_le_bytes());
+        body.extend(pixels.iter().flatten());
+        chunk(CHUNK_CEL, &body)
+    }
+
+    fn frame(duration: u16, chunks: &[Vec<u8>]) -> Vec<u8> {
+        let body: Vec<u8> = chunks.concat();
+        let mut out = ((body.len() + 16) as u32).to_le_bytes().to_vec();
+        out.extend_from_slice(&FRAME_MAGIC.to_le_bytes());
+        out.extend_from_slice(&(chunks.len() as u16).to_le_bytes());
+        out.extend_from_slice(&duration.to_le_bytes());
+        out.extend_from_slice(&[0; 2]);
+        out.extend_from_slice(&(chunks.len() as u32).to_le_bytes());
+        out.extend_from_slice(&body);
+        out
+    }
+
+    /// A 2x1 RGBA sprite: a background layer and a half-transparent "hat" layer, three frames,
+    /// and a ping-pong "walk" tag over all of them.
+    fn sprite() -> Vec<u8> {
+        let red = [255, 0, 0, 255];
+        let blue = [0, 0, 255, 255];
+        let mut tags = Vec::new();
+        tags.extend_from_slice(&1u16.to_le_bytes());
+        tags.extend_from_slice(&[0; 8]);
+        tags.extend_from_slice(&0u16.to_le_bytes());
+        tags.extend_from_slice(&2u16.to_le_bytes());
+        tags.push(DIRECTION_PING_PONG);
+        tags.extend_from_slice(&2u16.to_le_bytes());
+        tags.extend_from_slice(&[0; 10]);
+        tags.extend_from_slice(&string("walk"));
+
+        let frames = [
+            frame(
+                100,
+                &[
+                    layer("body", 1, 255),
+                    layer("hat", 1, 128),
+                    chunk(CHUNK_TAGS, &tags),
+                    cel(0, 0, 2, &[red, red]),
+                    cel(1, 1, 1, &[blue]),
+                ],
+            ),
+            frame(50, &[cel(0, 0, 2, &[blue, blue])]),
+            frame(25, &[cel(0, 0, 1, &[red])]),
+        ];
+        let body = frames.concat();
+
+        let mut out = Vec::new();
+        out.extend_from_slice(&((128 + body.len()) as u32).to_le_bytes());
+        out.extend_from_slice(&HEADER_MAGIC.to_le_bytes());
+        out.extend_from_slice(&3u16.to_le_bytes());
+        out.extend_from_slice(&2u16.to_le_bytes());
+        out.extend_from_slice(&1u16.to_le_bytes());
+        out.extend_from_slice(&32u16.to_le_bytes());
+        out.extend_from_slice(&1u32.to_le_bytes());
+        out.resize(128, 0);
+        out.extend_from_slice(&body);
+        out
+    }
+
+    #[test]
+    fn parses_layers_frames_and_tags() {
+        let s = parse(&sprite()).unwrap();
+        assert_eq!((s.width, s.height), (2, 1));
+        assert_eq!(s.durations, [100, 50, 25]);
+        assert_eq!(s.layers.len(), 2);
+        assert_eq!(s.tags[0].name, "walk");
+        assert_eq!(s.frames[0][..4], [255, 0, 0, 255]);
+        // The hat layer is at half opacity over red.
+        assert_eq!(s.frames[0][4..], [127, 0, 128, 255]);
+        assert_eq!(s.frames[2][4..], [0, 0, 0, 0]);
+        assert!(parse(&sprite()[..100]).is_none());
+    }
+
+    #[test]
+    fn hiding_a_layer_recomposites() {
+        let mut s = parse(&sprite()).unwrap();
+        assert_eq!(s.set_layer_visible("hat", false), 1);
+        assert_eq!(s.frames[0][4..], [255, 0, 0, 255]);
+        assert_eq!(s.set_layer_visible("nope", false), 0);
+    }
+
+    #[test]
+    fn tags_follow_direction_and_repeat() {
+        let s = parse(&sprite()).unwrap();
+        let walk = s.tag("walk").unwrap();
+        assert_eq!(s.sequence(&walk), [0, 1, 2, 1]);
+        assert_eq!(s.pass_millis(&walk), 225);
+        assert_eq!(s.frame_at(&walk, 0), Some(0));
+        assert_eq!(s.frame_at(&walk, 160), Some(2));
+        assert_eq!(s.frame_at(&walk, 180), Some(1));
+        assert_eq!(s.frame_at(&walk, 225 + 99), Some(0));
+        // Two passes, then it holds the last frame of the pass.
+        assert_eq!(s.frame_at(&walk, 10_000), Some(1));
+
+        let all = s.tag("").unwrap();
+        assert_eq!(s.sequence(&all), [0, 1, 2]);
+        assert_eq!(s.frame_at(&all, 10_000), Some(0));
+        assert!(s.tag("run").is_none());
+    }
+}
@@ -1,7 +1,8 @@
 // Needed for `alloc::` in this crate.
 extern crate alloc;
 
-use crate::state::global;
+use crate::runtime::GuestLimits;
+use crate::state::{AUDIO_GROUP_MUSIC, AUDIO_GROUPS, AudioChannel, RowMark, global};
 use wasmtime::Caller;
 
 // External crates for rendering
@@ -39,7 +40,7 @@ pub fn audio_init(sample_rate: u32) -> u32 {
 //
 // Fire-and-forget: no ids/handles are returned.
 
-pub fn audio_play_wav(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
+pub fn audio_play_wav(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) {
     let memory_ptr = {
         let s = match crate::state::global().lock() {
             Ok(g) => g,
@@ -61,24 +62,43 @@ pub fn audio_play_wav(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
         return;
     }
 
+    let Some((pcm_stereo, sample_rate)) = decode_wav(wav_bytes) else {
+        return;
+    };
+
+    // Create a new audio channel and add to global state.
+    let channel = crate::state::AudioChannel {
+        active: true,
+        volume_q8_8: 256, // 1.0
+        pan_i16: 0,       // Center
+        loop_enabled: true,
+        pcm_stereo,
+        position_frames: 0,
+        sample_rate,
+        ..Default::default()
+    };
+
+    let mut s = match crate::state::global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.audio.channels.push(channel);
+}
+
+/// Decode a WAV file to interleaved stereo i16 PCM. Returns the PCM and its sample rate.
+pub(super) fn decode_wav(wav_bytes: Vec<u8>) -> Option<(Vec<i16>, u32)> {
     // Decode WAV using hound.
     let cursor = std::io::Cursor::new(wav_bytes);
-    let reader = match hound::WavReader::new(cursor) {
-        Ok(r) => r,
-        Err(_) => return,
-    };
+    let reader = hound::WavReader::new(cursor).ok()?;
 
     let spec = reader.spec();
     let sample_rate = spec.sample_rate;
 
     // Collect samples as i16, converting if necessary.
-    let mut samples: Vec<i16> = Vec::new();
-    for sample in reader.into_samples::<i16>() {
-        match sample {
-            Ok(s) => samples.push(s),
-            Err(_) => return,
-        }
-    }
+    let samples: Vec<i16> = reader
+        .into_samples::<i16>()
+        .collect::<Result<_, _>>()
+        .ok()?;
 
     // Convert to interleaved stereo if mono.
     let pcm_stereo: Vec<i16> = if spec.channels == 1 {
@@ -89,28 +109,137 @@ pub fn audio_play_wav(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
         samples
     } else {
         // Unsupported channel count.
-        return;
+        return None;
     };
 
-    // Create a new audio channel and add to global state.
-    let channel = crate::state::AudioChannel {
-        active: true,
-        volume_q8_8: 256, // 1.0
-        pan_i16: 0,       // Center
-        loop_enabled: true,
-        pcm_stereo,
-        position_frames: 0,
-        sample_rate,
-    };
+    Some((pcm_stereo, sample_rate))
+}
 
-    let mut s = match crate::state::global().lock() {
+/// Add an addressable channel and return its handle.
+fn add_channel(mut channel: AudioChannel) -> u32 {
+    let mut s = match global().lock() {
         Ok(g) => g,
         Err(poisoned) => poisoned.into_inner(),
     };
+    s.audio.next_channel_id = s.audio.next_channel_id.wrapping_add(1).max(1);
+    channel.id = s.audio.next_channel_id;
+    let id = channel.id;
     s.audio.channels.push(channel);
+    id
+}
+
+// --- Positional audio ---
+
+/// Pan (-1.0 = left, 1.0 = right) and gain for a sound at offset `(dx, dy)` from the listener.
+///
+/// Pan follows the horizontal offset, reaching full left/right half a screen away. Gain rolls
+/// off with distance: 1.0 at the listener, 0.5 half a screen away, 1/3 a full screen away.
+pub fn positional_pan_gain(dx: f32, dy: f32, screen_width: u32) -> (f32, f32) {
+    let half = (screen_width.max(1) as f32) / 2.0;
+    if !dx.is_finite() || !dy.is_finite() {
+        return (0.0, 0.0);
+    }
+    let pan = (dx / half).clamp(-1.0, 1.0);
+    let dist = (dx * dx + dy * dy).sqrt();
+    (pan, half / (half + dist))
 }
 
-pub fn audio_play_qoa(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
+/// Convert a -1.0..=1.0 pan to the channel's i16 domain.
+pub fn pan_to_i16(pan: f32) -> i32 {
+    if !pan.is_finite() {
+        return 0;
+    }
+    (pan.clamp(-1.0, 1.0) * 32767.0) as i32
+}
+
+/// Set the listener position for positional playback (screen coordinates).
+/// Until this is called, the listener is at the centre of the screen.
+pub fn audio_set_listener(x: f32, y: f32) {
+    let mut s = global().lock().unwrap();
+    s.audio.listener = Some((x, y));
+}
+
+/// Play a WAV once, panned and attenuated by its screen position relative to the listener.
+/// Returns a channel handle (0 if the data can't be decoded).
+pub fn audio_play_wav_at(
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+    x: f32,
+    y: f32,
+) -> u32 {
+    let Ok(wav_bytes) = super::utils::read_guest_bytes(env, ptr, len) else {
+        return 0;
+    };
+    let Some((pcm_stereo, sample_rate)) = decode_wav(wav_bytes) else {
+        return 0;
+    };
+
+    let (listener, width, height) = {
+        let s = global().lock().unwrap();
+        (s.audio.listener, s.video.width, s.video.height)
+    };
+    let (lx, ly) = listener.unwrap_or((width as f32 / 2.0, height as f32 / 2.0));
+    let (pan, gain) = positional_pan_gain(x - lx, y - ly, width);
+
+    add_channel(AudioChannel {
+        active: true,
+        volume_q8_8: (gain * 256.0) as u32,
+        pan_i16: pan_to_i16(pan),
+        loop_enabled: false,
+        pcm_stereo,
+        sample_rate,
+        ..Default::default()
+    })
+}
+
+/// Set the pan of a channel (-1.0 = left, 0.0 = centre, 1.0 = right).
+pub fn audio_set_pan(handle: u32, pan: f32) {
+    with_channel(handle, |c| c.pan_i16 = pan_to_i16(pan));
+}
+
+/// Slowest and fastest playback ratios (three octaves either way).
+pub const MIN_PITCH: f32 = 0.125;
+pub const MAX_PITCH: f32 = 8.0;
+
+/// Clamp a guest pitch ratio; non-finite values mean "unchanged" (1.0).
+pub fn clamp_pitch(ratio: f32) -> f32 {
+    if ratio.is_finite() {
+        ratio.clamp(MIN_PITCH, MAX_PITCH)
+    } else {
+        1.0
+    }
+}
+
+/// Set a channel's playback ratio: 2.0 plays an octave up in half the time, 0.5 an octave down.
+pub fn audio_set_pitch(handle: u32, ratio: f32) {
+    with_channel(handle, |c| c.pitch = clamp_pitch(ratio));
+}
+
+/// Play a WAV once at a pitch ratio. Returns a channel handle (0 if the data can't be decoded).
+pub fn audio_play_wav_pitched(
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+    ratio: f32,
+) -> u32 {
+    let Ok(wav_bytes) = super::utils::read_guest_bytes(env, ptr, len) else {
+        return 0;
+    };
+    let Some((pcm_stereo, sample_rate)) = decode_wav(wav_bytes) else {
+        return 0;
+    };
+    add_channel(AudioChannel {
+        active: true,
+        loop_enabled: false,
+        pcm_stereo,
+        sample_rate,
+        pitch: clamp_pitch(ratio),
+        ..Default::default()
+    })
+}
+
+pub fn audio_play_qoa(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) {
     let memory_ptr = {
         let s = match crate::state::global().lock() {
             Ok(g) => g,
@@ -132,28 +261,7 @@ pub fn audio_play_qoa(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
         return;
     }
 
-    // Decode QOA using qoaudio crate.
-    let decoder = match qoaudio::QoaDecoder::new(&qoa_bytes) {
-        Ok(d) => d,
-        Err(_) => return,
-    };
-
-    let channels = decoder.channels() as usize;
-    let sample_rate = decoder.sample_rate() as u32;
-    let samples: Vec<i16> = if let Some(s) = decoder.decoded_samples() {
-        s.into_iter().collect()
-    } else {
-        return;
-    };
-
-    let pcm_stereo: Vec<i16> = if channels == 1 {
-        // Mono: duplicate to stereo.
-        samples.into_iter().flat_map(|s| [s, s]).collect()
-    } else if channels == 2 {
-        // Stereo: already interleaved.
-        samples
-    } else {
-        // Unsupported channel count.
+    let Some((pcm_stereo, sample_rate)) = decode_qoa(&qoa_bytes) else {
         return;
     };
 
@@ -166,6 +274,7 @@ pub fn audio_play_qoa(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
         pcm_stereo,
         position_frames: 0,
         sample_rate,
+        ..Default::default()
     };
 
     let mut s = match crate::state::global().lock() {
@@ -175,47 +284,47 @@ pub fn audio_play_qoa(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
     s.audio.channels.push(channel);
 }
 
-pub fn audio_play_xm(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
-    let memory_ptr = {
-        let s = match crate::state::global().lock() {
-            Ok(g) => g,
-            Err(poisoned) => poisoned.into_inner(),
-        };
-        s.memory_wasmtime
-    };
+/// Decode QOA bytes to interleaved stereo i16 samples and the sample rate.
+pub(super) fn decode_qoa(qoa_bytes: &[u8]) -> Option<(Vec<i16>, u32)> {
+    // Decode QOA using qoaudio crate.
+    let decoder = qoaudio::QoaDecoder::new(qoa_bytes).ok()?;
 
-    if memory_ptr.is_null() {
-        return;
-    }
+    let channels = decoder.channels() as usize;
+    let sample_rate = decoder.sample_rate() as u32;
+    let samples: Vec<i16> = decoder.decoded_samples()?.into_iter().collect();
 
-    // SAFETY: memory pointer checked.
-    let mem = unsafe { &*memory_ptr };
+    let pcm_stereo: Vec<i16> = if channels == 1 {
+        // Mono: duplicate to stereo.
+        samples.into_iter().flat_map(|s| [s, s]).collect()
+    } else if channels == 2 {
+        // Stereo: already interleaved.
+        samples
+    } else {
+        // Unsupported channel count.
+        return None;
+    };
+    Some((pcm_stereo, sample_rate))
+}
 
-    // Read XM bytes from guest memory.
-    let mut xm_bytes = vec![0u8; len as usize];
-    if mem.read(env, ptr as usize, &mut xm_bytes).is_err() {
-        return;
-    }
+pub fn audio_play_xm(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) {
+    let _ = audio_xm_play(env, ptr, len);
+}
 
+// --- XM music with playback control ---
+//
+// The whole song is rendered to PCM up front (as before), and the frame where each
+// (order, row) starts is recorded alongside it. Seeking and position queries are lookups into
+// that table, so the guest can sync game events to the music.
+
+/// Render an XM module to interleaved stereo PCM, recording where each row starts.
+fn decode_xm(xm_bytes: &[u8], sample_rate: u32) -> Option<(Vec<i16>, Vec<RowMark>)> {
     // Load XM module using xmrs.
-    let xm = match xmrs::import::xm::xmmodule::XmModule::load(&xm_bytes) {
-        Ok(xm) => xm,
-        Err(_) => return,
-    };
+    let xm = xmrs::import::xm::xmmodule::XmModule::load(xm_bytes).ok()?;
 
     let module = xm.to_module();
     let module = Box::new(module);
     let module_ref: &'static xmrs::prelude::Module = Box::leak(module);
 
-    // Get sample rate.
-    let sample_rate = {
-        let s = match crate::state::global().lock() {
-            Ok(g) => g,
-            Err(poisoned) => poisoned.into_inner(),
-        };
-        s.audio.sample_rate
-    };
-
     // Create player.
     let mut player =
         xmrsplayer::prelude::XmrsPlayer::new(module_ref, sample_rate as f32, 1024, false);
@@ -223,8 +332,22 @@ pub fn audio_play_xm(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
 
     // Decode the entire song into PCM.
     let mut pcm_stereo: Vec<i16> = Vec::new();
+    let mut row_marks: Vec<RowMark> = Vec::new();
 
     loop {
+        let order = player.get_current_table_index() as u16;
+        let row = player.get_current_row() as u16;
+        if row_marks
+            .last()
+            .is_none_or(|m| (m.order, m.row) != (order, row))
+        {
+            row_marks.push(RowMark {
+                order,
+                row,
+                frame: pcm_stereo.len() / 2,
+            });
+        }
+
         match player.sample(true) {
             Some((left, right)) => {
                 let l_i16 = (left * 32767.0) as i16;
@@ -236,8 +359,29 @@ pub fn audio_play_xm(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
         }
     }
 
-    // Create a new audio channel and add to global state.
-    let channel = crate::state::AudioChannel {
+    Some((pcm_stereo, row_marks))
+}
+
+/// Play an XM module and return a handle for controlling it (0 if the data can't be decoded).
+pub fn audio_xm_play(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    let Ok(xm_bytes) = super::utils::read_guest_bytes(env, ptr, len) else {
+        return 0;
+    };
+
+    // Get sample rate.
+    let sample_rate = {
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        s.audio.sample_rate
+    };
+
+    let Some((pcm_stereo, row_marks)) = decode_xm(&xm_bytes, sample_rate) else {
+        return 0;
+    };
+
+    add_channel(AudioChannel {
         active: true,
         volume_q8_8: 256, // 1.0
         pan_i16: 0,       // Center
@@ -245,16 +389,277 @@ pub fn audio_play_xm(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
         pcm_stereo,
         position_frames: 0,
         sample_rate,
+        row_marks,
+        group: AUDIO_GROUP_MUSIC,
+        ..Default::default()
+    })
+}
+
+/// First frame of `(order, row)`, if the song reaches that row.
+pub fn frame_for_row(marks: &[RowMark], order: u16, row: u16) -> Option<usize> {
+    marks
+        .iter()
+        .find(|m| (m.order, m.row) == (order, row))
+        .map(|m| m.frame)
+}
+
+/// The `(order, row)` playing at `frame`.
+pub fn row_for_frame(marks: &[RowMark], frame: usize) -> Option<(u16, u16)> {
+    let idx = marks.partition_point(|m| m.frame <= frame);
+    idx.checked_sub(1).map(|i| (marks[i].order, marks[i].row))
+}
+
+/// Pack a position for the ABI: `order << 16 | row`.
+pub fn pack_row(order: u16, row: u16) -> u32 {
+    ((order as u32) << 16) | row as u32
+}
+
+fn with_channel<R>(handle: u32, f: impl FnOnce(&mut AudioChannel) -> R) -> Option<R> {
+    if handle == 0 {
+        return None;
+    }
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
     };
+    s.audio.channels.iter_mut().find(|c| c.id == handle).map(f)
+}
 
-    let mut s = match crate::state::global().lock() {
+/// Pause or resume a song.
+pub fn audio_xm_pause(handle: u32, paused: bool) {
+    with_channel(handle, |c| c.paused = paused);
+}
+
+/// Stop a song and free its handle.
+pub fn audio_xm_stop(handle: u32) {
+    if handle == 0 {
+        return;
+    }
+    let mut s = match global().lock() {
         Ok(g) => g,
         Err(poisoned) => poisoned.into_inner(),
     };
-    s.audio.channels.push(channel);
+    s.audio.channels.retain(|c| c.id != handle);
+}
+
+/// Jump to the start of `(order, row)`. Returns 1 on success, 0 if the song never reaches it.
+pub fn audio_xm_set_position(handle: u32, order: u32, row: u32) -> u32 {
+    let (Ok(order), Ok(row)) = (u16::try_from(order), u16::try_from(row)) else {
+        return 0;
+    };
+    with_channel(handle, |c| match frame_for_row(&c.row_marks, order, row) {
+        Some(frame) => {
+            c.position_frames = frame;
+            c.active = true;
+            1
+        }
+        None => 0,
+    })
+    .unwrap_or(0)
 }
 
-pub fn audio_push_samples(env: &mut Caller<'_, ()>, ptr: u32, count: u32) -> Result<(), AvError> {
+/// Current position packed as `order << 16 | row`, or `u32::MAX` for an unknown handle.
+pub fn audio_xm_get_position(handle: u32) -> u32 {
+    with_channel(handle, |c| {
+        row_for_frame(&c.row_marks, c.position_frames)
+            .map(|(order, row)| pack_row(order, row))
+            .unwrap_or(0)
+    })
+    .unwrap_or(u32::MAX)
+}
+
+/// Loop between two rows: playback jumps from the start of `(end_order, end_row)` back to
+/// `(start_order, start_row)`. An end row the song never reaches means "loop at the song's end".
+///
+/// Returns 1 on success, 0 if the start row doesn't exist.
+pub fn audio_xm_set_loop(
+    handle: u32,
+    start_order: u32,
+    start_row: u32,
+    end_order: u32,
+    end_row: u32,
+) -> u32 {
+    let (Ok(start_order), Ok(start_row)) = (u16::try_from(start_order), u16::try_from(start_row))
+    else {
+        return 0;
+    };
+    with_channel(handle, |c| {
+        let Some(start) = frame_for_row(&c.row_marks, start_order, start_row) else {
+            return 0;
+        };
+        let end = match (u16::try_from(end_order), u16::try_from(end_row)) {
+            (Ok(o), Ok(r)) => frame_for_row(&c.row_marks, o, r).filter(|&e| e > start),
+            _ => None,
+        };
+        c.loop_start = start;
+        c.loop_end = end;
+        1
+    })
+    .unwrap_or(0)
+}
+
+/// Enable or disable looping (the song stops at its end, or loop end, when disabled).
+pub fn audio_xm_set_looping(handle: u32, enabled: bool) {
+    with_channel(handle, |c| c.loop_enabled = enabled);
+}
+
+/// Move a song to another mixer group.
+pub fn audio_xm_set_group(handle: u32, group: u32) {
+    if (group as usize) < AUDIO_GROUPS {
+        with_channel(handle, |c| c.group = group);
+    }
+}
+
+fn clamp_volume(vol: f32) -> f32 {
+    if vol.is_finite() {
+        vol.clamp(0.0, 1.0)
+    } else {
+        0.0
+    }
+}
+
+/// Set the gain applied to everything the core outputs (0.0..=1.0).
+pub fn audio_set_master_volume(vol: f32) {
+    let mut s = global().lock().unwrap();
+    s.audio.master_volume = clamp_volume(vol);
+}
+
+pub fn audio_get_master_volume() -> f32 {
+    let s = global().lock().unwrap();
+    s.audio.master_volume
+}
+
+/// Set a mixer group's gain (0.0..=1.0). Unknown groups are ignored.
+pub fn audio_set_group_volume(group: u32, vol: f32) {
+    let mut s = global().lock().unwrap();
+    if let Some(v) = s.audio.group_volumes.get_mut(group as usize) {
+        *v = clamp_volume(vol);
+    }
+}
+
+/// A mixer group's gain, or 0.0 for an unknown group.
+pub fn audio_get_group_volume(group: u32) -> f32 {
+    let s = global().lock().unwrap();
+    s.audio
+        .group_volumes
+        .get(group as usize)
+        .copied()
+        .unwrap_or(0.0)
+}
+
+/// Combined master and group gain for a channel or voice in `group`.
+pub fn mix_gain(master: f32, groups: &[f32; AUDIO_GROUPS], group: u32) -> f32 {
+    master * groups.get(group as usize).copied().unwrap_or(1.0)
+}
+
+/// Mix up to `out.len() / 2` frames of a channel into `out`, scaled by `gain`, honouring pause
+/// and the loop region. Deactivates non-looping channels that reach their end.
+pub fn mix_channel(channel: &mut AudioChannel, gain: f32, out: &mut [i16]) {
+    if !channel.active || channel.paused {
+        return;
+    }
+
+    let channel_frames = channel.pcm_stereo.len() / 2;
+    let end = channel
+        .loop_end
+        .map_or(channel_frames, |e| e.min(channel_frames));
+
+    let volume = channel.volume_q8_8 as f32 / 256.0 * gain;
+    let pan_left = if channel.pan_i16 <= 0 {
+        1.0
+    } else {
+        (32768 - channel.pan_i16) as f32 / 32768.0
+    };
+    let pan_right = if channel.pan_i16 >= 0 {
+        1.0
+    } else {
+        (32768 + channel.pan_i16) as f32 / 32768.0
+    };
+
+    if channel.pitch != 1.0 {
+        mix_channel_pitched(channel, end, volume * pan_left, volume * pan_right, out);
+        return;
+    }
+
+    let target_frames = out.len() / 2;
+    let mut written = 0;
+    while written < target_frames {
+        if channel.position_frames >= end {
+            if channel.loop_enabled && channel.loop_start < end {
+                channel.position_frames = channel.loop_start;
+            } else {
+                channel.active = false;
+                return;
+            }
+        }
+
+        let start_frame = channel.position_frames;
+        let frames_to_mix = (end - start_frame).min(target_frames - written);
+
+        for i in 0..frames_to_mix {
+            let src_idx = (start_frame + i) * 2;
+            let l = (channel.pcm_stereo[src_idx] as f32 * volume * pan_left) as i16;
+            let r = (channel.pcm_stereo[src_idx + 1] as f32 * volume * pan_right) as i16;
+
+            let dst_idx = (written + i) * 2;
+            out[dst_idx] = sat_add_i16(out[dst_idx], l);
+            out[dst_idx + 1] = sat_add_i16(out[dst_idx + 1], r);
+        }
+
+        channel.position_frames += frames_to_mix;
+        written += frames_to_mix;
+    }
+}
+
+/// `mix_channel` for a channel whose pitch isn't 1.0: steps through the PCM by `pitch` frames
+/// per output frame, interpolating linearly between neighbouring frames.
+fn mix_channel_pitched(
+    channel: &mut AudioChannel,
+    end: usize,
+    left: f32,
+    right: f32,
+    out: &mut [i16],
+) {
+    let looping = channel.loop_enabled && channel.loop_start < end;
+    for frame in out.chunks_exact_mut(2) {
+        if channel.position_frames >= end {
+            if looping {
+                let len = end - channel.loop_start;
+                channel.position_frames =
+                    channel.loop_start + (channel.position_frames - end) % len;
+            } else {
+                channel.active = false;
+                channel.position_frac = 0.0;
+                return;
+            }
+        }
+
+        let a = channel.position_frames;
+        let b = if a + 1 < end {
+            a + 1
+        } else if looping {
+            channel.loop_start
+        } else {
+            a
+        };
+        let t = channel.position_frac;
+        let pcm = &channel.pcm_stereo;
+        let l = pcm[a * 2] as f32 * (1.0 - t) + pcm[b * 2] as f32 * t;
+        let r = pcm[a * 2 + 1] as f32 * (1.0 - t) + pcm[b * 2 + 1] as f32 * t;
+        frame[0] = sat_add_i16(frame[0], (l * left) as i16);
+        frame[1] = sat_add_i16(frame[1], (r * right) as i16);
+
+        let next = channel.position_frac + channel.pitch;
+        channel.position_frames += next as usize;
+        channel.position_frac = next.fract();
+    }
+}
+
+pub fn audio_push_samples(
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    count: u32,
+) -> Result<(), AvError> {
     let memory_ptr = {
         let s = match global().lock() {
             Ok(g) => g,
@@ -284,16 +689,34 @@ pub fn audio_push_samples(env: &mut Caller<'_, ()>, ptr: u32, count: u32) -> Res
         samples.push(val);
     }
 
-    // Append to host queue
+    // Append to host queue, dropping whatever doesn't fit so latency stays bounded.
     let mut s = match global().lock() {
         Ok(g) => g,
         Err(poisoned) => poisoned.into_inner(),
     };
-    s.audio.host_queue.extend(samples);
+    let room = host_queue_capacity(s.audio.sample_rate).saturating_sub(s.audio.host_queue.len());
+    s.audio.host_queue.extend(samples.into_iter().take(room));
 
     Ok(())
 }
 
+/// Most i16 samples the raw-push queue holds: 200 ms of interleaved stereo.
+pub fn host_queue_capacity(sample_rate: u32) -> usize {
+    (sample_rate as usize / 5) * 2
+}
+
+/// Number of pushed i16 samples waiting to be played.
+pub fn audio_get_queued_samples() -> u32 {
+    let s = global().lock().unwrap();
+    s.audio.host_queue.len() as u32
+}
+
+/// Capacity of the raw-push queue in i16 samples. Samples pushed beyond it are dropped.
+pub fn audio_get_buffer_capacity() -> u32 {
+    let s = global().lock().unwrap();
+    host_queue_capacity(s.audio.sample_rate) as u32
+}
+
 pub fn audio_drain_host(max_frames: u32) -> u32 {
     let (audio_batch_cb, audio_sample_cb, sample_rate) = {
         let s = match global().lock() {
@@ -347,56 +770,61 @@ pub fn audio_drain_host(max_frames: u32) -> u32 {
         let frames_to_take = available_frames.min(target_frames);
         let samples_to_take = frames_to_take * samples_per_frame;
 
+        let master = s.audio.master_volume;
+        let groups = s.audio.group_volumes;
+
         if samples_to_take != 0 {
             let drained: Vec<i16> = s.audio.host_queue.drain(0..samples_to_take).collect();
             for (dst, src) in mixed.iter_mut().zip(drained.iter()) {
-                *dst = sat_add_i16(*dst, *src);
-            }
-        }
-
-        // Mix audio channels (higher-level playback).
-        for channel in &mut s.audio.channels {
-            if !channel.active {
-                continue;
-            }
-
-            let channel_frames = channel.pcm_stereo.len() / 2;
-            if channel.position_frames >= channel_frames {
-                if channel.loop_enabled {
-                    channel.position_frames = 0;
+                let src = if master < 1.0 {
+                    (*src as f32 * master) as i16
                 } else {
-                    channel.active = false;
-                    continue;
-                }
+                    *src
+                };
+                *dst = sat_add_i16(*dst, src);
             }
+        }
 
-            let start_frame = channel.position_frames;
-            let frames_to_mix = (channel_frames - start_frame).min(target_frames);
+        // Sources with effect sends are split between `mixed` and the send buses.
+        let audio = &mut s.audio;
+        let mut buses = super::dsp::SendBuses::new();
 
-            let volume = channel.volume_q8_8 as f32 / 256.0;
-            let pan_left = if channel.pan_i16 <= 0 {
-                1.0
-            } else {
-                (32768 - channel.pan_i16) as f32 / 32768.0
-            };
-            let pan_right = if channel.pan_i16 >= 0 {
-                1.0
-            } else {
-                (32768 + channel.pan_i16) as f32 / 32768.0
-            };
+        // Mix audio channels (higher-level playback).
+        for channel in &mut audio.channels {
+            let gain = mix_gain(master, &groups, channel.group);
+            let sends = audio.effects.sends(channel.group, channel.sends);
+            buses.route(sends, &mut mixed, |out| mix_channel(channel, gain, out));
+        }
 
-            for i in 0..frames_to_mix {
-                let src_idx = (start_frame + i) * 2;
-                let l = (channel.pcm_stereo[src_idx] as f32 * volume * pan_left) as i16;
-                let r = (channel.pcm_stereo[src_idx + 1] as f32 * volume * pan_right) as i16;
+        // Render synth voices.
+        let sample_rate = audio.sample_rate;
+        for voice in audio.synth_voices.values_mut() {
+            let gain = mix_gain(master, &groups, voice.group);
+            let sends = audio.effects.sends(voice.group, voice.sends);
+            buses.route(sends, &mut mixed, |out| {
+                super::synth::render_voice(voice, sample_rate, gain, out)
+            });
+        }
 
-                let dst_idx = i * 2;
-                mixed[dst_idx] = sat_add_i16(mixed[dst_idx], l);
-                mixed[dst_idx + 1] = sat_add_i16(mixed[dst_idx + 1], r);
-            }
+        // Decode and mix streamed music.
+        for music in audio.music.values_mut() {
+            let gain = mix_gain(master, &groups, music.group);
+            let sends = audio.effects.sends(music.group, Default::default());
+            buses.route(sends, &mut mixed, |out| {
+                super::music::mix_music(music, sample_rate, gain, out)
+            });
+        }
 
-            channel.position_frames += frames_to_mix;
+        // Mix sound pool voices.
+        for pool in audio.sound_pools.values_mut() {
+            let gain = mix_gain(master, &groups, pool.group);
+            let sends = audio.effects.sends(pool.group, Default::default());
+            buses.route(sends, &mut mixed, |out| {
+                super::sound_pool::mix_pool(pool, gain, out)
+            });
         }
+
+        buses.finish(&mut audio.effects, sample_rate, &mut mixed);
     }
 
     // Upload audio
@@ -0,0 +1,295 @@
+//! Host 2D camera: world-space drawing, bounds and screen shake.
+//!
+//! Between `camera_set` and `camera_reset`, 2D draw coordinates are world coordinates. The
+//! imports translate them by the origin of a *world pass* (`camera_point`), and the draws land in
+//! that pass. Without zoom or rotation the pass is simply the screen, offset. Otherwise it is an
+//! offscreen buffer covering the visible part of the world, resampled onto the screen
+//! (nearest-neighbor) when the pass closes: on `camera_reset`, on the next `camera_set`, or when
+//! the frame ends. Only pass pixels that were drawn replace screen pixels. Over a layer or mask
+//! canvas, the canvas coverage is resampled into and out of the pass along with the pixels.
+//!
+//! A camera left active stays in effect on later frames. Shake offsets are rolled once per frame
+//! and decay linearly to zero over the shake's duration. 3D rendering ignores the 2D camera.
+
+use crate::state::{Camera, CameraPass, VideoState, global};
+
+/// Zoom range accepted by `graphics_camera_set`; the low end bounds the world pass size.
+const MIN_ZOOM: f32 = 0.25;
+const MAX_ZOOM: f32 = 64.0;
+
+/// Point the camera at world (x, y) with `zoom` and `rotation` (radians, clockwise) and route the
+/// following 2D draws through it.
+pub fn graphics_camera_set(x: f32, y: f32, zoom: f32, rotation: f32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    close_pass(&mut s.video);
+    let finite = |v: f32, default: f32| if v.is_finite() { v } else { default };
+    let camera = &mut s.video.camera;
+    camera.x = finite(x, 0.0);
+    camera.y = finite(y, 0.0);
+    camera.zoom = finite(zoom, 1.0).clamp(MIN_ZOOM, MAX_ZOOM);
+    camera.rotation = finite(rotation, 0.0);
+    camera.active = true;
+    open_pass(&mut s.video);
+}
+
+/// Keep the view inside the world rectangle (x, y, w, h); a zero width or height removes the
+/// bounds. A view larger than the bounds is centered on them.
+pub fn graphics_camera_set_bounds(x: i32, y: i32, w: u32, h: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.video.camera.bounds = (w != 0 && h != 0).then_some((x as f32, y as f32, w as f32, h as f32));
+    reopen_pass(&mut s.video);
+}
+
+/// Shake the view by up to `magnitude` screen pixels, fading out over `duration_ms`. Replaces
+/// any shake in progress.
+pub fn graphics_camera_shake(magnitude: f32, duration_ms: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let camera = &mut s.video.camera;
+    camera.shake_magnitude = if magnitude.is_finite() {
+        magnitude.abs()
+    } else {
+        0.0
+    };
+    camera.shake_duration_ms = duration_ms;
+    camera.shake_remaining_ms = duration_ms;
+    roll_shake(camera);
+    reopen_pass(&mut s.video);
+}
+
+/// Finish the world pass and go back to drawing in screen coordinates (for HUDs). Shake and
+/// bounds are kept for the next `camera_set`.
+pub fn graphics_camera_reset() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    close_pass(&mut s.video);
+    s.video.camera.active = false;
+}
+
+/// Screen size the camera maps onto, even while a world pass has swapped the screen out.
+fn screen_size(video: &VideoState) -> (u32, u32) {
+    match video.camera.pass.as_ref().and_then(|p| p.screen.as_ref()) {
+        Some((_, w, h)) => (*w, *h),
+        None => (video.width, video.height),
+    }
+}
+
+/// Pack a point as `(x.to_bits() << 32) | y.to_bits()`.
+fn pack_point((x, y): (f32, f32)) -> u64 {
+    ((x.to_bits() as u64) << 32) | y.to_bits() as u64
+}
+
+/// The world point under screen position (x, y), packed as two `f32`s (x in the high word).
+/// Identity while no camera is active.
+pub fn graphics_screen_to_world(x: f32, y: f32) -> u64 {
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    if !s.video.camera.active {
+        return pack_point((x, y));
+    }
+    let (w, h) = screen_size(&s.video);
+    pack_point(s.video.camera.screen_to_world(x, y, w, h))
+}
+
+/// Where world point (x, y) lands on screen, packed like [`graphics_screen_to_world`].
+pub fn graphics_world_to_screen(x: f32, y: f32) -> u64 {
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    if !s.video.camera.active {
+        return pack_point((x, y));
+    }
+    let (w, h) = screen_size(&s.video);
+    pack_point(s.video.camera.world_to_screen(x, y, w, h))
+}
+
+/// Translate a draw coordinate into the open world pass (identity when there is none).
+pub fn camera_point(x: i32, y: i32) -> (i32, i32) {
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    match &s.video.camera.pass {
+        Some(pass) => (
+            x.saturating_sub(pass.origin.0),
+            y.saturating_sub(pass.origin.1),
+        ),
+        None => (x, y),
+    }
+}
+
+/// Reopen the world pass of a camera left active by the previous frame. Called before the
+/// guest draws.
+pub fn camera_begin_frame() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    if s.video.camera.active && s.video.camera.pass.is_none() {
+        open_pass(&mut s.video);
+    }
+}
+
+/// Composite the world pass onto the screen and advance the shake by `delta_ms`. Called once
+/// the guest has drawn, before the frame is captured or presented.
+pub fn camera_end_frame(delta_ms: u64) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    close_pass(&mut s.video);
+    let camera = &mut s.video.camera;
+    let elapsed = delta_ms.min(u32::MAX as u64) as u32;
+    camera.shake_remaining_ms = camera.shake_remaining_ms.saturating_sub(elapsed);
+    roll_shake(camera);
+}
+
+/// Pick this frame's shake offset from the remaining shake.
+fn roll_shake(camera: &mut Camera) {
+    if camera.shake_remaining_ms == 0 || camera.shake_duration_ms == 0 {
+        camera.shake_offset = (0.0, 0.0);
+        return;
+    }
+    let fade = camera.shake_remaining_ms as f32 / camera.shake_duration_ms as f32;
+    let mut unit = || {
+        camera.shake_rng ^= camera.shake_rng << 13;
+        camera.shake_rng ^= camera.shake_rng >> 7;
+        camera.shake_rng ^= camera.shake_rng << 17;
+        (camera.shake_rng >> 40) as f32 / (1u64 << 24) as f32 * 2.0 - 1.0
+    };
+    let (dx, dy) = (unit(), unit());
+    let m = camera.shake_magnitude * fade;
+    camera.shake_offset = (dx * m, dy * m);
+}
+
+/// Largest world pass edge, in pixels.
+const MAX_PASS_SIZE: u32 = 4096;
+
+/// Composite and restart an open world pass so later draws use the current view.
+pub fn reopen_pass(video: &mut VideoState) {
+    if video.camera.pass.is_some() {
+        close_pass(video);
+        open_pass(video);
+    }
+}
+
+/// Redirect the framebuffer to a world pass for the current camera.
+pub fn open_pass(video: &mut VideoState) {
+    let (w, h) = (video.width, video.height);
+    let camera = &video.camera;
+
+    if camera.zoom == 1.0 && camera.rotation == 0.0 {
+        let (wx, wy) = camera.screen_to_world(0.0, 0.0, w, h);
+        video.camera.pass = Some(CameraPass {
+            origin: (wx.round() as i32, wy.round() as i32),
+            screen: None,
+            base: Vec::new(),
+            coverage: None,
+        });
+        return;
+    }
+
+    // World-space bounding box of the screen corners.
+    let (mut min_x, mut min_y, mut max_x, mut max_y) = (f32::MAX, f32::MAX, f32::MIN, f32::MIN);
+    for (sx, sy) in [(0, 0), (w, 0), (0, h), (w, h)] {
+        let (x, y) = camera.screen_to_world(sx as f32, sy as f32, w, h);
+        min_x = min_x.min(x);
+        min_y = min_y.min(y);
+        max_x = max_x.max(x);
+        max_y = max_y.max(y);
+    }
+    let origin = (min_x.floor() as i32 - 1, min_y.floor() as i32 - 1);
+    let pw = ((max_x.ceil() as i64 - origin.0 as i64 + 1) as u32).clamp(1, MAX_PASS_SIZE);
+    let ph = ((max_y.ceil() as i64 - origin.1 as i64 + 1) as u32).clamp(1, MAX_PASS_SIZE);
+
+    // Start from the screen as the camera sees it, so translucent draws blend over it.
+    let mut base = vec![0; pw as usize * ph as usize];
+    let canvas = !video.coverage.is_empty();
+    let mut base_coverage = vec![0; if canvas { base.len() } else { 0 }];
+    for py in 0..ph {
+        for px in 0..pw {
+            let wx = (origin.0 + px as i32) as f32 + 0.5;
+            let wy = (origin.1 + py as i32) as f32 + 0.5;
+            let (sx, sy) = camera.world_to_screen(wx, wy, w, h);
+            if sx >= 0.0 && sy >= 0.0 && sx < w as f32 && sy < h as f32 {
+                let (i, si) = (
+                    (py * pw + px) as usize,
+                    sy as usize * w as usize + sx as usize,
+                );
+                base[i] = video.framebuffer[si];
+                if canvas {
+                    base_coverage[i] = video.coverage[si];
+                }
+            }
+        }
+    }
+
+    let screen = std::mem::replace(&mut video.framebuffer, base.clone());
+    let coverage = canvas.then(|| {
+        let screen = std::mem::replace(&mut video.coverage, base_coverage.clone());
+        (screen, base_coverage)
+    });
+    video.width = pw;
+    video.height = ph;
+    video.camera.pass = Some(CameraPass {
+        origin,
+        screen: Some((screen, w, h)),
+        base,
+        coverage,
+    });
+}
+
+/// Composite an open world pass back onto the screen.
+pub fn close_pass(video: &mut VideoState) {
+    let Some(pass) = video.camera.pass.take() else {
+        return;
+    };
+    let Some((mut screen, w, h)) = pass.screen else {
+        return;
+    };
+    let (pw, ph) = (video.width, video.height);
+    let drawn = std::mem::take(&mut video.framebuffer);
+    let drawn_coverage = std::mem::take(&mut video.coverage);
+    let mut coverage = pass.coverage;
+    for sy in 0..h {
+        for sx in 0..w {
+            let (wx, wy) = video
+                .camera
+                .screen_to_world(sx as f32 + 0.5, sy as f32 + 0.5, w, h);
+            let px = (wx - pass.origin.0 as f32).floor();
+            let py = (wy - pass.origin.1 as f32).floor();
+            if px < 0.0 || py < 0.0 || px >= pw as f32 || py >= ph as f32 {
+                continue;
+            }
+            let i = py as usize * pw as usize + px as usize;
+            let si = (sy * w + sx) as usize;
+            match &mut coverage {
+                Some((screen_coverage, base_coverage)) => {
+                    if drawn[i] != pass.base[i] || drawn_coverage[i] != base_coverage[i] {
+                        screen[si] = drawn[i];
+                        screen_coverage[si] = drawn_coverage[i];
+                    }
+                }
+                None if drawn[i] != pass.base[i] => screen[si] = drawn[i],
+                None => {}
+            }
+        }
+    }
+    video.framebuffer = screen;
+    video.coverage = coverage.map_or_else(Vec::new, |(screen, _)| screen);
+    video.width = w;
+    video.height = h;
+}
@@ -0,0 +1,376 @@
+//! Mixer effects: a low-pass filter and a reverb, fed by per-voice and per-group send levels.
+//!
+//! A source with no sends mixes straight into the output as before. A source with sends is
+//! mixed into a scratch buffer first and split:
+//! - low-pass send `s` crossfades the source towards its filtered version (1.0 = fully
+//!   filtered, e.g. underwater),
+//! - reverb send `s` adds `s` of the source to the reverb input on top of the dry signal.
+//!
+//! Sends only count while their effect is enabled. Enabled effects run every drain even with
+//! nothing sent to them, so a reverb tail rings out after its source stops.
+
+use crate::state::{
+    AUDIO_EFFECT_LOWPASS, AUDIO_EFFECT_REVERB, AUDIO_EFFECTS, AUDIO_GROUPS, global,
+};
+
+use super::utils::sat_add_i16;
+
+/// Two cascaded one-pole low-pass filters per channel (12 dB/octave).
+#[derive(Debug, Clone)]
+pub struct LowPass {
+    pub cutoff_hz: f32,
+    state: [[f32; 2]; 2],
+}
+
+impl LowPass {
+    pub fn new(cutoff_hz: f32) -> Self {
+        Self {
+            cutoff_hz,
+            state: [[0.0; 2]; 2],
+        }
+    }
+
+    /// Filter interleaved stereo `buf` in place.
+    pub fn process(&mut self, sample_rate: u32, buf: &mut [f32]) {
+        let rate = sample_rate.max(1) as f32;
+        let a = 1.0 - (-2.0 * core::f32::consts::PI * self.cutoff_hz / rate).exp();
+        for frame in buf.chunks_exact_mut(2) {
+            for (c, x) in frame.iter_mut().enumerate() {
+                let [s1, s2] = &mut self.state[c];
+                *s1 += a * (*x - *s1);
+                *s2 += a * (*s1 - *s2);
+                *x = *s2;
+            }
+        }
+    }
+}
+
+/// Comb and all-pass delay lengths in frames at 44.1 kHz (after Freeverb).
+const COMB_LENGTHS: [usize; 4] = [1116, 1188, 1277, 1356];
+const ALLPASS_LENGTHS: [usize; 2] = [556, 441];
+/// Extra delay on the right channel so the two sides decorrelate.
+const STEREO_SPREAD: usize = 23;
+/// Input scaling into the comb bank, which has a large gain at long decays.
+const REVERB_INPUT_GAIN: f32 = 0.05;
+
+#[derive(Debug, Clone)]
+struct Delay {
+    buf: Vec<f32>,
+    pos: usize,
+    /// Comb filter low-pass memory (unused by all-passes).
+    store: f32,
+}
+
+impl Delay {
+    fn new(len: usize) -> Self {
+        Self {
+            buf: vec![0.0; len.max(1)],
+            pos: 0,
+            store: 0.0,
+        }
+    }
+
+    fn comb(&mut self, input: f32, feedback: f32, damping: f32) -> f32 {
+        let out = self.buf[self.pos];
+        self.store = out * (1.0 - damping) + self.store * damping;
+        self.buf[self.pos] = input + self.store * feedback;
+        self.pos = (self.pos + 1) % self.buf.len();
+        out
+    }
+
+    fn allpass(&mut self, input: f32) -> f32 {
+        let delayed = self.buf[self.pos];
+        self.buf[self.pos] = input + delayed * 0.5;
+        self.pos = (self.pos + 1) % self.buf.len();
+        delayed - input
+    }
+}
+
+/// A small Schroeder reverb: parallel damped combs into series all-passes, per channel.
+#[derive(Debug, Clone)]
+pub struct Reverb {
+    /// 0.0..=1.0: longer decay as it grows.
+    pub room_size: f32,
+    /// 0.0..=1.0: how quickly high frequencies die away.
+    pub damping: f32,
+    combs: [Vec<Delay>; 2],
+    allpasses: [Vec<Delay>; 2],
+}
+
+impl Reverb {
+    pub fn new(sample_rate: u32, room_size: f32, damping: f32) -> Self {
+        let scale =
+            |len: usize, c: usize| (len + c * STEREO_SPREAD) * sample_rate.max(1) as usize / 44_100;
+        let bank = |lengths: &[usize], c: usize| {
+            lengths
+                .iter()
+                .map(|&len| Delay::new(scale(len, c)))
+                .collect()
+        };
+        Self {
+            room_size,
+            damping,
+            combs: [bank(&COMB_LENGTHS, 0), bank(&COMB_LENGTHS, 1)],
+            allpasses: [bank(&ALLPASS_LENGTHS, 0), bank(&ALLPASS_LENGTHS, 1)],
+        }
+    }
+
+    /// Replace interleaved stereo `buf` with its reverberated (wet only) version.
+    pub fn process(&mut self, buf: &mut [f32]) {
+        let feedback = 0.7 + 0.28 * self.room_size;
+        let damping = self.damping * 0.4;
+        for frame in buf.chunks_exact_mut(2) {
+            for (c, x) in frame.iter_mut().enumerate() {
+                let input = *x * REVERB_INPUT_GAIN;
+                let mut out: f32 = self.combs[c]
+                    .iter_mut()
+                    .map(|comb| comb.comb(input, feedback, damping))
+                    .sum();
+                for ap in &mut self.allpasses[c] {
+                    out = ap.allpass(out);
+                }
+                *x = out;
+            }
+        }
+    }
+}
+
+/// Enabled effects and the send level of each mixer group.
+#[derive(Debug, Clone, Default)]
+pub struct Effects {
+    pub lowpass: Option<LowPass>,
+    pub reverb: Option<Reverb>,
+    pub group_sends: [[f32; AUDIO_EFFECTS]; AUDIO_GROUPS],
+}
+
+impl Effects {
+    fn enabled(&self, effect: usize) -> bool {
+        match effect {
+            AUDIO_EFFECT_LOWPASS => self.lowpass.is_some(),
+            AUDIO_EFFECT_REVERB => self.reverb.is_some(),
+            _ => false,
+        }
+    }
+
+    /// Send levels for a source: its own plus its group's, clamped to 1.0; 0.0 for disabled
+    /// effects.
+    pub fn sends(&self, group: u32, voice: [f32; AUDIO_EFFECTS]) -> [f32; AUDIO_EFFECTS] {
+        let group = self
+            .group_sends
+            .get(group as usize)
+            .copied()
+            .unwrap_or_default();
+        core::array::from_fn(|e| {
+            if self.enabled(e) {
+                (voice[e] + group[e]).min(1.0)
+            } else {
+                0.0
+            }
+        })
+    }
+}
+
+/// Send buses for one drain. They're only allocated once something uses them.
+#[derive(Default)]
+pub struct SendBuses {
+    scratch: Vec<i16>,
+    buses: [Vec<f32>; AUDIO_EFFECTS],
+}
+
+impl SendBuses {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    fn allocate(&mut self, samples: usize) {
+        self.scratch.resize(samples, 0);
+        for bus in &mut self.buses {
+            bus.resize(samples, 0.0);
+        }
+    }
+
+    /// Mix one source with `mix`: straight into `dry` without sends, otherwise split between
+    /// `dry` and the buses.
+    pub fn route(
+        &mut self,
+        sends: [f32; AUDIO_EFFECTS],
+        dry: &mut [i16],
+        mix: impl FnOnce(&mut [i16]),
+    ) {
+        if sends == [0.0; AUDIO_EFFECTS] {
+            mix(dry);
+            return;
+        }
+        self.allocate(dry.len());
+        self.scratch.fill(0);
+        mix(&mut self.scratch);
+        let dry_level = 1.0 - sends[AUDIO_EFFECT_LOWPASS];
+        for (i, &x) in self.scratch.iter().enumerate() {
+            let x = x as f32;
+            dry[i] = sat_add_i16(dry[i], (x * dry_level) as i16);
+            for (bus, send) in self.buses.iter_mut().zip(sends) {
+                bus[i] += x * send;
+            }
+        }
+    }
+
+    /// Run the enabled effects over their buses and add the results to `out`.
+    pub fn finish(mut self, effects: &mut Effects, sample_rate: u32, out: &mut [i16]) {
+        if effects.lowpass.is_none() && effects.reverb.is_none() {
+            return;
+        }
+        self.allocate(out.len());
+        if let Some(lp) = &mut effects.lowpass {
+            lp.process(sample_rate, &mut self.buses[AUDIO_EFFECT_LOWPASS]);
+        } else {
+            self.buses[AUDIO_EFFECT_LOWPASS].fill(0.0);
+        }
+        if let Some(reverb) = &mut effects.reverb {
+            reverb.process(&mut self.buses[AUDIO_EFFECT_REVERB]);
+        } else {
+            self.buses[AUDIO_EFFECT_REVERB].fill(0.0);
+        }
+        for (i, dst) in out.iter_mut().enumerate() {
+            let wet: f32 = self.buses.iter().map(|bus| bus[i]).sum();
+            *dst = sat_add_i16(*dst, wet as i16);
+        }
+    }
+}
+
+fn clamp_unit(v: f32) -> f32 {
+    if v.is_finite() {
+        v.clamp(0.0, 1.0)
+    } else {
+        0.0
+    }
+}
+
+/// Enable (or re-tune) an effect. Low-pass: `a` = cutoff in Hz, `b` unused. Reverb: `a` = room
+/// size and `b` = damping, both 0.0..=1.0. Returns 0 for an unknown effect.
+pub fn audio_effect_enable(effect: u32, a: f32, b: f32) -> u32 {
+    let mut s = global().lock().unwrap();
+    let sample_rate = s.audio.sample_rate;
+    let effects = &mut s.audio.effects;
+    match effect as usize {
+        AUDIO_EFFECT_LOWPASS => {
+            let cutoff = if a.is_finite() {
+                a.clamp(20.0, 20_000.0)
+            } else {
+                20_000.0
+            };
+            match &mut effects.lowpass {
+                Some(lp) => lp.cutoff_hz = cutoff,
+                None => effects.lowpass = Some(LowPass::new(cutoff)),
+            }
+        }
+        AUDIO_EFFECT_REVERB => match &mut effects.reverb {
+            Some(reverb) => {
+                reverb.room_size = clamp_unit(a);
+                reverb.damping = clamp_unit(b);
+            }
+            None => effects.reverb = Some(Reverb::new(sample_rate, clamp_unit(a), clamp_unit(b))),
+        },
+        _ => return 0,
+    }
+    1
+}
+
+/// Disable an effect, dropping its state (and any reverb tail).
+pub fn audio_effect_disable(effect: u32) {
+    let mut s = global().lock().unwrap();
+    match effect as usize {
+        AUDIO_EFFECT_LOWPASS => s.audio.effects.lowpass = None,
+        AUDIO_EFFECT_REVERB => s.audio.effects.reverb = None,
+        _ => {}
+    }
+}
+
+/// Set how much of a channel (by handle) goes to `effect`, 0.0..=1.0.
+pub fn audio_set_send(handle: u32, effect: u32, level: f32) {
+    if effect as usize >= AUDIO_EFFECTS || handle == 0 {
+        return;
+    }
+    let mut s = global().lock().unwrap();
+    if let Some(c) = s.audio.channels.iter_mut().find(|c| c.id == handle) {
+        c.sends[effect as usize] = clamp_unit(level);
+    }
+}
+
+/// Set how much of a synth voice goes to `effect`, 0.0..=1.0.
+pub fn audio_synth_set_send(voice: u32, effect: u32, level: f32) {
+    if effect as usize >= AUDIO_EFFECTS {
+        return;
+    }
+    let mut s = global().lock().unwrap();
+    if let Some(v) = s.audio.synth_voices.get_mut(&voice) {
+        v.sends[effect as usize] = clamp_unit(level);
+    }
+}
+
+/// Set how much of everything in a mixer group goes to `effect`, 0.0..=1.0. Adds to each
+/// source's own send.
+pub fn audio_group_set_send(group: u32, effect: u32, level: f32) {
+    if effect as usize >= AUDIO_EFFECTS || group as usize >= AUDIO_GROUPS {
+        return;
+    }
+    let mut s = global().lock().unwrap();
+    s.audio.effects.group_sends[group as usize][effect as usize] = clamp_unit(level);
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn sends_split_dry_and_wet() {
+        let mut effects = Effects {
+            lowpass: Some(LowPass::new(20_000.0)),
+            ..Default::default()
+        };
+        effects.group_sends[0][AUDIO_EFFECT_LOWPASS] = 0.25;
+        let sends = effects.sends(0, [0.5, 0.5]);
+        // Reverb is disabled, so its send doesn't count.
+        assert_eq!(sends, [0.75, 0.0]);
+        assert_eq!(effects.sends(3, [0.0; AUDIO_EFFECTS]), [0.0; AUDIO_EFFECTS]);
+
+        let mut buses = SendBuses::new();
+        let mut out = [0i16; 2];
+        buses.route(sends, &mut out, |buf| buf.fill(1000));
+        assert_eq!(out, [250, 250]);
+        assert_eq!(buses.buses[AUDIO_EFFECT_LOWPASS], [750.0, 750.0]);
+
+        // No sends: mixed straight into the output.
+        buses.route([0.0; AUDIO_EFFECTS], &mut out, |buf| buf.fill(1));
+        assert_eq!(out, [1, 1]);
+    }
+
+    #[test]
+    fn lowpass_smooths_and_settles() {
+        let mut lp = LowPass::new(1000.0);
+        let mut buf = vec![1000.0f32; 2000];
+        lp.process(44_100, &mut buf);
+        assert!(buf[0] < 100.0);
+        assert!((buf[1998] - 1000.0).abs() < 1.0);
+
+        // A Nyquist-rate square wave is mostly removed.
+        let mut buf: Vec<f32> = (0..2000)
+            .map(|i| if (i / 2) % 2 == 0 { 1000.0 } else { -1000.0 })
+            .collect();
+        let mut lp = LowPass::new(500.0);
+        lp.process(44_100, &mut buf);
+        assert!(buf[1000..].iter().all(|x| x.abs() < 50.0));
+    }
+
+    #[test]
+    fn reverb_tail_outlasts_the_impulse() {
+        let mut reverb = Reverb::new(44_100, 0.8, 0.2);
+        let mut buf = vec![0.0f32; 44_100];
+        buf[0] = 10_000.0;
+        buf[1] = 10_000.0;
+        reverb.process(&mut buf);
+        assert!(buf[..200].iter().all(|&x| x == 0.0));
+        let late = buf[30_000..].iter().fold(0.0f32, |m, x| m.max(x.abs()));
+        assert!(late > 1.0);
+        assert!(buf.iter().all(|x| x.abs() < 10_000.0));
+    }
+}
@@ -16,6 +16,7 @@ extern crate alloc;
 // Supported font sources:
 // - TTF/OTF fonts registered via `wasm96_graphics_font_register_ttf`
 // - BDF fonts registered via `wasm96_graphics_font_register_bdf`
+// - AngelCode BMFont (text `.fnt` + atlas image) registered via `wasm96_graphics_font_register_fnt`
 // - Built-in Spleen bitmap fonts selected via `wasm96_graphics_font_register_spleen`
 //
 // IMPORTANT: fallback behavior
@@ -42,7 +43,9 @@ extern crate alloc;
 //
 // -------------------------------------------------------------------------------------------------
 
-use crate::state::global;
+use crate::runtime::GuestLimits;
+use crate::state::{LineStyle, VideoState, global};
+use crate::system::loading::{self, Decoded};
 use wasmtime::Caller;
 
 // External crates for rendering
@@ -56,9 +59,14 @@ use std::collections::HashMap;
 // Storage ABI helpers
 use alloc::vec::Vec;
 
-use super::resources::{AvError, FontResource, GifResource, ImageResource, RESOURCES};
+use super::resources::{
+    AvError, FntGlyph, FontResource, GifPlayback, GifResource, ImageResource, RESOURCES,
+    ResourceError, registration_failed,
+};
+use super::sdf::SdfFont;
 use super::utils::{
-    graphics_image_from_host, graphics_line_internal, read_guest_bytes, system_millis, tri_edge,
+    Canvas, DrawEx, blit_ex, graphics_image_ex_from_host, graphics_image_from_host,
+    guest_range_fits, read_guest_bytes, system_millis, tri_edge, write_guest_bytes,
 };
 
 // Material parsing (MTL)
@@ -156,19 +164,33 @@ fn register_encoded_texture_by_extension(key: u64, filename: &str, encoded: &[u8
 }
 
 /// Set the screen dimensions. Resizes the host framebuffer.
+///
+/// Works at any time: the framebuffer is cleared to black and the next tick sees
+/// `graphics_resized`. Sizes are clamped to the largest frame the frontend was told about.
 pub fn graphics_set_size(width: u32, height: u32) {
     if width == 0 || height == 0 {
         return;
     }
+    let width = width.min(super::scaling::MAX_WIDTH);
+    let height = height.min(super::scaling::MAX_HEIGHT);
     let mut s = match global().lock() {
         Ok(g) => g,
         Err(poisoned) => poisoned.into_inner(),
     };
+    if (s.video.width, s.video.height) != (width, height) {
+        s.video.resize_pending = true;
+    }
+    super::layers::close_layer(&mut s.video);
+    let camera_pass = s.video.camera.pass.is_some();
+    super::mask::reset(&mut s.video);
     s.video.width = width;
     s.video.height = height;
     s.video.framebuffer.resize((width * height) as usize, 0);
     // Clear to black on resize
     s.video.framebuffer.fill(0);
+    if camera_pass {
+        super::camera::open_pass(&mut s.video);
+    }
 }
 
 /// Set the current drawing color.
@@ -183,6 +205,16 @@ pub fn graphics_set_color(r: u32, g: u32, b: u32, a: u32) {
     s.video.draw_color = color;
 }
 
+/// Set the tint multiplied into subsequent image, GIF and SVG draws. Opaque white disables it;
+/// alpha below 255 blends those draws over what's underneath.
+pub fn graphics_set_tint(r: u32, g: u32, b: u32, a: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.video.tint = ((a & 0xFF) << 24) | ((r & 0xFF) << 16) | ((g & 0xFF) << 8) | (b & 0xFF);
+}
+
 /// Clear the screen to a specific color.
 pub fn graphics_background(r: u32, g: u32, b: u32) {
     // Clear GL framebuffer (color + depth)
@@ -200,10 +232,12 @@ pub fn graphics_background(r: u32, g: u32, b: u32) {
     if gl_cleared {
         // Clear software framebuffer to transparent so it doesn't occlude the 3D scene
         s.video.framebuffer.fill(0x00000000);
+        s.video.coverage.fill(0);
     } else {
         // Fallback for software rendering: clear to requested color
         let color = ((r & 0xFF) << 16) | ((g & 0xFF) << 8) | (b & 0xFF);
         s.video.framebuffer.fill(color);
+        s.video.coverage.fill(255);
     }
 }
 
@@ -218,47 +252,173 @@ pub fn graphics_point(x: i32, y: i32) {
 
     if x >= 0 && x < w && y >= 0 && y < h {
         let idx = (y * w + x) as usize;
-        s.video.framebuffer[idx] = s.video.draw_color;
+        let color = s.video.draw_color;
+        Canvas::of(&mut s.video).put(idx, color);
     }
 }
 
-/// Draw a line using Bresenham's algorithm.
-pub fn graphics_line(mut x0: i32, mut y0: i32, x1: i32, y1: i32) {
+/// Maximum stroke width accepted by `graphics_set_line_width`.
+const MAX_LINE_WIDTH: u32 = 64;
+
+/// Set the stroke width used by lines and outlines. `0` is treated as `1`.
+pub fn graphics_set_line_width(px: u32) {
     let mut s = match global().lock() {
         Ok(g) => g,
         Err(poisoned) => poisoned.into_inner(),
     };
-    let w = s.video.width as i32;
-    let h = s.video.height as i32;
-    let color = s.video.draw_color;
-    let fb = &mut s.video.framebuffer;
+    s.video.line_width = px.clamp(1, MAX_LINE_WIDTH);
+}
+
+/// Set the dash pattern used by lines and outlines (0 = solid, 1 = dashed, 2 = dotted).
+pub fn graphics_set_line_style(style: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.video.line_style = LineStyle::from_u32(style);
+}
+
+/// Whether the pixel at `step` along a stroke is drawn for the given style.
+///
+/// Patterns scale with the stroke width so thick dashes keep their proportions.
+fn line_style_on(style: LineStyle, step: u32, width: u32) -> bool {
+    match style {
+        LineStyle::Solid => true,
+        LineStyle::Dashed => step % (10 * width) < 6 * width,
+        LineStyle::Dotted => step % (3 * width) < width,
+    }
+}
 
-    let dx = (x1 - x0).abs();
-    let dy = -(y1 - y0).abs();
-    let sx = if x0 < x1 { 1 } else { -1 };
-    let sy = if y0 < y1 { 1 } else { -1 };
-    let mut err = dx + dy;
+/// Stamp a round brush of diameter `width` centered on (x, y).
+fn stroke_plot(video: &mut VideoState, x: i32, y: i32) {
+    let w = video.width as i32;
+    let h = video.height as i32;
+    let width = video.line_width.max(1) as i32;
+    let color = video.draw_color;
+    let mut fb = Canvas::of(video);
 
-    loop {
-        if x0 >= 0 && x0 < w && y0 >= 0 && y0 < h {
-            fb[(y0 * w + x0) as usize] = color;
+    if width == 1 {
+        if x >= 0 && x < w && y >= 0 && y < h {
+            fb.put((y * w + x) as usize, color);
         }
+        return;
+    }
 
-        if x0 == x1 && y0 == y1 {
-            break;
-        }
-        let e2 = 2 * err;
-        if e2 >= dy {
-            err += dy;
-            x0 += sx;
+    // Offsets lo..=hi around the center; compare in doubled coordinates so even widths work.
+    let lo = -((width - 1) / 2);
+    let hi = lo + width - 1;
+    let mid = lo + hi;
+    for dy in lo..=hi {
+        for dx in lo..=hi {
+            let (ex, ey) = (2 * dx - mid, 2 * dy - mid);
+            if ex * ex + ey * ey > width * width {
+                continue;
+            }
+            let (px, py) = (x + dx, y + dy);
+            if px >= 0 && px < w && py >= 0 && py < h {
+                fb.put((py * w + px) as usize, color);
+            }
         }
-        if e2 <= dx {
-            err += dx;
-            y0 += sy;
+    }
+}
+
+/// Stroke a connected path with the current line width and style.
+///
+/// The dash phase carries across vertices so patterns don't restart on every segment, and
+/// shared vertices are only stamped once.
+pub(super) fn stroke_path(video: &mut VideoState, points: &[(i32, i32)], closed: bool) {
+    let width = video.line_width.max(1);
+    let style = video.line_style;
+    let mut step: u32 = 0;
+
+    let Some(&first) = points.first() else {
+        return;
+    };
+    if points.len() == 1 {
+        stroke_plot(video, first.0, first.1);
+        return;
+    }
+
+    let segments = points.len() - 1 + usize::from(closed && points.len() > 2);
+    for i in 0..segments {
+        let (mut x0, mut y0) = points[i];
+        let (x1, y1) = points[(i + 1) % points.len()];
+
+        // Bresenham's algorithm.
+        let dx = (x1 - x0).abs();
+        let dy = -(y1 - y0).abs();
+        let sx = if x0 < x1 { 1 } else { -1 };
+        let sy = if y0 < y1 { 1 } else { -1 };
+        let mut err = dx + dy;
+        let mut skip = i > 0;
+
+        loop {
+            if !skip {
+                if line_style_on(style, step, width) {
+                    stroke_plot(video, x0, y0);
+                }
+                step = step.wrapping_add(1);
+            }
+            skip = false;
+
+            if x0 == x1 && y0 == y1 {
+                break;
+            }
+            let e2 = 2 * err;
+            if e2 >= dy {
+                err += dy;
+                x0 += sx;
+            }
+            if e2 <= dx {
+                err += dx;
+                y0 += sy;
+            }
         }
     }
 }
 
+/// Draw a line using Bresenham's algorithm, honoring the current line width and style.
+pub fn graphics_line(x0: i32, y0: i32, x1: i32, y1: i32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    stroke_path(&mut s.video, &[(x0, y0), (x1, y1)], false);
+}
+
+/// Stroke a path through `points` with the current line width and style.
+fn graphics_stroke_points(points: &[(i32, i32)], closed: bool) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    stroke_path(&mut s.video, points, closed);
+}
+
+/// Whether outlines can take the 1px solid fast paths.
+fn stroke_is_hairline() -> bool {
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.video.line_width <= 1 && s.video.line_style == LineStyle::Solid
+}
+
+/// Points approximating an ellipse, about one vertex per 2px of circumference.
+fn ellipse_points(cx: i32, cy: i32, rx: u32, ry: u32) -> Vec<(i32, i32)> {
+    let circumference = core::f32::consts::TAU * (rx.max(ry) as f32);
+    let segments = (circumference / 2.0).ceil().clamp(8.0, 1024.0) as u32;
+    (0..segments)
+        .map(|i| {
+            let a = core::f32::consts::TAU * i as f32 / segments as f32;
+            (
+                (cx as f32 + rx as f32 * a.cos()).round() as i32,
+                (cy as f32 + ry as f32 * a.sin()).round() as i32,
+            )
+        })
+        .collect()
+}
+
 /// Draw a filled rectangle.
 pub fn graphics_rect(x: i32, y: i32, w: u32, h: u32) {
     let mut s = global().lock().unwrap();
@@ -276,25 +436,19 @@ pub fn graphics_rect(x: i32, y: i32, w: u32, h: u32) {
     }
 
     let fb_w = s.video.width as usize;
-    let fb = &mut s.video.framebuffer;
+    let mut fb = Canvas::of(&mut s.video);
 
     for curr_y in y_start..y_end {
         let start_idx = (curr_y as usize) * fb_w + (x_start as usize);
         let end_idx = (curr_y as usize) * fb_w + (x_end as usize);
-        fb[start_idx..end_idx].fill(color);
+        fb.fill(start_idx..end_idx, color);
     }
 }
 
 /// Draw a rectangle outline.
 pub fn graphics_rect_outline(x: i32, y: i32, w: u32, h: u32) {
-    // Top
-    graphics_line_internal(x, y, x + w as i32, y);
-    // Bottom
-    graphics_line_internal(x, y + h as i32, x + w as i32, y + h as i32);
-    // Left
-    graphics_line_internal(x, y, x, y + h as i32);
-    // Right
-    graphics_line_internal(x + w as i32, y, x + w as i32, y + h as i32);
+    let (x1, y1) = (x + w as i32, y + h as i32);
+    graphics_stroke_points(&[(x, y), (x1, y), (x1, y1), (x, y1)], true);
 }
 
 /// Draw a filled circle.
@@ -306,7 +460,7 @@ pub fn graphics_circle(cx: i32, cy: i32, r: u32) {
     let w = s.video.width as i32;
     let h = s.video.height as i32;
     let color = s.video.draw_color;
-    let fb = &mut s.video.framebuffer;
+    let mut fb = Canvas::of(&mut s.video);
 
     let r_sq = (r * r) as i32;
     let r_i32 = r as i32;
@@ -321,7 +475,112 @@ pub fn graphics_circle(cx: i32, cy: i32, r: u32) {
             let dx = x - cx;
             let dy = y - cy;
             if dx * dx + dy * dy <= r_sq {
-                fb[(y * w + x) as usize] = color;
+                fb.put((y * w + x) as usize, color);
+            }
+        }
+    }
+}
+
+/// Convert a guest color packed as 0xRRGGBBAA into the framebuffer's 0xAARRGGBB layout.
+#[inline]
+fn rgba_to_argb(c: u32) -> u32 {
+    c.rotate_right(8)
+}
+
+/// Linearly interpolate two 0xAARRGGBB colors per channel. `t` is 0..=256.
+#[inline]
+fn lerp_argb(a: u32, b: u32, t: u32) -> u32 {
+    let mut out = 0u32;
+    for shift in [0, 8, 16, 24] {
+        let ca = (a >> shift) & 0xFF;
+        let cb = (b >> shift) & 0xFF;
+        let c = (ca * (256 - t) + cb * t) >> 8;
+        out |= (c & 0xFF) << shift;
+    }
+    out
+}
+
+/// Draw a rectangle filled with a bilinear gradient between four corner colors.
+///
+/// Colors are packed 0xRRGGBBAA.
+pub fn graphics_rect_gradient(
+    x: i32,
+    y: i32,
+    w: u32,
+    h: u32,
+    top_left: u32,
+    top_right: u32,
+    bottom_left: u32,
+    bottom_right: u32,
+) {
+    if w == 0 || h == 0 {
+        return;
+    }
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let screen_w = s.video.width as i32;
+    let screen_h = s.video.height as i32;
+    let mut fb = Canvas::of(&mut s.video);
+
+    let (tl, tr) = (rgba_to_argb(top_left), rgba_to_argb(top_right));
+    let (bl, br) = (rgba_to_argb(bottom_left), rgba_to_argb(bottom_right));
+
+    let x_start = x.max(0);
+    let y_start = y.max(0);
+    let x_end = (x + w as i32).min(screen_w);
+    let y_end = (y + h as i32).min(screen_h);
+
+    // Map the first and last row/column exactly onto the corner colors.
+    let span_x = (w - 1).max(1) as i64;
+    let span_y = (h - 1).max(1) as i64;
+
+    for curr_y in y_start..y_end {
+        let ty = (((curr_y - y) as i64 * 256) / span_y) as u32;
+        let left = lerp_argb(tl, bl, ty);
+        let right = lerp_argb(tr, br, ty);
+        let row = (curr_y as usize) * (screen_w as usize);
+        for curr_x in x_start..x_end {
+            let tx = (((curr_x - x) as i64 * 256) / span_x) as u32;
+            fb.put(row + curr_x as usize, lerp_argb(left, right, tx));
+        }
+    }
+}
+
+/// Draw a filled circle with a radial gradient from `inner` at the center to `outer` at the edge.
+///
+/// Colors are packed 0xRRGGBBAA.
+pub fn graphics_circle_gradient(cx: i32, cy: i32, r: u32, inner: u32, outer: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let w = s.video.width as i32;
+    let h = s.video.height as i32;
+    let mut fb = Canvas::of(&mut s.video);
+
+    let (inner, outer) = (rgba_to_argb(inner), rgba_to_argb(outer));
+    let r_i32 = r as i32;
+    let r_sq = (r as i64) * (r as i64);
+
+    let x_min = (cx - r_i32).max(0);
+    let x_max = (cx + r_i32).min(w);
+    let y_min = (cy - r_i32).max(0);
+    let y_max = (cy + r_i32).min(h);
+
+    for y in y_min..y_max {
+        for x in x_min..x_max {
+            let dx = (x - cx) as i64;
+            let dy = (y - cy) as i64;
+            let d_sq = dx * dx + dy * dy;
+            if d_sq <= r_sq {
+                let t = if r == 0 {
+                    0
+                } else {
+                    (((d_sq as f32).sqrt() / r as f32) * 256.0).min(256.0) as u32
+                };
+                fb.put((y * w + x) as usize, lerp_argb(inner, outer, t));
             }
         }
     }
@@ -330,6 +589,11 @@ pub fn graphics_circle(cx: i32, cy: i32, r: u32) {
 /// Draw a circle outline (Bresenham's circle algorithm).
 /// Draw a circle outline.
 pub fn graphics_circle_outline(cx: i32, cy: i32, r: u32) {
+    if !stroke_is_hairline() {
+        graphics_stroke_points(&ellipse_points(cx, cy, r, r), true);
+        return;
+    }
+
     let mut s = match global().lock() {
         Ok(g) => g,
         Err(poisoned) => poisoned.into_inner(),
@@ -337,7 +601,7 @@ pub fn graphics_circle_outline(cx: i32, cy: i32, r: u32) {
     let w = s.video.width as i32;
     let h = s.video.height as i32;
     let color = s.video.draw_color;
-    let fb = &mut s.video.framebuffer;
+    let mut fb = Canvas::of(&mut s.video);
 
     let mut x = 0;
     let mut y = r as i32;
@@ -345,7 +609,7 @@ pub fn graphics_circle_outline(cx: i32, cy: i32, r: u32) {
 
     let mut plot = |x: i32, y: i32| {
         if x >= 0 && x < w && y >= 0 && y < h {
-            fb[(y * w + x) as usize] = color;
+            fb.put((y * w + x) as usize, color);
         }
     };
 
@@ -372,7 +636,7 @@ pub fn graphics_circle_outline(cx: i32, cy: i32, r: u32) {
 /// Draw an image from guest memory.
 /// `ptr` points to RGBA bytes (4 bytes per pixel).
 pub fn graphics_image(
-    caller: &mut Caller<'_, ()>,
+    caller: &mut Caller<'_, GuestLimits>,
     x: i32,
     y: i32,
     img_w: u32,
@@ -412,7 +676,7 @@ pub fn graphics_image(
     };
     let screen_w = s.video.width as i32;
     let screen_h = s.video.height as i32;
-    let fb = &mut s.video.framebuffer;
+    let mut fb = Canvas::of(&mut s.video);
 
     // Clipping
     let x_start = x.max(0);
@@ -444,7 +708,7 @@ pub fn graphics_image(
                 // Real blending would be: result = alpha * src + (1-alpha) * dst
                 // For now, just overwrite if not fully transparent.
                 let color = ((r as u32) << 16) | ((g as u32) << 8) | (b as u32);
-                fb[dst_row_start + (curr_x as usize)] = color;
+                fb.put(dst_row_start + (curr_x as usize), color);
             }
         }
     }
@@ -452,11 +716,135 @@ pub fn graphics_image(
     Ok(())
 }
 
+/// Copy an RGBA8888 pixel block from guest memory straight into the framebuffer.
+///
+/// Unlike `graphics_image`, every pixel is written (including alpha) so a buffer obtained from
+/// `graphics_framebuffer_read` round-trips exactly.
+pub fn graphics_framebuffer_write(
+    caller: &mut Caller<'_, GuestLimits>,
+    x: i32,
+    y: i32,
+    w: u32,
+    h: u32,
+    ptr: u32,
+    len: u32,
+) -> Result<(), AvError> {
+    let Some(required) = w.checked_mul(h).and_then(|n| n.checked_mul(4)) else {
+        return Ok(());
+    };
+    if len < required {
+        return Ok(());
+    }
+    let data = read_guest_bytes(caller, ptr, required)?;
+    framebuffer_write_rgba(x, y, w, h, &data);
+    Ok(())
+}
+
+/// Copy a `w`x`h` block of the framebuffer into guest memory as RGBA8888.
+///
+/// Returns the number of bytes written, or 0 if the destination buffer is too small.
+/// Pixels outside the screen read as zero.
+pub fn graphics_framebuffer_read(
+    caller: &mut Caller<'_, GuestLimits>,
+    x: i32,
+    y: i32,
+    w: u32,
+    h: u32,
+    ptr: u32,
+    len: u32,
+) -> Result<u32, AvError> {
+    let Some(required) = w.checked_mul(h).and_then(|n| n.checked_mul(4)) else {
+        return Ok(0);
+    };
+    if len < required {
+        return Ok(0);
+    }
+    if !guest_range_fits(caller, ptr, required)? {
+        return Err(AvError::MemoryWriteFailed);
+    }
+    let data = framebuffer_read_rgba(x, y, w, h);
+    write_guest_bytes(caller, ptr, &data)?;
+    Ok(required)
+}
+
+/// Write RGBA8888 pixels into the framebuffer, clipped to the screen.
+pub fn framebuffer_write_rgba(x: i32, y: i32, w: u32, h: u32, data: &[u8]) {
+    let needed = (w as usize)
+        .checked_mul(h as usize)
+        .and_then(|n| n.checked_mul(4));
+    if needed.is_none_or(|needed| data.len() < needed) {
+        return;
+    }
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let screen_w = s.video.width as i32;
+    let screen_h = s.video.height as i32;
+    let mut fb = Canvas::of(&mut s.video);
+    let (xs, ys) = clip_block(x, y, w, h, screen_w, screen_h);
+
+    for curr_y in ys {
+        let src_row = (curr_y as i64 - y as i64) as usize * (w as usize);
+        let dst_row = (curr_y as usize) * (screen_w as usize);
+        for curr_x in xs.clone() {
+            let i = (src_row + (curr_x as i64 - x as i64) as usize) * 4;
+            let [r, g, b, a] = [data[i], data[i + 1], data[i + 2], data[i + 3]];
+            fb.put(
+                dst_row + curr_x as usize,
+                ((a as u32) << 24) | ((r as u32) << 16) | ((g as u32) << 8) | (b as u32),
+            );
+        }
+    }
+}
+
+/// The on-screen columns and rows of a `w`x`h` block at (x, y). Computed in `i64` so blocks
+/// reaching past `i32::MAX` clip instead of wrapping.
+fn clip_block(
+    x: i32,
+    y: i32,
+    w: u32,
+    h: u32,
+    screen_w: i32,
+    screen_h: i32,
+) -> (std::ops::Range<i32>, std::ops::Range<i32>) {
+    let x_end = (x as i64 + w as i64).min(screen_w as i64) as i32;
+    let y_end = (y as i64 + h as i64).min(screen_h as i64) as i32;
+    (x.max(0)..x_end, y.max(0)..y_end)
+}
+
+/// Read a block of the framebuffer as RGBA8888. Off-screen pixels are zero.
+pub fn framebuffer_read_rgba(x: i32, y: i32, w: u32, h: u32) -> Vec<u8> {
+    let mut out = vec![0u8; (w as usize) * (h as usize) * 4];
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let screen_w = s.video.width as i32;
+    let screen_h = s.video.height as i32;
+    let fb = &s.video.framebuffer;
+    let (xs, ys) = clip_block(x, y, w, h, screen_w, screen_h);
+
+    for curr_y in ys {
+        let dst_row = (curr_y as i64 - y as i64) as usize * (w as usize);
+        let src_row = (curr_y as usize) * (screen_w as usize);
+        for curr_x in xs.clone() {
+            let c = fb[src_row + curr_x as usize];
+            let i = (dst_row + (curr_x as i64 - x as i64) as usize) * 4;
+            out[i] = (c >> 16) as u8;
+            out[i + 1] = (c >> 8) as u8;
+            out[i + 2] = c as u8;
+            out[i + 3] = (c >> 24) as u8;
+        }
+    }
+    out
+}
+
 /// Decode PNG bytes from guest memory and draw at (x, y) at the image's natural size.
 ///
 /// If decoding fails, this is a no-op.
 pub fn graphics_image_png(
-    env: &mut Caller<'_, ()>,
+    env: &mut Caller<'_, GuestLimits>,
     x: i32,
     y: i32,
     ptr: u32,
@@ -477,7 +865,7 @@ pub fn graphics_image_png(
 ///
 /// If decoding fails, this is a no-op.
 pub fn graphics_image_jpeg(
-    env: &mut Caller<'_, ()>,
+    env: &mut Caller<'_, GuestLimits>,
     x: i32,
     y: i32,
     ptr: u32,
@@ -512,7 +900,7 @@ pub fn graphics_image_jpeg(
 /// - This keeps the host stateless regarding filesystem paths while still enabling OBJ+MTL style
 ///   materials in a "ROM-bytes only" environment.
 pub fn graphics_mtl_register_texture(
-    env: &mut Caller<'_, ()>,
+    env: &mut Caller<'_, GuestLimits>,
     texture_key: u64,
     mtl_ptr: u32,
     mtl_len: u32,
@@ -647,19 +1035,19 @@ fn decode_jpeg_to_rgba(jpeg_bytes: &[u8]) -> Option<ImageResource> {
 
 /// Register a PNG under a string key (bytes are encoded PNG).
 pub fn graphics_png_register(
-    env: &mut Caller<'_, ()>,
+    env: &mut Caller<'_, GuestLimits>,
     key: u64,
     data_ptr: u32,
     data_len: u32,
 ) -> u32 {
     let png_bytes = match read_guest_bytes(env, data_ptr, data_len) {
         Ok(b) => b,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Memory),
     };
 
     let decoded = match decode_png_to_rgba(&png_bytes) {
         Some(d) => d,
-        None => return 0,
+        None => return registration_failed(ResourceError::Invalid),
     };
 
     let mut res = RESOURCES.lock().unwrap();
@@ -711,19 +1099,19 @@ pub fn graphics_png_unregister(key: u64) {
 
 /// Register a JPEG under a string key (bytes are encoded JPEG).
 pub fn graphics_jpeg_register(
-    env: &mut Caller<'_, ()>,
+    env: &mut Caller<'_, GuestLimits>,
     key: u64,
     data_ptr: u32,
     data_len: u32,
 ) -> u32 {
     let jpeg_bytes = match read_guest_bytes(env, data_ptr, data_len) {
         Ok(b) => b,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Memory),
     };
 
     let decoded = match decode_jpeg_to_rgba(&jpeg_bytes) {
         Some(d) => d,
-        None => return 0,
+        None => return registration_failed(ResourceError::Invalid),
     };
 
     let mut res = RESOURCES.lock().unwrap();
@@ -731,6 +1119,47 @@ pub fn graphics_jpeg_register(
     1
 }
 
+/// Decode PNG or JPEG bytes, picked by magic number.
+pub(crate) fn decode_image_to_rgba(bytes: &[u8]) -> Option<ImageResource> {
+    if bytes.starts_with(b"\x89PNG") {
+        decode_png_to_rgba(bytes)
+    } else if bytes.starts_with(&[0xFF, 0xD8]) {
+        decode_jpeg_to_rgba(bytes)
+    } else {
+        None
+    }
+}
+
+/// Register a PNG or JPEG under a string key, decoding in the background (see
+/// `system::loading`).
+///
+/// Returns a load handle at once (0 if guest memory can't be read). The key draws nothing
+/// until the load is ready; an undecodable image fails the load.
+pub fn graphics_image_register_async(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    data_ptr: u32,
+    data_len: u32,
+) -> u32 {
+    let bytes = match read_guest_bytes(env, data_ptr, data_len) {
+        Ok(b) => b,
+        Err(_) => return registration_failed(ResourceError::Memory),
+    };
+
+    let id = {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        loading::begin(&mut s, |_, _| false)
+    };
+    loading::spawn(id, move || {
+        let image = decode_image_to_rgba(&bytes)?;
+        Some(Decoded::Image { key, image })
+    });
+    id
+}
+
 /// Draw a keyed JPEG at natural size.
 pub fn graphics_jpeg_draw_key(key: u64, x: i32, y: i32) {
     graphics_image_draw_key(key, x, y);
@@ -805,44 +1234,321 @@ fn graphics_image_draw_key_scaled(key: u64, x: i32, y: i32, w: u32, h: u32) {
     graphics_image_from_host(x, y, w, h, &dst);
 }
 
-/// Draw a filled triangle using a barycentric (edge-function) rasterizer.
-///
-/// Properties:
-/// - Works for any vertex order (winding), filled area is consistent.
-/// - Clips to framebuffer bounds.
-/// - Uses integer edge functions for stability/determinism.
-///
-/// Rasterization rule:
-/// - We treat pixels as **samples at pixel centers**: (x + 0.5, y + 0.5).
-///   This avoids cases where a triangle covers no integer lattice points and would
-///   otherwise render as empty for small/skinny triangles.
-pub fn graphics_triangle(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
-    let mut s = match global().lock() {
-        Ok(g) => g,
-        Err(poisoned) => poisoned.into_inner(),
-    };
-    let w = s.video.width as i32;
-    let h = s.video.height as i32;
-    if w <= 0 || h <= 0 {
-        return;
+/// Nearest-neighbor sample the `sw`x`sh` region at (`sx`, `sy`) of an RGBA image into a `w`x`h`
+/// RGBA buffer. Parts of the region outside the image come out transparent.
+pub fn sample_region(
+    src: &[u8],
+    src_w: u32,
+    src_h: u32,
+    (sx, sy, sw, sh): (i32, i32, u32, u32),
+    w: u32,
+    h: u32,
+) -> Vec<u8> {
+    let mut dst = vec![0u8; (w as usize).saturating_mul(h as usize).saturating_mul(4)];
+    if sw == 0 || sh == 0 {
+        return dst;
+    }
+    for dy in 0..h {
+        let py = sy as i64 + (dy as u64 * sh as u64 / h as u64) as i64;
+        if py < 0 || py >= src_h as i64 {
+            continue;
+        }
+        for dx in 0..w {
+            let px = sx as i64 + (dx as u64 * sw as u64 / w as u64) as i64;
+            if px < 0 || px >= src_w as i64 {
+                continue;
+            }
+            let sidx = ((py as usize) * (src_w as usize) + (px as usize)) * 4;
+            let didx = ((dy as usize) * (w as usize) + (dx as usize)) * 4;
+            if let Some(px) = src.get(sidx..sidx + 4) {
+                dst[didx..didx + 4].copy_from_slice(px);
+            }
+        }
     }
+    dst
+}
 
-    let color = s.video.draw_color;
-    let fb = &mut s.video.framebuffer;
+/// Draw the `sw`x`sh` region at (`sx`, `sy`) of a keyed PNG/JPEG, scaled to `w`x`h` (the region's
+/// own size if either is 0). This is how sprite-sheet frames are drawn.
+#[allow(clippy::too_many_arguments)]
+pub fn graphics_image_draw_region(
+    key: u64,
+    sx: i32,
+    sy: i32,
+    sw: u32,
+    sh: u32,
+    x: i32,
+    y: i32,
+    w: u32,
+    h: u32,
+) {
+    let (w, h) = if w == 0 || h == 0 { (sw, sh) } else { (w, h) };
+    let dst = {
+        let res = RESOURCES.lock().unwrap();
+        let Some(img) = res.keyed_images.get(&key) else {
+            return;
+        };
+        sample_region(&img.rgba, img.width, img.height, (sx, sy, sw, sh), w, h)
+    };
+    graphics_image_from_host(x, y, w, h, &dst);
+}
 
-    // Use 2x fixed-point coordinates so we can represent pixel centers as integers.
-    // A pixel center at (x + 0.5, y + 0.5) becomes P2 = (2x + 1, 2y + 1).
-    let v0 = (x1 * 2, y1 * 2);
-    let v1 = (x2 * 2, y2 * 2);
-    let v2 = (x3 * 2, y3 * 2);
+/// Split `total` into start/middle/end spans for a nine-slice axis, shrinking the fixed `start`
+/// and `end` proportionally when they don't fit.
+fn nine_slice_spans(total: u32, start: u32, end: u32) -> [(u32, u32); 3] {
+    let (start, end) = if start + end > total {
+        let start = (start as u64 * total as u64 / (start + end) as u64) as u32;
+        (start, total - start)
+    } else {
+        (start, end)
+    };
+    [(0, start), (start, total - start - end), (total - end, end)]
+}
 
-    // Degenerate (area==0): nothing to fill.
-    let area = tri_edge(v0, v1, v2);
-    if area == 0 {
-        return;
+/// Render an RGBA image as a `w`x`h` nine-slice: the corners (`left`/`top`/`right`/`bottom`
+/// pixels of the source) keep their size, the edges stretch along one axis and the center along
+/// both. Insets larger than the source are clamped.
+pub fn nine_slice(
+    src: &[u8],
+    src_w: u32,
+    src_h: u32,
+    w: u32,
+    h: u32,
+    (left, top, right, bottom): (u32, u32, u32, u32),
+) -> Vec<u8> {
+    let left = left.min(src_w);
+    let right = right.min(src_w - left);
+    let top = top.min(src_h);
+    let bottom = bottom.min(src_h - top);
+
+    let src_cols = [
+        (0, left),
+        (left, src_w - left - right),
+        (src_w - right, right),
+    ];
+    let src_rows = [
+        (0, top),
+        (top, src_h - top - bottom),
+        (src_h - bottom, bottom),
+    ];
+    let dst_cols = nine_slice_spans(w, left, right);
+    let dst_rows = nine_slice_spans(h, top, bottom);
+
+    let mut out = vec![0u8; (w as usize) * (h as usize) * 4];
+    for (&(sy, sh), &(dy, dh)) in src_rows.iter().zip(&dst_rows) {
+        for (&(sx, sw), &(dx, dw)) in src_cols.iter().zip(&dst_cols) {
+            if dw == 0 || dh == 0 {
+                continue;
+            }
+            let cell = sample_region(src, src_w, src_h, (sx as i32, sy as i32, sw, sh), dw, dh);
+            for row in 0..dh as usize {
+                let from = row * dw as usize * 4;
+                let to = ((dy as usize + row) * w as usize + dx as usize) * 4;
+                out[to..to + dw as usize * 4].copy_from_slice(&cell[from..from + dw as usize * 4]);
+            }
+        }
     }
+    out
+}
 
-    // Bounding box in pixel coordinates (inclusive), computed from the triangle vertices.
+/// Draw a keyed PNG/JPEG as a `w`x`h` nine-slice panel (see [`nine_slice`]).
+#[allow(clippy::too_many_arguments)]
+pub fn graphics_image_draw_nine_slice(
+    key: u64,
+    x: i32,
+    y: i32,
+    w: u32,
+    h: u32,
+    left: u32,
+    top: u32,
+    right: u32,
+    bottom: u32,
+) {
+    let rgba = {
+        let res = RESOURCES.lock().unwrap();
+        let Some(img) = res.keyed_images.get(&key) else {
+            return;
+        };
+        let insets = (left, top, right, bottom);
+        nine_slice(&img.rgba, img.width, img.height, w, h, insets)
+    };
+    graphics_image_from_host(x, y, w, h, &rgba);
+}
+
+/// Bytes per instance in a `graphics_image_draw_batch` buffer.
+pub const DRAW_INSTANCE_SIZE: usize = 32;
+
+/// One sprite of a batch: the `sw`x`sh` source region at (`sx`, `sy`) drawn with its top-left at
+/// (`x`, `y`), rotated by `angle` radians clockwise around its center and multiplied by `tint`
+/// (0xAARRGGBB, like `VideoState::tint`). A zero `sw` or `sh` means the whole image.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct DrawInstance {
+    pub x: i32,
+    pub y: i32,
+    pub sx: i32,
+    pub sy: i32,
+    pub sw: u32,
+    pub sh: u32,
+    pub angle: f32,
+    pub tint: u32,
+}
+
+/// Decode packed little-endian instances: x `i32`, y `i32`, sx `i32`, sy `i32`, sw `u32`,
+/// sh `u32`, angle `f32`, tint `u32` (0xRRGGBBAA). A trailing partial instance is ignored.
+pub fn parse_draw_instances(data: &[u8]) -> Vec<DrawInstance> {
+    data.chunks_exact(DRAW_INSTANCE_SIZE)
+        .map(|c| {
+            let word =
+                |i: usize| u32::from_le_bytes([c[i * 4], c[i * 4 + 1], c[i * 4 + 2], c[i * 4 + 3]]);
+            let rgba = word(7);
+            DrawInstance {
+                x: word(0) as i32,
+                y: word(1) as i32,
+                sx: word(2) as i32,
+                sy: word(3) as i32,
+                sw: word(4),
+                sh: word(5),
+                angle: f32::from_bits(word(6)),
+                tint: (rgba << 24) | (rgba >> 8),
+            }
+        })
+        .collect()
+}
+
+/// Multiply two 0xAARRGGBB tints channel by channel.
+fn combine_tints(a: u32, b: u32) -> u32 {
+    (0..4).fold(0, |out, i| {
+        let shift = i * 8;
+        let c = ((a >> shift) & 0xFF) * ((b >> shift) & 0xFF) / 255;
+        out | (c << shift)
+    })
+}
+
+/// Draw `count` packed instances (see `parse_draw_instances`) of a keyed PNG/JPEG in one call.
+/// Each instance's tint is combined with the current tint.
+pub fn graphics_image_draw_batch(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    ptr: u32,
+    count: u32,
+) {
+    let Some(len) = (count as usize).checked_mul(DRAW_INSTANCE_SIZE) else {
+        return;
+    };
+    let Ok(data) = read_guest_bytes(env, ptr, len as u32) else {
+        return;
+    };
+    let instances = parse_draw_instances(&data);
+
+    let res = RESOURCES.lock().unwrap();
+    let Some(img) = res.keyed_images.get(&key) else {
+        return;
+    };
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let size = (s.video.width, s.video.height);
+    let tint = s.video.tint;
+    let origin = s.video.camera.pass.as_ref().map_or((0, 0), |p| p.origin);
+    for inst in instances {
+        let (sw, sh) = if inst.sw == 0 || inst.sh == 0 {
+            (img.width, img.height)
+        } else {
+            (inst.sw, inst.sh)
+        };
+        let region = (inst.sx, inst.sy, sw, sh);
+        let src = sample_region(&img.rgba, img.width, img.height, region, sw, sh);
+        let d = DrawEx {
+            x: inst.x.saturating_sub(origin.0),
+            y: inst.y.saturating_sub(origin.1),
+            w: sw,
+            h: sh,
+            angle: inst.angle,
+            flags: 0,
+            pivot_x: (sw / 2) as i32,
+            pivot_y: (sh / 2) as i32,
+        };
+        let tint = combine_tints(tint, inst.tint);
+        blit_ex(&mut Canvas::of(&mut s.video), size, &src, (sw, sh), d, tint);
+    }
+}
+
+/// Draw a keyed PNG/JPEG scaled to `w`x`h` (natural size if either is 0), mirrored per `flags`
+/// (`DRAW_FLIP_X`, `DRAW_FLIP_Y`) and rotated by `angle` radians clockwise around
+/// (`pivot_x`, `pivot_y`), measured from the unrotated top-left at (`x`, `y`).
+#[allow(clippy::too_many_arguments)]
+pub fn graphics_image_draw_ex(
+    key: u64,
+    x: i32,
+    y: i32,
+    w: u32,
+    h: u32,
+    angle: f32,
+    flags: u32,
+    pivot_x: i32,
+    pivot_y: i32,
+) {
+    let res = RESOURCES.lock().unwrap();
+    let Some(img) = res.keyed_images.get(&key) else {
+        return;
+    };
+    let (w, h) = if w == 0 || h == 0 {
+        (img.width, img.height)
+    } else {
+        (w, h)
+    };
+    let d = DrawEx {
+        x,
+        y,
+        w,
+        h,
+        angle,
+        flags,
+        pivot_x,
+        pivot_y,
+    };
+    graphics_image_ex_from_host(&img.rgba, img.width, img.height, d);
+}
+
+/// Draw a filled triangle using a barycentric (edge-function) rasterizer.
+///
+/// Properties:
+/// - Works for any vertex order (winding), filled area is consistent.
+/// - Clips to framebuffer bounds.
+/// - Uses integer edge functions for stability/determinism.
+///
+/// Rasterization rule:
+/// - We treat pixels as **samples at pixel centers**: (x + 0.5, y + 0.5).
+///   This avoids cases where a triangle covers no integer lattice points and would
+///   otherwise render as empty for small/skinny triangles.
+pub fn graphics_triangle(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let w = s.video.width as i32;
+    let h = s.video.height as i32;
+    if w <= 0 || h <= 0 {
+        return;
+    }
+
+    let color = s.video.draw_color;
+    let mut fb = Canvas::of(&mut s.video);
+
+    // Use 2x fixed-point coordinates so we can represent pixel centers as integers.
+    // A pixel center at (x + 0.5, y + 0.5) becomes P2 = (2x + 1, 2y + 1).
+    let v0 = (x1 * 2, y1 * 2);
+    let v1 = (x2 * 2, y2 * 2);
+    let v2 = (x3 * 2, y3 * 2);
+
+    // Degenerate (area==0): nothing to fill.
+    let area = tri_edge(v0, v1, v2);
+    if area == 0 {
+        return;
+    }
+
+    // Bounding box in pixel coordinates (inclusive), computed from the triangle vertices.
     // We convert from 2x space back into pixel indices.
     let min_x = ((v0.0.min(v1.0).min(v2.0)) >> 1).max(0);
     let max_x = ((v0.0.max(v1.0).max(v2.0)) >> 1).min(w - 1);
@@ -880,7 +1586,7 @@ pub fn graphics_triangle(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
             let w2 = tri_edge(v2, v0, p) * sign;
 
             if w0 >= 0 && w1 >= 0 && w2 >= 0 {
-                fb[row + x as usize] = color;
+                fb.put(row + x as usize, color);
             }
         }
     }
@@ -888,9 +1594,7 @@ pub fn graphics_triangle(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
 
 /// Draw a triangle outline.
 pub fn graphics_triangle_outline(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
-    graphics_line(x1, y1, x2, y2);
-    graphics_line(x2, y2, x3, y3);
-    graphics_line(x3, y3, x1, y1);
+    graphics_stroke_points(&[(x1, y1), (x2, y2), (x3, y3)], true);
 }
 
 /// Draw a quadratic Bezier curve.
@@ -906,18 +1610,17 @@ pub fn graphics_bezier_quadratic(
     if segments == 0 {
         return;
     }
-    let mut prev_x = x1 as f32;
-    let mut prev_y = y1 as f32;
+    let mut points = Vec::with_capacity(segments as usize + 1);
+    points.push((x1, y1));
     for i in 1..=segments {
         let t = i as f32 / segments as f32;
         let x =
             (1.0 - t).powi(2) * x1 as f32 + 2.0 * (1.0 - t) * t * cx as f32 + t.powi(2) * x2 as f32;
         let y =
             (1.0 - t).powi(2) * y1 as f32 + 2.0 * (1.0 - t) * t * cy as f32 + t.powi(2) * y2 as f32;
-        graphics_line(prev_x as i32, prev_y as i32, x as i32, y as i32);
-        prev_x = x;
-        prev_y = y;
+        points.push((x as i32, y as i32));
     }
+    graphics_stroke_points(&points, false);
 }
 
 /// Draw a cubic Bezier curve.
@@ -935,8 +1638,8 @@ pub fn graphics_bezier_cubic(
     if segments == 0 {
         return;
     }
-    let mut prev_x = x1 as f32;
-    let mut prev_y = y1 as f32;
+    let mut points = Vec::with_capacity(segments as usize + 1);
+    points.push((x1, y1));
     for i in 1..=segments {
         let t = i as f32 / segments as f32;
         let x = (1.0 - t).powi(3) * x1 as f32
@@ -947,10 +1650,9 @@ pub fn graphics_bezier_cubic(
             + 3.0 * (1.0 - t).powi(2) * t * cy1 as f32
             + 3.0 * (1.0 - t) * t.powi(2) * cy2 as f32
             + t.powi(3) * y2 as f32;
-        graphics_line(prev_x as i32, prev_y as i32, x as i32, y as i32);
-        prev_x = x;
-        prev_y = y;
+        points.push((x as i32, y as i32));
     }
+    graphics_stroke_points(&points, false);
 }
 
 /// Draw a filled pill.
@@ -981,38 +1683,493 @@ pub fn graphics_pill_outline(x: i32, y: i32, w: u32, h: u32) {
     graphics_circle_outline(x + w as i32 - r, y + r, r as u32);
 }
 
+/// Maximum number of vertices accepted by a single polygon/polyline call.
+const MAX_POLY_POINTS: u32 = 65_536;
+
+/// Read `count` packed `(x: i32, y: i32)` little-endian vertices from guest memory.
+fn read_guest_points(
+    caller: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    count: u32,
+) -> Result<Vec<(i32, i32)>, AvError> {
+    let count = count.min(MAX_POLY_POINTS);
+    let bytes = read_guest_bytes(caller, ptr, count * 8)?;
+    Ok(bytes
+        .chunks_exact(8)
+        .map(|c| {
+            (
+                i32::from_le_bytes([c[0], c[1], c[2], c[3]]),
+                i32::from_le_bytes([c[4], c[5], c[6], c[7]]),
+            )
+        })
+        .collect())
+}
+
+/// Translate guest vertices into the open camera pass.
+fn camera_points(points: Vec<(i32, i32)>) -> Vec<(i32, i32)> {
+    points
+        .into_iter()
+        .map(|(x, y)| super::camera::camera_point(x, y))
+        .collect()
+}
+
+/// Draw a filled polygon from a packed vertex buffer in guest memory.
+///
+/// `ptr` points to `count` vertices, each two little-endian `i32`s (x, y).
+pub fn graphics_polygon(
+    caller: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    count: u32,
+) -> Result<(), AvError> {
+    let points = camera_points(read_guest_points(caller, ptr, count)?);
+    graphics_polygon_points(&points);
+    Ok(())
+}
+
+/// Draw a connected line strip from a packed vertex buffer in guest memory.
+///
+/// If `closed` is true, the last vertex is joined back to the first.
+pub fn graphics_polyline(
+    caller: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    count: u32,
+    closed: bool,
+) -> Result<(), AvError> {
+    let points = camera_points(read_guest_points(caller, ptr, count)?);
+    graphics_polyline_points(&points, closed);
+    Ok(())
+}
+
+/// Fill a polygon given as a list of vertices.
+///
+/// Uses scanline filling with the even-odd rule, so self-intersecting polygons leave their
+/// overlapping regions empty. Like `graphics_triangle`, pixels are sampled at their centers.
+pub fn graphics_polygon_points(points: &[(i32, i32)]) {
+    if points.len() < 3 {
+        return;
+    }
+
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let w = s.video.width as i32;
+    let h = s.video.height as i32;
+    if w <= 0 || h <= 0 {
+        return;
+    }
+    let color = s.video.draw_color;
+    let mut fb = Canvas::of(&mut s.video);
+
+    let min_y = points.iter().map(|p| p.1).min().unwrap_or(0).max(0);
+    let max_y = points.iter().map(|p| p.1).max().unwrap_or(0).min(h - 1);
+
+    let mut crossings: Vec<f32> = Vec::with_capacity(points.len());
+    for y in min_y..=max_y {
+        let sample_y = y as f32 + 0.5;
+
+        crossings.clear();
+        for i in 0..points.len() {
+            let (ax, ay) = points[i];
+            let (bx, by) = points[(i + 1) % points.len()];
+            if ay == by {
+                continue;
+            }
+            let (lo, hi) = if ay < by { (ay, by) } else { (by, ay) };
+            // Half-open span so a vertex shared by two edges is counted once.
+            if sample_y < lo as f32 || sample_y >= hi as f32 {
+                continue;
+            }
+            let t = (sample_y - ay as f32) / (by - ay) as f32;
+            crossings.push(ax as f32 + t * (bx - ax) as f32);
+        }
+        crossings.sort_by(|a, b| a.partial_cmp(b).unwrap_or(core::cmp::Ordering::Equal));
+
+        let row = (y as usize) * (w as usize);
+        for span in crossings.chunks_exact(2) {
+            // Pixel x is covered when its center x + 0.5 lies in [span[0], span[1]).
+            let x_start = ((span[0] - 0.5).ceil() as i32).max(0);
+            let x_end = ((span[1] - 0.5).ceil() as i32).min(w);
+            if x_start < x_end {
+                fb.fill(row + x_start as usize..row + x_end as usize, color);
+            }
+        }
+    }
+}
+
+/// Draw line segments between consecutive vertices, optionally closing the loop.
+pub fn graphics_polyline_points(points: &[(i32, i32)], closed: bool) {
+    graphics_stroke_points(points, closed);
+}
+
+/// Draw a filled axis-aligned ellipse centered at (cx, cy) with radii (rx, ry).
+pub fn graphics_ellipse(cx: i32, cy: i32, rx: u32, ry: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let w = s.video.width as i32;
+    let h = s.video.height as i32;
+    let color = s.video.draw_color;
+    let mut fb = Canvas::of(&mut s.video);
+
+    let rx2 = rx as i64 * rx as i64;
+    let ry2 = ry as i64 * ry as i64;
+    let limit = rx2 * ry2;
+
+    let x_min = (cx - rx as i32).max(0);
+    let x_max = (cx + rx as i32).min(w - 1);
+    let y_min = (cy - ry as i32).max(0);
+    let y_max = (cy + ry as i32).min(h - 1);
+
+    for y in y_min..=y_max {
+        let dy = (y - cy) as i64;
+        for x in x_min..=x_max {
+            let dx = (x - cx) as i64;
+            // (dx/rx)^2 + (dy/ry)^2 <= 1, multiplied through to stay in integers.
+            if dx * dx * ry2 + dy * dy * rx2 <= limit {
+                fb.put((y * w + x) as usize, color);
+            }
+        }
+    }
+}
+
+/// Draw an axis-aligned ellipse outline (midpoint ellipse algorithm).
+pub fn graphics_ellipse_outline(cx: i32, cy: i32, rx: u32, ry: u32) {
+    if !stroke_is_hairline() {
+        graphics_stroke_points(&ellipse_points(cx, cy, rx, ry), true);
+        return;
+    }
+    if rx == 0 || ry == 0 {
+        graphics_line(
+            cx - rx as i32,
+            cy - ry as i32,
+            cx + rx as i32,
+            cy + ry as i32,
+        );
+        return;
+    }
+
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let w = s.video.width as i32;
+    let h = s.video.height as i32;
+    let color = s.video.draw_color;
+    let mut fb = Canvas::of(&mut s.video);
+
+    let mut plot4 = |x: i32, y: i32| {
+        for (px, py) in [
+            (cx + x, cy + y),
+            (cx - x, cy + y),
+            (cx + x, cy - y),
+            (cx - x, cy - y),
+        ] {
+            if px >= 0 && px < w && py >= 0 && py < h {
+                fb.put((py * w + px) as usize, color);
+            }
+        }
+    };
+
+    let rx2 = rx as i64 * rx as i64;
+    let ry2 = ry as i64 * ry as i64;
+    let mut x: i64 = 0;
+    let mut y: i64 = ry as i64;
+    let mut px: i64 = 0;
+    let mut py: i64 = 2 * rx2 * y;
+
+    // Region 1: slope magnitude < 1, step in x. Decision values are scaled by 4 to stay integral.
+    let mut p = 4 * ry2 - 4 * rx2 * ry as i64 + rx2;
+    while px < py {
+        plot4(x as i32, y as i32);
+        x += 1;
+        px += 2 * ry2;
+        if p < 0 {
+            p += 4 * (ry2 + px);
+        } else {
+            y -= 1;
+            py -= 2 * rx2;
+            p += 4 * (ry2 + px - py);
+        }
+    }
+
+    // Region 2: slope magnitude >= 1, step in y.
+    let mut p = ry2 * (2 * x + 1) * (2 * x + 1) + 4 * rx2 * (y - 1) * (y - 1) - 4 * rx2 * ry2;
+    while y >= 0 {
+        plot4(x as i32, y as i32);
+        y -= 1;
+        py -= 2 * rx2;
+        if p > 0 {
+            p += 4 * (rx2 - py);
+        } else {
+            x += 1;
+            px += 2 * ry2;
+            p += 4 * (rx2 - py + px);
+        }
+    }
+}
+
+/// Normalize an angle sweep to `(start, sweep)` with `0 <= start < 2π` and `0 <= sweep <= 2π`.
+fn normalize_arc(start: f32, end: f32) -> (f32, f32) {
+    use core::f32::consts::TAU;
+    let (mut a, mut b) = (start, end);
+    if b < a {
+        core::mem::swap(&mut a, &mut b);
+    }
+    let sweep = (b - a).min(TAU);
+    (a.rem_euclid(TAU), sweep)
+}
+
+/// Draw a circular arc centered at (cx, cy).
+///
+/// Angles are in radians, measured clockwise from the +x axis (screen y points down).
+pub fn graphics_arc(cx: i32, cy: i32, r: u32, start: f32, end: f32) {
+    if !start.is_finite() || !end.is_finite() {
+        return;
+    }
+    let (start, sweep) = normalize_arc(start, end);
+
+    // Roughly one segment per 2px of arc length keeps curves smooth without overdraw.
+    let segments = ((r as f32 * sweep) / 2.0).ceil().clamp(4.0, 512.0) as u32;
+    let point_at = |t: f32| {
+        let a = start + sweep * t;
+        (
+            (cx as f32 + r as f32 * a.cos()).round() as i32,
+            (cy as f32 + r as f32 * a.sin()).round() as i32,
+        )
+    };
+
+    let points: Vec<(i32, i32)> = (0..=segments)
+        .map(|i| point_at(i as f32 / segments as f32))
+        .collect();
+    graphics_stroke_points(&points, false);
+}
+
+/// Draw a filled circular sector (pie slice) centered at (cx, cy).
+///
+/// Angles follow the same convention as `graphics_arc`.
+pub fn graphics_arc_filled(cx: i32, cy: i32, r: u32, start: f32, end: f32) {
+    use core::f32::consts::TAU;
+
+    if !start.is_finite() || !end.is_finite() {
+        return;
+    }
+    let (start, sweep) = normalize_arc(start, end);
+    if sweep >= TAU {
+        graphics_ellipse(cx, cy, r, r);
+        return;
+    }
+
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let w = s.video.width as i32;
+    let h = s.video.height as i32;
+    let color = s.video.draw_color;
+    let mut fb = Canvas::of(&mut s.video);
+
+    let r_i32 = r as i32;
+    let r_sq = r as i64 * r as i64;
+
+    let x_min = (cx - r_i32).max(0);
+    let x_max = (cx + r_i32).min(w - 1);
+    let y_min = (cy - r_i32).max(0);
+    let y_max = (cy + r_i32).min(h - 1);
+
+    for y in y_min..=y_max {
+        let dy = y - cy;
+        for x in x_min..=x_max {
+            let dx = x - cx;
+            if (dx as i64 * dx as i64 + dy as i64 * dy as i64) > r_sq {
+                continue;
+            }
+            // The center pixel belongs to every slice so adjacent slices meet without a hole.
+            if dx != 0 || dy != 0 {
+                let angle = (dy as f32).atan2(dx as f32);
+                if (angle - start).rem_euclid(TAU) > sweep {
+                    continue;
+                }
+            }
+            fb.put((y * w + x) as usize, color);
+        }
+    }
+}
+
 /// Create SVG resource.
 /// Register SVG resource under a string key.
 pub fn graphics_svg_register(
-    caller: &mut Caller<'_, ()>,
+    caller: &mut Caller<'_, GuestLimits>,
     key: u64,
     data_ptr: u32,
     data_len: u32,
 ) -> u32 {
     let data = match read_guest_bytes(caller, data_ptr, data_len) {
         Ok(d) => d,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Memory),
     };
 
     // Reuse the existing SVG parser logic by feeding bytes directly.
     let svg_str = match std::str::from_utf8(&data) {
         Ok(s) => s,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Invalid),
     };
 
     let tree = match Tree::from_str(svg_str, &usvg::Options::default()) {
         Ok(t) => t,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Invalid),
     };
 
     let mut res = RESOURCES.lock().unwrap();
     let id = res.next_id;
     res.next_id += 1;
     res.svgs.insert(id, tree);
+    res.svg_sources.insert(id, svg_str.to_string());
     res.keyed_svgs.insert(key, id);
     1
 }
 
+/// Intrinsic size of a keyed SVG in pixels (rounded up), packed as `(width << 32) | height`.
+/// Returns 0 if the key is unknown.
+pub fn graphics_svg_size(key: u64) -> u64 {
+    let res = RESOURCES.lock().unwrap();
+    let Some(tree) = res.keyed_svgs.get(&key).and_then(|id| res.svgs.get(id)) else {
+        return 0;
+    };
+    let size = tree.size();
+    ((size.width().ceil() as u64) << 32) | size.height().ceil() as u64
+}
+
+/// Set the fill of the elements of a keyed SVG matching `selector` to `color` (0xRRGGBBAA).
+///
+/// `#name` matches an element id, `.name` a class, and a bare `name` either. The fill replaces
+/// the element's `fill` attribute and any `fill` in its inline style; children without a fill of
+/// their own inherit it. Returns the number of elements recolored.
+pub fn graphics_svg_set_fill(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    selector_ptr: u32,
+    selector_len: u32,
+    color: u32,
+) -> u32 {
+    let Ok(selector) = read_guest_bytes(env, selector_ptr, selector_len) else {
+        return 0;
+    };
+    let Ok(selector) = std::str::from_utf8(&selector) else {
+        return 0;
+    };
+
+    let mut res = RESOURCES.lock().unwrap();
+    let Some(&id) = res.keyed_svgs.get(&key) else {
+        return 0;
+    };
+    let Some(source) = res.svg_sources.get(&id) else {
+        return 0;
+    };
+    let (recolored, count) = recolor_svg(source, selector, color);
+    if count == 0 {
+        return 0;
+    }
+    let Ok(tree) = Tree::from_str(&recolored, &usvg::Options::default()) else {
+        return 0;
+    };
+    res.svgs.insert(id, tree);
+    res.svg_sources.insert(id, recolored);
+    count as u32
+}
+
+/// Escape text for a double-quoted XML attribute value.
+fn xml_attr_escape(value: &str) -> String {
+    value
+        .replace('&', "&amp;")
+        .replace('<', "&lt;")
+        .replace('"', "&quot;")
+}
+
+/// Rewrite SVG markup so the elements matching `selector` (see `graphics_svg_set_fill`) fill with
+/// `color` (0xRRGGBBAA). Returns the new markup and how many elements matched.
+///
+/// The markup is parsed as XML, so comments, CDATA, entities and either quote style are handled;
+/// only the start tags of matching elements are edited and the rest is kept byte for byte.
+pub fn recolor_svg(source: &str, selector: &str, color: u32) -> (String, usize) {
+    let (target, by_id, by_class) = if let Some(id) = selector.strip_prefix('#') {
+        (id, true, false)
+    } else if let Some(class) = selector.strip_prefix('.') {
+        (class, false, true)
+    } else {
+        (selector, true, true)
+    };
+    if target.is_empty() {
+        return (source.to_string(), 0);
+    }
+    let options = roxmltree::ParsingOptions {
+        allow_dtd: true,
+        ..roxmltree::ParsingOptions::default()
+    };
+    let Ok(doc) = roxmltree::Document::parse_with_options(source, options) else {
+        return (source.to_string(), 0);
+    };
+    let fill = format!(
+        " fill=\"#{:06x}\" fill-opacity=\"{}\"",
+        color >> 8,
+        (color & 0xFF) as f32 / 255.0
+    );
+
+    // (range, replacement) edits of the source, applied back to front.
+    let mut edits: Vec<(std::ops::Range<usize>, String)> = Vec::new();
+    let mut count = 0;
+    for node in doc.descendants().filter(|n| n.is_element()) {
+        let matches = (by_id && node.attribute("id") == Some(target))
+            || (by_class
+                && node
+                    .attribute("class")
+                    .is_some_and(|c| c.split_whitespace().any(|c| c == target)));
+        if !matches {
+            continue;
+        }
+        count += 1;
+
+        for attr in node.attributes().filter(|a| a.namespace().is_none()) {
+            match attr.name() {
+                "fill" | "fill-opacity" => edits.push((attr.range(), String::new())),
+                "style" => {
+                    let style = attr
+                        .value()
+                        .split(';')
+                        .filter(|decl| {
+                            let prop = decl.split(':').next().unwrap_or("").trim();
+                            !prop.eq_ignore_ascii_case("fill")
+                                && !prop.eq_ignore_ascii_case("fill-opacity")
+                        })
+                        .collect::<Vec<_>>()
+                        .join(";");
+                    let style = if style.trim().is_empty() {
+                        String::new()
+                    } else {
+                        format!("style=\"{}\"", xml_attr_escape(&style))
+                    };
+                    edits.push((attr.range(), style));
+                }
+                _ => {}
+            }
+        }
+        // The new fill goes right after the element name.
+        let start = node.range().start + 1;
+        let name_end = source[start..]
+            .find(|c: char| c.is_whitespace() || c == '/' || c == '>')
+            .map_or(source.len(), |i| start + i);
+        edits.push((name_end..name_end, fill.clone()));
+    }
+
+    let mut out = source.to_string();
+    edits.sort_by_key(|(range, _)| std::cmp::Reverse(range.start));
+    for (range, replacement) in edits {
+        out.replace_range(range, &replacement);
+    }
+    (out, count)
+}
+
 /// Draw keyed SVG.
 pub fn graphics_svg_draw_key(key: u64, x: i32, y: i32, w: u32, h: u32) {
     let id = {
@@ -1063,19 +2220,20 @@ pub fn graphics_svg_draw(id: u32, x: i32, y: i32, w: u32, h: u32) {
 pub fn graphics_svg_destroy(id: u32) {
     let mut res = RESOURCES.lock().unwrap();
     res.svgs.remove(&id);
+    res.svg_sources.remove(&id);
 }
 
 /// Create GIF resource.
-pub fn graphics_gif_create(env: &mut Caller<'_, ()>, ptr: u32, len: u32) -> u32 {
+pub fn graphics_gif_create(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
     let data = match read_guest_bytes(env, ptr, len) {
         Ok(d) => d,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Memory),
     };
 
     let cursor = std::io::Cursor::new(&data);
     let mut decoder = match gif::DecodeOptions::new().read_info(cursor) {
         Ok(d) => d,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Invalid),
     };
 
     let width = decoder.width();
@@ -1095,7 +2253,7 @@ pub fn graphics_gif_create(env: &mut Caller<'_, ()>, ptr: u32, len: u32) -> u32
 
     while let Some(frame) = match decoder.read_next_frame() {
         Ok(f) => f,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Invalid),
     } {
         // 1. Handle disposal of the *previous* frame
         match last_disposal {
@@ -1232,6 +2390,7 @@ pub fn graphics_gif_create(env: &mut Caller<'_, ()>, ptr: u32, len: u32) -> u32
             delays,
             width,
             height,
+            playback: GifPlayback::default(),
         },
     );
     id
@@ -1246,24 +2405,7 @@ pub fn graphics_gif_draw(id: u32, x: i32, y: i32) {
 pub fn graphics_gif_draw_scaled(id: u32, x: i32, y: i32, w: u32, h: u32) {
     let res = RESOURCES.lock().unwrap();
     if let Some(gif) = res.gifs.get(&id) {
-        let millis = system_millis();
-        let total_delay_ms: u64 = gif.delays.iter().map(|&d| d as u64 * 10).sum();
-
-        let mut frame_idx = 0;
-        if total_delay_ms > 0 {
-            let mut rem = millis % total_delay_ms;
-            for (i, &d) in gif.delays.iter().enumerate() {
-                let d_ms = d as u64 * 10;
-                // Treat 0 delay as 100ms (common GIF viewer behavior)
-                let effective_delay = if d_ms == 0 { 100 } else { d_ms };
-                if rem < effective_delay {
-                    frame_idx = i;
-                    break;
-                }
-                rem = rem.saturating_sub(effective_delay);
-            }
-        }
-
+        let frame_idx = gif_current_frame(gif);
         let src_rgba = &gif.frames[frame_idx];
         let src_w = gif.width as u32;
         let src_h = gif.height as u32;
@@ -1304,6 +2446,33 @@ pub fn graphics_gif_draw_scaled(id: u32, x: i32, y: i32, w: u32, h: u32) {
     }
 }
 
+/// Index of the frame a GIF shows `millis` into its (looping) playback.
+fn gif_frame_at(gif: &GifResource, millis: u64) -> usize {
+    let total_delay_ms: u64 = gif.delays.iter().map(|&d| gif_delay_millis(d)).sum();
+    if total_delay_ms == 0 {
+        return 0;
+    }
+    let mut rem = millis % total_delay_ms;
+    for (i, &d) in gif.delays.iter().enumerate() {
+        let effective_delay = gif_delay_millis(d);
+        if rem < effective_delay {
+            return i;
+        }
+        rem = rem.saturating_sub(effective_delay);
+    }
+    0
+}
+
+/// Index of the frame a GIF shows now, following its playback controls.
+fn gif_current_frame(gif: &GifResource) -> usize {
+    gif_frame_at(gif, gif.playback.position_at(system_millis()))
+}
+
+/// A GIF frame delay (10ms units) in milliseconds. Zero delays play as 100ms, as most viewers do.
+pub fn gif_delay_millis(delay: u16) -> u64 {
+    if delay == 0 { 100 } else { delay as u64 * 10 }
+}
+
 /// Destroy GIF.
 pub fn graphics_gif_destroy(id: u32) {
     let mut res = RESOURCES.lock().unwrap();
@@ -1312,7 +2481,7 @@ pub fn graphics_gif_destroy(id: u32) {
 
 /// Register GIF resource under a string key.
 pub fn graphics_gif_register(
-    env: &mut Caller<'_, ()>,
+    env: &mut Caller<'_, GuestLimits>,
     key: u64,
     data_ptr: u32,
     data_len: u32,
@@ -1351,6 +2520,141 @@ pub fn graphics_gif_draw_key_scaled(key: u64, x: i32, y: i32, w: u32, h: u32) {
     }
 }
 
+/// Number of frames in a keyed GIF (0 if it isn't registered).
+pub fn graphics_gif_frame_count(key: u64) -> u32 {
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_gifs
+        .get(&key)
+        .and_then(|id| res.gifs.get(id))
+        .map_or(0, |gif| gif.frames.len() as u32)
+}
+
+/// Delay of one frame of a keyed GIF in milliseconds (0 if the GIF or frame doesn't exist).
+pub fn graphics_gif_frame_delay(key: u64, frame: u32) -> u32 {
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_gifs
+        .get(&key)
+        .and_then(|id| res.gifs.get(id))
+        .and_then(|gif| gif.delays.get(frame as usize))
+        .map_or(0, |&d| gif_delay_millis(d) as u32)
+}
+
+/// Jump a keyed GIF's playback to the start of `frame` (wrapping around). Paused GIFs stay on it.
+pub fn graphics_gif_set_frame(key: u64, frame: u32) {
+    let mut res = RESOURCES.lock().unwrap();
+    let Some(&id) = res.keyed_gifs.get(&key) else {
+        return;
+    };
+    let Some(gif) = res.gifs.get_mut(&id) else {
+        return;
+    };
+    if gif.delays.is_empty() {
+        return;
+    }
+    let frame = frame as usize % gif.delays.len();
+    let start: u64 = gif.delays[..frame]
+        .iter()
+        .map(|&d| gif_delay_millis(d))
+        .sum();
+    gif.playback.position_millis = start as f64;
+    gif.playback.anchor_millis = system_millis();
+}
+
+/// Scale a keyed GIF's playback speed (1 = normal, 0 = frozen; negative is treated as 0).
+pub fn graphics_gif_set_speed(key: u64, multiplier: f32) {
+    let mut res = RESOURCES.lock().unwrap();
+    let Some(&id) = res.keyed_gifs.get(&key) else {
+        return;
+    };
+    let Some(gif) = res.gifs.get_mut(&id) else {
+        return;
+    };
+    gif.playback.rebase(system_millis());
+    gif.playback.speed = if multiplier.is_finite() {
+        multiplier.max(0.0)
+    } else {
+        1.0
+    };
+}
+
+/// Pause (`paused != 0`) or resume a keyed GIF's playback where it is.
+pub fn graphics_gif_pause(key: u64, paused: u32) {
+    let mut res = RESOURCES.lock().unwrap();
+    let Some(&id) = res.keyed_gifs.get(&key) else {
+        return;
+    };
+    let Some(gif) = res.gifs.get_mut(&id) else {
+        return;
+    };
+    gif.playback.rebase(system_millis());
+    gif.playback.paused = paused != 0;
+}
+
+/// Draw one frame of a keyed GIF, ignoring the host clock. `w`/`h` of 0 means natural size.
+/// Frame indices wrap around.
+pub fn graphics_gif_draw_frame(key: u64, frame: u32, x: i32, y: i32, w: u32, h: u32) {
+    let drawn = {
+        let res = RESOURCES.lock().unwrap();
+        let Some(gif) = res.keyed_gifs.get(&key).and_then(|id| res.gifs.get(id)) else {
+            return;
+        };
+        if gif.frames.is_empty() {
+            return;
+        }
+        let rgba = &gif.frames[frame as usize % gif.frames.len()];
+        let (src_w, src_h) = (gif.width as u32, gif.height as u32);
+        if w == 0 || h == 0 {
+            (src_w, src_h, rgba.clone())
+        } else {
+            let region = (0, 0, src_w, src_h);
+            (w, h, sample_region(rgba, src_w, src_h, region, w, h))
+        }
+    };
+    let (w, h, rgba) = drawn;
+    graphics_image_from_host(x, y, w, h, &rgba);
+}
+
+/// Draw a keyed GIF (current frame by the host clock) rotated and/or flipped; see
+/// [`graphics_image_draw_ex`].
+#[allow(clippy::too_many_arguments)]
+pub fn graphics_gif_draw_ex(
+    key: u64,
+    x: i32,
+    y: i32,
+    w: u32,
+    h: u32,
+    angle: f32,
+    flags: u32,
+    pivot_x: i32,
+    pivot_y: i32,
+) {
+    let res = RESOURCES.lock().unwrap();
+    let Some(gif) = res.keyed_gifs.get(&key).and_then(|id| res.gifs.get(id)) else {
+        return;
+    };
+    if gif.frames.is_empty() {
+        return;
+    }
+    let rgba = &gif.frames[gif_current_frame(gif)];
+    let (src_w, src_h) = (gif.width as u32, gif.height as u32);
+    let (w, h) = if w == 0 || h == 0 {
+        (src_w, src_h)
+    } else {
+        (w, h)
+    };
+    let d = DrawEx {
+        x,
+        y,
+        w,
+        h,
+        angle,
+        flags,
+        pivot_x,
+        pivot_y,
+    };
+    graphics_image_ex_from_host(rgba, src_w, src_h, d);
+}
+
 /// Unregister keyed GIF and destroy its underlying resource.
 pub fn graphics_gif_unregister(key: u64) {
     let id = {
@@ -1379,15 +2683,15 @@ pub fn graphics_gif_unregister(key: u64) {
 /// Notes:
 /// - The host stores the parsed `Font` in `RESOURCES.fonts` under the returned id.
 /// - The guest never sees this id; guests use the original `key` (u64) when drawing/measuring text.
-pub fn graphics_font_upload_ttf(env: &mut Caller<'_, ()>, ptr: u32, len: u32) -> u32 {
+pub fn graphics_font_upload_ttf(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
     let data = match read_guest_bytes(env, ptr, len) {
         Ok(d) => d,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Memory),
     };
 
     let font = match Font::from_bytes(data, FontSettings::default()) {
         Ok(f) => f,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Invalid),
     };
 
     let mut res = RESOURCES.lock().unwrap();
@@ -1397,15 +2701,15 @@ pub fn graphics_font_upload_ttf(env: &mut Caller<'_, ()>, ptr: u32, len: u32) ->
     id
 }
 
-pub fn graphics_font_upload_bdf(env: &mut Caller<'_, ()>, ptr: u32, len: u32) -> u32 {
+pub fn graphics_font_upload_bdf(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
     let data = match read_guest_bytes(env, ptr, len) {
         Ok(d) => d,
-        Err(_) => return 0,
+        Err(_) => return registration_failed(ResourceError::Memory),
     };
 
-    let (glyphs, width, height) = match parse_bdf(&data) {
+    let (glyphs, width, height, descent) = match parse_bdf(&data) {
         Some(res) => res,
-        None => return 0,
+        None => return registration_failed(ResourceError::Invalid),
     };
 
     let mut res = RESOURCES.lock().unwrap();
@@ -1416,6 +2720,7 @@ pub fn graphics_font_upload_bdf(env: &mut Caller<'_, ()>, ptr: u32, len: u32) ->
         FontResource::Bdf {
             width,
             height,
+            descent,
             glyphs,
         },
     );
@@ -1441,7 +2746,7 @@ pub fn graphics_font_upload_bdf(env: &mut Caller<'_, ()>, ptr: u32, len: u32) ->
 /// - Register fonts once during guest `setup()`.
 /// - Reuse the same key each frame when rendering or measuring.
 pub fn graphics_font_register_ttf(
-    env: &mut Caller<'_, ()>,
+    env: &mut Caller<'_, GuestLimits>,
     key: u64,
     data_ptr: u32,
     data_len: u32,
@@ -1478,7 +2783,7 @@ pub fn graphics_font_register_ttf(
 /// - Current parser is intentionally minimal and expects a relatively well-formed BDF.
 /// - Missing glyphs will simply not render (per glyph lookup).
 pub fn graphics_font_register_bdf(
-    env: &mut Caller<'_, ()>,
+    env: &mut Caller<'_, GuestLimits>,
     key: u64,
     data_ptr: u32,
     data_len: u32,
@@ -1493,6 +2798,56 @@ pub fn graphics_font_register_bdf(
     1
 }
 
+/// Register an AngelCode BMFont under a key.
+///
+/// Guest ABI:
+/// - `key`: arbitrary u64 selected by the guest (often a hashed string).
+/// - `data_ptr/data_len`: `.fnt` descriptor bytes in guest memory (the text format).
+/// - `atlas_key`: key of the page image, already registered with `graphics_png_register` (or
+///   `graphics_jpeg_register`). The atlas is copied, so it may be unregistered afterwards.
+///
+/// Returns:
+/// - `1` on success
+/// - `0` if the descriptor doesn't parse or the atlas isn't registered
+///
+/// Caveats:
+/// - Only page 0 is used; glyphs on other pages are skipped. Kerning pairs are ignored.
+/// - Glyph pixels are multiplied by the draw color, so white atlases take the current color and
+///   colored atlases draw as-is under white.
+pub fn graphics_font_register_fnt(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    data_ptr: u32,
+    data_len: u32,
+    atlas_key: u64,
+) -> u32 {
+    let Ok(data) = read_guest_bytes(env, data_ptr, data_len) else {
+        return registration_failed(ResourceError::Memory);
+    };
+    let Some((line_height, base, glyphs)) = parse_fnt(&data) else {
+        return registration_failed(ResourceError::Invalid);
+    };
+
+    let mut res = RESOURCES.lock().unwrap();
+    let Some(atlas) = res.keyed_images.get(&atlas_key).cloned() else {
+        res.last_error = ResourceError::Missing;
+        return 0;
+    };
+    let id = res.next_id;
+    res.next_id += 1;
+    res.fonts.insert(
+        id,
+        FontResource::Fnt {
+            line_height,
+            base,
+            glyphs,
+            atlas,
+        },
+    );
+    res.keyed_fonts.insert(key, id);
+    1
+}
+
 /// Register a built-in Spleen bitmap font under a key.
 ///
 /// The Spleen family is bundled with the host as BDF assets. This function selects one of the
@@ -1542,8 +2897,9 @@ pub fn graphics_font_unregister(key: u64) {
         res.keyed_fonts.remove(&key)
     };
 
+    let mut res = RESOURCES.lock().unwrap();
+    res.font_fallbacks.remove(&key);
     if let Some(id) = id {
-        let mut res = RESOURCES.lock().unwrap();
         res.fonts.remove(&id);
     }
 }
@@ -1567,29 +2923,12 @@ pub fn graphics_font_unregister(key: u64) {
 pub fn graphics_text_key(
     x: i32,
     y: i32,
-    env: &mut Caller<'_, ()>,
+    env: &mut Caller<'_, GuestLimits>,
     font_key: u64,
     text_ptr: u32,
     text_len: u32,
 ) {
-    let font_id = {
-        let res = RESOURCES.lock().unwrap();
-        res.keyed_fonts.get(&font_key).copied()
-    };
-
-    // If no keyed font is registered, fall back to built-in Spleen at size 16.
-    // This makes text rendering work out-of-the-box even if the guest never
-    // called `wasm96_graphics_font_register_*`.
-    let font_id = match font_id {
-        Some(id) => id,
-        None => graphics_font_use_spleen(16),
-    };
-
-    if font_id == 0 {
-        return;
-    }
-
-    graphics_text(x, y, font_id, env, text_ptr, text_len);
+    graphics_text_sized_key(x, y, env, font_key, 0, text_ptr, text_len);
 }
 
 /// Measure UTF-8 text using a keyed font.
@@ -1612,37 +2951,200 @@ pub fn graphics_text_key(
 /// Notes:
 /// - Like draw, measurement reads the string bytes immediately from guest memory.
 pub fn graphics_text_measure_key(
-    env: &mut Caller<'_, ()>,
+    env: &mut Caller<'_, GuestLimits>,
     font_key: u64,
     text_ptr: u32,
     text_len: u32,
 ) -> u64 {
-    let font_id = {
-        let res = RESOURCES.lock().unwrap();
-        res.keyed_fonts.get(&font_key).copied()
+    graphics_text_measure_sized_key(env, font_key, 0, text_ptr, text_len)
+}
+
+/// Draw UTF-8 text with a keyed font at `size_px` pixels, so one registered font serves every
+/// size. `0` draws at the font's native size (16px for TTF/OTF, the line height for bitmap
+/// fonts). Characters the font lacks come from its fallbacks (see
+/// `graphics_font_add_fallback`). Same Spleen fallback as `graphics_text_key`.
+pub fn graphics_text_sized_key(
+    x: i32,
+    y: i32,
+    env: &mut Caller<'_, GuestLimits>,
+    font_key: u64,
+    size_px: u32,
+    text_ptr: u32,
+    text_len: u32,
+) {
+    let Ok(bytes) = read_guest_bytes(env, text_ptr, text_len) else {
+        return;
+    };
+    let Ok(text) = std::str::from_utf8(&bytes) else {
+        return;
     };
+    let chain = font_chain(font_key);
+    let res = RESOURCES.lock().unwrap();
+    let fonts: Vec<&FontResource> = chain.iter().filter_map(|id| res.fonts.get(id)).collect();
+    let size_px = fonts.first().map_or(size_px, |f| scaled_size(f, size_px));
+    draw_text_chain(x, y, &fonts, text, size_px);
+}
 
-    // If no keyed font is registered, fall back to built-in Spleen at size 16.
-    // This keeps measure behavior consistent with `graphics_text_key`.
-    let font_id = match font_id {
-        Some(id) => id,
-        None => graphics_font_use_spleen(16),
+/// Measure UTF-8 text with a keyed font at `size_px` pixels, packed like
+/// `graphics_text_measure_key`.
+pub fn graphics_text_measure_sized_key(
+    env: &mut Caller<'_, GuestLimits>,
+    font_key: u64,
+    size_px: u32,
+    text_ptr: u32,
+    text_len: u32,
+) -> u64 {
+    let Ok(bytes) = read_guest_bytes(env, text_ptr, text_len) else {
+        return 0;
     };
+    let Ok(text) = std::str::from_utf8(&bytes) else {
+        return 0;
+    };
+    let chain = font_chain(font_key);
+    let res = RESOURCES.lock().unwrap();
+    let fonts: Vec<&FontResource> = chain.iter().filter_map(|id| res.fonts.get(id)).collect();
+    let size_px = fonts.first().map_or(size_px, |f| scaled_size(f, size_px));
+    let (width, height) = measure_text_chain(&fonts, text, size_px);
+    ((width as u64) << 32) | (height as u64)
+}
+
+/// Most fallback fonts a single font can have.
+pub const MAX_FONT_FALLBACKS: usize = 8;
 
-    if font_id == 0 {
+/// Use the font under `fallback` for characters the font under `primary` has no glyph for.
+/// Fallbacks are tried in the order they were added; a font without one of its fallbacks'
+/// characters still draws nothing for it.
+///
+/// Returns `1` on success, `0` if either key isn't a registered font, they're the same key, or
+/// `primary` already has `MAX_FONT_FALLBACKS` fallbacks.
+pub fn graphics_font_add_fallback(primary: u64, fallback: u64) -> u32 {
+    let mut res = RESOURCES.lock().unwrap();
+    if primary == fallback
+        || !res.keyed_fonts.contains_key(&primary)
+        || !res.keyed_fonts.contains_key(&fallback)
+    {
+        res.last_error = ResourceError::Missing;
         return 0;
     }
+    let fallbacks = res.font_fallbacks.entry(primary).or_default();
+    if fallbacks.contains(&fallback) {
+        return 1;
+    }
+    if fallbacks.len() >= MAX_FONT_FALLBACKS {
+        res.last_error = ResourceError::Unsupported;
+        return 0;
+    }
+    fallbacks.push(fallback);
+    1
+}
+
+/// Host font ids used for `font_key`: the font itself (or the Spleen fallback), then its
+/// registered fallbacks in order.
+fn font_chain(font_key: u64) -> Vec<u32> {
+    let primary = keyed_font_or_spleen(font_key);
+    let res = RESOURCES.lock().unwrap();
+    let mut chain = vec![primary];
+    if let Some(keys) = res.font_fallbacks.get(&font_key) {
+        chain.extend(keys.iter().filter_map(|k| res.keyed_fonts.get(k).copied()));
+    }
+    chain
+}
+
+/// Whether `font` has its own glyph for `ch`.
+fn has_glyph(font: &FontResource, ch: char) -> bool {
+    match font {
+        FontResource::Ttf(f) | FontResource::Sdf(SdfFont { font: f, .. }) => {
+            f.lookup_glyph_index(ch) != 0
+        }
+        FontResource::Bdf { glyphs, .. } => glyphs.contains_key(&ch),
+        FontResource::Fnt { glyphs, .. } => glyphs.contains_key(&ch),
+    }
+}
+
+/// Split `text` into runs that share a font: for each character, the first font in `fonts`
+/// with a glyph for it, or the first font when none has one. Returns (font index, run).
+fn font_runs<'a>(fonts: &[&FontResource], text: &'a str) -> Vec<(usize, &'a str)> {
+    let mut runs: Vec<(usize, &str)> = Vec::new();
+    let mut start = 0;
+    let mut current = 0;
+    for (i, ch) in text.char_indices() {
+        let font = if fonts.len() > 1 {
+            fonts.iter().position(|f| has_glyph(f, ch)).unwrap_or(0)
+        } else {
+            0
+        };
+        if font != current && i > start {
+            runs.push((current, &text[start..i]));
+            start = i;
+        }
+        current = font;
+    }
+    if start < text.len() {
+        runs.push((current, &text[start..]));
+    }
+    runs
+}
+
+/// Pixel distance from the top of a line to the baseline of `font` drawn at `size_px`.
+fn ascent_at(font: &FontResource, size_px: u32) -> i32 {
+    let (size, scale) = resolve_size(font, size_px);
+    match font {
+        FontResource::Ttf(f) | FontResource::Sdf(SdfFont { font: f, .. }) => f
+            .horizontal_line_metrics(size)
+            .map_or(0, |m| m.ascent.round() as i32),
+        FontResource::Bdf {
+            height, descent, ..
+        } => ((height - descent) as f32 * scale).round() as i32,
+        FontResource::Fnt { base, .. } => (*base as f32 * scale).round() as i32,
+    }
+}
+
+/// Draw `text` with `fonts[0]`, taking characters it lacks from the later fonts. Every run is
+/// drawn at the primary font's size with the baselines lined up.
+fn draw_text_chain(x: i32, y: i32, fonts: &[&FontResource], text: &str, size_px: u32) {
+    let Some(primary) = fonts.first() else {
+        return;
+    };
+    if fonts.len() == 1 {
+        draw_text(x, y, primary, text, size_px);
+        return;
+    }
+    let size = resolve_size(primary, size_px).0.round() as u32;
+    let baseline = ascent_at(primary, size);
+    let mut pen = x;
+    for (i, run) in font_runs(fonts, text) {
+        let font = fonts[i];
+        draw_text(pen, y + baseline - ascent_at(font, size), font, run, size);
+        pen += measure_text_sized(font, run, size).0 as i32;
+    }
+}
 
-    graphics_text_measure(font_id, env, text_ptr, text_len)
+/// Size of `text` as `draw_text_chain` draws it.
+fn measure_text_chain(fonts: &[&FontResource], text: &str, size_px: u32) -> (u32, u32) {
+    let Some(primary) = fonts.first() else {
+        return (0, 0);
+    };
+    if fonts.len() == 1 {
+        return measure_text_sized(primary, text, size_px);
+    }
+    let size = resolve_size(primary, size_px).0.round() as u32;
+    let (mut width, mut height) = (0, 0);
+    for (i, run) in font_runs(fonts, text) {
+        let (w, h) = measure_text_sized(fonts[i], run, size);
+        width += w;
+        height = height.max(h);
+    }
+    (width, height)
 }
 
-/// Parse BDF font data into glyph map.
-fn parse_bdf(bdf_data: &[u8]) -> Option<(HashMap<char, Vec<u8>>, u32, u32)> {
+/// Parse BDF font data into glyph map, cell width, cell height and descent.
+fn parse_bdf(bdf_data: &[u8]) -> Option<(HashMap<char, Vec<u8>>, u32, u32, u32)> {
     let text = core::str::from_utf8(bdf_data).ok()?;
     let mut glyphs = HashMap::new();
     let mut lines = text.lines();
     let mut width = 0;
     let mut height = 0;
+    let mut descent = 0;
 
     while let Some(line) = lines.next() {
         if line.starts_with("FONTBOUNDINGBOX") {
@@ -1651,6 +3153,10 @@ fn parse_bdf(bdf_data: &[u8]) -> Option<(HashMap<char, Vec<u8>>, u32, u32)> {
                 width = parts[1].parse().unwrap_or(0);
                 height = parts[2].parse().unwrap_or(0);
             }
+            // The y offset of the bounding box is the (negative) descent.
+            if let Some(y_off) = parts.get(4).and_then(|p| p.parse::<i32>().ok()) {
+                descent = y_off.min(0).unsigned_abs();
+            }
         } else if line.starts_with("STARTCHAR") {
             let mut encoding = None;
             let mut bitmap = Vec::new();
@@ -1683,25 +3189,281 @@ fn parse_bdf(bdf_data: &[u8]) -> Option<(HashMap<char, Vec<u8>>, u32, u32)> {
     }
 
     if width > 0 && height > 0 {
-        Some((glyphs, width, height))
+        Some((glyphs, width, height, descent.min(height)))
     } else {
         None
     }
 }
 
+/// Parse the text flavour of an AngelCode `.fnt` into its line height, baseline and page-0
+/// glyphs.
+fn parse_fnt(fnt_data: &[u8]) -> Option<(u32, u32, HashMap<char, FntGlyph>)> {
+    let text = core::str::from_utf8(fnt_data).ok()?;
+    let mut line_height = None;
+    let mut base = 0;
+    let mut glyphs = HashMap::new();
+
+    for line in text.lines() {
+        let mut words = line.split_whitespace();
+        let tag = words.next();
+        // `key=value` pairs; only numeric values matter here (quoted strings fail to parse).
+        let mut attrs = HashMap::new();
+        for word in words {
+            if let Some((k, v)) = word.split_once('=') {
+                if let Ok(n) = v.parse::<i32>() {
+                    attrs.insert(k, n);
+                }
+            }
+        }
+        let get = |k: &str| attrs.get(k).copied().unwrap_or(0);
+
+        match tag {
+            Some("common") => {
+                line_height = attrs.get("lineHeight").map(|&h| h.max(0) as u32);
+                base = get("base").max(0) as u32;
+            }
+            Some("char") if get("page") == 0 => {
+                let Some(ch) = attrs.get("id").and_then(|&id| char::from_u32(id as u32)) else {
+                    continue;
+                };
+                glyphs.insert(
+                    ch,
+                    FntGlyph {
+                        x: get("x"),
+                        y: get("y"),
+                        width: get("width").max(0) as u32,
+                        height: get("height").max(0) as u32,
+                        xoffset: get("xoffset"),
+                        yoffset: get("yoffset"),
+                        xadvance: get("xadvance"),
+                    },
+                );
+            }
+            _ => {}
+        }
+    }
+
+    let line_height = line_height?;
+    Some((line_height, base.min(line_height), glyphs))
+}
+
 #[cfg(test)]
 mod tests {
     use super::*;
 
+    #[test]
+    fn test_parse_fnt() {
+        let fnt = b"info face=\"Tiny Font\" size=8\n\
+            common lineHeight=10 base=8 scaleW=64 scaleH=64 pages=2\n\
+            page id=0 file=\"tiny_0.png\"\n\
+            chars count=3\n\
+            char id=65   x=0     y=0     width=5     height=7     xoffset=0     yoffset=1     xadvance=6     page=0  chnl=15\n\
+            char id=66   x=6     y=0     width=5     height=7     xoffset=-1    yoffset=1     xadvance=6     page=0  chnl=15\n\
+            char id=67   x=0     y=0     width=5     height=7     xoffset=0     yoffset=1     xadvance=6     page=1  chnl=15\n";
+        let (line_height, base, glyphs) = parse_fnt(fnt).expect("Failed to parse FNT");
+        assert_eq!(line_height, 10);
+        assert_eq!(base, 8);
+        assert_eq!(glyphs.len(), 2);
+        assert_eq!(
+            glyphs[&'B'],
+            FntGlyph {
+                x: 6,
+                y: 0,
+                width: 5,
+                height: 7,
+                xoffset: -1,
+                yoffset: 1,
+                xadvance: 6,
+            }
+        );
+        assert!(parse_fnt(b"char id=65 x=0").is_none());
+    }
+
+    #[test]
+    fn test_floor_char_boundary() {
+        let text = "aé😀b";
+        assert_eq!(floor_char_boundary(text, 0), 0);
+        assert_eq!(floor_char_boundary(text, 2), 1);
+        assert_eq!(floor_char_boundary(text, 3), 3);
+        assert_eq!(floor_char_boundary(text, 5), 3);
+        assert_eq!(floor_char_boundary(text, 7), 7);
+        assert_eq!(floor_char_boundary(text, 100), 8);
+    }
+
+    #[test]
+    fn test_bitmap_font_metrics() {
+        let (glyphs, width, height, descent) =
+            parse_bdf(super::super::resources::SPLEEN_8X16).unwrap();
+        let bdf = FontResource::Bdf {
+            width,
+            height,
+            descent,
+            glyphs,
+        };
+        assert_eq!(font_metrics(&bdf), (12, 4, 0));
+        assert_eq!(measure_text(&bdf, "abc"), (24, 16));
+        assert_eq!(measure_text_sized(&bdf, "abc", 32), (48, 32));
+        assert_eq!(measure_text_sized(&bdf, "abc", 8), (12, 8));
+    }
+
+    #[test]
+    fn test_font_runs_use_fallbacks() {
+        let font = |chars: &str, width: u32| FontResource::Bdf {
+            width,
+            height: 8,
+            descent: 2,
+            glyphs: chars.chars().map(|c| (c, vec![0; 8])).collect(),
+        };
+        let latin = font("ab ", 4);
+        let cjk = font("日本", 8);
+        let fonts = [&latin, &cjk];
+
+        assert_eq!(
+            font_runs(&fonts, "ab 日本a?"),
+            vec![(0, "ab "), (1, "日本"), (0, "a?")]
+        );
+        assert_eq!(font_runs(&fonts[..1], "a日"), vec![(0, "a日")]);
+        assert_eq!(font_runs(&fonts, ""), vec![]);
+        assert_eq!(measure_text_chain(&fonts, "a日本", 0), (20, 8));
+    }
+
     #[test]
     fn test_parse_bdf_spleen_32x64() {
         let bdf_data = include_bytes!("../assets/spleen-32x64.bdf");
-        let (glyphs, width, height) = parse_bdf(bdf_data).expect("Failed to parse BDF");
+        let (glyphs, width, height, descent) = parse_bdf(bdf_data).expect("Failed to parse BDF");
         assert_eq!(width, 32);
         assert_eq!(height, 64);
+        assert_eq!(descent, 12);
         assert!(!glyphs.is_empty());
         assert!(glyphs.contains_key(&'A'));
     }
+
+    #[test]
+    fn text_and_black_shapes_on_a_layer_composite_over_the_screen() {
+        use crate::av::{
+            graphics_layer_begin, graphics_layer_end, layers_begin_frame, layers_end_frame,
+        };
+
+        let ttf = include_bytes!(
+            "../../../example/rust-guest-showcase/src/assets/UnifrakturMaguntia-Regular.ttf"
+        );
+        let font = FontResource::Ttf(Font::from_bytes(&ttf[..], FontSettings::default()).unwrap());
+        let w = 48;
+
+        crate::state::clear_on_unload();
+        graphics_set_size(w as u32, 32);
+        global().lock().unwrap().video.framebuffer.fill(0x00FF_FFFF);
+        layers_begin_frame();
+        graphics_layer_begin(0);
+        // Black with alpha 1 is exactly the value layers once used to mean "nothing drawn".
+        graphics_set_color(0, 0, 0, 1);
+        graphics_rect(0, 0, 4, 4);
+        graphics_set_color(255, 0, 0, 255);
+        draw_text(8, 0, &font, "W", 24);
+        let coverage = global().lock().unwrap().video.coverage.clone();
+        graphics_layer_end();
+        layers_end_frame();
+
+        let s = global().lock().unwrap();
+        let screen = &s.video.framebuffer;
+        for y in 0..4 {
+            for x in 0..4 {
+                assert_eq!(screen[y * w + x] & 0x00FF_FFFF, 0, "black at ({x}, {y})");
+            }
+        }
+        // Red glyph pixels blend over white by their coverage, without dark fringes.
+        let text = (0..screen.len()).filter(|i| i % w >= 8);
+        let (mut solid, mut edge) = (0, 0);
+        for i in text {
+            let c = coverage[i] as u32;
+            assert_eq!(screen[i], 0x00FF_0000 | (255 - c) * 0x0101, "pixel {i}");
+            match c {
+                255 => solid += 1,
+                1..=254 => edge += 1,
+                _ => {}
+            }
+        }
+        assert!(
+            solid > 0 && edge > 0,
+            "{solid} solid and {edge} antialiased pixels"
+        );
+    }
+
+    /// Attributes of the element with `id` in recolored markup, which must still parse.
+    fn svg_attrs(markup: &str, id: &str) -> Vec<(String, String)> {
+        let options = roxmltree::ParsingOptions {
+            allow_dtd: true,
+            ..roxmltree::ParsingOptions::default()
+        };
+        let doc = roxmltree::Document::parse_with_options(markup, options).unwrap();
+        let node = doc
+            .descendants()
+            .find(|n| n.attribute("id") == Some(id))
+            .unwrap();
+        node.attributes()
+            .map(|a| (a.name().to_string(), a.value().to_string()))
+            .collect()
+    }
+
+    fn attr<'a>(attrs: &'a [(String, String)], name: &str) -> Option<&'a str> {
+        attrs
+            .iter()
+            .find(|(n, _)| n == name)
+            .map(|(_, v)| v.as_str())
+    }
+
+    #[test]
+    fn test_recolor_svg() {
+        let svg = r#"<svg xmlns="http://www.w3.org/2000/svg"><!-- <rect id="a"/> -->
+<rect id="a" fill="red" style="stroke:blue;fill:green"/><g id="g" class="icon big"><circle r="2"/></g>
+<rect id="b" class="a"/></svg>"#;
+
+        let (out, count) = recolor_svg(svg, "#a", 0x00FF0080);
+        assert_eq!(count, 1);
+        let a = svg_attrs(&out, "a");
+        assert_eq!(attr(&a, "fill"), Some("#00ff00"));
+        assert_eq!(attr(&a, "fill-opacity"), Some("0.5019608"));
+        assert_eq!(attr(&a, "style"), Some("stroke:blue"));
+        assert!(out.contains("<!-- <rect id=\"a\"/> -->"));
+
+        let (out, count) = recolor_svg(svg, "a", 0x000000FF);
+        assert_eq!(count, 2, "a bare name matches ids and classes");
+        assert_eq!(attr(&svg_attrs(&out, "b"), "fill"), Some("#000000"));
+
+        let (out, count) = recolor_svg(svg, ".big", 0x112233FF);
+        assert_eq!(count, 1);
+        assert_eq!(attr(&svg_attrs(&out, "g"), "fill"), Some("#112233"));
+
+        assert_eq!(recolor_svg(svg, ".missing", 0).1, 0);
+    }
+
+    #[test]
+    fn test_recolor_svg_quotes_styles_entities_and_cdata() {
+        let svg = r#"<?xml version="1.0"?>
+<!DOCTYPE svg [<!ENTITY accent "accent">]>
+<svg xmlns="http://www.w3.org/2000/svg">
+<style><![CDATA[ .accent { stroke: red } <rect class="accent"/> ]]></style>
+<rect id='s' class='&accent;' fill='red' style='fill: green ; stroke:"x>y"'/>
+<path id="p" class="accent" style="FILL:blue"></path>
+<rect id="n" class="other" fill="red"/>
+</svg>"#;
+
+        let (out, count) = recolor_svg(svg, ".accent", 0xFF0000FF);
+        assert_eq!(count, 2, "CDATA text is not markup; entities expand");
+
+        let s = svg_attrs(&out, "s");
+        assert_eq!(attr(&s, "fill"), Some("#ff0000"));
+        assert_eq!(attr(&s, "class"), Some("accent"));
+        assert_eq!(attr(&s, "style"), Some(r#" stroke:"x>y""#));
+        assert_eq!(s.iter().filter(|(n, _)| n == "fill").count(), 1);
+
+        let p = svg_attrs(&out, "p");
+        assert_eq!(attr(&p, "fill"), Some("#ff0000"));
+        assert_eq!(attr(&p, "style"), None, "an emptied style is dropped");
+
+        assert_eq!(attr(&svg_attrs(&out, "n"), "fill"), Some("red"));
+        assert!(out.contains("<![CDATA[ .accent { stroke: red } <rect class=\"accent\"/> ]]>"));
+    }
 }
 
 /// Use (load) a built-in Spleen font at the given size and return a host-side font id.
@@ -1727,10 +3489,10 @@ pub fn graphics_font_use_spleen(size: u32) -> u32 {
         24 => super::resources::SPLEEN_12X24,
         32 => super::resources::SPLEEN_16X32,
         64 => super::resources::SPLEEN_32X64,
-        _ => return 0,
+        _ => return registration_failed(ResourceError::Unsupported),
     };
-    let Some((glyphs, width, height)) = parse_bdf(data) else {
-        return 0;
+    let Some((glyphs, width, height, descent)) = parse_bdf(data) else {
+        return registration_failed(ResourceError::Invalid);
     };
 
     let mut res = RESOURCES.lock().unwrap();
@@ -1741,29 +3503,94 @@ pub fn graphics_font_use_spleen(size: u32) -> u32 {
         FontResource::Bdf {
             width,
             height,
+            descent,
             glyphs,
         },
     );
     id
 }
 
-/// Draw text.
-pub fn graphics_text(x: i32, y: i32, font_id: u32, env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
-    let memory_ptr = {
-        let s = global().lock().unwrap();
-        s.memory_wasmtime
-    };
-    if memory_ptr.is_null() {
-        return;
+/// Pixel size TTF/OTF fonts are drawn at when no size is given.
+pub const TTF_DEFAULT_PX: f32 = 16.0;
+
+/// Size `font` draws at when no size is given: the TTF default, or a bitmap font's line height.
+fn native_size(font: &FontResource) -> f32 {
+    match font {
+        FontResource::Ttf(_) | FontResource::Sdf(_) => TTF_DEFAULT_PX,
+        FontResource::Bdf { height, .. } => *height as f32,
+        FontResource::Fnt { line_height, .. } => *line_height as f32,
+    }
+}
+
+/// Draw size for `font` at `size_px` (`0` = its native size), and the scale from native to it.
+fn resolve_size(font: &FontResource, size_px: u32) -> (f32, f32) {
+    let native = native_size(font);
+    if size_px == 0 || native <= 0.0 {
+        return (native, 1.0);
     }
+    (size_px as f32, size_px as f32 / native)
+}
 
-    let mem = unsafe { &*memory_ptr };
+/// Smallest and largest multiplier `graphics_set_text_scale` accepts.
+pub const MIN_TEXT_SCALE: f32 = 0.25;
+pub const MAX_TEXT_SCALE: f32 = 8.0;
 
-    let mut text_bytes = vec![0u8; len as usize];
-    if mem.read(env, ptr as usize, &mut text_bytes).is_err() {
-        return;
+/// Multiply the size of all text drawn and measured from now on, keyed or not and at any
+/// `size_px` (clamped to `MIN_TEXT_SCALE..=MAX_TEXT_SCALE`; NaN, infinities and values `<= 0`
+/// reset it to 1). Font metrics scale with it, so layout built on measurements follows.
+pub fn graphics_set_text_scale(multiplier: f32) {
+    let mut s = global().lock().unwrap();
+    s.video.text_scale = if multiplier.is_finite() && multiplier > 0.0 {
+        multiplier.clamp(MIN_TEXT_SCALE, MAX_TEXT_SCALE)
+    } else {
+        1.0
+    };
+}
+
+fn text_scale() -> f32 {
+    match global().lock() {
+        Ok(g) => g.video.text_scale,
+        Err(poisoned) => poisoned.into_inner().video.text_scale,
+    }
+}
+
+/// `size_px` for `font` (`0` = native) with the text scale applied; unchanged at scale 1.
+fn scaled_size(font: &FontResource, size_px: u32) -> u32 {
+    let scale = text_scale();
+    if scale == 1.0 {
+        return size_px;
     }
+    (resolve_size(font, size_px).0 * scale).round().max(1.0) as u32
+}
+
+/// Draw text at the font's native size.
+pub fn graphics_text(
+    x: i32,
+    y: i32,
+    font_id: u32,
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+) {
+    graphics_text_sized(x, y, font_id, 0, env, ptr, len);
+}
 
+/// Draw text at `size_px` pixels (`0` = the font's native size).
+///
+/// TTF/OTF fonts are rasterized at that size; bitmap fonts are scaled nearest-neighbor from their
+/// line height, so integer multiples stay crisp.
+pub fn graphics_text_sized(
+    x: i32,
+    y: i32,
+    font_id: u32,
+    size_px: u32,
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+) {
+    let Ok(text_bytes) = read_guest_bytes(env, ptr, len) else {
+        return;
+    };
     let text = match std::str::from_utf8(&text_bytes) {
         Ok(s) => s,
         Err(_) => return,
@@ -1771,38 +3598,53 @@ pub fn graphics_text(x: i32, y: i32, font_id: u32, env: &mut Caller<'_, ()>, ptr
 
     let res = RESOURCES.lock().unwrap();
     if let Some(font) = res.fonts.get(&font_id) {
-        match font {
-            FontResource::Ttf(f) => {
-                // Lock global state once for the whole string to enable blending
-                let mut s = match global().lock() {
-                    Ok(g) => g,
-                    Err(poisoned) => poisoned.into_inner(),
+        draw_text(x, y, font, text, scaled_size(font, size_px));
+    }
+}
+
+fn draw_text(x: i32, y: i32, font: &FontResource, text: &str, size_px: u32) {
+    let (size, scale) = resolve_size(font, size_px);
+    match font {
+        FontResource::Ttf(f) => {
+            // Lock global state once for the whole string to enable blending
+            let mut s = match global().lock() {
+                Ok(g) => g,
+                Err(poisoned) => poisoned.into_inner(),
+            };
+            let width = s.video.width as i32;
+            let height = s.video.height as i32;
+            let draw_color = s.video.draw_color;
+            let mut fb = Canvas::of(&mut s.video);
+            let r_fg = ((draw_color >> 16) & 0xFF) as f32;
+            let g_fg = ((draw_color >> 8) & 0xFF) as f32;
+            let b_fg = (draw_color & 0xFF) as f32;
+            let r_fg_sq = r_fg * r_fg;
+            let g_fg_sq = g_fg * g_fg;
+            let b_fg_sq = b_fg * b_fg;
+            // Glyphs hang from a shared baseline `ascent` below `y`, so accents and descenders
+            // land where the font puts them.
+            let ascent = f
+                .horizontal_line_metrics(size)
+                .map(|m| m.ascent.round() as i32);
+
+            let mut px = x as f32;
+            for ch in text.chars() {
+                let (metrics, bitmap) = f.rasterize(ch, size);
+                let start_x = px.round() as i32;
+                let top = match ascent {
+                    Some(ascent) => y + ascent - metrics.height as i32 - metrics.ymin,
+                    None => y,
                 };
-                let width = s.video.width as i32;
-                let height = s.video.height as i32;
-                let draw_color = s.video.draw_color;
-                let r_fg = ((draw_color >> 16) & 0xFF) as f32;
-                let g_fg = ((draw_color >> 8) & 0xFF) as f32;
-                let b_fg = (draw_color & 0xFF) as f32;
-                let r_fg_sq = r_fg * r_fg;
-                let g_fg_sq = g_fg * g_fg;
-                let b_fg_sq = b_fg * b_fg;
-
-                let mut px = x as f32;
-                for ch in text.chars() {
-                    let (metrics, bitmap) = f.rasterize(ch, 16.0); // fixed size
-                    let start_x = px.round() as i32;
-                    for (i, &alpha) in bitmap.iter().enumerate() {
-                        if alpha > 0 {
-                            let gx = start_x + (i % metrics.width) as i32;
-                            let gy = y + (i / metrics.width) as i32;
-
-                            if gx >= 0 && gx < width && gy >= 0 && gy < height {
-                                let idx = (gy * width + gx) as usize;
-                                let bg = s.video.framebuffer[idx];
-
-                                // Alpha blend (gamma-correct approximation)
-                                let a = alpha as f32 / 255.0;
+                for (i, &alpha) in bitmap.iter().enumerate() {
+                    if alpha > 0 {
+                        let gx = start_x + (i % metrics.width) as i32;
+                        let gy = top + (i / metrics.width) as i32;
+
+                        if gx >= 0 && gx < width && gy >= 0 && gy < height {
+                            let idx = (gy * width + gx) as usize;
+
+                            // Alpha blend (gamma-correct approximation)
+                            fb.blend(idx, alpha as f32 / 255.0, |bg, a| {
                                 let inv_a = 1.0 - a;
 
                                 let r_bg = ((bg >> 16) & 0xFF) as f32;
@@ -1813,98 +3655,288 @@ pub fn graphics_text(x: i32, y: i32, font_id: u32, env: &mut Caller<'_, ()>, ptr
                                 let g = (g_fg_sq * a + g_bg * g_bg * inv_a).sqrt() as u32;
                                 let b = (b_fg_sq * a + b_bg * b_bg * inv_a).sqrt() as u32;
 
-                                s.video.framebuffer[idx] = (r << 16) | (g << 8) | b;
-                            }
+                                (r << 16) | (g << 8) | b
+                            });
                         }
                     }
-                    px += metrics.advance_width;
                 }
+                px += metrics.advance_width;
             }
-            FontResource::Bdf {
-                width,
-                height,
-                glyphs,
-            } => {
-                let stride = (width + 7) / 8;
-                let mut px = x;
-                for ch in text.chars() {
-                    if let Some(bitmap) = glyphs.get(&ch) {
-                        for row in 0..*height as usize {
-                            for byte_idx in 0..stride as usize {
-                                let idx = row * stride as usize + byte_idx;
-                                if idx < bitmap.len() {
-                                    let byte = bitmap[idx];
-                                    for bit in 0..8 {
-                                        let col = byte_idx * 8 + bit;
-                                        if col < *width as usize {
-                                            if (byte & (1 << (7 - bit))) != 0 {
-                                                graphics_point(px + col as i32, y + row as i32);
-                                            }
+        }
+        FontResource::Sdf(f) => {
+            let mut s = match global().lock() {
+                Ok(g) => g,
+                Err(poisoned) => poisoned.into_inner(),
+            };
+            let style = super::sdf::TextStyle::default();
+            super::sdf::draw(&mut s.video, f, x as f32, y as f32, size, 0.0, text, &style);
+        }
+        FontResource::Bdf {
+            width,
+            height,
+            glyphs,
+            ..
+        } => {
+            let stride = (width + 7) / 8;
+            // Edge of source pixel `i` once scaled.
+            let edge = |i: usize| (i as f32 * scale).floor() as i32;
+            let mut pen = x as f32;
+            for ch in text.chars() {
+                let px = pen.round() as i32;
+                if let Some(bitmap) = glyphs.get(&ch) {
+                    for row in 0..*height as usize {
+                        let (y0, y1) = (edge(row), edge(row + 1));
+                        for byte_idx in 0..stride as usize {
+                            let idx = row * stride as usize + byte_idx;
+                            if idx < bitmap.len() {
+                                let byte = bitmap[idx];
+                                for bit in 0..8 {
+                                    let col = byte_idx * 8 + bit;
+                                    if col < *width as usize && (byte & (1 << (7 - bit))) != 0 {
+                                        let (x0, x1) = (edge(col), edge(col + 1));
+                                        if x1 > x0 && y1 > y0 {
+                                            graphics_rect(
+                                                px + x0,
+                                                y + y0,
+                                                (x1 - x0) as u32,
+                                                (y1 - y0) as u32,
+                                            );
                                         }
                                     }
                                 }
                             }
                         }
                     }
-                    px += *width as i32;
                 }
+                pen += *width as f32 * scale;
+            }
+        }
+        FontResource::Fnt { glyphs, atlas, .. } => {
+            let draw_color = {
+                let s = global().lock().unwrap();
+                s.video.draw_color
+            };
+            let color = [
+                (draw_color >> 16) & 0xFF,
+                (draw_color >> 8) & 0xFF,
+                draw_color & 0xFF,
+            ];
+            let scaled = |v: i32| (v as f32 * scale).round() as i32;
+            let mut pen = x as f32;
+            for ch in text.chars() {
+                let Some(g) = glyphs.get(&ch) else {
+                    continue;
+                };
+                let (w, h) = (scaled(g.width as i32), scaled(g.height as i32));
+                if w > 0 && h > 0 {
+                    let region = (g.x, g.y, g.width, g.height);
+                    let mut rgba = sample_region(
+                        &atlas.rgba,
+                        atlas.width,
+                        atlas.height,
+                        region,
+                        w as u32,
+                        h as u32,
+                    );
+                    for p in rgba.chunks_exact_mut(4) {
+                        for (c, m) in p.iter_mut().zip(color) {
+                            *c = (*c as u32 * m / 255) as u8;
+                        }
+                    }
+                    graphics_image_from_host(
+                        pen.round() as i32 + scaled(g.xoffset),
+                        y + scaled(g.yoffset),
+                        w as u32,
+                        h as u32,
+                        &rgba,
+                    );
+                }
+                pen += g.xadvance as f32 * scale;
             }
         }
     }
 }
 
-/// Measure text.
-pub fn graphics_text_measure(font_id: u32, env: &mut Caller<'_, ()>, ptr: u32, len: u32) -> u64 {
-    let memory_ptr = {
-        let s = global().lock().unwrap();
-        s.memory_wasmtime
-    };
-    if memory_ptr.is_null() {
-        return 0;
-    }
-
-    let mem = unsafe { &*memory_ptr };
+/// Measure text at the font's native size.
+pub fn graphics_text_measure(
+    font_id: u32,
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+) -> u64 {
+    graphics_text_measure_sized(font_id, 0, env, ptr, len)
+}
 
-    let mut text_bytes = vec![0u8; len as usize];
-    if mem.read(env, ptr as usize, &mut text_bytes).is_err() {
+/// Measure text at `size_px` pixels (`0` = the font's native size), matching
+/// `graphics_text_sized`.
+pub fn graphics_text_measure_sized(
+    font_id: u32,
+    size_px: u32,
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+) -> u64 {
+    let Ok(text_bytes) = read_guest_bytes(env, ptr, len) else {
         return 0;
-    }
-
+    };
     let text = match std::str::from_utf8(&text_bytes) {
         Ok(s) => s,
         Err(_) => return 0,
     };
 
     let res = RESOURCES.lock().unwrap();
-    let (width, height) = if let Some(font) = res.fonts.get(&font_id) {
-        match font {
-            FontResource::Ttf(f) => {
-                let mut width = 0.0;
-                let mut height: f32 = 0.0;
-                for ch in text.chars() {
-                    let (metrics, _) = f.rasterize(ch, 16.0);
-                    width += metrics.advance_width;
-                    height = height.max(metrics.height as f32);
-                }
-                (width.round() as u32, height as u32)
+    let (width, height) = match res.fonts.get(&font_id) {
+        Some(font) => measure_text_sized(font, text, scaled_size(font, size_px)),
+        None => (0, 0),
+    };
+
+    ((width as u64) << 32) | (height as u64)
+}
+
+/// Pixel size of `text` drawn in `font` at its native size, matching what `graphics_text`
+/// covers.
+fn measure_text(font: &FontResource, text: &str) -> (u32, u32) {
+    measure_text_sized(font, text, 0)
+}
+
+/// Pixel size of `text` drawn in `font` at `size_px` (`0` = native).
+fn measure_text_sized(font: &FontResource, text: &str, size_px: u32) -> (u32, u32) {
+    let (size, scale) = resolve_size(font, size_px);
+    match font {
+        FontResource::Ttf(f) | FontResource::Sdf(SdfFont { font: f, .. }) => {
+            let mut width = 0.0;
+            let mut height: f32 = 0.0;
+            for ch in text.chars() {
+                let metrics = f.metrics(ch, size);
+                width += metrics.advance_width;
+                height = height.max(metrics.height as f32);
             }
-            FontResource::Bdf {
-                width,
-                height,
-                glyphs: _,
-            } => (text.chars().count() as u32 * *width, *height),
+            // Glyphs are placed on the font's baseline, so a line is ascent + descent tall.
+            if let Some(m) = f.horizontal_line_metrics(size) {
+                height = (m.ascent - m.descent).round();
+            }
+            (width.round() as u32, height as u32)
         }
-    } else {
-        (0, 0)
+        FontResource::Bdf { width, height, .. } => {
+            let advance = *width as f32 * scale;
+            (
+                (text.chars().count() as f32 * advance).round() as u32,
+                (*height as f32 * scale).floor() as u32,
+            )
+        }
+        FontResource::Fnt {
+            line_height,
+            glyphs,
+            ..
+        } => {
+            let width: i32 = text
+                .chars()
+                .filter_map(|ch| glyphs.get(&ch))
+                .map(|g| g.xadvance)
+                .sum();
+            (
+                (width.max(0) as f32 * scale).round() as u32,
+                (*line_height as f32 * scale).round() as u32,
+            )
+        }
+    }
+}
+
+/// Vertical metrics of `font` in pixels: (ascent, descent, line gap). Descent is the distance
+/// below the baseline, so the three add up to the line height.
+fn font_metrics(font: &FontResource) -> (u32, u32, u32) {
+    match font {
+        FontResource::Ttf(f) | FontResource::Sdf(SdfFont { font: f, .. }) => {
+            match f.horizontal_line_metrics(TTF_DEFAULT_PX) {
+                Some(m) => (
+                    m.ascent.round().max(0.0) as u32,
+                    (-m.descent).round().max(0.0) as u32,
+                    m.line_gap.round().max(0.0) as u32,
+                ),
+                None => (0, 0, 0),
+            }
+        }
+        FontResource::Bdf {
+            height, descent, ..
+        } => (height - descent, *descent, 0),
+        FontResource::Fnt {
+            line_height, base, ..
+        } => (*base, line_height - base, 0),
+    }
+}
+
+/// Largest char boundary of `text` at or before `byte_offset`.
+fn floor_char_boundary(text: &str, byte_offset: usize) -> usize {
+    let mut end = byte_offset.min(text.len());
+    while !text.is_char_boundary(end) {
+        end -= 1;
+    }
+    end
+}
+
+/// Host font id for `font_key`, falling back to Spleen size 16 like `graphics_text_key`.
+fn keyed_font_or_spleen(font_key: u64) -> u32 {
+    let font_id = {
+        let res = RESOURCES.lock().unwrap();
+        res.keyed_fonts.get(&font_key).copied()
     };
+    font_id.unwrap_or_else(|| graphics_font_use_spleen(16))
+}
 
-    ((width as u64) << 32) | (height as u64)
+/// Vertical metrics of a keyed font.
+///
+/// Return value:
+/// - Packed `u64`: `(ascent << 32) | (descent << 16) | line_gap`, each in pixels (16 bits).
+///   Descent is measured downward from the baseline; for bitmap fonts the line gap is 0.
+/// - Returns `0` if no font is available even after the Spleen fallback.
+pub fn graphics_font_metrics_key(font_key: u64) -> u64 {
+    let font_id = keyed_font_or_spleen(font_key);
+    let res = RESOURCES.lock().unwrap();
+    let Some(font) = res.fonts.get(&font_id) else {
+        return 0;
+    };
+    let (ascent, descent, line_gap) = font_metrics(font);
+    let scale = text_scale();
+    let field = |v: u32| ((v as f32 * scale).round() as u32).min(0xFFFF) as u64;
+    (field(ascent) << 32) | (field(descent) << 16) | field(line_gap)
+}
+
+/// Width in pixels of the first `byte_offset` bytes of UTF-8 text in a keyed font, i.e. the x
+/// of a caret placed before that byte. Offsets inside a character round down to its start, and
+/// offsets past the end measure the whole string.
+///
+/// Uses the same fallback as `graphics_text_measure_key`. Returns `0` on invalid UTF-8.
+pub fn graphics_text_measure_up_to_key(
+    env: &mut Caller<'_, GuestLimits>,
+    font_key: u64,
+    text_ptr: u32,
+    text_len: u32,
+    byte_offset: u32,
+) -> u32 {
+    let Ok(bytes) = read_guest_bytes(env, text_ptr, text_len) else {
+        return 0;
+    };
+    let Ok(text) = std::str::from_utf8(&bytes) else {
+        return 0;
+    };
+    let prefix = &text[..floor_char_boundary(text, byte_offset as usize)];
+
+    let chain = font_chain(font_key);
+    let res = RESOURCES.lock().unwrap();
+    let fonts: Vec<&FontResource> = chain.iter().filter_map(|id| res.fonts.get(id)).collect();
+    let size_px = fonts.first().map_or(0, |f| scaled_size(f, 0));
+    measure_text_chain(&fonts, prefix, size_px).0
 }
 
 /// Present the framebuffer to libretro.
 pub fn video_present_host() {
     // Flush any 3D content to the framebuffer before presenting
     if super::graphics3d::flush_to_host() {
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        super::scaling::note_presented(s.video.width, s.video.height);
         return;
     }
 
@@ -1913,12 +3945,23 @@ pub fn video_present_host() {
             Ok(g) => g,
             Err(poisoned) => poisoned.into_inner(),
         };
-        (
-            s.video_refresh_cb,
+        let fb = super::post::post_process(
+            s.video.post_effect,
+            s.video.post_strength,
+            &s.video.framebuffer,
             s.video.width,
             s.video.height,
-            s.video.framebuffer.clone(),
-        )
+        );
+        let fb = match &s.video.color_grade {
+            Some(grade) => super::post::color_grade(grade, fb),
+            None => fb,
+        };
+        let fb = match &s.video.transition {
+            Some(t) => super::transition::cover(t, fb, s.video.width, s.video.height),
+            None => fb,
+        };
+        let (fb, width, height) = super::scaling::fit_to_window(&s.video, fb);
+        (s.video_refresh_cb, width, height, fb)
     };
 
     if let Some(cb) = video_cb {
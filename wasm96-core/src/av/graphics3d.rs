@@ -19,6 +19,7 @@ use std::sync::{Mutex, OnceLock};
 use bytemuck::{Pod, Zeroable};
 use glam::{Mat4, Vec3};
 
+use crate::runtime::GuestLimits;
 use crate::state::global;
 
 use super::resources::RESOURCES;
@@ -360,7 +361,7 @@ pub fn graphics_camera_perspective(fovy: f32, aspect: f32, near: f32, far: f32)
 }
 
 pub fn graphics_mesh_create(
-    env: &mut wasmtime::Caller<'_, ()>,
+    env: &mut wasmtime::Caller<'_, GuestLimits>,
     key: u64,
     v_ptr: u32,
     v_len: u32,
@@ -479,7 +480,7 @@ pub fn graphics_mesh_create(
 }
 
 pub fn graphics_mesh_create_obj(
-    env: &mut wasmtime::Caller<'_, ()>,
+    env: &mut wasmtime::Caller<'_, GuestLimits>,
     key: u64,
     ptr: u32,
     len: u32,
@@ -700,7 +701,7 @@ pub fn graphics_mesh_create_obj(
 }
 
 pub fn graphics_mesh_create_stl(
-    _env: &mut wasmtime::Caller<'_, ()>,
+    _env: &mut wasmtime::Caller<'_, GuestLimits>,
     _key: u64,
     _ptr: u32,
     _len: u32,
@@ -726,6 +727,11 @@ pub fn graphics_mesh_set_texture(mesh_key: u64, image_key: u64) -> u32 {
     1
 }
 
+/// Number of registered meshes.
+pub fn mesh_count() -> usize {
+    MESH_STORE.lock().unwrap().len()
+}
+
 pub fn graphics_mesh_draw(
     key: u64,
     x: f32,
@@ -0,0 +1,227 @@
+//! Draw layers: offscreen canvases composited over the screen in a chosen order.
+//!
+//! Between `layer_begin(i)` and `layer_end`, 2D draws land in layer `i` instead of the screen,
+//! so background, gameplay and UI can be drawn in any call order. Layers start each frame empty
+//! and, once the guest's `draw` returns, the visible ones are composited over the screen from the
+//! lowest `order` up (ties go by index). Each layer tracks how much of every pixel was drawn
+//! that frame (`Layer::coverage`), and is alpha-composited by it: undrawn pixels leave what's
+//! underneath, opaque ones replace it and antialiased text or translucent images blend over it.
+//! Draws made outside any layer form the backdrop.
+//!
+//! Under the 2D camera, a layer follows `parallax` times the camera position: 0 pins it to the
+//! screen, 1 moves it with the world, and values in between make distant backgrounds. Without a
+//! camera, parallax has no effect. 3D rendering ignores layers.
+
+use super::mask;
+use super::utils::mix_rgb;
+use crate::state::{Layer, VideoState, global};
+
+/// Number of layers a guest can use.
+pub const MAX_LAYERS: usize = 16;
+
+/// Layer `index`, created on first use.
+fn layer(video: &mut VideoState, index: usize) -> &mut Layer {
+    let list = &mut video.layers.list;
+    while list.len() <= index {
+        list.push(Layer::new(list.len()));
+    }
+    &mut list[index]
+}
+
+/// Send the following 2D draws to layer `index` (0..16), ending any layer already open.
+pub fn graphics_layer_begin(index: u32) {
+    let index = index as usize;
+    if index >= MAX_LAYERS {
+        return;
+    }
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    close_layer(&mut s.video);
+
+    let video = &mut s.video;
+    mask::end_drawing(video);
+    mask::suspend(video);
+    let size = (video.width * video.height) as usize;
+    let layer = layer(video, index);
+    let mut pixels = std::mem::take(&mut layer.pixels);
+    let mut coverage = std::mem::take(&mut layer.coverage);
+    let parallax = layer.parallax;
+    // The framebuffer was resized since the layer was last drawn.
+    if pixels.len() != size || coverage.len() != size {
+        pixels = vec![0; size];
+        coverage = vec![0; size];
+    }
+    video.layers.screen = std::mem::replace(&mut video.framebuffer, pixels);
+    video.coverage = coverage;
+    video.layers.open = Some(index);
+    video.camera.parallax = parallax;
+    mask::resume(video);
+}
+
+/// Go back to drawing on the screen.
+pub fn graphics_layer_end() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    close_layer(&mut s.video);
+}
+
+/// Show or hide layer `index` when frames are composited.
+pub fn graphics_layer_set_visible(index: u32, visible: u32) {
+    with_layer(index, |layer| layer.visible = visible != 0);
+}
+
+/// Set how much of the 2D camera position layer `index` follows. It applies from the next
+/// `layer_begin`.
+pub fn graphics_layer_set_parallax(index: u32, factor: f32) {
+    if factor.is_finite() {
+        with_layer(index, |layer| layer.parallax = factor);
+    }
+}
+
+/// Set layer `index`'s composite order; lower is further back.
+pub fn graphics_layer_set_order(index: u32, order: i32) {
+    with_layer(index, |layer| layer.order = order);
+}
+
+fn with_layer(index: u32, f: impl FnOnce(&mut Layer)) {
+    let index = index as usize;
+    if index >= MAX_LAYERS {
+        return;
+    }
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    f(layer(&mut s.video, index));
+}
+
+/// Put the open layer's pixels away and swap the screen back in, keeping an active camera's
+/// world pass and clipping on the screen.
+pub fn close_layer(video: &mut VideoState) {
+    let Some(index) = video.layers.open else {
+        return;
+    };
+    mask::end_drawing(video);
+    mask::suspend(video);
+    video.layers.open = None;
+    let screen = std::mem::take(&mut video.layers.screen);
+    let layer = &mut video.layers.list[index];
+    layer.pixels = std::mem::replace(&mut video.framebuffer, screen);
+    layer.coverage = std::mem::take(&mut video.coverage);
+    video.camera.parallax = 1.0;
+    mask::resume(video);
+}
+
+/// Empty every layer for the frame about to be drawn.
+pub fn layers_begin_frame() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let size = (s.video.width * s.video.height) as usize;
+    for layer in &mut s.video.layers.list {
+        layer.pixels.clear();
+        layer.pixels.resize(size, 0);
+        layer.coverage.clear();
+        layer.coverage.resize(size, 0);
+    }
+}
+
+/// Close a layer left open and composite the visible layers over the screen. Called once the
+/// guest has drawn, just before `camera_end_frame`.
+pub fn layers_end_frame() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let video = &mut s.video;
+    mask::end_drawing(video);
+    close_layer(video);
+    // Layers composite onto the finished screen, not into a world pass or through the mask.
+    mask::suspend(video);
+    if video.layers.list.is_empty() {
+        return;
+    }
+    composite(&video.layers.list, &mut video.framebuffer);
+}
+
+/// Blend the visible layers over `screen` by their coverage, back to front.
+fn composite(layers: &[Layer], screen: &mut [u32]) {
+    let sized = |l: &Layer| l.pixels.len() == screen.len() && l.coverage.len() == screen.len();
+    let mut indices: Vec<usize> = (0..layers.len())
+        .filter(|&i| layers[i].visible && sized(&layers[i]))
+        .collect();
+    indices.sort_by_key(|&i| (layers[i].order, i));
+    for i in indices {
+        let layer = &layers[i];
+        for ((dst, &src), &c) in screen.iter_mut().zip(&layer.pixels).zip(&layer.coverage) {
+            match c {
+                0 => {}
+                255 => *dst = src,
+                c => *dst = mix_rgb(*dst, src, c as u32),
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// A layer with opaque `pixels` where they're `Some` and nothing drawn elsewhere.
+    fn layer_with(index: usize, pixels: &[Option<u32>]) -> Layer {
+        Layer {
+            pixels: pixels.iter().map(|p| p.unwrap_or(0)).collect(),
+            coverage: pixels
+                .iter()
+                .map(|p| if p.is_some() { 255 } else { 0 })
+                .collect(),
+            ..Layer::new(index)
+        }
+    }
+
+    #[test]
+    fn layers_composite_by_order_then_index() {
+        let e = None;
+        let mut layers = vec![
+            layer_with(0, &[Some(1), Some(1), e, e]),
+            layer_with(1, &[Some(2), e, Some(2), e]),
+            layer_with(2, &[Some(3), e, e, e]),
+        ];
+        let mut screen = vec![9; 4];
+        composite(&layers, &mut screen);
+        assert_eq!(screen, [3, 1, 2, 9]);
+
+        // Send the top layer to the back and hide the middle one.
+        layers[2].order = -1;
+        layers[1].visible = false;
+        let mut screen = vec![9; 4];
+        composite(&layers, &mut screen);
+        assert_eq!(screen, [1, 1, 9, 9]);
+    }
+
+    #[test]
+    fn stale_sized_layers_are_skipped() {
+        let layers = vec![layer_with(0, &[Some(5); 2])];
+        let mut screen = vec![9; 4];
+        composite(&layers, &mut screen);
+        assert_eq!(screen, [9; 4]);
+    }
+
+    #[test]
+    fn partly_covered_pixels_blend_over_the_screen() {
+        let layer = Layer {
+            pixels: vec![0x00FF_0000, 0, 0x0100_0000],
+            coverage: vec![128, 0, 255],
+            ..Layer::new(0)
+        };
+        let mut screen = vec![0x00FF_FFFF; 3];
+        composite(&[layer], &mut screen);
+        // Half-covered red over white is pink; an opaque pixel of any value replaces the screen.
+        assert_eq!(screen, [0x00FF_7F7F, 0x00FF_FFFF, 0x0100_0000]);
+    }
+}
@@ -0,0 +1,229 @@
+//! Clip masks: draw a shape once, then limit later 2D draws to inside (or outside) it.
+//!
+//! Between `mask_begin` and `mask_end`, 2D draws paint the mask instead of the screen: every
+//! pixel they touch, in any color or opacity, is inside it. `mask_use(invert)` then clips the
+//! following draws to the mask, or to everything but the mask when `invert` is set, until
+//! `mask_off`. A new `mask_begin` replaces the shape and keeps the clip mode.
+//!
+//! Clipping works like the camera's world pass: while it's on, draws land in a copy of the draw
+//! target (the screen or the open layer), and only pixels the mask allows are copied back when
+//! the pass closes. The pass sits directly on the target, under any camera pass, and is closed
+//! and reopened around layer switches, resizes and the end of the frame. The mask is in screen
+//! pixels, so camera-space shapes are placed where they appear on screen. 3D rendering ignores
+//! masks.
+
+use std::mem::take;
+
+use super::camera;
+use crate::state::{Mask, VideoState, global};
+
+/// Start drawing the mask: following 2D draws mark its pixels instead of drawing.
+pub fn graphics_mask_begin() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    begin_drawing(&mut s.video);
+}
+
+fn begin_drawing(video: &mut VideoState) {
+    end_drawing(video);
+    suspend(video);
+    let size = video.framebuffer.len();
+    video.mask.target = Some(std::mem::replace(&mut video.framebuffer, vec![0; size]));
+    video.mask.target_coverage = std::mem::replace(&mut video.coverage, vec![0; size]);
+    video.mask.drawing = true;
+    if video.camera.active {
+        camera::open_pass(video);
+    }
+}
+
+/// Finish the mask and go back to drawing.
+pub fn graphics_mask_end() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    end_drawing(&mut s.video);
+}
+
+/// Clip the following 2D draws to the mask, or to outside it when `invert` is non-zero.
+pub fn graphics_mask_use(invert: u32) {
+    set_clip(Some(invert != 0));
+}
+
+/// Stop clipping. The mask is kept for a later `mask_use`.
+pub fn graphics_mask_off() {
+    set_clip(None);
+}
+
+fn set_clip(clip: Option<bool>) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let video = &mut s.video;
+    if video.mask.drawing {
+        video.mask.clip = clip;
+        return;
+    }
+    suspend(video);
+    video.mask.clip = clip;
+    resume(video);
+}
+
+/// Close the camera pass and the clip pass, so the framebuffer is the draw target itself.
+pub fn suspend(video: &mut VideoState) {
+    camera::close_pass(video);
+    close_clip_pass(video);
+}
+
+/// Reopen what [`suspend`] closed: the clip pass if clipping is on, then the camera pass.
+pub fn resume(video: &mut VideoState) {
+    open_clip_pass(video);
+    if video.camera.active {
+        camera::open_pass(video);
+    }
+}
+
+/// Finish a mask still being drawn: its drawn pixels become the mask and the target comes back.
+pub fn end_drawing(video: &mut VideoState) {
+    if !video.mask.drawing {
+        return;
+    }
+    camera::close_pass(video);
+    let Some(target) = video.mask.target.take() else {
+        return;
+    };
+    video.framebuffer = target;
+    let coverage = std::mem::replace(&mut video.coverage, take(&mut video.mask.target_coverage));
+    video.mask.bits = coverage.iter().map(|&c| c > 0).collect();
+    video.mask.drawing = false;
+    resume(video);
+}
+
+fn open_clip_pass(video: &mut VideoState) {
+    if video.mask.clip.is_none() || video.mask.target.is_some() {
+        return;
+    }
+    video.mask.target = Some(video.framebuffer.clone());
+    video.mask.target_coverage = video.coverage.clone();
+}
+
+fn close_clip_pass(video: &mut VideoState) {
+    if video.mask.drawing {
+        return;
+    }
+    let Some(mut target) = video.mask.target.take() else {
+        return;
+    };
+    clip(&video.mask, &video.framebuffer, &mut target);
+    video.framebuffer = target;
+    let mut coverage = take(&mut video.mask.target_coverage);
+    clip(&video.mask, &video.coverage, &mut coverage);
+    video.coverage = coverage;
+}
+
+/// Copy the pixels (or coverage) of `drawn` the mask allows into `target`.
+fn clip<T: Copy>(mask: &Mask, drawn: &[T], target: &mut [T]) {
+    let invert = mask.clip.unwrap_or(false);
+    let sized = mask.bits.len() == target.len();
+    for (i, (dst, &src)) in target.iter_mut().zip(drawn).enumerate() {
+        let inside = sized && mask.bits[i];
+        if inside != invert {
+            *dst = src;
+        }
+    }
+}
+
+/// Reopen the clip pass for a new frame. Called before the camera's `camera_begin_frame`.
+pub fn mask_begin_frame() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    open_clip_pass(&mut s.video);
+}
+
+/// Drop the mask and stop clipping (the draw target is about to be resized).
+pub fn reset(video: &mut VideoState) {
+    end_drawing(video);
+    suspend(video);
+    video.mask = Mask::default();
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::av::utils::Canvas;
+
+    #[test]
+    fn clipping_keeps_only_allowed_pixels() {
+        let mut mask = Mask {
+            bits: vec![true, false, true, false],
+            clip: Some(false),
+            ..Mask::default()
+        };
+        let drawn = [1, 2, 3, 4];
+        let mut target = [9; 4];
+        clip(&mask, &drawn, &mut target);
+        assert_eq!(target, [1, 9, 3, 9]);
+
+        mask.clip = Some(true);
+        let mut target = [9; 4];
+        clip(&mask, &drawn, &mut target);
+        assert_eq!(target, [9, 2, 9, 4]);
+
+        // A mask from another size is empty: nothing is inside it.
+        mask.bits.truncate(2);
+        let mut target = [9; 4];
+        clip(&mask, &drawn, &mut target);
+        assert_eq!(target, [1, 2, 3, 4]);
+    }
+
+    #[test]
+    fn masks_are_drawn_then_clip_the_target() {
+        let mut video = VideoState {
+            width: 2,
+            height: 2,
+            framebuffer: vec![5; 4],
+            ..VideoState::default()
+        };
+        begin_drawing(&mut video);
+        // Any draw marks the mask, even one in the color a blank canvas holds.
+        Canvas::of(&mut video).put(0, 0);
+        Canvas::of(&mut video).blend(3, 0.1, |dst, _| dst);
+        end_drawing(&mut video);
+        assert_eq!(video.mask.bits, [true, false, false, true]);
+        assert_eq!(video.framebuffer, [5; 4]);
+        assert!(video.coverage.is_empty());
+
+        video.mask.clip = Some(false);
+        open_clip_pass(&mut video);
+        video.framebuffer.fill(7);
+        suspend(&mut video);
+        assert_eq!(video.framebuffer, [7, 5, 5, 7]);
+        assert!(video.mask.target.is_none());
+    }
+
+    #[test]
+    fn clipping_a_layer_canvas_clips_its_coverage() {
+        let mut video = VideoState {
+            width: 2,
+            height: 1,
+            framebuffer: vec![0; 2],
+            coverage: vec![0; 2],
+            ..VideoState::default()
+        };
+        video.mask = Mask {
+            bits: vec![true, false],
+            clip: Some(false),
+            ..Mask::default()
+        };
+        open_clip_pass(&mut video);
+        Canvas::of(&mut video).fill(0..2, 0x00FF_0000);
+        suspend(&mut video);
+        assert_eq!(video.framebuffer, [0x00FF_0000, 0]);
+        assert_eq!(video.coverage, [255, 0]);
+    }
+}
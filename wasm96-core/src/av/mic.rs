@@ -0,0 +1,210 @@
+//! Microphone capture for guests, behind a player permission.
+//!
+//! Capture goes through the frontend's microphone interface
+//! (`RETRO_ENVIRONMENT_GET_MICROPHONE_INTERFACE`, fetched in `retro_set_environment`), so the
+//! frontend and OS still apply their own microphone prompts. On top of that the player must
+//! allow it with the `WASM96_MICROPHONE` environment variable (`1`, `true`, `yes` or `allow`);
+//! unset, every capture call is refused.
+//!
+//! Samples are mono i16 at the rate returned by `audio_capture_start`. The guest drains them
+//! with `audio_capture_read`; the frontend buffers a little, so carts should read every tick.
+
+use std::ffi::c_void;
+use std::os::raw::{c_int, c_uint};
+use std::sync::Mutex;
+
+use crate::runtime::GuestLimits;
+use wasmtime::Caller;
+
+use super::utils::write_guest_bytes;
+
+/// `RETRO_ENVIRONMENT_GET_MICROPHONE_INTERFACE` (experimental in libretro.h).
+pub const ENVIRONMENT_GET_MICROPHONE_INTERFACE: c_uint = 75 | 0x10000;
+/// `RETRO_MICROPHONE_INTERFACE_VERSION`.
+pub const MICROPHONE_INTERFACE_VERSION: c_uint = 1;
+
+/// Environment variable holding the microphone permission.
+pub const PERMISSION_ENV: &str = "WASM96_MICROPHONE";
+
+/// Most samples one `audio_capture_read` call returns (one second at 48 kHz).
+pub const MAX_READ_SAMPLES: u32 = 48_000;
+
+/// libretro's `retro_microphone_params_t`.
+#[repr(C)]
+pub struct MicParams {
+    pub rate: c_uint,
+}
+
+/// libretro's opaque `retro_microphone_t`.
+pub type MicHandle = *mut c_void;
+
+/// libretro's `struct retro_microphone_interface`.
+#[repr(C)]
+#[derive(Clone, Copy)]
+pub struct HostMicInterface {
+    pub interface_version: c_uint,
+    pub open_mic: Option<unsafe extern "C" fn(params: *const MicParams) -> MicHandle>,
+    pub close_mic: Option<unsafe extern "C" fn(mic: MicHandle)>,
+    pub get_params: Option<unsafe extern "C" fn(mic: MicHandle, params: *mut MicParams) -> bool>,
+    pub set_mic_state: Option<unsafe extern "C" fn(mic: MicHandle, state: bool) -> bool>,
+    pub get_mic_state: Option<unsafe extern "C" fn(mic: MicHandle) -> bool>,
+    pub read_mic:
+        Option<unsafe extern "C" fn(mic: MicHandle, samples: *mut i16, num: usize) -> c_int>,
+}
+
+impl HostMicInterface {
+    /// An empty interface carrying the version the frontend is asked for.
+    pub fn requested() -> Self {
+        Self {
+            interface_version: MICROPHONE_INTERFACE_VERSION,
+            open_mic: None,
+            close_mic: None,
+            get_params: None,
+            set_mic_state: None,
+            get_mic_state: None,
+            read_mic: None,
+        }
+    }
+}
+
+struct MicState {
+    host: Option<HostMicInterface>,
+    /// The open microphone, if capturing.
+    open: Option<MicHandle>,
+}
+
+// The handle is only ever used while holding the lock, from the frontend's thread.
+unsafe impl Send for MicState {}
+
+// Fetched once in `retro_set_environment`, like the log interface.
+static MIC: Mutex<MicState> = Mutex::new(MicState {
+    host: None,
+    open: None,
+});
+
+fn mic() -> std::sync::MutexGuard<'static, MicState> {
+    match MIC.lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    }
+}
+
+/// Remember the frontend's microphone interface (or forget it with `None`).
+pub fn set_host_mic(host: Option<HostMicInterface>) {
+    let mut m = mic();
+    close(&mut m);
+    m.host = host;
+}
+
+/// Whether a `WASM96_MICROPHONE` value allows capture.
+pub fn parse_permission(value: &str) -> bool {
+    matches!(
+        value.trim().to_ascii_lowercase().as_str(),
+        "1" | "true" | "yes" | "allow"
+    )
+}
+
+fn permitted() -> bool {
+    parse_permission(&std::env::var(PERMISSION_ENV).unwrap_or_default())
+}
+
+fn close(m: &mut MicState) {
+    let (Some(host), Some(handle)) = (m.host, m.open.take()) else {
+        return;
+    };
+    // SAFETY: `handle` came from this interface's `open_mic` and is closed exactly once.
+    unsafe {
+        if let Some(set_state) = host.set_mic_state {
+            set_state(handle, false);
+        }
+        if let Some(close_mic) = host.close_mic {
+            close_mic(handle);
+        }
+    }
+}
+
+/// Open the microphone at `sample_rate` Hz (0 = the frontend's choice) and start capturing.
+/// Returns the actual rate, or 0 if capture isn't permitted or available.
+pub fn audio_capture_start(sample_rate: u32) -> u32 {
+    if !permitted() {
+        return 0;
+    }
+    let mut m = mic();
+    close(&mut m);
+    let Some(host) = m.host else {
+        return 0;
+    };
+    let (Some(open_mic), Some(set_state)) = (host.open_mic, host.set_mic_state) else {
+        return 0;
+    };
+    // A null params pointer asks for the frontend's default rate.
+    let requested = MicParams { rate: sample_rate };
+    let params: *const MicParams = if sample_rate == 0 {
+        std::ptr::null()
+    } else {
+        &requested
+    };
+    // SAFETY: interface functions provided by the frontend; `requested` outlives the call.
+    let handle = unsafe { open_mic(params) };
+    if handle.is_null() {
+        return 0;
+    }
+    m.open = Some(handle);
+    // SAFETY: `handle` is the open microphone.
+    unsafe {
+        if !set_state(handle, true) {
+            close(&mut m);
+            return 0;
+        }
+        let mut actual = MicParams { rate: sample_rate };
+        match host.get_params {
+            Some(get_params) if get_params(handle, &mut actual) => actual.rate.max(1),
+            _ => sample_rate.max(1),
+        }
+    }
+}
+
+/// Copy up to `max_samples` captured mono samples into guest memory at `ptr`. Returns how many
+/// were written (0 when not capturing or nothing is ready).
+pub fn audio_capture_read(caller: &mut Caller<'_, GuestLimits>, ptr: u32, max_samples: u32) -> u32 {
+    let mut samples = vec![0i16; max_samples.min(MAX_READ_SAMPLES) as usize];
+    let read = {
+        let m = mic();
+        let (Some(host), Some(handle)) = (m.host, m.open) else {
+            return 0;
+        };
+        let Some(read_mic) = host.read_mic else {
+            return 0;
+        };
+        // SAFETY: `samples` has room for `samples.len()` values; `handle` is open.
+        let n = unsafe { read_mic(handle, samples.as_mut_ptr(), samples.len()) };
+        n.clamp(0, samples.len() as c_int) as usize
+    };
+    let bytes: Vec<u8> = samples[..read]
+        .iter()
+        .flat_map(|s| s.to_le_bytes())
+        .collect();
+    match write_guest_bytes(caller, ptr, &bytes) {
+        Ok(()) => read as u32,
+        Err(_) => 0,
+    }
+}
+
+/// Stop capturing and close the microphone.
+pub fn audio_capture_stop() {
+    close(&mut mic());
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn permission_needs_an_explicit_yes() {
+        assert!(parse_permission("1"));
+        assert!(parse_permission(" Allow "));
+        assert!(!parse_permission(""));
+        assert!(!parse_permission("0"));
+        assert!(!parse_permission("no"));
+    }
+}
@@ -0,0 +1,843 @@
+//! MIDI music played through a SoundFont.
+//!
+//! A Standard MIDI File (format 0 or 1) is merged into one timeline of channel events and tempo
+//! changes, then rendered by a small sample-playback synth using a SoundFont bank registered with
+//! `wasm96_audio_soundfont_create`. The song becomes a music stream (see `music`): it is mixed in
+//! the music group, and play/pause/stop/seek/volume/looping/crossfade use the `music` imports.
+//!
+//! The synth follows General MIDI: channel 10 plays the percussion bank, and note velocity,
+//! volume (CC 7), expression (CC 11), pan (CC 10), sustain pedal (CC 64), bank select (CC 0),
+//! program changes, pitch bend and its range (RPN 0) are honoured. Songs render at the output
+//! rate with up to `MAX_VOICES` notes at once; the oldest note is cut when more start.
+//!
+//! On top of the file, the guest can scale the tempo and set a volume per channel, e.g. to bring
+//! in a drum part when the action starts. Seeking replays the controller and program events up
+//! to the target without sounding notes.
+
+use std::sync::Arc;
+
+use wasmtime::Caller;
+
+use super::music::{MusicStream, PacketSource};
+use super::soundfont::{PERCUSSION_BANK, Region, SoundFont};
+use super::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::global;
+
+/// Most notes sounding at once per song.
+pub const MAX_VOICES: usize = 64;
+/// Frames rendered per packet.
+const PACKET_FRAMES: usize = 256;
+/// Envelopes and pitch are updated every this many frames.
+const BLOCK_FRAMES: usize = 16;
+/// How long notes may ring after the last event before the song counts as ended, in seconds.
+const MAX_TAIL_SECONDS: u32 = 5;
+/// Headroom so a full arrangement doesn't clip.
+const MASTER_GAIN: f32 = 0.35;
+/// Release ends once a voice is this far down, in dB.
+const SILENT_DB: f32 = 96.0;
+/// Tempo multipliers accepted by `set_tempo`.
+pub const MIN_TEMPO_SCALE: f32 = 0.1;
+pub const MAX_TEMPO_SCALE: f32 = 4.0;
+
+const DEFAULT_TEMPO: u32 = 500_000;
+const PERCUSSION_CHANNEL: u8 = 9;
+
+/// A channel event or tempo change.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Event {
+    NoteOn {
+        channel: u8,
+        key: u8,
+        velocity: u8,
+    },
+    NoteOff {
+        channel: u8,
+        key: u8,
+    },
+    Control {
+        channel: u8,
+        controller: u8,
+        value: u8,
+    },
+    Program {
+        channel: u8,
+        program: u8,
+    },
+    /// -8192..=8191.
+    PitchBend {
+        channel: u8,
+        value: i16,
+    },
+    /// Microseconds per quarter note.
+    Tempo(u32),
+}
+
+/// A parsed MIDI file: every track's events merged by tick.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Song {
+    /// Ticks per quarter note.
+    pub division: u16,
+    pub events: Vec<(u64, Event)>,
+}
+
+fn varint(data: &[u8], pos: &mut usize) -> Option<u32> {
+    let mut value = 0u32;
+    for _ in 0..4 {
+        let byte = *data.get(*pos)?;
+        *pos += 1;
+        value = (value << 7) | (byte & 0x7F) as u32;
+        if byte & 0x80 == 0 {
+            return Some(value);
+        }
+    }
+    None
+}
+
+fn parse_track(data: &[u8], events: &mut Vec<(u64, Event)>) -> Option<()> {
+    let (mut pos, mut tick, mut status) = (0usize, 0u64, 0u8);
+    while pos < data.len() {
+        tick += varint(data, &mut pos)? as u64;
+        let mut byte = *data.get(pos)?;
+        if byte >= 0x80 {
+            pos += 1;
+        } else {
+            // Running status: reuse the last channel status byte.
+            byte = status;
+        }
+        match byte {
+            0xFF => {
+                let kind = *data.get(pos)?;
+                pos += 1;
+                let len = varint(data, &mut pos)? as usize;
+                let body = data.get(pos..pos + len)?;
+                pos += len;
+                match kind {
+                    0x2F => break,
+                    0x51 if len == 3 => {
+                        let tempo = u32::from_be_bytes([0, body[0], body[1], body[2]]);
+                        events.push((tick, Event::Tempo(tempo.max(1))));
+                    }
+                    _ => {}
+                }
+            }
+            0xF0 | 0xF7 => {
+                let len = varint(data, &mut pos)? as usize;
+                pos += len;
+            }
+            0x80..=0xEF => {
+                status = byte;
+                let channel = byte & 0x0F;
+                let mut arg = || {
+                    let v = *data.get(pos)?;
+                    pos += 1;
+                    Some(v & 0x7F)
+                };
+                let event = match byte & 0xF0 {
+                    0x80 => {
+                        let key = arg()?;
+                        arg()?;
+                        Some(Event::NoteOff { channel, key })
+                    }
+                    0x90 => {
+                        let (key, velocity) = (arg()?, arg()?);
+                        Some(match velocity {
+                            0 => Event::NoteOff { channel, key },
+                            _ => Event::NoteOn {
+                                channel,
+                                key,
+                                velocity,
+                            },
+                        })
+                    }
+                    0xB0 => Some(Event::Control {
+                        channel,
+                        controller: arg()?,
+                        value: arg()?,
+                    }),
+                    0xC0 => Some(Event::Program {
+                        channel,
+                        program: arg()?,
+                    }),
+                    0xE0 => {
+                        let (lsb, msb) = (arg()? as i16, arg()? as i16);
+                        Some(Event::PitchBend {
+                            channel,
+                            value: ((msb << 7) | lsb) - 8192,
+                        })
+                    }
+                    0xA0 => {
+                        arg()?;
+                        arg()?;
+                        None
+                    }
+                    _ => {
+                        arg()?;
+                        None
+                    }
+                };
+                events.extend(event.map(|e| (tick, e)));
+            }
+            _ => return None,
+        }
+    }
+    Some(())
+}
+
+impl Song {
+    /// Parse a Standard MIDI File. SMPTE time division isn't supported.
+    pub fn parse(bytes: &[u8]) -> Option<Self> {
+        let mut rest = bytes;
+        let mut next_chunk = || {
+            let id: [u8; 4] = rest.get(..4)?.try_into().ok()?;
+            let len = u32::from_be_bytes(rest.get(4..8)?.try_into().ok()?) as usize;
+            let data = rest.get(8..8 + len)?;
+            rest = &rest[8 + len..];
+            Some((id, data))
+        };
+        let (id, header) = next_chunk()?;
+        if &id != b"MThd" || header.len() < 6 {
+            return None;
+        }
+        let division = u16::from_be_bytes([header[4], header[5]]);
+        if division == 0 || division & 0x8000 != 0 {
+            return None;
+        }
+        let mut events = Vec::new();
+        while let Some((id, data)) = next_chunk() {
+            if &id == b"MTrk" {
+                parse_track(data, &mut events)?;
+            }
+        }
+        // Stable: same-tick events keep track order.
+        events.sort_by_key(|(tick, _)| *tick);
+        Some(Self { division, events })
+    }
+}
+
+#[derive(Debug, Clone, Copy)]
+struct Channel {
+    bank: u16,
+    program: u8,
+    volume: f32,
+    expression: f32,
+    pan: f32,
+    /// Semitones.
+    bend: f32,
+    bend_range: f32,
+    sustain: bool,
+    rpn: (u8, u8),
+}
+
+impl Default for Channel {
+    fn default() -> Self {
+        Self {
+            bank: 0,
+            program: 0,
+            volume: 100.0 / 127.0,
+            expression: 1.0,
+            pan: 0.0,
+            bend: 0.0,
+            bend_range: 2.0,
+            sustain: false,
+            rpn: (127, 127),
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy, PartialEq)]
+enum Stage {
+    Delay,
+    Attack,
+    Hold,
+    Decay,
+    Sustain,
+    Release,
+    Done,
+}
+
+#[derive(Debug, Clone)]
+struct Voice {
+    channel: u8,
+    key: u8,
+    region: Region,
+    velocity_gain: f32,
+    /// Position in the sample pool.
+    pos: f64,
+    stage: Stage,
+    /// Seconds spent in the current stage.
+    elapsed: f32,
+    /// Attack level 0..1 and attenuation in dB, which together give the envelope gain.
+    attack: f32,
+    attenuation_db: f32,
+    held: bool,
+    gain: f32,
+}
+
+impl Voice {
+    fn released(&self) -> bool {
+        matches!(self.stage, Stage::Release | Stage::Done)
+    }
+
+    fn release(&mut self) {
+        if !self.released() {
+            self.stage = Stage::Release;
+            self.elapsed = 0.0;
+        }
+    }
+
+    /// Advance the envelope by `dt` seconds and return its gain.
+    fn step_envelope(&mut self, dt: f32) -> f32 {
+        let env = self.region.envelope;
+        self.elapsed += dt;
+        loop {
+            let (length, next) = match self.stage {
+                Stage::Delay => (env.delay, Stage::Attack),
+                Stage::Attack => (env.attack, Stage::Hold),
+                Stage::Hold => (env.hold, Stage::Decay),
+                _ => break,
+            };
+            if self.stage == Stage::Attack {
+                self.attack = (self.elapsed / length.max(1e-4)).min(1.0);
+            }
+            if self.elapsed < length {
+                break;
+            }
+            self.elapsed -= length;
+            self.stage = next;
+            self.attack = if next == Stage::Attack { 0.0 } else { 1.0 };
+        }
+        match self.stage {
+            // Decay and release run at 96 dB per stage time.
+            Stage::Decay => {
+                self.attenuation_db += SILENT_DB * dt / env.decay.max(1e-4);
+                if self.attenuation_db >= env.sustain {
+                    self.attenuation_db = env.sustain;
+                    self.stage = Stage::Sustain;
+                }
+            }
+            Stage::Release => {
+                self.attenuation_db += SILENT_DB * dt / env.release.max(1e-4);
+                if self.attenuation_db >= SILENT_DB {
+                    self.stage = Stage::Done;
+                }
+            }
+            _ => {}
+        }
+        match self.stage {
+            Stage::Delay | Stage::Done => 0.0,
+            _ => self.attack * 10f32.powf(-self.attenuation_db / 20.0),
+        }
+    }
+}
+
+/// Renders a `Song` with a `SoundFont`; the `PacketSource` behind a MIDI music handle.
+pub struct MidiSource {
+    font: Arc<SoundFont>,
+    song: Arc<Song>,
+    rate: u32,
+    channels: [Channel; 16],
+    voices: Vec<Voice>,
+    next_event: usize,
+    tick: f64,
+    tempo: u32,
+    /// Frames rendered since the last event.
+    tail: u32,
+    /// Guest-controlled; kept across seeks.
+    pub tempo_scale: f32,
+    pub channel_volumes: [f32; 16],
+}
+
+impl MidiSource {
+    pub fn new(font: Arc<SoundFont>, song: Arc<Song>, rate: u32) -> Self {
+        Self {
+            font,
+            song,
+            rate: rate.max(1),
+            channels: [Channel::default(); 16],
+            voices: Vec::new(),
+            next_event: 0,
+            tick: 0.0,
+            tempo: DEFAULT_TEMPO,
+            tail: 0,
+            tempo_scale: 1.0,
+            channel_volumes: [1.0; 16],
+        }
+    }
+
+    fn ticks_per_frame(&self) -> f64 {
+        self.song.division as f64 * 1_000_000.0 / self.tempo as f64 / self.rate as f64
+            * self.tempo_scale as f64
+    }
+
+    /// Frames until the next event is due (at least 1), or `None` after the last one.
+    fn frames_to_next_event(&self) -> Option<usize> {
+        let (tick, _) = self.song.events.get(self.next_event)?;
+        let frames = ((*tick as f64 - self.tick) / self.ticks_per_frame()).ceil();
+        Some(frames.max(1.0) as usize)
+    }
+
+    /// Apply every event due at the current tick. `sound` is false while seeking.
+    fn dispatch(&mut self, sound: bool) {
+        while let Some(&(tick, event)) = self.song.events.get(self.next_event) {
+            if tick as f64 > self.tick {
+                break;
+            }
+            self.next_event += 1;
+            self.tail = 0;
+            self.apply(event, sound);
+        }
+    }
+
+    fn apply(&mut self, event: Event, sound: bool) {
+        match event {
+            Event::Tempo(tempo) => self.tempo = tempo,
+            Event::NoteOn {
+                channel,
+                key,
+                velocity,
+            } if sound => self.note_on(channel, key, velocity),
+            Event::NoteOn { .. } => {}
+            Event::NoteOff { channel, key } => {
+                let sustain = self.channels[channel as usize].sustain;
+                for v in self
+                    .voices
+                    .iter_mut()
+                    .filter(|v| v.channel == channel && v.key == key)
+                {
+                    if sustain {
+                        v.held = true;
+                    } else {
+                        v.release();
+                    }
+                }
+            }
+            Event::Program { channel, program } => {
+                self.channels[channel as usize].program = program
+            }
+            Event::PitchBend { channel, value } => {
+                let ch = &mut self.channels[channel as usize];
+                ch.bend = value as f32 / 8192.0 * ch.bend_range;
+            }
+            Event::Control {
+                channel,
+                controller,
+                value,
+            } => self.control(channel, controller, value),
+        }
+    }
+
+    fn control(&mut self, channel: u8, controller: u8, value: u8) {
+        let ch = &mut self.channels[channel as usize];
+        let unit = value as f32 / 127.0;
+        match controller {
+            0 => ch.bank = value as u16,
+            6 if ch.rpn == (0, 0) => ch.bend_range = value as f32,
+            7 => ch.volume = unit,
+            10 => ch.pan = (value as f32 - 64.0) / 63.0,
+            11 => ch.expression = unit,
+            64 => {
+                ch.sustain = value >= 64;
+                if !ch.sustain {
+                    for v in self
+                        .voices
+                        .iter_mut()
+                        .filter(|v| v.channel == channel && v.held)
+                    {
+                        v.held = false;
+                        v.release();
+                    }
+                }
+            }
+            100 => ch.rpn.1 = value,
+            101 => ch.rpn.0 = value,
+            120 => self.voices.retain(|v| v.channel != channel),
+            121 => {
+                *ch = Channel {
+                    bank: ch.bank,
+                    program: ch.program,
+                    volume: ch.volume,
+                    pan: ch.pan,
+                    ..Channel::default()
+                };
+            }
+            123 => {
+                for v in self.voices.iter_mut().filter(|v| v.channel == channel) {
+                    v.release();
+                }
+            }
+            _ => {}
+        }
+    }
+
+    fn note_on(&mut self, channel: u8, key: u8, velocity: u8) {
+        let ch = self.channels[channel as usize];
+        let bank = if channel == PERCUSSION_CHANNEL {
+            PERCUSSION_BANK
+        } else {
+            ch.bank
+        };
+        let velocity_gain = (velocity as f32 / 127.0).powi(2);
+        for region in self.font.regions(bank, ch.program as u16, key, velocity) {
+            if region.exclusive_class != 0 {
+                self.voices.retain(|v| {
+                    v.channel != channel || v.region.exclusive_class != region.exclusive_class
+                });
+            }
+            if self.voices.len() >= MAX_VOICES {
+                // Voices are kept oldest first; prefer cutting one that is already fading.
+                let victim = self.voices.iter().position(Voice::released).unwrap_or(0);
+                self.voices.remove(victim);
+            }
+            self.voices.push(Voice {
+                channel,
+                key,
+                region,
+                velocity_gain,
+                pos: region.sample.start as f64,
+                stage: Stage::Delay,
+                elapsed: 0.0,
+                attack: 0.0,
+                attenuation_db: 0.0,
+                held: false,
+                gain: 0.0,
+            });
+        }
+    }
+
+    /// Mix `frames` frames of every voice into `out` (interleaved stereo).
+    fn render(&mut self, out: &mut [f32]) {
+        let frames = out.len() / 2;
+        let dt = frames as f32 / self.rate as f32;
+        let data = &self.font.data;
+        for v in &mut self.voices {
+            let ch = &self.channels[v.channel as usize];
+            let from = v.gain;
+            let level = v.step_envelope(dt)
+                * v.velocity_gain
+                * 10f32.powf(-v.region.attenuation / 20.0)
+                * ch.volume.powi(2)
+                * ch.expression.powi(2)
+                * self.channel_volumes[v.channel as usize]
+                * MASTER_GAIN;
+            v.gain = level;
+            let pan = (v.region.pan + ch.pan).clamp(-1.0, 1.0);
+            let angle = (pan + 1.0) * std::f32::consts::FRAC_PI_4;
+            let (left, right) = (angle.cos(), angle.sin());
+
+            let r = &v.region;
+            let cents =
+                (v.key as f32 - r.root_key as f32) * r.scale_tuning + r.tune + ch.bend * 100.0;
+            let step = 2f64.powf(cents as f64 / 1200.0) * r.sample.rate as f64 / self.rate as f64;
+            let looping = r.loop_mode == 1 || (r.loop_mode == 3 && !v.released());
+            let (loop_start, loop_end) = (r.sample.loop_start as f64, r.sample.loop_end as f64);
+
+            for (i, frame) in out.chunks_exact_mut(2).enumerate() {
+                if looping {
+                    while v.pos >= loop_end {
+                        v.pos -= loop_end - loop_start;
+                    }
+                } else if v.pos >= r.sample.end as f64 - 1.0 {
+                    v.stage = Stage::Done;
+                    break;
+                }
+                let index = v.pos as usize;
+                let next = if looping && index + 1 >= r.sample.loop_end as usize {
+                    r.sample.loop_start as usize
+                } else {
+                    index + 1
+                };
+                let (a, b) = (data[index] as f32, data[next] as f32);
+                let t = (v.pos - index as f64) as f32;
+                let gain = from + (level - from) * (i as f32 / frames as f32);
+                let s = (a + (b - a) * t) * gain;
+                frame[0] += s * left;
+                frame[1] += s * right;
+                v.pos += step;
+            }
+        }
+        self.voices.retain(|v| v.stage != Stage::Done);
+    }
+
+    /// Back to the start, keeping the guest's tempo and channel volumes.
+    fn reset(&mut self) {
+        self.channels = [Channel::default(); 16];
+        self.voices.clear();
+        self.next_event = 0;
+        self.tick = 0.0;
+        self.tempo = DEFAULT_TEMPO;
+        self.tail = 0;
+    }
+}
+
+impl PacketSource for MidiSource {
+    fn channels(&self) -> usize {
+        2
+    }
+
+    fn sample_rate(&self) -> u32 {
+        self.rate
+    }
+
+    fn next_packet(&mut self) -> Option<Vec<i16>> {
+        let ended = self.next_event >= self.song.events.len();
+        if ended && (self.voices.is_empty() || self.tail >= self.rate * MAX_TAIL_SECONDS) {
+            return None;
+        }
+        let mut mix = vec![0f32; PACKET_FRAMES * 2];
+        let mut done = 0;
+        while done < PACKET_FRAMES {
+            self.dispatch(true);
+            let due = self.frames_to_next_event().unwrap_or(usize::MAX);
+            let frames = due.min(BLOCK_FRAMES).min(PACKET_FRAMES - done);
+            self.render(&mut mix[done * 2..(done + frames) * 2]);
+            self.tick += frames as f64 * self.ticks_per_frame();
+            self.tail = self.tail.saturating_add(frames as u32);
+            done += frames;
+        }
+        Some(
+            mix.iter()
+                .map(|s| s.clamp(-32768.0, 32767.0) as i16)
+                .collect(),
+        )
+    }
+
+    /// Replay from the start to `frame` without sounding notes.
+    fn seek(&mut self, frame: u64) -> Option<u64> {
+        self.reset();
+        let mut left = frame;
+        while left > 0 {
+            self.dispatch(false);
+            let Some(due) = self.frames_to_next_event() else {
+                break;
+            };
+            let frames = (due as u64).min(left);
+            self.tick += frames as f64 * self.ticks_per_frame();
+            left -= frames;
+        }
+        self.dispatch(false);
+        Some(frame - left)
+    }
+
+    fn as_any_mut(&mut self) -> Option<&mut dyn std::any::Any> {
+        Some(self)
+    }
+}
+
+/// Register a SoundFont (`.sf2`) from guest memory. Returns its id (0 if it doesn't parse).
+pub fn audio_soundfont_create(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    let Ok(bytes) = read_guest_bytes(env, ptr, len) else {
+        return 0;
+    };
+    let Some(font) = SoundFont::parse(&bytes) else {
+        return 0;
+    };
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.audio.next_soundfont_id = s.audio.next_soundfont_id.wrapping_add(1).max(1);
+    let id = s.audio.next_soundfont_id;
+    s.audio.soundfonts.insert(id, Arc::new(font));
+    id
+}
+
+/// Free a SoundFont id. Songs already using it keep playing.
+pub fn audio_soundfont_destroy(id: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.audio.soundfonts.remove(&id);
+}
+
+/// Start a MIDI file with a registered SoundFont. Returns a playing, looping music handle (0 if
+/// the file doesn't parse or the SoundFont id is unknown).
+pub fn audio_midi_play(
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+    soundfont: u32,
+) -> u32 {
+    let Ok(bytes) = read_guest_bytes(env, ptr, len) else {
+        return 0;
+    };
+    let Some(song) = Song::parse(&bytes) else {
+        return 0;
+    };
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let Some(font) = s.audio.soundfonts.get(&soundfont).cloned() else {
+        return 0;
+    };
+    let source = MidiSource::new(font, Arc::new(song), s.audio.sample_rate);
+    let Some(mut stream) = MusicStream::new(Box::new(source)) else {
+        return 0;
+    };
+    stream.playing = true;
+    s.audio.next_music_id = s.audio.next_music_id.wrapping_add(1).max(1);
+    let id = s.audio.next_music_id;
+    s.audio.music.insert(id, stream);
+    id
+}
+
+fn with_midi(handle: u32, f: impl FnOnce(&mut MidiSource)) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let midi = s
+        .audio
+        .music
+        .get_mut(&handle)
+        .and_then(|m| m.source_mut().as_any_mut())
+        .and_then(|any| any.downcast_mut::<MidiSource>());
+    if let Some(midi) = midi {
+        f(midi);
+    }
+}
+
+/// Scale a MIDI handle's tempo (1.0 = as written; clamped to 0.1..=4.0). Pitch is unchanged.
+pub fn audio_midi_set_tempo(handle: u32, scale: f32) {
+    if scale.is_finite() {
+        with_midi(handle, |m| {
+            m.tempo_scale = scale.clamp(MIN_TEMPO_SCALE, MAX_TEMPO_SCALE)
+        });
+    }
+}
+
+/// Set a volume (0.0..=1.0) for one MIDI channel (0..16; 9 is percussion), on top of the file's
+/// own volume and expression.
+pub fn audio_midi_set_channel_volume(handle: u32, channel: u32, vol: f32) {
+    let vol = if vol.is_finite() {
+        vol.clamp(0.0, 1.0)
+    } else {
+        0.0
+    };
+    if channel < 16 {
+        with_midi(handle, |m| m.channel_volumes[channel as usize] = vol);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::av::soundfont::testing::square_font;
+
+    fn smf(tracks: &[&[u8]]) -> Vec<u8> {
+        let mut out = b"MThd\0\0\0\x06\0\x01".to_vec();
+        out.extend_from_slice(&(tracks.len() as u16).to_be_bytes());
+        out.extend_from_slice(&96u16.to_be_bytes());
+        for t in tracks {
+            out.extend_from_slice(b"MTrk");
+            out.extend_from_slice(&(t.len() as u32).to_be_bytes());
+            out.extend_from_slice(t);
+        }
+        out
+    }
+
+    /// 120 bpm at 96 ticks per beat; a note on channel 0 from tick 0 to 96 (half a second).
+    fn one_note() -> Vec<u8> {
+        smf(&[
+            b"\x00\xFF\x51\x03\x07\xA1\x20\x00\xFF\x2F\x00",
+            b"\x00\xC0\x00\x00\x90\x3C\x64\x60\x3C\x00\x00\xFF\x2F\x00",
+        ])
+    }
+
+    fn source(bytes: &[u8]) -> MidiSource {
+        let font = Arc::new(SoundFont::parse(&square_font()).unwrap());
+        MidiSource::new(font, Arc::new(Song::parse(bytes).unwrap()), 1000)
+    }
+
+    fn frames_until_release(m: &mut MidiSource) -> usize {
+        let mut frames = 0;
+        while m.voices.iter().all(|v| !v.released()) {
+            m.next_packet().unwrap();
+            frames += PACKET_FRAMES;
+        }
+        frames
+    }
+
+    #[test]
+    fn parses_tracks_running_status_and_tempo() {
+        let song = Song::parse(&smf(&[
+            b"\x00\x90\x3C\x40\x10\x3E\x40\x10\x80\x3C\x00\x00\xE0\x00\x40\x00\xFF\x2F\x00",
+        ]))
+        .unwrap();
+        assert_eq!(song.division, 96);
+        assert_eq!(
+            song.events,
+            [
+                (
+                    0,
+                    Event::NoteOn {
+                        channel: 0,
+                        key: 60,
+                        velocity: 64
+                    }
+                ),
+                (
+                    16,
+                    Event::NoteOn {
+                        channel: 0,
+                        key: 62,
+                        velocity: 64
+                    }
+                ),
+                (
+                    32,
+                    Event::NoteOff {
+                        channel: 0,
+                        key: 60
+                    }
+                ),
+                (
+                    32,
+                    Event::PitchBend {
+                        channel: 0,
+                        value: 0
+                    }
+                ),
+            ]
+        );
+        assert_eq!(
+            Song::parse(&one_note()).unwrap().events[0],
+            (0, Event::Tempo(500_000))
+        );
+        assert!(Song::parse(b"RIFF").is_none());
+    }
+
+    #[test]
+    fn renders_notes_until_released() {
+        let mut m = source(&one_note());
+        assert!(m.next_packet().unwrap().iter().any(|&s| s != 0));
+        // Released half a second in (at 1000 Hz), during the second packet.
+        let mut m = source(&one_note());
+        assert_eq!(frames_until_release(&mut m), 2 * PACKET_FRAMES);
+        // The release fades out and the song ends.
+        let mut packets = 0;
+        while m.next_packet().is_some() {
+            packets += 1;
+        }
+        assert!(packets <= 3, "{packets}");
+    }
+
+    #[test]
+    fn tempo_and_channel_volume_apply() {
+        let mut m = source(&one_note());
+        m.tempo_scale = 2.0;
+        assert_eq!(frames_until_release(&mut m) / PACKET_FRAMES, 1);
+
+        let mut m = source(&one_note());
+        m.channel_volumes[0] = 0.0;
+        assert!(m.next_packet().unwrap().iter().all(|&s| s == 0));
+
+        // Seeking replays the program change but doesn't start the note.
+        let mut m = source(&one_note());
+        assert_eq!(m.seek(100), Some(100));
+        assert!(m.voices.is_empty());
+        assert_eq!((m.next_event, m.channels[0].program), (3, 0));
+    }
+}
@@ -23,17 +23,97 @@ extern crate alloc;
 
 // Storage ABI helpers
 
+pub mod aseprite;
 pub mod audio;
+pub mod camera;
+pub mod dsp;
 pub mod graphics;
 pub mod graphics3d;
+pub mod layers;
+pub mod mask;
+pub mod mic;
+pub mod midi;
+pub mod music;
+pub mod palette;
+pub mod particles;
+pub mod path;
+pub mod post;
 pub mod resources;
+pub mod scaling;
+pub mod sdf;
+pub mod sound_pool;
+pub mod soundfont;
 pub mod storage;
+pub mod synth;
 pub mod tests;
+pub mod tilemap;
+pub mod transition;
 pub mod utils;
 
 // Re-export all public functions
+pub use aseprite::{
+    graphics_aseprite_draw_frame, graphics_aseprite_draw_tag, graphics_aseprite_frame_count,
+    graphics_aseprite_frame_duration, graphics_aseprite_register,
+    graphics_aseprite_set_layer_visible, graphics_aseprite_size, graphics_aseprite_tag_duration,
+    graphics_aseprite_unregister,
+};
 pub use audio::*;
+pub use camera::{
+    camera_begin_frame, camera_end_frame, camera_point, graphics_camera_reset, graphics_camera_set,
+    graphics_camera_set_bounds, graphics_camera_shake, graphics_screen_to_world,
+    graphics_world_to_screen,
+};
+pub use dsp::{
+    audio_effect_disable, audio_effect_enable, audio_group_set_send, audio_set_send,
+    audio_synth_set_send,
+};
 pub use graphics::*;
 pub use graphics3d::*;
-pub use resources::AvError;
+pub use layers::{
+    graphics_layer_begin, graphics_layer_end, graphics_layer_set_order,
+    graphics_layer_set_parallax, graphics_layer_set_visible, layers_begin_frame, layers_end_frame,
+};
+pub use mask::{
+    graphics_mask_begin, graphics_mask_end, graphics_mask_off, graphics_mask_use, mask_begin_frame,
+};
+pub use mic::{audio_capture_read, audio_capture_start, audio_capture_stop};
+pub use midi::{
+    audio_midi_play, audio_midi_set_channel_volume, audio_midi_set_tempo, audio_soundfont_create,
+    audio_soundfont_destroy,
+};
+pub use music::{
+    audio_music_create, audio_music_crossfade, audio_music_destroy, audio_music_pause,
+    audio_music_play, audio_music_position, audio_music_seek, audio_music_set_group,
+    audio_music_set_looping, audio_music_set_volume, audio_music_stop,
+};
+pub use palette::*;
+pub use particles::{
+    graphics_particles_clear, graphics_particles_count, graphics_particles_create,
+    graphics_particles_destroy, graphics_particles_emit, graphics_particles_update_and_draw,
+};
+pub use path::{
+    graphics_path_begin, graphics_path_close, graphics_path_curve_to, graphics_path_fill,
+    graphics_path_line_to, graphics_path_move_to, graphics_path_stroke,
+};
+pub use post::{graphics_color_grade_set, graphics_set_post_effect};
+pub use resources::{AvError, graphics_last_error};
+pub use scaling::{
+    graphics_fullscreen, graphics_resized, graphics_set_fullscreen, graphics_set_scaling_mode,
+    graphics_window_size,
+};
+pub use sdf::{graphics_font_register_ttf_sdf, graphics_text_sdf_key};
+pub use sound_pool::{
+    audio_sound_pool_active, audio_sound_pool_create, audio_sound_pool_create_async,
+    audio_sound_pool_destroy, audio_sound_pool_play, audio_sound_pool_set_group,
+    audio_sound_pool_set_pitch_variation, audio_sound_pool_stop,
+};
 pub use storage::*;
+pub use tilemap::{
+    graphics_map_draw, graphics_map_draw_layer, graphics_map_layer_count, graphics_map_layer_index,
+    graphics_map_load, graphics_map_objects, graphics_map_register, graphics_map_size,
+    graphics_map_tile, graphics_map_tile_size, graphics_map_unregister,
+};
+pub use transition::{
+    graphics_transition_active, graphics_transition_midpoint, graphics_transition_start,
+    transition_begin_tick,
+};
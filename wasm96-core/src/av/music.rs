@@ -0,0 +1,464 @@
+//! Streamed music.
+//!
+//! WAV, QOA and XM are decoded to PCM up front, which is fine for sound effects but costs tens of
+//! megabytes for a few minutes of music. A music handle instead keeps the compressed file and
+//! decodes a few packets at a time while mixing, resampling to the output rate as it goes.
+//!
+//! Handles survive `stop` (which rewinds) and are freed by `destroy`. Each stream has its own
+//! volume plus a fade level, which `crossfade` ramps to hand over from one track to another.
+//!
+//! `wasm96_audio_music_create` takes Ogg Vorbis and returns 0 for other formats. MIDI songs
+//! (`wasm96_audio_midi_play`, see `midi`) are rendered by a synth into the same kind of stream.
+
+use std::collections::VecDeque;
+use std::io::Cursor;
+
+use lewton::inside_ogg::OggStreamReader;
+use wasmtime::Caller;
+
+use crate::runtime::GuestLimits;
+use crate::state::{AUDIO_GROUP_MUSIC, AUDIO_GROUPS, global};
+
+use super::utils::{read_guest_bytes, sat_add_i16};
+
+/// `format` value for Ogg Vorbis data.
+pub const MUSIC_FORMAT_OGG_VORBIS: u32 = 0;
+
+/// Rewinds allowed while decoding nothing; an empty or broken file set to loop ends instead of
+/// spinning.
+const MAX_EMPTY_REWINDS: u32 = 1;
+
+/// A decoder that yields interleaved PCM packets and can jump to a frame.
+pub trait PacketSource: Send {
+    fn channels(&self) -> usize;
+    fn sample_rate(&self) -> u32;
+    /// The next packet of interleaved samples; `None` at the end (or on a decode error).
+    fn next_packet(&mut self) -> Option<Vec<i16>>;
+    /// Jump to about `frame`; returns the frame decoding actually resumes from.
+    fn seek(&mut self, frame: u64) -> Option<u64>;
+    /// The source itself, for sources with their own controls (see `midi`).
+    fn as_any_mut(&mut self) -> Option<&mut dyn std::any::Any> {
+        None
+    }
+}
+
+struct OggSource(OggStreamReader<Cursor<Vec<u8>>>);
+
+impl PacketSource for OggSource {
+    fn channels(&self) -> usize {
+        self.0.ident_hdr.audio_channels as usize
+    }
+
+    fn sample_rate(&self) -> u32 {
+        self.0.ident_hdr.audio_sample_rate
+    }
+
+    fn next_packet(&mut self) -> Option<Vec<i16>> {
+        self.0.read_dec_packet_itl().ok().flatten()
+    }
+
+    // Vorbis seeks to the page holding `frame`, so decoding restarts a little before it.
+    fn seek(&mut self, frame: u64) -> Option<u64> {
+        self.0.seek_absgp_pg(frame).ok()?;
+        Some(frame)
+    }
+}
+
+/// A volume ramp in output frames.
+#[derive(Debug, Clone, Copy)]
+struct Fade {
+    from: f32,
+    to: f32,
+    done: u64,
+    total: u64,
+    /// Stop (and rewind) the stream when the ramp ends.
+    stop: bool,
+}
+
+/// One music handle's decoder and playback state.
+pub struct MusicStream {
+    source: Box<dyn PacketSource>,
+    /// Decoded stereo frames not yet mixed past.
+    pending: VecDeque<[i16; 2]>,
+    /// Read position between `pending[0]` and `pending[1]`, for resampling.
+    frac: f64,
+    /// Source frame index of the next frame to be decoded.
+    decoded: u64,
+    /// The decoder has run out and the stream doesn't loop.
+    exhausted: bool,
+    pub playing: bool,
+    pub looping: bool,
+    pub volume: f32,
+    pub group: u32,
+    /// Multiplier driven by fades (1.0 unless fading).
+    level: f32,
+    fade: Option<Fade>,
+}
+
+impl std::fmt::Debug for MusicStream {
+    fn fmt(&self, f: &mut std::fmt::Formatter<'_>) -> std::fmt::Result {
+        f.debug_struct("MusicStream")
+            .field("sample_rate", &self.source.sample_rate())
+            .field("position", &self.position_frames())
+            .field("playing", &self.playing)
+            .field("looping", &self.looping)
+            .field("volume", &self.volume)
+            .finish_non_exhaustive()
+    }
+}
+
+impl MusicStream {
+    /// A paused stream over `source`. Mono and stereo sources are supported.
+    pub fn new(source: Box<dyn PacketSource>) -> Option<Self> {
+        if !(1..=2).contains(&source.channels()) || source.sample_rate() == 0 {
+            return None;
+        }
+        Some(Self {
+            source,
+            pending: VecDeque::new(),
+            frac: 0.0,
+            decoded: 0,
+            exhausted: false,
+            playing: false,
+            looping: true,
+            volume: 1.0,
+            group: AUDIO_GROUP_MUSIC,
+            level: 1.0,
+            fade: None,
+        })
+    }
+
+    /// Source frame currently playing.
+    pub fn position_frames(&self) -> u64 {
+        self.decoded.saturating_sub(self.pending.len() as u64)
+    }
+
+    pub fn sample_rate(&self) -> u32 {
+        self.source.sample_rate()
+    }
+
+    pub fn source_mut(&mut self) -> &mut dyn PacketSource {
+        self.source.as_mut()
+    }
+
+    /// Decode until at least `frames` are pending. Returns false if the stream ran out first.
+    fn fill(&mut self, frames: usize) -> bool {
+        let mut rewinds = 0;
+        while self.pending.len() < frames {
+            if self.exhausted {
+                return false;
+            }
+            let Some(packet) = self.source.next_packet() else {
+                if self.looping && rewinds < MAX_EMPTY_REWINDS {
+                    rewinds += 1;
+                    self.decoded = self.source.seek(0).unwrap_or(0);
+                } else {
+                    self.exhausted = true;
+                }
+                continue;
+            };
+            if !packet.is_empty() {
+                rewinds = 0;
+            }
+            match self.source.channels() {
+                1 => self.pending.extend(packet.iter().map(|&s| [s, s])),
+                _ => self
+                    .pending
+                    .extend(packet.chunks_exact(2).map(|f| [f[0], f[1]])),
+            }
+            self.decoded += (packet.len() / self.source.channels()) as u64;
+        }
+        true
+    }
+
+    /// Jump to `frame`, dropping anything already decoded.
+    pub fn seek(&mut self, frame: u64) -> bool {
+        let Some(at) = self.source.seek(frame) else {
+            return false;
+        };
+        self.pending.clear();
+        self.frac = 0.0;
+        self.decoded = at;
+        self.exhausted = false;
+        true
+    }
+
+    /// Stop and rewind to the start.
+    pub fn stop(&mut self) {
+        self.playing = false;
+        self.fade = None;
+        self.level = 1.0;
+        self.seek(0);
+    }
+
+    /// Ramp the fade level to `to` over `frames` output frames, optionally stopping at the end.
+    pub fn fade_to(&mut self, to: f32, frames: u64, stop: bool) {
+        if frames == 0 {
+            self.level = to;
+            self.fade = None;
+            if stop {
+                self.stop();
+            }
+            return;
+        }
+        self.fade = Some(Fade {
+            from: self.level,
+            to,
+            done: 0,
+            total: frames,
+            stop,
+        });
+    }
+
+    /// Advance the fade by one output frame.
+    fn step_fade(&mut self) {
+        let Some(fade) = self.fade.as_mut() else {
+            return;
+        };
+        fade.done += 1;
+        let t = fade.done as f32 / fade.total as f32;
+        self.level = fade.from + (fade.to - fade.from) * t.min(1.0);
+        if fade.done >= fade.total {
+            let stop = fade.stop;
+            self.fade = None;
+            if stop {
+                self.stop();
+            }
+        }
+    }
+}
+
+/// Mix a playing stream into `out` (interleaved stereo at `out_rate`), scaled by `gain`.
+pub fn mix_music(m: &mut MusicStream, out_rate: u32, gain: f32, out: &mut [i16]) {
+    if !m.playing {
+        return;
+    }
+    let step = m.sample_rate() as f64 / out_rate.max(1) as f64;
+    for frame in out.chunks_exact_mut(2) {
+        if !m.fill(2) && m.pending.is_empty() {
+            // Played to the end without looping: rewind so `play` starts over.
+            m.stop();
+            return;
+        }
+        let a = m.pending[0];
+        let b = m.pending.get(1).copied().unwrap_or(a);
+        let t = m.frac as f32;
+        let volume = m.volume * m.level * gain;
+        for c in 0..2 {
+            let s = a[c] as f32 + (b[c] as f32 - a[c] as f32) * t;
+            frame[c] = sat_add_i16(frame[c], (s * volume) as i16);
+        }
+        m.frac += step;
+        while m.frac >= 1.0 && !m.pending.is_empty() {
+            m.pending.pop_front();
+            m.frac -= 1.0;
+        }
+        m.step_fade();
+        if !m.playing {
+            return;
+        }
+    }
+}
+
+fn with_music<R>(handle: u32, f: impl FnOnce(&mut MusicStream, u32) -> R) -> Option<R> {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let out_rate = s.audio.sample_rate;
+    s.audio.music.get_mut(&handle).map(|m| f(m, out_rate))
+}
+
+fn millis_to_frames(ms: u32, rate: u32) -> u64 {
+    ms as u64 * rate as u64 / 1000
+}
+
+/// Register a stream over guest data; returns a paused, looping handle (0 if the format is
+/// unknown or the data can't be decoded).
+pub fn audio_music_create(
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+    format: u32,
+) -> u32 {
+    let Ok(bytes) = read_guest_bytes(env, ptr, len) else {
+        return 0;
+    };
+    let source: Box<dyn PacketSource> = match format {
+        MUSIC_FORMAT_OGG_VORBIS => match OggStreamReader::new(Cursor::new(bytes)) {
+            Ok(reader) => Box::new(OggSource(reader)),
+            Err(_) => return 0,
+        },
+        _ => return 0,
+    };
+    let Some(stream) = MusicStream::new(source) else {
+        return 0;
+    };
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.audio.next_music_id = s.audio.next_music_id.wrapping_add(1).max(1);
+    let id = s.audio.next_music_id;
+    s.audio.music.insert(id, stream);
+    id
+}
+
+/// Start or resume playback.
+pub fn audio_music_play(handle: u32) {
+    with_music(handle, |m, _| m.playing = true);
+}
+
+pub fn audio_music_pause(handle: u32) {
+    with_music(handle, |m, _| m.playing = false);
+}
+
+/// Stop and rewind; `play` starts from the beginning again.
+pub fn audio_music_stop(handle: u32) {
+    with_music(handle, |m, _| m.stop());
+}
+
+/// Free a handle.
+pub fn audio_music_destroy(handle: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.audio.music.remove(&handle);
+}
+
+/// Jump to `millis` from the start. Returns 1 on success.
+pub fn audio_music_seek(handle: u32, millis: u32) -> u32 {
+    with_music(handle, |m, _| {
+        let frame = millis_to_frames(millis, m.sample_rate());
+        m.seek(frame) as u32
+    })
+    .unwrap_or(0)
+}
+
+/// Playback position in milliseconds, or `u32::MAX` for an unknown handle.
+pub fn audio_music_position(handle: u32) -> u32 {
+    with_music(handle, |m, _| {
+        (m.position_frames() * 1000 / m.sample_rate() as u64).min(u32::MAX as u64 - 1) as u32
+    })
+    .unwrap_or(u32::MAX)
+}
+
+pub fn audio_music_set_volume(handle: u32, vol: f32) {
+    let vol = if vol.is_finite() {
+        vol.clamp(0.0, 1.0)
+    } else {
+        0.0
+    };
+    with_music(handle, |m, _| m.volume = vol);
+}
+
+pub fn audio_music_set_looping(handle: u32, enabled: bool) {
+    with_music(handle, |m, _| m.looping = enabled);
+}
+
+/// Move a stream to another mixer group (music by default).
+pub fn audio_music_set_group(handle: u32, group: u32) {
+    if (group as usize) < AUDIO_GROUPS {
+        with_music(handle, |m, _| m.group = group);
+    }
+}
+
+/// Fade `from` out (then stop it) while fading `to` in from silence, over `millis`. Either
+/// handle may be 0 for a plain fade-in or fade-out.
+pub fn audio_music_crossfade(from: u32, to: u32, millis: u32) {
+    with_music(from, |m, rate| {
+        m.fade_to(0.0, millis_to_frames(millis, rate), true)
+    });
+    with_music(to, |m, rate| {
+        if !m.playing {
+            m.level = 0.0;
+        }
+        m.playing = true;
+        m.fade_to(1.0, millis_to_frames(millis, rate), false);
+    });
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// Mono ramp 0, 1, 2, ... in packets of 4.
+    struct Ramp {
+        len: u64,
+        at: u64,
+        rate: u32,
+    }
+
+    impl PacketSource for Ramp {
+        fn channels(&self) -> usize {
+            1
+        }
+
+        fn sample_rate(&self) -> u32 {
+            self.rate
+        }
+
+        fn next_packet(&mut self) -> Option<Vec<i16>> {
+            if self.at >= self.len {
+                return None;
+            }
+            let end = (self.at + 4).min(self.len);
+            let packet = (self.at..end).map(|s| s as i16).collect();
+            self.at = end;
+            Some(packet)
+        }
+
+        fn seek(&mut self, frame: u64) -> Option<u64> {
+            self.at = frame.min(self.len);
+            Some(self.at)
+        }
+    }
+
+    fn ramp(len: u64, rate: u32) -> MusicStream {
+        let mut m = MusicStream::new(Box::new(Ramp { len, at: 0, rate })).unwrap();
+        m.playing = true;
+        m
+    }
+
+    fn left(out: &[i16]) -> Vec<i16> {
+        out.iter().step_by(2).copied().collect()
+    }
+
+    #[test]
+    fn streams_loop_and_resample() {
+        let mut m = ramp(6, 100);
+        let mut out = vec![0; 16];
+        mix_music(&mut m, 100, 1.0, &mut out);
+        assert_eq!(left(&out), [0, 1, 2, 3, 4, 5, 0, 1]);
+        assert_eq!(m.position_frames(), 2);
+
+        // Half the source rate: every frame is played twice (interpolated in between).
+        let mut m = ramp(100, 50);
+        let mut out = vec![0; 8];
+        mix_music(&mut m, 100, 1.0, &mut out);
+        assert_eq!(left(&out), [0, 0, 1, 1]);
+    }
+
+    #[test]
+    fn non_looping_streams_stop_and_rewind() {
+        let mut m = ramp(3, 100);
+        m.looping = false;
+        let mut out = vec![0; 12];
+        mix_music(&mut m, 100, 1.0, &mut out);
+        assert_eq!(left(&out), [0, 1, 2, 0, 0, 0]);
+        assert!(!m.playing);
+        assert_eq!(m.position_frames(), 0);
+    }
+
+    #[test]
+    fn fades_ramp_the_level_and_can_stop() {
+        let mut m = ramp(1000, 100);
+        m.seek(100);
+        m.fade_to(0.0, 4, true);
+        let mut out = vec![0; 12];
+        mix_music(&mut m, 100, 1.0, &mut out);
+        assert_eq!(left(&out), [100, 75, 51, 25, 0, 0]);
+        assert!(!m.playing);
+    }
+}
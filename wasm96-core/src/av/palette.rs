@@ -0,0 +1,126 @@
+//! Indexed-color palette mode.
+//!
+//! Indexed images store one palette index per pixel and are colored when drawn, so changing a
+//! palette entry, swapping indices or marking one transparent affects every later draw without
+//! re-uploading pixels (PICO-8-style flashes, recolored enemies and fades). `set_color_index`
+//! picks the shape draw color from the same palette.
+
+use wasmtime::Caller;
+
+use super::resources::{IndexedImage, RESOURCES, ResourceError, registration_failed};
+use super::utils::{graphics_image_from_host, read_guest_bytes};
+use crate::runtime::GuestLimits;
+use crate::state::{Palette, global};
+
+/// Set palette entry `index` (0..=255) to an RGB color.
+pub fn graphics_palette_set(index: u32, r: u32, g: u32, b: u32) {
+    let Ok(index) = u8::try_from(index) else {
+        return;
+    };
+    let mut s = global().lock().unwrap();
+    s.video.palette.colors[index as usize] = ((r & 0xFF) << 16) | ((g & 0xFF) << 8) | (b & 0xFF);
+}
+
+/// Draw index `from` with the color of index `to` until swapped back or reset.
+pub fn graphics_palette_swap(from: u32, to: u32) {
+    let (Ok(from), Ok(to)) = (u8::try_from(from), u8::try_from(to)) else {
+        return;
+    };
+    let mut s = global().lock().unwrap();
+    s.video.palette.swap[from as usize] = to;
+}
+
+/// Mark whether pixels with `index` are skipped when drawing indexed images.
+pub fn graphics_palette_set_transparent(index: u32, transparent: u32) {
+    let Ok(index) = u8::try_from(index) else {
+        return;
+    };
+    let mut s = global().lock().unwrap();
+    s.video.palette.transparent[index as usize] = transparent != 0;
+}
+
+/// Undo all swaps and restore the default transparency (index 0 only). Colors are kept.
+pub fn graphics_palette_reset() {
+    let mut s = global().lock().unwrap();
+    s.video.palette.reset_swaps();
+}
+
+/// Set the draw color to palette entry `index` (after swaps), fully opaque.
+pub fn graphics_set_color_index(index: u32) {
+    let Ok(index) = u8::try_from(index) else {
+        return;
+    };
+    let mut s = global().lock().unwrap();
+    s.video.draw_color = 0xFF00_0000 | s.video.palette.resolve(index);
+}
+
+/// Register a `width`x`height` image of palette indices (one byte per pixel, row-major) under a
+/// key. Returns 1 on success, 0 if the data is shorter than `width * height`.
+pub fn graphics_indexed_register(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    width: u32,
+    height: u32,
+    data_ptr: u32,
+    data_len: u32,
+) -> u32 {
+    let Some(pixels) = (width as usize).checked_mul(height as usize) else {
+        return registration_failed(ResourceError::Invalid);
+    };
+    if (data_len as usize) < pixels {
+        return registration_failed(ResourceError::Invalid);
+    }
+    let Ok(mut indices) = read_guest_bytes(env, data_ptr, data_len) else {
+        return registration_failed(ResourceError::Memory);
+    };
+    indices.truncate(pixels);
+
+    let mut res = RESOURCES.lock().unwrap();
+    res.keyed_indexed.insert(
+        key,
+        IndexedImage {
+            indices,
+            width,
+            height,
+        },
+    );
+    1
+}
+
+/// Unregister a keyed indexed image.
+pub fn graphics_indexed_unregister(key: u64) {
+    let mut res = RESOURCES.lock().unwrap();
+    res.keyed_indexed.remove(&key);
+}
+
+/// Draw a keyed indexed image at natural size through the current palette.
+pub fn graphics_indexed_draw(key: u64, x: i32, y: i32) {
+    let (rgba, w, h) = {
+        let res = RESOURCES.lock().unwrap();
+        let Some(img) = res.keyed_indexed.get(&key) else {
+            return;
+        };
+        let s = global().lock().unwrap();
+        (
+            indexed_to_rgba(&img.indices, &s.video.palette),
+            img.width,
+            img.height,
+        )
+    };
+    graphics_image_from_host(x, y, w, h, &rgba);
+}
+
+/// Color palette indices as RGBA8888. Transparency is looked up on the original index, before
+/// its swap.
+pub fn indexed_to_rgba(indices: &[u8], palette: &Palette) -> Vec<u8> {
+    let mut out = Vec::with_capacity(indices.len() * 4);
+    for &i in indices {
+        if palette.transparent[i as usize] {
+            out.extend_from_slice(&[0, 0, 0, 0]);
+        } else {
+            let c = palette.resolve(i);
+            out.extend_from_slice(&[(c >> 16) as u8, (c >> 8) as u8, c as u8, 255]);
+        }
+    }
+    out
+}
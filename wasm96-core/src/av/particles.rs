@@ -0,0 +1,283 @@
+//! Host-side particle systems.
+//!
+//! A cart creates a keyed system from a packed [`ParticleConfig`], emits bursts into it and calls
+//! `update_and_draw` once per frame; the host integrates and rasterizes every particle, so
+//! explosions and rain cost a handful of imports instead of guest CPU. Particles are simulated
+//! with the guest tick's delta time and draw as alpha-blended squares or circles.
+//!
+//! Systems are effects, not game state: they are not captured by save states.
+
+use std::collections::HashMap;
+use std::sync::Mutex;
+
+use wasmtime::Caller;
+
+use super::utils::{Canvas, read_guest_bytes};
+use crate::runtime::GuestLimits;
+use crate::state::global;
+
+lazy_static::lazy_static! {
+    static ref SYSTEMS: Mutex<HashMap<u64, ParticleSystem>> = Mutex::new(HashMap::new());
+}
+
+/// Bytes in a packed [`ParticleConfig`].
+pub const PARTICLE_CONFIG_SIZE: usize = 60;
+
+/// Particles kept per system when the config asks for 0.
+const DEFAULT_MAX_PARTICLES: u32 = 1024;
+const MAX_PARTICLES_LIMIT: u32 = 65536;
+
+/// How a system's particles behave over their life.
+///
+/// Packed as 15 little-endian words: life min/max `u32` (ms), speed min/max `f32` (px/s),
+/// direction `f32` (radians, 0 = right, clockwise), spread `f32` (full cone width in radians),
+/// gravity x/y `f32` (px/s²), drag `f32` (fraction of velocity lost per second), start/end color
+/// `u32` (0xRRGGBBAA), start/end size `f32` (px), max particles `u32` (0 = 1024), shape `u32`
+/// (0 = square, 1 = circle).
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct ParticleConfig {
+    pub life_min_ms: u32,
+    pub life_max_ms: u32,
+    pub speed_min: f32,
+    pub speed_max: f32,
+    pub direction: f32,
+    pub spread: f32,
+    pub gravity: (f32, f32),
+    pub drag: f32,
+    pub color_start: [u8; 4],
+    pub color_end: [u8; 4],
+    pub size_start: f32,
+    pub size_end: f32,
+    pub max_particles: u32,
+    pub circle: bool,
+}
+
+impl ParticleConfig {
+    /// Decode a packed config; `None` if `data` is too short.
+    pub fn parse(data: &[u8]) -> Option<Self> {
+        let data = data.get(..PARTICLE_CONFIG_SIZE)?;
+        let word = |i: usize| {
+            u32::from_le_bytes([
+                data[i * 4],
+                data[i * 4 + 1],
+                data[i * 4 + 2],
+                data[i * 4 + 3],
+            ])
+        };
+        let float = |i: usize| {
+            let v = f32::from_bits(word(i));
+            if v.is_finite() { v } else { 0.0 }
+        };
+        let (life_min_ms, life_max_ms) = (word(0), word(1));
+        let max_particles = match word(13) {
+            0 => DEFAULT_MAX_PARTICLES,
+            n => n.min(MAX_PARTICLES_LIMIT),
+        };
+        Some(Self {
+            life_min_ms: life_min_ms.min(life_max_ms),
+            life_max_ms: life_max_ms.max(life_min_ms),
+            speed_min: float(2),
+            speed_max: float(3),
+            direction: float(4),
+            spread: float(5),
+            gravity: (float(6), float(7)),
+            drag: float(8).clamp(0.0, 1.0),
+            color_start: word(9).to_be_bytes(),
+            color_end: word(10).to_be_bytes(),
+            size_start: float(11).max(0.0),
+            size_end: float(12).max(0.0),
+            max_particles,
+            circle: word(14) == 1,
+        })
+    }
+}
+
+#[derive(Copy, Clone, Debug)]
+struct Particle {
+    x: f32,
+    y: f32,
+    vx: f32,
+    vy: f32,
+    age: f32,
+    life: f32,
+}
+
+/// A config plus its live particles.
+#[derive(Clone, Debug)]
+pub struct ParticleSystem {
+    config: ParticleConfig,
+    particles: Vec<Particle>,
+    rng: u64,
+}
+
+impl ParticleSystem {
+    /// An empty system; `seed` makes emission repeatable.
+    pub fn new(config: ParticleConfig, seed: u64) -> Self {
+        Self {
+            config,
+            particles: Vec::new(),
+            // xorshift state must be non-zero.
+            rng: seed | 1,
+        }
+    }
+
+    pub fn len(&self) -> usize {
+        self.particles.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.particles.is_empty()
+    }
+
+    pub fn clear(&mut self) {
+        self.particles.clear();
+    }
+
+    /// Uniform in 0..1.
+    fn next_unit(&mut self) -> f32 {
+        self.rng ^= self.rng << 13;
+        self.rng ^= self.rng >> 7;
+        self.rng ^= self.rng << 17;
+        (self.rng >> 40) as f32 / (1u64 << 24) as f32
+    }
+
+    fn range(&mut self, min: f32, max: f32) -> f32 {
+        min + (max - min) * self.next_unit()
+    }
+
+    /// Spawn up to `count` particles at (x, y); any beyond the system's limit are dropped.
+    pub fn emit(&mut self, x: f32, y: f32, count: u32) {
+        let room = (self.config.max_particles as usize).saturating_sub(self.particles.len());
+        for _ in 0..(count as usize).min(room) {
+            let c = self.config;
+            let angle = c.direction + self.range(-0.5, 0.5) * c.spread;
+            let speed = self.range(c.speed_min, c.speed_max);
+            let life = self.range(c.life_min_ms as f32, c.life_max_ms as f32) / 1000.0;
+            self.particles.push(Particle {
+                x,
+                y,
+                vx: angle.cos() * speed,
+                vy: angle.sin() * speed,
+                age: 0.0,
+                life,
+            });
+        }
+    }
+
+    /// Advance every particle by `dt` seconds and drop the ones that outlived their life.
+    pub fn update(&mut self, dt: f32) {
+        let c = self.config;
+        let damping = (1.0 - c.drag).powf(dt);
+        self.particles.retain_mut(|p| {
+            p.age += dt;
+            if p.age >= p.life {
+                return false;
+            }
+            p.vx = (p.vx + c.gravity.0 * dt) * damping;
+            p.vy = (p.vy + c.gravity.1 * dt) * damping;
+            p.x += p.vx * dt;
+            p.y += p.vy * dt;
+            true
+        });
+    }
+
+    /// Rasterize into an XRGB framebuffer whose pixel (0, 0) is at `origin`, interpolating color
+    /// and size over each particle's life.
+    pub fn draw(&self, fb: &mut Canvas, width: u32, height: u32, origin: (i32, i32)) {
+        let c = self.config;
+        for p in &self.particles {
+            let (x, y) = (p.x - origin.0 as f32, p.y - origin.1 as f32);
+            let t = if p.life > 0.0 { p.age / p.life } else { 1.0 };
+            let size = c.size_start + (c.size_end - c.size_start) * t;
+            let [r, g, b, a] = [0, 1, 2, 3].map(|i| {
+                let (s, e) = (c.color_start[i] as f32, c.color_end[i] as f32);
+                (s + (e - s) * t).round() as u8
+            });
+            if size < 0.5 || a == 0 {
+                continue;
+            }
+            let tint = ((a as u32) << 24) | 0x00FF_FFFF;
+            let half = size / 2.0;
+            let x0 = ((x - half).round() as i64).max(0);
+            let y0 = ((y - half).round() as i64).max(0);
+            let x1 = ((x + half).round() as i64).min(width as i64);
+            let y1 = ((y + half).round() as i64).min(height as i64);
+            for py in y0..y1 {
+                for px in x0..x1 {
+                    if c.circle {
+                        let (dx, dy) = (px as f32 + 0.5 - x, py as f32 + 0.5 - y);
+                        if dx * dx + dy * dy > half * half {
+                            continue;
+                        }
+                    }
+                    let idx = py as usize * width as usize + px as usize;
+                    fb.image_pixel(idx, [r, g, b, 255], tint);
+                }
+            }
+        }
+    }
+}
+
+/// Create (or replace) the particle system under `key` from a packed config. Returns 1 on
+/// success, 0 if the config is too short.
+pub fn graphics_particles_create(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    config_ptr: u32,
+    config_len: u32,
+) -> u32 {
+    let Ok(data) = read_guest_bytes(env, config_ptr, config_len) else {
+        return 0;
+    };
+    let Some(config) = ParticleConfig::parse(&data) else {
+        return 0;
+    };
+    let mut systems = SYSTEMS.lock().unwrap();
+    systems.insert(key, ParticleSystem::new(config, key));
+    1
+}
+
+/// Spawn `count` particles at (x, y) in the system under `key`.
+pub fn graphics_particles_emit(key: u64, x: i32, y: i32, count: u32) {
+    let mut systems = SYSTEMS.lock().unwrap();
+    if let Some(system) = systems.get_mut(&key) {
+        system.emit(x as f32, y as f32, count);
+    }
+}
+
+/// Step the system under `key` by the last tick's delta time and draw it.
+pub fn graphics_particles_update_and_draw(key: u64) {
+    let mut systems = SYSTEMS.lock().unwrap();
+    let Some(system) = systems.get_mut(&key) else {
+        return;
+    };
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    system.update(s.timing.delta_millis as f32 / 1000.0);
+    let (w, h) = (s.video.width, s.video.height);
+    // Particles live in world space when a camera pass is open.
+    let origin = s.video.camera.pass.as_ref().map_or((0, 0), |p| p.origin);
+    system.draw(&mut Canvas::of(&mut s.video), w, h, origin);
+}
+
+/// Number of live particles in the system under `key` (0 if there is none).
+pub fn graphics_particles_count(key: u64) -> u32 {
+    let systems = SYSTEMS.lock().unwrap();
+    systems.get(&key).map_or(0, |s| s.len() as u32)
+}
+
+/// Remove the live particles of the system under `key`, keeping its config.
+pub fn graphics_particles_clear(key: u64) {
+    let mut systems = SYSTEMS.lock().unwrap();
+    if let Some(system) = systems.get_mut(&key) {
+        system.clear();
+    }
+}
+
+/// Destroy the system under `key`.
+pub fn graphics_particles_destroy(key: u64) {
+    let mut systems = SYSTEMS.lock().unwrap();
+    systems.remove(&key);
+}
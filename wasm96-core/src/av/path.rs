@@ -0,0 +1,334 @@
+//! Vector paths: build a shape from lines and cubic curves, then fill or stroke it in one call.
+//!
+//! `path_begin` clears the path, `path_move_to` starts a subpath and `path_line_to` /
+//! `path_curve_to` extend it. Curves are flattened here, so a cart never sends the host more
+//! than its control points. A fill closes every subpath implicitly and covers pixels whose
+//! centers are inside the shape under the nonzero or even-odd rule, the same sampling
+//! `polygon` uses. The path stays until the next `path_begin`, so a shape can be filled and
+//! then outlined.
+
+use crate::state::{VectorPath, VideoState, global};
+
+use super::graphics::stroke_path;
+use super::utils::Canvas;
+
+/// Most points a path may hold; further points are dropped.
+pub const MAX_PATH_POINTS: usize = 65_536;
+
+/// Most line segments a single curve is flattened into.
+const MAX_CURVE_SEGMENTS: usize = 256;
+
+/// Target length, in pixels, of the segments a curve is flattened into.
+const CURVE_TOLERANCE: f32 = 3.0;
+
+impl VectorPath {
+    /// The point the next segment starts from.
+    fn current(&self) -> Option<(f32, f32)> {
+        self.subpaths
+            .last()
+            .and_then(|(points, _)| points.last().copied())
+    }
+
+    fn push(&mut self, x: f32, y: f32) {
+        if self.len >= MAX_PATH_POINTS {
+            return;
+        }
+        match self.subpaths.last_mut() {
+            Some((points, false)) => points.push((x, y)),
+            _ => self.subpaths.push((vec![(x, y)], false)),
+        }
+        self.len += 1;
+    }
+
+    /// Start a new subpath at (x, y).
+    pub fn move_to(&mut self, x: f32, y: f32) {
+        if self.len >= MAX_PATH_POINTS {
+            return;
+        }
+        // A subpath that never got past its first point draws nothing; reuse it.
+        if let Some((points, false)) = self.subpaths.last_mut()
+            && points.len() == 1
+        {
+            points[0] = (x, y);
+            return;
+        }
+        self.subpaths.push((vec![(x, y)], false));
+        self.len += 1;
+    }
+
+    /// Add a straight segment to (x, y). Without a current point this starts a subpath there.
+    pub fn line_to(&mut self, x: f32, y: f32) {
+        self.push(x, y);
+    }
+
+    /// Add a cubic Bézier segment with control points c1 and c2, ending at `to`.
+    pub fn curve_to(&mut self, c1: (f32, f32), c2: (f32, f32), to: (f32, f32)) {
+        let Some(from) = self.current() else {
+            self.move_to(c1.0, c1.1);
+            return self.curve_to(c1, c2, to);
+        };
+        let dist = |a: (f32, f32), b: (f32, f32)| (b.0 - a.0).hypot(b.1 - a.1);
+        let hull = dist(from, c1) + dist(c1, c2) + dist(c2, to);
+        let segments = ((hull / CURVE_TOLERANCE).ceil() as usize).clamp(1, MAX_CURVE_SEGMENTS);
+        for i in 1..=segments {
+            let t = i as f32 / segments as f32;
+            let u = 1.0 - t;
+            let (a, b, c, d) = (u * u * u, 3.0 * u * u * t, 3.0 * u * t * t, t * t * t);
+            self.push(
+                a * from.0 + b * c1.0 + c * c2.0 + d * to.0,
+                a * from.1 + b * c1.1 + c * c2.1 + d * to.1,
+            );
+        }
+    }
+
+    /// Close the current subpath. The next segment starts a new subpath at its first point.
+    pub fn close(&mut self) {
+        let Some((points, closed)) = self.subpaths.last_mut() else {
+            return;
+        };
+        if *closed {
+            return;
+        }
+        *closed = true;
+        let start = points[0];
+        self.move_to(start.0, start.1);
+    }
+}
+
+/// Fill `path` into the framebuffer with the current draw color.
+pub fn fill(video: &mut VideoState, path: &VectorPath, even_odd: bool) {
+    let w = video.width as i32;
+    let h = video.height as i32;
+    if w <= 0 || h <= 0 {
+        return;
+    }
+
+    // Every subpath is closed for filling. Edges keep their direction for the nonzero rule.
+    let mut edges: Vec<((f32, f32), (f32, f32), i32)> = Vec::with_capacity(path.len);
+    for (points, _) in &path.subpaths {
+        if points.len() < 3 {
+            continue;
+        }
+        for (i, &a) in points.iter().enumerate() {
+            let b = points[(i + 1) % points.len()];
+            if a.1 != b.1 {
+                edges.push((a, b, if a.1 < b.1 { 1 } else { -1 }));
+            }
+        }
+    }
+    if edges.is_empty() {
+        return;
+    }
+
+    let ys = edges.iter().flat_map(|(a, b, _)| [a.1, b.1]);
+    let min_y = ys.clone().fold(f32::INFINITY, f32::min).floor().max(0.0) as i32;
+    let max_y = (ys.fold(f32::NEG_INFINITY, f32::max).ceil() as i32).min(h - 1);
+
+    let color = video.draw_color;
+    let mut fb = Canvas::of(video);
+    let mut crossings: Vec<(f32, i32)> = Vec::with_capacity(edges.len());
+    for y in min_y..=max_y {
+        let sample_y = y as f32 + 0.5;
+        crossings.clear();
+        for &(a, b, dir) in &edges {
+            let (lo, hi) = if a.1 < b.1 { (a.1, b.1) } else { (b.1, a.1) };
+            // Half-open span so a vertex shared by two edges is counted once.
+            if sample_y < lo || sample_y >= hi {
+                continue;
+            }
+            let t = (sample_y - a.1) / (b.1 - a.1);
+            crossings.push((a.0 + t * (b.0 - a.0), dir));
+        }
+        crossings.sort_by(|a, b| a.0.total_cmp(&b.0));
+
+        let row = (y as usize) * (w as usize);
+        let mut span_fill = |from: f32, to: f32| {
+            // Pixel x is covered when its center x + 0.5 lies in [from, to).
+            let x_start = ((from - 0.5).ceil() as i32).max(0);
+            let x_end = ((to - 0.5).ceil() as i32).min(w);
+            if x_start < x_end {
+                fb.fill(row + x_start as usize..row + x_end as usize, color);
+            }
+        };
+        if even_odd {
+            for span in crossings.chunks_exact(2) {
+                span_fill(span[0].0, span[1].0);
+            }
+        } else {
+            let mut winding = 0;
+            let mut start = 0.0;
+            for &(x, dir) in &crossings {
+                if winding == 0 {
+                    start = x;
+                }
+                winding += dir;
+                if winding == 0 {
+                    span_fill(start, x);
+                }
+            }
+        }
+    }
+}
+
+/// Stroke every subpath of `path` with the current line width and style.
+pub fn stroke(video: &mut VideoState, path: &VectorPath) {
+    let mut points = Vec::new();
+    for (subpath, closed) in &path.subpaths {
+        // A lone point is a `move_to` nothing followed.
+        if subpath.len() < 2 {
+            continue;
+        }
+        points.clear();
+        points.extend(
+            subpath
+                .iter()
+                .map(|&(x, y)| (x.round() as i32, y.round() as i32)),
+        );
+        points.dedup();
+        stroke_path(video, &points, *closed);
+    }
+}
+
+/// Run `f` on the path, with a mapping from guest coordinates into the draw target (the same
+/// offset `camera_point` applies).
+fn with_path(f: impl FnOnce(&mut VectorPath, &dyn Fn(f32, f32) -> (f32, f32))) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let origin = s
+        .video
+        .camera
+        .pass
+        .as_ref()
+        .map_or((0, 0), |pass| pass.origin);
+    let at = move |x: f32, y: f32| (x - origin.0 as f32, y - origin.1 as f32);
+    f(&mut s.video.path, &at);
+}
+
+/// Clear the path.
+pub fn graphics_path_begin() {
+    with_path(|path, _| *path = VectorPath::default());
+}
+
+/// Start a subpath at (x, y).
+pub fn graphics_path_move_to(x: f32, y: f32) {
+    with_path(|path, at| {
+        let (x, y) = at(x, y);
+        path.move_to(x, y);
+    });
+}
+
+/// Add a straight segment to (x, y).
+pub fn graphics_path_line_to(x: f32, y: f32) {
+    with_path(|path, at| {
+        let (x, y) = at(x, y);
+        path.line_to(x, y);
+    });
+}
+
+/// Add a cubic Bézier segment through control points (cx1, cy1) and (cx2, cy2) to (x, y).
+pub fn graphics_path_curve_to(cx1: f32, cy1: f32, cx2: f32, cy2: f32, x: f32, y: f32) {
+    with_path(|path, at| path.curve_to(at(cx1, cy1), at(cx2, cy2), at(x, y)));
+}
+
+/// Close the current subpath.
+pub fn graphics_path_close() {
+    with_path(|path, _| path.close());
+}
+
+/// Fill the path. `even_odd` nonzero uses the even-odd rule, otherwise nonzero winding.
+pub fn graphics_path_fill(even_odd: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let path = std::mem::take(&mut s.video.path);
+    fill(&mut s.video, &path, even_odd != 0);
+    s.video.path = path;
+}
+
+/// Outline the path with the current line width and style.
+pub fn graphics_path_stroke() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let path = std::mem::take(&mut s.video.path);
+    stroke(&mut s.video, &path);
+    s.video.path = path;
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn square(path: &mut VectorPath, x: f32, y: f32, size: f32, clockwise: bool) {
+        path.move_to(x, y);
+        if clockwise {
+            path.line_to(x + size, y);
+            path.line_to(x + size, y + size);
+            path.line_to(x, y + size);
+        } else {
+            path.line_to(x, y + size);
+            path.line_to(x + size, y + size);
+            path.line_to(x + size, y);
+        }
+        path.close();
+    }
+
+    fn video(size: u32) -> VideoState {
+        let mut video = VideoState {
+            width: size,
+            height: size,
+            draw_color: 0xFFFF_FFFF,
+            ..VideoState::default()
+        };
+        video.framebuffer = vec![0; (size * size) as usize];
+        video
+    }
+
+    #[test]
+    fn fill_rules_decide_whether_nested_shapes_leave_holes() {
+        let mut path = VectorPath::default();
+        square(&mut path, 0.0, 0.0, 10.0, true);
+        square(&mut path, 3.0, 3.0, 4.0, true);
+
+        let mut v = video(10);
+        fill(&mut v, &path, true);
+        assert_eq!(v.framebuffer.iter().filter(|&&c| c != 0).count(), 100 - 16);
+        assert_eq!(v.framebuffer[5 * 10 + 5], 0);
+
+        let mut v = video(10);
+        fill(&mut v, &path, false);
+        assert_eq!(v.framebuffer.iter().filter(|&&c| c != 0).count(), 100);
+
+        // Winding the inner square the other way cuts a hole under both rules.
+        let mut path = VectorPath::default();
+        square(&mut path, 0.0, 0.0, 10.0, true);
+        square(&mut path, 3.0, 3.0, 4.0, false);
+        let mut v = video(10);
+        fill(&mut v, &path, false);
+        assert_eq!(v.framebuffer.iter().filter(|&&c| c != 0).count(), 100 - 16);
+    }
+
+    #[test]
+    fn curves_flatten_onto_their_end_points() {
+        let mut path = VectorPath::default();
+        path.move_to(0.0, 0.0);
+        path.curve_to((0.0, 30.0), (30.0, 30.0), (30.0, 0.0));
+        let (points, closed) = &path.subpaths[0];
+        assert!(!closed);
+        assert!(points.len() > 10);
+        assert_eq!(*points.last().unwrap(), (30.0, 0.0));
+        // The curve bulges towards its control points but stays inside their hull.
+        assert!(points.iter().all(|p| p.1 >= 0.0 && p.1 <= 30.0));
+        assert!(points.iter().any(|p| p.1 > 20.0));
+        assert_eq!(path.len, points.len());
+
+        path.close();
+        path.line_to(0.0, 10.0);
+        assert_eq!(path.subpaths.len(), 2);
+        assert_eq!(path.subpaths[1].0, [(0.0, 0.0), (0.0, 10.0)]);
+    }
+}
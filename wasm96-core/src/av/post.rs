@@ -0,0 +1,272 @@
+//! Post-processing filters applied to the composed 2D frame just before it is presented.
+//!
+//! The guest's framebuffer is never modified: `video_present_host` filters a copy, so reads with
+//! `framebuffer_read` and the next frame's drawing see the unfiltered pixels. Frames composed
+//! with 3D are presented through GL and are not filtered.
+//!
+//! A color grade (a remap table or a 3D LUT uploaded by the guest) runs after the post effect,
+//! so tinting the whole frame for night or a damage flash needs no change to any draw call.
+
+use super::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::{ColorGrade, PostEffect, global};
+use wasmtime::Caller;
+
+/// Largest 3D LUT edge `color_grade_set` accepts.
+pub const MAX_LUT_SIZE: usize = 64;
+
+/// Select the post effect and its strength (clamped to 0..=1; 0 disables it).
+pub fn graphics_set_post_effect(effect: u32, strength: f32) {
+    let mut s = global().lock().unwrap();
+    s.video.post_effect = PostEffect::from_u32(effect);
+    s.video.post_strength = if strength.is_nan() {
+        0.0
+    } else {
+        strength.clamp(0.0, 1.0)
+    };
+}
+
+/// Return `fb` (XRGB8888, `width`x`height`) with `effect` applied at `strength` (0..=1).
+pub fn post_process(
+    effect: PostEffect,
+    strength: f32,
+    fb: &[u32],
+    width: u32,
+    height: u32,
+) -> Vec<u32> {
+    let (w, h) = (width as usize, height as usize);
+    if strength <= 0.0 || fb.len() < w * h {
+        return fb.to_vec();
+    }
+    match effect {
+        PostEffect::None => fb.to_vec(),
+        PostEffect::Scanlines => scanlines(fb, w, 1.0 - strength),
+        PostEffect::Crt => {
+            let curved = curvature(fb, w, h, 0.2 * strength);
+            scanlines(&curved, w, 1.0 - 0.4 * strength)
+        }
+        PostEffect::Bloom => bloom(fb, w, h, strength),
+        PostEffect::Grayscale => fb.iter().map(|&p| grayscale(p, strength)).collect(),
+        PostEffect::Dither => dither(fb, w, strength),
+    }
+}
+
+/// Set the color grade from `len` guest bytes at `ptr`; `len` 0 removes it. Returns 1 if the
+/// bytes were a grade (see [`parse_color_grade`]), 0 otherwise (the previous grade is kept).
+pub fn graphics_color_grade_set(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    let grade = if len == 0 {
+        None
+    } else {
+        if len as usize > MAX_LUT_SIZE.pow(3) * 3 {
+            return 0;
+        }
+        let Ok(bytes) = read_guest_bytes(env, ptr, len) else {
+            return 0;
+        };
+        match parse_color_grade(&bytes) {
+            Some(grade) => Some(grade),
+            None => return 0,
+        }
+    };
+    global().lock().unwrap().video.color_grade = grade;
+    1
+}
+
+/// Read a color grade by its length:
+/// - 256 bytes: one remap table used for red, green and blue;
+/// - 768 bytes: 256 RGB entries; a pixel's red value picks the red of its entry, and so on;
+/// - `size`^3 RGB triples (`size` 2..=64, red varying fastest): a 3D LUT.
+pub fn parse_color_grade(bytes: &[u8]) -> Option<ColorGrade> {
+    match bytes.len() {
+        256 => {
+            let mut table = [0; 256];
+            table.copy_from_slice(bytes);
+            Some(ColorGrade::Remap(Box::new([table; 3])))
+        }
+        768 => {
+            let mut tables = Box::new([[0; 256]; 3]);
+            for (v, rgb) in bytes.chunks_exact(3).enumerate() {
+                for (table, &c) in tables.iter_mut().zip(rgb) {
+                    table[v] = c;
+                }
+            }
+            Some(ColorGrade::Remap(tables))
+        }
+        len => {
+            let size = (2..=MAX_LUT_SIZE).find(|&n| n * n * n * 3 == len)?;
+            Some(ColorGrade::Lut {
+                size,
+                data: bytes.to_vec(),
+            })
+        }
+    }
+}
+
+/// Run every pixel of `fb` through `grade`.
+pub fn color_grade(grade: &ColorGrade, fb: Vec<u32>) -> Vec<u32> {
+    match grade {
+        ColorGrade::Remap(tables) => fb
+            .into_iter()
+            .map(|p| {
+                let c = |table: &[u8; 256], shift: u32| {
+                    (table[((p >> shift) & 0xFF) as usize] as u32) << shift
+                };
+                c(&tables[0], 16) | c(&tables[1], 8) | c(&tables[2], 0)
+            })
+            .collect(),
+        ColorGrade::Lut { size, data } => fb
+            .into_iter()
+            .map(|p| pack(sample_lut(*size, data, channels(p))))
+            .collect(),
+    }
+}
+
+/// Trilinear lookup of `rgb` (0..=255 per channel) in a `size`^3 LUT.
+fn sample_lut(size: usize, data: &[u8], rgb: [f32; 3]) -> [f32; 3] {
+    let max = (size - 1) as f32;
+    let mut base = [0; 3];
+    let mut frac = [0.0; 3];
+    for i in 0..3 {
+        let pos = rgb[i] / 255.0 * max;
+        base[i] = (pos.floor() as usize).min(size - 2);
+        frac[i] = pos - base[i] as f32;
+    }
+    let at = |r: usize, g: usize, b: usize| {
+        let i = ((b * size + g) * size + r) * 3;
+        [data[i] as f32, data[i + 1] as f32, data[i + 2] as f32]
+    };
+    let lerp = |a: [f32; 3], b: [f32; 3], t: f32| [0, 1, 2].map(|i| a[i] + (b[i] - a[i]) * t);
+    let [r, g, b] = base;
+    let plane = |b: usize| {
+        let low = lerp(at(r, g, b), at(r + 1, g, b), frac[0]);
+        let high = lerp(at(r, g + 1, b), at(r + 1, g + 1, b), frac[0]);
+        lerp(low, high, frac[1])
+    };
+    lerp(plane(b), plane(b + 1), frac[2])
+}
+
+fn channels(p: u32) -> [f32; 3] {
+    [
+        ((p >> 16) & 0xFF) as f32,
+        ((p >> 8) & 0xFF) as f32,
+        (p & 0xFF) as f32,
+    ]
+}
+
+fn pack([r, g, b]: [f32; 3]) -> u32 {
+    let c = |v: f32| v.round().clamp(0.0, 255.0) as u32;
+    (c(r) << 16) | (c(g) << 8) | c(b)
+}
+
+fn scale(p: u32, k: f32) -> u32 {
+    pack(channels(p).map(|c| c * k))
+}
+
+/// Darken every odd row to `keep` of its brightness.
+fn scanlines(fb: &[u32], w: usize, keep: f32) -> Vec<u32> {
+    fb.iter()
+        .enumerate()
+        .map(|(i, &p)| if (i / w) % 2 == 1 { scale(p, keep) } else { p })
+        .collect()
+}
+
+/// Barrel distortion: the image bulges toward the viewer like a tube screen, and the corners
+/// that fall outside the source turn black.
+fn curvature(fb: &[u32], w: usize, h: usize, amount: f32) -> Vec<u32> {
+    let mut out = vec![0; w * h];
+    for y in 0..h {
+        let ny = (y as f32 + 0.5) / h as f32 * 2.0 - 1.0;
+        for x in 0..w {
+            let nx = (x as f32 + 0.5) / w as f32 * 2.0 - 1.0;
+            let k = 1.0 + amount * (nx * nx + ny * ny);
+            let (sx, sy) = (nx * k, ny * k);
+            if sx.abs() > 1.0 || sy.abs() > 1.0 {
+                continue;
+            }
+            let px = (((sx + 1.0) * 0.5 * w as f32) as usize).min(w - 1);
+            let py = (((sy + 1.0) * 0.5 * h as f32) as usize).min(h - 1);
+            out[y * w + x] = fb[py * w + px];
+        }
+    }
+    out
+}
+
+fn luma([r, g, b]: [f32; 3]) -> f32 {
+    0.299 * r + 0.587 * g + 0.114 * b
+}
+
+fn grayscale(p: u32, strength: f32) -> u32 {
+    let c = channels(p);
+    let l = luma(c);
+    pack(c.map(|v| v + (l - v) * strength))
+}
+
+/// Add a blurred copy of the bright parts of the frame back on top of it.
+fn bloom(fb: &[u32], w: usize, h: usize, strength: f32) -> Vec<u32> {
+    const THRESHOLD: f32 = 160.0;
+    const RADIUS: isize = 3;
+
+    let bright: Vec<[f32; 3]> = fb
+        .iter()
+        .map(|&p| {
+            let c = channels(p);
+            if luma(c) > THRESHOLD { c } else { [0.0; 3] }
+        })
+        .collect();
+
+    // Separable box blur, clamping at the edges.
+    let blur = |src: &[[f32; 3]], horizontal: bool| -> Vec<[f32; 3]> {
+        let mut out = vec![[0.0; 3]; w * h];
+        let taps = (2 * RADIUS + 1) as f32;
+        for y in 0..h {
+            for x in 0..w {
+                let mut sum = [0.0; 3];
+                for d in -RADIUS..=RADIUS {
+                    let (sx, sy) = if horizontal {
+                        ((x as isize + d).clamp(0, w as isize - 1) as usize, y)
+                    } else {
+                        (x, (y as isize + d).clamp(0, h as isize - 1) as usize)
+                    };
+                    for (s, v) in sum.iter_mut().zip(src[sy * w + sx]) {
+                        *s += v;
+                    }
+                }
+                out[y * w + x] = sum.map(|v| v / taps);
+            }
+        }
+        out
+    };
+    let glow = blur(&blur(&bright, true), false);
+
+    fb.iter()
+        .zip(glow)
+        .map(|(&p, g)| {
+            let c = channels(p);
+            pack([0, 1, 2].map(|i| c[i] + g[i] * strength))
+        })
+        .collect()
+}
+
+/// 4x4 ordered (Bayer) dither down to fewer levels per channel: 256 at strength 0, 4 at 1.
+fn dither(fb: &[u32], w: usize, strength: f32) -> Vec<u32> {
+    const BAYER: [[f32; 4]; 4] = [
+        [0.0, 8.0, 2.0, 10.0],
+        [12.0, 4.0, 14.0, 6.0],
+        [3.0, 11.0, 1.0, 9.0],
+        [15.0, 7.0, 13.0, 5.0],
+    ];
+    let bits = 8 - (strength * 6.0).round() as u32;
+    if bits >= 8 {
+        return fb.to_vec();
+    }
+    let levels = ((1u32 << bits) - 1) as f32;
+    let step = 255.0 / levels;
+
+    fb.iter()
+        .enumerate()
+        .map(|(i, &p)| {
+            let threshold = (BAYER[(i / w) % 4][(i % w) % 4] + 0.5) / 16.0 - 0.5;
+            pack(channels(p).map(|v| ((v / step + threshold).round().clamp(0.0, levels)) * step))
+        })
+        .collect()
+}
@@ -28,6 +28,8 @@ lazy_static::lazy_static! {
 pub struct Resources {
     // ID-based resources (existing APIs in this module).
     pub svgs: HashMap<u32, Tree>,
+    // SVG markup by id, kept so elements can be recolored and the tree rebuilt.
+    pub svg_sources: HashMap<u32, String>,
     pub gifs: HashMap<u32, GifResource>,
     pub fonts: HashMap<u32, FontResource>,
 
@@ -39,8 +41,60 @@ pub struct Resources {
     pub keyed_images: HashMap<u64, ImageResource>,
 
     pub keyed_fonts: HashMap<u64, u32>,
+    // Font key -> fallback font keys, tried in order for missing glyphs.
+    pub font_fallbacks: HashMap<u64, Vec<u64>>,
+
+    // Palette-index images, colored at draw time (see `palette`).
+    pub keyed_indexed: HashMap<u64, IndexedImage>,
+
+    // Aseprite sprites with their tags and layers (see `aseprite`).
+    pub keyed_aseprites: HashMap<u64, super::aseprite::Aseprite>,
+
+    // Tile maps loaded from Tiled/LDtk files (see `tilemap`).
+    pub keyed_maps: HashMap<u64, super::tilemap::TileMap>,
 
     pub next_id: u32,
+
+    // Why the most recent failed registration failed (see `graphics_last_error`).
+    pub last_error: ResourceError,
+}
+
+/// Why a resource registration failed, as reported to guests by `graphics_last_error`.
+#[repr(u32)]
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq)]
+pub enum ResourceError {
+    #[default]
+    None = 0,
+    /// The data pointer/length is outside guest memory.
+    Memory = 1,
+    /// The data doesn't decode as the expected format.
+    Invalid = 2,
+    /// A resource the registration depends on isn't registered.
+    Missing = 3,
+    /// The request is well formed but not supported (e.g. an unknown built-in font size).
+    Unsupported = 4,
+}
+
+/// Record `err` as the last registration error and return the import's failure value, 0.
+pub fn registration_failed(err: ResourceError) -> u32 {
+    RESOURCES.lock().unwrap().last_error = err;
+    0
+}
+
+/// Error code of the most recent failed resource registration (0 if none has failed).
+pub fn graphics_last_error() -> u32 {
+    RESOURCES.lock().unwrap().last_error as u32
+}
+
+/// Registered (images, fonts). SVGs, GIFs, palette images and Aseprite sprites count as images.
+pub fn resource_counts() -> (usize, usize) {
+    let res = RESOURCES.lock().unwrap();
+    let images = res.keyed_images.len()
+        + res.keyed_indexed.len()
+        + res.keyed_svgs.len()
+        + res.keyed_gifs.len()
+        + res.keyed_aseprites.len();
+    (images, res.keyed_fonts.len())
 }
 
 pub struct GifResource {
@@ -48,6 +102,47 @@ pub struct GifResource {
     pub delays: Vec<u16>,     // in 10ms units
     pub width: u16,
     pub height: u16,
+    pub playback: GifPlayback,
+}
+
+/// Where a GIF is in its (looping) animation: the host clock, scaled by `speed`, unless paused.
+#[derive(Clone, Copy, Debug, PartialEq)]
+pub struct GifPlayback {
+    /// Playback position in milliseconds at host time `anchor_millis`.
+    pub position_millis: f64,
+    pub anchor_millis: u64,
+    pub speed: f32,
+    pub paused: bool,
+}
+
+impl GifPlayback {
+    /// Playback position in milliseconds at host time `now`.
+    pub fn position_at(&self, now: u64) -> u64 {
+        if self.paused {
+            return self.position_millis as u64;
+        }
+        let elapsed = now.saturating_sub(self.anchor_millis) as f64;
+        (self.position_millis + elapsed * self.speed as f64) as u64
+    }
+
+    /// Restart the clock from the current position, so a speed or pause change applies from
+    /// `now` on.
+    pub fn rebase(&mut self, now: u64) {
+        self.position_millis = self.position_at(now) as f64;
+        self.anchor_millis = now;
+    }
+}
+
+impl Default for GifPlayback {
+    /// Plays in step with the host clock, as GIFs always have.
+    fn default() -> Self {
+        Self {
+            position_millis: 0.0,
+            anchor_millis: 0,
+            speed: 1.0,
+            paused: false,
+        }
+    }
 }
 
 #[derive(Clone)]
@@ -57,13 +152,41 @@ pub struct ImageResource {
     pub height: u32,
 }
 
+pub struct IndexedImage {
+    pub indices: Vec<u8>, // one palette index per pixel
+    pub width: u32,
+    pub height: u32,
+}
+
 pub enum FontResource {
     Ttf(Font),
+    /// TTF/OTF drawn through signed distance fields (see `sdf`).
+    Sdf(super::sdf::SdfFont),
     Bdf {
         width: u32,
         height: u32,
+        descent: u32,                   // rows of the cell below the baseline
         glyphs: HashMap<char, Vec<u8>>, // char -> bitmap rows
     },
+    /// AngelCode BMFont: glyph cells cut from an atlas image (page 0).
+    Fnt {
+        line_height: u32,
+        base: u32, // baseline, in pixels from the top of the line
+        glyphs: HashMap<char, FntGlyph>,
+        atlas: ImageResource,
+    },
+}
+
+/// One BMFont glyph: its cell in the atlas and its placement relative to the pen.
+#[derive(Clone, Copy, Debug, PartialEq)]
+pub struct FntGlyph {
+    pub x: i32,
+    pub y: i32,
+    pub width: u32,
+    pub height: u32,
+    pub xoffset: i32,
+    pub yoffset: i32,
+    pub xadvance: i32,
 }
 
 /// Errors from AV operations.
@@ -71,4 +194,5 @@ pub enum FontResource {
 pub enum AvError {
     MissingMemory,
     MemoryReadFailed,
+    MemoryWriteFailed,
 }
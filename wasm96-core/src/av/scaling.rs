@@ -0,0 +1,325 @@
+//! Fitting the framebuffer to the window.
+//!
+//! libretro doesn't tell cores how big the window is, so the window size is the
+//! `wasm96_window_size` core option. At `native` (the default) the framebuffer is presented as-is
+//! and the frontend scales it with its own settings. Any fixed size makes the host scale each
+//! frame into one that big using the guest's `ScalingMode`: nearest-neighbor sampling, with black
+//! bars around the picture. Pointer positions are mapped back through the same viewport. Frames
+//! composed with 3D are presented through GL at the framebuffer size.
+//!
+//! libretro can't switch the frontend between windowed and fullscreen either. A cart asking for
+//! fullscreen gets the full display size (`MAX_WIDTH`x`MAX_HEIGHT`) as its window instead, which
+//! a fullscreen frontend shows without scaling again.
+//!
+//! The framebuffer may be resized at any time. `update` sees `graphics_resized` return 1 on the
+//! first tick after the framebuffer or window changed size.
+
+use std::sync::Mutex;
+
+use crate::state::{ScalingMode, VideoState, global};
+
+/// Core option holding the window size.
+pub const WINDOW_OPTION_KEY: &str = "wasm96_window_size";
+/// Description and values of the window size option, as `RETRO_ENVIRONMENT_SET_VARIABLES`
+/// expects them (the first value is the default).
+pub const WINDOW_OPTION_VALUES: &str = "Window size; native|640x480|960x720|1280x720|1920x1080";
+
+/// Largest frame the core reports to the frontend (matches `retro_get_system_av_info`).
+pub const MAX_WIDTH: u32 = 1920;
+pub const MAX_HEIGHT: u32 = 1080;
+
+struct Presenter {
+    /// Fixed window size from the core option; `None` at `native`.
+    window: Option<(u32, u32)>,
+    /// The option changed since the last tick.
+    window_changed: bool,
+    /// Size of the last presented frame.
+    presented: (u32, u32),
+    /// Frame size last reported to the frontend.
+    reported: (u32, u32),
+}
+
+static PRESENTER: Mutex<Presenter> = Mutex::new(Presenter {
+    window: None,
+    window_changed: false,
+    presented: (0, 0),
+    reported: (0, 0),
+});
+
+fn presenter() -> std::sync::MutexGuard<'static, Presenter> {
+    match PRESENTER.lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    }
+}
+
+/// Apply the window size option's value (`native` or `WIDTHxHEIGHT`). Unknown values mean native.
+pub fn set_window_option(value: &str) {
+    let window = parse_window_size(value);
+    let mut p = presenter();
+    if p.window != window {
+        p.window = window;
+        p.window_changed = true;
+    }
+}
+
+fn parse_window_size(value: &str) -> Option<(u32, u32)> {
+    let (w, h) = value.trim().split_once('x')?;
+    let (w, h) = (w.parse::<u32>().ok()?, h.parse::<u32>().ok()?);
+    (w > 0 && h > 0 && w <= MAX_WIDTH && h <= MAX_HEIGHT).then_some((w, h))
+}
+
+/// Where the framebuffer lands inside the presented frame.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Viewport {
+    /// Size of the presented frame.
+    pub window: (u32, u32),
+    pub x: u32,
+    pub y: u32,
+    pub width: u32,
+    pub height: u32,
+}
+
+impl Viewport {
+    /// Lay out a `fb_width`x`fb_height` framebuffer in `window` with `mode`.
+    pub fn new(mode: ScalingMode, fb_width: u32, fb_height: u32, window: (u32, u32)) -> Self {
+        let (ww, wh) = window;
+        let (fw, fh) = (fb_width.max(1), fb_height.max(1));
+        let (width, height) = match mode {
+            ScalingMode::Stretch => (ww, wh),
+            ScalingMode::Integer if ww >= fw && wh >= fh => {
+                let scale = (ww / fw).min(wh / fh);
+                (fw * scale, fh * scale)
+            }
+            // Integer scaling falls back to fitting when the framebuffer is bigger than the window.
+            ScalingMode::Fit | ScalingMode::Integer => {
+                let scale = (ww as f64 / fw as f64).min(wh as f64 / fh as f64);
+                (
+                    ((fw as f64 * scale).round() as u32).clamp(1, ww.max(1)),
+                    ((fh as f64 * scale).round() as u32).clamp(1, wh.max(1)),
+                )
+            }
+        };
+        Viewport {
+            window,
+            x: (ww - width.min(ww)) / 2,
+            y: (wh - height.min(wh)) / 2,
+            width,
+            height,
+        }
+    }
+
+    /// Map a pixel of the presented frame to the framebuffer pixel drawn there. Points on the
+    /// bars clamp to the nearest edge.
+    pub fn to_screen(&self, wx: i32, wy: i32, fb_width: u32, fb_height: u32) -> (i32, i32) {
+        let axis = |v: i32, start: u32, len: u32, size: u32| {
+            let size = size.max(1) as i64;
+            let offset = v as i64 - start as i64;
+            (offset * size / len.max(1) as i64).clamp(0, size - 1) as i32
+        };
+        (
+            axis(wx, self.x, self.width, fb_width),
+            axis(wy, self.y, self.height, fb_height),
+        )
+    }
+}
+
+/// The window frames are fitted to: the full display when fullscreen, the core option otherwise
+/// (`None` at `native`).
+fn window(video: &VideoState) -> Option<(u32, u32)> {
+    if video.fullscreen {
+        Some((MAX_WIDTH, MAX_HEIGHT))
+    } else {
+        presenter().window
+    }
+}
+
+/// Viewport for the current framebuffer, scaling mode and window. At `native` it covers the
+/// whole frame.
+pub fn current_viewport(video: &VideoState) -> Viewport {
+    let window = window(video).unwrap_or((video.width, video.height));
+    Viewport::new(video.scaling, video.width, video.height, window)
+}
+
+/// Scale `fb` into `view`'s window, with black bars outside the picture.
+pub fn scale_frame(fb: &[u32], fb_width: u32, fb_height: u32, view: &Viewport) -> Vec<u32> {
+    let (ww, wh) = (view.window.0 as usize, view.window.1 as usize);
+    let (fw, fh) = (fb_width as usize, fb_height as usize);
+    let mut out = vec![0u32; ww * wh];
+    if fw == 0 || fh == 0 || fb.len() < fw * fh {
+        return out;
+    }
+    let (vw, vh) = (view.width as usize, view.height as usize);
+    let columns: Vec<usize> = (0..vw).map(|x| (x * fw / vw).min(fw - 1)).collect();
+    for row in 0..vh {
+        let y = view.y as usize + row;
+        if y >= wh {
+            break;
+        }
+        let src = &fb[(row * fh / vh).min(fh - 1) * fw..][..fw];
+        let dst = &mut out[y * ww + view.x as usize..][..vw.min(ww - view.x as usize)];
+        for (d, &sx) in dst.iter_mut().zip(&columns) {
+            *d = src[sx];
+        }
+    }
+    out
+}
+
+/// Fit a composed frame (`video`'s size) to the window. Returns the frame to present and its
+/// size.
+pub fn fit_to_window(video: &VideoState, fb: Vec<u32>) -> (Vec<u32>, u32, u32) {
+    let (width, height) = (video.width, video.height);
+    let (frame, size) = match window(video) {
+        Some(window) if window != (width, height) => {
+            let view = Viewport::new(video.scaling, width, height, window);
+            (scale_frame(&fb, width, height, &view), window)
+        }
+        _ => (fb, (width, height)),
+    };
+    note_presented(size.0, size.1);
+    (frame, size.0, size.1)
+}
+
+/// Record the size of a frame handed to the frontend.
+pub fn note_presented(width: u32, height: u32) {
+    presenter().presented = (width, height);
+}
+
+/// Size of the presented frame whenever it differs from what the frontend was last told, so the
+/// caller can send `RETRO_ENVIRONMENT_SET_GEOMETRY`.
+pub fn take_geometry_change() -> Option<(u32, u32)> {
+    let mut p = presenter();
+    if p.presented == (0, 0) || p.presented == p.reported {
+        return None;
+    }
+    p.reported = p.presented;
+    Some(p.presented)
+}
+
+/// Latch the resize flag for the tick about to run.
+pub fn begin_tick() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let window_changed = std::mem::take(&mut presenter().window_changed);
+    s.video.resized = std::mem::take(&mut s.video.resize_pending) || window_changed;
+}
+
+/// Whether the framebuffer or window changed size before this tick. Returns 1 or 0.
+pub fn graphics_resized() -> u32 {
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.video.resized as u32
+}
+
+/// Ask for the full display size as the window (see the module docs).
+pub fn graphics_set_fullscreen(enabled: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let enabled = enabled != 0;
+    if s.video.fullscreen != enabled {
+        s.video.fullscreen = enabled;
+        s.video.resize_pending = true;
+    }
+}
+
+/// Whether the cart asked for fullscreen. Returns 1 or 0.
+pub fn graphics_fullscreen() -> u32 {
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.video.fullscreen as u32
+}
+
+/// Choose how the framebuffer is fitted to the window: 0 fit, 1 integer scale, 2 stretch.
+pub fn graphics_set_scaling_mode(mode: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.video.scaling = ScalingMode::from_u32(mode);
+}
+
+/// Window size packed as `(width << 32) | height`. At `native` this is the framebuffer size.
+pub fn graphics_window_size() -> u64 {
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let (w, h) = window(&s.video).unwrap_or((s.video.width, s.video.height));
+    ((w as u64) << 32) | h as u64
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn window_sizes_parse() {
+        assert_eq!(parse_window_size("1280x720"), Some((1280, 720)));
+        assert_eq!(parse_window_size("native"), None);
+        assert_eq!(parse_window_size("0x720"), None);
+        assert_eq!(parse_window_size("4000x3000"), None);
+    }
+
+    #[test]
+    fn viewports_follow_the_mode() {
+        let fit = Viewport::new(ScalingMode::Fit, 320, 240, (1280, 720));
+        assert_eq!((fit.x, fit.y, fit.width, fit.height), (160, 0, 960, 720));
+        let integer = Viewport::new(ScalingMode::Integer, 320, 240, (1280, 720));
+        assert_eq!(
+            (integer.x, integer.y, integer.width, integer.height),
+            (160, 0, 960, 720)
+        );
+        let integer = Viewport::new(ScalingMode::Integer, 320, 200, (1280, 720));
+        assert_eq!(
+            (integer.x, integer.y, integer.width, integer.height),
+            (160, 60, 960, 600)
+        );
+        let stretch = Viewport::new(ScalingMode::Stretch, 320, 240, (1280, 720));
+        assert_eq!(
+            (stretch.x, stretch.y, stretch.width, stretch.height),
+            (0, 0, 1280, 720)
+        );
+        // Too big to integer scale: fit instead.
+        let shrink = Viewport::new(ScalingMode::Integer, 640, 480, (320, 200));
+        assert_eq!((shrink.width, shrink.height), (267, 200));
+    }
+
+    #[test]
+    fn fullscreen_uses_the_display_size() {
+        let mut video = VideoState {
+            width: 320,
+            height: 240,
+            scaling: ScalingMode::Integer,
+            ..VideoState::default()
+        };
+        assert_eq!(current_viewport(&video).window, (320, 240));
+        video.fullscreen = true;
+        let view = current_viewport(&video);
+        assert_eq!(view.window, (MAX_WIDTH, MAX_HEIGHT));
+        assert_eq!(
+            (view.x, view.y, view.width, view.height),
+            (320, 60, 1280, 960)
+        );
+    }
+
+    #[test]
+    fn scaled_frames_are_letterboxed_and_map_pointers_back() {
+        let fb = [1, 2, 3, 4];
+        let view = Viewport::new(ScalingMode::Integer, 2, 2, (6, 4));
+        let out = scale_frame(&fb, 2, 2, &view);
+        assert_eq!(&out[0..6], &[0, 1, 1, 2, 2, 0]);
+        assert_eq!(&out[18..24], &[0, 3, 3, 4, 4, 0]);
+        assert_eq!(view.to_screen(1, 0, 2, 2), (0, 0));
+        assert_eq!(view.to_screen(4, 3, 2, 2), (1, 1));
+        assert_eq!(view.to_screen(0, 0, 2, 2), (0, 0));
+        assert_eq!(view.to_screen(5, 3, 2, 2), (1, 1));
+    }
+}
@@ -0,0 +1,465 @@
+//! Signed distance field (SDF) fonts: TTF/OTF text that stays sharp at any size and angle.
+//!
+//! Each glyph is rasterized once at [`SDF_BASE_PX`] and turned into a field holding, per texel,
+//! the distance to the glyph's edge (positive inside). Drawing samples that field through the
+//! text's scale and rotation, so edges are cut at the target resolution instead of being
+//! stretched. Outlines and shadows are the same field cut at a different distance. Glyphs are
+//! built the first time they're drawn and cached with the font.
+//!
+//! Style read by `wasm96_graphics_text_sdf_key` (little-endian, [`STYLE_SIZE`] bytes): outline
+//! width `f32`, outline color `u32`, shadow offset x `f32`, shadow offset y `f32`, shadow
+//! softness `f32`, shadow color `u32`. Lengths are screen pixels and colors 0xRRGGBBAA; a
+//! transparent color turns that effect off.
+
+use std::collections::HashMap;
+use std::sync::{Arc, Mutex};
+
+use fontdue::{Font, FontSettings};
+use wasmtime::Caller;
+
+use super::resources::{FontResource, RESOURCES, ResourceError, registration_failed};
+use super::utils::{Canvas, read_guest_bytes};
+use crate::runtime::GuestLimits;
+use crate::state::{VideoState, global};
+
+/// Pixel size glyphs are rasterized at before conversion.
+pub const SDF_BASE_PX: f32 = 48.0;
+
+/// Distance, in texels at `SDF_BASE_PX`, the field records on each side of an edge. Outlines
+/// and shadow blur are limited to this, scaled to the drawn size.
+pub const SDF_SPREAD: f32 = 8.0;
+
+/// Bytes in a packed text style.
+pub const STYLE_SIZE: usize = 24;
+
+/// A TTF/OTF font drawn through distance fields.
+pub struct SdfFont {
+    pub font: Font,
+    glyphs: Mutex<HashMap<char, Arc<SdfGlyph>>>,
+}
+
+/// One glyph's field and its placement relative to the pen on the baseline, at `SDF_BASE_PX`.
+#[derive(Debug, Clone, PartialEq)]
+pub struct SdfGlyph {
+    pub width: usize,
+    pub height: usize,
+    /// Field's left edge from the pen.
+    pub left: f32,
+    /// Field's top edge from the baseline (negative is above).
+    pub top: f32,
+    pub advance: f32,
+    /// `128` on the edge, `255` at `SDF_SPREAD` inside, `0` at `SDF_SPREAD` outside.
+    pub field: Vec<u8>,
+}
+
+impl SdfFont {
+    pub fn new(font: Font) -> Self {
+        Self {
+            font,
+            glyphs: Mutex::new(HashMap::new()),
+        }
+    }
+
+    /// The glyph for `ch`, building its field on first use.
+    fn glyph(&self, ch: char) -> Arc<SdfGlyph> {
+        let mut glyphs = match self.glyphs.lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        glyphs
+            .entry(ch)
+            .or_insert_with(|| {
+                let (metrics, coverage) = self.font.rasterize(ch, SDF_BASE_PX);
+                let pad = SDF_SPREAD as usize;
+                let (field, width, height) =
+                    distance_field(&coverage, metrics.width, metrics.height);
+                Arc::new(SdfGlyph {
+                    width,
+                    height,
+                    left: metrics.xmin as f32 - pad as f32,
+                    top: -(metrics.height as f32 + metrics.ymin as f32) - pad as f32,
+                    advance: metrics.advance_width,
+                    field,
+                })
+            })
+            .clone()
+    }
+}
+
+/// Turn an 8-bit coverage bitmap into a distance field padded by `SDF_SPREAD` on every side.
+/// Returns the field and its size; an empty bitmap gives an empty field.
+pub fn distance_field(coverage: &[u8], width: usize, height: usize) -> (Vec<u8>, usize, usize) {
+    if width == 0 || height == 0 || coverage.len() < width * height {
+        return (Vec::new(), 0, 0);
+    }
+    let pad = SDF_SPREAD as i32;
+    let (gw, gh) = (width as i32, height as i32);
+    let (w, h) = (gw + 2 * pad, gh + 2 * pad);
+    let cov = |x: i32, y: i32| {
+        let (gx, gy) = (x - pad, y - pad);
+        if gx >= 0 && gy >= 0 && gx < gw && gy < gh {
+            coverage[(gy * gw + gx) as usize]
+        } else {
+            0
+        }
+    };
+
+    let mut field = Vec::with_capacity((w * h) as usize);
+    for y in 0..h {
+        for x in 0..w {
+            let c = cov(x, y);
+            let inside = c >= 128;
+            // Nearest texel on the other side of the edge, by brute force over the spread.
+            let mut nearest = i32::MAX;
+            for dy in -pad..=pad {
+                for dx in -pad..=pad {
+                    if (cov(x + dx, y + dy) >= 128) != inside {
+                        nearest = nearest.min(dx * dx + dy * dy);
+                    }
+                }
+            }
+            let r = (nearest as f32).sqrt();
+            // Texels touching the edge know it more precisely from their coverage.
+            let d = if nearest <= 1 {
+                c as f32 / 255.0 - 0.5
+            } else if inside {
+                r - 0.5
+            } else {
+                0.5 - r
+            };
+            field.push((128.0 + d / SDF_SPREAD * 127.0).round().clamp(0.0, 255.0) as u8);
+        }
+    }
+    (field, w as usize, h as usize)
+}
+
+impl SdfGlyph {
+    /// Signed distance in base texels at (u, v), where texel i's center is at i. Outside the
+    /// field counts as far outside.
+    fn sample(&self, u: f32, v: f32) -> f32 {
+        let (x0, y0) = (u.floor(), v.floor());
+        let (fx, fy) = (u - x0, v - y0);
+        let (x0, y0) = (x0 as i32, y0 as i32);
+        let at = |x: i32, y: i32| {
+            if x >= 0 && y >= 0 && (x as usize) < self.width && (y as usize) < self.height {
+                self.field[y as usize * self.width + x as usize] as f32
+            } else {
+                0.0
+            }
+        };
+        let top = at(x0, y0) + (at(x0 + 1, y0) - at(x0, y0)) * fx;
+        let bottom = at(x0, y0 + 1) + (at(x0 + 1, y0 + 1) - at(x0, y0 + 1)) * fx;
+        let value = top + (bottom - top) * fy;
+        (value - 128.0) / 127.0 * SDF_SPREAD
+    }
+}
+
+/// Outline and drop shadow for one SDF text draw. Colors are 0xAARRGGBB.
+#[derive(Debug, Clone, Copy, Default, PartialEq)]
+pub struct TextStyle {
+    pub outline_width: f32,
+    pub outline_color: u32,
+    pub shadow_x: f32,
+    pub shadow_y: f32,
+    pub shadow_softness: f32,
+    pub shadow_color: u32,
+}
+
+/// Decode a packed style (see the module docs). `None` if `data` is too short.
+pub fn parse_style(data: &[u8]) -> Option<TextStyle> {
+    if data.len() < STYLE_SIZE {
+        return None;
+    }
+    let word = |i: usize| u32::from_le_bytes([data[i], data[i + 1], data[i + 2], data[i + 3]]);
+    let length = |i: usize| {
+        let v = f32::from_bits(word(i));
+        if v.is_finite() { v } else { 0.0 }
+    };
+    let color = |i: usize| {
+        let rgba = word(i);
+        (rgba << 24) | (rgba >> 8)
+    };
+    Some(TextStyle {
+        outline_width: length(0).max(0.0),
+        outline_color: color(4),
+        shadow_x: length(8),
+        shadow_y: length(12),
+        shadow_softness: length(16).max(0.0),
+        shadow_color: color(20),
+    })
+}
+
+/// `color`'s RGB blended over `bg` with coverage `a`, using the same gamma approximation as TTF
+/// text.
+fn blend(bg: u32, color: u32, a: f32) -> u32 {
+    let channel = |shift: u32| {
+        let fg = ((color >> shift) & 0xFF) as f32;
+        let bg = ((bg >> shift) & 0xFF) as f32;
+        ((fg * fg * a + bg * bg * (1.0 - a)).sqrt() as u32).min(255) << shift
+    };
+    let bg_alpha = (bg >> 24) as f32;
+    let alpha = (bg_alpha + (255.0 - bg_alpha) * a).round() as u32;
+    (alpha << 24) | channel(16) | channel(8) | channel(0)
+}
+
+/// Draw `text` with its top-left at (x, y), `size_px` tall and rotated `angle` radians clockwise
+/// around that corner. The fill uses the draw color's RGB; the shadow goes under the outline, which
+/// goes under the fill.
+#[allow(clippy::too_many_arguments)]
+pub fn draw(
+    video: &mut VideoState,
+    font: &SdfFont,
+    x: f32,
+    y: f32,
+    size_px: f32,
+    angle: f32,
+    text: &str,
+    style: &TextStyle,
+) {
+    let k = size_px / SDF_BASE_PX;
+    let (w, h) = (video.width as i32, video.height as i32);
+    if !(k > 0.0) || !k.is_finite() || w <= 0 || h <= 0 {
+        return;
+    }
+    let ascent = font
+        .font
+        .horizontal_line_metrics(SDF_BASE_PX)
+        .map_or(SDF_BASE_PX, |m| m.ascent);
+    let mut pen = 0.0;
+    let glyphs: Vec<(Arc<SdfGlyph>, f32)> = text
+        .chars()
+        .map(|ch| {
+            let glyph = font.glyph(ch);
+            let at = pen;
+            pen += glyph.advance;
+            (glyph, at)
+        })
+        .collect();
+
+    let (sin, cos) = if angle.is_finite() {
+        angle.sin_cos()
+    } else {
+        (0.0, 1.0)
+    };
+    let to_screen =
+        |lx: f32, ly: f32| (x + k * (lx * cos - ly * sin), y + k * (lx * sin + ly * cos));
+
+    // How far past the edge the field reaches once scaled.
+    let reach = (SDF_SPREAD * k - 1.0).max(0.0);
+    let outline = style.outline_width.min(reach);
+    let alpha = |color: u32| (color >> 24) as f32 / 255.0;
+
+    // (offset, distance the edge is pushed out, ramp width, color, opacity)
+    let mut passes = Vec::with_capacity(3);
+    if alpha(style.shadow_color) > 0.0 {
+        let softness = style.shadow_softness.min(2.0 * (reach - outline).max(0.0));
+        passes.push((
+            (style.shadow_x, style.shadow_y),
+            outline,
+            1.0 + softness,
+            style.shadow_color,
+        ));
+    }
+    if outline > 0.0 && alpha(style.outline_color) > 0.0 {
+        passes.push(((0.0, 0.0), outline, 1.0, style.outline_color));
+    }
+    // Like other text, the fill ignores the draw color's alpha.
+    passes.push(((0.0, 0.0), 0.0, 1.0, video.draw_color | 0xFF00_0000));
+
+    let mut fb = Canvas::of(video);
+    for ((ox, oy), edge, ramp, color) in passes {
+        let opacity = alpha(color);
+        for (glyph, at) in &glyphs {
+            if glyph.width == 0 {
+                continue;
+            }
+            let (gx0, gy0) = (at + glyph.left, ascent + glyph.top);
+            let (gx1, gy1) = (gx0 + glyph.width as f32, gy0 + glyph.height as f32);
+            let corners = [
+                to_screen(gx0, gy0),
+                to_screen(gx1, gy0),
+                to_screen(gx0, gy1),
+                to_screen(gx1, gy1),
+            ];
+            let min_x = corners.iter().map(|c| c.0).fold(f32::INFINITY, f32::min) + ox;
+            let max_x = corners
+                .iter()
+                .map(|c| c.0)
+                .fold(f32::NEG_INFINITY, f32::max)
+                + ox;
+            let min_y = corners.iter().map(|c| c.1).fold(f32::INFINITY, f32::min) + oy;
+            let max_y = corners
+                .iter()
+                .map(|c| c.1)
+                .fold(f32::NEG_INFINITY, f32::max)
+                + oy;
+            let (x0, x1) = ((min_x.floor() as i32).max(0), (max_x.ceil() as i32).min(w));
+            let (y0, y1) = ((min_y.floor() as i32).max(0), (max_y.ceil() as i32).min(h));
+
+            for py in y0..y1 {
+                for px in x0..x1 {
+                    let dx = (px as f32 + 0.5 - ox - x) / k;
+                    let dy = (py as f32 + 0.5 - oy - y) / k;
+                    let lx = dx * cos + dy * sin;
+                    let ly = -dx * sin + dy * cos;
+                    let d = glyph.sample(lx - gx0 - 0.5, ly - gy0 - 0.5) * k;
+                    let a = ((d + edge) / ramp + 0.5).clamp(0.0, 1.0) * opacity;
+                    if a > 0.0 {
+                        let i = (py * w + px) as usize;
+                        fb.blend(i, a, |bg, t| blend(bg, color, t));
+                    }
+                }
+            }
+        }
+    }
+}
+
+/// Register a TTF/OTF font under `key` to be drawn through distance fields. It works with every
+/// keyed text import, and `graphics_text_sdf_key` can also rotate it and add an outline and
+/// shadow. Returns `1` on success, `0` on failure.
+pub fn graphics_font_register_ttf_sdf(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    data_ptr: u32,
+    data_len: u32,
+) -> u32 {
+    let data = match read_guest_bytes(env, data_ptr, data_len) {
+        Ok(d) => d,
+        Err(_) => return registration_failed(ResourceError::Memory),
+    };
+    let font = match Font::from_bytes(data, FontSettings::default()) {
+        Ok(f) => f,
+        Err(_) => return registration_failed(ResourceError::Invalid),
+    };
+
+    let mut res = RESOURCES.lock().unwrap();
+    let id = res.next_id;
+    res.next_id += 1;
+    res.fonts.insert(id, FontResource::Sdf(SdfFont::new(font)));
+    res.keyed_fonts.insert(key, id);
+    1
+}
+
+/// Draw UTF-8 text with a keyed SDF font (see `graphics_font_register_ttf_sdf`): top-left at
+/// (x, y) in world coordinates, `size_px` tall (`0` = 16), rotated `angle` radians clockwise
+/// around the top-left, with the style at `style_ptr` (`0` = no outline or shadow). The text
+/// scale applies. Keys that aren't SDF fonts draw nothing.
+#[allow(clippy::too_many_arguments)]
+pub fn graphics_text_sdf_key(
+    env: &mut Caller<'_, GuestLimits>,
+    x: f32,
+    y: f32,
+    font_key: u64,
+    size_px: f32,
+    angle: f32,
+    text_ptr: u32,
+    text_len: u32,
+    style_ptr: u32,
+) {
+    let style = if style_ptr == 0 {
+        TextStyle::default()
+    } else {
+        match read_guest_bytes(env, style_ptr, STYLE_SIZE as u32) {
+            Ok(data) => parse_style(&data).unwrap_or_default(),
+            Err(_) => return,
+        }
+    };
+    let Ok(bytes) = read_guest_bytes(env, text_ptr, text_len) else {
+        return;
+    };
+    let Ok(text) = std::str::from_utf8(&bytes) else {
+        return;
+    };
+
+    let res = RESOURCES.lock().unwrap();
+    let Some(FontResource::Sdf(font)) = res
+        .keyed_fonts
+        .get(&font_key)
+        .and_then(|id| res.fonts.get(id))
+    else {
+        return;
+    };
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let origin = s
+        .video
+        .camera
+        .pass
+        .as_ref()
+        .map_or((0, 0), |pass| pass.origin);
+    let size_px = if size_px > 0.0 {
+        size_px
+    } else {
+        super::graphics::TTF_DEFAULT_PX
+    } * s.video.text_scale;
+    draw(
+        &mut s.video,
+        font,
+        x - origin.0 as f32,
+        y - origin.1 as f32,
+        size_px,
+        angle,
+        text,
+        &style,
+    );
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn field_is_signed_around_the_edge() {
+        // An 8x8 block inside a 12x12 bitmap.
+        let mut coverage = vec![0u8; 12 * 12];
+        for y in 2..10 {
+            for x in 2..10 {
+                coverage[y * 12 + x] = 255;
+            }
+        }
+        let (field, w, h) = distance_field(&coverage, 12, 12);
+        let pad = SDF_SPREAD as usize;
+        assert_eq!((w, h), (12 + 2 * pad, 12 + 2 * pad));
+        let at = |x: usize, y: usize| field[(y + pad) * w + x + pad];
+        // Deep inside is above the edge value, far outside below, and the padding is empty.
+        assert!(at(6, 6) > 180);
+        assert!(at(2, 6) >= 128);
+        assert!(at(1, 6) < 128);
+        assert_eq!(field[0], 0);
+
+        let glyph = SdfGlyph {
+            width: w,
+            height: h,
+            left: 0.0,
+            top: 0.0,
+            advance: 0.0,
+            field,
+        };
+        // The edge sits between texels 1 and 2 of the bitmap.
+        let edge = glyph.sample((pad as f32) + 1.5, (pad + 6) as f32);
+        assert!(edge.abs() < 0.5, "{edge}");
+        assert!(glyph.sample(-5.0, -5.0) < -SDF_SPREAD + 0.1);
+
+        assert_eq!(distance_field(&[], 0, 0), (Vec::new(), 0, 0));
+    }
+
+    #[test]
+    fn styles_decode_with_colors_as_argb() {
+        let mut data = Vec::new();
+        data.extend_from_slice(&2.5f32.to_le_bytes());
+        data.extend_from_slice(&0x11223344u32.to_le_bytes());
+        data.extend_from_slice(&3.0f32.to_le_bytes());
+        data.extend_from_slice(&(-1.0f32).to_le_bytes());
+        data.extend_from_slice(&f32::NAN.to_le_bytes());
+        data.extend_from_slice(&0x000000FFu32.to_le_bytes());
+        let style = parse_style(&data).unwrap();
+        assert_eq!(style.outline_width, 2.5);
+        assert_eq!(style.outline_color, 0x44112233);
+        assert_eq!((style.shadow_x, style.shadow_y), (3.0, -1.0));
+        assert_eq!(style.shadow_softness, 0.0);
+        assert_eq!(style.shadow_color, 0xFF000000);
+        assert!(parse_style(&data[..20]).is_none());
+    }
+}
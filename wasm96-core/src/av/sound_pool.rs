@@ -0,0 +1,376 @@
+//! Sound pools: one decoded sound effect shared by a fixed number of voices.
+//!
+//! Rapid-fire effects (bullets, coins) played with `wasm96_audio_play_wav` each decode a fresh
+//! copy and pile up without limit. A pool decodes the sound once and plays it on at most
+//! `max_voices` voices; when all are busy, the steal policy decides whether the new play takes
+//! over the oldest or quietest voice or is dropped. Each play can also vary its pitch slightly
+//! (from the host RNG, so replays sound the same) to keep repeats from sounding mechanical.
+
+use std::sync::Arc;
+
+use wasmtime::Caller;
+
+use crate::runtime::GuestLimits;
+use crate::state::{AUDIO_GROUP_SFX, AUDIO_GROUPS, global};
+use crate::system::loading::{self, Decoded};
+
+use super::utils::{read_guest_bytes, sat_add_i16};
+
+/// Most voices one pool may have.
+pub const MAX_POOL_VOICES: u32 = 32;
+
+/// What a pool does with a new play when every voice is busy.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum StealPolicy {
+    /// Restart the voice that has been playing longest.
+    Oldest = 0,
+    /// Restart the voice with the lowest volume.
+    Quietest = 1,
+    /// Drop the new play.
+    None = 2,
+}
+
+impl StealPolicy {
+    pub fn from_u32(v: u32) -> Option<Self> {
+        match v {
+            0 => Some(Self::Oldest),
+            1 => Some(Self::Quietest),
+            2 => Some(Self::None),
+            _ => None,
+        }
+    }
+}
+
+#[derive(Debug, Clone, Copy)]
+struct Voice {
+    /// Read position in source frames.
+    pos: f64,
+    /// Source frames advanced per output frame (sample rate ratio times pitch).
+    step: f64,
+    volume: f32,
+    /// -1.0 = left, 1.0 = right.
+    pan: f32,
+    /// Play counter when this voice started, for `StealPolicy::Oldest`.
+    started: u64,
+}
+
+#[derive(Debug)]
+pub struct SoundPool {
+    /// Interleaved stereo PCM, shared so voices don't copy it.
+    pcm: Arc<[i16]>,
+    sample_rate: u32,
+    max_voices: usize,
+    policy: StealPolicy,
+    /// Pitch varies uniformly within `1.0 ± pitch_variation` per play.
+    pub pitch_variation: f32,
+    pub group: u32,
+    voices: Vec<Voice>,
+    plays: u64,
+}
+
+impl SoundPool {
+    pub fn new(pcm: Vec<i16>, sample_rate: u32, max_voices: u32, policy: StealPolicy) -> Self {
+        Self {
+            pcm: pcm.into(),
+            sample_rate: sample_rate.max(1),
+            max_voices: max_voices.clamp(1, MAX_POOL_VOICES) as usize,
+            policy,
+            pitch_variation: 0.0,
+            group: AUDIO_GROUP_SFX,
+            voices: Vec::new(),
+            plays: 0,
+        }
+    }
+
+    fn frames(&self) -> usize {
+        self.pcm.len() / 2
+    }
+
+    /// Swap in the sound of a pool created with `audio_sound_pool_create_async`.
+    pub fn set_pcm(&mut self, pcm: Vec<i16>, sample_rate: u32) {
+        self.voices.clear();
+        self.pcm = pcm.into();
+        self.sample_rate = sample_rate.max(1);
+    }
+
+    /// Start a voice; `random` in `0.0..1.0` picks the pitch within the variation. Returns
+    /// false if the play was dropped (or the sound hasn't loaded yet).
+    pub fn play(&mut self, volume: f32, pan: f32, out_rate: u32, random: f32) -> bool {
+        if self.pcm.is_empty() {
+            return false;
+        }
+        let pitch = 1.0 + self.pitch_variation * (random * 2.0 - 1.0);
+        self.plays += 1;
+        let voice = Voice {
+            pos: 0.0,
+            step: self.sample_rate as f64 / out_rate.max(1) as f64 * pitch.max(0.01) as f64,
+            volume,
+            pan,
+            started: self.plays,
+        };
+        if self.voices.len() < self.max_voices {
+            self.voices.push(voice);
+            return true;
+        }
+        let victim = match self.policy {
+            StealPolicy::Oldest => self
+                .voices
+                .iter()
+                .enumerate()
+                .min_by_key(|(_, v)| v.started),
+            StealPolicy::Quietest => self
+                .voices
+                .iter()
+                .enumerate()
+                .min_by(|(_, a), (_, b)| a.volume.total_cmp(&b.volume)),
+            StealPolicy::None => None,
+        };
+        match victim.map(|(i, _)| i) {
+            Some(i) => {
+                self.voices[i] = voice;
+                true
+            }
+            None => false,
+        }
+    }
+
+    pub fn active_voices(&self) -> usize {
+        self.voices.len()
+    }
+
+    pub fn stop(&mut self) {
+        self.voices.clear();
+    }
+}
+
+/// Mix every voice of `pool` into `out` (interleaved stereo), dropping voices that finish.
+pub fn mix_pool(pool: &mut SoundPool, gain: f32, out: &mut [i16]) {
+    let frames = pool.frames();
+    let pcm = &pool.pcm;
+    pool.voices.retain_mut(|voice| {
+        let left = gain * voice.volume * (1.0 - voice.pan.max(0.0));
+        let right = gain * voice.volume * (1.0 + voice.pan.min(0.0));
+        for frame in out.chunks_exact_mut(2) {
+            let i = voice.pos as usize;
+            if i >= frames {
+                return false;
+            }
+            let j = (i + 1).min(frames - 1);
+            let t = (voice.pos - i as f64) as f32;
+            let sample = |c: usize| pcm[i * 2 + c] as f32 * (1.0 - t) + pcm[j * 2 + c] as f32 * t;
+            frame[0] = sat_add_i16(frame[0], (sample(0) * left) as i16);
+            frame[1] = sat_add_i16(frame[1], (sample(1) * right) as i16);
+            voice.pos += voice.step;
+        }
+        (voice.pos as usize) < frames
+    });
+}
+
+/// Decode WAV or QOA sound data (by magic number) to interleaved stereo PCM and its rate.
+fn decode_sound(bytes: Vec<u8>) -> Option<(Vec<i16>, u32)> {
+    if bytes.starts_with(b"qoaf") {
+        super::audio::decode_qoa(&bytes)
+    } else {
+        super::audio::decode_wav(bytes)
+    }
+}
+
+/// Decode guest sound data (WAV or QOA, by magic number) into a pool. Returns its handle, or 0
+/// if the data can't be decoded or the policy is unknown.
+pub fn audio_sound_pool_create(
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+    max_voices: u32,
+    steal_policy: u32,
+) -> u32 {
+    let Some(policy) = StealPolicy::from_u32(steal_policy) else {
+        return 0;
+    };
+    let Ok(bytes) = read_guest_bytes(env, ptr, len) else {
+        return 0;
+    };
+    let Some((pcm, sample_rate)) = decode_sound(bytes) else {
+        return 0;
+    };
+    let pool = SoundPool::new(pcm, sample_rate, max_voices, policy);
+
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    // Skip handles still held by pools created asynchronously.
+    let id = loop {
+        s.audio.next_sound_pool_id = s.audio.next_sound_pool_id.wrapping_add(1).max(1);
+        let id = s.audio.next_sound_pool_id;
+        if !s.audio.sound_pools.contains_key(&id) {
+            break id;
+        }
+    };
+    s.audio.sound_pools.insert(id, pool);
+    id
+}
+
+/// Like `audio_sound_pool_create`, but decodes in the background (see `system::loading`). The
+/// pool handle is returned at once and doubles as its load handle; plays are dropped until the
+/// sound is ready. Returns 0 if the policy is unknown or the data can't be read.
+pub fn audio_sound_pool_create_async(
+    env: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+    max_voices: u32,
+    steal_policy: u32,
+) -> u32 {
+    let Some(policy) = StealPolicy::from_u32(steal_policy) else {
+        return 0;
+    };
+    let Ok(bytes) = read_guest_bytes(env, ptr, len) else {
+        return 0;
+    };
+
+    let id = {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let id = loading::begin(&mut s, |s, id| s.audio.sound_pools.contains_key(&id));
+        let pool = SoundPool::new(Vec::new(), 1, max_voices, policy);
+        s.audio.sound_pools.insert(id, pool);
+        id
+    };
+    loading::spawn(id, move || {
+        let (pcm, sample_rate) = decode_sound(bytes)?;
+        Some(Decoded::Sound { pcm, sample_rate })
+    });
+    id
+}
+
+/// Play the pool's sound at `volume` (0.0..=1.0) and `pan`. Returns 1 if a voice started.
+pub fn audio_sound_pool_play(pool: u32, volume: f32, pan: f32) -> u32 {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let random = (s.rng.next_u64() >> 40) as f32 / (1u64 << 24) as f32;
+    let out_rate = s.audio.sample_rate;
+    let volume = if volume.is_finite() {
+        volume.clamp(0.0, 1.0)
+    } else {
+        0.0
+    };
+    let pan = if pan.is_finite() {
+        pan.clamp(-1.0, 1.0)
+    } else {
+        0.0
+    };
+    s.audio
+        .sound_pools
+        .get_mut(&pool)
+        .is_some_and(|p| p.play(volume, pan, out_rate, random)) as u32
+}
+
+/// Vary each play's pitch by up to `amount` either way (0.05 = ±5%; clamped to 0.0..=0.5).
+pub fn audio_sound_pool_set_pitch_variation(pool: u32, amount: f32) {
+    let amount = if amount.is_finite() {
+        amount.clamp(0.0, 0.5)
+    } else {
+        0.0
+    };
+    let mut s = global().lock().unwrap();
+    if let Some(p) = s.audio.sound_pools.get_mut(&pool) {
+        p.pitch_variation = amount;
+    }
+}
+
+pub fn audio_sound_pool_set_group(pool: u32, group: u32) {
+    if (group as usize) >= AUDIO_GROUPS {
+        return;
+    }
+    let mut s = global().lock().unwrap();
+    if let Some(p) = s.audio.sound_pools.get_mut(&pool) {
+        p.group = group;
+    }
+}
+
+/// Number of voices currently playing.
+pub fn audio_sound_pool_active(pool: u32) -> u32 {
+    let s = global().lock().unwrap();
+    s.audio
+        .sound_pools
+        .get(&pool)
+        .map_or(0, |p| p.active_voices() as u32)
+}
+
+/// Silence every voice of the pool.
+pub fn audio_sound_pool_stop(pool: u32) {
+    let mut s = global().lock().unwrap();
+    if let Some(p) = s.audio.sound_pools.get_mut(&pool) {
+        p.stop();
+    }
+}
+
+pub fn audio_sound_pool_destroy(pool: u32) {
+    let mut s = global().lock().unwrap();
+    s.audio.sound_pools.remove(&pool);
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn pool(max_voices: u32, policy: StealPolicy) -> SoundPool {
+        // Four frames of a constant 1000 on both channels.
+        SoundPool::new(vec![1000; 8], 100, max_voices, policy)
+    }
+
+    #[test]
+    fn busy_pools_steal_or_drop() {
+        let mut p = pool(2, StealPolicy::Oldest);
+        assert!(p.play(1.0, 0.0, 100, 0.5));
+        assert!(p.play(0.5, 0.0, 100, 0.5));
+        assert!(p.play(0.8, 0.0, 100, 0.5));
+        assert_eq!(p.active_voices(), 2);
+        assert_eq!(p.voices[0].volume, 0.8);
+
+        let mut p = pool(2, StealPolicy::Quietest);
+        p.play(1.0, 0.0, 100, 0.5);
+        p.play(0.2, 0.0, 100, 0.5);
+        p.play(0.9, 0.0, 100, 0.5);
+        assert_eq!(p.voices[1].volume, 0.9);
+
+        let mut p = pool(1, StealPolicy::None);
+        assert!(p.play(1.0, 0.0, 100, 0.5));
+        assert!(!p.play(1.0, 0.0, 100, 0.5));
+    }
+
+    #[test]
+    fn pools_play_once_their_sound_arrives() {
+        let mut p = SoundPool::new(Vec::new(), 1, 2, StealPolicy::Oldest);
+        assert!(!p.play(1.0, 0.0, 100, 0.5));
+        p.set_pcm(vec![1000; 8], 100);
+        assert!(p.play(1.0, 0.0, 100, 0.5));
+        assert_eq!(p.active_voices(), 1);
+    }
+
+    #[test]
+    fn voices_mix_pan_and_finish() {
+        let mut p = pool(4, StealPolicy::Oldest);
+        p.play(0.5, 1.0, 100, 0.5);
+        let mut out = vec![0i16; 12];
+        mix_pool(&mut p, 1.0, &mut out);
+        assert_eq!(out, [0, 500, 0, 500, 0, 500, 0, 500, 0, 0, 0, 0]);
+        assert_eq!(p.active_voices(), 0);
+    }
+
+    #[test]
+    fn pitch_variation_changes_the_step() {
+        let mut p = pool(4, StealPolicy::Oldest);
+        p.pitch_variation = 0.1;
+        p.play(1.0, 0.0, 100, 0.0);
+        p.play(1.0, 0.0, 100, 1.0);
+        p.play(1.0, 0.0, 50, 0.5);
+        assert!((p.voices[0].step - 0.9).abs() < 1e-6);
+        assert!((p.voices[1].step - 1.1).abs() < 1e-6);
+        assert!((p.voices[2].step - 2.0).abs() < 1e-6);
+    }
+}
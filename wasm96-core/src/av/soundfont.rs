@@ -0,0 +1,540 @@
+//! SoundFont 2 (`.sf2`) banks for MIDI playback (see `midi`).
+//!
+//! A bank is parsed once into its 16-bit sample pool, sample headers, instruments and presets.
+//! Playing a note looks up the preset for the channel's bank and program, then every preset and
+//! instrument zone covering the key and velocity, and resolves each pair into a `Region`: the
+//! sample slice to play, its loop, tuning, attenuation, pan and volume envelope.
+//!
+//! Generators follow the spec's layering: an instrument's global zone sets defaults its other
+//! zones override, and preset zones add to the instrument's values. Modulators, filters, the
+//! modulation envelope and LFOs are ignored, as are 24-bit sample extensions; the synth applies
+//! the standard velocity, volume, expression, pan and pitch-bend behaviour itself.
+
+/// Generator ids used by the synth.
+mod generator {
+    pub const START_OFFSET: u16 = 0;
+    pub const END_OFFSET: u16 = 1;
+    pub const LOOP_START_OFFSET: u16 = 2;
+    pub const LOOP_END_OFFSET: u16 = 3;
+    pub const START_COARSE_OFFSET: u16 = 4;
+    pub const END_COARSE_OFFSET: u16 = 12;
+    pub const PAN: u16 = 17;
+    pub const DELAY_VOL_ENV: u16 = 33;
+    pub const ATTACK_VOL_ENV: u16 = 34;
+    pub const HOLD_VOL_ENV: u16 = 35;
+    pub const DECAY_VOL_ENV: u16 = 36;
+    pub const SUSTAIN_VOL_ENV: u16 = 37;
+    pub const RELEASE_VOL_ENV: u16 = 38;
+    pub const INSTRUMENT: u16 = 41;
+    pub const KEY_RANGE: u16 = 43;
+    pub const VEL_RANGE: u16 = 44;
+    pub const LOOP_START_COARSE_OFFSET: u16 = 45;
+    pub const INITIAL_ATTENUATION: u16 = 48;
+    pub const LOOP_END_COARSE_OFFSET: u16 = 50;
+    pub const COARSE_TUNE: u16 = 51;
+    pub const FINE_TUNE: u16 = 52;
+    pub const SAMPLE_ID: u16 = 53;
+    pub const SAMPLE_MODES: u16 = 54;
+    pub const SCALE_TUNING: u16 = 56;
+    pub const EXCLUSIVE_CLASS: u16 = 57;
+    pub const OVERRIDING_ROOT_KEY: u16 = 58;
+    pub const COUNT: usize = 61;
+}
+
+/// The percussion bank (MIDI channel 10).
+pub const PERCUSSION_BANK: u16 = 128;
+
+/// A sample header: a slice of the sample pool.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Sample {
+    pub start: u32,
+    pub end: u32,
+    pub loop_start: u32,
+    pub loop_end: u32,
+    pub rate: u32,
+    pub root_key: u8,
+    pub correction: i8,
+}
+
+/// Volume envelope times in seconds; `sustain` is the sustain attenuation in dB.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct Envelope {
+    pub delay: f32,
+    pub attack: f32,
+    pub hold: f32,
+    pub decay: f32,
+    pub sustain: f32,
+    pub release: f32,
+}
+
+/// Everything a voice needs to play one sample for one note.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct Region {
+    pub sample: Sample,
+    pub root_key: u8,
+    /// Fine tuning in cents, including the sample's pitch correction.
+    pub tune: f32,
+    /// Cents per key (100 = normal).
+    pub scale_tuning: f32,
+    /// Attenuation in dB.
+    pub attenuation: f32,
+    /// -1.0 (left) ..= 1.0 (right).
+    pub pan: f32,
+    /// 0 = no loop, 1 = loop, 3 = loop until released, then play to the end.
+    pub loop_mode: u8,
+    pub exclusive_class: u16,
+    pub envelope: Envelope,
+}
+
+#[derive(Debug, Clone, Default)]
+struct Zone {
+    gens: Vec<(u16, i16)>,
+    /// Instrument index (preset zones) or sample index (instrument zones).
+    target: Option<u16>,
+}
+
+impl Zone {
+    fn range(&self, op: u16) -> (u8, u8) {
+        self.gens
+            .iter()
+            .rev()
+            .find(|(o, _)| *o == op)
+            .map_or((0, 127), |&(_, v)| (v as u16 as u8, (v as u16 >> 8) as u8))
+    }
+
+    fn covers(&self, key: u8, vel: u8) -> bool {
+        let (klo, khi) = self.range(generator::KEY_RANGE);
+        let (vlo, vhi) = self.range(generator::VEL_RANGE);
+        (klo..=khi).contains(&key) && (vlo..=vhi).contains(&vel)
+    }
+}
+
+#[derive(Debug, Clone, Default)]
+struct ZoneSet {
+    global: Option<Zone>,
+    zones: Vec<Zone>,
+}
+
+#[derive(Debug, Clone)]
+struct Preset {
+    bank: u16,
+    program: u16,
+    zones: ZoneSet,
+}
+
+/// A parsed SoundFont bank.
+#[derive(Debug, Clone)]
+pub struct SoundFont {
+    pub data: Vec<i16>,
+    samples: Vec<Sample>,
+    instruments: Vec<ZoneSet>,
+    presets: Vec<Preset>,
+}
+
+struct Chunk<'a> {
+    id: [u8; 4],
+    data: &'a [u8],
+}
+
+fn chunks(mut bytes: &[u8]) -> impl Iterator<Item = Chunk<'_>> {
+    std::iter::from_fn(move || {
+        if bytes.len() < 8 {
+            return None;
+        }
+        let id = bytes[..4].try_into().ok()?;
+        let len = u32::from_le_bytes(bytes[4..8].try_into().ok()?) as usize;
+        let data = bytes.get(8..8 + len)?;
+        // Chunks are padded to an even length.
+        bytes = bytes.get(8 + len + (len & 1)..).unwrap_or(&[]);
+        Some(Chunk { id, data })
+    })
+}
+
+/// The body of `LIST` chunk `kind` among `bytes`' chunks.
+fn list<'a>(bytes: &'a [u8], kind: &[u8; 4]) -> Option<&'a [u8]> {
+    chunks(bytes)
+        .find(|c| &c.id == b"LIST" && c.data.get(..4) == Some(kind))
+        .map(|c| &c.data[4..])
+}
+
+fn sub<'a>(bytes: &'a [u8], id: &[u8; 4]) -> Option<&'a [u8]> {
+    chunks(bytes).find(|c| &c.id == id).map(|c| c.data)
+}
+
+fn u16_at(b: &[u8], at: usize) -> u16 {
+    u16::from_le_bytes([b[at], b[at + 1]])
+}
+
+fn u32_at(b: &[u8], at: usize) -> u32 {
+    u32::from_le_bytes([b[at], b[at + 1], b[at + 2], b[at + 3]])
+}
+
+/// Group `(bag index)` records into zones. `headers` are the bag start indices of each
+/// preset/instrument, terminal record included; `terminal` is the generator that ends a
+/// non-global zone.
+fn zone_sets(headers: &[usize], bags: &[u8], gens: &[u8], terminal: u16) -> Option<Vec<ZoneSet>> {
+    let bag_count = bags.len() / 4;
+    let gen_count = gens.len() / 4;
+    let bag_gen = |i: usize| (i < bag_count).then(|| u16_at(bags, i * 4) as usize);
+    let mut sets = Vec::new();
+    for pair in headers.windows(2) {
+        let mut set = ZoneSet::default();
+        for bag in pair[0]..pair[1] {
+            let (from, to) = (bag_gen(bag)?, bag_gen(bag + 1)?);
+            if from > to || to > gen_count {
+                return None;
+            }
+            let mut zone = Zone::default();
+            for g in from..to {
+                let (op, amount) = (u16_at(gens, g * 4), u16_at(gens, g * 4 + 2) as i16);
+                if op == terminal {
+                    zone.target = Some(amount as u16);
+                    // Generators after the terminal one are ignored.
+                    break;
+                }
+                zone.gens.push((op, amount));
+            }
+            if zone.target.is_some() {
+                set.zones.push(zone);
+            } else if bag == pair[0] {
+                set.global = Some(zone);
+            }
+        }
+        sets.push(set);
+    }
+    Some(sets)
+}
+
+impl SoundFont {
+    /// Parse a `.sf2` file. `None` if it isn't a SoundFont 2 bank or its tables are broken.
+    pub fn parse(bytes: &[u8]) -> Option<Self> {
+        let riff = chunks(bytes).next()?;
+        if &riff.id != b"RIFF" || riff.data.get(..4)? != b"sfbk" {
+            return None;
+        }
+        let body = &riff.data[4..];
+        let smpl = sub(list(body, b"sdta")?, b"smpl")?;
+        let pdta = list(body, b"pdta")?;
+        let table = |id: &[u8; 4], size: usize| {
+            sub(pdta, id).filter(|t| t.len() % size == 0 && t.len() >= size)
+        };
+        let (phdr, pbag, pgen) = (table(b"phdr", 38)?, table(b"pbag", 4)?, table(b"pgen", 4)?);
+        let (inst, ibag, igen) = (table(b"inst", 22)?, table(b"ibag", 4)?, table(b"igen", 4)?);
+        let shdr = table(b"shdr", 46)?;
+
+        let data: Vec<i16> = smpl
+            .chunks_exact(2)
+            .map(|s| i16::from_le_bytes([s[0], s[1]]))
+            .collect();
+        let samples = shdr
+            .chunks_exact(46)
+            .map(|h| Sample {
+                start: u32_at(h, 20),
+                end: u32_at(h, 24),
+                loop_start: u32_at(h, 28),
+                loop_end: u32_at(h, 32),
+                rate: u32_at(h, 36),
+                root_key: h[40],
+                correction: h[41] as i8,
+            })
+            .collect();
+
+        let inst_bags: Vec<usize> = inst
+            .chunks_exact(22)
+            .map(|h| u16_at(h, 20) as usize)
+            .collect();
+        let instruments = zone_sets(&inst_bags, ibag, igen, generator::SAMPLE_ID)?;
+        let preset_bags: Vec<usize> = phdr
+            .chunks_exact(38)
+            .map(|h| u16_at(h, 24) as usize)
+            .collect();
+        let preset_sets = zone_sets(&preset_bags, pbag, pgen, generator::INSTRUMENT)?;
+        let presets = phdr
+            .chunks_exact(38)
+            .zip(preset_sets)
+            .map(|(h, zones)| Preset {
+                program: u16_at(h, 20),
+                bank: u16_at(h, 22),
+                zones,
+            })
+            .collect();
+
+        Some(Self {
+            data,
+            samples,
+            instruments,
+            presets,
+        })
+    }
+
+    /// Number of presets.
+    pub fn preset_count(&self) -> usize {
+        self.presets.len()
+    }
+
+    /// The preset for `bank`/`program`, falling back to bank 0 (or the first percussion kit)
+    /// and then to the first preset, as General MIDI players do.
+    fn preset(&self, bank: u16, program: u16) -> Option<&Preset> {
+        let find = |bank: u16, program: u16| {
+            self.presets
+                .iter()
+                .find(|p| p.bank == bank && p.program == program)
+        };
+        find(bank, program)
+            .or_else(|| match bank {
+                PERCUSSION_BANK => find(PERCUSSION_BANK, 0),
+                _ => find(0, program),
+            })
+            .or_else(|| self.presets.first())
+    }
+
+    /// The regions to play for a note.
+    pub fn regions(&self, bank: u16, program: u16, key: u8, vel: u8) -> Vec<Region> {
+        let mut out = Vec::new();
+        let Some(preset) = self.preset(bank, program) else {
+            return out;
+        };
+        for pzone in preset.zones.zones.iter().filter(|z| z.covers(key, vel)) {
+            let Some(inst) = pzone.target.and_then(|i| self.instruments.get(i as usize)) else {
+                continue;
+            };
+            for izone in inst.zones.iter().filter(|z| z.covers(key, vel)) {
+                let Some(sample) = izone.target.and_then(|s| self.samples.get(s as usize)) else {
+                    continue;
+                };
+                // Instrument values: defaults, then the global zone, then the zone itself.
+                let mut values = [0i32; generator::COUNT];
+                for (op, v) in [
+                    (generator::DELAY_VOL_ENV, -12000),
+                    (generator::ATTACK_VOL_ENV, -12000),
+                    (generator::HOLD_VOL_ENV, -12000),
+                    (generator::DECAY_VOL_ENV, -12000),
+                    (generator::RELEASE_VOL_ENV, -12000),
+                    (generator::SCALE_TUNING, 100),
+                    (generator::OVERRIDING_ROOT_KEY, -1),
+                ] {
+                    values[op as usize] = v;
+                }
+                for (op, v) in inst.global.iter().flat_map(|g| &g.gens).chain(&izone.gens) {
+                    if let Some(slot) = values.get_mut(*op as usize) {
+                        *slot = *v as i32;
+                    }
+                }
+                // Preset values are offsets: the global zone's, overridden by the zone's.
+                let mut offsets = [0i32; generator::COUNT];
+                for (op, v) in preset
+                    .zones
+                    .global
+                    .iter()
+                    .flat_map(|g| &g.gens)
+                    .chain(&pzone.gens)
+                {
+                    if let Some(slot) = offsets.get_mut(*op as usize) {
+                        *slot = *v as i32;
+                    }
+                }
+                if let Some(region) = self.resolve(sample, &values, &offsets) {
+                    out.push(region);
+                }
+            }
+        }
+        out
+    }
+
+    fn resolve(
+        &self,
+        sample: &Sample,
+        values: &[i32; generator::COUNT],
+        offsets: &[i32; generator::COUNT],
+    ) -> Option<Region> {
+        let at = |op: u16| values[op as usize];
+        let sum = |op: u16| values[op as usize] + offsets[op as usize];
+        let shift = |base: u32, fine: u16, coarse: u16| {
+            (base as i64 + at(fine) as i64 + at(coarse) as i64 * 32768).max(0) as u32
+        };
+        let mut s = *sample;
+        s.start = shift(
+            s.start,
+            generator::START_OFFSET,
+            generator::START_COARSE_OFFSET,
+        );
+        s.end = shift(s.end, generator::END_OFFSET, generator::END_COARSE_OFFSET)
+            .min(self.data.len() as u32);
+        s.loop_start = shift(
+            s.loop_start,
+            generator::LOOP_START_OFFSET,
+            generator::LOOP_START_COARSE_OFFSET,
+        );
+        s.loop_end = shift(
+            s.loop_end,
+            generator::LOOP_END_OFFSET,
+            generator::LOOP_END_COARSE_OFFSET,
+        );
+        if s.start >= s.end || s.rate == 0 {
+            return None;
+        }
+        let mut loop_mode = (at(generator::SAMPLE_MODES) & 3) as u8;
+        if loop_mode == 2
+            || s.loop_start < s.start
+            || s.loop_end > s.end
+            || s.loop_start + 1 >= s.loop_end
+        {
+            loop_mode = 0;
+        }
+        let root_key = match at(generator::OVERRIDING_ROOT_KEY) {
+            key @ 0..=127 => key as u8,
+            _ => s.root_key.min(127),
+        };
+        let seconds = |op: u16| 2f32.powf(sum(op).clamp(-12000, 8000) as f32 / 1200.0);
+        Some(Region {
+            sample: s,
+            root_key,
+            tune: (sum(generator::COARSE_TUNE) * 100
+                + sum(generator::FINE_TUNE)
+                + s.correction as i32) as f32,
+            scale_tuning: sum(generator::SCALE_TUNING) as f32,
+            attenuation: sum(generator::INITIAL_ATTENUATION).clamp(0, 1440) as f32 / 10.0,
+            pan: (sum(generator::PAN).clamp(-500, 500) as f32) / 500.0,
+            loop_mode,
+            exclusive_class: at(generator::EXCLUSIVE_CLASS).max(0) as u16,
+            envelope: Envelope {
+                delay: seconds(generator::DELAY_VOL_ENV),
+                attack: seconds(generator::ATTACK_VOL_ENV),
+                hold: seconds(generator::HOLD_VOL_ENV),
+                decay: seconds(generator::DECAY_VOL_ENV),
+                sustain: sum(generator::SUSTAIN_VOL_ENV).clamp(0, 1440) as f32 / 10.0,
+                release: seconds(generator::RELEASE_VOL_ENV),
+            },
+        })
+    }
+}
+
+/// Builds small banks for tests here and in `midi`.
+#[cfg(test)]
+pub(crate) mod testing {
+    fn chunk(id: &[u8; 4], data: &[u8]) -> Vec<u8> {
+        let mut out = id.to_vec();
+        out.extend_from_slice(&(data.len() as u32).to_le_bytes());
+        out.extend_from_slice(data);
+        if data.len() % 2 == 1 {
+            out.push(0);
+        }
+        out
+    }
+
+    fn list(kind: &[u8; 4], chunks: &[Vec<u8>]) -> Vec<u8> {
+        let mut body = kind.to_vec();
+        for c in chunks {
+            body.extend_from_slice(c);
+        }
+        chunk(b"LIST", &body)
+    }
+
+    fn record(name: &str, tail: &[u8], size: usize) -> Vec<u8> {
+        let mut out = vec![0u8; 20];
+        out[..name.len()].copy_from_slice(name.as_bytes());
+        out.extend_from_slice(tail);
+        out.resize(size, 0);
+        out
+    }
+
+    fn gens(list: &[(u16, u16)]) -> Vec<u8> {
+        list.iter()
+            .flat_map(|(op, v)| [op.to_le_bytes(), v.to_le_bytes()].concat())
+            .collect()
+    }
+
+    /// One preset (bank 0, program 0) playing a looped 100-frame square wave rooted at key 60,
+    /// upper keys (72..) an octave up via coarse tune, with a 0.5 s release.
+    pub fn square_font() -> Vec<u8> {
+        let samples: Vec<u8> = (0..100)
+            .flat_map(|i: i32| (if i % 20 < 10 { 8000i16 } else { -8000 }).to_le_bytes())
+            .collect();
+        let mut shdr = Vec::new();
+        for (name, start, end) in [("square", 0u32, 100u32), ("EOS", 0, 0)] {
+            let mut tail = Vec::new();
+            for v in [start, end, 20, 80, 1000] {
+                tail.extend_from_slice(&v.to_le_bytes());
+            }
+            tail.extend_from_slice(&[60, 0, 0, 0, 1, 0]);
+            shdr.extend(record(name, &tail, 46));
+        }
+        // Instrument: a global zone (release, looping) and two key-split zones.
+        let igen = gens(&[
+            (38, (-1200i16) as u16),
+            (54, 1),
+            (43, 71 << 8),
+            (53, 0),
+            (43, 72 | (127 << 8)),
+            (51, 12),
+            (53, 0),
+        ]);
+        let ibag: Vec<u8> = [0u16, 0, 2, 0, 4, 0, 7, 0]
+            .iter()
+            .flat_map(|v| v.to_le_bytes())
+            .collect();
+        let inst = [
+            record("lead", &0u16.to_le_bytes(), 22),
+            record("EOI", &3u16.to_le_bytes(), 22),
+        ]
+        .concat();
+        let pgen = gens(&[(41, 0)]);
+        let pbag: Vec<u8> = [0u16, 0, 1, 0]
+            .iter()
+            .flat_map(|v| v.to_le_bytes())
+            .collect();
+        let mut p0 = 0u16.to_le_bytes().to_vec();
+        p0.extend_from_slice(&0u16.to_le_bytes());
+        p0.extend_from_slice(&0u16.to_le_bytes());
+        let mut eop = vec![0xFF, 0, 0, 0];
+        eop.extend_from_slice(&1u16.to_le_bytes());
+        let phdr = [record("Lead", &p0, 38), record("EOP", &eop, 38)].concat();
+
+        let body = [
+            b"sfbk".to_vec(),
+            list(b"INFO", &[chunk(b"ifil", &[2, 0, 1, 0])]),
+            list(b"sdta", &[chunk(b"smpl", &samples)]),
+            list(
+                b"pdta",
+                &[
+                    chunk(b"phdr", &phdr),
+                    chunk(b"pbag", &pbag),
+                    chunk(b"pmod", &[0; 10]),
+                    chunk(b"pgen", &pgen),
+                    chunk(b"inst", &inst),
+                    chunk(b"ibag", &ibag),
+                    chunk(b"imod", &[0; 10]),
+                    chunk(b"igen", &igen),
+                    chunk(b"shdr", &shdr),
+                ],
+            ),
+        ]
+        .concat();
+        chunk(b"RIFF", &body)
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_zones_and_layers_generators() {
+        let font = SoundFont::parse(&testing::square_font()).unwrap();
+        assert_eq!(font.preset_count(), 1);
+        assert_eq!(font.data.len(), 100);
+
+        let low = font.regions(0, 0, 60, 100);
+        assert_eq!(low.len(), 1);
+        let r = low[0];
+        assert_eq!((r.root_key, r.tune, r.loop_mode), (60, 0.0, 1));
+        assert_eq!((r.sample.loop_start, r.sample.loop_end), (20, 80));
+        assert!((r.envelope.release - 0.5).abs() < 1e-4);
+
+        let high = font.regions(0, 0, 80, 100);
+        assert_eq!(high[0].tune, 1200.0);
+        // Unknown programs fall back to what the bank has.
+        assert_eq!(font.regions(3, 42, 60, 100).len(), 1);
+        assert!(SoundFont::parse(b"RIFF\x04\x00\x00\x00WAVE").is_none());
+    }
+}
@@ -1,6 +1,7 @@
 // Needed for `alloc::` in this crate.
 extern crate alloc;
 
+use crate::runtime::GuestLimits;
 use crate::state::global;
 use wasmtime::Caller;
 
@@ -11,7 +12,7 @@ use wasmtime::Caller;
 // Storage ABI helpers
 use super::utils::{guest_alloc, guest_free};
 
-pub fn storage_save(env: &mut Caller<'_, ()>, key: u64, data_ptr: u32, data_len: u32) {
+pub fn storage_save(env: &mut Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32) {
     // Read guest memory pointers
     let memory_ptr = {
         let s = global().lock().unwrap();
@@ -33,7 +34,7 @@ pub fn storage_save(env: &mut Caller<'_, ()>, key: u64, data_ptr: u32, data_len:
     s.storage.kv.insert(key, data);
 }
 
-pub fn storage_load(env: &mut Caller<'_, ()>, key: u64) -> u64 {
+pub fn storage_load(env: &mut Caller<'_, GuestLimits>, key: u64) -> u64 {
     // Read guest memory pointers
     let memory_ptr = {
         let s = global().lock().unwrap();
@@ -68,6 +69,6 @@ pub fn storage_load(env: &mut Caller<'_, ()>, key: u64) -> u64 {
     ((dst_ptr as u64) << 32) | (data.len() as u64)
 }
 
-pub fn storage_free(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
+pub fn storage_free(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) {
     guest_free(env, ptr, len);
 }
@@ -0,0 +1,267 @@
+//! Chiptune synth voices.
+//!
+//! Guests create a voice with a waveform, shape it with an ADSR envelope, and trigger notes with
+//! `note_on`/`note_off`. The host renders every voice into the mix in `audio_drain_host`, so the
+//! guest never has to generate samples itself.
+
+use crate::state::{AUDIO_GROUPS, EnvelopeStage, SynthVoice, Waveform, global};
+
+use super::utils::sat_add_i16;
+
+/// Output gain per voice at full volume, leaving headroom for several voices to play at once.
+pub const VOICE_GAIN: f32 = 0.25;
+
+/// Create a voice. Returns its id, or 0 for an unknown waveform.
+pub fn voice_create(waveform: u32) -> u32 {
+    let Some(waveform) = Waveform::from_u32(waveform) else {
+        return 0;
+    };
+    let mut s = global().lock().unwrap();
+    s.audio.next_synth_id = s.audio.next_synth_id.wrapping_add(1).max(1);
+    let id = s.audio.next_synth_id;
+    s.audio.synth_voices.insert(id, SynthVoice::new(waveform));
+    id
+}
+
+/// Destroy a voice, silencing it immediately.
+pub fn voice_destroy(voice: u32) {
+    let mut s = global().lock().unwrap();
+    s.audio.synth_voices.remove(&voice);
+}
+
+/// Set the ADSR envelope. Times are in milliseconds; `sustain` is a level in 0.0..=1.0.
+pub fn set_envelope(voice: u32, attack_ms: u32, decay_ms: u32, sustain: f32, release_ms: u32) {
+    let mut s = global().lock().unwrap();
+    if let Some(v) = s.audio.synth_voices.get_mut(&voice) {
+        v.attack = attack_ms as f32 / 1000.0;
+        v.decay = decay_ms as f32 / 1000.0;
+        v.sustain = if sustain.is_finite() {
+            sustain.clamp(0.0, 1.0)
+        } else {
+            0.0
+        };
+        v.release = release_ms as f32 / 1000.0;
+    }
+}
+
+/// Move a voice to another mixer group.
+pub fn set_group(voice: u32, group: u32) {
+    if group as usize >= AUDIO_GROUPS {
+        return;
+    }
+    let mut s = global().lock().unwrap();
+    if let Some(v) = s.audio.synth_voices.get_mut(&voice) {
+        v.group = group;
+    }
+}
+
+/// Set a voice's stereo position (-1.0 = left, 0.0 = centre, 1.0 = right).
+pub fn set_pan(voice: u32, pan: f32) {
+    let mut s = global().lock().unwrap();
+    if let Some(v) = s.audio.synth_voices.get_mut(&voice) {
+        v.pan = if pan.is_finite() {
+            pan.clamp(-1.0, 1.0)
+        } else {
+            0.0
+        };
+    }
+}
+
+/// Start (or retrigger) a note. The envelope restarts from its current level, so retriggering
+/// a sounding voice doesn't click.
+pub fn note_on(voice: u32, freq: f32, volume: f32) {
+    let mut s = global().lock().unwrap();
+    if let Some(v) = s.audio.synth_voices.get_mut(&voice) {
+        v.freq = if freq.is_finite() { freq.max(0.0) } else { 0.0 };
+        v.volume = if volume.is_finite() {
+            volume.clamp(0.0, 1.0)
+        } else {
+            0.0
+        };
+        v.stage = EnvelopeStage::Attack;
+    }
+}
+
+/// Release the current note; the voice fades out over its release time.
+pub fn note_off(voice: u32) {
+    let mut s = global().lock().unwrap();
+    let sample_rate = s.audio.sample_rate;
+    if let Some(v) = s.audio.synth_voices.get_mut(&voice) {
+        release(v, sample_rate);
+    }
+}
+
+fn release(v: &mut SynthVoice, sample_rate: u32) {
+    if matches!(v.stage, EnvelopeStage::Idle | EnvelopeStage::Release) {
+        return;
+    }
+    v.stage = EnvelopeStage::Release;
+    v.release_step = v.level / (v.release * sample_rate as f32).max(1.0);
+}
+
+/// Advance the envelope by one sample and return its level.
+fn step_envelope(v: &mut SynthVoice, sample_rate: f32) -> f32 {
+    match v.stage {
+        EnvelopeStage::Idle => v.level = 0.0,
+        EnvelopeStage::Attack => {
+            v.level += 1.0 / (v.attack * sample_rate).max(1.0);
+            if v.level >= 1.0 {
+                v.level = 1.0;
+                v.stage = EnvelopeStage::Decay;
+            }
+        }
+        EnvelopeStage::Decay => {
+            v.level -= (1.0 - v.sustain) / (v.decay * sample_rate).max(1.0);
+            if v.level <= v.sustain {
+                v.level = v.sustain;
+                v.stage = EnvelopeStage::Sustain;
+            }
+        }
+        EnvelopeStage::Sustain => v.level = v.sustain,
+        EnvelopeStage::Release => {
+            v.level -= v.release_step;
+            if v.level <= 0.0 {
+                v.level = 0.0;
+                v.stage = EnvelopeStage::Idle;
+            }
+        }
+    }
+    v.level
+}
+
+/// Oscillator output in -1.0..=1.0 for the current phase.
+fn oscillator(v: &SynthVoice) -> f32 {
+    match v.waveform {
+        Waveform::Square => {
+            if v.phase < 0.5 {
+                1.0
+            } else {
+                -1.0
+            }
+        }
+        Waveform::Triangle => 1.0 - 4.0 * (v.phase - 0.5).abs(),
+        Waveform::Saw => 2.0 * v.phase - 1.0,
+        Waveform::Noise => {
+            if v.lfsr & 1 == 0 {
+                1.0
+            } else {
+                -1.0
+            }
+        }
+    }
+}
+
+/// Mix one voice into an interleaved stereo buffer, scaled by the mixer `gain`.
+pub fn render_voice(v: &mut SynthVoice, sample_rate: u32, gain: f32, out: &mut [i16]) {
+    if v.stage == EnvelopeStage::Idle {
+        return;
+    }
+    let sr = sample_rate.max(1) as f32;
+    let step = v.freq / sr;
+    // Same linear pan law as sample channels: the far side fades, the near side stays at 1.0.
+    let pan_left = (1.0 - v.pan).min(1.0);
+    let pan_right = (1.0 + v.pan).min(1.0);
+    for frame in out.chunks_exact_mut(2) {
+        let level = step_envelope(v, sr);
+        let sample = oscillator(v) * level * v.volume * gain * VOICE_GAIN * 32767.0;
+        frame[0] = sat_add_i16(frame[0], (sample * pan_left) as i16);
+        frame[1] = sat_add_i16(frame[1], (sample * pan_right) as i16);
+
+        v.phase += step;
+        if v.phase >= 1.0 {
+            v.phase = v.phase.fract();
+            // The noise generator is clocked once per oscillator period, so `freq` sets its pitch.
+            let bit = (v.lfsr ^ (v.lfsr >> 1)) & 1;
+            v.lfsr = (v.lfsr >> 1) | (bit << 14);
+        }
+        if v.stage == EnvelopeStage::Idle {
+            break;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn envelope_runs_attack_decay_sustain_release() {
+        let mut v = SynthVoice::new(Waveform::Square);
+        v.attack = 0.01;
+        v.decay = 0.01;
+        v.sustain = 0.5;
+        v.release = 0.01;
+        v.stage = EnvelopeStage::Attack;
+
+        // 1000 Hz sample rate: 10 samples per 10 ms stage.
+        for _ in 0..10 {
+            step_envelope(&mut v, 1000.0);
+        }
+        assert_eq!(v.stage, EnvelopeStage::Decay);
+        assert_eq!(v.level, 1.0);
+
+        for _ in 0..11 {
+            step_envelope(&mut v, 1000.0);
+        }
+        assert_eq!(v.stage, EnvelopeStage::Sustain);
+        assert_eq!(v.level, 0.5);
+
+        release(&mut v, 1000);
+        for _ in 0..11 {
+            step_envelope(&mut v, 1000.0);
+        }
+        assert_eq!(v.stage, EnvelopeStage::Idle);
+        assert_eq!(v.level, 0.0);
+    }
+
+    #[test]
+    fn square_wave_has_the_requested_period() {
+        let mut v = SynthVoice::new(Waveform::Square);
+        v.attack = 0.0;
+        v.decay = 0.0;
+        v.sustain = 1.0;
+        v.freq = 100.0;
+        v.stage = EnvelopeStage::Attack;
+
+        // 800 Hz output, 100 Hz tone: 8 frames per period, 4 high then 4 low.
+        let mut out = vec![0i16; 16 * 2];
+        render_voice(&mut v, 800, 1.0, &mut out);
+        let left: Vec<i16> = out.iter().step_by(2).copied().collect();
+        assert!(left[0..4].iter().all(|&s| s > 0));
+        assert!(left[4..8].iter().all(|&s| s < 0));
+        assert!(left[8..12].iter().all(|&s| s > 0));
+        assert_eq!(out[0], out[1]);
+    }
+
+    #[test]
+    fn idle_voice_is_silent_and_noise_varies() {
+        let mut idle = SynthVoice::new(Waveform::Saw);
+        let mut out = vec![0i16; 64];
+        render_voice(&mut idle, 44100, 1.0, &mut out);
+        assert!(out.iter().all(|&s| s == 0));
+
+        let mut noise = SynthVoice::new(Waveform::Noise);
+        noise.attack = 0.0;
+        noise.freq = 22050.0;
+        noise.stage = EnvelopeStage::Attack;
+        let mut out = vec![0i16; 256];
+        render_voice(&mut noise, 44100, 1.0, &mut out);
+        assert!(out.iter().any(|&s| s > 0) && out.iter().any(|&s| s < 0));
+    }
+
+    #[test]
+    fn panned_voice_fades_the_far_channel() {
+        let mut v = SynthVoice::new(Waveform::Square);
+        v.attack = 0.0;
+        v.decay = 0.0;
+        v.sustain = 1.0;
+        v.freq = 100.0;
+        v.pan = -1.0;
+        v.stage = EnvelopeStage::Attack;
+
+        let mut out = vec![0i16; 4];
+        render_voice(&mut v, 800, 1.0, &mut out);
+        assert!(out[0] > 0);
+        assert_eq!(out[1], 0);
+    }
+}
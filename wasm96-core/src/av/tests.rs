@@ -5,7 +5,12 @@ extern crate alloc;
 mod tests {
     use crate::av::audio::audio_init;
     use crate::av::utils::{graphics_image_from_host, sat_add_i16};
-    use crate::av::{graphics_point, graphics_set_color, graphics_set_size, graphics_triangle};
+    use crate::av::{
+        graphics_arc_filled, graphics_circle_gradient, graphics_ellipse, graphics_line,
+        graphics_point, graphics_polygon_points, graphics_polyline_points, graphics_rect_gradient,
+        graphics_set_color, graphics_set_line_style, graphics_set_line_width, graphics_set_size,
+        graphics_triangle,
+    };
     use crate::state::global;
 
     fn count_nonzero(buf: &[u32]) -> usize {
@@ -223,6 +228,7 @@ mod tests {
                 pcm_stereo,
                 position_frames: 0,
                 sample_rate,
+                ..Default::default()
             });
 
             // Mix exactly 1 frame from the channel (mirrors the logic in `audio_drain_host`,
@@ -302,4 +308,786 @@ mod tests {
             s.video.framebuffer[0]
         );
     }
+
+    #[test]
+    fn polygon_fills_square_interior() {
+        reset_state_for_test();
+
+        graphics_set_size(10, 10);
+        clear_framebuffer_for_test();
+        graphics_set_color(255, 255, 255, 255);
+
+        graphics_polygon_points(&[(1, 1), (5, 1), (5, 5), (1, 5)]);
+
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        assert_eq!(count_nonzero(&s.video.framebuffer), 16);
+        assert_ne!(s.video.framebuffer[10 + 1], 0);
+        assert_eq!(s.video.framebuffer[5 * 10 + 5], 0);
+    }
+
+    #[test]
+    fn polygon_uses_even_odd_rule_for_holes() {
+        reset_state_for_test();
+
+        graphics_set_size(10, 10);
+        clear_framebuffer_for_test();
+        graphics_set_color(255, 255, 255, 255);
+
+        // Outer square with an inner square traced in the same path.
+        graphics_polygon_points(&[
+            (0, 0),
+            (10, 0),
+            (10, 10),
+            (0, 10),
+            (0, 0),
+            (3, 3),
+            (3, 7),
+            (7, 7),
+            (7, 3),
+            (3, 3),
+        ]);
+
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        assert_eq!(count_nonzero(&s.video.framebuffer), 100 - 16);
+        assert_eq!(s.video.framebuffer[5 * 10 + 5], 0);
+    }
+
+    #[test]
+    fn polyline_closed_joins_last_point_to_first() {
+        reset_state_for_test();
+
+        graphics_set_size(8, 8);
+        clear_framebuffer_for_test();
+        graphics_set_color(255, 255, 255, 255);
+
+        graphics_polyline_points(&[(0, 0), (7, 0), (7, 7)], true);
+
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        // Diagonal closing segment passes through (3, 3).
+        assert_ne!(s.video.framebuffer[3 * 8 + 3], 0);
+    }
+
+    #[test]
+    fn ellipse_respects_independent_radii() {
+        reset_state_for_test();
+
+        graphics_set_size(21, 13);
+        clear_framebuffer_for_test();
+        graphics_set_color(255, 255, 255, 255);
+
+        graphics_ellipse(10, 6, 8, 4);
+
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let px = |x: usize, y: usize| s.video.framebuffer[y * 21 + x];
+        // Wide along x, short along y.
+        assert_ne!(px(3, 6), 0);
+        assert_ne!(px(17, 6), 0);
+        assert_eq!(px(10, 1), 0);
+        assert_eq!(px(3, 4), 0);
+    }
+
+    #[test]
+    fn arc_filled_only_covers_requested_quadrant() {
+        reset_state_for_test();
+
+        graphics_set_size(21, 21);
+        clear_framebuffer_for_test();
+        graphics_set_color(255, 255, 255, 255);
+
+        // 0..π/2 is the lower-right quadrant because screen y points down.
+        graphics_arc_filled(10, 10, 8, 0.0, core::f32::consts::FRAC_PI_2);
+
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let px = |x: usize, y: usize| s.video.framebuffer[y * 21 + x];
+        assert_ne!(px(14, 14), 0);
+        assert_eq!(px(6, 14), 0);
+        assert_eq!(px(14, 6), 0);
+        assert_eq!(px(6, 6), 0);
+    }
+
+    #[test]
+    fn line_width_thickens_horizontal_line() {
+        reset_state_for_test();
+
+        graphics_set_size(16, 8);
+        clear_framebuffer_for_test();
+        graphics_set_color(255, 255, 255, 255);
+        graphics_set_line_width(3);
+
+        graphics_line(2, 4, 13, 4);
+
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let px = |x: usize, y: usize| s.video.framebuffer[y * 16 + x];
+        assert_ne!(px(8, 3), 0);
+        assert_ne!(px(8, 4), 0);
+        assert_ne!(px(8, 5), 0);
+        assert_eq!(px(8, 2), 0);
+        assert_eq!(px(8, 6), 0);
+    }
+
+    #[test]
+    fn dashed_line_leaves_gaps() {
+        reset_state_for_test();
+
+        graphics_set_size(30, 4);
+        clear_framebuffer_for_test();
+        graphics_set_color(255, 255, 255, 255);
+        graphics_set_line_style(1);
+
+        graphics_line(0, 1, 29, 1);
+
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        // 6px on, 4px off at width 1.
+        assert_ne!(s.video.framebuffer[30], 0);
+        assert_ne!(s.video.framebuffer[30 + 5], 0);
+        assert_eq!(s.video.framebuffer[30 + 6], 0);
+        assert_eq!(s.video.framebuffer[30 + 9], 0);
+        assert_ne!(s.video.framebuffer[30 + 10], 0);
+    }
+
+    #[test]
+    fn rect_gradient_hits_corner_colors() {
+        reset_state_for_test();
+
+        graphics_set_size(4, 4);
+        clear_framebuffer_for_test();
+
+        // 0xRRGGBBAA in, 0xAARRGGBB in the framebuffer.
+        graphics_rect_gradient(0, 0, 4, 4, 0xFF0000FF, 0x00FF00FF, 0x0000FFFF, 0xFFFFFFFF);
+
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let fb = &s.video.framebuffer;
+        assert_eq!(fb[0], 0xFFFF0000);
+        assert_eq!(fb[3], 0xFF00FF00);
+        assert_eq!(fb[12], 0xFF0000FF);
+        assert_eq!(fb[15], 0xFFFFFFFF);
+    }
+
+    #[test]
+    fn circle_gradient_uses_inner_color_at_center() {
+        reset_state_for_test();
+
+        graphics_set_size(9, 9);
+        clear_framebuffer_for_test();
+
+        graphics_circle_gradient(4, 4, 4, 0xFFFFFFFF, 0x000000FF);
+
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let fb = &s.video.framebuffer;
+        assert_eq!(fb[4 * 9 + 4], 0xFFFFFFFF);
+        // Pixels near the edge are darker than the center.
+        assert!((fb[4 * 9 + 1] & 0xFF) < 0xFF);
+        // Outside the circle stays untouched.
+        assert_eq!(fb[0], 0);
+    }
+
+    #[test]
+    fn framebuffer_write_then_read_round_trips() {
+        reset_state_for_test();
+
+        graphics_set_size(4, 4);
+        clear_framebuffer_for_test();
+
+        let block: Vec<u8> = (0..2 * 2 * 4).map(|i| i as u8 * 10).collect();
+        framebuffer_write_rgba(1, 1, 2, 2, &block);
+
+        assert_eq!(framebuffer_read_rgba(1, 1, 2, 2), block);
+    }
+
+    #[test]
+    fn framebuffer_read_clips_offscreen_to_zero() {
+        reset_state_for_test();
+
+        graphics_set_size(2, 2);
+        clear_framebuffer_for_test();
+        framebuffer_write_rgba(0, 0, 1, 1, &[1, 2, 3, 4]);
+
+        let out = framebuffer_read_rgba(-1, -1, 2, 2);
+        assert_eq!(&out[0..12], &[0u8; 12]);
+        assert_eq!(&out[12..16], &[1, 2, 3, 4]);
+    }
+
+    #[test]
+    fn framebuffer_blocks_near_i32_max_clip_without_overflow() {
+        reset_state_for_test();
+
+        graphics_set_size(2, 2);
+        clear_framebuffer_for_test();
+        framebuffer_write_rgba(i32::MAX - 1, 0, 4, 1, &[0xFF; 16]);
+        framebuffer_write_rgba(0, i32::MAX, 1, 2, &[0xFF; 8]);
+
+        assert_eq!(
+            framebuffer_read_rgba(i32::MAX - 1, i32::MAX - 1, 4, 4),
+            [0u8; 64]
+        );
+        assert_eq!(framebuffer_read_rgba(0, 0, 2, 2), [0u8; 16]);
+    }
+
+    fn song_marks() -> Vec<crate::state::RowMark> {
+        use crate::state::RowMark;
+        vec![
+            RowMark {
+                order: 0,
+                row: 0,
+                frame: 0,
+            },
+            RowMark {
+                order: 0,
+                row: 1,
+                frame: 2,
+            },
+            RowMark {
+                order: 1,
+                row: 0,
+                frame: 4,
+            },
+            RowMark {
+                order: 1,
+                row: 1,
+                frame: 6,
+            },
+        ]
+    }
+
+    #[test]
+    fn xm_row_marks_map_between_rows_and_frames() {
+        use crate::av::audio::{frame_for_row, row_for_frame};
+
+        let marks = song_marks();
+        assert_eq!(frame_for_row(&marks, 1, 0), Some(4));
+        assert_eq!(frame_for_row(&marks, 2, 0), None);
+        assert_eq!(row_for_frame(&marks, 0), Some((0, 0)));
+        assert_eq!(row_for_frame(&marks, 5), Some((1, 0)));
+        assert_eq!(row_for_frame(&marks, 100), Some((1, 1)));
+        assert_eq!(row_for_frame(&[], 3), None);
+    }
+
+    #[test]
+    fn mix_channel_wraps_inside_loop_region_and_respects_pause() {
+        use crate::av::audio::mix_channel;
+
+        // Frame n has sample value n + 1, so the output shows which frames were played.
+        let pcm_stereo: Vec<i16> = (0..8).flat_map(|n| [n + 1, n + 1]).collect();
+        let mut channel = crate::state::AudioChannel {
+            active: true,
+            loop_enabled: true,
+            pcm_stereo,
+            loop_start: 4,
+            loop_end: Some(6),
+            row_marks: song_marks(),
+            ..Default::default()
+        };
+
+        let mut out = vec![0i16; 8 * 2];
+        mix_channel(&mut channel, 1.0, &mut out);
+        let left: Vec<i16> = out.iter().step_by(2).copied().collect();
+        assert_eq!(left, vec![1, 2, 3, 4, 5, 6, 5, 6]);
+        assert_eq!(channel.position_frames, 6);
+
+        channel.paused = true;
+        let mut out = vec![0i16; 4];
+        mix_channel(&mut channel, 1.0, &mut out);
+        assert_eq!(out, vec![0; 4]);
+        assert_eq!(channel.position_frames, 6);
+
+        // Without looping the channel stops at the loop end.
+        channel.paused = false;
+        channel.loop_enabled = false;
+        mix_channel(&mut channel, 1.0, &mut out);
+        assert!(!channel.active);
+    }
+
+    #[test]
+    fn mix_gain_combines_master_and_group_volume() {
+        use crate::av::audio::{mix_channel, mix_gain};
+        use crate::state::{AUDIO_GROUP_MUSIC, AUDIO_GROUPS};
+
+        let mut groups = [1.0; AUDIO_GROUPS];
+        groups[AUDIO_GROUP_MUSIC as usize] = 0.5;
+        assert_eq!(mix_gain(0.5, &groups, AUDIO_GROUP_MUSIC), 0.25);
+        assert_eq!(mix_gain(1.0, &groups, 0), 1.0);
+        // Out-of-range groups only get the master volume.
+        assert_eq!(mix_gain(0.5, &groups, 99), 0.5);
+
+        let mut channel = crate::state::AudioChannel {
+            active: true,
+            pcm_stereo: vec![8000, 8000],
+            ..Default::default()
+        };
+        let mut out = vec![0i16; 2];
+        mix_channel(&mut channel, 0.25, &mut out);
+        assert_eq!(out, vec![2000, 2000]);
+    }
+
+    #[test]
+    fn pitched_channels_step_and_interpolate() {
+        use crate::av::audio::{clamp_pitch, mix_channel};
+
+        let pcm_stereo: Vec<i16> = (0..4).flat_map(|n| [n * 100, n * 100]).collect();
+        let mut channel = crate::state::AudioChannel {
+            active: true,
+            pcm_stereo: pcm_stereo.clone(),
+            pitch: 2.0,
+            ..Default::default()
+        };
+        let mut out = vec![0i16; 4 * 2];
+        mix_channel(&mut channel, 1.0, &mut out);
+        let left: Vec<i16> = out.iter().step_by(2).copied().collect();
+        assert_eq!(left, vec![0, 200, 0, 0]);
+        assert!(!channel.active);
+
+        // Half speed lands between frames and loops back to the start.
+        let mut channel = crate::state::AudioChannel {
+            active: true,
+            loop_enabled: true,
+            pcm_stereo,
+            pitch: 0.5,
+            ..Default::default()
+        };
+        let mut out = vec![0i16; 9 * 2];
+        mix_channel(&mut channel, 1.0, &mut out);
+        let left: Vec<i16> = out.iter().step_by(2).copied().collect();
+        assert_eq!(left, vec![0, 50, 100, 150, 200, 250, 300, 150, 0]);
+
+        assert_eq!(clamp_pitch(100.0), 8.0);
+        assert_eq!(clamp_pitch(f32::NAN), 1.0);
+    }
+
+    #[test]
+    fn positional_audio_pans_and_attenuates_by_offset() {
+        use crate::av::audio::{pan_to_i16, positional_pan_gain};
+
+        let (pan, gain) = positional_pan_gain(0.0, 0.0, 320);
+        assert_eq!((pan, gain), (0.0, 1.0));
+
+        // Half a screen to the right: hard right, half volume.
+        let (pan, gain) = positional_pan_gain(160.0, 0.0, 320);
+        assert_eq!((pan, gain), (1.0, 0.5));
+
+        let (pan, _) = positional_pan_gain(-80.0, 0.0, 320);
+        assert_eq!(pan, -0.5);
+
+        // Straight below: centred but quieter.
+        let (pan, gain) = positional_pan_gain(0.0, 320.0, 320);
+        assert_eq!(pan, 0.0);
+        assert!((gain - 1.0 / 3.0).abs() < 1e-6);
+
+        assert_eq!(pan_to_i16(1.0), 32767);
+        assert_eq!(pan_to_i16(-2.0), -32767);
+        assert_eq!(pan_to_i16(f32::NAN), 0);
+    }
+
+    #[test]
+    fn host_queue_capacity_is_200ms_of_stereo() {
+        use crate::av::audio::host_queue_capacity;
+
+        assert_eq!(host_queue_capacity(44_100), 17_640);
+        assert_eq!(host_queue_capacity(48_000), 19_200);
+        // Always an even number of samples so stereo frames are never split.
+        assert_eq!(host_queue_capacity(22_051) % 2, 0);
+    }
+
+    #[test]
+    fn sample_region_crops_scales_and_pads() {
+        use crate::av::graphics::sample_region;
+
+        // 2x2 image: red, green / blue, white.
+        let src = [
+            255, 0, 0, 255, 0, 255, 0, 255, //
+            0, 0, 255, 255, 255, 255, 255, 255,
+        ];
+        assert_eq!(
+            sample_region(&src, 2, 2, (1, 0, 1, 1), 1, 1),
+            [0, 255, 0, 255]
+        );
+
+        // The bottom row doubled horizontally.
+        let row = sample_region(&src, 2, 2, (0, 1, 2, 1), 4, 1);
+        assert_eq!(&row[..8], &[0, 0, 255, 255, 0, 0, 255, 255]);
+        assert_eq!(&row[8..], &[255; 8]);
+
+        // Outside the image is transparent.
+        let padded = sample_region(&src, 2, 2, (1, 1, 2, 1), 2, 1);
+        assert_eq!(padded, [255, 255, 255, 255, 0, 0, 0, 0]);
+    }
+
+    #[test]
+    fn blit_ex_flips_and_rotates() {
+        use crate::av::utils::{Canvas, DRAW_FLIP_X, DrawEx, blit_ex};
+        use crate::state::TINT_NONE;
+
+        // 2x1 image: red, green.
+        let src = [255, 0, 0, 255, 0, 255, 0, 255];
+        let red = 0x00FF0000;
+        let green = 0x0000FF00;
+        let place = |angle, flags, pivot: (i32, i32)| DrawEx {
+            x: 1,
+            y: 1,
+            w: 2,
+            h: 1,
+            angle,
+            flags,
+            pivot_x: pivot.0,
+            pivot_y: pivot.1,
+        };
+
+        let draw = |d| {
+            let mut fb = vec![0u32; 16];
+            let mut canvas = Canvas {
+                pixels: &mut fb,
+                coverage: &mut [],
+            };
+            blit_ex(&mut canvas, (4, 4), &src, (2, 1), d, TINT_NONE);
+            fb
+        };
+
+        let fb = draw(place(0.0, 0, (0, 0)));
+        assert_eq!((fb[5], fb[6]), (red, green));
+
+        let fb = draw(place(0.0, DRAW_FLIP_X, (0, 0)));
+        assert_eq!((fb[5], fb[6]), (green, red));
+
+        // A quarter turn clockwise around the top-left corner stacks the pixels downward, left of x.
+        let fb = draw(place(std::f32::consts::FRAC_PI_2, 0, (0, 0)));
+        assert_eq!((fb[4], fb[8]), (red, green));
+        assert_eq!(fb.iter().filter(|&&p| p != 0).count(), 2);
+    }
+
+    #[test]
+    fn tint_multiplies_and_blends() {
+        use crate::av::utils::Canvas;
+        use crate::state::TINT_NONE;
+
+        // Draw one image pixel over `dst` on the screen (no coverage).
+        let draw = |dst: u32, px: [u8; 4], tint: u32| {
+            let mut fb = [dst];
+            Canvas {
+                pixels: &mut fb,
+                coverage: &mut [],
+            }
+            .image_pixel(0, px, tint);
+            fb[0]
+        };
+
+        let px = [200, 100, 50, 255];
+        assert_eq!(draw(0, px, TINT_NONE), 0x00C86432);
+        assert_eq!(draw(7, [1, 2, 3, 0], TINT_NONE), 7);
+
+        // Opaque red tint keeps only the red channel.
+        assert_eq!(draw(0, px, 0xFFFF0000), 0x00C80000);
+        // Opaque black tint makes a silhouette.
+        assert_eq!(draw(0x00123456, px, 0xFF000000), 0);
+
+        // Half alpha blends halfway toward what's underneath.
+        assert_eq!(draw(0, [255, 255, 255, 255], 0x80FFFFFF), 0x00808080);
+        // Tint alpha combines with the pixel's own alpha.
+        assert_eq!(draw(0, [255, 255, 255, 128], 0x80FFFFFF), 0x00404040);
+        assert_eq!(draw(0x00ABCDEF, px, 0x00FFFFFF), 0x00ABCDEF);
+
+        // On a layer canvas, a translucent pixel over nothing keeps its color and records its
+        // opacity instead of blending with the empty canvas.
+        let (mut fb, mut coverage) = ([0u32], [0u8]);
+        let mut canvas = Canvas {
+            pixels: &mut fb,
+            coverage: &mut coverage,
+        };
+        canvas.image_pixel(0, [255, 255, 255, 255], 0x80FFFFFF);
+        assert_eq!((fb[0], coverage[0]), (0x00FFFFFF, 128));
+    }
+
+    #[test]
+    fn nine_slice_keeps_corners_and_stretches_center() {
+        use crate::av::graphics::nine_slice;
+
+        // 3x3 source: distinct corner values, 9 in the middle.
+        let src: Vec<u8> = [1, 2, 3, 4, 9, 5, 6, 7, 8]
+            .iter()
+            .flat_map(|&v| [v, v, v, 255])
+            .collect();
+        let out = nine_slice(&src, 3, 3, 5, 4, (1, 1, 1, 1));
+        let at = |x: usize, y: usize| out[(y * 5 + x) * 4];
+        assert_eq!([at(0, 0), at(4, 0), at(0, 3), at(4, 3)], [1, 3, 6, 8]);
+        assert_eq!([at(1, 0), at(3, 0)], [2, 2]);
+        assert_eq!([at(0, 1), at(0, 2)], [4, 4]);
+        assert!((1..4).all(|x| (1..3).all(|y| at(x, y) == 9)));
+
+        // Too small for both borders: they shrink and the center disappears.
+        let tiny = nine_slice(&src, 3, 3, 1, 1, (1, 1, 1, 1));
+        assert_eq!(tiny.len(), 4);
+    }
+
+    #[test]
+    fn post_effects_filter_a_copy() {
+        use crate::av::post::post_process;
+        use crate::state::PostEffect;
+
+        let gray = 0x00808080;
+        let fb = vec![gray; 8 * 8];
+
+        // Zero strength and `None` leave the frame alone.
+        assert_eq!(post_process(PostEffect::Scanlines, 0.0, &fb, 8, 8), fb);
+        assert_eq!(post_process(PostEffect::None, 1.0, &fb, 8, 8), fb);
+
+        let lines = post_process(PostEffect::Scanlines, 1.0, &fb, 8, 8);
+        assert_eq!((lines[0], lines[8]), (gray, 0));
+
+        assert_eq!(
+            post_process(PostEffect::Grayscale, 1.0, &[0x00FF0000], 1, 1),
+            vec![0x004C4C4C]
+        );
+
+        // Curvature pushes the corners off the tube but keeps the center.
+        let crt = post_process(PostEffect::Crt, 1.0, &fb, 8, 8);
+        assert_eq!(crt[0], 0);
+        assert_eq!(crt[4 * 8 + 3], gray);
+
+        // A single bright pixel glows onto its dark neighbors.
+        let mut spot = vec![0; 9 * 9];
+        spot[4 * 9 + 4] = 0x00FFFFFF;
+        let bloom = post_process(PostEffect::Bloom, 1.0, &spot, 9, 9);
+        assert_ne!(bloom[4 * 9 + 5], 0);
+        assert_eq!(bloom[0], 0);
+
+        // Full-strength dither leaves 4 levels per channel.
+        let ramp: Vec<u32> = (0..256).map(|v| v * 0x010101).collect();
+        let dithered = post_process(PostEffect::Dither, 1.0, &ramp, 16, 16);
+        assert!(
+            dithered
+                .iter()
+                .all(|&p| [0, 85, 170, 255].contains(&(p & 0xFF)))
+        );
+    }
+
+    #[test]
+    fn color_grades_remap_and_sample_luts() {
+        use crate::av::post::{color_grade, parse_color_grade};
+
+        // Lengths that are neither a table nor a cube are refused.
+        assert!(parse_color_grade(&[0; 100]).is_none());
+        assert!(parse_color_grade(&[0; 3]).is_none());
+
+        // One table for every channel: invert.
+        let invert: Vec<u8> = (0..=255).rev().collect();
+        let grade = parse_color_grade(&invert).unwrap();
+        assert_eq!(color_grade(&grade, vec![0x00FF8000]), vec![0x00007FFF]);
+
+        // RGB entries: only red is kept.
+        let red_only: Vec<u8> = (0..=255).flat_map(|v| [v, 0, 0]).collect();
+        let grade = parse_color_grade(&red_only).unwrap();
+        assert_eq!(color_grade(&grade, vec![0x00123456]), vec![0x00120000]);
+
+        // A 2x2x2 identity cube keeps colors and interpolates between its corners.
+        let identity: Vec<u8> = (0..8)
+            .flat_map(|i| [(i & 1) * 255, (i >> 1 & 1) * 255, (i >> 2 & 1) * 255])
+            .map(|c| c as u8)
+            .collect();
+        let grade = parse_color_grade(&identity).unwrap();
+        let fb = vec![0x00000000, 0x00FFFFFF, 0x00804020];
+        assert_eq!(color_grade(&grade, fb.clone()), fb);
+
+        // A 2x2x2 cube of one color tints everything.
+        let night: Vec<u8> = [10, 20, 60].repeat(8);
+        let grade = parse_color_grade(&night).unwrap();
+        assert_eq!(color_grade(&grade, vec![0x00FFFFFF]), vec![0x000A143C]);
+    }
+
+    #[test]
+    fn indexed_images_follow_palette_swaps() {
+        use crate::av::palette::indexed_to_rgba;
+        use crate::state::Palette;
+
+        let mut palette = Palette::default();
+        palette.colors[1] = 0x112233;
+        palette.colors[2] = 0xAABBCC;
+
+        let indices = [0, 1, 2];
+        assert_eq!(
+            indexed_to_rgba(&indices, &palette),
+            [0, 0, 0, 0, 0x11, 0x22, 0x33, 255, 0xAA, 0xBB, 0xCC, 255]
+        );
+
+        // Swapping recolors without touching the indices; transparency uses the original index.
+        palette.swap[1] = 2;
+        palette.swap[0] = 1;
+        palette.transparent[2] = true;
+        assert_eq!(
+            indexed_to_rgba(&indices, &palette),
+            [0, 0, 0, 0, 0xAA, 0xBB, 0xCC, 255, 0, 0, 0, 0]
+        );
+
+        palette.reset_swaps();
+        assert_eq!(palette.resolve(1), 0x112233);
+        assert!(palette.transparent[0] && !palette.transparent[2]);
+    }
+
+    #[test]
+    fn draw_batch_instances_decode() {
+        use crate::av::graphics::{DRAW_INSTANCE_SIZE, parse_draw_instances};
+
+        let mut data = Vec::new();
+        for v in [-3i32, 4, 8, 0] {
+            data.extend_from_slice(&v.to_le_bytes());
+        }
+        for v in [8u32, 16, 1.5f32.to_bits(), 0x11223344] {
+            data.extend_from_slice(&v.to_le_bytes());
+        }
+        assert_eq!(data.len(), DRAW_INSTANCE_SIZE);
+        data.extend_from_slice(&[0; 5]); // a partial trailing instance is ignored
+
+        let parsed = parse_draw_instances(&data);
+        assert_eq!(parsed.len(), 1);
+        let inst = parsed[0];
+        assert_eq!((inst.x, inst.y, inst.sx, inst.sy), (-3, 4, 8, 0));
+        assert_eq!((inst.sw, inst.sh, inst.angle), (8, 16, 1.5));
+        // 0xRRGGBBAA on the wire, 0xAARRGGBB like the global tint.
+        assert_eq!(inst.tint, 0x44112233);
+    }
+
+    #[test]
+    fn particles_emit_fall_and_expire() {
+        use crate::av::particles::{PARTICLE_CONFIG_SIZE, ParticleConfig, ParticleSystem};
+
+        let mut packed = Vec::new();
+        for w in [100u32, 100] {
+            packed.extend_from_slice(&w.to_le_bytes());
+        }
+        // speed 0..0, direction 0, no spread, gravity (0, 100), no drag
+        for f in [0.0f32, 0.0, 0.0, 0.0, 0.0, 100.0, 0.0] {
+            packed.extend_from_slice(&f.to_bits().to_le_bytes());
+        }
+        for w in [0xFF0000FFu32, 0xFF000000] {
+            packed.extend_from_slice(&w.to_le_bytes());
+        }
+        for f in [2.0f32, 2.0] {
+            packed.extend_from_slice(&f.to_bits().to_le_bytes());
+        }
+        for w in [3u32, 0] {
+            packed.extend_from_slice(&w.to_le_bytes());
+        }
+        assert_eq!(packed.len(), PARTICLE_CONFIG_SIZE);
+        assert!(ParticleConfig::parse(&packed[..PARTICLE_CONFIG_SIZE - 1]).is_none());
+
+        let config = ParticleConfig::parse(&packed).unwrap();
+        let mut system = ParticleSystem::new(config, 7);
+        system.emit(4.0, 0.0, 10);
+        assert_eq!(system.len(), 3, "emits past the cap are dropped");
+        system.clear();
+        system.emit(4.0, 0.0, 1);
+
+        // Gravity pulls the particles down into view, half faded to transparent.
+        system.update(0.05);
+        let mut fb = vec![0u32; 8 * 8];
+        system.draw(&mut fb, 8, 8, (0, 0));
+        assert_eq!(fb[4], 0x00800000);
+        assert_eq!(fb[0], 0);
+
+        system.update(0.06);
+        assert!(system.is_empty());
+    }
+
+    #[test]
+    fn camera_pass_translates_zooms_and_clamps() {
+        use crate::av::camera::{close_pass, open_pass};
+        use crate::state::{Camera, VideoState};
+
+        let mut video = VideoState {
+            width: 8,
+            height: 8,
+            framebuffer: vec![0x111111; 64],
+            ..VideoState::default()
+        };
+
+        // Unzoomed: the pass is the screen, offset so the camera lands at its center.
+        video.camera = Camera {
+            x: 14.0,
+            y: 4.0,
+            ..Camera::default()
+        };
+        open_pass(&mut video);
+        assert_eq!(video.camera.pass.as_ref().unwrap().origin, (10, 0));
+        close_pass(&mut video);
+        assert_eq!(video.width, 8);
+
+        // 2x zoom: world pixel (4, 4) covers screen pixels 4..6 and nothing else changes.
+        video.camera.x = 4.0;
+        video.camera.zoom = 2.0;
+        open_pass(&mut video);
+        let (ox, oy) = video.camera.pass.as_ref().unwrap().origin;
+        let pw = video.width as i32;
+        video.framebuffer[((4 - oy) * pw + (4 - ox)) as usize] = 0xFF0000;
+        close_pass(&mut video);
+        assert_eq!(video.framebuffer.len(), 64);
+        let px = |x: usize, y: usize| video.framebuffer[y * 8 + x];
+        for (x, y) in [(4, 4), (5, 4), (4, 5), (5, 5)] {
+            assert_eq!(px(x, y), 0xFF0000);
+        }
+        assert_eq!(px(3, 4), 0x111111);
+        assert_eq!(px(6, 6), 0x111111);
+
+        // Bounds keep the view inside the world; rotation round-trips.
+        let camera = Camera {
+            x: -100.0,
+            y: 5.0,
+            rotation: 0.7,
+            bounds: Some((0.0, 0.0, 64.0, 64.0)),
+            ..Camera::default()
+        };
+        let (cx, _) = camera.center(8, 8);
+        assert!(cx > 0.0 && cx < 10.0);
+        let (wx, wy) = camera.screen_to_world(1.0, 7.0, 8, 8);
+        let (sx, sy) = camera.world_to_screen(wx, wy, 8, 8);
+        assert!((sx - 1.0).abs() < 1e-3 && (sy - 7.0).abs() < 1e-3);
+    }
+
+    #[test]
+    fn gif_playback_pauses_and_scales_time() {
+        use crate::av::resources::GifPlayback;
+
+        let mut playback = GifPlayback::default();
+        assert_eq!(
+            playback.position_at(1234),
+            1234,
+            "defaults to the host clock"
+        );
+
+        playback.rebase(1000);
+        playback.speed = 2.0;
+        assert_eq!(playback.position_at(1100), 1200);
+
+        playback.rebase(1100);
+        playback.paused = true;
+        assert_eq!(playback.position_at(5000), 1200);
+
+        playback.rebase(5000);
+        playback.paused = false;
+        playback.speed = 0.5;
+        assert_eq!(playback.position_at(5100), 1250);
+    }
 }
@@ -0,0 +1,1255 @@
+//! Tile maps loaded from Tiled (`.tmx`, `.tmj`/`.json`) and LDtk (`.ldtk`) files.
+//!
+//! A map is parsed once into tilesets, tile layers and objects. Files the map refers to (tileset
+//! images, external Tiled tilesets, LDtk external levels) are read from the cart's `.w96` bundle,
+//! relative to the map's own path. Each tileset image is registered as a keyed image under its
+//! bundle path, unless an image with that key is already registered; carts without a bundle
+//! register the images themselves first (`png_register("tiles.png", ...)`) under the paths the
+//! map uses.
+//!
+//! Layers are indexed bottom to top and drawn in that order. Tiles keep Tiled's flip flags
+//! (horizontal, vertical, diagonal); LDtk tiles are numbered the same way, with each tileset's
+//! ids following the previous one's. LDtk IntGrid layers keep their values for collision
+//! lookups, and entity layers become objects. Objects have their top-left corner at (x, y) in
+//! map pixels (Tiled tile objects and LDtk pivots are converted).
+//!
+//! Only orthogonal, finite Tiled maps load; image-collection tilesets and zstd-compressed layers
+//! aren't supported. LDtk holds one tile per cell: stacked tiles keep the top one.
+
+use std::collections::HashMap;
+use std::io::Read;
+
+use serde_json::Value;
+use wasmtime::Caller;
+
+use super::graphics::decode_image_to_rgba;
+use super::resources::{RESOURCES, ResourceError, registration_failed};
+use super::utils::{Canvas, read_guest_bytes};
+use crate::loader::bundle::normalize_path;
+use crate::runtime::GuestLimits;
+use crate::state::global;
+
+/// Tiled's flip flags in the high bits of a tile id.
+pub const FLIP_HORIZONTAL: u32 = 0x8000_0000;
+pub const FLIP_VERTICAL: u32 = 0x4000_0000;
+pub const FLIP_DIAGONAL: u32 = 0x2000_0000;
+const FLAGS: u32 = FLIP_HORIZONTAL | FLIP_VERTICAL | FLIP_DIAGONAL | 0x1000_0000;
+
+/// Largest map side, in tiles.
+pub const MAX_TILES: u32 = 4096;
+
+/// A tileset: a grid of tiles cut from one image.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Tileset {
+    pub first_id: u32,
+    /// Bundle path of the image; it's registered under this key.
+    pub image: String,
+    pub tile_width: u32,
+    pub tile_height: u32,
+    pub columns: u32,
+    pub count: u32,
+    pub spacing: u32,
+    pub margin: u32,
+}
+
+/// A grid of tile ids (0 = empty) with optional per-cell values (LDtk IntGrid).
+#[derive(Debug, Clone, PartialEq)]
+pub struct TileLayer {
+    pub name: String,
+    pub columns: u32,
+    pub rows: u32,
+    pub tile_width: u32,
+    pub tile_height: u32,
+    pub offset_x: i32,
+    pub offset_y: i32,
+    pub visible: bool,
+    pub tiles: Vec<u32>,
+    pub values: Vec<u32>,
+}
+
+/// A placed object: a spawn point, trigger, collider, ...
+#[derive(Debug, Clone, PartialEq)]
+pub struct MapObject {
+    pub id: u32,
+    pub layer: String,
+    pub name: String,
+    pub kind: String,
+    pub x: f32,
+    pub y: f32,
+    pub width: f32,
+    pub height: f32,
+    pub properties: Vec<(String, String)>,
+}
+
+/// A parsed map.
+#[derive(Debug, Clone, PartialEq)]
+pub struct TileMap {
+    pub columns: u32,
+    pub rows: u32,
+    pub tile_width: u32,
+    pub tile_height: u32,
+    pub tilesets: Vec<Tileset>,
+    pub layers: Vec<TileLayer>,
+    pub objects: Vec<MapObject>,
+}
+
+type Parse<T> = Result<T, ResourceError>;
+
+fn req<T>(value: Option<T>) -> Parse<T> {
+    value.ok_or(ResourceError::Invalid)
+}
+
+/// FNV-1a, the hash the SDKs use for resource keys.
+pub fn hash_key(key: &str) -> u64 {
+    let mut hash: u64 = 0xcbf29ce484222325;
+    for byte in key.bytes() {
+        hash ^= byte as u64;
+        hash = hash.wrapping_mul(0x100000001b3);
+    }
+    hash
+}
+
+/// The directory part of `path` (empty for a bare file name).
+fn dir_of(path: &str) -> &str {
+    path.rfind('/').map_or("", |i| &path[..i])
+}
+
+/// Resolve `rel` against `dir`, folding `.` and `..` segments.
+pub fn join(dir: &str, rel: &str) -> String {
+    let mut parts: Vec<&str> = if rel.starts_with('/') {
+        Vec::new()
+    } else {
+        dir.split('/').filter(|p| !p.is_empty()).collect()
+    };
+    for part in rel.split(['/', '\\']) {
+        match part {
+            "" | "." => {}
+            ".." => {
+                parts.pop();
+            }
+            _ => parts.push(part),
+        }
+    }
+    parts.join("/")
+}
+
+/// Reads files next to the map.
+pub trait Assets {
+    fn read(&self, path: &str) -> Option<Vec<u8>>;
+}
+
+impl<F: Fn(&str) -> Option<Vec<u8>>> Assets for F {
+    fn read(&self, path: &str) -> Option<Vec<u8>> {
+        self(path)
+    }
+}
+
+fn read_asset(assets: &dyn Assets, path: &str) -> Parse<Vec<u8>> {
+    assets.read(path).ok_or(ResourceError::Missing)
+}
+
+fn is_xml(bytes: &[u8]) -> bool {
+    let text = bytes.strip_prefix(b"\xEF\xBB\xBF").unwrap_or(bytes);
+    text.iter().find(|b| !b.is_ascii_whitespace()) == Some(&b'<')
+}
+
+/// Parse a Tiled or LDtk map found at bundle `path` (used to resolve the files it refers to).
+/// `level` picks an LDtk level by identifier (empty = the first); Tiled maps ignore it.
+pub fn parse(data: &[u8], path: &str, level: &str, assets: &dyn Assets) -> Parse<TileMap> {
+    let dir = dir_of(normalize_path(path));
+    let map = if is_xml(data) {
+        let text = std::str::from_utf8(data).map_err(|_| ResourceError::Invalid)?;
+        let doc = roxmltree::Document::parse(text).map_err(|_| ResourceError::Invalid)?;
+        tmx::parse_map(doc.root_element(), dir, assets)?
+    } else {
+        let root: Value = serde_json::from_slice(data).map_err(|_| ResourceError::Invalid)?;
+        if root.get("defs").is_some() && root.get("levels").is_some() {
+            ldtk::parse_project(&root, dir, level, assets)?
+        } else {
+            tiled_json::parse_map(&root, dir, assets)?
+        }
+    };
+    // Every layer must cover its grid exactly; drawing indexes it directly.
+    for layer in &map.layers {
+        let cells = layer.columns as usize * layer.rows as usize;
+        if layer.tiles.len() != cells || !(layer.values.is_empty() || layer.values.len() == cells) {
+            return Err(ResourceError::Invalid);
+        }
+    }
+    Ok(map)
+}
+
+fn base64_decode(text: &str) -> Option<Vec<u8>> {
+    let mut out = Vec::with_capacity(text.len() * 3 / 4);
+    let (mut acc, mut bits) = (0u32, 0u32);
+    for c in text.bytes() {
+        let v = match c {
+            b'A'..=b'Z' => c - b'A',
+            b'a'..=b'z' => c - b'a' + 26,
+            b'0'..=b'9' => c - b'0' + 52,
+            b'+' => 62,
+            b'/' => 63,
+            b'=' => break,
+            c if c.is_ascii_whitespace() => continue,
+            _ => return None,
+        };
+        acc = (acc << 6) | v as u32;
+        bits += 6;
+        if bits >= 8 {
+            bits -= 8;
+            out.push((acc >> bits) as u8);
+        }
+    }
+    Some(out)
+}
+
+/// Tile ids from a Tiled base64 layer (`compression` "", "zlib" or "gzip").
+fn decode_base64_tiles(text: &str, compression: &str) -> Parse<Vec<u32>> {
+    let raw = req(base64_decode(text.trim()))?;
+    let bytes = match compression {
+        "" => raw,
+        "zlib" => {
+            let mut out = Vec::new();
+            flate2::read::ZlibDecoder::new(&raw[..])
+                .read_to_end(&mut out)
+                .map_err(|_| ResourceError::Invalid)?;
+            out
+        }
+        "gzip" => {
+            let mut out = Vec::new();
+            flate2::read::GzDecoder::new(&raw[..])
+                .read_to_end(&mut out)
+                .map_err(|_| ResourceError::Invalid)?;
+            out
+        }
+        _ => return Err(ResourceError::Unsupported),
+    };
+    Ok(bytes
+        .chunks_exact(4)
+        .map(|b| u32::from_le_bytes([b[0], b[1], b[2], b[3]]))
+        .collect())
+}
+
+fn check_size(columns: u32, rows: u32) -> Parse<()> {
+    if columns == 0 || rows == 0 || columns > MAX_TILES || rows > MAX_TILES {
+        return Err(ResourceError::Invalid);
+    }
+    Ok(())
+}
+
+/// Tiled maps in JSON (`.tmj`/`.json`), with JSON or XML external tilesets.
+mod tiled_json {
+    use super::*;
+
+    fn u32_of(v: &Value, key: &str) -> u32 {
+        v.get(key).and_then(Value::as_u64).unwrap_or(0) as u32
+    }
+
+    fn f32_of(v: &Value, key: &str) -> f32 {
+        v.get(key).and_then(Value::as_f64).unwrap_or(0.0) as f32
+    }
+
+    fn str_of<'a>(v: &'a Value, key: &str) -> &'a str {
+        v.get(key).and_then(Value::as_str).unwrap_or("")
+    }
+
+    /// A tileset object (inline, or a whole `.tsj` file). `None` for image collections.
+    pub fn parse_tileset(v: &Value, first_id: u32, dir: &str) -> Option<Tileset> {
+        let image = v.get("image")?.as_str()?;
+        Some(Tileset {
+            first_id,
+            image: join(dir, image),
+            tile_width: u32_of(v, "tilewidth"),
+            tile_height: u32_of(v, "tileheight"),
+            columns: u32_of(v, "columns"),
+            count: u32_of(v, "tilecount"),
+            spacing: u32_of(v, "spacing"),
+            margin: u32_of(v, "margin"),
+        })
+    }
+
+    pub fn parse_map(root: &Value, dir: &str, assets: &dyn Assets) -> Parse<TileMap> {
+        if root.get("infinite").and_then(Value::as_bool) == Some(true)
+            || str_of(root, "orientation") != "orthogonal"
+        {
+            return Err(ResourceError::Unsupported);
+        }
+        let mut map = TileMap {
+            columns: u32_of(root, "width"),
+            rows: u32_of(root, "height"),
+            tile_width: u32_of(root, "tilewidth"),
+            tile_height: u32_of(root, "tileheight"),
+            tilesets: Vec::new(),
+            layers: Vec::new(),
+            objects: Vec::new(),
+        };
+        check_size(map.columns, map.rows)?;
+
+        for ts in root
+            .get("tilesets")
+            .and_then(Value::as_array)
+            .into_iter()
+            .flatten()
+        {
+            let first_id = u32_of(ts, "firstgid");
+            let tileset = match ts.get("source").and_then(Value::as_str) {
+                Some(source) => {
+                    let path = join(dir, source);
+                    let bytes = read_asset(assets, &path)?;
+                    if is_xml(&bytes) {
+                        let text =
+                            std::str::from_utf8(&bytes).map_err(|_| ResourceError::Invalid)?;
+                        let doc =
+                            roxmltree::Document::parse(text).map_err(|_| ResourceError::Invalid)?;
+                        tmx::parse_tileset(doc.root_element(), first_id, dir_of(&path))
+                    } else {
+                        let v: Value =
+                            serde_json::from_slice(&bytes).map_err(|_| ResourceError::Invalid)?;
+                        parse_tileset(&v, first_id, dir_of(&path))
+                    }
+                }
+                None => parse_tileset(ts, first_id, dir),
+            };
+            map.tilesets.extend(tileset);
+        }
+
+        let layers = req(root.get("layers").and_then(Value::as_array))?;
+        walk_layers(&mut map, layers, (0, 0), true)?;
+        Ok(map)
+    }
+
+    fn walk_layers(
+        map: &mut TileMap,
+        layers: &[Value],
+        (ox, oy): (i32, i32),
+        visible: bool,
+    ) -> Parse<()> {
+        for layer in layers {
+            let offset = (
+                ox + f32_of(layer, "offsetx") as i32,
+                oy + f32_of(layer, "offsety") as i32,
+            );
+            let shown = visible && layer.get("visible").and_then(Value::as_bool) != Some(false);
+            let name = str_of(layer, "name").to_string();
+            match str_of(layer, "type") {
+                "group" => {
+                    let children = req(layer.get("layers").and_then(Value::as_array))?;
+                    walk_layers(map, children, offset, shown)?;
+                }
+                "tilelayer" => {
+                    let (columns, rows) = (u32_of(layer, "width"), u32_of(layer, "height"));
+                    check_size(columns, rows)?;
+                    let tiles = match layer.get("data") {
+                        Some(Value::Array(ids)) => ids
+                            .iter()
+                            .map(|id| id.as_u64().unwrap_or(0) as u32)
+                            .collect(),
+                        Some(Value::String(text)) if str_of(layer, "encoding") == "base64" => {
+                            decode_base64_tiles(text, str_of(layer, "compression"))?
+                        }
+                        _ => return Err(ResourceError::Invalid),
+                    };
+                    map.layers.push(TileLayer {
+                        name,
+                        columns,
+                        rows,
+                        tile_width: map.tile_width,
+                        tile_height: map.tile_height,
+                        offset_x: offset.0,
+                        offset_y: offset.1,
+                        visible: shown,
+                        tiles,
+                        values: Vec::new(),
+                    });
+                }
+                "objectgroup" => {
+                    for object in layer
+                        .get("objects")
+                        .and_then(Value::as_array)
+                        .into_iter()
+                        .flatten()
+                    {
+                        let height = f32_of(object, "height");
+                        // Tile objects are anchored at their bottom-left.
+                        let lift = if object.get("gid").is_some() {
+                            height
+                        } else {
+                            0.0
+                        };
+                        let kind = match str_of(object, "type") {
+                            "" => str_of(object, "class"),
+                            kind => kind,
+                        };
+                        let properties = object
+                            .get("properties")
+                            .and_then(Value::as_array)
+                            .into_iter()
+                            .flatten()
+                            .map(|p| (str_of(p, "name").to_string(), value_text(p.get("value"))))
+                            .collect();
+                        map.objects.push(MapObject {
+                            id: u32_of(object, "id"),
+                            layer: name.clone(),
+                            name: str_of(object, "name").to_string(),
+                            kind: kind.to_string(),
+                            x: f32_of(object, "x") + offset.0 as f32,
+                            y: f32_of(object, "y") - lift + offset.1 as f32,
+                            width: f32_of(object, "width"),
+                            height,
+                            properties,
+                        });
+                    }
+                }
+                _ => {}
+            }
+        }
+        Ok(())
+    }
+}
+
+/// A JSON property value as text: strings as they are, anything else as JSON.
+fn value_text(value: Option<&Value>) -> String {
+    match value {
+        Some(Value::String(s)) => s.clone(),
+        Some(Value::Null) | None => String::new(),
+        Some(v) => v.to_string(),
+    }
+}
+
+/// Tiled maps and tilesets in XML (`.tmx`/`.tsx`).
+mod tmx {
+    use super::*;
+    use roxmltree::Node;
+
+    fn u32_of(node: Node, key: &str) -> u32 {
+        node.attribute(key)
+            .and_then(|v| v.parse().ok())
+            .unwrap_or(0)
+    }
+
+    fn f32_of(node: Node, key: &str) -> f32 {
+        node.attribute(key)
+            .and_then(|v| v.parse().ok())
+            .unwrap_or(0.0)
+    }
+
+    fn children<'a, 'i>(
+        node: Node<'a, 'i>,
+        tag: &'static str,
+    ) -> impl Iterator<Item = Node<'a, 'i>> {
+        node.children().filter(move |n| n.has_tag_name(tag))
+    }
+
+    /// A `<tileset>` element. `None` for image collections.
+    pub fn parse_tileset(node: Node, first_id: u32, dir: &str) -> Option<Tileset> {
+        let image = children(node, "image").next()?.attribute("source")?;
+        Some(Tileset {
+            first_id,
+            image: join(dir, image),
+            tile_width: u32_of(node, "tilewidth"),
+            tile_height: u32_of(node, "tileheight"),
+            columns: u32_of(node, "columns"),
+            count: u32_of(node, "tilecount"),
+            spacing: u32_of(node, "spacing"),
+            margin: u32_of(node, "margin"),
+        })
+    }
+
+    pub fn parse_map(root: Node, dir: &str, assets: &dyn Assets) -> Parse<TileMap> {
+        if !root.has_tag_name("map") {
+            return Err(ResourceError::Invalid);
+        }
+        if root.attribute("infinite") == Some("1")
+            || root.attribute("orientation") != Some("orthogonal")
+        {
+            return Err(ResourceError::Unsupported);
+        }
+        let mut map = TileMap {
+            columns: u32_of(root, "width"),
+            rows: u32_of(root, "height"),
+            tile_width: u32_of(root, "tilewidth"),
+            tile_height: u32_of(root, "tileheight"),
+            tilesets: Vec::new(),
+            layers: Vec::new(),
+            objects: Vec::new(),
+        };
+        check_size(map.columns, map.rows)?;
+
+        for ts in children(root, "tileset") {
+            let first_id = u32_of(ts, "firstgid");
+            let tileset = match ts.attribute("source") {
+                Some(source) => {
+                    let path = join(dir, source);
+                    let bytes = read_asset(assets, &path)?;
+                    if is_xml(&bytes) {
+                        let text =
+                            std::str::from_utf8(&bytes).map_err(|_| ResourceError::Invalid)?;
+                        let doc =
+                            roxmltree::Document::parse(text).map_err(|_| ResourceError::Invalid)?;
+                        parse_tileset(doc.root_element(), first_id, dir_of(&path))
+                    } else {
+                        let v: Value =
+                            serde_json::from_slice(&bytes).map_err(|_| ResourceError::Invalid)?;
+                        tiled_json::parse_tileset(&v, first_id, dir_of(&path))
+                    }
+                }
+                None => parse_tileset(ts, first_id, dir),
+            };
+            map.tilesets.extend(tileset);
+        }
+
+        walk_layers(&mut map, root, (0, 0), true)?;
+        Ok(map)
+    }
+
+    fn walk_layers(
+        map: &mut TileMap,
+        parent: Node,
+        (ox, oy): (i32, i32),
+        visible: bool,
+    ) -> Parse<()> {
+        for layer in parent.children().filter(Node::is_element) {
+            let offset = (
+                ox + f32_of(layer, "offsetx") as i32,
+                oy + f32_of(layer, "offsety") as i32,
+            );
+            let shown = visible && layer.attribute("visible") != Some("0");
+            let name = layer.attribute("name").unwrap_or("").to_string();
+            match layer.tag_name().name() {
+                "group" => walk_layers(map, layer, offset, shown)?,
+                "layer" => {
+                    let (columns, rows) = (u32_of(layer, "width"), u32_of(layer, "height"));
+                    check_size(columns, rows)?;
+                    let data = req(children(layer, "data").next())?;
+                    let text = data.text().unwrap_or("");
+                    let tiles = match data.attribute("encoding") {
+                        Some("csv") => text
+                            .split(',')
+                            .map(|id| id.trim().parse().unwrap_or(0))
+                            .collect(),
+                        Some("base64") => {
+                            decode_base64_tiles(text, data.attribute("compression").unwrap_or(""))?
+                        }
+                        None => children(data, "tile").map(|t| u32_of(t, "gid")).collect(),
+                        Some(_) => return Err(ResourceError::Unsupported),
+                    };
+                    map.layers.push(TileLayer {
+                        name,
+                        columns,
+                        rows,
+                        tile_width: map.tile_width,
+                        tile_height: map.tile_height,
+                        offset_x: offset.0,
+                        offset_y: offset.1,
+                        visible: shown,
+                        tiles,
+                        values: Vec::new(),
+                    });
+                }
+                "objectgroup" => {
+                    for object in children(layer, "object") {
+                        let height = f32_of(object, "height");
+                        let lift = if object.attribute("gid").is_some() {
+                            height
+                        } else {
+                            0.0
+                        };
+                        let kind = object
+                            .attribute("type")
+                            .or_else(|| object.attribute("class"))
+                            .unwrap_or("");
+                        let properties = children(object, "properties")
+                            .flat_map(|p| children(p, "property"))
+                            .map(|p| {
+                                let value = p.attribute("value").or_else(|| p.text()).unwrap_or("");
+                                (
+                                    p.attribute("name").unwrap_or("").to_string(),
+                                    value.to_string(),
+                                )
+                            })
+                            .collect();
+                        map.objects.push(MapObject {
+                            id: u32_of(object, "id"),
+                            layer: name.clone(),
+                            name: object.attribute("name").unwrap_or("").to_string(),
+                            kind: kind.to_string(),
+                            x: f32_of(object, "x") + offset.0 as f32,
+                            y: f32_of(object, "y") - lift + offset.1 as f32,
+                            width: f32_of(object, "width"),
+                            height,
+                            properties,
+                        });
+                    }
+                }
+                _ => {}
+            }
+        }
+        Ok(())
+    }
+}
+
+/// LDtk projects (`.ldtk`), with optional external level files.
+mod ldtk {
+    use super::*;
+
+    fn i64_of(v: &Value, key: &str) -> i64 {
+        v.get(key).and_then(Value::as_i64).unwrap_or(0)
+    }
+
+    fn str_of<'a>(v: &'a Value, key: &str) -> &'a str {
+        v.get(key).and_then(Value::as_str).unwrap_or("")
+    }
+
+    fn pair(v: &Value, key: &str) -> (f64, f64) {
+        let a = v.get(key).and_then(Value::as_array);
+        let at = |i: usize| {
+            a.and_then(|a| a.get(i))
+                .and_then(Value::as_f64)
+                .unwrap_or(0.0)
+        };
+        (at(0), at(1))
+    }
+
+    pub fn parse_project(
+        root: &Value,
+        dir: &str,
+        level: &str,
+        assets: &dyn Assets,
+    ) -> Parse<TileMap> {
+        let grid = root
+            .get("defaultGridSize")
+            .and_then(Value::as_u64)
+            .unwrap_or(16) as u32;
+
+        // Ids run on from one tileset to the next, starting at 1 like Tiled's.
+        let mut tilesets = Vec::new();
+        let mut first_ids = HashMap::new();
+        let mut next_id = 1u32;
+        let defs = root.get("defs").and_then(|d| d.get("tilesets"));
+        for ts in defs.and_then(Value::as_array).into_iter().flatten() {
+            let Some(rel) = ts.get("relPath").and_then(Value::as_str) else {
+                continue;
+            };
+            let size = i64_of(ts, "tileGridSize").max(1) as u32;
+            let spacing = i64_of(ts, "spacing").max(0) as u32;
+            let padding = i64_of(ts, "padding").max(0) as u32;
+            let span = |px: i64| {
+                (px.max(0) as u32 + spacing).saturating_sub(2 * padding) / (size + spacing)
+            };
+            let (columns, rows) = (span(i64_of(ts, "pxWid")), span(i64_of(ts, "pxHei")));
+            first_ids.insert(i64_of(ts, "uid"), next_id);
+            tilesets.push(Tileset {
+                first_id: next_id,
+                image: join(dir, rel),
+                tile_width: size,
+                tile_height: size,
+                columns,
+                count: columns * rows,
+                spacing,
+                margin: padding,
+            });
+            next_id += (columns * rows).max(1);
+        }
+
+        let levels = req(root.get("levels").and_then(Value::as_array))?;
+        let chosen = if level.is_empty() {
+            levels.first()
+        } else {
+            levels.iter().find(|l| str_of(l, "identifier") == level)
+        };
+        let chosen = chosen.ok_or(ResourceError::Missing)?;
+        let external;
+        let chosen = match chosen.get("layerInstances") {
+            Some(Value::Array(_)) => chosen,
+            _ => {
+                let path = join(dir, str_of(chosen, "externalRelPath"));
+                let bytes = read_asset(assets, &path)?;
+                external =
+                    serde_json::from_slice::<Value>(&bytes).map_err(|_| ResourceError::Invalid)?;
+                &external
+            }
+        };
+
+        let mut map = TileMap {
+            columns: i64_of(chosen, "pxWid").max(0) as u32 / grid.max(1),
+            rows: i64_of(chosen, "pxHei").max(0) as u32 / grid.max(1),
+            tile_width: grid,
+            tile_height: grid,
+            tilesets,
+            layers: Vec::new(),
+            objects: Vec::new(),
+        };
+        check_size(map.columns, map.rows)?;
+
+        let layers = req(chosen.get("layerInstances").and_then(Value::as_array))?;
+        // LDtk lists the top layer first.
+        for layer in layers.iter().rev() {
+            let name = str_of(layer, "__identifier").to_string();
+            let offset = (
+                i64_of(layer, "__pxTotalOffsetX") as i32,
+                i64_of(layer, "__pxTotalOffsetY") as i32,
+            );
+            let visible = layer.get("visible").and_then(Value::as_bool) != Some(false);
+            let size = i64_of(layer, "__gridSize").max(1) as u32;
+            let (columns, rows) = (
+                i64_of(layer, "__cWid").max(0) as u32,
+                i64_of(layer, "__cHei").max(0) as u32,
+            );
+
+            if str_of(layer, "__type") == "Entities" {
+                for (i, entity) in layer
+                    .get("entityInstances")
+                    .and_then(Value::as_array)
+                    .into_iter()
+                    .flatten()
+                    .enumerate()
+                {
+                    let (px, py) = pair(entity, "px");
+                    let (pivot_x, pivot_y) = pair(entity, "__pivot");
+                    let width = entity.get("width").and_then(Value::as_f64).unwrap_or(0.0);
+                    let height = entity.get("height").and_then(Value::as_f64).unwrap_or(0.0);
+                    let identifier = str_of(entity, "__identifier").to_string();
+                    let properties = entity
+                        .get("fieldInstances")
+                        .and_then(Value::as_array)
+                        .into_iter()
+                        .flatten()
+                        .map(|f| {
+                            (
+                                str_of(f, "__identifier").to_string(),
+                                value_text(f.get("__value")),
+                            )
+                        })
+                        .collect();
+                    map.objects.push(MapObject {
+                        id: i as u32 + 1,
+                        layer: name.clone(),
+                        name: identifier.clone(),
+                        kind: identifier,
+                        x: (px - pivot_x * width) as f32 + offset.0 as f32,
+                        y: (py - pivot_y * height) as f32 + offset.1 as f32,
+                        width: width as f32,
+                        height: height as f32,
+                        properties,
+                    });
+                }
+                continue;
+            }
+
+            check_size(columns, rows)?;
+            let first_id = layer
+                .get("__tilesetDefUid")
+                .and_then(Value::as_i64)
+                .and_then(|uid| first_ids.get(&uid).copied());
+            let mut tiles = vec![0u32; columns as usize * rows as usize];
+            if let Some(first_id) = first_id {
+                let placed = ["autoLayerTiles", "gridTiles"]
+                    .into_iter()
+                    .filter_map(|key| layer.get(key).and_then(Value::as_array))
+                    .flatten();
+                for tile in placed {
+                    let (px, py) = pair(tile, "px");
+                    let (cx, cy) = (px as i64 / size as i64, py as i64 / size as i64);
+                    if cx < 0 || cy < 0 || cx >= columns as i64 || cy >= rows as i64 {
+                        continue;
+                    }
+                    let f = i64_of(tile, "f");
+                    let mut id = first_id + i64_of(tile, "t").max(0) as u32;
+                    if f & 1 != 0 {
+                        id |= FLIP_HORIZONTAL;
+                    }
+                    if f & 2 != 0 {
+                        id |= FLIP_VERTICAL;
+                    }
+                    tiles[(cy * columns as i64 + cx) as usize] = id;
+                }
+            }
+            let values = layer
+                .get("intGridCsv")
+                .and_then(Value::as_array)
+                .map(|v| v.iter().map(|n| n.as_u64().unwrap_or(0) as u32).collect())
+                .unwrap_or_default();
+            map.layers.push(TileLayer {
+                name,
+                columns,
+                rows,
+                tile_width: size,
+                tile_height: size,
+                offset_x: offset.0,
+                offset_y: offset.1,
+                visible,
+                tiles,
+                values,
+            });
+        }
+        Ok(map)
+    }
+}
+
+impl TileMap {
+    /// The tileset holding tile `id` (flags already stripped).
+    pub fn tileset_for(&self, id: u32) -> Option<&Tileset> {
+        self.tilesets
+            .iter()
+            .filter(|t| t.first_id <= id)
+            .max_by_key(|t| t.first_id)
+    }
+
+    /// Tile id at a cell (flags stripped), or the IntGrid value on layers that have them.
+    pub fn tile(&self, layer: usize, column: u32, row: u32) -> u32 {
+        let Some(l) = self.layers.get(layer) else {
+            return 0;
+        };
+        if column >= l.columns || row >= l.rows {
+            return 0;
+        }
+        let i = (row * l.columns + column) as usize;
+        if !l.values.is_empty() {
+            return l.values.get(i).copied().unwrap_or(0);
+        }
+        l.tiles.get(i).map_or(0, |t| t & !FLAGS)
+    }
+
+    /// Objects encoded for the guest; see `graphics_map_objects`.
+    pub fn encode_objects(&self) -> Vec<u8> {
+        fn text(out: &mut Vec<u8>, s: &str) {
+            out.extend_from_slice(&(s.len() as u32).to_le_bytes());
+            out.extend_from_slice(s.as_bytes());
+        }
+        let mut out = Vec::new();
+        for o in &self.objects {
+            out.extend_from_slice(&o.id.to_le_bytes());
+            for v in [o.x, o.y, o.width, o.height] {
+                out.extend_from_slice(&v.to_le_bytes());
+            }
+            text(&mut out, &o.layer);
+            text(&mut out, &o.name);
+            text(&mut out, &o.kind);
+            out.extend_from_slice(&(o.properties.len() as u32).to_le_bytes());
+            for (k, v) in &o.properties {
+                text(&mut out, k);
+                text(&mut out, v);
+            }
+        }
+        out
+    }
+}
+
+/// Parse a map and register the tileset images it needs.
+fn load(key: u64, data: &[u8], path: &str, level: &str) -> u32 {
+    let assets = |p: &str| {
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        s.cart.assets.asset(p).map(<[u8]>::to_vec)
+    };
+    let map = match parse(data, path, level, &assets) {
+        Ok(map) => map,
+        Err(err) => return registration_failed(err),
+    };
+
+    let mut images = Vec::new();
+    for tileset in &map.tilesets {
+        let image_key = hash_key(&tileset.image);
+        if RESOURCES
+            .lock()
+            .unwrap()
+            .keyed_images
+            .contains_key(&image_key)
+            || images.iter().any(|(k, _)| *k == image_key)
+        {
+            continue;
+        }
+        let Some(bytes) = assets(&tileset.image) else {
+            return registration_failed(ResourceError::Missing);
+        };
+        let Some(image) = decode_image_to_rgba(&bytes) else {
+            return registration_failed(ResourceError::Invalid);
+        };
+        images.push((image_key, image));
+    }
+
+    let mut res = RESOURCES.lock().unwrap();
+    res.keyed_images.extend(images);
+    res.keyed_maps.insert(key, map);
+    1
+}
+
+fn read_text(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> Option<String> {
+    read_guest_bytes(env, ptr, len)
+        .ok()
+        .and_then(|b| String::from_utf8(b).ok())
+}
+
+/// Load the map at bundle `path` under a key. Returns 1 on success, 0 on failure (see
+/// `graphics_last_error`: 3 = the map, a tileset or an image isn't in the bundle).
+pub fn graphics_map_load(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    path_ptr: u32,
+    path_len: u32,
+    level_ptr: u32,
+    level_len: u32,
+) -> u32 {
+    let (Some(path), Some(level)) = (
+        read_text(env, path_ptr, path_len),
+        read_text(env, level_ptr, level_len),
+    ) else {
+        return registration_failed(ResourceError::Memory);
+    };
+    let data = {
+        let s = global().lock().unwrap();
+        s.cart.assets.asset(&path).map(<[u8]>::to_vec)
+    };
+    match data {
+        Some(data) => load(key, &data, &path, &level),
+        None => registration_failed(ResourceError::Missing),
+    }
+}
+
+/// Register map bytes from guest memory under a key; the files it refers to are looked up
+/// relative to the bundle root.
+pub fn graphics_map_register(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    data_ptr: u32,
+    data_len: u32,
+    level_ptr: u32,
+    level_len: u32,
+) -> u32 {
+    let (Ok(data), Some(level)) = (
+        read_guest_bytes(env, data_ptr, data_len),
+        read_text(env, level_ptr, level_len),
+    ) else {
+        return registration_failed(ResourceError::Memory);
+    };
+    load(key, &data, "", &level)
+}
+
+/// Unregister a map. Its tileset images stay registered.
+pub fn graphics_map_unregister(key: u64) {
+    let mut res = RESOURCES.lock().unwrap();
+    res.keyed_maps.remove(&key);
+}
+
+/// Map size in tiles as `(columns << 32) | rows` (0 if unknown).
+pub fn graphics_map_size(key: u64) -> u64 {
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_maps
+        .get(&key)
+        .map_or(0, |m| ((m.columns as u64) << 32) | m.rows as u64)
+}
+
+/// Tile size in pixels as `(width << 32) | height` (0 if unknown).
+pub fn graphics_map_tile_size(key: u64) -> u64 {
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_maps
+        .get(&key)
+        .map_or(0, |m| ((m.tile_width as u64) << 32) | m.tile_height as u64)
+}
+
+/// Number of tile layers (0 if unknown).
+pub fn graphics_map_layer_count(key: u64) -> u32 {
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_maps
+        .get(&key)
+        .map_or(0, |m| m.layers.len() as u32)
+}
+
+/// Index of the first tile layer called the name at `name_ptr`, or -1.
+pub fn graphics_map_layer_index(
+    env: &mut Caller<'_, GuestLimits>,
+    key: u64,
+    name_ptr: u32,
+    name_len: u32,
+) -> i32 {
+    let Some(name) = read_text(env, name_ptr, name_len) else {
+        return -1;
+    };
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_maps
+        .get(&key)
+        .and_then(|m| m.layers.iter().position(|l| l.name == name))
+        .map_or(-1, |i| i as i32)
+}
+
+/// Tile id (or IntGrid value) at a cell; 0 = empty or out of range.
+pub fn graphics_map_tile(key: u64, layer: u32, column: u32, row: u32) -> u32 {
+    let res = RESOURCES.lock().unwrap();
+    res.keyed_maps
+        .get(&key)
+        .map_or(0, |m| m.tile(layer as usize, column, row))
+}
+
+/// Blob id of the map's objects (0 if there are none). Per object, little-endian: `u32` id,
+/// `f32` x, y, width, height, then the layer, name and kind strings (`u32` length + UTF-8), a
+/// `u32` property count and that many key/value string pairs.
+pub fn graphics_map_objects(key: u64) -> u32 {
+    let encoded = {
+        let res = RESOURCES.lock().unwrap();
+        match res.keyed_maps.get(&key) {
+            Some(m) if !m.objects.is_empty() => m.encode_objects(),
+            _ => return 0,
+        }
+    };
+    crate::system::blobs::store(encoded)
+}
+
+/// Draw one tile layer with the map's top-left at (x, y). Hidden layers draw too, so carts
+/// can keep collision layers hidden in the editor and still show them when debugging.
+pub fn graphics_map_draw_layer(key: u64, layer: u32, x: i32, y: i32) {
+    let res = RESOURCES.lock().unwrap();
+    let Some(map) = res.keyed_maps.get(&key) else {
+        return;
+    };
+    let Some(layer) = map.layers.get(layer as usize) else {
+        return;
+    };
+    draw_layer(map, layer, &res.keyed_images, x, y);
+}
+
+/// Draw every visible tile layer, bottom to top, with the map's top-left at (x, y).
+pub fn graphics_map_draw(key: u64, x: i32, y: i32) {
+    let res = RESOURCES.lock().unwrap();
+    let Some(map) = res.keyed_maps.get(&key) else {
+        return;
+    };
+    for layer in map.layers.iter().filter(|l| l.visible) {
+        draw_layer(map, layer, &res.keyed_images, x, y);
+    }
+}
+
+fn draw_layer(
+    map: &TileMap,
+    layer: &TileLayer,
+    images: &HashMap<u64, super::resources::ImageResource>,
+    x: i32,
+    y: i32,
+) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let (screen_w, screen_h) = (s.video.width as i32, s.video.height as i32);
+    let tint = s.video.tint;
+    let mut fb = Canvas::of(&mut s.video);
+    let (tw, th) = (
+        layer.tile_width.max(1) as i32,
+        layer.tile_height.max(1) as i32,
+    );
+    let (origin_x, origin_y) = (x + layer.offset_x, y + layer.offset_y);
+
+    // Tiles can be taller or wider than the grid, so widen the culled range by the biggest one.
+    let reach_x = map
+        .tilesets
+        .iter()
+        .map(|t| t.tile_width as i32)
+        .max()
+        .unwrap_or(0);
+    let reach_y = map
+        .tilesets
+        .iter()
+        .map(|t| t.tile_height as i32)
+        .max()
+        .unwrap_or(0);
+    let first_col = ((-origin_x - reach_x) / tw).max(0);
+    let last_col = ((screen_w - origin_x) / tw + 1).min(layer.columns as i32);
+    let first_row = ((-origin_y) / th).max(0);
+    let last_row = ((screen_h - origin_y + reach_y) / th + 1).min(layer.rows as i32);
+
+    for row in first_row..last_row {
+        for col in first_col..last_col {
+            let raw = layer.tiles[(row * layer.columns as i32 + col) as usize];
+            let id = raw & !FLAGS;
+            if id == 0 {
+                continue;
+            }
+            let Some(tileset) = map.tileset_for(id) else {
+                continue;
+            };
+            let Some(image) = images.get(&hash_key(&tileset.image)) else {
+                continue;
+            };
+            let local = id - tileset.first_id;
+            if tileset.columns == 0 || (tileset.count > 0 && local >= tileset.count) {
+                continue;
+            }
+            let (w, h) = (tileset.tile_width as i32, tileset.tile_height as i32);
+            let sx = (tileset.margin
+                + (local % tileset.columns) * (tileset.tile_width + tileset.spacing))
+                as i32;
+            let sy = (tileset.margin
+                + (local / tileset.columns) * (tileset.tile_height + tileset.spacing))
+                as i32;
+            // Like Tiled, oversized tiles grow up and to the right from the cell's bottom-left.
+            let dx0 = origin_x + col * tw;
+            let dy0 = origin_y + (row + 1) * th - h;
+
+            for ty in 0..h {
+                let dy = dy0 + ty;
+                if dy < 0 || dy >= screen_h {
+                    continue;
+                }
+                for tx in 0..w {
+                    let dx = dx0 + tx;
+                    if dx < 0 || dx >= screen_w {
+                        continue;
+                    }
+                    let (mut u, mut v) = (tx, ty);
+                    if raw & FLIP_HORIZONTAL != 0 {
+                        u = w - 1 - u;
+                    }
+                    if raw & FLIP_VERTICAL != 0 {
+                        v = h - 1 - v;
+                    }
+                    if raw & FLIP_DIAGONAL != 0 {
+                        (u, v) = (v, u);
+                    }
+                    let (px, py) = (sx + u, sy + v);
+                    if px >= image.width as i32 || py >= image.height as i32 {
+                        continue;
+                    }
+                    let i = (py as usize * image.width as usize + px as usize) * 4;
+                    let pixel = [
+                        image.rgba[i],
+                        image.rgba[i + 1],
+                        image.rgba[i + 2],
+                        image.rgba[i + 3],
+                    ];
+                    fb.image_pixel(dy as usize * screen_w as usize + dx as usize, pixel, tint);
+                }
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn no_assets(_: &str) -> Option<Vec<u8>> {
+        None
+    }
+
+    #[test]
+    fn joins_relative_paths() {
+        assert_eq!(
+            join("maps/world", "../tiles/grass.png"),
+            "maps/tiles/grass.png"
+        );
+        assert_eq!(join("", "./tiles.png"), "tiles.png");
+        assert_eq!(join("maps", "/abs.png"), "abs.png");
+        assert_eq!(
+            base64_decode("AQAAAAIAAAA=").unwrap(),
+            [1, 0, 0, 0, 2, 0, 0, 0]
+        );
+    }
+
+    #[test]
+    fn parses_tiled_json_with_groups_and_objects() {
+        let json = br#"{
+            "orientation": "orthogonal", "width": 2, "height": 1,
+            "tilewidth": 8, "tileheight": 8,
+            "tilesets": [{"firstgid": 1, "image": "tiles.png", "tilewidth": 8,
+                          "tileheight": 8, "columns": 4, "tilecount": 16}],
+            "layers": [
+                {"type": "tilelayer", "name": "ground", "width": 2, "height": 1,
+                 "data": [1, 2147483650]},
+                {"type": "group", "name": "fx", "offsetx": 4, "visible": false, "layers": [
+                    {"type": "tilelayer", "name": "base64", "width": 2, "height": 1,
+                     "encoding": "base64", "data": "AwAAAAAAAAA="},
+                    {"type": "objectgroup", "name": "spawns", "objects": [
+                        {"id": 7, "name": "hero", "type": "player", "x": 10, "y": 20,
+                         "width": 8, "height": 8, "gid": 3,
+                         "properties": [{"name": "hp", "type": "int", "value": 3}]}
+                    ]}
+                ]}
+            ]
+        }"#;
+        let map = parse(json, "maps/level.tmj", "", &no_assets).unwrap();
+        assert_eq!(map.tilesets[0].image, "maps/tiles.png");
+        assert_eq!(map.layers.len(), 2);
+        assert_eq!(map.tile(0, 1, 0), 2);
+        assert_eq!(map.layers[0].tiles[1] & FLIP_HORIZONTAL, FLIP_HORIZONTAL);
+        assert_eq!((map.layers[1].offset_x, map.layers[1].visible), (4, false));
+        assert_eq!(map.tile(1, 0, 0), 3);
+        let hero = &map.objects[0];
+        assert_eq!(
+            (hero.layer.as_str(), hero.kind.as_str()),
+            ("spawns", "player")
+        );
+        assert_eq!((hero.x, hero.y), (14.0, 12.0));
+        assert_eq!(hero.properties, [("hp".to_string(), "3".to_string())]);
+        assert_eq!(
+            map.encode_objects().len(),
+            4 + 16 + 4 + 6 + 4 + 4 + 4 + 6 + 4 + 4 + 2 + 4 + 1
+        );
+    }
+
+    #[test]
+    fn parses_tmx_with_external_tileset() {
+        let tmx = br#"<?xml version="1.0"?>
+            <map orientation="orthogonal" width="2" height="2" tilewidth="16" tileheight="16">
+              <tileset firstgid="1" source="../sets/terrain.tsx"/>
+              <layer name="walls" width="2" height="2">
+                <data encoding="csv">1,0,
+                0,5</data>
+              </layer>
+              <objectgroup name="colliders">
+                <object id="1" x="0" y="16" width="32" height="16">
+                  <properties><property name="solid" type="bool" value="true"/></properties>
+                </object>
+              </objectgroup>
+            </map>"#;
+        let tsx =
+            br#"<tileset name="terrain" tilewidth="16" tileheight="16" tilecount="8" columns="4">
+              <image source="terrain.png" width="64" height="32"/></tileset>"#;
+        let assets = |p: &str| (p == "sets/terrain.tsx").then(|| tsx.to_vec());
+        let map = parse(tmx, "maps/a.tmx", "", &assets).unwrap();
+        assert_eq!(map.tilesets[0].image, "sets/terrain.png");
+        assert_eq!(map.layers[0].tiles, [1, 0, 0, 5]);
+        assert_eq!(map.objects[0].properties[0].1, "true");
+        assert_eq!(
+            parse(tmx, "maps/a.tmx", "", &no_assets),
+            Err(ResourceError::Missing)
+        );
+    }
+
+    #[test]
+    fn parses_ldtk_levels() {
+        let ldtk = br#"{
+            "defaultGridSize": 8,
+            "defs": {"tilesets": [
+                {"uid": 5, "relPath": "atlas.png", "pxWid": 32, "pxHei": 16, "tileGridSize": 8,
+                 "spacing": 0, "padding": 0}
+            ]},
+            "levels": [
+                {"identifier": "Intro", "pxWid": 8, "pxHei": 8, "layerInstances": []},
+                {"identifier": "Cave", "pxWid": 16, "pxHei": 8, "layerInstances": [
+                    {"__type": "Entities", "__identifier": "Things", "__gridSize": 8,
+                     "__cWid": 2, "__cHei": 1, "entityInstances": [
+                        {"__identifier": "Door", "px": [8, 8], "__pivot": [0.5, 1],
+                         "width": 8, "height": 8,
+                         "fieldInstances": [{"__identifier": "to", "__value": "Intro"}]}
+                     ]},
+                    {"__type": "IntGrid", "__identifier": "Collision", "__gridSize": 8,
+                     "__cWid": 2, "__cHei": 1, "__tilesetDefUid": 5, "intGridCsv": [1, 0],
+                     "autoLayerTiles": [{"px": [0, 0], "t": 6, "f": 1}]}
+                ]}
+            ]
+        }"#;
+        let map = parse(ldtk, "world.ldtk", "Cave", &no_assets).unwrap();
+        assert_eq!((map.columns, map.rows, map.tilesets[0].count), (2, 1, 8));
+        assert_eq!(map.layers[0].name, "Collision");
+        assert_eq!(map.layers[0].tiles[0], 7 | FLIP_HORIZONTAL);
+        assert_eq!((map.tile(0, 0, 0), map.tile(0, 1, 0)), (1, 0));
+        let door = &map.objects[0];
+        assert_eq!((door.kind.as_str(), door.x, door.y), ("Door", 4.0, 0.0));
+        assert_eq!(door.properties[0], ("to".to_string(), "Intro".to_string()));
+        assert_eq!(
+            parse(ldtk, "world.ldtk", "Nope", &no_assets),
+            Err(ResourceError::Missing)
+        );
+    }
+}
@@ -0,0 +1,233 @@
+//! Full-screen transitions drawn by the host.
+//!
+//! `transition_start(kind, duration_ms)` covers the screen with the current draw color over the
+//! first half of the duration and reveals it again over the second. On the tick the screen is
+//! fully covered, `transition_midpoint` returns 1; swapping scenes then hides the cut. Like post
+//! effects, transitions are drawn on the presented copy of the frame, so `framebuffer_read` sees
+//! the guest's own pixels. Frames composed with 3D are presented through GL and are not covered.
+
+use crate::state::{Transition, TransitionKind, global};
+
+/// 4x4 Bayer thresholds for the dither wipe's edge.
+const BAYER: [[f32; 4]; 4] = [
+    [0.0, 8.0, 2.0, 10.0],
+    [12.0, 4.0, 14.0, 6.0],
+    [3.0, 11.0, 1.0, 9.0],
+    [15.0, 7.0, 13.0, 5.0],
+];
+
+/// Start a transition of `kind` (0 fade, 1 dither wipe, 2 pixelate, 3 iris) lasting
+/// `duration_ms`, covering with the current draw color. Replaces one already running.
+pub fn graphics_transition_start(kind: u32, duration_ms: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.video.transition = Some(Transition {
+        kind: TransitionKind::from_u32(kind),
+        color: s.video.draw_color & 0x00FF_FFFF,
+        duration_ms,
+        elapsed_ms: 0,
+        passed_midpoint: false,
+    });
+}
+
+/// Whether a transition is running. Returns 1 or 0.
+pub fn graphics_transition_active() -> u32 {
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.video.transition.is_some() as u32
+}
+
+/// Whether this is the tick the running transition fully covers the screen. Returns 1 or 0.
+pub fn graphics_transition_midpoint() -> u32 {
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.video.transition_midpoint as u32
+}
+
+/// Advance the running transition by the tick's delta time. Called before the guest's `update`.
+pub fn transition_begin_tick(delta_ms: u64) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let delta_ms = delta_ms.min(u32::MAX as u64) as u32;
+    let (next, midpoint) = match s.video.transition {
+        Some(t) => step(t, delta_ms),
+        None => (None, false),
+    };
+    s.video.transition = next;
+    s.video.transition_midpoint = midpoint;
+}
+
+/// `t` after `delta_ms` more, or `None` once it has finished, and whether the screen is fully
+/// covered on this step. The step that crosses the midpoint stops on it, so one tick is always
+/// fully covered.
+fn step(mut t: Transition, delta_ms: u32) -> (Option<Transition>, bool) {
+    let elapsed = t.elapsed_ms.saturating_add(delta_ms);
+    if t.passed_midpoint {
+        if elapsed >= t.duration_ms {
+            return (None, false);
+        }
+        t.elapsed_ms = elapsed;
+        return (Some(t), false);
+    }
+    let half = t.duration_ms / 2;
+    if elapsed >= half {
+        t.elapsed_ms = half;
+        t.passed_midpoint = true;
+        return (Some(t), true);
+    }
+    t.elapsed_ms = elapsed;
+    (Some(t), false)
+}
+
+/// How much of the screen `t` covers, 0..=1.
+fn coverage(t: &Transition) -> f32 {
+    let half = t.duration_ms / 2;
+    let c = if !t.passed_midpoint {
+        if half == 0 {
+            1.0
+        } else {
+            t.elapsed_ms as f32 / half as f32
+        }
+    } else {
+        let rest = t.duration_ms - half;
+        if rest == 0 {
+            0.0
+        } else {
+            1.0 - (t.elapsed_ms - half) as f32 / rest as f32
+        }
+    };
+    c.clamp(0.0, 1.0)
+}
+
+fn mix(p: u32, color: u32, k: f32) -> u32 {
+    let channel = |shift: u32| {
+        let a = ((p >> shift) & 0xFF) as f32;
+        let b = ((color >> shift) & 0xFF) as f32;
+        ((a + (b - a) * k).round() as u32).min(255) << shift
+    };
+    channel(16) | channel(8) | channel(0)
+}
+
+/// Draw transition `t` over a presented frame (`width`x`height`).
+pub fn cover(t: &Transition, fb: Vec<u32>, width: u32, height: u32) -> Vec<u32> {
+    let c = coverage(t);
+    let (w, h) = (width as usize, height as usize);
+    if c <= 0.0 || w == 0 || h == 0 || fb.len() < w * h {
+        return fb;
+    }
+    let color = t.color;
+    match t.kind {
+        TransitionKind::Fade => fb.iter().map(|&p| mix(p, color, c)).collect(),
+        TransitionKind::DitherWipe => fb
+            .iter()
+            .enumerate()
+            .map(|(i, &p)| {
+                let (x, y) = (i % w, i / w);
+                let edge = (BAYER[y % 4][x % 4] + 0.5) / 16.0;
+                let threshold = x as f32 / w as f32 * 0.75 + edge * 0.25;
+                if threshold < c { color } else { p }
+            })
+            .collect(),
+        TransitionKind::Pixelate => {
+            let block = 1 + (c * (w.max(h) / 8) as f32) as usize;
+            let fade = ((c - 0.5) * 2.0).max(0.0);
+            let mut out = vec![0; w * h];
+            for y in 0..h {
+                let sy = ((y / block) * block + block / 2).min(h - 1);
+                for x in 0..w {
+                    let sx = ((x / block) * block + block / 2).min(w - 1);
+                    out[y * w + x] = mix(fb[sy * w + sx], color, fade);
+                }
+            }
+            out
+        }
+        TransitionKind::Iris => {
+            let (cx, cy) = (w as f32 / 2.0, h as f32 / 2.0);
+            let radius = (1.0 - c) * cx.hypot(cy);
+            fb.iter()
+                .enumerate()
+                .map(|(i, &p)| {
+                    let dx = (i % w) as f32 + 0.5 - cx;
+                    let dy = (i / w) as f32 + 0.5 - cy;
+                    if dx.hypot(dy) >= radius { color } else { p }
+                })
+                .collect()
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn transition(kind: TransitionKind, duration_ms: u32) -> Transition {
+        Transition {
+            kind,
+            color: 0x102030,
+            duration_ms,
+            elapsed_ms: 0,
+            passed_midpoint: false,
+        }
+    }
+
+    #[test]
+    fn transitions_stop_on_the_midpoint_then_finish() {
+        let t = transition(TransitionKind::Fade, 100);
+        let (t, midpoint) = step(t, 30);
+        let t = t.unwrap();
+        assert!(!midpoint);
+        assert!((coverage(&t) - 0.6).abs() < 1e-6);
+
+        let (t, midpoint) = step(t, 40);
+        let t = t.unwrap();
+        assert!(midpoint);
+        assert_eq!(t.elapsed_ms, 50);
+        assert_eq!(coverage(&t), 1.0);
+
+        let (t, midpoint) = step(t, 25);
+        let t = t.unwrap();
+        assert!(!midpoint);
+        assert!((coverage(&t) - 0.5).abs() < 1e-6);
+        assert_eq!(step(t, 25), (None, false));
+
+        // A zero-length transition still covers one tick.
+        let (t, midpoint) = step(transition(TransitionKind::Iris, 0), 16);
+        assert!(midpoint);
+        assert_eq!(step(t.unwrap(), 16), (None, false));
+    }
+
+    #[test]
+    fn covered_frames_are_the_color_and_fresh_ones_untouched() {
+        let fb: Vec<u32> = (0..64).map(|i| i * 0x010101).collect();
+        for kind in [
+            TransitionKind::Fade,
+            TransitionKind::DitherWipe,
+            TransitionKind::Pixelate,
+            TransitionKind::Iris,
+        ] {
+            let mut t = transition(kind, 100);
+            assert_eq!(cover(&t, fb.clone(), 8, 8), fb);
+            t.elapsed_ms = 50;
+            t.passed_midpoint = true;
+            assert!(cover(&t, fb.clone(), 8, 8).iter().all(|&p| p == 0x102030));
+        }
+    }
+
+    #[test]
+    fn the_wipe_sweeps_left_to_right() {
+        let mut t = transition(TransitionKind::DitherWipe, 100);
+        t.elapsed_ms = 25;
+        let out = cover(&t, vec![0xFFFFFF; 16 * 4], 16, 4);
+        let covered = |x: usize| (0..4).filter(|y| out[y * 16 + x] == 0x102030).count();
+        assert_eq!(covered(0), 4);
+        assert_eq!(covered(15), 0);
+    }
+}
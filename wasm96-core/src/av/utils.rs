@@ -1,7 +1,9 @@
 // Needed for `alloc::` in this crate.
 extern crate alloc;
 
-use crate::state::global;
+use crate::runtime::GuestLimits;
+use crate::state::{TINT_NONE, VideoState, global};
+use core::ops::Range;
 use wasmtime::Caller;
 
 // External crates for rendering
@@ -13,8 +15,22 @@ use alloc::vec::Vec;
 
 use super::AvError;
 
-pub fn read_guest_bytes(
-    caller: &mut Caller<'_, ()>,
+/// Whether `len` bytes at `ptr` lie inside the guest's memory. Checked before allocating
+/// buffers sized by the guest.
+pub fn guest_range_fits<T>(
+    caller: &mut Caller<'_, T>,
+    ptr: u32,
+    len: u32,
+) -> Result<bool, AvError> {
+    let memory = caller
+        .get_export("memory")
+        .and_then(|e| e.into_memory())
+        .ok_or(AvError::MissingMemory)?;
+    Ok(ptr as u64 + len as u64 <= memory.data_size(&*caller) as u64)
+}
+
+pub fn read_guest_bytes<T>(
+    caller: &mut Caller<'_, T>,
     ptr: u32,
     len: u32,
 ) -> Result<Vec<u8>, AvError> {
@@ -22,6 +38,9 @@ pub fn read_guest_bytes(
         .get_export("memory")
         .and_then(|e| e.into_memory())
         .ok_or(AvError::MissingMemory)?;
+    if ptr as u64 + len as u64 > memory.data_size(&*caller) as u64 {
+        return Err(AvError::MemoryReadFailed);
+    }
 
     let mut data = vec![0u8; len as usize];
     memory
@@ -30,8 +49,19 @@ pub fn read_guest_bytes(
     Ok(data)
 }
 
-pub fn graphics_line_internal(x1: i32, y1: i32, x2: i32, y2: i32) {
-    super::graphics::graphics_line(x1, y1, x2, y2);
+pub fn write_guest_bytes<T>(
+    caller: &mut Caller<'_, T>,
+    ptr: u32,
+    data: &[u8],
+) -> Result<(), AvError> {
+    let memory = caller
+        .get_export("memory")
+        .and_then(|e| e.into_memory())
+        .ok_or(AvError::MissingMemory)?;
+
+    memory
+        .write(&mut *caller, ptr as usize, data)
+        .map_err(|_| AvError::MemoryWriteFailed)
 }
 
 #[inline]
@@ -49,7 +79,8 @@ pub fn graphics_image_from_host(x: i32, y: i32, w: u32, h: u32, data: &[u8]) {
     };
     let screen_w = s.video.width as i32;
     let screen_h = s.video.height as i32;
-    let fb = &mut s.video.framebuffer;
+    let tint = s.video.tint;
+    let mut fb = Canvas::of(&mut s.video);
 
     let x_start = x.max(0);
     let y_start = y.max(0);
@@ -63,18 +94,216 @@ pub fn graphics_image_from_host(x: i32, y: i32, w: u32, h: u32, data: &[u8]) {
         for curr_x in x_start..x_end {
             let src_x = curr_x - x;
             let src_idx = src_row_start + (src_x as usize) * 4;
-            let r = data[src_idx];
-            let g = data[src_idx + 1];
-            let b = data[src_idx + 2];
-            let a = data[src_idx + 3];
-            if a > 0 {
-                let color = ((r as u32) << 16) | ((g as u32) << 8) | (b as u32);
-                fb[dst_row_start + (curr_x as usize)] = color;
+            let px = [
+                data[src_idx],
+                data[src_idx + 1],
+                data[src_idx + 2],
+                data[src_idx + 3],
+            ];
+            fb.image_pixel(dst_row_start + (curr_x as usize), px, tint);
+        }
+    }
+}
+
+/// The 2D draw target: the framebuffer and, on a layer or mask canvas, its coverage.
+///
+/// Draws write through [`Canvas::put`] and [`Canvas::blend`] so a canvas knows which pixels were
+/// drawn and how opaquely; the screen has no coverage and those are plain writes and blends.
+pub struct Canvas<'a> {
+    pub pixels: &'a mut [u32],
+    /// Empty for the screen; otherwise one entry per pixel (see `VideoState::coverage`).
+    pub coverage: &'a mut [u8],
+}
+
+impl<'a> Canvas<'a> {
+    pub fn of(video: &'a mut VideoState) -> Self {
+        Self {
+            pixels: &mut video.framebuffer,
+            coverage: &mut video.coverage,
+        }
+    }
+
+    /// Write `color` outright.
+    #[inline]
+    pub fn put(&mut self, i: usize, color: u32) {
+        self.pixels[i] = color;
+        if let Some(c) = self.coverage.get_mut(i) {
+            *c = 255;
+        }
+    }
+
+    /// Write `color` outright over a run of pixels.
+    pub fn fill(&mut self, range: Range<usize>, color: u32) {
+        if let Some(c) = self.coverage.get_mut(range.clone()) {
+            c.fill(255);
+        }
+        self.pixels[range].fill(color);
+    }
+
+    /// Draw over pixel `i` with opacity `a` (0..=1). `mix(dst, t)` returns the source mixed over
+    /// `dst` with weight `t`. On the screen `t` is `a`; on a canvas, the part of the pixel nothing
+    /// was drawn to yet doesn't count, so a source over an empty pixel comes out unmixed and the
+    /// pixel's coverage grows by `a` instead.
+    #[inline]
+    pub fn blend(&mut self, i: usize, a: f32, mix: impl FnOnce(u32, f32) -> u32) {
+        let t = match self.coverage.get_mut(i) {
+            None => a,
+            Some(c) => {
+                let below = *c as f32 / 255.0;
+                let covered = a + below * (1.0 - a);
+                *c = (covered * 255.0).round() as u8;
+                if covered > 0.0 { a / covered } else { 0.0 }
             }
+        };
+        self.pixels[i] = mix(self.pixels[i], t);
+    }
+
+    /// Draw an RGBA image pixel with `tint` (see [`tinted_pixel`]).
+    #[inline]
+    pub fn image_pixel(&mut self, i: usize, px: [u8; 4], tint: u32) {
+        match tinted_pixel(px, tint) {
+            None => {}
+            Some((color, 255)) => self.put(i, color),
+            Some((color, alpha)) => self.blend(i, alpha as f32 / 255.0, |dst, t| {
+                mix_rgb(dst, color, (t * 255.0).round() as u32)
+            }),
+        }
+    }
+}
+
+/// An RGBA image pixel's color multiplied by `tint` (0xAARRGGBB) and the opacity (0..=255) to
+/// draw it with, or `None` to leave the target alone.
+///
+/// With an opaque tint, any pixel with non-zero alpha is opaque, as images always have been;
+/// with a translucent tint, the opacity is the pixel's alpha times the tint's alpha.
+pub fn tinted_pixel([r, g, b, a]: [u8; 4], tint: u32) -> Option<(u32, u32)> {
+    if a == 0 {
+        return None;
+    }
+    if tint == TINT_NONE {
+        return Some((((r as u32) << 16) | ((g as u32) << 8) | (b as u32), 255));
+    }
+    let channel = |v: u8, shift: u32| (v as u32 * ((tint >> shift) & 0xFF) + 127) / 255;
+    let color = (channel(r, 16) << 16) | (channel(g, 8) << 8) | channel(b, 0);
+    let ta = tint >> 24;
+    if ta == 255 {
+        return Some((color, 255));
+    }
+    let alpha = (a as u32 * ta + 127) / 255;
+    (alpha > 0).then_some((color, alpha))
+}
+
+/// `src` mixed over `dst` by `alpha` (0..=255), per RGB channel.
+pub fn mix_rgb(dst: u32, src: u32, alpha: u32) -> u32 {
+    let channel = |shift: u32| {
+        let (s, d) = ((src >> shift) & 0xFF, (dst >> shift) & 0xFF);
+        (s * alpha + d * (255 - alpha) + 127) / 255
+    };
+    (channel(16) << 16) | (channel(8) << 8) | channel(0)
+}
+
+/// Mirror the image horizontally (bit of the `flags` argument to the `*_draw_ex` imports).
+pub const DRAW_FLIP_X: u32 = 1;
+/// Mirror the image vertically.
+pub const DRAW_FLIP_Y: u32 = 2;
+
+/// Placement for a rotated/flipped image draw.
+///
+/// The image is scaled to `w`x`h` with its unrotated top-left at (`x`, `y`), mirrored per `flags`,
+/// then rotated by `angle` radians (clockwise on screen) around the point (`pivot_x`, `pivot_y`)
+/// measured from that top-left.
+#[derive(Copy, Clone, Debug)]
+pub struct DrawEx {
+    pub x: i32,
+    pub y: i32,
+    pub w: u32,
+    pub h: u32,
+    pub angle: f32,
+    pub flags: u32,
+    pub pivot_x: i32,
+    pub pivot_y: i32,
+}
+
+/// Rasterize an RGBA image into an XRGB canvas with [`DrawEx`] placement, writing pixels
+/// through [`Canvas::image_pixel`] as [`graphics_image_from_host`] does. Sampling is
+/// nearest-neighbor.
+pub fn blit_ex(
+    fb: &mut Canvas,
+    (screen_w, screen_h): (u32, u32),
+    src: &[u8],
+    (src_w, src_h): (u32, u32),
+    d: DrawEx,
+    tint: u32,
+) {
+    if d.w == 0 || d.h == 0 || src_w == 0 || src_h == 0 {
+        return;
+    }
+    let (sin, cos) = d.angle.sin_cos();
+    let (w, h) = (d.w as f32, d.h as f32);
+    let (px, py) = (d.pivot_x as f32, d.pivot_y as f32);
+    let (cx, cy) = (d.x as f32 + px, d.y as f32 + py);
+
+    // Screen-space bounding box of the rotated rectangle.
+    let (mut min_x, mut min_y, mut max_x, mut max_y) = (f32::MAX, f32::MAX, f32::MIN, f32::MIN);
+    for (lx, ly) in [(0.0, 0.0), (w, 0.0), (0.0, h), (w, h)] {
+        let (rx, ry) = (lx - px, ly - py);
+        let sx = cx + rx * cos - ry * sin;
+        let sy = cy + rx * sin + ry * cos;
+        min_x = min_x.min(sx);
+        min_y = min_y.min(sy);
+        max_x = max_x.max(sx);
+        max_y = max_y.max(sy);
+    }
+    let x0 = (min_x.floor() as i64).max(0);
+    let y0 = (min_y.floor() as i64).max(0);
+    let x1 = (max_x.ceil() as i64).min(screen_w as i64);
+    let y1 = (max_y.ceil() as i64).min(screen_h as i64);
+
+    for sy in y0..y1 {
+        for sx in x0..x1 {
+            // Map the pixel center back into the unrotated image.
+            let rx = sx as f32 + 0.5 - cx;
+            let ry = sy as f32 + 0.5 - cy;
+            let mut u = rx * cos + ry * sin + px;
+            let mut v = -rx * sin + ry * cos + py;
+            if u < 0.0 || v < 0.0 || u >= w || v >= h {
+                continue;
+            }
+            if d.flags & DRAW_FLIP_X != 0 {
+                u = w - u;
+            }
+            if d.flags & DRAW_FLIP_Y != 0 {
+                v = h - v;
+            }
+            let tx = ((u / w * src_w as f32) as u32).min(src_w - 1);
+            let ty = ((v / h * src_h as f32) as u32).min(src_h - 1);
+            let i = ((ty as usize) * (src_w as usize) + tx as usize) * 4;
+            let Some(&px) = src.get(i..i + 4).and_then(|p| p.first_chunk::<4>()) else {
+                continue;
+            };
+            fb.image_pixel((sy as usize) * (screen_w as usize) + sx as usize, px, tint);
         }
     }
 }
 
+/// [`blit_ex`] into the global framebuffer.
+pub fn graphics_image_ex_from_host(src: &[u8], src_w: u32, src_h: u32, d: DrawEx) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let size = (s.video.width, s.video.height);
+    let tint = s.video.tint;
+    blit_ex(
+        &mut Canvas::of(&mut s.video),
+        size,
+        src,
+        (src_w, src_h),
+        d,
+        tint,
+    );
+}
+
 // Get current time in milliseconds
 pub fn system_millis() -> u64 {
     use std::time::{SystemTime, UNIX_EPOCH};
@@ -96,7 +325,7 @@ pub fn sat_add_i16(a: i16, b: i16) -> i16 {
     }
 }
 
-pub fn guest_alloc(env: &mut Caller<'_, ()>, len: u32) -> Option<u32> {
+pub fn guest_alloc(env: &mut Caller<'_, GuestLimits>, len: u32) -> Option<u32> {
     let _ = env;
     let _ = len;
     // We don't have direct access to the instance here; allocation exports must be wired
@@ -104,7 +333,7 @@ pub fn guest_alloc(env: &mut Caller<'_, ()>, len: u32) -> Option<u32> {
     None
 }
 
-pub fn guest_free(env: &mut Caller<'_, ()>, ptr: u32, len: u32) {
+pub fn guest_free(env: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) {
     let _ = env;
     let _ = ptr;
     let _ = len;
@@ -4,11 +4,30 @@
 //! - Provide a stable ABI-facing set of input queries (joypad/keyboard/mouse).
 //! - Implement those queries by calling into libretro callbacks.
 //! - Optionally cache/snapshot inputs per-frame for determinism.
+//! - Record and replay per-tick input traces (`replay`).
+//! - Hand the guest the whole tick's input in one call (`snapshot`).
+
+pub mod replay;
+pub mod snapshot;
 
 use crate::abi::Button;
-use crate::state;
+use crate::state::{self, BUTTONS_PER_PORT, MAX_PORTS, MAX_TOUCHES, Touch, TouchPhase};
 use libretro_sys::*;
 
+/// `RETRO_DEVICE_ID_POINTER_COUNT` (not exported by libretro-sys).
+const DEVICE_ID_POINTER_COUNT: u32 = 3;
+
+/// Typed text beyond this many bytes is dropped until the guest drains the queue.
+pub const MAX_TEXT_INPUT_BYTES: usize = 4096;
+
+// libretro key codes (`RETROK_*`) that produce editing characters.
+const RETROK_BACKSPACE: u32 = 8;
+const RETROK_RETURN: u32 = 13;
+const RETROK_KP_ENTER: u32 = 271;
+
+/// Low bits of a libretro device id hold the base device type.
+const DEVICE_MASK: u32 = 0xff;
+
 /// Convert ABI joypad button id into libretro device ID.
 fn map_joypad_button(button: u32) -> Option<u32> {
     match button {
@@ -32,33 +51,88 @@ fn map_joypad_button(button: u32) -> Option<u32> {
     }
 }
 
-/// Query whether a given joypad button is pressed.
+/// Query whether a given joypad button is pressed this frame.
 ///
 /// Returns 1 if pressed, else 0.
 pub fn joypad_button_pressed(port: u32, button: u32) -> u32 {
-    let Some(id) = map_joypad_button(button) else {
+    if map_joypad_button(button).is_none() {
         return 0;
-    };
-
-    let cb = {
-        let s = state::global().lock().unwrap();
-        s.input_state_cb
-    };
+    }
+    let s = state::global().lock().unwrap();
+    let held = s.input.buttons.get(port as usize).copied().unwrap_or(0);
+    (held >> button) & 1
+}
 
-    if let Some(input_state) = cb {
-        unsafe {
-            let val = input_state(port, DEVICE_JOYPAD, 0, id);
-            if val != 0 { 1 } else { 0 }
+/// Query libretro for every joypad button on every port, as ABI-button bitmasks.
+fn poll_buttons(input_state: InputStateFn) -> [u32; MAX_PORTS] {
+    let mut buttons = [0; MAX_PORTS];
+    for (port, held) in buttons.iter_mut().enumerate() {
+        for button in 0..BUTTONS_PER_PORT as u32 {
+            let Some(id) = map_joypad_button(button) else {
+                continue;
+            };
+            if unsafe { input_state(port as u32, DEVICE_JOYPAD, 0, id) } != 0 {
+                *held |= 1 << button;
+            }
         }
-    } else {
-        0
     }
+    buttons
+}
+
+/// Query whether a given key is pressed this frame.
+pub fn key_pressed(key: u32) -> u32 {
+    let s = state::global().lock().unwrap();
+    s.input.keys.get(key as usize).copied().unwrap_or(false) as u32
 }
 
-/// Query whether a given key is pressed.
-pub fn key_pressed(_key: u32) -> u32 {
-    // TODO(libretro): wire to real keyboard input via libretro if/when exposed.
-    0
+/// Milliseconds `btn` on `port` has been held (0 on the tick it went down, and while released).
+pub fn button_held_millis(port: u32, button: u32) -> u32 {
+    let s = state::global().lock().unwrap();
+    s.input
+        .button_held_millis
+        .get(port as usize)
+        .and_then(|p| p.get(button as usize))
+        .copied()
+        .flatten()
+        .unwrap_or(0)
+}
+
+/// Milliseconds `key` has been held (0 on the tick it went down, and while released).
+pub fn key_held_millis(key: u32) -> u32 {
+    let s = state::global().lock().unwrap();
+    s.input
+        .key_held_millis
+        .get(key as usize)
+        .copied()
+        .flatten()
+        .unwrap_or(0)
+}
+
+/// Advance one hold timer: starts at 0 when the input goes down, grows by `dt` while it stays
+/// down, and clears when it's released.
+fn step_hold(timer: &mut Option<u32>, down: bool, dt: u32) {
+    *timer = down.then(|| timer.map_or(0, |t| t.saturating_add(dt)));
+}
+
+/// Advance the button and key hold timers by this tick's delta.
+///
+/// Called once per guest tick, after replayed input is applied, so hold times replay too.
+pub fn tick_hold_timers() {
+    let mut s = state::global().lock().unwrap();
+    let dt = s.timing.delta_millis.min(u32::MAX as u64) as u32;
+    let input = &mut s.input;
+    for (held, timers) in input
+        .buttons
+        .iter()
+        .zip(input.button_held_millis.iter_mut())
+    {
+        for (button, timer) in timers.iter_mut().enumerate() {
+            step_hold(timer, held >> button & 1 != 0, dt);
+        }
+    }
+    for (&down, timer) in input.keys.iter().zip(input.key_held_millis.iter_mut()) {
+        step_hold(timer, down, dt);
+    }
 }
 
 /// Mouse X coordinate.
@@ -79,6 +153,235 @@ pub fn mouse_buttons() -> u32 {
     s.input.mouse_buttons
 }
 
+/// Record the device the frontend assigned to `port` (from `retro_set_controller_port_device`).
+///
+/// libretro has no separate hot-plug event; a port's device changing mid-game is reported to the
+/// guest as a hot-plug.
+pub fn set_port_device(port: u32, device: u32) {
+    let mut s = state::global().lock().unwrap();
+    let Some(slot) = s.input.port_devices.get_mut(port as usize) else {
+        return;
+    };
+    if *slot != device {
+        *slot = device;
+        s.input.ports_changed_pending = true;
+    }
+}
+
+/// Bitmask of ports with a device assigned (bit N = port N).
+pub fn connected_ports_mask(devices: &[u32]) -> u32 {
+    devices
+        .iter()
+        .enumerate()
+        .filter(|(_, d)| **d & DEVICE_MASK != DEVICE_NONE)
+        .fold(0, |mask, (port, _)| mask | (1 << port))
+}
+
+/// Human-readable name for a libretro device id, or `None` for `DEVICE_NONE`.
+///
+/// Subclassed devices (`RETRO_DEVICE_SUBCLASS`) are named after their base type.
+pub fn device_name(device: u32) -> Option<&'static str> {
+    match device & DEVICE_MASK {
+        DEVICE_JOYPAD => Some("RetroPad"),
+        DEVICE_MOUSE => Some("Mouse"),
+        DEVICE_KEYBOARD => Some("Keyboard"),
+        DEVICE_LIGHTGUN => Some("Lightgun"),
+        DEVICE_ANALOG => Some("Analog RetroPad"),
+        DEVICE_POINTER => Some("Pointer"),
+        DEVICE_NONE => None,
+        _ => Some("Unknown"),
+    }
+}
+
+/// Bitmask of connected ports.
+pub fn connected_ports() -> u32 {
+    let s = state::global().lock().unwrap();
+    connected_ports_mask(&s.input.port_devices)
+}
+
+/// Name of the controller in `port`, as a blob id (0 if nothing is connected).
+pub fn controller_name(port: u32) -> u32 {
+    let device = {
+        let s = state::global().lock().unwrap();
+        s.input.port_devices.get(port as usize).copied()
+    };
+    match device.and_then(device_name) {
+        Some(name) => crate::system::blobs::store(name.as_bytes().to_vec()),
+        None => 0,
+    }
+}
+
+/// Whether any port's device changed just before this frame. Returns 1 or 0.
+pub fn ports_changed() -> u32 {
+    let s = state::global().lock().unwrap();
+    s.input.ports_changed as u32
+}
+
+/// Map a libretro pointer coordinate (-0x7fff..=0x7fff) to a pixel in `0..size`.
+pub fn pointer_to_screen(v: i16, size: u32) -> i32 {
+    let size = size.max(1) as i64;
+    let px = (v as i64 + 0x7fff) * size / 0xfffe;
+    px.clamp(0, size - 1) as i32
+}
+
+/// Advance touch tracking by one frame.
+///
+/// `current[i]` is the position of libretro pointer `i` if it is pressed. Returns the touches to
+/// report this frame: new ones as `Began`, held ones as `Moved`/`Stationary`, and lifted ones as
+/// `Ended` (once).
+pub fn step_touches(
+    slots: &mut [Option<Touch>; MAX_TOUCHES],
+    current: &[Option<(i32, i32)>; MAX_TOUCHES],
+    next_id: &mut u32,
+) -> Vec<Touch> {
+    let mut out = Vec::new();
+    for (slot, pos) in slots.iter_mut().zip(current) {
+        match (slot.as_mut(), *pos) {
+            (None, Some((x, y))) => {
+                let touch = Touch {
+                    id: *next_id,
+                    x,
+                    y,
+                    phase: TouchPhase::Began,
+                };
+                *next_id = next_id.wrapping_add(1).max(1);
+                *slot = Some(touch);
+                out.push(touch);
+            }
+            (Some(touch), Some((x, y))) => {
+                touch.phase = if (touch.x, touch.y) == (x, y) {
+                    TouchPhase::Stationary
+                } else {
+                    TouchPhase::Moved
+                };
+                touch.x = x;
+                touch.y = y;
+                out.push(*touch);
+            }
+            (Some(touch), None) => {
+                out.push(Touch {
+                    phase: TouchPhase::Ended,
+                    ..*touch
+                });
+                *slot = None;
+            }
+            (None, None) => {}
+        }
+    }
+    out
+}
+
+/// Query libretro's pointer device for pressed touch points, in screen pixels. Pointer
+/// coordinates span the presented frame, which `view` maps back to the framebuffer.
+fn poll_pointers(
+    input_state: InputStateFn,
+    view: &crate::av::scaling::Viewport,
+    width: u32,
+    height: u32,
+) -> [Option<(i32, i32)>; MAX_TOUCHES] {
+    let mut current = [None; MAX_TOUCHES];
+    unsafe {
+        // Frontends that predate POINTER_COUNT return 0; fall back to probing each index.
+        let count = match input_state(0, DEVICE_POINTER, 0, DEVICE_ID_POINTER_COUNT) {
+            n if n > 0 => (n as usize).min(MAX_TOUCHES),
+            _ => MAX_TOUCHES,
+        };
+        for (i, slot) in current.iter_mut().enumerate().take(count) {
+            let index = i as u32;
+            if input_state(0, DEVICE_POINTER, index, DEVICE_ID_POINTER_PRESSED) == 0 {
+                continue;
+            }
+            let x = input_state(0, DEVICE_POINTER, index, DEVICE_ID_POINTER_X);
+            let y = input_state(0, DEVICE_POINTER, index, DEVICE_ID_POINTER_Y);
+            let (wx, wy) = (
+                pointer_to_screen(x, view.window.0),
+                pointer_to_screen(y, view.window.1),
+            );
+            *slot = Some(view.to_screen(wx, wy, width, height));
+        }
+    }
+    current
+}
+
+/// Number of touches reported this frame.
+pub fn touch_count() -> u32 {
+    let s = state::global().lock().unwrap();
+    s.input.touches.len() as u32
+}
+
+/// Touch `index` this frame, if it exists.
+pub fn touch(index: u32) -> Option<Touch> {
+    let s = state::global().lock().unwrap();
+    s.input.touches.get(index as usize).copied()
+}
+
+/// Enable or disable mirroring the first touch to the mouse.
+pub fn set_touch_mouse(enabled: bool) {
+    let mut s = state::global().lock().unwrap();
+    s.input.touch_mouse = enabled;
+}
+
+/// The text a keyboard event contributes, if any.
+///
+/// Printable characters come through as-is (the frontend has already applied shift state and
+/// layout). Backspace becomes `'\u{8}'` and Enter becomes `'\n'` so name-entry fields can edit.
+pub fn text_for_key_event(down: bool, keycode: u32, character: u32) -> Option<char> {
+    if !down {
+        return None;
+    }
+    match keycode {
+        RETROK_BACKSPACE => return Some('\u{8}'),
+        RETROK_RETURN | RETROK_KP_ENTER => return Some('\n'),
+        _ => {}
+    }
+    char::from_u32(character).filter(|c| !c.is_control())
+}
+
+/// Keyboard callback from the frontend. Tracks held keys (latched at the next frame snapshot)
+/// and queues typed text while text input is active.
+pub fn on_keyboard_event(down: bool, keycode: u32, character: u32) {
+    let mut s = match state::global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    if let Some(held) = s.input.keys_pending.get_mut(keycode as usize) {
+        *held = down;
+    }
+    let Some(c) = text_for_key_event(down, keycode, character) else {
+        return;
+    };
+    if s.input.text_input_active && s.input.text_input.len() + c.len_utf8() <= MAX_TEXT_INPUT_BYTES
+    {
+        s.input.text_input.push(c);
+    }
+}
+
+/// Start collecting typed text. Anything typed before this is discarded.
+pub fn text_input_start() {
+    let mut s = state::global().lock().unwrap();
+    s.input.text_input_active = true;
+    s.input.text_input.clear();
+}
+
+/// Stop collecting typed text and drop anything not yet read.
+pub fn text_input_stop() {
+    let mut s = state::global().lock().unwrap();
+    s.input.text_input_active = false;
+    s.input.text_input.clear();
+}
+
+/// Drain the typed-text queue into a blob. Returns 0 if nothing was typed.
+pub fn take_text_input() -> u32 {
+    let text = {
+        let mut s = state::global().lock().unwrap();
+        std::mem::take(&mut s.input.text_input)
+    };
+    if text.is_empty() {
+        return 0;
+    }
+    crate::system::blobs::store(text.into_bytes())
+}
+
 /// Snapshot inputs for the current frame into `state::InputState`.
 ///
 /// Call this once per `on_run` before invoking guest `wasm96_frame`.
@@ -91,5 +394,117 @@ pub fn snapshot_per_frame() {
     // s.input.mouse_y = ...
     // s.input.mouse_buttons = ...
 
-    let _ = &mut *s;
+    // Latch hot-plug changes so the flag is stable for the whole frame.
+    s.input.ports_changed = std::mem::take(&mut s.input.ports_changed_pending);
+    s.input.keys = s.input.keys_pending;
+
+    // Touch: query outside the lock (the callback may be slow), then fold into state.
+    let cb = s.input_state_cb;
+    let (width, height) = (s.video.width, s.video.height);
+    let view = crate::av::scaling::current_viewport(&s.video);
+    drop(s);
+    let (buttons, current) = match cb {
+        Some(input_state) => (
+            poll_buttons(input_state),
+            poll_pointers(input_state, &view, width, height),
+        ),
+        None => ([0; MAX_PORTS], [None; MAX_TOUCHES]),
+    };
+
+    let mut s = state::global().lock().unwrap();
+    let input = &mut s.input;
+    input.buttons = buttons;
+    input.touches = step_touches(&mut input.touch_slots, &current, &mut input.next_touch_id);
+    let first = input.touches.first().copied();
+    if let (true, Some(first)) = (input.touch_mouse, first) {
+        input.mouse_x = first.x;
+        input.mouse_y = first.y;
+        if first.phase == TouchPhase::Ended {
+            input.mouse_buttons &= !1;
+        } else {
+            input.mouse_buttons |= 1;
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn pointer_coordinates_map_to_screen_edges() {
+        assert_eq!(pointer_to_screen(-0x7fff, 320), 0);
+        assert_eq!(pointer_to_screen(0, 320), 160);
+        assert_eq!(pointer_to_screen(0x7fff, 320), 319);
+        assert_eq!(pointer_to_screen(i16::MIN, 240), 0);
+    }
+
+    #[test]
+    fn touches_move_through_phases_with_stable_ids() {
+        let mut slots = [None; MAX_TOUCHES];
+        let mut next_id = 1;
+        let mut current = [None; MAX_TOUCHES];
+
+        current[0] = Some((10, 20));
+        let t = step_touches(&mut slots, &current, &mut next_id);
+        assert_eq!(t.len(), 1);
+        assert_eq!((t[0].id, t[0].phase), (1, TouchPhase::Began));
+
+        current[1] = Some((50, 60));
+        let t = step_touches(&mut slots, &current, &mut next_id);
+        assert_eq!(t[0].phase, TouchPhase::Stationary);
+        assert_eq!((t[1].id, t[1].phase), (2, TouchPhase::Began));
+
+        current[0] = Some((11, 20));
+        current[1] = None;
+        let t = step_touches(&mut slots, &current, &mut next_id);
+        assert_eq!((t[0].id, t[0].phase, t[0].x), (1, TouchPhase::Moved, 11));
+        assert_eq!((t[1].id, t[1].phase, t[1].x), (2, TouchPhase::Ended, 50));
+
+        let t = step_touches(&mut slots, &current, &mut next_id);
+        assert_eq!(t.len(), 1);
+
+        // A new touch in a freed slot gets a fresh id.
+        current[1] = Some((0, 0));
+        let t = step_touches(&mut slots, &current, &mut next_id);
+        assert_eq!(t[1].id, 3);
+    }
+
+    #[test]
+    fn key_events_produce_text_and_edit_characters() {
+        assert_eq!(text_for_key_event(true, 97, 'A' as u32), Some('A'));
+        assert_eq!(text_for_key_event(true, 0, 'é' as u32), Some('é'));
+        assert_eq!(text_for_key_event(false, 97, 'a' as u32), None);
+        assert_eq!(text_for_key_event(true, RETROK_BACKSPACE, 8), Some('\u{8}'));
+        assert_eq!(text_for_key_event(true, RETROK_RETURN, 13), Some('\n'));
+        // Modifier keys report no character.
+        assert_eq!(text_for_key_event(true, 304, 0), None);
+    }
+
+    #[test]
+    fn hold_timers_start_at_zero_and_clear_on_release() {
+        let mut timer = None;
+        step_hold(&mut timer, true, 16);
+        assert_eq!(timer, Some(0));
+        step_hold(&mut timer, true, 16);
+        step_hold(&mut timer, true, 17);
+        assert_eq!(timer, Some(33));
+        step_hold(&mut timer, false, 16);
+        assert_eq!(timer, None);
+    }
+
+    #[test]
+    fn connected_mask_sets_a_bit_per_assigned_port() {
+        let devices = [DEVICE_JOYPAD, DEVICE_NONE, DEVICE_ANALOG, DEVICE_NONE];
+        assert_eq!(connected_ports_mask(&devices), 0b101);
+        assert_eq!(connected_ports_mask(&[DEVICE_NONE; 4]), 0);
+    }
+
+    #[test]
+    fn device_names_use_the_base_type() {
+        assert_eq!(device_name(DEVICE_JOYPAD), Some("RetroPad"));
+        // RETRO_DEVICE_SUBCLASS(DEVICE_JOYPAD, 0)
+        assert_eq!(device_name((1 << 8) | DEVICE_JOYPAD), Some("RetroPad"));
+        assert_eq!(device_name(DEVICE_NONE), None);
+    }
 }
@@ -0,0 +1,376 @@
+//! Input recording and deterministic replay.
+//!
+//! While recording, the input the guest sees on each tick (joypad buttons, keys, mouse, touches),
+//! the tick's delta time and the number of `update`s it ran are appended to a trace. Replaying a trace feeds those frames back in
+//! place of live input, one per tick, and restores the host RNG seed captured when recording
+//! started, so a cart that only reads input, `delta_millis` and `random` reproduces the same run.
+//! Live input resumes when the trace runs out.
+//!
+//! Trace layout (little-endian):
+//! - header: `b"W96R"`, version `u8`, RNG seed `u64`
+//! - per tick: buttons `u16` x `MAX_PORTS`, held keys as a bitmap of `KEY_BYTES` bytes (key `k`
+//!   is bit `k % 8` of byte `k / 8`), mouse x `i32`, mouse y `i32`, mouse buttons `u8`, delta
+//!   millis `u16`, updates `u8`, touch count `u8`, then per touch: id `u32`, x `i32`, y `i32`, phase `u8`
+//!
+//! Typed text and wall-clock `millis` are not recorded.
+
+use wasmtime::Caller;
+
+use crate::av::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::{self, InputState, MAX_KEYS, MAX_PORTS, MAX_TOUCHES, Touch, TouchPhase};
+
+const MAGIC: &[u8; 4] = b"W96R";
+const VERSION: u8 = 3;
+const HEADER_LEN: usize = 4 + 1 + 8;
+
+/// Bytes of the per-tick key bitmap.
+const KEY_BYTES: usize = MAX_KEYS.div_ceil(8);
+
+/// Recording stops growing after this many ticks (an hour at 60 Hz).
+pub const MAX_RECORD_FRAMES: u32 = 60 * 60 * 60;
+
+/// One tick of recorded input.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Frame {
+    pub buttons: [u16; MAX_PORTS],
+    /// Held keys, one bit per keycode.
+    pub keys: [u8; KEY_BYTES],
+    pub mouse_x: i32,
+    pub mouse_y: i32,
+    pub mouse_buttons: u8,
+    pub delta_millis: u16,
+    /// `update` calls the tick ran. With a fixed update rate this follows the wall clock, so it
+    /// is replayed rather than worked out again from `delta_millis`.
+    pub updates: u8,
+    pub touches: Vec<Touch>,
+}
+
+impl Frame {
+    /// Capture the input the guest currently sees.
+    pub fn capture(input: &InputState, delta_millis: u64, updates: u32) -> Self {
+        Self {
+            buttons: input.buttons.map(|b| b as u16),
+            keys: pack_keys(&input.keys),
+            mouse_x: input.mouse_x,
+            mouse_y: input.mouse_y,
+            mouse_buttons: input.mouse_buttons as u8,
+            delta_millis: delta_millis.min(u16::MAX as u64) as u16,
+            updates: updates.min(u8::MAX as u32) as u8,
+            touches: input.touches.iter().take(MAX_TOUCHES).copied().collect(),
+        }
+    }
+
+    /// Overwrite the guest-visible input with this frame.
+    pub fn apply(&self, input: &mut InputState) {
+        input.buttons = self.buttons.map(u32::from);
+        for (k, held) in input.keys.iter_mut().enumerate() {
+            *held = self.keys[k / 8] >> (k % 8) & 1 != 0;
+        }
+        input.mouse_x = self.mouse_x;
+        input.mouse_y = self.mouse_y;
+        input.mouse_buttons = self.mouse_buttons as u32;
+        input.touches = self.touches.clone();
+    }
+
+    pub fn encode(&self, out: &mut Vec<u8>) {
+        for b in self.buttons {
+            out.extend_from_slice(&b.to_le_bytes());
+        }
+        out.extend_from_slice(&self.keys);
+        out.extend_from_slice(&self.mouse_x.to_le_bytes());
+        out.extend_from_slice(&self.mouse_y.to_le_bytes());
+        out.push(self.mouse_buttons);
+        out.extend_from_slice(&self.delta_millis.to_le_bytes());
+        out.push(self.updates);
+        out.push(self.touches.len() as u8);
+        for t in &self.touches {
+            out.extend_from_slice(&t.id.to_le_bytes());
+            out.extend_from_slice(&t.x.to_le_bytes());
+            out.extend_from_slice(&t.y.to_le_bytes());
+            out.push(t.phase as u8);
+        }
+    }
+
+    /// Decode the frame at `*pos`, advancing it. `None` at the end of the trace or on bad data.
+    pub fn decode(data: &[u8], pos: &mut usize) -> Option<Self> {
+        let mut r = Reader { data, pos: *pos };
+        let mut buttons = [0u16; MAX_PORTS];
+        for b in &mut buttons {
+            *b = u16::from_le_bytes(r.take()?);
+        }
+        let keys = r.take()?;
+        let mouse_x = i32::from_le_bytes(r.take()?);
+        let mouse_y = i32::from_le_bytes(r.take()?);
+        let [mouse_buttons] = r.take()?;
+        let delta_millis = u16::from_le_bytes(r.take()?);
+        let [updates] = r.take()?;
+        let [count] = r.take()?;
+        if count as usize > MAX_TOUCHES {
+            return None;
+        }
+        let mut touches = Vec::with_capacity(count as usize);
+        for _ in 0..count {
+            let id = u32::from_le_bytes(r.take()?);
+            let x = i32::from_le_bytes(r.take()?);
+            let y = i32::from_le_bytes(r.take()?);
+            let phase = match r.take::<1>()? {
+                [0] => TouchPhase::Began,
+                [1] => TouchPhase::Moved,
+                [2] => TouchPhase::Stationary,
+                [3] => TouchPhase::Ended,
+                _ => return None,
+            };
+            touches.push(Touch { id, x, y, phase });
+        }
+        *pos = r.pos;
+        Some(Self {
+            buttons,
+            keys,
+            mouse_x,
+            mouse_y,
+            mouse_buttons,
+            delta_millis,
+            updates,
+            touches,
+        })
+    }
+}
+
+/// `keys` as a bitmap, key `k` in bit `k % 8` of byte `k / 8`.
+fn pack_keys(keys: &[bool; MAX_KEYS]) -> [u8; KEY_BYTES] {
+    let mut bits = [0; KEY_BYTES];
+    for (k, _) in keys.iter().enumerate().filter(|(_, held)| **held) {
+        bits[k / 8] |= 1 << (k % 8);
+    }
+    bits
+}
+
+struct Reader<'a> {
+    data: &'a [u8],
+    pos: usize,
+}
+
+impl Reader<'_> {
+    fn take<const N: usize>(&mut self) -> Option<[u8; N]> {
+        let bytes = self.data.get(self.pos..self.pos + N)?;
+        self.pos += N;
+        bytes.try_into().ok()
+    }
+}
+
+/// Trace header for a recording seeded with `seed`.
+pub fn encode_header(seed: u64) -> Vec<u8> {
+    let mut out = Vec::with_capacity(HEADER_LEN);
+    out.extend_from_slice(MAGIC);
+    out.push(VERSION);
+    out.extend_from_slice(&seed.to_le_bytes());
+    out
+}
+
+/// The RNG seed from a trace header, or `None` if `data` isn't a trace.
+pub fn decode_header(data: &[u8]) -> Option<u64> {
+    if data.len() < HEADER_LEN || &data[..4] != MAGIC || data[4] != VERSION {
+        return None;
+    }
+    Some(u64::from_le_bytes(data[5..HEADER_LEN].try_into().ok()?))
+}
+
+/// Start recording, discarding any previous recording. Reseeds the host RNG so the seed can be
+/// stored in the trace.
+pub fn record_start() {
+    let seed = crate::system::random_seed();
+    let mut s = state::global().lock().unwrap();
+    s.rng.state = Some(seed);
+    s.replay.recording = Some(encode_header(seed));
+    s.replay.recorded_frames = 0;
+}
+
+/// Stop recording and return the trace as a blob id (0 if not recording).
+pub fn record_stop() -> u32 {
+    let trace = {
+        let mut s = state::global().lock().unwrap();
+        s.replay.recording.take()
+    };
+    match trace {
+        Some(trace) => crate::system::blobs::store(trace),
+        None => 0,
+    }
+}
+
+/// Start replaying `data` from the next tick. Returns false if it isn't a valid trace.
+pub fn replay_start(data: Vec<u8>) -> bool {
+    let Some(seed) = decode_header(&data) else {
+        return false;
+    };
+    let mut s = state::global().lock().unwrap();
+    s.rng.state = Some(seed);
+    s.replay.playback = Some((data, HEADER_LEN));
+    true
+}
+
+pub fn replay_start_guest(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    match read_guest_bytes(caller, ptr, len) {
+        Ok(data) => replay_start(data) as u32,
+        Err(_) => 0,
+    }
+}
+
+/// Whether a trace is still being replayed. Returns 1 or 0.
+pub fn is_replaying() -> u32 {
+    let s = state::global().lock().unwrap();
+    s.replay.playback.is_some() as u32
+}
+
+/// Called once per guest tick, after input and timing are latched and before `update`.
+///
+/// Replaces live input and timing with the next replayed frame, or appends them to the recording.
+pub fn tick() {
+    let mut s = match state::global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let s = &mut *s;
+
+    if let Some((data, pos)) = s.replay.playback.as_mut() {
+        match Frame::decode(data, pos) {
+            Some(frame) => {
+                frame.apply(&mut s.input);
+                s.timing.delta_millis = frame.delta_millis as u64;
+                s.timing.updates_due = frame.updates as u32;
+            }
+            None => s.replay.playback = None,
+        }
+    }
+
+    if let Some(trace) = s.replay.recording.as_mut()
+        && s.replay.recorded_frames < MAX_RECORD_FRAMES
+    {
+        Frame::capture(&s.input, s.timing.delta_millis, s.timing.updates_due).encode(trace);
+        s.replay.recorded_frames += 1;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn sample_frame() -> Frame {
+        let mut buttons = [0; MAX_PORTS];
+        buttons[0] = 1 << 8;
+        buttons[3] = 0xffff;
+        let mut keys = [0; KEY_BYTES];
+        keys[0] = 0b1000_0001;
+        keys[KEY_BYTES - 1] = 0b1000;
+        Frame {
+            buttons,
+            keys,
+            mouse_x: -5,
+            mouse_y: 300,
+            mouse_buttons: 1,
+            delta_millis: 16,
+            updates: 2,
+            touches: vec![Touch {
+                id: 7,
+                x: 10,
+                y: 20,
+                phase: TouchPhase::Moved,
+            }],
+        }
+    }
+
+    #[test]
+    fn frames_round_trip() {
+        let mut trace = encode_header(42);
+        sample_frame().encode(&mut trace);
+        Frame {
+            touches: Vec::new(),
+            ..sample_frame()
+        }
+        .encode(&mut trace);
+
+        assert_eq!(decode_header(&trace), Some(42));
+        let mut pos = HEADER_LEN;
+        assert_eq!(Frame::decode(&trace, &mut pos), Some(sample_frame()));
+        assert!(Frame::decode(&trace, &mut pos).unwrap().touches.is_empty());
+        assert_eq!(pos, trace.len());
+        assert_eq!(Frame::decode(&trace, &mut pos), None);
+    }
+
+    #[test]
+    fn rejects_foreign_or_truncated_data() {
+        assert_eq!(decode_header(b"not a trace"), None);
+        let mut bad_version = encode_header(1);
+        bad_version[4] = 99;
+        assert_eq!(decode_header(&bad_version), None);
+
+        let mut trace = encode_header(1);
+        sample_frame().encode(&mut trace);
+        trace.pop();
+        let mut pos = HEADER_LEN;
+        assert_eq!(Frame::decode(&trace, &mut pos), None);
+        assert_eq!(pos, HEADER_LEN);
+    }
+
+    #[test]
+    fn hold_times_and_updates_reproduce_under_replay() {
+        const KEY: usize = 97;
+        // Held state, delta time and updates due of each tick.
+        let ticks = [
+            (true, 16, 1),
+            (true, 33, 2),
+            (false, 16, 1),
+            (true, 20, 0),
+            (true, 17, 1),
+        ];
+        let run = |keys: &dyn Fn(bool) -> bool,
+                   delta: &dyn Fn(u64) -> u64,
+                   updates: &dyn Fn(u32) -> u32| {
+            ticks
+                .iter()
+                .map(|&(down, dt, due)| {
+                    {
+                        let mut s = state::global().lock().unwrap();
+                        s.input.keys[KEY] = keys(down);
+                        s.timing.delta_millis = delta(dt);
+                        s.timing.updates_due = updates(due);
+                    }
+                    tick();
+                    crate::input::tick_hold_timers();
+                    let s = state::global().lock().unwrap();
+                    (s.input.key_held_millis[KEY], s.timing.updates_due)
+                })
+                .collect::<Vec<_>>()
+        };
+
+        state::clear_on_unload();
+        record_start();
+        let recorded = run(&|down| down, &|dt| dt, &|due| due);
+        let trace = state::global()
+            .lock()
+            .unwrap()
+            .replay
+            .recording
+            .take()
+            .unwrap();
+        assert!(
+            recorded
+                .iter()
+                .any(|(held, _)| held.is_some_and(|ms| ms > 0))
+        );
+
+        // Live input and timing differ completely during the replay.
+        state::clear_on_unload();
+        assert!(replay_start(trace));
+        let replayed = run(&|down| !down, &|_| 1_000, &|_| 8);
+        assert_eq!(replayed, recorded);
+    }
+
+    #[test]
+    fn capture_and_apply_mirror_input_state() {
+        let frame = sample_frame();
+        let mut input = InputState::default();
+        frame.apply(&mut input);
+        assert_eq!(Frame::capture(&input, 16, 2), frame);
+    }
+}
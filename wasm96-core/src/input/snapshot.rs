@@ -0,0 +1,111 @@
+//! The whole input state for a tick in one import call.
+//!
+//! Polling every button on every port plus the mouse and keys costs dozens of host calls a
+//! tick; `wasm96_input_snapshot` writes it all to guest memory at once.
+//!
+//! Layout (little-endian, [`SNAPSHOT_SIZE`] bytes):
+//! - `0..16`: buttons held, one `u16` per port (bit N = ABI `Button` N)
+//! - `16..32`: buttons that went down this tick, same layout
+//! - `32`: connected ports mask `u32`
+//! - `36`: mouse x `i32`, `40`: mouse y `i32`, `44`: mouse buttons `u32`
+//! - `48..96`: keys held, a bitmap (key N = bit `N % 8` of byte `N / 8`)
+//! - `96..144`: keys that went down this tick, same layout
+
+use wasmtime::Caller;
+
+use crate::av::utils::write_guest_bytes;
+use crate::input::connected_ports_mask;
+use crate::runtime::GuestLimits;
+use crate::state::{self, InputState, MAX_KEYS, MAX_PORTS};
+
+/// Bytes written by `wasm96_input_snapshot`.
+pub const SNAPSHOT_SIZE: usize = 144;
+
+const PRESSED: usize = 16;
+const CONNECTED: usize = 32;
+const MOUSE: usize = 36;
+const KEYS: usize = 48;
+const KEYS_PRESSED: usize = 96;
+/// Bytes per key bitmap (room for 384 keys).
+const KEY_BITMAP: usize = 48;
+
+const _: () = assert!(MAX_KEYS <= KEY_BITMAP * 8 && MAX_PORTS * 2 == PRESSED);
+
+/// Pack `input` as the snapshot layout.
+pub fn encode(input: &InputState) -> [u8; SNAPSHOT_SIZE] {
+    let mut out = [0; SNAPSHOT_SIZE];
+    for port in 0..MAX_PORTS {
+        let held = input.buttons[port] as u16;
+        let pressed = input.button_held_millis[port]
+            .iter()
+            .enumerate()
+            .filter(|(_, t)| **t == Some(0))
+            .fold(0u16, |mask, (button, _)| mask | 1 << button);
+        out[port * 2..port * 2 + 2].copy_from_slice(&held.to_le_bytes());
+        out[PRESSED + port * 2..PRESSED + port * 2 + 2].copy_from_slice(&pressed.to_le_bytes());
+    }
+    let connected = connected_ports_mask(&input.port_devices);
+    out[CONNECTED..CONNECTED + 4].copy_from_slice(&connected.to_le_bytes());
+    out[MOUSE..MOUSE + 4].copy_from_slice(&input.mouse_x.to_le_bytes());
+    out[MOUSE + 4..MOUSE + 8].copy_from_slice(&input.mouse_y.to_le_bytes());
+    out[MOUSE + 8..MOUSE + 12].copy_from_slice(&input.mouse_buttons.to_le_bytes());
+    for key in 0..MAX_KEYS {
+        if input.keys[key] {
+            out[KEYS + key / 8] |= 1 << (key % 8);
+        }
+        if input.key_held_millis[key] == Some(0) {
+            out[KEYS_PRESSED + key / 8] |= 1 << (key % 8);
+        }
+    }
+    out
+}
+
+/// Guest import: write the snapshot to `ptr`. Returns the bytes written, or 0 if `len` is too
+/// small or the write fails.
+pub fn snapshot_guest(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    if (len as usize) < SNAPSHOT_SIZE {
+        return 0;
+    }
+    let data = encode(&state::global().lock().unwrap().input);
+    match write_guest_bytes(caller, ptr, &data) {
+        Ok(()) => SNAPSHOT_SIZE as u32,
+        Err(_) => 0,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use libretro_sys::DEVICE_JOYPAD;
+
+    #[test]
+    fn encodes_fixed_layout() {
+        let mut input = InputState::default();
+        input.buttons[1] = 0b1_0000_0001;
+        input.button_held_millis[1][8] = Some(0);
+        input.button_held_millis[1][0] = Some(120);
+        input.port_devices[0] = DEVICE_JOYPAD;
+        input.port_devices[1] = DEVICE_JOYPAD;
+        input.mouse_x = -3;
+        input.mouse_y = 200;
+        input.mouse_buttons = 1;
+        input.keys[32] = true;
+        input.key_held_millis[32] = Some(0);
+        input.keys[323] = true;
+
+        let data = encode(&input);
+        let half = |i: usize| u16::from_le_bytes([data[i], data[i + 1]]);
+        let word = |i: usize| i32::from_le_bytes(data[i..i + 4].try_into().unwrap());
+        assert_eq!((half(0), half(2)), (0, 0b1_0000_0001));
+        assert_eq!(half(PRESSED + 2), 1 << 8);
+        assert_eq!(word(CONNECTED), 0b11);
+        assert_eq!(
+            (word(MOUSE), word(MOUSE + 4), word(MOUSE + 8)),
+            (-3, 200, 1)
+        );
+        assert_eq!(data[KEYS + 4], 1);
+        assert_eq!(data[KEYS + 40], 1 << 3);
+        assert_eq!(data[KEYS_PRESSED + 4], 1);
+        assert_eq!(data[KEYS_PRESSED + 40], 0);
+    }
+}
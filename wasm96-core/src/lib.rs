@@ -9,16 +9,25 @@
 //! The ABI surface is defined in `crate::abi` and mirrored by `wasm96-sdk`.
 //!
 //! Runtime backend: Wasmtime (see `crate::runtime`).
+//!
+//! `abi` and `loader` are public so the `wasm96` command-line tool shares the export names and
+//! the `.w96` bundle format with the core; `host_signatures` lets it check a guest's imports.
 
-mod abi;
+pub mod abi;
 mod av;
 mod input;
 mod libretro_glue;
-mod loader;
+pub mod loader;
+mod net;
 mod runtime;
 mod state;
+mod system;
+
+pub use runtime::imports::{HostSignature, host_signatures};
+
+use std::time::Instant;
 
-use crate::abi::GuestEntrypoints;
+use crate::abi::{GuestEntrypoints, guest_exports};
 
 /// The libretro core instance.
 #[derive(Default)]
@@ -28,6 +37,10 @@ pub struct Wasm96Core {
     instance: Option<wasmtime::Instance>,
     entrypoints: Option<GuestEntrypoints>,
     setup_called: bool,
+    /// Set once a guest entrypoint traps; the guest is not ticked again until reset or reload.
+    faulted: bool,
+    /// Save state size reported to the frontend, fixed from the first report until unload.
+    save_state_len: Option<usize>,
 }
 
 impl Wasm96Core {
@@ -72,7 +85,10 @@ impl Wasm96Core {
 
         // Wasmtime's `Func::call` requires an output buffer even if there are no returns.
         let mut results: [wasmtime::Val; 0] = [];
-        let _ = entry.setup.call(&mut rt.store, &[], &mut results);
+        let result = entry.setup.call(&mut rt.store, &[], &mut results);
+        if let Err(e) = result {
+            self.guest_trapped("setup", e);
+        }
     }
 
     fn call_guest_update(&mut self) {
@@ -83,7 +99,10 @@ impl Wasm96Core {
         let Some(update) = &entry.update else { return };
 
         let mut results: [wasmtime::Val; 0] = [];
-        let _ = update.call(&mut rt.store, &[], &mut results);
+        let result = update.call(&mut rt.store, &[], &mut results);
+        if let Err(e) = result {
+            self.guest_trapped("update", e);
+        }
     }
 
     fn call_guest_draw(&mut self) {
@@ -94,19 +113,96 @@ impl Wasm96Core {
         let Some(draw) = &entry.draw else { return };
 
         let mut results: [wasmtime::Val; 0] = [];
-        let _ = draw.call(&mut rt.store, &[], &mut results);
+        let result = draw.call(&mut rt.store, &[], &mut results);
+        if let Err(e) = result {
+            self.guest_trapped("draw", e);
+        }
+    }
+
+    /// Call an optional lifecycle export, if the guest has it.
+    fn call_guest_hook(
+        &mut self,
+        name: &str,
+        hook: fn(&GuestEntrypoints) -> Option<&wasmtime::Func>,
+    ) {
+        let Some(rt) = self.rt.as_mut() else { return };
+        let Some(func) = self.entrypoints.as_ref().and_then(hook) else {
+            return;
+        };
+
+        let mut results: [wasmtime::Val; 0] = [];
+        let result = func.call(&mut rt.store, &[], &mut results);
+        if let Err(e) = result {
+            self.guest_trapped(name, e);
+        }
+    }
+
+    /// Surface a trap from a guest entrypoint in the log and stop ticking the guest.
+    ///
+    /// Wasmtime's error carries the trap reason plus a wasm backtrace (with function names
+    /// when the module has a name section). Guests that call `wasm96_system_report_error`
+    /// from a panic hook will already have logged their own message just before this.
+    fn guest_trapped(&mut self, export: &str, err: anyhow::Error) {
+        self.faulted = true;
+        system::log::log(
+            system::log::LEVEL_ERROR,
+            &format!("guest `{export}` trapped; halting guest until reset: {err:?}"),
+        );
     }
 
     fn clear_guest(&mut self) {
         self.module = None;
         self.instance = None;
         self.entrypoints = None;
+        self.save_state_len = None;
         // Keep `rt` allocated so subsequent loads are faster; it’s safe because imports are pure host fns.
     }
 
     // Public API for libretro_glue
 
-    pub fn load_game_from_bytes(&mut self, data: &[u8]) -> Result<(), anyhow::Error> {
+    /// Development hot reload: swap in a rebuilt cart, keeping storage and launch parameters.
+    /// A new module restarts the guest; otherwise only the metadata and assets change.
+    fn hot_reload(&mut self, data: &[u8]) {
+        if system::reload::swap_module(data) {
+            let Some(rt) = self.rt.as_ref() else { return };
+            let module = match loader::compile_module(&rt.engine, data) {
+                Ok(m) => m,
+                Err(e) => {
+                    system::log::log(
+                        system::log::LEVEL_ERROR,
+                        &format!("hot reload failed; keeping the running cart: {e:?}"),
+                    );
+                    return;
+                }
+            };
+            // Let the guest flush its saves into storage, which outlives the reload.
+            if self.setup_called && !self.faulted {
+                self.call_guest_hook(guest_exports::ON_QUIT, |e| e.on_quit.as_ref());
+            }
+            self.module = Some(module);
+            system::cart::reload(data);
+            self.reset();
+            if let Some(module) = self.module.as_ref() {
+                if let Err(e) = system::jobs::set_module(module, data) {
+                    system::log::log(
+                        system::log::LEVEL_WARN,
+                        &format!("background jobs unavailable: {e:?}"),
+                    );
+                }
+            }
+        } else {
+            system::cart::reload(data);
+        }
+        system::reload::mark_reloaded();
+        system::log::log(system::log::LEVEL_INFO, "hot reloaded the cart");
+    }
+
+    /// Load a cart. `launch_args` is the frontend's content meta string, if it passed one.
+    pub fn load_game_from_bytes(
+        &mut self,
+        data: &[u8],
+        launch_args: Option<&str>,
+    ) -> Result<(), anyhow::Error> {
         // Ensure runtime exists so we have an Engine to compile against.
         if self.ensure_runtime().is_err() {
             state::clear_on_unload();
@@ -132,19 +228,43 @@ impl Wasm96Core {
             return Err(anyhow::anyhow!("Failed to instantiate module: {e:?}"));
         }
 
+        // Metadata and launch parameters are readable from `setup` on.
+        system::cart::load(data, launch_args);
+
+        // Background jobs run on their own instances of the same module.
+        if let Some(module) = self.module.as_ref() {
+            if let Err(e) = system::jobs::set_module(module, data) {
+                system::log::log(
+                    system::log::LEVEL_WARN,
+                    &format!("background jobs unavailable: {e:?}"),
+                );
+            }
+        }
+
         // Call setup
         // self.call_guest_setup();
         self.setup_called = false;
+        self.faulted = false;
 
         Ok(())
     }
 
     pub fn unload(&mut self) {
+        // Give a running guest the chance to flush saves.
+        if self.setup_called && !self.faulted {
+            self.call_guest_hook(guest_exports::ON_QUIT, |e| e.on_quit.as_ref());
+        }
         self.clear_guest();
+        av::mic::audio_capture_stop();
+        system::jobs::clear_module();
         state::clear_on_unload();
     }
 
     pub fn run_frame(&mut self) {
+        if let Some(data) = system::reload::poll() {
+            self.hot_reload(&data);
+        }
+
         if !self.setup_called {
             self.call_guest_setup();
             self.setup_called = true;
@@ -153,18 +273,193 @@ impl Wasm96Core {
         // Snapshot inputs once per frame for determinism.
         input::snapshot_per_frame();
 
-        // Run guest update loop.
-        self.call_guest_update();
+        // Tell the guest the frontend paused or resumed (see `system::lifecycle`).
+        match system::lifecycle::begin_host_frame() {
+            _ if self.faulted => {}
+            Some(system::lifecycle::Hook::Pause) => {
+                self.call_guest_hook(guest_exports::ON_PAUSE, |e| e.on_pause.as_ref());
+            }
+            Some(system::lifecycle::Hook::Resume) => {
+                self.call_guest_hook(guest_exports::ON_RESUME, |e| e.on_resume.as_ref());
+            }
+            None => {}
+        }
+
+        // LAN connections are serviced every host frame so they stay alive through held ticks.
+        net::lan::pump();
+
+        let mut tick_times = None;
+
+        // Advance frame timing; with a target FPS set, some host frames skip the guest tick
+        // and simply re-present the previous framebuffer, as do frames held back for a lagging
+        // netplay peer. A faulted guest is never ticked.
+        if system::begin_frame() && !self.faulted && self.netplay_begin_tick() {
+            // Swap in replayed input, or append this tick to an input recording.
+            input::replay::tick();
+            // Assets decoded in the background since the last tick become usable now.
+            system::loading::install_finished();
+            input::tick_hold_timers();
+            av::scaling::begin_tick();
+            av::transition_begin_tick(system::delta_millis());
+
+            // Run the updates due this tick: one, or with a fixed update rate as many as
+            // have come due (possibly none). Netplay ticks are always exactly one update.
+            let updates = if net::session::active() {
+                1
+            } else {
+                system::updates_due()
+            };
+            let started = Instant::now();
+            for _ in 0..updates {
+                if self.faulted {
+                    break;
+                }
+                self.call_guest_update();
+                net::session::end_update();
+            }
+            let update_time = started.elapsed();
 
-        // Run guest draw loop.
-        self.call_guest_draw();
+            // Run guest draw loop, through the 2D camera if one is still active, then
+            // composite the draw layers.
+            let started = Instant::now();
+            av::layers_begin_frame();
+            av::mask_begin_frame();
+            av::camera_begin_frame();
+            self.call_guest_draw();
+            let draw_time = started.elapsed();
+            let started = Instant::now();
+            av::layers_end_frame();
+            av::camera_end_frame(system::delta_millis());
+            let composite_time = started.elapsed();
+
+            // Append the freshly drawn frame to an active GIF recording.
+            system::capture::capture_frame();
+
+            // A save state requested during this tick is safe to restore now that the guest
+            // has returned.
+            if let Some(data) = system::savestate::take_pending_load() {
+                self.load_state(&data);
+            }
+
+            // Likewise a restart the guest asked for.
+            if system::take_reset_request() {
+                self.reset();
+            }
+            system::reload::end_tick();
+
+            tick_times = Some((update_time, draw_time, composite_time));
+        }
 
         // Present video and drain audio.
+        let started = Instant::now();
         av::video_present_host();
+        if let Some((update, draw, composite)) = tick_times {
+            let memory_bytes = self
+                .guest_memory()
+                .map_or(0, |(rt, memory)| memory.data_size(&rt.store) as u64);
+            system::stats::end_tick(update, draw, composite + started.elapsed(), memory_bytes);
+        }
         av::audio_drain_host(0);
+        system::lifecycle::end_host_frame();
+    }
+
+    /// Netplay: exchange inputs, re-simulate ticks whose predicted input was wrong, and
+    /// snapshot the state this tick starts from. Returns false to hold the tick while a peer
+    /// catches up.
+    fn netplay_begin_tick(&mut self) -> bool {
+        let rollback = match net::session::begin_tick() {
+            net::session::Tick::Free => return true,
+            net::session::Tick::Hold => return false,
+            net::session::Tick::Run { rollback } => rollback,
+        };
+        if let Some(tick) = rollback {
+            self.netplay_rollback(tick);
+        }
+        if let Some(snapshot) = self.save_state() {
+            net::session::store_snapshot(snapshot);
+        }
+        !self.faulted
     }
 
+    /// Restore the snapshot from before `tick` and run `update` again up to the present.
+    fn netplay_rollback(&mut self, tick: u32) {
+        let Some((snapshot, resume)) = net::session::begin_rollback(tick) else {
+            return;
+        };
+        if self.load_state(&snapshot) {
+            self.call_guest_hook(guest_exports::ON_ROLLBACK, |e| e.on_rollback.as_ref());
+            while !self.faulted && net::session::resimulating_before(resume) {
+                if let Some(snapshot) = self.save_state() {
+                    net::session::store_snapshot(snapshot);
+                }
+                self.call_guest_update();
+                net::session::end_update();
+            }
+        }
+        net::session::end_rollback(resume);
+    }
+
+    fn guest_memory(&mut self) -> Option<(&mut runtime::WasmtimeRuntime, wasmtime::Memory)> {
+        let rt = self.rt.as_mut()?;
+        let memory = self
+            .instance
+            .as_ref()?
+            .get_export(&mut rt.store, "memory")?
+            .into_memory()?;
+        Some((rt, memory))
+    }
+
+    /// Snapshot guest memory and host state (`None` if no guest with memory is loaded).
+    pub fn save_state(&mut self) -> Option<Vec<u8>> {
+        let (rt, memory) = self.guest_memory()?;
+        Some(system::savestate::save(&rt.store, memory))
+    }
+
+    /// Size to report for the loaded guest's save states (see `system::savestate::max_len`).
+    /// The first report sticks, since frontends size their buffers from it once.
+    pub fn save_state_max_len(&mut self) -> Option<usize> {
+        if let Some(len) = self.save_state_len {
+            return Some(len);
+        }
+        let (rt, memory) = self.guest_memory()?;
+        let memory_len = memory.data_size(&rt.store);
+        let (width, height) = {
+            let s = state::global().lock().unwrap();
+            (s.video.width, s.video.height)
+        };
+        let len = system::savestate::max_len(memory_len, width, height);
+        self.save_state_len = Some(len);
+        Some(len)
+    }
+
+    /// Restore a snapshot from `save_state`. Returns false if it doesn't apply.
+    pub fn load_state(&mut self, data: &[u8]) -> bool {
+        let Some((rt, memory)) = self.guest_memory() else {
+            return false;
+        };
+        system::savestate::load(&mut rt.store, memory, data)
+    }
+
+    /// Restart the cart: a fresh instance (new linear memory and globals) and fresh per-run host
+    /// state, then `setup` again on the next frame.
     pub fn reset(&mut self) {
         self.setup_called = false;
+        self.faulted = false;
+        if self.module.is_none() {
+            return;
+        }
+        state::clear_for_restart();
+        // The previous run's jobs are gone from the table; stop their workers.
+        system::jobs::interrupt();
+        if let Some(rt) = self.rt.as_mut() {
+            rt.reset_store();
+        }
+        if let Err(e) = self.instantiate_with_details() {
+            self.faulted = true;
+            system::log::log(
+                system::log::LEVEL_ERROR,
+                &format!("failed to restart guest: {e:?}"),
+            );
+        }
     }
 }
@@ -1,12 +1,13 @@
-use std::ffi::{CString, c_void};
+use std::ffi::{CStr, CString, c_void};
 use std::os::raw::{c_char, c_uint};
 use std::ptr;
 
 use libretro_sys::*;
 
 use crate::Wasm96Core;
-use crate::av::graphics3d;
+use crate::av::{graphics3d, scaling};
 use crate::state;
+use crate::system::{accessibility, lifecycle, locale};
 
 static mut CORE: Option<Wasm96Core> = None;
 
@@ -43,6 +44,15 @@ static mut HW_RENDER: HwRenderCallback = HwRenderCallback {
     debug_context: false,
 };
 
+// Keyboard events carry the typed character, which feeds the guest's text input queue.
+static mut KEYBOARD_CALLBACK: KeyboardCallback = KeyboardCallback {
+    callback: keyboard_event,
+};
+
+unsafe extern "C" fn keyboard_event(down: bool, keycode: c_uint, character: u32, _mods: u16) {
+    crate::input::on_keyboard_event(down, keycode, character);
+}
+
 unsafe extern "C" fn context_reset() {
     // Initialize GL context
     graphics3d::init_gl_context(get_proc_address_wrapper);
@@ -58,6 +68,54 @@ unsafe extern "C" fn context_destroy() {
     // graphics3d::deinit_gl_context();
 }
 
+/// The frontend's value for the core option `key`, if it has one.
+fn read_option(key: &str) -> Option<String> {
+    let env = unsafe { ENV_CB }?;
+    let key = CString::new(key).ok()?;
+    let mut variable = Variable {
+        key: key.as_ptr(),
+        value: ptr::null(),
+    };
+    let ok = unsafe {
+        env(
+            ENVIRONMENT_GET_VARIABLE,
+            &mut variable as *mut _ as *mut c_void,
+        )
+    };
+    if !ok || variable.value.is_null() {
+        return None;
+    }
+    let value = unsafe { CStr::from_ptr(variable.value) };
+    Some(value.to_string_lossy().into_owned())
+}
+
+/// Ask the frontend for the user's language, for `system::locale`.
+fn read_language() {
+    let Some(env) = (unsafe { ENV_CB }) else {
+        return;
+    };
+    let mut language: c_uint = 0;
+    let ok = unsafe {
+        env(
+            ENVIRONMENT_GET_LANGUAGE,
+            &mut language as *mut c_uint as *mut c_void,
+        )
+    };
+    locale::set_frontend_language(ok.then_some(language));
+}
+
+/// Read the window size and accessibility core options and apply them.
+fn read_core_options() {
+    if let Some(value) = read_option(scaling::WINDOW_OPTION_KEY) {
+        scaling::set_window_option(&value);
+    }
+    for (key, _) in accessibility::OPTIONS {
+        if let Some(value) = read_option(key) {
+            accessibility::set_option(key, &value);
+        }
+    }
+}
+
 fn get_proc_address_wrapper(symbol: &str) -> *const c_void {
     unsafe {
         let get_proc = HW_RENDER.get_proc_address;
@@ -90,6 +148,52 @@ pub unsafe extern "C" fn retro_set_environment(cb: Option<EnvironmentFn>) {
     unsafe {
         ENV_CB = cb;
 
+        // Route guest logs through the frontend's log when it has one.
+        if let Some(env) = ENV_CB {
+            let mut log_cb = crate::system::log::HostLogCallback { log: None };
+            let ok = env(
+                ENVIRONMENT_GET_LOG_INTERFACE,
+                &mut log_cb as *mut _ as *mut c_void,
+            );
+            crate::system::log::set_host_log(if ok { log_cb.log } else { None });
+        }
+
+        // Microphone capture, when the frontend supports it.
+        if let Some(env) = ENV_CB {
+            let mut mic = crate::av::mic::HostMicInterface::requested();
+            let ok = env(
+                crate::av::mic::ENVIRONMENT_GET_MICROPHONE_INTERFACE,
+                &mut mic as *mut _ as *mut c_void,
+            );
+            crate::av::mic::set_host_mic(if ok { Some(mic) } else { None });
+        }
+
+        // Core options.
+        if let Some(env) = ENV_CB {
+            let options: Vec<(CString, CString)> =
+                std::iter::once((scaling::WINDOW_OPTION_KEY, scaling::WINDOW_OPTION_VALUES))
+                    .chain(accessibility::OPTIONS)
+                    .map(|(key, values)| {
+                        (CString::new(key).unwrap(), CString::new(values).unwrap())
+                    })
+                    .collect();
+            let mut variables: Vec<Variable> = options
+                .iter()
+                .map(|(key, values)| Variable {
+                    key: key.as_ptr(),
+                    value: values.as_ptr(),
+                })
+                .chain(std::iter::once(Variable {
+                    key: ptr::null(),
+                    value: ptr::null(),
+                }))
+                .collect();
+            env(
+                ENVIRONMENT_SET_VARIABLES,
+                variables.as_mut_ptr() as *mut c_void,
+            );
+        }
+
         // Enable HW Render
         if let Some(env) = ENV_CB {
             let ret = env(
@@ -168,8 +272,8 @@ pub unsafe extern "C" fn retro_get_system_av_info(info: *mut SystemAvInfo) {
     // Default values, will be updated after load
     info.geometry.base_width = 320;
     info.geometry.base_height = 240;
-    info.geometry.max_width = 1920;
-    info.geometry.max_height = 1080;
+    info.geometry.max_width = scaling::MAX_WIDTH;
+    info.geometry.max_height = scaling::MAX_HEIGHT;
     info.geometry.aspect_ratio = 0.0;
 
     info.timing.fps = 60.0;
@@ -190,10 +294,33 @@ pub unsafe extern "C" fn retro_load_game(game: *const GameInfo) -> bool {
     }
     let game = unsafe { &*game };
 
+    unsafe {
+        if let Some(env) = ENV_CB {
+            env(
+                ENVIRONMENT_SET_KEYBOARD_CALLBACK,
+                &raw mut KEYBOARD_CALLBACK as *mut _ as *mut c_void,
+            );
+        }
+    }
+
+    read_core_options();
+    read_language();
+
     let data_slice = unsafe { std::slice::from_raw_parts(game.data as *const u8, game.size) };
+    let launch_args = if game.meta.is_null() {
+        None
+    } else {
+        unsafe { CStr::from_ptr(game.meta) }.to_str().ok()
+    };
 
-    match core.load_game_from_bytes(data_slice) {
-        Ok(_) => true,
+    match core.load_game_from_bytes(data_slice, launch_args) {
+        Ok(_) => {
+            let path = (!game.path.is_null())
+                .then(|| unsafe { CStr::from_ptr(game.path) }.to_str().ok())
+                .flatten();
+            crate::system::reload::watch(path.map(std::path::Path::new), data_slice);
+            true
+        }
         Err(e) => {
             eprintln!("(wasm96) Failed to load game content: {e:?}");
             false
@@ -217,6 +344,34 @@ pub unsafe extern "C" fn retro_run() {
         }
     }
 
+    // Pick up changed core options.
+    let mut options_changed = false;
+    unsafe {
+        if let Some(env) = ENV_CB {
+            let ok = env(
+                ENVIRONMENT_GET_VARIABLE_UPDATE,
+                &mut options_changed as *mut bool as *mut c_void,
+            );
+            options_changed &= ok;
+        }
+    }
+    if options_changed {
+        read_core_options();
+    }
+
+    // A paused frontend that steps single frames says so (see `system::lifecycle`).
+    let mut throttle = lifecycle::ThrottleState::default();
+    let stepping = unsafe {
+        match ENV_CB {
+            Some(env) => env(
+                lifecycle::ENVIRONMENT_GET_THROTTLE_STATE,
+                &mut throttle as *mut _ as *mut c_void,
+            ),
+            None => false,
+        }
+    } && throttle.mode == lifecycle::THROTTLE_FRAME_STEPPING;
+    lifecycle::set_frame_stepping(stepping);
+
     // Prepare 3D frame (only if a valid HW framebuffer is available).
     //
     // Some frontends/drivers may reject HW rendering (or provide a 0 framebuffer).
@@ -230,6 +385,57 @@ pub unsafe extern "C" fn retro_run() {
 
     // Run core frame
     core.run_frame();
+
+    // Tell the frontend when the presented frame changed size.
+    if let Some((width, height)) = scaling::take_geometry_change() {
+        let mut geometry = GameGeometry {
+            base_width: width,
+            base_height: height,
+            max_width: scaling::MAX_WIDTH,
+            max_height: scaling::MAX_HEIGHT,
+            aspect_ratio: width as f32 / height as f32,
+        };
+        unsafe {
+            if let Some(env) = ENV_CB {
+                env(
+                    ENVIRONMENT_SET_GEOMETRY,
+                    &mut geometry as *mut _ as *mut c_void,
+                );
+            }
+        }
+    }
+
+    // Achievement notifications from this tick (already logged, so a refusal loses nothing).
+    for toast in crate::system::achievements::take_toasts() {
+        let Ok(text) = CString::new(toast.replace('\0', "")) else {
+            continue;
+        };
+        let mut msg = Message {
+            msg: text.as_ptr(),
+            frames: crate::system::achievements::TOAST_FRAMES,
+        };
+        unsafe {
+            if let Some(env) = ENV_CB {
+                env(ENVIRONMENT_SET_MESSAGE, &mut msg as *mut _ as *mut c_void);
+            }
+        }
+    }
+
+    // The guest asked to exit back to the frontend.
+    if crate::system::take_quit_request() {
+        let accepted = unsafe {
+            match ENV_CB {
+                Some(env) => env(ENVIRONMENT_SHUTDOWN, ptr::null_mut()),
+                None => false,
+            }
+        };
+        if !accepted {
+            crate::system::log::log(
+                crate::system::log::LEVEL_WARN,
+                "frontend doesn't support shutdown requests; ignoring quit",
+            );
+        }
+    }
 }
 
 #[unsafe(no_mangle)]
@@ -260,17 +466,58 @@ pub unsafe extern "C" fn retro_get_memory_data(_id: c_uint) -> *mut c_void {
 pub unsafe extern "C" fn retro_get_memory_size(_id: c_uint) -> usize {
     0
 }
+// Save states snapshot guest memory, which can grow between calls, and frontends cache the size.
+// Report the current size plus headroom (see `system::savestate::max_len`), zero-pad the tail,
+// and refuse snapshots that have outgrown it.
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn retro_serialize_size() -> usize {
-    0
+    unsafe {
+        (&mut *(&raw mut CORE))
+            .as_mut()
+            .and_then(|c| c.save_state_max_len())
+            .unwrap_or(0)
+    }
 }
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn retro_serialize(_data: *mut c_void, _size: usize) -> bool {
-    false
+pub unsafe extern "C" fn retro_serialize(data: *mut c_void, size: usize) -> bool {
+    unsafe {
+        let Some(snapshot) = (&mut *(&raw mut CORE))
+            .as_mut()
+            .and_then(|c| c.save_state())
+        else {
+            return false;
+        };
+        if data.is_null() {
+            return false;
+        }
+        if snapshot.len() > size {
+            crate::system::log::log(
+                crate::system::log::LEVEL_WARN,
+                &format!(
+                    "save state needs {} bytes but the frontend allows {size}; guest memory grew \
+                     past the reported size",
+                    snapshot.len()
+                ),
+            );
+            return false;
+        }
+        let out = std::slice::from_raw_parts_mut(data as *mut u8, size);
+        out[..snapshot.len()].copy_from_slice(&snapshot);
+        out[snapshot.len()..].fill(0);
+        true
+    }
 }
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn retro_unserialize(_data: *const c_void, _size: usize) -> bool {
-    false
+pub unsafe extern "C" fn retro_unserialize(data: *const c_void, size: usize) -> bool {
+    unsafe {
+        let Some(core) = (&mut *(&raw mut CORE)).as_mut() else {
+            return false;
+        };
+        if data.is_null() {
+            return false;
+        }
+        core.load_state(std::slice::from_raw_parts(data as *const u8, size))
+    }
 }
 #[unsafe(no_mangle)]
 pub unsafe extern "C" fn retro_cheat_reset() {}
@@ -285,4 +532,6 @@ pub unsafe extern "C" fn retro_load_game_special(
     false
 }
 #[unsafe(no_mangle)]
-pub unsafe extern "C" fn retro_set_controller_port_device(_port: c_uint, _device: c_uint) {}
+pub unsafe extern "C" fn retro_set_controller_port_device(port: c_uint, device: c_uint) {
+    crate::input::set_port_device(port, device);
+}
@@ -0,0 +1,172 @@
+//! `.w96` cart bundles: a guest module packed with its assets in one file.
+//!
+//! Assets in a bundle stay on the host until the guest asks for them
+//! (`wasm96_system_asset_read`), instead of being embedded in the module and copied into guest
+//! memory at start-up.
+//!
+//! Layout (all integers little-endian):
+//! - magic `W96B`, `u32` version (1), `u32` entry count;
+//! - per entry: `u32` name length, UTF-8 name, `u32` data offset (from the start of the file),
+//!   `u32` data length;
+//! - entry data, anywhere after the table.
+//!
+//! Names are `/`-separated paths. Reserved names: `cart.wasm` or `cart.wat` holds the module
+//! (required), and `wasm96.meta` holds `key=value` metadata lines read like the module's
+//! `wasm96.meta` custom section. Every other entry is an asset.
+
+use std::collections::BTreeMap;
+use std::ops::Range;
+use std::sync::Arc;
+
+pub const MAGIC: &[u8; 4] = b"W96B";
+pub const VERSION: u32 = 1;
+
+/// Entry names that may hold the guest module, in the order they're looked up.
+pub const MODULE_ENTRIES: [&str; 2] = ["cart.wasm", "cart.wat"];
+/// Entry holding cart metadata.
+pub const META_ENTRY: &str = "wasm96.meta";
+
+/// A parsed bundle. Cheap to clone; entry data is shared.
+#[derive(Debug, Clone, Default)]
+pub struct Bundle {
+    data: Arc<[u8]>,
+    entries: BTreeMap<String, Range<usize>>,
+}
+
+/// Whether `bytes` start like a bundle.
+pub fn is_bundle(bytes: &[u8]) -> bool {
+    bytes.starts_with(MAGIC)
+}
+
+fn read_u32(bytes: &[u8], at: &mut usize) -> Option<u32> {
+    let v = bytes.get(*at..*at + 4)?;
+    *at += 4;
+    Some(u32::from_le_bytes(v.try_into().ok()?))
+}
+
+/// Strip the leading `/` or `./` a guest might put on an asset path.
+pub fn normalize_path(path: &str) -> &str {
+    let path = path.strip_prefix("./").unwrap_or(path);
+    path.trim_start_matches('/')
+}
+
+impl Bundle {
+    /// Parse a bundle, or `None` if the bytes aren't a well-formed version 1 bundle.
+    pub fn parse(bytes: &[u8]) -> Option<Bundle> {
+        if !is_bundle(bytes) {
+            return None;
+        }
+        let mut at = MAGIC.len();
+        if read_u32(bytes, &mut at)? != VERSION {
+            return None;
+        }
+        let count = read_u32(bytes, &mut at)?;
+        let mut entries = BTreeMap::new();
+        for _ in 0..count {
+            let name_len = read_u32(bytes, &mut at)? as usize;
+            let name = std::str::from_utf8(bytes.get(at..at.checked_add(name_len)?)?).ok()?;
+            at += name_len;
+            let offset = read_u32(bytes, &mut at)? as usize;
+            let len = read_u32(bytes, &mut at)? as usize;
+            let range = offset..offset.checked_add(len)?;
+            bytes.get(range.clone())?;
+            entries.insert(normalize_path(name).to_string(), range);
+        }
+        Some(Bundle {
+            data: bytes.into(),
+            entries,
+        })
+    }
+
+    /// Build a bundle from `(name, data)` entries.
+    pub fn write(entries: &[(&str, &[u8])]) -> Vec<u8> {
+        let table_len: usize = entries.iter().map(|(name, _)| 12 + name.len()).sum();
+        let mut offset = MAGIC.len() + 8 + table_len;
+        let mut out = Vec::with_capacity(offset + entries.iter().map(|e| e.1.len()).sum::<usize>());
+        out.extend_from_slice(MAGIC);
+        out.extend_from_slice(&VERSION.to_le_bytes());
+        out.extend_from_slice(&(entries.len() as u32).to_le_bytes());
+        for (name, data) in entries {
+            out.extend_from_slice(&(name.len() as u32).to_le_bytes());
+            out.extend_from_slice(name.as_bytes());
+            out.extend_from_slice(&(offset as u32).to_le_bytes());
+            out.extend_from_slice(&(data.len() as u32).to_le_bytes());
+            offset += data.len();
+        }
+        for (_, data) in entries {
+            out.extend_from_slice(data);
+        }
+        out
+    }
+
+    /// Data of the entry called `name`.
+    pub fn get(&self, name: &str) -> Option<&[u8]> {
+        let range = self.entries.get(normalize_path(name))?;
+        Some(&self.data[range.clone()])
+    }
+
+    /// The guest module (WASM or WAT bytes).
+    pub fn module(&self) -> Option<&[u8]> {
+        MODULE_ENTRIES.iter().find_map(|name| self.get(name))
+    }
+
+    fn is_reserved(name: &str) -> bool {
+        name == META_ENTRY || MODULE_ENTRIES.contains(&name)
+    }
+
+    /// Data of the asset at `path`; reserved entries aren't assets.
+    pub fn asset(&self, path: &str) -> Option<&[u8]> {
+        let path = normalize_path(path);
+        if Self::is_reserved(path) {
+            return None;
+        }
+        self.get(path)
+    }
+
+    /// Asset paths starting with `prefix`, sorted.
+    pub fn asset_paths<'a>(&'a self, prefix: &'a str) -> impl Iterator<Item = &'a str> {
+        let prefix = normalize_path(prefix);
+        self.entries
+            .keys()
+            .map(String::as_str)
+            .filter(move |name| name.starts_with(prefix) && !Self::is_reserved(name))
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn round_trips_entries() {
+        let bytes = Bundle::write(&[
+            ("cart.wat", b"(module)"),
+            ("wasm96.meta", b"title=Rocks"),
+            ("sprites/ship.png", b"png"),
+            ("sprites/rock.png", b"rock"),
+            ("music/title.ogg", b""),
+        ]);
+        assert!(is_bundle(&bytes));
+        let bundle = Bundle::parse(&bytes).unwrap();
+        assert_eq!(bundle.module(), Some(&b"(module)"[..]));
+        assert_eq!(bundle.get(META_ENTRY), Some(&b"title=Rocks"[..]));
+        assert_eq!(bundle.asset("/sprites/ship.png"), Some(&b"png"[..]));
+        assert_eq!(bundle.asset("./music/title.ogg"), Some(&b""[..]));
+        assert_eq!(bundle.asset("cart.wat"), None);
+        assert_eq!(
+            bundle.asset_paths("sprites/").collect::<Vec<_>>(),
+            ["sprites/rock.png", "sprites/ship.png"]
+        );
+        assert_eq!(bundle.asset_paths("").count(), 3);
+    }
+
+    #[test]
+    fn rejects_truncated_bundles() {
+        let bytes = Bundle::write(&[("cart.wasm", b"\0asm\x01\0\0\0")]);
+        assert!(Bundle::parse(&bytes[..bytes.len() - 1]).is_none());
+        assert!(Bundle::parse(&bytes[..10]).is_none());
+        let mut wrong_version = bytes.clone();
+        wrong_version[4] = 2;
+        assert!(Bundle::parse(&wrong_version).is_none());
+    }
+}
@@ -1,7 +1,8 @@
 //! Loader utilities for wasm96-core.
 //!
 //! Responsibilities:
-//! - Detect whether the provided ROM bytes are a `.wasm` binary or `.wat` text.
+//! - Detect whether the provided ROM bytes are a `.wasm` binary, `.wat` text, or a `.w96`
+//!   bundle (see `bundle`) carrying either plus assets.
 //! - If it looks like WAT, convert it to WASM bytes (via the `wat` crate).
 //! - Compile a Wasmtime `Module` from the resulting WASM bytes.
 //!
@@ -10,6 +11,8 @@
 //!   so we sniff the bytes themselves.
 //! - We accept leading whitespace/comments for WAT as best-effort.
 
+pub mod bundle;
+
 use wasmtime::{Engine, Module};
 
 /// Error returned by loader helpers.
@@ -17,6 +20,8 @@ use wasmtime::{Engine, Module};
 pub enum LoadError {
     /// The input was empty or otherwise not recognized as WASM/WAT.
     UnrecognizedFormat,
+    /// The input looked like a `.w96` bundle but is truncated or has no module entry.
+    BadBundle,
     /// WAT parsing failed.
     WatParseFailed(wat::Error),
     /// Wasmtime module compilation failed.
@@ -27,8 +32,9 @@ impl core::fmt::Display for LoadError {
     fn fmt(&self, f: &mut core::fmt::Formatter<'_>) -> core::fmt::Result {
         match self {
             LoadError::UnrecognizedFormat => {
-                write!(f, "unrecognized ROM format (expected wasm or wat)")
+                write!(f, "unrecognized ROM format (expected wasm, wat or w96)")
             }
+            LoadError::BadBundle => write!(f, "malformed w96 bundle or missing cart module"),
             LoadError::WatParseFailed(e) => write!(f, "failed to parse WAT: {e}"),
             LoadError::CompileFailed(e) => write!(f, "failed to compile WASM module: {e}"),
         }
@@ -42,6 +48,8 @@ impl std::error::Error for LoadError {}
 pub enum DetectedFormat {
     Wasm,
     Wat,
+    /// A `.w96` bundle; its module entry is WASM or WAT.
+    Bundle,
 }
 
 /// Load: detect -> (optional) wat->wasm -> compile.
@@ -67,6 +75,19 @@ pub fn normalize_to_wasm(rom_bytes: &[u8]) -> Result<Detected, LoadError> {
                 wasm_bytes: bytes.into(),
             })
         }
+        DetectedFormat::Bundle => {
+            let bundle = bundle::Bundle::parse(rom_bytes).ok_or(LoadError::BadBundle)?;
+            let module = bundle.module().ok_or(LoadError::BadBundle)?;
+            // A bundle inside a bundle isn't a module.
+            if bundle::is_bundle(module) {
+                return Err(LoadError::BadBundle);
+            }
+            let inner = normalize_to_wasm(module)?;
+            Ok(Detected {
+                format,
+                wasm_bytes: inner.wasm_bytes,
+            })
+        }
     }
 }
 
@@ -74,7 +95,7 @@ pub fn normalize_to_wasm(rom_bytes: &[u8]) -> Result<Detected, LoadError> {
 #[derive(Clone, Debug)]
 pub struct Detected {
     pub format: DetectedFormat,
-    /// Always valid WASM bytes (for WASM/WAT inputs).
+    /// Always valid WASM bytes (for WASM/WAT inputs, or a bundle's module entry).
     pub wasm_bytes: Vec<u8>,
 }
 
@@ -82,6 +103,7 @@ pub struct Detected {
 ///
 /// Rules:
 /// - If the first 4 bytes are `\0asm`, treat as WASM.
+/// - If the first 4 bytes are `W96B`, treat as a bundle.
 /// - Else, after stripping UTF-8 BOM / leading whitespace, if the first non-ws byte is `(`,
 ///   treat as WAT (common WAT starts with `(module ...)`).
 ///
@@ -90,6 +112,9 @@ pub fn detect_format(bytes: &[u8]) -> Option<DetectedFormat> {
     if is_wasm_magic(bytes) {
         return Some(DetectedFormat::Wasm);
     }
+    if bundle::is_bundle(bytes) {
+        return Some(DetectedFormat::Bundle);
+    }
 
     // Check for "(...)" after skipping common whitespace/BOM.
     let i = skip_bom_and_leading_ws(bytes);
@@ -172,5 +197,16 @@ mod tests {
         let wasm = wat::parse_bytes(wat).unwrap();
         let m2 = compile_module(&engine, wasm.as_ref()).unwrap();
         assert!(m2.exports().len() >= 1);
+
+        let w96 = bundle::Bundle::write(&[("cart.wat", wat), ("sprites/ship.png", b"png")]);
+        assert_eq!(detect_format(&w96), Some(DetectedFormat::Bundle));
+        let m3 = compile_module(&engine, &w96).unwrap();
+        assert!(m3.exports().len() >= 1);
+
+        let no_module = bundle::Bundle::write(&[("sprites/ship.png", b"png")]);
+        assert!(matches!(
+            compile_module(&engine, &no_module),
+            Err(LoadError::BadBundle)
+        ));
     }
 }
@@ -0,0 +1,709 @@
+//! Local network play: find other machines running the same cart and exchange messages with
+//! them directly over UDP, with no server in between.
+//!
+//! The LAN endpoint opens the first time the guest looks for peers. It listens on UDP
+//! [`LAN_PORT`] (or any free port if another instance on this machine has it) and broadcasts a
+//! probe at most every [`PROBE_INTERVAL`]; machines running a cart with the same title answer,
+//! and each side lists the other as a peer. One side then connects to a peer and the other
+//! accepts the incoming connection.
+//!
+//! Messages go out in one of two modes. Unreliable messages are sent once and may be lost or
+//! reordered, which suits state that is replaced every tick. Reliable messages are resent
+//! every [`RESEND_INTERVAL`] until acknowledged and are delivered once and in order. A rollback
+//! session can use a connection as a peer's link (`crate::net::session`), so couch netplay
+//! needs no addresses or allowlist.
+//!
+//! Only private, link-local and loopback IPv4 addresses are used, so this never reaches the
+//! internet. It is off unless the player sets `WASM96_NET_LAN` (e.g. `WASM96_NET_LAN=1`), so a
+//! cart can't open a port or broadcast on its own. A connection silent for [`LAN_TIMEOUT`] is
+//! closed; keepalives are sent every [`KEEPALIVE_INTERVAL`].
+//!
+//! Packet layout (little-endian): magic `W96L`, kind `u8`, sender instance `u64`, then for
+//! probes, announcements and connects the cart id `u64`; for messages the channel `u8`
+//! (0 = unreliable, 1 = reliable, 2 = rollback session), sequence `u32` and payload; for acks
+//! the sequence `u32`.
+
+use std::collections::{BTreeMap, VecDeque};
+use std::hash::{DefaultHasher, Hash, Hasher};
+use std::net::{Ipv4Addr, SocketAddr, SocketAddrV4, UdpSocket};
+use std::sync::atomic::Ordering;
+use std::time::{Duration, Instant};
+
+use wasmtime::Caller;
+
+use super::NEXT_REQUEST_ID;
+use crate::av::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::{NetState, global};
+
+const MAGIC: &[u8; 4] = b"W96L";
+
+/// Environment variable turning LAN play on. Empty, `off`, `0` and `false` leave it off.
+pub const LAN_ENV: &str = "WASM96_NET_LAN";
+/// UDP port the endpoint listens on when it's free.
+pub const LAN_PORT: u16 = 47096;
+/// Largest message payload.
+pub const MAX_MESSAGE_BYTES: usize = 1200;
+/// Most reliable messages in flight per connection.
+pub const MAX_UNACKED: usize = 256;
+/// Most received messages kept per connection until the guest reads them.
+pub const MAX_INBOX: usize = 1024;
+
+/// Shortest time between discovery probes.
+pub const PROBE_INTERVAL: Duration = Duration::from_secs(1);
+/// How long a peer stays listed after it was last heard.
+pub const PEER_TTL: Duration = Duration::from_secs(5);
+/// How often unacknowledged reliable messages (and connects) are resent.
+pub const RESEND_INTERVAL: Duration = Duration::from_millis(100);
+/// An idle connection sends a keepalive this often.
+pub const KEEPALIVE_INTERVAL: Duration = Duration::from_secs(1);
+/// A connection that hears nothing for this long is closed.
+pub const LAN_TIMEOUT: Duration = Duration::from_secs(5);
+
+const PROBE: u8 = 0;
+const ANNOUNCE: u8 = 1;
+const CONNECT: u8 = 2;
+const MESSAGE: u8 = 3;
+const ACK: u8 = 4;
+const PING: u8 = 5;
+const CLOSE: u8 = 6;
+
+const UNRELIABLE: u8 = 0;
+const RELIABLE: u8 = 1;
+const SESSION: u8 = 2;
+
+/// Reliable messages further ahead of the next expected one than this are dropped (and resent).
+const REORDER_WINDOW: u32 = 256;
+
+/// Where a connection is in its lifecycle.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum ConnState {
+    /// Waiting for the peer to answer.
+    Connecting = 1,
+    Open = 2,
+    /// Closed by either side or timed out. Received messages can still be read.
+    Closed = 3,
+}
+
+#[derive(Debug)]
+struct LanPeer {
+    addr: SocketAddr,
+    last_heard: Instant,
+}
+
+#[derive(Debug)]
+struct Connection {
+    addr: SocketAddr,
+    state: ConnState,
+    last_heard: Instant,
+    last_sent: Instant,
+    /// Sequence number of the next reliable message sent.
+    next_seq: u32,
+    /// Reliable messages not yet acknowledged, with when they were last sent (`None` if queued
+    /// while connecting).
+    unacked: BTreeMap<u32, (Vec<u8>, Option<Instant>)>,
+    /// Sequence number of the next reliable message to deliver.
+    expected: u32,
+    /// Reliable messages that arrived ahead of `expected`.
+    early: BTreeMap<u32, Vec<u8>>,
+    inbox: VecDeque<Vec<u8>>,
+    /// Rollback session packets, for `crate::net::session`.
+    session_inbox: VecDeque<Vec<u8>>,
+}
+
+impl Connection {
+    fn new(addr: SocketAddr, state: ConnState, now: Instant) -> Connection {
+        Connection {
+            addr,
+            state,
+            last_heard: now,
+            last_sent: now,
+            next_seq: 0,
+            unacked: BTreeMap::new(),
+            expected: 0,
+            early: BTreeMap::new(),
+            inbox: VecDeque::new(),
+            session_inbox: VecDeque::new(),
+        }
+    }
+
+    /// Handle a reliable message. Returns false if there is no room for it yet, so it isn't
+    /// acknowledged and the sender tries again.
+    fn receive_reliable(&mut self, seq: u32, payload: &[u8]) -> bool {
+        let ahead = seq.wrapping_sub(self.expected);
+        if ahead >= REORDER_WINDOW {
+            // Already delivered: acknowledge again, the first ack was lost.
+            return ahead > u32::MAX / 2;
+        }
+        if self.inbox.len() + self.early.len() >= MAX_INBOX {
+            return false;
+        }
+        self.early.insert(seq, payload.to_vec());
+        while let Some(message) = self.early.remove(&self.expected) {
+            self.inbox.push_back(message);
+            self.expected = self.expected.wrapping_add(1);
+        }
+        true
+    }
+}
+
+/// The LAN endpoint: discovered peers and open connections.
+#[derive(Debug)]
+pub struct Lan {
+    socket: UdpSocket,
+    /// Random per-endpoint id, so broadcasts we hear from ourselves are ignored.
+    instance: u64,
+    /// Only peers running a cart with the same id are listed.
+    cart: u64,
+    peers: BTreeMap<u32, LanPeer>,
+    connections: BTreeMap<u32, Connection>,
+    /// Incoming connections the guest hasn't accepted yet.
+    incoming: VecDeque<u32>,
+    last_probe: Option<Instant>,
+}
+
+/// Whether `addr` is on the local network.
+pub fn is_local(addr: &SocketAddr) -> bool {
+    match addr {
+        SocketAddr::V4(v4) => {
+            let ip = v4.ip();
+            ip.is_private() || ip.is_link_local() || ip.is_loopback()
+        }
+        SocketAddr::V6(_) => false,
+    }
+}
+
+/// Id shared by every copy of a cart: a hash of its id (or title) metadata.
+pub fn cart_id(title: &str) -> u64 {
+    let mut hasher = DefaultHasher::new();
+    title.hash(&mut hasher);
+    hasher.finish()
+}
+
+impl Lan {
+    /// Open the endpoint on `LAN_PORT`, or on any free port if that is taken.
+    pub fn open(cart: u64) -> Option<Lan> {
+        let socket = UdpSocket::bind((Ipv4Addr::UNSPECIFIED, LAN_PORT))
+            .or_else(|_| UdpSocket::bind((Ipv4Addr::UNSPECIFIED, 0)))
+            .ok()?;
+        socket.set_nonblocking(true).ok()?;
+        socket.set_broadcast(true).ok()?;
+        let mut hasher = DefaultHasher::new();
+        (std::process::id(), Instant::now(), cart).hash(&mut hasher);
+        Some(Lan::with_socket(socket, hasher.finish(), cart))
+    }
+
+    fn with_socket(socket: UdpSocket, instance: u64, cart: u64) -> Lan {
+        Lan {
+            socket,
+            instance,
+            cart,
+            peers: BTreeMap::new(),
+            connections: BTreeMap::new(),
+            incoming: VecDeque::new(),
+            last_probe: None,
+        }
+    }
+
+    fn header(&self, kind: u8) -> Vec<u8> {
+        let mut out = Vec::with_capacity(32);
+        out.extend_from_slice(MAGIC);
+        out.push(kind);
+        out.extend_from_slice(&self.instance.to_le_bytes());
+        out
+    }
+
+    /// Send a packet with no payload beyond the cart id (probe, announce, connect) or none at
+    /// all (ping, close).
+    fn send_control(&self, kind: u8, to: SocketAddr) {
+        let mut packet = self.header(kind);
+        if matches!(kind, PROBE | ANNOUNCE | CONNECT) {
+            packet.extend_from_slice(&self.cart.to_le_bytes());
+        }
+        // Lost control packets are repeated by the next probe, resend or keepalive.
+        let _ = self.socket.send_to(&packet, to);
+    }
+
+    fn send_message(&self, to: SocketAddr, channel: u8, seq: u32, payload: &[u8]) {
+        let mut packet = self.header(MESSAGE);
+        packet.push(channel);
+        packet.extend_from_slice(&seq.to_le_bytes());
+        packet.extend_from_slice(payload);
+        let _ = self.socket.send_to(&packet, to);
+    }
+
+    /// Broadcast a probe unless one went out within `PROBE_INTERVAL`, and list the peers heard
+    /// within `PEER_TTL`.
+    pub fn discover(&mut self, now: Instant) -> Vec<(u32, SocketAddr)> {
+        if self
+            .last_probe
+            .is_none_or(|at| now.duration_since(at) >= PROBE_INTERVAL)
+        {
+            self.last_probe = Some(now);
+            for ip in [Ipv4Addr::BROADCAST, Ipv4Addr::LOCALHOST] {
+                self.send_control(PROBE, SocketAddr::V4(SocketAddrV4::new(ip, LAN_PORT)));
+            }
+        }
+        self.peers
+            .retain(|_, p| now.duration_since(p.last_heard) < PEER_TTL);
+        self.peers.iter().map(|(&id, p)| (id, p.addr)).collect()
+    }
+
+    fn note_peer(&mut self, addr: SocketAddr, now: Instant) {
+        match self.peers.values_mut().find(|p| p.addr == addr) {
+            Some(peer) => peer.last_heard = now,
+            None => {
+                let id = NEXT_REQUEST_ID.fetch_add(1, Ordering::Relaxed);
+                self.peers.insert(
+                    id,
+                    LanPeer {
+                        addr,
+                        last_heard: now,
+                    },
+                );
+            }
+        }
+    }
+
+    fn connection_for(&self, addr: SocketAddr) -> Option<u32> {
+        self.connections
+            .iter()
+            .find(|(_, c)| c.addr == addr && c.state != ConnState::Closed)
+            .map(|(&id, _)| id)
+    }
+
+    /// Connect to a discovered peer. Returns the connection id, or `None` for an unknown peer.
+    pub fn connect(&mut self, peer: u32, now: Instant) -> Option<u32> {
+        let addr = self.peers.get(&peer)?.addr;
+        if let Some(id) = self.connection_for(addr) {
+            return Some(id);
+        }
+        let id = NEXT_REQUEST_ID.fetch_add(1, Ordering::Relaxed);
+        self.connections
+            .insert(id, Connection::new(addr, ConnState::Connecting, now));
+        self.send_control(CONNECT, addr);
+        Some(id)
+    }
+
+    /// The oldest incoming connection not yet accepted.
+    pub fn accept(&mut self) -> Option<u32> {
+        self.incoming.pop_front()
+    }
+
+    pub fn state(&self, id: u32) -> Option<ConnState> {
+        self.connections.get(&id).map(|c| c.state)
+    }
+
+    /// Send a message; reliable ones are kept until acknowledged. False if the connection is
+    /// closed or unknown, the message is too big, or too many reliable messages are in flight.
+    pub fn send(&mut self, id: u32, payload: &[u8], reliable: bool, now: Instant) -> bool {
+        if payload.len() > MAX_MESSAGE_BYTES {
+            return false;
+        }
+        let Some(conn) = self.connections.get_mut(&id) else {
+            return false;
+        };
+        if conn.state == ConnState::Closed {
+            return false;
+        }
+        if !reliable {
+            let addr = conn.addr;
+            conn.last_sent = now;
+            // Unreliable messages sent while connecting are simply lost.
+            if conn.state == ConnState::Open {
+                self.send_message(addr, UNRELIABLE, 0, payload);
+            }
+            return true;
+        }
+        if conn.unacked.len() >= MAX_UNACKED {
+            return false;
+        }
+        let seq = conn.next_seq;
+        conn.next_seq = seq.wrapping_add(1);
+        // While connecting, the message goes out on the first pump after the peer answers.
+        let open = conn.state == ConnState::Open;
+        conn.unacked
+            .insert(seq, (payload.to_vec(), open.then_some(now)));
+        conn.last_sent = now;
+        let addr = conn.addr;
+        if open {
+            self.send_message(addr, RELIABLE, seq, payload);
+        }
+        true
+    }
+
+    /// Send a rollback session packet (unreliable; the session resends what matters).
+    pub fn send_session(&mut self, id: u32, packet: &[u8]) {
+        let Some(conn) = self
+            .connections
+            .get(&id)
+            .filter(|c| c.state == ConnState::Open)
+        else {
+            return;
+        };
+        self.send_message(conn.addr, SESSION, 0, packet);
+    }
+
+    /// The oldest received message on a connection.
+    pub fn receive(&mut self, id: u32) -> Option<Vec<u8>> {
+        self.connections.get_mut(&id)?.inbox.pop_front()
+    }
+
+    /// Rollback session packets received since the last call, with their connection.
+    pub fn take_session_packets(&mut self) -> Vec<(u32, Vec<u8>)> {
+        let mut out = Vec::new();
+        for (&id, conn) in &mut self.connections {
+            out.extend(conn.session_inbox.drain(..).map(|p| (id, p)));
+        }
+        out
+    }
+
+    /// Close and forget a connection.
+    pub fn close(&mut self, id: u32) {
+        if let Some(conn) = self.connections.remove(&id) {
+            if conn.state != ConnState::Closed {
+                self.send_control(CLOSE, conn.addr);
+            }
+        }
+        self.incoming.retain(|&i| i != id);
+    }
+
+    /// Handle one received packet from `from`.
+    fn handle(&mut self, from: SocketAddr, packet: &[u8], now: Instant) {
+        if !is_local(&from) {
+            return;
+        }
+        let Some(rest) = packet.strip_prefix(MAGIC) else {
+            return;
+        };
+        let Some((&kind, rest)) = rest.split_first() else {
+            return;
+        };
+        let Some((instance, rest)) = rest.split_first_chunk::<8>() else {
+            return;
+        };
+        if u64::from_le_bytes(*instance) == self.instance {
+            return;
+        }
+        let cart = rest.first_chunk::<8>().map(|c| u64::from_le_bytes(*c));
+
+        match kind {
+            PROBE | ANNOUNCE => {
+                if cart != Some(self.cart) {
+                    return;
+                }
+                self.note_peer(from, now);
+                if kind == PROBE {
+                    self.send_control(ANNOUNCE, from);
+                }
+                return;
+            }
+            CONNECT => {
+                if cart != Some(self.cart) {
+                    return;
+                }
+                self.note_peer(from, now);
+                if self.connection_for(from).is_none() {
+                    let id = NEXT_REQUEST_ID.fetch_add(1, Ordering::Relaxed);
+                    self.connections
+                        .insert(id, Connection::new(from, ConnState::Open, now));
+                    self.incoming.push_back(id);
+                }
+                // Answer every connect, in case an earlier answer was lost.
+                self.send_control(PING, from);
+                return;
+            }
+            _ => {}
+        }
+
+        let Some(id) = self.connection_for(from) else {
+            return;
+        };
+        let conn = self.connections.get_mut(&id).expect("connection exists");
+        conn.last_heard = now;
+        if conn.state == ConnState::Connecting {
+            conn.state = ConnState::Open;
+        }
+        match kind {
+            MESSAGE => {
+                let Some((&channel, rest)) = rest.split_first() else {
+                    return;
+                };
+                let Some((seq, payload)) = rest.split_first_chunk::<4>() else {
+                    return;
+                };
+                let seq = u32::from_le_bytes(*seq);
+                match channel {
+                    UNRELIABLE if conn.inbox.len() < MAX_INBOX => {
+                        conn.inbox.push_back(payload.to_vec())
+                    }
+                    RELIABLE => {
+                        if conn.receive_reliable(seq, payload) {
+                            let mut ack = self.header(ACK);
+                            ack.extend_from_slice(&seq.to_le_bytes());
+                            let _ = self.socket.send_to(&ack, from);
+                        }
+                    }
+                    SESSION if conn.session_inbox.len() < MAX_INBOX => {
+                        conn.session_inbox.push_back(payload.to_vec())
+                    }
+                    _ => {}
+                }
+            }
+            ACK => {
+                if let Some(seq) = rest.first_chunk::<4>() {
+                    conn.unacked.remove(&u32::from_le_bytes(*seq));
+                }
+            }
+            CLOSE => conn.state = ConnState::Closed,
+            _ => {}
+        }
+    }
+
+    /// Drain received packets, resend what is due and close silent connections.
+    pub fn pump(&mut self, now: Instant) {
+        let mut buf = [0u8; 2048];
+        let mut packets = Vec::new();
+        while let Ok((n, from)) = self.socket.recv_from(&mut buf) {
+            packets.push((from, buf[..n].to_vec()));
+        }
+        for (from, packet) in packets {
+            self.handle(from, &packet, now);
+        }
+
+        let mut resends = Vec::new();
+        for conn in self.connections.values_mut() {
+            if conn.state == ConnState::Closed {
+                continue;
+            }
+            if now.duration_since(conn.last_heard) >= LAN_TIMEOUT {
+                conn.state = ConnState::Closed;
+                continue;
+            }
+            if conn.state == ConnState::Connecting {
+                if now.duration_since(conn.last_sent) >= RESEND_INTERVAL {
+                    conn.last_sent = now;
+                    resends.push((conn.addr, CONNECT, 0, Vec::new()));
+                }
+                continue;
+            }
+            for (&seq, (payload, sent)) in &mut conn.unacked {
+                if sent.is_none_or(|at| now.duration_since(at) >= RESEND_INTERVAL) {
+                    *sent = Some(now);
+                    resends.push((conn.addr, MESSAGE, seq, payload.clone()));
+                }
+            }
+            if now.duration_since(conn.last_sent) >= KEEPALIVE_INTERVAL {
+                conn.last_sent = now;
+                resends.push((conn.addr, PING, 0, Vec::new()));
+            }
+        }
+        for (addr, kind, seq, payload) in resends {
+            match kind {
+                MESSAGE => self.send_message(addr, RELIABLE, seq, &payload),
+                kind => self.send_control(kind, addr),
+            }
+        }
+    }
+}
+
+/// Whether `value` of [`LAN_ENV`] turns LAN play on.
+pub fn enabled_by(value: &str) -> bool {
+    !matches!(
+        value.trim().to_ascii_lowercase().as_str(),
+        "" | "off" | "0" | "false"
+    )
+}
+
+/// Whether the player turned LAN play on.
+fn enabled() -> bool {
+    std::env::var(LAN_ENV).is_ok_and(|v| enabled_by(&v))
+}
+
+fn with_lan<R>(f: impl FnOnce(&mut Lan) -> R) -> Option<R> {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.net.lan.as_mut().map(f)
+}
+
+/// Once a tick: service the endpoint if it's open.
+pub fn pump() {
+    with_lan(|lan| lan.pump(Instant::now()));
+}
+
+/// Guest import: open the endpoint if needed, probe for peers, and return a blob listing the
+/// peers found so far (per peer `u32` id, `u8` address length, `ip:port`). 0 if LAN play is
+/// off or the endpoint can't open.
+pub fn discover_guest() -> u32 {
+    if !enabled() {
+        return 0;
+    }
+    let peers = {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        if s.net.lan.is_none() {
+            let meta = &s.cart.meta;
+            let name = meta.get("id").or_else(|| meta.get("title"));
+            let cart = cart_id(name.map_or("cart", String::as_str));
+            s.net.lan = Lan::open(cart);
+        }
+        let Some(lan) = s.net.lan.as_mut() else {
+            return 0;
+        };
+        lan.discover(Instant::now())
+    };
+    let mut out = Vec::new();
+    for (id, addr) in peers {
+        let addr = addr.to_string();
+        out.extend_from_slice(&id.to_le_bytes());
+        out.push(addr.len() as u8);
+        out.extend_from_slice(addr.as_bytes());
+    }
+    crate::system::blobs::store(out)
+}
+
+/// Guest import: connect to a discovered peer. Returns the connection id (0 = unknown peer).
+pub fn connect(peer: u32) -> u32 {
+    with_lan(|lan| lan.connect(peer, Instant::now()))
+        .flatten()
+        .unwrap_or(0)
+}
+
+/// Guest import: the next incoming connection (0 = none).
+pub fn accept() -> u32 {
+    with_lan(Lan::accept).flatten().unwrap_or(0)
+}
+
+/// State: 0 = unknown id, then `ConnState` values.
+pub fn state(id: u32) -> u32 {
+    with_lan(|lan| lan.state(id))
+        .flatten()
+        .map_or(0, |s| s as u32)
+}
+
+/// Guest import: send a message from guest memory. 1 = sent or queued.
+pub fn send_guest(
+    caller: &mut Caller<'_, GuestLimits>,
+    id: u32,
+    ptr: u32,
+    len: u32,
+    reliable: u32,
+) -> u32 {
+    if len as usize > MAX_MESSAGE_BYTES {
+        return 0;
+    }
+    let Ok(payload) = read_guest_bytes(caller, ptr, len) else {
+        return 0;
+    };
+    with_lan(|lan| lan.send(id, &payload, reliable != 0, Instant::now())).unwrap_or(false) as u32
+}
+
+/// Guest import: blob id of the oldest received message (0 = none).
+pub fn receive(id: u32) -> u32 {
+    match with_lan(|lan| lan.receive(id)).flatten() {
+        Some(message) => crate::system::blobs::store(message),
+        None => 0,
+    }
+}
+
+pub fn close(id: u32) {
+    with_lan(|lan| lan.close(id));
+}
+
+/// Whether connection `id` exists and isn't closed, for sessions linking to it.
+pub fn is_usable(net: &NetState, id: u32) -> bool {
+    net.lan
+        .as_ref()
+        .and_then(|lan| lan.state(id))
+        .is_some_and(|s| s != ConnState::Closed)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn endpoint(instance: u64) -> (Lan, SocketAddr) {
+        let socket = UdpSocket::bind((Ipv4Addr::LOCALHOST, 0)).unwrap();
+        socket.set_nonblocking(true).unwrap();
+        let addr = socket.local_addr().unwrap();
+        (Lan::with_socket(socket, instance, 7), addr)
+    }
+
+    /// Let both endpoints handle what the other sent (loopback delivery is immediate).
+    fn exchange(a: &mut Lan, b: &mut Lan, now: Instant) {
+        for _ in 0..3 {
+            std::thread::sleep(Duration::from_millis(5));
+            a.pump(now);
+            b.pump(now);
+        }
+    }
+
+    #[test]
+    fn connects_and_delivers_both_modes() {
+        let (mut a, _) = endpoint(1);
+        let (mut b, b_addr) = endpoint(2);
+        let now = Instant::now();
+        // A heard B's announcement.
+        a.note_peer(b_addr, now);
+        let peer = a.discover(now)[0].0;
+        let conn = a.connect(peer, now).unwrap();
+        assert_eq!(a.state(conn), Some(ConnState::Connecting));
+        assert!(a.send(conn, b"hello", true, now));
+
+        exchange(&mut a, &mut b, now);
+        let incoming = b.accept().expect("incoming connection");
+        assert_eq!(a.state(conn), Some(ConnState::Open));
+
+        // The reliable message queued while connecting goes out once the peer answers.
+        let later = now + RESEND_INTERVAL;
+        exchange(&mut a, &mut b, later);
+        assert_eq!(b.receive(incoming).as_deref(), Some(&b"hello"[..]));
+        assert!(a.connections[&conn].unacked.is_empty());
+
+        assert!(b.send(incoming, b"tick", false, later));
+        exchange(&mut a, &mut b, later);
+        assert_eq!(a.receive(conn).as_deref(), Some(&b"tick"[..]));
+        assert_eq!(a.receive(conn), None);
+
+        assert!(!a.send(conn, &[0; MAX_MESSAGE_BYTES + 1], true, later));
+        b.close(incoming);
+        exchange(&mut a, &mut b, later);
+        assert_eq!(a.state(conn), Some(ConnState::Closed));
+        assert!(!a.send(conn, b"bye", false, later));
+    }
+
+    #[test]
+    fn reliable_messages_arrive_once_and_in_order() {
+        let addr = SocketAddr::from(([192, 168, 1, 2], LAN_PORT));
+        let mut conn = Connection::new(addr, ConnState::Open, Instant::now());
+        assert!(conn.receive_reliable(1, b"b"));
+        assert!(conn.inbox.is_empty());
+        assert!(conn.receive_reliable(0, b"a"));
+        // A duplicate is acknowledged again but not delivered twice.
+        assert!(conn.receive_reliable(0, b"a"));
+        assert!(!conn.receive_reliable(REORDER_WINDOW + 5, b"z"));
+        assert_eq!(conn.inbox, [b"a".to_vec(), b"b".to_vec()]);
+    }
+
+    #[test]
+    fn only_local_addresses_are_used() {
+        assert!(is_local(&"192.168.0.10:1".parse().unwrap()));
+        assert!(is_local(&"10.1.2.3:1".parse().unwrap()));
+        assert!(is_local(&"127.0.0.1:1".parse().unwrap()));
+        assert!(!is_local(&"8.8.8.8:1".parse().unwrap()));
+        assert!(!is_local(&"[::1]:1".parse().unwrap()));
+    }
+
+    #[test]
+    fn off_unless_turned_on() {
+        assert!(enabled_by("1"));
+        assert!(enabled_by("on"));
+        assert!(!enabled_by(""));
+        assert!(!enabled_by(" Off "));
+        assert!(!enabled_by("false"));
+    }
+}
@@ -0,0 +1,480 @@
+//! Networking module for wasm96-core.
+//!
+//! Responsibilities:
+//! - Outbound HTTP(S) requests for guests (`wasm96_net_fetch` and friends).
+//! - WebSocket client connections (see `websocket`).
+//! - Rollback netplay sessions over UDP (see `session`).
+//! - Peer discovery and direct connections on the local network (see `lan`).
+//! - Leaderboard submissions and fetches against the player's scores service (see `scores`).
+//! - Enforcing the host-side allowlist. Carts cannot reach arbitrary hosts.
+//!
+//! Requests run on background threads so the frame loop never blocks on the network. The guest
+//! gets a request id back immediately and polls it from `update`.
+//!
+//! Allowlist:
+//! - Read from the `WASM96_NET_ALLOW` environment variable: a comma-separated list of hosts.
+//! - `example.com` matches exactly that host; `*.example.com` matches any subdomain (and the
+//!   bare domain); `*` allows every host.
+//! - If the variable is unset or empty, networking is disabled and every fetch is rejected.
+//! - Redirects are followed only to allowlisted hosts.
+//! - LAN play never leaves the local network and isn't subject to the allowlist; it has its
+//!   own switch, `WASM96_NET_LAN`.
+
+use std::io::Read;
+use std::sync::atomic::{AtomicU32, Ordering};
+use std::time::Duration;
+
+use url::{Host, Url};
+use wasmtime::Caller;
+
+use crate::av::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::{FetchRequest, FetchState, global};
+
+pub mod lan;
+pub mod scores;
+pub mod session;
+pub mod websocket;
+
+/// Environment variable holding the host allowlist.
+pub const ALLOWLIST_ENV: &str = "WASM96_NET_ALLOW";
+
+/// Responses larger than this are truncated.
+pub const MAX_BODY_BYTES: u64 = 16 * 1024 * 1024;
+
+/// Overall timeout for one request.
+const REQUEST_TIMEOUT: Duration = Duration::from_secs(30);
+
+/// Request and socket ids are never reused, even across cart reloads, so a late-finishing thread
+/// from a previous cart can't overwrite a new request.
+static NEXT_REQUEST_ID: AtomicU32 = AtomicU32::new(1);
+
+/// Most redirects followed for one request. Every hop must be allowlisted too.
+const MAX_REDIRECTS: usize = 5;
+
+/// Extract the lowercase host from an `http://` or `https://` URL.
+pub fn url_host(url: &str) -> Option<String> {
+    host_with_scheme(url, &["https", "http"])
+}
+
+/// Extract the lowercase host from a URL with one of `schemes`.
+///
+/// The URL is parsed with the WHATWG parser that ureq and tungstenite use, so the host checked
+/// is the host they connect to (`http://a.com\@b.com/` is `a.com`, not `b.com`).
+fn host_with_scheme(url: &str, schemes: &[&str]) -> Option<String> {
+    parsed_host(&Url::parse(url).ok()?, schemes)
+}
+
+/// The lowercase host of a parsed URL with one of `schemes`.
+fn parsed_host(url: &Url, schemes: &[&str]) -> Option<String> {
+    if !schemes.contains(&url.scheme()) {
+        return None;
+    }
+    match url.host()? {
+        Host::Domain(domain) if !domain.is_empty() => Some(domain.to_ascii_lowercase()),
+        Host::Domain(_) => None,
+        Host::Ipv4(ip) => Some(ip.to_string()),
+        Host::Ipv6(ip) => Some(ip.to_string()),
+    }
+}
+
+/// Whether `host` matches any entry of a comma-separated allowlist.
+pub fn host_allowed(host: &str, allowlist: &str) -> bool {
+    allowlist
+        .split(',')
+        .map(|e| e.trim().to_ascii_lowercase())
+        .filter(|e| !e.is_empty())
+        .any(|entry| {
+            if entry == "*" {
+                return true;
+            }
+            match entry.strip_prefix("*.") {
+                Some(domain) => {
+                    host == domain
+                        || host
+                            .strip_suffix(domain)
+                            .is_some_and(|prefix| prefix.ends_with('.'))
+                }
+                None => host == entry,
+            }
+        })
+}
+
+/// Whether `host` is in the player's allowlist (`WASM96_NET_ALLOW`).
+fn host_permitted(host: &str) -> bool {
+    let allowlist = std::env::var(ALLOWLIST_ENV).unwrap_or_default();
+    host_allowed(host, &allowlist)
+}
+
+/// Parse `Name: value` header lines (separated by `\n`). Malformed lines are skipped.
+pub fn parse_headers(raw: &str) -> Vec<(String, String)> {
+    raw.lines()
+        .filter_map(|line| {
+            let (name, value) = line.split_once(':')?;
+            let name = name.trim();
+            if name.is_empty() {
+                return None;
+            }
+            Some((name.to_string(), value.trim().to_string()))
+        })
+        .collect()
+}
+
+/// Where a redirect response points, resolved against the URL that returned it.
+fn redirect_target(current: &Url, status: u16, location: Option<&str>) -> Option<Url> {
+    if !matches!(status, 301 | 302 | 303 | 307 | 308) {
+        return None;
+    }
+    current.join(location?).ok()
+}
+
+/// Perform one blocking request. Returns `(status, body)` for any HTTP response, including
+/// 4xx/5xx, and `None` for transport errors.
+///
+/// Redirects are followed here rather than by ureq, so each hop's host can be checked with
+/// `permitted` first; a redirect to a host it rejects fails the request. Credentials aren't
+/// forwarded to another origin.
+fn perform(
+    method: &str,
+    url: &str,
+    headers: &[(String, String)],
+    body: &[u8],
+    permitted: &dyn Fn(&str) -> bool,
+) -> Option<(u32, Vec<u8>)> {
+    let agent = ureq::AgentBuilder::new()
+        .timeout(REQUEST_TIMEOUT)
+        .redirects(0)
+        .build();
+    let mut url = Url::parse(url).ok()?;
+    let mut method = method.to_string();
+    let mut headers = headers.to_vec();
+    let mut body = body;
+
+    let mut hops = 0;
+    let response = loop {
+        let mut request = agent.request(&method, url.as_str());
+        for (name, value) in &headers {
+            request = request.set(name, value);
+        }
+        let result = if body.is_empty() {
+            request.call()
+        } else {
+            request.send_bytes(body)
+        };
+        let response = match result {
+            Ok(r) => r,
+            Err(ureq::Error::Status(_, r)) => r,
+            Err(_) => return None,
+        };
+
+        let status = response.status();
+        let Some(next) = redirect_target(&url, status, response.header("location")) else {
+            break response;
+        };
+        hops += 1;
+        if hops > MAX_REDIRECTS
+            || !parsed_host(&next, &["https", "http"]).is_some_and(|h| permitted(&h))
+        {
+            return None;
+        }
+        if next.origin() != url.origin() {
+            headers.retain(|(name, _)| {
+                !name.eq_ignore_ascii_case("authorization") && !name.eq_ignore_ascii_case("cookie")
+            });
+        }
+        // 307 and 308 repeat the request as is; the others turn it into a GET.
+        if !matches!(status, 307 | 308) && method != "HEAD" {
+            method = "GET".to_string();
+            body = &[];
+        }
+        url = next;
+    };
+
+    let status = response.status() as u32;
+    let mut data = Vec::new();
+    response
+        .into_reader()
+        .take(MAX_BODY_BYTES)
+        .read_to_end(&mut data)
+        .ok()?;
+    Some((status, data))
+}
+
+/// Start a request. Returns its id, or 0 if the URL is invalid or the host isn't allowlisted.
+pub fn fetch(method: &str, url: &str, headers: &str, body: Vec<u8>) -> u32 {
+    let Ok(url) = Url::parse(url) else {
+        return 0;
+    };
+    if !parsed_host(&url, &["https", "http"]).is_some_and(|host| host_permitted(&host)) {
+        return 0;
+    }
+
+    let method = if method.is_empty() {
+        "GET".to_string()
+    } else {
+        method.to_ascii_uppercase()
+    };
+    let url = url.to_string();
+    let headers = parse_headers(headers);
+    spawn_request(move || perform(&method, &url, &headers, &body, &host_permitted))
+}
+
+/// Track a new request and run `work` for it on a background thread. `work` returns
+/// `(status, body)`, or `None` for a failure.
+fn spawn_request(work: impl FnOnce() -> Option<(u32, Vec<u8>)> + Send + 'static) -> u32 {
+    let id = NEXT_REQUEST_ID.fetch_add(1, Ordering::Relaxed);
+    {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        s.net.requests.insert(
+            id,
+            FetchRequest {
+                state: FetchState::Pending,
+                status: 0,
+                body: Vec::new(),
+            },
+        );
+    }
+
+    std::thread::spawn(move || {
+        let outcome = work();
+
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        // The guest may have cancelled (or the cart unloaded) while we were waiting.
+        if let Some(req) = s.net.requests.get_mut(&id) {
+            match outcome {
+                Some((status, data)) => {
+                    req.state = FetchState::Done;
+                    req.status = status;
+                    req.body = data;
+                }
+                None => req.state = FetchState::Failed,
+            }
+        }
+    });
+
+    id
+}
+
+/// `fetch` with all arguments read from guest memory. Invalid UTF-8 rejects the request.
+#[allow(clippy::too_many_arguments)]
+pub fn fetch_guest(
+    caller: &mut Caller<'_, GuestLimits>,
+    method_ptr: u32,
+    method_len: u32,
+    url_ptr: u32,
+    url_len: u32,
+    headers_ptr: u32,
+    headers_len: u32,
+    body_ptr: u32,
+    body_len: u32,
+) -> u32 {
+    let read_str = |caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32| {
+        read_guest_bytes(caller, ptr, len)
+            .ok()
+            .and_then(|b| String::from_utf8(b).ok())
+    };
+    let Some(method) = read_str(caller, method_ptr, method_len) else {
+        return 0;
+    };
+    let Some(url) = read_str(caller, url_ptr, url_len) else {
+        return 0;
+    };
+    let Some(headers) = read_str(caller, headers_ptr, headers_len) else {
+        return 0;
+    };
+    let Ok(body) = read_guest_bytes(caller, body_ptr, body_len) else {
+        return 0;
+    };
+    fetch(&method, &url, &headers, body)
+}
+
+/// Poll a request: 0 = unknown id, 1 = pending, 2 = done, 3 = failed.
+pub fn poll(id: u32) -> u32 {
+    let s = global().lock().unwrap();
+    match s.net.requests.get(&id).map(|r| r.state) {
+        None => 0,
+        Some(FetchState::Pending) => 1,
+        Some(FetchState::Done) => 2,
+        Some(FetchState::Failed) => 3,
+    }
+}
+
+/// HTTP status code of a finished request (0 if unknown, pending, or failed).
+pub fn status(id: u32) -> u32 {
+    let s = global().lock().unwrap();
+    s.net.requests.get(&id).map(|r| r.status).unwrap_or(0)
+}
+
+/// Move a finished response body into a blob and forget the request.
+///
+/// Returns the blob id, or 0 if the request is unknown or still pending.
+pub fn take_body(id: u32) -> u32 {
+    let body = {
+        let mut s = global().lock().unwrap();
+        match s.net.requests.get(&id).map(|r| r.state) {
+            Some(FetchState::Done) | Some(FetchState::Failed) => {}
+            _ => return 0,
+        }
+        match s.net.requests.remove(&id) {
+            Some(req) => req.body,
+            None => return 0,
+        }
+    };
+    crate::system::blobs::store(body)
+}
+
+/// Forget a request. A still-running request finishes in the background and is discarded.
+pub fn cancel(id: u32) {
+    let mut s = global().lock().unwrap();
+    s.net.requests.remove(&id);
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn url_host_strips_scheme_port_path_and_userinfo() {
+        assert_eq!(
+            url_host("https://Example.com/a?b"),
+            Some("example.com".into())
+        );
+        assert_eq!(
+            url_host("http://user:pw@api.example.com:8080/x"),
+            Some("api.example.com".into())
+        );
+        assert_eq!(url_host("http://[::1]:80/"), Some("::1".into()));
+        assert_eq!(url_host("ftp://example.com"), None);
+        assert_eq!(url_host("https://"), None);
+        // Extra slashes are skipped, so this connects to the host `path`.
+        assert_eq!(url_host("https:///path"), Some("path".into()));
+    }
+
+    #[test]
+    fn url_host_is_the_host_the_client_connects_to() {
+        // A backslash ends the authority like `/` does, so the host is `evil.com`.
+        assert_eq!(
+            url_host("http://evil.com\\@allowed.com/"),
+            Some("evil.com".into())
+        );
+        assert_eq!(
+            url_host("http://evil.com#@allowed.com"),
+            Some("evil.com".into())
+        );
+        assert_eq!(
+            url_host("http://allowed.com:pw@evil.com/"),
+            Some("evil.com".into())
+        );
+        assert_eq!(url_host("http://0x7f.1/"), Some("127.0.0.1".into()));
+        assert_eq!(url_host("HTTP://EXAMPLE.com"), Some("example.com".into()));
+    }
+
+    /// Serve `count` connections, answering each request path with the matching response.
+    fn serve(count: usize, respond: impl Fn(&str, u16) -> String + Send + 'static) -> u16 {
+        use std::io::Write;
+        let listener = std::net::TcpListener::bind("127.0.0.1:0").unwrap();
+        let port = listener.local_addr().unwrap().port();
+        std::thread::spawn(move || {
+            for stream in listener.incoming().take(count) {
+                let mut stream = stream.unwrap();
+                let mut request = Vec::new();
+                let mut buf = [0u8; 1024];
+                while !request.ends_with(b"\r\n\r\n") {
+                    let n = stream.read(&mut buf).unwrap();
+                    if n == 0 {
+                        break;
+                    }
+                    request.extend_from_slice(&buf[..n]);
+                }
+                let request = String::from_utf8_lossy(&request);
+                let path = request.split(' ').nth(1).unwrap_or("");
+                let _ = stream.write_all(respond(path, port).as_bytes());
+            }
+        });
+        port
+    }
+
+    fn redirect(to: &str) -> String {
+        format!(
+            "HTTP/1.1 302 Found\r\nLocation: {to}\r\nContent-Length: 0\r\nConnection: close\r\n\r\n"
+        )
+    }
+
+    #[test]
+    fn redirects_are_followed_only_to_permitted_hosts() {
+        let port = serve(3, |path, port| match path {
+            "/start" => redirect(&format!("http://127.0.0.1:{port}/end")),
+            "/escape" => redirect(&format!("http://localhost:{port}/end")),
+            _ => {
+                "HTTP/1.1 200 OK\r\nContent-Length: 4\r\nConnection: close\r\n\r\ndone".to_string()
+            }
+        });
+        let permitted = |host: &str| host == "127.0.0.1";
+        assert_eq!(
+            perform(
+                "GET",
+                &format!("http://127.0.0.1:{port}/start"),
+                &[],
+                &[],
+                &permitted
+            ),
+            Some((200, b"done".to_vec()))
+        );
+        // `localhost` is the same machine, but not on the allowlist.
+        assert_eq!(
+            perform(
+                "GET",
+                &format!("http://127.0.0.1:{port}/escape"),
+                &[],
+                &[],
+                &permitted
+            ),
+            None
+        );
+    }
+
+    #[test]
+    fn redirect_targets_resolve_against_the_current_url() {
+        let url = Url::parse("https://a.example.com/x/y").unwrap();
+        assert_eq!(
+            redirect_target(&url, 301, Some("/z")).map(String::from),
+            Some("https://a.example.com/z".to_string())
+        );
+        assert_eq!(
+            redirect_target(&url, 307, Some("https://b.example.com/")).map(String::from),
+            Some("https://b.example.com/".to_string())
+        );
+        assert_eq!(redirect_target(&url, 200, Some("/z")), None);
+        assert_eq!(redirect_target(&url, 302, None), None);
+    }
+
+    #[test]
+    fn allowlist_matches_exact_and_wildcard_hosts() {
+        let list = "scores.example.com, *.cdn.example.org";
+        assert!(host_allowed("scores.example.com", list));
+        assert!(!host_allowed("evil.example.com", list));
+        assert!(host_allowed("a.cdn.example.org", list));
+        assert!(host_allowed("cdn.example.org", list));
+        assert!(!host_allowed("notcdn.example.org", list));
+        assert!(!host_allowed("example.com", ""));
+        assert!(host_allowed("anything.net", "*"));
+    }
+
+    #[test]
+    fn parse_headers_skips_malformed_lines() {
+        let h = parse_headers("Content-Type: application/json\nbogus\n: empty\nX-A:  b ");
+        assert_eq!(
+            h,
+            vec![
+                ("Content-Type".to_string(), "application/json".to_string()),
+                ("X-A".to_string(), "b".to_string()),
+            ]
+        );
+    }
+}
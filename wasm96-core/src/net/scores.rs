@@ -0,0 +1,330 @@
+//! Leaderboards: score submission and high-score tables, with the backend on the host.
+//!
+//! The player points the core at a scores service with `WASM96_SCORES_URL` and, if it needs
+//! auth, `WASM96_SCORES_TOKEN` (sent as a bearer token); `WASM96_PLAYER_NAME` names the player.
+//! Carts never see any of them: they name a board and a score. The `WASM96_NET_ALLOW` allowlist
+//! doesn't apply, since the service is the player's choice rather than the cart's.
+//!
+//! Submissions and fetches are requests like `wasm96_net_fetch`: the guest polls the returned id
+//! with `wasm96_net_poll` and takes the result with `wasm96_net_take_body`. A fetched body holds
+//! the entries, best first: per entry `u32` rank, `i64` score, `u32` name length, name, `u32`
+//! meta length, meta bytes (little-endian).
+//!
+//! Service protocol, plain UTF-8 text:
+//! - submit: `POST {url}/{cart}/{board}` with body lines `name=<player>`, `score=<i64>` and
+//!   `meta=<hex>`; any 2xx status means accepted.
+//! - fetch: `GET {url}/{cart}/{board}?count=<n>`, answered with one entry per line,
+//!   `rank<TAB>score<TAB>name<TAB>meta hex`, best first.
+//!
+//! `{cart}` is the cart's `id` metadata, else its `title`; both path segments are
+//! percent-encoded.
+//!
+//! Without `WASM96_SCORES_URL`, boards are kept by the core itself for as long as it runs
+//! (across cart reloads), highest score first, `MAX_LOCAL_ENTRIES` per board.
+
+use std::collections::HashMap;
+use std::sync::Mutex;
+
+use wasmtime::Caller;
+
+use super::{perform, spawn_request};
+use crate::av::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::global;
+
+/// Environment variable holding the scores service base URL.
+pub const SCORES_URL_ENV: &str = "WASM96_SCORES_URL";
+/// Environment variable holding the scores service token.
+pub const SCORES_TOKEN_ENV: &str = "WASM96_SCORES_TOKEN";
+/// Environment variable holding the player's name on leaderboards.
+pub const PLAYER_NAME_ENV: &str = "WASM96_PLAYER_NAME";
+
+/// Largest meta payload per score.
+pub const MAX_META_BYTES: u32 = 1024;
+/// Most entries one fetch returns.
+pub const MAX_FETCH_COUNT: u32 = 100;
+/// Entries kept per local board.
+pub const MAX_LOCAL_ENTRIES: usize = 100;
+
+/// One leaderboard row.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct Entry {
+    pub rank: u32,
+    pub score: i64,
+    pub name: String,
+    pub meta: Vec<u8>,
+}
+
+// Keyed by `cart/board`; survives cart reloads like a frontend's in-memory high-score table.
+static LOCAL_BOARDS: Mutex<Option<HashMap<String, Vec<Entry>>>> = Mutex::new(None);
+
+fn player_name() -> String {
+    std::env::var(PLAYER_NAME_ENV)
+        .ok()
+        .map(|n| n.trim().to_string())
+        .filter(|n| !n.is_empty())
+        .unwrap_or_else(|| "player".to_string())
+}
+
+fn cart_id() -> String {
+    let s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let meta = &s.cart.meta;
+    meta.get("id")
+        .or_else(|| meta.get("title"))
+        .cloned()
+        .unwrap_or_else(|| "cart".to_string())
+}
+
+/// Percent-encode everything but unreserved characters, for a URL path segment.
+pub fn encode_segment(text: &str) -> String {
+    let mut out = String::with_capacity(text.len());
+    for b in text.bytes() {
+        if b.is_ascii_alphanumeric() || matches!(b, b'-' | b'.' | b'_' | b'~') {
+            out.push(b as char);
+        } else {
+            out.push_str(&format!("%{b:02X}"));
+        }
+    }
+    out
+}
+
+fn hex(bytes: &[u8]) -> String {
+    bytes.iter().map(|b| format!("{b:02x}")).collect()
+}
+
+fn unhex(text: &str) -> Option<Vec<u8>> {
+    if text.len() % 2 != 0 {
+        return None;
+    }
+    (0..text.len())
+        .step_by(2)
+        .map(|i| u8::from_str_radix(text.get(i..i + 2)?, 16).ok())
+        .collect()
+}
+
+/// Parse a service's fetch response. Malformed lines are skipped.
+pub fn parse_entries(text: &str) -> Vec<Entry> {
+    text.lines()
+        .filter_map(|line| {
+            let mut fields = line.split('\t');
+            let rank = fields.next()?.trim().parse().ok()?;
+            let score = fields.next()?.trim().parse().ok()?;
+            let name = fields.next()?.to_string();
+            let meta = unhex(fields.next().unwrap_or("").trim()).unwrap_or_default();
+            Some(Entry {
+                rank,
+                score,
+                name,
+                meta,
+            })
+        })
+        .collect()
+}
+
+/// Encode entries for the guest.
+pub fn encode_entries(entries: &[Entry]) -> Vec<u8> {
+    let mut out = Vec::new();
+    for e in entries {
+        out.extend_from_slice(&e.rank.to_le_bytes());
+        out.extend_from_slice(&e.score.to_le_bytes());
+        out.extend_from_slice(&(e.name.len() as u32).to_le_bytes());
+        out.extend_from_slice(e.name.as_bytes());
+        out.extend_from_slice(&(e.meta.len() as u32).to_le_bytes());
+        out.extend_from_slice(&e.meta);
+    }
+    out
+}
+
+/// Insert a score into a local board, keeping it sorted (ties keep submission order).
+pub fn insert_local(board: &mut Vec<Entry>, score: i64, name: String, meta: Vec<u8>) {
+    let at = board.partition_point(|e| e.score >= score);
+    board.insert(
+        at,
+        Entry {
+            rank: 0,
+            score,
+            name,
+            meta,
+        },
+    );
+    board.truncate(MAX_LOCAL_ENTRIES);
+    for (i, e) in board.iter_mut().enumerate() {
+        e.rank = i as u32 + 1;
+    }
+}
+
+fn local_boards<R>(f: impl FnOnce(&mut HashMap<String, Vec<Entry>>) -> R) -> R {
+    let mut boards = match LOCAL_BOARDS.lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    f(boards.get_or_insert_with(HashMap::new))
+}
+
+fn service() -> Option<(String, Vec<(String, String)>)> {
+    let url = std::env::var(SCORES_URL_ENV).ok()?;
+    let url = url.trim().trim_end_matches('/').to_string();
+    if url.is_empty() {
+        return None;
+    }
+    let mut headers = vec![(
+        "Content-Type".to_string(),
+        "text/plain; charset=utf-8".to_string(),
+    )];
+    if let Ok(token) = std::env::var(SCORES_TOKEN_ENV)
+        && !token.trim().is_empty()
+    {
+        headers.push((
+            "Authorization".to_string(),
+            format!("Bearer {}", token.trim()),
+        ));
+    }
+    Some((url, headers))
+}
+
+/// Submit `score` to `board`. Returns a request id (0 if the board name is empty).
+pub fn submit(board: &str, score: i64, meta: Vec<u8>) -> u32 {
+    if board.is_empty() {
+        return 0;
+    }
+    let cart = cart_id();
+    let name = player_name();
+    let Some((url, headers)) = service() else {
+        let key = format!("{cart}/{board}");
+        local_boards(|boards| insert_local(boards.entry(key).or_default(), score, name, meta));
+        return spawn_request(|| Some((200, Vec::new())));
+    };
+    let url = format!("{url}/{}/{}", encode_segment(&cart), encode_segment(board));
+    let body = format!("name={name}\nscore={score}\nmeta={}\n", hex(&meta));
+    spawn_request(move || {
+        let (status, _) = perform("POST", &url, &headers, body.as_bytes(), &|_| true)?;
+        // A rejected score is a failed request; the guest doesn't need the service's reasons.
+        (200..300).contains(&status).then_some((status, Vec::new()))
+    })
+}
+
+/// Fetch the top `count` entries of `board`. Returns a request id (0 if the board name is
+/// empty).
+pub fn fetch(board: &str, count: u32) -> u32 {
+    if board.is_empty() {
+        return 0;
+    }
+    let count = count.clamp(1, MAX_FETCH_COUNT);
+    let cart = cart_id();
+    let Some((url, headers)) = service() else {
+        let key = format!("{cart}/{board}");
+        let entries = local_boards(|boards| {
+            let board = boards.get(&key).map_or(&[][..], |b| &b[..]);
+            encode_entries(&board[..board.len().min(count as usize)])
+        });
+        return spawn_request(move || Some((200, entries)));
+    };
+    let url = format!(
+        "{url}/{}/{}?count={count}",
+        encode_segment(&cart),
+        encode_segment(board)
+    );
+    spawn_request(move || {
+        let (status, body) = perform("GET", &url, &headers, &[], &|_| true)?;
+        if !(200..300).contains(&status) {
+            return None;
+        }
+        let mut entries = parse_entries(&String::from_utf8_lossy(&body));
+        entries.truncate(count as usize);
+        Some((status, encode_entries(&entries)))
+    })
+}
+
+fn read_board(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> Option<String> {
+    read_guest_bytes(caller, ptr, len)
+        .ok()
+        .and_then(|b| String::from_utf8(b).ok())
+}
+
+/// `submit` with the board name and meta read from guest memory.
+pub fn submit_guest(
+    caller: &mut Caller<'_, GuestLimits>,
+    board_ptr: u32,
+    board_len: u32,
+    score: i64,
+    meta_ptr: u32,
+    meta_len: u32,
+) -> u32 {
+    if meta_len > MAX_META_BYTES {
+        return 0;
+    }
+    let Some(board) = read_board(caller, board_ptr, board_len) else {
+        return 0;
+    };
+    let Ok(meta) = read_guest_bytes(caller, meta_ptr, meta_len) else {
+        return 0;
+    };
+    submit(&board, score, meta)
+}
+
+/// `fetch` with the board name read from guest memory.
+pub fn fetch_guest(
+    caller: &mut Caller<'_, GuestLimits>,
+    board_ptr: u32,
+    board_len: u32,
+    count: u32,
+) -> u32 {
+    match read_board(caller, board_ptr, board_len) {
+        Some(board) => fetch(&board, count),
+        None => 0,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn local_boards_stay_sorted_and_capped() {
+        let mut board = Vec::new();
+        insert_local(&mut board, 50, "a".into(), vec![]);
+        insert_local(&mut board, 90, "b".into(), vec![1]);
+        insert_local(&mut board, 50, "c".into(), vec![]);
+        let names: Vec<_> = board.iter().map(|e| (e.rank, e.name.as_str())).collect();
+        assert_eq!(names, [(1, "b"), (2, "a"), (3, "c")]);
+
+        for i in 0..200 {
+            insert_local(&mut board, i, "x".into(), vec![]);
+        }
+        assert_eq!(board.len(), MAX_LOCAL_ENTRIES);
+        assert_eq!(board[0].score, 199);
+    }
+
+    #[test]
+    fn parses_service_entries() {
+        let text = "1\t900\tAda\t0aff\n2\t-5\tBob\t\nbogus\n3\tx\tEve\t\n";
+        let entries = parse_entries(text);
+        assert_eq!(
+            entries,
+            [
+                Entry {
+                    rank: 1,
+                    score: 900,
+                    name: "Ada".into(),
+                    meta: vec![0x0a, 0xff],
+                },
+                Entry {
+                    rank: 2,
+                    score: -5,
+                    name: "Bob".into(),
+                    meta: vec![],
+                },
+            ]
+        );
+        assert_eq!(encode_entries(&entries[1..]).len(), 4 + 8 + 4 + 3 + 4);
+    }
+
+    #[test]
+    fn encodes_path_segments() {
+        assert_eq!(encode_segment("Space Rocks/1"), "Space%20Rocks%2F1");
+        assert_eq!(encode_segment("high-score_v2"), "high-score_v2");
+    }
+}
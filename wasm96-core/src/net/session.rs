@@ -0,0 +1,807 @@
+//! Rollback netplay sessions: per-tick input exchange between peers over UDP.
+//!
+//! Every player runs the same cart. Each tick the guest hands its local input to
+//! `wasm96_net_session_add_local_input`, which schedules it `input_delay` ticks ahead and sends
+//! it to every peer, then reads all players' inputs for the tick with
+//! `wasm96_net_session_synced_inputs`. Remote inputs that haven't arrived yet are predicted by
+//! repeating the player's last known input.
+//!
+//! When a late input contradicts a prediction, the core rolls back: it restores the save state
+//! (`crate::system::savestate`) taken before the first mispredicted tick, calls the guest's
+//! `on_rollback` export if there is one, and runs `update` again (without `draw`) for every tick
+//! up to the present. `wasm96_net_session_is_resimulating` lets the guest skip sounds and other
+//! side effects while that happens. A tick is held back, re-presenting the last frame, while a
+//! peer is `MAX_ROLLBACK` ticks behind.
+//!
+//! Peers are `host:port` UDP addresses whose host must be in the `WASM96_NET_ALLOW` allowlist,
+//! or LAN connections (`crate::net::lan`), which need no address or allowlist.
+//! The session starts once a packet has arrived from every peer; until then ticks run freely
+//! and no inputs are synced. A peer silent for `PEER_TIMEOUT` is dropped and its last input is
+//! repeated from then on.
+//!
+//! Packet layout (little-endian): magic `W96N`, sender player `u8`, `u32` first tick the sender
+//! still needs from the recipient, `u32` first tick carried, `u8` tick count, then per tick a
+//! `u8` input length and the input bytes.
+
+use std::collections::{BTreeMap, VecDeque};
+use std::net::{SocketAddr, ToSocketAddrs, UdpSocket};
+use std::sync::atomic::Ordering;
+use std::time::{Duration, Instant};
+
+use wasmtime::Caller;
+
+use super::{NEXT_REQUEST_ID, host_permitted};
+use crate::av::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::{NetState, global};
+
+const MAGIC: &[u8; 4] = b"W96N";
+
+/// Most players in a session.
+pub const MAX_PLAYERS: u32 = 8;
+/// Largest input payload per player per tick.
+pub const MAX_INPUT_BYTES: usize = 64;
+/// Largest input delay, in ticks.
+pub const MAX_INPUT_DELAY: u32 = 8;
+/// How many ticks the simulation may run ahead of the oldest missing remote input.
+pub const MAX_ROLLBACK: u32 = 8;
+/// A peer that sends nothing for this long is dropped.
+pub const PEER_TIMEOUT: Duration = Duration::from_secs(5);
+
+/// Inputs older than this many ticks are forgotten.
+const HISTORY: u32 = 64;
+/// Most ticks of input carried by one packet.
+const MAX_TICKS_PER_PACKET: u32 = 32;
+
+/// Where a session is in its lifecycle.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum SessionStatus {
+    /// Waiting to hear from every peer.
+    Connecting = 1,
+    Running = 2,
+    /// Running, but at least one peer timed out.
+    PeerDropped = 3,
+}
+
+/// Where a peer's packets go.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Link {
+    /// A UDP address, reached from the session's own socket.
+    Udp(SocketAddr),
+    /// A LAN connection id.
+    Lan(u32),
+}
+
+impl From<SocketAddr> for Link {
+    fn from(addr: SocketAddr) -> Link {
+        Link::Udp(addr)
+    }
+}
+
+#[derive(Debug)]
+struct Peer {
+    link: Link,
+    /// First tick of our input the peer still needs.
+    acked: u32,
+    last_heard: Option<Instant>,
+    dropped: bool,
+}
+
+#[derive(Debug, Default)]
+struct Player {
+    /// Confirmed inputs by tick.
+    inputs: BTreeMap<u32, Vec<u8>>,
+    /// First tick without a confirmed input.
+    next_needed: u32,
+    /// Inputs guessed for ticks that have been simulated but not confirmed.
+    predicted: BTreeMap<u32, Vec<u8>>,
+    peer: Option<Peer>,
+}
+
+/// What the core should do with this tick.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Tick {
+    /// No running session: tick as usual.
+    Free,
+    /// Hold the tick; a peer is too far behind.
+    Hold,
+    /// Tick, first re-simulating from `rollback` if a prediction was wrong.
+    Run { rollback: Option<u32> },
+}
+
+/// A netplay session.
+#[derive(Debug)]
+pub struct Session {
+    id: u32,
+    local: usize,
+    delay: u32,
+    /// The tick being simulated.
+    frame: u32,
+    players: Vec<Player>,
+    status: SessionStatus,
+    /// Snapshots taken before each of the last ticks' `update`, oldest first.
+    snapshots: VecDeque<(u32, Vec<u8>)>,
+    rollback: Option<u32>,
+    resimulating: bool,
+    local_added: bool,
+    socket: Option<UdpSocket>,
+    /// Packets for LAN-linked peers, handed to the LAN endpoint after each call in.
+    lan_outbox: Vec<(u32, Vec<u8>)>,
+}
+
+impl Session {
+    /// A session for `players` players, this machine playing `local`. Not bound to a socket.
+    pub fn new(id: u32, players: u32, input_delay: u32, local: u32) -> Option<Session> {
+        if !(2..=MAX_PLAYERS).contains(&players) || local >= players {
+            return None;
+        }
+        let delay = input_delay.min(MAX_INPUT_DELAY);
+        let players = (0..players)
+            .map(|_| Player {
+                // Nobody has input for the first `delay` ticks.
+                inputs: (0..delay).map(|t| (t, Vec::new())).collect(),
+                next_needed: delay,
+                ..Player::default()
+            })
+            .collect();
+        Some(Session {
+            id,
+            local: local as usize,
+            delay,
+            frame: 0,
+            players,
+            status: SessionStatus::Connecting,
+            snapshots: VecDeque::new(),
+            rollback: None,
+            resimulating: false,
+            local_added: false,
+            socket: None,
+            lan_outbox: Vec::new(),
+        })
+    }
+
+    pub fn status(&self) -> SessionStatus {
+        self.status
+    }
+
+    pub fn frame(&self) -> u32 {
+        self.frame
+    }
+
+    fn running(&self) -> bool {
+        self.status != SessionStatus::Connecting
+    }
+
+    /// Send `player`'s inputs over `link`. Fails for the local player or one out of range.
+    pub fn add_peer(&mut self, player: u32, link: impl Into<Link>) -> bool {
+        let Some(p) = self.players.get_mut(player as usize) else {
+            return false;
+        };
+        if player as usize == self.local {
+            return false;
+        }
+        p.peer = Some(Peer {
+            link: link.into(),
+            acked: 0,
+            last_heard: None,
+            dropped: false,
+        });
+        true
+    }
+
+    /// Record a confirmed input, scheduling a rollback if it contradicts a prediction.
+    fn confirm(&mut self, player: usize, tick: u32, input: Vec<u8>) {
+        let p = &mut self.players[player];
+        if tick < p.next_needed || p.inputs.contains_key(&tick) {
+            return;
+        }
+        if let Some(guess) = p.predicted.remove(&tick)
+            && guess != input
+        {
+            self.rollback = Some(self.rollback.map_or(tick, |r| r.min(tick)));
+        }
+        p.inputs.insert(tick, input);
+        while p.inputs.contains_key(&p.next_needed) {
+            p.next_needed += 1;
+        }
+    }
+
+    /// The local input for this tick, applied `input_delay` ticks later. Ignored while
+    /// re-simulating; false if the session isn't running or input was already added this tick.
+    pub fn add_local_input(&mut self, input: &[u8]) -> bool {
+        if self.resimulating {
+            return true;
+        }
+        if !self.running() || self.local_added || input.len() > MAX_INPUT_BYTES {
+            return false;
+        }
+        self.local_added = true;
+        self.confirm(self.local, self.frame + self.delay, input.to_vec());
+        self.send();
+        true
+    }
+
+    /// Every player's input for the current tick and whether it is confirmed. Add the local
+    /// input first: with no input delay, reading locks in an empty local input for the tick.
+    pub fn synced_inputs(&mut self) -> Vec<(bool, Vec<u8>)> {
+        let frame = self.frame;
+        if !self.resimulating && !self.players[self.local].inputs.contains_key(&frame) {
+            self.confirm(self.local, frame, Vec::new());
+            self.local_added = true;
+        }
+        self.players
+            .iter_mut()
+            .map(|p| {
+                if let Some(input) = p.inputs.get(&frame) {
+                    return (true, input.clone());
+                }
+                let guess = p
+                    .inputs
+                    .range(..frame)
+                    .next_back()
+                    .map(|(_, input)| input.clone())
+                    .unwrap_or_default();
+                p.predicted.insert(frame, guess.clone());
+                (false, guess)
+            })
+            .collect()
+    }
+
+    /// Handle one received packet from `from`.
+    fn receive(&mut self, from: impl Into<Link>, packet: &[u8]) {
+        let from: Link = from.into();
+        let Some(rest) = packet.strip_prefix(MAGIC) else {
+            return;
+        };
+        let Some((&sender, rest)) = rest.split_first() else {
+            return;
+        };
+        let sender = sender as usize;
+        let Some(peer) = self.players.get_mut(sender).and_then(|p| p.peer.as_mut()) else {
+            return;
+        };
+        if peer.link != from || peer.dropped {
+            return;
+        }
+        let Some((ack, rest)) = split_u32(rest) else {
+            return;
+        };
+        peer.acked = peer.acked.max(ack);
+        peer.last_heard = Some(Instant::now());
+        let Some((first, rest)) = split_u32(rest) else {
+            return;
+        };
+        let Some((&count, mut rest)) = rest.split_first() else {
+            return;
+        };
+        for tick in first..first.saturating_add(count as u32) {
+            let Some((&len, r)) = rest.split_first() else {
+                return;
+            };
+            let Some((input, r)) = r.split_at_checked(len as usize) else {
+                return;
+            };
+            rest = r;
+            self.confirm(sender, tick, input.to_vec());
+        }
+    }
+
+    /// The packet for the peer playing `player`.
+    fn packet_for(&self, player: usize) -> Option<Vec<u8>> {
+        let peer = self.players[player].peer.as_ref()?;
+        let local = &self.players[self.local];
+        let first = peer.acked;
+        let end = local
+            .next_needed
+            .min(first.saturating_add(MAX_TICKS_PER_PACKET));
+        let mut out = Vec::with_capacity(16 + (end.saturating_sub(first) as usize) * 8);
+        out.extend_from_slice(MAGIC);
+        out.push(self.local as u8);
+        out.extend_from_slice(&self.players[player].next_needed.to_le_bytes());
+        out.extend_from_slice(&first.to_le_bytes());
+        let ticks: Vec<&Vec<u8>> = (first..end).map_while(|t| local.inputs.get(&t)).collect();
+        out.push(ticks.len() as u8);
+        for input in ticks {
+            out.push(input.len() as u8);
+            out.extend_from_slice(input);
+        }
+        Some(out)
+    }
+
+    /// Send our unacknowledged inputs (and acks) to every peer.
+    fn send(&mut self) {
+        for (i, p) in self.players.iter().enumerate() {
+            let Some(peer) = p.peer.as_ref().filter(|peer| !peer.dropped) else {
+                continue;
+            };
+            let Some(packet) = self.packet_for(i) else {
+                continue;
+            };
+            // Lost packets are resent next tick.
+            match peer.link {
+                Link::Udp(addr) => {
+                    if let Some(socket) = &self.socket {
+                        let _ = socket.send_to(&packet, addr);
+                    }
+                }
+                Link::Lan(conn) => self.lan_outbox.push((conn, packet)),
+            }
+        }
+    }
+
+    /// Update connection status: start once every peer is heard from, drop silent peers.
+    fn update_status(&mut self, now: Instant) {
+        let remotes = self
+            .players
+            .iter_mut()
+            .enumerate()
+            .filter(|(i, _)| *i != self.local)
+            .map(|(_, p)| p);
+        let mut all_heard = true;
+        let mut any_dropped = false;
+        for p in remotes {
+            let Some(peer) = p.peer.as_mut() else {
+                all_heard = false;
+                continue;
+            };
+            match peer.last_heard {
+                None => all_heard = false,
+                Some(at) if self.status != SessionStatus::Connecting => {
+                    if now.duration_since(at) >= PEER_TIMEOUT {
+                        peer.dropped = true;
+                    }
+                }
+                Some(_) => {}
+            }
+            any_dropped |= peer.dropped;
+        }
+        self.status = match self.status {
+            SessionStatus::Connecting if all_heard => SessionStatus::Running,
+            SessionStatus::Running if any_dropped => SessionStatus::PeerDropped,
+            status => status,
+        };
+    }
+
+    /// Whether every live peer is close enough to simulate the current tick.
+    fn can_advance(&self) -> bool {
+        self.players.iter().enumerate().all(|(i, p)| {
+            i == self.local
+                || p.peer.as_ref().is_some_and(|peer| peer.dropped)
+                || self.frame < p.next_needed + MAX_ROLLBACK
+        })
+    }
+
+    /// Start of a tick: decide whether to run it and whether to roll back first.
+    pub fn begin_tick(&mut self, now: Instant) -> Tick {
+        self.update_status(now);
+        if !self.running() {
+            return Tick::Free;
+        }
+        self.send();
+        if !self.can_advance() {
+            return Tick::Hold;
+        }
+        Tick::Run {
+            rollback: self.rollback.take(),
+        }
+    }
+
+    /// After `update`: move on to the next tick. The local player gets an empty input if the
+    /// guest didn't add one.
+    pub fn end_update(&mut self) {
+        if !self.running() {
+            return;
+        }
+        if !self.local_added {
+            self.confirm(self.local, self.frame + self.delay, Vec::new());
+        }
+        self.local_added = false;
+        self.frame += 1;
+        self.prune();
+    }
+
+    fn prune(&mut self) {
+        let cut = self.frame.saturating_sub(HISTORY);
+        for p in &mut self.players {
+            // Keep the newest input even if it's old: dropped peers repeat it forever.
+            while p.inputs.len() > 1 && p.inputs.first_key_value().is_some_and(|(&t, _)| t < cut) {
+                p.inputs.pop_first();
+            }
+            p.predicted = p.predicted.split_off(&cut);
+        }
+    }
+
+    /// Keep a snapshot taken before the current tick's `update`.
+    pub fn store_snapshot(&mut self, data: Vec<u8>) {
+        let frame = self.frame;
+        self.snapshots
+            .retain(|(t, _)| *t < frame && t + MAX_ROLLBACK >= frame);
+        self.snapshots.push_back((frame, data));
+    }
+
+    /// Start a rollback to `tick`: the snapshot to restore, and the tick to return to.
+    pub fn begin_rollback(&mut self, tick: u32) -> Option<(Vec<u8>, u32)> {
+        let (_, data) = self.snapshots.iter().find(|(t, _)| *t == tick)?;
+        let data = data.clone();
+        let resume = self.frame;
+        self.resimulating = true;
+        self.frame = tick;
+        Some((data, resume))
+    }
+
+    /// Re-simulated `update` for the current tick is done.
+    pub fn end_resimulated_update(&mut self) {
+        self.frame += 1;
+    }
+
+    /// The rollback is over; carry on at `resume`.
+    pub fn end_rollback(&mut self, resume: u32) {
+        self.resimulating = false;
+        self.frame = resume;
+    }
+}
+
+fn split_u32(data: &[u8]) -> Option<(u32, &[u8])> {
+    let (head, rest) = data.split_first_chunk::<4>()?;
+    Some((u32::from_le_bytes(*head), rest))
+}
+
+/// Hand packets queued for LAN-linked peers to the LAN endpoint.
+fn flush_lan(net: &mut NetState) {
+    let Some(session) = net.session.as_mut() else {
+        return;
+    };
+    let packets = std::mem::take(&mut session.lan_outbox);
+    if let Some(lan) = net.lan.as_mut() {
+        for (conn, packet) in packets {
+            lan.send_session(conn, &packet);
+        }
+    }
+}
+
+fn with_session<R>(id: u32, f: impl FnOnce(&mut Session) -> R) -> Option<R> {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let result = s
+        .net
+        .session
+        .as_mut()
+        .filter(|session| session.id == id)
+        .map(f);
+    flush_lan(&mut s.net);
+    result
+}
+
+fn with_active<R>(f: impl FnOnce(&mut Session) -> R) -> Option<R> {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let result = s.net.session.as_mut().map(f);
+    flush_lan(&mut s.net);
+    result
+}
+
+/// Create the session, bound to UDP `port` (0 = any free port). Replaces an existing one.
+/// Returns its id, or 0 if the arguments are invalid or the port can't be bound.
+pub fn create(players: u32, input_delay: u32, local: u32, port: u32) -> u32 {
+    let Ok(port) = u16::try_from(port) else {
+        return 0;
+    };
+    let id = NEXT_REQUEST_ID.fetch_add(1, Ordering::Relaxed);
+    let Some(mut session) = Session::new(id, players, input_delay, local) else {
+        return 0;
+    };
+    let Ok(socket) = UdpSocket::bind(("0.0.0.0", port)) else {
+        return 0;
+    };
+    if socket.set_nonblocking(true).is_err() {
+        return 0;
+    }
+    session.socket = Some(socket);
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.net.session = Some(session);
+    id
+}
+
+/// Split `host:port` (or `[v6]:port`) into the host and the whole address.
+fn peer_host(addr: &str) -> Option<&str> {
+    let (host, port) = addr.rsplit_once(':')?;
+    port.parse::<u16>().ok()?;
+    let host = host
+        .strip_prefix('[')
+        .and_then(|h| h.strip_suffix(']'))
+        .unwrap_or(host);
+    (!host.is_empty()).then_some(host)
+}
+
+/// Guest import: route `player`'s inputs to the `host:port` at `addr_ptr`. Returns 1 on
+/// success, 0 if the address is invalid, not allowlisted or the player can't be a peer.
+pub fn add_peer_guest(
+    caller: &mut Caller<'_, GuestLimits>,
+    id: u32,
+    player: u32,
+    addr_ptr: u32,
+    addr_len: u32,
+) -> u32 {
+    let Some(addr) = read_guest_bytes(caller, addr_ptr, addr_len)
+        .ok()
+        .and_then(|b| String::from_utf8(b).ok())
+    else {
+        return 0;
+    };
+    let Some(host) = peer_host(&addr) else {
+        return 0;
+    };
+    if !host_permitted(&host.to_ascii_lowercase()) {
+        return 0;
+    }
+    let Some(resolved) = addr.to_socket_addrs().ok().and_then(|mut a| a.next()) else {
+        return 0;
+    };
+    with_session(id, |session| session.add_peer(player, resolved)).unwrap_or(false) as u32
+}
+
+/// Guest import: route `player`'s inputs over LAN connection `conn`. Returns 1 on success, 0
+/// if the connection is closed or unknown or the player can't be a peer.
+pub fn add_lan_peer(id: u32, player: u32, conn: u32) -> u32 {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    if !super::lan::is_usable(&s.net, conn) {
+        return 0;
+    }
+    s.net
+        .session
+        .as_mut()
+        .filter(|session| session.id == id)
+        .is_some_and(|session| session.add_peer(player, Link::Lan(conn))) as u32
+}
+
+/// Guest import: add this tick's local input from guest memory.
+pub fn add_local_input_guest(
+    caller: &mut Caller<'_, GuestLimits>,
+    id: u32,
+    ptr: u32,
+    len: u32,
+) -> u32 {
+    if len as usize > MAX_INPUT_BYTES {
+        return 0;
+    }
+    let Ok(input) = read_guest_bytes(caller, ptr, len) else {
+        return 0;
+    };
+    with_session(id, |session| session.add_local_input(&input)).unwrap_or(false) as u32
+}
+
+/// Guest import: blob id of this tick's inputs (0 if the session isn't running). Per player:
+/// `u8` 1 if confirmed (0 if predicted), `u8` length, input bytes.
+pub fn synced_inputs(id: u32) -> u32 {
+    let Some(inputs) = with_session(id, |session| {
+        session.running().then(|| session.synced_inputs())
+    })
+    .flatten() else {
+        return 0;
+    };
+    let mut out = Vec::new();
+    for (confirmed, input) in inputs {
+        out.push(confirmed as u8);
+        out.push(input.len() as u8);
+        out.extend_from_slice(&input);
+    }
+    crate::system::blobs::store(out)
+}
+
+/// Status: 0 = unknown id, then `SessionStatus` values.
+pub fn status(id: u32) -> u32 {
+    with_session(id, |session| session.status() as u32).unwrap_or(0)
+}
+
+/// The tick being simulated (re-simulated ticks included).
+pub fn frame(id: u32) -> u32 {
+    with_session(id, |session| session.frame()).unwrap_or(0)
+}
+
+pub fn is_resimulating(id: u32) -> u32 {
+    with_session(id, |session| session.resimulating as u32).unwrap_or(0)
+}
+
+/// The UDP port the session is bound to (0 for an unknown id).
+pub fn local_port(id: u32) -> u32 {
+    with_session(id, |session| {
+        session
+            .socket
+            .as_ref()
+            .and_then(|s| s.local_addr().ok())
+            .map_or(0, |a| a.port() as u32)
+    })
+    .unwrap_or(0)
+}
+
+pub fn close(id: u32) {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    if s.net
+        .session
+        .as_ref()
+        .is_some_and(|session| session.id == id)
+    {
+        s.net.session = None;
+    }
+}
+
+/// Whether a session is open (each tick is then exactly one `update`).
+pub fn active() -> bool {
+    with_active(|_| ()).is_some()
+}
+
+/// Start of a tick: drain received packets, then decide what to run.
+pub fn begin_tick() -> Tick {
+    let lan_packets = {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        match (&s.net.session, s.net.lan.as_mut()) {
+            (Some(_), Some(lan)) => lan.take_session_packets(),
+            _ => Vec::new(),
+        }
+    };
+    with_active(|session| {
+        let mut packets = Vec::new();
+        if let Some(socket) = &session.socket {
+            let mut buf = [0u8; 4096];
+            while let Ok((n, from)) = socket.recv_from(&mut buf) {
+                packets.push((from, buf[..n].to_vec()));
+            }
+        }
+        for (from, packet) in packets {
+            session.receive(from, &packet);
+        }
+        for (conn, packet) in lan_packets {
+            session.receive(Link::Lan(conn), &packet);
+        }
+        session.begin_tick(Instant::now())
+    })
+    .unwrap_or(Tick::Free)
+}
+
+/// After the tick's `update` (or a re-simulated one).
+pub fn end_update() {
+    with_active(|session| {
+        if session.resimulating {
+            session.end_resimulated_update();
+        } else {
+            session.end_update();
+        }
+    });
+}
+
+pub fn store_snapshot(data: Vec<u8>) {
+    with_active(|session| session.store_snapshot(data));
+}
+
+pub fn begin_rollback(tick: u32) -> Option<(Vec<u8>, u32)> {
+    with_active(|session| session.begin_rollback(tick)).flatten()
+}
+
+pub fn end_rollback(resume: u32) {
+    with_active(|session| session.end_rollback(resume));
+}
+
+/// Whether a rollback in progress still has ticks to re-simulate before `resume`.
+pub fn resimulating_before(resume: u32) -> bool {
+    with_active(|session| session.resimulating && session.frame < resume).unwrap_or(false)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn pair(delay: u32) -> (Session, Session) {
+        let addr = |port| SocketAddr::from(([127, 0, 0, 1], port));
+        let mut a = Session::new(1, 2, delay, 0).unwrap();
+        let mut b = Session::new(2, 2, delay, 1).unwrap();
+        a.add_peer(1, addr(2));
+        b.add_peer(0, addr(1));
+        (a, b)
+    }
+
+    /// Deliver everything `from` has for `to`.
+    fn deliver(from: &Session, to: &mut Session) {
+        let port = if from.local == 0 { 1 } else { 2 };
+        let packet = from.packet_for(to.local).unwrap();
+        to.receive(SocketAddr::from(([127, 0, 0, 1], port)), &packet);
+    }
+
+    #[test]
+    fn starts_once_peers_are_heard_and_exchanges_inputs() {
+        let (mut a, mut b) = pair(1);
+        let now = Instant::now();
+        assert_eq!(a.begin_tick(now), Tick::Free);
+        assert!(!a.add_local_input(&[1]));
+        deliver(&b, &mut a);
+        deliver(&a, &mut b);
+        assert_eq!(a.begin_tick(now), Tick::Run { rollback: None });
+        assert_eq!(b.begin_tick(now), Tick::Run { rollback: None });
+
+        // Tick 0 is covered by the input delay.
+        assert_eq!(a.synced_inputs(), vec![(true, vec![]), (true, vec![])]);
+        assert!(a.add_local_input(&[1]));
+        assert!(!a.add_local_input(&[2]));
+        assert!(b.add_local_input(&[9]));
+        a.end_update();
+        b.end_update();
+
+        deliver(&b, &mut a);
+        assert_eq!(a.begin_tick(now), Tick::Run { rollback: None });
+        assert_eq!(a.synced_inputs(), vec![(true, vec![1]), (true, vec![9])]);
+    }
+
+    #[test]
+    fn mispredictions_roll_back_and_lag_holds_the_tick() {
+        let (mut a, mut b) = pair(0);
+        let now = Instant::now();
+        deliver(&b, &mut a);
+        deliver(&a, &mut b);
+        a.begin_tick(now);
+        b.begin_tick(now);
+
+        // B's inputs don't reach A for a while; A predicts "nothing pressed".
+        for tick in 0..MAX_ROLLBACK {
+            assert_eq!(a.begin_tick(now), Tick::Run { rollback: None });
+            a.store_snapshot(vec![tick as u8]);
+            a.add_local_input(&[0]);
+            assert_eq!(a.synced_inputs()[1], (false, vec![]));
+            a.end_update();
+            b.add_local_input(if tick >= 3 { &[7] } else { &[] });
+            b.end_update();
+        }
+        assert_eq!(a.begin_tick(now), Tick::Hold);
+
+        deliver(&b, &mut a);
+        assert_eq!(a.begin_tick(now), Tick::Run { rollback: Some(3) });
+        let (snapshot, resume) = a.begin_rollback(3).unwrap();
+        assert_eq!((snapshot, resume), (vec![3], MAX_ROLLBACK));
+        assert_eq!(a.synced_inputs()[1], (true, vec![7]));
+        assert!(a.add_local_input(&[5]));
+        a.end_resimulated_update();
+        assert_eq!(a.frame(), 4);
+        a.end_rollback(resume);
+        assert_eq!(a.frame(), MAX_ROLLBACK);
+    }
+
+    #[test]
+    fn silent_peers_are_dropped() {
+        let (mut a, b) = pair(0);
+        deliver(&b, &mut a);
+        let start = Instant::now();
+        a.begin_tick(start);
+        assert_eq!(a.status(), SessionStatus::Running);
+        for _ in 0..MAX_ROLLBACK {
+            a.end_update();
+        }
+        assert_eq!(a.begin_tick(start), Tick::Hold);
+        assert_eq!(
+            a.begin_tick(start + PEER_TIMEOUT),
+            Tick::Run { rollback: None }
+        );
+        assert_eq!(a.status(), SessionStatus::PeerDropped);
+    }
+
+    #[test]
+    fn parses_peer_hosts() {
+        assert_eq!(peer_host("example.com:7000"), Some("example.com"));
+        assert_eq!(peer_host("[::1]:7000"), Some("::1"));
+        assert_eq!(peer_host("example.com"), None);
+        assert_eq!(peer_host(":7000"), None);
+    }
+}
@@ -0,0 +1,327 @@
+//! WebSocket client connections for guests.
+//!
+//! Each connection runs on its own background thread. The guest never touches the socket: it
+//! queues outgoing messages and drains received ones through `crate::state::NetState::sockets`,
+//! and the connection thread moves them to and from the wire.
+//!
+//! Only `ws://` and `wss://` URLs whose host is in the `WASM96_NET_ALLOW` allowlist are accepted.
+
+use std::net::TcpStream;
+use std::sync::atomic::Ordering;
+use std::time::Duration;
+
+use tungstenite::stream::MaybeTlsStream;
+use tungstenite::{Message, WebSocket};
+use url::Url;
+use wasmtime::Caller;
+
+use super::{NEXT_REQUEST_ID, host_permitted, host_with_scheme, parsed_host};
+use crate::av::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::{OutgoingMessage, SocketState, WebSocketConn, global};
+
+/// Received messages beyond this many are dropped (oldest first) if the guest doesn't drain them.
+pub const MAX_QUEUED_MESSAGES: usize = 1024;
+
+/// How long the connection thread blocks on a read before checking for outgoing messages.
+const POLL_INTERVAL: Duration = Duration::from_millis(5);
+
+type Socket = WebSocket<MaybeTlsStream<TcpStream>>;
+
+/// Extract the lowercase host from a `ws://` or `wss://` URL.
+pub fn ws_url_host(url: &str) -> Option<String> {
+    host_with_scheme(url, &["wss", "ws"])
+}
+
+/// Append a received message, dropping the oldest one if the queue is full.
+pub fn push_incoming(conn: &mut WebSocketConn, data: Vec<u8>) {
+    if conn.incoming.len() >= MAX_QUEUED_MESSAGES {
+        conn.incoming.pop_front();
+    }
+    conn.incoming.push_back(data);
+}
+
+/// Open a connection. Returns its id, or 0 if the URL is invalid or the host isn't allowlisted.
+pub fn open(url: &str) -> u32 {
+    let Ok(url) = Url::parse(url) else {
+        return 0;
+    };
+    if !parsed_host(&url, &["wss", "ws"]).is_some_and(|host| host_permitted(&host)) {
+        return 0;
+    }
+
+    let id = NEXT_REQUEST_ID.fetch_add(1, Ordering::Relaxed);
+    {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        s.net.sockets.insert(
+            id,
+            WebSocketConn {
+                state: SocketState::Connecting,
+                incoming: Default::default(),
+                outgoing: Default::default(),
+            },
+        );
+    }
+
+    // Connect to the normalized URL, so tungstenite can't read a different host out of it.
+    let url = url.to_string();
+    std::thread::spawn(move || run(id, &url));
+    id
+}
+
+/// `open` with the URL read from guest memory.
+pub fn open_guest(caller: &mut Caller<'_, GuestLimits>, url_ptr: u32, url_len: u32) -> u32 {
+    match read_guest_bytes(caller, url_ptr, url_len)
+        .ok()
+        .and_then(|b| String::from_utf8(b).ok())
+    {
+        Some(url) => open(&url),
+        None => 0,
+    }
+}
+
+/// Connection thread: connect, then shuttle messages until either side closes.
+fn run(id: u32, url: &str) {
+    let mut socket = match tungstenite::connect(url) {
+        Ok((socket, _response)) => socket,
+        Err(_) => {
+            set_state(id, SocketState::Closed);
+            return;
+        }
+    };
+    set_read_timeout(&socket, POLL_INTERVAL);
+    if !set_state(id, SocketState::Open) {
+        // Closed by the guest (or the cart unloaded) while connecting.
+        let _ = socket.close(None);
+        let _ = socket.flush();
+        return;
+    }
+
+    loop {
+        let outgoing = {
+            let mut s = match global().lock() {
+                Ok(g) => g,
+                Err(poisoned) => poisoned.into_inner(),
+            };
+            match s.net.sockets.get_mut(&id) {
+                Some(conn) => std::mem::take(&mut conn.outgoing),
+                None => {
+                    drop(s);
+                    let _ = socket.close(None);
+                    let _ = socket.flush();
+                    return;
+                }
+            }
+        };
+        for msg in outgoing {
+            let frame = if msg.text {
+                Message::Text(String::from_utf8_lossy(&msg.data).into_owned())
+            } else {
+                Message::Binary(msg.data)
+            };
+            if socket.send(frame).is_err() {
+                set_state(id, SocketState::Closed);
+                return;
+            }
+        }
+
+        let data = match socket.read() {
+            Ok(Message::Text(text)) => text.into_bytes(),
+            Ok(Message::Binary(data)) => data,
+            Ok(Message::Close(_)) => {
+                set_state(id, SocketState::Closed);
+                return;
+            }
+            // Pings are answered by tungstenite itself.
+            Ok(_) => continue,
+            Err(tungstenite::Error::Io(e))
+                if matches!(
+                    e.kind(),
+                    std::io::ErrorKind::WouldBlock | std::io::ErrorKind::TimedOut
+                ) =>
+            {
+                continue;
+            }
+            Err(_) => {
+                set_state(id, SocketState::Closed);
+                return;
+            }
+        };
+
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        if let Some(conn) = s.net.sockets.get_mut(&id) {
+            push_incoming(conn, data);
+        }
+    }
+}
+
+fn set_read_timeout(socket: &Socket, timeout: Duration) {
+    let _ = match socket.get_ref() {
+        MaybeTlsStream::Plain(stream) => stream.set_read_timeout(Some(timeout)),
+        MaybeTlsStream::Rustls(stream) => stream.get_ref().set_read_timeout(Some(timeout)),
+        _ => Ok(()),
+    };
+}
+
+/// Update a connection's state. Returns false if the guest has already forgotten it.
+fn set_state(id: u32, state: SocketState) -> bool {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    match s.net.sockets.get_mut(&id) {
+        Some(conn) => {
+            conn.state = state;
+            true
+        }
+        None => false,
+    }
+}
+
+/// Connection state: 0 = unknown id, 1 = connecting, 2 = open, 3 = closed.
+pub fn state(id: u32) -> u32 {
+    let s = global().lock().unwrap();
+    match s.net.sockets.get(&id).map(|c| c.state) {
+        None => 0,
+        Some(SocketState::Connecting) => 1,
+        Some(SocketState::Open) => 2,
+        Some(SocketState::Closed) => 3,
+    }
+}
+
+/// Queue a message. Messages queued while connecting are sent once the connection opens.
+///
+/// Returns 1 if queued, 0 if the id is unknown or the connection is closed.
+pub fn send(id: u32, data: Vec<u8>, text: bool) -> u32 {
+    let mut s = global().lock().unwrap();
+    match s.net.sockets.get_mut(&id) {
+        Some(conn) if conn.state != SocketState::Closed => {
+            conn.outgoing.push_back(OutgoingMessage { data, text });
+            1
+        }
+        _ => 0,
+    }
+}
+
+/// `send` with the payload read from guest memory.
+pub fn send_guest(
+    caller: &mut Caller<'_, GuestLimits>,
+    id: u32,
+    ptr: u32,
+    len: u32,
+    text: u32,
+) -> u32 {
+    let Ok(data) = read_guest_bytes(caller, ptr, len) else {
+        return 0;
+    };
+    if text != 0 && std::str::from_utf8(&data).is_err() {
+        return 0;
+    }
+    send(id, data, text != 0)
+}
+
+/// Pop the oldest received message into a blob. Returns the blob id, or 0 if nothing is queued.
+///
+/// Messages that arrived before the connection closed can still be received.
+pub fn receive(id: u32) -> u32 {
+    let data = {
+        let mut s = global().lock().unwrap();
+        match s
+            .net
+            .sockets
+            .get_mut(&id)
+            .and_then(|c| c.incoming.pop_front())
+        {
+            Some(data) => data,
+            None => return 0,
+        }
+    };
+    crate::system::blobs::store(data)
+}
+
+/// Close a connection and forget it, dropping any unread messages.
+pub fn close(id: u32) {
+    let mut s = global().lock().unwrap();
+    s.net.sockets.remove(&id);
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn insert_conn(state: SocketState) -> u32 {
+        let id = NEXT_REQUEST_ID.fetch_add(1, Ordering::Relaxed);
+        global().lock().unwrap().net.sockets.insert(
+            id,
+            WebSocketConn {
+                state,
+                incoming: Default::default(),
+                outgoing: Default::default(),
+            },
+        );
+        id
+    }
+
+    #[test]
+    fn ws_url_host_requires_websocket_scheme() {
+        assert_eq!(
+            ws_url_host("wss://Chat.example.com:443/room"),
+            Some("chat.example.com".into())
+        );
+        assert_eq!(ws_url_host("ws://127.0.0.1:9000"), Some("127.0.0.1".into()));
+        assert_eq!(ws_url_host("https://example.com"), None);
+        assert_eq!(
+            ws_url_host("ws://evil.com\\@allowed.com/"),
+            Some("evil.com".into())
+        );
+    }
+
+    #[test]
+    fn incoming_queue_drops_oldest_when_full() {
+        let mut conn = WebSocketConn {
+            state: SocketState::Open,
+            incoming: Default::default(),
+            outgoing: Default::default(),
+        };
+        for i in 0..=MAX_QUEUED_MESSAGES {
+            push_incoming(&mut conn, vec![(i % 256) as u8]);
+        }
+        assert_eq!(conn.incoming.len(), MAX_QUEUED_MESSAGES);
+        assert_eq!(conn.incoming.front(), Some(&vec![1u8]));
+    }
+
+    #[test]
+    fn send_queues_until_closed() {
+        let id = insert_conn(SocketState::Connecting);
+        assert_eq!(send(id, b"hi".to_vec(), true), 1);
+        assert_eq!(global().lock().unwrap().net.sockets[&id].outgoing.len(), 1);
+
+        global()
+            .lock()
+            .unwrap()
+            .net
+            .sockets
+            .get_mut(&id)
+            .unwrap()
+            .state = SocketState::Closed;
+        assert_eq!(send(id, b"late".to_vec(), false), 0);
+        assert_eq!(state(id), 3);
+
+        close(id);
+        assert_eq!(state(id), 0);
+        assert_eq!(send(id, b"gone".to_vec(), false), 0);
+    }
+
+    #[test]
+    fn unknown_socket_has_nothing_to_receive() {
+        let id = insert_conn(SocketState::Open);
+        close(id);
+        assert_eq!(receive(id), 0);
+    }
+}
@@ -5,19 +5,57 @@
 //! NOTE: Keep this file in a **single-pass**/single `define_imports` implementation to avoid
 //! accidentally registering imports twice (or returning early and leaving dead code below).
 
+use crate::runtime::GuestLimits;
 use crate::{
     abi::{IMPORT_MODULE, host_imports},
-    av, input,
+    av, input, net, system,
 };
-use wasmtime::{Caller, Linker};
+use wasmtime::{Caller, Engine, Extern, Linker, Store};
+
+/// A host import's name and type, with value types written as in WAT (`i32`, `f64`, ...).
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct HostSignature {
+    pub name: String,
+    pub params: Vec<String>,
+    pub results: Vec<String>,
+}
+
+/// The signature of every host import, read back from a linker set up by `define_imports`, so
+/// tools can check a guest's imports without instantiating it.
+pub fn host_signatures() -> anyhow::Result<Vec<HostSignature>> {
+    let engine = Engine::default();
+    let mut linker = Linker::new(&engine);
+    define_imports(&mut linker)?;
+    let mut store = Store::new(&engine, GuestLimits::default());
+    let funcs: Vec<_> = linker
+        .iter(&mut store)
+        .filter_map(|(_, name, item)| match item {
+            Extern::Func(func) => Some((name.to_string(), func)),
+            _ => None,
+        })
+        .collect();
+    let mut signatures: Vec<HostSignature> = funcs
+        .into_iter()
+        .map(|(name, func)| {
+            let ty = func.ty(&store);
+            HostSignature {
+                name,
+                params: ty.params().map(|t| t.to_string()).collect(),
+                results: ty.results().map(|t| t.to_string()).collect(),
+            }
+        })
+        .collect();
+    signatures.sort_by(|a, b| a.name.cmp(&b.name));
+    Ok(signatures)
+}
 
 /// Define all host imports expected by guests under module `"env"`.
-pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
+pub fn define_imports(linker: &mut Linker<GuestLimits>) -> anyhow::Result<()> {
     // --- Graphics ---
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_SET_SIZE,
-        |_caller: Caller<'_, ()>, width: u32, height: u32| {
+        |_caller: Caller<'_, GuestLimits>, width: u32, height: u32| {
             av::graphics_set_size(width, height);
         },
     )?;
@@ -25,15 +63,90 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_SET_COLOR,
-        |_caller: Caller<'_, ()>, r: u32, g: u32, b: u32, a: u32| {
+        |_caller: Caller<'_, GuestLimits>, r: u32, g: u32, b: u32, a: u32| {
             av::graphics_set_color(r, g, b, a);
         },
     )?;
 
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SET_TINT,
+        |_caller: Caller<'_, GuestLimits>, r: u32, g: u32, b: u32, a: u32| {
+            av::graphics_set_tint(r, g, b, a);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SET_POST_EFFECT,
+        |_caller: Caller<'_, GuestLimits>, effect: u32, strength: f32| {
+            av::graphics_set_post_effect(effect, strength);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_COLOR_GRADE_SET,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            av::graphics_color_grade_set(&mut caller, ptr, len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SET_SCALING_MODE,
+        |_caller: Caller<'_, GuestLimits>, mode: u32| {
+            av::graphics_set_scaling_mode(mode);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_WINDOW_SIZE,
+        |_caller: Caller<'_, GuestLimits>| -> u64 { av::graphics_window_size() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SET_FULLSCREEN,
+        |_caller: Caller<'_, GuestLimits>, enabled: u32| {
+            av::graphics_set_fullscreen(enabled);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FULLSCREEN,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { av::graphics_fullscreen() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_RESIZED,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { av::graphics_resized() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SET_LINE_WIDTH,
+        |_caller: Caller<'_, GuestLimits>, px: u32| {
+            av::graphics_set_line_width(px);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SET_LINE_STYLE,
+        |_caller: Caller<'_, GuestLimits>, style: u32| {
+            av::graphics_set_line_style(style);
+        },
+    )?;
+
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_BACKGROUND,
-        |_caller: Caller<'_, ()>, r: u32, g: u32, b: u32| {
+        |_caller: Caller<'_, GuestLimits>, r: u32, g: u32, b: u32| {
+            system::stats::count_draw();
             av::graphics_background(r, g, b);
         },
     )?;
@@ -41,7 +154,9 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_POINT,
-        |_caller: Caller<'_, ()>, x: i32, y: i32| {
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
             av::graphics_point(x, y);
         },
     )?;
@@ -49,7 +164,10 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_LINE,
-        |_caller: Caller<'_, ()>, x1: i32, y1: i32, x2: i32, y2: i32| {
+        |_caller: Caller<'_, GuestLimits>, x1: i32, y1: i32, x2: i32, y2: i32| {
+            system::stats::count_draw();
+            let (x1, y1) = av::camera_point(x1, y1);
+            let (x2, y2) = av::camera_point(x2, y2);
             av::graphics_line(x1, y1, x2, y2);
         },
     )?;
@@ -57,7 +175,9 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_RECT,
-        |_caller: Caller<'_, ()>, x: i32, y: i32, w: u32, h: u32| {
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, w: u32, h: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
             av::graphics_rect(x, y, w, h);
         },
     )?;
@@ -65,7 +185,9 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_RECT_OUTLINE,
-        |_caller: Caller<'_, ()>, x: i32, y: i32, w: u32, h: u32| {
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, w: u32, h: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
             av::graphics_rect_outline(x, y, w, h);
         },
     )?;
@@ -73,7 +195,9 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_CIRCLE,
-        |_caller: Caller<'_, ()>, x: i32, y: i32, r: u32| {
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, r: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
             av::graphics_circle(x, y, r);
         },
     )?;
@@ -81,25 +205,99 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_CIRCLE_OUTLINE,
-        |_caller: Caller<'_, ()>, x: i32, y: i32, r: u32| {
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, r: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
             av::graphics_circle_outline(x, y, r);
         },
     )?;
 
+    // Gradients (colors packed 0xRRGGBBAA)
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_RECT_GRADIENT,
+        |_caller: Caller<'_, GuestLimits>,
+         x: i32,
+         y: i32,
+         w: u32,
+         h: u32,
+         top_left: u32,
+         top_right: u32,
+         bottom_left: u32,
+         bottom_right: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_rect_gradient(x, y, w, h, top_left, top_right, bottom_left, bottom_right);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_CIRCLE_GRADIENT,
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, r: u32, inner: u32, outer: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_circle_gradient(x, y, r, inner, outer);
+        },
+    )?;
+
     // Raw RGBA blit: (x,y,w,h,ptr,len)
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_IMAGE,
-        |mut caller: Caller<'_, ()>, x: i32, y: i32, w: u32, h: u32, ptr: u32, len: u32| {
+        |mut caller: Caller<'_, GuestLimits>,
+         x: i32,
+         y: i32,
+         w: u32,
+         h: u32,
+         ptr: u32,
+         len: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
             let _ = av::graphics_image(&mut caller, x, y, w, h, ptr, len);
         },
     )?;
 
+    // Direct framebuffer access: (x,y,w,h,ptr,len)
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FRAMEBUFFER_WRITE,
+        |mut caller: Caller<'_, GuestLimits>,
+         x: i32,
+         y: i32,
+         w: u32,
+         h: u32,
+         ptr: u32,
+         len: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            let _ = av::graphics_framebuffer_write(&mut caller, x, y, w, h, ptr, len);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FRAMEBUFFER_READ,
+        |mut caller: Caller<'_, GuestLimits>,
+         x: i32,
+         y: i32,
+         w: u32,
+         h: u32,
+         ptr: u32,
+         len: u32|
+         -> u32 {
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_framebuffer_read(&mut caller, x, y, w, h, ptr, len).unwrap_or(0)
+        },
+    )?;
+
     // One-shot PNG decode+draw: (x,y,ptr,len)
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_IMAGE_PNG,
-        |mut caller: Caller<'_, ()>, x: i32, y: i32, ptr: u32, len: u32| {
+        |mut caller: Caller<'_, GuestLimits>, x: i32, y: i32, ptr: u32, len: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
             let _ = av::graphics_image_png(&mut caller, x, y, ptr, len);
         },
     )?;
@@ -108,16 +306,24 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_IMAGE_JPEG,
-        |mut caller: Caller<'_, ()>, x: i32, y: i32, ptr: u32, len: u32| {
+        |mut caller: Caller<'_, GuestLimits>, x: i32, y: i32, ptr: u32, len: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
             let _ = av::graphics_image_jpeg(&mut caller, x, y, ptr, len);
         },
     )?;
 
     // --- Keyed resources (SVG/GIF/PNG/JPEG) ---
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_LAST_ERROR,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { av::graphics_last_error() },
+    )?;
+
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_SVG_REGISTER,
-        |mut caller: Caller<'_, ()>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
+        |mut caller: Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
             av::graphics_svg_register(&mut caller, key, data_ptr, data_len)
         },
     )?;
@@ -125,7 +331,9 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_SVG_DRAW_KEY,
-        |_caller: Caller<'_, ()>, key: u64, x: i32, y: i32, w: u32, h: u32| {
+        |_caller: Caller<'_, GuestLimits>, key: u64, x: i32, y: i32, w: u32, h: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
             av::graphics_svg_draw_key(key, x, y, w, h)
         },
     )?;
@@ -133,15 +341,34 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_SVG_UNREGISTER,
-        |_caller: Caller<'_, ()>, key: u64| {
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
             av::graphics_svg_unregister(key);
         },
     )?;
 
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SVG_SIZE,
+        |_caller: Caller<'_, GuestLimits>, key: u64| -> u64 { av::graphics_svg_size(key) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SVG_SET_FILL,
+        |mut caller: Caller<'_, GuestLimits>,
+         key: u64,
+         selector_ptr: u32,
+         selector_len: u32,
+         color: u32|
+         -> u32 {
+            av::graphics_svg_set_fill(&mut caller, key, selector_ptr, selector_len, color)
+        },
+    )?;
+
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_GIF_REGISTER,
-        |mut caller: Caller<'_, ()>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
+        |mut caller: Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
             av::graphics_gif_register(&mut caller, key, data_ptr, data_len)
         },
     )?;
@@ -149,13 +376,19 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_GIF_DRAW_KEY,
-        |_caller: Caller<'_, ()>, key: u64, x: i32, y: i32| av::graphics_gif_draw_key(key, x, y),
+        |_caller: Caller<'_, GuestLimits>, key: u64, x: i32, y: i32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_gif_draw_key(key, x, y)
+        },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_GIF_DRAW_KEY_SCALED,
-        |_caller: Caller<'_, ()>, key: u64, x: i32, y: i32, w: u32, h: u32| {
+        |_caller: Caller<'_, GuestLimits>, key: u64, x: i32, y: i32, w: u32, h: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
             av::graphics_gif_draw_key_scaled(key, x, y, w, h)
         },
     )?;
@@ -163,412 +396,2490 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::GRAPHICS_GIF_UNREGISTER,
-        |_caller: Caller<'_, ()>, key: u64| {
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
             av::graphics_gif_unregister(key);
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_PNG_REGISTER,
-        |mut caller: Caller<'_, ()>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
-            av::graphics_png_register(&mut caller, key, data_ptr, data_len)
-        },
+        host_imports::GRAPHICS_GIF_FRAME_COUNT,
+        |_caller: Caller<'_, GuestLimits>, key: u64| -> u32 { av::graphics_gif_frame_count(key) },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_PNG_DRAW_KEY,
-        |_caller: Caller<'_, ()>, key: u64, x: i32, y: i32| av::graphics_png_draw_key(key, x, y),
+        host_imports::GRAPHICS_GIF_FRAME_DELAY,
+        |_caller: Caller<'_, GuestLimits>, key: u64, frame: u32| -> u32 {
+            av::graphics_gif_frame_delay(key, frame)
+        },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_PNG_DRAW_KEY_SCALED,
-        |_caller: Caller<'_, ()>, key: u64, x: i32, y: i32, w: u32, h: u32| {
-            av::graphics_png_draw_key_scaled(key, x, y, w, h)
+        host_imports::GRAPHICS_GIF_DRAW_FRAME,
+        |_caller: Caller<'_, GuestLimits>, key: u64, frame: u32, x: i32, y: i32, w: u32, h: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_gif_draw_frame(key, frame, x, y, w, h)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_PNG_UNREGISTER,
-        |_caller: Caller<'_, ()>, key: u64| {
-            av::graphics_png_unregister(key);
+        host_imports::GRAPHICS_GIF_DRAW_EX,
+        |_caller: Caller<'_, GuestLimits>,
+         key: u64,
+         x: i32,
+         y: i32,
+         w: u32,
+         h: u32,
+         angle: f32,
+         flags: u32,
+         pivot_x: i32,
+         pivot_y: i32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_gif_draw_ex(key, x, y, w, h, angle, flags, pivot_x, pivot_y)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_JPEG_REGISTER,
-        |mut caller: Caller<'_, ()>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
-            av::graphics_jpeg_register(&mut caller, key, data_ptr, data_len)
+        host_imports::GRAPHICS_GIF_SET_FRAME,
+        |_caller: Caller<'_, GuestLimits>, key: u64, frame: u32| {
+            av::graphics_gif_set_frame(key, frame);
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_JPEG_DRAW_KEY,
-        |_caller: Caller<'_, ()>, key: u64, x: i32, y: i32| av::graphics_jpeg_draw_key(key, x, y),
+        host_imports::GRAPHICS_GIF_SET_SPEED,
+        |_caller: Caller<'_, GuestLimits>, key: u64, multiplier: f32| {
+            av::graphics_gif_set_speed(key, multiplier);
+        },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_JPEG_DRAW_KEY_SCALED,
-        |_caller: Caller<'_, ()>, key: u64, x: i32, y: i32, w: u32, h: u32| {
-            av::graphics_jpeg_draw_key_scaled(key, x, y, w, h)
+        host_imports::GRAPHICS_GIF_PAUSE,
+        |_caller: Caller<'_, GuestLimits>, key: u64, paused: u32| {
+            av::graphics_gif_pause(key, paused);
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_JPEG_UNREGISTER,
-        |_caller: Caller<'_, ()>, key: u64| {
-            av::graphics_jpeg_unregister(key);
+        host_imports::GRAPHICS_ASEPRITE_REGISTER,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
+            av::graphics_aseprite_register(&mut caller, key, data_ptr, data_len)
         },
     )?;
 
-    // Fonts (keyed)
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_FONT_REGISTER_TTF,
-        |mut caller: Caller<'_, ()>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
-            av::graphics_font_register_ttf(&mut caller, key, data_ptr, data_len)
+        host_imports::GRAPHICS_ASEPRITE_UNREGISTER,
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
+            av::graphics_aseprite_unregister(key);
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_FONT_REGISTER_BDF,
-        |mut caller: Caller<'_, ()>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
-            av::graphics_font_register_bdf(&mut caller, key, data_ptr, data_len)
-        },
+        host_imports::GRAPHICS_ASEPRITE_SIZE,
+        |_caller: Caller<'_, GuestLimits>, key: u64| -> u64 { av::graphics_aseprite_size(key) },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_FONT_REGISTER_SPLEEN,
-        |_caller: Caller<'_, ()>, key: u64, size: u32| -> u32 {
-            av::graphics_font_register_spleen(key, size)
+        host_imports::GRAPHICS_ASEPRITE_FRAME_COUNT,
+        |_caller: Caller<'_, GuestLimits>, key: u64| -> u32 {
+            av::graphics_aseprite_frame_count(key)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_FONT_UNREGISTER,
-        |_caller: Caller<'_, ()>, key: u64| {
-            av::graphics_font_unregister(key);
+        host_imports::GRAPHICS_ASEPRITE_FRAME_DURATION,
+        |_caller: Caller<'_, GuestLimits>, key: u64, frame: u32| -> u32 {
+            av::graphics_aseprite_frame_duration(key, frame)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_TEXT_KEY,
-        |mut caller: Caller<'_, ()>,
-         x: i32,
-         y: i32,
-         font_key: u64,
-         text_ptr: u32,
-         text_len: u32| {
-            av::graphics_text_key(x, y, &mut caller, font_key, text_ptr, text_len);
+        host_imports::GRAPHICS_ASEPRITE_TAG_DURATION,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, tag_ptr: u32, tag_len: u32| -> u32 {
+            av::graphics_aseprite_tag_duration(&mut caller, key, tag_ptr, tag_len)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_TEXT_MEASURE_KEY,
-        |mut caller: Caller<'_, ()>, font_key: u64, text_ptr: u32, text_len: u32| -> u64 {
-            av::graphics_text_measure_key(&mut caller, font_key, text_ptr, text_len)
+        host_imports::GRAPHICS_ASEPRITE_DRAW_FRAME,
+        |_caller: Caller<'_, GuestLimits>, key: u64, frame: u32, x: i32, y: i32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_aseprite_draw_frame(key, frame, x, y)
         },
     )?;
 
-    // Shapes
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_TRIANGLE,
-        |_caller: Caller<'_, ()>, x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32| {
-            av::graphics_triangle(x1, y1, x2, y2, x3, y3);
+        host_imports::GRAPHICS_ASEPRITE_DRAW_TAG,
+        |mut caller: Caller<'_, GuestLimits>,
+         key: u64,
+         tag_ptr: u32,
+         tag_len: u32,
+         millis: u32,
+         x: i32,
+         y: i32|
+         -> u32 {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_aseprite_draw_tag(&mut caller, key, tag_ptr, tag_len, millis, x, y)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_TRIANGLE_OUTLINE,
-        |_caller: Caller<'_, ()>, x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32| {
-            av::graphics_triangle_outline(x1, y1, x2, y2, x3, y3);
+        host_imports::GRAPHICS_ASEPRITE_SET_LAYER_VISIBLE,
+        |mut caller: Caller<'_, GuestLimits>,
+         key: u64,
+         name_ptr: u32,
+         name_len: u32,
+         visible: u32|
+         -> u32 {
+            av::graphics_aseprite_set_layer_visible(&mut caller, key, name_ptr, name_len, visible)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_BEZIER_QUADRATIC,
-        |_caller: Caller<'_, ()>,
-         x1: i32,
-         y1: i32,
-         cx: i32,
-         cy: i32,
-         x2: i32,
-         y2: i32,
-         segments: u32| {
-            av::graphics_bezier_quadratic(x1, y1, cx, cy, x2, y2, segments);
+        host_imports::GRAPHICS_MAP_LOAD,
+        |mut caller: Caller<'_, GuestLimits>,
+         key: u64,
+         path_ptr: u32,
+         path_len: u32,
+         level_ptr: u32,
+         level_len: u32|
+         -> u32 {
+            av::graphics_map_load(&mut caller, key, path_ptr, path_len, level_ptr, level_len)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_BEZIER_CUBIC,
-        |_caller: Caller<'_, ()>,
-         x1: i32,
-         y1: i32,
-         cx1: i32,
-         cy1: i32,
-         cx2: i32,
-         cy2: i32,
-         x2: i32,
-         y2: i32,
-         segments: u32| {
-            av::graphics_bezier_cubic(x1, y1, cx1, cy1, cx2, cy2, x2, y2, segments);
+        host_imports::GRAPHICS_MAP_REGISTER,
+        |mut caller: Caller<'_, GuestLimits>,
+         key: u64,
+         data_ptr: u32,
+         data_len: u32,
+         level_ptr: u32,
+         level_len: u32|
+         -> u32 {
+            av::graphics_map_register(&mut caller, key, data_ptr, data_len, level_ptr, level_len)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_PILL,
-        |_caller: Caller<'_, ()>, x: i32, y: i32, w: u32, h: u32| {
-            av::graphics_pill(x, y, w, h);
+        host_imports::GRAPHICS_MAP_UNREGISTER,
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
+            av::graphics_map_unregister(key);
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_PILL_OUTLINE,
-        |_caller: Caller<'_, ()>, x: i32, y: i32, w: u32, h: u32| {
-            av::graphics_pill_outline(x, y, w, h);
-        },
+        host_imports::GRAPHICS_MAP_SIZE,
+        |_caller: Caller<'_, GuestLimits>, key: u64| -> u64 { av::graphics_map_size(key) },
     )?;
 
-    // 3D
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_SET_3D,
-        |_caller: Caller<'_, ()>, enable: u32| {
-            av::graphics_set_3d(enable != 0);
-        },
+        host_imports::GRAPHICS_MAP_TILE_SIZE,
+        |_caller: Caller<'_, GuestLimits>, key: u64| -> u64 { av::graphics_map_tile_size(key) },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_CAMERA_LOOK_AT,
-        |_caller: Caller<'_, ()>,
-         eye_x: f32,
-         eye_y: f32,
-         eye_z: f32,
-         target_x: f32,
-         target_y: f32,
-         target_z: f32,
-         up_x: f32,
-         up_y: f32,
-         up_z: f32| {
-            av::graphics_camera_look_at(
-                eye_x, eye_y, eye_z, target_x, target_y, target_z, up_x, up_y, up_z,
-            );
-        },
+        host_imports::GRAPHICS_MAP_LAYER_COUNT,
+        |_caller: Caller<'_, GuestLimits>, key: u64| -> u32 { av::graphics_map_layer_count(key) },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_CAMERA_PERSPECTIVE,
-        |_caller: Caller<'_, ()>, fovy: f32, aspect: f32, near: f32, far: f32| {
-            av::graphics_camera_perspective(fovy, aspect, near, far);
+        host_imports::GRAPHICS_MAP_LAYER_INDEX,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, name_ptr: u32, name_len: u32| -> i32 {
+            av::graphics_map_layer_index(&mut caller, key, name_ptr, name_len)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_MESH_CREATE,
-        |mut caller: Caller<'_, ()>,
-         key: u64,
-         v_ptr: u32,
-         v_len: u32,
-         i_ptr: u32,
-         i_len: u32|
-         -> u32 { av::graphics_mesh_create(&mut caller, key, v_ptr, v_len, i_ptr, i_len) },
+        host_imports::GRAPHICS_MAP_TILE,
+        |_caller: Caller<'_, GuestLimits>, key: u64, layer: u32, column: u32, row: u32| -> u32 {
+            av::graphics_map_tile(key, layer, column, row)
+        },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_MESH_CREATE_OBJ,
-        |mut caller: Caller<'_, ()>, key: u64, ptr: u32, len: u32| -> u32 {
-            av::graphics_mesh_create_obj(&mut caller, key, ptr, len)
-        },
+        host_imports::GRAPHICS_MAP_OBJECTS,
+        |_caller: Caller<'_, GuestLimits>, key: u64| -> u32 { av::graphics_map_objects(key) },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_MESH_CREATE_STL,
-        |mut caller: Caller<'_, ()>, key: u64, ptr: u32, len: u32| -> u32 {
-            av::graphics_mesh_create_stl(&mut caller, key, ptr, len)
+        host_imports::GRAPHICS_MAP_DRAW,
+        |_caller: Caller<'_, GuestLimits>, key: u64, x: i32, y: i32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_map_draw(key, x, y)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_MESH_SET_TEXTURE,
-        |_caller: Caller<'_, ()>, mesh_key: u64, image_key: u64| -> u32 {
-            av::graphics_mesh_set_texture(mesh_key, image_key)
+        host_imports::GRAPHICS_MAP_DRAW_LAYER,
+        |_caller: Caller<'_, GuestLimits>, key: u64, layer: u32, x: i32, y: i32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_map_draw_layer(key, layer, x, y)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_MESH_DRAW,
-        |_caller: Caller<'_, ()>,
-         key: u64,
-         x: f32,
-         y: f32,
-         z: f32,
-         rx: f32,
-         ry: f32,
-         rz: f32,
-         sx: f32,
-         sy: f32,
-         sz: f32| {
-            av::graphics_mesh_draw(key, x, y, z, rx, ry, rz, sx, sy, sz);
+        host_imports::GRAPHICS_PNG_REGISTER,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
+            av::graphics_png_register(&mut caller, key, data_ptr, data_len)
         },
     )?;
 
-    // Materials / textures (OBJ+MTL workflows)
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::GRAPHICS_MTL_REGISTER_TEXTURE,
-        |mut caller: Caller<'_, ()>,
-         texture_key: u64,
-         mtl_ptr: u32,
-         mtl_len: u32,
-         tex_filename_ptr: u32,
-         tex_filename_len: u32,
-         tex_ptr: u32,
-         tex_len: u32|
-         -> u32 {
-            av::graphics_mtl_register_texture(
-                &mut caller,
-                texture_key,
-                mtl_ptr,
-                mtl_len,
-                tex_filename_ptr,
-                tex_filename_len,
-                tex_ptr,
-                tex_len,
-            )
+        host_imports::GRAPHICS_PNG_DRAW_KEY,
+        |_caller: Caller<'_, GuestLimits>, key: u64, x: i32, y: i32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_png_draw_key(key, x, y)
         },
     )?;
 
-    // --- Input ---
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::INPUT_IS_BUTTON_DOWN,
-        |_caller: Caller<'_, ()>, port: u32, btn: u32| -> u32 {
-            input::joypad_button_pressed(port, btn)
+        host_imports::GRAPHICS_PNG_DRAW_KEY_SCALED,
+        |_caller: Caller<'_, GuestLimits>, key: u64, x: i32, y: i32, w: u32, h: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_png_draw_key_scaled(key, x, y, w, h)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::INPUT_IS_KEY_DOWN,
-        |_caller: Caller<'_, ()>, key: u32| -> u32 { input::key_pressed(key) },
+        host_imports::GRAPHICS_PNG_UNREGISTER,
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
+            av::graphics_png_unregister(key);
+        },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::INPUT_GET_MOUSE_X,
-        |_caller: Caller<'_, ()>| -> i32 { input::mouse_x() },
-    )?;
-
+        host_imports::GRAPHICS_IMAGE_DRAW_REGION,
+        |_caller: Caller<'_, GuestLimits>,
+         key: u64,
+         sx: i32,
+         sy: i32,
+         sw: u32,
+         sh: u32,
+         x: i32,
+         y: i32,
+         w: u32,
+         h: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_image_draw_region(key, sx, sy, sw, sh, x, y, w, h)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_IMAGE_DRAW_EX,
+        |_caller: Caller<'_, GuestLimits>,
+         key: u64,
+         x: i32,
+         y: i32,
+         w: u32,
+         h: u32,
+         angle: f32,
+         flags: u32,
+         pivot_x: i32,
+         pivot_y: i32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_image_draw_ex(key, x, y, w, h, angle, flags, pivot_x, pivot_y)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_IMAGE_DRAW_NINE_SLICE,
+        |_caller: Caller<'_, GuestLimits>,
+         key: u64,
+         x: i32,
+         y: i32,
+         w: u32,
+         h: u32,
+         left: u32,
+         top: u32,
+         right: u32,
+         bottom: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_image_draw_nine_slice(key, x, y, w, h, left, top, right, bottom)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_IMAGE_DRAW_BATCH,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, ptr: u32, count: u32| {
+            system::stats::count_draw();
+            av::graphics_image_draw_batch(&mut caller, key, ptr, count);
+        },
+    )?;
+
+    // Palette mode
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PALETTE_SET,
+        |_caller: Caller<'_, GuestLimits>, index: u32, r: u32, g: u32, b: u32| {
+            av::graphics_palette_set(index, r, g, b);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PALETTE_SWAP,
+        |_caller: Caller<'_, GuestLimits>, from: u32, to: u32| {
+            av::graphics_palette_swap(from, to);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PALETTE_SET_TRANSPARENT,
+        |_caller: Caller<'_, GuestLimits>, index: u32, transparent: u32| {
+            av::graphics_palette_set_transparent(index, transparent);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PALETTE_RESET,
+        |_caller: Caller<'_, GuestLimits>| {
+            av::graphics_palette_reset();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SET_COLOR_INDEX,
+        |_caller: Caller<'_, GuestLimits>, index: u32| {
+            av::graphics_set_color_index(index);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_INDEXED_REGISTER,
+        |mut caller: Caller<'_, GuestLimits>,
+         key: u64,
+         width: u32,
+         height: u32,
+         data_ptr: u32,
+         data_len: u32|
+         -> u32 {
+            av::graphics_indexed_register(&mut caller, key, width, height, data_ptr, data_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_INDEXED_DRAW,
+        |_caller: Caller<'_, GuestLimits>, key: u64, x: i32, y: i32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_indexed_draw(key, x, y);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_INDEXED_UNREGISTER,
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
+            av::graphics_indexed_unregister(key);
+        },
+    )?;
+
+    // Particles
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PARTICLES_CREATE,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, config_ptr: u32, config_len: u32| -> u32 {
+            av::graphics_particles_create(&mut caller, key, config_ptr, config_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PARTICLES_EMIT,
+        |_caller: Caller<'_, GuestLimits>, key: u64, x: i32, y: i32, count: u32| {
+            av::graphics_particles_emit(key, x, y, count);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PARTICLES_UPDATE_AND_DRAW,
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
+            system::stats::count_draw();
+            av::graphics_particles_update_and_draw(key);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PARTICLES_COUNT,
+        |_caller: Caller<'_, GuestLimits>, key: u64| -> u32 { av::graphics_particles_count(key) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PARTICLES_CLEAR,
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
+            av::graphics_particles_clear(key);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PARTICLES_DESTROY,
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
+            av::graphics_particles_destroy(key);
+        },
+    )?;
+
+    // 2D camera
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_CAMERA_SET,
+        |_caller: Caller<'_, GuestLimits>, x: f32, y: f32, zoom: f32, rotation: f32| {
+            av::graphics_camera_set(x, y, zoom, rotation);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_CAMERA_SET_BOUNDS,
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, w: u32, h: u32| {
+            av::graphics_camera_set_bounds(x, y, w, h);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_CAMERA_SHAKE,
+        |_caller: Caller<'_, GuestLimits>, magnitude: f32, duration_ms: u32| {
+            av::graphics_camera_shake(magnitude, duration_ms);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_CAMERA_RESET,
+        |_caller: Caller<'_, GuestLimits>| {
+            av::graphics_camera_reset();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SCREEN_TO_WORLD,
+        |_caller: Caller<'_, GuestLimits>, x: f32, y: f32| -> u64 {
+            av::graphics_screen_to_world(x, y)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_WORLD_TO_SCREEN,
+        |_caller: Caller<'_, GuestLimits>, x: f32, y: f32| -> u64 {
+            av::graphics_world_to_screen(x, y)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_LAYER_BEGIN,
+        |_caller: Caller<'_, GuestLimits>, index: u32| {
+            av::graphics_layer_begin(index);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_LAYER_END,
+        |_caller: Caller<'_, GuestLimits>| {
+            av::graphics_layer_end();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_LAYER_SET_VISIBLE,
+        |_caller: Caller<'_, GuestLimits>, index: u32, visible: u32| {
+            av::graphics_layer_set_visible(index, visible);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_LAYER_SET_PARALLAX,
+        |_caller: Caller<'_, GuestLimits>, index: u32, factor: f32| {
+            av::graphics_layer_set_parallax(index, factor);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_LAYER_SET_ORDER,
+        |_caller: Caller<'_, GuestLimits>, index: u32, order: i32| {
+            av::graphics_layer_set_order(index, order);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_MASK_BEGIN,
+        |_caller: Caller<'_, GuestLimits>| {
+            av::graphics_mask_begin();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_MASK_END,
+        |_caller: Caller<'_, GuestLimits>| {
+            av::graphics_mask_end();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_MASK_USE,
+        |_caller: Caller<'_, GuestLimits>, invert: u32| {
+            av::graphics_mask_use(invert);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_MASK_OFF,
+        |_caller: Caller<'_, GuestLimits>| {
+            av::graphics_mask_off();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PATH_BEGIN,
+        |_caller: Caller<'_, GuestLimits>| {
+            av::graphics_path_begin();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PATH_MOVE_TO,
+        |_caller: Caller<'_, GuestLimits>, x: f32, y: f32| {
+            av::graphics_path_move_to(x, y);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PATH_LINE_TO,
+        |_caller: Caller<'_, GuestLimits>, x: f32, y: f32| {
+            av::graphics_path_line_to(x, y);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PATH_CURVE_TO,
+        |_caller: Caller<'_, GuestLimits>,
+         cx1: f32,
+         cy1: f32,
+         cx2: f32,
+         cy2: f32,
+         x: f32,
+         y: f32| {
+            av::graphics_path_curve_to(cx1, cy1, cx2, cy2, x, y);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PATH_CLOSE,
+        |_caller: Caller<'_, GuestLimits>| {
+            av::graphics_path_close();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PATH_FILL,
+        |_caller: Caller<'_, GuestLimits>, even_odd: u32| {
+            system::stats::count_draw();
+            av::graphics_path_fill(even_odd);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PATH_STROKE,
+        |_caller: Caller<'_, GuestLimits>| {
+            system::stats::count_draw();
+            av::graphics_path_stroke();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TRANSITION_START,
+        |_caller: Caller<'_, GuestLimits>, kind: u32, duration_ms: u32| {
+            av::graphics_transition_start(kind, duration_ms);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TRANSITION_ACTIVE,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { av::graphics_transition_active() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TRANSITION_MIDPOINT,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { av::graphics_transition_midpoint() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_JPEG_REGISTER,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
+            av::graphics_jpeg_register(&mut caller, key, data_ptr, data_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_IMAGE_REGISTER_ASYNC,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
+            av::graphics_image_register_async(&mut caller, key, data_ptr, data_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_JPEG_DRAW_KEY,
+        |_caller: Caller<'_, GuestLimits>, key: u64, x: i32, y: i32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_jpeg_draw_key(key, x, y)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_JPEG_DRAW_KEY_SCALED,
+        |_caller: Caller<'_, GuestLimits>, key: u64, x: i32, y: i32, w: u32, h: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_jpeg_draw_key_scaled(key, x, y, w, h)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_JPEG_UNREGISTER,
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
+            av::graphics_jpeg_unregister(key);
+        },
+    )?;
+
+    // Fonts (keyed)
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FONT_REGISTER_TTF,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
+            av::graphics_font_register_ttf(&mut caller, key, data_ptr, data_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FONT_REGISTER_BDF,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
+            av::graphics_font_register_bdf(&mut caller, key, data_ptr, data_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FONT_REGISTER_FNT,
+        |mut caller: Caller<'_, GuestLimits>,
+         key: u64,
+         data_ptr: u32,
+         data_len: u32,
+         atlas_key: u64|
+         -> u32 {
+            av::graphics_font_register_fnt(&mut caller, key, data_ptr, data_len, atlas_key)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FONT_REGISTER_SPLEEN,
+        |_caller: Caller<'_, GuestLimits>, key: u64, size: u32| -> u32 {
+            av::graphics_font_register_spleen(key, size)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FONT_UNREGISTER,
+        |_caller: Caller<'_, GuestLimits>, key: u64| {
+            av::graphics_font_unregister(key);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FONT_ADD_FALLBACK,
+        |_caller: Caller<'_, GuestLimits>, primary: u64, fallback: u64| -> u32 {
+            av::graphics_font_add_fallback(primary, fallback)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TEXT_KEY,
+        |mut caller: Caller<'_, GuestLimits>,
+         x: i32,
+         y: i32,
+         font_key: u64,
+         text_ptr: u32,
+         text_len: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_text_key(x, y, &mut caller, font_key, text_ptr, text_len);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TEXT_MEASURE_KEY,
+        |mut caller: Caller<'_, GuestLimits>, font_key: u64, text_ptr: u32, text_len: u32| -> u64 {
+            av::graphics_text_measure_key(&mut caller, font_key, text_ptr, text_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TEXT_SIZED_KEY,
+        |mut caller: Caller<'_, GuestLimits>,
+         x: i32,
+         y: i32,
+         font_key: u64,
+         size_px: u32,
+         text_ptr: u32,
+         text_len: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_text_sized_key(x, y, &mut caller, font_key, size_px, text_ptr, text_len);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TEXT_MEASURE_SIZED_KEY,
+        |mut caller: Caller<'_, GuestLimits>,
+         font_key: u64,
+         size_px: u32,
+         text_ptr: u32,
+         text_len: u32|
+         -> u64 {
+            av::graphics_text_measure_sized_key(&mut caller, font_key, size_px, text_ptr, text_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TEXT_MEASURE_UP_TO_KEY,
+        |mut caller: Caller<'_, GuestLimits>,
+         font_key: u64,
+         text_ptr: u32,
+         text_len: u32,
+         byte_offset: u32|
+         -> u32 {
+            av::graphics_text_measure_up_to_key(
+                &mut caller,
+                font_key,
+                text_ptr,
+                text_len,
+                byte_offset,
+            )
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FONT_METRICS_KEY,
+        |_caller: Caller<'_, GuestLimits>, font_key: u64| -> u64 {
+            av::graphics_font_metrics_key(font_key)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SET_TEXT_SCALE,
+        |_caller: Caller<'_, GuestLimits>, multiplier: f32| {
+            av::graphics_set_text_scale(multiplier);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_FONT_REGISTER_TTF_SDF,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32| -> u32 {
+            av::graphics_font_register_ttf_sdf(&mut caller, key, data_ptr, data_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TEXT_SDF_KEY,
+        |mut caller: Caller<'_, GuestLimits>,
+         x: f32,
+         y: f32,
+         font_key: u64,
+         size_px: f32,
+         angle: f32,
+         text_ptr: u32,
+         text_len: u32,
+         style_ptr: u32| {
+            system::stats::count_draw();
+            av::graphics_text_sdf_key(
+                &mut caller,
+                x,
+                y,
+                font_key,
+                size_px,
+                angle,
+                text_ptr,
+                text_len,
+                style_ptr,
+            );
+        },
+    )?;
+
+    // Shapes
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TRIANGLE,
+        |_caller: Caller<'_, GuestLimits>, x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32| {
+            system::stats::count_draw();
+            let (x1, y1) = av::camera_point(x1, y1);
+            let (x2, y2) = av::camera_point(x2, y2);
+            let (x3, y3) = av::camera_point(x3, y3);
+            av::graphics_triangle(x1, y1, x2, y2, x3, y3);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_TRIANGLE_OUTLINE,
+        |_caller: Caller<'_, GuestLimits>, x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32| {
+            system::stats::count_draw();
+            let (x1, y1) = av::camera_point(x1, y1);
+            let (x2, y2) = av::camera_point(x2, y2);
+            let (x3, y3) = av::camera_point(x3, y3);
+            av::graphics_triangle_outline(x1, y1, x2, y2, x3, y3);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_BEZIER_QUADRATIC,
+        |_caller: Caller<'_, GuestLimits>,
+         x1: i32,
+         y1: i32,
+         cx: i32,
+         cy: i32,
+         x2: i32,
+         y2: i32,
+         segments: u32| {
+            system::stats::count_draw();
+            let (x1, y1) = av::camera_point(x1, y1);
+            let (x2, y2) = av::camera_point(x2, y2);
+            let (cx, cy) = av::camera_point(cx, cy);
+            av::graphics_bezier_quadratic(x1, y1, cx, cy, x2, y2, segments);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_BEZIER_CUBIC,
+        |_caller: Caller<'_, GuestLimits>,
+         x1: i32,
+         y1: i32,
+         cx1: i32,
+         cy1: i32,
+         cx2: i32,
+         cy2: i32,
+         x2: i32,
+         y2: i32,
+         segments: u32| {
+            system::stats::count_draw();
+            let (x1, y1) = av::camera_point(x1, y1);
+            let (x2, y2) = av::camera_point(x2, y2);
+            let (cx1, cy1) = av::camera_point(cx1, cy1);
+            let (cx2, cy2) = av::camera_point(cx2, cy2);
+            av::graphics_bezier_cubic(x1, y1, cx1, cy1, cx2, cy2, x2, y2, segments);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PILL,
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, w: u32, h: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_pill(x, y, w, h);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_PILL_OUTLINE,
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, w: u32, h: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_pill_outline(x, y, w, h);
+        },
+    )?;
+
+    // Vertex buffers: (ptr, count) of packed i32 x/y pairs
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_POLYGON,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, count: u32| {
+            system::stats::count_draw();
+            let _ = av::graphics_polygon(&mut caller, ptr, count);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_POLYLINE,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, count: u32, closed: u32| {
+            system::stats::count_draw();
+            let _ = av::graphics_polyline(&mut caller, ptr, count, closed != 0);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_ELLIPSE,
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, rx: u32, ry: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_ellipse(x, y, rx, ry);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_ELLIPSE_OUTLINE,
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, rx: u32, ry: u32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_ellipse_outline(x, y, rx, ry);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_ARC,
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, r: u32, start: f32, end: f32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_arc(x, y, r, start, end);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_ARC_FILLED,
+        |_caller: Caller<'_, GuestLimits>, x: i32, y: i32, r: u32, start: f32, end: f32| {
+            system::stats::count_draw();
+            let (x, y) = av::camera_point(x, y);
+            av::graphics_arc_filled(x, y, r, start, end);
+        },
+    )?;
+
+    // 3D
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_SET_3D,
+        |_caller: Caller<'_, GuestLimits>, enable: u32| {
+            av::graphics_set_3d(enable != 0);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_CAMERA_LOOK_AT,
+        |_caller: Caller<'_, GuestLimits>,
+         eye_x: f32,
+         eye_y: f32,
+         eye_z: f32,
+         target_x: f32,
+         target_y: f32,
+         target_z: f32,
+         up_x: f32,
+         up_y: f32,
+         up_z: f32| {
+            av::graphics_camera_look_at(
+                eye_x, eye_y, eye_z, target_x, target_y, target_z, up_x, up_y, up_z,
+            );
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_CAMERA_PERSPECTIVE,
+        |_caller: Caller<'_, GuestLimits>, fovy: f32, aspect: f32, near: f32, far: f32| {
+            av::graphics_camera_perspective(fovy, aspect, near, far);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_MESH_CREATE,
+        |mut caller: Caller<'_, GuestLimits>,
+         key: u64,
+         v_ptr: u32,
+         v_len: u32,
+         i_ptr: u32,
+         i_len: u32|
+         -> u32 { av::graphics_mesh_create(&mut caller, key, v_ptr, v_len, i_ptr, i_len) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_MESH_CREATE_OBJ,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, ptr: u32, len: u32| -> u32 {
+            av::graphics_mesh_create_obj(&mut caller, key, ptr, len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_MESH_CREATE_STL,
+        |mut caller: Caller<'_, GuestLimits>, key: u64, ptr: u32, len: u32| -> u32 {
+            av::graphics_mesh_create_stl(&mut caller, key, ptr, len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_MESH_SET_TEXTURE,
+        |_caller: Caller<'_, GuestLimits>, mesh_key: u64, image_key: u64| -> u32 {
+            av::graphics_mesh_set_texture(mesh_key, image_key)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_MESH_DRAW,
+        |_caller: Caller<'_, GuestLimits>,
+         key: u64,
+         x: f32,
+         y: f32,
+         z: f32,
+         rx: f32,
+         ry: f32,
+         rz: f32,
+         sx: f32,
+         sy: f32,
+         sz: f32| {
+            system::stats::count_draw();
+            av::graphics_mesh_draw(key, x, y, z, rx, ry, rz, sx, sy, sz);
+        },
+    )?;
+
+    // Materials / textures (OBJ+MTL workflows)
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::GRAPHICS_MTL_REGISTER_TEXTURE,
+        |mut caller: Caller<'_, GuestLimits>,
+         texture_key: u64,
+         mtl_ptr: u32,
+         mtl_len: u32,
+         tex_filename_ptr: u32,
+         tex_filename_len: u32,
+         tex_ptr: u32,
+         tex_len: u32|
+         -> u32 {
+            av::graphics_mtl_register_texture(
+                &mut caller,
+                texture_key,
+                mtl_ptr,
+                mtl_len,
+                tex_filename_ptr,
+                tex_filename_len,
+                tex_ptr,
+                tex_len,
+            )
+        },
+    )?;
+
+    // --- Input ---
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_IS_BUTTON_DOWN,
+        |_caller: Caller<'_, GuestLimits>, port: u32, btn: u32| -> u32 {
+            input::joypad_button_pressed(port, btn)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_IS_KEY_DOWN,
+        |_caller: Caller<'_, GuestLimits>, key: u32| -> u32 { input::key_pressed(key) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_GET_MOUSE_X,
+        |_caller: Caller<'_, GuestLimits>| -> i32 { input::mouse_x() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_GET_MOUSE_Y,
+        |_caller: Caller<'_, GuestLimits>| -> i32 { input::mouse_y() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_IS_MOUSE_DOWN,
+        |_caller: Caller<'_, GuestLimits>, btn: u32| -> u32 {
+            let mask = input::mouse_buttons();
+            let requested = 1u32 << btn;
+            if (mask & requested) != 0 { 1 } else { 0 }
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_GET_CONNECTED_PORTS,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { input::connected_ports() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_SNAPSHOT,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            input::snapshot::snapshot_guest(&mut caller, ptr, len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_GET_CONTROLLER_NAME,
+        |_caller: Caller<'_, GuestLimits>, port: u32| -> u32 { input::controller_name(port) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_PORTS_CHANGED,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { input::ports_changed() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_BUTTON_HELD_MILLIS,
+        |_caller: Caller<'_, GuestLimits>, port: u32, btn: u32| -> u32 {
+            input::button_held_millis(port, btn)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_KEY_HELD_MILLIS,
+        |_caller: Caller<'_, GuestLimits>, key: u32| -> u32 { input::key_held_millis(key) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_GET_TOUCH_COUNT,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { input::touch_count() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_GET_TOUCH_ID,
+        |_caller: Caller<'_, GuestLimits>, index: u32| -> u32 {
+            input::touch(index).map(|t| t.id).unwrap_or(0)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_GET_TOUCH_X,
+        |_caller: Caller<'_, GuestLimits>, index: u32| -> i32 {
+            input::touch(index).map(|t| t.x).unwrap_or(0)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_GET_TOUCH_Y,
+        |_caller: Caller<'_, GuestLimits>, index: u32| -> i32 {
+            input::touch(index).map(|t| t.y).unwrap_or(0)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_GET_TOUCH_PHASE,
+        |_caller: Caller<'_, GuestLimits>, index: u32| -> u32 {
+            input::touch(index).map(|t| t.phase as u32).unwrap_or(0)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_SET_TOUCH_MOUSE,
+        |_caller: Caller<'_, GuestLimits>, enabled: u32| {
+            input::set_touch_mouse(enabled != 0);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_TEXT_INPUT_START,
+        |_caller: Caller<'_, GuestLimits>| {
+            input::text_input_start();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_TEXT_INPUT_STOP,
+        |_caller: Caller<'_, GuestLimits>| {
+            input::text_input_stop();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_GET_TEXT_INPUT,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { input::take_text_input() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_RECORD_START,
+        |_caller: Caller<'_, GuestLimits>| {
+            input::replay::record_start();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_RECORD_STOP,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { input::replay::record_stop() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_REPLAY,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            input::replay::replay_start_guest(&mut caller, ptr, len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::INPUT_IS_REPLAYING,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { input::replay::is_replaying() },
+    )?;
+
+    // --- Audio ---
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_INIT,
+        |_caller: Caller<'_, GuestLimits>, sample_rate: u32| -> u32 { av::audio_init(sample_rate) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_PUSH_SAMPLES,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| {
+            let _ = av::audio_push_samples(&mut caller, ptr, len);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_GET_QUEUED_SAMPLES,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { av::audio_get_queued_samples() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_GET_BUFFER_CAPACITY,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { av::audio_get_buffer_capacity() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_PLAY_WAV,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| {
+            av::audio_play_wav(&mut caller, ptr, len);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_PLAY_QOA,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| {
+            av::audio_play_qoa(&mut caller, ptr, len);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_PLAY_XM,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| {
+            av::audio_play_xm(&mut caller, ptr, len);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_XM_PLAY,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            av::audio_xm_play(&mut caller, ptr, len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_XM_PAUSE,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, paused: u32| {
+            av::audio_xm_pause(handle, paused != 0);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_XM_STOP,
+        |_caller: Caller<'_, GuestLimits>, handle: u32| {
+            av::audio_xm_stop(handle);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_XM_SET_POSITION,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, order: u32, row: u32| -> u32 {
+            av::audio_xm_set_position(handle, order, row)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_XM_GET_POSITION,
+        |_caller: Caller<'_, GuestLimits>, handle: u32| -> u32 {
+            av::audio_xm_get_position(handle)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_XM_SET_LOOP,
+        |_caller: Caller<'_, GuestLimits>,
+         handle: u32,
+         start_order: u32,
+         start_row: u32,
+         end_order: u32,
+         end_row: u32|
+         -> u32 {
+            av::audio_xm_set_loop(handle, start_order, start_row, end_order, end_row)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_XM_SET_LOOPING,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, enabled: u32| {
+            av::audio_xm_set_looping(handle, enabled != 0);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_XM_SET_GROUP,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, group: u32| {
+            av::audio_xm_set_group(handle, group);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_CREATE,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32, format: u32| -> u32 {
+            av::audio_music_create(&mut caller, ptr, len, format)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_PLAY,
+        |_caller: Caller<'_, GuestLimits>, handle: u32| {
+            av::audio_music_play(handle);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_PAUSE,
+        |_caller: Caller<'_, GuestLimits>, handle: u32| {
+            av::audio_music_pause(handle);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_STOP,
+        |_caller: Caller<'_, GuestLimits>, handle: u32| {
+            av::audio_music_stop(handle);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_DESTROY,
+        |_caller: Caller<'_, GuestLimits>, handle: u32| {
+            av::audio_music_destroy(handle);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_SEEK,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, millis: u32| -> u32 {
+            av::audio_music_seek(handle, millis)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_POSITION,
+        |_caller: Caller<'_, GuestLimits>, handle: u32| -> u32 { av::audio_music_position(handle) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_SET_VOLUME,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, vol: f32| {
+            av::audio_music_set_volume(handle, vol);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_SET_LOOPING,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, enabled: u32| {
+            av::audio_music_set_looping(handle, enabled != 0);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_SET_GROUP,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, group: u32| {
+            av::audio_music_set_group(handle, group);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MUSIC_CROSSFADE,
+        |_caller: Caller<'_, GuestLimits>, from: u32, to: u32, millis: u32| {
+            av::audio_music_crossfade(from, to, millis);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SOUNDFONT_CREATE,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            av::audio_soundfont_create(&mut caller, ptr, len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SOUNDFONT_DESTROY,
+        |_caller: Caller<'_, GuestLimits>, id: u32| {
+            av::audio_soundfont_destroy(id);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MIDI_PLAY,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32, soundfont: u32| -> u32 {
+            av::audio_midi_play(&mut caller, ptr, len, soundfont)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MIDI_SET_TEMPO,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, scale: f32| {
+            av::audio_midi_set_tempo(handle, scale);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_MIDI_SET_CHANNEL_VOLUME,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, channel: u32, vol: f32| {
+            av::audio_midi_set_channel_volume(handle, channel, vol);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SOUND_POOL_CREATE,
+        |mut caller: Caller<'_, GuestLimits>,
+         ptr: u32,
+         len: u32,
+         max_voices: u32,
+         steal_policy: u32|
+         -> u32 {
+            av::audio_sound_pool_create(&mut caller, ptr, len, max_voices, steal_policy)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SOUND_POOL_CREATE_ASYNC,
+        |mut caller: Caller<'_, GuestLimits>,
+         ptr: u32,
+         len: u32,
+         max_voices: u32,
+         steal_policy: u32|
+         -> u32 {
+            av::audio_sound_pool_create_async(&mut caller, ptr, len, max_voices, steal_policy)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SOUND_POOL_PLAY,
+        |_caller: Caller<'_, GuestLimits>, pool: u32, vol: f32, pan: f32| -> u32 {
+            av::audio_sound_pool_play(pool, vol, pan)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SOUND_POOL_SET_PITCH_VARIATION,
+        |_caller: Caller<'_, GuestLimits>, pool: u32, amount: f32| {
+            av::audio_sound_pool_set_pitch_variation(pool, amount);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SOUND_POOL_SET_GROUP,
+        |_caller: Caller<'_, GuestLimits>, pool: u32, group: u32| {
+            av::audio_sound_pool_set_group(pool, group);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SOUND_POOL_ACTIVE,
+        |_caller: Caller<'_, GuestLimits>, pool: u32| -> u32 { av::audio_sound_pool_active(pool) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SOUND_POOL_STOP,
+        |_caller: Caller<'_, GuestLimits>, pool: u32| {
+            av::audio_sound_pool_stop(pool);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SOUND_POOL_DESTROY,
+        |_caller: Caller<'_, GuestLimits>, pool: u32| {
+            av::audio_sound_pool_destroy(pool);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SET_MASTER_VOLUME,
+        |_caller: Caller<'_, GuestLimits>, vol: f32| {
+            av::audio_set_master_volume(vol);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_GET_MASTER_VOLUME,
+        |_caller: Caller<'_, GuestLimits>| -> f32 { av::audio_get_master_volume() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SET_GROUP_VOLUME,
+        |_caller: Caller<'_, GuestLimits>, group: u32, vol: f32| {
+            av::audio_set_group_volume(group, vol);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_GET_GROUP_VOLUME,
+        |_caller: Caller<'_, GuestLimits>, group: u32| -> f32 { av::audio_get_group_volume(group) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SYNTH_SET_GROUP,
+        |_caller: Caller<'_, GuestLimits>, voice: u32, group: u32| {
+            av::synth::set_group(voice, group);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SET_PAN,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, pan: f32| {
+            av::audio_set_pan(handle, pan);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SYNTH_SET_PAN,
+        |_caller: Caller<'_, GuestLimits>, voice: u32, pan: f32| {
+            av::synth::set_pan(voice, pan);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SET_LISTENER,
+        |_caller: Caller<'_, GuestLimits>, x: f32, y: f32| {
+            av::audio_set_listener(x, y);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_PLAY_WAV_AT,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32, x: f32, y: f32| -> u32 {
+            av::audio_play_wav_at(&mut caller, ptr, len, x, y)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SET_PITCH,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, ratio: f32| {
+            av::audio_set_pitch(handle, ratio);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_PLAY_WAV_PITCHED,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32, ratio: f32| -> u32 {
+            av::audio_play_wav_pitched(&mut caller, ptr, len, ratio)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_EFFECT_ENABLE,
+        |_caller: Caller<'_, GuestLimits>, effect: u32, a: f32, b: f32| -> u32 {
+            av::audio_effect_enable(effect, a, b)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_EFFECT_DISABLE,
+        |_caller: Caller<'_, GuestLimits>, effect: u32| {
+            av::audio_effect_disable(effect);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SET_SEND,
+        |_caller: Caller<'_, GuestLimits>, handle: u32, effect: u32, level: f32| {
+            av::audio_set_send(handle, effect, level);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SYNTH_SET_SEND,
+        |_caller: Caller<'_, GuestLimits>, voice: u32, effect: u32, level: f32| {
+            av::audio_synth_set_send(voice, effect, level);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_GROUP_SET_SEND,
+        |_caller: Caller<'_, GuestLimits>, group: u32, effect: u32, level: f32| {
+            av::audio_group_set_send(group, effect, level);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_CAPTURE_START,
+        |_caller: Caller<'_, GuestLimits>, sample_rate: u32| -> u32 {
+            av::audio_capture_start(sample_rate)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_CAPTURE_READ,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, max_samples: u32| -> u32 {
+            av::audio_capture_read(&mut caller, ptr, max_samples)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_CAPTURE_STOP,
+        |_caller: Caller<'_, GuestLimits>| {
+            av::audio_capture_stop();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SYNTH_VOICE_CREATE,
+        |_caller: Caller<'_, GuestLimits>, waveform: u32| -> u32 {
+            av::synth::voice_create(waveform)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SYNTH_VOICE_DESTROY,
+        |_caller: Caller<'_, GuestLimits>, voice: u32| {
+            av::synth::voice_destroy(voice);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SYNTH_SET_ENVELOPE,
+        |_caller: Caller<'_, GuestLimits>,
+         voice: u32,
+         attack_ms: u32,
+         decay_ms: u32,
+         sustain: f32,
+         release_ms: u32| {
+            av::synth::set_envelope(voice, attack_ms, decay_ms, sustain, release_ms);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SYNTH_NOTE_ON,
+        |_caller: Caller<'_, GuestLimits>, voice: u32, freq: f32, volume: f32| {
+            av::synth::note_on(voice, freq, volume);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::AUDIO_SYNTH_NOTE_OFF,
+        |_caller: Caller<'_, GuestLimits>, voice: u32| {
+            av::synth::note_off(voice);
+        },
+    )?;
+
+    // --- System ---
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_LOG,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| {
+            let memory = caller.get_export("memory").and_then(|e| e.into_memory());
+            let Some(memory) = memory else {
+                return;
+            };
+
+            let mut buf = vec![0u8; len as usize];
+            if memory.read(&caller, ptr as usize, &mut buf).is_ok()
+                && let Ok(msg) = core::str::from_utf8(&buf)
+            {
+                system::log::log(system::log::LEVEL_INFO, msg);
+            }
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_LOG_AT,
+        |mut caller: Caller<'_, GuestLimits>, level: u32, ptr: u32, len: u32| {
+            // Skip the copy entirely for filtered-out messages.
+            if !system::log::enabled(level) {
+                return;
+            }
+            let memory = caller.get_export("memory").and_then(|e| e.into_memory());
+            let Some(memory) = memory else {
+                return;
+            };
+
+            let mut buf = vec![0u8; len as usize];
+            if memory.read(&caller, ptr as usize, &mut buf).is_ok() {
+                system::log::log(level, &String::from_utf8_lossy(&buf));
+            }
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_REPORT_ERROR,
+        |mut caller: Caller<'_, GuestLimits>,
+         msg_ptr: u32,
+         msg_len: u32,
+         stack_ptr: u32,
+         stack_len: u32| {
+            let memory = caller.get_export("memory").and_then(|e| e.into_memory());
+            let Some(memory) = memory else {
+                return;
+            };
+
+            let mut msg = vec![0u8; msg_len as usize];
+            let mut stack = vec![0u8; stack_len as usize];
+            if memory.read(&caller, msg_ptr as usize, &mut msg).is_ok()
+                && memory.read(&caller, stack_ptr as usize, &mut stack).is_ok()
+            {
+                system::log::report_error(
+                    &String::from_utf8_lossy(&msg),
+                    &String::from_utf8_lossy(&stack),
+                );
+            }
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_SET_LOG_LEVEL,
+        |_caller: Caller<'_, GuestLimits>, level: u32| {
+            system::log::set_log_level(level);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_MILLIS,
+        |_caller: Caller<'_, GuestLimits>| -> u64 { crate::av::utils::system_millis() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_UNIX_TIME,
+        |_caller: Caller<'_, GuestLimits>| -> i64 { system::clock::unix_time() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_LOCAL_TIME_OFFSET_MINUTES,
+        |_caller: Caller<'_, GuestLimits>| -> i32 { system::clock::local_offset_guest() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_GET_LOCALE,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { system::locale::locale_guest() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_DELTA_MILLIS,
+        |_caller: Caller<'_, GuestLimits>| -> u64 { system::delta_millis() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_SET_TARGET_FPS,
+        |_caller: Caller<'_, GuestLimits>, fps: u32| {
+            system::set_target_fps(fps);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_GET_FPS,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { system::get_fps() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_SET_UPDATE_RATE,
+        |_caller: Caller<'_, GuestLimits>, hz: u32| {
+            system::set_update_rate(hz);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_INTERPOLATION_ALPHA,
+        |_caller: Caller<'_, GuestLimits>| -> f32 { system::interpolation_alpha() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_RANDOM,
+        |_caller: Caller<'_, GuestLimits>| -> u64 { system::random() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_RANDOM_SEED,
+        |_caller: Caller<'_, GuestLimits>| -> u64 { system::random_seed() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_QUIT,
+        |_caller: Caller<'_, GuestLimits>| {
+            system::request_quit();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_RESET,
+        |_caller: Caller<'_, GuestLimits>| {
+            system::request_reset();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_CLIPBOARD_GET,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { system::clipboard::read_start() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_CLIPBOARD_POLL,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { system::clipboard::read_poll(id) },
+    )?;
+
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::INPUT_GET_MOUSE_Y,
-        |_caller: Caller<'_, ()>| -> i32 { input::mouse_y() },
+        host_imports::SYSTEM_CLIPBOARD_TAKE,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { system::clipboard::read_take(id) },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::INPUT_IS_MOUSE_DOWN,
-        |_caller: Caller<'_, ()>, btn: u32| -> u32 {
-            let mask = input::mouse_buttons();
-            let requested = 1u32 << btn;
-            if (mask & requested) != 0 { 1 } else { 0 }
+        host_imports::SYSTEM_CLIPBOARD_CANCEL,
+        |_caller: Caller<'_, GuestLimits>, id: u32| {
+            system::clipboard::read_cancel(id);
         },
     )?;
 
-    // --- Audio ---
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::AUDIO_INIT,
-        |_caller: Caller<'_, ()>, sample_rate: u32| -> u32 { av::audio_init(sample_rate) },
+        host_imports::SYSTEM_CLIPBOARD_SET,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            system::clipboard::set_guest(&mut caller, ptr, len)
+        },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::AUDIO_PUSH_SAMPLES,
-        |mut caller: Caller<'_, ()>, ptr: u32, len: u32| {
-            let _ = av::audio_push_samples(&mut caller, ptr, len);
+        host_imports::SYSTEM_CART_META,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            system::cart::meta_guest(&mut caller, ptr, len)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::AUDIO_PLAY_WAV,
-        |mut caller: Caller<'_, ()>, ptr: u32, len: u32| {
-            av::audio_play_wav(&mut caller, ptr, len);
+        host_imports::SYSTEM_LAUNCH_ARG,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            system::cart::launch_arg_guest(&mut caller, ptr, len)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::AUDIO_PLAY_QOA,
-        |mut caller: Caller<'_, ()>, ptr: u32, len: u32| {
-            av::audio_play_qoa(&mut caller, ptr, len);
+        host_imports::SYSTEM_ASSET_READ,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            system::cart::asset_read_guest(&mut caller, ptr, len)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::AUDIO_PLAY_XM,
-        |mut caller: Caller<'_, ()>, ptr: u32, len: u32| {
-            av::audio_play_xm(&mut caller, ptr, len);
+        host_imports::SYSTEM_ASSET_LIST,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            system::cart::asset_list_guest(&mut caller, ptr, len)
         },
     )?;
 
-    // --- System ---
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::SYSTEM_LOG,
-        |mut caller: Caller<'_, ()>, ptr: u32, len: u32| {
-            let memory = caller.get_export("memory").and_then(|e| e.into_memory());
-            let Some(memory) = memory else {
-                return;
-            };
+        host_imports::SYSTEM_STATS,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            system::stats::stats_guest(&mut caller, ptr, len)
+        },
+    )?;
 
-            let mut buf = vec![0u8; len as usize];
-            if memory.read(&caller, ptr as usize, &mut buf).is_ok()
-                && let Ok(msg) = core::str::from_utf8(&buf)
-            {
-                println!("[wasm96] {msg}");
-            }
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_ACCESSIBILITY_SETTINGS,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            system::accessibility::settings_guest(&mut caller, ptr, len)
         },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
-        host_imports::SYSTEM_MILLIS,
-        |_caller: Caller<'_, ()>| -> u64 { crate::av::utils::system_millis() },
+        host_imports::SYSTEM_LOAD_STATUS,
+        |_caller: Caller<'_, GuestLimits>, handle: u32| -> u32 {
+            system::loading::load_status(handle)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_LOAD_PROGRESS,
+        |_caller: Caller<'_, GuestLimits>| -> f32 { system::loading::load_progress() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_SPAWN,
+        |mut caller: Caller<'_, GuestLimits>,
+         name_ptr: u32,
+         name_len: u32,
+         arg: u32,
+         data_ptr: u32,
+         data_len: u32|
+         -> u32 {
+            system::jobs::spawn_guest(&mut caller, name_ptr, name_len, arg, data_ptr, data_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_STATUS,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { system::jobs::status(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_RESULT,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { system::jobs::result(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_OUTPUT,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { system::jobs::output(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_FREE,
+        |_caller: Caller<'_, GuestLimits>, id: u32| system::jobs::free(id),
+    )?;
+
+    // The job-side imports; on the main instance there's no job, so no input and nowhere for
+    // output to go. Workers get the real ones (`system::jobs`).
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_INPUT_LEN,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { 0 },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_INPUT_READ,
+        |_caller: Caller<'_, GuestLimits>, _ptr: u32, _len: u32| -> u32 { 0 },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_OUTPUT_WRITE,
+        |_caller: Caller<'_, GuestLimits>, _ptr: u32, _len: u32| -> u32 { 0 },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_ACHIEVEMENT_UNLOCK,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            system::achievements::unlock_guest(&mut caller, ptr, len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_ACHIEVEMENT_PROGRESS,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32, value: u32, max: u32| -> u32 {
+            system::achievements::progress_guest(&mut caller, ptr, len, value, max)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_DEV_RELOAD_REQUESTED,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { system::reload::requested_guest() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_BLOB_LEN,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { system::blobs::len(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_BLOB_READ,
+        |mut caller: Caller<'_, GuestLimits>, id: u32, ptr: u32, len: u32| -> u32 {
+            system::blobs::read(&mut caller, id, ptr, len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_BLOB_FREE,
+        |_caller: Caller<'_, GuestLimits>, id: u32| {
+            system::blobs::free(id);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_SCREENSHOT,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { system::capture::screenshot() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_RECORD_GIF_START,
+        |_caller: Caller<'_, GuestLimits>| {
+            system::capture::record_gif_start();
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_RECORD_GIF_STOP,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { system::capture::record_gif_stop() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_STATE_SAVE,
+        |mut caller: Caller<'_, GuestLimits>| -> u32 { system::savestate::save_guest(&mut caller) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_STATE_LOAD,
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| -> u32 {
+            system::savestate::request_load(&mut caller, ptr, len)
+        },
+    )?;
+
+    // --- Net ---
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_FETCH,
+        |mut caller: Caller<'_, GuestLimits>,
+         method_ptr: u32,
+         method_len: u32,
+         url_ptr: u32,
+         url_len: u32,
+         headers_ptr: u32,
+         headers_len: u32,
+         body_ptr: u32,
+         body_len: u32|
+         -> u32 {
+            net::fetch_guest(
+                &mut caller,
+                method_ptr,
+                method_len,
+                url_ptr,
+                url_len,
+                headers_ptr,
+                headers_len,
+                body_ptr,
+                body_len,
+            )
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_POLL,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { net::poll(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_STATUS,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { net::status(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_TAKE_BODY,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { net::take_body(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_CANCEL,
+        |_caller: Caller<'_, GuestLimits>, id: u32| {
+            net::cancel(id);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_WS_OPEN,
+        |mut caller: Caller<'_, GuestLimits>, url_ptr: u32, url_len: u32| -> u32 {
+            net::websocket::open_guest(&mut caller, url_ptr, url_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_WS_STATE,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { net::websocket::state(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_WS_SEND,
+        |mut caller: Caller<'_, GuestLimits>, id: u32, ptr: u32, len: u32, text: u32| -> u32 {
+            net::websocket::send_guest(&mut caller, id, ptr, len, text)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_WS_RECEIVE,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { net::websocket::receive(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_WS_CLOSE,
+        |_caller: Caller<'_, GuestLimits>, id: u32| {
+            net::websocket::close(id);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SESSION_CREATE,
+        |_caller: Caller<'_, GuestLimits>,
+         players: u32,
+         input_delay: u32,
+         local: u32,
+         port: u32|
+         -> u32 { net::session::create(players, input_delay, local, port) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SESSION_ADD_PEER,
+        |mut caller: Caller<'_, GuestLimits>,
+         id: u32,
+         player: u32,
+         addr_ptr: u32,
+         addr_len: u32|
+         -> u32 {
+            net::session::add_peer_guest(&mut caller, id, player, addr_ptr, addr_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SESSION_ADD_LOCAL_INPUT,
+        |mut caller: Caller<'_, GuestLimits>, id: u32, ptr: u32, len: u32| -> u32 {
+            net::session::add_local_input_guest(&mut caller, id, ptr, len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SESSION_SYNCED_INPUTS,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { net::session::synced_inputs(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SESSION_STATUS,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { net::session::status(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SESSION_FRAME,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { net::session::frame(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SESSION_IS_RESIMULATING,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { net::session::is_resimulating(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SESSION_LOCAL_PORT,
+        |_caller: Caller<'_, GuestLimits>, id: u32| -> u32 { net::session::local_port(id) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SESSION_CLOSE,
+        |_caller: Caller<'_, GuestLimits>, id: u32| {
+            net::session::close(id);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SESSION_ADD_LAN_PEER,
+        |_caller: Caller<'_, GuestLimits>, id: u32, player: u32, conn: u32| -> u32 {
+            net::session::add_lan_peer(id, player, conn)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_LAN_DISCOVER,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { net::lan::discover_guest() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_LAN_CONNECT,
+        |_caller: Caller<'_, GuestLimits>, peer: u32| -> u32 { net::lan::connect(peer) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_LAN_ACCEPT,
+        |_caller: Caller<'_, GuestLimits>| -> u32 { net::lan::accept() },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_LAN_STATE,
+        |_caller: Caller<'_, GuestLimits>, conn: u32| -> u32 { net::lan::state(conn) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_LAN_SEND,
+        |mut caller: Caller<'_, GuestLimits>,
+         conn: u32,
+         ptr: u32,
+         len: u32,
+         reliable: u32|
+         -> u32 { net::lan::send_guest(&mut caller, conn, ptr, len, reliable) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_LAN_RECEIVE,
+        |_caller: Caller<'_, GuestLimits>, conn: u32| -> u32 { net::lan::receive(conn) },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_LAN_CLOSE,
+        |_caller: Caller<'_, GuestLimits>, conn: u32| {
+            net::lan::close(conn);
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SCORE_SUBMIT,
+        |mut caller: Caller<'_, GuestLimits>,
+         board_ptr: u32,
+         board_len: u32,
+         score: i64,
+         meta_ptr: u32,
+         meta_len: u32|
+         -> u32 {
+            net::scores::submit_guest(&mut caller, board_ptr, board_len, score, meta_ptr, meta_len)
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::NET_SCORE_FETCH,
+        |mut caller: Caller<'_, GuestLimits>, board_ptr: u32, board_len: u32, count: u32| -> u32 {
+            net::scores::fetch_guest(&mut caller, board_ptr, board_len, count)
+        },
     )?;
 
     // --- Storage ---
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::STORAGE_SAVE,
-        |mut caller: Caller<'_, ()>, key: u64, data_ptr: u32, data_len: u32| {
+        |mut caller: Caller<'_, GuestLimits>, key: u64, data_ptr: u32, data_len: u32| {
             av::storage_save(&mut caller, key, data_ptr, data_len);
         },
     )?;
@@ -576,13 +2887,15 @@ pub fn define_imports(linker: &mut Linker<()>) -> anyhow::Result<()> {
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::STORAGE_LOAD,
-        |mut caller: Caller<'_, ()>, key: u64| -> u64 { av::storage_load(&mut caller, key) },
+        |mut caller: Caller<'_, GuestLimits>, key: u64| -> u64 {
+            av::storage_load(&mut caller, key)
+        },
     )?;
 
     linker.func_wrap(
         IMPORT_MODULE,
         host_imports::STORAGE_FREE,
-        |mut caller: Caller<'_, ()>, ptr: u32, len: u32| {
+        |mut caller: Caller<'_, GuestLimits>, ptr: u32, len: u32| {
             av::storage_free(&mut caller, ptr, len);
         },
     )?;
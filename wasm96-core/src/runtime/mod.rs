@@ -14,4 +14,4 @@
 pub mod imports;
 pub mod runtime;
 
-pub use runtime::WasmtimeRuntime;
+pub use runtime::{GuestLimits, WasmtimeRuntime};
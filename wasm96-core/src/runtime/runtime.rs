@@ -13,13 +13,58 @@
 
 use crate::{abi, state};
 
-use wasmtime::{Extern, Instance, Linker, Module, Store};
+use wasmtime::{Engine, Extern, Instance, Linker, Module, ResourceLimiter, Store};
+
+/// Most a single guest memory may grow to: a 32-bit address space. Only memory64 guests can ask
+/// for more, and they would otherwise be limited by nothing but the host.
+pub const MAX_GUEST_MEMORY: u64 = 4 * 1024 * 1024 * 1024;
+
+/// Store data for guest instances: the limits their memories and tables grow within.
+#[derive(Debug, Clone, Copy)]
+pub struct GuestLimits {
+    pub memory: u64,
+}
+
+impl Default for GuestLimits {
+    fn default() -> Self {
+        Self {
+            memory: MAX_GUEST_MEMORY,
+        }
+    }
+}
+
+impl ResourceLimiter for GuestLimits {
+    fn memory_growing(
+        &mut self,
+        _current: usize,
+        desired: usize,
+        maximum: Option<usize>,
+    ) -> anyhow::Result<bool> {
+        Ok(desired as u64 <= self.memory && maximum.is_none_or(|max| desired <= max))
+    }
+
+    fn table_growing(
+        &mut self,
+        _current: usize,
+        desired: usize,
+        maximum: Option<usize>,
+    ) -> anyhow::Result<bool> {
+        Ok(maximum.is_none_or(|max| desired <= max))
+    }
+}
+
+/// A store for guest instances, limited by its `GuestLimits`.
+pub fn guest_store(engine: &Engine) -> Store<GuestLimits> {
+    let mut store = Store::new(engine, GuestLimits::default());
+    store.limiter(|limits| limits);
+    store
+}
 
 /// Host-side runtime container.
 pub struct WasmtimeRuntime {
     pub engine: wasmtime::Engine,
-    pub store: Store<()>,
-    pub linker: Linker<()>,
+    pub store: Store<GuestLimits>,
+    pub linker: Linker<GuestLimits>,
 }
 
 impl WasmtimeRuntime {
@@ -31,6 +76,19 @@ impl WasmtimeRuntime {
     ///   beyond flipping a config bit; we enable them here so modules can at least validate,
     ///   but guests must still be written with the embedding constraints in mind.
     pub fn new() -> Result<Self, anyhow::Error> {
+        let engine = wasmtime::Engine::new(&Self::config())?;
+        let store = guest_store(&engine);
+        let linker = Linker::new(&engine);
+
+        Ok(Self {
+            engine,
+            store,
+            linker,
+        })
+    }
+
+    /// Engine configuration for guest modules; background job workers start from it too.
+    pub fn config() -> wasmtime::Config {
         let mut cfg = wasmtime::Config::new();
 
         // Broadly supported/expected features for "modern" Wasm modules.
@@ -54,15 +112,12 @@ impl WasmtimeRuntime {
         // Exception handling proposal is useful for some toolchains.
         cfg.wasm_exceptions(true);
 
-        let engine = wasmtime::Engine::new(&cfg)?;
-        let store = Store::new(&engine, ());
-        let linker = Linker::new(&engine);
+        cfg
+    }
 
-        Ok(Self {
-            engine,
-            store,
-            linker,
-        })
+    /// Drop every instance (and its memory) by starting over with an empty store.
+    pub fn reset_store(&mut self) {
+        self.store = guest_store(&self.engine);
     }
 
     /// Define all host imports expected by guests under module `"env"`.
@@ -9,8 +9,10 @@
 //! - Host presents the framebuffer to libretro at the end of the frame.
 
 use libretro_sys::{AudioSampleBatchFn, AudioSampleFn, InputPollFn, InputStateFn, VideoRefreshFn};
-use std::collections::HashMap;
+use std::collections::{HashMap, HashSet, VecDeque};
+use std::path::PathBuf;
 use std::sync::{Mutex, OnceLock};
+use std::time::{Instant, SystemTime};
 
 use wasmtime::Memory as WasmtimeMemory;
 
@@ -49,6 +51,53 @@ pub struct AudioChannel {
     /// Source sample rate for this channel's PCM.
     #[allow(dead_code)]
     pub sample_rate: u32,
+
+    /// Handle returned to the guest (0 = fire-and-forget, not addressable).
+    pub id: u32,
+
+    /// Paused channels keep their position and produce no output.
+    pub paused: bool,
+
+    /// Loop region in frames. Playback jumps from `loop_end` (or the end of the PCM) back to
+    /// `loop_start` when looping is enabled.
+    pub loop_start: usize,
+    pub loop_end: Option<usize>,
+
+    /// For tracker music: the frame where each (order, row) starts, in playback order.
+    pub row_marks: Vec<RowMark>,
+
+    /// Mixer group whose volume applies to this channel (see `AudioState::group_volumes`).
+    pub group: u32,
+
+    /// Playback speed ratio (1.0 = as decoded, 2.0 = an octave up and twice as fast).
+    pub pitch: f32,
+    /// Fractional part of the playback position when `pitch` isn't 1.0.
+    pub position_frac: f32,
+
+    /// Send level to each mixer effect, 0.0..=1.0.
+    pub sends: [f32; AUDIO_EFFECTS],
+}
+
+/// Number of mixer groups.
+pub const AUDIO_GROUPS: usize = 8;
+/// Default group for sound effects (WAV/QOA playback and synth voices).
+pub const AUDIO_GROUP_SFX: u32 = 0;
+/// Default group for music (XM songs).
+pub const AUDIO_GROUP_MUSIC: u32 = 1;
+
+/// Number of mixer effects a source can send to (see `av::dsp`).
+pub const AUDIO_EFFECTS: usize = 2;
+pub const AUDIO_EFFECT_LOWPASS: usize = 0;
+pub const AUDIO_EFFECT_REVERB: usize = 1;
+
+/// Start of one tracker row within a decoded XM song.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct RowMark {
+    /// Index into the song's pattern order table.
+    pub order: u16,
+    pub row: u16,
+    /// First PCM frame of this row.
+    pub frame: usize,
 }
 
 impl Default for AudioChannel {
@@ -61,6 +110,15 @@ impl Default for AudioChannel {
             pcm_stereo: Vec::new(),
             position_frames: 0,
             sample_rate: 44100,
+            id: 0,
+            paused: false,
+            loop_start: 0,
+            loop_end: None,
+            row_marks: Vec::new(),
+            group: AUDIO_GROUP_SFX,
+            pitch: 1.0,
+            position_frac: 0.0,
+            sends: [0.0; AUDIO_EFFECTS],
         }
     }
 }
@@ -97,6 +155,57 @@ pub struct GlobalState {
 
     /// Host-owned storage state (persistent-ish key/value store).
     pub storage: StorageState,
+
+    /// Frame timing (delta time, target FPS pacing, measured FPS).
+    pub timing: TimingState,
+
+    /// Host random number generator exposed to the guest.
+    pub rng: RngState,
+
+    /// Host-produced byte buffers waiting to be copied into guest memory.
+    pub blobs: BlobState,
+
+    /// In-progress GIF recording of the framebuffer.
+    pub recording: RecordingState,
+
+    /// Outbound network requests issued by the guest.
+    pub net: NetState,
+
+    /// Guest log filtering.
+    pub log: LogState,
+
+    /// Input trace being recorded or replayed.
+    pub replay: ReplayState,
+
+    /// Per-tick profiling counters.
+    pub stats: StatsState,
+
+    /// Metadata and launch parameters of the loaded cart.
+    pub cart: CartState,
+
+    /// Asset decodes running in the background.
+    pub loading: LoadingState,
+
+    /// Guest exports running on worker instances; see `system::jobs`.
+    pub jobs: HashMap<u32, Job>,
+
+    /// Clipboard reads running in the background; see `system::clipboard`.
+    pub clipboard_reads: HashMap<u32, ClipboardRead>,
+
+    /// Achievement unlocks and progress; see `system::achievements`.
+    pub achievements: AchievementState,
+
+    /// The cart file watched for development hot reloads; see `system::reload`.
+    pub reload: ReloadState,
+
+    /// Save state the guest asked to restore, applied after the current tick.
+    pub pending_state_load: Option<Vec<u8>>,
+
+    /// The guest asked to restart the cart after the current tick.
+    pub pending_reset: bool,
+
+    /// The guest asked the frontend to shut down after the current tick.
+    pub pending_quit: bool,
 }
 
 // Raw pointers are used for `handle` and `memory`. We guard access with a mutex.
@@ -121,8 +230,402 @@ pub struct VideoState {
     /// Format: 0x00RRGGBB (little endian in memory: BB GG RR 00).
     pub framebuffer: Vec<u32>,
 
+    /// While the framebuffer is a layer or mask canvas: how much of each pixel has been drawn
+    /// (0 = nothing, 255 = opaque). Empty while drawing to the screen. See `av::utils::Canvas`.
+    pub coverage: Vec<u8>,
+
     /// Current drawing color (packed 0x00RRGGBB for XRGB8888).
     pub draw_color: u32,
+
+    /// Stroke width in pixels for lines and outlines (>= 1).
+    pub line_width: u32,
+
+    /// Dash pattern for lines and outlines.
+    pub line_style: LineStyle,
+
+    /// Multiplier for image, GIF and SVG pixels (packed 0xAARRGGBB). `TINT_NONE` leaves them as is.
+    pub tint: u32,
+
+    /// Colors for indexed images and `set_color_index`.
+    pub palette: Palette,
+
+    /// Filter applied to a copy of the framebuffer when it is presented.
+    pub post_effect: PostEffect,
+
+    /// Strength of `post_effect`, 0..=1.
+    pub post_strength: f32,
+
+    /// Multiplier for the size of all drawn and measured text.
+    pub text_scale: f32,
+
+    /// Color grade applied to the presented frame after `post_effect`.
+    pub color_grade: Option<ColorGrade>,
+
+    /// How the framebuffer is fitted to a fixed window size.
+    pub scaling: ScalingMode,
+
+    /// The cart asked for the full display size as its window.
+    pub fullscreen: bool,
+
+    /// The framebuffer or window changed size since the last tick.
+    pub resize_pending: bool,
+
+    /// `resize_pending`, latched for the current tick.
+    pub resized: bool,
+
+    /// 2D world camera applied to draws between `camera_set` and `camera_reset`.
+    pub camera: Camera,
+
+    /// Offscreen layers composited over the screen when the frame ends.
+    pub layers: Layers,
+
+    /// Full-screen transition drawn over presented frames.
+    pub transition: Option<Transition>,
+
+    /// Clip mask for 2D draws.
+    pub mask: Mask,
+
+    /// Vector path being built for `path_fill` / `path_stroke`.
+    pub path: VectorPath,
+
+    /// The running transition covers the whole screen this tick.
+    pub transition_midpoint: bool,
+}
+
+/// Opaque white: image draws are left untouched.
+pub const TINT_NONE: u32 = 0xFFFF_FFFF;
+
+/// 256-entry indexed-color palette with draw-time swaps.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Palette {
+    /// Color per index (packed 0x00RRGGBB).
+    pub colors: [u32; 256],
+    /// Index `i` draws with `colors[swap[i]]`.
+    pub swap: [u8; 256],
+    /// Indices left out of indexed image draws (checked before the swap).
+    pub transparent: [bool; 256],
+}
+
+/// Default colors for indices 0..16 (the PICO-8 palette); the rest start black.
+const DEFAULT_PALETTE: [u32; 16] = [
+    0x000000, 0x1D2B53, 0x7E2553, 0x008751, 0xAB5236, 0x5F574F, 0xC2C3C7, 0xFFF1E8, 0xFF004D,
+    0xFFA300, 0xFFEC27, 0x00E436, 0x29ADFF, 0x83769C, 0xFF77A8, 0xFFCCAA,
+];
+
+impl Palette {
+    /// Color index `i` draws with, after swaps.
+    pub fn resolve(&self, i: u8) -> u32 {
+        self.colors[self.swap[i as usize] as usize]
+    }
+
+    /// Undo swaps and make only index 0 transparent.
+    pub fn reset_swaps(&mut self) {
+        for (i, s) in self.swap.iter_mut().enumerate() {
+            *s = i as u8;
+        }
+        self.transparent = [false; 256];
+        self.transparent[0] = true;
+    }
+}
+
+impl Default for Palette {
+    fn default() -> Self {
+        let mut palette = Self {
+            colors: [0; 256],
+            swap: [0; 256],
+            transparent: [false; 256],
+        };
+        palette.colors[..16].copy_from_slice(&DEFAULT_PALETTE);
+        palette.reset_swaps();
+        palette
+    }
+}
+
+/// Host 2D camera: where the world is viewed from, plus screen shake.
+///
+/// A world point at the camera position lands at the screen center; the world is scaled by
+/// `zoom` around it and rotated by `rotation` radians (clockwise on screen).
+#[derive(Debug, Clone, PartialEq)]
+pub struct Camera {
+    pub x: f32,
+    pub y: f32,
+    pub zoom: f32,
+    pub rotation: f32,
+    /// Whether 2D draws currently go through the camera.
+    pub active: bool,
+    /// World rectangle (x, y, w, h) the view is kept inside, if any.
+    pub bounds: Option<(f32, f32, f32, f32)>,
+    /// Peak shake offset in screen pixels; it decays linearly over the shake's duration.
+    pub shake_magnitude: f32,
+    pub shake_duration_ms: u32,
+    pub shake_remaining_ms: u32,
+    /// This frame's shake offset in screen pixels.
+    pub shake_offset: (f32, f32),
+    /// xorshift state for shake offsets (non-zero).
+    pub shake_rng: u64,
+    /// The world pass draws go into while the camera is active.
+    pub pass: Option<CameraPass>,
+    /// Fraction of the camera position applied, from the open layer's parallax factor.
+    pub parallax: f32,
+}
+
+/// Draw layers: the guest picks one with `layer_begin`, and visible layers are composited over
+/// the screen in `order` when the frame ends.
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct Layers {
+    /// Layers by index, created on first use.
+    pub list: Vec<Layer>,
+    /// Index of the layer the framebuffer is swapped out for, if any.
+    pub open: Option<usize>,
+    /// The screen, while a layer is open.
+    pub screen: Vec<u32>,
+}
+
+/// One offscreen draw layer.
+#[derive(Debug, Clone, PartialEq)]
+pub struct Layer {
+    /// Pixels drawn this frame, meaningful where `coverage` is non-zero.
+    pub pixels: Vec<u32>,
+    /// How much of each pixel was drawn this frame (0 = nothing, 255 = opaque).
+    pub coverage: Vec<u8>,
+    pub visible: bool,
+    /// Fraction of the 2D camera position the layer follows (0 fixed to the screen, 1 the world).
+    pub parallax: f32,
+    /// Composite order; lower is further back, ties go by index.
+    pub order: i32,
+}
+
+impl Layer {
+    pub fn new(index: usize) -> Self {
+        Self {
+            pixels: Vec::new(),
+            coverage: Vec::new(),
+            visible: true,
+            parallax: 1.0,
+            order: index as i32,
+        }
+    }
+}
+
+/// Clip mask: a shape drawn between `mask_begin` and `mask_end` that later draws are limited to.
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct Mask {
+    /// Whether each pixel of the draw target is inside the mask (empty if none was drawn).
+    pub bits: Vec<bool>,
+    /// Clipping in effect: `Some(false)` draws inside the mask, `Some(true)` outside it.
+    pub clip: Option<bool>,
+    /// The draw target, set aside while the mask is drawn or a clip pass is open.
+    pub target: Option<Vec<u32>>,
+    /// The draw target's coverage, set aside with it (empty for the screen).
+    pub target_coverage: Vec<u8>,
+    /// `target` is set aside for drawing the mask rather than for a clip pass.
+    pub drawing: bool,
+}
+
+/// A vector path: subpaths flattened to points in draw-target pixels.
+#[derive(Debug, Clone, Default, PartialEq)]
+pub struct VectorPath {
+    /// Each subpath's points and whether `path_close` ended it.
+    pub subpaths: Vec<(Vec<(f32, f32)>, bool)>,
+    /// Points across all subpaths.
+    pub len: usize,
+}
+
+/// Offscreen target for the draws made under a camera.
+#[derive(Debug, Clone, PartialEq)]
+pub struct CameraPass {
+    /// World coordinates of framebuffer pixel (0, 0).
+    pub origin: (i32, i32),
+    /// For zoomed or rotated views: the screen (pixels, width, height) the pass is resampled
+    /// onto when it closes. `None` when the pass is the screen itself, merely offset.
+    pub screen: Option<(Vec<u32>, u32, u32)>,
+    /// Pass pixels as they were when it opened; only pixels that changed are composited.
+    pub base: Vec<u32>,
+    /// For a zoomed or rotated pass over a layer or mask canvas: the canvas coverage and the
+    /// pass coverage it opened with, resampled along with the pixels.
+    pub coverage: Option<(Vec<u8>, Vec<u8>)>,
+}
+
+impl Camera {
+    /// Camera position after clamping the view to `bounds`, for a `width`x`height` screen.
+    pub fn center(&self, width: u32, height: u32) -> (f32, f32) {
+        let Some((bx, by, bw, bh)) = self.bounds else {
+            return (self.x * self.parallax, self.y * self.parallax);
+        };
+        let (sin, cos) = self.rotation.sin_cos();
+        let (w, h) = (width as f32, height as f32);
+        let half_w = (w * cos.abs() + h * sin.abs()) / (2.0 * self.zoom);
+        let half_h = (w * sin.abs() + h * cos.abs()) / (2.0 * self.zoom);
+        let clamp = |v: f32, lo: f32, len: f32, half: f32| {
+            if len <= 2.0 * half {
+                lo + len / 2.0
+            } else {
+                v.clamp(lo + half, lo + len - half)
+            }
+        };
+        (
+            clamp(self.x, bx, bw, half_w) * self.parallax,
+            clamp(self.y, by, bh, half_h) * self.parallax,
+        )
+    }
+
+    /// Map a screen position to the world point under it.
+    pub fn screen_to_world(&self, sx: f32, sy: f32, width: u32, height: u32) -> (f32, f32) {
+        let (cx, cy) = self.center(width, height);
+        let dx = (sx - width as f32 / 2.0 - self.shake_offset.0) / self.zoom;
+        let dy = (sy - height as f32 / 2.0 - self.shake_offset.1) / self.zoom;
+        let (sin, cos) = self.rotation.sin_cos();
+        (cx + dx * cos + dy * sin, cy - dx * sin + dy * cos)
+    }
+
+    /// Map a world point to where it lands on screen.
+    pub fn world_to_screen(&self, wx: f32, wy: f32, width: u32, height: u32) -> (f32, f32) {
+        let (cx, cy) = self.center(width, height);
+        let (dx, dy) = ((wx - cx) * self.zoom, (wy - cy) * self.zoom);
+        let (sin, cos) = self.rotation.sin_cos();
+        (
+            dx * cos - dy * sin + width as f32 / 2.0 + self.shake_offset.0,
+            dx * sin + dy * cos + height as f32 / 2.0 + self.shake_offset.1,
+        )
+    }
+}
+
+impl Default for Camera {
+    fn default() -> Self {
+        Self {
+            x: 0.0,
+            y: 0.0,
+            zoom: 1.0,
+            rotation: 0.0,
+            active: false,
+            bounds: None,
+            shake_magnitude: 0.0,
+            shake_duration_ms: 0,
+            shake_remaining_ms: 0,
+            shake_offset: (0.0, 0.0),
+            shake_rng: 0x2545_F491_4F6C_DD1D,
+            pass: None,
+            parallax: 1.0,
+        }
+    }
+}
+
+/// Dash pattern applied to lines and outlines.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum LineStyle {
+    #[default]
+    Solid,
+    Dashed,
+    Dotted,
+}
+
+impl LineStyle {
+    /// Map the ABI value to a style. Unknown values fall back to `Solid`.
+    pub fn from_u32(v: u32) -> Self {
+        match v {
+            1 => LineStyle::Dashed,
+            2 => LineStyle::Dotted,
+            _ => LineStyle::Solid,
+        }
+    }
+}
+
+/// How the framebuffer is fitted to the window.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum ScalingMode {
+    /// Largest size that keeps the aspect ratio, with black bars.
+    #[default]
+    Fit,
+    /// Largest whole-number multiple, so every pixel is the same size.
+    Integer,
+    /// Fill the window, ignoring the aspect ratio.
+    Stretch,
+}
+
+impl ScalingMode {
+    /// Map the ABI value to a mode. Unknown values fall back to `Fit`.
+    pub fn from_u32(v: u32) -> Self {
+        match v {
+            1 => ScalingMode::Integer,
+            2 => ScalingMode::Stretch,
+            _ => ScalingMode::Fit,
+        }
+    }
+}
+
+/// Effect a screen transition covers and reveals the frame with.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum TransitionKind {
+    /// Blend to a solid color.
+    #[default]
+    Fade,
+    /// Left-to-right wipe with an ordered-dither edge.
+    DitherWipe,
+    /// Ever bigger blocks, then a blend to the color.
+    Pixelate,
+    /// A circle closing on the screen center.
+    Iris,
+}
+
+impl TransitionKind {
+    /// Map the ABI value to a kind. Unknown values fall back to `Fade`.
+    pub fn from_u32(v: u32) -> Self {
+        match v {
+            1 => TransitionKind::DitherWipe,
+            2 => TransitionKind::Pixelate,
+            3 => TransitionKind::Iris,
+            _ => TransitionKind::Fade,
+        }
+    }
+}
+
+/// A running screen transition: covered over the first half of `duration_ms`, revealed over
+/// the second.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct Transition {
+    pub kind: TransitionKind,
+    /// Color the screen is covered with (0x00RRGGBB).
+    pub color: u32,
+    pub duration_ms: u32,
+    pub elapsed_ms: u32,
+    /// The covered midpoint has been reported.
+    pub passed_midpoint: bool,
+}
+
+/// Built-in filter applied to the presented frame.
+#[derive(Debug, Clone, Copy, Default, PartialEq, Eq)]
+pub enum PostEffect {
+    #[default]
+    None,
+    Scanlines,
+    Crt,
+    Bloom,
+    Grayscale,
+    Dither,
+}
+
+impl PostEffect {
+    /// Map the ABI value to an effect. Unknown values fall back to `None`.
+    pub fn from_u32(v: u32) -> Self {
+        match v {
+            1 => PostEffect::Scanlines,
+            2 => PostEffect::Crt,
+            3 => PostEffect::Bloom,
+            4 => PostEffect::Grayscale,
+            5 => PostEffect::Dither,
+            _ => PostEffect::None,
+        }
+    }
+}
+
+/// Color lookup applied to the presented frame.
+#[derive(Debug, Clone, PartialEq)]
+pub enum ColorGrade {
+    /// Remap tables: value `v` of red, green and blue becomes `tables[0][v]`, `tables[1][v]` and
+    /// `tables[2][v]`.
+    Remap(Box<[[u8; 256]; 3]>),
+    /// A `size`x`size`x`size` lattice of RGB colors, red varying fastest, sampled trilinearly.
+    Lut { size: usize, data: Vec<u8> },
 }
 
 impl Default for VideoState {
@@ -131,7 +634,116 @@ impl Default for VideoState {
             width: 320, // Default size until set_size is called
             height: 240,
             framebuffer: vec![0; 320 * 240],
+            coverage: Vec::new(),
             draw_color: 0x00FFFFFF, // Default white
+            line_width: 1,
+            line_style: LineStyle::Solid,
+            tint: TINT_NONE,
+            palette: Palette::default(),
+            post_effect: PostEffect::None,
+            post_strength: 0.0,
+            text_scale: 1.0,
+            color_grade: None,
+            scaling: ScalingMode::Fit,
+            fullscreen: false,
+            resize_pending: false,
+            resized: false,
+            camera: Camera::default(),
+            layers: Layers::default(),
+            transition: None,
+            mask: Mask::default(),
+            path: VectorPath::default(),
+            transition_midpoint: false,
+        }
+    }
+}
+
+/// Oscillator shape for a synth voice.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Waveform {
+    Square = 0,
+    Triangle = 1,
+    Saw = 2,
+    Noise = 3,
+}
+
+impl Waveform {
+    pub fn from_u32(v: u32) -> Option<Self> {
+        match v {
+            0 => Some(Self::Square),
+            1 => Some(Self::Triangle),
+            2 => Some(Self::Saw),
+            3 => Some(Self::Noise),
+            _ => None,
+        }
+    }
+}
+
+/// Which part of the ADSR envelope a synth voice is in.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum EnvelopeStage {
+    Idle,
+    Attack,
+    Decay,
+    Sustain,
+    Release,
+}
+
+/// A host-side chiptune oscillator with an ADSR envelope.
+///
+/// NOTE: Rendering lives in `av::synth`; this is only state.
+#[derive(Debug, Clone)]
+pub struct SynthVoice {
+    pub waveform: Waveform,
+
+    /// Envelope times in seconds and sustain level (0.0..=1.0).
+    pub attack: f32,
+    pub decay: f32,
+    pub sustain: f32,
+    pub release: f32,
+
+    /// Oscillator frequency in Hz and note volume (0.0..=1.0).
+    pub freq: f32,
+    pub volume: f32,
+
+    /// Oscillator phase in cycles (0.0..1.0).
+    pub phase: f32,
+    pub stage: EnvelopeStage,
+    /// Current envelope level (0.0..=1.0).
+    pub level: f32,
+    /// Per-sample level decrement during release.
+    pub release_step: f32,
+    /// 15-bit LFSR for the noise waveform.
+    pub lfsr: u16,
+
+    /// Mixer group whose volume applies to this voice.
+    pub group: u32,
+
+    /// Stereo position, -1.0 = left, 0.0 = centre, 1.0 = right.
+    pub pan: f32,
+
+    /// Send level to each mixer effect, 0.0..=1.0.
+    pub sends: [f32; AUDIO_EFFECTS],
+}
+
+impl SynthVoice {
+    pub fn new(waveform: Waveform) -> Self {
+        Self {
+            waveform,
+            attack: 0.005,
+            decay: 0.05,
+            sustain: 0.7,
+            release: 0.1,
+            freq: 440.0,
+            volume: 1.0,
+            phase: 0.0,
+            stage: EnvelopeStage::Idle,
+            level: 0.0,
+            release_step: 0.0,
+            lfsr: 1,
+            group: AUDIO_GROUP_SFX,
+            pan: 0.0,
+            sends: [0.0; AUDIO_EFFECTS],
         }
     }
 }
@@ -152,6 +764,36 @@ pub struct AudioState {
     /// Guests can trigger playback via higher-level audio APIs and the core will mix
     /// these channels into the output stream.
     pub channels: Vec<AudioChannel>,
+
+    /// Last handle given to an addressable channel (see `AudioChannel::id`).
+    pub next_channel_id: u32,
+
+    /// Gain applied to the whole mix, 0.0..=1.0.
+    pub master_volume: f32,
+    /// Gain per mixer group, 0.0..=1.0. Guest-pushed raw samples only get the master volume.
+    pub group_volumes: [f32; AUDIO_GROUPS],
+
+    /// Listener position for positional playback (`None` = centre of the screen).
+    pub listener: Option<(f32, f32)>,
+
+    /// Chiptune synth voices, keyed by the id returned to the guest.
+    pub synth_voices: HashMap<u32, SynthVoice>,
+    pub next_synth_id: u32,
+
+    /// Streamed music, keyed by the handle returned to the guest.
+    pub music: HashMap<u32, crate::av::music::MusicStream>,
+    pub next_music_id: u32,
+
+    /// SoundFont banks for MIDI songs, keyed by the id returned to the guest.
+    pub soundfonts: HashMap<u32, std::sync::Arc<crate::av::soundfont::SoundFont>>,
+    pub next_soundfont_id: u32,
+
+    /// Sound pools, keyed by the handle returned to the guest.
+    pub sound_pools: HashMap<u32, crate::av::sound_pool::SoundPool>,
+    pub next_sound_pool_id: u32,
+
+    /// Low-pass and reverb effects and per-group send levels.
+    pub effects: crate::av::dsp::Effects,
 }
 
 impl Default for AudioState {
@@ -161,6 +803,25 @@ impl Default for AudioState {
             host_queue: Vec::new(),
 
             channels: Vec::new(),
+            next_channel_id: 0,
+
+            master_volume: 1.0,
+            group_volumes: [1.0; AUDIO_GROUPS],
+            listener: None,
+
+            synth_voices: HashMap::new(),
+            next_synth_id: 0,
+
+            music: HashMap::new(),
+            next_music_id: 0,
+
+            soundfonts: HashMap::new(),
+            next_soundfont_id: 0,
+
+            sound_pools: HashMap::new(),
+            next_sound_pool_id: 0,
+
+            effects: Default::default(),
         }
     }
 }
@@ -176,12 +837,380 @@ pub struct StorageState {
     pub kv: HashMap<u64, Vec<u8>>,
 }
 
+/// Host-side frame timing state.
+///
+/// The libretro frontend drives `retro_run` at its own rate; this state lets the core report
+/// real elapsed time to the guest, optionally tick the guest at a lower target rate, and
+/// optionally run `update` at its own fixed rate within ticks.
+#[derive(Debug, Default)]
+pub struct TimingState {
+    /// Time of the previous host frame (`None` before the first frame).
+    pub last_host_frame: Option<Instant>,
+
+    /// When the previous host frame finished; see `system::lifecycle`.
+    pub last_host_frame_end: Option<Instant>,
+
+    /// The frontend reports stepping single frames while paused, for the current host frame.
+    pub frame_stepping: bool,
+
+    /// The guest was last told `on_pause` rather than `on_resume`.
+    pub paused: bool,
+
+    /// Time of the previous guest tick (`update`/`draw` pair).
+    pub last_tick: Option<Instant>,
+
+    /// Milliseconds between the two most recent guest ticks (clamped).
+    pub delta_millis: u64,
+
+    /// Requested guest tick rate. `0` means "tick on every host frame".
+    pub target_fps: u32,
+
+    /// Elapsed time not yet consumed by a guest tick, in microseconds.
+    pub accumulator_micros: u64,
+
+    /// Guest ticks per second measured over the last full one-second window.
+    pub measured_fps: u32,
+
+    /// Start of the current FPS measurement window.
+    pub fps_window_start: Option<Instant>,
+
+    /// Guest ticks counted in the current FPS measurement window.
+    pub fps_window_ticks: u32,
+
+    /// Fixed `update` rate in Hz. `0` means one `update` per tick.
+    pub update_rate: u32,
+
+    /// Elapsed time not yet consumed by a fixed-rate `update`, in microseconds.
+    pub update_accumulator_micros: u64,
+
+    /// `update` calls due in the current tick.
+    pub updates_due: u32,
+
+    /// How far the current tick is between the last `update` and the next, in `0.0..1.0`
+    /// (1.0 without a fixed update rate).
+    pub interpolation_alpha: f32,
+}
+
+/// Host-side PRNG state (splitmix64).
+///
+/// Seeded lazily from OS entropy on first use so every run of a cart differs.
+#[derive(Debug, Default)]
+pub struct RngState {
+    /// Current generator state. `None` until the first draw seeds it.
+    pub state: Option<u64>,
+}
+
+/// Input recording and deterministic replay.
+///
+/// A trace is a header (magic, version, RNG seed) followed by one encoded frame of input per
+/// guest tick; see `input::replay`.
+#[derive(Debug, Default)]
+pub struct ReplayState {
+    /// Trace being recorded, if recording.
+    pub recording: Option<Vec<u8>>,
+    /// Frames appended to `recording` so far.
+    pub recorded_frames: u32,
+
+    /// Trace being replayed and the read offset of the next frame.
+    pub playback: Option<(Vec<u8>, usize)>,
+}
+
+/// Metadata, launch parameters and bundled assets of the loaded cart; see `system::cart`.
+#[derive(Debug, Default)]
+pub struct CartState {
+    /// `key=value` pairs from the cart's `wasm96.meta` section.
+    pub meta: HashMap<String, String>,
+
+    /// Parameters supplied by the frontend or environment at launch.
+    pub launch_args: HashMap<String, String>,
+
+    /// Assets of a `.w96` bundle cart (empty for plain modules).
+    pub assets: crate::loader::bundle::Bundle,
+}
+
+/// Profiling counters for the guest's ticks; see `system::stats`.
+#[derive(Debug, Default)]
+pub struct StatsState {
+    /// Draw imports called so far in the current tick.
+    pub draw_calls: u32,
+
+    /// Figures for the last completed tick.
+    pub last: FrameStats,
+}
+
+/// What one guest tick cost.
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq)]
+pub struct FrameStats {
+    pub draw_calls: u32,
+    /// Time in the guest's `update`, in microseconds.
+    pub update_micros: u32,
+    /// Time in the guest's `draw`, including the host work its draw calls do.
+    pub draw_micros: u32,
+    /// Host time spent compositing the camera pass, post-processing and presenting.
+    pub render_micros: u32,
+    /// Size of the guest's linear memory in bytes.
+    pub memory_bytes: u64,
+}
+
+/// Guest log filtering.
+#[derive(Debug, Default)]
+pub struct LogState {
+    /// Messages below this level (0 = debug .. 3 = error) are dropped.
+    pub min_level: u32,
+}
+
+/// Host-owned byte buffers handed to the guest by id.
+///
+/// Imports that produce variable-length results (screenshots, recordings, ...) store the bytes
+/// here and return an id; the guest queries the length, copies the bytes out, and frees the id.
+#[derive(Debug, Default)]
+pub struct BlobState {
+    pub next_id: u32,
+    pub blobs: HashMap<u32, Vec<u8>>,
+}
+
+/// Framebuffer frames captured while a GIF recording is active.
+#[derive(Debug, Default)]
+pub struct RecordingState {
+    pub active: bool,
+    pub width: u32,
+    pub height: u32,
+
+    /// Captured frames as RGBA8888.
+    pub frames: Vec<Vec<u8>>,
+
+    /// Per-frame delay in GIF units (1/100 s).
+    pub delays: Vec<u16>,
+
+    /// When the most recent frame was captured.
+    pub last_capture: Option<Instant>,
+}
+
+/// Lifecycle of a guest HTTP request.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum FetchState {
+    Pending,
+    Done,
+    Failed,
+}
+
+/// A guest HTTP request and, once finished, its response.
+#[derive(Debug)]
+pub struct FetchRequest {
+    pub state: FetchState,
+    /// HTTP status code (0 until a response arrives or if the request failed).
+    pub status: u32,
+    pub body: Vec<u8>,
+}
+
+/// Lifecycle of a guest WebSocket connection.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum SocketState {
+    Connecting,
+    Open,
+    Closed,
+}
+
+/// A guest WebSocket connection. The connection thread moves messages between these queues and
+/// the socket.
+#[derive(Debug)]
+pub struct WebSocketConn {
+    pub state: SocketState,
+    /// Messages received from the server, oldest first.
+    pub incoming: VecDeque<Vec<u8>>,
+    /// Messages queued by the guest, not yet sent.
+    pub outgoing: VecDeque<OutgoingMessage>,
+}
+
+/// A message queued for sending on a WebSocket.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub struct OutgoingMessage {
+    pub data: Vec<u8>,
+    /// Send as a text frame (`data` is UTF-8) rather than a binary frame.
+    pub text: bool,
+}
+
+/// Where an async asset load is; see `system::loading`.
+pub enum LoadPhase {
+    Pending,
+    /// Decoded on the worker, waiting to be installed at the next tick.
+    Decoded(crate::system::loading::Decoded),
+    Ready,
+    Failed,
+}
+
+/// Async asset loads, kept until unload so their handles stay pollable.
+#[derive(Default)]
+pub struct LoadingState {
+    pub next_id: u32,
+    pub loads: HashMap<u32, LoadPhase>,
+    /// Loads started in the current batch (since nothing was last pending), and how many of
+    /// them have finished.
+    pub batch_total: u32,
+    pub batch_done: u32,
+}
+
+/// Achievements reported by the cart; kept across restarts, cleared on unload.
+#[derive(Debug, Default)]
+pub struct AchievementState {
+    pub unlocked: HashSet<String>,
+    /// Latest `(value, max)` reported for achievements not yet unlocked.
+    pub progress: HashMap<String, (u32, u32)>,
+    /// Notifications waiting to be shown by the frontend.
+    pub toasts: Vec<String>,
+}
+
+/// Development hot reload of the cart file; kept across restarts, cleared on unload.
+#[derive(Debug, Default)]
+pub struct ReloadState {
+    /// The cart file being watched (`None` when hot reload is off).
+    pub path: Option<PathBuf>,
+    /// Modification time of the cart that is running.
+    pub loaded: Option<SystemTime>,
+    /// A newer modification time seen at the last check, reloaded once it stops changing.
+    pub pending: Option<SystemTime>,
+    pub last_check: Option<Instant>,
+    /// Hash of the running cart's module, to tell a new module from new assets.
+    pub module_hash: u64,
+    /// The cart was reloaded and the first tick since hasn't finished yet.
+    pub reloaded: bool,
+}
+
+/// Lifecycle of a background job.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum JobPhase {
+    Running,
+    Done,
+    Failed,
+}
+
+/// A background job and, once finished, what it produced.
+#[derive(Debug)]
+pub struct Job {
+    pub phase: JobPhase,
+    /// The export's return value (0 if it returns nothing).
+    pub result: u32,
+    /// Bytes the job wrote with `wasm96_system_job_output_write`.
+    pub output: Vec<u8>,
+}
+
+/// A background clipboard read and, once finished, the text it found.
+#[derive(Debug, Clone, PartialEq, Eq)]
+pub enum ClipboardRead {
+    Pending,
+    Done(Vec<u8>),
+    Failed,
+}
+
+/// Outbound network state.
+#[derive(Debug, Default)]
+pub struct NetState {
+    pub requests: HashMap<u32, FetchRequest>,
+    pub sockets: HashMap<u32, WebSocketConn>,
+    /// The netplay session, if one is open.
+    pub session: Option<crate::net::session::Session>,
+    /// The LAN endpoint, opened by the first discovery.
+    pub lan: Option<crate::net::lan::Lan>,
+}
+
+/// Number of controller ports tracked by the core.
+pub const MAX_PORTS: usize = 8;
+
+/// Maximum simultaneous touch points tracked.
+pub const MAX_TOUCHES: usize = 10;
+
+/// Keyboard key codes tracked (libretro `RETROK_*` values below `RETROK_LAST`).
+pub const MAX_KEYS: usize = 324;
+
+/// Joypad buttons per port (ABI `Button` ids `0..16`).
+pub const BUTTONS_PER_PORT: usize = 16;
+
+/// Where a touch is in its lifecycle.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum TouchPhase {
+    Began = 0,
+    Moved = 1,
+    Stationary = 2,
+    /// The finger lifted before this frame; reported once, at its last position.
+    Ended = 3,
+}
+
+/// One touch point in screen pixels.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub struct Touch {
+    /// Stable for the lifetime of the touch; never reused.
+    pub id: u32,
+    pub x: i32,
+    pub y: i32,
+    pub phase: TouchPhase,
+}
+
 /// Minimal cached input state.
-#[derive(Default, Debug)]
+#[derive(Debug)]
 pub struct InputState {
+    /// Joypad buttons held this frame per port (bit N = ABI `Button` N).
+    pub buttons: [u32; MAX_PORTS],
+    /// How long each held button has been down, in tick time; `None` while released.
+    pub button_held_millis: [[Option<u32>; BUTTONS_PER_PORT]; MAX_PORTS],
+
+    /// Keys held as of the latest keyboard events from the frontend.
+    pub keys_pending: [bool; MAX_KEYS],
+    /// Keys held this frame (latched from `keys_pending`).
+    pub keys: [bool; MAX_KEYS],
+    /// How long each held key has been down, in tick time; `None` while released.
+    pub key_held_millis: [Option<u32>; MAX_KEYS],
+
     pub mouse_x: i32,
     pub mouse_y: i32,
     pub mouse_buttons: u32,
+
+    /// libretro device assigned to each port by the frontend (`DEVICE_NONE` = nothing plugged in).
+    pub port_devices: [u32; MAX_PORTS],
+    /// A port's device changed since the last frame snapshot.
+    pub ports_changed_pending: bool,
+    /// A port's device changed just before this frame (true for exactly one frame).
+    pub ports_changed: bool,
+
+    /// Touches reported to the guest this frame (including ones that just ended).
+    pub touches: Vec<Touch>,
+    /// Active touch per libretro pointer index, carried between frames to derive phases and ids.
+    pub touch_slots: [Option<Touch>; MAX_TOUCHES],
+    pub next_touch_id: u32,
+    /// Mirror the first touch to the mouse position and left button.
+    pub touch_mouse: bool,
+
+    /// Whether typed characters are being collected for the guest.
+    pub text_input_active: bool,
+    /// Characters typed since the guest last drained the queue.
+    pub text_input: String,
+}
+
+impl Default for InputState {
+    fn default() -> Self {
+        // Frontends aren't required to call `retro_set_controller_port_device`; assume a RetroPad
+        // in port 0 until told otherwise.
+        let mut port_devices = [libretro_sys::DEVICE_NONE; MAX_PORTS];
+        port_devices[0] = libretro_sys::DEVICE_JOYPAD;
+        Self {
+            buttons: [0; MAX_PORTS],
+            button_held_millis: [[None; BUTTONS_PER_PORT]; MAX_PORTS],
+            keys_pending: [false; MAX_KEYS],
+            keys: [false; MAX_KEYS],
+            key_held_millis: [None; MAX_KEYS],
+            mouse_x: 0,
+            mouse_y: 0,
+            mouse_buttons: 0,
+            port_devices,
+            ports_changed_pending: false,
+            ports_changed: false,
+            touches: Vec::new(),
+            touch_slots: [None; MAX_TOUCHES],
+            next_touch_id: 1,
+            touch_mouse: true,
+            text_input_active: false,
+            text_input: String::new(),
+        }
+    }
 }
 
 pub fn set_video_refresh_cb(cb: Option<VideoRefreshFn>) {
@@ -231,6 +1260,53 @@ pub fn clear_on_unload() {
 
     s.video = VideoState::default();
     s.audio = AudioState::default();
-    s.input = InputState::default();
+    // Port assignments come from the frontend, not the cart; keep them across loads.
+    s.input = InputState {
+        port_devices: s.input.port_devices,
+        ..InputState::default()
+    };
     s.storage = StorageState::default();
+    s.timing = TimingState::default();
+    s.rng = RngState::default();
+    s.blobs = BlobState::default();
+    s.recording = RecordingState::default();
+    s.net = NetState::default();
+    s.log = LogState::default();
+    s.replay = ReplayState::default();
+    s.stats = StatsState::default();
+    s.cart = CartState::default();
+    s.loading = LoadingState::default();
+    s.jobs.clear();
+    s.clipboard_reads.clear();
+    s.achievements = AchievementState::default();
+    s.reload = ReloadState::default();
+    s.pending_state_load = None;
+    s.pending_reset = false;
+    s.pending_quit = false;
+}
+
+/// Reset the per-run host state for a cart restart.
+///
+/// Unlike `clear_on_unload`, this keeps the frontend callbacks, input port assignments, the
+/// cart's saved data, its metadata, launch parameters and assets.
+pub fn clear_for_restart() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+
+    s.video = VideoState::default();
+    s.audio = AudioState::default();
+    s.timing = TimingState::default();
+    s.rng = RngState::default();
+    s.blobs = BlobState::default();
+    s.recording = RecordingState::default();
+    s.net = NetState::default();
+    s.replay = ReplayState::default();
+    s.stats = StatsState::default();
+    s.loading = LoadingState::default();
+    s.jobs.clear();
+    s.clipboard_reads.clear();
+    s.pending_state_load = None;
+    s.pending_reset = false;
 }
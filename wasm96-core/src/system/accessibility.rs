@@ -0,0 +1,144 @@
+//! Player accessibility preferences, set once in the frontend and read by every cart.
+//!
+//! The preferences are core options (`wasm96_reduce_flashing`, `wasm96_high_contrast`,
+//! `wasm96_text_scale`, `wasm96_color_blind_mode`), so they belong to the player rather than the
+//! cart and survive loading another one. The core only reports them: a cart decides how to dim
+//! its flashes, which palette to use, and whether to pass the text scale to
+//! `wasm96_graphics_set_text_scale`.
+//!
+//! Layout written by `wasm96_system_accessibility_settings` (little-endian,
+//! [`SETTINGS_SIZE`] bytes): flags `u32` (bit 0 = reduce flashing, bit 1 = high contrast), text
+//! scale `f32`, color-blind mode `u32` (0 = off, 1 = protanopia, 2 = deuteranopia,
+//! 3 = tritanopia).
+
+use std::sync::Mutex;
+
+use wasmtime::Caller;
+
+use crate::av::utils::write_guest_bytes;
+use crate::runtime::GuestLimits;
+
+/// Bytes written by `wasm96_system_accessibility_settings`.
+pub const SETTINGS_SIZE: usize = 12;
+
+/// Core options and their values, as `RETRO_ENVIRONMENT_SET_VARIABLES` expects them (the first
+/// value is the default).
+pub const OPTIONS: [(&str, &str); 4] = [
+    ("wasm96_reduce_flashing", "Reduce flashing; off|on"),
+    ("wasm96_high_contrast", "High contrast; off|on"),
+    ("wasm96_text_scale", "Text scale; 1x|1.25x|1.5x|2x|3x"),
+    (
+        "wasm96_color_blind_mode",
+        "Color-blind mode; off|protanopia|deuteranopia|tritanopia",
+    ),
+];
+
+/// The player's accessibility preferences.
+#[derive(Debug, Clone, Copy, PartialEq)]
+pub struct Settings {
+    pub reduce_flashing: bool,
+    pub high_contrast: bool,
+    /// Preferred multiplier for text size.
+    pub text_scale: f32,
+    /// 0 = off, 1 = protanopia, 2 = deuteranopia, 3 = tritanopia.
+    pub color_blind_mode: u32,
+}
+
+impl Settings {
+    const DEFAULT: Settings = Settings {
+        reduce_flashing: false,
+        high_contrast: false,
+        text_scale: 1.0,
+        color_blind_mode: 0,
+    };
+}
+
+impl Default for Settings {
+    fn default() -> Self {
+        Self::DEFAULT
+    }
+}
+
+static SETTINGS: Mutex<Settings> = Mutex::new(Settings::DEFAULT);
+
+/// The current preferences.
+pub fn settings() -> Settings {
+    match SETTINGS.lock() {
+        Ok(g) => *g,
+        Err(poisoned) => *poisoned.into_inner(),
+    }
+}
+
+/// Apply the value of the core option `key`. Unknown keys are ignored; unknown values mean the
+/// option's default.
+pub fn set_option(key: &str, value: &str) {
+    let mut s = match SETTINGS.lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let value = value.trim();
+    match key {
+        "wasm96_reduce_flashing" => s.reduce_flashing = value == "on",
+        "wasm96_high_contrast" => s.high_contrast = value == "on",
+        "wasm96_text_scale" => s.text_scale = parse_scale(value).unwrap_or(1.0),
+        "wasm96_color_blind_mode" => {
+            s.color_blind_mode = match value {
+                "protanopia" => 1,
+                "deuteranopia" => 2,
+                "tritanopia" => 3,
+                _ => 0,
+            }
+        }
+        _ => {}
+    }
+}
+
+fn parse_scale(value: &str) -> Option<f32> {
+    let scale = value.strip_suffix('x')?.parse::<f32>().ok()?;
+    (scale.is_finite() && scale > 0.0).then_some(scale)
+}
+
+/// Pack `settings` as the guest layout.
+pub fn encode(settings: &Settings) -> [u8; SETTINGS_SIZE] {
+    let flags = settings.reduce_flashing as u32 | (settings.high_contrast as u32) << 1;
+    let mut out = [0; SETTINGS_SIZE];
+    out[0..4].copy_from_slice(&flags.to_le_bytes());
+    out[4..8].copy_from_slice(&settings.text_scale.to_le_bytes());
+    out[8..12].copy_from_slice(&settings.color_blind_mode.to_le_bytes());
+    out
+}
+
+/// Guest import: write the preferences to `ptr`. Returns the bytes written, or 0 if `len` is too
+/// small or the write fails.
+pub fn settings_guest(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    if (len as usize) < SETTINGS_SIZE {
+        return 0;
+    }
+    match write_guest_bytes(caller, ptr, &encode(&settings())) {
+        Ok(()) => SETTINGS_SIZE as u32,
+        Err(_) => 0,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn options_parse_and_encode() {
+        assert_eq!(parse_scale("1.5x"), Some(1.5));
+        assert_eq!(parse_scale("big"), None);
+        assert_eq!(parse_scale("0x"), None);
+
+        let settings = Settings {
+            reduce_flashing: true,
+            high_contrast: false,
+            text_scale: 2.0,
+            color_blind_mode: 2,
+        };
+        let data = encode(&settings);
+        assert_eq!(u32::from_le_bytes(data[0..4].try_into().unwrap()), 1);
+        assert_eq!(f32::from_le_bytes(data[4..8].try_into().unwrap()), 2.0);
+        assert_eq!(u32::from_le_bytes(data[8..12].try_into().unwrap()), 2);
+    }
+}
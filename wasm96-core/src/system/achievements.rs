@@ -0,0 +1,266 @@
+//! Achievements: the cart reports unlocks and progress, the frontend shows and tracks them.
+//!
+//! The cart declares its achievements in its metadata: `achievements` lists the ids (separated
+//! by commas or whitespace) and an optional `achievement_<id>` key gives one a display title
+//! (the id is shown otherwise). With a manifest, ids it doesn't list are refused and logged, so
+//! a typo can't quietly create a new achievement; without one any id is accepted.
+//!
+//! Unlocks, and progress passing each quarter of the way, become frontend notifications
+//! (`RETRO_ENVIRONMENT_SET_MESSAGE`) shown after the tick, and are logged at info level with the
+//! completion count when there is a manifest. Unlocks and progress last until the cart unloads;
+//! restarts keep them.
+
+use std::collections::HashMap;
+use std::os::raw::c_uint;
+
+use wasmtime::Caller;
+
+use super::log::{LEVEL_INFO, LEVEL_WARN, log};
+use crate::av::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::{AchievementState, global};
+
+/// Metadata key listing the cart's achievement ids.
+pub const MANIFEST_KEY: &str = "achievements";
+/// Prefix of the metadata keys holding display titles.
+pub const TITLE_KEY_PREFIX: &str = "achievement_";
+/// Longest achievement id.
+pub const MAX_ID_LEN: u32 = 64;
+
+/// How long a notification stays up, in frontend frames.
+pub const TOAST_FRAMES: c_uint = 180;
+
+/// The achievement ids listed in cart metadata, in order (empty if there is no manifest).
+pub fn manifest(meta: &HashMap<String, String>) -> Vec<String> {
+    let Some(list) = meta.get(MANIFEST_KEY) else {
+        return Vec::new();
+    };
+    let mut ids: Vec<String> = Vec::new();
+    for id in list.split(|c: char| c == ',' || c.is_whitespace()) {
+        if !id.is_empty() && !ids.iter().any(|known| known == id) {
+            ids.push(id.to_string());
+        }
+    }
+    ids
+}
+
+fn title(meta: &HashMap<String, String>, id: &str) -> String {
+    meta.get(&format!("{TITLE_KEY_PREFIX}{id}"))
+        .filter(|t| !t.is_empty())
+        .cloned()
+        .unwrap_or_else(|| id.to_string())
+}
+
+/// What a report changed, for the caller to announce once the state lock is released.
+#[derive(Debug, PartialEq, Eq)]
+pub enum Outcome {
+    /// Unknown id (or bad arguments); nothing changed.
+    Rejected,
+    /// Accepted, nothing worth announcing.
+    Quiet,
+    /// Accepted; show this message.
+    Announce(String),
+}
+
+/// Record an unlock in `state`; `meta` is the cart's metadata.
+pub fn apply_unlock(
+    state: &mut AchievementState,
+    meta: &HashMap<String, String>,
+    id: &str,
+) -> Outcome {
+    let known = manifest(meta);
+    if id.is_empty() || (!known.is_empty() && !known.iter().any(|k| k == id)) {
+        return Outcome::Rejected;
+    }
+    if !state.unlocked.insert(id.to_string()) {
+        return Outcome::Quiet;
+    }
+    state.progress.remove(id);
+    let mut text = format!("Achievement unlocked: {}", title(meta, id));
+    if !known.is_empty() {
+        let done = known.iter().filter(|k| state.unlocked.contains(*k)).count();
+        text.push_str(&format!(" ({done}/{})", known.len()));
+    }
+    Outcome::Announce(text)
+}
+
+/// Record progress `value` out of `max` in `state`; reaching `max` unlocks the achievement.
+pub fn apply_progress(
+    state: &mut AchievementState,
+    meta: &HashMap<String, String>,
+    id: &str,
+    value: u32,
+    max: u32,
+) -> Outcome {
+    if max == 0 {
+        return Outcome::Rejected;
+    }
+    if value >= max {
+        return apply_unlock(state, meta, id);
+    }
+    let known = manifest(meta);
+    if id.is_empty() || (!known.is_empty() && !known.iter().any(|k| k == id)) {
+        return Outcome::Rejected;
+    }
+    if state.unlocked.contains(id) {
+        return Outcome::Quiet;
+    }
+    let quarter = |(value, max): (u32, u32)| value as u64 * 4 / max as u64;
+    let before = state.progress.insert(id.to_string(), (value, max));
+    if quarter((value, max)) > before.map_or(0, quarter) {
+        Outcome::Announce(format!("{}: {value}/{max}", title(meta, id)))
+    } else {
+        Outcome::Quiet
+    }
+}
+
+fn report(
+    id: &str,
+    apply: impl FnOnce(&mut AchievementState, &HashMap<String, String>) -> Outcome,
+) -> bool {
+    let outcome = {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let s = &mut *s;
+        let outcome = apply(&mut s.achievements, &s.cart.meta);
+        if let Outcome::Announce(text) = &outcome {
+            s.achievements.toasts.push(text.clone());
+        }
+        outcome
+    };
+    match outcome {
+        Outcome::Rejected => {
+            log(LEVEL_WARN, &format!("unknown achievement '{id}'"));
+            false
+        }
+        Outcome::Quiet => true,
+        Outcome::Announce(text) => {
+            log(LEVEL_INFO, &text);
+            true
+        }
+    }
+}
+
+/// Unlock achievement `id`. Returns false if the manifest doesn't list it.
+pub fn unlock(id: &str) -> bool {
+    report(id, |state, meta| apply_unlock(state, meta, id))
+}
+
+/// Report progress on achievement `id`. Returns false if the manifest doesn't list it or `max`
+/// is 0.
+pub fn progress(id: &str, value: u32, max: u32) -> bool {
+    report(id, |state, meta| {
+        apply_progress(state, meta, id, value, max)
+    })
+}
+
+fn read_id(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> Option<String> {
+    if len > MAX_ID_LEN {
+        return None;
+    }
+    read_guest_bytes(caller, ptr, len)
+        .ok()
+        .and_then(|b| String::from_utf8(b).ok())
+}
+
+/// `unlock` with the id read from guest memory. Returns 1 if unlocked (now or before).
+pub fn unlock_guest(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    read_id(caller, ptr, len).is_some_and(|id| unlock(&id)) as u32
+}
+
+/// `progress` with the id read from guest memory. Returns 1 if accepted.
+pub fn progress_guest(
+    caller: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+    value: u32,
+    max: u32,
+) -> u32 {
+    read_id(caller, ptr, len).is_some_and(|id| progress(&id, value, max)) as u32
+}
+
+/// Take the notifications queued since the last call, oldest first.
+pub fn take_toasts() -> Vec<String> {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    std::mem::take(&mut s.achievements.toasts)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn meta(pairs: &[(&str, &str)]) -> HashMap<String, String> {
+        pairs
+            .iter()
+            .map(|(k, v)| (k.to_string(), v.to_string()))
+            .collect()
+    }
+
+    #[test]
+    fn manifest_lists_ids_once() {
+        let m = meta(&[(
+            "achievements",
+            "first_blood, speedrun,,first_blood  pacifist",
+        )]);
+        assert_eq!(manifest(&m), ["first_blood", "speedrun", "pacifist"]);
+        assert!(manifest(&HashMap::new()).is_empty());
+    }
+
+    #[test]
+    fn unlocks_follow_the_manifest() {
+        let m = meta(&[
+            ("achievements", "first_blood,speedrun"),
+            ("achievement_speedrun", "Under Ten Minutes"),
+        ]);
+        let mut state = AchievementState::default();
+        assert_eq!(apply_unlock(&mut state, &m, "typo"), Outcome::Rejected);
+        assert_eq!(
+            apply_unlock(&mut state, &m, "speedrun"),
+            Outcome::Announce("Achievement unlocked: Under Ten Minutes (1/2)".into())
+        );
+        assert_eq!(apply_unlock(&mut state, &m, "speedrun"), Outcome::Quiet);
+
+        // Without a manifest anything goes.
+        let mut state = AchievementState::default();
+        assert_eq!(
+            apply_unlock(&mut state, &HashMap::new(), "anything"),
+            Outcome::Announce("Achievement unlocked: anything".into())
+        );
+    }
+
+    #[test]
+    fn progress_announces_quarters_and_unlocks_at_max() {
+        let m = HashMap::new();
+        let mut state = AchievementState::default();
+        assert_eq!(
+            apply_progress(&mut state, &m, "coins", 1, 0),
+            Outcome::Rejected
+        );
+        assert_eq!(
+            apply_progress(&mut state, &m, "coins", 10, 100),
+            Outcome::Quiet
+        );
+        assert_eq!(
+            apply_progress(&mut state, &m, "coins", 30, 100),
+            Outcome::Announce("coins: 30/100".into())
+        );
+        assert_eq!(
+            apply_progress(&mut state, &m, "coins", 40, 100),
+            Outcome::Quiet
+        );
+        assert_eq!(
+            apply_progress(&mut state, &m, "coins", 120, 100),
+            Outcome::Announce("Achievement unlocked: coins".into())
+        );
+        assert!(state.progress.is_empty());
+        assert_eq!(
+            apply_progress(&mut state, &m, "coins", 5, 100),
+            Outcome::Quiet
+        );
+    }
+}
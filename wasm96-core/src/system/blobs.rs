@@ -0,0 +1,54 @@
+//! Host-owned byte buffers returned to the guest by id.
+//!
+//! Imports that produce variable-length output store it here and return a blob id (`0` means
+//! "no result"). The guest then calls:
+//! - `wasm96_system_blob_len(id)` to size a buffer,
+//! - `wasm96_system_blob_read(id, ptr, len)` to copy the bytes into guest memory,
+//! - `wasm96_system_blob_free(id)` to release the host copy.
+
+use wasmtime::Caller;
+
+use crate::av::utils::write_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::global;
+
+/// Store `data` and return its id. Ids start at 1 and are never 0.
+pub fn store(data: Vec<u8>) -> u32 {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.blobs.next_id = s.blobs.next_id.wrapping_add(1).max(1);
+    let id = s.blobs.next_id;
+    s.blobs.blobs.insert(id, data);
+    id
+}
+
+/// Length in bytes of blob `id`, or 0 if it doesn't exist.
+pub fn len(id: u32) -> u32 {
+    let s = global().lock().unwrap();
+    s.blobs.blobs.get(&id).map(|b| b.len() as u32).unwrap_or(0)
+}
+
+/// Copy blob `id` into guest memory at `ptr`.
+///
+/// Returns the number of bytes copied, or 0 if the blob is missing or `len` is too small.
+pub fn read(caller: &mut Caller<'_, GuestLimits>, id: u32, ptr: u32, len: u32) -> u32 {
+    let data = {
+        let s = global().lock().unwrap();
+        match s.blobs.blobs.get(&id) {
+            Some(b) if b.len() as u64 <= len as u64 => b.clone(),
+            _ => return 0,
+        }
+    };
+    match write_guest_bytes(caller, ptr, &data) {
+        Ok(()) => data.len() as u32,
+        Err(_) => 0,
+    }
+}
+
+/// Release blob `id`. Unknown ids are ignored.
+pub fn free(id: u32) {
+    let mut s = global().lock().unwrap();
+    s.blobs.blobs.remove(&id);
+}
@@ -0,0 +1,192 @@
+//! Screenshots and GIF recording of the software framebuffer.
+//!
+//! Captures read `VideoState::framebuffer`, i.e. what the guest drew with 2D calls. The 3D
+//! (GL) layer is not included.
+
+use std::time::Instant;
+
+use super::blobs;
+use crate::state::global;
+
+/// Upper bound on frames kept by one recording (~20 s at the capture rate below).
+pub const MAX_GIF_FRAMES: usize = 1000;
+
+/// Minimum spacing between captured frames. Most GIF viewers clamp delays under 20ms anyway.
+const MIN_FRAME_MILLIS: u128 = 20;
+
+/// Convert 0xAARRGGBB framebuffer pixels to tightly packed RGB8.
+///
+/// The framebuffer's alpha byte is the 3D overlay mask, not image alpha, so it is dropped.
+fn framebuffer_to_rgb(fb: &[u32]) -> Vec<u8> {
+    let mut out = Vec::with_capacity(fb.len() * 3);
+    for &c in fb {
+        out.extend_from_slice(&[(c >> 16) as u8, (c >> 8) as u8, c as u8]);
+    }
+    out
+}
+
+/// Encode a framebuffer as an RGB PNG.
+pub fn encode_png(width: u32, height: u32, fb: &[u32]) -> Option<Vec<u8>> {
+    let rgb = framebuffer_to_rgb(fb);
+    let mut out = Vec::new();
+    {
+        let mut encoder = png::Encoder::new(&mut out, width, height);
+        encoder.set_color(png::ColorType::Rgb);
+        encoder.set_depth(png::BitDepth::Eight);
+        let mut writer = encoder.write_header().ok()?;
+        writer.write_image_data(&rgb).ok()?;
+    }
+    Some(out)
+}
+
+/// Encode captured RGBA frames as a looping GIF.
+pub fn encode_gif(
+    width: u32,
+    height: u32,
+    frames: &mut [Vec<u8>],
+    delays: &[u16],
+) -> Option<Vec<u8>> {
+    if frames.is_empty() || width > u16::MAX as u32 || height > u16::MAX as u32 {
+        return None;
+    }
+    let mut out = Vec::new();
+    {
+        let mut encoder = gif::Encoder::new(&mut out, width as u16, height as u16, &[]).ok()?;
+        encoder.set_repeat(gif::Repeat::Infinite).ok()?;
+        for (rgba, &delay) in frames.iter_mut().zip(delays) {
+            // Speed 10 is the gif crate's recommended quality/speed trade-off.
+            let mut frame = gif::Frame::from_rgba_speed(width as u16, height as u16, rgba, 10);
+            frame.delay = delay.max(2);
+            encoder.write_frame(&frame).ok()?;
+        }
+    }
+    Some(out)
+}
+
+/// Encode the current framebuffer as PNG and return a blob id (0 on failure).
+pub fn screenshot() -> u32 {
+    let (width, height, fb) = {
+        let s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        (s.video.width, s.video.height, s.video.framebuffer.clone())
+    };
+    match encode_png(width, height, &fb) {
+        Some(png) => blobs::store(png),
+        None => 0,
+    }
+}
+
+/// Begin recording. Any recording already in progress is discarded.
+pub fn record_gif_start() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    let (width, height) = (s.video.width, s.video.height);
+    let rec = &mut s.recording;
+    rec.active = true;
+    rec.width = width;
+    rec.height = height;
+    rec.frames.clear();
+    rec.delays.clear();
+    rec.last_capture = None;
+}
+
+/// Stop recording and encode the captured frames as a GIF. Returns a blob id (0 if nothing was
+/// recorded or encoding failed).
+pub fn record_gif_stop() -> u32 {
+    let (width, height, mut frames, delays) = {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let rec = &mut s.recording;
+        if !rec.active {
+            return 0;
+        }
+        rec.active = false;
+        rec.last_capture = None;
+        (
+            rec.width,
+            rec.height,
+            std::mem::take(&mut rec.frames),
+            std::mem::take(&mut rec.delays),
+        )
+    };
+    match encode_gif(width, height, &mut frames, &delays) {
+        Some(gif) => blobs::store(gif),
+        None => 0,
+    }
+}
+
+/// Called by the core after each guest draw. Appends a frame while recording.
+pub fn capture_frame() {
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    if !s.recording.active {
+        return;
+    }
+    // A mid-recording resize can't be represented in one GIF; keep the original size only.
+    if s.video.width != s.recording.width || s.video.height != s.recording.height {
+        return;
+    }
+    if s.recording.frames.len() >= MAX_GIF_FRAMES {
+        return;
+    }
+
+    let now = Instant::now();
+    if let Some(last) = s.recording.last_capture {
+        let elapsed = now.saturating_duration_since(last).as_millis();
+        if elapsed < MIN_FRAME_MILLIS {
+            return;
+        }
+        // The previous frame stays on screen until this one; record its delay in 1/100 s.
+        if let Some(d) = s.recording.delays.last_mut() {
+            *d = (elapsed / 10).min(u16::MAX as u128) as u16;
+        }
+    }
+
+    let mut rgba = Vec::with_capacity(s.video.framebuffer.len() * 4);
+    for &c in &s.video.framebuffer {
+        rgba.extend_from_slice(&[(c >> 16) as u8, (c >> 8) as u8, c as u8, 0xFF]);
+    }
+    let rec = &mut s.recording;
+    rec.frames.push(rgba);
+    rec.delays.push((MIN_FRAME_MILLIS / 10) as u16);
+    rec.last_capture = Some(now);
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn framebuffer_to_rgb_drops_overlay_alpha() {
+        assert_eq!(
+            framebuffer_to_rgb(&[0x00112233, 0xFF445566]),
+            vec![0x11, 0x22, 0x33, 0x44, 0x55, 0x66]
+        );
+    }
+
+    #[test]
+    fn encode_png_produces_png_signature() {
+        let png = encode_png(2, 2, &[0x00FF0000; 4]).expect("encode");
+        assert_eq!(&png[..8], b"\x89PNG\r\n\x1a\n");
+    }
+
+    #[test]
+    fn encode_gif_rejects_empty_recording() {
+        assert!(encode_gif(2, 2, &mut [], &[]).is_none());
+    }
+
+    #[test]
+    fn encode_gif_produces_gif_header() {
+        let mut frames = vec![vec![255u8; 2 * 2 * 4], vec![0u8; 2 * 2 * 4]];
+        let gif = encode_gif(2, 2, &mut frames, &[5, 5]).expect("encode");
+        assert_eq!(&gif[..6], b"GIF89a");
+    }
+}
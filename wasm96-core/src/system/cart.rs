@@ -0,0 +1,256 @@
+//! Cartridge metadata and launch parameters.
+//!
+//! Metadata comes from the cart itself: a `wasm96.meta` custom section holding UTF-8
+//! `key=value` lines (`title`, `version`, `author`, or anything else the cart wants to ship).
+//! Blank lines and lines starting with `#` are skipped; values may be wrapped in double quotes.
+//! A `.w96` bundle may also carry a `wasm96.meta` entry in the same format, which wins over the
+//! module's section.
+//!
+//! Bundle assets are read on demand with `wasm96_system_asset_read` and listed with
+//! `wasm96_system_asset_list`; they stay on the host until then. Plain `.wasm`/`.wat` carts have
+//! no assets.
+//!
+//! Launch parameters come from the player: the frontend's content meta string, then the
+//! `WASM96_LAUNCH_ARGS` environment variable (later values win). Both hold `key=value` pairs
+//! separated by whitespace, `,` or `;`; a bare `key` means `key=1`, so `debug` turns on a flag.
+//!
+//! Both are read once when the cart loads and are available from `setup` onwards.
+
+use std::collections::HashMap;
+
+use wasmtime::Caller;
+
+use crate::av::utils::read_guest_bytes;
+use crate::loader;
+use crate::loader::bundle::{self, Bundle};
+use crate::runtime::GuestLimits;
+use crate::state::{GlobalState, global};
+
+/// Custom section carrying cart metadata.
+pub const META_SECTION: &str = "wasm96.meta";
+
+/// Environment variable holding launch parameters.
+pub const LAUNCH_ARGS_ENV: &str = "WASM96_LAUNCH_ARGS";
+
+/// Read `key=value` lines from every `wasm96.meta` custom section of a WASM (or WAT) module,
+/// then from the `wasm96.meta` entry if `rom_bytes` is a bundle.
+pub fn parse_meta(rom_bytes: &[u8]) -> HashMap<String, String> {
+    let mut meta = HashMap::new();
+    let Ok(detected) = loader::normalize_to_wasm(rom_bytes) else {
+        return meta;
+    };
+    for section in custom_sections(&detected.wasm_bytes, META_SECTION) {
+        parse_meta_lines(section, &mut meta);
+    }
+    if let Some(entry) = Bundle::parse(rom_bytes)
+        .as_ref()
+        .and_then(|b| b.get(bundle::META_ENTRY))
+    {
+        parse_meta_lines(entry, &mut meta);
+    }
+    meta
+}
+
+fn parse_meta_lines(text: &[u8], meta: &mut HashMap<String, String>) {
+    for line in String::from_utf8_lossy(text).lines() {
+        let line = line.trim();
+        if line.is_empty() || line.starts_with('#') {
+            continue;
+        }
+        if let Some((key, value)) = line.split_once('=') {
+            let value = value.trim();
+            let value = value
+                .strip_prefix('"')
+                .and_then(|v| v.strip_suffix('"'))
+                .unwrap_or(value);
+            meta.insert(key.trim().to_string(), value.to_string());
+        }
+    }
+}
+
+/// Payloads of the custom sections called `name`.
+fn custom_sections<'a>(wasm: &'a [u8], name: &str) -> Vec<&'a [u8]> {
+    let mut found = Vec::new();
+    let Some(mut rest) = wasm.get(8..) else {
+        return found;
+    };
+    while let Some((&id, after_id)) = rest.split_first() {
+        let Some((size, body)) = read_leb_u32(after_id) else {
+            break;
+        };
+        let Some(payload) = body.get(..size as usize) else {
+            break;
+        };
+        rest = &body[size as usize..];
+        if id != 0 {
+            continue;
+        }
+        let Some((name_len, after_len)) = read_leb_u32(payload) else {
+            continue;
+        };
+        if after_len.get(..name_len as usize) == Some(name.as_bytes()) {
+            found.push(&after_len[name_len as usize..]);
+        }
+    }
+    found
+}
+
+/// Decode an unsigned LEB128 `u32`, returning it and the bytes after it.
+fn read_leb_u32(data: &[u8]) -> Option<(u32, &[u8])> {
+    let mut value = 0u32;
+    for (i, &byte) in data.iter().enumerate().take(5) {
+        value |= ((byte & 0x7F) as u32) << (7 * i);
+        if byte & 0x80 == 0 {
+            return Some((value, &data[i + 1..]));
+        }
+    }
+    None
+}
+
+/// Parse `key=value` pairs separated by whitespace, `,` or `;` into `args`.
+pub fn parse_launch_args(text: &str, args: &mut HashMap<String, String>) {
+    for pair in text.split(|c: char| c.is_whitespace() || c == ',' || c == ';') {
+        if pair.is_empty() {
+            continue;
+        }
+        let (key, value) = pair.split_once('=').unwrap_or((pair, "1"));
+        if !key.is_empty() {
+            args.insert(key.to_string(), value.to_string());
+        }
+    }
+}
+
+/// Record the metadata and assets of a freshly loaded cart and its launch parameters.
+pub fn load(rom_bytes: &[u8], frontend_meta: Option<&str>) {
+    let meta = parse_meta(rom_bytes);
+    let assets = Bundle::parse(rom_bytes).unwrap_or_default();
+    let mut args = HashMap::new();
+    if let Some(text) = frontend_meta {
+        parse_launch_args(text, &mut args);
+    }
+    if let Ok(text) = std::env::var(LAUNCH_ARGS_ENV) {
+        parse_launch_args(&text, &mut args);
+    }
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.cart.meta = meta;
+    s.cart.launch_args = args;
+    s.cart.assets = assets;
+}
+
+/// Swap in the metadata and assets of a hot-reloaded cart, keeping the launch parameters.
+pub fn reload(rom_bytes: &[u8]) {
+    let meta = parse_meta(rom_bytes);
+    let assets = Bundle::parse(rom_bytes).unwrap_or_default();
+    let mut s = global().lock().unwrap();
+    s.cart.meta = meta;
+    s.cart.assets = assets;
+}
+
+/// Guest import: blob id of the metadata value under the key at `ptr` (0 if it isn't set).
+pub fn meta_guest(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    lookup(caller, ptr, len, |s, key| {
+        s.cart.meta.get(key).map(|v| v.clone().into_bytes())
+    })
+}
+
+/// Guest import: blob id of the launch parameter under the key at `ptr` (0 if it isn't set).
+pub fn launch_arg_guest(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    lookup(caller, ptr, len, |s, key| {
+        s.cart.launch_args.get(key).map(|v| v.clone().into_bytes())
+    })
+}
+
+/// Guest import: blob id of the bundle asset at the path at `ptr` (0 if there is none).
+pub fn asset_read_guest(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    lookup(caller, ptr, len, |s, path| {
+        s.cart.assets.asset(path).map(<[u8]>::to_vec)
+    })
+}
+
+/// Guest import: blob id of the sorted, newline-separated bundle asset paths starting with the
+/// prefix at `ptr` (0 if none match).
+pub fn asset_list_guest(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    lookup(caller, ptr, len, |s, prefix| {
+        let paths: Vec<&str> = s.cart.assets.asset_paths(prefix).collect();
+        (!paths.is_empty()).then(|| paths.join("\n").into_bytes())
+    })
+}
+
+fn lookup(
+    caller: &mut Caller<'_, GuestLimits>,
+    ptr: u32,
+    len: u32,
+    get: impl Fn(&GlobalState, &str) -> Option<Vec<u8>>,
+) -> u32 {
+    let Ok(key) = read_guest_bytes(caller, ptr, len) else {
+        return 0;
+    };
+    let Ok(key) = std::str::from_utf8(&key) else {
+        return 0;
+    };
+    let value = get(&global().lock().unwrap(), key);
+    match value {
+        Some(v) => super::blobs::store(v),
+        None => 0,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// A module with just a custom section.
+    fn module_with_section(name: &str, payload: &[u8]) -> Vec<u8> {
+        let mut body = vec![name.len() as u8];
+        body.extend_from_slice(name.as_bytes());
+        body.extend_from_slice(payload);
+        let mut wasm = b"\0asm\x01\0\0\0".to_vec();
+        wasm.push(0);
+        wasm.push(body.len() as u8);
+        wasm.extend_from_slice(&body);
+        wasm
+    }
+
+    #[test]
+    fn reads_meta_section() {
+        let wasm = module_with_section(
+            META_SECTION,
+            b"# cart info\ntitle = \"Space Rocks\"\nversion=1.2\n\nauthor=ada\n",
+        );
+        let meta = parse_meta(&wasm);
+        assert_eq!(meta["title"], "Space Rocks");
+        assert_eq!(meta["version"], "1.2");
+        assert_eq!(meta["author"], "ada");
+        assert_eq!(meta.len(), 3);
+
+        let other = module_with_section("name", b"title=nope");
+        assert!(parse_meta(&other).is_empty());
+    }
+
+    #[test]
+    fn bundle_meta_wins_over_the_section() {
+        let wasm = module_with_section(META_SECTION, b"title=Module\nversion=1");
+        let w96 = Bundle::write(&[
+            ("cart.wasm", &wasm),
+            ("wasm96.meta", b"title=\"Bundle\"\nauthor=ada"),
+        ]);
+        let meta = parse_meta(&w96);
+        assert_eq!(meta["title"], "Bundle");
+        assert_eq!(meta["version"], "1");
+        assert_eq!(meta["author"], "ada");
+    }
+
+    #[test]
+    fn parses_launch_args() {
+        let mut args = HashMap::new();
+        parse_launch_args("difficulty=hard, debug;lives=3", &mut args);
+        parse_launch_args("lives=5", &mut args);
+        assert_eq!(args["difficulty"], "hard");
+        assert_eq!(args["debug"], "1");
+        assert_eq!(args["lives"], "5");
+        assert_eq!(args.len(), 3);
+    }
+}
@@ -0,0 +1,250 @@
+//! Clipboard access for guests, behind a player permission.
+//!
+//! Carts can read or write the system clipboard only when the player allows it with the
+//! `WASM96_CLIPBOARD` environment variable: `read`, `write`, or both (`read,write`; `1` or `all`
+//! also grant both). Unset or empty, every clipboard call is refused.
+//!
+//! The clipboard is reached through the platform's command-line tools, so no windowing
+//! dependency is needed: `pbpaste`/`pbcopy` on macOS, PowerShell `Get-Clipboard`/`clip` on
+//! Windows, and `wl-paste`/`wl-copy` (Wayland) or `xclip`/`xsel` (X11) elsewhere. Both run on
+//! background threads so a slow tool never stalls a frame: a read returns an id the cart polls
+//! until the text is ready, like a network request.
+
+use std::io::Write;
+use std::process::{Command, Stdio};
+use std::sync::atomic::{AtomicU32, Ordering};
+
+use wasmtime::Caller;
+
+use crate::av::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::{ClipboardRead, global};
+
+/// Environment variable holding the clipboard permission.
+pub const PERMISSION_ENV: &str = "WASM96_CLIPBOARD";
+
+/// Clipboard text larger than this is refused.
+pub const MAX_CLIPBOARD_BYTES: usize = 1024 * 1024;
+
+/// Most reads that may be pending at once; further reads are refused.
+pub const MAX_PENDING_READS: usize = 4;
+
+static NEXT_READ_ID: AtomicU32 = AtomicU32::new(1);
+
+/// What a `WASM96_CLIPBOARD` value allows, as (read, write).
+pub fn parse_permission(value: &str) -> (bool, bool) {
+    let (mut read, mut write) = (false, false);
+    for part in value.split(',').map(|p| p.trim().to_ascii_lowercase()) {
+        match part.as_str() {
+            "read" => read = true,
+            "write" => write = true,
+            "1" | "all" | "true" => (read, write) = (true, true),
+            _ => {}
+        }
+    }
+    (read, write)
+}
+
+fn permission() -> (bool, bool) {
+    parse_permission(&std::env::var(PERMISSION_ENV).unwrap_or_default())
+}
+
+/// Commands that print the clipboard, in the order to try them.
+fn paste_commands() -> Vec<(&'static str, &'static [&'static str])> {
+    if cfg!(target_os = "macos") {
+        vec![("pbpaste", &[])]
+    } else if cfg!(windows) {
+        vec![(
+            "powershell",
+            &["-NoProfile", "-Command", "Get-Clipboard -Raw"],
+        )]
+    } else {
+        vec![
+            ("wl-paste", &["--no-newline"]),
+            ("xclip", &["-selection", "clipboard", "-o"]),
+            ("xsel", &["--clipboard", "--output"]),
+        ]
+    }
+}
+
+/// Commands that replace the clipboard with their stdin, in the order to try them.
+fn copy_commands() -> Vec<(&'static str, &'static [&'static str])> {
+    if cfg!(target_os = "macos") {
+        vec![("pbcopy", &[])]
+    } else if cfg!(windows) {
+        vec![("clip", &[])]
+    } else {
+        vec![
+            ("wl-copy", &[]),
+            ("xclip", &["-selection", "clipboard", "-i"]),
+            ("xsel", &["--clipboard", "--input"]),
+        ]
+    }
+}
+
+/// Read the clipboard as text, or `None` if no tool worked.
+pub fn read_text() -> Option<String> {
+    for (program, args) in paste_commands() {
+        let Ok(output) = Command::new(program)
+            .args(args)
+            .stdin(Stdio::null())
+            .stderr(Stdio::null())
+            .output()
+        else {
+            continue;
+        };
+        if output.status.success() && output.stdout.len() <= MAX_CLIPBOARD_BYTES {
+            return String::from_utf8(output.stdout).ok();
+        }
+    }
+    None
+}
+
+/// Replace the clipboard with `text` on a background thread.
+pub fn write_text(text: String) {
+    std::thread::spawn(move || {
+        for (program, args) in copy_commands() {
+            let Ok(mut child) = Command::new(program)
+                .args(args)
+                .stdin(Stdio::piped())
+                .stdout(Stdio::null())
+                .stderr(Stdio::null())
+                .spawn()
+            else {
+                continue;
+            };
+            if let Some(mut stdin) = child.stdin.take() {
+                let _ = stdin.write_all(text.as_bytes());
+            }
+            if child.wait().is_ok_and(|status| status.success()) {
+                return;
+            }
+        }
+    });
+}
+
+/// Start reading the clipboard on a background thread. Returns the read's id, or 0 if
+/// reading isn't allowed or too many reads are pending.
+pub fn read_start() -> u32 {
+    if !permission().0 {
+        return 0;
+    }
+    let id = {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let pending = s
+            .clipboard_reads
+            .values()
+            .filter(|read| **read == ClipboardRead::Pending)
+            .count();
+        if pending >= MAX_PENDING_READS {
+            return 0;
+        }
+        let id = NEXT_READ_ID.fetch_add(1, Ordering::Relaxed).max(1);
+        s.clipboard_reads.insert(id, ClipboardRead::Pending);
+        id
+    };
+
+    std::thread::spawn(move || {
+        let outcome = match read_text() {
+            Some(text) => ClipboardRead::Done(text.into_bytes()),
+            None => ClipboardRead::Failed,
+        };
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        // The guest may have cancelled (or the cart unloaded) while the tool ran.
+        if let Some(read) = s.clipboard_reads.get_mut(&id) {
+            *read = outcome;
+        }
+    });
+
+    id
+}
+
+/// Poll a read: 0 = unknown id, 1 = pending, 2 = done, 3 = failed.
+pub fn read_poll(id: u32) -> u32 {
+    let s = global().lock().unwrap();
+    match s.clipboard_reads.get(&id) {
+        None => 0,
+        Some(ClipboardRead::Pending) => 1,
+        Some(ClipboardRead::Done(_)) => 2,
+        Some(ClipboardRead::Failed) => 3,
+    }
+}
+
+/// Move a finished read's text into a blob and forget the read.
+///
+/// Returns the blob id, or 0 if the read is unknown, still pending, failed, or found no text.
+pub fn read_take(id: u32) -> u32 {
+    let text = {
+        let mut s = global().lock().unwrap();
+        if s.clipboard_reads.get(&id) == Some(&ClipboardRead::Pending) {
+            return 0;
+        }
+        match s.clipboard_reads.remove(&id) {
+            Some(ClipboardRead::Done(text)) if !text.is_empty() => text,
+            _ => return 0,
+        }
+    };
+    super::blobs::store(text)
+}
+
+/// Forget a read. A still-running read finishes in the background and is discarded.
+pub fn read_cancel(id: u32) {
+    let mut s = global().lock().unwrap();
+    s.clipboard_reads.remove(&id);
+}
+
+/// Guest import: copy the UTF-8 text at `ptr` to the clipboard. Returns 1 if the write was
+/// allowed and started.
+pub fn set_guest(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    if !permission().1 || len as usize > MAX_CLIPBOARD_BYTES {
+        return 0;
+    }
+    let Ok(bytes) = read_guest_bytes(caller, ptr, len) else {
+        return 0;
+    };
+    let Ok(text) = String::from_utf8(bytes) else {
+        return 0;
+    };
+    write_text(text);
+    1
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_permission() {
+        assert_eq!(parse_permission(""), (false, false));
+        assert_eq!(parse_permission("read"), (true, false));
+        assert_eq!(parse_permission("write"), (false, true));
+        assert_eq!(parse_permission("Read, write"), (true, true));
+        assert_eq!(parse_permission("1"), (true, true));
+        assert_eq!(parse_permission("nope"), (false, false));
+    }
+
+    #[test]
+    fn finished_reads_are_taken_once() {
+        global().lock().unwrap().clipboard_reads.extend([
+            (7, ClipboardRead::Pending),
+            (8, ClipboardRead::Done(b"hi".to_vec())),
+        ]);
+
+        assert_eq!(read_poll(7), 1);
+        assert_eq!(read_take(7), 0);
+        assert_eq!(read_poll(7), 1);
+        read_cancel(7);
+        assert_eq!(read_poll(7), 0);
+
+        assert_eq!(read_poll(8), 2);
+        assert_ne!(read_take(8), 0);
+        assert_eq!(read_poll(8), 0);
+        assert_eq!(read_take(8), 0);
+    }
+}
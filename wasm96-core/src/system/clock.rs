@@ -0,0 +1,85 @@
+//! Wall-clock time for guests.
+//!
+//! `wasm96_system_millis` is for measuring intervals; carts that care about the calendar (daily
+//! challenges, seasonal events, an in-game clock) use the Unix time and the player's UTC offset
+//! from here and do the date arithmetic themselves.
+//!
+//! The offset comes from the `WASM96_UTC_OFFSET_MINUTES` environment variable when it's set,
+//! otherwise from the host's local time zone (Unix only; other platforms report UTC). It is
+//! looked up for the current instant, so it follows daylight saving changes.
+//!
+//! Neither value is part of save states or input replays: a replayed session sees the time of
+//! the replay, not of the recording.
+
+use std::time::{SystemTime, UNIX_EPOCH};
+
+/// Environment variable overriding the local UTC offset, in minutes east of UTC.
+pub const UTC_OFFSET_ENV: &str = "WASM96_UTC_OFFSET_MINUTES";
+
+/// Largest offset accepted from the environment (±18 hours).
+const MAX_OFFSET_MINUTES: i32 = 18 * 60;
+
+/// Seconds since 1970-01-01 00:00:00 UTC (negative if the host clock is before it).
+pub fn unix_time() -> i64 {
+    match SystemTime::now().duration_since(UNIX_EPOCH) {
+        Ok(since) => since.as_secs() as i64,
+        Err(before) => -(before.duration().as_secs() as i64),
+    }
+}
+
+/// Parse a `WASM96_UTC_OFFSET_MINUTES` value (e.g. `120`, `-300`).
+pub fn parse_offset(value: &str) -> Option<i32> {
+    let minutes: i32 = value.trim().parse().ok()?;
+    (minutes.abs() <= MAX_OFFSET_MINUTES).then_some(minutes)
+}
+
+/// Minutes east of UTC of the player's local time at `unix_time`.
+pub fn local_offset_minutes(unix_time: i64) -> i32 {
+    if let Some(minutes) = std::env::var(UTC_OFFSET_ENV)
+        .ok()
+        .and_then(|v| parse_offset(&v))
+    {
+        return minutes;
+    }
+    host_offset_seconds(unix_time).map_or(0, |s| (s / 60) as i32)
+}
+
+#[cfg(unix)]
+fn host_offset_seconds(unix_time: i64) -> Option<i64> {
+    let time = unix_time as libc::time_t;
+    // SAFETY: `localtime_r` only writes the `tm` we hand it.
+    let mut tm: libc::tm = unsafe { std::mem::zeroed() };
+    if unsafe { libc::localtime_r(&time, &mut tm) }.is_null() {
+        return None;
+    }
+    Some(tm.tm_gmtoff as i64)
+}
+
+#[cfg(not(unix))]
+fn host_offset_seconds(_unix_time: i64) -> Option<i64> {
+    None
+}
+
+/// Guest import: the local UTC offset right now.
+pub fn local_offset_guest() -> i32 {
+    local_offset_minutes(unix_time())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn parses_offset() {
+        assert_eq!(parse_offset("120"), Some(120));
+        assert_eq!(parse_offset(" -330 "), Some(-330));
+        assert_eq!(parse_offset("0"), Some(0));
+        assert_eq!(parse_offset("5000"), None);
+        assert_eq!(parse_offset("UTC"), None);
+    }
+
+    #[test]
+    fn unix_time_is_after_2020() {
+        assert!(unix_time() > 1_577_836_800);
+    }
+}
@@ -0,0 +1,470 @@
+//! Background jobs: a guest export run on a worker instance, in parallel with the cart.
+//!
+//! `wasm96_system_job_spawn` names an export taking a `u32` argument (returning a `u32` or
+//! nothing) and hands over input bytes. The host instantiates the cart module again on a worker
+//! thread, calls `_initialize` if the module exports one, then the job export. The worker
+//! instance has its own linear memory, so jobs exchange data only through their input
+//! (`wasm96_system_job_input_*`) and output (`wasm96_system_job_output_write`); the cart
+//! collects the return value and output once `wasm96_system_job_status` reports it done.
+//!
+//! Workers only get the job imports. Any other import traps, failing the job, so jobs can't
+//! draw, play sounds or touch host state behind the cart's back. Outside a job the input imports
+//! see an empty input and output is discarded.
+//!
+//! Workers run on their own engine with epoch interruption. Freeing a job, restarting or
+//! unloading the cart bumps the epoch, as does a ticker every `TICK` while workers are alive;
+//! each worker then checks whether its job is still wanted and traps out if not, so abandoned
+//! jobs don't keep threads alive.
+//!
+//! Jobs finish on their own schedule, so carts that rely on replays or rollback should wait for
+//! results at a fixed point (e.g. block a few ticks later) rather than use them as they land.
+
+use std::sync::atomic::{AtomicU32, AtomicUsize, Ordering};
+use std::sync::{Arc, Mutex, OnceLock};
+use std::thread::Thread;
+use std::time::Duration;
+
+use wasmtime::{Caller, Engine, Linker, Module, Store, UpdateDeadline};
+
+use crate::abi::{IMPORT_MODULE, host_imports};
+use crate::av::utils::{read_guest_bytes, write_guest_bytes};
+use crate::loader;
+use crate::runtime::GuestLimits;
+use crate::runtime::runtime::WasmtimeRuntime;
+use crate::state::{Job, JobPhase, global};
+
+/// Most worker threads that may be alive at once; further spawns are refused.
+pub const MAX_RUNNING_JOBS: usize = 64;
+
+/// Largest input a job accepts.
+pub const MAX_JOB_INPUT: u32 = 16 * 1024 * 1024;
+
+/// Worker store data: the job's input, the output it has written so far, and the same memory
+/// limits the cart's own store has.
+#[derive(Default)]
+pub struct JobData {
+    input: Vec<u8>,
+    output: Vec<u8>,
+    limits: GuestLimits,
+}
+
+/// What a worker needs to instantiate the loaded cart.
+struct JobContext {
+    module: Module,
+    linker: Arc<Linker<JobData>>,
+}
+
+static CONTEXT: Mutex<Option<JobContext>> = Mutex::new(None);
+
+// Shared by every cart, so `interrupt` reaches workers left over from an earlier one.
+static ENGINE: OnceLock<Engine> = OnceLock::new();
+
+// Catches workers that checked their job just before it was freed and so missed that bump.
+static TICKER: OnceLock<Thread> = OnceLock::new();
+const TICK: Duration = Duration::from_millis(10);
+
+// Worker threads that haven't exited yet, whether or not their job is still in the table.
+static LIVE_WORKERS: AtomicUsize = AtomicUsize::new(0);
+
+/// Decrements `LIVE_WORKERS` when a worker thread exits, however it exits.
+struct LiveWorker;
+
+impl Drop for LiveWorker {
+    fn drop(&mut self) {
+        LIVE_WORKERS.fetch_sub(1, Ordering::Relaxed);
+    }
+}
+
+// Ids are never reused, so a worker finishing after a restart can't fill in a newer job.
+static NEXT_JOB_ID: AtomicU32 = AtomicU32::new(1);
+
+fn context() -> std::sync::MutexGuard<'static, Option<JobContext>> {
+    match CONTEXT.lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    }
+}
+
+fn engine() -> anyhow::Result<&'static Engine> {
+    if let Some(engine) = ENGINE.get() {
+        return Ok(engine);
+    }
+    let mut cfg = WasmtimeRuntime::config();
+    cfg.epoch_interruption(true);
+    let engine = Engine::new(&cfg)?;
+    let engine = ENGINE.get_or_init(|| engine);
+    TICKER.get_or_init(|| std::thread::spawn(tick).thread().clone());
+    Ok(engine)
+}
+
+/// Ticker thread: bump the epoch every `TICK` while any worker is alive, park otherwise.
+fn tick() {
+    loop {
+        if LIVE_WORKERS.load(Ordering::Relaxed) == 0 {
+            std::thread::park();
+            continue;
+        }
+        std::thread::sleep(TICK);
+        interrupt();
+    }
+}
+
+/// Make the cart in `data` available to workers; called once `cart` (compiled from the same
+/// bytes for the main instance) has loaded. Workers need an engine with epoch interruption, so
+/// the cart is compiled again for it, but only if it can spawn jobs at all.
+pub fn set_module(cart: &Module, data: &[u8]) -> anyhow::Result<()> {
+    clear_module();
+    let spawns_jobs = cart
+        .imports()
+        .any(|i| i.module() == IMPORT_MODULE && i.name() == host_imports::SYSTEM_JOB_SPAWN);
+    if !spawns_jobs {
+        return Ok(());
+    }
+    let engine = engine()?;
+    let module = loader::compile_module(engine, data)?;
+    let mut linker = Linker::new(engine);
+    define_worker_imports(&mut linker)?;
+    linker.define_unknown_imports_as_traps(&module)?;
+    *context() = Some(JobContext {
+        module,
+        linker: Arc::new(linker),
+    });
+    Ok(())
+}
+
+/// Forget the cart module and every job, stopping their workers.
+pub fn clear_module() {
+    *context() = None;
+    global().lock().unwrap().jobs.clear();
+    interrupt();
+}
+
+/// Have running workers check whether their job is still in the table, and stop if it isn't.
+/// Call after jobs have been dropped (`free`, a cart restart).
+pub fn interrupt() {
+    if let Some(engine) = ENGINE.get() {
+        engine.increment_epoch();
+    }
+}
+
+fn define_worker_imports(linker: &mut Linker<JobData>) -> anyhow::Result<()> {
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_INPUT_LEN,
+        |caller: Caller<'_, JobData>| -> u32 { caller.data().input.len() as u32 },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_INPUT_READ,
+        |mut caller: Caller<'_, JobData>, ptr: u32, len: u32| -> u32 {
+            let input = std::mem::take(&mut caller.data_mut().input);
+            let n = input.len().min(len as usize);
+            let written = write_guest_bytes(&mut caller, ptr, &input[..n]).is_ok();
+            caller.data_mut().input = input;
+            if written { n as u32 } else { 0 }
+        },
+    )?;
+
+    linker.func_wrap(
+        IMPORT_MODULE,
+        host_imports::SYSTEM_JOB_OUTPUT_WRITE,
+        |mut caller: Caller<'_, JobData>, ptr: u32, len: u32| -> u32 {
+            match read_guest_bytes(&mut caller, ptr, len) {
+                Ok(bytes) => {
+                    caller.data_mut().output.extend_from_slice(&bytes);
+                    1
+                }
+                Err(_) => 0,
+            }
+        },
+    )?;
+    Ok(())
+}
+
+/// Run the cart's `export` on a worker with argument `arg` and the given input bytes.
+pub fn spawn(export: &str, arg: u32, input: Vec<u8>) -> u32 {
+    let Some((module, linker)) = context()
+        .as_ref()
+        .map(|c| (c.module.clone(), Arc::clone(&c.linker)))
+    else {
+        return 0;
+    };
+    if module.get_export(export).is_none() {
+        return 0;
+    }
+
+    let id = {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let admitted = LIVE_WORKERS.fetch_update(Ordering::Relaxed, Ordering::Relaxed, |n| {
+            (n < MAX_RUNNING_JOBS).then_some(n + 1)
+        });
+        if admitted.is_err() {
+            return 0;
+        }
+        if let Some(ticker) = TICKER.get() {
+            ticker.unpark();
+        }
+        let id = NEXT_JOB_ID.fetch_add(1, Ordering::Relaxed).max(1);
+        s.jobs.insert(
+            id,
+            Job {
+                phase: JobPhase::Running,
+                result: 0,
+                output: Vec::new(),
+            },
+        );
+        id
+    };
+
+    let export = export.to_string();
+    std::thread::spawn(move || {
+        let _live = LiveWorker;
+        let mut store = Store::new(
+            module.engine(),
+            JobData {
+                input,
+                output: Vec::new(),
+                limits: GuestLimits::default(),
+            },
+        );
+        store.limiter(|data| &mut data.limits);
+        // Every epoch bump, carry on only while the job is still wanted.
+        store.set_epoch_deadline(1);
+        store.epoch_deadline_callback(move |_| {
+            let s = match global().lock() {
+                Ok(g) => g,
+                Err(poisoned) => poisoned.into_inner(),
+            };
+            if s.jobs.contains_key(&id) {
+                Ok(UpdateDeadline::Continue(1))
+            } else {
+                Err(anyhow::anyhow!("job {id} was freed"))
+            }
+        });
+        let outcome = run(&mut store, &linker, &module, &export, arg);
+        let output = std::mem::take(&mut store.data_mut().output);
+
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        // The guest may have freed the job (or the cart unloaded) while it ran.
+        if let Some(job) = s.jobs.get_mut(&id) {
+            match outcome {
+                Ok(result) => {
+                    job.phase = JobPhase::Done;
+                    job.result = result;
+                    job.output = output;
+                }
+                Err(_) => job.phase = JobPhase::Failed,
+            }
+        }
+    });
+
+    id
+}
+
+fn run(
+    store: &mut Store<JobData>,
+    linker: &Linker<JobData>,
+    module: &Module,
+    export: &str,
+    arg: u32,
+) -> anyhow::Result<u32> {
+    let instance = linker.instantiate(&mut *store, module)?;
+    if let Ok(init) = instance.get_typed_func::<(), ()>(&mut *store, "_initialize") {
+        init.call(&mut *store, ())?;
+    }
+    if let Ok(job) = instance.get_typed_func::<u32, u32>(&mut *store, export) {
+        return job.call(&mut *store, arg);
+    }
+    let job = instance.get_typed_func::<u32, ()>(&mut *store, export)?;
+    job.call(&mut *store, arg)?;
+    Ok(0)
+}
+
+/// Guest import: spawn the export named at `name_ptr` with `arg` and the input at `data_ptr`.
+/// Returns the job id, or 0 if the export doesn't exist, too many jobs are running, or guest
+/// memory can't be read.
+pub fn spawn_guest(
+    caller: &mut Caller<'_, GuestLimits>,
+    name_ptr: u32,
+    name_len: u32,
+    arg: u32,
+    data_ptr: u32,
+    data_len: u32,
+) -> u32 {
+    if data_len > MAX_JOB_INPUT {
+        return 0;
+    }
+    let Ok(name) = read_guest_bytes(caller, name_ptr, name_len) else {
+        return 0;
+    };
+    let Ok(name) = String::from_utf8(name) else {
+        return 0;
+    };
+    let Ok(input) = read_guest_bytes(caller, data_ptr, data_len) else {
+        return 0;
+    };
+    spawn(&name, arg, input)
+}
+
+/// Status of a job: 0 = unknown id, 1 = running, 2 = done, 3 = failed (trapped or the export
+/// has the wrong signature).
+pub fn status(id: u32) -> u32 {
+    let s = global().lock().unwrap();
+    match s.jobs.get(&id).map(|j| j.phase) {
+        None => 0,
+        Some(JobPhase::Running) => 1,
+        Some(JobPhase::Done) => 2,
+        Some(JobPhase::Failed) => 3,
+    }
+}
+
+/// The value a finished job's export returned (0 if it returned nothing or isn't done).
+pub fn result(id: u32) -> u32 {
+    let s = global().lock().unwrap();
+    s.jobs.get(&id).map_or(0, |j| j.result)
+}
+
+/// Blob id of the bytes a finished job wrote (0 if none or not done). The output is handed
+/// over once.
+pub fn output(id: u32) -> u32 {
+    let output = {
+        let mut s = global().lock().unwrap();
+        match s.jobs.get_mut(&id) {
+            Some(job) if job.phase == JobPhase::Done && !job.output.is_empty() => {
+                std::mem::take(&mut job.output)
+            }
+            _ => return 0,
+        }
+    };
+    super::blobs::store(output)
+}
+
+/// Forget a job. A job still running is stopped.
+pub fn free(id: u32) {
+    let removed = global().lock().unwrap().jobs.remove(&id);
+    if removed.is_some_and(|job| job.phase == JobPhase::Running) {
+        interrupt();
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    // The module context and worker count are process-wide.
+    static SERIAL: Mutex<()> = Mutex::new(());
+
+    fn serial() -> std::sync::MutexGuard<'static, ()> {
+        match SERIAL.lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        }
+    }
+
+    fn wait(id: u32) -> u32 {
+        for _ in 0..500 {
+            match status(id) {
+                1 => std::thread::sleep(std::time::Duration::from_millis(10)),
+                other => return other,
+            }
+        }
+        panic!("job {id} never finished");
+    }
+
+    #[test]
+    fn jobs_run_on_workers_and_only_get_job_imports() {
+        let _serial = serial();
+        let wat = r#"(module
+            (import "env" "wasm96_system_job_spawn" (func (param i32 i32 i32 i32 i32) (result i32)))
+            (import "env" "wasm96_system_job_input_len" (func $len (result i32)))
+            (import "env" "wasm96_system_job_input_read" (func $read (param i32 i32) (result i32)))
+            (import "env" "wasm96_system_job_output_write" (func $write (param i32 i32) (result i32)))
+            (import "env" "wasm96_graphics_set_size" (func $size (param i32 i32)))
+            (memory (export "memory") 1)
+            (func (export "double") (param $arg i32) (result i32)
+                (drop (call $read (i32.const 0) (call $len)))
+                (drop (call $write (i32.const 0) (call $len)))
+                (i32.mul (local.get $arg) (i32.const 2)))
+            (func (export "draw") (param i32)
+                (call $size (i32.const 1) (i32.const 1))))"#;
+        let engine = Engine::default();
+        let module = Module::new(&engine, wat::parse_str(wat).unwrap()).unwrap();
+        set_module(&module, wat.as_bytes()).unwrap();
+
+        let id = spawn("double", 21, b"echo".to_vec());
+        assert_eq!(wait(id), 2);
+        assert_eq!(result(id), 42);
+        let blob = output(id);
+        assert_eq!(
+            global().lock().unwrap().blobs.blobs.get(&blob).unwrap(),
+            b"echo"
+        );
+        free(id);
+        assert_eq!(status(id), 0);
+
+        let id = spawn("draw", 0, Vec::new());
+        assert_eq!(wait(id), 3);
+        assert_eq!(spawn("missing", 0, Vec::new()), 0);
+        clear_module();
+    }
+
+    fn wait_for_no_workers() {
+        for _ in 0..500 {
+            if LIVE_WORKERS.load(Ordering::Relaxed) == 0 {
+                return;
+            }
+            std::thread::sleep(std::time::Duration::from_millis(10));
+        }
+        panic!(
+            "{} workers still running",
+            LIVE_WORKERS.load(Ordering::Relaxed)
+        );
+    }
+
+    #[test]
+    fn freeing_or_unloading_stops_workers() {
+        let _serial = serial();
+        let wat = r#"(module
+            (import "env" "wasm96_system_job_spawn" (func (param i32 i32 i32 i32 i32) (result i32)))
+            (func (export "spin") (param i32)
+                (loop $forever (br $forever))))"#;
+        let engine = Engine::default();
+        let module = Module::new(&engine, wat::parse_str(wat).unwrap()).unwrap();
+        set_module(&module, wat.as_bytes()).unwrap();
+
+        // Far more spawn/free rounds than the worker cap: each free has to end its thread.
+        for _ in 0..MAX_RUNNING_JOBS * 4 {
+            let id = spawn("spin", 0, Vec::new());
+            assert_ne!(id, 0, "freed jobs still count against the cap");
+            free(id);
+            wait_for_no_workers();
+        }
+
+        // A full set of workers blocks further spawns until unload stops them.
+        let ids: Vec<u32> = (0..MAX_RUNNING_JOBS)
+            .map(|_| spawn("spin", 0, Vec::new()))
+            .collect();
+        assert!(ids.iter().all(|&id| id != 0));
+        assert_eq!(spawn("spin", 0, Vec::new()), 0);
+        clear_module();
+        wait_for_no_workers();
+        assert!(ids.iter().all(|&id| status(id) == 0));
+    }
+
+    #[test]
+    fn carts_without_jobs_skip_the_worker_build() {
+        let _serial = serial();
+        let wat = r#"(module (func (export "spin") (param i32)))"#;
+        let engine = Engine::default();
+        let module = Module::new(&engine, wat::parse_str(wat).unwrap()).unwrap();
+        set_module(&module, wat.as_bytes()).unwrap();
+        assert_eq!(spawn("spin", 0, Vec::new()), 0);
+    }
+}
@@ -0,0 +1,117 @@
+//! Pause and resume signals for the guest's `on_pause` / `on_resume` hooks.
+//!
+//! libretro has no pause callback, so the two ways a frontend pauses are tracked separately:
+//! - Frame stepping: a paused frontend that still advances single frames reports
+//!   `RETRO_THROTTLE_FRAME_STEPPING` (`RETRO_ENVIRONMENT_GET_THROTTLE_STATE`, read on every
+//!   `retro_run`). The first stepped frame calls `on_pause` and the first normal frame after it
+//!   `on_resume`, so the guest runs, and can show its pause menu, while paused.
+//! - Absence: most frontends simply stop calling `retro_run` while their menu is open or the
+//!   window is unfocused, and nothing of the guest can run then. When frames come back after at
+//!   least [`ABSENCE_MILLIS`] without one, only `on_resume` is called. The gap is measured from
+//!   the end of the previous host frame, so a slow frame of the cart's own doesn't count.
+//!
+//! Quitting needs no detection: `retro_unload_game` runs `on_quit` (see `Wasm96Core::unload`).
+
+use std::os::raw::c_uint;
+use std::time::{Duration, Instant};
+
+use crate::state::{self, TimingState};
+
+/// libretro's `RETRO_ENVIRONMENT_GET_THROTTLE_STATE` (experimental in libretro.h).
+pub const ENVIRONMENT_GET_THROTTLE_STATE: c_uint = 71 | 0x10000;
+
+/// libretro's `RETRO_THROTTLE_FRAME_STEPPING`: the frontend is paused and steps single frames.
+pub const THROTTLE_FRAME_STEPPING: c_uint = 1;
+
+/// libretro's `retro_throttle_state`.
+#[repr(C)]
+#[derive(Debug, Default)]
+pub struct ThrottleState {
+    pub mode: c_uint,
+    pub rate: f32,
+}
+
+/// Time without host frames after which the frontend is taken to have stopped the core.
+pub const ABSENCE_MILLIS: u64 = 500;
+
+/// A lifecycle hook to call at the start of a host frame.
+#[derive(Debug, Clone, Copy, PartialEq, Eq)]
+pub enum Hook {
+    Pause,
+    Resume,
+}
+
+/// Record whether the frontend reports frame stepping for the coming host frame.
+pub fn set_frame_stepping(stepping: bool) {
+    let mut s = state::global().lock().unwrap();
+    s.timing.frame_stepping = stepping;
+}
+
+/// The hook due at the start of the current host frame, if any. Called before `begin_frame`.
+pub fn begin_host_frame() -> Option<Hook> {
+    let mut s = state::global().lock().unwrap();
+    hook_due(&mut s.timing, Instant::now())
+}
+
+/// Note that the current host frame is done; absence is measured from here.
+pub fn end_host_frame() {
+    let mut s = state::global().lock().unwrap();
+    s.timing.last_host_frame_end = Some(Instant::now());
+}
+
+fn hook_due(timing: &mut TimingState, now: Instant) -> Option<Hook> {
+    let was_paused = std::mem::replace(&mut timing.paused, timing.frame_stepping);
+    let gap = timing
+        .last_host_frame_end
+        .map(|t| now.saturating_duration_since(t));
+    let absent = gap.is_some_and(|gap| gap >= Duration::from_millis(ABSENCE_MILLIS));
+    match (was_paused, timing.paused) {
+        (false, true) => Some(Hook::Pause),
+        (true, false) => Some(Hook::Resume),
+        (false, false) if absent => Some(Hook::Resume),
+        _ => None,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn frame(timing: &mut TimingState, stepping: bool, at: Instant) -> Option<Hook> {
+        timing.frame_stepping = stepping;
+        let hook = hook_due(timing, at);
+        timing.last_host_frame_end = Some(at);
+        hook
+    }
+
+    #[test]
+    fn frame_stepping_pauses_until_normal_frames_return() {
+        let mut t = TimingState::default();
+        let start = Instant::now();
+        let at = |ms| start + Duration::from_millis(ms);
+
+        assert_eq!(frame(&mut t, false, at(0)), None);
+        assert_eq!(frame(&mut t, true, at(16)), Some(Hook::Pause));
+        // Stepping slowly through a paused game is not a second pause or a resume.
+        assert_eq!(frame(&mut t, true, at(2_000)), None);
+        assert_eq!(frame(&mut t, false, at(2_016)), Some(Hook::Resume));
+        assert_eq!(frame(&mut t, false, at(2_032)), None);
+    }
+
+    #[test]
+    fn only_a_long_absence_resumes() {
+        let mut t = TimingState::default();
+        let start = Instant::now();
+        let at = |ms| start + Duration::from_millis(ms);
+
+        assert_eq!(frame(&mut t, false, at(0)), None);
+        // The previous frame ran long itself; only the time between frames counts.
+        t.last_host_frame_end = Some(at(900));
+        assert_eq!(frame(&mut t, false, at(916)), None);
+        assert_eq!(
+            frame(&mut t, false, at(916 + ABSENCE_MILLIS)),
+            Some(Hook::Resume)
+        );
+        assert_eq!(frame(&mut t, false, at(932 + ABSENCE_MILLIS)), None);
+    }
+}
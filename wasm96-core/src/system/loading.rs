@@ -0,0 +1,140 @@
+//! Asynchronous asset loading, so big decodes don't freeze the first frame.
+//!
+//! Async imports (`wasm96_graphics_image_register_async`, `wasm96_audio_sound_pool_create_async`)
+//! copy the encoded bytes, return a load handle at once and decode on a worker thread. Finished
+//! decodes are installed at the start of the next tick, so a resource never appears halfway
+//! through `update` or `draw`.
+//!
+//! The guest polls a handle with `wasm96_system_load_status` and drives a loading screen with
+//! `wasm96_system_load_progress`. Progress covers the current batch: every load started since
+//! the last moment nothing was pending.
+
+use crate::av::resources::{ImageResource, RESOURCES};
+use crate::state::{GlobalState, LoadPhase, global};
+
+/// A decoded asset waiting to be installed.
+pub enum Decoded {
+    /// RGBA image to register under a keyed image `key`.
+    Image { key: u64, image: ImageResource },
+    /// Interleaved stereo PCM for the sound pool whose handle is the load handle.
+    Sound { pcm: Vec<i16>, sample_rate: u32 },
+}
+
+/// Start tracking a load and return its handle. `taken` rejects handles that are already used
+/// elsewhere (sound pools share their handle with their load).
+pub fn begin(s: &mut GlobalState, taken: impl Fn(&GlobalState, u32) -> bool) -> u32 {
+    let id = loop {
+        s.loading.next_id = s.loading.next_id.wrapping_add(1).max(1);
+        let id = s.loading.next_id;
+        if !s.loading.loads.contains_key(&id) && !taken(s, id) {
+            break id;
+        }
+    };
+    let loading = &mut s.loading;
+    if loading.batch_done >= loading.batch_total {
+        loading.batch_total = 0;
+        loading.batch_done = 0;
+    }
+    loading.batch_total += 1;
+    loading.loads.insert(id, LoadPhase::Pending);
+    id
+}
+
+/// Decode on a worker thread; the result is installed by `install_finished`. A `None` result
+/// marks the load failed.
+pub fn spawn(id: u32, decode: impl FnOnce() -> Option<Decoded> + Send + 'static) {
+    std::thread::spawn(move || {
+        let decoded = decode();
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        // The cart may have unloaded or restarted while we were decoding.
+        let Some(phase @ LoadPhase::Pending) = s.loading.loads.get_mut(&id) else {
+            return;
+        };
+        match decoded {
+            Some(decoded) => *phase = LoadPhase::Decoded(decoded),
+            None => {
+                *phase = LoadPhase::Failed;
+                s.loading.batch_done += 1;
+            }
+        }
+    });
+}
+
+/// Install every finished decode. Called once per tick, before `update`.
+pub fn install_finished() {
+    let mut images = Vec::new();
+    {
+        let mut s = match global().lock() {
+            Ok(g) => g,
+            Err(poisoned) => poisoned.into_inner(),
+        };
+        let s = &mut *s;
+        for (&id, phase) in s.loading.loads.iter_mut() {
+            if !matches!(phase, LoadPhase::Decoded(_)) {
+                continue;
+            }
+            let LoadPhase::Decoded(decoded) = std::mem::replace(phase, LoadPhase::Ready) else {
+                unreachable!();
+            };
+            s.loading.batch_done += 1;
+            match decoded {
+                Decoded::Image { key, image } => images.push((key, image)),
+                // A pool destroyed while loading just drops its sound.
+                Decoded::Sound { pcm, sample_rate } => {
+                    if let Some(pool) = s.audio.sound_pools.get_mut(&id) {
+                        pool.set_pcm(pcm, sample_rate);
+                    }
+                }
+            }
+        }
+    }
+    if !images.is_empty() {
+        let mut res = RESOURCES.lock().unwrap();
+        res.keyed_images.extend(images);
+    }
+}
+
+/// Status of a load: 0 = unknown handle, 1 = pending, 2 = ready, 3 = failed.
+pub fn load_status(id: u32) -> u32 {
+    let s = global().lock().unwrap();
+    match s.loading.loads.get(&id) {
+        None => 0,
+        Some(LoadPhase::Pending | LoadPhase::Decoded(_)) => 1,
+        Some(LoadPhase::Ready) => 2,
+        Some(LoadPhase::Failed) => 3,
+    }
+}
+
+/// Fraction of the current batch of loads that has finished (ready or failed), `0.0..=1.0`.
+/// 1.0 when nothing is loading.
+pub fn load_progress() -> f32 {
+    let s = global().lock().unwrap();
+    let loading = &s.loading;
+    if loading.batch_total == 0 {
+        return 1.0;
+    }
+    loading.batch_done as f32 / loading.batch_total as f32
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn progress_tracks_the_current_batch() {
+        let mut s = GlobalState::default();
+        let a = begin(&mut s, |_, _| false);
+        let b = begin(&mut s, |_, id| id == 2);
+        assert_eq!((a, b), (1, 3));
+        assert_eq!((s.loading.batch_done, s.loading.batch_total), (0, 2));
+
+        s.loading.loads.insert(a, LoadPhase::Ready);
+        s.loading.batch_done = 2;
+        // Everything finished: the next load starts a fresh batch.
+        begin(&mut s, |_, _| false);
+        assert_eq!((s.loading.batch_done, s.loading.batch_total), (0, 1));
+    }
+}
@@ -0,0 +1,105 @@
+//! The player's language, as a BCP-47 tag (`"en-US"`, `"pt-BR"`, `"ja"`).
+//!
+//! The `WASM96_LOCALE` environment variable wins when it's set. Otherwise the core uses the
+//! frontend's user language (`RETRO_ENVIRONMENT_GET_LANGUAGE`, read when a cart loads), then the
+//! host's POSIX locale (`LC_ALL`, `LC_MESSAGES`, `LANG`), and finally `"en"`. POSIX names like
+//! `pt_BR.UTF-8` are rewritten as tags.
+
+use std::sync::Mutex;
+
+/// Environment variable overriding the locale.
+pub const LOCALE_ENV: &str = "WASM96_LOCALE";
+
+/// Locale used when nothing else names one.
+pub const DEFAULT_LOCALE: &str = "en";
+
+/// Tags for libretro's `enum retro_language`, by value.
+const LANGUAGES: [&str; 28] = [
+    "en", "ja", "fr", "es", "de", "it", "nl", "pt-BR", "pt-PT", "ru", "ko", "zh-Hant", "zh-Hans",
+    "eo", "pl", "vi", "ar", "el", "tr", "sk", "fa", "he", "ast", "fi", "id", "sv", "uk", "cs",
+];
+
+/// The frontend's language, once it has been asked.
+static FRONTEND_LANGUAGE: Mutex<Option<&'static str>> = Mutex::new(None);
+
+/// Remember the frontend's `retro_language` value (or forget it with `None`). Values the core
+/// doesn't know are treated as unset.
+pub fn set_frontend_language(language: Option<u32>) {
+    let tag = language.and_then(|l| LANGUAGES.get(l as usize).copied());
+    let mut slot = match FRONTEND_LANGUAGE.lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    *slot = tag;
+}
+
+/// Rewrite a locale name as a BCP-47 tag: `de_AT.UTF-8@euro` becomes `de-AT`. `None` for empty
+/// names and the `C`/`POSIX` locales.
+pub fn normalize(name: &str) -> Option<String> {
+    let name = name.trim();
+    let name = name.split(['.', '@']).next().unwrap_or("");
+    if name.is_empty() || name == "C" || name == "POSIX" {
+        return None;
+    }
+    let mut parts = name.split(['_', '-']).filter(|p| !p.is_empty());
+    let language = parts.next()?;
+    if !language.chars().all(|c| c.is_ascii_alphabetic()) {
+        return None;
+    }
+    let mut tag = language.to_ascii_lowercase();
+    for part in parts {
+        if !part.chars().all(|c| c.is_ascii_alphanumeric()) {
+            return None;
+        }
+        tag.push('-');
+        // Regions are upper case and scripts title case; anything else stays as given.
+        match part.len() {
+            2 => tag.push_str(&part.to_ascii_uppercase()),
+            4 => {
+                tag.push_str(&part[..1].to_ascii_uppercase());
+                tag.push_str(&part[1..].to_ascii_lowercase());
+            }
+            _ => tag.push_str(part),
+        }
+    }
+    Some(tag)
+}
+
+/// The player's locale, following the order in the module docs.
+pub fn locale() -> String {
+    let env = |key: &str| std::env::var(key).ok().and_then(|v| normalize(&v));
+    if let Some(tag) = env(LOCALE_ENV) {
+        return tag;
+    }
+    let frontend = match FRONTEND_LANGUAGE.lock() {
+        Ok(g) => *g,
+        Err(poisoned) => *poisoned.into_inner(),
+    };
+    if let Some(tag) = frontend {
+        return tag.to_string();
+    }
+    ["LC_ALL", "LC_MESSAGES", "LANG"]
+        .into_iter()
+        .find_map(env)
+        .unwrap_or_else(|| DEFAULT_LOCALE.to_string())
+}
+
+/// Guest import: the locale as a blob id.
+pub fn locale_guest() -> u32 {
+    super::blobs::store(locale().into_bytes())
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn normalizes_posix_names() {
+        assert_eq!(normalize("pt_BR.UTF-8").as_deref(), Some("pt-BR"));
+        assert_eq!(normalize("de_AT@euro").as_deref(), Some("de-AT"));
+        assert_eq!(normalize("zh-hant-tw").as_deref(), Some("zh-Hant-TW"));
+        assert_eq!(normalize("FR").as_deref(), Some("fr"));
+        assert_eq!(normalize("C.UTF-8"), None);
+        assert_eq!(normalize(""), None);
+    }
+}
@@ -0,0 +1,141 @@
+//! Leveled guest logging.
+//!
+//! Messages go to the frontend's log interface (`RETRO_ENVIRONMENT_GET_LOG_INTERFACE`) when it
+//! provides one, so they land in RetroArch's log with the matching severity. Otherwise they are
+//! printed to stdout (debug/info) or stderr (warn/error).
+
+use std::ffi::CString;
+use std::os::raw::{c_char, c_uint};
+use std::sync::Mutex;
+
+use crate::state;
+
+pub const LEVEL_DEBUG: u32 = 0;
+pub const LEVEL_INFO: u32 = 1;
+pub const LEVEL_WARN: u32 = 2;
+pub const LEVEL_ERROR: u32 = 3;
+
+/// libretro's `retro_log_printf_t`. Levels use the same numbering as ours.
+pub type HostLogFn = unsafe extern "C" fn(level: c_uint, fmt: *const c_char, ...);
+
+/// libretro's `struct retro_log_callback`.
+#[repr(C)]
+pub struct HostLogCallback {
+    pub log: Option<HostLogFn>,
+}
+
+// Fetched once in `retro_set_environment`; unlike the per-game callbacks it outlives unloads.
+static HOST_LOG: Mutex<Option<HostLogFn>> = Mutex::new(None);
+
+/// Remember the frontend's log function (or forget it with `None`).
+pub fn set_host_log(log: Option<HostLogFn>) {
+    let mut slot = match HOST_LOG.lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    *slot = log;
+}
+
+fn level_name(level: u32) -> &'static str {
+    match level {
+        LEVEL_DEBUG => "DEBUG",
+        LEVEL_INFO => "INFO",
+        LEVEL_WARN => "WARN",
+        _ => "ERROR",
+    }
+}
+
+/// Drop messages below `level`. Levels above error are clamped.
+pub fn set_log_level(level: u32) {
+    let mut s = state::global().lock().unwrap();
+    s.log.min_level = level.min(LEVEL_ERROR);
+}
+
+/// Whether a message at `level` passes a filter of `min_level`. Unknown levels count as errors.
+pub fn passes(min_level: u32, level: u32) -> bool {
+    level.min(LEVEL_ERROR) >= min_level.min(LEVEL_ERROR)
+}
+
+/// Whether a message at `level` passes the guest's filter.
+pub fn enabled(level: u32) -> bool {
+    let s = match state::global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    passes(s.log.min_level, level)
+}
+
+/// Log a guest message at `level`, subject to the filter.
+pub fn log(level: u32, msg: &str) {
+    let level = level.min(LEVEL_ERROR);
+    if !enabled(level) {
+        return;
+    }
+
+    let host = match HOST_LOG.lock() {
+        Ok(g) => *g,
+        Err(poisoned) => *poisoned.into_inner(),
+    };
+    if let Some(host) = host {
+        // Interior NULs would truncate the C string; drop them rather than the whole message.
+        let Ok(text) = CString::new(msg.replace('\0', "")) else {
+            return;
+        };
+        unsafe { host(level, c"[wasm96] %s\n".as_ptr(), text.as_ptr()) };
+        return;
+    }
+
+    if level >= LEVEL_WARN {
+        eprintln!("[wasm96] {}: {msg}", level_name(level));
+    } else {
+        println!("[wasm96] {}: {msg}", level_name(level));
+    }
+}
+
+/// Format a guest-reported error (typically from a panic hook) for the log.
+pub fn format_error_report(msg: &str, stack: &str) -> String {
+    let stack = stack.trim_end();
+    if stack.is_empty() {
+        format!("guest error: {msg}")
+    } else {
+        format!("guest error: {msg}\n{stack}")
+    }
+}
+
+/// Log a guest-reported error. Errors always pass the filter.
+pub fn report_error(msg: &str, stack: &str) {
+    log(LEVEL_ERROR, &format_error_report(msg, stack));
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn filter_drops_lower_levels() {
+        assert!(passes(LEVEL_DEBUG, LEVEL_DEBUG));
+
+        assert!(!passes(LEVEL_WARN, LEVEL_DEBUG));
+        assert!(!passes(LEVEL_WARN, LEVEL_INFO));
+        assert!(passes(LEVEL_WARN, LEVEL_WARN));
+        assert!(passes(LEVEL_WARN, LEVEL_ERROR));
+        // Unknown levels count as errors.
+        assert!(passes(LEVEL_ERROR, 9));
+    }
+
+    #[test]
+    fn error_report_includes_stack_when_present() {
+        assert_eq!(format_error_report("boom", ""), "guest error: boom");
+        assert_eq!(format_error_report("boom", "  \n"), "guest error: boom");
+        assert_eq!(
+            format_error_report("boom", "at src/lib.rs:10:5\n"),
+            "guest error: boom\nat src/lib.rs:10:5"
+        );
+    }
+
+    #[test]
+    fn out_of_range_filter_is_clamped() {
+        assert!(passes(42, LEVEL_ERROR));
+        assert!(!passes(42, LEVEL_WARN));
+    }
+}
@@ -0,0 +1,372 @@
+//! System module for wasm96-core.
+//!
+//! Responsibilities:
+//! - Frame timing: delta time between guest ticks, optional target-FPS pacing, measured FPS.
+//! - Randomness: a host PRNG seeded from OS entropy, plus fresh seeds for guest-side generators.
+//! - Blobs: host-produced byte buffers handed to the guest by id (`blobs`).
+//! - Capture: PNG screenshots and GIF recording of the framebuffer (`capture`).
+//! - Logging: leveled guest messages routed to the frontend's log (`log`).
+//! - Save states: guest memory + host state snapshots for quick-save, rewind and the
+//!   frontend's save states (`savestate`).
+//! - Clipboard: text read/write behind the `WASM96_CLIPBOARD` permission (`clipboard`).
+//! - Cart info: metadata from the cart's custom section and launch parameters (`cart`).
+//! - Clock: wall-clock Unix time and the player's UTC offset (`clock`).
+//! - Locale: the player's language as a BCP-47 tag, for localized text (`locale`).
+//! - Stats: draw calls, timings and memory use of the last tick, for profiling (`stats`).
+//! - Accessibility: the player's reduce-flashing, contrast, text-scale and color-blind
+//!   preferences from the core options (`accessibility`).
+//! - Loading: background asset decodes with per-handle status and batch progress (`loading`).
+//! - Jobs: guest exports run on worker instances in parallel with the cart (`jobs`).
+//! - Achievements: unlocks and progress shown as frontend notifications (`achievements`).
+//! - Hot reload: the cart file swapped in when it changes, during development (`reload`).
+//! - Lifecycle: when the frontend pauses and resumes, for the guest's hooks (`lifecycle`).
+//!
+//! The frontend calls `retro_run` at a fixed rate (60 Hz by default). Guests that want a lower
+//! tick rate call `wasm96_system_set_target_fps`; the core then skips guest `update`/`draw` on
+//! host frames where a tick is not yet due and re-presents the previous framebuffer.
+//!
+//! A tick is normally one `update` and one `draw`. Guests that want fixed-step simulation call
+//! `wasm96_system_set_update_rate`; each tick then runs as many `update`s as are due at that
+//! rate (none, one or several) before its `draw`, and `wasm96_system_interpolation_alpha` says
+//! how far `draw` is between the last `update` and the next.
+
+pub mod accessibility;
+pub mod achievements;
+pub mod blobs;
+pub mod capture;
+pub mod cart;
+pub mod clipboard;
+pub mod clock;
+pub mod jobs;
+pub mod lifecycle;
+pub mod loading;
+pub mod locale;
+pub mod log;
+pub mod reload;
+pub mod savestate;
+pub mod stats;
+
+use std::collections::hash_map::RandomState;
+use std::hash::{BuildHasher, Hasher};
+use std::time::{Duration, Instant, SystemTime, UNIX_EPOCH};
+
+use crate::state::{self, RngState, TimingState};
+
+/// Upper bound on a reported frame delta.
+///
+/// A stall (debugger, window drag, slow asset decode) would otherwise hand the guest one huge
+/// step and break variable-timestep physics.
+pub const MAX_DELTA_MILLIS: u64 = 250;
+
+/// Most fixed-rate `update`s run in one tick. Time owed beyond this after a stall is dropped,
+/// so a slow `update` can't fall further behind each tick.
+pub const MAX_UPDATES_PER_TICK: u32 = 8;
+
+impl TimingState {
+    /// Advance timing for one host frame at `now`.
+    ///
+    /// Returns `true` if the guest should tick (`update` + `draw`) this frame.
+    pub fn advance(&mut self, now: Instant) -> bool {
+        let host_elapsed = self
+            .last_host_frame
+            .map(|t| now.saturating_duration_since(t))
+            .unwrap_or_default();
+        self.last_host_frame = Some(now);
+
+        if self.target_fps != 0 {
+            let interval = 1_000_000 / self.target_fps as u64;
+            self.accumulator_micros = self
+                .accumulator_micros
+                .saturating_add(host_elapsed.as_micros() as u64);
+
+            // Always tick on the very first frame so `draw` runs at least once.
+            if self.last_tick.is_some() && self.accumulator_micros < interval {
+                return false;
+            }
+
+            // Never carry more than one interval of debt, so a stall doesn't cause a burst.
+            self.accumulator_micros =
+                (self.accumulator_micros.saturating_sub(interval)).min(interval);
+        }
+
+        let tick_elapsed = self
+            .last_tick
+            .map(|t| now.saturating_duration_since(t))
+            .unwrap_or_default()
+            .min(Duration::from_millis(MAX_DELTA_MILLIS));
+        self.delta_millis = tick_elapsed.as_millis() as u64;
+        let first_tick = self.last_tick.is_none();
+        self.last_tick = Some(now);
+        self.schedule_updates(tick_elapsed, first_tick);
+
+        // FPS is measured in guest ticks over one-second windows.
+        let window_start = *self.fps_window_start.get_or_insert(now);
+        self.fps_window_ticks += 1;
+        if now.saturating_duration_since(window_start) >= Duration::from_secs(1) {
+            self.measured_fps = self.fps_window_ticks;
+            self.fps_window_ticks = 0;
+            self.fps_window_start = Some(now);
+        }
+
+        true
+    }
+
+    /// Work out the `update`s due in a tick `elapsed` after the previous one.
+    fn schedule_updates(&mut self, elapsed: Duration, first_tick: bool) {
+        if self.update_rate == 0 {
+            self.updates_due = 1;
+            self.interpolation_alpha = 1.0;
+            return;
+        }
+        let interval = 1_000_000 / self.update_rate as u64;
+        if first_tick {
+            // Update once before the first draw so it has a state to show.
+            self.updates_due = 1;
+            self.update_accumulator_micros = 0;
+        } else {
+            self.update_accumulator_micros = self
+                .update_accumulator_micros
+                .saturating_add(elapsed.as_micros() as u64);
+            let due = self.update_accumulator_micros / interval;
+            if due > MAX_UPDATES_PER_TICK as u64 {
+                self.updates_due = MAX_UPDATES_PER_TICK;
+                self.update_accumulator_micros = 0;
+            } else {
+                self.updates_due = due as u32;
+                self.update_accumulator_micros -= due * interval;
+            }
+        }
+        self.interpolation_alpha = self.update_accumulator_micros as f32 / interval as f32;
+    }
+}
+
+/// Called by the core once per host frame. Returns whether the guest should tick.
+pub fn begin_frame() -> bool {
+    let mut s = match state::global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.timing.advance(Instant::now())
+}
+
+/// Guest import: restart the cart once the current tick returns.
+pub fn request_reset() {
+    let mut s = state::global().lock().unwrap();
+    s.pending_reset = true;
+}
+
+/// Guest import: ask the frontend to shut down once the current tick returns.
+pub fn request_quit() {
+    let mut s = state::global().lock().unwrap();
+    s.pending_quit = true;
+}
+
+/// Take a restart queued by `request_reset`.
+pub fn take_reset_request() -> bool {
+    let mut s = state::global().lock().unwrap();
+    std::mem::take(&mut s.pending_reset)
+}
+
+/// Take a shutdown queued by `request_quit`.
+pub fn take_quit_request() -> bool {
+    let mut s = state::global().lock().unwrap();
+    std::mem::take(&mut s.pending_quit)
+}
+
+/// Milliseconds elapsed between the previous guest tick and the current one.
+pub fn delta_millis() -> u64 {
+    let s = state::global().lock().unwrap();
+    s.timing.delta_millis
+}
+
+/// Set the guest tick rate. `0` restores "tick on every host frame".
+pub fn set_target_fps(fps: u32) {
+    let mut s = state::global().lock().unwrap();
+    s.timing.target_fps = fps;
+    s.timing.accumulator_micros = 0;
+}
+
+/// Run `update` `hz` times per second, independently of `draw`. `0` restores one `update` per
+/// tick.
+pub fn set_update_rate(hz: u32) {
+    let mut s = state::global().lock().unwrap();
+    s.timing.update_rate = hz;
+    s.timing.update_accumulator_micros = 0;
+}
+
+/// Number of `update` calls due in the tick that just began.
+pub fn updates_due() -> u32 {
+    let s = state::global().lock().unwrap();
+    s.timing.updates_due
+}
+
+/// How far the current tick's `draw` is between the last `update` and the next, in
+/// `0.0..1.0`. Always 1.0 without a fixed update rate.
+pub fn interpolation_alpha() -> f32 {
+    let s = state::global().lock().unwrap();
+    s.timing.interpolation_alpha
+}
+
+/// Guest ticks per second measured over the last full second.
+pub fn get_fps() -> u32 {
+    let s = state::global().lock().unwrap();
+    s.timing.measured_fps
+}
+
+/// Advance a splitmix64 state and return the next output.
+fn splitmix64(state: &mut u64) -> u64 {
+    *state = state.wrapping_add(0x9E37_79B9_7F4A_7C15);
+    let mut z = *state;
+    z = (z ^ (z >> 30)).wrapping_mul(0xBF58_476D_1CE4_E5B9);
+    z = (z ^ (z >> 27)).wrapping_mul(0x94D0_49BB_1331_11EB);
+    z ^ (z >> 31)
+}
+
+/// Gather 64 bits of entropy.
+///
+/// `RandomState` is keyed from the OS RNG once per process and perturbed per instance, so
+/// hashing the wall clock through a fresh one gives an unpredictable value without pulling in
+/// an extra crate.
+fn entropy() -> u64 {
+    let nanos = SystemTime::now()
+        .duration_since(UNIX_EPOCH)
+        .map(|d| d.as_nanos() as u64)
+        .unwrap_or_default();
+    let mut h = RandomState::new().build_hasher();
+    h.write_u64(nanos);
+    h.finish()
+}
+
+impl RngState {
+    /// Next value from the host generator, seeding it first if needed.
+    pub fn next_u64(&mut self) -> u64 {
+        let state = self.state.get_or_insert_with(entropy);
+        splitmix64(state)
+    }
+}
+
+/// Next value from the host PRNG.
+pub fn random() -> u64 {
+    let mut s = state::global().lock().unwrap();
+    s.rng.next_u64()
+}
+
+/// A fresh, independent 64-bit seed for guest-side generators.
+pub fn random_seed() -> u64 {
+    entropy()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn ms(n: u64) -> Duration {
+        Duration::from_millis(n)
+    }
+
+    #[test]
+    fn ticks_every_host_frame_without_target() {
+        let mut t = TimingState::default();
+        let start = Instant::now();
+
+        assert!(t.advance(start));
+        assert_eq!(t.delta_millis, 0);
+
+        assert!(t.advance(start + ms(16)));
+        assert_eq!(t.delta_millis, 16);
+    }
+
+    #[test]
+    fn target_fps_skips_frames_until_due() {
+        let mut t = TimingState {
+            target_fps: 30,
+            ..Default::default()
+        };
+        let start = Instant::now();
+
+        // First frame always ticks.
+        assert!(t.advance(start));
+        // ~16.6ms later: not yet due at 30 FPS (33.3ms interval).
+        assert!(!t.advance(start + ms(17)));
+        // ~33ms later: due.
+        assert!(t.advance(start + ms(34)));
+        assert_eq!(t.delta_millis, 34);
+    }
+
+    #[test]
+    fn fixed_update_rate_runs_updates_as_due() {
+        let mut t = TimingState {
+            update_rate: 30,
+            ..Default::default()
+        };
+        let start = Instant::now();
+
+        // The first tick updates once; the next at 60 Hz owes half an update.
+        t.advance(start);
+        assert_eq!(t.updates_due, 1);
+        t.advance(start + Duration::from_micros(16_667));
+        assert_eq!(t.updates_due, 0);
+        assert!((t.interpolation_alpha - 0.5).abs() < 0.01);
+        t.advance(start + Duration::from_micros(33_334));
+        assert_eq!(t.updates_due, 1);
+        assert!(t.interpolation_alpha < 0.01);
+
+        // A stall runs at most MAX_UPDATES_PER_TICK and drops the rest.
+        t.update_rate = 240;
+        t.advance(start + ms(233));
+        assert_eq!(t.updates_due, MAX_UPDATES_PER_TICK);
+        assert_eq!(t.interpolation_alpha, 0.0);
+    }
+
+    #[test]
+    fn one_update_per_tick_without_an_update_rate() {
+        let mut t = TimingState::default();
+        let start = Instant::now();
+        t.advance(start);
+        t.advance(start + ms(16));
+        assert_eq!(t.updates_due, 1);
+        assert_eq!(t.interpolation_alpha, 1.0);
+    }
+
+    #[test]
+    fn delta_is_clamped_after_stall() {
+        let mut t = TimingState::default();
+        let start = Instant::now();
+
+        t.advance(start);
+        t.advance(start + ms(5_000));
+        assert_eq!(t.delta_millis, MAX_DELTA_MILLIS);
+    }
+
+    #[test]
+    fn fps_is_measured_per_second() {
+        let mut t = TimingState::default();
+        let start = Instant::now();
+
+        for i in 0..=60 {
+            t.advance(start + Duration::from_micros(i * 16_667));
+        }
+        assert!(
+            (59..=61).contains(&t.measured_fps),
+            "got {}",
+            t.measured_fps
+        );
+    }
+
+    #[test]
+    fn rng_is_deterministic_for_a_given_state() {
+        let mut a = RngState { state: Some(42) };
+        let mut b = RngState { state: Some(42) };
+        let xs: Vec<u64> = (0..8).map(|_| a.next_u64()).collect();
+        let ys: Vec<u64> = (0..8).map(|_| b.next_u64()).collect();
+        assert_eq!(xs, ys);
+        assert_ne!(xs[0], xs[1]);
+    }
+
+    #[test]
+    fn rng_seeds_itself_on_first_use() {
+        let mut r = RngState::default();
+        r.next_u64();
+        assert!(r.state.is_some());
+    }
+}
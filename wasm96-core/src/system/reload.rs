@@ -0,0 +1,153 @@
+//! Development hot reload: the cart file is watched and swapped in when it changes.
+//!
+//! Off unless the `WASM96_HOT_RELOAD` environment variable is set (to anything but `0`), and
+//! only for carts the frontend loaded from a file. The file's modification time is checked a
+//! few times a second; a change is picked up once the time has stopped moving for one check, so
+//! a cart still being written isn't read half-way.
+//!
+//! A cart with a new module restarts the guest: `on_quit` runs, then a fresh instance runs
+//! `setup` again. A cart with the same module and new metadata or assets swaps those in and
+//! keeps running. Either way storage and launch parameters are kept, and
+//! `wasm96_system_dev_reload_requested` returns 1 until the first tick after the reload ends,
+//! so `setup` can skip the title screen and a running guest can re-read its assets.
+
+use std::collections::hash_map::DefaultHasher;
+use std::hash::{Hash, Hasher};
+use std::path::Path;
+use std::time::{Duration, Instant, SystemTime};
+
+use crate::loader;
+use crate::state::{ReloadState, global};
+
+/// Environment variable turning hot reload on.
+pub const ENABLE_ENV: &str = "WASM96_HOT_RELOAD";
+
+/// How often the cart file is checked.
+pub const CHECK_INTERVAL: Duration = Duration::from_millis(250);
+
+/// Whether `value` of `ENABLE_ENV` turns hot reload on.
+pub fn enabled_by(value: &str) -> bool {
+    let value = value.trim();
+    !value.is_empty() && value != "0"
+}
+
+fn enabled() -> bool {
+    std::env::var(ENABLE_ENV).is_ok_and(|v| enabled_by(&v))
+}
+
+fn modified(path: &Path) -> Option<SystemTime> {
+    std::fs::metadata(path).and_then(|m| m.modified()).ok()
+}
+
+/// Hash of the module in `rom_bytes` (0 if it has none).
+pub fn module_hash(rom_bytes: &[u8]) -> u64 {
+    let Ok(detected) = loader::normalize_to_wasm(rom_bytes) else {
+        return 0;
+    };
+    let mut hasher = DefaultHasher::new();
+    detected.wasm_bytes.hash(&mut hasher);
+    hasher.finish()
+}
+
+impl ReloadState {
+    /// Note the cart file's modification time at a check. Returns true when a change has
+    /// settled and the cart should be reloaded.
+    pub fn observe(&mut self, modified: SystemTime) -> bool {
+        if self.loaded == Some(modified) {
+            self.pending = None;
+            return false;
+        }
+        if self.pending == Some(modified) {
+            self.loaded = Some(modified);
+            self.pending = None;
+            return true;
+        }
+        self.pending = Some(modified);
+        false
+    }
+}
+
+/// Start watching the cart loaded from `path`, if hot reload is on.
+pub fn watch(path: Option<&Path>, rom_bytes: &[u8]) {
+    let path = path.filter(|_| enabled());
+    let mut s = match global().lock() {
+        Ok(g) => g,
+        Err(poisoned) => poisoned.into_inner(),
+    };
+    s.reload = ReloadState::default();
+    if let Some(path) = path {
+        s.reload.loaded = modified(path);
+        s.reload.path = Some(path.to_path_buf());
+        s.reload.module_hash = module_hash(rom_bytes);
+    }
+}
+
+/// The new cart's bytes, once the watched file has changed and settled.
+pub fn poll() -> Option<Vec<u8>> {
+    let mut s = global().lock().unwrap();
+    let reload = &mut s.reload;
+    let path = reload.path.clone()?;
+    let now = Instant::now();
+    if reload
+        .last_check
+        .is_some_and(|t| now.duration_since(t) < CHECK_INTERVAL)
+    {
+        return None;
+    }
+    reload.last_check = Some(now);
+    if !reload.observe(modified(&path)?) {
+        return None;
+    }
+    drop(s);
+    std::fs::read(&path).ok().filter(|data| !data.is_empty())
+}
+
+/// Whether `rom_bytes` has a different module from the running cart; remembers it if so.
+pub fn swap_module(rom_bytes: &[u8]) -> bool {
+    let hash = module_hash(rom_bytes);
+    let mut s = global().lock().unwrap();
+    std::mem::replace(&mut s.reload.module_hash, hash) != hash
+}
+
+/// Mark the cart as just reloaded.
+pub fn mark_reloaded() {
+    global().lock().unwrap().reload.reloaded = true;
+}
+
+/// End of a tick: the first tick after a reload is over.
+pub fn end_tick() {
+    global().lock().unwrap().reload.reloaded = false;
+}
+
+/// Guest import: 1 from a hot reload until the first tick after it ends, else 0.
+pub fn requested_guest() -> u32 {
+    global().lock().unwrap().reload.reloaded as u32
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn reloads_once_the_file_stops_changing() {
+        let t = |secs| SystemTime::UNIX_EPOCH + Duration::from_secs(secs);
+        let mut state = ReloadState {
+            loaded: Some(t(1)),
+            ..ReloadState::default()
+        };
+        assert!(!state.observe(t(1)));
+        assert!(!state.observe(t(2)));
+        assert!(!state.observe(t(3)));
+        assert!(state.observe(t(3)));
+        assert_eq!(state.loaded, Some(t(3)));
+        assert!(!state.observe(t(3)));
+    }
+
+    #[test]
+    fn env_values() {
+        assert!(enabled_by("1"));
+        assert!(enabled_by("yes"));
+        assert!(!enabled_by("0"));
+        assert!(!enabled_by(" "));
+    }
+}
@@ -0,0 +1,379 @@
+//! Save states: snapshots of guest linear memory plus the host state a cart can observe.
+//!
+//! A snapshot holds the guest's memory, the drawing state (color, line, tint, palette) and
+//! framebuffer, the host RNG and the mixer volumes. Registered resources (images, fonts, meshes,
+//! ...) are keyed and immutable, so they are left alone; sounds already playing keep playing.
+//!
+//! Only linear memory is captured, not wasm globals. Between ticks the toolchain stack pointer is
+//! back at its base, so this covers Rust, C and Zig guests; runtimes that keep allocator state in
+//! non-exported globals (e.g. AssemblyScript) can't be restored faithfully.
+//!
+//! Guests request a restore in the middle of a tick, while their own call frames are live in
+//! linear memory, so `request_load` only queues the snapshot; the core applies it once `draw`
+//! has returned. Frontend save states (`retro_unserialize`) are applied immediately.
+//!
+//! Frontends ask for the size once and reuse it, but guest memory can grow. [`max_len`] is the
+//! size of a snapshot taken now plus [`HEADROOM`] for later growth, computed without taking one;
+//! the core reports it the first time it's asked and keeps reporting that value. Shorter
+//! snapshots are zero-padded, and one that has outgrown it fails to save.
+//!
+//! Layout (little-endian): `b"W96S"`, version `u8`, memory length `u64`, memory bytes, width
+//! `u32`, height `u32`, draw color `u32`, line width `u32`, tint `u32`, palette colors `u32` x 256,
+//! palette swaps `u8` x 256, palette transparency `u8` x 256, line style `u8`, RNG flag `u8` +
+//! state `u64`, master volume `f32`, group volumes `f32` x `AUDIO_GROUPS`, framebuffer `u32` x
+//! width x height.
+
+use wasmtime::{AsContext, AsContextMut, Caller, Memory};
+
+use crate::av::utils::read_guest_bytes;
+use crate::runtime::GuestLimits;
+use crate::state::{self, AUDIO_GROUPS, LineStyle, Palette};
+
+const MAGIC: &[u8; 4] = b"W96S";
+const VERSION: u8 = 3;
+const WASM_PAGE: u64 = 64 * 1024;
+
+/// Room left in the reported snapshot size for guest memory or the screen to grow into.
+pub const HEADROOM: usize = 8 * 1024 * 1024;
+
+/// Snapshot bytes besides guest memory and the framebuffer: header, memory length, five `u32`
+/// fields, palette, line style, RNG, volumes.
+const FIXED_LEN: usize =
+    MAGIC.len() + 1 + 8 + 5 * 4 + 256 * 4 + 256 + 256 + 1 + 1 + 8 + 4 + AUDIO_GROUPS * 4;
+
+/// Size to report for snapshots of `memory_len` bytes of memory and a `width` x `height` screen:
+/// what one takes now, plus [`HEADROOM`].
+pub fn max_len(memory_len: usize, width: u32, height: u32) -> usize {
+    FIXED_LEN + memory_len + (width as usize * height as usize * 4) + HEADROOM
+}
+
+/// Host state carried in a snapshot.
+#[derive(Debug, Clone, PartialEq)]
+pub struct HostSnapshot {
+    pub width: u32,
+    pub height: u32,
+    pub draw_color: u32,
+    pub line_width: u32,
+    pub tint: u32,
+    pub palette: Palette,
+    pub line_style: LineStyle,
+    pub rng: Option<u64>,
+    pub master_volume: f32,
+    pub group_volumes: [f32; AUDIO_GROUPS],
+    pub framebuffer: Vec<u32>,
+}
+
+/// Copy the snapshot-relevant host state out of global state.
+pub fn capture_host() -> HostSnapshot {
+    let s = state::global().lock().unwrap();
+    // Mid-draw, a zoomed or rotated camera has swapped the screen out for its world pass.
+    let screen = s.video.camera.pass.as_ref().and_then(|p| p.screen.as_ref());
+    let (framebuffer, width, height) = match screen {
+        Some((fb, w, h)) => (fb, *w, *h),
+        None => (&s.video.framebuffer, s.video.width, s.video.height),
+    };
+    // Inside a draw layer or a clip mask, the screen is set aside as well.
+    let framebuffer = match (s.video.layers.open, &s.video.mask.target) {
+        (Some(_), _) => s.video.layers.screen.clone(),
+        (None, Some(screen)) => screen.clone(),
+        (None, None) => framebuffer.clone(),
+    };
+    HostSnapshot {
+        width,
+        height,
+        draw_color: s.video.draw_color,
+        line_width: s.video.line_width,
+        tint: s.video.tint,
+        palette: s.video.palette.clone(),
+        line_style: s.video.line_style,
+        rng: s.rng.state,
+        master_volume: s.audio.master_volume,
+        group_volumes: s.audio.group_volumes,
+        framebuffer,
+    }
+}
+
+/// Put captured host state back.
+pub fn restore_host(host: HostSnapshot) {
+    let mut s = state::global().lock().unwrap();
+    if (s.video.width, s.video.height) != (host.width, host.height) {
+        s.video.resize_pending = true;
+    }
+    s.video.width = host.width;
+    s.video.height = host.height;
+    s.video.draw_color = host.draw_color;
+    s.video.line_width = host.line_width;
+    s.video.tint = host.tint;
+    s.video.palette = host.palette;
+    s.video.line_style = host.line_style;
+    s.video.framebuffer = host.framebuffer;
+    s.rng.state = host.rng;
+    s.audio.master_volume = host.master_volume;
+    s.audio.group_volumes = host.group_volumes;
+}
+
+pub fn encode(memory: &[u8], host: &HostSnapshot) -> Vec<u8> {
+    let mut out = Vec::with_capacity(memory.len() + host.framebuffer.len() * 4 + 2048);
+    out.extend_from_slice(MAGIC);
+    out.push(VERSION);
+    out.extend_from_slice(&(memory.len() as u64).to_le_bytes());
+    out.extend_from_slice(memory);
+    for v in [
+        host.width,
+        host.height,
+        host.draw_color,
+        host.line_width,
+        host.tint,
+    ] {
+        out.extend_from_slice(&v.to_le_bytes());
+    }
+    for c in host.palette.colors {
+        out.extend_from_slice(&c.to_le_bytes());
+    }
+    out.extend_from_slice(&host.palette.swap);
+    out.extend(host.palette.transparent.map(u8::from));
+    out.push(host.line_style as u8);
+    out.push(host.rng.is_some() as u8);
+    out.extend_from_slice(&host.rng.unwrap_or(0).to_le_bytes());
+    out.extend_from_slice(&host.master_volume.to_le_bytes());
+    for v in host.group_volumes {
+        out.extend_from_slice(&v.to_le_bytes());
+    }
+    for px in &host.framebuffer {
+        out.extend_from_slice(&px.to_le_bytes());
+    }
+    out
+}
+
+/// Split a snapshot into guest memory and host state. `None` if it's malformed.
+///
+/// Trailing bytes are ignored: frontends hand back the whole (zero-padded) buffer they sized
+/// with `retro_serialize_size`.
+pub fn decode(data: &[u8]) -> Option<(&[u8], HostSnapshot)> {
+    let rest = data.strip_prefix(MAGIC)?;
+    let (&version, rest) = rest.split_first()?;
+    if version != VERSION {
+        return None;
+    }
+    let (mem_len, rest) = split_u64(rest)?;
+    let mem_len = usize::try_from(mem_len).ok()?;
+    if rest.len() < mem_len {
+        return None;
+    }
+    let (memory, rest) = rest.split_at(mem_len);
+
+    let (width, rest) = split_u32(rest)?;
+    let (height, rest) = split_u32(rest)?;
+    let (draw_color, rest) = split_u32(rest)?;
+    let (line_width, rest) = split_u32(rest)?;
+    let (tint, mut rest) = split_u32(rest)?;
+    let mut palette = Palette::default();
+    for c in &mut palette.colors {
+        let (v, r) = split_u32(rest)?;
+        *c = v;
+        rest = r;
+    }
+    let (swap, rest) = rest.split_first_chunk::<256>()?;
+    palette.swap = *swap;
+    let (transparent, rest) = rest.split_first_chunk::<256>()?;
+    palette.transparent = transparent.map(|t| t != 0);
+    let (&line_style, rest) = rest.split_first()?;
+    let (&has_rng, rest) = rest.split_first()?;
+    let (rng, rest) = split_u64(rest)?;
+    let (master_volume, mut rest) = split_u32(rest)?;
+    let mut group_volumes = [0.0; AUDIO_GROUPS];
+    for v in &mut group_volumes {
+        let (bits, r) = split_u32(rest)?;
+        *v = f32::from_bits(bits);
+        rest = r;
+    }
+
+    let pixels = (width as usize).checked_mul(height as usize)?;
+    let framebuffer = rest
+        .get(..pixels.checked_mul(4)?)?
+        .chunks_exact(4)
+        .map(|c| u32::from_le_bytes([c[0], c[1], c[2], c[3]]))
+        .collect();
+
+    let host = HostSnapshot {
+        width,
+        height,
+        draw_color,
+        line_width,
+        tint,
+        palette,
+        line_style: LineStyle::from_u32(line_style as u32),
+        rng: (has_rng != 0).then_some(rng),
+        master_volume: f32::from_bits(master_volume),
+        group_volumes,
+        framebuffer,
+    };
+    Some((memory, host))
+}
+
+fn split_u32(data: &[u8]) -> Option<(u32, &[u8])> {
+    let (head, rest) = data.split_first_chunk::<4>()?;
+    Some((u32::from_le_bytes(*head), rest))
+}
+
+fn split_u64(data: &[u8]) -> Option<(u64, &[u8])> {
+    let (head, rest) = data.split_first_chunk::<8>()?;
+    Some((u64::from_le_bytes(*head), rest))
+}
+
+/// Snapshot guest `memory` and the host state.
+pub fn save(store: impl AsContext, memory: Memory) -> Vec<u8> {
+    encode(memory.data(&store), &capture_host())
+}
+
+/// Restore a snapshot into guest `memory`, growing it if needed. Returns false (changing
+/// nothing) if `data` is malformed or memory can't grow.
+pub fn load(mut store: impl AsContextMut, memory: Memory, data: &[u8]) -> bool {
+    let Some((saved, host)) = decode(data) else {
+        return false;
+    };
+    let current = memory.data_size(&store) as u64;
+    if (saved.len() as u64) > current {
+        let pages = (saved.len() as u64 - current).div_ceil(WASM_PAGE);
+        if memory.grow(&mut store, pages).is_err() {
+            return false;
+        }
+    }
+    // Memory can't shrink; anything past the saved length is zeroed as if freshly grown.
+    let mem = memory.data_mut(&mut store);
+    mem[..saved.len()].copy_from_slice(saved);
+    mem[saved.len()..].fill(0);
+    restore_host(host);
+    true
+}
+
+/// Guest import: snapshot into a blob and return its id (0 if the guest has no memory export).
+pub fn save_guest(caller: &mut Caller<'_, GuestLimits>) -> u32 {
+    let Some(memory) = caller.get_export("memory").and_then(|e| e.into_memory()) else {
+        return 0;
+    };
+    let data = save(&*caller, memory);
+    super::blobs::store(data)
+}
+
+/// Guest import: queue a snapshot to be restored after this tick. Returns 1 if it looks valid.
+pub fn request_load(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    let Ok(data) = read_guest_bytes(caller, ptr, len) else {
+        return 0;
+    };
+    if decode(&data).is_none() {
+        return 0;
+    }
+    let mut s = state::global().lock().unwrap();
+    s.pending_state_load = Some(data);
+    1
+}
+
+/// Take a snapshot queued by `request_load`, if any.
+pub fn take_pending_load() -> Option<Vec<u8>> {
+    let mut s = state::global().lock().unwrap();
+    s.pending_state_load.take()
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn sample_palette() -> Palette {
+        let mut palette = Palette::default();
+        palette.colors[200] = 0x123456;
+        palette.swap[3] = 9;
+        palette.transparent[7] = true;
+        palette
+    }
+
+    fn sample_host() -> HostSnapshot {
+        HostSnapshot {
+            width: 2,
+            height: 3,
+            draw_color: 0xFF112233,
+            line_width: 4,
+            tint: 0x80FF0000,
+            palette: sample_palette(),
+            line_style: LineStyle::Dotted,
+            rng: Some(99),
+            master_volume: 0.5,
+            group_volumes: [0.25; AUDIO_GROUPS],
+            framebuffer: (0..6).collect(),
+        }
+    }
+
+    #[test]
+    fn snapshot_round_trips() {
+        let memory = vec![1, 2, 3, 4, 5];
+        let data = encode(&memory, &sample_host());
+        let (mem, host) = decode(&data).unwrap();
+        assert_eq!(mem, &memory[..]);
+        assert_eq!(host, sample_host());
+
+        let no_rng = HostSnapshot {
+            rng: None,
+            ..sample_host()
+        };
+        assert_eq!(decode(&encode(&[], &no_rng)).unwrap().1.rng, None);
+    }
+
+    #[test]
+    fn ignores_frontend_padding() {
+        let mut data = encode(&[7; 3], &sample_host());
+        data.resize(data.len() + 64, 0);
+        assert_eq!(decode(&data).unwrap().1, sample_host());
+    }
+
+    #[test]
+    fn reported_size_leaves_headroom_for_growth() {
+        let engine = wasmtime::Engine::default();
+        let mut store = crate::runtime::runtime::guest_store(&engine);
+        let memory = Memory::new(&mut store, wasmtime::MemoryType::new(16, None)).unwrap();
+        let host = HostSnapshot {
+            width: 320,
+            height: 240,
+            framebuffer: vec![0; 320 * 240],
+            ..sample_host()
+        };
+        let bound = max_len(memory.data_size(&store), host.width, host.height);
+        assert_eq!(
+            encode(memory.data(&store), &host).len() + HEADROOM,
+            bound,
+            "a realistic size, not the most memory could ever hold"
+        );
+
+        // Growth within the headroom still fits.
+        memory
+            .grow(&mut store, HEADROOM as u64 / WASM_PAGE - 1)
+            .unwrap();
+        assert!(encode(memory.data(&store), &host).len() <= bound);
+
+        // Growth past it doesn't, and the snapshot is refused rather than cut short.
+        memory.grow(&mut store, 2).unwrap();
+        assert!(encode(memory.data(&store), &host).len() > bound);
+    }
+
+    #[test]
+    fn fixed_len_matches_the_encoding() {
+        let empty = HostSnapshot {
+            width: 0,
+            height: 0,
+            framebuffer: Vec::new(),
+            ..sample_host()
+        };
+        assert_eq!(encode(&[], &empty).len(), FIXED_LEN);
+    }
+
+    #[test]
+    fn rejects_truncated_or_foreign_data() {
+        let data = encode(&[0; 16], &sample_host());
+        assert!(decode(&data[..data.len() - 1]).is_none());
+        assert!(decode(&data[..10]).is_none());
+        assert!(decode(b"W96R\x01").is_none());
+
+        let mut bad_version = data.clone();
+        bad_version[4] = VERSION + 1;
+        assert!(decode(&bad_version).is_none());
+    }
+}
@@ -0,0 +1,100 @@
+//! Per-tick profiling counters.
+//!
+//! Every draw import bumps a counter; the core times the guest's `update` and `draw` and its own
+//! compositing and presentation, and publishes the totals once the frame has been presented. A
+//! guest reading its stats therefore sees the previous tick.
+//!
+//! Layout written by `wasm96_system_stats` (little-endian, [`STATS_SIZE`] bytes): draw calls
+//! `u32`, update µs `u32`, draw µs `u32`, render µs `u32`, memory bytes `u64`, images `u32`,
+//! fonts `u32`, meshes `u32`.
+
+use std::time::Duration;
+
+use wasmtime::Caller;
+
+use crate::av::utils::write_guest_bytes;
+use crate::av::{graphics3d, resources};
+use crate::runtime::GuestLimits;
+use crate::state::{self, FrameStats};
+
+/// Bytes written by `wasm96_system_stats`.
+pub const STATS_SIZE: usize = 36;
+
+/// Count one draw import against the current tick.
+pub fn count_draw() {
+    let mut s = state::global().lock().unwrap();
+    s.stats.draw_calls = s.stats.draw_calls.saturating_add(1);
+}
+
+/// Publish the finished tick's timings and start counting the next one.
+pub fn end_tick(update: Duration, draw: Duration, render: Duration, memory_bytes: u64) {
+    let micros = |d: Duration| d.as_micros().min(u32::MAX as u128) as u32;
+    let mut s = state::global().lock().unwrap();
+    s.stats.last = FrameStats {
+        draw_calls: std::mem::take(&mut s.stats.draw_calls),
+        update_micros: micros(update),
+        draw_micros: micros(draw),
+        render_micros: micros(render),
+        memory_bytes,
+    };
+}
+
+/// Pack the last tick's stats with the current resource counts.
+pub fn encode(frame: &FrameStats, images: usize, fonts: usize, meshes: usize) -> [u8; STATS_SIZE] {
+    let mut out = [0; STATS_SIZE];
+    let words = [
+        frame.draw_calls,
+        frame.update_micros,
+        frame.draw_micros,
+        frame.render_micros,
+    ];
+    for (i, w) in words.iter().enumerate() {
+        out[i * 4..i * 4 + 4].copy_from_slice(&w.to_le_bytes());
+    }
+    out[16..24].copy_from_slice(&frame.memory_bytes.to_le_bytes());
+    for (i, n) in [images, fonts, meshes].into_iter().enumerate() {
+        let n = n.min(u32::MAX as usize) as u32;
+        out[24 + i * 4..28 + i * 4].copy_from_slice(&n.to_le_bytes());
+    }
+    out
+}
+
+/// Guest import: write the stats to `ptr`. Returns the bytes written, or 0 if `len` is too
+/// small or the write fails.
+pub fn stats_guest(caller: &mut Caller<'_, GuestLimits>, ptr: u32, len: u32) -> u32 {
+    if (len as usize) < STATS_SIZE {
+        return 0;
+    }
+    let (images, fonts) = resources::resource_counts();
+    let meshes = graphics3d::mesh_count();
+    let frame = state::global().lock().unwrap().stats.last;
+    let data = encode(&frame, images, fonts, meshes);
+    match write_guest_bytes(caller, ptr, &data) {
+        Ok(()) => STATS_SIZE as u32,
+        Err(_) => 0,
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn encodes_fixed_layout() {
+        let frame = FrameStats {
+            draw_calls: 7,
+            update_micros: 1500,
+            draw_micros: 2500,
+            render_micros: 300,
+            memory_bytes: 1 << 33,
+        };
+        let data = encode(&frame, 4, 2, 1);
+        let word = |i: usize| u32::from_le_bytes(data[i..i + 4].try_into().unwrap());
+        assert_eq!([word(0), word(4), word(8), word(12)], [7, 1500, 2500, 300]);
+        assert_eq!(
+            u64::from_le_bytes(data[16..24].try_into().unwrap()),
+            1 << 33
+        );
+        assert_eq!([word(24), word(28), word(32)], [4, 2, 1]);
+    }
+}
@@ -0,0 +1,301 @@
+//! Named input actions with remappable bindings.
+//!
+//! Game code asks about "jump" instead of `Button::A`, and the player can rebind it to any mix
+//! of joypad buttons, keys and mouse buttons; bindings save to persistent storage as text:
+//!
+//! ```ignore
+//! let mut actions = ActionMap::new();
+//! actions.bind("jump", &[Binding::pad(0, Button::A), Binding::Key(32)]);
+//! actions.load("controls"); // keep the defaults if nothing was saved
+//! // each tick:
+//! actions.update();
+//! if actions.pressed("jump") { player.jump(); }
+//! ```
+//!
+//! For a "press a button to rebind" screen, wait until [`Binding::held`] returns `None` (so the
+//! confirm press isn't captured), then bind the first `Some`.
+
+use alloc::{string::String, vec::Vec};
+use core::fmt::Write;
+
+use crate::{Button, input, storage};
+
+/// Joypad ports scanned by [`Binding::held`].
+const PORTS: u32 = 8;
+/// Key codes scanned by [`Binding::held`] (libretro's `RETROK_*` range).
+const KEYS: u32 = 324;
+/// Mouse buttons scanned by [`Binding::held`]: left, right, middle.
+const MOUSE_BUTTONS: u32 = 3;
+
+const BUTTONS: [Button; 16] = [
+    Button::B,
+    Button::Y,
+    Button::Select,
+    Button::Start,
+    Button::Up,
+    Button::Down,
+    Button::Left,
+    Button::Right,
+    Button::A,
+    Button::X,
+    Button::L1,
+    Button::R1,
+    Button::L2,
+    Button::R2,
+    Button::L3,
+    Button::R3,
+];
+
+/// One physical input an action can be bound to.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, Hash)]
+pub enum Binding {
+    /// A joypad button on one port.
+    Button { port: u32, button: Button },
+    /// A keyboard key code, as for [`input::is_key_down`].
+    Key(u32),
+    /// A mouse button: 0 = left, 1 = right, 2 = middle.
+    Mouse(u32),
+}
+
+impl Binding {
+    pub const fn pad(port: u32, button: Button) -> Self {
+        Binding::Button { port, button }
+    }
+
+    pub fn is_down(self) -> bool {
+        match self {
+            Binding::Button { port, button } => input::is_button_down(port, button),
+            Binding::Key(key) => input::is_key_down(key),
+            Binding::Mouse(btn) => input::is_mouse_down(btn),
+        }
+    }
+
+    /// The first input currently held, checking joypads, then mouse buttons, then keys.
+    pub fn held() -> Option<Binding> {
+        let pads = (0..PORTS)
+            .filter(|&port| input::is_connected(port))
+            .flat_map(|port| {
+                BUTTONS
+                    .iter()
+                    .map(move |&button| Binding::pad(port, button))
+            });
+        let mice = (0..MOUSE_BUTTONS).map(Binding::Mouse);
+        let keys = (0..KEYS).map(Binding::Key);
+        pads.chain(mice).chain(keys).find(|b| b.is_down())
+    }
+
+    /// Parse the text form written by [`ActionMap::to_text`]: `pad0:A`, `key:32` or `mouse:0`.
+    pub fn parse(s: &str) -> Option<Binding> {
+        let (kind, value) = s.split_once(':')?;
+        match kind {
+            "key" => value.parse().ok().map(Binding::Key),
+            "mouse" => value.parse().ok().map(Binding::Mouse),
+            _ => {
+                let port = kind.strip_prefix("pad")?.parse().ok()?;
+                let button = *BUTTONS
+                    .iter()
+                    .find(|b| button_name(**b).eq_ignore_ascii_case(value))?;
+                Some(Binding::pad(port, button))
+            }
+        }
+    }
+}
+
+impl core::fmt::Display for Binding {
+    fn fmt(&self, f: &mut core::fmt::Formatter<'_>) -> core::fmt::Result {
+        match *self {
+            Binding::Button { port, button } => write!(f, "pad{port}:{}", button_name(button)),
+            Binding::Key(key) => write!(f, "key:{key}"),
+            Binding::Mouse(btn) => write!(f, "mouse:{btn}"),
+        }
+    }
+}
+
+fn button_name(button: Button) -> &'static str {
+    match button {
+        Button::B => "B",
+        Button::Y => "Y",
+        Button::Select => "Select",
+        Button::Start => "Start",
+        Button::Up => "Up",
+        Button::Down => "Down",
+        Button::Left => "Left",
+        Button::Right => "Right",
+        Button::A => "A",
+        Button::X => "X",
+        Button::L1 => "L1",
+        Button::R1 => "R1",
+        Button::L2 => "L2",
+        Button::R2 => "R2",
+        Button::L3 => "L3",
+        Button::R3 => "R3",
+    }
+}
+
+#[derive(Clone, Debug)]
+struct Action {
+    name: String,
+    bindings: Vec<Binding>,
+    down: bool,
+    was_down: bool,
+}
+
+/// Named actions and the inputs bound to each. Call [`ActionMap::update`] once per tick before
+/// querying.
+#[derive(Clone, Debug, Default)]
+pub struct ActionMap {
+    actions: Vec<Action>,
+}
+
+impl ActionMap {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    fn find(&self, name: &str) -> Option<&Action> {
+        self.actions.iter().find(|a| a.name == name)
+    }
+
+    fn entry(&mut self, name: &str) -> &mut Action {
+        let i = match self.actions.iter().position(|a| a.name == name) {
+            Some(i) => i,
+            None => {
+                self.actions.push(Action {
+                    name: name.into(),
+                    bindings: Vec::new(),
+                    down: false,
+                    was_down: false,
+                });
+                self.actions.len() - 1
+            }
+        };
+        &mut self.actions[i]
+    }
+
+    /// Set the inputs for `name`, replacing any it had.
+    pub fn bind(&mut self, name: &str, inputs: &[Binding]) {
+        let action = self.entry(name);
+        action.bindings.clear();
+        action.bindings.extend_from_slice(inputs);
+    }
+
+    /// Add one more input to `name`.
+    pub fn add_binding(&mut self, name: &str, input: Binding) {
+        let action = self.entry(name);
+        if !action.bindings.contains(&input) {
+            action.bindings.push(input);
+        }
+    }
+
+    /// Remove `input` from every action (e.g. before giving it to another one).
+    pub fn unbind_input(&mut self, input: Binding) {
+        for action in &mut self.actions {
+            action.bindings.retain(|b| *b != input);
+        }
+    }
+
+    pub fn bindings(&self, name: &str) -> &[Binding] {
+        self.find(name).map_or(&[], |a| &a.bindings)
+    }
+
+    /// Action names in the order they were first bound.
+    pub fn names(&self) -> impl Iterator<Item = &str> {
+        self.actions.iter().map(|a| a.name.as_str())
+    }
+
+    /// Sample every action's inputs for this tick.
+    pub fn update(&mut self) {
+        for action in &mut self.actions {
+            action.was_down = action.down;
+            action.down = action.bindings.iter().any(|b| b.is_down());
+        }
+    }
+
+    /// Any of `name`'s inputs is held.
+    pub fn down(&self, name: &str) -> bool {
+        self.find(name).is_some_and(|a| a.down)
+    }
+
+    /// `name` went down this tick.
+    pub fn pressed(&self, name: &str) -> bool {
+        self.find(name).is_some_and(|a| a.down && !a.was_down)
+    }
+
+    /// `name` was let go this tick.
+    pub fn released(&self, name: &str) -> bool {
+        self.find(name).is_some_and(|a| !a.down && a.was_down)
+    }
+
+    /// One line per action: `jump = pad0:A key:32`.
+    pub fn to_text(&self) -> String {
+        let mut out = String::new();
+        for action in &self.actions {
+            let _ = write!(out, "{} =", action.name);
+            for b in &action.bindings {
+                let _ = write!(out, " {b}");
+            }
+            out.push('\n');
+        }
+        out
+    }
+
+    /// Apply bindings from [`ActionMap::to_text`] output. Actions listed there are rebound;
+    /// others keep their current inputs. Unrecognised inputs are skipped.
+    pub fn load_text(&mut self, text: &str) {
+        for line in text.lines() {
+            let Some((name, inputs)) = line.split_once('=') else {
+                continue;
+            };
+            let name = name.trim();
+            if name.is_empty() {
+                continue;
+            }
+            let action = self.entry(name);
+            action.bindings.clear();
+            action
+                .bindings
+                .extend(inputs.split_whitespace().filter_map(Binding::parse));
+        }
+    }
+
+    /// Save the bindings to persistent storage under `key`.
+    pub fn save(&self, key: &str) {
+        storage::save(key, self.to_text().as_bytes());
+    }
+
+    /// Load bindings saved with [`ActionMap::save`]. Returns false (leaving the current bindings
+    /// alone) if nothing was saved under `key`.
+    pub fn load(&mut self, key: &str) -> bool {
+        let Some(data) = storage::load(key) else {
+            return false;
+        };
+        self.load_text(&String::from_utf8_lossy(&data));
+        true
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn bindings_round_trip_as_text() {
+        let mut map = ActionMap::new();
+        map.bind("jump", &[Binding::pad(0, Button::A), Binding::Key(32)]);
+        map.bind("fire", &[Binding::Mouse(0), Binding::pad(1, Button::R2)]);
+        let text = map.to_text();
+        assert_eq!(text, "jump = pad0:A key:32\nfire = mouse:0 pad1:R2\n");
+
+        let mut loaded = ActionMap::new();
+        loaded.bind("pause", &[Binding::pad(0, Button::Start)]);
+        loaded.load_text(&text);
+        loaded.load_text("fire = pad0:bogus key:13\n");
+        assert_eq!(loaded.bindings("jump"), map.bindings("jump"));
+        assert_eq!(loaded.bindings("fire"), &[Binding::Key(13)]);
+        assert_eq!(loaded.bindings("pause"), &[Binding::pad(0, Button::Start)]);
+        assert_eq!(
+            Binding::parse("pad2:select"),
+            Some(Binding::pad(2, Button::Select))
+        );
+    }
+}
@@ -0,0 +1,283 @@
+//! Frame-stepped sprite animation over a registered GIF or a sprite-sheet image.
+//!
+//! An [`Animation`] owns the playback state (current frame, elapsed time, speed, paused/looping)
+//! and draws through the host, so every project doesn't reimplement frame stepping:
+//!
+//! ```ignore
+//! graphics::png_register("hero", HERO_PNG);
+//! let mut walk = Animation::grid("hero", 16, 16, 4, 0, 4, 100);
+//! // each tick:
+//! walk.update(system::delta_seconds());
+//! walk.draw(x, y);
+//! ```
+//!
+//! GIF animations use the GIF's own frame delays; sheet animations use a fixed frame duration
+//! unless set per frame with [`Animation::set_frame_millis`].
+
+use alloc::{vec, vec::Vec};
+
+use crate::graphics::{self, hash_key};
+use crate::math::Rect;
+use crate::{Point, sys};
+
+#[derive(Clone, Debug, PartialEq)]
+enum Source {
+    /// A keyed GIF; frames are its frame indices.
+    Gif(u64),
+    /// A keyed PNG/JPEG; frames are pixel regions (x, y, w, h) of it.
+    Sheet(u64, Vec<(i32, i32, u32, u32)>),
+}
+
+/// Playback state for one animated sprite.
+#[derive(Clone, Debug, PartialEq)]
+pub struct Animation {
+    source: Source,
+    durations: Vec<u32>,
+    frame: usize,
+    elapsed_ms: f32,
+    speed: f32,
+    playing: bool,
+    looping: bool,
+}
+
+impl Animation {
+    fn new(source: Source, durations: Vec<u32>) -> Self {
+        Self {
+            source,
+            durations,
+            frame: 0,
+            elapsed_ms: 0.0,
+            speed: 1.0,
+            playing: true,
+            looping: true,
+        }
+    }
+
+    /// Animate a GIF registered with [`graphics::gif_register`], using its own frame delays.
+    ///
+    /// The frame list is read from the host now, so register the GIF first; an unknown key
+    /// gives an empty animation that draws nothing.
+    pub fn gif(key: &str) -> Self {
+        let key = hash_key(key);
+        let count = unsafe { sys::graphics_gif_frame_count(key) };
+        let durations = (0..count)
+            .map(|i| unsafe { sys::graphics_gif_frame_delay(key, i) })
+            .collect();
+        Self::new(Source::Gif(key), durations)
+    }
+
+    /// Animate regions of a PNG/JPEG registered with [`graphics::png_register`] (or
+    /// `jpeg_register`), each shown for `frame_millis`. Regions round to whole pixels.
+    pub fn sheet(key: &str, frames: &[Rect], frame_millis: u32) -> Self {
+        let regions: Vec<_> = frames.iter().map(|&r| graphics::rect_pixels(r)).collect();
+        let durations = vec![frame_millis; regions.len()];
+        Self::new(Source::Sheet(hash_key(key), regions), durations)
+    }
+
+    /// Animate `count` cells of a uniform sprite sheet, reading left to right and wrapping after
+    /// `columns` cells, starting at cell `first`. Each cell is `frame_w`x`frame_h` pixels.
+    pub fn grid(
+        key: &str,
+        frame_w: u32,
+        frame_h: u32,
+        columns: u32,
+        first: u32,
+        count: u32,
+        frame_millis: u32,
+    ) -> Self {
+        let columns = columns.max(1);
+        let regions: Vec<_> = (first..first.saturating_add(count))
+            .map(|cell| {
+                let x = (cell % columns) * frame_w;
+                let y = (cell / columns) * frame_h;
+                (x as i32, y as i32, frame_w, frame_h)
+            })
+            .collect();
+        let durations = vec![frame_millis; regions.len()];
+        Self::new(Source::Sheet(hash_key(key), regions), durations)
+    }
+
+    /// Resume playback.
+    pub fn play(&mut self) {
+        if self.is_finished() {
+            self.restart();
+        }
+        self.playing = true;
+    }
+
+    /// Stop advancing; [`draw`](Self::draw) keeps showing the current frame.
+    pub fn pause(&mut self) {
+        self.playing = false;
+    }
+
+    pub fn is_playing(&self) -> bool {
+        self.playing
+    }
+
+    /// Jump back to the first frame.
+    pub fn restart(&mut self) {
+        self.frame = 0;
+        self.elapsed_ms = 0.0;
+    }
+
+    /// Playback rate multiplier (1.0 = normal, 2.0 = double speed). Negative values are
+    /// treated as 0.
+    pub fn set_speed(&mut self, speed: f32) {
+        self.speed = speed.max(0.0);
+    }
+
+    pub fn speed(&self) -> f32 {
+        self.speed
+    }
+
+    /// Whether to wrap to the first frame after the last (the default), or stop on the last.
+    pub fn set_looping(&mut self, looping: bool) {
+        self.looping = looping;
+    }
+
+    /// True once a non-looping animation has reached the end of its last frame.
+    pub fn is_finished(&self) -> bool {
+        !self.looping
+            && !self.durations.is_empty()
+            && self.frame == self.durations.len() - 1
+            && self.elapsed_ms >= self.durations[self.frame] as f32
+    }
+
+    pub fn frame(&self) -> usize {
+        self.frame
+    }
+
+    pub fn frame_count(&self) -> usize {
+        self.durations.len()
+    }
+
+    /// Show frame `index` (clamped), restarting its timer.
+    pub fn set_frame(&mut self, index: usize) {
+        self.frame = index.min(self.durations.len().saturating_sub(1));
+        self.elapsed_ms = 0.0;
+    }
+
+    /// Override how long frame `index` is shown.
+    pub fn set_frame_millis(&mut self, index: usize, millis: u32) {
+        if let Some(d) = self.durations.get_mut(index) {
+            *d = millis;
+        }
+    }
+
+    /// Advance by `dt` seconds (typically [`crate::system::delta_seconds`]).
+    pub fn update(&mut self, dt: f32) {
+        if !self.playing || self.durations.is_empty() {
+            return;
+        }
+        self.elapsed_ms += dt * 1000.0 * self.speed;
+        // Zero-length frames would never let the loop finish; treat them as 1ms.
+        let total: u32 = self.durations.iter().map(|&d| d.max(1)).sum();
+        if self.looping && self.elapsed_ms > total as f32 {
+            // Skip whole cycles after a long hitch instead of stepping through them.
+            self.elapsed_ms %= total as f32;
+        }
+        loop {
+            let duration = self.durations[self.frame].max(1) as f32;
+            if self.elapsed_ms < duration {
+                break;
+            }
+            if self.frame + 1 < self.durations.len() {
+                self.elapsed_ms -= duration;
+                self.frame += 1;
+            } else if self.looping {
+                self.elapsed_ms -= duration;
+                self.frame = 0;
+            } else {
+                self.elapsed_ms = duration;
+                break;
+            }
+        }
+    }
+
+    /// Draw the current frame at its natural size.
+    pub fn draw(&self, x: i32, y: i32) {
+        self.draw_scaled(x, y, 0, 0);
+    }
+
+    /// Draw the current frame at `p`.
+    pub fn draw_at(&self, p: impl Into<Point>) {
+        let p = p.into();
+        self.draw(p.x, p.y);
+    }
+
+    /// Draw the current frame scaled to `w`x`h` (natural size if either is 0).
+    pub fn draw_scaled(&self, x: i32, y: i32, w: u32, h: u32) {
+        match &self.source {
+            Source::Gif(key) => unsafe {
+                sys::graphics_gif_draw_frame(*key, self.frame as u32, x, y, w, h)
+            },
+            Source::Sheet(key, regions) => {
+                if let Some(&(sx, sy, sw, sh)) = regions.get(self.frame) {
+                    unsafe { sys::graphics_image_draw_region(*key, sx, sy, sw, sh, x, y, w, h) }
+                }
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn grid_lays_out_cells_row_major() {
+        let anim = Animation::grid("sheet", 16, 8, 3, 2, 3, 100);
+        let Source::Sheet(_, regions) = &anim.source else {
+            panic!("expected a sheet");
+        };
+        assert_eq!(regions, &[(32, 0, 16, 8), (0, 8, 16, 8), (16, 8, 16, 8)]);
+    }
+
+    #[test]
+    fn update_steps_and_loops() {
+        let mut anim = Animation::grid("sheet", 8, 8, 4, 0, 3, 100);
+        anim.update(0.05);
+        assert_eq!(anim.frame(), 0);
+        anim.update(0.06);
+        assert_eq!(anim.frame(), 1);
+        anim.update(0.2);
+        assert_eq!(anim.frame(), 0);
+        // A long hitch skips whole cycles.
+        anim.update(3.0);
+        assert_eq!(anim.frame(), 0);
+    }
+
+    #[test]
+    fn speed_pause_and_one_shot() {
+        let mut anim = Animation::grid("sheet", 8, 8, 4, 0, 2, 100);
+        anim.set_speed(2.0);
+        anim.update(0.05);
+        assert_eq!(anim.frame(), 1);
+
+        anim.pause();
+        anim.update(1.0);
+        assert_eq!(anim.frame(), 1);
+
+        anim.set_looping(false);
+        anim.play();
+        anim.update(1.0);
+        assert_eq!(anim.frame(), 1);
+        assert!(anim.is_finished());
+
+        // Playing a finished one-shot starts it over.
+        anim.play();
+        assert_eq!(anim.frame(), 0);
+        assert!(!anim.is_finished());
+    }
+
+    #[test]
+    fn per_frame_durations() {
+        let frames = [Rect::new(0.0, 0.0, 8.0, 8.0), Rect::new(8.0, 0.0, 8.0, 8.0)];
+        let mut anim = Animation::sheet("sheet", &frames, 100);
+        anim.set_frame_millis(0, 500);
+        anim.update(0.4);
+        assert_eq!(anim.frame(), 0);
+        anim.update(0.15);
+        assert_eq!(anim.frame(), 1);
+    }
+}
@@ -0,0 +1,462 @@
+//! Collision helpers for game physics: contacts, raycasts, swept boxes and a spatial hash.
+//!
+//! The shapes are the [`Rect`] and circle (center + radius) of [`crate::math`]. Overlap tests
+//! return a [`Contact`] saying how to separate the shapes; ray and sweep tests return a [`Hit`]
+//! with the time of impact along the motion. [`move_aabb`] is the usual platformer step: move a
+//! box through solid tiles, stopping flush against them and reporting which axes were blocked.
+//!
+//! ```ignore
+//! let moved = collide::move_aabb(player, velocity * dt, level.solids_near(player));
+//! player = moved.rect;
+//! if moved.blocked_y && velocity.y > 0.0 {
+//!     on_ground = true;
+//! }
+//! if moved.blocked_x || moved.blocked_y {
+//!     velocity = moved.velocity(velocity);
+//! }
+//! ```
+//!
+//! Nothing here allocates except [`SpatialHash`], which keeps its buffers across
+//! [`SpatialHash::clear`] so a per-frame rebuild reuses them.
+
+use alloc::vec::Vec;
+
+use crate::math::{Rect, Vec2, floor, sqrt};
+
+/// How to separate two overlapping shapes: move the first by `normal * depth`.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Contact {
+    /// Unit vector pointing from the second shape towards the first.
+    pub normal: Vec2,
+    /// Overlap along `normal`, in pixels.
+    pub depth: f32,
+}
+
+/// Where a moving point or shape first touches a target.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Hit {
+    /// Fraction of the motion completed at impact, `0.0..=1.0`.
+    pub time: f32,
+    /// The point of impact (for sweeps, the moving box's top-left corner at impact).
+    pub point: Vec2,
+    /// Unit surface normal of the target at the point of impact.
+    pub normal: Vec2,
+}
+
+/// Overlap of two boxes, separated along the axis of least overlap. Touching edges don't count.
+pub fn aabb_aabb(a: Rect, b: Rect) -> Option<Contact> {
+    let push = a.penetration(b)?;
+    let depth = push.x.abs() + push.y.abs();
+    Some(Contact {
+        normal: push / depth,
+        depth,
+    })
+}
+
+/// Overlap of two circles. Concentric circles separate upwards.
+pub fn circle_circle(a: Vec2, ra: f32, b: Vec2, rb: f32) -> Option<Contact> {
+    let d = a - b;
+    let r = ra + rb;
+    let dist_sq = d.length_squared();
+    if dist_sq >= r * r {
+        return None;
+    }
+    let dist = sqrt(dist_sq);
+    Some(Contact {
+        normal: if dist > 0.0 { d / dist } else { Vec2::UP },
+        depth: r - dist,
+    })
+}
+
+/// Overlap of a circle and a box; the contact moves the circle out of the box.
+pub fn circle_aabb(center: Vec2, r: f32, rect: Rect) -> Option<Contact> {
+    let nearest = rect.clamp_point(center);
+    let d = center - nearest;
+    let dist_sq = d.length_squared();
+    if dist_sq > 0.0 {
+        if dist_sq >= r * r {
+            return None;
+        }
+        let dist = sqrt(dist_sq);
+        return Some(Contact {
+            normal: d / dist,
+            depth: r - dist,
+        });
+    }
+    // The center is inside the box: leave through the nearest edge.
+    let exits = [
+        (center.x - rect.left(), Vec2::LEFT),
+        (rect.right() - center.x, Vec2::RIGHT),
+        (center.y - rect.top(), Vec2::UP),
+        (rect.bottom() - center.y, Vec2::DOWN),
+    ];
+    let (dist, normal) = exits
+        .into_iter()
+        .fold(exits[0], |best, e| if e.0 < best.0 { e } else { best });
+    Some(Contact {
+        normal,
+        depth: dist + r,
+    })
+}
+
+/// First point where the segment `from..to` enters `rect`. A segment starting inside the box,
+/// or only sliding along an edge, doesn't hit.
+pub fn segment_aabb(from: Vec2, to: Vec2, rect: Rect) -> Option<Hit> {
+    let d = to - from;
+    let mut t_near = f32::NEG_INFINITY;
+    let mut t_far = f32::INFINITY;
+    let mut normal = Vec2::ZERO;
+    let axes = [
+        (from.x, d.x, rect.left(), rect.right(), Vec2::RIGHT),
+        (from.y, d.y, rect.top(), rect.bottom(), Vec2::DOWN),
+    ];
+    for (origin, dir, min, max, axis) in axes {
+        if dir == 0.0 {
+            if origin <= min || origin >= max {
+                return None;
+            }
+            continue;
+        }
+        let (mut t1, mut t2) = ((min - origin) / dir, (max - origin) / dir);
+        if t1 > t2 {
+            core::mem::swap(&mut t1, &mut t2);
+        }
+        if t1 > t_near {
+            t_near = t1;
+            normal = if dir > 0.0 { -axis } else { axis };
+        }
+        t_far = t_far.min(t2);
+    }
+    if t_near >= t_far || !(0.0..=1.0).contains(&t_near) {
+        return None;
+    }
+    Some(Hit {
+        time: t_near,
+        point: from + d * t_near,
+        normal,
+    })
+}
+
+/// First point where the segment `from..to` enters the circle. A segment starting inside the
+/// circle doesn't hit.
+pub fn segment_circle(from: Vec2, to: Vec2, center: Vec2, r: f32) -> Option<Hit> {
+    let d = to - from;
+    let f = from - center;
+    let a = d.length_squared();
+    let c = f.length_squared() - r * r;
+    if a == 0.0 || c <= 0.0 {
+        return None;
+    }
+    let b = f.dot(d);
+    let disc = b * b - a * c;
+    if disc < 0.0 {
+        return None;
+    }
+    let t = (-b - sqrt(disc)) / a;
+    if !(0.0..=1.0).contains(&t) {
+        return None;
+    }
+    let point = from + d * t;
+    Some(Hit {
+        time: t,
+        point,
+        normal: (point - center).normalize(),
+    })
+}
+
+/// When `moving`, travelling by `delta`, first touches `target`. Boxes that already overlap, or
+/// that only slide along each other's edges, don't hit.
+pub fn sweep_aabb(moving: Rect, delta: Vec2, target: Rect) -> Option<Hit> {
+    // Shrink `moving` to its top-left corner and grow `target` by its size.
+    let expanded = Rect::new(
+        target.x - moving.w,
+        target.y - moving.h,
+        target.w + moving.w,
+        target.h + moving.h,
+    );
+    let from = moving.position();
+    segment_aabb(from, from + delta, expanded)
+}
+
+/// Result of [`move_aabb`].
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Move {
+    /// The box after moving.
+    pub rect: Rect,
+    /// A solid stopped horizontal motion.
+    pub blocked_x: bool,
+    /// A solid stopped vertical motion (landed, or bumped a ceiling).
+    pub blocked_y: bool,
+}
+
+impl Move {
+    /// `velocity` with the blocked components zeroed.
+    pub fn velocity(&self, velocity: Vec2) -> Vec2 {
+        Vec2::new(
+            if self.blocked_x { 0.0 } else { velocity.x },
+            if self.blocked_y { 0.0 } else { velocity.y },
+        )
+    }
+}
+
+/// Move `rect` by `delta` through `solids`, one axis at a time (x, then y), stopping flush
+/// against the first solid on each axis. Solids the box already overlaps are ignored, so a box
+/// can't get stuck inside one.
+pub fn move_aabb<I>(rect: Rect, delta: Vec2, solids: I) -> Move
+where
+    I: IntoIterator<Item = Rect>,
+    I::IntoIter: Clone,
+{
+    let solids = solids.into_iter();
+    let mut rect = rect;
+    let mut blocked = [false; 2];
+    for (axis, step) in [Vec2::new(delta.x, 0.0), Vec2::new(0.0, delta.y)]
+        .into_iter()
+        .enumerate()
+    {
+        if step == Vec2::ZERO {
+            continue;
+        }
+        let first = solids
+            .clone()
+            .filter_map(|solid| sweep_aabb(rect, step, solid))
+            .map(|hit| hit.time)
+            .reduce(f32::min);
+        blocked[axis] = first.is_some();
+        rect = rect.translate(step * first.unwrap_or(1.0));
+    }
+    Move {
+        rect,
+        blocked_x: blocked[0],
+        blocked_y: blocked[1],
+    }
+}
+
+/// A uniform grid hashed into a fixed number of buckets, for finding the boxes near an area
+/// without testing every pair.
+///
+/// Rebuild it each frame with [`clear`](Self::clear) and [`insert`](Self::insert), then
+/// [`query`](Self::query) candidates. Buffers are kept between frames, so a steady scene stops
+/// allocating after the first few.
+#[derive(Clone, Debug)]
+pub struct SpatialHash {
+    cell_size: f32,
+    /// Indices into `items`, per bucket.
+    buckets: Vec<Vec<u32>>,
+    items: Vec<(u32, Rect)>,
+    /// Query generation at which each item was last reported, to report it once.
+    seen: Vec<u32>,
+    generation: u32,
+}
+
+impl SpatialHash {
+    /// A grid of `cell_size`-pixel cells spread over `buckets` buckets (rounded up to a power of
+    /// two). Cells about the size of the typical object work best.
+    pub fn new(cell_size: f32, buckets: usize) -> Self {
+        let count = buckets.max(1).next_power_of_two();
+        Self {
+            cell_size: if cell_size > 0.0 { cell_size } else { 1.0 },
+            buckets: (0..count).map(|_| Vec::new()).collect(),
+            items: Vec::new(),
+            seen: Vec::new(),
+            generation: 0,
+        }
+    }
+
+    /// Remove every item, keeping the allocated buffers.
+    pub fn clear(&mut self) {
+        for bucket in &mut self.buckets {
+            bucket.clear();
+        }
+        self.items.clear();
+        self.seen.clear();
+    }
+
+    pub fn len(&self) -> usize {
+        self.items.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.items.is_empty()
+    }
+
+    /// Add a box under a caller-chosen `id` (an entity index, say).
+    pub fn insert(&mut self, id: u32, bounds: Rect) {
+        let index = self.items.len() as u32;
+        self.items.push((id, bounds));
+        self.seen.push(self.generation);
+        self.for_each_bucket(bounds, |bucket| {
+            if bucket.last() != Some(&index) {
+                bucket.push(index);
+            }
+        });
+    }
+
+    /// Append to `out` the id of every item whose box overlaps `area`, each once.
+    pub fn query(&mut self, area: Rect, out: &mut Vec<u32>) {
+        self.generation = self.generation.wrapping_add(1);
+        if self.generation == 0 {
+            // Wrapped around: forget old marks so none collides with the new generation.
+            self.seen.iter_mut().for_each(|s| *s = 0);
+            self.generation = 1;
+        }
+        let generation = self.generation;
+        let (items, seen) = (&self.items, &mut self.seen);
+        let mut visit = |bucket: &Vec<u32>| {
+            for &index in bucket {
+                let (id, bounds) = items[index as usize];
+                if seen[index as usize] != generation && bounds.intersects(area) {
+                    seen[index as usize] = generation;
+                    out.push(id);
+                }
+            }
+        };
+        match cell_range(self.cell_size, area) {
+            Some((x0, y0, x1, y1)) if cell_count(x0, y0, x1, y1) < self.buckets.len() => {
+                for cy in y0..=y1 {
+                    for cx in x0..=x1 {
+                        visit(&self.buckets[bucket_index(cx, cy, self.buckets.len())]);
+                    }
+                }
+            }
+            _ => self.buckets.iter().for_each(visit),
+        }
+    }
+
+    /// Call `f` with every bucket the cells under `bounds` hash to.
+    fn for_each_bucket(&mut self, bounds: Rect, mut f: impl FnMut(&mut Vec<u32>)) {
+        let count = self.buckets.len();
+        match cell_range(self.cell_size, bounds) {
+            Some((x0, y0, x1, y1)) if cell_count(x0, y0, x1, y1) < count => {
+                for cy in y0..=y1 {
+                    for cx in x0..=x1 {
+                        f(&mut self.buckets[bucket_index(cx, cy, count)]);
+                    }
+                }
+            }
+            _ => self.buckets.iter_mut().for_each(f),
+        }
+    }
+}
+
+/// Inclusive cell coordinates covered by `r`, or `None` if they don't fit an `i32`.
+fn cell_range(cell_size: f32, r: Rect) -> Option<(i32, i32, i32, i32)> {
+    let cell = |v: f32| {
+        let c = floor(v / cell_size);
+        (c.is_finite() && c.abs() < i32::MAX as f32).then_some(c as i32)
+    };
+    Some((
+        cell(r.left())?,
+        cell(r.top())?,
+        cell(r.right())?,
+        cell(r.bottom())?,
+    ))
+}
+
+fn cell_count(x0: i32, y0: i32, x1: i32, y1: i32) -> usize {
+    let w = (x1 as i64 - x0 as i64 + 1).max(0) as u64;
+    let h = (y1 as i64 - y0 as i64 + 1).max(0) as u64;
+    w.saturating_mul(h).min(usize::MAX as u64) as usize
+}
+
+fn bucket_index(cx: i32, cy: i32, count: usize) -> usize {
+    let h = (cx as u32).wrapping_mul(0x9E37_79B1) ^ (cy as u32).wrapping_mul(0x85EB_CA77);
+    h as usize & (count - 1)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn close(a: Vec2, b: Vec2) -> bool {
+        (a - b).length() < 1e-4
+    }
+
+    #[test]
+    fn overlap_contacts() {
+        let c = aabb_aabb(
+            Rect::new(0.0, 0.0, 10.0, 10.0),
+            Rect::new(8.0, 0.0, 10.0, 10.0),
+        );
+        assert_eq!(
+            c,
+            Some(Contact {
+                normal: Vec2::LEFT,
+                depth: 2.0
+            })
+        );
+
+        let c = circle_circle(Vec2::new(3.0, 0.0), 2.0, Vec2::ZERO, 2.0).unwrap();
+        assert!(close(c.normal, Vec2::RIGHT) && (c.depth - 1.0).abs() < 1e-4);
+        assert_eq!(
+            circle_circle(Vec2::new(4.0, 0.0), 2.0, Vec2::ZERO, 2.0),
+            None
+        );
+
+        let wall = Rect::new(0.0, 0.0, 10.0, 10.0);
+        let c = circle_aabb(Vec2::new(5.0, 12.0), 3.0, wall).unwrap();
+        assert!(close(c.normal, Vec2::DOWN) && (c.depth - 1.0).abs() < 1e-4);
+        let c = circle_aabb(Vec2::new(9.0, 5.0), 1.0, wall).unwrap();
+        assert_eq!((c.normal, c.depth), (Vec2::RIGHT, 2.0));
+    }
+
+    #[test]
+    fn segments_hit_boxes_and_circles() {
+        let wall = Rect::new(10.0, 0.0, 5.0, 10.0);
+        let hit = segment_aabb(Vec2::new(0.0, 5.0), Vec2::new(20.0, 5.0), wall).unwrap();
+        assert_eq!(
+            (hit.time, hit.point, hit.normal),
+            (0.5, Vec2::new(10.0, 5.0), Vec2::LEFT)
+        );
+        assert_eq!(
+            segment_aabb(Vec2::new(0.0, 5.0), Vec2::new(5.0, 5.0), wall),
+            None
+        );
+        // Sliding along the top edge is not a hit.
+        assert_eq!(segment_aabb(Vec2::ZERO, Vec2::new(20.0, 0.0), wall), None);
+
+        let hit =
+            segment_circle(Vec2::ZERO, Vec2::new(10.0, 0.0), Vec2::new(8.0, 0.0), 2.0).unwrap();
+        assert!((hit.time - 0.6).abs() < 1e-4 && close(hit.normal, Vec2::LEFT));
+    }
+
+    #[test]
+    fn platformer_step_lands_flush() {
+        let floor = Rect::new(0.0, 20.0, 100.0, 10.0);
+        let wall = Rect::new(30.0, 0.0, 10.0, 20.0);
+        let player = Rect::new(10.0, 10.0, 8.0, 8.0);
+
+        let moved = move_aabb(player, Vec2::new(20.0, 5.0), [floor, wall]);
+        assert_eq!(moved.rect, Rect::new(22.0, 12.0, 8.0, 8.0));
+        assert!(moved.blocked_x && moved.blocked_y);
+        assert_eq!(moved.velocity(Vec2::new(3.0, 4.0)), Vec2::ZERO);
+
+        // Standing on the floor, walking isn't blocked by it.
+        let moved = move_aabb(moved.rect, Vec2::new(-5.0, 0.0), [floor, wall]);
+        assert_eq!(moved.rect.x, 17.0);
+        assert!(!moved.blocked_x && !moved.blocked_y);
+    }
+
+    #[test]
+    fn spatial_hash_finds_neighbours_once() {
+        let mut grid = SpatialHash::new(16.0, 8);
+        grid.insert(1, Rect::new(0.0, 0.0, 8.0, 8.0));
+        grid.insert(2, Rect::new(40.0, 40.0, 40.0, 40.0));
+        grid.insert(3, Rect::new(1000.0, 0.0, 4.0, 4.0));
+
+        let mut found = Vec::new();
+        grid.query(Rect::new(4.0, 4.0, 50.0, 50.0), &mut found);
+        found.sort();
+        assert_eq!(found, [1, 2]);
+
+        found.clear();
+        grid.query(Rect::new(-1e9, -1e9, 2e9, 2e9), &mut found);
+        found.sort();
+        assert_eq!(found, [1, 2, 3]);
+
+        grid.clear();
+        found.clear();
+        grid.query(Rect::new(0.0, 0.0, 10.0, 10.0), &mut found);
+        assert!(found.is_empty() && grid.is_empty());
+    }
+}
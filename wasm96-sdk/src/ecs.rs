@@ -0,0 +1,362 @@
+//! A small entity-component registry for carts that outgrow a handful of global `Vec`s.
+//!
+//! [`World`] hands out [`Entity`] ids; each component type lives in its own [`Storage`], a
+//! sparse set the cart owns as a plain field. No `Any`, no type maps: a "query" is iterating
+//! one storage and looking entities up in others, which the borrow checker is happy with
+//! because every storage is a separate value:
+//!
+//! ```ignore
+//! struct Game {
+//!     world: World,
+//!     pos: Storage<Vec2>,
+//!     vel: Storage<Vec2>,
+//! }
+//!
+//! // spawn
+//! let e = game.world.spawn();
+//! game.pos.insert(e, Vec2::new(10.0, 10.0));
+//! game.vel.insert(e, Vec2::RIGHT);
+//!
+//! // system
+//! for (_, p, v) in game.pos.join_mut(&game.vel) {
+//!     *p += *v * dt;
+//! }
+//! ```
+//!
+//! Changes made while iterating are deferred: [`World::despawn_later`],
+//! [`Storage::insert_later`] and [`Storage::remove_later`] queue them, and they apply at the
+//! end of the tick with [`World::flush`] followed by [`Storage::flush`] on every storage (which
+//! also drops components of despawned entities).
+
+use alloc::vec::Vec;
+
+/// An entity id. The generation makes ids of despawned entities stop matching once their slot
+/// is reused.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, Hash, PartialOrd, Ord)]
+pub struct Entity {
+    pub index: u32,
+    pub generation: u32,
+}
+
+/// Allocates entity ids and tracks which are alive.
+#[derive(Clone, Debug, Default)]
+pub struct World {
+    generations: Vec<u32>,
+    alive: Vec<bool>,
+    free: Vec<u32>,
+    doomed: Vec<Entity>,
+    /// Bumped whenever an entity is despawned, so storages know when to sweep.
+    despawns: u32,
+}
+
+impl World {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// A new live entity, reusing a despawned slot when there is one.
+    pub fn spawn(&mut self) -> Entity {
+        if let Some(index) = self.free.pop() {
+            let i = index as usize;
+            self.alive[i] = true;
+            return Entity {
+                index,
+                generation: self.generations[i],
+            };
+        }
+        let index = self.generations.len() as u32;
+        self.generations.push(0);
+        self.alive.push(true);
+        Entity {
+            index,
+            generation: 0,
+        }
+    }
+
+    pub fn is_alive(&self, e: Entity) -> bool {
+        let i = e.index as usize;
+        self.alive.get(i).copied().unwrap_or(false) && self.generations[i] == e.generation
+    }
+
+    /// Despawn `e` now. Returns `false` if it was already gone. Storages drop its components at
+    /// their next [`Storage::flush`].
+    pub fn despawn(&mut self, e: Entity) -> bool {
+        if !self.is_alive(e) {
+            return false;
+        }
+        let i = e.index as usize;
+        self.alive[i] = false;
+        self.generations[i] = self.generations[i].wrapping_add(1);
+        self.free.push(e.index);
+        self.despawns = self.despawns.wrapping_add(1);
+        true
+    }
+
+    /// Despawn `e` at the next [`World::flush`]; safe to call while iterating.
+    pub fn despawn_later(&mut self, e: Entity) {
+        self.doomed.push(e);
+    }
+
+    /// Apply queued despawns.
+    pub fn flush(&mut self) {
+        let doomed = core::mem::take(&mut self.doomed);
+        for &e in &doomed {
+            self.despawn(e);
+        }
+        self.doomed = doomed;
+        self.doomed.clear();
+    }
+
+    /// Number of live entities.
+    pub fn len(&self) -> usize {
+        self.alive.len() - self.free.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.len() == 0
+    }
+
+    /// All live entities, in slot order.
+    pub fn iter(&self) -> impl Iterator<Item = Entity> + '_ {
+        self.alive
+            .iter()
+            .enumerate()
+            .filter(|&(_, &alive)| alive)
+            .map(|(i, _)| Entity {
+                index: i as u32,
+                generation: self.generations[i],
+            })
+    }
+}
+
+const EMPTY: u32 = u32::MAX;
+
+/// Components of one type, keyed by entity. Lookups are O(1) and iteration walks a packed
+/// array, in no particular order.
+#[derive(Clone, Debug)]
+pub struct Storage<T> {
+    /// Entity index to position in `dense`, or `EMPTY`.
+    sparse: Vec<u32>,
+    dense: Vec<Entity>,
+    data: Vec<T>,
+    pending: Vec<(Entity, Option<T>)>,
+    /// `World::despawns` at the last sweep.
+    swept: u32,
+}
+
+impl<T> Default for Storage<T> {
+    fn default() -> Self {
+        Self {
+            sparse: Vec::new(),
+            dense: Vec::new(),
+            data: Vec::new(),
+            pending: Vec::new(),
+            swept: 0,
+        }
+    }
+}
+
+impl<T> Storage<T> {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    fn slot(&self, e: Entity) -> Option<usize> {
+        let slot = *self.sparse.get(e.index as usize)?;
+        (slot != EMPTY && self.dense[slot as usize] == e).then_some(slot as usize)
+    }
+
+    /// Attach `value` to `e`, returning the component it replaced.
+    pub fn insert(&mut self, e: Entity, value: T) -> Option<T> {
+        if let Some(slot) = self.slot(e) {
+            return Some(core::mem::replace(&mut self.data[slot], value));
+        }
+        let i = e.index as usize;
+        if i >= self.sparse.len() {
+            self.sparse.resize(i + 1, EMPTY);
+        }
+        // A component left over from an earlier generation of this slot is replaced.
+        let stale = self.sparse[i];
+        if stale != EMPTY {
+            self.dense[stale as usize] = e;
+            self.data[stale as usize] = value;
+            return None;
+        }
+        self.sparse[i] = self.dense.len() as u32;
+        self.dense.push(e);
+        self.data.push(value);
+        None
+    }
+
+    pub fn remove(&mut self, e: Entity) -> Option<T> {
+        let slot = self.slot(e)?;
+        Some(self.remove_slot(slot))
+    }
+
+    fn remove_slot(&mut self, slot: usize) -> T {
+        let e = self.dense.swap_remove(slot);
+        self.sparse[e.index as usize] = EMPTY;
+        if let Some(moved) = self.dense.get(slot) {
+            self.sparse[moved.index as usize] = slot as u32;
+        }
+        self.data.swap_remove(slot)
+    }
+
+    pub fn get(&self, e: Entity) -> Option<&T> {
+        self.slot(e).map(|slot| &self.data[slot])
+    }
+
+    pub fn get_mut(&mut self, e: Entity) -> Option<&mut T> {
+        self.slot(e).map(|slot| &mut self.data[slot])
+    }
+
+    pub fn contains(&self, e: Entity) -> bool {
+        self.slot(e).is_some()
+    }
+
+    pub fn len(&self) -> usize {
+        self.dense.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.dense.is_empty()
+    }
+
+    pub fn clear(&mut self) {
+        self.sparse.clear();
+        self.dense.clear();
+        self.data.clear();
+        self.pending.clear();
+    }
+
+    /// Entities that have this component.
+    pub fn entities(&self) -> &[Entity] {
+        &self.dense
+    }
+
+    pub fn iter(&self) -> impl Iterator<Item = (Entity, &T)> {
+        self.dense.iter().copied().zip(self.data.iter())
+    }
+
+    pub fn iter_mut(&mut self) -> impl Iterator<Item = (Entity, &mut T)> {
+        self.dense.iter().copied().zip(self.data.iter_mut())
+    }
+
+    /// Entities with a component here and in `other`.
+    pub fn join<'a, U>(
+        &'a self,
+        other: &'a Storage<U>,
+    ) -> impl Iterator<Item = (Entity, &'a T, &'a U)> {
+        self.iter().filter_map(|(e, a)| Some((e, a, other.get(e)?)))
+    }
+
+    /// Like [`Storage::join`], with this storage's components mutable.
+    pub fn join_mut<'a, U>(
+        &'a mut self,
+        other: &'a Storage<U>,
+    ) -> impl Iterator<Item = (Entity, &'a mut T, &'a U)> {
+        self.iter_mut()
+            .filter_map(|(e, a)| Some((e, a, other.get(e)?)))
+    }
+
+    /// Attach `value` to `e` at the next [`Storage::flush`].
+    pub fn insert_later(&mut self, e: Entity, value: T) {
+        self.pending.push((e, Some(value)));
+    }
+
+    /// Remove `e`'s component at the next [`Storage::flush`].
+    pub fn remove_later(&mut self, e: Entity) {
+        self.pending.push((e, None));
+    }
+
+    /// Apply queued inserts and removes in the order they were made, then drop components of
+    /// entities `world` no longer has. Call after [`World::flush`].
+    pub fn flush(&mut self, world: &World) {
+        let mut pending = core::mem::take(&mut self.pending);
+        for (e, value) in pending.drain(..) {
+            match value {
+                Some(value) if world.is_alive(e) => {
+                    self.insert(e, value);
+                }
+                Some(_) => {}
+                None => {
+                    self.remove(e);
+                }
+            }
+        }
+        self.pending = pending;
+
+        if self.swept != world.despawns {
+            self.swept = world.despawns;
+            let mut slot = 0;
+            while slot < self.dense.len() {
+                if world.is_alive(self.dense[slot]) {
+                    slot += 1;
+                } else {
+                    self.remove_slot(slot);
+                }
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloc::vec;
+
+    #[test]
+    fn ids_are_generational() {
+        let mut world = World::new();
+        let a = world.spawn();
+        let b = world.spawn();
+        assert!(world.despawn(a));
+        assert!(!world.despawn(a));
+        let c = world.spawn();
+        assert_eq!(c.index, a.index);
+        assert!(!world.is_alive(a));
+        assert!(world.is_alive(c));
+        assert_eq!(world.iter().collect::<Vec<_>>(), vec![c, b]);
+        assert_eq!(world.len(), 2);
+    }
+
+    #[test]
+    fn storage_joins_and_sweeps() {
+        let mut world = World::new();
+        let mut pos: Storage<i32> = Storage::new();
+        let mut vel: Storage<i32> = Storage::new();
+        let a = world.spawn();
+        let b = world.spawn();
+        pos.insert(a, 0);
+        pos.insert(b, 10);
+        vel.insert(b, 5);
+        for (_, p, v) in pos.join_mut(&vel) {
+            *p += *v;
+        }
+        assert_eq!(pos.get(a), Some(&0));
+        assert_eq!(pos.get(b), Some(&15));
+
+        // Deferred changes made mid-iteration land at flush.
+        for (e, _) in pos.iter() {
+            if e == a {
+                world.despawn_later(e);
+            }
+        }
+        vel.insert_later(b, 7);
+        assert!(world.is_alive(a));
+        world.flush();
+        pos.flush(&world);
+        vel.flush(&world);
+        assert!(!pos.contains(a));
+        assert_eq!(vel.get(b), Some(&7));
+
+        // A reused slot doesn't inherit the old entity's component.
+        let c = world.spawn();
+        assert_eq!(c.index, a.index);
+        assert_eq!(pos.get(c), None);
+        pos.insert(c, 1);
+        pos.remove_later(c);
+        pos.flush(&world);
+        assert_eq!(pos.len(), 1);
+    }
+}
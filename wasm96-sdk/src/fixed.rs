@@ -0,0 +1,416 @@
+//! Deterministic Q16.16 fixed-point math, for game state that must match bit for bit across
+//! machines (lockstep or rollback netplay, replays checked by hash).
+//!
+//! Float results can differ between platforms, compilers and the approximations in
+//! [`crate::math`]. [`Fixed`] only uses integer arithmetic, so the same inputs always give the
+//! same bits. Its range is about ±32768 with a resolution of 1/65536. Arithmetic saturates at
+//! [`Fixed::MIN`]/[`Fixed::MAX`] instead of wrapping, and division by zero saturates too.
+//!
+//! Trigonometry reads a 1024-step sine table built at compile time with integer arithmetic,
+//! interpolating linearly between steps (error under 4e-5). [`Fixed::atan2`] uses 16 CORDIC
+//! iterations (error around 3e-5 rad).
+//!
+//! Keep `Fixed` values in the simulation and convert with [`Fixed::to_f32`] only for drawing.
+//! Build constants with [`Fixed::from_int`] or [`Fixed::from_ratio`], not from floats.
+
+use core::ops::{Add, AddAssign, Div, DivAssign, Mul, MulAssign, Neg, Sub, SubAssign};
+
+/// Fractional bits.
+pub const FRAC_BITS: u32 = 16;
+
+/// A Q16.16 fixed-point number.
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq, PartialOrd, Ord, Hash)]
+pub struct Fixed(i32);
+
+/// Sine steps per quarter turn.
+const QUARTER: usize = 256;
+/// Sine steps per full turn.
+const STEPS: i64 = 4 * QUARTER as i64;
+
+/// Sine of `i / QUARTER` of a quarter turn for `i` in `0..=QUARTER`, in Q16.16.
+const SIN_TABLE: [i32; QUARTER + 1] = build_sin_table();
+
+const fn build_sin_table() -> [i32; QUARTER + 1] {
+    // π/2 in Q30.
+    const HALF_PI_Q30: i64 = 1_686_629_713;
+    let mut table = [0i32; QUARTER + 1];
+    let mut i = 0;
+    while i <= QUARTER {
+        // Taylor series in Q30; x <= π/2, so eight terms are exact to Q30 precision.
+        let x = HALF_PI_Q30 * i as i64 / QUARTER as i64;
+        let mut term = x;
+        let mut sum = x;
+        let mut k = 1;
+        while k <= 8 {
+            term = (term * x) >> 30;
+            term = (term * x) >> 30;
+            term = -term / ((2 * k) * (2 * k + 1));
+            sum += term;
+            k += 1;
+        }
+        table[i] = ((sum + (1 << 13)) >> 14) as i32;
+        i += 1;
+    }
+    table
+}
+
+/// `atan(2^-i)` in Q16.16 radians, for CORDIC.
+const ATAN_TABLE: [i64; 16] = [
+    51472, 30386, 16055, 8150, 4091, 2047, 1024, 512, 256, 128, 64, 32, 16, 8, 4, 2,
+];
+
+fn saturate(v: i64) -> Fixed {
+    Fixed(v.clamp(i32::MIN as i64, i32::MAX as i64) as i32)
+}
+
+/// Integer square root (floor).
+fn isqrt(n: u128) -> u128 {
+    let mut op = n;
+    let mut res = 0u128;
+    let mut one = 1u128 << 126;
+    while one > op {
+        one >>= 2;
+    }
+    while one != 0 {
+        if op >= res + one {
+            op -= res + one;
+            res = (res >> 1) + one;
+        } else {
+            res >>= 1;
+        }
+        one >>= 2;
+    }
+    res
+}
+
+impl Fixed {
+    pub const ZERO: Fixed = Fixed(0);
+    pub const ONE: Fixed = Fixed(1 << FRAC_BITS);
+    pub const HALF: Fixed = Fixed(1 << (FRAC_BITS - 1));
+    /// The smallest positive value, 1/65536.
+    pub const EPSILON: Fixed = Fixed(1);
+    pub const MAX: Fixed = Fixed(i32::MAX);
+    pub const MIN: Fixed = Fixed(i32::MIN);
+    pub const PI: Fixed = Fixed(205_887);
+    pub const HALF_PI: Fixed = Fixed(102_944);
+    pub const TAU: Fixed = Fixed(411_775);
+
+    /// The value whose raw Q16.16 representation is `bits`.
+    pub const fn from_bits(bits: i32) -> Fixed {
+        Fixed(bits)
+    }
+
+    /// The raw Q16.16 representation, for hashing or sending over the network.
+    pub const fn to_bits(self) -> i32 {
+        self.0
+    }
+
+    /// `n` as a fixed-point value (saturating outside ±32767).
+    pub const fn from_int(n: i32) -> Fixed {
+        let v = (n as i64) << FRAC_BITS;
+        if v > i32::MAX as i64 {
+            Fixed::MAX
+        } else if v < i32::MIN as i64 {
+            Fixed::MIN
+        } else {
+            Fixed(v as i32)
+        }
+    }
+
+    /// `num / den`, rounded toward zero; e.g. `from_ratio(3, 2)` is 1.5. Saturates when `den`
+    /// is 0.
+    pub const fn from_ratio(num: i32, den: i32) -> Fixed {
+        if den == 0 {
+            return if num < 0 { Fixed::MIN } else { Fixed::MAX };
+        }
+        let v = ((num as i64) << FRAC_BITS) / den as i64;
+        if v > i32::MAX as i64 {
+            Fixed::MAX
+        } else if v < i32::MIN as i64 {
+            Fixed::MIN
+        } else {
+            Fixed(v as i32)
+        }
+    }
+
+    /// Nearest fixed-point value to `v`. Only for values that don't feed back into the
+    /// simulation (UI, tuning); prefer [`Fixed::from_ratio`] for constants.
+    pub fn from_f32(v: f32) -> Fixed {
+        saturate((v * (1 << FRAC_BITS) as f32) as i64)
+    }
+
+    /// For drawing and display.
+    pub fn to_f32(self) -> f32 {
+        self.0 as f32 / (1 << FRAC_BITS) as f32
+    }
+
+    /// Largest integer not greater than `self`.
+    pub const fn to_int(self) -> i32 {
+        self.0 >> FRAC_BITS
+    }
+
+    /// Nearest integer, halves rounding up.
+    pub const fn round_to_int(self) -> i32 {
+        ((self.0 as i64 + (1 << (FRAC_BITS - 1))) >> FRAC_BITS) as i32
+    }
+
+    pub const fn floor(self) -> Fixed {
+        Fixed(self.0 & !((1 << FRAC_BITS) - 1))
+    }
+
+    /// The fractional part, `self - self.floor()` (always non-negative).
+    pub const fn fract(self) -> Fixed {
+        Fixed(self.0 & ((1 << FRAC_BITS) - 1))
+    }
+
+    pub const fn abs(self) -> Fixed {
+        Fixed(self.0.saturating_abs())
+    }
+
+    pub const fn is_negative(self) -> bool {
+        self.0 < 0
+    }
+
+    pub fn min(self, other: Fixed) -> Fixed {
+        Ord::min(self, other)
+    }
+
+    pub fn max(self, other: Fixed) -> Fixed {
+        Ord::max(self, other)
+    }
+
+    /// Clamp to `min..=max`.
+    pub fn clamp(self, min: Fixed, max: Fixed) -> Fixed {
+        self.max(min).min(max)
+    }
+
+    /// Linear interpolation: `self` at `t = 0`, `b` at `t = 1`. `t` is not clamped.
+    pub fn lerp(self, b: Fixed, t: Fixed) -> Fixed {
+        self + (b - self) * t
+    }
+
+    /// Square root; 0 for non-positive values.
+    pub fn sqrt(self) -> Fixed {
+        if self.0 <= 0 {
+            return Fixed::ZERO;
+        }
+        Fixed(isqrt((self.0 as u128) << FRAC_BITS) as i32)
+    }
+
+    /// `sqrt(x² + y²)` without intermediate overflow (saturates at [`Fixed::MAX`]).
+    pub fn hypot(x: Fixed, y: Fixed) -> Fixed {
+        let (x, y) = (x.0 as i128, y.0 as i128);
+        saturate(isqrt((x * x + y * y) as u128) as i64)
+    }
+
+    /// Sine at `phase` sine-table steps in Q16 (`STEPS` steps per turn).
+    fn sin_steps(phase: i64) -> Fixed {
+        let phase = phase.rem_euclid(STEPS << FRAC_BITS);
+        let step = phase >> FRAC_BITS;
+        let frac = phase & ((1 << FRAC_BITS) - 1);
+        let at = |step: i64| -> i64 {
+            let step = step.rem_euclid(STEPS) as usize;
+            let (quadrant, i) = (step / QUARTER, step % QUARTER);
+            match quadrant {
+                0 => SIN_TABLE[i] as i64,
+                1 => SIN_TABLE[QUARTER - i] as i64,
+                2 => -(SIN_TABLE[i] as i64),
+                _ => -(SIN_TABLE[QUARTER - i] as i64),
+            }
+        };
+        let (a, b) = (at(step), at(step + 1));
+        Fixed((a + (((b - a) * frac) >> FRAC_BITS)) as i32)
+    }
+
+    /// Sine-table phase of an angle in radians.
+    fn phase(self) -> i64 {
+        ((self.0 as i64) * (STEPS << FRAC_BITS)).div_euclid(Fixed::TAU.0 as i64)
+    }
+
+    /// Sine of `self` radians.
+    pub fn sin(self) -> Fixed {
+        Fixed::sin_steps(self.phase())
+    }
+
+    /// Cosine of `self` radians.
+    pub fn cos(self) -> Fixed {
+        Fixed::sin_steps(self.phase() + ((QUARTER as i64) << FRAC_BITS))
+    }
+
+    /// Angle of the vector `(x, y)` in radians, in `-PI..=PI`; 0 for the zero vector.
+    pub fn atan2(y: Fixed, x: Fixed) -> Fixed {
+        let (mut x, mut y) = (x.0 as i64, y.0 as i64);
+        if x == 0 && y == 0 {
+            return Fixed::ZERO;
+        }
+        // Rotate into the right half-plane by a quarter turn.
+        let mut angle = 0;
+        if x < 0 {
+            if y >= 0 {
+                (x, y) = (y, -x);
+                angle = Fixed::HALF_PI.0 as i64;
+            } else {
+                (x, y) = (-y, x);
+                angle = -(Fixed::HALF_PI.0 as i64);
+            }
+        }
+        // Scale up so small vectors keep their precision through the shifts.
+        let shift = (x.abs().max(y.abs()).leading_zeros() as i64 - 24).max(0);
+        (x, y) = (x << shift, y << shift);
+        for (i, atan) in ATAN_TABLE.iter().enumerate() {
+            let (dx, dy) = (y >> i, x >> i);
+            if y > 0 {
+                (x, y) = (x + dx, y - dy);
+                angle += atan;
+            } else {
+                (x, y) = (x - dx, y + dy);
+                angle -= atan;
+            }
+        }
+        saturate(angle)
+    }
+}
+
+impl From<i32> for Fixed {
+    fn from(n: i32) -> Fixed {
+        Fixed::from_int(n)
+    }
+}
+
+impl Add for Fixed {
+    type Output = Fixed;
+    fn add(self, rhs: Fixed) -> Fixed {
+        Fixed(self.0.saturating_add(rhs.0))
+    }
+}
+
+impl Sub for Fixed {
+    type Output = Fixed;
+    fn sub(self, rhs: Fixed) -> Fixed {
+        Fixed(self.0.saturating_sub(rhs.0))
+    }
+}
+
+impl Mul for Fixed {
+    type Output = Fixed;
+    fn mul(self, rhs: Fixed) -> Fixed {
+        saturate((self.0 as i64 * rhs.0 as i64) >> FRAC_BITS)
+    }
+}
+
+impl Div for Fixed {
+    type Output = Fixed;
+    fn div(self, rhs: Fixed) -> Fixed {
+        if rhs.0 == 0 {
+            return if self.0 < 0 { Fixed::MIN } else { Fixed::MAX };
+        }
+        saturate(((self.0 as i64) << FRAC_BITS) / rhs.0 as i64)
+    }
+}
+
+impl Neg for Fixed {
+    type Output = Fixed;
+    fn neg(self) -> Fixed {
+        Fixed(self.0.saturating_neg())
+    }
+}
+
+impl AddAssign for Fixed {
+    fn add_assign(&mut self, rhs: Fixed) {
+        *self = *self + rhs;
+    }
+}
+
+impl SubAssign for Fixed {
+    fn sub_assign(&mut self, rhs: Fixed) {
+        *self = *self - rhs;
+    }
+}
+
+impl MulAssign for Fixed {
+    fn mul_assign(&mut self, rhs: Fixed) {
+        *self = *self * rhs;
+    }
+}
+
+impl DivAssign for Fixed {
+    fn div_assign(&mut self, rhs: Fixed) {
+        *self = *self / rhs;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn close(a: Fixed, b: f64, tolerance: f64) -> bool {
+        (a.to_f32() as f64 - b).abs() <= tolerance
+    }
+
+    #[test]
+    fn arithmetic_rounds_and_saturates() {
+        let a = Fixed::from_ratio(3, 2);
+        assert_eq!(a.to_bits(), 98304);
+        assert_eq!((a * a).to_bits(), Fixed::from_ratio(9, 4).to_bits());
+        assert_eq!(Fixed::ONE / Fixed::from_int(4), Fixed::from_ratio(1, 4));
+        assert_eq!(Fixed::from_int(30000) * Fixed::from_int(2), Fixed::MAX);
+        assert_eq!(-Fixed::ONE / Fixed::ZERO, Fixed::MIN);
+        assert_eq!(Fixed::from_int(40000), Fixed::MAX);
+        assert_eq!(Fixed::from_ratio(-3, 2).to_int(), -2);
+        assert_eq!(Fixed::from_ratio(-3, 2).round_to_int(), -1);
+        assert_eq!(Fixed::from_ratio(-3, 2).fract(), Fixed::HALF);
+        assert_eq!(
+            Fixed::ZERO.lerp(Fixed::from_int(10), Fixed::from_ratio(1, 4)),
+            Fixed::from_ratio(5, 2)
+        );
+    }
+
+    #[test]
+    fn sqrt_and_hypot() {
+        assert_eq!(Fixed::from_int(9).sqrt(), Fixed::from_int(3));
+        assert_eq!(Fixed::from_int(-4).sqrt(), Fixed::ZERO);
+        assert!(close(Fixed::from_int(2).sqrt(), 2f64.sqrt(), 2e-5));
+        assert_eq!(
+            Fixed::hypot(Fixed::from_int(3), Fixed::from_int(4)),
+            Fixed::from_int(5)
+        );
+        assert_eq!(Fixed::hypot(Fixed::MAX, Fixed::MAX), Fixed::MAX);
+    }
+
+    #[test]
+    fn trig_matches_floats() {
+        assert_eq!(SIN_TABLE[0], 0);
+        assert_eq!(SIN_TABLE[QUARTER], Fixed::ONE.to_bits());
+        for i in -40..=40 {
+            let rad = Fixed::from_ratio(i, 8);
+            let r = rad.to_f32() as f64;
+            assert!(close(rad.sin(), r.sin(), 4e-5), "sin({r})");
+            assert!(close(rad.cos(), r.cos(), 4e-5), "cos({r})");
+        }
+        assert_eq!(Fixed::ZERO.sin(), Fixed::ZERO);
+        assert_eq!(Fixed::ZERO.cos(), Fixed::ONE);
+        // Same angle, same bits, however it was reached.
+        assert_eq!((Fixed::TAU + Fixed::HALF).sin(), Fixed::HALF.sin());
+    }
+
+    #[test]
+    fn atan2_covers_every_quadrant() {
+        assert_eq!(Fixed::atan2(Fixed::ZERO, Fixed::ZERO), Fixed::ZERO);
+        for (y, x) in [
+            (1, 1),
+            (1, -1),
+            (-1, -1),
+            (-1, 1),
+            (0, -3),
+            (5, 0),
+            (-2, 7),
+            (1, -100),
+        ] {
+            let got = Fixed::atan2(Fixed::from_int(y), Fixed::from_int(x));
+            let want = (y as f64).atan2(x as f64);
+            assert!(close(got, want, 1e-4), "atan2({y}, {x}) = {got:?}");
+        }
+        let tiny = Fixed::atan2(Fixed::EPSILON, Fixed::EPSILON);
+        assert!(close(tiny, core::f64::consts::FRAC_PI_4, 1e-4));
+    }
+}
@@ -0,0 +1,450 @@
+//! Localized text: a key → string table per locale, with plurals and named arguments.
+//!
+//! Tables are plain text, one `key = value` per line. Blank lines and lines starting with `#`
+//! are skipped, and `\n`, `\t` and `\\` in values are escapes. Plural forms are keys with the
+//! CLDR category as a suffix (`.zero`, `.one`, `.two`, `.few`, `.many`, `.other`), and values
+//! name their arguments in braces (`{{` and `}}` are literal braces):
+//!
+//! ```text
+//! # lang/de.lang
+//! title = Weltraumrennen
+//! greeting = Hallo, {name}!
+//! coins.one = {n} Münze
+//! coins.other = {n} Münzen
+//! ```
+//!
+//! Ship tables as bundle assets (one `<locale>.lang` per language in a directory) or embed them
+//! with `include_str!`, then pick the player's language:
+//!
+//! ```ignore
+//! let mut text = I18n::new();
+//! text.load_assets("lang/");
+//! text.add_text("en", include_str!("../lang/en.lang"));
+//! text.set_fallback("en");
+//! text.use_system_locale();
+//!
+//! graphics::text_key(8, 8, "ui", &text.t("title"));
+//! graphics::text_key(8, 24, "ui", &text.format("greeting", &[("name", &player.name)]));
+//! graphics::text_key(8, 40, "ui", &text.plural("coins", player.coins as u64, &[]));
+//! ```
+//!
+//! A key missing from both the current and the fallback table comes back as the key itself, so
+//! untranslated text shows up on screen instead of vanishing.
+
+use alloc::{string::String, string::ToString, vec::Vec};
+use core::fmt::{Display, Write};
+
+use crate::system;
+
+/// A CLDR plural category.
+#[derive(Copy, Clone, Debug, PartialEq, Eq)]
+pub enum Plural {
+    Zero,
+    One,
+    Two,
+    Few,
+    Many,
+    Other,
+}
+
+impl Plural {
+    /// The category of the count `n` in `locale`'s language. Covers the languages libretro
+    /// frontends offer; others use the English rule.
+    pub fn for_count(locale: &str, n: u64) -> Plural {
+        let (n10, n100) = (n % 10, n % 100);
+        let slavic_few = (2..=4).contains(&n10) && !(12..=14).contains(&n100);
+        match language(locale) {
+            "ja" | "zh" | "ko" | "vi" | "id" | "th" | "ms" => Plural::Other,
+            "fr" | "fa" | "hi" if n <= 1 => Plural::One,
+            "pt" if n <= 1 && !locale.eq_ignore_ascii_case("pt-PT") => Plural::One,
+            "fr" | "fa" | "hi" => Plural::Other,
+            "ru" | "uk" | "be" | "pl" if n == 1 => Plural::One,
+            "ru" | "uk" | "be" if n10 == 1 && n100 != 11 => Plural::One,
+            "ru" | "uk" | "be" | "pl" if slavic_few => Plural::Few,
+            "ru" | "uk" | "be" | "pl" => Plural::Many,
+            "cs" | "sk" if (2..=4).contains(&n) => Plural::Few,
+            "ar" => match (n, n100) {
+                (0, _) => Plural::Zero,
+                (1, _) => Plural::One,
+                (2, _) => Plural::Two,
+                (_, 3..=10) => Plural::Few,
+                (_, 11..=99) => Plural::Many,
+                _ => Plural::Other,
+            },
+            "he" if n == 2 => Plural::Two,
+            _ if n == 1 => Plural::One,
+            _ => Plural::Other,
+        }
+    }
+
+    /// The key suffix for this category, without the dot.
+    pub fn suffix(self) -> &'static str {
+        match self {
+            Plural::Zero => "zero",
+            Plural::One => "one",
+            Plural::Two => "two",
+            Plural::Few => "few",
+            Plural::Many => "many",
+            Plural::Other => "other",
+        }
+    }
+}
+
+/// The language subtag of a BCP-47 tag (`"pt"` for `"pt-BR"`).
+fn language(locale: &str) -> &str {
+    locale.split(['-', '_']).next().unwrap_or(locale)
+}
+
+/// One locale's key → string table.
+#[derive(Clone, Debug, Default, PartialEq)]
+pub struct Catalog {
+    /// Sorted by key.
+    entries: Vec<(String, String)>,
+}
+
+impl Catalog {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Read a table in the format described in the module docs. Lines without `=` are
+    /// skipped; a repeated key keeps its last value.
+    pub fn parse(text: &str) -> Self {
+        let mut catalog = Self::new();
+        for line in text.lines() {
+            let line = line.trim_start();
+            if line.is_empty() || line.starts_with('#') {
+                continue;
+            }
+            if let Some((key, value)) = line.split_once('=') {
+                catalog.insert(key.trim(), &unescape(value.trim()));
+            }
+        }
+        catalog
+    }
+
+    /// Set `key` to `value`.
+    pub fn insert(&mut self, key: &str, value: &str) {
+        match self.entries.binary_search_by(|(k, _)| k.as_str().cmp(key)) {
+            Ok(i) => self.entries[i].1 = value.to_string(),
+            Err(i) => self.entries.insert(i, (key.to_string(), value.to_string())),
+        }
+    }
+
+    /// The string under `key`.
+    pub fn get(&self, key: &str) -> Option<&str> {
+        let i = self
+            .entries
+            .binary_search_by(|(k, _)| k.as_str().cmp(key))
+            .ok()?;
+        Some(&self.entries[i].1)
+    }
+
+    pub fn len(&self) -> usize {
+        self.entries.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.entries.is_empty()
+    }
+}
+
+fn unescape(value: &str) -> String {
+    let mut out = String::with_capacity(value.len());
+    let mut chars = value.chars();
+    while let Some(c) = chars.next() {
+        if c != '\\' {
+            out.push(c);
+            continue;
+        }
+        match chars.next() {
+            Some('n') => out.push('\n'),
+            Some('t') => out.push('\t'),
+            Some(other) => out.push(other),
+            None => out.push('\\'),
+        }
+    }
+    out
+}
+
+/// Replace each `{name}` in `template` with the matching argument. Unknown names are left as
+/// written; `{{` and `}}` are literal braces.
+pub fn format(template: &str, args: &[(&str, &dyn Display)]) -> String {
+    let mut out = String::with_capacity(template.len());
+    let mut rest = template;
+    while let Some(i) = rest.find(['{', '}']) {
+        out.push_str(&rest[..i]);
+        let tail = &rest[i..];
+        if tail.starts_with("{{") || tail.starts_with("}}") {
+            out.push_str(&tail[..1]);
+            rest = &tail[2..];
+            continue;
+        }
+        let arg = tail
+            .strip_prefix('{')
+            .and_then(|t| t.split_once('}'))
+            .and_then(|(name, after)| {
+                let (_, value) = args.iter().find(|(n, _)| *n == name)?;
+                Some((value, after))
+            });
+        match arg {
+            Some((value, after)) => {
+                let _ = write!(out, "{value}");
+                rest = after;
+            }
+            None => {
+                out.push_str(&tail[..1]);
+                rest = &tail[1..];
+            }
+        }
+    }
+    out.push_str(rest);
+    out
+}
+
+/// Tables for several locales, a current one, and a fallback for keys it lacks.
+#[derive(Clone, Debug, Default)]
+pub struct I18n {
+    catalogs: Vec<(String, Catalog)>,
+    current: Option<usize>,
+    fallback: Option<usize>,
+}
+
+impl I18n {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Add `catalog` for `locale`, merged into any table the locale already has. The first
+    /// locale added becomes current until [`I18n::set_locale`] picks another.
+    pub fn add(&mut self, locale: &str, catalog: Catalog) {
+        match self.index(locale) {
+            Some(i) => {
+                for (key, value) in catalog.entries {
+                    self.catalogs[i].1.insert(&key, &value);
+                }
+            }
+            None => {
+                self.catalogs.push((locale.to_string(), catalog));
+                self.current.get_or_insert(self.catalogs.len() - 1);
+            }
+        }
+    }
+
+    /// [`I18n::add`] a table written in the text format, e.g. from `include_str!`.
+    pub fn add_text(&mut self, locale: &str, text: &str) {
+        self.add(locale, Catalog::parse(text));
+    }
+
+    /// Add every `<locale>.lang` bundle asset directly in `dir` (e.g. `"lang/"`). Returns how
+    /// many tables were loaded.
+    pub fn load_assets(&mut self, dir: &str) -> usize {
+        let mut loaded = 0;
+        for path in system::asset_list(dir) {
+            let Some(name) = path
+                .strip_prefix(dir)
+                .and_then(|name| name.strip_suffix(".lang"))
+            else {
+                continue;
+            };
+            if name.contains('/') {
+                continue;
+            }
+            if let Some(bytes) = system::asset_read(&path) {
+                self.add_text(name, &String::from_utf8_lossy(&bytes));
+                loaded += 1;
+            }
+        }
+        loaded
+    }
+
+    /// Locales with a table, in the order they were added.
+    pub fn locales(&self) -> impl Iterator<Item = &str> {
+        self.catalogs.iter().map(|(locale, _)| locale.as_str())
+    }
+
+    /// Exact match first (ignoring case), then the same language: `"pt-BR"` falls back to a
+    /// `"pt"` or `"pt-PT"` table.
+    fn best_match(&self, locale: &str) -> Option<usize> {
+        self.index(locale).or_else(|| {
+            let wanted = language(locale);
+            self.catalogs
+                .iter()
+                .position(|(l, _)| language(l).eq_ignore_ascii_case(wanted))
+        })
+    }
+
+    fn index(&self, locale: &str) -> Option<usize> {
+        self.catalogs
+            .iter()
+            .position(|(l, _)| l.eq_ignore_ascii_case(locale))
+    }
+
+    /// Switch to the table that best matches `locale`. Returns false, keeping the current
+    /// table, when no table has the same language.
+    pub fn set_locale(&mut self, locale: &str) -> bool {
+        match self.best_match(locale) {
+            Some(i) => {
+                self.current = Some(i);
+                true
+            }
+            None => false,
+        }
+    }
+
+    /// [`I18n::set_locale`] with the player's locale from [`system::locale`].
+    pub fn use_system_locale(&mut self) -> bool {
+        self.set_locale(&system::locale())
+    }
+
+    /// Look keys the current table lacks up in `locale`'s table.
+    pub fn set_fallback(&mut self, locale: &str) {
+        self.fallback = self.best_match(locale);
+    }
+
+    /// The current locale, if any table was added.
+    pub fn locale(&self) -> Option<&str> {
+        self.current.map(|i| self.catalogs[i].0.as_str())
+    }
+
+    /// The current and fallback tables, in lookup order.
+    fn chain(&self) -> impl Iterator<Item = &(String, Catalog)> {
+        let fallback = self.fallback.filter(|f| Some(*f) != self.current);
+        self.current
+            .into_iter()
+            .chain(fallback)
+            .map(move |i| &self.catalogs[i])
+    }
+
+    /// The string under `key`, if the current or fallback table has it.
+    pub fn get(&self, key: &str) -> Option<&str> {
+        self.chain().find_map(|(_, catalog)| catalog.get(key))
+    }
+
+    /// The string under `key`, or the key itself.
+    pub fn t(&self, key: &str) -> String {
+        self.get(key).unwrap_or(key).to_string()
+    }
+
+    /// The string under `key` with its `{name}` arguments filled in (see [`format`]).
+    pub fn format(&self, key: &str, args: &[(&str, &dyn Display)]) -> String {
+        format(self.get(key).unwrap_or(key), args)
+    }
+
+    /// The plural form of `key` for the count `n`, with `{n}` and `args` filled in. Tries
+    /// `key.<category>`, then `key.other`, then `key`, in the current table and then the
+    /// fallback, each with its own language's rule.
+    pub fn plural(&self, key: &str, n: u64, args: &[(&str, &dyn Display)]) -> String {
+        let template = self
+            .chain()
+            .find_map(|(locale, catalog)| {
+                let category = Plural::for_count(locale, n).suffix();
+                [category, "other"]
+                    .iter()
+                    .find_map(|suffix| catalog.get(&plural_key(key, suffix)))
+                    .or_else(|| catalog.get(key))
+            })
+            .unwrap_or(key);
+        let mut all: Vec<(&str, &dyn Display)> = Vec::with_capacity(args.len() + 1);
+        all.push(("n", &n));
+        all.extend_from_slice(args);
+        format(template, &all)
+    }
+}
+
+/// `key.suffix`.
+fn plural_key(key: &str, suffix: &str) -> String {
+    let mut full = String::with_capacity(key.len() + suffix.len() + 1);
+    full.push_str(key);
+    full.push('.');
+    full.push_str(suffix);
+    full
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    const EN: &str = "
+        # English
+        title = Space Race
+        greeting = Hello, {name}!
+        coins.one = {n} coin
+        coins.other = {n} coins
+        credits = Made by\\nAda = {{team}}
+    ";
+
+    const RU: &str = "
+        title = Космическая гонка
+        coins.one = {n} монета
+        coins.few = {n} монеты
+        coins.many = {n} монет
+    ";
+
+    #[test]
+    fn parses_tables_and_formats_arguments() {
+        let en = Catalog::parse(EN);
+        assert_eq!(en.len(), 5);
+        assert_eq!(en.get("credits"), Some("Made by\nAda = {{team}}"));
+        assert_eq!(
+            format(en.get("credits").unwrap(), &[]),
+            "Made by\nAda = {team}"
+        );
+        assert_eq!(
+            format("Hello, {name}! {missing}", &[("name", &"Bo")]),
+            "Hello, Bo! {missing}"
+        );
+        assert_eq!(format("{a}{b}", &[("a", &1), ("b", &2.5)]), "12.5");
+    }
+
+    #[test]
+    fn plural_rules() {
+        use Plural::*;
+        let en = [0, 1, 2].map(|n| Plural::for_count("en-US", n));
+        assert_eq!(en, [Other, One, Other]);
+        assert_eq!(Plural::for_count("fr", 0), One);
+        assert_eq!(Plural::for_count("pt-PT", 0), Other);
+        let ru = [1, 3, 5, 11, 21, 22, 112].map(|n| Plural::for_count("ru", n));
+        assert_eq!(ru, [One, Few, Many, Many, One, Few, Many]);
+        assert_eq!(Plural::for_count("pl", 21), Many);
+        assert_eq!(Plural::for_count("ja", 1), Other);
+        assert_eq!(Plural::for_count("ar", 105), Few);
+    }
+
+    #[test]
+    fn picks_locales_and_falls_back() {
+        let mut text = I18n::new();
+        text.add_text("en", EN);
+        text.add_text("ru", RU);
+        text.set_fallback("en");
+        assert_eq!(text.locale(), Some("en"));
+
+        assert!(text.set_locale("ru-RU"));
+        assert_eq!(text.locale(), Some("ru"));
+        assert_eq!(text.t("title"), "Космическая гонка");
+        assert_eq!(
+            text.format("greeting", &[("name", &"Ivan")]),
+            "Hello, Ivan!"
+        );
+        assert_eq!(text.plural("coins", 3, &[]), "3 монеты");
+        assert_eq!(text.plural("coins", 25, &[]), "25 монет");
+        assert_eq!(text.t("missing.key"), "missing.key");
+
+        assert!(!text.set_locale("de"));
+        assert_eq!(text.locale(), Some("ru"));
+        assert!(text.set_locale("EN"));
+        assert_eq!(text.plural("coins", 1, &[]), "1 coin");
+    }
+
+    #[cfg(all(feature = "mock", not(target_arch = "wasm32")))]
+    #[test]
+    fn follows_the_system_locale() {
+        crate::mock::reset();
+        crate::mock::with(|host| host.set_locale("ru-RU"));
+        let mut text = I18n::new();
+        text.add_text("en", EN);
+        text.add_text("ru", RU);
+        assert!(text.use_system_locale());
+        assert_eq!(text.locale(), Some("ru"));
+    }
+}
@@ -19,8 +19,9 @@
 //!
 //! In the Rust SDK:
 //! - Registration lives in [`graphics::font_register_ttf`], [`graphics::font_register_bdf`],
-//!   and [`graphics::font_register_spleen`].
-//! - Drawing & measuring live in [`graphics::text_key`] and [`graphics::text_measure_key`].
+//!   [`graphics::font_register_fnt`] and [`graphics::font_register_spleen`].
+//! - Drawing & measuring live in [`graphics::text_key`] and [`graphics::text_measure_key`];
+//!   [`graphics::text_sized`] and [`graphics::text_measure_sized`] take an explicit pixel size.
 //!
 //! ## Fallback behavior (important)
 //!
@@ -40,6 +41,9 @@
 //! - **BDF (custom)** via [`graphics::font_register_bdf`]
 //!   - Best for pixel-perfect fonts you control.
 //!   - Host parses the BDF, builds a glyph map, and renders using the parsed bitmaps.
+//! - **AngelCode BMFont (custom)** via [`graphics::font_register_fnt`]
+//!   - For pixel fonts made in BMFont/Hiero: a `.fnt` descriptor plus a PNG atlas.
+//!   - Glyphs keep their own offsets and advances, so proportional fonts lay out correctly.
 //! - **TTF/OTF (custom)** via [`graphics::font_register_ttf`]
 //!   - Best for scalable fonts.
 //!   - Host uses font rasterization and draws glyphs as alpha-blended bitmaps.
@@ -88,14 +92,15 @@
 //! [`graphics::font_unregister`]. The key will no longer map to a font. Subsequent text usage
 //! with that key will again hit the host fallback (Spleen size 16).
 
-#[cfg(not(feature = "std"))]
+// Both `std` and `no_std` builds take collections from `alloc`, so the modules import them the
+// same way either way.
 extern crate alloc;
 
 use core::ffi::c_void;
 
 /// Joypad button ids.
 #[repr(u32)]
-#[derive(Copy, Clone, Debug, Eq, PartialEq)]
+#[derive(Copy, Clone, Debug, Eq, PartialEq, Hash)]
 pub enum Button {
     B = 0,
     Y = 1,
@@ -115,6 +120,108 @@ pub enum Button {
     R3 = 15,
 }
 
+/// An RGBA color. Packed for the host as 0xRRGGBBAA.
+#[derive(Copy, Clone, Debug, Default, Eq, PartialEq)]
+pub struct Color {
+    pub r: u8,
+    pub g: u8,
+    pub b: u8,
+    pub a: u8,
+}
+
+impl Color {
+    pub const BLACK: Color = Color::rgb(0, 0, 0);
+    pub const WHITE: Color = Color::rgb(255, 255, 255);
+    pub const TRANSPARENT: Color = Color::rgba(0, 0, 0, 0);
+
+    /// Opaque color from red, green, and blue.
+    pub const fn rgb(r: u8, g: u8, b: u8) -> Self {
+        Self { r, g, b, a: 255 }
+    }
+
+    /// Color from red, green, blue, and alpha.
+    pub const fn rgba(r: u8, g: u8, b: u8, a: u8) -> Self {
+        Self { r, g, b, a }
+    }
+
+    /// Unpack a 0xRRGGBBAA value.
+    pub const fn from_u32(v: u32) -> Self {
+        Self::rgba((v >> 24) as u8, (v >> 16) as u8, (v >> 8) as u8, v as u8)
+    }
+
+    /// Pack as 0xRRGGBBAA (the layout host imports expect).
+    pub const fn to_u32(self) -> u32 {
+        ((self.r as u32) << 24) | ((self.g as u32) << 16) | ((self.b as u32) << 8) | self.a as u32
+    }
+}
+
+/// Dash pattern for lines and outlines.
+#[repr(u32)]
+#[derive(Copy, Clone, Debug, Default, Eq, PartialEq)]
+pub enum LineStyle {
+    #[default]
+    Solid = 0,
+    Dashed = 1,
+    Dotted = 2,
+}
+
+/// Built-in filter the host applies to each presented frame.
+#[repr(u32)]
+#[derive(Copy, Clone, Debug, Default, Eq, PartialEq)]
+pub enum PostEffect {
+    #[default]
+    None = 0,
+    /// Darkened odd rows.
+    Scanlines = 1,
+    /// Tube curvature plus light scanlines.
+    Crt = 2,
+    /// Bright areas glow into their surroundings.
+    Bloom = 3,
+    Grayscale = 4,
+    /// Ordered dither down to fewer color levels.
+    Dither = 5,
+}
+
+/// Effect a screen transition covers and reveals the frame with.
+#[repr(u32)]
+#[derive(Copy, Clone, Debug, Default, Eq, PartialEq)]
+pub enum ScreenTransition {
+    /// Blend to the color and back.
+    #[default]
+    Fade = 0,
+    /// Left-to-right wipe with a dithered edge.
+    DitherWipe = 1,
+    /// Ever bigger blocks, then a blend to the color.
+    Pixelate = 2,
+    /// A circle closing on the screen center.
+    Iris = 3,
+}
+
+/// Which parts of a [`graphics::path_fill`] shape count as inside.
+#[repr(u32)]
+#[derive(Copy, Clone, Debug, Default, Eq, PartialEq)]
+pub enum FillRule {
+    /// Inside wherever the outlines wind around a point; a hole needs a subpath drawn the
+    /// other way round.
+    #[default]
+    NonZero = 0,
+    /// Inside where a ray crosses an odd number of outlines, so every nested subpath is a hole.
+    EvenOdd = 1,
+}
+
+/// How the host fits the framebuffer to a fixed window size.
+#[repr(u32)]
+#[derive(Copy, Clone, Debug, Default, Eq, PartialEq)]
+pub enum ScalingMode {
+    /// Largest size that keeps the aspect ratio, with black bars.
+    #[default]
+    Fit = 0,
+    /// Largest whole-number multiple, so pixels stay square and even.
+    IntegerScale = 1,
+    /// Fill the window, ignoring the aspect ratio.
+    Stretch = 2,
+}
+
 /// Text size dimensions.
 #[repr(C)]
 #[derive(Copy, Clone, Debug, Eq, PartialEq)]
@@ -123,15 +230,350 @@ pub struct TextSize {
     pub height: u32,
 }
 
+/// Vertical font metrics, in pixels. Text is drawn with its top at `y`, so the baseline sits at
+/// `y + ascent`.
+#[derive(Copy, Clone, Debug, Default, Eq, PartialEq)]
+pub struct FontMetrics {
+    /// Height above the baseline.
+    pub ascent: u32,
+    /// Depth below the baseline.
+    pub descent: u32,
+    /// Extra space the font suggests between lines (0 for bitmap fonts).
+    pub line_gap: u32,
+}
+
+impl FontMetrics {
+    /// Distance from one line's top to the next.
+    pub const fn line_height(&self) -> u32 {
+        self.ascent + self.descent + self.line_gap
+    }
+}
+
+/// A 2D integer point, laid out as the host expects in vertex buffers.
+#[repr(C)]
+#[derive(Copy, Clone, Debug, Default, Eq, PartialEq)]
+pub struct Point {
+    pub x: i32,
+    pub y: i32,
+}
+
+impl Point {
+    pub const fn new(x: i32, y: i32) -> Self {
+        Self { x, y }
+    }
+}
+
+/// Shape of host-drawn particles.
+#[repr(u32)]
+#[derive(Copy, Clone, Debug, Default, Eq, PartialEq)]
+pub enum ParticleShape {
+    #[default]
+    Square = 0,
+    Circle = 1,
+}
+
+/// Behavior of a host particle system, laid out as the host expects (see
+/// [`graphics::particles_create`]).
+///
+/// Each particle gets a random life, speed and direction from the given ranges, then falls under
+/// `gravity` while its color and size move from the start values to the end values.
+#[repr(C)]
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct ParticleConfig {
+    pub life_min_ms: u32,
+    pub life_max_ms: u32,
+    /// Initial speed range in pixels per second.
+    pub speed_min: f32,
+    pub speed_max: f32,
+    /// Center of the emission cone in radians (0 = right, clockwise).
+    pub direction: f32,
+    /// Full width of the emission cone in radians (`TAU` = every direction).
+    pub spread: f32,
+    /// Acceleration in pixels per second squared.
+    pub gravity_x: f32,
+    pub gravity_y: f32,
+    /// Fraction of velocity lost per second, 0..=1.
+    pub drag: f32,
+    /// Packed 0xRRGGBBAA, see [`Color::to_u32`]. Alpha fades blend over the frame.
+    pub color_start: u32,
+    pub color_end: u32,
+    /// Edge length (or diameter) in pixels.
+    pub size_start: f32,
+    pub size_end: f32,
+    /// Live particles kept at once; emits past it are dropped. 0 means 1024.
+    pub max_particles: u32,
+    pub shape: ParticleShape,
+}
+
+impl Default for ParticleConfig {
+    /// Short-lived white sparks flying out in every direction.
+    fn default() -> Self {
+        Self {
+            life_min_ms: 500,
+            life_max_ms: 1000,
+            speed_min: 20.0,
+            speed_max: 60.0,
+            direction: 0.0,
+            spread: core::f32::consts::TAU,
+            gravity_x: 0.0,
+            gravity_y: 0.0,
+            drag: 0.0,
+            color_start: 0xFFFF_FFFF,
+            color_end: 0xFFFF_FF00,
+            size_start: 2.0,
+            size_end: 1.0,
+            max_particles: 0,
+            shape: ParticleShape::Square,
+        }
+    }
+}
+
+/// One sprite in a [`graphics::image_draw_batch`] call, laid out as the host expects.
+///
+/// Draws the `sw`x`sh` region at (`sx`, `sy`) of the image with its top-left at (`x`, `y`),
+/// rotated by `angle` radians clockwise around its center and multiplied by `tint`.
+#[repr(C)]
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct DrawInstance {
+    pub x: i32,
+    pub y: i32,
+    pub sx: i32,
+    pub sy: i32,
+    /// Region size; 0 in either means the whole image.
+    pub sw: u32,
+    pub sh: u32,
+    pub angle: f32,
+    /// Packed 0xRRGGBBAA, see [`Color::to_u32`].
+    pub tint: u32,
+}
+
+impl DrawInstance {
+    /// The whole image at (x, y), unrotated and untinted.
+    pub const fn new(x: i32, y: i32) -> Self {
+        Self {
+            x,
+            y,
+            sx: 0,
+            sy: 0,
+            sw: 0,
+            sh: 0,
+            angle: 0.0,
+            tint: 0xFFFF_FFFF,
+        }
+    }
+
+    /// Draw only the `sw`x`sh` region at (`sx`, `sy`), e.g. a sprite-sheet cell.
+    pub const fn region(mut self, sx: i32, sy: i32, sw: u32, sh: u32) -> Self {
+        self.sx = sx;
+        self.sy = sy;
+        self.sw = sw;
+        self.sh = sh;
+        self
+    }
+
+    pub const fn angle(mut self, angle: f32) -> Self {
+        self.angle = angle;
+        self
+    }
+
+    pub const fn tint(mut self, tint: Color) -> Self {
+        self.tint = tint.to_u32();
+        self
+    }
+}
+
+/// Outline and drop shadow for one [`graphics::text_sdf`] call, laid out as the host expects.
+///
+/// Lengths are in screen pixels. A transparent color turns its effect off, so
+/// `TextStyle::default()` draws plain text. Outlines and shadow blur reach at most a sixth of
+/// the text size.
+#[repr(C)]
+#[derive(Copy, Clone, Debug, Default, PartialEq)]
+pub struct TextStyle {
+    pub outline_width: f32,
+    /// Packed 0xRRGGBBAA, see [`Color::to_u32`].
+    pub outline_color: u32,
+    /// Shadow offset, not rotated with the text.
+    pub shadow_x: f32,
+    pub shadow_y: f32,
+    /// Blur of the shadow's edge; 0 is hard.
+    pub shadow_softness: f32,
+    /// Packed 0xRRGGBBAA.
+    pub shadow_color: u32,
+}
+
+impl TextStyle {
+    /// Outline the glyphs `width` pixels wide.
+    pub const fn outline(mut self, width: f32, color: Color) -> Self {
+        self.outline_width = width;
+        self.outline_color = color.to_u32();
+        self
+    }
+
+    /// Drop a shadow offset by (`x`, `y`) with `softness` pixels of blur.
+    pub const fn shadow(mut self, x: f32, y: f32, softness: f32, color: Color) -> Self {
+        self.shadow_x = x;
+        self.shadow_y = y;
+        self.shadow_softness = softness;
+        self.shadow_color = color.to_u32();
+        self
+    }
+}
+
+/// Declares the host imports.
+///
+/// On wasm this is a plain `extern` block. With the `mock` feature on a native target, every
+/// import instead becomes a method on [`sys::Host`] (defaulting to a no-op that returns zero),
+/// and the free functions forward to the thread's [`mock::MockHost`].
+macro_rules! wasm_imports {
+    ($(#[link_name = $name:literal] pub fn $f:ident($($a:ident: $t:ty),* $(,)?) $(-> $r:ty)?;)*) => {
+        #[cfg(not(all(feature = "mock", not(target_arch = "wasm32"))))]
+        unsafe extern "C" {
+            $(
+                #[link_name = $name]
+                pub fn $f($($a: $t),*) $(-> $r)?;
+            )*
+        }
+
+        /// Every host import as an overridable method; the defaults do nothing and return zero.
+        #[cfg(all(feature = "mock", not(target_arch = "wasm32")))]
+        #[allow(unused_variables, clippy::too_many_arguments)]
+        pub trait Host {
+            $(
+                fn $f(&mut self, $($a: $t),*) $(-> $r)? {
+                    Default::default()
+                }
+            )*
+        }
+
+        $(
+            #[cfg(all(feature = "mock", not(target_arch = "wasm32")))]
+            #[allow(clippy::too_many_arguments, clippy::missing_safety_doc)]
+            pub unsafe fn $f($($a: $t),*) $(-> $r)? {
+                crate::mock::with(|host| Host::$f(host, $($a),*))
+            }
+        )*
+    };
+}
+
+/// Embed cart metadata (read back with [`system::cart_meta`]) in a `wasm96.meta` custom section.
+///
+/// ```ignore
+/// wasm96_sdk::cart_meta! {
+///     title = "Space Rocks",
+///     version = "1.2.0",
+///     author = "Ada",
+/// }
+/// ```
+#[macro_export]
+macro_rules! cart_meta {
+    ($($key:ident = $value:literal),* $(,)?) => {
+        const _: () = {
+            const META: &str = concat!($(stringify!($key), "=", $value, "\n"),*);
+            #[used]
+            #[unsafe(link_section = "wasm96.meta")]
+            static SECTION: [u8; META.len()] = $crate::__meta_bytes(META);
+        };
+    };
+}
+
+/// Export `on_pause`, `on_resume`, `on_quit` and `on_rollback`, running the callbacks set with
+/// [`system::on_pause`] and friends. Carts that export these hooks themselves leave it out.
+///
+/// ```ignore
+/// wasm96_sdk::lifecycle_hooks!();
+/// ```
+#[macro_export]
+macro_rules! lifecycle_hooks {
+    () => {
+        const _: () = {
+            #[unsafe(no_mangle)]
+            extern "C" fn on_pause() {
+                $crate::system::run_hook($crate::system::HOOK_PAUSE);
+            }
+
+            #[unsafe(no_mangle)]
+            extern "C" fn on_resume() {
+                $crate::system::run_hook($crate::system::HOOK_RESUME);
+            }
+
+            #[unsafe(no_mangle)]
+            extern "C" fn on_quit() {
+                $crate::system::run_hook($crate::system::HOOK_QUIT);
+            }
+
+            #[unsafe(no_mangle)]
+            extern "C" fn on_rollback() {
+                $crate::system::run_hook($crate::system::HOOK_ROLLBACK);
+            }
+        };
+    };
+}
+
+#[doc(hidden)]
+pub const fn __meta_bytes<const N: usize>(text: &str) -> [u8; N] {
+    let bytes = text.as_bytes();
+    let mut out = [0u8; N];
+    let mut i = 0;
+    while i < N {
+        out[i] = bytes[i];
+        i += 1;
+    }
+    out
+}
+
+pub mod actions;
+pub mod animation;
+pub mod collide;
+pub mod ecs;
+pub mod fixed;
+pub mod i18n;
+pub mod math;
+pub mod pack;
+pub mod qoi;
+pub mod resources;
+pub mod save;
+pub mod scene;
+pub mod time;
+pub mod timer;
+pub mod tween;
+pub mod ui;
+
+#[cfg(all(feature = "mock", not(target_arch = "wasm32")))]
+pub mod mock;
+
 /// Low-level raw ABI imports.
 #[allow(non_camel_case_types)]
 pub mod sys {
-    unsafe extern "C" {
+    wasm_imports! {
         // Graphics
         #[link_name = "wasm96_graphics_set_size"]
         pub fn graphics_set_size(width: u32, height: u32);
         #[link_name = "wasm96_graphics_set_color"]
         pub fn graphics_set_color(r: u32, g: u32, b: u32, a: u32);
+        #[link_name = "wasm96_graphics_set_tint"]
+        pub fn graphics_set_tint(r: u32, g: u32, b: u32, a: u32);
+        #[link_name = "wasm96_graphics_set_post_effect"]
+        pub fn graphics_set_post_effect(effect: u32, strength: f32);
+        #[link_name = "wasm96_graphics_color_grade_set"]
+        pub fn graphics_color_grade_set(ptr: *const u8, len: u32) -> u32;
+        #[link_name = "wasm96_graphics_set_scaling_mode"]
+        pub fn graphics_set_scaling_mode(mode: u32);
+        // (width << 32) | height
+        #[link_name = "wasm96_graphics_window_size"]
+        pub fn graphics_window_size() -> u64;
+        #[link_name = "wasm96_graphics_set_fullscreen"]
+        pub fn graphics_set_fullscreen(enabled: u32);
+        #[link_name = "wasm96_graphics_fullscreen"]
+        pub fn graphics_fullscreen() -> u32;
+        #[link_name = "wasm96_graphics_resized"]
+        pub fn graphics_resized() -> u32;
+
+        #[link_name = "wasm96_graphics_set_line_width"]
+        pub fn graphics_set_line_width(px: u32);
+
+        #[link_name = "wasm96_graphics_set_line_style"]
+        pub fn graphics_set_line_style(style: u32);
         #[link_name = "wasm96_graphics_background"]
         pub fn graphics_background(r: u32, g: u32, b: u32);
         #[link_name = "wasm96_graphics_point"]
@@ -147,13 +589,21 @@ pub mod sys {
         #[link_name = "wasm96_graphics_circle_outline"]
         pub fn graphics_circle_outline(x: i32, y: i32, r: u32);
         #[link_name = "wasm96_graphics_image"]
-        pub fn graphics_image(x: i32, y: i32, w: u32, h: u32, ptr: u32, len: u32);
+        pub fn graphics_image(x: i32, y: i32, w: u32, h: u32, ptr: *const u8, len: u32);
 
         // One-shot (decode + draw at natural size)
         #[link_name = "wasm96_graphics_image_png"]
-        pub fn graphics_image_png(x: i32, y: i32, ptr: u32, len: u32);
+        pub fn graphics_image_png(x: i32, y: i32, ptr: *const u8, len: u32);
         #[link_name = "wasm96_graphics_image_jpeg"]
-        pub fn graphics_image_jpeg(x: i32, y: i32, ptr: u32, len: u32);
+        pub fn graphics_image_jpeg(x: i32, y: i32, ptr: *const u8, len: u32);
+
+        // Direct framebuffer access (RGBA8888)
+        #[link_name = "wasm96_graphics_framebuffer_write"]
+        pub fn graphics_framebuffer_write(x: i32, y: i32, w: u32, h: u32, ptr: *const u8, len: u32);
+
+        #[link_name = "wasm96_graphics_framebuffer_read"]
+        pub fn graphics_framebuffer_read(x: i32, y: i32, w: u32, h: u32, ptr: *mut u8, len: u32)
+        -> u32;
 
         // Materials / textures (OBJ+MTL workflows)
         //
@@ -162,46 +612,287 @@ pub mod sys {
         #[link_name = "wasm96_graphics_mtl_register_texture"]
         pub fn graphics_mtl_register_texture(
             texture_key: u64,
-            mtl_ptr: u32,
+            mtl_ptr: *const u8,
             mtl_len: u32,
-            tex_filename_ptr: u32,
+            tex_filename_ptr: *const u8,
             tex_filename_len: u32,
-            tex_ptr: u32,
+            tex_ptr: *const u8,
             tex_len: u32,
         ) -> u32;
 
         // --- Keyed resources (hashed keys) ---
+        // Why the last register call failed (0 = it didn't); see `resources::ResourceError`.
+        #[link_name = "wasm96_graphics_last_error"]
+        pub fn graphics_last_error() -> u32;
+
         // SVG
         #[link_name = "wasm96_graphics_svg_register"]
-        pub fn graphics_svg_register(key: u64, data_ptr: u32, data_len: u32) -> u32;
+        pub fn graphics_svg_register(key: u64, data_ptr: *const u8, data_len: u32) -> u32;
         #[link_name = "wasm96_graphics_svg_draw_key"]
         pub fn graphics_svg_draw_key(key: u64, x: i32, y: i32, w: u32, h: u32);
         #[link_name = "wasm96_graphics_svg_unregister"]
         pub fn graphics_svg_unregister(key: u64);
+        #[link_name = "wasm96_graphics_svg_size"]
+        pub fn graphics_svg_size(key: u64) -> u64;
+        #[link_name = "wasm96_graphics_svg_set_fill"]
+        pub fn graphics_svg_set_fill(
+            key: u64,
+            selector_ptr: *const u8,
+            selector_len: u32,
+            color: u32,
+        ) -> u32;
 
         // GIF
         #[link_name = "wasm96_graphics_gif_register"]
-        pub fn graphics_gif_register(key: u64, data_ptr: u32, data_len: u32) -> u32;
+        pub fn graphics_gif_register(key: u64, data_ptr: *const u8, data_len: u32) -> u32;
         #[link_name = "wasm96_graphics_gif_draw_key"]
         pub fn graphics_gif_draw_key(key: u64, x: i32, y: i32);
         #[link_name = "wasm96_graphics_gif_draw_key_scaled"]
         pub fn graphics_gif_draw_key_scaled(key: u64, x: i32, y: i32, w: u32, h: u32);
         #[link_name = "wasm96_graphics_gif_unregister"]
         pub fn graphics_gif_unregister(key: u64);
+        #[link_name = "wasm96_graphics_gif_frame_count"]
+        pub fn graphics_gif_frame_count(key: u64) -> u32;
+        #[link_name = "wasm96_graphics_gif_frame_delay"]
+        pub fn graphics_gif_frame_delay(key: u64, frame: u32) -> u32;
+        #[link_name = "wasm96_graphics_gif_draw_frame"]
+        pub fn graphics_gif_draw_frame(key: u64, frame: u32, x: i32, y: i32, w: u32, h: u32);
+        #[link_name = "wasm96_graphics_gif_set_frame"]
+        pub fn graphics_gif_set_frame(key: u64, frame: u32);
+        #[link_name = "wasm96_graphics_gif_set_speed"]
+        pub fn graphics_gif_set_speed(key: u64, multiplier: f32);
+        #[link_name = "wasm96_graphics_gif_pause"]
+        pub fn graphics_gif_pause(key: u64, paused: u32);
+        #[link_name = "wasm96_graphics_gif_draw_ex"]
+        pub fn graphics_gif_draw_ex(
+            key: u64,
+            x: i32,
+            y: i32,
+            w: u32,
+            h: u32,
+            angle: f32,
+            flags: u32,
+            pivot_x: i32,
+            pivot_y: i32,
+        );
+
+        // Aseprite
+        #[link_name = "wasm96_graphics_aseprite_register"]
+        pub fn graphics_aseprite_register(key: u64, data_ptr: *const u8, data_len: u32) -> u32;
+        #[link_name = "wasm96_graphics_aseprite_unregister"]
+        pub fn graphics_aseprite_unregister(key: u64);
+        // (width << 32) | height; 0 if unknown.
+        #[link_name = "wasm96_graphics_aseprite_size"]
+        pub fn graphics_aseprite_size(key: u64) -> u64;
+        #[link_name = "wasm96_graphics_aseprite_frame_count"]
+        pub fn graphics_aseprite_frame_count(key: u64) -> u32;
+        #[link_name = "wasm96_graphics_aseprite_frame_duration"]
+        pub fn graphics_aseprite_frame_duration(key: u64, frame: u32) -> u32;
+        #[link_name = "wasm96_graphics_aseprite_tag_duration"]
+        pub fn graphics_aseprite_tag_duration(key: u64, tag_ptr: *const u8, tag_len: u32) -> u32;
+        #[link_name = "wasm96_graphics_aseprite_draw_frame"]
+        pub fn graphics_aseprite_draw_frame(key: u64, frame: u32, x: i32, y: i32);
+        // Frame drawn, or u32::MAX if there is no such sprite or tag.
+        #[link_name = "wasm96_graphics_aseprite_draw_tag"]
+        pub fn graphics_aseprite_draw_tag(
+            key: u64,
+            tag_ptr: *const u8,
+            tag_len: u32,
+            millis: u32,
+            x: i32,
+            y: i32,
+        ) -> u32;
+        #[link_name = "wasm96_graphics_aseprite_set_layer_visible"]
+        pub fn graphics_aseprite_set_layer_visible(
+            key: u64,
+            name_ptr: *const u8,
+            name_len: u32,
+            visible: u32,
+        ) -> u32;
+
+        // Tile maps (Tiled / LDtk)
+        #[link_name = "wasm96_graphics_map_load"]
+        pub fn graphics_map_load(
+            key: u64,
+            path_ptr: *const u8,
+            path_len: u32,
+            level_ptr: *const u8,
+            level_len: u32,
+        ) -> u32;
+        #[link_name = "wasm96_graphics_map_register"]
+        pub fn graphics_map_register(
+            key: u64,
+            data_ptr: *const u8,
+            data_len: u32,
+            level_ptr: *const u8,
+            level_len: u32,
+        ) -> u32;
+        #[link_name = "wasm96_graphics_map_unregister"]
+        pub fn graphics_map_unregister(key: u64);
+        // (columns << 32) | rows
+        #[link_name = "wasm96_graphics_map_size"]
+        pub fn graphics_map_size(key: u64) -> u64;
+        // (width << 32) | height
+        #[link_name = "wasm96_graphics_map_tile_size"]
+        pub fn graphics_map_tile_size(key: u64) -> u64;
+        #[link_name = "wasm96_graphics_map_layer_count"]
+        pub fn graphics_map_layer_count(key: u64) -> u32;
+        #[link_name = "wasm96_graphics_map_layer_index"]
+        pub fn graphics_map_layer_index(key: u64, name_ptr: *const u8, name_len: u32) -> i32;
+        #[link_name = "wasm96_graphics_map_tile"]
+        pub fn graphics_map_tile(key: u64, layer: u32, column: u32, row: u32) -> u32;
+        // Blob id of the encoded objects (0 = none).
+        #[link_name = "wasm96_graphics_map_objects"]
+        pub fn graphics_map_objects(key: u64) -> u32;
+        #[link_name = "wasm96_graphics_map_draw"]
+        pub fn graphics_map_draw(key: u64, x: i32, y: i32);
+        #[link_name = "wasm96_graphics_map_draw_layer"]
+        pub fn graphics_map_draw_layer(key: u64, layer: u32, x: i32, y: i32);
 
         // PNG
         #[link_name = "wasm96_graphics_png_register"]
-        pub fn graphics_png_register(key: u64, data_ptr: u32, data_len: u32) -> u32;
+        pub fn graphics_png_register(key: u64, data_ptr: *const u8, data_len: u32) -> u32;
         #[link_name = "wasm96_graphics_png_draw_key"]
         pub fn graphics_png_draw_key(key: u64, x: i32, y: i32);
         #[link_name = "wasm96_graphics_png_draw_key_scaled"]
         pub fn graphics_png_draw_key_scaled(key: u64, x: i32, y: i32, w: u32, h: u32);
         #[link_name = "wasm96_graphics_png_unregister"]
         pub fn graphics_png_unregister(key: u64);
+        #[link_name = "wasm96_graphics_image_draw_region"]
+        pub fn graphics_image_draw_region(
+            key: u64,
+            sx: i32,
+            sy: i32,
+            sw: u32,
+            sh: u32,
+            x: i32,
+            y: i32,
+            w: u32,
+            h: u32,
+        );
+        #[link_name = "wasm96_graphics_image_draw_ex"]
+        pub fn graphics_image_draw_ex(
+            key: u64,
+            x: i32,
+            y: i32,
+            w: u32,
+            h: u32,
+            angle: f32,
+            flags: u32,
+            pivot_x: i32,
+            pivot_y: i32,
+        );
+        #[link_name = "wasm96_graphics_image_draw_nine_slice"]
+        pub fn graphics_image_draw_nine_slice(
+            key: u64,
+            x: i32,
+            y: i32,
+            w: u32,
+            h: u32,
+            left: u32,
+            top: u32,
+            right: u32,
+            bottom: u32,
+        );
+        #[link_name = "wasm96_graphics_image_draw_batch"]
+        pub fn graphics_image_draw_batch(key: u64, ptr: *const u8, count: u32);
+
+        // Palette mode
+        #[link_name = "wasm96_graphics_palette_set"]
+        pub fn graphics_palette_set(index: u32, r: u32, g: u32, b: u32);
+        #[link_name = "wasm96_graphics_palette_swap"]
+        pub fn graphics_palette_swap(from: u32, to: u32);
+        #[link_name = "wasm96_graphics_palette_set_transparent"]
+        pub fn graphics_palette_set_transparent(index: u32, transparent: u32);
+        #[link_name = "wasm96_graphics_palette_reset"]
+        pub fn graphics_palette_reset();
+        #[link_name = "wasm96_graphics_set_color_index"]
+        pub fn graphics_set_color_index(index: u32);
+        #[link_name = "wasm96_graphics_indexed_register"]
+        pub fn graphics_indexed_register(
+            key: u64,
+            width: u32,
+            height: u32,
+            data_ptr: *const u8,
+            data_len: u32,
+        ) -> u32;
+        #[link_name = "wasm96_graphics_indexed_draw"]
+        pub fn graphics_indexed_draw(key: u64, x: i32, y: i32);
+        #[link_name = "wasm96_graphics_indexed_unregister"]
+        pub fn graphics_indexed_unregister(key: u64);
+
+        // Particles
+        #[link_name = "wasm96_graphics_particles_create"]
+        pub fn graphics_particles_create(key: u64, config_ptr: *const u8, config_len: u32) -> u32;
+        #[link_name = "wasm96_graphics_particles_emit"]
+        pub fn graphics_particles_emit(key: u64, x: i32, y: i32, count: u32);
+        #[link_name = "wasm96_graphics_particles_update_and_draw"]
+        pub fn graphics_particles_update_and_draw(key: u64);
+        #[link_name = "wasm96_graphics_particles_count"]
+        pub fn graphics_particles_count(key: u64) -> u32;
+        #[link_name = "wasm96_graphics_particles_clear"]
+        pub fn graphics_particles_clear(key: u64);
+        #[link_name = "wasm96_graphics_particles_destroy"]
+        pub fn graphics_particles_destroy(key: u64);
+
+        // 2D camera
+        #[link_name = "wasm96_graphics_camera_set"]
+        pub fn graphics_camera_set(x: f32, y: f32, zoom: f32, rotation: f32);
+        #[link_name = "wasm96_graphics_camera_set_bounds"]
+        pub fn graphics_camera_set_bounds(x: i32, y: i32, w: u32, h: u32);
+        #[link_name = "wasm96_graphics_camera_shake"]
+        pub fn graphics_camera_shake(magnitude: f32, duration_ms: u32);
+        #[link_name = "wasm96_graphics_camera_reset"]
+        pub fn graphics_camera_reset();
+        #[link_name = "wasm96_graphics_screen_to_world"]
+        pub fn graphics_screen_to_world(x: f32, y: f32) -> u64;
+        #[link_name = "wasm96_graphics_world_to_screen"]
+        pub fn graphics_world_to_screen(x: f32, y: f32) -> u64;
+        #[link_name = "wasm96_graphics_layer_begin"]
+        pub fn graphics_layer_begin(index: u32);
+        #[link_name = "wasm96_graphics_layer_end"]
+        pub fn graphics_layer_end();
+        #[link_name = "wasm96_graphics_layer_set_visible"]
+        pub fn graphics_layer_set_visible(index: u32, visible: u32);
+        #[link_name = "wasm96_graphics_layer_set_parallax"]
+        pub fn graphics_layer_set_parallax(index: u32, factor: f32);
+        #[link_name = "wasm96_graphics_layer_set_order"]
+        pub fn graphics_layer_set_order(index: u32, order: i32);
+        #[link_name = "wasm96_graphics_mask_begin"]
+        pub fn graphics_mask_begin();
+        #[link_name = "wasm96_graphics_mask_end"]
+        pub fn graphics_mask_end();
+        #[link_name = "wasm96_graphics_mask_use"]
+        pub fn graphics_mask_use(invert: u32);
+        #[link_name = "wasm96_graphics_mask_off"]
+        pub fn graphics_mask_off();
+        #[link_name = "wasm96_graphics_path_begin"]
+        pub fn graphics_path_begin();
+        #[link_name = "wasm96_graphics_path_move_to"]
+        pub fn graphics_path_move_to(x: f32, y: f32);
+        #[link_name = "wasm96_graphics_path_line_to"]
+        pub fn graphics_path_line_to(x: f32, y: f32);
+        #[link_name = "wasm96_graphics_path_curve_to"]
+        pub fn graphics_path_curve_to(cx1: f32, cy1: f32, cx2: f32, cy2: f32, x: f32, y: f32);
+        #[link_name = "wasm96_graphics_path_close"]
+        pub fn graphics_path_close();
+        #[link_name = "wasm96_graphics_path_fill"]
+        pub fn graphics_path_fill(even_odd: u32);
+        #[link_name = "wasm96_graphics_path_stroke"]
+        pub fn graphics_path_stroke();
+        #[link_name = "wasm96_graphics_transition_start"]
+        pub fn graphics_transition_start(kind: u32, duration_ms: u32);
+        #[link_name = "wasm96_graphics_transition_active"]
+        pub fn graphics_transition_active() -> u32;
+        #[link_name = "wasm96_graphics_transition_midpoint"]
+        pub fn graphics_transition_midpoint() -> u32;
 
         // JPEG
         #[link_name = "wasm96_graphics_jpeg_register"]
-        pub fn graphics_jpeg_register(key: u64, data_ptr: u32, data_len: u32) -> u32;
+        pub fn graphics_jpeg_register(key: u64, data_ptr: *const u8, data_len: u32) -> u32;
+        // PNG or JPEG decoded in the background; returns a load handle.
+        #[link_name = "wasm96_graphics_image_register_async"]
+        pub fn graphics_image_register_async(key: u64, data_ptr: *const u8, data_len: u32) -> u32;
         #[link_name = "wasm96_graphics_jpeg_draw_key"]
         pub fn graphics_jpeg_draw_key(key: u64, x: i32, y: i32);
         #[link_name = "wasm96_graphics_jpeg_draw_key_scaled"]
@@ -223,25 +914,75 @@ pub mod sys {
         // This makes text work out-of-the-box, but for stable metrics you should explicitly
         // register a font under a deterministic key during `setup()`.
         #[link_name = "wasm96_graphics_font_register_ttf"]
-        pub fn graphics_font_register_ttf(key: u64, data_ptr: u32, data_len: u32) -> u32;
+        pub fn graphics_font_register_ttf(key: u64, data_ptr: *const u8, data_len: u32) -> u32;
         #[link_name = "wasm96_graphics_font_register_bdf"]
-        pub fn graphics_font_register_bdf(key: u64, data_ptr: u32, data_len: u32) -> u32;
+        pub fn graphics_font_register_bdf(key: u64, data_ptr: *const u8, data_len: u32) -> u32;
+        #[link_name = "wasm96_graphics_font_register_fnt"]
+        pub fn graphics_font_register_fnt(
+            key: u64,
+            data_ptr: *const u8,
+            data_len: u32,
+            atlas_key: u64,
+        ) -> u32;
         #[link_name = "wasm96_graphics_font_register_spleen"]
         pub fn graphics_font_register_spleen(key: u64, size: u32) -> u32;
         #[link_name = "wasm96_graphics_font_unregister"]
         pub fn graphics_font_unregister(key: u64);
+        #[link_name = "wasm96_graphics_font_add_fallback"]
+        pub fn graphics_font_add_fallback(primary: u64, fallback: u64) -> u32;
 
         // Draw text with a keyed font.
         // - `text_ptr/text_len` are UTF-8 bytes in guest memory (host expects valid UTF-8).
         // - If `font_key` is unknown, host falls back to Spleen size 16.
         #[link_name = "wasm96_graphics_text_key"]
-        pub fn graphics_text_key(x: i32, y: i32, font_key: u64, text_ptr: u32, text_len: u32);
+        pub fn graphics_text_key(x: i32, y: i32, font_key: u64, text_ptr: *const u8, text_len: u32);
 
         // Measure text with a keyed font.
         // - Returns a packed u64: (width<<32) | height.
         // - If `font_key` is unknown, host falls back to Spleen size 16.
         #[link_name = "wasm96_graphics_text_measure_key"]
-        pub fn graphics_text_measure_key(font_key: u64, text_ptr: u32, text_len: u32) -> u64;
+        pub fn graphics_text_measure_key(font_key: u64, text_ptr: *const u8, text_len: u32) -> u64;
+        // Draw / measure at an explicit pixel size (0 = the font's native size).
+        #[link_name = "wasm96_graphics_text_sized_key"]
+        pub fn graphics_text_sized_key(
+            x: i32,
+            y: i32,
+            font_key: u64,
+            size_px: u32,
+            text_ptr: *const u8,
+            text_len: u32,
+        );
+        #[link_name = "wasm96_graphics_text_measure_sized_key"]
+        pub fn graphics_text_measure_sized_key(
+            font_key: u64,
+            size_px: u32,
+            text_ptr: *const u8,
+            text_len: u32,
+        ) -> u64;
+        #[link_name = "wasm96_graphics_text_measure_up_to_key"]
+        pub fn graphics_text_measure_up_to_key(
+            font_key: u64,
+            text_ptr: *const u8,
+            text_len: u32,
+            byte_offset: u32,
+        ) -> u32;
+        #[link_name = "wasm96_graphics_font_metrics_key"]
+        pub fn graphics_font_metrics_key(font_key: u64) -> u64;
+        #[link_name = "wasm96_graphics_set_text_scale"]
+        pub fn graphics_set_text_scale(multiplier: f32);
+        #[link_name = "wasm96_graphics_font_register_ttf_sdf"]
+        pub fn graphics_font_register_ttf_sdf(key: u64, data_ptr: *const u8, data_len: u32) -> u32;
+        #[link_name = "wasm96_graphics_text_sdf_key"]
+        pub fn graphics_text_sdf_key(
+            x: f32,
+            y: f32,
+            font_key: u64,
+            size_px: f32,
+            angle: f32,
+            text_ptr: *const u8,
+            text_len: u32,
+            style_ptr: *const u8,
+        );
 
         #[link_name = "wasm96_graphics_triangle"]
         pub fn graphics_triangle(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32);
@@ -279,6 +1020,39 @@ pub mod sys {
         #[link_name = "wasm96_graphics_pill_outline"]
         pub fn graphics_pill_outline(x: i32, y: i32, w: u32, h: u32);
 
+        #[link_name = "wasm96_graphics_rect_gradient"]
+        pub fn graphics_rect_gradient(
+            x: i32,
+            y: i32,
+            w: u32,
+            h: u32,
+            top_left: u32,
+            top_right: u32,
+            bottom_left: u32,
+            bottom_right: u32,
+        );
+
+        #[link_name = "wasm96_graphics_circle_gradient"]
+        pub fn graphics_circle_gradient(x: i32, y: i32, r: u32, inner: u32, outer: u32);
+
+        #[link_name = "wasm96_graphics_polygon"]
+        pub fn graphics_polygon(ptr: *const super::Point, count: u32);
+
+        #[link_name = "wasm96_graphics_polyline"]
+        pub fn graphics_polyline(ptr: *const super::Point, count: u32, closed: u32);
+
+        #[link_name = "wasm96_graphics_ellipse"]
+        pub fn graphics_ellipse(x: i32, y: i32, rx: u32, ry: u32);
+
+        #[link_name = "wasm96_graphics_ellipse_outline"]
+        pub fn graphics_ellipse_outline(x: i32, y: i32, rx: u32, ry: u32);
+
+        #[link_name = "wasm96_graphics_arc"]
+        pub fn graphics_arc(x: i32, y: i32, r: u32, start: f32, end: f32);
+
+        #[link_name = "wasm96_graphics_arc_filled"]
+        pub fn graphics_arc_filled(x: i32, y: i32, r: u32, start: f32, end: f32);
+
         // 3D Graphics
         #[link_name = "wasm96_graphics_set_3d"]
         pub fn graphics_set_3d(enable: u32);
@@ -342,42 +1116,407 @@ pub mod sys {
         pub fn input_get_mouse_y() -> i32;
         #[link_name = "wasm96_input_is_mouse_down"]
         pub fn input_is_mouse_down(btn: u32) -> u32;
+        #[link_name = "wasm96_input_get_connected_ports"]
+        pub fn input_get_connected_ports() -> u32;
+        #[link_name = "wasm96_input_snapshot"]
+        pub fn input_snapshot(ptr: *mut u8, len: u32) -> u32;
+        #[link_name = "wasm96_input_get_controller_name"]
+        pub fn input_get_controller_name(port: u32) -> u32;
+        #[link_name = "wasm96_input_ports_changed"]
+        pub fn input_ports_changed() -> u32;
+        #[link_name = "wasm96_input_button_held_millis"]
+        pub fn input_button_held_millis(port: u32, btn: u32) -> u32;
+        #[link_name = "wasm96_input_key_held_millis"]
+        pub fn input_key_held_millis(key: u32) -> u32;
+        #[link_name = "wasm96_input_get_touch_count"]
+        pub fn input_get_touch_count() -> u32;
+        #[link_name = "wasm96_input_get_touch_id"]
+        pub fn input_get_touch_id(index: u32) -> u32;
+        #[link_name = "wasm96_input_get_touch_x"]
+        pub fn input_get_touch_x(index: u32) -> i32;
+        #[link_name = "wasm96_input_get_touch_y"]
+        pub fn input_get_touch_y(index: u32) -> i32;
+        #[link_name = "wasm96_input_get_touch_phase"]
+        pub fn input_get_touch_phase(index: u32) -> u32;
+        #[link_name = "wasm96_input_set_touch_mouse"]
+        pub fn input_set_touch_mouse(enabled: u32);
+        #[link_name = "wasm96_input_text_input_start"]
+        pub fn input_text_input_start();
+        #[link_name = "wasm96_input_text_input_stop"]
+        pub fn input_text_input_stop();
+        #[link_name = "wasm96_input_get_text_input"]
+        pub fn input_get_text_input() -> u32;
+        #[link_name = "wasm96_input_record_start"]
+        pub fn input_record_start();
+        #[link_name = "wasm96_input_record_stop"]
+        pub fn input_record_stop() -> u32;
+        #[link_name = "wasm96_input_replay"]
+        pub fn input_replay(ptr: *const u8, len: u32) -> u32;
+        #[link_name = "wasm96_input_is_replaying"]
+        pub fn input_is_replaying() -> u32;
 
         // Audio
         #[link_name = "wasm96_audio_init"]
         pub fn audio_init(sample_rate: u32) -> u32;
         #[link_name = "wasm96_audio_push_samples"]
-        pub fn audio_push_samples(ptr: u32, len: u32);
+        pub fn audio_push_samples(ptr: *const i16, len: u32);
+        #[link_name = "wasm96_audio_get_queued_samples"]
+        pub fn audio_get_queued_samples() -> u32;
+        #[link_name = "wasm96_audio_get_buffer_capacity"]
+        pub fn audio_get_buffer_capacity() -> u32;
 
         #[link_name = "wasm96_audio_play_wav"]
-        pub fn audio_play_wav(ptr: u32, len: u32);
+        pub fn audio_play_wav(ptr: *const u8, len: u32);
 
         #[link_name = "wasm96_audio_play_qoa"]
-        pub fn audio_play_qoa(ptr: u32, len: u32);
+        pub fn audio_play_qoa(ptr: *const u8, len: u32);
 
         #[link_name = "wasm96_audio_play_xm"]
-        pub fn audio_play_xm(ptr: u32, len: u32);
+        pub fn audio_play_xm(ptr: *const u8, len: u32);
+
+        #[link_name = "wasm96_audio_xm_play"]
+        pub fn audio_xm_play(ptr: *const u8, len: u32) -> u32;
+        #[link_name = "wasm96_audio_xm_pause"]
+        pub fn audio_xm_pause(handle: u32, paused: u32);
+        #[link_name = "wasm96_audio_xm_stop"]
+        pub fn audio_xm_stop(handle: u32);
+        #[link_name = "wasm96_audio_xm_set_position"]
+        pub fn audio_xm_set_position(handle: u32, order: u32, row: u32) -> u32;
+        #[link_name = "wasm96_audio_xm_get_position"]
+        pub fn audio_xm_get_position(handle: u32) -> u32;
+        #[link_name = "wasm96_audio_xm_set_loop"]
+        pub fn audio_xm_set_loop(
+            handle: u32,
+            start_order: u32,
+            start_row: u32,
+            end_order: u32,
+            end_row: u32,
+        ) -> u32;
+        #[link_name = "wasm96_audio_xm_set_looping"]
+        pub fn audio_xm_set_looping(handle: u32, enabled: u32);
+        #[link_name = "wasm96_audio_xm_set_group"]
+        pub fn audio_xm_set_group(handle: u32, group: u32);
+
+        // Streamed music
+        #[link_name = "wasm96_audio_music_create"]
+        pub fn audio_music_create(ptr: *const u8, len: u32, format: u32) -> u32;
+        #[link_name = "wasm96_audio_music_play"]
+        pub fn audio_music_play(handle: u32);
+        #[link_name = "wasm96_audio_music_pause"]
+        pub fn audio_music_pause(handle: u32);
+        #[link_name = "wasm96_audio_music_stop"]
+        pub fn audio_music_stop(handle: u32);
+        #[link_name = "wasm96_audio_music_destroy"]
+        pub fn audio_music_destroy(handle: u32);
+        #[link_name = "wasm96_audio_music_seek"]
+        pub fn audio_music_seek(handle: u32, millis: u32) -> u32;
+        #[link_name = "wasm96_audio_music_position"]
+        pub fn audio_music_position(handle: u32) -> u32;
+        #[link_name = "wasm96_audio_music_set_volume"]
+        pub fn audio_music_set_volume(handle: u32, vol: f32);
+        #[link_name = "wasm96_audio_music_set_looping"]
+        pub fn audio_music_set_looping(handle: u32, enabled: u32);
+        #[link_name = "wasm96_audio_music_set_group"]
+        pub fn audio_music_set_group(handle: u32, group: u32);
+        #[link_name = "wasm96_audio_music_crossfade"]
+        pub fn audio_music_crossfade(from: u32, to: u32, millis: u32);
+
+        // MIDI + SoundFont (MIDI songs are music handles)
+        #[link_name = "wasm96_audio_soundfont_create"]
+        pub fn audio_soundfont_create(ptr: *const u8, len: u32) -> u32;
+        #[link_name = "wasm96_audio_soundfont_destroy"]
+        pub fn audio_soundfont_destroy(id: u32);
+        #[link_name = "wasm96_audio_midi_play"]
+        pub fn audio_midi_play(ptr: *const u8, len: u32, soundfont: u32) -> u32;
+        #[link_name = "wasm96_audio_midi_set_tempo"]
+        pub fn audio_midi_set_tempo(handle: u32, scale: f32);
+        #[link_name = "wasm96_audio_midi_set_channel_volume"]
+        pub fn audio_midi_set_channel_volume(handle: u32, channel: u32, vol: f32);
+
+        // Sound pools
+        #[link_name = "wasm96_audio_sound_pool_create"]
+        pub fn audio_sound_pool_create(ptr: *const u8, len: u32, max_voices: u32, steal_policy: u32) -> u32;
+        // Pool handle doubles as its load handle.
+        #[link_name = "wasm96_audio_sound_pool_create_async"]
+        pub fn audio_sound_pool_create_async(ptr: *const u8, len: u32, max_voices: u32, steal_policy: u32) -> u32;
+        #[link_name = "wasm96_audio_sound_pool_play"]
+        pub fn audio_sound_pool_play(pool: u32, vol: f32, pan: f32) -> u32;
+        #[link_name = "wasm96_audio_sound_pool_set_pitch_variation"]
+        pub fn audio_sound_pool_set_pitch_variation(pool: u32, amount: f32);
+        #[link_name = "wasm96_audio_sound_pool_set_group"]
+        pub fn audio_sound_pool_set_group(pool: u32, group: u32);
+        #[link_name = "wasm96_audio_sound_pool_active"]
+        pub fn audio_sound_pool_active(pool: u32) -> u32;
+        #[link_name = "wasm96_audio_sound_pool_stop"]
+        pub fn audio_sound_pool_stop(pool: u32);
+        #[link_name = "wasm96_audio_sound_pool_destroy"]
+        pub fn audio_sound_pool_destroy(pool: u32);
+
+        #[link_name = "wasm96_audio_set_master_volume"]
+        pub fn audio_set_master_volume(vol: f32);
+        #[link_name = "wasm96_audio_get_master_volume"]
+        pub fn audio_get_master_volume() -> f32;
+        #[link_name = "wasm96_audio_set_group_volume"]
+        pub fn audio_set_group_volume(group: u32, vol: f32);
+        #[link_name = "wasm96_audio_get_group_volume"]
+        pub fn audio_get_group_volume(group: u32) -> f32;
+        #[link_name = "wasm96_audio_synth_set_group"]
+        pub fn audio_synth_set_group(voice: u32, group: u32);
+
+        #[link_name = "wasm96_audio_set_pan"]
+        pub fn audio_set_pan(handle: u32, pan: f32);
+        #[link_name = "wasm96_audio_synth_set_pan"]
+        pub fn audio_synth_set_pan(voice: u32, pan: f32);
+        #[link_name = "wasm96_audio_set_listener"]
+        pub fn audio_set_listener(x: f32, y: f32);
+        #[link_name = "wasm96_audio_play_wav_at"]
+        pub fn audio_play_wav_at(ptr: *const u8, len: u32, x: f32, y: f32) -> u32;
+        #[link_name = "wasm96_audio_set_pitch"]
+        pub fn audio_set_pitch(handle: u32, ratio: f32);
+        #[link_name = "wasm96_audio_play_wav_pitched"]
+        pub fn audio_play_wav_pitched(ptr: *const u8, len: u32, ratio: f32) -> u32;
+
+        // Effects
+        #[link_name = "wasm96_audio_effect_enable"]
+        pub fn audio_effect_enable(effect: u32, a: f32, b: f32) -> u32;
+        #[link_name = "wasm96_audio_effect_disable"]
+        pub fn audio_effect_disable(effect: u32);
+        #[link_name = "wasm96_audio_set_send"]
+        pub fn audio_set_send(handle: u32, effect: u32, level: f32);
+        #[link_name = "wasm96_audio_synth_set_send"]
+        pub fn audio_synth_set_send(voice: u32, effect: u32, level: f32);
+        #[link_name = "wasm96_audio_group_set_send"]
+        pub fn audio_group_set_send(group: u32, effect: u32, level: f32);
+
+        // Microphone capture
+        #[link_name = "wasm96_audio_capture_start"]
+        pub fn audio_capture_start(sample_rate: u32) -> u32;
+        #[link_name = "wasm96_audio_capture_read"]
+        pub fn audio_capture_read(ptr: *mut i16, max_samples: u32) -> u32;
+        #[link_name = "wasm96_audio_capture_stop"]
+        pub fn audio_capture_stop();
+
+        #[link_name = "wasm96_audio_synth_voice_create"]
+        pub fn audio_synth_voice_create(waveform: u32) -> u32;
+        #[link_name = "wasm96_audio_synth_voice_destroy"]
+        pub fn audio_synth_voice_destroy(voice: u32);
+        #[link_name = "wasm96_audio_synth_set_envelope"]
+        pub fn audio_synth_set_envelope(
+            voice: u32,
+            attack_ms: u32,
+            decay_ms: u32,
+            sustain: f32,
+            release_ms: u32,
+        );
+        #[link_name = "wasm96_audio_synth_note_on"]
+        pub fn audio_synth_note_on(voice: u32, freq: f32, volume: f32);
+        #[link_name = "wasm96_audio_synth_note_off"]
+        pub fn audio_synth_note_off(voice: u32);
 
         // Storage
         #[link_name = "wasm96_storage_save"]
-        pub fn storage_save(key: u64, data_ptr: u32, data_len: u32);
+        pub fn storage_save(key: u64, data_ptr: *const u8, data_len: u32);
         #[link_name = "wasm96_storage_load"]
         pub fn storage_load(key: u64) -> u64;
         #[link_name = "wasm96_storage_free"]
         pub fn storage_free(ptr: u32, len: u32);
 
         // System
+        // Net
+        #[link_name = "wasm96_net_fetch"]
+        pub fn net_fetch(
+            method_ptr: *const u8,
+            method_len: u32,
+            url_ptr: *const u8,
+            url_len: u32,
+            headers_ptr: *const u8,
+            headers_len: u32,
+            body_ptr: *const u8,
+            body_len: u32,
+        ) -> u32;
+        #[link_name = "wasm96_net_poll"]
+        pub fn net_poll(id: u32) -> u32;
+        #[link_name = "wasm96_net_status"]
+        pub fn net_status(id: u32) -> u32;
+        #[link_name = "wasm96_net_take_body"]
+        pub fn net_take_body(id: u32) -> u32;
+        #[link_name = "wasm96_net_cancel"]
+        pub fn net_cancel(id: u32);
+        #[link_name = "wasm96_net_ws_open"]
+        pub fn net_ws_open(url_ptr: *const u8, url_len: u32) -> u32;
+        #[link_name = "wasm96_net_ws_state"]
+        pub fn net_ws_state(id: u32) -> u32;
+        #[link_name = "wasm96_net_ws_send"]
+        pub fn net_ws_send(id: u32, ptr: *const u8, len: u32, text: u32) -> u32;
+        #[link_name = "wasm96_net_ws_receive"]
+        pub fn net_ws_receive(id: u32) -> u32;
+        #[link_name = "wasm96_net_ws_close"]
+        pub fn net_ws_close(id: u32);
+
+        // Netplay sessions
+        #[link_name = "wasm96_net_session_create"]
+        pub fn net_session_create(players: u32, input_delay: u32, local_player: u32, port: u32) -> u32;
+        #[link_name = "wasm96_net_session_add_peer"]
+        pub fn net_session_add_peer(id: u32, player: u32, addr_ptr: *const u8, addr_len: u32) -> u32;
+        #[link_name = "wasm96_net_session_add_local_input"]
+        pub fn net_session_add_local_input(id: u32, ptr: *const u8, len: u32) -> u32;
+        #[link_name = "wasm96_net_session_synced_inputs"]
+        pub fn net_session_synced_inputs(id: u32) -> u32;
+        #[link_name = "wasm96_net_session_status"]
+        pub fn net_session_status(id: u32) -> u32;
+        #[link_name = "wasm96_net_session_frame"]
+        pub fn net_session_frame(id: u32) -> u32;
+        #[link_name = "wasm96_net_session_is_resimulating"]
+        pub fn net_session_is_resimulating(id: u32) -> u32;
+        #[link_name = "wasm96_net_session_local_port"]
+        pub fn net_session_local_port(id: u32) -> u32;
+        #[link_name = "wasm96_net_session_close"]
+        pub fn net_session_close(id: u32);
+        #[link_name = "wasm96_net_session_add_lan_peer"]
+        pub fn net_session_add_lan_peer(id: u32, player: u32, conn: u32) -> u32;
+
+        // LAN play
+        #[link_name = "wasm96_net_lan_discover"]
+        pub fn net_lan_discover() -> u32;
+        #[link_name = "wasm96_net_lan_connect"]
+        pub fn net_lan_connect(peer: u32) -> u32;
+        #[link_name = "wasm96_net_lan_accept"]
+        pub fn net_lan_accept() -> u32;
+        #[link_name = "wasm96_net_lan_state"]
+        pub fn net_lan_state(conn: u32) -> u32;
+        #[link_name = "wasm96_net_lan_send"]
+        pub fn net_lan_send(conn: u32, ptr: *const u8, len: u32, reliable: u32) -> u32;
+        #[link_name = "wasm96_net_lan_receive"]
+        pub fn net_lan_receive(conn: u32) -> u32;
+        #[link_name = "wasm96_net_lan_close"]
+        pub fn net_lan_close(conn: u32);
+
+        // Leaderboards
+        #[link_name = "wasm96_net_score_submit"]
+        pub fn net_score_submit(board_ptr: *const u8, board_len: u32, score: i64, meta_ptr: *const u8, meta_len: u32) -> u32;
+        #[link_name = "wasm96_net_score_fetch"]
+        pub fn net_score_fetch(board_ptr: *const u8, board_len: u32, count: u32) -> u32;
+
         #[link_name = "wasm96_system_log"]
-        pub fn system_log(ptr: u32, len: u32);
+        pub fn system_log(ptr: *const u8, len: u32);
+        #[link_name = "wasm96_system_log_at"]
+        pub fn system_log_at(level: u32, ptr: *const u8, len: u32);
+        #[link_name = "wasm96_system_set_log_level"]
+        pub fn system_set_log_level(level: u32);
+        #[link_name = "wasm96_system_report_error"]
+        pub fn system_report_error(msg_ptr: *const u8, msg_len: u32, stack_ptr: *const u8, stack_len: u32);
         #[link_name = "wasm96_system_millis"]
         pub fn system_millis() -> u64;
+        #[link_name = "wasm96_system_unix_time"]
+        pub fn system_unix_time() -> i64;
+        #[link_name = "wasm96_system_local_time_offset_minutes"]
+        pub fn system_local_time_offset_minutes() -> i32;
+        #[link_name = "wasm96_system_get_locale"]
+        pub fn system_get_locale() -> u32;
+        #[link_name = "wasm96_system_delta_millis"]
+        pub fn system_delta_millis() -> u64;
+        #[link_name = "wasm96_system_set_target_fps"]
+        pub fn system_set_target_fps(fps: u32);
+        #[link_name = "wasm96_system_get_fps"]
+        pub fn system_get_fps() -> u32;
+        #[link_name = "wasm96_system_set_update_rate"]
+        pub fn system_set_update_rate(hz: u32);
+        #[link_name = "wasm96_system_interpolation_alpha"]
+        pub fn system_interpolation_alpha() -> f32;
+        #[link_name = "wasm96_system_random"]
+        pub fn system_random() -> u64;
+        #[link_name = "wasm96_system_random_seed"]
+        pub fn system_random_seed() -> u64;
+        #[link_name = "wasm96_system_quit"]
+        pub fn system_quit();
+        #[link_name = "wasm96_system_reset"]
+        pub fn system_reset();
+        #[link_name = "wasm96_system_clipboard_get"]
+        pub fn system_clipboard_get() -> u32;
+        #[link_name = "wasm96_system_clipboard_poll"]
+        pub fn system_clipboard_poll(id: u32) -> u32;
+        #[link_name = "wasm96_system_clipboard_take"]
+        pub fn system_clipboard_take(id: u32) -> u32;
+        #[link_name = "wasm96_system_clipboard_cancel"]
+        pub fn system_clipboard_cancel(id: u32);
+        #[link_name = "wasm96_system_clipboard_set"]
+        pub fn system_clipboard_set(ptr: *const u8, len: u32) -> u32;
+        #[link_name = "wasm96_system_cart_meta"]
+        pub fn system_cart_meta(key_ptr: *const u8, key_len: u32) -> u32;
+        #[link_name = "wasm96_system_launch_arg"]
+        pub fn system_launch_arg(key_ptr: *const u8, key_len: u32) -> u32;
+        // Blob id of a `.w96` bundle asset (0 = none).
+        #[link_name = "wasm96_system_asset_read"]
+        pub fn system_asset_read(path_ptr: *const u8, path_len: u32) -> u32;
+        // Blob id of newline-separated asset paths under a prefix (0 = none).
+        #[link_name = "wasm96_system_asset_list"]
+        pub fn system_asset_list(prefix_ptr: *const u8, prefix_len: u32) -> u32;
+        #[link_name = "wasm96_system_stats"]
+        pub fn system_stats(ptr: *mut u8, len: u32) -> u32;
+        #[link_name = "wasm96_system_accessibility_settings"]
+        pub fn system_accessibility_settings(ptr: *mut u8, len: u32) -> u32;
+        // 0 = unknown, 1 = pending, 2 = ready, 3 = failed.
+        #[link_name = "wasm96_system_load_status"]
+        pub fn system_load_status(handle: u32) -> u32;
+        #[link_name = "wasm96_system_load_progress"]
+        pub fn system_load_progress() -> f32;
+
+        // Background jobs
+        #[link_name = "wasm96_system_job_spawn"]
+        pub fn system_job_spawn(name_ptr: *const u8, name_len: u32, arg: u32, data_ptr: *const u8, data_len: u32) -> u32;
+        // 0 = unknown, 1 = running, 2 = done, 3 = failed.
+        #[link_name = "wasm96_system_job_status"]
+        pub fn system_job_status(id: u32) -> u32;
+        #[link_name = "wasm96_system_job_result"]
+        pub fn system_job_result(id: u32) -> u32;
+        // Blob id of the job's output (0 = none).
+        #[link_name = "wasm96_system_job_output"]
+        pub fn system_job_output(id: u32) -> u32;
+        #[link_name = "wasm96_system_job_free"]
+        pub fn system_job_free(id: u32);
+        #[link_name = "wasm96_system_job_input_len"]
+        pub fn system_job_input_len() -> u32;
+        #[link_name = "wasm96_system_job_input_read"]
+        pub fn system_job_input_read(ptr: *mut u8, len: u32) -> u32;
+        #[link_name = "wasm96_system_job_output_write"]
+        pub fn system_job_output_write(ptr: *const u8, len: u32) -> u32;
+        // 1 if unlocked (now or before), 0 if the cart's manifest doesn't list the id.
+        #[link_name = "wasm96_system_achievement_unlock"]
+        pub fn system_achievement_unlock(id_ptr: *const u8, id_len: u32) -> u32;
+        #[link_name = "wasm96_system_achievement_progress"]
+        pub fn system_achievement_progress(id_ptr: *const u8, id_len: u32, value: u32, max: u32) -> u32;
+        // 1 from a hot reload of the cart until the first tick after it ends.
+        #[link_name = "wasm96_system_dev_reload_requested"]
+        pub fn system_dev_reload_requested() -> u32;
+        #[link_name = "wasm96_system_blob_len"]
+        pub fn system_blob_len(id: u32) -> u32;
+        #[link_name = "wasm96_system_blob_read"]
+        pub fn system_blob_read(id: u32, ptr: *mut u8, len: u32) -> u32;
+        #[link_name = "wasm96_system_blob_free"]
+        pub fn system_blob_free(id: u32);
+        #[link_name = "wasm96_system_screenshot"]
+        pub fn system_screenshot() -> u32;
+        #[link_name = "wasm96_system_record_gif_start"]
+        pub fn system_record_gif_start();
+        #[link_name = "wasm96_system_record_gif_stop"]
+        pub fn system_record_gif_stop() -> u32;
+        #[link_name = "wasm96_system_state_save"]
+        pub fn system_state_save() -> u32;
+        #[link_name = "wasm96_system_state_load"]
+        pub fn system_state_load(ptr: *const u8, len: u32) -> u32;
     }
 }
 
 /// Graphics API.
 pub mod graphics {
     use super::sys;
-    use crate::TextSize;
+    use crate::{
+        Color, DrawInstance, FillRule, FontMetrics, LineStyle, ParticleConfig, Point, PostEffect,
+        ScalingMode, ScreenTransition, TextSize, TextStyle,
+    };
+    use alloc::string::String;
+    use alloc::vec;
+    use alloc::vec::Vec;
 
     pub(crate) fn hash_key(key: &str) -> u64 {
         let mut hash: u64 = 0xcbf29ce484222325;
@@ -388,7 +1527,8 @@ pub mod graphics {
         hash
     }
 
-    /// Set the screen dimensions.
+    /// Set the screen dimensions. This may be called at any time: the framebuffer is cleared to
+    /// black and [`resized`] reports the change on the next tick. Sizes are clamped to 1920x1080.
     pub fn set_size(width: u32, height: u32) {
         unsafe { sys::graphics_set_size(width, height) }
     }
@@ -398,6 +1538,86 @@ pub mod graphics {
         unsafe { sys::graphics_set_color(r as u32, g as u32, b as u32, a as u32) }
     }
 
+    /// Multiply subsequent image, GIF and SVG draws by this color (RGBA), e.g. red for a damage
+    /// flash or black for a silhouette. Alpha below 255 blends them over what's underneath, for
+    /// fade-ins. The tint stays until changed; [`clear_tint`] turns it off.
+    pub fn set_tint(r: u8, g: u8, b: u8, a: u8) {
+        unsafe { sys::graphics_set_tint(r as u32, g as u32, b as u32, a as u32) }
+    }
+
+    /// Draw images, GIFs and SVGs untinted again.
+    pub fn clear_tint() {
+        set_tint(255, 255, 255, 255)
+    }
+
+    /// Filter every presented frame with a built-in effect. `strength` runs from 0 (off) to 1
+    /// (full). The effect applies to a copy at present time, so [`framebuffer_read`] still sees
+    /// the unfiltered frame. Frames that use 3D are not filtered.
+    pub fn set_post_effect(effect: PostEffect, strength: f32) {
+        unsafe { sys::graphics_set_post_effect(effect as u32, strength) }
+    }
+
+    /// Run every presented frame through a color grade, after the post effect. `lut` is one of:
+    /// - 256 bytes: a remap table applied to red, green and blue alike;
+    /// - 768 bytes: 256 RGB entries; red is remapped through the entries' reds, and so on;
+    /// - `n * n * n * 3` bytes (`n` 2..=64): a 3D LUT of RGB colors, red varying fastest, as in
+    ///   `.cube` files.
+    ///
+    /// Returns false (keeping the previous grade) for any other length. Good for day/night tints
+    /// and damage flashes without touching the draw calls. Frames that use 3D are not graded.
+    pub fn color_grade_set(lut: &[u8]) -> bool {
+        unsafe { sys::graphics_color_grade_set(lut.as_ptr(), lut.len() as u32) != 0 }
+    }
+
+    /// Remove the color grade.
+    pub fn color_grade_clear() {
+        unsafe {
+            sys::graphics_color_grade_set(core::ptr::null(), 0);
+        }
+    }
+
+    /// Choose how the framebuffer is fitted to the window. This only matters when the player
+    /// picked a fixed window size in the core options; at `native` the frontend scales the frame.
+    /// Frames that use 3D are presented at the framebuffer size.
+    pub fn set_scaling_mode(mode: ScalingMode) {
+        unsafe { sys::graphics_set_scaling_mode(mode as u32) }
+    }
+
+    /// Window size in pixels (width, height). This is the framebuffer size when the window size
+    /// core option is `native`.
+    pub fn window_size() -> (u32, u32) {
+        let packed = unsafe { sys::graphics_window_size() };
+        ((packed >> 32) as u32, packed as u32)
+    }
+
+    /// Ask for fullscreen. libretro can't switch the frontend's window mode, so this presents
+    /// frames at the full display size (1920x1080) with the current [`ScalingMode`] instead of
+    /// the window size option. [`window_size`] follows it.
+    pub fn set_fullscreen(enabled: bool) {
+        unsafe { sys::graphics_set_fullscreen(enabled as u32) }
+    }
+
+    /// Whether fullscreen was asked for with [`set_fullscreen`].
+    pub fn fullscreen() -> bool {
+        unsafe { sys::graphics_fullscreen() != 0 }
+    }
+
+    /// True during the first tick after the framebuffer or window changed size, so layouts can
+    /// be recomputed once.
+    pub fn resized() -> bool {
+        unsafe { sys::graphics_resized() != 0 }
+    }
+
+    /// Set the stroke width in pixels for lines, outlines, curves, and polylines.
+    pub fn set_line_width(px: u32) {
+        unsafe { sys::graphics_set_line_width(px) }
+    }
+
+    /// Set the dash pattern for lines, outlines, curves, and polylines.
+    pub fn set_line_style(style: LineStyle) {
+        unsafe { sys::graphics_set_line_style(style as u32) }
+    }
+
     /// Clear the screen with a specific color (RGB).
     pub fn background(r: u8, g: u8, b: u8) {
         unsafe { sys::graphics_background(r as u32, g as u32, b as u32) }
@@ -436,17 +1656,42 @@ pub mod graphics {
     /// Draw an image/sprite.
     /// `data` is a slice of RGBA bytes (4 bytes per pixel).
     pub fn image(x: i32, y: i32, w: u32, h: u32, data: &[u8]) {
-        unsafe { sys::graphics_image(x, y, w, h, data.as_ptr() as u32, data.len() as u32) }
+        unsafe { sys::graphics_image(x, y, w, h, data.as_ptr(), data.len() as u32) }
     }
 
     /// Draw an image from raw PNG bytes.
     pub fn image_png(x: i32, y: i32, data: &[u8]) {
-        unsafe { sys::graphics_image_png(x, y, data.as_ptr() as u32, data.len() as u32) }
+        unsafe { sys::graphics_image_png(x, y, data.as_ptr(), data.len() as u32) }
     }
 
     /// Draw an image from raw JPEG bytes.
     pub fn image_jpeg(x: i32, y: i32, data: &[u8]) {
-        unsafe { sys::graphics_image_jpeg(x, y, data.as_ptr() as u32, data.len() as u32) }
+        unsafe { sys::graphics_image_jpeg(x, y, data.as_ptr(), data.len() as u32) }
+    }
+
+    /// Copy a `w`x`h` block of RGBA8888 pixels straight into the framebuffer.
+    ///
+    /// Every pixel is written (no alpha test), so this is the fast path for effects that compute
+    /// a whole buffer locally and blit it once per frame.
+    pub fn framebuffer_write(x: i32, y: i32, w: u32, h: u32, pixels: &[u8]) {
+        unsafe { sys::graphics_framebuffer_write(x, y, w, h, pixels.as_ptr(), pixels.len() as u32) }
+    }
+
+    /// Read a `w`x`h` block of the framebuffer as RGBA8888 into `out`.
+    ///
+    /// Returns `false` if `out` is smaller than `w * h * 4` bytes. Off-screen pixels read as zero.
+    pub fn framebuffer_read_into(x: i32, y: i32, w: u32, h: u32, out: &mut [u8]) -> bool {
+        let written = unsafe {
+            sys::graphics_framebuffer_read(x, y, w, h, out.as_mut_ptr(), out.len() as u32)
+        };
+        written != 0
+    }
+
+    /// Read a `w`x`h` block of the framebuffer as RGBA8888.
+    pub fn framebuffer_read(x: i32, y: i32, w: u32, h: u32) -> Vec<u8> {
+        let mut out = vec![0u8; (w as usize) * (h as usize) * 4];
+        framebuffer_read_into(x, y, w, h, &mut out);
+        out
     }
 
     /// Register an encoded PNG (bytes) with the host under a string key.
@@ -454,11 +1699,8 @@ pub mod graphics {
     /// Returns true on success.
     pub fn gif_register(key: &str, gif_bytes: &[u8]) -> bool {
         unsafe {
-            sys::graphics_gif_register(
-                hash_key(key),
-                gif_bytes.as_ptr() as u32,
-                gif_bytes.len() as u32,
-            ) != 0
+            sys::graphics_gif_register(hash_key(key), gif_bytes.as_ptr(), gif_bytes.len() as u32)
+                != 0
         }
     }
 
@@ -477,90 +1719,473 @@ pub mod graphics {
         unsafe { sys::graphics_gif_unregister(hash_key(key)) }
     }
 
-    /// Draw a filled triangle.
-    pub fn triangle(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
-        unsafe { sys::graphics_triangle(x1, y1, x2, y2, x3, y3) }
+    /// Number of frames in a registered GIF (0 if the key is unknown).
+    pub fn gif_frame_count(key: &str) -> u32 {
+        unsafe { sys::graphics_gif_frame_count(hash_key(key)) }
     }
 
-    /// Draw a triangle outline.
-    pub fn triangle_outline(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
-        unsafe { sys::graphics_triangle_outline(x1, y1, x2, y2, x3, y3) }
+    /// How long frame `frame` of a registered GIF is shown, in milliseconds.
+    pub fn gif_frame_delay(key: &str, frame: u32) -> u32 {
+        unsafe { sys::graphics_gif_frame_delay(hash_key(key), frame) }
     }
 
-    /// Draw a quadratic Bezier curve.
-    pub fn bezier_quadratic(x1: i32, y1: i32, cx: i32, cy: i32, x2: i32, y2: i32, segments: u32) {
-        unsafe { sys::graphics_bezier_quadratic(x1, y1, cx, cy, x2, y2, segments) }
+    /// Draw one frame of a registered GIF regardless of the host clock, scaled to `w`x`h`
+    /// (natural size if either is 0). See [`crate::animation::Animation`] for playback.
+    pub fn gif_draw_frame(key: &str, frame: u32, x: i32, y: i32, w: u32, h: u32) {
+        unsafe { sys::graphics_gif_draw_frame(hash_key(key), frame, x, y, w, h) }
     }
 
-    /// Draw a cubic Bezier curve.
-    pub fn bezier_cubic(
-        x1: i32,
-        y1: i32,
-        cx1: i32,
-        cy1: i32,
-        cx2: i32,
-        cy2: i32,
-        x2: i32,
-        y2: i32,
-        segments: u32,
-    ) {
-        unsafe { sys::graphics_bezier_cubic(x1, y1, cx1, cy1, cx2, cy2, x2, y2, segments) }
+    /// Jump a registered GIF's host playback (used by [`gif_draw_key`] and friends) to the start
+    /// of `frame`. Frame indices wrap around.
+    pub fn gif_set_frame(key: &str, frame: u32) {
+        unsafe { sys::graphics_gif_set_frame(hash_key(key), frame) }
     }
 
-    /// Draw a filled pill.
-    pub fn pill(x: i32, y: i32, w: u32, h: u32) {
-        unsafe { sys::graphics_pill(x, y, w, h) }
+    /// Scale a registered GIF's playback speed: 1 is normal, 2 twice as fast, 0 frozen.
+    pub fn gif_set_speed(key: &str, multiplier: f32) {
+        unsafe { sys::graphics_gif_set_speed(hash_key(key), multiplier) }
     }
 
-    /// Draw a pill outline.
-    pub fn pill_outline(x: i32, y: i32, w: u32, h: u32) {
-        unsafe { sys::graphics_pill_outline(x, y, w, h) }
+    /// Pause or resume a registered GIF's playback where it is.
+    pub fn gif_pause(key: &str, paused: bool) {
+        unsafe { sys::graphics_gif_pause(hash_key(key), paused as u32) }
     }
 
-    // =========================
-    // 3D Graphics
-    // =========================
+    /// Register an Aseprite file (`.ase`/`.aseprite`, e.g. from `include_bytes!`) under a
+    /// string key, keeping its tags, layers and frame durations. Returns true on success.
+    pub fn aseprite_register(key: &str, data: &[u8]) -> bool {
+        unsafe {
+            sys::graphics_aseprite_register(hash_key(key), data.as_ptr(), data.len() as u32) != 0
+        }
+    }
 
-    pub fn set_3d(enable: bool) {
-        unsafe { sys::graphics_set_3d(enable as u32) }
+    /// Unregister an Aseprite sprite by key.
+    pub fn aseprite_unregister(key: &str) {
+        unsafe { sys::graphics_aseprite_unregister(hash_key(key)) }
     }
 
-    pub fn camera_look_at(eye: (f32, f32, f32), target: (f32, f32, f32), up: (f32, f32, f32)) {
-        unsafe {
-            sys::graphics_camera_look_at(
-                eye.0, eye.1, eye.2, target.0, target.1, target.2, up.0, up.1, up.2,
-            )
-        }
+    /// Canvas (width, height) of a registered sprite, or (0, 0) if it isn't registered.
+    pub fn aseprite_size(key: &str) -> (u32, u32) {
+        let packed = unsafe { sys::graphics_aseprite_size(hash_key(key)) };
+        ((packed >> 32) as u32, packed as u32)
     }
 
-    pub fn camera_perspective(fovy: f32, aspect: f32, near: f32, far: f32) {
-        unsafe { sys::graphics_camera_perspective(fovy, aspect, near, far) }
+    /// Number of frames in a registered sprite (0 if the key is unknown).
+    pub fn aseprite_frame_count(key: &str) -> u32 {
+        unsafe { sys::graphics_aseprite_frame_count(hash_key(key)) }
     }
 
-    pub fn mesh_create(key: &str, vertices: &[f32], indices: &[u32]) -> bool {
-        let k = hash_key(key);
-        unsafe {
-            sys::graphics_mesh_create(
-                k,
-                vertices.as_ptr(),
-                vertices.len(),
-                indices.as_ptr(),
-                indices.len(),
-            ) != 0
-        }
+    /// How long frame `frame` is shown, in milliseconds, as set in Aseprite.
+    pub fn aseprite_frame_duration(key: &str, frame: u32) -> u32 {
+        unsafe { sys::graphics_aseprite_frame_duration(hash_key(key), frame) }
     }
 
-    pub fn mesh_create_obj(key: &str, obj_data: &[u8]) -> bool {
-        let k = hash_key(key);
-        unsafe { sys::graphics_mesh_create_obj(k, obj_data.as_ptr(), obj_data.len()) != 0 }
+    /// Milliseconds of one pass through `tag` (there and back for ping-pong tags), or 0 if the
+    /// sprite has no such tag. `""` stands for every frame.
+    pub fn aseprite_tag_duration(key: &str, tag: &str) -> u32 {
+        unsafe {
+            sys::graphics_aseprite_tag_duration(hash_key(key), tag.as_ptr(), tag.len() as u32)
+        }
     }
 
-    pub fn mesh_create_stl(key: &str, stl_data: &[u8]) -> bool {
-        let k = hash_key(key);
-        unsafe { sys::graphics_mesh_create_stl(k, stl_data.as_ptr(), stl_data.len()) != 0 }
+    /// Draw one frame at natural size. Frame indices wrap around.
+    pub fn aseprite_draw_frame(key: &str, frame: u32, x: i32, y: i32) {
+        unsafe { sys::graphics_aseprite_draw_frame(hash_key(key), frame, x, y) }
     }
 
-    pub fn mesh_draw(
+    /// Draw the frame `tag` shows `millis` after the animation started, following the tag's
+    /// direction and repeat count (`""` plays every frame). Keep `millis` in your own state, so
+    /// each entity animates on its own clock:
+    ///
+    /// ```ignore
+    /// self.walk_ms += system::delta_millis() as u32;
+    /// graphics::aseprite_draw_tag("hero", "walk", self.walk_ms, x, y);
+    /// ```
+    ///
+    /// Returns the frame drawn, or `None` if the sprite or tag doesn't exist.
+    pub fn aseprite_draw_tag(key: &str, tag: &str, millis: u32, x: i32, y: i32) -> Option<u32> {
+        let frame = unsafe {
+            sys::graphics_aseprite_draw_tag(
+                hash_key(key),
+                tag.as_ptr(),
+                tag.len() as u32,
+                millis,
+                x,
+                y,
+            )
+        };
+        (frame != u32::MAX).then_some(frame)
+    }
+
+    /// Show or hide every layer named `layer` (a hat, a weapon, a team color). Returns how many
+    /// layers matched. Every frame is re-composited, so call it when the look changes.
+    pub fn aseprite_set_layer_visible(key: &str, layer: &str, visible: bool) -> u32 {
+        unsafe {
+            sys::graphics_aseprite_set_layer_visible(
+                hash_key(key),
+                layer.as_ptr(),
+                layer.len() as u32,
+                visible as u32,
+            )
+        }
+    }
+
+    /// An object from a map's object layers (Tiled) or entity layers (LDtk): a spawn point, a
+    /// collider, a door.
+    #[derive(Clone, Debug, PartialEq)]
+    pub struct MapObject {
+        /// Tiled's object id; LDtk entities are numbered from 1 within their layer.
+        pub id: u32,
+        /// Name of the layer holding it.
+        pub layer: String,
+        pub name: String,
+        /// Tiled's type/class, or the LDtk entity identifier.
+        pub kind: String,
+        /// Top-left corner, in map pixels.
+        pub x: f32,
+        pub y: f32,
+        pub width: f32,
+        pub height: f32,
+        /// Custom properties (LDtk fields) as text; non-string values are JSON.
+        pub properties: Vec<(String, String)>,
+    }
+
+    impl MapObject {
+        /// The value of property `name`, if set.
+        pub fn property(&self, name: &str) -> Option<&str> {
+            self.properties
+                .iter()
+                .find(|(k, _)| k == name)
+                .map(|(_, v)| v.as_str())
+        }
+    }
+
+    /// Load a Tiled (`.tmx`, `.tmj`) or LDtk (`.ldtk`) map from the cart bundle under a string
+    /// key, registering the tileset images it uses under their bundle paths. `level` picks an
+    /// LDtk level by identifier (`""` = the first; Tiled maps ignore it). Returns true on success.
+    pub fn map_load(key: &str, path: &str, level: &str) -> bool {
+        unsafe {
+            sys::graphics_map_load(
+                hash_key(key),
+                path.as_ptr(),
+                path.len() as u32,
+                level.as_ptr(),
+                level.len() as u32,
+            ) != 0
+        }
+    }
+
+    /// Like [`map_load`], from bytes (e.g. `include_bytes!`). Tileset files and images are
+    /// looked up in the bundle from its root; without a bundle, register the images first with
+    /// [`png_register`] under the paths the map uses.
+    pub fn map_register(key: &str, data: &[u8], level: &str) -> bool {
+        unsafe {
+            sys::graphics_map_register(
+                hash_key(key),
+                data.as_ptr(),
+                data.len() as u32,
+                level.as_ptr(),
+                level.len() as u32,
+            ) != 0
+        }
+    }
+
+    /// Unregister a map by key. Its tileset images stay registered.
+    pub fn map_unregister(key: &str) {
+        unsafe { sys::graphics_map_unregister(hash_key(key)) }
+    }
+
+    /// Map size in tiles (columns, rows), or (0, 0) if it isn't registered.
+    pub fn map_size(key: &str) -> (u32, u32) {
+        let packed = unsafe { sys::graphics_map_size(hash_key(key)) };
+        ((packed >> 32) as u32, packed as u32)
+    }
+
+    /// Tile size in pixels (width, height), or (0, 0) if the map isn't registered.
+    pub fn map_tile_size(key: &str) -> (u32, u32) {
+        let packed = unsafe { sys::graphics_map_tile_size(hash_key(key)) };
+        ((packed >> 32) as u32, packed as u32)
+    }
+
+    /// Number of tile layers, indexed bottom to top.
+    pub fn map_layer_count(key: &str) -> u32 {
+        unsafe { sys::graphics_map_layer_count(hash_key(key)) }
+    }
+
+    /// Index of the tile layer called `name`, if there is one.
+    pub fn map_layer_index(key: &str, name: &str) -> Option<u32> {
+        let index = unsafe {
+            sys::graphics_map_layer_index(hash_key(key), name.as_ptr(), name.len() as u32)
+        };
+        u32::try_from(index).ok()
+    }
+
+    /// Tile id at a cell (flip flags removed), or the value on LDtk IntGrid layers; 0 is empty.
+    pub fn map_tile(key: &str, layer: u32, column: u32, row: u32) -> u32 {
+        unsafe { sys::graphics_map_tile(hash_key(key), layer, column, row) }
+    }
+
+    /// The map's objects, in file order.
+    pub fn map_objects(key: &str) -> Vec<MapObject> {
+        fn take<'a>(rest: &mut &'a [u8], n: usize) -> Option<&'a [u8]> {
+            let (head, tail) = rest.split_at_checked(n)?;
+            *rest = tail;
+            Some(head)
+        }
+        fn word(rest: &mut &[u8]) -> Option<[u8; 4]> {
+            take(rest, 4)?.try_into().ok()
+        }
+        fn text(rest: &mut &[u8]) -> Option<String> {
+            let len = u32::from_le_bytes(word(rest)?);
+            String::from_utf8(take(rest, len as usize)?.to_vec()).ok()
+        }
+        fn object(rest: &mut &[u8]) -> Option<MapObject> {
+            let id = u32::from_le_bytes(word(rest)?);
+            let x = f32::from_le_bytes(word(rest)?);
+            let y = f32::from_le_bytes(word(rest)?);
+            let width = f32::from_le_bytes(word(rest)?);
+            let height = f32::from_le_bytes(word(rest)?);
+            let (layer, name, kind) = (text(rest)?, text(rest)?, text(rest)?);
+            let count = u32::from_le_bytes(word(rest)?);
+            let mut properties = Vec::new();
+            for _ in 0..count {
+                properties.push((text(rest)?, text(rest)?));
+            }
+            Some(MapObject {
+                id,
+                layer,
+                name,
+                kind,
+                x,
+                y,
+                width,
+                height,
+                properties,
+            })
+        }
+        let Some(data) =
+            super::system::take_blob(unsafe { sys::graphics_map_objects(hash_key(key)) })
+        else {
+            return Vec::new();
+        };
+        let mut objects = Vec::new();
+        let mut rest = &data[..];
+        while let Some(o) = object(&mut rest) {
+            objects.push(o);
+        }
+        objects
+    }
+
+    /// Draw every visible tile layer, bottom to top, with the map's top-left at (x, y).
+    pub fn map_draw(key: &str, x: i32, y: i32) {
+        unsafe { sys::graphics_map_draw(hash_key(key), x, y) }
+    }
+
+    /// Draw one tile layer (even one hidden in the editor) with the map's top-left at (x, y).
+    pub fn map_draw_layer(key: &str, layer: u32, x: i32, y: i32) {
+        unsafe { sys::graphics_map_draw_layer(hash_key(key), layer, x, y) }
+    }
+
+    /// Draw a filled triangle.
+    pub fn triangle(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
+        unsafe { sys::graphics_triangle(x1, y1, x2, y2, x3, y3) }
+    }
+
+    /// Draw a triangle outline.
+    pub fn triangle_outline(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
+        unsafe { sys::graphics_triangle_outline(x1, y1, x2, y2, x3, y3) }
+    }
+
+    /// Draw a quadratic Bezier curve.
+    pub fn bezier_quadratic(x1: i32, y1: i32, cx: i32, cy: i32, x2: i32, y2: i32, segments: u32) {
+        unsafe { sys::graphics_bezier_quadratic(x1, y1, cx, cy, x2, y2, segments) }
+    }
+
+    /// Draw a cubic Bezier curve.
+    pub fn bezier_cubic(
+        x1: i32,
+        y1: i32,
+        cx1: i32,
+        cy1: i32,
+        cx2: i32,
+        cy2: i32,
+        x2: i32,
+        y2: i32,
+        segments: u32,
+    ) {
+        unsafe { sys::graphics_bezier_cubic(x1, y1, cx1, cy1, cx2, cy2, x2, y2, segments) }
+    }
+
+    /// Draw a filled pill.
+    pub fn pill(x: i32, y: i32, w: u32, h: u32) {
+        unsafe { sys::graphics_pill(x, y, w, h) }
+    }
+
+    /// Draw a pill outline.
+    pub fn pill_outline(x: i32, y: i32, w: u32, h: u32) {
+        unsafe { sys::graphics_pill_outline(x, y, w, h) }
+    }
+
+    /// Fill a rectangle with a bilinear gradient between four corner colors.
+    pub fn rect_gradient(
+        x: i32,
+        y: i32,
+        w: u32,
+        h: u32,
+        top_left: Color,
+        top_right: Color,
+        bottom_left: Color,
+        bottom_right: Color,
+    ) {
+        unsafe {
+            sys::graphics_rect_gradient(
+                x,
+                y,
+                w,
+                h,
+                top_left.to_u32(),
+                top_right.to_u32(),
+                bottom_left.to_u32(),
+                bottom_right.to_u32(),
+            )
+        }
+    }
+
+    /// Fill a circle with a radial gradient from `inner` at the center to `outer` at the edge.
+    pub fn circle_gradient(x: i32, y: i32, r: u32, inner: Color, outer: Color) {
+        unsafe { sys::graphics_circle_gradient(x, y, r, inner.to_u32(), outer.to_u32()) }
+    }
+
+    /// Draw a filled polygon (even-odd rule) in a single call.
+    pub fn polygon(points: &[Point]) {
+        unsafe { sys::graphics_polygon(points.as_ptr(), points.len() as u32) }
+    }
+
+    /// Draw connected line segments through `points`; `closed` joins the last point to the first.
+    pub fn polyline(points: &[Point], closed: bool) {
+        unsafe {
+            sys::graphics_polyline(
+                points.as_ptr(),
+                points.len() as u32,
+                if closed { 1 } else { 0 },
+            )
+        }
+    }
+
+    /// Draw a filled ellipse centered at (x, y) with radii (rx, ry).
+    pub fn ellipse(x: i32, y: i32, rx: u32, ry: u32) {
+        unsafe { sys::graphics_ellipse(x, y, rx, ry) }
+    }
+
+    /// Draw an ellipse outline centered at (x, y) with radii (rx, ry).
+    pub fn ellipse_outline(x: i32, y: i32, rx: u32, ry: u32) {
+        unsafe { sys::graphics_ellipse_outline(x, y, rx, ry) }
+    }
+
+    /// Draw a circular arc. Angles are in radians, clockwise from +x (screen y points down).
+    pub fn arc(x: i32, y: i32, r: u32, start: f32, end: f32) {
+        unsafe { sys::graphics_arc(x, y, r, start, end) }
+    }
+
+    /// Draw a filled pie slice. Angles follow the same convention as [`arc`].
+    pub fn arc_filled(x: i32, y: i32, r: u32, start: f32, end: f32) {
+        unsafe { sys::graphics_arc_filled(x, y, r, start, end) }
+    }
+
+    // Overloads taking `Point`s, `math::Vec2`s and `math::Rect`s. Float positions round to the
+    // nearest pixel; rectangle sizes round too and clamp at zero.
+
+    /// [`point`] at `p`.
+    pub fn point_at(p: impl Into<Point>) {
+        let p = p.into();
+        point(p.x, p.y)
+    }
+
+    /// [`line`] from `a` to `b`.
+    pub fn line_between(a: impl Into<Point>, b: impl Into<Point>) {
+        let (a, b) = (a.into(), b.into());
+        line(a.x, a.y, b.x, b.y)
+    }
+
+    /// [`circle`] centered at `center`.
+    pub fn circle_at(center: impl Into<Point>, r: u32) {
+        let c = center.into();
+        circle(c.x, c.y, r)
+    }
+
+    /// [`circle_outline`] centered at `center`.
+    pub fn circle_outline_at(center: impl Into<Point>, r: u32) {
+        let c = center.into();
+        circle_outline(c.x, c.y, r)
+    }
+
+    pub(crate) fn rect_pixels(r: crate::math::Rect) -> (i32, i32, u32, u32) {
+        let min = Point::from(r.position());
+        let max = Point::from(crate::math::Vec2::new(r.right(), r.bottom()));
+        (
+            min.x,
+            min.y,
+            max.x.saturating_sub(min.x).max(0) as u32,
+            max.y.saturating_sub(min.y).max(0) as u32,
+        )
+    }
+
+    /// [`rect`] covering `r`.
+    pub fn rect_of(r: crate::math::Rect) {
+        let (x, y, w, h) = rect_pixels(r);
+        rect(x, y, w, h)
+    }
+
+    /// [`rect_outline`] around `r`.
+    pub fn rect_outline_of(r: crate::math::Rect) {
+        let (x, y, w, h) = rect_pixels(r);
+        rect_outline(x, y, w, h)
+    }
+
+    // =========================
+    // 3D Graphics
+    // =========================
+
+    pub fn set_3d(enable: bool) {
+        unsafe { sys::graphics_set_3d(enable as u32) }
+    }
+
+    pub fn camera_look_at(eye: (f32, f32, f32), target: (f32, f32, f32), up: (f32, f32, f32)) {
+        unsafe {
+            sys::graphics_camera_look_at(
+                eye.0, eye.1, eye.2, target.0, target.1, target.2, up.0, up.1, up.2,
+            )
+        }
+    }
+
+    pub fn camera_perspective(fovy: f32, aspect: f32, near: f32, far: f32) {
+        unsafe { sys::graphics_camera_perspective(fovy, aspect, near, far) }
+    }
+
+    pub fn mesh_create(key: &str, vertices: &[f32], indices: &[u32]) -> bool {
+        let k = hash_key(key);
+        unsafe {
+            sys::graphics_mesh_create(
+                k,
+                vertices.as_ptr(),
+                vertices.len(),
+                indices.as_ptr(),
+                indices.len(),
+            ) != 0
+        }
+    }
+
+    pub fn mesh_create_obj(key: &str, obj_data: &[u8]) -> bool {
+        let k = hash_key(key);
+        unsafe { sys::graphics_mesh_create_obj(k, obj_data.as_ptr(), obj_data.len()) != 0 }
+    }
+
+    pub fn mesh_create_stl(key: &str, stl_data: &[u8]) -> bool {
+        let k = hash_key(key);
+        unsafe { sys::graphics_mesh_create_stl(k, stl_data.as_ptr(), stl_data.len()) != 0 }
+    }
+
+    pub fn mesh_draw(
         key: &str,
         pos: (f32, f32, f32),
         rot: (f32, f32, f32),
@@ -589,11 +2214,8 @@ pub mod graphics {
     /// Returns true on success.
     pub fn svg_register(key: &str, svg_bytes: &[u8]) -> bool {
         unsafe {
-            sys::graphics_svg_register(
-                hash_key(key),
-                svg_bytes.as_ptr() as u32,
-                svg_bytes.len() as u32,
-            ) != 0
+            sys::graphics_svg_register(hash_key(key), svg_bytes.as_ptr(), svg_bytes.len() as u32)
+                != 0
         }
     }
 
@@ -607,15 +2229,32 @@ pub mod graphics {
         unsafe { sys::graphics_svg_unregister(hash_key(key)) }
     }
 
+    /// Intrinsic (width, height) of a keyed SVG in pixels, or (0, 0) if it isn't registered.
+    pub fn svg_size(key: &str) -> (u32, u32) {
+        let packed = unsafe { sys::graphics_svg_size(hash_key(key)) };
+        ((packed >> 32) as u32, packed as u32)
+    }
+
+    /// Recolor the elements of a keyed SVG matching `selector`: `"#id"`, `".class"`, or a bare
+    /// name matching either. Children without their own fill inherit it. Returns how many
+    /// elements changed.
+    pub fn svg_set_fill(key: &str, selector: &str, color: Color) -> u32 {
+        unsafe {
+            sys::graphics_svg_set_fill(
+                hash_key(key),
+                selector.as_ptr(),
+                selector.len() as u32,
+                color.to_u32(),
+            )
+        }
+    }
+
     /// Register a PNG resource (encoded bytes) under a string key.
     /// Returns true on success.
     pub fn png_register(key: &str, png_bytes: &[u8]) -> bool {
         unsafe {
-            sys::graphics_png_register(
-                hash_key(key),
-                png_bytes.as_ptr() as u32,
-                png_bytes.len() as u32,
-            ) != 0
+            sys::graphics_png_register(hash_key(key), png_bytes.as_ptr(), png_bytes.len() as u32)
+                != 0
         }
     }
 
@@ -638,11 +2277,11 @@ pub mod graphics {
         unsafe {
             sys::graphics_mtl_register_texture(
                 hash_key(texture_key),
-                mtl_bytes.as_ptr() as u32,
+                mtl_bytes.as_ptr(),
                 mtl_bytes.len() as u32,
-                tex_filename.as_ptr() as u32,
+                tex_filename.as_ptr(),
                 tex_filename.len() as u32,
-                tex_bytes.as_ptr() as u32,
+                tex_bytes.as_ptr(),
                 tex_bytes.len() as u32,
             ) != 0
         }
@@ -652,14 +2291,21 @@ pub mod graphics {
     /// Returns true on success.
     pub fn jpeg_register(key: &str, jpeg_bytes: &[u8]) -> bool {
         unsafe {
-            sys::graphics_jpeg_register(
-                hash_key(key),
-                jpeg_bytes.as_ptr() as u32,
-                jpeg_bytes.len() as u32,
-            ) != 0
+            sys::graphics_jpeg_register(hash_key(key), jpeg_bytes.as_ptr(), jpeg_bytes.len() as u32)
+                != 0
         }
     }
 
+    /// Register a PNG or JPEG under a string key, decoding it in the background so big images
+    /// don't stall the frame. Returns a load handle for [`system::is_ready`](crate::system::is_ready)
+    /// (`None` if the bytes couldn't be handed over); the key draws nothing until then.
+    pub fn image_register_async(key: &str, bytes: &[u8]) -> Option<u32> {
+        let handle = unsafe {
+            sys::graphics_image_register_async(hash_key(key), bytes.as_ptr(), bytes.len() as u32)
+        };
+        (handle != 0).then_some(handle)
+    }
+
     /// Draw a registered PNG by key at natural size.
     pub fn png_draw_key(key: &str, x: i32, y: i32) {
         unsafe { sys::graphics_png_draw_key(hash_key(key), x, y) }
@@ -685,59 +2331,431 @@ pub mod graphics {
         unsafe { sys::graphics_png_unregister(hash_key(key)) }
     }
 
-    /// Unregister a JPEG by key.
-    pub fn jpeg_unregister(key: &str) {
-        unsafe { sys::graphics_jpeg_unregister(hash_key(key)) }
+    /// Draw the `sw`x`sh` region at (`sx`, `sy`) of a registered PNG or JPEG at (x, y), scaled to
+    /// `w`x`h` (the region's size if either is 0). Use this to draw sprite-sheet cells.
+    #[allow(clippy::too_many_arguments)]
+    pub fn image_draw_region(
+        key: &str,
+        sx: i32,
+        sy: i32,
+        sw: u32,
+        sh: u32,
+        x: i32,
+        y: i32,
+        w: u32,
+        h: u32,
+    ) {
+        unsafe { sys::graphics_image_draw_region(hash_key(key), sx, sy, sw, sh, x, y, w, h) }
     }
 
-    /// Register a TTF/OTF font under a string key.
-    ///
-    /// ## What the host does
-    /// - The host reads the encoded font bytes immediately during this call.
-    /// - It attempts to parse them as a TTF/OTF via its font rasterizer.
-    /// - On success it stores the font in a host-side table and associates it with `hash_key(key)`.
-    ///
-    /// ## When to call this
-    /// Prefer calling during `setup()` (once), *not per-frame*.
-    ///
-    /// ## Return value
-    /// Returns `true` if the host successfully parsed and registered the font.
+    fn flip_flags(flip_x: bool, flip_y: bool) -> u32 {
+        (flip_x as u32) | ((flip_y as u32) << 1)
+    }
+
+    /// Draw a registered PNG or JPEG scaled to `w`x`h` (natural size if either is 0), optionally
+    /// mirrored, and rotated `angle` radians clockwise around (`pivot_x`, `pivot_y`).
     ///
-    /// ## Notes
-    /// - If you never register a font for a key, `text_key`/`text_measure_key` will still work due
-    ///   to host fallback (Spleen size 16), but metrics/appearance may differ from what you expect.
-    pub fn font_register_ttf(key: &str, data: &[u8]) -> bool {
+    /// (x, y) is where the unrotated top-left corner goes and the pivot is measured from it, so
+    /// `pivot = (w / 2, h / 2)` spins the sprite in place.
+    #[allow(clippy::too_many_arguments)]
+    pub fn image_draw_ex(
+        key: &str,
+        x: i32,
+        y: i32,
+        w: u32,
+        h: u32,
+        angle: f32,
+        flip_x: bool,
+        flip_y: bool,
+        pivot_x: i32,
+        pivot_y: i32,
+    ) {
+        let flags = flip_flags(flip_x, flip_y);
         unsafe {
-            sys::graphics_font_register_ttf(hash_key(key), data.as_ptr() as u32, data.len() as u32)
-                != 0
+            sys::graphics_image_draw_ex(hash_key(key), x, y, w, h, angle, flags, pivot_x, pivot_y)
         }
     }
 
-    /// Register a BDF bitmap font under a string key.
-    ///
-    /// ## What the host does
-    /// - The host reads `data` immediately and parses the BDF text.
-    /// - It extracts the font bounding box (pixel width/height) and glyph bitmaps.
-    /// - On success, the parsed font is stored and associated with `hash_key(key)`.
-    ///
-    /// ## When to use BDF
-    /// Use BDF for crisp pixel fonts, debug overlays, and UIs where you want deterministic
-    /// bitmap metrics and a retro look.
+    /// Draw a registered PNG or JPEG as a `w`x`h` nine-slice (9-patch) panel.
     ///
-    /// ## Return value
-    /// Returns `true` if parsing succeeded and the font was registered.
-    pub fn font_register_bdf(key: &str, data: &[u8]) -> bool {
+    /// `left`/`top`/`right`/`bottom` are the border widths in source pixels. The corners are drawn
+    /// at their natural size, the edges stretch along one axis and the center along both, so panel
+    /// art stays crisp at any size. If the panel is smaller than the borders, they shrink to fit.
+    #[allow(clippy::too_many_arguments)]
+    pub fn image_draw_nine_slice(
+        key: &str,
+        x: i32,
+        y: i32,
+        w: u32,
+        h: u32,
+        left: u32,
+        top: u32,
+        right: u32,
+        bottom: u32,
+    ) {
         unsafe {
-            sys::graphics_font_register_bdf(hash_key(key), data.as_ptr() as u32, data.len() as u32)
-                != 0
+            sys::graphics_image_draw_nine_slice(hash_key(key), x, y, w, h, left, top, right, bottom)
         }
     }
 
-    /// Register the built-in Spleen font under a string key.
+    /// Draw many copies of a registered PNG or JPEG in one host call, e.g. particles or tiles.
     ///
-    /// Spleen is a bitmap font family bundled with the host (wasm96-core).
-    /// This function associates a chosen Spleen size with your `key`, so you can refer to it
-    /// via `text_key`/`text_measure_key`.
+    /// Each [`DrawInstance`] picks a source region, position, rotation and tint. Instance tints
+    /// are multiplied with the current [`set_tint`]. Prefer this over per-sprite calls once
+    /// there are hundreds of them, since each call crosses into the host.
+    pub fn image_draw_batch(key: &str, instances: &[DrawInstance]) {
+        unsafe {
+            sys::graphics_image_draw_batch(
+                hash_key(key),
+                instances.as_ptr() as *const u8,
+                instances.len() as u32,
+            )
+        }
+    }
+
+    /// Create (or replace) a host-simulated particle system under `key`. Returns `false` if the
+    /// host rejected the config.
+    ///
+    /// ```ignore
+    /// graphics::particles_create("sparks", &ParticleConfig { gravity_y: 200.0, ..Default::default() });
+    /// // on hit:
+    /// graphics::particles_emit("sparks", x, y, 40);
+    /// // every frame, after drawing the scene:
+    /// graphics::particles_update_and_draw("sparks");
+    /// ```
+    pub fn particles_create(key: &str, config: &ParticleConfig) -> bool {
+        unsafe {
+            sys::graphics_particles_create(
+                hash_key(key),
+                config as *const ParticleConfig as *const u8,
+                core::mem::size_of::<ParticleConfig>() as u32,
+            ) != 0
+        }
+    }
+
+    /// Spawn `count` particles at (x, y).
+    pub fn particles_emit(key: &str, x: i32, y: i32, count: u32) {
+        unsafe { sys::graphics_particles_emit(hash_key(key), x, y, count) }
+    }
+
+    /// Step the system by this tick's delta time and draw its particles. Call once per frame.
+    pub fn particles_update_and_draw(key: &str) {
+        unsafe { sys::graphics_particles_update_and_draw(hash_key(key)) }
+    }
+
+    /// Number of live particles (0 for an unknown key).
+    pub fn particles_count(key: &str) -> u32 {
+        unsafe { sys::graphics_particles_count(hash_key(key)) }
+    }
+
+    /// Remove all live particles, keeping the system.
+    pub fn particles_clear(key: &str) {
+        unsafe { sys::graphics_particles_clear(hash_key(key)) }
+    }
+
+    /// Destroy the system.
+    pub fn particles_destroy(key: &str) {
+        unsafe { sys::graphics_particles_destroy(hash_key(key)) }
+    }
+
+    /// Draw the world through a camera: until [`camera_reset`], every 2D draw takes world
+    /// coordinates, and world point (`x`, `y`) lands at the screen center, scaled by `zoom`
+    /// (0.25..=64) and rotated by `rotation` radians clockwise. The camera stays on across frames.
+    ///
+    /// For a smooth follow, ease the position toward the target each frame before calling this.
+    pub fn camera_set(x: f32, y: f32, zoom: f32, rotation: f32) {
+        unsafe { sys::graphics_camera_set(x, y, zoom, rotation) }
+    }
+
+    /// Keep the camera's view inside the world rectangle (`x`, `y`, `w`, `h`); a zero size removes
+    /// the bounds.
+    pub fn camera_set_bounds(x: i32, y: i32, w: u32, h: u32) {
+        unsafe { sys::graphics_camera_set_bounds(x, y, w, h) }
+    }
+
+    /// Shake the view by up to `magnitude` screen pixels, fading out over `duration_ms`.
+    pub fn camera_shake(magnitude: f32, duration_ms: u32) {
+        unsafe { sys::graphics_camera_shake(magnitude, duration_ms) }
+    }
+
+    /// Go back to screen coordinates (e.g. to draw the HUD over the world).
+    pub fn camera_reset() {
+        unsafe { sys::graphics_camera_reset() }
+    }
+
+    fn unpack_point(packed: u64) -> crate::math::Vec2 {
+        crate::math::Vec2::new(
+            f32::from_bits((packed >> 32) as u32),
+            f32::from_bits(packed as u32),
+        )
+    }
+
+    /// The world point under a screen position (e.g. the mouse), through the current camera's
+    /// zoom, rotation and shake. Unchanged while no camera is set.
+    pub fn screen_to_world(x: f32, y: f32) -> crate::math::Vec2 {
+        unpack_point(unsafe { sys::graphics_screen_to_world(x, y) })
+    }
+
+    /// Where a world point lands on screen through the current camera.
+    pub fn world_to_screen(x: f32, y: f32) -> crate::math::Vec2 {
+        unpack_point(unsafe { sys::graphics_world_to_screen(x, y) })
+    }
+
+    /// Send the following 2D draws to layer `index` (0..16) until [`layer_end`]. Layers start
+    /// each frame empty and are composited over the screen by [`layer_set_order`] once `draw`
+    /// returns, so the background, the world and the HUD can be drawn in any order.
+    pub fn layer_begin(index: u32) {
+        unsafe { sys::graphics_layer_begin(index) }
+    }
+
+    /// Go back to drawing on the screen, which sits under every layer.
+    pub fn layer_end() {
+        unsafe { sys::graphics_layer_end() }
+    }
+
+    /// Show or hide a layer. Hidden layers are still drawn to, just not composited.
+    pub fn layer_set_visible(index: u32, visible: bool) {
+        unsafe { sys::graphics_layer_set_visible(index, visible as u32) }
+    }
+
+    /// How much of the camera position a layer follows: 0 pins it to the screen, 1 (the default)
+    /// moves it with the world, 0.5 makes a distant background. Applies from the next
+    /// [`layer_begin`].
+    pub fn layer_set_parallax(index: u32, factor: f32) {
+        unsafe { sys::graphics_layer_set_parallax(index, factor) }
+    }
+
+    /// Composite order of a layer; lower is further back. Defaults to the index.
+    pub fn layer_set_order(index: u32, order: i32) {
+        unsafe { sys::graphics_layer_set_order(index, order) }
+    }
+
+    /// Draw a clip mask: until [`mask_end`], 2D draws mark the pixels they touch instead of
+    /// drawing. Replaces the previous mask.
+    pub fn mask_begin() {
+        unsafe { sys::graphics_mask_begin() }
+    }
+
+    /// Finish the mask and go back to drawing.
+    pub fn mask_end() {
+        unsafe { sys::graphics_mask_end() }
+    }
+
+    /// Clip the following 2D draws to the mask, or to everything outside it when `invert` is
+    /// true, until [`mask_off`]. Good for spotlights, windows and wipes in any shape.
+    pub fn mask_use(invert: bool) {
+        unsafe { sys::graphics_mask_use(invert as u32) }
+    }
+
+    /// Stop clipping. The mask is kept for a later [`mask_use`].
+    pub fn mask_off() {
+        unsafe { sys::graphics_mask_off() }
+    }
+
+    /// Start a new vector path, forgetting the previous one.
+    ///
+    /// Build the shape with [`path_move_to`], [`path_line_to`], [`path_curve_to`] and
+    /// [`path_close`], then draw it with [`path_fill`] and/or [`path_stroke`]. The host flattens
+    /// the curves and fills the whole shape in one pass, so outlines with holes (letters,
+    /// rings, map regions) need no triangulation in the cart. Coordinates are in world space like
+    /// other 2D draws.
+    pub fn path_begin() {
+        unsafe { sys::graphics_path_begin() }
+    }
+
+    /// Start a subpath at (x, y).
+    pub fn path_move_to(x: f32, y: f32) {
+        unsafe { sys::graphics_path_move_to(x, y) }
+    }
+
+    /// Add a straight segment to (x, y).
+    pub fn path_line_to(x: f32, y: f32) {
+        unsafe { sys::graphics_path_line_to(x, y) }
+    }
+
+    /// Add a cubic Bézier segment bending towards (cx1, cy1) and (cx2, cy2) and ending at
+    /// (x, y).
+    pub fn path_curve_to(cx1: f32, cy1: f32, cx2: f32, cy2: f32, x: f32, y: f32) {
+        unsafe { sys::graphics_path_curve_to(cx1, cy1, cx2, cy2, x, y) }
+    }
+
+    /// Join the current subpath back to its start. Fills close every subpath anyway; this
+    /// matters for [`path_stroke`].
+    pub fn path_close() {
+        unsafe { sys::graphics_path_close() }
+    }
+
+    /// Fill the path with the current color. The path is kept, so it can be stroked next.
+    pub fn path_fill(rule: FillRule) {
+        unsafe { sys::graphics_path_fill(rule as u32) }
+    }
+
+    /// Outline the path with the current line width and style.
+    pub fn path_stroke() {
+        unsafe { sys::graphics_path_stroke() }
+    }
+
+    /// Cover the screen with the current draw color over the first half of `duration_ms`, then
+    /// reveal it over the second. Swap scenes when [`transition_midpoint`] is true and the cut is
+    /// never seen. Replaces a transition already running.
+    pub fn transition_start(kind: ScreenTransition, duration_ms: u32) {
+        unsafe { sys::graphics_transition_start(kind as u32, duration_ms) }
+    }
+
+    /// Whether a transition is running.
+    pub fn transition_active() -> bool {
+        unsafe { sys::graphics_transition_active() != 0 }
+    }
+
+    /// True for the one tick the running transition fully covers the screen.
+    pub fn transition_midpoint() -> bool {
+        unsafe { sys::graphics_transition_midpoint() != 0 }
+    }
+
+    /// Set palette entry `index` to an RGB color. Indices 0..16 start as the PICO-8 palette and
+    /// the rest as black.
+    pub fn palette_set(index: u8, r: u8, g: u8, b: u8) {
+        unsafe { sys::graphics_palette_set(index as u32, r as u32, g as u32, b as u32) }
+    }
+
+    /// Draw index `from` with the color of index `to` (in indexed images and
+    /// [`set_color_index`]) until swapped back or [`palette_reset`]. Use it for hit flashes,
+    /// recolored enemies and fades.
+    pub fn palette_swap(from: u8, to: u8) {
+        unsafe { sys::graphics_palette_swap(from as u32, to as u32) }
+    }
+
+    /// Choose whether pixels with `index` are left out of indexed image draws. Only index 0 is
+    /// transparent by default.
+    pub fn palette_set_transparent(index: u8, transparent: bool) {
+        unsafe { sys::graphics_palette_set_transparent(index as u32, transparent as u32) }
+    }
+
+    /// Undo all swaps and restore the default transparency. Palette colors are kept.
+    pub fn palette_reset() {
+        unsafe { sys::graphics_palette_reset() }
+    }
+
+    /// Set the drawing color to palette entry `index` (after swaps), fully opaque.
+    pub fn set_color_index(index: u8) {
+        unsafe { sys::graphics_set_color_index(index as u32) }
+    }
+
+    /// Register a `width`x`height` image of palette indices (one byte per pixel, row-major). It
+    /// is colored through the palette each time it is drawn, so palette changes apply without
+    /// re-uploading. Returns `false` if `indices` is shorter than `width * height`.
+    pub fn indexed_register(key: &str, width: u32, height: u32, indices: &[u8]) -> bool {
+        unsafe {
+            sys::graphics_indexed_register(
+                hash_key(key),
+                width,
+                height,
+                indices.as_ptr(),
+                indices.len() as u32,
+            ) != 0
+        }
+    }
+
+    /// Draw a registered indexed image at natural size through the current palette.
+    pub fn indexed_draw(key: &str, x: i32, y: i32) {
+        unsafe { sys::graphics_indexed_draw(hash_key(key), x, y) }
+    }
+
+    /// Unregister an indexed image by key.
+    pub fn indexed_unregister(key: &str) {
+        unsafe { sys::graphics_indexed_unregister(hash_key(key)) }
+    }
+
+    /// [`image_draw_ex`] for a registered GIF, showing its current frame by the host clock.
+    #[allow(clippy::too_many_arguments)]
+    pub fn gif_draw_ex(
+        key: &str,
+        x: i32,
+        y: i32,
+        w: u32,
+        h: u32,
+        angle: f32,
+        flip_x: bool,
+        flip_y: bool,
+        pivot_x: i32,
+        pivot_y: i32,
+    ) {
+        let flags = flip_flags(flip_x, flip_y);
+        unsafe {
+            sys::graphics_gif_draw_ex(hash_key(key), x, y, w, h, angle, flags, pivot_x, pivot_y)
+        }
+    }
+
+    /// Unregister a JPEG by key.
+    pub fn jpeg_unregister(key: &str) {
+        unsafe { sys::graphics_jpeg_unregister(hash_key(key)) }
+    }
+
+    /// Register a TTF/OTF font under a string key.
+    ///
+    /// ## What the host does
+    /// - The host reads the encoded font bytes immediately during this call.
+    /// - It attempts to parse them as a TTF/OTF via its font rasterizer.
+    /// - On success it stores the font in a host-side table and associates it with `hash_key(key)`.
+    ///
+    /// ## When to call this
+    /// Prefer calling during `setup()` (once), *not per-frame*.
+    ///
+    /// ## Return value
+    /// Returns `true` if the host successfully parsed and registered the font.
+    ///
+    /// ## Notes
+    /// - If you never register a font for a key, `text_key`/`text_measure_key` will still work due
+    ///   to host fallback (Spleen size 16), but metrics/appearance may differ from what you expect.
+    pub fn font_register_ttf(key: &str, data: &[u8]) -> bool {
+        unsafe {
+            sys::graphics_font_register_ttf(hash_key(key), data.as_ptr(), data.len() as u32) != 0
+        }
+    }
+
+    /// Register a BDF bitmap font under a string key.
+    ///
+    /// ## What the host does
+    /// - The host reads `data` immediately and parses the BDF text.
+    /// - It extracts the font bounding box (pixel width/height) and glyph bitmaps.
+    /// - On success, the parsed font is stored and associated with `hash_key(key)`.
+    ///
+    /// ## When to use BDF
+    /// Use BDF for crisp pixel fonts, debug overlays, and UIs where you want deterministic
+    /// bitmap metrics and a retro look.
+    ///
+    /// ## Return value
+    /// Returns `true` if parsing succeeded and the font was registered.
+    pub fn font_register_bdf(key: &str, data: &[u8]) -> bool {
+        unsafe {
+            sys::graphics_font_register_bdf(hash_key(key), data.as_ptr(), data.len() as u32) != 0
+        }
+    }
+
+    /// Register an AngelCode BMFont (as exported by BMFont, Hiero, etc.) under a string key.
+    ///
+    /// `fnt` is the text-format `.fnt` descriptor; `atlas_key` names its page image, registered
+    /// first with [`png_register`]. Glyph pixels are multiplied by the draw color, so export
+    /// white glyphs to color text with [`set_color`].
+    ///
+    /// Only the first page is used and kerning is ignored. Returns `true` if the descriptor
+    /// parsed and the atlas was found.
+    pub fn font_register_fnt(key: &str, fnt: &[u8], atlas_key: &str) -> bool {
+        unsafe {
+            sys::graphics_font_register_fnt(
+                hash_key(key),
+                fnt.as_ptr(),
+                fnt.len() as u32,
+                hash_key(atlas_key),
+            ) != 0
+        }
+    }
+
+    /// Register the built-in Spleen font under a string key.
+    ///
+    /// Spleen is a bitmap font family bundled with the host (wasm96-core).
+    /// This function associates a chosen Spleen size with your `key`, so you can refer to it
+    /// via `text_key`/`text_measure_key`.
     ///
     /// ## Supported sizes
     /// The host currently supports: **8, 16, 24, 32, 64**.
@@ -766,6 +2784,15 @@ pub mod graphics {
         unsafe { sys::graphics_font_unregister(hash_key(key)) }
     }
 
+    /// Draw characters the font under `primary` has no glyph for (accents, CJK, emoji) with the
+    /// font under `fallback`. A font can have up to 8 fallbacks, tried in the order added; the
+    /// fallback is drawn at the primary's size with the baselines lined up.
+    ///
+    /// Returns `false` if either key isn't a registered font or `primary` has no room left.
+    pub fn font_add_fallback(primary: &str, fallback: &str) -> bool {
+        unsafe { sys::graphics_font_add_fallback(hash_key(primary), hash_key(fallback)) != 0 }
+    }
+
     /// Draw text using a keyed font.
     ///
     /// ## Parameters
@@ -782,13 +2809,7 @@ pub mod graphics {
     /// - Register fonts once in `setup()`; do not register fonts in `draw()`.
     pub fn text_key(x: i32, y: i32, font_key: &str, text: &str) {
         unsafe {
-            sys::graphics_text_key(
-                x,
-                y,
-                hash_key(font_key),
-                text.as_ptr() as u32,
-                text.len() as u32,
-            )
+            sys::graphics_text_key(x, y, hash_key(font_key), text.as_ptr(), text.len() as u32)
         }
     }
 
@@ -814,16 +2835,124 @@ pub mod graphics {
     ///   your layout can change accordingly.
     pub fn text_measure_key(font_key: &str, text: &str) -> TextSize {
         let packed = unsafe {
-            sys::graphics_text_measure_key(
+            sys::graphics_text_measure_key(hash_key(font_key), text.as_ptr(), text.len() as u32)
+        };
+
+        TextSize {
+            width: (packed >> 32) as u32,
+            height: (packed & 0xFFFF_FFFF) as u32,
+        }
+    }
+
+    /// Draw text with a keyed font at `size_px` pixels, so one registered TTF serves every size.
+    ///
+    /// TTF/OTF fonts are rasterized at that size; bitmap fonts (BDF, BMFont, Spleen) are scaled
+    /// from their line height, so integer multiples stay crisp. `0` uses the font's native size,
+    /// like [`text_key`].
+    pub fn text_sized(x: i32, y: i32, font_key: &str, size_px: u32, text: &str) {
+        unsafe {
+            sys::graphics_text_sized_key(
+                x,
+                y,
                 hash_key(font_key),
-                text.as_ptr() as u32,
+                size_px,
+                text.as_ptr(),
                 text.len() as u32,
             )
-        };
+        }
+    }
 
+    /// Measure text as [`text_sized`] draws it.
+    pub fn text_measure_sized(font_key: &str, size_px: u32, text: &str) -> TextSize {
+        let packed = unsafe {
+            sys::graphics_text_measure_sized_key(
+                hash_key(font_key),
+                size_px,
+                text.as_ptr(),
+                text.len() as u32,
+            )
+        };
         TextSize {
             width: (packed >> 32) as u32,
-            height: (packed & 0xFFFF_FFFF) as u32,
+            height: packed as u32,
+        }
+    }
+
+    /// Width in pixels of `text[..byte_offset]`: the x of a caret placed before that byte.
+    ///
+    /// Offsets inside a multi-byte character round down to its start; offsets past the end
+    /// measure the whole string. Uses the same fallback as [`text_measure_key`].
+    pub fn text_measure_up_to(font_key: &str, text: &str, byte_offset: usize) -> u32 {
+        unsafe {
+            sys::graphics_text_measure_up_to_key(
+                hash_key(font_key),
+                text.as_ptr(),
+                text.len() as u32,
+                byte_offset.min(u32::MAX as usize) as u32,
+            )
+        }
+    }
+
+    /// Multiply the size of all text drawn and measured from now on, and of
+    /// [`font_metrics`]. Clamped to 0.25..=8; `1.0` restores normal sizes.
+    ///
+    /// Pass [`system::accessibility_settings`](crate::system::accessibility_settings)'s
+    /// `text_scale` to honor the player's preference.
+    pub fn set_text_scale(multiplier: f32) {
+        unsafe { sys::graphics_set_text_scale(multiplier) }
+    }
+
+    /// Register a TTF/OTF font under a string key to be drawn through signed distance fields.
+    ///
+    /// Each glyph is rasterized once and stored as the distance to its edge, so the font stays
+    /// sharp at any size and angle without keeping a bitmap per size. Good for titles and big
+    /// animated text; small body text looks better as a plain [`font_register_ttf`]. The key
+    /// works with every keyed text function, and [`text_sdf`] adds rotation, outlines and
+    /// shadows.
+    pub fn font_register_ttf_sdf(key: &str, data: &[u8]) -> bool {
+        unsafe {
+            sys::graphics_font_register_ttf_sdf(hash_key(key), data.as_ptr(), data.len() as u32)
+                != 0
+        }
+    }
+
+    /// Draw text with an SDF font (see [`font_register_ttf_sdf`]) at any size, rotated `angle`
+    /// radians clockwise around its top-left corner, with the outline and shadow in `style`.
+    ///
+    /// The fill uses the current color. `size_px` may be fractional, so text can grow smoothly;
+    /// `0` means 16. Keys that aren't SDF fonts draw nothing.
+    pub fn text_sdf(
+        x: f32,
+        y: f32,
+        font_key: &str,
+        size_px: f32,
+        angle: f32,
+        text: &str,
+        style: &TextStyle,
+    ) {
+        unsafe {
+            sys::graphics_text_sdf_key(
+                x,
+                y,
+                hash_key(font_key),
+                size_px,
+                angle,
+                text.as_ptr(),
+                text.len() as u32,
+                style as *const TextStyle as *const u8,
+            )
+        }
+    }
+
+    /// Vertical metrics of a keyed font (see [`FontMetrics`]).
+    ///
+    /// Uses the same Spleen fallback as [`text_key`] for unregistered keys.
+    pub fn font_metrics(font_key: &str) -> FontMetrics {
+        let packed = unsafe { sys::graphics_font_metrics_key(hash_key(font_key)) };
+        FontMetrics {
+            ascent: ((packed >> 32) & 0xFFFF) as u32,
+            descent: ((packed >> 16) & 0xFFFF) as u32,
+            line_gap: (packed & 0xFFFF) as u32,
         }
     }
 }
@@ -831,6 +2960,8 @@ pub mod graphics {
 /// Input API.
 pub mod input {
     use super::{Button, sys};
+    use alloc::string::String;
+    use alloc::vec::Vec;
 
     /// Returns true if the specified button is currently held down.
     pub fn is_button_down(port: u32, btn: Button) -> bool {
@@ -857,107 +2988,2092 @@ pub mod input {
     pub fn is_mouse_down(btn: u32) -> bool {
         unsafe { sys::input_is_mouse_down(btn) != 0 }
     }
-}
 
-/// Audio API.
-pub mod audio {
-    use super::sys;
+    /// Bitmask of ports with a controller connected (bit N = port N).
+    pub fn get_connected_ports() -> u32 {
+        unsafe { sys::input_get_connected_ports() }
+    }
 
-    /// Initialize audio system.
-    pub fn init(sample_rate: u32) -> u32 {
-        unsafe { sys::audio_init(sample_rate) }
+    /// Returns true if a controller is connected to `port`.
+    pub fn is_connected(port: u32) -> bool {
+        port < 32 && get_connected_ports() & (1 << port) != 0
     }
 
-    /// Push a chunk of audio samples.
-    /// Samples are interleaved stereo (L, R, L, R...) signed 16-bit integers.
-    pub fn push_samples(samples: &[i16]) {
-        unsafe { sys::audio_push_samples(samples.as_ptr() as u32, samples.len() as u32) }
+    /// Name of the controller in `port` (e.g. `"RetroPad"`), or `None` if nothing is connected.
+    pub fn get_controller_name(port: u32) -> Option<String> {
+        let bytes = super::system::take_blob(unsafe { sys::input_get_controller_name(port) })?;
+        String::from_utf8(bytes).ok()
     }
 
-    /// Play a WAV file.
-    /// The WAV data is decoded and played as a one-shot audio channel.
-    pub fn play_wav(data: &[u8]) {
-        unsafe { sys::audio_play_wav(data.as_ptr() as u32, data.len() as u32) }
+    /// Returns true for the one frame after a controller was connected, removed, or swapped.
+    pub fn ports_changed() -> bool {
+        unsafe { sys::input_ports_changed() != 0 }
     }
 
-    /// Play a QOA file.
-    /// The QOA data is decoded and played as a looping audio channel.
-    pub fn play_qoa(data: &[u8]) {
-        unsafe { sys::audio_play_qoa(data.as_ptr() as u32, data.len() as u32) }
+    /// Milliseconds `btn` on `port` has been held, for charge attacks and hold-to-confirm.
+    /// 0 on the tick it went down and while it's released.
+    pub fn button_held_millis(port: u32, btn: Button) -> u32 {
+        unsafe { sys::input_button_held_millis(port, btn as u32) }
     }
 
-    /// Play an XM file.
-    /// Play an XM file.
-    /// The XM data is decoded using xmrsplayer and played as a looping audio channel.
-    pub fn play_xm(data: &[u8]) {
-        unsafe { sys::audio_play_xm(data.as_ptr() as u32, data.len() as u32) }
+    /// Milliseconds `key` has been held. 0 on the tick it went down and while it's released.
+    pub fn key_held_millis(key: u32) -> u32 {
+        unsafe { sys::input_key_held_millis(key) }
     }
-}
 
-/// Storage API.
-pub mod storage {
-    use super::sys;
+    /// True on the tick `btn` goes down, then again after `initial_delay_ms` and every
+    /// `interval_ms` while it stays held, like a keyboard's auto-repeat. For menu navigation.
+    pub fn button_repeat(port: u32, btn: Button, initial_delay_ms: u32, interval_ms: u32) -> bool {
+        repeat_fires(
+            is_button_down(port, btn),
+            button_held_millis(port, btn),
+            initial_delay_ms,
+            interval_ms,
+        )
+    }
 
-    /// Save data to persistent storage.
-    pub fn save(key: &str, data: &[u8]) {
-        unsafe {
-            sys::storage_save(
-                super::graphics::hash_key(key),
-                data.as_ptr() as u32,
-                data.len() as u32,
-            )
-        }
+    /// [`button_repeat`] for a keyboard key.
+    pub fn key_repeat(key: u32, initial_delay_ms: u32, interval_ms: u32) -> bool {
+        repeat_fires(
+            is_key_down(key),
+            key_held_millis(key),
+            initial_delay_ms,
+            interval_ms,
+        )
     }
 
-    /// Load data from persistent storage.
-    /// Returns `Some(data)` if found, `None` otherwise.
-    pub fn load(key: &str) -> Option<Vec<u8>> {
-        let packed = unsafe { sys::storage_load(super::graphics::hash_key(key)) };
-        if packed == 0 {
-            return None;
-        }
+    /// Bytes in a snapshot; see [`snapshot`].
+    const SNAPSHOT_SIZE: usize = 144;
+
+    /// The whole input state for one tick, read with a single import call by [`snapshot`].
+    ///
+    /// Cheaper than polling each button and key separately when a game reads a lot of input
+    /// every tick, and consistent: everything in it is from the same tick.
+    #[derive(Clone, Copy, Debug, PartialEq, Eq)]
+    pub struct InputSnapshot {
+        bytes: [u8; SNAPSHOT_SIZE],
+    }
+
+    impl Default for InputSnapshot {
+        fn default() -> Self {
+            Self {
+                bytes: [0; SNAPSHOT_SIZE],
+            }
+        }
+    }
+
+    impl InputSnapshot {
+        fn word(&self, offset: usize) -> u32 {
+            let b = &self.bytes[offset..offset + 4];
+            u32::from_le_bytes([b[0], b[1], b[2], b[3]])
+        }
+
+        fn port_mask(&self, offset: usize, port: u32) -> u16 {
+            if port >= 8 {
+                return 0;
+            }
+            let i = offset + port as usize * 2;
+            u16::from_le_bytes([self.bytes[i], self.bytes[i + 1]])
+        }
+
+        fn key_bit(&self, offset: usize, key: u32) -> bool {
+            let key = key as usize;
+            key < 48 * 8 && self.bytes[offset + key / 8] & (1 << (key % 8)) != 0
+        }
+
+        /// Buttons held on `port`, bit N = [`Button`] N.
+        pub fn buttons(&self, port: u32) -> u16 {
+            self.port_mask(0, port)
+        }
+
+        /// Returns true if `btn` is held on `port`.
+        pub fn is_button_down(&self, port: u32, btn: Button) -> bool {
+            self.buttons(port) & (1 << btn as u32) != 0
+        }
+
+        /// Returns true if `btn` on `port` went down this tick.
+        pub fn is_button_pressed(&self, port: u32, btn: Button) -> bool {
+            self.port_mask(16, port) & (1 << btn as u32) != 0
+        }
+
+        /// Bitmask of ports with a controller connected (bit N = port N).
+        pub fn connected_ports(&self) -> u32 {
+            self.word(32)
+        }
+
+        /// Returns true if a controller is connected to `port`.
+        pub fn is_connected(&self, port: u32) -> bool {
+            port < 32 && self.connected_ports() & (1 << port) != 0
+        }
+
+        /// Mouse X position.
+        pub fn mouse_x(&self) -> i32 {
+            self.word(36) as i32
+        }
+
+        /// Mouse Y position.
+        pub fn mouse_y(&self) -> i32 {
+            self.word(40) as i32
+        }
+
+        /// Returns true if the mouse button is held. 0 = Left, 1 = Right, 2 = Middle.
+        pub fn is_mouse_down(&self, btn: u32) -> bool {
+            btn < 32 && self.word(44) & (1 << btn) != 0
+        }
+
+        /// Returns true if `key` is held.
+        pub fn is_key_down(&self, key: u32) -> bool {
+            self.key_bit(48, key)
+        }
+
+        /// Returns true if `key` went down this tick.
+        pub fn is_key_pressed(&self, key: u32) -> bool {
+            self.key_bit(96, key)
+        }
+    }
+
+    /// Read every button, key and the mouse for this tick in one call.
+    pub fn snapshot() -> InputSnapshot {
+        let mut snapshot = InputSnapshot::default();
+        let buf = &mut snapshot.bytes;
+        if unsafe { sys::input_snapshot(buf.as_mut_ptr(), buf.len() as u32) } == 0 {
+            return InputSnapshot::default();
+        }
+        snapshot
+    }
+
+    /// Whether a repeat is due this tick for an input held `held` ms.
+    fn repeat_fires(down: bool, held: u32, delay: u32, interval: u32) -> bool {
+        if !down {
+            return false;
+        }
+        if held == 0 {
+            return true;
+        }
+        // Repeats due by a given hold time; one fired this tick if the count went up.
+        let due = |t: u32| match (t < delay, interval) {
+            (true, _) => 0,
+            (false, 0) => 1,
+            (false, i) => 1 + (t - delay) / i,
+        };
+        let dt = super::system::delta_millis().min(u32::MAX as u64) as u32;
+        due(held) > due(held.saturating_sub(dt))
+    }
+
+    /// Where a touch is in its lifecycle.
+    #[derive(Clone, Copy, Debug, PartialEq, Eq)]
+    pub enum TouchPhase {
+        Began,
+        Moved,
+        Stationary,
+        /// The finger lifted since the last frame; reported once, at its last position.
+        Ended,
+    }
+
+    /// A touch point in screen pixels.
+    #[derive(Clone, Copy, Debug, PartialEq, Eq)]
+    pub struct Touch {
+        /// Stable while the finger stays down; never reused.
+        pub id: u32,
+        pub x: i32,
+        pub y: i32,
+        pub phase: TouchPhase,
+    }
+
+    /// Number of touches this frame (including ones that just ended).
+    pub fn get_touch_count() -> u32 {
+        unsafe { sys::input_get_touch_count() }
+    }
+
+    /// Touch `index` (`0..get_touch_count()`) this frame.
+    pub fn get_touch(index: u32) -> Option<Touch> {
+        let id = unsafe { sys::input_get_touch_id(index) };
+        if id == 0 {
+            return None;
+        }
+        let phase = match unsafe { sys::input_get_touch_phase(index) } {
+            0 => TouchPhase::Began,
+            1 => TouchPhase::Moved,
+            2 => TouchPhase::Stationary,
+            _ => TouchPhase::Ended,
+        };
+        Some(Touch {
+            id,
+            x: unsafe { sys::input_get_touch_x(index) },
+            y: unsafe { sys::input_get_touch_y(index) },
+            phase,
+        })
+    }
+
+    /// Iterate over this frame's touches.
+    pub fn touches() -> impl Iterator<Item = Touch> {
+        (0..get_touch_count()).filter_map(get_touch)
+    }
+
+    /// Mirror the first touch to the mouse position and left button (on by default).
+    pub fn set_touch_mouse(enabled: bool) {
+        unsafe { sys::input_set_touch_mouse(enabled as u32) }
+    }
+
+    /// Start collecting typed text (e.g. when a name-entry field gains focus).
+    pub fn text_input_start() {
+        unsafe { sys::input_text_input_start() }
+    }
+
+    /// Stop collecting typed text; anything not yet read is dropped.
+    pub fn text_input_stop() {
+        unsafe { sys::input_text_input_stop() }
+    }
+
+    /// Text typed since the last call (empty if none). Shift state and keyboard layout are
+    /// already applied. Backspace arrives as `'\u{8}'` and Enter as `'\n'`.
+    pub fn get_text_input() -> String {
+        super::system::take_blob(unsafe { sys::input_get_text_input() })
+            .and_then(|bytes| String::from_utf8(bytes).ok())
+            .unwrap_or_default()
+    }
+
+    /// Start recording the input seen on each tick (buttons, mouse, touches, delta time).
+    ///
+    /// Also reseeds the host RNG and stores the seed in the trace, so a cart that only depends on
+    /// input, `system::delta_millis` and `system::random` replays identically.
+    pub fn record_start() {
+        unsafe { sys::input_record_start() }
+    }
+
+    /// Stop recording and return the trace, or `None` if not recording.
+    pub fn record_stop() -> Option<Vec<u8>> {
+        super::system::take_blob(unsafe { sys::input_record_stop() })
+    }
+
+    /// Replay a trace from [`record_stop`] in place of live input, starting next tick.
+    /// Returns false if `trace` isn't a recording.
+    pub fn replay(trace: &[u8]) -> bool {
+        unsafe { sys::input_replay(trace.as_ptr(), trace.len() as u32) != 0 }
+    }
+
+    /// True while a replay is playing; live input resumes when it ends.
+    pub fn is_replaying() -> bool {
+        unsafe { sys::input_is_replaying() != 0 }
+    }
+}
+
+/// Audio API.
+pub mod audio {
+    use super::sys;
+
+    /// Initialize audio system.
+    pub fn init(sample_rate: u32) -> u32 {
+        unsafe { sys::audio_init(sample_rate) }
+    }
+
+    /// Push a chunk of audio samples.
+    /// Samples are interleaved stereo (L, R, L, R...) signed 16-bit integers.
+    pub fn push_samples(samples: &[i16]) {
+        unsafe { sys::audio_push_samples(samples.as_ptr(), samples.len() as u32) }
+    }
+
+    /// Number of pushed samples (i16 values, not frames) still waiting to be played.
+    pub fn get_queued_samples() -> u32 {
+        unsafe { sys::audio_get_queued_samples() }
+    }
+
+    /// Capacity of the push queue in i16 samples. Samples pushed beyond it are dropped, so
+    /// generate at most `get_buffer_capacity() - get_queued_samples()` per call.
+    pub fn get_buffer_capacity() -> u32 {
+        unsafe { sys::audio_get_buffer_capacity() }
+    }
+
+    /// Play a WAV file.
+    /// The WAV data is decoded and played as a one-shot audio channel.
+    pub fn play_wav(data: &[u8]) {
+        unsafe { sys::audio_play_wav(data.as_ptr(), data.len() as u32) }
+    }
+
+    /// Play a QOA file.
+    /// The QOA data is decoded and played as a looping audio channel.
+    pub fn play_qoa(data: &[u8]) {
+        unsafe { sys::audio_play_qoa(data.as_ptr(), data.len() as u32) }
+    }
+
+    /// Play an XM file.
+    /// Play an XM file.
+    /// The XM data is decoded using xmrsplayer and played as a looping audio channel.
+    pub fn play_xm(data: &[u8]) {
+        unsafe { sys::audio_play_xm(data.as_ptr(), data.len() as u32) }
+    }
+
+    /// A position in tracker music: index into the song's order table, and row within it.
+    #[derive(Clone, Copy, Debug, PartialEq, Eq, PartialOrd, Ord, Hash)]
+    pub struct XmPosition {
+        pub order: u16,
+        pub row: u16,
+    }
+
+    /// A playing XM song with playback control. Dropping it stops the song.
+    #[derive(Debug)]
+    pub struct XmSong {
+        handle: u32,
+    }
+
+    impl XmSong {
+        /// Start playing an XM module (looping). Returns `None` if it can't be decoded.
+        pub fn play(data: &[u8]) -> Option<Self> {
+            let handle = unsafe { sys::audio_xm_play(data.as_ptr(), data.len() as u32) };
+            if handle == 0 {
+                None
+            } else {
+                Some(Self { handle })
+            }
+        }
+
+        pub fn pause(&self) {
+            unsafe { sys::audio_xm_pause(self.handle, 1) }
+        }
+
+        pub fn resume(&self) {
+            unsafe { sys::audio_xm_pause(self.handle, 0) }
+        }
+
+        /// Jump to the start of a row. Returns false if the song never reaches it.
+        pub fn set_position(&self, pos: XmPosition) -> bool {
+            unsafe {
+                sys::audio_xm_set_position(self.handle, pos.order as u32, pos.row as u32) != 0
+            }
+        }
+
+        /// The row currently playing.
+        pub fn position(&self) -> XmPosition {
+            let packed = unsafe { sys::audio_xm_get_position(self.handle) };
+            XmPosition {
+                order: (packed >> 16) as u16,
+                row: packed as u16,
+            }
+        }
+
+        /// Loop from the start of `end` back to `start`. Pass `None` to loop at the song's end.
+        /// Returns false if the song never reaches `start`.
+        pub fn set_loop(&self, start: XmPosition, end: Option<XmPosition>) -> bool {
+            let (end_order, end_row) =
+                end.map_or((u32::MAX, u32::MAX), |e| (e.order as u32, e.row as u32));
+            unsafe {
+                sys::audio_xm_set_loop(
+                    self.handle,
+                    start.order as u32,
+                    start.row as u32,
+                    end_order,
+                    end_row,
+                ) != 0
+            }
+        }
+
+        /// Enable or disable looping. A non-looping song stops at its end (or loop end).
+        pub fn set_looping(&self, enabled: bool) {
+            unsafe { sys::audio_xm_set_looping(self.handle, enabled as u32) }
+        }
+
+        /// Move the song to another mixer group (songs start in [`Group::MUSIC`]).
+        pub fn set_group(&self, group: Group) {
+            unsafe { sys::audio_xm_set_group(self.handle, group.0) }
+        }
+
+        /// Set the stereo position (-1.0 = left, 0.0 = centre, 1.0 = right).
+        pub fn set_pan(&self, pan: f32) {
+            unsafe { sys::audio_set_pan(self.handle, pan) }
+        }
+
+        /// Set the playback speed ratio; tempo and key change together.
+        pub fn set_pitch(&self, ratio: f32) {
+            unsafe { sys::audio_set_pitch(self.handle, ratio) }
+        }
+
+        /// Send some of the song (0.0..=1.0) to a mixer effect.
+        pub fn set_send(&self, effect: Effect, level: f32) {
+            unsafe { sys::audio_set_send(self.handle, effect as u32, level) }
+        }
+    }
+
+    impl Drop for XmSong {
+        fn drop(&mut self) {
+            unsafe { sys::audio_xm_stop(self.handle) }
+        }
+    }
+
+    /// Compressed formats [`Music`] can stream.
+    #[repr(u32)]
+    #[derive(Clone, Copy, Debug, PartialEq, Eq, Hash)]
+    pub enum MusicFormat {
+        OggVorbis = 0,
+    }
+
+    /// A long music track decoded on the host while it plays, instead of all at once.
+    /// Dropping it frees the track.
+    #[derive(Debug)]
+    pub struct Music {
+        handle: u32,
+    }
+
+    impl Music {
+        /// Load a track (paused, looping, in [`Group::MUSIC`]). The host copies `data`. Returns
+        /// `None` if it can't be decoded.
+        pub fn new(data: &[u8], format: MusicFormat) -> Option<Self> {
+            let handle =
+                unsafe { sys::audio_music_create(data.as_ptr(), data.len() as u32, format as u32) };
+            (handle != 0).then_some(Self { handle })
+        }
+
+        /// Start a Standard MIDI File (`.mid`) played with `font` (playing, looping, in
+        /// [`Group::MUSIC`]). Returns `None` if the file can't be parsed.
+        pub fn play_midi(data: &[u8], font: &SoundFont) -> Option<Self> {
+            let handle = unsafe { sys::audio_midi_play(data.as_ptr(), data.len() as u32, font.id) };
+            (handle != 0).then_some(Self { handle })
+        }
+
+        /// Start, or resume after [`Music::pause`].
+        pub fn play(&self) {
+            unsafe { sys::audio_music_play(self.handle) }
+        }
+
+        pub fn pause(&self) {
+            unsafe { sys::audio_music_pause(self.handle) }
+        }
+
+        /// Stop and rewind to the start.
+        pub fn stop(&self) {
+            unsafe { sys::audio_music_stop(self.handle) }
+        }
+
+        /// Jump to `millis` from the start. Ogg Vorbis lands on the page containing it, a little
+        /// early.
+        pub fn seek(&self, millis: u32) -> bool {
+            unsafe { sys::audio_music_seek(self.handle, millis) != 0 }
+        }
+
+        /// Playback position in milliseconds.
+        pub fn position_millis(&self) -> u32 {
+            unsafe { sys::audio_music_position(self.handle) }
+        }
+
+        /// Track volume (0.0..=1.0), on top of its group and the master volume.
+        pub fn set_volume(&self, vol: f32) {
+            unsafe { sys::audio_music_set_volume(self.handle, vol) }
+        }
+
+        /// Enable or disable looping. A non-looping track stops and rewinds at its end.
+        pub fn set_looping(&self, enabled: bool) {
+            unsafe { sys::audio_music_set_looping(self.handle, enabled as u32) }
+        }
+
+        pub fn set_group(&self, group: Group) {
+            unsafe { sys::audio_music_set_group(self.handle, group.0) }
+        }
+
+        /// Fade this track out (stopping it) while `next` starts and fades in.
+        pub fn crossfade_to(&self, next: &Music, millis: u32) {
+            unsafe { sys::audio_music_crossfade(self.handle, next.handle, millis) }
+        }
+
+        /// Start playing from silence, fading in over `millis`.
+        pub fn fade_in(&self, millis: u32) {
+            unsafe { sys::audio_music_crossfade(0, self.handle, millis) }
+        }
+
+        /// Fade out over `millis`, then stop.
+        pub fn fade_out(&self, millis: u32) {
+            unsafe { sys::audio_music_crossfade(self.handle, 0, millis) }
+        }
+
+        /// Speed a MIDI track up or down (1.0 = as written, 0.1..=4.0) without changing its
+        /// pitch. Does nothing for other tracks.
+        pub fn set_tempo(&self, scale: f32) {
+            unsafe { sys::audio_midi_set_tempo(self.handle, scale) }
+        }
+
+        /// Volume (0.0..=1.0) of one channel of a MIDI track (0..16; 9 is drums), e.g. to bring
+        /// in a part as the action builds. Does nothing for other tracks.
+        pub fn set_channel_volume(&self, channel: u32, vol: f32) {
+            unsafe { sys::audio_midi_set_channel_volume(self.handle, channel, vol) }
+        }
+    }
+
+    impl Drop for Music {
+        fn drop(&mut self) {
+            unsafe { sys::audio_music_destroy(self.handle) }
+        }
+    }
+
+    /// A SoundFont 2 (`.sf2`) bank of instruments for [`Music::play_midi`]. Dropping it frees
+    /// the bank; tracks already using it keep playing.
+    #[derive(Debug)]
+    pub struct SoundFont {
+        id: u32,
+    }
+
+    impl SoundFont {
+        /// Load a bank; the host copies `data`. Returns `None` if it isn't a SoundFont 2 file.
+        pub fn new(data: &[u8]) -> Option<Self> {
+            let id = unsafe { sys::audio_soundfont_create(data.as_ptr(), data.len() as u32) };
+            (id != 0).then_some(Self { id })
+        }
+    }
+
+    impl Drop for SoundFont {
+        fn drop(&mut self) {
+            unsafe { sys::audio_soundfont_destroy(self.id) }
+        }
+    }
+
+    /// What a [`SoundPool`] does with a new play when every voice is busy.
+    #[repr(u32)]
+    #[derive(Clone, Copy, Debug, PartialEq, Eq, Hash)]
+    pub enum StealPolicy {
+        /// Restart the voice that has been playing longest.
+        Oldest = 0,
+        /// Restart the quietest voice.
+        Quietest = 1,
+        /// Drop the new play.
+        None = 2,
+    }
+
+    /// One sound effect (WAV or QOA) decoded once and played on a capped number of voices, for
+    /// rapid-fire effects like shots and coins. Dropping it frees the sound.
+    #[derive(Debug)]
+    pub struct SoundPool {
+        handle: u32,
+        /// Made with `new_async`, so `handle` is also a load handle.
+        loading: bool,
+    }
+
+    impl SoundPool {
+        /// Decode `data` (copied by the host) for up to `max_voices` (1..=32) overlapping plays,
+        /// in [`Group::SFX`]. Returns `None` if it can't be decoded.
+        pub fn new(data: &[u8], max_voices: u32, steal: StealPolicy) -> Option<Self> {
+            let handle = unsafe {
+                sys::audio_sound_pool_create(
+                    data.as_ptr(),
+                    data.len() as u32,
+                    max_voices,
+                    steal as u32,
+                )
+            };
+            (handle != 0).then_some(Self {
+                handle,
+                loading: false,
+            })
+        }
+
+        /// Like [`SoundPool::new`], but decodes in the background and returns at once. Plays
+        /// are dropped until [`SoundPool::is_ready`]; a sound that can't be decoded never
+        /// becomes ready (see [`system::load_status`](crate::system::load_status)).
+        pub fn new_async(data: &[u8], max_voices: u32, steal: StealPolicy) -> Option<Self> {
+            let handle = unsafe {
+                sys::audio_sound_pool_create_async(
+                    data.as_ptr(),
+                    data.len() as u32,
+                    max_voices,
+                    steal as u32,
+                )
+            };
+            (handle != 0).then_some(Self {
+                handle,
+                loading: true,
+            })
+        }
+
+        /// Whether the sound has finished loading (always true for [`SoundPool::new`]).
+        pub fn is_ready(&self) -> bool {
+            !self.loading || crate::system::is_ready(self.handle)
+        }
+
+        /// Load handle of a pool made with [`SoundPool::new_async`], for
+        /// [`system::load_status`](crate::system::load_status).
+        pub fn load_handle(&self) -> Option<u32> {
+            self.loading.then_some(self.handle)
+        }
+
+        /// Play at full volume, centred. Returns false if the play was dropped.
+        pub fn play(&self) -> bool {
+            self.play_with(1.0, 0.0)
+        }
+
+        /// Play at `vol` (0.0..=1.0) and `pan` (-1.0 = left, 1.0 = right).
+        pub fn play_with(&self, vol: f32, pan: f32) -> bool {
+            unsafe { sys::audio_sound_pool_play(self.handle, vol, pan) != 0 }
+        }
+
+        /// Vary each play's pitch randomly by up to `amount` either way (0.05 = ±5%, max 0.5).
+        /// The host RNG picks it, so replays sound the same.
+        pub fn set_pitch_variation(&self, amount: f32) {
+            unsafe { sys::audio_sound_pool_set_pitch_variation(self.handle, amount) }
+        }
+
+        pub fn set_group(&self, group: Group) {
+            unsafe { sys::audio_sound_pool_set_group(self.handle, group.0) }
+        }
+
+        /// Number of voices currently playing.
+        pub fn active_voices(&self) -> u32 {
+            unsafe { sys::audio_sound_pool_active(self.handle) }
+        }
+
+        /// Silence every voice.
+        pub fn stop(&self) {
+            unsafe { sys::audio_sound_pool_stop(self.handle) }
+        }
+    }
+
+    impl Drop for SoundPool {
+        fn drop(&mut self) {
+            unsafe { sys::audio_sound_pool_destroy(self.handle) }
+        }
+    }
+
+    /// A mixer group (0..8). Each group has its own volume on top of the master volume.
+    #[derive(Clone, Copy, Debug, PartialEq, Eq, Hash)]
+    pub struct Group(pub u32);
+
+    impl Group {
+        /// Default group for WAV/QOA playback and synth voices.
+        pub const SFX: Group = Group(0);
+        /// Default group for XM songs.
+        pub const MUSIC: Group = Group(1);
+    }
+
+    /// Set the volume of everything the core outputs (0.0..=1.0).
+    pub fn set_master_volume(vol: f32) {
+        unsafe { sys::audio_set_master_volume(vol) }
+    }
+
+    pub fn get_master_volume() -> f32 {
+        unsafe { sys::audio_get_master_volume() }
+    }
+
+    /// Set a mixer group's volume (0.0..=1.0), e.g. for music/SFX sliders.
+    pub fn set_group_volume(group: Group, vol: f32) {
+        unsafe { sys::audio_set_group_volume(group.0, vol) }
+    }
+
+    pub fn get_group_volume(group: Group) -> f32 {
+        unsafe { sys::audio_get_group_volume(group.0) }
+    }
+
+    /// A sound started with [`play_wav_at`] or [`play_wav_pitched`]. It plays once; the handle
+    /// only adjusts it.
+    #[derive(Clone, Copy, Debug, PartialEq, Eq)]
+    pub struct Sound {
+        handle: u32,
+    }
+
+    impl Sound {
+        /// Set the stereo position (-1.0 = left, 0.0 = centre, 1.0 = right).
+        pub fn set_pan(&self, pan: f32) {
+            unsafe { sys::audio_set_pan(self.handle, pan) }
+        }
+
+        /// Set the playback speed ratio (2.0 = an octave up and twice as fast; 0.125..=8.0).
+        pub fn set_pitch(&self, ratio: f32) {
+            unsafe { sys::audio_set_pitch(self.handle, ratio) }
+        }
+
+        /// Send some of the sound (0.0..=1.0) to a mixer effect.
+        pub fn set_send(&self, effect: Effect, level: f32) {
+            unsafe { sys::audio_set_send(self.handle, effect as u32, level) }
+        }
+    }
+
+    /// Play a WAV once at a playback speed ratio, e.g. 0.5 for slow motion or a random
+    /// 0.9..1.1 for footsteps. Returns `None` if the data can't be decoded.
+    pub fn play_wav_pitched(data: &[u8], ratio: f32) -> Option<Sound> {
+        let handle =
+            unsafe { sys::audio_play_wav_pitched(data.as_ptr(), data.len() as u32, ratio) };
+        (handle != 0).then_some(Sound { handle })
+    }
+
+    /// Set the listener position for positional playback, in screen coordinates.
+    /// Until this is called, the listener is at the centre of the screen.
+    pub fn set_listener(x: f32, y: f32) {
+        unsafe { sys::audio_set_listener(x, y) }
+    }
+
+    /// Play a WAV once at a screen position: panned by its horizontal offset from the listener
+    /// and quieter the further away it is. Returns `None` if the data can't be decoded.
+    pub fn play_wav_at(data: &[u8], x: f32, y: f32) -> Option<Sound> {
+        let handle = unsafe { sys::audio_play_wav_at(data.as_ptr(), data.len() as u32, x, y) };
+        if handle == 0 {
+            None
+        } else {
+            Some(Sound { handle })
+        }
+    }
+
+    /// Oscillator shape for a [`SynthVoice`].
+    #[repr(u32)]
+    #[derive(Clone, Copy, Debug, PartialEq, Eq)]
+    pub enum Waveform {
+        Square = 0,
+        Triangle = 1,
+        Saw = 2,
+        Noise = 3,
+    }
+
+    /// ADSR envelope for a [`SynthVoice`].
+    #[derive(Clone, Copy, Debug, PartialEq)]
+    pub struct Envelope {
+        pub attack_ms: u32,
+        pub decay_ms: u32,
+        /// Level held while the note is on, 0.0..=1.0.
+        pub sustain: f32,
+        pub release_ms: u32,
+    }
+
+    impl Default for Envelope {
+        fn default() -> Self {
+            Self {
+                attack_ms: 5,
+                decay_ms: 50,
+                sustain: 0.7,
+                release_ms: 100,
+            }
+        }
+    }
+
+    /// A host-rendered chiptune oscillator. Dropping it silences and frees the voice.
+    #[derive(Debug)]
+    pub struct SynthVoice {
+        id: u32,
+    }
+
+    impl SynthVoice {
+        pub fn new(waveform: Waveform) -> Self {
+            Self {
+                id: unsafe { sys::audio_synth_voice_create(waveform as u32) },
+            }
+        }
+
+        pub fn set_envelope(&self, env: Envelope) {
+            unsafe {
+                sys::audio_synth_set_envelope(
+                    self.id,
+                    env.attack_ms,
+                    env.decay_ms,
+                    env.sustain,
+                    env.release_ms,
+                )
+            }
+        }
+
+        /// Start (or retrigger) a note. `freq` is in Hz, `volume` in 0.0..=1.0.
+        pub fn note_on(&self, freq: f32, volume: f32) {
+            unsafe { sys::audio_synth_note_on(self.id, freq, volume) }
+        }
+
+        /// Release the note; it fades out over the envelope's release time.
+        pub fn note_off(&self) {
+            unsafe { sys::audio_synth_note_off(self.id) }
+        }
+
+        /// Move the voice to another mixer group (voices start in [`Group::SFX`]).
+        pub fn set_group(&self, group: Group) {
+            unsafe { sys::audio_synth_set_group(self.id, group.0) }
+        }
+
+        /// Set the stereo position (-1.0 = left, 0.0 = centre, 1.0 = right).
+        pub fn set_pan(&self, pan: f32) {
+            unsafe { sys::audio_synth_set_pan(self.id, pan) }
+        }
+
+        /// Send some of the voice (0.0..=1.0) to a mixer effect.
+        pub fn set_send(&self, effect: Effect, level: f32) {
+            unsafe { sys::audio_synth_set_send(self.id, effect as u32, level) }
+        }
+    }
+
+    /// A mixer effect that sources send to.
+    ///
+    /// A low-pass send crossfades the source to its filtered version (1.0 = fully filtered, e.g.
+    /// underwater). A reverb send adds reverb on top of the dry source (e.g. caves).
+    #[repr(u32)]
+    #[derive(Clone, Copy, Debug, PartialEq, Eq, Hash)]
+    pub enum Effect {
+        LowPass = 0,
+        Reverb = 1,
+    }
+
+    /// Enable the low-pass effect, or change its cutoff (20..=20000 Hz).
+    pub fn enable_low_pass(cutoff_hz: f32) {
+        unsafe {
+            sys::audio_effect_enable(Effect::LowPass as u32, cutoff_hz, 0.0);
+        }
+    }
+
+    /// Enable the reverb, or re-tune it. `room_size` lengthens the tail and `damping` dulls
+    /// it; both are 0.0..=1.0.
+    pub fn enable_reverb(room_size: f32, damping: f32) {
+        unsafe {
+            sys::audio_effect_enable(Effect::Reverb as u32, room_size, damping);
+        }
+    }
+
+    /// Turn an effect off, cutting any reverb tail.
+    pub fn disable_effect(effect: Effect) {
+        unsafe { sys::audio_effect_disable(effect as u32) }
+    }
+
+    /// Send some of everything in `group` (0.0..=1.0) to an effect, on top of each source's
+    /// own send.
+    pub fn set_group_send(group: Group, effect: Effect, level: f32) {
+        unsafe { sys::audio_group_set_send(group.0, effect as u32, level) }
+    }
+
+    /// Start capturing mono samples from the microphone at `sample_rate` Hz (0 = the
+    /// frontend's default). Returns the actual rate, or `None` if the player hasn't allowed it
+    /// (`WASM96_MICROPHONE=1`) or the frontend has no microphone support.
+    pub fn capture_start(sample_rate: u32) -> Option<u32> {
+        let rate = unsafe { sys::audio_capture_start(sample_rate) };
+        (rate != 0).then_some(rate)
+    }
+
+    /// Read captured samples into `buf`, returning how many were written. Call every tick so
+    /// the frontend's buffer doesn't overflow.
+    pub fn capture_read(buf: &mut [i16]) -> usize {
+        unsafe { sys::audio_capture_read(buf.as_mut_ptr(), buf.len() as u32) as usize }
+    }
+
+    /// Stop capturing and release the microphone.
+    pub fn capture_stop() {
+        unsafe { sys::audio_capture_stop() }
+    }
+
+    impl Drop for SynthVoice {
+        fn drop(&mut self) {
+            unsafe { sys::audio_synth_voice_destroy(self.id) }
+        }
+    }
+}
+
+/// Storage API.
+pub mod storage {
+    use super::sys;
+    use alloc::vec::Vec;
+
+    /// Save data to persistent storage.
+    pub fn save(key: &str, data: &[u8]) {
+        unsafe {
+            sys::storage_save(
+                super::graphics::hash_key(key),
+                data.as_ptr(),
+                data.len() as u32,
+            )
+        }
+    }
+
+    /// Load data from persistent storage.
+    /// Returns `Some(data)` if found, `None` otherwise.
+    pub fn load(key: &str) -> Option<Vec<u8>> {
+        load_hashed(super::graphics::hash_key(key))
+    }
+
+    // Native pointers don't fit the packed (ptr << 32 | len) result, so the mock is read
+    // directly.
+    #[cfg(all(feature = "mock", not(target_arch = "wasm32")))]
+    fn load_hashed(key: u64) -> Option<Vec<u8>> {
+        crate::mock::with(|host| host.storage.get(&key).cloned())
+    }
+
+    #[cfg(not(all(feature = "mock", not(target_arch = "wasm32"))))]
+    fn load_hashed(key: u64) -> Option<Vec<u8>> {
+        let packed = unsafe { sys::storage_load(key) };
+        if packed == 0 {
+            return None;
+        }
 
         let ptr = (packed >> 32) as u32;
         let len = packed as u32;
 
-        // Read data from guest memory
-        let mut data = Vec::with_capacity(len as usize);
-        unsafe {
-            core::ptr::copy_nonoverlapping(ptr as *const u8, data.as_mut_ptr(), len as usize);
-            data.set_len(len as usize);
+        // Read data from guest memory
+        let mut data = Vec::with_capacity(len as usize);
+        unsafe {
+            core::ptr::copy_nonoverlapping(ptr as *const u8, data.as_mut_ptr(), len as usize);
+            data.set_len(len as usize);
+        }
+
+        // Free the memory in guest space
+        unsafe { sys::storage_free(ptr, len) };
+
+        Some(data)
+    }
+}
+
+/// Networking API (outbound HTTP).
+///
+/// Requests only succeed for hosts the player has allowlisted on the host side
+/// (`WASM96_NET_ALLOW`); otherwise [`fetch`] returns `None`. Requests run in the background:
+/// keep the [`Request`] around and call [`Request::poll`] from `update`.
+pub mod net {
+    use super::sys;
+    use alloc::string::String;
+    use alloc::vec::Vec;
+
+    /// Options for [`fetch`].
+    #[derive(Clone, Copy, Debug)]
+    pub struct FetchOptions<'a> {
+        /// HTTP method; empty means `GET`.
+        pub method: &'a str,
+        pub headers: &'a [(&'a str, &'a str)],
+        pub body: &'a [u8],
+    }
+
+    impl Default for FetchOptions<'_> {
+        fn default() -> Self {
+            Self {
+                method: "GET",
+                headers: &[],
+                body: &[],
+            }
+        }
+    }
+
+    /// A completed HTTP response (any status code, including 4xx/5xx).
+    #[derive(Clone, Debug)]
+    pub struct Response {
+        pub status: u32,
+        pub body: Vec<u8>,
+    }
+
+    impl Response {
+        /// The entries of a [`fetch_scores`] response, best first.
+        pub fn scores(&self) -> Vec<ScoreEntry> {
+            fn take<'a>(rest: &mut &'a [u8], n: usize) -> Option<&'a [u8]> {
+                let (head, tail) = rest.split_at_checked(n)?;
+                *rest = tail;
+                Some(head)
+            }
+            fn entry(rest: &mut &[u8]) -> Option<ScoreEntry> {
+                let rank = u32::from_le_bytes(take(rest, 4)?.try_into().ok()?);
+                let score = i64::from_le_bytes(take(rest, 8)?.try_into().ok()?);
+                let len = u32::from_le_bytes(take(rest, 4)?.try_into().ok()?);
+                let name = String::from_utf8(take(rest, len as usize)?.to_vec()).ok()?;
+                let len = u32::from_le_bytes(take(rest, 4)?.try_into().ok()?);
+                let meta = take(rest, len as usize)?.to_vec();
+                Some(ScoreEntry {
+                    rank,
+                    score,
+                    name,
+                    meta,
+                })
+            }
+            let mut entries = Vec::new();
+            let mut rest = &self.body[..];
+            while let Some(e) = entry(&mut rest) {
+                entries.push(e);
+            }
+            entries
+        }
+    }
+
+    /// Result of polling a [`Request`].
+    #[derive(Clone, Debug)]
+    pub enum Poll {
+        Pending,
+        Ready(Response),
+        /// Transport error (DNS, TLS, timeout, ...), or the handle was already consumed.
+        Failed,
+    }
+
+    /// Handle to an in-flight request. Dropping it cancels the request.
+    #[derive(Debug)]
+    pub struct Request {
+        id: u32,
+    }
+
+    impl Request {
+        /// Check on the request. After `Ready` or `Failed` the handle is spent.
+        pub fn poll(&mut self) -> Poll {
+            if self.id == 0 {
+                return Poll::Failed;
+            }
+            match unsafe { sys::net_poll(self.id) } {
+                1 => Poll::Pending,
+                2 => {
+                    let status = unsafe { sys::net_status(self.id) };
+                    let body = super::system::take_blob(unsafe { sys::net_take_body(self.id) });
+                    self.id = 0;
+                    Poll::Ready(Response {
+                        status,
+                        body: body.unwrap_or_default(),
+                    })
+                }
+                _ => {
+                    unsafe { sys::net_cancel(self.id) };
+                    self.id = 0;
+                    Poll::Failed
+                }
+            }
+        }
+    }
+
+    impl Drop for Request {
+        fn drop(&mut self) {
+            if self.id != 0 {
+                unsafe { sys::net_cancel(self.id) };
+            }
+        }
+    }
+
+    /// Start an HTTP request. Returns `None` if the URL is invalid or its host isn't allowlisted.
+    pub fn fetch(url: &str, opts: &FetchOptions) -> Option<Request> {
+        let mut headers = String::new();
+        for (name, value) in opts.headers {
+            headers.push_str(name);
+            headers.push_str(": ");
+            headers.push_str(value);
+            headers.push('\n');
+        }
+        let id = unsafe {
+            sys::net_fetch(
+                opts.method.as_ptr(),
+                opts.method.len() as u32,
+                url.as_ptr(),
+                url.len() as u32,
+                headers.as_ptr(),
+                headers.len() as u32,
+                opts.body.as_ptr(),
+                opts.body.len() as u32,
+            )
+        };
+        if id == 0 { None } else { Some(Request { id }) }
+    }
+
+    /// Start a `GET` request.
+    pub fn get(url: &str) -> Option<Request> {
+        fetch(url, &FetchOptions::default())
+    }
+
+    /// One leaderboard row.
+    #[derive(Clone, Debug, PartialEq, Eq)]
+    pub struct ScoreEntry {
+        /// 1 for the best score.
+        pub rank: u32,
+        pub score: i64,
+        /// The player's name, as the host knows it.
+        pub name: String,
+        /// Bytes submitted with the score (replay id, character, ...).
+        pub meta: Vec<u8>,
+    }
+
+    /// Submit a score to `board`, with up to 1 KiB of `meta`. Higher scores rank first, so
+    /// submit times negated. The host owns the backend and the player's identity; poll the
+    /// request to see whether the score was accepted.
+    pub fn submit_score(board: &str, score: i64, meta: &[u8]) -> Option<Request> {
+        let id = unsafe {
+            sys::net_score_submit(
+                board.as_ptr(),
+                board.len() as u32,
+                score,
+                meta.as_ptr(),
+                meta.len() as u32,
+            )
+        };
+        if id == 0 { None } else { Some(Request { id }) }
+    }
+
+    /// Fetch the top `count` entries (at most 100) of `board`. Read them with
+    /// [`Response::scores`] once the request is ready.
+    pub fn fetch_scores(board: &str, count: u32) -> Option<Request> {
+        let id = unsafe { sys::net_score_fetch(board.as_ptr(), board.len() as u32, count) };
+        if id == 0 { None } else { Some(Request { id }) }
+    }
+
+    /// State of a [`WebSocket`] or [`LanConnection`].
+    #[derive(Clone, Copy, Debug, PartialEq, Eq)]
+    pub enum SocketState {
+        Connecting,
+        Open,
+        /// Closed by either side or failed to connect. Already-received messages can still be read.
+        Closed,
+    }
+
+    /// A WebSocket connection. The host buffers messages in both directions; call
+    /// [`WebSocket::receive`] from `update` to drain incoming ones. Dropping it closes the
+    /// connection.
+    #[derive(Debug)]
+    pub struct WebSocket {
+        id: u32,
+    }
+
+    impl WebSocket {
+        /// Connect to a `ws://` or `wss://` URL. Returns `None` if the URL is invalid or its host
+        /// isn't allowlisted. The connection opens in the background.
+        pub fn open(url: &str) -> Option<Self> {
+            let id = unsafe { sys::net_ws_open(url.as_ptr(), url.len() as u32) };
+            if id == 0 { None } else { Some(Self { id }) }
+        }
+
+        pub fn state(&self) -> SocketState {
+            match unsafe { sys::net_ws_state(self.id) } {
+                1 => SocketState::Connecting,
+                2 => SocketState::Open,
+                _ => SocketState::Closed,
+            }
+        }
+
+        /// Queue a binary message. Messages sent while connecting go out once the socket opens.
+        /// Returns false if the connection is closed.
+        pub fn send(&self, data: &[u8]) -> bool {
+            unsafe { sys::net_ws_send(self.id, data.as_ptr(), data.len() as u32, 0) != 0 }
         }
 
-        // Free the memory in guest space
-        unsafe { sys::storage_free(ptr, len) };
+        /// Queue a text message.
+        pub fn send_text(&self, text: &str) -> bool {
+            unsafe { sys::net_ws_send(self.id, text.as_ptr(), text.len() as u32, 1) != 0 }
+        }
 
-        Some(data)
+        /// Take the oldest received message, if any. Text messages arrive as UTF-8 bytes.
+        pub fn receive(&self) -> Option<Vec<u8>> {
+            super::system::take_blob(unsafe { sys::net_ws_receive(self.id) })
+        }
+    }
+
+    impl Drop for WebSocket {
+        fn drop(&mut self) {
+            unsafe { sys::net_ws_close(self.id) };
+        }
+    }
+
+    /// State of a [`Session`].
+    #[derive(Clone, Copy, Debug, PartialEq, Eq)]
+    pub enum SessionStatus {
+        /// Waiting to hear from every peer. Ticks run normally and no inputs are synced.
+        Connecting,
+        Running,
+        /// Running, but a peer stopped responding; its last input repeats from now on.
+        PeerDropped,
+        /// The session was closed or replaced.
+        Closed,
+    }
+
+    /// One player's input for the current tick.
+    #[derive(Clone, Debug, PartialEq, Eq)]
+    pub struct PlayerInput {
+        pub bytes: Vec<u8>,
+        /// False if the host predicted it (the player's last input). A wrong prediction is
+        /// fixed by a rollback.
+        pub confirmed: bool,
+    }
+
+    /// A rollback netplay session. Each machine runs the same cart; every tick it adds its own
+    /// input and reads everyone's. When a predicted remote input turns out wrong, the host
+    /// restores a save state from before it and runs `update` again for the ticks since (see
+    /// [`Session::is_resimulating`] and [`super::system::on_rollback`]).
+    ///
+    /// Game state must depend only on the synced inputs (use [`crate::fixed`] rather than
+    /// floats), and only one session can be open. Dropping it closes the session.
+    #[derive(Debug)]
+    pub struct Session {
+        id: u32,
+    }
+
+    impl Session {
+        /// Open a session for `players` players (2-8) on UDP `port` (0 = any free port), this
+        /// machine playing `local_player`. Local inputs are applied `input_delay` ticks later
+        /// (at most 8), which trades latency for fewer rollbacks. Replaces an open session.
+        pub fn create(
+            players: u32,
+            input_delay: u32,
+            local_player: u32,
+            port: u16,
+        ) -> Option<Self> {
+            let id =
+                unsafe { sys::net_session_create(players, input_delay, local_player, port as u32) };
+            if id == 0 { None } else { Some(Self { id }) }
+        }
+
+        /// Exchange inputs with `player` at `addr` (`host:port`; the host must be allowlisted).
+        pub fn add_peer(&self, player: u32, addr: &str) -> bool {
+            unsafe {
+                sys::net_session_add_peer(self.id, player, addr.as_ptr(), addr.len() as u32) != 0
+            }
+        }
+
+        /// This tick's local input (at most 64 bytes). Call once per tick from `update`, before
+        /// [`Session::synced_inputs`]. Does nothing while re-simulating.
+        pub fn add_local_input(&self, input: &[u8]) -> bool {
+            unsafe {
+                sys::net_session_add_local_input(self.id, input.as_ptr(), input.len() as u32) != 0
+            }
+        }
+
+        /// Every player's input for this tick, indexed by player. Empty while connecting.
+        pub fn synced_inputs(&self) -> Vec<PlayerInput> {
+            let Some(data) =
+                super::system::take_blob(unsafe { sys::net_session_synced_inputs(self.id) })
+            else {
+                return Vec::new();
+            };
+            let mut inputs = Vec::new();
+            let mut rest = &data[..];
+            while let [confirmed, len, tail @ ..] = rest {
+                let len = (*len as usize).min(tail.len());
+                inputs.push(PlayerInput {
+                    bytes: tail[..len].to_vec(),
+                    confirmed: *confirmed != 0,
+                });
+                rest = &tail[len..];
+            }
+            inputs
+        }
+
+        pub fn status(&self) -> SessionStatus {
+            match unsafe { sys::net_session_status(self.id) } {
+                1 => SessionStatus::Connecting,
+                2 => SessionStatus::Running,
+                3 => SessionStatus::PeerDropped,
+                _ => SessionStatus::Closed,
+            }
+        }
+
+        /// The tick being simulated, counted from the start of the session.
+        pub fn frame(&self) -> u32 {
+            unsafe { sys::net_session_frame(self.id) }
+        }
+
+        /// True while `update` runs again for rolled-back ticks: skip sounds and other effects
+        /// that shouldn't repeat.
+        pub fn is_resimulating(&self) -> bool {
+            unsafe { sys::net_session_is_resimulating(self.id) != 0 }
+        }
+
+        /// The UDP port the session listens on, to tell the other players.
+        pub fn local_port(&self) -> u16 {
+            unsafe { sys::net_session_local_port(self.id) as u16 }
+        }
+
+        /// Exchange inputs with `player` over an open [`LanConnection`]. No address or
+        /// allowlist is needed. The connection must stay alive as long as the session.
+        pub fn add_lan_peer(&self, player: u32, conn: &LanConnection) -> bool {
+            unsafe { sys::net_session_add_lan_peer(self.id, player, conn.id) != 0 }
+        }
+    }
+
+    impl Drop for Session {
+        fn drop(&mut self) {
+            unsafe { sys::net_session_close(self.id) };
+        }
+    }
+
+    /// Another machine on the local network running this cart.
+    #[derive(Clone, Debug, PartialEq, Eq)]
+    pub struct LanPeer {
+        pub id: u32,
+        /// `ip:port`, for showing in a lobby.
+        pub address: String,
+    }
+
+    /// Look for other machines on the local network running this cart. Call it every tick or
+    /// so while in a lobby: the host probes at most once a second and lists the peers heard
+    /// in the last few seconds. Empty unless the player turned LAN play on.
+    pub fn lan_discover() -> Vec<LanPeer> {
+        let Some(data) = super::system::take_blob(unsafe { sys::net_lan_discover() }) else {
+            return Vec::new();
+        };
+        let mut peers = Vec::new();
+        let mut rest = &data[..];
+        while let [a, b, c, d, len, tail @ ..] = rest {
+            let len = (*len as usize).min(tail.len());
+            peers.push(LanPeer {
+                id: u32::from_le_bytes([*a, *b, *c, *d]),
+                address: String::from_utf8_lossy(&tail[..len]).into_owned(),
+            });
+            rest = &tail[len..];
+        }
+        peers
+    }
+
+    /// How [`LanConnection::send`] delivers a message.
+    #[derive(Clone, Copy, Debug, PartialEq, Eq)]
+    pub enum SendMode {
+        /// Sent once; may be lost or arrive out of order. For state replaced every tick.
+        Unreliable,
+        /// Resent until acknowledged; arrives once and in order. For events that must land.
+        Reliable,
+    }
+
+    /// A direct connection to a [`LanPeer`], with no server in between. One side connects and
+    /// the other accepts. Call [`LanConnection::receive`] from `update` to drain incoming
+    /// messages. Dropping it closes the connection.
+    #[derive(Debug)]
+    pub struct LanConnection {
+        id: u32,
+    }
+
+    impl LanConnection {
+        /// Connect to a discovered peer. The connection opens once the peer answers.
+        pub fn connect(peer: &LanPeer) -> Option<Self> {
+            let id = unsafe { sys::net_lan_connect(peer.id) };
+            if id == 0 { None } else { Some(Self { id }) }
+        }
+
+        /// The next connection a peer opened to this machine, if any.
+        pub fn accept() -> Option<Self> {
+            let id = unsafe { sys::net_lan_accept() };
+            if id == 0 { None } else { Some(Self { id }) }
+        }
+
+        /// Connections close when either side closes them or after a few seconds of silence.
+        pub fn state(&self) -> SocketState {
+            match unsafe { sys::net_lan_state(self.id) } {
+                1 => SocketState::Connecting,
+                2 => SocketState::Open,
+                _ => SocketState::Closed,
+            }
+        }
+
+        /// Send a message of at most 1200 bytes. Reliable messages sent while connecting go out
+        /// once the connection opens; unreliable ones are dropped. Returns false if the
+        /// connection is closed, the message is too big or too many reliable messages are
+        /// still unacknowledged.
+        pub fn send(&self, data: &[u8], mode: SendMode) -> bool {
+            let reliable = (mode == SendMode::Reliable) as u32;
+            unsafe { sys::net_lan_send(self.id, data.as_ptr(), data.len() as u32, reliable) != 0 }
+        }
+
+        /// Take the oldest received message, if any.
+        pub fn receive(&self) -> Option<Vec<u8>> {
+            super::system::take_blob(unsafe { sys::net_lan_receive(self.id) })
+        }
+    }
+
+    impl Drop for LanConnection {
+        fn drop(&mut self) {
+            unsafe { sys::net_lan_close(self.id) };
+        }
     }
 }
 
 /// System API.
 pub mod system {
     use super::sys;
+    use alloc::format;
+    use alloc::string::{String, ToString};
+    use alloc::vec;
+    use alloc::vec::Vec;
+    use core::sync::atomic::{AtomicPtr, AtomicU32, Ordering};
 
     /// Log a message to the host console.
     pub fn log(message: &str) {
-        unsafe { sys::system_log(message.as_ptr() as u32, message.len() as u32) }
+        unsafe { sys::system_log(message.as_ptr(), message.len() as u32) }
+    }
+
+    /// Severity of a log message. Maps onto the frontend's log levels.
+    #[repr(u32)]
+    #[derive(Clone, Copy, Debug, PartialEq, Eq, PartialOrd, Ord)]
+    pub enum LogLevel {
+        Debug = 0,
+        Info = 1,
+        Warn = 2,
+        Error = 3,
+    }
+
+    // Mirror of the host filter so `logf` can skip formatting messages that would be dropped.
+    static LOG_LEVEL: AtomicU32 = AtomicU32::new(LogLevel::Debug as u32);
+
+    /// Log a message at `level`.
+    pub fn log_at(level: LogLevel, message: &str) {
+        unsafe { sys::system_log_at(level as u32, message.as_ptr(), message.len() as u32) }
+    }
+
+    /// Format and log a message at `level`: `logf(LogLevel::Info, format_args!("hp={}", hp))`.
+    ///
+    /// Nothing is formatted when `level` is below the [`set_log_level`] filter.
+    pub fn logf(level: LogLevel, args: core::fmt::Arguments) {
+        if (level as u32) < LOG_LEVEL.load(Ordering::Relaxed) {
+            return;
+        }
+        match args.as_str() {
+            Some(s) => log_at(level, s),
+            None => log_at(level, &format!("{args}")),
+        }
+    }
+
+    pub fn debug(message: &str) {
+        log_at(LogLevel::Debug, message);
+    }
+
+    pub fn info(message: &str) {
+        log_at(LogLevel::Info, message);
+    }
+
+    pub fn warn(message: &str) {
+        log_at(LogLevel::Warn, message);
+    }
+
+    pub fn error(message: &str) {
+        log_at(LogLevel::Error, message);
+    }
+
+    /// Drop messages below `level`, e.g. `LogLevel::Info` to silence debug output in release carts.
+    pub fn set_log_level(level: LogLevel) {
+        LOG_LEVEL.store(level as u32, Ordering::Relaxed);
+        unsafe { sys::system_set_log_level(level as u32) }
+    }
+
+    /// Report a crash to the host console. `stack` may be empty.
+    pub fn report_error(message: &str, stack: &str) {
+        unsafe {
+            sys::system_report_error(
+                message.as_ptr(),
+                message.len() as u32,
+                stack.as_ptr(),
+                stack.len() as u32,
+            )
+        }
+    }
+
+    /// Install a panic hook that forwards panics to [`report_error`].
+    ///
+    /// Panics on wasm abort the module, so the host only sees a trap; call this once at the top
+    /// of `setup` to get the panic message and source location in the host console instead.
+    #[cfg(feature = "std")]
+    pub fn install_panic_hook() {
+        std::panic::set_hook(Box::new(|info| {
+            let payload = info.payload();
+            let message = if let Some(s) = payload.downcast_ref::<&str>() {
+                s
+            } else if let Some(s) = payload.downcast_ref::<String>() {
+                s.as_str()
+            } else {
+                "panic"
+            };
+            let location = info
+                .location()
+                .map(|l| format!("at {}:{}:{}", l.file(), l.line(), l.column()))
+                .unwrap_or_default();
+            report_error(message, &location);
+        }));
     }
 
     /// Get the number of milliseconds since the app started.
     pub fn millis() -> u64 {
         unsafe { sys::system_millis() }
     }
+
+    /// Wall-clock seconds since 1970-01-01 UTC. Use [`crate::time::DateTime`] for the calendar
+    /// date.
+    pub fn unix_time() -> i64 {
+        unsafe { sys::system_unix_time() }
+    }
+
+    /// The player's current UTC offset in minutes east of UTC (e.g. `-300` for New York in
+    /// winter). 0 when the host doesn't know its time zone.
+    pub fn local_time_offset_minutes() -> i32 {
+        unsafe { sys::system_local_time_offset_minutes() }
+    }
+
+    /// The player's language as a BCP-47 tag (`"en-US"`, `"pt-BR"`, `"ja"`), from the
+    /// frontend's language setting or the host locale. `"en"` when neither names one. See
+    /// [`crate::i18n`] for localized text.
+    pub fn locale() -> String {
+        take_blob(unsafe { sys::system_get_locale() })
+            .and_then(|bytes| String::from_utf8(bytes).ok())
+            .unwrap_or_else(|| "en".to_string())
+    }
+
+    /// The wall-clock time as a [`std::time::SystemTime`].
+    #[cfg(feature = "std")]
+    pub fn now() -> std::time::SystemTime {
+        let t = unix_time();
+        let since = std::time::Duration::from_secs(t.unsigned_abs());
+        if t >= 0 {
+            std::time::UNIX_EPOCH + since
+        } else {
+            std::time::UNIX_EPOCH - since
+        }
+    }
+
+    /// Milliseconds between the previous tick and this one (0 on the first tick).
+    pub fn delta_millis() -> u64 {
+        unsafe { sys::system_delta_millis() }
+    }
+
+    /// Seconds between the previous tick and this one, for variable-timestep updates.
+    pub fn delta_seconds() -> f32 {
+        delta_millis() as f32 / 1000.0
+    }
+
+    /// Limit `update`/`draw` to at most `fps` ticks per second. `0` ticks every host frame.
+    pub fn set_target_fps(fps: u32) {
+        unsafe { sys::system_set_target_fps(fps) }
+    }
+
+    /// Ticks per second measured over the last full second.
+    pub fn get_fps() -> u32 {
+        unsafe { sys::system_get_fps() }
+    }
+
+    /// Run `update` `hz` times per second, independently of `draw`, for fixed-step physics.
+    /// Each tick then runs the updates that have come due (none, one, or several to catch up)
+    /// before drawing once; step the simulation by `1.0 / hz` in each. `0` restores one
+    /// `update` per tick. Input is read once per tick, so every update in a tick sees the same
+    /// input, and netplay sessions always run one update per tick.
+    ///
+    /// ```ignore
+    /// system::set_update_rate(60);
+    /// // update: prev = pos; pos += vel / 60.0;
+    /// // draw:   let shown = prev.lerp(pos, system::interpolation_alpha());
+    /// ```
+    pub fn set_update_rate(hz: u32) {
+        unsafe { sys::system_set_update_rate(hz) }
+    }
+
+    /// How far this tick's `draw` is between the last `update` and the next, in `0.0..1.0`.
+    /// Always 1.0 without [`set_update_rate`].
+    pub fn interpolation_alpha() -> f32 {
+        unsafe { sys::system_interpolation_alpha() }
+    }
+
+    /// Next value from the host random number generator.
+    pub fn random() -> u64 {
+        unsafe { sys::system_random() }
+    }
+
+    /// Fresh entropy from the host, for seeding a guest-side generator.
+    pub fn random_seed() -> u64 {
+        unsafe { sys::system_random_seed() }
+    }
+
+    /// Callbacks set with [`on_pause`], [`on_resume`], [`on_quit`] and [`on_rollback`], run by the
+    /// exports of the same names that [`crate::lifecycle_hooks!`] defines.
+    static HOOKS: [AtomicPtr<()>; 4] = [const { AtomicPtr::new(core::ptr::null_mut()) }; 4];
+    #[doc(hidden)]
+    pub const HOOK_PAUSE: usize = 0;
+    #[doc(hidden)]
+    pub const HOOK_RESUME: usize = 1;
+    #[doc(hidden)]
+    pub const HOOK_QUIT: usize = 2;
+    #[doc(hidden)]
+    pub const HOOK_ROLLBACK: usize = 3;
+
+    #[doc(hidden)]
+    pub fn run_hook(slot: usize) {
+        let ptr = HOOKS[slot].load(Ordering::Relaxed);
+        if !ptr.is_null() {
+            // Only ever stored from a `fn()` below.
+            let hook: fn() = unsafe { core::mem::transmute::<*mut (), fn()>(ptr) };
+            hook();
+        }
+    }
+
+    /// Run `hook` when the frontend pauses and steps single frames.
+    ///
+    /// Most frontends don't run the cart at all while paused (menu open, window unfocused); then
+    /// only [`on_resume`] is called, once frames come back. Use either to open a pause menu.
+    /// Hooks only run in carts that invoke [`crate::lifecycle_hooks!`].
+    pub fn on_pause(hook: fn()) {
+        HOOKS[HOOK_PAUSE].store(hook as *mut (), Ordering::Relaxed);
+    }
+
+    /// Run `hook` when frames resume after a pause or after the frontend stopped running the
+    /// cart for a while; see [`on_pause`].
+    pub fn on_resume(hook: fn()) {
+        HOOKS[HOOK_RESUME].store(hook as *mut (), Ordering::Relaxed);
+    }
+
+    /// Run `hook` before the cart is unloaded (the player closed it), e.g. to flush saves.
+    pub fn on_quit(hook: fn()) {
+        HOOKS[HOOK_QUIT].store(hook as *mut (), Ordering::Relaxed);
+    }
+
+    /// Run `hook` when a netplay [`crate::net::Session`] rolls back: memory has just been
+    /// restored to an earlier tick, and `update` is about to run again from there.
+    pub fn on_rollback(hook: fn()) {
+        HOOKS[HOOK_ROLLBACK].store(hook as *mut (), Ordering::Relaxed);
+    }
+
+    /// Exit back to the frontend once the current tick returns (after `on_quit`, see
+    /// [`on_quit`]). Frontends that don't support it log a warning and keep running.
+    pub fn quit() {
+        unsafe { sys::system_quit() }
+    }
+
+    /// Restart the cart cleanly once the current tick returns: fresh memory, then `setup` again.
+    /// Saved data, metadata and launch parameters are kept.
+    pub fn reset() {
+        unsafe { sys::system_reset() }
+    }
+
+    /// Result of polling a [`ClipboardRead`].
+    #[derive(Clone, Debug, PartialEq, Eq)]
+    pub enum ClipboardPoll {
+        Pending,
+        /// The clipboard's text (empty if it holds none).
+        Ready(String),
+        /// No clipboard tool worked, or the handle was already consumed.
+        Failed,
+    }
+
+    /// Handle to a clipboard read running in the background. Dropping it discards the text.
+    #[derive(Debug)]
+    pub struct ClipboardRead {
+        id: u32,
+    }
+
+    impl ClipboardRead {
+        /// Check on the read. After `Ready` or `Failed` the handle is spent.
+        pub fn poll(&mut self) -> ClipboardPoll {
+            if self.id == 0 {
+                return ClipboardPoll::Failed;
+            }
+            match unsafe { sys::system_clipboard_poll(self.id) } {
+                1 => ClipboardPoll::Pending,
+                2 => {
+                    let text = take_blob(unsafe { sys::system_clipboard_take(self.id) });
+                    self.id = 0;
+                    ClipboardPoll::Ready(
+                        text.and_then(|t| String::from_utf8(t).ok())
+                            .unwrap_or_default(),
+                    )
+                }
+                _ => {
+                    unsafe { sys::system_clipboard_cancel(self.id) };
+                    self.id = 0;
+                    ClipboardPoll::Failed
+                }
+            }
+        }
+    }
+
+    impl Drop for ClipboardRead {
+        fn drop(&mut self) {
+            if self.id != 0 {
+                unsafe { sys::system_clipboard_cancel(self.id) };
+            }
+        }
+    }
+
+    /// Start reading the clipboard's text in the background; poll the handle on later ticks.
+    /// `None` if the player hasn't allowed clipboard reads (`WASM96_CLIPBOARD=read`) or a few
+    /// reads are already pending. Read on a paste action, not every tick.
+    pub fn clipboard_get() -> Option<ClipboardRead> {
+        let id = unsafe { sys::system_clipboard_get() };
+        (id != 0).then_some(ClipboardRead { id })
+    }
+
+    /// Copy `text` to the clipboard. Returns false if the player hasn't allowed clipboard writes
+    /// (`WASM96_CLIPBOARD=write`).
+    pub fn clipboard_set(text: &str) -> bool {
+        unsafe { sys::system_clipboard_set(text.as_ptr(), text.len() as u32) != 0 }
+    }
+
+    /// A value from this cart's metadata (`title`, `version`, `author`, ...), as embedded with
+    /// [`cart_meta!`](crate::cart_meta). `None` if the cart doesn't set it.
+    pub fn cart_meta(key: &str) -> Option<String> {
+        let id = unsafe { sys::system_cart_meta(key.as_ptr(), key.len() as u32) };
+        String::from_utf8(take_blob(id)?).ok()
+    }
+
+    /// A launch parameter supplied by the player or frontend (e.g. `difficulty`, `debug`).
+    /// Flags given without a value read as `"1"`. `None` if it wasn't supplied.
+    pub fn launch_arg(key: &str) -> Option<String> {
+        let id = unsafe { sys::system_launch_arg(key.as_ptr(), key.len() as u32) };
+        String::from_utf8(take_blob(id)?).ok()
+    }
+
+    /// Unlock an achievement; the frontend shows a notification the first time. Returns `false`
+    /// if the cart declares its achievements and `id` isn't one of them:
+    ///
+    /// ```ignore
+    /// wasm96_sdk::cart_meta! {
+    ///     achievements = "first_blood,speedrun",
+    ///     achievement_speedrun = "Under Ten Minutes",
+    /// }
+    /// ```
+    pub fn achievement_unlock(id: &str) -> bool {
+        unsafe { sys::system_achievement_unlock(id.as_ptr(), id.len() as u32) != 0 }
+    }
+
+    /// Report progress towards an achievement, e.g. coins collected out of 100. Every quarter of
+    /// the way is announced, and reaching `max` unlocks it. Returns `false` for an undeclared id
+    /// or a `max` of 0.
+    pub fn achievement_progress(id: &str, value: u32, max: u32) -> bool {
+        unsafe { sys::system_achievement_progress(id.as_ptr(), id.len() as u32, value, max) != 0 }
+    }
+
+    /// Whether the cart was just hot-reloaded (the host was run with `WASM96_HOT_RELOAD` and the
+    /// cart file changed). A new module re-runs `setup` on a fresh instance, with storage kept,
+    /// so `setup` can skip the title screen and restore the level being worked on. New assets
+    /// alone keep the guest running; re-read them in `update` when this is true. It stays true
+    /// until the first tick after the reload ends.
+    pub fn dev_reload_requested() -> bool {
+        unsafe { sys::system_dev_reload_requested() != 0 }
+    }
+
+    /// The bytes of an asset packed in this cart's `.w96` bundle, e.g. `"sprites/ship.png"`.
+    /// Assets stay on the host until read. `None` if there's no such asset (or the cart isn't a
+    /// bundle).
+    pub fn asset_read(path: &str) -> Option<Vec<u8>> {
+        take_blob(unsafe { sys::system_asset_read(path.as_ptr(), path.len() as u32) })
+    }
+
+    /// Paths of the bundle assets starting with `prefix` (`""` lists all), sorted.
+    pub fn asset_list(prefix: &str) -> Vec<String> {
+        let id = unsafe { sys::system_asset_list(prefix.as_ptr(), prefix.len() as u32) };
+        let Some(bytes) = take_blob(id) else {
+            return Vec::new();
+        };
+        String::from_utf8_lossy(&bytes)
+            .lines()
+            .map(String::from)
+            .collect()
+    }
+
+    /// Color vision deficiency the player asked carts to accommodate.
+    #[derive(Copy, Clone, Debug, Default, PartialEq, Eq)]
+    pub enum ColorBlindMode {
+        #[default]
+        Off,
+        /// Red-blind.
+        Protanopia,
+        /// Green-blind.
+        Deuteranopia,
+        /// Blue-blind.
+        Tritanopia,
+    }
+
+    /// The player's accessibility preferences, from [`accessibility_settings`].
+    #[derive(Copy, Clone, Debug, PartialEq)]
+    pub struct AccessibilitySettings {
+        /// Avoid strobing, screen flashes and rapid palette cycling.
+        pub reduce_flashing: bool,
+        /// Prefer stronger contrast between text, UI and backgrounds.
+        pub high_contrast: bool,
+        /// Preferred text size multiplier, for [`graphics::set_text_scale`](crate::graphics::set_text_scale).
+        pub text_scale: f32,
+        pub color_blind_mode: ColorBlindMode,
+    }
+
+    impl Default for AccessibilitySettings {
+        fn default() -> Self {
+            Self {
+                reduce_flashing: false,
+                high_contrast: false,
+                text_scale: 1.0,
+                color_blind_mode: ColorBlindMode::Off,
+            }
+        }
+    }
+
+    /// The player's accessibility preferences, set in the frontend's core options. They can
+    /// change while the cart runs, so read them again when opening a menu or each tick.
+    pub fn accessibility_settings() -> AccessibilitySettings {
+        let mut buf = [0u8; 12];
+        if unsafe { sys::system_accessibility_settings(buf.as_mut_ptr(), buf.len() as u32) } == 0 {
+            return AccessibilitySettings::default();
+        }
+        let word = |i: usize| u32::from_le_bytes([buf[i], buf[i + 1], buf[i + 2], buf[i + 3]]);
+        let flags = word(0);
+        AccessibilitySettings {
+            reduce_flashing: flags & 1 != 0,
+            high_contrast: flags & 2 != 0,
+            text_scale: f32::from_bits(word(4)),
+            color_blind_mode: match word(8) {
+                1 => ColorBlindMode::Protanopia,
+                2 => ColorBlindMode::Deuteranopia,
+                3 => ColorBlindMode::Tritanopia,
+                _ => ColorBlindMode::Off,
+            },
+        }
+    }
+
+    /// Profiling figures for the previous tick, from [`stats`].
+    #[derive(Copy, Clone, Debug, Default, PartialEq, Eq)]
+    pub struct Stats {
+        /// Draw imports called during the tick.
+        pub draw_calls: u32,
+        /// Time spent in `update`, in microseconds.
+        pub update_micros: u32,
+        /// Time spent in `draw`, including the host work its draw calls did.
+        pub draw_micros: u32,
+        /// Host time spent compositing, post-processing and presenting the frame.
+        pub render_micros: u32,
+        /// Size of this cart's linear memory in bytes.
+        pub memory_bytes: u64,
+        /// Registered images (PNG, JPEG, SVG, GIF and palette images).
+        pub images: u32,
+        pub fonts: u32,
+        pub meshes: u32,
+    }
+
+    /// Draw calls, timings, resource counts and memory use of the previous tick, for finding
+    /// performance regressions.
+    pub fn stats() -> Stats {
+        let mut buf = [0u8; 36];
+        if unsafe { sys::system_stats(buf.as_mut_ptr(), buf.len() as u32) } == 0 {
+            return Stats::default();
+        }
+        let word = |i: usize| u32::from_le_bytes([buf[i], buf[i + 1], buf[i + 2], buf[i + 3]]);
+        Stats {
+            draw_calls: word(0),
+            update_micros: word(4),
+            draw_micros: word(8),
+            render_micros: word(12),
+            memory_bytes: word(16) as u64 | (word(20) as u64) << 32,
+            images: word(24),
+            fonts: word(28),
+            meshes: word(32),
+        }
+    }
+
+    /// Where an async load ([`graphics::image_register_async`](crate::graphics::image_register_async),
+    /// [`audio::SoundPool::new_async`](crate::audio::SoundPool::new_async)) is.
+    #[derive(Copy, Clone, Debug, PartialEq, Eq)]
+    pub enum LoadStatus {
+        Unknown,
+        Pending,
+        Ready,
+        Failed,
+    }
+
+    /// Status of an async load. Decoded assets become ready at the start of a tick.
+    pub fn load_status(handle: u32) -> LoadStatus {
+        match unsafe { sys::system_load_status(handle) } {
+            1 => LoadStatus::Pending,
+            2 => LoadStatus::Ready,
+            3 => LoadStatus::Failed,
+            _ => LoadStatus::Unknown,
+        }
+    }
+
+    /// Whether an async load has finished successfully.
+    pub fn is_ready(handle: u32) -> bool {
+        load_status(handle) == LoadStatus::Ready
+    }
+
+    /// Finished fraction (0.0..=1.0) of the loads started since nothing was last loading; 1.0
+    /// when idle. Drives a loading-screen progress bar.
+    pub fn load_progress() -> f32 {
+        unsafe { sys::system_load_progress() }
+    }
+
+    /// Where a background [`Job`] is.
+    #[derive(Copy, Clone, Debug, PartialEq, Eq)]
+    pub enum JobStatus {
+        Running,
+        Done,
+        /// Trapped, had the wrong signature, or called an import jobs don't get.
+        Failed,
+    }
+
+    /// An export of this cart running on a worker instance, in parallel with the cart. Dropping
+    /// it forgets the job and stops it if it's still running.
+    ///
+    /// The worker has its own memory and only the job imports ([`job_input`], [`job_output`]);
+    /// drawing, audio and other host calls fail the job.
+    #[derive(Debug)]
+    pub struct Job {
+        id: u32,
+    }
+
+    /// Run export `name` (`extern "C" fn(u32) -> u32`, or returning nothing) on a worker with
+    /// `arg`. `None` if there's no such export or too many jobs are running.
+    pub fn spawn_job(name: &str, arg: u32) -> Option<Job> {
+        spawn_job_with(name, arg, &[])
+    }
+
+    /// [`spawn_job`] with input bytes (up to 16 MiB) the job reads with [`job_input`].
+    pub fn spawn_job_with(name: &str, arg: u32, input: &[u8]) -> Option<Job> {
+        let id = unsafe {
+            sys::system_job_spawn(
+                name.as_ptr(),
+                name.len() as u32,
+                arg,
+                input.as_ptr(),
+                input.len() as u32,
+            )
+        };
+        (id != 0).then_some(Job { id })
+    }
+
+    impl Job {
+        pub fn status(&self) -> JobStatus {
+            match unsafe { sys::system_job_status(self.id) } {
+                1 => JobStatus::Running,
+                2 => JobStatus::Done,
+                _ => JobStatus::Failed,
+            }
+        }
+
+        /// Whether the job has finished, successfully or not.
+        pub fn is_done(&self) -> bool {
+            self.status() != JobStatus::Running
+        }
+
+        /// The export's return value, once done.
+        pub fn result(&self) -> Option<u32> {
+            (self.status() == JobStatus::Done).then(|| unsafe { sys::system_job_result(self.id) })
+        }
+
+        /// The bytes the job wrote with [`job_output`], once done. Handed over once.
+        pub fn take_output(&self) -> Option<Vec<u8>> {
+            take_blob(unsafe { sys::system_job_output(self.id) })
+        }
+    }
+
+    impl Drop for Job {
+        fn drop(&mut self) {
+            unsafe { sys::system_job_free(self.id) }
+        }
+    }
+
+    /// Inside a job: the input bytes it was spawned with (empty outside a job).
+    pub fn job_input() -> Vec<u8> {
+        let len = unsafe { sys::system_job_input_len() };
+        let mut data = vec![0u8; len as usize];
+        let n = unsafe { sys::system_job_input_read(data.as_mut_ptr(), len) };
+        data.truncate(n as usize);
+        data
+    }
+
+    /// Inside a job: append bytes to its output (discarded outside a job).
+    pub fn job_output(bytes: &[u8]) -> bool {
+        unsafe { sys::system_job_output_write(bytes.as_ptr(), bytes.len() as u32) != 0 }
+    }
+
+    /// Copy a host blob into a `Vec` and release it. Returns `None` for id 0 or a missing blob.
+    pub(crate) fn take_blob(id: u32) -> Option<Vec<u8>> {
+        if id == 0 {
+            return None;
+        }
+        let len = unsafe { sys::system_blob_len(id) };
+        let mut data = vec![0u8; len as usize];
+        let copied = unsafe { sys::system_blob_read(id, data.as_mut_ptr(), len) };
+        unsafe { sys::system_blob_free(id) };
+        if copied != len {
+            return None;
+        }
+        Some(data)
+    }
+
+    /// Capture the current framebuffer as PNG bytes (2D layer only).
+    pub fn screenshot() -> Option<Vec<u8>> {
+        take_blob(unsafe { sys::system_screenshot() })
+    }
+
+    /// Start recording drawn frames for a GIF. Restarts any recording in progress.
+    pub fn record_gif_start() {
+        unsafe { sys::system_record_gif_start() }
+    }
+
+    /// Stop recording and return the encoded GIF bytes, or `None` if nothing was recorded.
+    pub fn record_gif_stop() -> Option<Vec<u8>> {
+        take_blob(unsafe { sys::system_record_gif_stop() })
+    }
+
+    /// Snapshot the whole cart: guest memory plus drawing state, framebuffer, host RNG and
+    /// mixer volumes. Keep it to implement quick-save or rewind.
+    pub fn state_save() -> Option<Vec<u8>> {
+        take_blob(unsafe { sys::system_state_save() })
+    }
+
+    /// Restore a snapshot from [`state_save`]. It takes effect once the current tick returns
+    /// (restoring memory mid-call would pull the rug out from under it), so return promptly.
+    /// Returns false if `data` isn't a snapshot.
+    pub fn state_load(data: &[u8]) -> bool {
+        unsafe { sys::system_state_load(data.as_ptr(), data.len() as u32) != 0 }
+    }
+
+    /// Small guest-side PRNG (splitmix64).
+    ///
+    /// Seed it from the host with [`Rng::new`] for varied runs, or with [`Rng::with_seed`] for
+    /// reproducible sequences (replays, procedural generation).
+    #[derive(Clone, Debug)]
+    pub struct Rng {
+        state: u64,
+    }
+
+    impl Rng {
+        /// Create a generator seeded from host entropy.
+        pub fn new() -> Self {
+            Self::with_seed(random_seed())
+        }
+
+        /// Create a generator with a fixed seed.
+        pub fn with_seed(seed: u64) -> Self {
+            Self { state: seed }
+        }
+
+        /// Next 64 random bits.
+        pub fn next_u64(&mut self) -> u64 {
+            self.state = self.state.wrapping_add(0x9E37_79B9_7F4A_7C15);
+            let mut z = self.state;
+            z = (z ^ (z >> 30)).wrapping_mul(0xBF58_476D_1CE4_E5B9);
+            z = (z ^ (z >> 27)).wrapping_mul(0x94D0_49BB_1331_11EB);
+            z ^ (z >> 31)
+        }
+
+        /// Next 32 random bits.
+        pub fn next_u32(&mut self) -> u32 {
+            (self.next_u64() >> 32) as u32
+        }
+
+        /// Uniform float in `[0, 1)`.
+        pub fn next_f32(&mut self) -> f32 {
+            (self.next_u64() >> 40) as f32 / (1u64 << 24) as f32
+        }
+
+        /// Uniform integer in `[lo, hi)`. Returns `lo` if the range is empty.
+        pub fn range(&mut self, lo: i32, hi: i32) -> i32 {
+            if hi <= lo {
+                return lo;
+            }
+            let span = (hi as i64 - lo as i64) as u64;
+            (lo as i64 + (self.next_u64() % span) as i64) as i32
+        }
+    }
+
+    impl Default for Rng {
+        fn default() -> Self {
+            Self::new()
+        }
+    }
 }
 
 /// Convenience prelude for guest apps.
 pub mod prelude {
     pub use crate::Button;
-    pub use crate::TextSize;
+    pub use crate::Color;
+    pub use crate::DrawInstance;
+    pub use crate::FillRule;
+    pub use crate::LineStyle;
+    pub use crate::ParticleConfig;
+    pub use crate::ParticleShape;
+    pub use crate::Point;
+    pub use crate::PostEffect;
+    pub use crate::ScalingMode;
+    pub use crate::ScreenTransition;
+    pub use crate::TextStyle;
+    pub use crate::actions::{ActionMap, Binding};
+    pub use crate::animation::Animation;
     pub use crate::audio;
+    pub use crate::collide;
+    pub use crate::ecs::{Entity, Storage, World};
+    pub use crate::fixed::Fixed;
     pub use crate::graphics;
+    pub use crate::i18n::I18n;
     pub use crate::input;
+    pub use crate::math::{self, Rect, Vec2};
+    pub use crate::net;
+    pub use crate::pack::{self, Pack};
+    pub use crate::qoi;
+    pub use crate::resources::{FontHandle, GifHandle, ResourceError, SvgHandle};
+    pub use crate::save::{self, SaveData, SaveError};
+    pub use crate::scene::{Scene, SceneCommand, SceneManager, Transition};
     pub use crate::storage;
     pub use crate::system;
+    pub use crate::time::DateTime;
+    pub use crate::timer::{TimerHandle, Timers};
+    pub use crate::tween::{Ease, Group, Tween};
+    pub use crate::ui::{Theme, Ui, UiInput};
+    pub use crate::{FontMetrics, TextSize};
 }
 
 // Keep `c_void` referenced so it doesn't look unused in some configurations.
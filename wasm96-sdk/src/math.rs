@@ -0,0 +1,549 @@
+//! 2D math for game logic: vectors, rectangles, interpolation and intersection tests.
+//!
+//! Everything is `f32`, which is what the host's drawing API ends up rounding to anyway.
+//! Convert to screen coordinates with `Point::from(v)` or the `*_at`/`*_of` drawing helpers in
+//! [`crate::graphics`].
+//!
+//! `core` has no transcendental functions, so [`sqrt`], [`sin`], [`cos`] and [`atan2`] are small
+//! approximations (relative error around 1e-6, `atan2` around 1e-5 rad) that work the same with
+//! and without `std` and don't pull in a libm.
+
+use core::f32::consts::{PI, TAU};
+use core::ops::{Add, AddAssign, Div, Mul, MulAssign, Neg, Sub, SubAssign};
+
+use crate::Point;
+
+/// Linear interpolation: `a` at `t = 0`, `b` at `t = 1`. `t` is not clamped.
+pub fn lerp(a: f32, b: f32, t: f32) -> f32 {
+    a + (b - a) * t
+}
+
+/// Where `v` sits between `a` and `b` (0 at `a`, 1 at `b`). Returns 0 if `a == b`.
+pub fn inverse_lerp(a: f32, b: f32, v: f32) -> f32 {
+    if a == b { 0.0 } else { (v - a) / (b - a) }
+}
+
+/// Clamp `v` to `min..=max`.
+pub fn clamp(v: f32, min: f32, max: f32) -> f32 {
+    v.max(min).min(max)
+}
+
+/// Move `current` toward `target` by at most `max_delta`, without overshooting.
+pub fn approach(current: f32, target: f32, max_delta: f32) -> f32 {
+    if current < target {
+        (current + max_delta).min(target)
+    } else {
+        (current - max_delta).max(target)
+    }
+}
+
+pub fn deg_to_rad(deg: f32) -> f32 {
+    deg * (PI / 180.0)
+}
+
+pub fn rad_to_deg(rad: f32) -> f32 {
+    rad * (180.0 / PI)
+}
+
+/// Largest integer not greater than `v`. Values beyond `i64` range saturate.
+pub fn floor(v: f32) -> f32 {
+    let t = v as i64 as f32;
+    if t > v { t - 1.0 } else { t }
+}
+
+/// Round half away from zero.
+pub fn round(v: f32) -> f32 {
+    if v >= 0.0 {
+        floor(v + 0.5)
+    } else {
+        -floor(-v + 0.5)
+    }
+}
+
+/// Square root; 0 for non-positive input.
+pub fn sqrt(v: f32) -> f32 {
+    if v <= 0.0 || v.is_nan() {
+        return 0.0;
+    }
+    if v.is_infinite() {
+        return v;
+    }
+    // Bit-level initial guess, then Newton steps.
+    let mut y = f32::from_bits((v.to_bits() >> 1) + 0x1fbd_1df5);
+    for _ in 0..3 {
+        y = 0.5 * (y + v / y);
+    }
+    y
+}
+
+/// Sine of `rad`.
+pub fn sin(rad: f32) -> f32 {
+    // Reduce to -PI/2..PI/2, where the series converges quickly.
+    let mut x = wrap_angle(rad);
+    if x > PI / 2.0 {
+        x = PI - x;
+    } else if x < -PI / 2.0 {
+        x = -PI - x;
+    }
+    let x2 = x * x;
+    x * (1.0
+        + x2 * (-1.0 / 6.0
+            + x2 * (1.0 / 120.0
+                + x2 * (-1.0 / 5040.0 + x2 * (1.0 / 362_880.0 + x2 * (-1.0 / 39_916_800.0))))))
+}
+
+/// Cosine of `rad`.
+pub fn cos(rad: f32) -> f32 {
+    sin(rad + PI / 2.0)
+}
+
+/// Angle of the vector `(x, y)` from the positive x axis, in `-PI..=PI`. 0 for the origin.
+pub fn atan2(y: f32, x: f32) -> f32 {
+    fn atan_unit(z: f32) -> f32 {
+        // Minimax fit of atan on -1..1.
+        let z2 = z * z;
+        z * (0.999_977_26
+            + z2 * (-0.332_623_47
+                + z2 * (0.193_543_46
+                    + z2 * (-0.116_432_87 + z2 * (0.052_653_32 + z2 * -0.011_721_2)))))
+    }
+    if x == 0.0 && y == 0.0 {
+        return 0.0;
+    }
+    if x.abs() >= y.abs() {
+        let a = atan_unit(y / x);
+        match (x < 0.0, y < 0.0) {
+            (false, _) => a,
+            (true, false) => a + PI,
+            (true, true) => a - PI,
+        }
+    } else {
+        let a = -atan_unit(x / y);
+        if y > 0.0 { a + PI / 2.0 } else { a - PI / 2.0 }
+    }
+}
+
+/// Wrap an angle in radians to `-PI..PI`.
+pub fn wrap_angle(rad: f32) -> f32 {
+    let shifted = rad + PI;
+    let a = shifted - TAU * floor(shifted / TAU) - PI;
+    // Rounding can land exactly on PI for inputs just below a multiple of TAU.
+    if a >= PI { a - TAU } else { a }
+}
+
+/// Signed shortest rotation from angle `from` to angle `to`, in `-PI..PI`.
+pub fn angle_diff(from: f32, to: f32) -> f32 {
+    wrap_angle(to - from)
+}
+
+/// Interpolate between two angles along the shortest arc.
+pub fn lerp_angle(from: f32, to: f32, t: f32) -> f32 {
+    from + angle_diff(from, to) * t
+}
+
+/// A 2D vector.
+#[derive(Copy, Clone, Debug, Default, PartialEq)]
+pub struct Vec2 {
+    pub x: f32,
+    pub y: f32,
+}
+
+impl Vec2 {
+    pub const ZERO: Vec2 = Vec2::new(0.0, 0.0);
+    pub const ONE: Vec2 = Vec2::new(1.0, 1.0);
+    pub const UP: Vec2 = Vec2::new(0.0, -1.0);
+    pub const DOWN: Vec2 = Vec2::new(0.0, 1.0);
+    pub const LEFT: Vec2 = Vec2::new(-1.0, 0.0);
+    pub const RIGHT: Vec2 = Vec2::new(1.0, 0.0);
+
+    pub const fn new(x: f32, y: f32) -> Self {
+        Self { x, y }
+    }
+
+    /// Unit vector at `angle` radians (0 = right, clockwise on screen since y points down).
+    pub fn from_angle(angle: f32) -> Self {
+        Self::new(cos(angle), sin(angle))
+    }
+
+    pub fn dot(self, other: Vec2) -> f32 {
+        self.x * other.x + self.y * other.y
+    }
+
+    /// Z component of the 3D cross product; positive if `other` is clockwise from `self` on screen.
+    pub fn cross(self, other: Vec2) -> f32 {
+        self.x * other.y - self.y * other.x
+    }
+
+    pub fn length_squared(self) -> f32 {
+        self.dot(self)
+    }
+
+    pub fn length(self) -> f32 {
+        sqrt(self.length_squared())
+    }
+
+    pub fn distance(self, other: Vec2) -> f32 {
+        (other - self).length()
+    }
+
+    pub fn distance_squared(self, other: Vec2) -> f32 {
+        (other - self).length_squared()
+    }
+
+    /// Unit vector in the same direction, or zero for the zero vector.
+    pub fn normalize(self) -> Vec2 {
+        let len = self.length();
+        if len == 0.0 { Vec2::ZERO } else { self / len }
+    }
+
+    /// Same direction, length capped at `max`.
+    pub fn clamp_length(self, max: f32) -> Vec2 {
+        let len = self.length();
+        if len > max { self * (max / len) } else { self }
+    }
+
+    /// Angle in radians from the positive x axis.
+    pub fn angle(self) -> f32 {
+        atan2(self.y, self.x)
+    }
+
+    /// Rotate by `angle` radians.
+    pub fn rotate(self, angle: f32) -> Vec2 {
+        let (s, c) = (sin(angle), cos(angle));
+        Vec2::new(self.x * c - self.y * s, self.x * s + self.y * c)
+    }
+
+    /// Perpendicular vector (rotated 90 degrees).
+    pub fn perp(self) -> Vec2 {
+        Vec2::new(-self.y, self.x)
+    }
+
+    pub fn lerp(self, other: Vec2, t: f32) -> Vec2 {
+        Vec2::new(lerp(self.x, other.x, t), lerp(self.y, other.y, t))
+    }
+
+    /// Move toward `target` by at most `max_delta`, without overshooting.
+    pub fn approach(self, target: Vec2, max_delta: f32) -> Vec2 {
+        let delta = target - self;
+        let dist = delta.length();
+        if dist <= max_delta || dist == 0.0 {
+            target
+        } else {
+            self + delta * (max_delta / dist)
+        }
+    }
+
+    /// Reflect off a surface with unit normal `normal`.
+    pub fn reflect(self, normal: Vec2) -> Vec2 {
+        self - normal * (2.0 * self.dot(normal))
+    }
+}
+
+impl Add for Vec2 {
+    type Output = Vec2;
+    fn add(self, rhs: Vec2) -> Vec2 {
+        Vec2::new(self.x + rhs.x, self.y + rhs.y)
+    }
+}
+
+impl AddAssign for Vec2 {
+    fn add_assign(&mut self, rhs: Vec2) {
+        *self = *self + rhs;
+    }
+}
+
+impl Sub for Vec2 {
+    type Output = Vec2;
+    fn sub(self, rhs: Vec2) -> Vec2 {
+        Vec2::new(self.x - rhs.x, self.y - rhs.y)
+    }
+}
+
+impl SubAssign for Vec2 {
+    fn sub_assign(&mut self, rhs: Vec2) {
+        *self = *self - rhs;
+    }
+}
+
+impl Mul<f32> for Vec2 {
+    type Output = Vec2;
+    fn mul(self, rhs: f32) -> Vec2 {
+        Vec2::new(self.x * rhs, self.y * rhs)
+    }
+}
+
+impl MulAssign<f32> for Vec2 {
+    fn mul_assign(&mut self, rhs: f32) {
+        *self = *self * rhs;
+    }
+}
+
+impl Div<f32> for Vec2 {
+    type Output = Vec2;
+    fn div(self, rhs: f32) -> Vec2 {
+        Vec2::new(self.x / rhs, self.y / rhs)
+    }
+}
+
+impl Neg for Vec2 {
+    type Output = Vec2;
+    fn neg(self) -> Vec2 {
+        Vec2::new(-self.x, -self.y)
+    }
+}
+
+impl From<Point> for Vec2 {
+    fn from(p: Point) -> Self {
+        Vec2::new(p.x as f32, p.y as f32)
+    }
+}
+
+impl From<Vec2> for Point {
+    /// Rounds to the nearest pixel.
+    fn from(v: Vec2) -> Self {
+        Point::new(round(v.x) as i32, round(v.y) as i32)
+    }
+}
+
+/// An axis-aligned rectangle: top-left corner plus size.
+#[derive(Copy, Clone, Debug, Default, PartialEq)]
+pub struct Rect {
+    pub x: f32,
+    pub y: f32,
+    pub w: f32,
+    pub h: f32,
+}
+
+impl Rect {
+    pub const fn new(x: f32, y: f32, w: f32, h: f32) -> Self {
+        Self { x, y, w, h }
+    }
+
+    /// Rectangle of size `size` centered on `center`.
+    pub fn from_center(center: Vec2, size: Vec2) -> Self {
+        Self::new(
+            center.x - size.x / 2.0,
+            center.y - size.y / 2.0,
+            size.x,
+            size.y,
+        )
+    }
+
+    pub fn left(self) -> f32 {
+        self.x
+    }
+
+    pub fn right(self) -> f32 {
+        self.x + self.w
+    }
+
+    pub fn top(self) -> f32 {
+        self.y
+    }
+
+    pub fn bottom(self) -> f32 {
+        self.y + self.h
+    }
+
+    pub fn position(self) -> Vec2 {
+        Vec2::new(self.x, self.y)
+    }
+
+    pub fn size(self) -> Vec2 {
+        Vec2::new(self.w, self.h)
+    }
+
+    pub fn center(self) -> Vec2 {
+        Vec2::new(self.x + self.w / 2.0, self.y + self.h / 2.0)
+    }
+
+    /// Same size, moved by `offset`.
+    pub fn translate(self, offset: Vec2) -> Rect {
+        Rect::new(self.x + offset.x, self.y + offset.y, self.w, self.h)
+    }
+
+    /// Grown by `amount` on every side (shrunk if negative).
+    pub fn inflate(self, amount: f32) -> Rect {
+        Rect::new(
+            self.x - amount,
+            self.y - amount,
+            self.w + amount * 2.0,
+            self.h + amount * 2.0,
+        )
+    }
+
+    /// True if `p` is inside (left/top edges inclusive, right/bottom exclusive).
+    pub fn contains(self, p: Vec2) -> bool {
+        p.x >= self.left() && p.x < self.right() && p.y >= self.top() && p.y < self.bottom()
+    }
+
+    /// True if the rectangles overlap by a non-zero area.
+    pub fn intersects(self, other: Rect) -> bool {
+        self.left() < other.right()
+            && other.left() < self.right()
+            && self.top() < other.bottom()
+            && other.top() < self.bottom()
+    }
+
+    /// The overlapping area, if any.
+    pub fn intersection(self, other: Rect) -> Option<Rect> {
+        if !self.intersects(other) {
+            return None;
+        }
+        let x = self.left().max(other.left());
+        let y = self.top().max(other.top());
+        Some(Rect::new(
+            x,
+            y,
+            self.right().min(other.right()) - x,
+            self.bottom().min(other.bottom()) - y,
+        ))
+    }
+
+    /// Smallest rectangle containing both.
+    pub fn union(self, other: Rect) -> Rect {
+        let x = self.left().min(other.left());
+        let y = self.top().min(other.top());
+        Rect::new(
+            x,
+            y,
+            self.right().max(other.right()) - x,
+            self.bottom().max(other.bottom()) - y,
+        )
+    }
+
+    /// Closest point inside the rectangle to `p`.
+    pub fn clamp_point(self, p: Vec2) -> Vec2 {
+        Vec2::new(
+            clamp(p.x, self.left(), self.right()),
+            clamp(p.y, self.top(), self.bottom()),
+        )
+    }
+
+    /// True if the circle at `center` with radius `r` overlaps the rectangle.
+    pub fn intersects_circle(self, center: Vec2, r: f32) -> bool {
+        self.clamp_point(center).distance_squared(center) < r * r
+    }
+
+    /// Minimum translation that pushes `self` out of `other`, along the axis of least overlap.
+    /// `None` if they don't overlap.
+    pub fn penetration(self, other: Rect) -> Option<Vec2> {
+        let overlap = self.intersection(other)?;
+        let (dc_x, dc_y) = (
+            self.center().x - other.center().x,
+            self.center().y - other.center().y,
+        );
+        Some(if overlap.w < overlap.h {
+            Vec2::new(if dc_x < 0.0 { -overlap.w } else { overlap.w }, 0.0)
+        } else {
+            Vec2::new(0.0, if dc_y < 0.0 { -overlap.h } else { overlap.h })
+        })
+    }
+}
+
+/// True if two circles overlap.
+pub fn circles_intersect(a: Vec2, ra: f32, b: Vec2, rb: f32) -> bool {
+    let r = ra + rb;
+    a.distance_squared(b) < r * r
+}
+
+/// Intersection point of segments `a1..a2` and `b1..b2`, if they cross.
+pub fn segments_intersect(a1: Vec2, a2: Vec2, b1: Vec2, b2: Vec2) -> Option<Vec2> {
+    let r = a2 - a1;
+    let s = b2 - b1;
+    let denom = r.cross(s);
+    if denom == 0.0 {
+        return None; // parallel or collinear
+    }
+    let t = (b1 - a1).cross(s) / denom;
+    let u = (b1 - a1).cross(r) / denom;
+    if (0.0..=1.0).contains(&t) && (0.0..=1.0).contains(&u) {
+        Some(a1 + r * t)
+    } else {
+        None
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    fn close(a: f32, b: f32) -> bool {
+        (a - b).abs() < 1e-5
+    }
+
+    #[test]
+    fn scalar_helpers() {
+        assert_eq!(lerp(10.0, 20.0, 0.25), 12.5);
+        assert_eq!(inverse_lerp(10.0, 20.0, 12.5), 0.25);
+        assert_eq!(clamp(5.0, 0.0, 1.0), 1.0);
+        assert_eq!(approach(0.0, 10.0, 3.0), 3.0);
+        assert_eq!(approach(9.0, 10.0, 3.0), 10.0);
+        assert!(close(wrap_angle(3.0 * PI), -PI));
+        assert!(close(
+            angle_diff(deg_to_rad(350.0), deg_to_rad(10.0)),
+            deg_to_rad(20.0)
+        ));
+    }
+
+    #[test]
+    fn approximations_match_std() {
+        for i in -200..200 {
+            let a = i as f32 * 0.1;
+            assert!((sin(a) - a.sin()).abs() < 1e-5, "sin({a})");
+            assert!((cos(a) - a.cos()).abs() < 1e-5, "cos({a})");
+            let (y, x) = (a.sin() * 3.0, (a * 0.7).cos() - 0.2);
+            assert!((atan2(y, x) - y.atan2(x)).abs() < 1e-4, "atan2({y}, {x})");
+        }
+        for v in [1e-6f32, 0.25, 2.0, 10.0, 12345.0, 1e20] {
+            assert!((sqrt(v) - v.sqrt()).abs() <= v.sqrt() * 1e-6, "sqrt({v})");
+        }
+        assert_eq!(sqrt(-4.0), 0.0);
+        assert_eq!(round(2.5), 3.0);
+        assert_eq!(round(-2.5), -3.0);
+        assert_eq!(floor(-0.5), -1.0);
+    }
+
+    #[test]
+    fn vector_ops() {
+        let v = Vec2::new(3.0, 4.0);
+        assert_eq!(v.length(), 5.0);
+        assert!(close(v.normalize().length(), 1.0));
+        assert_eq!(Vec2::ZERO.normalize(), Vec2::ZERO);
+        assert_eq!(v + Vec2::ONE, Vec2::new(4.0, 5.0));
+        assert_eq!(v.clamp_length(2.5), Vec2::new(1.5, 2.0));
+        let r = Vec2::RIGHT.rotate(PI / 2.0);
+        assert!(close(r.x, 0.0) && close(r.y, 1.0));
+        assert_eq!(Point::from(Vec2::new(1.6, -1.4)), Point::new(2, -1));
+        assert_eq!(Vec2::new(1.0, -1.0).reflect(Vec2::UP), Vec2::new(1.0, 1.0));
+    }
+
+    #[test]
+    fn rect_tests() {
+        let a = Rect::new(0.0, 0.0, 10.0, 10.0);
+        let b = Rect::new(8.0, 5.0, 10.0, 10.0);
+        assert!(a.contains(Vec2::new(0.0, 9.9)));
+        assert!(!a.contains(Vec2::new(10.0, 5.0)));
+        assert_eq!(a.intersection(b), Some(Rect::new(8.0, 5.0, 2.0, 5.0)));
+        // Touching edges don't count as overlap.
+        assert!(!a.intersects(Rect::new(10.0, 0.0, 5.0, 5.0)));
+        assert_eq!(a.penetration(b), Some(Vec2::new(-2.0, 0.0)));
+        assert!(a.intersects_circle(Vec2::new(12.0, 5.0), 2.5));
+        assert!(!a.intersects_circle(Vec2::new(12.0, 12.0), 2.5));
+    }
+
+    #[test]
+    fn segment_crossing() {
+        let hit = segments_intersect(
+            Vec2::new(0.0, 0.0),
+            Vec2::new(10.0, 10.0),
+            Vec2::new(0.0, 10.0),
+            Vec2::new(10.0, 0.0),
+        );
+        assert_eq!(hit, Some(Vec2::new(5.0, 5.0)));
+        assert_eq!(
+            segments_intersect(Vec2::ZERO, Vec2::RIGHT, Vec2::DOWN, Vec2::ONE),
+            None
+        );
+    }
+}
@@ -0,0 +1,724 @@
+//! In-memory host for unit-testing guest code natively (`--features mock`).
+//!
+//! Every `wasm96_*` import resolves to a [`MockHost`] owned by the current thread, so
+//! `cargo test` can drive game logic without wasm or the libretro core. Each test runs on its
+//! own thread and therefore starts from a fresh host; call [`reset`] to start over mid-test.
+//!
+//! The mock keeps a software framebuffer (points, lines, filled rects and backgrounds are
+//! rasterized, without blending), records every draw call with the color it was issued in,
+//! lets tests inject buttons, keys and the mouse, captures logs and reported errors, keeps
+//! storage in memory, and advances time only when told to. Imports it doesn't model do nothing
+//! and return zero.
+//!
+//! ```ignore
+//! use wasm96_sdk::mock::{self, Draw};
+//! use wasm96_sdk::Button;
+//!
+//! #[test]
+//! fn jump_draws_player_higher() {
+//!     mock::with(|host| host.press(0, Button::A));
+//!     my_game::update();
+//!     my_game::draw();
+//!     assert!(mock::with(|host| host.draws().iter().any(|(d, _)| matches!(d, Draw::Rect { y: 10, .. }))));
+//! }
+//! ```
+
+use std::cell::RefCell;
+use std::collections::HashMap;
+
+use crate::sys::Host;
+use crate::system::LogLevel;
+use crate::{Button, Color};
+
+/// A draw call recorded by the mock.
+#[derive(Clone, Debug, PartialEq)]
+pub enum Draw {
+    Background {
+        r: u8,
+        g: u8,
+        b: u8,
+    },
+    Point {
+        x: i32,
+        y: i32,
+    },
+    Line {
+        x1: i32,
+        y1: i32,
+        x2: i32,
+        y2: i32,
+    },
+    Rect {
+        x: i32,
+        y: i32,
+        w: u32,
+        h: u32,
+    },
+    RectOutline {
+        x: i32,
+        y: i32,
+        w: u32,
+        h: u32,
+    },
+    Circle {
+        x: i32,
+        y: i32,
+        r: u32,
+    },
+    CircleOutline {
+        x: i32,
+        y: i32,
+        r: u32,
+    },
+    Triangle {
+        x1: i32,
+        y1: i32,
+        x2: i32,
+        y2: i32,
+        x3: i32,
+        y3: i32,
+    },
+    TriangleOutline {
+        x1: i32,
+        y1: i32,
+        x2: i32,
+        y2: i32,
+        x3: i32,
+        y3: i32,
+    },
+    Text {
+        x: i32,
+        y: i32,
+        font_key: u64,
+        text: String,
+    },
+}
+
+/// The in-memory host backing every import on the current thread.
+pub struct MockHost {
+    width: u32,
+    height: u32,
+    framebuffer: Vec<u32>,
+    color: Color,
+    draws: Vec<(Draw, Color)>,
+
+    buttons: HashMap<u32, u32>,
+    keys: HashMap<u32, bool>,
+    /// Hold time per held button (`(port, btn)`) and key, grown by `advance`.
+    button_held: HashMap<(u32, u32), u32>,
+    key_held: HashMap<u32, u32>,
+    mouse: (i32, i32),
+    mouse_buttons: u32,
+
+    millis: u64,
+    delta_millis: u64,
+    unix_time: i64,
+    utc_offset_minutes: i32,
+    locale: String,
+    rng: u64,
+
+    log_level: u32,
+    logs: Vec<(LogLevel, String)>,
+    errors: Vec<(String, String)>,
+
+    pub(crate) storage: HashMap<u64, Vec<u8>>,
+    blobs: HashMap<u32, Vec<u8>>,
+    next_blob: u32,
+}
+
+impl Default for MockHost {
+    fn default() -> Self {
+        // Same default screen as the core until `set_size` is called.
+        Self {
+            width: 320,
+            height: 240,
+            framebuffer: vec![0; 320 * 240],
+            color: Color::WHITE,
+            draws: Vec::new(),
+            buttons: HashMap::new(),
+            keys: HashMap::new(),
+            button_held: HashMap::new(),
+            key_held: HashMap::new(),
+            mouse: (0, 0),
+            mouse_buttons: 0,
+            millis: 0,
+            delta_millis: 0,
+            unix_time: 0,
+            utc_offset_minutes: 0,
+            locale: "en-US".to_string(),
+            rng: 0x853C_49E6_748F_EA9B,
+            log_level: 0,
+            logs: Vec::new(),
+            errors: Vec::new(),
+            storage: HashMap::new(),
+            blobs: HashMap::new(),
+            next_blob: 1,
+        }
+    }
+}
+
+thread_local! {
+    static HOST: RefCell<MockHost> = RefCell::new(MockHost::default());
+}
+
+/// Run `f` with this thread's mock host.
+pub fn with<R>(f: impl FnOnce(&mut MockHost) -> R) -> R {
+    HOST.with(|host| f(&mut host.borrow_mut()))
+}
+
+/// Replace this thread's mock host with a fresh one.
+pub fn reset() {
+    with(|host| *host = MockHost::default());
+}
+
+fn pack(c: Color) -> u32 {
+    (c.a as u32) << 24 | (c.r as u32) << 16 | (c.g as u32) << 8 | c.b as u32
+}
+
+/// Borrow a guest byte range. The mock runs natively, so guest pointers are host pointers.
+fn bytes<'a>(ptr: *const u8, len: u32) -> &'a [u8] {
+    if len == 0 {
+        return &[];
+    }
+    unsafe { core::slice::from_raw_parts(ptr, len as usize) }
+}
+
+fn text(ptr: *const u8, len: u32) -> String {
+    String::from_utf8_lossy(bytes(ptr, len)).into_owned()
+}
+
+impl MockHost {
+    // --- Test controls ---
+
+    /// Hold `btn` on controller `port`.
+    pub fn press(&mut self, port: u32, btn: Button) {
+        *self.buttons.entry(port).or_default() |= 1 << btn as u32;
+        self.button_held.entry((port, btn as u32)).or_insert(0);
+    }
+
+    /// Release `btn` on controller `port`.
+    pub fn release(&mut self, port: u32, btn: Button) {
+        *self.buttons.entry(port).or_default() &= !(1 << btn as u32);
+        self.button_held.remove(&(port, btn as u32));
+    }
+
+    /// Hold or release a keyboard key (libretro keycode).
+    pub fn set_key(&mut self, key: u32, down: bool) {
+        self.keys.insert(key, down);
+        if down {
+            self.key_held.entry(key).or_insert(0);
+        } else {
+            self.key_held.remove(&key);
+        }
+    }
+
+    /// Move the mouse.
+    pub fn set_mouse(&mut self, x: i32, y: i32) {
+        self.mouse = (x, y);
+    }
+
+    /// Hold or release a mouse button (0 = left, 1 = right, 2 = middle).
+    pub fn set_mouse_button(&mut self, btn: u32, down: bool) {
+        if down {
+            self.mouse_buttons |= 1 << btn;
+        } else {
+            self.mouse_buttons &= !(1 << btn);
+        }
+    }
+
+    /// Advance the clock by `ms`; `system::delta_millis` reports the same step and held
+    /// buttons and keys count it towards their hold time.
+    pub fn advance(&mut self, ms: u64) {
+        self.millis += ms;
+        self.delta_millis = ms;
+        let ms = ms.min(u32::MAX as u64) as u32;
+        for t in self
+            .button_held
+            .values_mut()
+            .chain(self.key_held.values_mut())
+        {
+            *t = t.saturating_add(ms);
+        }
+    }
+
+    /// Set the wall clock read by `system::unix_time` and `system::local_time_offset_minutes`.
+    pub fn set_wall_clock(&mut self, unix_time: i64, utc_offset_minutes: i32) {
+        self.unix_time = unix_time;
+        self.utc_offset_minutes = utc_offset_minutes;
+    }
+
+    /// Set the BCP-47 tag `system::locale` returns (`"en-US"` by default).
+    pub fn set_locale(&mut self, locale: &str) {
+        self.locale = locale.to_string();
+    }
+
+    // --- Assertions ---
+
+    /// Every draw call so far, with the color current when it was issued.
+    pub fn draws(&self) -> &[(Draw, Color)] {
+        &self.draws
+    }
+
+    /// Forget recorded draw calls (the framebuffer is kept).
+    pub fn clear_draws(&mut self) {
+        self.draws.clear();
+    }
+
+    /// Framebuffer pixel as 0xAARRGGBB, or `None` outside the screen.
+    pub fn pixel(&self, x: i32, y: i32) -> Option<u32> {
+        if x < 0 || y < 0 || x as u32 >= self.width || y as u32 >= self.height {
+            return None;
+        }
+        Some(self.framebuffer[(y as u32 * self.width + x as u32) as usize])
+    }
+
+    /// Screen size set by the guest.
+    pub fn size(&self) -> (u32, u32) {
+        (self.width, self.height)
+    }
+
+    /// Messages that passed the guest's log filter. Plain `system::log` is `LogLevel::Info`.
+    pub fn logs(&self) -> &[(LogLevel, String)] {
+        &self.logs
+    }
+
+    /// `(message, stack)` pairs passed to `system::report_error`.
+    pub fn errors(&self) -> &[(String, String)] {
+        &self.errors
+    }
+
+    /// Queue a blob for the guest to take (e.g. to fake a host-produced result). Returns its id.
+    pub fn push_blob(&mut self, data: Vec<u8>) -> u32 {
+        let id = self.next_blob;
+        self.next_blob += 1;
+        self.blobs.insert(id, data);
+        id
+    }
+
+    fn record(&mut self, draw: Draw) {
+        self.draws.push((draw, self.color));
+    }
+
+    fn plot(&mut self, x: i32, y: i32, argb: u32) {
+        if x < 0 || y < 0 || x as u32 >= self.width || y as u32 >= self.height {
+            return;
+        }
+        self.framebuffer[(y as u32 * self.width + x as u32) as usize] = argb;
+    }
+
+    fn push_log(&mut self, level: LogLevel, message: String) {
+        if level as u32 >= self.log_level {
+            self.logs.push((level, message));
+        }
+    }
+}
+
+// Pointers come from the SDK wrappers, which always pass live slices.
+#[allow(clippy::not_unsafe_ptr_arg_deref)]
+impl Host for MockHost {
+    fn graphics_set_size(&mut self, width: u32, height: u32) {
+        self.width = width;
+        self.height = height;
+        self.framebuffer = vec![0; (width * height) as usize];
+    }
+
+    fn graphics_set_color(&mut self, r: u32, g: u32, b: u32, a: u32) {
+        self.color = Color::rgba(r as u8, g as u8, b as u8, a as u8);
+    }
+
+    fn graphics_background(&mut self, r: u32, g: u32, b: u32) {
+        let (r, g, b) = (r as u8, g as u8, b as u8);
+        self.framebuffer.fill(pack(Color::rgb(r, g, b)));
+        self.record(Draw::Background { r, g, b });
+    }
+
+    fn graphics_point(&mut self, x: i32, y: i32) {
+        self.plot(x, y, pack(self.color));
+        self.record(Draw::Point { x, y });
+    }
+
+    fn graphics_line(&mut self, x1: i32, y1: i32, x2: i32, y2: i32) {
+        // Bresenham, matching the core's 1px lines.
+        let argb = pack(self.color);
+        let (dx, dy) = ((x2 - x1).abs(), -(y2 - y1).abs());
+        let (sx, sy) = (if x1 < x2 { 1 } else { -1 }, if y1 < y2 { 1 } else { -1 });
+        let (mut x, mut y, mut err) = (x1, y1, dx + dy);
+        loop {
+            self.plot(x, y, argb);
+            if x == x2 && y == y2 {
+                break;
+            }
+            let e2 = 2 * err;
+            if e2 >= dy {
+                err += dy;
+                x += sx;
+            }
+            if e2 <= dx {
+                err += dx;
+                y += sy;
+            }
+        }
+        self.record(Draw::Line { x1, y1, x2, y2 });
+    }
+
+    fn graphics_rect(&mut self, x: i32, y: i32, w: u32, h: u32) {
+        let argb = pack(self.color);
+        for py in y..y + h as i32 {
+            for px in x..x + w as i32 {
+                self.plot(px, py, argb);
+            }
+        }
+        self.record(Draw::Rect { x, y, w, h });
+    }
+
+    fn graphics_rect_outline(&mut self, x: i32, y: i32, w: u32, h: u32) {
+        self.record(Draw::RectOutline { x, y, w, h });
+    }
+
+    fn graphics_circle(&mut self, x: i32, y: i32, r: u32) {
+        self.record(Draw::Circle { x, y, r });
+    }
+
+    fn graphics_circle_outline(&mut self, x: i32, y: i32, r: u32) {
+        self.record(Draw::CircleOutline { x, y, r });
+    }
+
+    fn graphics_triangle(&mut self, x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
+        self.record(Draw::Triangle {
+            x1,
+            y1,
+            x2,
+            y2,
+            x3,
+            y3,
+        });
+    }
+
+    fn graphics_triangle_outline(&mut self, x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) {
+        self.record(Draw::TriangleOutline {
+            x1,
+            y1,
+            x2,
+            y2,
+            x3,
+            y3,
+        });
+    }
+
+    fn graphics_text_key(&mut self, x: i32, y: i32, font_key: u64, ptr: *const u8, len: u32) {
+        let text = text(ptr, len);
+        self.record(Draw::Text {
+            x,
+            y,
+            font_key,
+            text,
+        });
+    }
+
+    fn input_is_button_down(&mut self, port: u32, btn: u32) -> u32 {
+        let held = self.buttons.get(&port).copied().unwrap_or(0);
+        (btn < 32 && held & (1 << btn) != 0) as u32
+    }
+
+    fn input_is_key_down(&mut self, key: u32) -> u32 {
+        self.keys.get(&key).copied().unwrap_or(false) as u32
+    }
+
+    fn input_get_mouse_x(&mut self) -> i32 {
+        self.mouse.0
+    }
+
+    fn input_get_mouse_y(&mut self) -> i32 {
+        self.mouse.1
+    }
+
+    fn input_is_mouse_down(&mut self, btn: u32) -> u32 {
+        (btn < 32 && self.mouse_buttons & (1 << btn) != 0) as u32
+    }
+
+    fn input_button_held_millis(&mut self, port: u32, btn: u32) -> u32 {
+        self.button_held.get(&(port, btn)).copied().unwrap_or(0)
+    }
+
+    fn input_key_held_millis(&mut self, key: u32) -> u32 {
+        self.key_held.get(&key).copied().unwrap_or(0)
+    }
+
+    fn input_get_connected_ports(&mut self) -> u32 {
+        1
+    }
+
+    fn input_snapshot(&mut self, ptr: *mut u8, len: u32) -> u32 {
+        const SIZE: usize = 144;
+        if (len as usize) < SIZE {
+            return 0;
+        }
+        let mut out = [0u8; SIZE];
+        for port in 0..8u32 {
+            let held = self.buttons.get(&port).copied().unwrap_or(0) as u16;
+            let pressed = self
+                .button_held
+                .iter()
+                .filter(|((p, b), t)| *p == port && *b < 16 && **t == 0)
+                .fold(0u16, |mask, ((_, b), _)| mask | 1 << b);
+            let i = port as usize * 2;
+            out[i..i + 2].copy_from_slice(&held.to_le_bytes());
+            out[16 + i..16 + i + 2].copy_from_slice(&pressed.to_le_bytes());
+        }
+        out[32..36].copy_from_slice(&self.input_get_connected_ports().to_le_bytes());
+        out[36..40].copy_from_slice(&self.mouse.0.to_le_bytes());
+        out[40..44].copy_from_slice(&self.mouse.1.to_le_bytes());
+        out[44..48].copy_from_slice(&self.mouse_buttons.to_le_bytes());
+        for (&key, &down) in &self.keys {
+            if down && (key as usize) < 48 * 8 {
+                out[48 + key as usize / 8] |= 1 << (key % 8);
+            }
+        }
+        for (&key, &held) in &self.key_held {
+            if held == 0 && (key as usize) < 48 * 8 {
+                out[96 + key as usize / 8] |= 1 << (key % 8);
+            }
+        }
+        unsafe { core::ptr::copy_nonoverlapping(out.as_ptr(), ptr, SIZE) };
+        SIZE as u32
+    }
+
+    fn storage_save(&mut self, key: u64, ptr: *const u8, len: u32) {
+        self.storage.insert(key, bytes(ptr, len).to_vec());
+    }
+
+    fn system_log(&mut self, ptr: *const u8, len: u32) {
+        self.push_log(LogLevel::Info, text(ptr, len));
+    }
+
+    fn system_log_at(&mut self, level: u32, ptr: *const u8, len: u32) {
+        let level = match level {
+            0 => LogLevel::Debug,
+            1 => LogLevel::Info,
+            2 => LogLevel::Warn,
+            _ => LogLevel::Error,
+        };
+        self.push_log(level, text(ptr, len));
+    }
+
+    fn system_set_log_level(&mut self, level: u32) {
+        self.log_level = level.min(LogLevel::Error as u32);
+    }
+
+    fn system_report_error(
+        &mut self,
+        msg_ptr: *const u8,
+        msg_len: u32,
+        stack_ptr: *const u8,
+        stack_len: u32,
+    ) {
+        self.errors
+            .push((text(msg_ptr, msg_len), text(stack_ptr, stack_len)));
+    }
+
+    fn system_millis(&mut self) -> u64 {
+        self.millis
+    }
+
+    fn system_delta_millis(&mut self) -> u64 {
+        self.delta_millis
+    }
+
+    fn system_unix_time(&mut self) -> i64 {
+        self.unix_time
+    }
+
+    fn system_local_time_offset_minutes(&mut self) -> i32 {
+        self.utc_offset_minutes
+    }
+
+    fn system_get_locale(&mut self) -> u32 {
+        let locale = self.locale.clone().into_bytes();
+        self.push_blob(locale)
+    }
+
+    fn system_random(&mut self) -> u64 {
+        // splitmix64 from a fixed seed, so tests are reproducible.
+        self.rng = self.rng.wrapping_add(0x9E37_79B9_7F4A_7C15);
+        let mut z = self.rng;
+        z = (z ^ (z >> 30)).wrapping_mul(0xBF58_476D_1CE4_E5B9);
+        z = (z ^ (z >> 27)).wrapping_mul(0x94D0_49BB_1331_11EB);
+        z ^ (z >> 31)
+    }
+
+    fn system_random_seed(&mut self) -> u64 {
+        self.system_random()
+    }
+
+    fn system_blob_len(&mut self, id: u32) -> u32 {
+        self.blobs.get(&id).map_or(0, |b| b.len() as u32)
+    }
+
+    fn system_blob_read(&mut self, id: u32, ptr: *mut u8, len: u32) -> u32 {
+        let Some(blob) = self.blobs.get(&id) else {
+            return 0;
+        };
+        let n = blob.len().min(len as usize);
+        unsafe { core::ptr::copy_nonoverlapping(blob.as_ptr(), ptr, n) };
+        n as u32
+    }
+
+    fn system_blob_free(&mut self, id: u32) {
+        self.blobs.remove(&id);
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use crate::{graphics, input, storage, system};
+
+    #[test]
+    fn records_and_rasterizes_draws() {
+        graphics::set_size(16, 16);
+        graphics::background(0, 0, 0);
+        graphics::set_color(255, 0, 0, 255);
+        graphics::rect(2, 3, 4, 5);
+
+        with(|host| {
+            assert_eq!(host.size(), (16, 16));
+            assert_eq!(
+                host.draws().last(),
+                Some(&(
+                    Draw::Rect {
+                        x: 2,
+                        y: 3,
+                        w: 4,
+                        h: 5
+                    },
+                    Color::rgb(255, 0, 0)
+                ))
+            );
+            assert_eq!(host.pixel(2, 3), Some(0xFFFF_0000));
+            assert_eq!(host.pixel(6, 3), Some(0xFF00_0000));
+            assert_eq!(host.pixel(16, 0), None);
+        });
+    }
+
+    #[test]
+    fn injected_input_is_visible_to_the_guest() {
+        assert!(!input::is_button_down(0, Button::A));
+        with(|host| {
+            host.press(0, Button::A);
+            host.set_mouse(10, 20);
+        });
+        assert!(input::is_button_down(0, Button::A));
+        assert!(!input::is_button_down(1, Button::A));
+        assert_eq!((input::get_mouse_x(), input::get_mouse_y()), (10, 20));
+
+        with(|host| host.release(0, Button::A));
+        assert!(!input::is_button_down(0, Button::A));
+    }
+
+    #[test]
+    fn snapshot_matches_polled_input() {
+        with(|host| {
+            host.press(1, Button::Start);
+            host.set_key(32, true);
+            host.set_mouse(-4, 9);
+        });
+        let snap = input::snapshot();
+        assert!(snap.is_button_down(1, Button::Start) && snap.is_button_pressed(1, Button::Start));
+        assert!(!snap.is_button_down(0, Button::Start));
+        assert!(snap.is_key_down(32) && snap.is_key_pressed(32));
+        assert_eq!((snap.mouse_x(), snap.mouse_y()), (-4, 9));
+        assert!(snap.is_connected(0));
+
+        with(|host| host.advance(16));
+        let snap = input::snapshot();
+        assert!(snap.is_button_down(1, Button::Start) && !snap.is_button_pressed(1, Button::Start));
+        assert!(snap.is_key_down(32) && !snap.is_key_pressed(32));
+    }
+
+    #[test]
+    fn actions_follow_bound_inputs() {
+        use crate::actions::{ActionMap, Binding};
+
+        let mut actions = ActionMap::new();
+        actions.bind("jump", &[Binding::pad(0, Button::A), Binding::Key(32)]);
+        with(|host| host.set_key(32, true));
+        actions.update();
+        assert!(actions.pressed("jump") && actions.down("jump"));
+        assert_eq!(Binding::held(), Some(Binding::Key(32)));
+
+        with(|host| host.press(0, Button::A));
+        actions.update();
+        assert!(!actions.pressed("jump") && actions.down("jump"));
+
+        with(|host| {
+            host.set_key(32, false);
+            host.release(0, Button::A);
+        });
+        actions.update();
+        assert!(actions.released("jump"));
+        assert_eq!(Binding::held(), None);
+
+        actions.save("controls");
+        let mut restored = ActionMap::new();
+        assert!(restored.load("controls"));
+        assert_eq!(restored.bindings("jump"), actions.bindings("jump"));
+    }
+
+    #[test]
+    fn held_inputs_time_and_repeat() {
+        with(|host| host.press(0, Button::Down));
+        assert!(input::button_repeat(0, Button::Down, 300, 100));
+        let mut fired = Vec::new();
+        for tick in 1..=30 {
+            with(|host| host.advance(20));
+            if input::button_repeat(0, Button::Down, 300, 100) {
+                fired.push(tick * 20);
+            }
+        }
+        assert_eq!(fired, [300, 400, 500, 600]);
+        assert_eq!(input::button_held_millis(0, Button::Down), 600);
+
+        with(|host| host.release(0, Button::Down));
+        assert_eq!(input::button_held_millis(0, Button::Down), 0);
+        assert!(!input::button_repeat(0, Button::Down, 300, 100));
+    }
+
+    #[test]
+    fn logs_respect_the_filter() {
+        system::log("hello");
+        system::set_log_level(LogLevel::Warn);
+        system::debug("dropped");
+        system::logf(LogLevel::Error, format_args!("hp={}", 0));
+        system::report_error("boom", "at game.rs:1:1");
+
+        with(|host| {
+            assert_eq!(
+                host.logs(),
+                &[
+                    (LogLevel::Info, "hello".to_string()),
+                    (LogLevel::Error, "hp=0".to_string())
+                ]
+            );
+            assert_eq!(host.errors()[0].0, "boom");
+        });
+    }
+
+    #[test]
+    fn storage_and_time_round_trip() {
+        assert_eq!(storage::load("save"), None);
+        storage::save("save", b"level=3");
+        assert_eq!(storage::load("save").as_deref(), Some(&b"level=3"[..]));
+
+        with(|host| host.advance(16));
+        assert_eq!(system::millis(), 16);
+        assert_eq!(system::delta_millis(), 16);
+
+        with(|host| host.set_wall_clock(1_709_249_415, 60));
+        assert_eq!(crate::time::DateTime::now_local().day, 1);
+        assert_eq!(crate::time::DateTime::now_utc().day, 29);
+
+        reset();
+        assert_eq!(storage::load("save"), None);
+        assert_eq!(system::millis(), 0);
+    }
+}
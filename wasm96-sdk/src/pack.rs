@@ -0,0 +1,553 @@
+//! Compact binary encoding and LZ4 compression for save games and level data.
+//!
+//! Values are written with [`Writer`] and read back in the same order with [`Reader`]:
+//! integers as LEB128 varints (signed ones zigzagged, so small negatives stay short), floats as
+//! little-endian bits, and byte strings, strings and lists prefixed with their length. The
+//! [`Pack`] trait does this for whole values, and [`pack_struct!`](crate::pack_struct) for a
+//! struct's fields:
+//!
+//! ```ignore
+//! struct Save {
+//!     level: u32,
+//!     score: i64,
+//!     name: String,
+//!     unlocked: Vec<bool>,
+//! }
+//! wasm96_sdk::pack_struct!(Save { level, score, name, unlocked });
+//!
+//! storage::save("save", &pack::compress(&pack::to_bytes(&save)));
+//! let save: Option<Save> = storage::load("save")
+//!     .and_then(|data| pack::decompress(&data))
+//!     .and_then(|bytes| pack::from_bytes(&bytes));
+//! ```
+//!
+//! [`compress`] is the LZ4 block format behind a varint of the uncompressed length: fast
+//! enough to run every save, and good at the repetition in tile maps and zeroed buffers. The
+//! encoding carries no field names or types; a changed layout needs its own version handling.
+
+use alloc::{string::String, vec, vec::Vec};
+
+/// Shortest match LZ4 encodes.
+const MIN_MATCH: usize = 4;
+/// The last this many bytes are always literals.
+const LAST_LITERALS: usize = 5;
+/// No match starts within this many bytes of the end.
+const MATCH_FIND_LIMIT: usize = 12;
+/// Farthest back a match can point.
+const MAX_OFFSET: usize = 65535;
+const HASH_BITS: u32 = 12;
+
+/// Writes LEB128 `value` to `out`.
+pub fn write_varint(out: &mut Vec<u8>, mut value: u64) {
+    while value >= 0x80 {
+        out.push(value as u8 | 0x80);
+        value >>= 7;
+    }
+    out.push(value as u8);
+}
+
+/// Reads a LEB128 value from the start of `data`, returning it and the bytes it took.
+pub fn read_varint(data: &[u8]) -> Option<(u64, usize)> {
+    let mut value = 0u64;
+    for (i, &byte) in data.iter().enumerate().take(10) {
+        value |= ((byte & 0x7F) as u64) << (7 * i);
+        if byte & 0x80 == 0 {
+            return Some((value, i + 1));
+        }
+    }
+    None
+}
+
+fn zigzag(value: i64) -> u64 {
+    ((value << 1) ^ (value >> 63)) as u64
+}
+
+fn unzigzag(value: u64) -> i64 {
+    (value >> 1) as i64 ^ -((value & 1) as i64)
+}
+
+/// Builds a byte buffer of packed values.
+#[derive(Clone, Debug, Default)]
+pub struct Writer {
+    bytes: Vec<u8>,
+}
+
+impl Writer {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// The bytes written so far.
+    pub fn finish(self) -> Vec<u8> {
+        self.bytes
+    }
+
+    pub fn u8(&mut self, value: u8) -> &mut Self {
+        self.bytes.push(value);
+        self
+    }
+
+    pub fn u64(&mut self, value: u64) -> &mut Self {
+        write_varint(&mut self.bytes, value);
+        self
+    }
+
+    pub fn i64(&mut self, value: i64) -> &mut Self {
+        self.u64(zigzag(value))
+    }
+
+    pub fn u32(&mut self, value: u32) -> &mut Self {
+        self.u64(value as u64)
+    }
+
+    pub fn i32(&mut self, value: i32) -> &mut Self {
+        self.i64(value as i64)
+    }
+
+    pub fn bool(&mut self, value: bool) -> &mut Self {
+        self.u8(value as u8)
+    }
+
+    pub fn f32(&mut self, value: f32) -> &mut Self {
+        self.bytes.extend_from_slice(&value.to_le_bytes());
+        self
+    }
+
+    pub fn f64(&mut self, value: f64) -> &mut Self {
+        self.bytes.extend_from_slice(&value.to_le_bytes());
+        self
+    }
+
+    /// Length-prefixed bytes.
+    pub fn bytes(&mut self, value: &[u8]) -> &mut Self {
+        self.u64(value.len() as u64);
+        self.bytes.extend_from_slice(value);
+        self
+    }
+
+    pub fn str(&mut self, value: &str) -> &mut Self {
+        self.bytes(value.as_bytes())
+    }
+
+    pub fn put<T: Pack>(&mut self, value: &T) -> &mut Self {
+        value.pack(self);
+        self
+    }
+}
+
+/// Reads packed values back in the order they were written. Every read returns `None` once the
+/// data runs out or doesn't fit the type.
+#[derive(Clone, Debug)]
+pub struct Reader<'a> {
+    data: &'a [u8],
+    pos: usize,
+}
+
+impl<'a> Reader<'a> {
+    pub fn new(data: &'a [u8]) -> Self {
+        Self { data, pos: 0 }
+    }
+
+    /// Bytes not read yet.
+    pub fn remaining(&self) -> usize {
+        self.data.len() - self.pos
+    }
+
+    fn take(&mut self, len: usize) -> Option<&'a [u8]> {
+        let bytes = self.data.get(self.pos..self.pos.checked_add(len)?)?;
+        self.pos += len;
+        Some(bytes)
+    }
+
+    pub fn u8(&mut self) -> Option<u8> {
+        Some(self.take(1)?[0])
+    }
+
+    pub fn u64(&mut self) -> Option<u64> {
+        let (value, len) = read_varint(&self.data[self.pos..])?;
+        self.pos += len;
+        Some(value)
+    }
+
+    pub fn i64(&mut self) -> Option<i64> {
+        self.u64().map(unzigzag)
+    }
+
+    pub fn u32(&mut self) -> Option<u32> {
+        self.u64()?.try_into().ok()
+    }
+
+    pub fn i32(&mut self) -> Option<i32> {
+        self.i64()?.try_into().ok()
+    }
+
+    pub fn bool(&mut self) -> Option<bool> {
+        match self.u8()? {
+            0 => Some(false),
+            1 => Some(true),
+            _ => None,
+        }
+    }
+
+    pub fn f32(&mut self) -> Option<f32> {
+        Some(f32::from_le_bytes(self.take(4)?.try_into().ok()?))
+    }
+
+    pub fn f64(&mut self) -> Option<f64> {
+        Some(f64::from_le_bytes(self.take(8)?.try_into().ok()?))
+    }
+
+    /// Length-prefixed bytes, borrowed from the data.
+    pub fn bytes(&mut self) -> Option<&'a [u8]> {
+        let len = self.u64()?;
+        self.take(len.try_into().ok()?)
+    }
+
+    pub fn str(&mut self) -> Option<&'a str> {
+        core::str::from_utf8(self.bytes()?).ok()
+    }
+
+    pub fn get<T: Pack>(&mut self) -> Option<T> {
+        T::unpack(self)
+    }
+}
+
+/// A value with a packed encoding. Implemented for integers, floats, `bool`, `String`, and
+/// `Vec`s, `Option`s and tuples of packable values; [`pack_struct!`](crate::pack_struct)
+/// implements it for a struct.
+pub trait Pack: Sized {
+    fn pack(&self, w: &mut Writer);
+    fn unpack(r: &mut Reader<'_>) -> Option<Self>;
+}
+
+macro_rules! pack_via {
+    ($($ty:ty => $write:ident, $read:ident;)*) => {
+        $(
+            impl Pack for $ty {
+                fn pack(&self, w: &mut Writer) {
+                    w.$write((*self).into());
+                }
+                fn unpack(r: &mut Reader<'_>) -> Option<Self> {
+                    r.$read()?.try_into().ok()
+                }
+            }
+        )*
+    };
+}
+
+pack_via! {
+    u8 => u8, u8;
+    u16 => u64, u64;
+    u32 => u64, u64;
+    u64 => u64, u64;
+    i8 => i64, i64;
+    i16 => i64, i64;
+    i32 => i64, i64;
+    i64 => i64, i64;
+    bool => bool, bool;
+    f32 => f32, f32;
+    f64 => f64, f64;
+}
+
+impl Pack for String {
+    fn pack(&self, w: &mut Writer) {
+        w.str(self);
+    }
+    fn unpack(r: &mut Reader<'_>) -> Option<Self> {
+        r.str().map(String::from)
+    }
+}
+
+impl<T: Pack> Pack for Vec<T> {
+    fn pack(&self, w: &mut Writer) {
+        w.u64(self.len() as u64);
+        for item in self {
+            item.pack(w);
+        }
+    }
+    fn unpack(r: &mut Reader<'_>) -> Option<Self> {
+        let len = r.u64()?;
+        // Every item takes at least a byte, so a corrupt length can't reserve too much.
+        if len > r.remaining() as u64 {
+            return None;
+        }
+        (0..len).map(|_| T::unpack(r)).collect()
+    }
+}
+
+impl<T: Pack> Pack for Option<T> {
+    fn pack(&self, w: &mut Writer) {
+        w.bool(self.is_some());
+        if let Some(value) = self {
+            value.pack(w);
+        }
+    }
+    fn unpack(r: &mut Reader<'_>) -> Option<Self> {
+        match r.bool()? {
+            true => T::unpack(r).map(Some),
+            false => Some(None),
+        }
+    }
+}
+
+impl<A: Pack, B: Pack> Pack for (A, B) {
+    fn pack(&self, w: &mut Writer) {
+        self.0.pack(w);
+        self.1.pack(w);
+    }
+    fn unpack(r: &mut Reader<'_>) -> Option<Self> {
+        Some((A::unpack(r)?, B::unpack(r)?))
+    }
+}
+
+impl<A: Pack, B: Pack, C: Pack> Pack for (A, B, C) {
+    fn pack(&self, w: &mut Writer) {
+        self.0.pack(w);
+        self.1.pack(w);
+        self.2.pack(w);
+    }
+    fn unpack(r: &mut Reader<'_>) -> Option<Self> {
+        Some((A::unpack(r)?, B::unpack(r)?, C::unpack(r)?))
+    }
+}
+
+/// Implement [`Pack`](crate::pack::Pack) for a struct by packing the listed fields in order.
+/// Every field must be listed and itself implement `Pack`.
+///
+/// ```ignore
+/// struct Level { width: u32, tiles: Vec<u8> }
+/// wasm96_sdk::pack_struct!(Level { width, tiles });
+/// ```
+#[macro_export]
+macro_rules! pack_struct {
+    ($ty:ty { $($field:ident),* $(,)? }) => {
+        impl $crate::pack::Pack for $ty {
+            fn pack(&self, w: &mut $crate::pack::Writer) {
+                $( $crate::pack::Pack::pack(&self.$field, w); )*
+            }
+            fn unpack(r: &mut $crate::pack::Reader<'_>) -> Option<Self> {
+                Some(Self {
+                    $( $field: $crate::pack::Pack::unpack(r)?, )*
+                })
+            }
+        }
+    };
+}
+
+/// `value` packed on its own.
+pub fn to_bytes<T: Pack>(value: &T) -> Vec<u8> {
+    let mut w = Writer::new();
+    value.pack(&mut w);
+    w.finish()
+}
+
+/// A value packed by [`to_bytes`]; `None` if it doesn't decode or leaves bytes over.
+pub fn from_bytes<T: Pack>(data: &[u8]) -> Option<T> {
+    let mut r = Reader::new(data);
+    let value = T::unpack(&mut r)?;
+    (r.remaining() == 0).then_some(value)
+}
+
+fn read_u32(data: &[u8], at: usize) -> u32 {
+    u32::from_le_bytes([data[at], data[at + 1], data[at + 2], data[at + 3]])
+}
+
+/// An LZ4 extra-length run: 255s, then the rest.
+fn write_length(out: &mut Vec<u8>, mut len: usize) {
+    while len >= 255 {
+        out.push(255);
+        len -= 255;
+    }
+    out.push(len as u8);
+}
+
+/// One LZ4 sequence: `literals`, then a match of `len` bytes `offset` back (none for the last).
+fn write_sequence(out: &mut Vec<u8>, literals: &[u8], matched: Option<(usize, usize)>) {
+    let extra = matched.map_or(0, |(_, len)| len - MIN_MATCH);
+    out.push((literals.len().min(15) << 4 | extra.min(15)) as u8);
+    if literals.len() >= 15 {
+        write_length(out, literals.len() - 15);
+    }
+    out.extend_from_slice(literals);
+    if let Some((offset, _)) = matched {
+        out.extend_from_slice(&(offset as u16).to_le_bytes());
+        if extra >= 15 {
+            write_length(out, extra - 15);
+        }
+    }
+}
+
+/// LZ4-compress `data`: a varint of its length, then one LZ4 block.
+pub fn compress(data: &[u8]) -> Vec<u8> {
+    let mut out = Vec::with_capacity(data.len() / 2 + 16);
+    write_varint(&mut out, data.len() as u64);
+
+    // Position + 1 of the last 4 bytes seen with each hash (0 = none).
+    let mut table = vec![0u32; 1 << HASH_BITS];
+    let mut anchor = 0;
+    let mut i = 0;
+    let match_end = data.len().saturating_sub(LAST_LITERALS);
+    while i + MATCH_FIND_LIMIT < data.len() {
+        let seq = read_u32(data, i);
+        let h = (seq.wrapping_mul(2_654_435_761) >> (32 - HASH_BITS)) as usize;
+        let candidate = core::mem::replace(&mut table[h], i as u32 + 1) as usize;
+        if candidate == 0
+            || i - (candidate - 1) > MAX_OFFSET
+            || read_u32(data, candidate - 1) != seq
+        {
+            i += 1;
+            continue;
+        }
+        let from = candidate - 1;
+        let mut len = MIN_MATCH;
+        while i + len < match_end && data[from + len] == data[i + len] {
+            len += 1;
+        }
+        write_sequence(&mut out, &data[anchor..i], Some((i - from, len)));
+        i += len;
+        anchor = i;
+    }
+    write_sequence(&mut out, &data[anchor..], None);
+    out
+}
+
+/// Read an LZ4 extra length at `*p`.
+fn read_length(data: &[u8], p: &mut usize) -> Option<usize> {
+    let mut len = 0usize;
+    loop {
+        let byte = *data.get(*p)?;
+        *p += 1;
+        len = len.checked_add(byte as usize)?;
+        if byte != 255 {
+            return Some(len);
+        }
+    }
+}
+
+/// Undo [`compress`]. `None` if `data` is corrupt or cut short.
+pub fn decompress(data: &[u8]) -> Option<Vec<u8>> {
+    let (size, mut p) = read_varint(data)?;
+    // LZ4 can't expand a byte into more than 255, so a larger size is corrupt.
+    if size > (data.len() as u64).saturating_mul(255) {
+        return None;
+    }
+    let size = usize::try_from(size).ok()?;
+    let mut out = Vec::with_capacity(size);
+    loop {
+        let token = *data.get(p)?;
+        p += 1;
+        let mut literals = (token >> 4) as usize;
+        if literals == 15 {
+            literals += read_length(data, &mut p)?;
+        }
+        let end = p.checked_add(literals)?;
+        if out.len() + literals > size {
+            return None;
+        }
+        out.extend_from_slice(data.get(p..end)?);
+        p = end;
+        if p == data.len() {
+            break;
+        }
+
+        let offset = u16::from_le_bytes([*data.get(p)?, *data.get(p + 1)?]) as usize;
+        p += 2;
+        let mut len = (token & 15) as usize;
+        if len == 15 {
+            len += read_length(data, &mut p)?;
+        }
+        len += MIN_MATCH;
+        if offset == 0 || offset > out.len() || out.len() + len > size {
+            return None;
+        }
+        // Byte by byte: the match may overlap what it's copying.
+        let start = out.len() - offset;
+        for k in 0..len {
+            out.push(out[start + k]);
+        }
+    }
+    (out.len() == size).then_some(out)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloc::string::ToString;
+
+    #[derive(Debug, PartialEq)]
+    struct Save {
+        level: u32,
+        score: i64,
+        name: String,
+        best: Option<f32>,
+        unlocked: Vec<bool>,
+        spawn: (i16, i16),
+    }
+    crate::pack_struct!(Save {
+        level,
+        score,
+        name,
+        best,
+        unlocked,
+        spawn,
+    });
+
+    #[test]
+    fn varints_are_short_for_small_values() {
+        let mut w = Writer::new();
+        w.u32(5).i32(-1).u64(300).i64(i64::MIN);
+        let bytes = w.finish();
+        assert_eq!(&bytes[..4], [5, 1, 0xAC, 0x02]);
+        let mut r = Reader::new(&bytes);
+        assert_eq!(r.u32(), Some(5));
+        assert_eq!(r.i32(), Some(-1));
+        assert_eq!(r.u64(), Some(300));
+        assert_eq!(r.i64(), Some(i64::MIN));
+        assert_eq!(r.u8(), None);
+    }
+
+    #[test]
+    fn structs_round_trip() {
+        let save = Save {
+            level: 3,
+            score: -120,
+            name: "Ada".to_string(),
+            best: Some(41.5),
+            unlocked: vec![true, false, true],
+            spawn: (-4, 200),
+        };
+        let bytes = to_bytes(&save);
+        assert_eq!(from_bytes::<Save>(&bytes), Some(save));
+        assert_eq!(from_bytes::<Save>(&bytes[..bytes.len() - 1]), None);
+        assert_eq!(from_bytes::<u8>(&[1, 2]), None);
+        // A huge list length in corrupt data is refused before allocating.
+        assert_eq!(from_bytes::<Vec<u8>>(&[0xFF, 0xFF, 0xFF, 0x0F]), None);
+    }
+
+    #[test]
+    fn compression_round_trips() {
+        let mut level = vec![0u8; 4000];
+        for (i, tile) in level.iter_mut().enumerate().skip(1000).take(500) {
+            *tile = (i % 7) as u8;
+        }
+        level.extend(b"the end, the end, the end.");
+        let packed = compress(&level);
+        assert!(packed.len() < level.len() / 10, "{}", packed.len());
+        assert_eq!(decompress(&packed).as_deref(), Some(&level[..]));
+
+        for data in [&b""[..], b"tiny", b"abcdefghijklmnopqrstuvwxyz0123456789"] {
+            assert_eq!(decompress(&compress(data)).as_deref(), Some(data));
+        }
+    }
+
+    #[test]
+    fn corrupt_data_is_refused() {
+        let packed = compress(&[9u8; 1000]);
+        assert_eq!(decompress(&packed[..packed.len() - 1]), None);
+        let mut bad_offset = packed.clone();
+        // The first match's offset follows the length, the token and one literal.
+        bad_offset[4..6].copy_from_slice(&[0, 0]);
+        assert_eq!(decompress(&bad_offset), None);
+        assert_eq!(decompress(&[0xFF, 0xFF, 0xFF, 0xFF, 0x0F, 0]), None);
+    }
+}
@@ -0,0 +1,247 @@
+//! QOI ("Quite OK Image") encoding and decoding, entirely in the guest.
+//!
+//! QOI compresses RGBA pixels about as well as PNG at a fraction of the code and time, which
+//! makes it a good fit for pixels a cart makes itself: generated textures, in-guest
+//! screenshots, or level thumbnails kept in [`crate::storage`]. Pixels are RGBA8888, the format
+//! of [`graphics::image`](crate::graphics::image) and
+//! [`graphics::framebuffer_read`](crate::graphics::framebuffer_read):
+//!
+//! ```ignore
+//! // Save a thumbnail of the screen...
+//! let pixels = graphics::framebuffer_read(0, 0, 320, 240);
+//! storage::save("thumb", &qoi::encode(320, 240, &pixels).unwrap());
+//!
+//! // ...and draw it back later.
+//! if let Some(thumb) = storage::load("thumb").and_then(|d| qoi::decode(&d)) {
+//!     graphics::image(8, 8, thumb.width, thumb.height, &thumb.pixels);
+//! }
+//! ```
+//!
+//! Files follow the QOI specification, so ones written by other tools decode here (RGB files
+//! come out with opaque alpha) and ones written here open elsewhere.
+
+use alloc::vec::Vec;
+
+/// Magic bytes at the start of every QOI file.
+pub const MAGIC: [u8; 4] = *b"qoif";
+/// Length of the header: magic, width, height, channels and colorspace.
+pub const HEADER_LEN: usize = 14;
+/// Largest image accepted, in pixels (as in the reference implementation).
+pub const MAX_PIXELS: u64 = 400_000_000;
+
+const END: [u8; 8] = [0, 0, 0, 0, 0, 0, 0, 1];
+
+const OP_INDEX: u8 = 0x00;
+const OP_DIFF: u8 = 0x40;
+const OP_LUMA: u8 = 0x80;
+const OP_RUN: u8 = 0xC0;
+const OP_RGB: u8 = 0xFE;
+const OP_RGBA: u8 = 0xFF;
+
+/// A decoded image: `width * height` RGBA8888 pixels, row by row from the top left.
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub struct Image {
+    pub width: u32,
+    pub height: u32,
+    pub pixels: Vec<u8>,
+}
+
+fn hash(px: [u8; 4]) -> usize {
+    let [r, g, b, a] = px.map(usize::from);
+    (r * 3 + g * 5 + b * 7 + a * 11) % 64
+}
+
+/// The width and height in a QOI header, without decoding the pixels.
+pub fn size(data: &[u8]) -> Option<(u32, u32)> {
+    if data.len() < HEADER_LEN || data[..4] != MAGIC {
+        return None;
+    }
+    let width = u32::from_be_bytes(data[4..8].try_into().ok()?);
+    let height = u32::from_be_bytes(data[8..12].try_into().ok()?);
+    Some((width, height))
+}
+
+/// Encode `width * height` RGBA8888 `pixels` as a QOI file. `None` if the size is zero, too
+/// large, or doesn't match `pixels`.
+pub fn encode(width: u32, height: u32, pixels: &[u8]) -> Option<Vec<u8>> {
+    let count = width as u64 * height as u64;
+    if count == 0 || count > MAX_PIXELS || pixels.len() as u64 != count * 4 {
+        return None;
+    }
+    let mut out = Vec::with_capacity(HEADER_LEN + pixels.len() / 2 + END.len());
+    out.extend_from_slice(&MAGIC);
+    out.extend_from_slice(&width.to_be_bytes());
+    out.extend_from_slice(&height.to_be_bytes());
+    // Four channels, sRGB with linear alpha.
+    out.extend_from_slice(&[4, 0]);
+
+    let mut index = [[0u8; 4]; 64];
+    let mut prev = [0, 0, 0, 255];
+    let mut run = 0u8;
+    let last = pixels.len() / 4 - 1;
+    for (i, px) in pixels.chunks_exact(4).enumerate() {
+        let px = [px[0], px[1], px[2], px[3]];
+        if px == prev {
+            run += 1;
+            if run == 62 || i == last {
+                out.push(OP_RUN | (run - 1));
+                run = 0;
+            }
+            continue;
+        }
+        if run > 0 {
+            out.push(OP_RUN | (run - 1));
+            run = 0;
+        }
+        let h = hash(px);
+        if index[h] == px {
+            out.push(OP_INDEX | h as u8);
+        } else {
+            index[h] = px;
+            if px[3] == prev[3] {
+                let dr = px[0].wrapping_sub(prev[0]) as i8;
+                let dg = px[1].wrapping_sub(prev[1]) as i8;
+                let db = px[2].wrapping_sub(prev[2]) as i8;
+                let (dr_dg, db_dg) = (dr.wrapping_sub(dg), db.wrapping_sub(dg));
+                if (-2..=1).contains(&dr) && (-2..=1).contains(&dg) && (-2..=1).contains(&db) {
+                    out.push(
+                        OP_DIFF | ((dr + 2) as u8) << 4 | ((dg + 2) as u8) << 2 | (db + 2) as u8,
+                    );
+                } else if (-32..=31).contains(&dg)
+                    && (-8..=7).contains(&dr_dg)
+                    && (-8..=7).contains(&db_dg)
+                {
+                    out.push(OP_LUMA | (dg + 32) as u8);
+                    out.push(((dr_dg + 8) as u8) << 4 | (db_dg + 8) as u8);
+                } else {
+                    out.extend_from_slice(&[OP_RGB, px[0], px[1], px[2]]);
+                }
+            } else {
+                out.extend_from_slice(&[OP_RGBA, px[0], px[1], px[2], px[3]]);
+            }
+        }
+        prev = px;
+    }
+    out.extend_from_slice(&END);
+    Some(out)
+}
+
+/// Decode a QOI file to RGBA8888 pixels. `None` if it isn't QOI, is larger than
+/// [`MAX_PIXELS`], or is cut short.
+pub fn decode(data: &[u8]) -> Option<Image> {
+    let (width, height) = size(data)?;
+    let count = width as u64 * height as u64;
+    let channels = data[12];
+    if count == 0 || count > MAX_PIXELS || !(3..=4).contains(&channels) || data[13] > 1 {
+        return None;
+    }
+    let body = data.get(HEADER_LEN..data.len().checked_sub(END.len())?)?;
+
+    let mut pixels = Vec::with_capacity(count as usize * 4);
+    let mut index = [[0u8; 4]; 64];
+    let mut px = [0, 0, 0, 255];
+    let mut run = 0u8;
+    let mut p = 0;
+    for _ in 0..count {
+        if run > 0 {
+            run -= 1;
+        } else {
+            let op = *body.get(p)?;
+            p += 1;
+            match op {
+                OP_RGB => {
+                    px[..3].copy_from_slice(body.get(p..p + 3)?);
+                    p += 3;
+                }
+                OP_RGBA => {
+                    px.copy_from_slice(body.get(p..p + 4)?);
+                    p += 4;
+                }
+                _ => match op & 0xC0 {
+                    OP_INDEX => px = index[op as usize],
+                    OP_DIFF => {
+                        px[0] = px[0].wrapping_add((op >> 4 & 3).wrapping_sub(2));
+                        px[1] = px[1].wrapping_add((op >> 2 & 3).wrapping_sub(2));
+                        px[2] = px[2].wrapping_add((op & 3).wrapping_sub(2));
+                    }
+                    OP_LUMA => {
+                        let second = *body.get(p)?;
+                        p += 1;
+                        let dg = (op & 0x3F).wrapping_sub(32);
+                        px[0] = px[0].wrapping_add(dg.wrapping_sub(8).wrapping_add(second >> 4));
+                        px[1] = px[1].wrapping_add(dg);
+                        px[2] = px[2].wrapping_add(dg.wrapping_sub(8).wrapping_add(second & 15));
+                    }
+                    _ => run = op & 0x3F,
+                },
+            }
+            index[hash(px)] = px;
+        }
+        pixels.extend_from_slice(&px);
+    }
+    Some(Image {
+        width,
+        height,
+        pixels,
+    })
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    /// A gradient with runs, repeats, small steps and alpha changes, to hit every op.
+    fn sample(width: u32, height: u32) -> Vec<u8> {
+        let mut pixels = Vec::new();
+        for y in 0..height {
+            for x in 0..width {
+                let px = match x % 8 {
+                    0..=2 => [10, 20, 30, 255],
+                    3 => [(x * 3) as u8, (y * 5) as u8, 200, 255],
+                    4 => [(x * 3 + 1) as u8, (y * 5 + 1) as u8, 199, 255],
+                    5 => [(x * 3 + 20) as u8, (y * 5 + 25) as u8, 210, 255],
+                    6 => [x as u8, 255 - y as u8, 77, 128],
+                    _ => [10, 20, 30, 255],
+                };
+                pixels.extend_from_slice(&px);
+            }
+        }
+        pixels
+    }
+
+    #[test]
+    fn round_trips_and_compresses() {
+        let pixels = sample(37, 21);
+        let encoded = encode(37, 21, &pixels).unwrap();
+        assert_eq!(size(&encoded), Some((37, 21)));
+        assert!(encoded.len() < pixels.len());
+        let image = decode(&encoded).unwrap();
+        assert_eq!((image.width, image.height), (37, 21));
+        assert_eq!(image.pixels, pixels);
+
+        // Runs longer than 62 pixels are split.
+        let flat = [7u8, 7, 7, 255].repeat(200);
+        assert_eq!(
+            decode(&encode(200, 1, &flat).unwrap()).unwrap().pixels,
+            flat
+        );
+    }
+
+    #[test]
+    fn decodes_rgb_files() {
+        // 2x1, three channels: an RGB op, then a run of one.
+        let mut file = b"qoif\0\0\0\x02\0\0\0\x01\x03\0".to_vec();
+        file.extend_from_slice(&[OP_RGB, 1, 2, 3, OP_RUN]);
+        file.extend_from_slice(&END);
+        assert_eq!(decode(&file).unwrap().pixels, [1, 2, 3, 255, 1, 2, 3, 255]);
+    }
+
+    #[test]
+    fn rejects_bad_input() {
+        assert!(encode(0, 4, &[]).is_none());
+        assert!(encode(2, 2, &[0; 15]).is_none());
+        let encoded = encode(37, 21, &sample(37, 21)).unwrap();
+        assert!(decode(&encoded[..encoded.len() / 2]).is_none());
+        assert!(decode(b"\x89PNG\r\n\x1a\n").is_none());
+    }
+}
@@ -0,0 +1,256 @@
+//! Typed handles for registered SVGs, GIFs and fonts.
+//!
+//! The `graphics::*_register` functions return a bare `bool`; the loaders here return a handle
+//! on success and a [`ResourceError`] saying why on failure, so a corrupt asset is caught where
+//! it's loaded instead of silently drawing nothing:
+//!
+//! ```ignore
+//! let logo = SvgHandle::load("logo", LOGO_SVG)?;
+//! let (w, h) = logo.size();
+//! logo.draw(10, 10, w, h);
+//! logo.close();
+//! ```
+//!
+//! Handles are small `Copy` values naming the same keyed resources as the string-key API, so the
+//! two can be mixed. `close` unregisters the resource; a closed handle draws nothing.
+
+use crate::graphics::{self, hash_key};
+use crate::{Color, FontMetrics, TextSize, sys};
+
+/// Why the host refused to register a resource.
+#[derive(Copy, Clone, Debug, PartialEq, Eq)]
+pub enum ResourceError {
+    /// The data isn't readable guest memory.
+    Memory,
+    /// The data doesn't decode as the expected format.
+    Invalid,
+    /// A resource it depends on (e.g. a BMFont atlas) isn't registered.
+    Missing,
+    /// The request isn't supported (e.g. an unknown built-in font size).
+    Unsupported,
+    /// An error code this SDK doesn't know.
+    Other(u32),
+}
+
+impl ResourceError {
+    /// Map a host error code (see `graphics_last_error`) to an error.
+    pub const fn from_code(code: u32) -> Self {
+        match code {
+            1 => ResourceError::Memory,
+            2 => ResourceError::Invalid,
+            3 => ResourceError::Missing,
+            4 => ResourceError::Unsupported,
+            other => ResourceError::Other(other),
+        }
+    }
+
+    /// The error behind the most recent failed registration.
+    pub fn last() -> Self {
+        Self::from_code(unsafe { sys::graphics_last_error() })
+    }
+}
+
+impl core::fmt::Display for ResourceError {
+    fn fmt(&self, f: &mut core::fmt::Formatter<'_>) -> core::fmt::Result {
+        match self {
+            ResourceError::Memory => f.write_str("resource data is outside guest memory"),
+            ResourceError::Invalid => f.write_str("resource data is invalid"),
+            ResourceError::Missing => f.write_str("a required resource isn't registered"),
+            ResourceError::Unsupported => f.write_str("resource request isn't supported"),
+            ResourceError::Other(code) => write!(f, "resource error {code}"),
+        }
+    }
+}
+
+/// Turn a register call's `bool` into a handle or the host's reason for failing.
+fn registered<T>(ok: bool, handle: T) -> Result<T, ResourceError> {
+    if ok {
+        Ok(handle)
+    } else {
+        Err(ResourceError::last())
+    }
+}
+
+/// A registered SVG.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, Hash)]
+pub struct SvgHandle(u64);
+
+impl SvgHandle {
+    /// Register SVG markup under `key`.
+    pub fn load(key: &str, svg: &[u8]) -> Result<Self, ResourceError> {
+        registered(graphics::svg_register(key, svg), SvgHandle(hash_key(key)))
+    }
+
+    /// Draw scaled to `w`x`h`.
+    pub fn draw(self, x: i32, y: i32, w: u32, h: u32) {
+        unsafe { sys::graphics_svg_draw_key(self.0, x, y, w, h) }
+    }
+
+    /// Intrinsic (width, height) in pixels.
+    pub fn size(self) -> (u32, u32) {
+        let packed = unsafe { sys::graphics_svg_size(self.0) };
+        ((packed >> 32) as u32, packed as u32)
+    }
+
+    /// Recolor matching elements; see [`graphics::svg_set_fill`].
+    pub fn set_fill(self, selector: &str, color: Color) -> u32 {
+        unsafe {
+            sys::graphics_svg_set_fill(
+                self.0,
+                selector.as_ptr(),
+                selector.len() as u32,
+                color.to_u32(),
+            )
+        }
+    }
+
+    /// Unregister the SVG.
+    pub fn close(self) {
+        unsafe { sys::graphics_svg_unregister(self.0) }
+    }
+}
+
+/// A registered animated GIF.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, Hash)]
+pub struct GifHandle(u64);
+
+impl GifHandle {
+    /// Decode and register a GIF under `key`.
+    pub fn load(key: &str, gif: &[u8]) -> Result<Self, ResourceError> {
+        registered(graphics::gif_register(key, gif), GifHandle(hash_key(key)))
+    }
+
+    /// Draw the current frame at natural size.
+    pub fn draw(self, x: i32, y: i32) {
+        unsafe { sys::graphics_gif_draw_key(self.0, x, y) }
+    }
+
+    /// Draw the current frame scaled to `w`x`h`.
+    pub fn draw_scaled(self, x: i32, y: i32, w: u32, h: u32) {
+        unsafe { sys::graphics_gif_draw_key_scaled(self.0, x, y, w, h) }
+    }
+
+    pub fn frame_count(self) -> u32 {
+        unsafe { sys::graphics_gif_frame_count(self.0) }
+    }
+
+    /// Jump playback to the start of `frame`.
+    pub fn set_frame(self, frame: u32) {
+        unsafe { sys::graphics_gif_set_frame(self.0, frame) }
+    }
+
+    /// Scale playback speed (1 = normal, 0 = frozen).
+    pub fn set_speed(self, multiplier: f32) {
+        unsafe { sys::graphics_gif_set_speed(self.0, multiplier) }
+    }
+
+    pub fn pause(self, paused: bool) {
+        unsafe { sys::graphics_gif_pause(self.0, paused as u32) }
+    }
+
+    /// Unregister the GIF.
+    pub fn close(self) {
+        unsafe { sys::graphics_gif_unregister(self.0) }
+    }
+}
+
+/// A registered font.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, Hash)]
+pub struct FontHandle(u64);
+
+impl FontHandle {
+    /// Register a TTF/OTF font under `key`.
+    pub fn load_ttf(key: &str, data: &[u8]) -> Result<Self, ResourceError> {
+        registered(
+            graphics::font_register_ttf(key, data),
+            FontHandle(hash_key(key)),
+        )
+    }
+
+    /// Register a BDF bitmap font under `key`.
+    pub fn load_bdf(key: &str, data: &[u8]) -> Result<Self, ResourceError> {
+        registered(
+            graphics::font_register_bdf(key, data),
+            FontHandle(hash_key(key)),
+        )
+    }
+
+    /// Register an AngelCode BMFont whose page image is registered under `atlas_key`.
+    pub fn load_fnt(key: &str, fnt: &[u8], atlas_key: &str) -> Result<Self, ResourceError> {
+        let ok = graphics::font_register_fnt(key, fnt, atlas_key);
+        registered(ok, FontHandle(hash_key(key)))
+    }
+
+    /// Register a built-in Spleen size (8, 16, 24, 32 or 64) under `key`.
+    pub fn spleen(key: &str, size: u32) -> Result<Self, ResourceError> {
+        registered(
+            graphics::font_register_spleen(key, size),
+            FontHandle(hash_key(key)),
+        )
+    }
+
+    /// Draw `text` with its top-left at (x, y) in the current color.
+    pub fn text(self, x: i32, y: i32, text: &str) {
+        unsafe { sys::graphics_text_key(x, y, self.0, text.as_ptr(), text.len() as u32) }
+    }
+
+    /// Draw `text` at `size_px` pixels; see [`graphics::text_sized`].
+    pub fn text_sized(self, x: i32, y: i32, size_px: u32, text: &str) {
+        unsafe {
+            sys::graphics_text_sized_key(x, y, self.0, size_px, text.as_ptr(), text.len() as u32)
+        }
+    }
+
+    pub fn measure(self, text: &str) -> TextSize {
+        let packed =
+            unsafe { sys::graphics_text_measure_key(self.0, text.as_ptr(), text.len() as u32) };
+        TextSize {
+            width: (packed >> 32) as u32,
+            height: packed as u32,
+        }
+    }
+
+    pub fn measure_sized(self, size_px: u32, text: &str) -> TextSize {
+        let packed = unsafe {
+            sys::graphics_text_measure_sized_key(self.0, size_px, text.as_ptr(), text.len() as u32)
+        };
+        TextSize {
+            width: (packed >> 32) as u32,
+            height: packed as u32,
+        }
+    }
+
+    pub fn metrics(self) -> FontMetrics {
+        let packed = unsafe { sys::graphics_font_metrics_key(self.0) };
+        FontMetrics {
+            ascent: ((packed >> 32) & 0xFFFF) as u32,
+            descent: ((packed >> 16) & 0xFFFF) as u32,
+            line_gap: (packed & 0xFFFF) as u32,
+        }
+    }
+
+    /// Draw characters this font lacks with `fallback`; see [`graphics::font_add_fallback`].
+    pub fn add_fallback(self, fallback: FontHandle) -> Result<(), ResourceError> {
+        let ok = unsafe { sys::graphics_font_add_fallback(self.0, fallback.0) } != 0;
+        registered(ok, ())
+    }
+
+    /// Unregister the font.
+    pub fn close(self) {
+        unsafe { sys::graphics_font_unregister(self.0) }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn error_codes_map_to_variants() {
+        assert_eq!(ResourceError::from_code(1), ResourceError::Memory);
+        assert_eq!(ResourceError::from_code(2), ResourceError::Invalid);
+        assert_eq!(ResourceError::from_code(3), ResourceError::Missing);
+        assert_eq!(ResourceError::from_code(4), ResourceError::Unsupported);
+        assert_eq!(ResourceError::from_code(9), ResourceError::Other(9));
+    }
+}
@@ -0,0 +1,256 @@
+//! Versioned save games on top of [`crate::storage`].
+//!
+//! A save type names its schema and current version and packs itself with [`crate::pack`].
+//! Every save is written with a small header (magic, schema name, version) ahead of the
+//! LZ4-compressed fields. When a cart update changes the layout, bump `VERSION` and teach
+//! `migrate` to read the older payloads; saves from before the update keep loading:
+//!
+//! ```ignore
+//! struct Progress { level: u32, coins: u32, name: String }
+//! wasm96_sdk::pack_struct!(Progress { level, coins, name });
+//!
+//! impl SaveData for Progress {
+//!     const SCHEMA: &'static str = "progress";
+//!     const VERSION: u32 = 2;
+//!
+//!     // Version 1 had no name.
+//!     fn migrate(version: u32, r: &mut pack::Reader) -> Option<Self> {
+//!         match version {
+//!             1 => Some(Progress { level: r.get()?, coins: r.get()?, name: "Player".into() }),
+//!             _ => None,
+//!         }
+//!     }
+//! }
+//!
+//! save::write("slot1", &progress);
+//! match save::read::<Progress>("slot1") {
+//!     Ok(progress) => resume(progress),
+//!     Err(SaveError::Missing) => new_game(),
+//!     Err(e) => system::log(&format!("couldn't load the save: {e}")),
+//! }
+//! ```
+//!
+//! A migrated save stays in its old version in storage until it's written again.
+
+use alloc::{string::String, vec::Vec};
+
+use crate::pack::{self, Pack, Reader, Writer};
+use crate::storage;
+
+/// Magic bytes at the start of every save.
+pub const MAGIC: [u8; 4] = *b"w96s";
+
+/// A value saved with a schema name and version.
+pub trait SaveData: Pack {
+    /// Names the kind of save, so one type's data is never read as another's.
+    const SCHEMA: &'static str;
+    /// The version [`Pack`] reads and writes. Bump it when the packed layout changes.
+    const VERSION: u32;
+
+    /// Read a payload written as the older `version` (never the current one). The default
+    /// refuses every older version.
+    fn migrate(version: u32, r: &mut Reader<'_>) -> Option<Self> {
+        let _ = (version, r);
+        None
+    }
+}
+
+/// Why a save couldn't be read.
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub enum SaveError {
+    /// Nothing is saved under the key.
+    Missing,
+    /// The data isn't a save, or is damaged.
+    Corrupt,
+    /// The save holds another schema.
+    WrongSchema(String),
+    /// The save was written by a newer version of the cart.
+    TooNew(u32),
+    /// `migrate` refused the save's older version.
+    NoMigration(u32),
+}
+
+impl core::fmt::Display for SaveError {
+    fn fmt(&self, f: &mut core::fmt::Formatter<'_>) -> core::fmt::Result {
+        match self {
+            SaveError::Missing => write!(f, "no save found"),
+            SaveError::Corrupt => write!(f, "save data is corrupt"),
+            SaveError::WrongSchema(schema) => write!(f, "save holds schema `{schema}`"),
+            SaveError::TooNew(version) => write!(f, "save is from a newer version ({version})"),
+            SaveError::NoMigration(version) => {
+                write!(f, "save version {version} can't be migrated")
+            }
+        }
+    }
+}
+
+/// The schema and version at the start of a save.
+#[derive(Clone, Debug, PartialEq, Eq)]
+pub struct Header {
+    pub schema: String,
+    pub version: u32,
+}
+
+/// Split a save into its header and compressed payload.
+fn split(data: &[u8]) -> Option<(Header, &[u8])> {
+    let body = data.strip_prefix(&MAGIC[..])?;
+    let mut r = Reader::new(body);
+    let header = Header {
+        schema: r.get()?,
+        version: r.get()?,
+    };
+    Some((header, &body[body.len() - r.remaining()..]))
+}
+
+/// The header of `data`, without decoding the rest; `None` if it isn't a save.
+pub fn header(data: &[u8]) -> Option<Header> {
+    split(data).map(|(header, _)| header)
+}
+
+/// `value` as save bytes.
+pub fn encode<T: SaveData>(value: &T) -> Vec<u8> {
+    let mut w = Writer::new();
+    w.str(T::SCHEMA).u32(T::VERSION);
+    let mut out = MAGIC.to_vec();
+    out.extend(w.finish());
+    out.extend(pack::compress(&pack::to_bytes(value)));
+    out
+}
+
+/// Read save bytes as a `T`, migrating older versions.
+pub fn decode<T: SaveData>(data: &[u8]) -> Result<T, SaveError> {
+    let (header, payload) = split(data).ok_or(SaveError::Corrupt)?;
+    let payload = pack::decompress(payload).ok_or(SaveError::Corrupt)?;
+    if header.schema != T::SCHEMA {
+        return Err(SaveError::WrongSchema(header.schema));
+    }
+    if header.version > T::VERSION {
+        return Err(SaveError::TooNew(header.version));
+    }
+    if header.version == T::VERSION {
+        return pack::from_bytes(&payload).ok_or(SaveError::Corrupt);
+    }
+    let mut r = Reader::new(&payload);
+    match T::migrate(header.version, &mut r) {
+        Some(value) if r.remaining() == 0 => Ok(value),
+        Some(_) => Err(SaveError::Corrupt),
+        None => Err(SaveError::NoMigration(header.version)),
+    }
+}
+
+/// Save `value` under `key` in persistent storage.
+pub fn write<T: SaveData>(key: &str, value: &T) {
+    storage::save(key, &encode(value));
+}
+
+/// Load the save under `key` from persistent storage.
+pub fn read<T: SaveData>(key: &str) -> Result<T, SaveError> {
+    decode(&storage::load(key).ok_or(SaveError::Missing)?)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloc::string::ToString;
+
+    #[derive(Debug, PartialEq)]
+    struct Progress {
+        level: u32,
+        coins: u32,
+        name: String,
+    }
+    crate::pack_struct!(Progress { level, coins, name });
+
+    impl SaveData for Progress {
+        const SCHEMA: &'static str = "progress";
+        const VERSION: u32 = 2;
+
+        fn migrate(version: u32, r: &mut Reader<'_>) -> Option<Self> {
+            match version {
+                1 => Some(Progress {
+                    level: r.get()?,
+                    coins: r.get()?,
+                    name: "Player".to_string(),
+                }),
+                _ => None,
+            }
+        }
+    }
+
+    /// Version 1 of `Progress`, as an older cart wrote it.
+    struct ProgressV1 {
+        level: u32,
+        coins: u32,
+    }
+    crate::pack_struct!(ProgressV1 { level, coins });
+
+    impl SaveData for ProgressV1 {
+        const SCHEMA: &'static str = "progress";
+        const VERSION: u32 = 1;
+    }
+
+    struct Settings {
+        volume: u8,
+    }
+    crate::pack_struct!(Settings { volume });
+
+    impl SaveData for Settings {
+        const SCHEMA: &'static str = "settings";
+        const VERSION: u32 = 1;
+    }
+
+    fn progress() -> Progress {
+        Progress {
+            level: 4,
+            coins: 250,
+            name: "Ada".to_string(),
+        }
+    }
+
+    #[test]
+    fn round_trips_with_a_header() {
+        let data = encode(&progress());
+        assert_eq!(
+            header(&data),
+            Some(Header {
+                schema: "progress".to_string(),
+                version: 2
+            })
+        );
+        assert_eq!(decode::<Progress>(&data), Ok(progress()));
+        assert_eq!(
+            decode::<Progress>(&data[..data.len() - 1]),
+            Err(SaveError::Corrupt)
+        );
+        assert_eq!(decode::<Progress>(b"not a save"), Err(SaveError::Corrupt));
+    }
+
+    #[test]
+    fn older_versions_migrate_and_others_are_refused() {
+        let old = encode(&ProgressV1 {
+            level: 3,
+            coins: 10,
+        });
+        let migrated = decode::<Progress>(&old).unwrap();
+        assert_eq!((migrated.level, migrated.coins), (3, 10));
+        assert_eq!(migrated.name, "Player");
+
+        assert_eq!(
+            decode::<ProgressV1>(&encode(&progress())).err(),
+            Some(SaveError::TooNew(2))
+        );
+        assert_eq!(
+            decode::<Settings>(&old).err(),
+            Some(SaveError::WrongSchema("progress".to_string()))
+        );
+    }
+
+    #[cfg(all(feature = "mock", not(target_arch = "wasm32")))]
+    #[test]
+    fn reads_and_writes_storage() {
+        crate::mock::reset();
+        assert_eq!(read::<Progress>("slot1"), Err(SaveError::Missing));
+        write("slot1", &progress());
+        assert_eq!(read::<Progress>("slot1"), Ok(progress()));
+    }
+}
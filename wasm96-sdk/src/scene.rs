@@ -0,0 +1,459 @@
+//! A stack of game scenes (title, gameplay, pause menu, ...) with transitions.
+//!
+//! Implement [`Scene`] for each state and let a [`SceneManager`] drive them from the cart's
+//! `update`/`draw` exports. Scenes change the stack by returning a [`SceneCommand`] from
+//! [`Scene::update`]; the manager calls `exit`/`enter` and plays the requested [`Transition`]:
+//! the screen is covered, the stack changes, then the new scene is uncovered.
+//!
+//! ```ignore
+//! static mut SCENES: Option<SceneManager> = None;
+//!
+//! fn update() {
+//!     scenes().update(system::delta_seconds());
+//! }
+//!
+//! impl Scene for Title {
+//!     fn update(&mut self, _dt: f32) -> SceneCommand {
+//!         if input::is_button_down(0, Button::Start) {
+//!             return SceneCommand::replace(Game::new()).with(Transition::fade(Color::BLACK, 400));
+//!         }
+//!         SceneCommand::NONE
+//!     }
+//!     fn draw(&mut self) { /* ... */ }
+//! }
+//! ```
+
+use alloc::{boxed::Box, vec::Vec};
+
+use crate::{Color, graphics};
+
+/// One game state.
+pub trait Scene {
+    /// Called when the scene becomes part of the stack.
+    fn enter(&mut self) {}
+
+    /// Called when the scene leaves the stack.
+    fn exit(&mut self) {}
+
+    /// Advance the scene by `dt` seconds. Only the top scene is updated, and no scene is updated
+    /// while a transition is playing.
+    fn update(&mut self, dt: f32) -> SceneCommand {
+        let _ = dt;
+        SceneCommand::NONE
+    }
+
+    /// Render the scene.
+    fn draw(&mut self);
+
+    /// Return true to have the scene below drawn first (pause menus, dialogs).
+    fn is_overlay(&self) -> bool {
+        false
+    }
+}
+
+enum Action {
+    Push(Box<dyn Scene>),
+    Pop,
+    Replace(Box<dyn Scene>),
+}
+
+/// A change to the scene stack, optionally with a transition.
+#[must_use]
+pub struct SceneCommand {
+    action: Option<Action>,
+    transition: Transition,
+}
+
+impl SceneCommand {
+    /// Stay on the current scene.
+    pub const NONE: SceneCommand = SceneCommand {
+        action: None,
+        transition: Transition::None,
+    };
+
+    /// Put `scene` on top of the stack.
+    pub fn push(scene: impl Scene + 'static) -> Self {
+        Self::new(Action::Push(Box::new(scene)))
+    }
+
+    /// Remove the top scene, returning to the one below.
+    pub fn pop() -> Self {
+        Self::new(Action::Pop)
+    }
+
+    /// Swap the top scene for `scene`.
+    pub fn replace(scene: impl Scene + 'static) -> Self {
+        Self::new(Action::Replace(Box::new(scene)))
+    }
+
+    fn new(action: Action) -> Self {
+        Self {
+            action: Some(action),
+            transition: Transition::None,
+        }
+    }
+
+    /// Play `transition` around the change.
+    pub fn with(mut self, transition: Transition) -> Self {
+        self.transition = transition;
+        self
+    }
+}
+
+/// Edge a wipe starts from.
+#[derive(Copy, Clone, Debug, Eq, PartialEq)]
+pub enum WipeFrom {
+    Left,
+    Right,
+    Top,
+    Bottom,
+}
+
+/// How the screen is covered and uncovered around a scene change. `millis` is the total
+/// duration; the stack changes halfway through.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub enum Transition {
+    /// Change immediately.
+    None,
+    /// Fade the whole screen to `color` and back.
+    Fade { color: Color, millis: u32 },
+    /// Sweep a solid `color` panel across the screen and off the far side.
+    Wipe {
+        color: Color,
+        millis: u32,
+        from: WipeFrom,
+    },
+}
+
+impl Transition {
+    pub const fn fade(color: Color, millis: u32) -> Self {
+        Transition::Fade { color, millis }
+    }
+
+    pub const fn wipe(color: Color, millis: u32, from: WipeFrom) -> Self {
+        Transition::Wipe {
+            color,
+            millis,
+            from,
+        }
+    }
+
+    fn millis(&self) -> u32 {
+        match *self {
+            Transition::None => 0,
+            Transition::Fade { millis, .. } | Transition::Wipe { millis, .. } => millis,
+        }
+    }
+}
+
+struct Playing {
+    transition: Transition,
+    elapsed_ms: f32,
+    /// Applied at the halfway point; `None` once it has been.
+    pending: Option<Action>,
+}
+
+/// Owns the scene stack and any transition in progress.
+pub struct SceneManager {
+    stack: Vec<Box<dyn Scene>>,
+    playing: Option<Playing>,
+    width: u32,
+    height: u32,
+}
+
+impl SceneManager {
+    /// Start with `first` as the only scene. `width`/`height` are the screen size passed to
+    /// [`graphics::set_size`], which transitions need to cover the screen.
+    pub fn new(width: u32, height: u32, first: impl Scene + 'static) -> Self {
+        let mut manager = Self {
+            stack: Vec::new(),
+            playing: None,
+            width,
+            height,
+        };
+        manager.apply(Action::Push(Box::new(first)));
+        manager
+    }
+
+    /// Call after [`graphics::set_size`] if the resolution changes.
+    pub fn set_screen_size(&mut self, width: u32, height: u32) {
+        self.width = width;
+        self.height = height;
+    }
+
+    /// Push `scene` on top of the stack.
+    pub fn push(&mut self, scene: impl Scene + 'static, transition: Transition) {
+        self.run(SceneCommand::push(scene).with(transition));
+    }
+
+    /// Pop the top scene.
+    pub fn pop(&mut self, transition: Transition) {
+        self.run(SceneCommand::pop().with(transition));
+    }
+
+    /// Replace the top scene with `scene`.
+    pub fn replace(&mut self, scene: impl Scene + 'static, transition: Transition) {
+        self.run(SceneCommand::replace(scene).with(transition));
+    }
+
+    /// Carry out `command`. Commands issued while a transition is playing are dropped.
+    pub fn run(&mut self, command: SceneCommand) {
+        let Some(action) = command.action else {
+            return;
+        };
+        if self.playing.is_some() {
+            return;
+        }
+        if command.transition.millis() == 0 {
+            self.apply(action);
+        } else {
+            self.playing = Some(Playing {
+                transition: command.transition,
+                elapsed_ms: 0.0,
+                pending: Some(action),
+            });
+        }
+    }
+
+    fn apply(&mut self, action: Action) {
+        match action {
+            Action::Push(mut scene) => {
+                scene.enter();
+                self.stack.push(scene);
+            }
+            Action::Pop => {
+                if let Some(mut scene) = self.stack.pop() {
+                    scene.exit();
+                }
+            }
+            Action::Replace(mut scene) => {
+                if let Some(mut old) = self.stack.pop() {
+                    old.exit();
+                }
+                scene.enter();
+                self.stack.push(scene);
+            }
+        }
+    }
+
+    /// Number of scenes on the stack. Zero once the last one is popped.
+    pub fn len(&self) -> usize {
+        self.stack.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.stack.is_empty()
+    }
+
+    /// Whether a transition is playing.
+    pub fn is_transitioning(&self) -> bool {
+        self.playing.is_some()
+    }
+
+    /// Advance the transition, or update the top scene and carry out its command.
+    pub fn update(&mut self, dt: f32) {
+        if let Some(playing) = self.playing.as_mut() {
+            playing.elapsed_ms += dt * 1000.0;
+            let total = playing.transition.millis() as f32;
+            if playing.elapsed_ms >= total / 2.0
+                && let Some(action) = playing.pending.take()
+            {
+                self.apply(action);
+            }
+            if self.playing.as_ref().is_some_and(|p| p.elapsed_ms >= total) {
+                self.playing = None;
+            }
+            return;
+        }
+
+        let command = match self.stack.last_mut() {
+            Some(scene) => scene.update(dt),
+            None => return,
+        };
+        self.run(command);
+    }
+
+    /// Draw the visible scenes (the top one plus any it overlays), then the transition.
+    pub fn draw(&mut self) {
+        let base = self
+            .stack
+            .iter()
+            .rposition(|s| !s.is_overlay())
+            .unwrap_or(0);
+        for scene in self.stack.iter_mut().skip(base) {
+            scene.draw();
+        }
+        if let Some(playing) = &self.playing {
+            self.draw_transition(playing);
+        }
+    }
+
+    /// How much of the screen is covered, 0..=1: rising to 1 at the halfway point, then falling.
+    fn coverage(playing: &Playing) -> f32 {
+        let total = playing.transition.millis().max(1) as f32;
+        let t = (playing.elapsed_ms / total).clamp(0.0, 1.0);
+        if t < 0.5 { t * 2.0 } else { (1.0 - t) * 2.0 }
+    }
+
+    fn draw_transition(&self, playing: &Playing) {
+        let coverage = Self::coverage(playing);
+        let (w, h) = (self.width, self.height);
+        match playing.transition {
+            Transition::None => {}
+            Transition::Fade { color, .. } => {
+                // Drawing colors aren't blended, so mix the finished frame toward `color` here.
+                let mut pixels = graphics::framebuffer_read(0, 0, w, h);
+                let mix =
+                    |from: u8, to: u8| (from as f32 + (to as f32 - from as f32) * coverage) as u8;
+                for px in pixels.chunks_exact_mut(4) {
+                    px[0] = mix(px[0], color.r);
+                    px[1] = mix(px[1], color.g);
+                    px[2] = mix(px[2], color.b);
+                    px[3] = mix(px[3], 255);
+                }
+                graphics::framebuffer_write(0, 0, w, h, &pixels);
+            }
+            Transition::Wipe { color, from, .. } => {
+                // The panel enters from `from` and, after the switch, leaves through the far edge.
+                let entering = playing.pending.is_some();
+                let cw = (w as f32 * coverage) as u32;
+                let ch = (h as f32 * coverage) as u32;
+                let (x, y, rw, rh) = match (from, entering) {
+                    (WipeFrom::Left, true) | (WipeFrom::Right, false) => (0, 0, cw, h),
+                    (WipeFrom::Right, true) | (WipeFrom::Left, false) => {
+                        ((w - cw) as i32, 0, cw, h)
+                    }
+                    (WipeFrom::Top, true) | (WipeFrom::Bottom, false) => (0, 0, w, ch),
+                    (WipeFrom::Bottom, true) | (WipeFrom::Top, false) => {
+                        (0, (h - ch) as i32, w, ch)
+                    }
+                };
+                graphics::set_color(color.r, color.g, color.b, color.a);
+                graphics::rect(x, y, rw, rh);
+            }
+        }
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloc::format;
+    use alloc::rc::Rc;
+    use alloc::string::String;
+    use core::cell::RefCell;
+
+    type Log = Rc<RefCell<Vec<String>>>;
+
+    struct Named {
+        name: &'static str,
+        log: Log,
+        next: Option<fn(&Log) -> SceneCommand>,
+    }
+
+    impl Named {
+        fn new(name: &'static str, log: &Log) -> Self {
+            Self {
+                name,
+                log: log.clone(),
+                next: None,
+            }
+        }
+    }
+
+    impl Scene for Named {
+        fn enter(&mut self) {
+            self.log.borrow_mut().push(format!("enter {}", self.name));
+        }
+        fn exit(&mut self) {
+            self.log.borrow_mut().push(format!("exit {}", self.name));
+        }
+        fn update(&mut self, _dt: f32) -> SceneCommand {
+            self.log.borrow_mut().push(format!("update {}", self.name));
+            match self.next.take() {
+                Some(next) => next(&self.log),
+                None => SceneCommand::NONE,
+            }
+        }
+        fn draw(&mut self) {}
+    }
+
+    fn take(log: &Log) -> Vec<String> {
+        core::mem::take(&mut *log.borrow_mut())
+    }
+
+    #[test]
+    fn push_pop_replace_call_hooks() {
+        let log = Log::default();
+        let mut scenes = SceneManager::new(320, 240, Named::new("title", &log));
+        assert_eq!(take(&log), ["enter title"]);
+
+        scenes.push(Named::new("pause", &log), Transition::None);
+        scenes.replace(Named::new("options", &log), Transition::None);
+        assert_eq!(scenes.len(), 2);
+        assert_eq!(take(&log), ["enter pause", "exit pause", "enter options"]);
+
+        scenes.update(0.016);
+        assert_eq!(take(&log), ["update options"]);
+
+        scenes.pop(Transition::None);
+        scenes.pop(Transition::None);
+        assert!(scenes.is_empty());
+        assert_eq!(take(&log), ["exit options", "exit title"]);
+    }
+
+    #[test]
+    fn scenes_issue_commands_from_update() {
+        let log = Log::default();
+        let mut title = Named::new("title", &log);
+        title.next = Some(|log| SceneCommand::replace(Named::new("game", log)));
+        let mut scenes = SceneManager::new(320, 240, title);
+        take(&log);
+
+        scenes.update(0.016);
+        assert_eq!(take(&log), ["update title", "exit title", "enter game"]);
+    }
+
+    #[test]
+    fn transition_switches_halfway_and_freezes_updates() {
+        let log = Log::default();
+        let mut scenes = SceneManager::new(320, 240, Named::new("title", &log));
+        scenes.replace(
+            Named::new("game", &log),
+            Transition::fade(Color::BLACK, 400),
+        );
+        take(&log);
+
+        scenes.update(0.1);
+        assert!(scenes.is_transitioning());
+        assert!(take(&log).is_empty());
+
+        // Further commands are dropped mid-transition.
+        scenes.pop(Transition::None);
+        assert_eq!(scenes.len(), 1);
+
+        scenes.update(0.1);
+        assert_eq!(take(&log), ["exit title", "enter game"]);
+
+        scenes.update(0.25);
+        assert!(!scenes.is_transitioning());
+        scenes.update(0.016);
+        assert_eq!(take(&log), ["update game"]);
+    }
+
+    #[test]
+    fn coverage_peaks_at_the_switch() {
+        let at = |elapsed_ms| {
+            SceneManager::coverage(&Playing {
+                transition: Transition::fade(Color::BLACK, 400),
+                elapsed_ms,
+                pending: None,
+            })
+        };
+        assert_eq!(at(0.0), 0.0);
+        assert_eq!(at(100.0), 0.5);
+        assert_eq!(at(200.0), 1.0);
+        assert_eq!(at(300.0), 0.5);
+        assert_eq!(at(500.0), 0.0);
+    }
+}
@@ -0,0 +1,156 @@
+//! Calendar dates from the host's wall clock.
+//!
+//! [`system::unix_time`](crate::system::unix_time) and
+//! [`system::local_time_offset_minutes`](crate::system::local_time_offset_minutes) are raw
+//! numbers; [`DateTime`] breaks them into a proleptic Gregorian date and time of day without
+//! needing `std`:
+//!
+//! ```ignore
+//! let today = DateTime::now_local();
+//! if today.month == 12 && today.day == 25 {
+//!     spawn_snow();
+//! }
+//! // Same daily puzzle for everyone on the same local day.
+//! let seed = today.day_number() as u64;
+//! ```
+
+use crate::system;
+
+/// A wall-clock date and time at a fixed UTC offset.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, Hash)]
+pub struct DateTime {
+    pub year: i32,
+    /// 1..=12
+    pub month: u8,
+    /// 1..=31
+    pub day: u8,
+    /// 0..=23
+    pub hour: u8,
+    /// 0..=59
+    pub minute: u8,
+    /// 0..=59
+    pub second: u8,
+    /// Minutes east of UTC this date is expressed in.
+    pub offset_minutes: i32,
+}
+
+impl DateTime {
+    /// The date and time `unix_time` (seconds since 1970-01-01 UTC) reads as at `offset_minutes`
+    /// east of UTC.
+    pub const fn from_unix(unix_time: i64, offset_minutes: i32) -> Self {
+        let local = unix_time + offset_minutes as i64 * 60;
+        let days = local.div_euclid(86_400);
+        let secs = local.rem_euclid(86_400);
+        let (year, month, day) = civil_from_days(days);
+        DateTime {
+            year,
+            month,
+            day,
+            hour: (secs / 3600) as u8,
+            minute: (secs / 60 % 60) as u8,
+            second: (secs % 60) as u8,
+            offset_minutes,
+        }
+    }
+
+    /// Back to seconds since 1970-01-01 UTC.
+    pub const fn to_unix(&self) -> i64 {
+        self.day_number() * 86_400
+            + self.hour as i64 * 3600
+            + self.minute as i64 * 60
+            + self.second as i64
+            - self.offset_minutes as i64 * 60
+    }
+
+    /// The current time in UTC.
+    pub fn now_utc() -> Self {
+        Self::from_unix(system::unix_time(), 0)
+    }
+
+    /// The current time in the player's time zone.
+    pub fn now_local() -> Self {
+        Self::from_unix(system::unix_time(), system::local_time_offset_minutes())
+    }
+
+    /// Days from 1970-01-01 to this date (negative before it), ignoring the time of day. Handy
+    /// as a daily-challenge seed.
+    pub const fn day_number(&self) -> i64 {
+        days_from_civil(self.year, self.month, self.day)
+    }
+
+    /// Day of the week, 0 = Sunday through 6 = Saturday.
+    pub const fn weekday(&self) -> u8 {
+        // 1970-01-01 was a Thursday.
+        (self.day_number() + 4).rem_euclid(7) as u8
+    }
+
+    /// Day of the year, 1 = January 1st.
+    pub const fn day_of_year(&self) -> u16 {
+        (self.day_number() - days_from_civil(self.year, 1, 1) + 1) as u16
+    }
+}
+
+/// Days since 1970-01-01 of a proleptic Gregorian date (Howard Hinnant's algorithm).
+const fn days_from_civil(year: i32, month: u8, day: u8) -> i64 {
+    let y = (if month <= 2 { year - 1 } else { year }) as i64;
+    let era = y.div_euclid(400);
+    let yoe = y - era * 400;
+    let m = month as i64;
+    let doy = (153 * (if m > 2 { m - 3 } else { m + 9 }) + 2) / 5 + day as i64 - 1;
+    let doe = yoe * 365 + yoe / 4 - yoe / 100 + doy;
+    era * 146_097 + doe - 719_468
+}
+
+/// Inverse of [`days_from_civil`].
+const fn civil_from_days(days: i64) -> (i32, u8, u8) {
+    let z = days + 719_468;
+    let era = z.div_euclid(146_097);
+    let doe = z - era * 146_097;
+    let yoe = (doe - doe / 1460 + doe / 36_524 - doe / 146_096) / 365;
+    let doy = doe - (365 * yoe + yoe / 4 - yoe / 100);
+    let mp = (5 * doy + 2) / 153;
+    let day = (doy - (153 * mp + 2) / 5 + 1) as u8;
+    let month = (if mp < 10 { mp + 3 } else { mp - 9 }) as u8;
+    let year = yoe + era * 400 + if month <= 2 { 1 } else { 0 };
+    (year as i32, month, day)
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn breaks_unix_time_into_dates() {
+        let epoch = DateTime::from_unix(0, 0);
+        assert_eq!((epoch.year, epoch.month, epoch.day), (1970, 1, 1));
+        assert_eq!(epoch.weekday(), 4);
+
+        // 2024-02-29 23:30:15 UTC is already March 1st in UTC+1.
+        let leap = DateTime::from_unix(1_709_249_415, 0);
+        assert_eq!((leap.year, leap.month, leap.day), (2024, 2, 29));
+        assert_eq!((leap.hour, leap.minute, leap.second), (23, 30, 15));
+        assert_eq!(leap.day_of_year(), 60);
+        let cet = DateTime::from_unix(1_709_249_415, 60);
+        assert_eq!((cet.month, cet.day, cet.hour), (3, 1, 0));
+
+        let before = DateTime::from_unix(-1, 0);
+        assert_eq!((before.year, before.month, before.day), (1969, 12, 31));
+        assert_eq!(before.hour, 23);
+    }
+
+    #[test]
+    fn round_trips_through_unix_time() {
+        for t in [
+            -86_400 * 800,
+            -1,
+            0,
+            951_782_400,
+            1_709_249_415,
+            4_102_444_800,
+        ] {
+            for offset in [-480, 0, 330] {
+                assert_eq!(DateTime::from_unix(t, offset).to_unix(), t);
+            }
+        }
+    }
+}
@@ -0,0 +1,201 @@
+//! Delayed and repeating callbacks driven from the cart's `update`.
+//!
+//! Instead of comparing [`system::millis`](crate::system::millis) against saved deadlines by
+//! hand, schedule the work on a [`Timers`] and advance it once per tick:
+//!
+//! ```ignore
+//! let spawns = Rc::new(Cell::new(0));
+//! let count = spawns.clone();
+//! let wave = timers.every(2000, move || count.set(count.get() + 1));
+//! let hint = timers.after(5000, || show_hint());
+//!
+//! fn update() {
+//!     timers.update(); // advances by system::delta_millis()
+//!     if player_moved {
+//!         timers.cancel(hint);
+//!     }
+//! }
+//! ```
+//!
+//! Timers only move when `update` or [`Timers::advance`] is called, so a paused game simply
+//! stops calling it. A repeating timer fires once for every whole interval that passed, so a
+//! long tick doesn't lose beats.
+
+use alloc::{boxed::Box, vec::Vec};
+
+use crate::system;
+
+/// Identifies a scheduled timer, for [`Timers::cancel`]. Handles are never reused.
+#[derive(Copy, Clone, Debug, PartialEq, Eq, Hash)]
+pub struct TimerHandle(u32);
+
+struct Timer {
+    handle: TimerHandle,
+    /// Milliseconds until it next fires.
+    remaining: u64,
+    /// Repeat interval; `None` fires once.
+    interval: Option<u64>,
+    callback: Box<dyn FnMut()>,
+}
+
+/// A set of scheduled callbacks.
+#[derive(Default)]
+pub struct Timers {
+    timers: Vec<Timer>,
+    next: u32,
+}
+
+impl Timers {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    fn schedule(
+        &mut self,
+        delay: u64,
+        interval: Option<u64>,
+        callback: Box<dyn FnMut()>,
+    ) -> TimerHandle {
+        let handle = TimerHandle(self.next);
+        self.next = self.next.wrapping_add(1);
+        self.timers.push(Timer {
+            handle,
+            remaining: delay,
+            interval,
+            callback,
+        });
+        handle
+    }
+
+    /// Call `f` once, `ms` milliseconds from now. `0` fires on the next update.
+    pub fn after(&mut self, ms: u64, f: impl FnMut() + 'static) -> TimerHandle {
+        self.schedule(ms, None, Box::new(f))
+    }
+
+    /// Call `f` every `ms` milliseconds (at least 1) until cancelled. The first call is `ms`
+    /// from now.
+    pub fn every(&mut self, ms: u64, f: impl FnMut() + 'static) -> TimerHandle {
+        let ms = ms.max(1);
+        self.schedule(ms, Some(ms), Box::new(f))
+    }
+
+    /// Stop a timer before it fires again. Returns false if it already finished or was
+    /// cancelled.
+    pub fn cancel(&mut self, handle: TimerHandle) -> bool {
+        let before = self.timers.len();
+        self.timers.retain(|t| t.handle != handle);
+        self.timers.len() != before
+    }
+
+    /// Whether the timer will still fire.
+    pub fn is_active(&self, handle: TimerHandle) -> bool {
+        self.timers.iter().any(|t| t.handle == handle)
+    }
+
+    /// Milliseconds until the timer next fires, or `None` if it isn't active.
+    pub fn remaining(&self, handle: TimerHandle) -> Option<u64> {
+        self.timers
+            .iter()
+            .find(|t| t.handle == handle)
+            .map(|t| t.remaining)
+    }
+
+    /// Cancel every timer.
+    pub fn clear(&mut self) {
+        self.timers.clear();
+    }
+
+    pub fn len(&self) -> usize {
+        self.timers.len()
+    }
+
+    pub fn is_empty(&self) -> bool {
+        self.timers.is_empty()
+    }
+
+    /// Advance by this tick's [`system::delta_millis`] and fire what's due.
+    pub fn update(&mut self) {
+        self.advance(system::delta_millis());
+    }
+
+    /// Advance by `ms` and fire what's due, in the order the timers were scheduled.
+    pub fn advance(&mut self, ms: u64) {
+        self.timers.retain_mut(|timer| {
+            let mut elapsed = ms;
+            while elapsed >= timer.remaining {
+                elapsed -= timer.remaining;
+                (timer.callback)();
+                match timer.interval {
+                    Some(interval) => timer.remaining = interval,
+                    None => return false,
+                }
+            }
+            timer.remaining -= elapsed;
+            true
+        });
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloc::rc::Rc;
+    use core::cell::{Cell, RefCell};
+
+    #[test]
+    fn one_shot_and_repeating_timers_fire_on_time() {
+        let log = Rc::new(RefCell::new(Vec::new()));
+        let mut timers = Timers::new();
+        let l = log.clone();
+        let once = timers.after(50, move || l.borrow_mut().push("once"));
+        let l = log.clone();
+        let tick = timers.every(20, move || l.borrow_mut().push("tick"));
+
+        timers.advance(19);
+        assert!(log.borrow().is_empty());
+        assert_eq!(timers.remaining(tick), Some(1));
+        timers.advance(1);
+        assert_eq!(*log.borrow(), ["tick"]);
+        // A long step fires each whole interval it covers.
+        timers.advance(45);
+        assert_eq!(*log.borrow(), ["tick", "once", "tick", "tick"]);
+        assert!(!timers.is_active(once));
+        assert_eq!(timers.remaining(tick), Some(15));
+
+        assert!(timers.cancel(tick));
+        assert!(!timers.cancel(tick));
+        timers.advance(100);
+        assert_eq!(log.borrow().len(), 4);
+        assert!(timers.is_empty());
+    }
+
+    #[test]
+    fn zero_delay_fires_on_the_next_update() {
+        let fired = Rc::new(Cell::new(0));
+        let mut timers = Timers::new();
+        let f = fired.clone();
+        timers.after(0, move || f.set(f.get() + 1));
+        let f = fired.clone();
+        timers.every(0, move || f.set(f.get() + 10));
+        timers.advance(0);
+        assert_eq!(fired.get(), 1);
+        timers.advance(3);
+        assert_eq!(fired.get(), 31);
+    }
+
+    #[cfg(all(feature = "mock", not(target_arch = "wasm32")))]
+    #[test]
+    fn update_follows_the_host_clock() {
+        crate::mock::reset();
+        let fired = Rc::new(Cell::new(false));
+        let mut timers = Timers::new();
+        let f = fired.clone();
+        timers.after(100, move || f.set(true));
+        crate::mock::with(|host| host.advance(60));
+        timers.update();
+        assert!(!fired.get());
+        crate::mock::with(|host| host.advance(60));
+        timers.update();
+        assert!(fired.get());
+    }
+}
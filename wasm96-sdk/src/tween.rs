@@ -0,0 +1,395 @@
+//! Easing curves and time-driven tweens for UI transitions and juice.
+//!
+//! An [`Ease`] reshapes linear progress `0..=1`; a [`Tween`] animates one `f32` from a start to
+//! an end value over a duration, advanced by the frame delta; a [`Group`] plays tweens one after
+//! another or all at once:
+//!
+//! ```ignore
+//! let mut pop = Group::sequence(vec![
+//!     Tween::new(0.0, 1.2, 0.15, Ease::BackOut),
+//!     Tween::new(1.2, 1.0, 0.1, Ease::QuadIn),
+//! ]);
+//! // each tick:
+//! pop.update(system::delta_seconds());
+//! let scale = pop.value();
+//! ```
+//!
+//! To animate a position or color, tween a `0..1` progress and feed it to `Vec2::lerp` or
+//! similar. Like [`crate::math`], the curves use the SDK's own approximations, so they behave the
+//! same with and without `std`.
+
+use alloc::vec::Vec;
+use core::f32::consts::PI;
+
+use crate::math::{cos, floor, lerp, sin};
+
+/// An easing curve: maps linear progress `t` in `0..=1` to eased progress (which may overshoot
+/// for `Back` and `Elastic`).
+#[derive(Copy, Clone, Debug, Default, PartialEq, Eq, Hash)]
+pub enum Ease {
+    #[default]
+    Linear,
+    QuadIn,
+    QuadOut,
+    QuadInOut,
+    CubicIn,
+    CubicOut,
+    CubicInOut,
+    SineIn,
+    SineOut,
+    SineInOut,
+    ExpoIn,
+    ExpoOut,
+    ExpoInOut,
+    /// Pulls back before moving.
+    BackIn,
+    /// Overshoots, then settles.
+    BackOut,
+    BackInOut,
+    ElasticIn,
+    /// Springs past the end and wobbles into place.
+    ElasticOut,
+    ElasticInOut,
+    BounceIn,
+    /// Bounces against the end like a dropped ball.
+    BounceOut,
+    BounceInOut,
+}
+
+impl Ease {
+    /// Eased progress at `t` (clamped to `0..=1`). Every curve maps 0 to 0 and 1 to 1.
+    pub fn apply(self, t: f32) -> f32 {
+        let t = t.clamp(0.0, 1.0);
+        // Mirror an ease-in curve into the matching in-out curve.
+        let in_out = |f: fn(f32) -> f32| {
+            if t < 0.5 {
+                f(t * 2.0) / 2.0
+            } else {
+                1.0 - f((1.0 - t) * 2.0) / 2.0
+            }
+        };
+        match self {
+            Ease::Linear => t,
+            Ease::QuadIn => quad(t),
+            Ease::QuadOut => 1.0 - quad(1.0 - t),
+            Ease::QuadInOut => in_out(quad),
+            Ease::CubicIn => cubic(t),
+            Ease::CubicOut => 1.0 - cubic(1.0 - t),
+            Ease::CubicInOut => in_out(cubic),
+            Ease::SineIn => sine(t),
+            Ease::SineOut => 1.0 - sine(1.0 - t),
+            Ease::SineInOut => in_out(sine),
+            Ease::ExpoIn => expo(t),
+            Ease::ExpoOut => 1.0 - expo(1.0 - t),
+            Ease::ExpoInOut => in_out(expo),
+            Ease::BackIn => back(t),
+            Ease::BackOut => 1.0 - back(1.0 - t),
+            Ease::BackInOut => in_out(back),
+            Ease::ElasticIn => elastic(t),
+            Ease::ElasticOut => 1.0 - elastic(1.0 - t),
+            Ease::ElasticInOut => in_out(elastic),
+            Ease::BounceIn => 1.0 - bounce_out(1.0 - t),
+            Ease::BounceOut => bounce_out(t),
+            Ease::BounceInOut => in_out(|t| 1.0 - bounce_out(1.0 - t)),
+        }
+    }
+}
+
+fn quad(t: f32) -> f32 {
+    t * t
+}
+
+fn cubic(t: f32) -> f32 {
+    t * t * t
+}
+
+fn sine(t: f32) -> f32 {
+    1.0 - cos(t * PI / 2.0)
+}
+
+fn expo(t: f32) -> f32 {
+    if t <= 0.0 { 0.0 } else { exp2(10.0 * t - 10.0) }
+}
+
+fn back(t: f32) -> f32 {
+    const C1: f32 = 1.70158;
+    (C1 + 1.0) * t * t * t - C1 * t * t
+}
+
+fn elastic(t: f32) -> f32 {
+    if t <= 0.0 || t >= 1.0 {
+        return t;
+    }
+    -exp2(10.0 * t - 10.0) * sin((t * 10.0 - 10.75) * (2.0 * PI / 3.0))
+}
+
+fn bounce_out(t: f32) -> f32 {
+    const N: f32 = 7.5625;
+    const D: f32 = 2.75;
+    if t < 1.0 / D {
+        N * t * t
+    } else if t < 2.0 / D {
+        let t = t - 1.5 / D;
+        N * t * t + 0.75
+    } else if t < 2.5 / D {
+        let t = t - 2.25 / D;
+        N * t * t + 0.9375
+    } else {
+        let t = t - 2.625 / D;
+        N * t * t + 0.984375
+    }
+}
+
+/// `2^x`, accurate to about 1e-7 relative for the small exponents the curves use.
+fn exp2(x: f32) -> f32 {
+    if x < -126.0 {
+        return 0.0;
+    }
+    let n = floor(x);
+    let f = x - n;
+    let frac = 1.0
+        + f * (core::f32::consts::LN_2
+            + f * (0.240_226_5 + f * (0.055_504_1 + f * (0.009_618_1 + f * 0.001_333_3))));
+    frac * f32::from_bits(((n as i32 + 127) as u32) << 23)
+}
+
+/// One `f32` animated from `from` to `to` over `duration` seconds.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Tween {
+    pub from: f32,
+    pub to: f32,
+    pub duration: f32,
+    pub ease: Ease,
+    /// Seconds to hold `from` before starting.
+    pub delay: f32,
+    elapsed: f32,
+}
+
+impl Tween {
+    pub fn new(from: f32, to: f32, duration: f32, ease: Ease) -> Self {
+        Self {
+            from,
+            to,
+            duration: duration.max(0.0),
+            ease,
+            delay: 0.0,
+            elapsed: 0.0,
+        }
+    }
+
+    /// Wait `seconds` before starting (for staggering tweens in a [`Group::parallel`]).
+    pub fn with_delay(mut self, seconds: f32) -> Self {
+        self.delay = seconds.max(0.0);
+        self
+    }
+
+    /// Advance by `dt` seconds and return the new value.
+    pub fn update(&mut self, dt: f32) -> f32 {
+        self.advance(dt);
+        self.value()
+    }
+
+    /// Advance by `dt` seconds; returns the part of `dt` left over after finishing.
+    fn advance(&mut self, dt: f32) -> f32 {
+        let total = self.delay + self.duration;
+        let next = self.elapsed + dt.max(0.0);
+        self.elapsed = next.min(total);
+        next - self.elapsed
+    }
+
+    /// Linear progress `0..=1`, ignoring the ease.
+    pub fn progress(&self) -> f32 {
+        if self.duration <= 0.0 {
+            return if self.elapsed >= self.delay { 1.0 } else { 0.0 };
+        }
+        ((self.elapsed - self.delay) / self.duration).clamp(0.0, 1.0)
+    }
+
+    /// Eased progress, for driving values other than `from..to` (positions, colors).
+    pub fn eased(&self) -> f32 {
+        self.ease.apply(self.progress())
+    }
+
+    pub fn value(&self) -> f32 {
+        lerp(self.from, self.to, self.eased())
+    }
+
+    pub fn is_finished(&self) -> bool {
+        self.elapsed >= self.delay + self.duration
+    }
+
+    /// Back to the start, delay included.
+    pub fn reset(&mut self) {
+        self.elapsed = 0.0;
+    }
+}
+
+/// Several tweens played in order ([`Group::sequence`]) or together ([`Group::parallel`]).
+#[derive(Clone, Debug, PartialEq)]
+pub struct Group {
+    tweens: Vec<Tween>,
+    parallel: bool,
+    /// Index of the playing tween in a sequence.
+    current: usize,
+    looping: bool,
+}
+
+impl Group {
+    /// Play `tweens` one after another; time left over when one finishes carries into the next.
+    pub fn sequence(tweens: Vec<Tween>) -> Self {
+        Self {
+            tweens,
+            parallel: false,
+            current: 0,
+            looping: false,
+        }
+    }
+
+    /// Play `tweens` at the same time; use [`Tween::with_delay`] to stagger them.
+    pub fn parallel(tweens: Vec<Tween>) -> Self {
+        Self {
+            parallel: true,
+            ..Self::sequence(tweens)
+        }
+    }
+
+    /// Start over whenever the group finishes.
+    pub fn looping(mut self, looping: bool) -> Self {
+        self.looping = looping;
+        self
+    }
+
+    /// Advance every playing tween by `dt` seconds.
+    pub fn update(&mut self, dt: f32) {
+        let mut left = dt.max(0.0);
+        // A looping group of zero-length tweens would never use up `dt`; stop after a lap.
+        let mut laps = 0;
+        loop {
+            if self.parallel {
+                left = self
+                    .tweens
+                    .iter_mut()
+                    .map(|t| t.advance(left))
+                    .fold(left, f32::min);
+            } else {
+                while let Some(tween) = self.tweens.get_mut(self.current) {
+                    left = tween.advance(left);
+                    if !tween.is_finished() {
+                        break;
+                    }
+                    self.current += 1;
+                }
+            }
+            if !(self.looping && self.is_finished() && left > 0.0 && laps < 1) {
+                break;
+            }
+            self.reset();
+            laps += 1;
+        }
+    }
+
+    /// The tween at `index`, e.g. to read its [`Tween::value`].
+    pub fn get(&self, index: usize) -> Option<&Tween> {
+        self.tweens.get(index)
+    }
+
+    /// The value of the playing tween in a sequence (the last one once finished), or of the
+    /// first tween in a parallel group.
+    pub fn value(&self) -> f32 {
+        let index = if self.parallel {
+            0
+        } else {
+            self.current.min(self.tweens.len().saturating_sub(1))
+        };
+        self.tweens.get(index).map_or(0.0, Tween::value)
+    }
+
+    pub fn is_finished(&self) -> bool {
+        self.tweens.iter().all(Tween::is_finished)
+    }
+
+    pub fn reset(&mut self) {
+        self.tweens.iter_mut().for_each(Tween::reset);
+        self.current = 0;
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+    use alloc::vec;
+
+    const ALL: [Ease; 22] = [
+        Ease::Linear,
+        Ease::QuadIn,
+        Ease::QuadOut,
+        Ease::QuadInOut,
+        Ease::CubicIn,
+        Ease::CubicOut,
+        Ease::CubicInOut,
+        Ease::SineIn,
+        Ease::SineOut,
+        Ease::SineInOut,
+        Ease::ExpoIn,
+        Ease::ExpoOut,
+        Ease::ExpoInOut,
+        Ease::BackIn,
+        Ease::BackOut,
+        Ease::BackInOut,
+        Ease::ElasticIn,
+        Ease::ElasticOut,
+        Ease::ElasticInOut,
+        Ease::BounceIn,
+        Ease::BounceOut,
+        Ease::BounceInOut,
+    ];
+
+    #[test]
+    fn curves_hit_their_ends() {
+        for ease in ALL {
+            assert!(ease.apply(0.0).abs() < 1e-3, "{ease:?}(0)");
+            assert!((ease.apply(1.0) - 1.0).abs() < 1e-3, "{ease:?}(1)");
+        }
+        assert_eq!(Ease::QuadIn.apply(0.5), 0.25);
+        assert_eq!(Ease::QuadInOut.apply(0.25), 0.125);
+        assert!(Ease::BackOut.apply(0.6) > 1.0);
+        assert!((exp2(-3.5) - 2f32.powf(-3.5)).abs() < 1e-6);
+    }
+
+    #[test]
+    fn tween_waits_then_animates() {
+        let mut t = Tween::new(10.0, 20.0, 1.0, Ease::Linear).with_delay(0.5);
+        assert_eq!(t.update(0.25), 10.0);
+        assert_eq!(t.update(0.75), 15.0);
+        assert_eq!(t.update(5.0), 20.0);
+        assert!(t.is_finished());
+        t.reset();
+        assert_eq!(t.value(), 10.0);
+    }
+
+    #[test]
+    fn groups_sequence_and_overlap() {
+        let mut seq = Group::sequence(vec![
+            Tween::new(0.0, 1.0, 1.0, Ease::Linear),
+            Tween::new(1.0, 3.0, 1.0, Ease::Linear),
+        ]);
+        seq.update(1.5);
+        assert_eq!(seq.value(), 2.0);
+        seq.update(1.0);
+        assert!(seq.is_finished());
+        assert_eq!(seq.value(), 3.0);
+
+        let mut par = Group::parallel(vec![
+            Tween::new(0.0, 1.0, 1.0, Ease::Linear),
+            Tween::new(0.0, 1.0, 1.0, Ease::Linear).with_delay(0.5),
+        ]);
+        par.update(0.75);
+        assert_eq!(par.get(0).unwrap().value(), 0.75);
+        assert_eq!(par.get(1).unwrap().value(), 0.25);
+
+        let mut looped =
+            Group::sequence(vec![Tween::new(0.0, 1.0, 1.0, Ease::Linear)]).looping(true);
+        looped.update(1.25);
+        assert_eq!(looped.value(), 0.25);
+    }
+}
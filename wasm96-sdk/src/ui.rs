@@ -0,0 +1,513 @@
+//! Immediate-mode UI: buttons, checkboxes, sliders and text fields for options menus and
+//! editors, drawn with the ordinary graphics primitives.
+//!
+//! Widgets are functions called every frame between [`Ui::begin`] and the end of `draw`; each
+//! draws itself and reports what happened to it this frame. There is no widget tree to build or
+//! keep in sync with game state:
+//!
+//! ```ignore
+//! // in draw:
+//! ui.begin();
+//! if ui.button("Play", Rect::new(100.0, 60.0, 120.0, 20.0)) {
+//!     scenes.push(Game::new());
+//! }
+//! ui.checkbox("Fullscreen", Rect::new(100.0, 90.0, 120.0, 16.0), &mut options.fullscreen);
+//! ui.slider(&format!("Volume {}%##volume", (options.volume * 100.0) as u32),
+//!     Rect::new(100.0, 114.0, 120.0, 16.0), &mut options.volume, 0.0, 1.0);
+//! ui.text_field("Name", Rect::new(100.0, 138.0, 120.0, 16.0), &mut options.name, 12);
+//! ```
+//!
+//! The mouse clicks and drags widgets. Up and down (arrow keys, Tab or the d-pad) move focus
+//! through widgets in the order they were drawn, left and right move a focused slider, and A,
+//! Enter or Space presses the focused widget. Text fields collect typed text while editing,
+//! through [`input::text_input_start`]; Enter finishes.
+//!
+//! Widgets are told apart by their label, so labels on screen at once must differ. Text after
+//! `##` in a label is its id and isn't drawn, for labels that change (`"Volume 80%##volume"`) or
+//! repeat (`"Delete##slot2"`).
+
+use alloc::{string::String, vec::Vec};
+
+use crate::graphics::{self, hash_key};
+use crate::math::{Rect, Vec2};
+use crate::{Button, Color, input, system};
+
+// libretro key codes used for navigation.
+const KEY_TAB: u32 = 9;
+const KEY_RETURN: u32 = 13;
+const KEY_SPACE: u32 = 32;
+const KEY_UP: u32 = 273;
+const KEY_DOWN: u32 = 274;
+const KEY_RIGHT: u32 = 275;
+const KEY_LEFT: u32 = 276;
+
+/// Auto-repeat for held navigation inputs, in milliseconds.
+const REPEAT_DELAY: u32 = 300;
+const REPEAT_INTERVAL: u32 = 80;
+
+/// Left and right move a focused slider by this fraction of its range.
+const SLIDER_STEP: f32 = 1.0 / 20.0;
+
+/// Text field caret blink period, in milliseconds.
+const CARET_BLINK: u64 = 500;
+
+/// Colors and font the widgets draw with.
+#[derive(Copy, Clone, Debug, PartialEq)]
+pub struct Theme {
+    /// Font key for labels. Unregistered keys draw with the built-in Spleen 16, so registering
+    /// a font under the default `"ui"` restyles every widget.
+    pub font: &'static str,
+    pub text: Color,
+    /// Text of empty text fields.
+    pub placeholder: Color,
+    pub background: Color,
+    pub hovered: Color,
+    pub pressed: Color,
+    /// Slider fill, checkbox tick and the outline of a text field being edited.
+    pub accent: Color,
+    /// Outline of the focused widget.
+    pub focus: Color,
+    /// Space between a widget's edge and its contents, in pixels.
+    pub padding: f32,
+}
+
+impl Default for Theme {
+    fn default() -> Self {
+        Self {
+            font: "ui",
+            text: Color::WHITE,
+            placeholder: Color::rgb(140, 140, 150),
+            background: Color::rgb(48, 48, 56),
+            hovered: Color::rgb(72, 72, 84),
+            pressed: Color::rgb(32, 32, 40),
+            accent: Color::rgb(90, 160, 255),
+            focus: Color::WHITE,
+            padding: 4.0,
+        }
+    }
+}
+
+/// The input a frame of UI reacts to. [`UiInput::read`] fills it from the host; tests and
+/// carts with their own input handling can build one directly.
+#[derive(Copy, Clone, Debug, Default, PartialEq)]
+pub struct UiInput {
+    pub mouse: Vec2,
+    /// The left mouse button (or first touch) is held.
+    pub mouse_down: bool,
+    /// Move focus to the previous widget.
+    pub up: bool,
+    /// Move focus to the next widget.
+    pub down: bool,
+    /// Decrease the focused slider.
+    pub left: bool,
+    /// Increase the focused slider.
+    pub right: bool,
+    /// Press the focused widget.
+    pub activate: bool,
+}
+
+impl UiInput {
+    /// Read the mouse, the keyboard and the joypad on `port`. Held directions auto-repeat.
+    pub fn read(port: u32) -> Self {
+        let nav = |button, key| {
+            input::button_repeat(port, button, REPEAT_DELAY, REPEAT_INTERVAL)
+                || input::key_repeat(key, REPEAT_DELAY, REPEAT_INTERVAL)
+        };
+        let button_pressed = |button| {
+            input::is_button_down(port, button) && input::button_held_millis(port, button) == 0
+        };
+        let key_pressed = |key| input::is_key_down(key) && input::key_held_millis(key) == 0;
+        Self {
+            mouse: Vec2::new(input::get_mouse_x() as f32, input::get_mouse_y() as f32),
+            mouse_down: input::is_mouse_down(0),
+            up: nav(Button::Up, KEY_UP),
+            down: nav(Button::Down, KEY_DOWN)
+                || input::key_repeat(KEY_TAB, REPEAT_DELAY, REPEAT_INTERVAL),
+            left: nav(Button::Left, KEY_LEFT),
+            right: nav(Button::Right, KEY_RIGHT),
+            activate: button_pressed(Button::A)
+                || key_pressed(KEY_RETURN)
+                || key_pressed(KEY_SPACE),
+        }
+    }
+}
+
+/// Immediate-mode UI state kept between frames: focus, the widget the mouse went down on, and
+/// the text field being edited.
+#[derive(Clone, Debug, Default)]
+pub struct Ui {
+    pub theme: Theme,
+    /// Joypad port [`Ui::begin`] reads (0 by default).
+    pub port: u32,
+    input: UiInput,
+    mouse_pressed: bool,
+    mouse_released: bool,
+    focus: Option<u64>,
+    /// Focusable widgets in draw order: this frame's so far, and last frame's.
+    order: Vec<u64>,
+    last_order: Vec<u64>,
+    /// The widget the mouse button went down on, until it's released.
+    pressed_on: Option<u64>,
+    editing: Option<u64>,
+    typed: String,
+}
+
+/// The shown part and the id of a label (see the module docs).
+fn split_label(label: &str) -> (&str, u64) {
+    match label.split_once("##") {
+        Some((shown, id)) => (shown, hash_key(id)),
+        None => (label, hash_key(label)),
+    }
+}
+
+/// Focus after moving `step` widgets from `focus` through `order`, wrapping around. With
+/// nothing focused, down focuses the first widget and up the last.
+fn step_focus(order: &[u64], focus: Option<u64>, step: i32) -> Option<u64> {
+    let len = order.len() as i32;
+    if len == 0 || step == 0 {
+        return focus;
+    }
+    let next = match focus.and_then(|id| order.iter().position(|&o| o == id)) {
+        Some(i) => (i as i32 + step).rem_euclid(len),
+        None if step > 0 => 0,
+        None => len - 1,
+    };
+    Some(order[next as usize])
+}
+
+/// Apply typed text to `value`: backspace deletes, other control characters are dropped, and
+/// nothing is added past `max_chars`. Returns whether `value` changed and whether Enter was
+/// typed (anything after it is dropped).
+fn edit_text(value: &mut String, typed: &str, max_chars: usize) -> (bool, bool) {
+    let mut changed = false;
+    for c in typed.chars() {
+        match c {
+            '\u{8}' => changed |= value.pop().is_some(),
+            '\n' | '\r' => return (changed, true),
+            c if c.is_control() => {}
+            c if value.chars().count() < max_chars => {
+                value.push(c);
+                changed = true;
+            }
+            _ => {}
+        }
+    }
+    (changed, false)
+}
+
+fn fill(color: Color, r: Rect) {
+    graphics::set_color(color.r, color.g, color.b, color.a);
+    graphics::rect_of(r);
+}
+
+fn outline(color: Color, r: Rect) {
+    graphics::set_color(color.r, color.g, color.b, color.a);
+    graphics::rect_outline_of(r);
+}
+
+impl Ui {
+    pub fn new() -> Self {
+        Self::default()
+    }
+
+    /// Start a frame of UI, reading input from the host. Call once per frame before any widget.
+    pub fn begin(&mut self) {
+        let typed = if self.editing.is_some() {
+            input::get_text_input()
+        } else {
+            String::new()
+        };
+        self.begin_with(UiInput::read(self.port), &typed);
+    }
+
+    /// [`Ui::begin`] with the given input and text typed since the last frame.
+    pub fn begin_with(&mut self, frame: UiInput, typed: &str) {
+        let was_down = self.input.mouse_down;
+        if !was_down {
+            self.pressed_on = None;
+        }
+        self.mouse_pressed = frame.mouse_down && !was_down;
+        self.mouse_released = !frame.mouse_down && was_down;
+        self.input = frame;
+        self.typed.clear();
+        self.typed.push_str(typed);
+
+        self.last_order = core::mem::take(&mut self.order);
+        if self.focus.is_some_and(|id| !self.last_order.contains(&id)) {
+            self.focus = None;
+        }
+        if self.editing.is_none() {
+            let step = frame.down as i32 - frame.up as i32;
+            self.focus = step_focus(&self.last_order, self.focus, step);
+        }
+        if self.editing.is_some() && self.editing != self.focus {
+            self.stop_editing();
+        }
+    }
+
+    /// Whether a text field is collecting typed text, so the game can ignore the keyboard.
+    pub fn is_editing(&self) -> bool {
+        self.editing.is_some()
+    }
+
+    /// Focus the widget with `label` (or clear focus with `None`), e.g. the first menu item
+    /// when a gamepad menu opens.
+    pub fn set_focus(&mut self, label: Option<&str>) {
+        self.focus = label.map(|label| split_label(label).1);
+    }
+
+    fn stop_editing(&mut self) {
+        self.editing = None;
+        input::text_input_stop();
+    }
+
+    /// Register a focusable widget and return (hovered, focused, clicked).
+    fn widget(&mut self, id: u64, r: Rect) -> (bool, bool, bool) {
+        self.order.push(id);
+        let hovered = r.contains(self.input.mouse);
+        if hovered && self.mouse_pressed {
+            self.pressed_on = Some(id);
+            self.focus = Some(id);
+        }
+        let focused = self.focus == Some(id);
+        let clicked = (self.mouse_released && hovered && self.pressed_on == Some(id))
+            || (focused && self.input.activate && self.editing.is_none());
+        (hovered, focused, clicked)
+    }
+
+    fn held(&self, id: u64) -> bool {
+        self.input.mouse_down && self.pressed_on == Some(id)
+    }
+
+    fn background(&self, id: u64, hovered: bool) -> Color {
+        if self.held(id) {
+            self.theme.pressed
+        } else if hovered {
+            self.theme.hovered
+        } else {
+            self.theme.background
+        }
+    }
+
+    /// Draw `text` at `x`, centered vertically in `r`.
+    fn text_in(&self, color: Color, x: f32, r: Rect, text: &str) {
+        let size = graphics::text_measure_key(self.theme.font, text);
+        let y = r.y + (r.h - size.height as f32) / 2.0;
+        graphics::set_color(color.r, color.g, color.b, color.a);
+        graphics::text_key(x as i32, y as i32, self.theme.font, text);
+    }
+
+    /// Draw `text` with its top left at (`x`, `y`), in the theme's font and text color.
+    pub fn label(&self, x: f32, y: f32, text: &str) {
+        let color = self.theme.text;
+        graphics::set_color(color.r, color.g, color.b, color.a);
+        graphics::text_key(x as i32, y as i32, self.theme.font, text);
+    }
+
+    /// A push button filling `r`. Returns true on the frame it's clicked or activated.
+    pub fn button(&mut self, label: &str, r: Rect) -> bool {
+        let (shown, id) = split_label(label);
+        let (hovered, focused, clicked) = self.widget(id, r);
+        fill(self.background(id, hovered), r);
+        if focused {
+            outline(self.theme.focus, r);
+        }
+        let width = graphics::text_measure_key(self.theme.font, shown).width as f32;
+        self.text_in(self.theme.text, r.x + (r.w - width) / 2.0, r, shown);
+        clicked
+    }
+
+    /// A checkbox with its label to the right, toggling `value`. Returns true when it changes.
+    pub fn checkbox(&mut self, label: &str, r: Rect, value: &mut bool) -> bool {
+        let (shown, id) = split_label(label);
+        let (hovered, focused, clicked) = self.widget(id, r);
+        if clicked {
+            *value = !*value;
+        }
+        let pad = self.theme.padding;
+        let check = Rect::new(r.x, r.y, r.h, r.h);
+        fill(self.background(id, hovered), check);
+        if *value {
+            fill(self.theme.accent, check.inflate(-pad.min(r.h / 4.0)));
+        }
+        if focused {
+            outline(self.theme.focus, r);
+        }
+        self.text_in(self.theme.text, r.x + r.h + pad, r, shown);
+        clicked
+    }
+
+    /// A horizontal slider for `value` between `min` and `max`, with its label centered on it.
+    /// Dragging sets the value; left and right step it by a twentieth of the range. Returns
+    /// true when it changes.
+    pub fn slider(&mut self, label: &str, r: Rect, value: &mut f32, min: f32, max: f32) -> bool {
+        let (shown, id) = split_label(label);
+        let (hovered, focused, _) = self.widget(id, r);
+        let old = *value;
+        if self.held(id) && r.w > 0.0 {
+            *value = min + (self.input.mouse.x - r.x) / r.w * (max - min);
+        } else if focused && self.editing.is_none() {
+            let step = (self.input.right as i32 - self.input.left as i32) as f32;
+            *value += step * (max - min) * SLIDER_STEP;
+        }
+        *value = value.clamp(min.min(max), max.max(min));
+
+        fill(self.background(id, hovered), r);
+        let t = if max != min {
+            (*value - min) / (max - min)
+        } else {
+            0.0
+        };
+        fill(self.theme.accent, Rect::new(r.x, r.y, r.w * t, r.h));
+        if focused {
+            outline(self.theme.focus, r);
+        }
+        let width = graphics::text_measure_key(self.theme.font, shown).width as f32;
+        self.text_in(self.theme.text, r.x + (r.w - width) / 2.0, r, shown);
+        *value != old
+    }
+
+    /// A one-line text field editing `value`, up to `max_chars` characters. Clicking or
+    /// activating it starts editing; Enter, clicking elsewhere or moving focus stops. The label
+    /// shows while `value` is empty. Returns true on the frame Enter finishes editing.
+    pub fn text_field(
+        &mut self,
+        label: &str,
+        r: Rect,
+        value: &mut String,
+        max_chars: usize,
+    ) -> bool {
+        let (shown, id) = split_label(label);
+        let (hovered, focused, clicked) = self.widget(id, r);
+        if self.editing == Some(id) && self.mouse_pressed && !hovered {
+            self.stop_editing();
+        } else if clicked && self.editing.is_none() {
+            self.editing = Some(id);
+            self.focus = Some(id);
+            input::text_input_start();
+        }
+
+        let mut submitted = false;
+        let editing = self.editing == Some(id);
+        if editing {
+            let typed = core::mem::take(&mut self.typed);
+            (_, submitted) = edit_text(value, &typed, max_chars);
+            if submitted {
+                self.stop_editing();
+            }
+        }
+
+        fill(self.background(id, hovered), r);
+        if editing {
+            outline(self.theme.accent, r);
+        } else if focused {
+            outline(self.theme.focus, r);
+        }
+        let x = r.x + self.theme.padding;
+        if value.is_empty() && !editing {
+            self.text_in(self.theme.placeholder, x, r, shown);
+        } else {
+            self.text_in(self.theme.text, x, r, value);
+        }
+        if editing && system::millis() / CARET_BLINK % 2 == 0 {
+            let width = graphics::text_measure_key(self.theme.font, value).width as f32;
+            let pad = self.theme.padding;
+            fill(
+                self.theme.text,
+                Rect::new(x + width, r.y + pad / 2.0, 1.0, r.h - pad),
+            );
+        }
+        submitted
+    }
+}
+
+#[cfg(test)]
+mod tests {
+    use super::*;
+
+    #[test]
+    fn focus_wraps_through_draw_order() {
+        let order = [1, 2, 3];
+        assert_eq!(step_focus(&order, None, 1), Some(1));
+        assert_eq!(step_focus(&order, None, -1), Some(3));
+        assert_eq!(step_focus(&order, Some(3), 1), Some(1));
+        assert_eq!(step_focus(&order, Some(1), -1), Some(3));
+        assert_eq!(step_focus(&order, Some(2), 0), Some(2));
+        assert_eq!(step_focus(&[], Some(2), 1), Some(2));
+    }
+
+    #[test]
+    fn labels_and_typing() {
+        assert_eq!(
+            split_label("Volume 80%##volume"),
+            ("Volume 80%", hash_key("volume"))
+        );
+        assert_eq!(split_label("Play"), ("Play", hash_key("Play")));
+
+        let mut name = String::from("Ad");
+        assert_eq!(edit_text(&mut name, "a\u{1b}xy", 4), (true, false));
+        assert_eq!(name, "Adax");
+        assert_eq!(edit_text(&mut name, "\u{8}\u{8}b\nzz", 4), (true, true));
+        assert_eq!(name, "Adb");
+    }
+
+    #[cfg(all(feature = "mock", not(target_arch = "wasm32")))]
+    #[test]
+    fn mouse_and_keyboard_press_buttons() {
+        let play = Rect::new(10.0, 10.0, 80.0, 20.0);
+        let quit = Rect::new(10.0, 40.0, 80.0, 20.0);
+        let mut ui = Ui::new();
+        let frame = |ui: &mut Ui, input: UiInput| {
+            ui.begin_with(input, "");
+            (ui.button("Play", play), ui.button("Quit", quit))
+        };
+
+        let over_play = UiInput {
+            mouse: Vec2::new(20.0, 15.0),
+            ..UiInput::default()
+        };
+        let down = UiInput {
+            mouse_down: true,
+            ..over_play
+        };
+        assert_eq!(frame(&mut ui, over_play), (false, false));
+        assert_eq!(frame(&mut ui, down), (false, false));
+        assert_eq!(frame(&mut ui, over_play), (true, false));
+
+        // Play has focus from the click; down moves to Quit.
+        let nav = UiInput {
+            down: true,
+            ..UiInput::default()
+        };
+        assert_eq!(frame(&mut ui, nav), (false, false));
+        let activate = UiInput {
+            activate: true,
+            ..UiInput::default()
+        };
+        assert_eq!(frame(&mut ui, activate), (false, true));
+    }
+
+    #[cfg(all(feature = "mock", not(target_arch = "wasm32")))]
+    #[test]
+    fn sliders_drag_and_step() {
+        let r = Rect::new(0.0, 0.0, 100.0, 10.0);
+        let mut ui = Ui::new();
+        let mut volume = 0.5;
+        let drag = UiInput {
+            mouse: Vec2::new(25.0, 5.0),
+            mouse_down: true,
+            ..UiInput::default()
+        };
+        ui.begin_with(drag, "");
+        assert!(ui.slider("Volume", r, &mut volume, 0.0, 1.0));
+        assert_eq!(volume, 0.25);
+
+        let right = UiInput {
+            right: true,
+            ..UiInput::default()
+        };
+        ui.begin_with(right, "");
+        assert!(ui.slider("Volume", r, &mut volume, 0.0, 1.0));
+        assert!((volume - 0.3).abs() < 1e-6);
+    }
+}
@@ -20,17 +20,165 @@ pub const Button = enum(u32) {
     r3 = 15,
 };
 
+/// An RGBA color. Packed for the host as 0xRRGGBBAA.
+pub const Color = struct {
+    r: u8,
+    g: u8,
+    b: u8,
+    a: u8 = 255,
+
+    pub const black = Color{ .r = 0, .g = 0, .b = 0 };
+    pub const white = Color{ .r = 255, .g = 255, .b = 255 };
+
+    pub fn rgb(r: u8, g: u8, b: u8) Color {
+        return .{ .r = r, .g = g, .b = b };
+    }
+
+    pub fn rgba(r: u8, g: u8, b: u8, a: u8) Color {
+        return .{ .r = r, .g = g, .b = b, .a = a };
+    }
+
+    /// Pack as 0xRRGGBBAA (the layout host imports expect).
+    pub fn toU32(self: Color) u32 {
+        return (@as(u32, self.r) << 24) | (@as(u32, self.g) << 16) | (@as(u32, self.b) << 8) | @as(u32, self.a);
+    }
+};
+
+/// Dash pattern for lines and outlines.
+pub const LineStyle = enum(u32) {
+    solid = 0,
+    dashed = 1,
+    dotted = 2,
+};
+
+/// One sprite of a `graphics.imageDrawBatch` call, laid out as the host expects.
+/// `sw`/`sh` of 0 draw the whole image; rotation is about the sprite's center.
+pub const DrawInstance = extern struct {
+    x: i32,
+    y: i32,
+    sx: i32 = 0,
+    sy: i32 = 0,
+    sw: u32 = 0,
+    sh: u32 = 0,
+    angle: f32 = 0,
+    /// Packed 0xRRGGBBAA.
+    tint: u32 = 0xFFFFFFFF,
+};
+
+/// Outline and drop shadow for `graphics.textSdf`, laid out as the host expects.
+/// Lengths are screen pixels; a transparent color (the default) turns its effect off.
+pub const TextStyle = extern struct {
+    outline_width: f32 = 0,
+    /// Packed 0xRRGGBBAA.
+    outline_color: u32 = 0,
+    shadow_x: f32 = 0,
+    shadow_y: f32 = 0,
+    shadow_softness: f32 = 0,
+    /// Packed 0xRRGGBBAA.
+    shadow_color: u32 = 0,
+};
+
+/// Shape of host-drawn particles.
+pub const ParticleShape = enum(u32) {
+    square = 0,
+    circle = 1,
+};
+
+/// Behavior of a host particle system, laid out as the host expects.
+/// Defaults are short-lived white sparks flying out in every direction.
+pub const ParticleConfig = extern struct {
+    life_min_ms: u32 = 500,
+    life_max_ms: u32 = 1000,
+    /// Pixels per second.
+    speed_min: f32 = 20,
+    speed_max: f32 = 60,
+    /// Radians, 0 = right, clockwise.
+    direction: f32 = 0,
+    /// Full cone width in radians.
+    spread: f32 = std.math.tau,
+    /// Pixels per second squared.
+    gravity_x: f32 = 0,
+    gravity_y: f32 = 0,
+    /// Fraction of velocity lost per second.
+    drag: f32 = 0,
+    /// Packed 0xRRGGBBAA.
+    color_start: u32 = 0xFFFFFFFF,
+    color_end: u32 = 0xFFFFFF00,
+    size_start: f32 = 2,
+    size_end: f32 = 1,
+    /// 0 means 1024.
+    max_particles: u32 = 0,
+    shape: ParticleShape = .square,
+};
+
+/// Built-in filter applied to each presented frame.
+pub const PostEffect = enum(u32) {
+    none = 0,
+    scanlines = 1,
+    crt = 2,
+    bloom = 3,
+    grayscale = 4,
+    dither = 5,
+};
+
+/// Effect a screen transition covers and reveals the frame with.
+pub const ScreenTransition = enum(u32) {
+    fade = 0,
+    dither_wipe = 1,
+    pixelate = 2,
+    iris = 3,
+};
+
+pub const FillRule = enum(u32) {
+    non_zero = 0,
+    even_odd = 1,
+};
+
+/// How the framebuffer is fitted to a fixed window size.
+pub const ScalingMode = enum(u32) {
+    fit = 0,
+    integer_scale = 1,
+    stretch = 2,
+};
+
 /// Text size dimensions.
 pub const TextSize = struct {
     width: u32,
     height: u32,
 };
 
+/// Vertical font metrics in pixels; the baseline sits `ascent` below the text's top.
+pub const FontMetrics = struct {
+    ascent: u32,
+    descent: u32,
+    line_gap: u32,
+
+    pub fn lineHeight(self: FontMetrics) u32 {
+        return self.ascent + self.descent + self.line_gap;
+    }
+};
+
+/// A 2D integer point, laid out as the host expects in vertex buffers.
+pub const Point = extern struct {
+    x: i32,
+    y: i32,
+};
+
 /// Low-level raw ABI imports.
 pub const sys = struct {
     // Graphics
     extern fn wasm96_graphics_set_size(width: u32, height: u32) void;
     extern fn wasm96_graphics_set_color(r: u32, g: u32, b: u32, a: u32) void;
+    extern fn wasm96_graphics_set_tint(r: u32, g: u32, b: u32, a: u32) void;
+    extern fn wasm96_graphics_set_post_effect(effect: u32, strength: f32) void;
+    extern fn wasm96_graphics_color_grade_set(ptr: [*]const u8, len: usize) u32;
+    extern fn wasm96_graphics_set_scaling_mode(mode: u32) void;
+    extern fn wasm96_graphics_window_size() u64;
+    extern fn wasm96_graphics_set_fullscreen(enabled: u32) void;
+    extern fn wasm96_graphics_fullscreen() u32;
+    extern fn wasm96_graphics_resized() u32;
+    extern fn wasm96_graphics_set_line_width(px: u32) void;
+    extern fn wasm96_graphics_set_line_style(style: u32) void;
     extern fn wasm96_graphics_background(r: u32, g: u32, b: u32) void;
     extern fn wasm96_graphics_point(x: i32, y: i32) void;
     extern fn wasm96_graphics_line(x1: i32, y1: i32, x2: i32, y2: i32) void;
@@ -41,12 +189,22 @@ pub const sys = struct {
     extern fn wasm96_graphics_image(x: i32, y: i32, w: u32, h: u32, ptr: [*]const u8, len: usize) void;
     extern fn wasm96_graphics_image_png(x: i32, y: i32, ptr: [*]const u8, len: usize) void;
     extern fn wasm96_graphics_image_jpeg(x: i32, y: i32, ptr: [*]const u8, len: usize) void;
+    extern fn wasm96_graphics_framebuffer_write(x: i32, y: i32, w: u32, h: u32, ptr: [*]const u8, len: usize) void;
+    extern fn wasm96_graphics_framebuffer_read(x: i32, y: i32, w: u32, h: u32, ptr: [*]u8, len: usize) u32;
     extern fn wasm96_graphics_triangle(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) void;
     extern fn wasm96_graphics_triangle_outline(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) void;
     extern fn wasm96_graphics_bezier_quadratic(x1: i32, y1: i32, cx: i32, cy: i32, x2: i32, y2: i32, segments: u32) void;
     extern fn wasm96_graphics_bezier_cubic(x1: i32, y1: i32, cx1: i32, cy1: i32, cx2: i32, cy2: i32, x2: i32, y2: i32, segments: u32) void;
     extern fn wasm96_graphics_pill(x: i32, y: i32, w: u32, h: u32) void;
     extern fn wasm96_graphics_pill_outline(x: i32, y: i32, w: u32, h: u32) void;
+    extern fn wasm96_graphics_rect_gradient(x: i32, y: i32, w: u32, h: u32, top_left: u32, top_right: u32, bottom_left: u32, bottom_right: u32) void;
+    extern fn wasm96_graphics_circle_gradient(x: i32, y: i32, r: u32, inner: u32, outer: u32) void;
+    extern fn wasm96_graphics_polygon(ptr: [*]const Point, count: usize) void;
+    extern fn wasm96_graphics_polyline(ptr: [*]const Point, count: usize, closed: u32) void;
+    extern fn wasm96_graphics_ellipse(x: i32, y: i32, rx: u32, ry: u32) void;
+    extern fn wasm96_graphics_ellipse_outline(x: i32, y: i32, rx: u32, ry: u32) void;
+    extern fn wasm96_graphics_arc(x: i32, y: i32, r: u32, start: f32, end: f32) void;
+    extern fn wasm96_graphics_arc_filled(x: i32, y: i32, r: u32, start: f32, end: f32) void;
 
     // 3D Graphics
     extern fn wasm96_graphics_set_3d(enable: u32) void;
@@ -69,31 +227,148 @@ pub const sys = struct {
         tex_len: u32,
     ) u32;
 
+    extern fn wasm96_graphics_last_error() u32;
     extern fn wasm96_graphics_svg_register(key: u64, data_ptr: [*]const u8, data_len: usize) u32;
     extern fn wasm96_graphics_svg_draw_key(key: u64, x: i32, y: i32, w: u32, h: u32) void;
     extern fn wasm96_graphics_svg_unregister(key: u64) void;
+    extern fn wasm96_graphics_svg_size(key: u64) u64;
+    extern fn wasm96_graphics_svg_set_fill(key: u64, selector_ptr: [*]const u8, selector_len: usize, color: u32) u32;
 
     extern fn wasm96_graphics_gif_register(key: u64, data_ptr: [*]const u8, data_len: usize) u32;
     extern fn wasm96_graphics_gif_draw_key(key: u64, x: i32, y: i32) void;
     extern fn wasm96_graphics_gif_draw_key_scaled(key: u64, x: i32, y: i32, w: u32, h: u32) void;
     extern fn wasm96_graphics_gif_unregister(key: u64) void;
+    extern fn wasm96_graphics_gif_frame_count(key: u64) u32;
+    extern fn wasm96_graphics_gif_frame_delay(key: u64, frame: u32) u32;
+    extern fn wasm96_graphics_gif_set_frame(key: u64, frame: u32) void;
+    extern fn wasm96_graphics_gif_set_speed(key: u64, multiplier: f32) void;
+    extern fn wasm96_graphics_gif_pause(key: u64, paused: u32) void;
+    extern fn wasm96_graphics_gif_draw_frame(key: u64, frame: u32, x: i32, y: i32, w: u32, h: u32) void;
+    extern fn wasm96_graphics_gif_draw_ex(key: u64, x: i32, y: i32, w: u32, h: u32, angle: f32, flags: u32, pivot_x: i32, pivot_y: i32) void;
+
+    extern fn wasm96_graphics_aseprite_register(key: u64, data_ptr: [*]const u8, data_len: usize) u32;
+    extern fn wasm96_graphics_aseprite_unregister(key: u64) void;
+    extern fn wasm96_graphics_aseprite_size(key: u64) u64;
+    extern fn wasm96_graphics_aseprite_frame_count(key: u64) u32;
+    extern fn wasm96_graphics_aseprite_frame_duration(key: u64, frame: u32) u32;
+    extern fn wasm96_graphics_aseprite_tag_duration(key: u64, tag_ptr: [*]const u8, tag_len: usize) u32;
+    extern fn wasm96_graphics_aseprite_draw_frame(key: u64, frame: u32, x: i32, y: i32) void;
+    extern fn wasm96_graphics_aseprite_draw_tag(key: u64, tag_ptr: [*]const u8, tag_len: usize, millis: u32, x: i32, y: i32) u32;
+    extern fn wasm96_graphics_aseprite_set_layer_visible(key: u64, name_ptr: [*]const u8, name_len: usize, visible: u32) u32;
+
+    // Tile maps (Tiled / LDtk)
+    extern fn wasm96_graphics_map_load(key: u64, path_ptr: [*]const u8, path_len: usize, level_ptr: [*]const u8, level_len: usize) u32;
+    extern fn wasm96_graphics_map_register(key: u64, data_ptr: [*]const u8, data_len: usize, level_ptr: [*]const u8, level_len: usize) u32;
+    extern fn wasm96_graphics_map_unregister(key: u64) void;
+    extern fn wasm96_graphics_map_size(key: u64) u64;
+    extern fn wasm96_graphics_map_tile_size(key: u64) u64;
+    extern fn wasm96_graphics_map_layer_count(key: u64) u32;
+    extern fn wasm96_graphics_map_layer_index(key: u64, name_ptr: [*]const u8, name_len: usize) i32;
+    extern fn wasm96_graphics_map_tile(key: u64, layer: u32, column: u32, row: u32) u32;
+    extern fn wasm96_graphics_map_objects(key: u64) u32;
+    extern fn wasm96_graphics_map_draw(key: u64, x: i32, y: i32) void;
+    extern fn wasm96_graphics_map_draw_layer(key: u64, layer: u32, x: i32, y: i32) void;
 
     extern fn wasm96_graphics_png_register(key: u64, data_ptr: [*]const u8, data_len: usize) u32;
     extern fn wasm96_graphics_png_draw_key(key: u64, x: i32, y: i32) void;
     extern fn wasm96_graphics_png_draw_key_scaled(key: u64, x: i32, y: i32, w: u32, h: u32) void;
     extern fn wasm96_graphics_png_unregister(key: u64) void;
+    extern fn wasm96_graphics_image_draw_region(key: u64, sx: i32, sy: i32, sw: u32, sh: u32, x: i32, y: i32, w: u32, h: u32) void;
+    extern fn wasm96_graphics_image_draw_nine_slice(key: u64, x: i32, y: i32, w: u32, h: u32, left: u32, top: u32, right: u32, bottom: u32) void;
+    extern fn wasm96_graphics_image_draw_batch(key: u64, ptr: [*]const DrawInstance, count: usize) void;
+    extern fn wasm96_graphics_particles_create(key: u64, config_ptr: *const ParticleConfig, config_len: usize) u32;
+    extern fn wasm96_graphics_particles_emit(key: u64, x: i32, y: i32, count: u32) void;
+    extern fn wasm96_graphics_particles_update_and_draw(key: u64) void;
+    extern fn wasm96_graphics_particles_count(key: u64) u32;
+    extern fn wasm96_graphics_particles_clear(key: u64) void;
+    extern fn wasm96_graphics_particles_destroy(key: u64) void;
+    extern fn wasm96_graphics_camera_set(x: f32, y: f32, zoom: f32, rotation: f32) void;
+    extern fn wasm96_graphics_camera_set_bounds(x: i32, y: i32, w: u32, h: u32) void;
+    extern fn wasm96_graphics_camera_shake(magnitude: f32, duration_ms: u32) void;
+    extern fn wasm96_graphics_camera_reset() void;
+    extern fn wasm96_graphics_screen_to_world(x: f32, y: f32) u64;
+    extern fn wasm96_graphics_world_to_screen(x: f32, y: f32) u64;
+    extern fn wasm96_graphics_layer_begin(index: u32) void;
+    extern fn wasm96_graphics_layer_end() void;
+    extern fn wasm96_graphics_layer_set_visible(index: u32, visible: u32) void;
+    extern fn wasm96_graphics_layer_set_parallax(index: u32, factor: f32) void;
+    extern fn wasm96_graphics_layer_set_order(index: u32, order: i32) void;
+    extern fn wasm96_graphics_mask_begin() void;
+    extern fn wasm96_graphics_mask_end() void;
+    extern fn wasm96_graphics_mask_use(invert: u32) void;
+    extern fn wasm96_graphics_mask_off() void;
+    extern fn wasm96_graphics_path_begin() void;
+    extern fn wasm96_graphics_path_move_to(x: f32, y: f32) void;
+    extern fn wasm96_graphics_path_line_to(x: f32, y: f32) void;
+    extern fn wasm96_graphics_path_curve_to(cx1: f32, cy1: f32, cx2: f32, cy2: f32, x: f32, y: f32) void;
+    extern fn wasm96_graphics_path_close() void;
+    extern fn wasm96_graphics_path_fill(even_odd: u32) void;
+    extern fn wasm96_graphics_path_stroke() void;
+    extern fn wasm96_graphics_transition_start(kind: u32, duration_ms: u32) void;
+    extern fn wasm96_graphics_transition_active() u32;
+    extern fn wasm96_graphics_transition_midpoint() u32;
+    extern fn wasm96_graphics_palette_set(index: u32, r: u32, g: u32, b: u32) void;
+    extern fn wasm96_graphics_palette_swap(from: u32, to: u32) void;
+    extern fn wasm96_graphics_palette_set_transparent(index: u32, transparent: u32) void;
+    extern fn wasm96_graphics_palette_reset() void;
+    extern fn wasm96_graphics_set_color_index(index: u32) void;
+    extern fn wasm96_graphics_indexed_register(key: u64, width: u32, height: u32, data_ptr: [*]const u8, data_len: usize) u32;
+    extern fn wasm96_graphics_indexed_draw(key: u64, x: i32, y: i32) void;
+    extern fn wasm96_graphics_indexed_unregister(key: u64) void;
+    extern fn wasm96_graphics_image_draw_ex(key: u64, x: i32, y: i32, w: u32, h: u32, angle: f32, flags: u32, pivot_x: i32, pivot_y: i32) void;
 
     extern fn wasm96_graphics_jpeg_register(key: u64, data_ptr: [*]const u8, data_len: usize) u32;
+    extern fn wasm96_graphics_image_register_async(key: u64, data_ptr: [*]const u8, data_len: usize) u32;
     extern fn wasm96_graphics_jpeg_draw_key(key: u64, x: i32, y: i32) void;
     extern fn wasm96_graphics_jpeg_draw_key_scaled(key: u64, x: i32, y: i32, w: u32, h: u32) void;
     extern fn wasm96_graphics_jpeg_unregister(key: u64) void;
 
     extern fn wasm96_graphics_font_register_ttf(key: u64, data_ptr: [*]const u8, data_len: usize) u32;
     extern fn wasm96_graphics_font_register_bdf(key: u64, data_ptr: [*]const u8, data_len: usize) u32;
+    extern fn wasm96_graphics_font_register_fnt(key: u64, data_ptr: [*]const u8, data_len: usize, atlas_key: u64) u32;
     extern fn wasm96_graphics_font_register_spleen(key: u64, size: u32) u32;
     extern fn wasm96_graphics_font_unregister(key: u64) void;
+    extern fn wasm96_graphics_font_add_fallback(primary: u64, fallback: u64) u32;
     extern fn wasm96_graphics_text_key(x: i32, y: i32, font_key: u64, text_ptr: [*]const u8, text_len: usize) void;
     extern fn wasm96_graphics_text_measure_key(font_key: u64, text_ptr: [*]const u8, text_len: usize) u64;
+    extern fn wasm96_graphics_text_sized_key(x: i32, y: i32, font_key: u64, size_px: u32, text_ptr: [*]const u8, text_len: usize) void;
+    extern fn wasm96_graphics_text_measure_sized_key(font_key: u64, size_px: u32, text_ptr: [*]const u8, text_len: usize) u64;
+    extern fn wasm96_graphics_text_measure_up_to_key(font_key: u64, text_ptr: [*]const u8, text_len: usize, byte_offset: u32) u32;
+    extern fn wasm96_graphics_font_metrics_key(font_key: u64) u64;
+    extern fn wasm96_graphics_set_text_scale(multiplier: f32) void;
+    extern fn wasm96_graphics_font_register_ttf_sdf(key: u64, data_ptr: [*]const u8, data_len: usize) u32;
+    extern fn wasm96_graphics_text_sdf_key(x: f32, y: f32, font_key: u64, size_px: f32, angle: f32, text_ptr: [*]const u8, text_len: usize, style_ptr: *const TextStyle) void;
+
+    // Net
+    extern fn wasm96_net_fetch(method_ptr: [*]const u8, method_len: usize, url_ptr: [*]const u8, url_len: usize, headers_ptr: [*]const u8, headers_len: usize, body_ptr: [*]const u8, body_len: usize) u32;
+    extern fn wasm96_net_poll(id: u32) u32;
+    extern fn wasm96_net_status(id: u32) u32;
+    extern fn wasm96_net_take_body(id: u32) u32;
+    extern fn wasm96_net_cancel(id: u32) void;
+    extern fn wasm96_net_ws_open(url_ptr: [*]const u8, url_len: usize) u32;
+    extern fn wasm96_net_ws_state(id: u32) u32;
+    extern fn wasm96_net_ws_send(id: u32, ptr: [*]const u8, len: usize, text: u32) u32;
+    extern fn wasm96_net_ws_receive(id: u32) u32;
+    extern fn wasm96_net_ws_close(id: u32) void;
+    extern fn wasm96_net_session_create(players: u32, input_delay: u32, local_player: u32, port: u32) u32;
+    extern fn wasm96_net_session_add_peer(id: u32, player: u32, addr_ptr: [*]const u8, addr_len: usize) u32;
+    extern fn wasm96_net_session_add_local_input(id: u32, ptr: [*]const u8, len: usize) u32;
+    extern fn wasm96_net_session_synced_inputs(id: u32) u32;
+    extern fn wasm96_net_session_status(id: u32) u32;
+    extern fn wasm96_net_session_frame(id: u32) u32;
+    extern fn wasm96_net_session_is_resimulating(id: u32) u32;
+    extern fn wasm96_net_session_local_port(id: u32) u32;
+    extern fn wasm96_net_session_close(id: u32) void;
+    extern fn wasm96_net_session_add_lan_peer(id: u32, player: u32, conn: u32) u32;
+    extern fn wasm96_net_lan_discover() u32;
+    extern fn wasm96_net_lan_connect(peer: u32) u32;
+    extern fn wasm96_net_lan_accept() u32;
+    extern fn wasm96_net_lan_state(conn: u32) u32;
+    extern fn wasm96_net_lan_send(conn: u32, ptr: [*]const u8, len: usize, reliable: u32) u32;
+    extern fn wasm96_net_lan_receive(conn: u32) u32;
+    extern fn wasm96_net_lan_close(conn: u32) void;
+    extern fn wasm96_net_score_submit(board_ptr: [*]const u8, board_len: usize, score: i64, meta_ptr: [*]const u8, meta_len: usize) u32;
+    extern fn wasm96_net_score_fetch(board_ptr: [*]const u8, board_len: usize, count: u32) u32;
 
     // Input
     extern fn wasm96_input_is_button_down(port: u32, btn: u32) u32;
@@ -101,13 +376,92 @@ pub const sys = struct {
     extern fn wasm96_input_get_mouse_x() i32;
     extern fn wasm96_input_get_mouse_y() i32;
     extern fn wasm96_input_is_mouse_down(btn: u32) u32;
+    extern fn wasm96_input_get_connected_ports() u32;
+    extern fn wasm96_input_get_controller_name(port: u32) u32;
+    extern fn wasm96_input_ports_changed() u32;
+    extern fn wasm96_input_button_held_millis(port: u32, btn: u32) u32;
+    extern fn wasm96_input_key_held_millis(key: u32) u32;
+    extern fn wasm96_input_snapshot(ptr: [*]u8, len: usize) u32;
+    extern fn wasm96_input_get_touch_count() u32;
+    extern fn wasm96_input_get_touch_id(index: u32) u32;
+    extern fn wasm96_input_get_touch_x(index: u32) i32;
+    extern fn wasm96_input_get_touch_y(index: u32) i32;
+    extern fn wasm96_input_get_touch_phase(index: u32) u32;
+    extern fn wasm96_input_set_touch_mouse(enabled: u32) void;
+    extern fn wasm96_input_text_input_start() void;
+    extern fn wasm96_input_text_input_stop() void;
+    extern fn wasm96_input_get_text_input() u32;
+    extern fn wasm96_input_record_start() void;
+    extern fn wasm96_input_record_stop() u32;
+    extern fn wasm96_input_replay(ptr: [*]const u8, len: usize) u32;
+    extern fn wasm96_input_is_replaying() u32;
 
     // Audio
     extern fn wasm96_audio_init(sample_rate: u32) u32;
     extern fn wasm96_audio_push_samples(ptr: [*]const i16, len: usize) void;
+    extern fn wasm96_audio_get_queued_samples() u32;
+    extern fn wasm96_audio_get_buffer_capacity() u32;
     extern fn wasm96_audio_play_wav(ptr: [*]const u8, len: usize) void;
     extern fn wasm96_audio_play_qoa(ptr: [*]const u8, len: usize) void;
     extern fn wasm96_audio_play_xm(ptr: [*]const u8, len: usize) void;
+    extern fn wasm96_audio_xm_play(ptr: [*]const u8, len: usize) u32;
+    extern fn wasm96_audio_xm_pause(handle: u32, paused: u32) void;
+    extern fn wasm96_audio_xm_stop(handle: u32) void;
+    extern fn wasm96_audio_xm_set_position(handle: u32, order: u32, row: u32) u32;
+    extern fn wasm96_audio_xm_get_position(handle: u32) u32;
+    extern fn wasm96_audio_xm_set_loop(handle: u32, start_order: u32, start_row: u32, end_order: u32, end_row: u32) u32;
+    extern fn wasm96_audio_xm_set_looping(handle: u32, enabled: u32) void;
+    extern fn wasm96_audio_xm_set_group(handle: u32, group: u32) void;
+    extern fn wasm96_audio_music_create(ptr: [*]const u8, len: usize, format: u32) u32;
+    extern fn wasm96_audio_music_play(handle: u32) void;
+    extern fn wasm96_audio_music_pause(handle: u32) void;
+    extern fn wasm96_audio_music_stop(handle: u32) void;
+    extern fn wasm96_audio_music_destroy(handle: u32) void;
+    extern fn wasm96_audio_music_seek(handle: u32, millis: u32) u32;
+    extern fn wasm96_audio_music_position(handle: u32) u32;
+    extern fn wasm96_audio_music_set_volume(handle: u32, vol: f32) void;
+    extern fn wasm96_audio_music_set_looping(handle: u32, enabled: u32) void;
+    extern fn wasm96_audio_music_set_group(handle: u32, group: u32) void;
+    extern fn wasm96_audio_music_crossfade(from: u32, to: u32, millis: u32) void;
+
+    // MIDI + SoundFont
+    extern fn wasm96_audio_soundfont_create(ptr: [*]const u8, len: usize) u32;
+    extern fn wasm96_audio_soundfont_destroy(id: u32) void;
+    extern fn wasm96_audio_midi_play(ptr: [*]const u8, len: usize, soundfont: u32) u32;
+    extern fn wasm96_audio_midi_set_tempo(handle: u32, scale: f32) void;
+    extern fn wasm96_audio_midi_set_channel_volume(handle: u32, channel: u32, vol: f32) void;
+    extern fn wasm96_audio_sound_pool_create(ptr: [*]const u8, len: usize, max_voices: u32, steal_policy: u32) u32;
+    extern fn wasm96_audio_sound_pool_create_async(ptr: [*]const u8, len: usize, max_voices: u32, steal_policy: u32) u32;
+    extern fn wasm96_audio_sound_pool_play(pool: u32, vol: f32, pan: f32) u32;
+    extern fn wasm96_audio_sound_pool_set_pitch_variation(pool: u32, amount: f32) void;
+    extern fn wasm96_audio_sound_pool_set_group(pool: u32, group: u32) void;
+    extern fn wasm96_audio_sound_pool_active(pool: u32) u32;
+    extern fn wasm96_audio_sound_pool_stop(pool: u32) void;
+    extern fn wasm96_audio_sound_pool_destroy(pool: u32) void;
+    extern fn wasm96_audio_set_master_volume(vol: f32) void;
+    extern fn wasm96_audio_get_master_volume() f32;
+    extern fn wasm96_audio_set_group_volume(group: u32, vol: f32) void;
+    extern fn wasm96_audio_get_group_volume(group: u32) f32;
+    extern fn wasm96_audio_synth_set_group(voice: u32, group: u32) void;
+    extern fn wasm96_audio_set_pan(handle: u32, pan: f32) void;
+    extern fn wasm96_audio_synth_set_pan(voice: u32, pan: f32) void;
+    extern fn wasm96_audio_set_listener(x: f32, y: f32) void;
+    extern fn wasm96_audio_play_wav_at(ptr: [*]const u8, len: usize, x: f32, y: f32) u32;
+    extern fn wasm96_audio_set_pitch(handle: u32, ratio: f32) void;
+    extern fn wasm96_audio_play_wav_pitched(ptr: [*]const u8, len: usize, ratio: f32) u32;
+    extern fn wasm96_audio_effect_enable(effect: u32, a: f32, b: f32) u32;
+    extern fn wasm96_audio_effect_disable(effect: u32) void;
+    extern fn wasm96_audio_set_send(handle: u32, effect: u32, level: f32) void;
+    extern fn wasm96_audio_synth_set_send(voice: u32, effect: u32, level: f32) void;
+    extern fn wasm96_audio_group_set_send(group: u32, effect: u32, level: f32) void;
+    extern fn wasm96_audio_capture_start(sample_rate: u32) u32;
+    extern fn wasm96_audio_capture_read(ptr: [*]i16, max_samples: usize) u32;
+    extern fn wasm96_audio_capture_stop() void;
+    extern fn wasm96_audio_synth_voice_create(waveform: u32) u32;
+    extern fn wasm96_audio_synth_voice_destroy(voice: u32) void;
+    extern fn wasm96_audio_synth_set_envelope(voice: u32, attack_ms: u32, decay_ms: u32, sustain: f32, release_ms: u32) void;
+    extern fn wasm96_audio_synth_note_on(voice: u32, freq: f32, volume: f32) void;
+    extern fn wasm96_audio_synth_note_off(voice: u32) void;
 
     // System
     extern fn wasm96_storage_save(key: u64, data_ptr: [*]const u8, data_len: usize) void;
@@ -115,7 +469,54 @@ pub const sys = struct {
     extern fn wasm96_storage_free(ptr: [*]const u8, len: usize) void;
 
     extern fn wasm96_system_log(ptr: [*]const u8, len: usize) void;
+    extern fn wasm96_system_log_at(level: u32, ptr: [*]const u8, len: usize) void;
+    extern fn wasm96_system_set_log_level(level: u32) void;
+    extern fn wasm96_system_report_error(msg_ptr: [*]const u8, msg_len: usize, stack_ptr: [*]const u8, stack_len: usize) void;
     extern fn wasm96_system_millis() u64;
+    extern fn wasm96_system_unix_time() i64;
+    extern fn wasm96_system_local_time_offset_minutes() i32;
+    extern fn wasm96_system_get_locale() u32;
+    extern fn wasm96_system_delta_millis() u64;
+    extern fn wasm96_system_set_target_fps(fps: u32) void;
+    extern fn wasm96_system_get_fps() u32;
+    extern fn wasm96_system_set_update_rate(hz: u32) void;
+    extern fn wasm96_system_interpolation_alpha() f32;
+    extern fn wasm96_system_random() u64;
+    extern fn wasm96_system_random_seed() u64;
+    extern fn wasm96_system_quit() void;
+    extern fn wasm96_system_reset() void;
+    extern fn wasm96_system_clipboard_get() u32;
+    extern fn wasm96_system_clipboard_poll(id: u32) u32;
+    extern fn wasm96_system_clipboard_take(id: u32) u32;
+    extern fn wasm96_system_clipboard_cancel(id: u32) void;
+    extern fn wasm96_system_clipboard_set(ptr: [*]const u8, len: usize) u32;
+    extern fn wasm96_system_cart_meta(key_ptr: [*]const u8, key_len: usize) u32;
+    extern fn wasm96_system_launch_arg(key_ptr: [*]const u8, key_len: usize) u32;
+    extern fn wasm96_system_asset_read(path_ptr: [*]const u8, path_len: usize) u32;
+    extern fn wasm96_system_asset_list(prefix_ptr: [*]const u8, prefix_len: usize) u32;
+    extern fn wasm96_system_stats(ptr: [*]u8, len: usize) u32;
+    extern fn wasm96_system_accessibility_settings(ptr: [*]u8, len: usize) u32;
+    extern fn wasm96_system_load_status(handle: u32) u32;
+    extern fn wasm96_system_load_progress() f32;
+    extern fn wasm96_system_job_spawn(name_ptr: [*]const u8, name_len: usize, arg: u32, data_ptr: [*]const u8, data_len: usize) u32;
+    extern fn wasm96_system_job_status(id: u32) u32;
+    extern fn wasm96_system_job_result(id: u32) u32;
+    extern fn wasm96_system_job_output(id: u32) u32;
+    extern fn wasm96_system_job_free(id: u32) void;
+    extern fn wasm96_system_job_input_len() u32;
+    extern fn wasm96_system_job_input_read(ptr: [*]u8, len: usize) u32;
+    extern fn wasm96_system_job_output_write(ptr: [*]const u8, len: usize) u32;
+    extern fn wasm96_system_achievement_unlock(id_ptr: [*]const u8, id_len: usize) u32;
+    extern fn wasm96_system_achievement_progress(id_ptr: [*]const u8, id_len: usize, value: u32, max: u32) u32;
+    extern fn wasm96_system_dev_reload_requested() u32;
+    extern fn wasm96_system_blob_len(id: u32) u32;
+    extern fn wasm96_system_blob_read(id: u32, ptr: [*]u8, len: usize) u32;
+    extern fn wasm96_system_blob_free(id: u32) void;
+    extern fn wasm96_system_screenshot() u32;
+    extern fn wasm96_system_record_gif_start() void;
+    extern fn wasm96_system_record_gif_stop() u32;
+    extern fn wasm96_system_state_save() u32;
+    extern fn wasm96_system_state_load(ptr: [*]const u8, len: usize) u32;
 };
 
 /// Graphics API.
@@ -129,7 +530,7 @@ pub const graphics = struct {
         return hash;
     }
 
-    /// Set the screen dimensions.
+    /// Set the screen dimensions. Callable at any time; `resized` reports it on the next tick.
     pub fn setSize(width: u32, height: u32) void {
         sys.wasm96_graphics_set_size(width, height);
     }
@@ -139,6 +540,67 @@ pub const graphics = struct {
         sys.wasm96_graphics_set_color(@as(u32, r), @as(u32, g), @as(u32, b), @as(u32, a));
     }
 
+    /// Multiply subsequent image, GIF and SVG draws by this color; alpha below 255 blends them.
+    pub fn setTint(r: u8, g: u8, b: u8, a: u8) void {
+        sys.wasm96_graphics_set_tint(@as(u32, r), @as(u32, g), @as(u32, b), @as(u32, a));
+    }
+
+    /// Draw images, GIFs and SVGs untinted again.
+    pub fn clearTint() void {
+        setTint(255, 255, 255, 255);
+    }
+
+    /// Set the stroke width in pixels for lines, outlines, curves, and polylines.
+    pub fn setLineWidth(px: u32) void {
+        sys.wasm96_graphics_set_line_width(px);
+    }
+
+    /// Set the dash pattern for lines, outlines, curves, and polylines.
+    pub fn setLineStyle(style: LineStyle) void {
+        sys.wasm96_graphics_set_line_style(@intFromEnum(style));
+    }
+
+    /// Filter every presented frame; `strength` runs from 0 (off) to 1.
+    pub fn setPostEffect(effect: PostEffect, strength: f32) void {
+        sys.wasm96_graphics_set_post_effect(@intFromEnum(effect), strength);
+    }
+
+    /// Color grade presented frames: a 256-byte table, 256 RGB entries, or an n^3 RGB LUT
+    /// (red fastest). Returns false for any other length.
+    pub fn colorGradeSet(lut: []const u8) bool {
+        return sys.wasm96_graphics_color_grade_set(lut.ptr, lut.len) != 0;
+    }
+
+    pub fn colorGradeClear() void {
+        _ = sys.wasm96_graphics_color_grade_set(&[_]u8{}, 0);
+    }
+
+    /// Choose how the framebuffer fits a fixed window size (set in the core options).
+    pub fn setScalingMode(mode: ScalingMode) void {
+        sys.wasm96_graphics_set_scaling_mode(@intFromEnum(mode));
+    }
+
+    /// Window size: .{ width, height }. The framebuffer size when the window option is native.
+    pub fn windowSize() [2]u32 {
+        const packed = sys.wasm96_graphics_window_size();
+        return .{ @truncate(packed >> 32), @truncate(packed) };
+    }
+
+    /// Present at the full display size (1920x1080) instead of the window size option.
+    pub fn setFullscreen(enabled: bool) void {
+        sys.wasm96_graphics_set_fullscreen(@intFromBool(enabled));
+    }
+
+    /// Whether fullscreen was asked for.
+    pub fn fullscreen() bool {
+        return sys.wasm96_graphics_fullscreen() != 0;
+    }
+
+    /// True during the first tick after the framebuffer or window changed size.
+    pub fn resized() bool {
+        return sys.wasm96_graphics_resized() != 0;
+    }
+
     /// Clear the screen with a specific color (RGB).
     pub fn background(r: u8, g: u8, b: u8) void {
         sys.wasm96_graphics_background(@as(u32, r), @as(u32, g), @as(u32, b));
@@ -164,6 +626,23 @@ pub const graphics = struct {
         sys.wasm96_graphics_rect_outline(x, y, w, h);
     }
 
+    /// Draw a line between two points.
+    pub fn lineBetween(a: Point, b: Point) void {
+        line(a.x, a.y, b.x, b.y);
+    }
+
+    /// Draw a filled `math.Rect`, rounded to whole pixels.
+    pub fn rectOf(r: math.Rect) void {
+        const p = r.pixels();
+        rect(p.x, p.y, p.w, p.h);
+    }
+
+    /// Draw the outline of a `math.Rect`, rounded to whole pixels.
+    pub fn rectOutlineOf(r: math.Rect) void {
+        const p = r.pixels();
+        rectOutline(p.x, p.y, p.w, p.h);
+    }
+
     /// Draw a filled circle.
     pub fn circle(x: i32, y: i32, r: u32) void {
         sys.wasm96_graphics_circle(x, y, r);
@@ -189,6 +668,17 @@ pub const graphics = struct {
         sys.wasm96_graphics_image_jpeg(x, y, data.ptr, data.len);
     }
 
+    /// Copy a `w`x`h` block of RGBA8888 pixels straight into the framebuffer (no alpha test).
+    pub fn framebufferWrite(x: i32, y: i32, w: u32, h: u32, pixels: []const u8) void {
+        sys.wasm96_graphics_framebuffer_write(x, y, w, h, pixels.ptr, pixels.len);
+    }
+
+    /// Read a `w`x`h` block of the framebuffer as RGBA8888 into `out`.
+    /// Returns false if `out` is smaller than `w * h * 4` bytes.
+    pub fn framebufferRead(x: i32, y: i32, w: u32, h: u32, out: []u8) bool {
+        return sys.wasm96_graphics_framebuffer_read(x, y, w, h, out.ptr, out.len) != 0;
+    }
+
     /// Draw a filled triangle.
     pub fn triangle(x1: i32, y1: i32, x2: i32, y2: i32, x3: i32, y3: i32) void {
         sys.wasm96_graphics_triangle(x1, y1, x2, y2, x3, y3);
@@ -219,6 +709,46 @@ pub const graphics = struct {
         sys.wasm96_graphics_pill_outline(x, y, w, h);
     }
 
+    /// Fill a rectangle with a bilinear gradient between four corner colors.
+    pub fn rectGradient(x: i32, y: i32, w: u32, h: u32, top_left: Color, top_right: Color, bottom_left: Color, bottom_right: Color) void {
+        sys.wasm96_graphics_rect_gradient(x, y, w, h, top_left.toU32(), top_right.toU32(), bottom_left.toU32(), bottom_right.toU32());
+    }
+
+    /// Fill a circle with a radial gradient from `inner` at the center to `outer` at the edge.
+    pub fn circleGradient(x: i32, y: i32, r: u32, inner: Color, outer: Color) void {
+        sys.wasm96_graphics_circle_gradient(x, y, r, inner.toU32(), outer.toU32());
+    }
+
+    /// Draw a filled polygon (even-odd rule) in a single call.
+    pub fn polygon(points: []const Point) void {
+        sys.wasm96_graphics_polygon(points.ptr, points.len);
+    }
+
+    /// Draw connected line segments through `points`; `closed` joins the last point to the first.
+    pub fn polyline(points: []const Point, closed: bool) void {
+        sys.wasm96_graphics_polyline(points.ptr, points.len, if (closed) 1 else 0);
+    }
+
+    /// Draw a filled ellipse centered at (x, y) with radii (rx, ry).
+    pub fn ellipse(x: i32, y: i32, rx: u32, ry: u32) void {
+        sys.wasm96_graphics_ellipse(x, y, rx, ry);
+    }
+
+    /// Draw an ellipse outline centered at (x, y) with radii (rx, ry).
+    pub fn ellipseOutline(x: i32, y: i32, rx: u32, ry: u32) void {
+        sys.wasm96_graphics_ellipse_outline(x, y, rx, ry);
+    }
+
+    /// Draw a circular arc. Angles are in radians, clockwise from +x (screen y points down).
+    pub fn arc(x: i32, y: i32, r: u32, start: f32, end: f32) void {
+        sys.wasm96_graphics_arc(x, y, r, start, end);
+    }
+
+    /// Draw a filled pie slice. Angles follow the same convention as `arc`.
+    pub fn arcFilled(x: i32, y: i32, r: u32, start: f32, end: f32) void {
+        sys.wasm96_graphics_arc_filled(x, y, r, start, end);
+    }
+
     // =========================
     // 3D Graphics
     // =========================
@@ -303,6 +833,17 @@ pub const graphics = struct {
         sys.wasm96_graphics_svg_unregister(hashKey(key));
     }
 
+    /// Intrinsic size of a keyed SVG in pixels ({0, 0} if it isn't registered).
+    pub fn svgSize(key: []const u8) [2]u32 {
+        const packed = sys.wasm96_graphics_svg_size(hashKey(key));
+        return .{ @truncate(packed >> 32), @truncate(packed) };
+    }
+
+    /// Recolor the elements matching "#id", ".class" or a bare name. Returns how many changed.
+    pub fn svgSetFill(key: []const u8, selector: []const u8, color: Color) u32 {
+        return sys.wasm96_graphics_svg_set_fill(hashKey(key), selector.ptr, selector.len, color.toU32());
+    }
+
     /// Register a GIF resource under a string key.
     pub fn gifRegister(key: []const u8, data: []const u8) bool {
         return sys.wasm96_graphics_gif_register(hashKey(key), data.ptr, data.len) != 0;
@@ -323,176 +864,5294 @@ pub const graphics = struct {
         sys.wasm96_graphics_gif_unregister(hashKey(key));
     }
 
-    /// Register a PNG resource under a string key.
-    pub fn pngRegister(key: []const u8, data: []const u8) bool {
-        return sys.wasm96_graphics_png_register(hashKey(key), data.ptr, data.len) != 0;
+    /// Number of frames in a registered GIF (0 if the key is unknown).
+    pub fn gifFrameCount(key: []const u8) u32 {
+        return sys.wasm96_graphics_gif_frame_count(hashKey(key));
     }
 
-    pub fn jpegRegister(key: []const u8, data: []const u8) bool {
-        return sys.wasm96_graphics_jpeg_register(hashKey(key), data.ptr, data.len) != 0;
+    /// How long a GIF frame is shown, in milliseconds.
+    pub fn gifFrameDelay(key: []const u8, frame: u32) u32 {
+        return sys.wasm96_graphics_gif_frame_delay(hashKey(key), frame);
     }
 
-    /// Draw a registered PNG by key at natural size.
-    pub fn pngDrawKey(key: []const u8, x: i32, y: i32) void {
-        sys.wasm96_graphics_png_draw_key(hashKey(key), x, y);
+    /// Draw one GIF frame regardless of the host clock (natural size if `w` or `h` is 0).
+    pub fn gifDrawFrame(key: []const u8, frame: u32, x: i32, y: i32, w: u32, h: u32) void {
+        sys.wasm96_graphics_gif_draw_frame(hashKey(key), frame, x, y, w, h);
     }
 
-    pub fn jpegDrawKey(key: []const u8, x: i32, y: i32) void {
-        sys.wasm96_graphics_jpeg_draw_key(hashKey(key), x, y);
+    /// Jump a GIF's host playback to the start of `frame`.
+    pub fn gifSetFrame(key: []const u8, frame: u32) void {
+        sys.wasm96_graphics_gif_set_frame(hashKey(key), frame);
     }
 
-    /// Draw a registered PNG by key scaled.
-    pub fn pngDrawKeyScaled(key: []const u8, x: i32, y: i32, w: u32, h: u32) void {
-        sys.wasm96_graphics_png_draw_key_scaled(hashKey(key), x, y, w, h);
+    /// Scale a GIF's playback speed (1 = normal, 0 = frozen).
+    pub fn gifSetSpeed(key: []const u8, multiplier: f32) void {
+        sys.wasm96_graphics_gif_set_speed(hashKey(key), multiplier);
     }
 
-    pub fn jpegDrawKeyScaled(key: []const u8, x: i32, y: i32, w: u32, h: u32) void {
-        sys.wasm96_graphics_jpeg_draw_key_scaled(hashKey(key), x, y, w, h);
+    /// Pause or resume a GIF's playback.
+    pub fn gifPause(key: []const u8, paused: bool) void {
+        sys.wasm96_graphics_gif_pause(hashKey(key), @intFromBool(paused));
     }
 
-    /// Unregister a PNG by key.
-    pub fn pngUnregister(key: []const u8) void {
-        sys.wasm96_graphics_png_unregister(hashKey(key));
+    /// Register an Aseprite file (`.ase`/`.aseprite`) with its tags, layers and frame durations.
+    pub fn asepriteRegister(key: []const u8, data: []const u8) bool {
+        return sys.wasm96_graphics_aseprite_register(hashKey(key), data.ptr, data.len) != 0;
     }
 
-    pub fn jpegUnregister(key: []const u8) void {
-        sys.wasm96_graphics_jpeg_unregister(hashKey(key));
+    pub fn asepriteUnregister(key: []const u8) void {
+        sys.wasm96_graphics_aseprite_unregister(hashKey(key));
     }
 
-    /// Register a TTF font under a string key.
-    pub fn fontRegisterTtf(key: []const u8, data: []const u8) bool {
-        return sys.wasm96_graphics_font_register_ttf(hashKey(key), data.ptr, data.len) != 0;
+    /// Canvas size as .{ width, height }, or zeros if not registered.
+    pub fn asepriteSize(key: []const u8) [2]u32 {
+        const packed = sys.wasm96_graphics_aseprite_size(hashKey(key));
+        return .{ @truncate(packed >> 32), @truncate(packed) };
     }
 
-    /// Register a BDF font under a string key.
-    pub fn fontRegisterBdf(key: []const u8, data: []const u8) bool {
-        return sys.wasm96_graphics_font_register_bdf(hashKey(key), data.ptr, data.len) != 0;
+    pub fn asepriteFrameCount(key: []const u8) u32 {
+        return sys.wasm96_graphics_aseprite_frame_count(hashKey(key));
     }
 
-    /// Register a built-in Spleen font under a string key.
-    pub fn fontRegisterSpleen(key: []const u8, size: u32) bool {
-        return sys.wasm96_graphics_font_register_spleen(hashKey(key), size) != 0;
+    /// How long a frame is shown, in milliseconds.
+    pub fn asepriteFrameDuration(key: []const u8, frame: u32) u32 {
+        return sys.wasm96_graphics_aseprite_frame_duration(hashKey(key), frame);
     }
 
-    /// Unregister a font by key.
-    pub fn fontUnregister(key: []const u8) void {
-        sys.wasm96_graphics_font_unregister(hashKey(key));
+    /// Milliseconds of one pass through `tag` ("" = every frame); 0 if there is no such tag.
+    pub fn asepriteTagDuration(key: []const u8, tag: []const u8) u32 {
+        return sys.wasm96_graphics_aseprite_tag_duration(hashKey(key), tag.ptr, tag.len);
     }
 
-    /// Draw text using a font referenced by key.
-    pub fn textKey(x: i32, y: i32, font_key: []const u8, string: []const u8) void {
-        sys.wasm96_graphics_text_key(x, y, hashKey(font_key), string.ptr, string.len);
+    /// Draw one frame at natural size (indices wrap around).
+    pub fn asepriteDrawFrame(key: []const u8, frame: u32, x: i32, y: i32) void {
+        sys.wasm96_graphics_aseprite_draw_frame(hashKey(key), frame, x, y);
     }
 
-    /// Measure text using a font referenced by key.
-    pub fn textMeasureKey(font_key: []const u8, str: []const u8) TextSize {
-        const result = sys.wasm96_graphics_text_measure_key(hashKey(font_key), str.ptr, str.len);
-        return TextSize{
-            .width = @as(u32, @intCast(result >> 32)),
-            .height = @as(u32, @intCast(result & 0xFFFFFFFF)),
-        };
+    /// Draw the frame `tag` shows `millis` after it started ("" = every frame), following the
+    /// tag's direction and repeat count. Returns the frame drawn, or null if there is no such
+    /// sprite or tag.
+    pub fn asepriteDrawTag(key: []const u8, tag: []const u8, millis: u32, x: i32, y: i32) ?u32 {
+        const frame = sys.wasm96_graphics_aseprite_draw_tag(hashKey(key), tag.ptr, tag.len, millis, x, y);
+        return if (frame == std.math.maxInt(u32)) null else frame;
     }
-};
 
-/// Input API.
-pub const input = struct {
-    /// Returns true if the specified button is currently held down.
-    pub fn isButtonDown(port: u32, btn: Button) bool {
-        return sys.wasm96_input_is_button_down(port, @intFromEnum(btn)) != 0;
+    /// Show or hide every layer named `layer`; returns how many matched.
+    pub fn asepriteSetLayerVisible(key: []const u8, layer: []const u8, visible: bool) u32 {
+        return sys.wasm96_graphics_aseprite_set_layer_visible(hashKey(key), layer.ptr, layer.len, @intFromBool(visible));
     }
 
-    /// Returns true if the specified key is currently held down.
-    pub fn isKeyDown(key: u32) bool {
-        return sys.wasm96_input_is_key_down(key) != 0;
+    /// Load a Tiled (`.tmx`, `.tmj`) or LDtk (`.ldtk`) map from the cart bundle, registering the
+    /// tileset images it uses under their bundle paths. `level` picks an LDtk level ("" = first).
+    pub fn mapLoad(key: []const u8, path: []const u8, level: []const u8) bool {
+        return sys.wasm96_graphics_map_load(hashKey(key), path.ptr, path.len, level.ptr, level.len) != 0;
     }
 
-    /// Get current mouse X position.
-    pub fn getMouseX() i32 {
-        return sys.wasm96_input_get_mouse_x();
+    /// Like `mapLoad`, from bytes; the files it refers to are looked up from the bundle root.
+    pub fn mapRegister(key: []const u8, data: []const u8, level: []const u8) bool {
+        return sys.wasm96_graphics_map_register(hashKey(key), data.ptr, data.len, level.ptr, level.len) != 0;
     }
 
-    /// Get current mouse Y position.
-    pub fn getMouseY() i32 {
-        return sys.wasm96_input_get_mouse_y();
+    /// Unregister a map; its tileset images stay registered.
+    pub fn mapUnregister(key: []const u8) void {
+        sys.wasm96_graphics_map_unregister(hashKey(key));
     }
 
-    /// Returns true if the specified mouse button is held down.
-    /// 0 = Left, 1 = Right, 2 = Middle.
-    pub fn isMouseDown(btn: u32) bool {
-        return sys.wasm96_input_is_mouse_down(btn) != 0;
+    /// Map size in tiles: .{ columns, rows } (zeros if unknown).
+    pub fn mapSize(key: []const u8) [2]u32 {
+        const packed = sys.wasm96_graphics_map_size(hashKey(key));
+        return .{ @truncate(packed >> 32), @truncate(packed) };
     }
-};
 
-/// Audio API.
-pub const audio = struct {
-    /// Initialize audio system.
-    pub fn init(sample_rate: u32) u32 {
-        return sys.wasm96_audio_init(sample_rate);
+    /// Tile size in pixels: .{ width, height } (zeros if unknown).
+    pub fn mapTileSize(key: []const u8) [2]u32 {
+        const packed = sys.wasm96_graphics_map_tile_size(hashKey(key));
+        return .{ @truncate(packed >> 32), @truncate(packed) };
     }
 
-    /// Push a chunk of audio samples.
-    /// Samples are interleaved stereo (L, R, L, R...) signed 16-bit integers.
-    pub fn pushSamples(samples: []const i16) void {
-        sys.wasm96_audio_push_samples(samples.ptr, samples.len);
+    /// Number of tile layers, indexed bottom to top.
+    pub fn mapLayerCount(key: []const u8) u32 {
+        return sys.wasm96_graphics_map_layer_count(hashKey(key));
     }
 
-    /// Play a WAV file.
-    /// The WAV data is decoded and played as a one-shot audio channel.
-    pub fn playWav(data: []const u8) void {
-        sys.wasm96_audio_play_wav(data.ptr, data.len);
+    /// Index of the tile layer called `name`, or null.
+    pub fn mapLayerIndex(key: []const u8, name: []const u8) ?u32 {
+        const index = sys.wasm96_graphics_map_layer_index(hashKey(key), name.ptr, name.len);
+        return if (index < 0) null else @intCast(index);
     }
 
-    /// Play a QOA file.
-    /// The QOA data is decoded and played as a looping audio channel.
-    pub fn playQoa(data: []const u8) void {
-        sys.wasm96_audio_play_qoa(data.ptr, data.len);
+    /// Tile id at a cell (flip flags removed), or the LDtk IntGrid value; 0 is empty.
+    pub fn mapTile(key: []const u8, layer: u32, column: u32, row: u32) u32 {
+        return sys.wasm96_graphics_map_tile(hashKey(key), layer, column, row);
     }
 
-    /// Play an XM file.
-    /// The XM data is decoded using xmrsplayer and played as a looping audio channel.
-    pub fn playXm(data: []const u8) void {
-        sys.wasm96_audio_play_xm(data.ptr, data.len);
+    /// Draw every visible tile layer, bottom to top, with the map's top-left at (x, y).
+    pub fn mapDraw(key: []const u8, x: i32, y: i32) void {
+        sys.wasm96_graphics_map_draw(hashKey(key), x, y);
     }
-};
 
-/// Storage API.
-pub const storage = struct {
-    /// Save data to persistent storage.
-    pub fn save(key: []const u8, data: []const u8) void {
-        sys.wasm96_storage_save(graphics.hashKey(key), data.ptr, data.len);
+    /// Draw one tile layer (even one hidden in the editor).
+    pub fn mapDrawLayer(key: []const u8, layer: u32, x: i32, y: i32) void {
+        sys.wasm96_graphics_map_draw_layer(hashKey(key), layer, x, y);
     }
 
-    /// Load data from persistent storage.
-    /// Returns the data if found, null otherwise.
-    pub fn load(allocator: std.mem.Allocator, key: []const u8) !?[]u8 {
-        const packed_result = sys.wasm96_storage_load(graphics.hashKey(key));
-        if (packed_result == 0) return null;
+    /// An object from a map's object (Tiled) or entity (LDtk) layers. Strings point into the
+    /// buffer returned by `mapObjects`.
+    pub const MapObject = struct {
+        id: u32,
+        layer: []const u8,
+        name: []const u8,
+        /// Tiled's type/class, or the LDtk entity identifier.
+        kind: []const u8,
+        /// Top-left corner, in map pixels.
+        x: f32,
+        y: f32,
+        width: f32,
+        height: f32,
+        property_count: u32,
+        properties: []const u8,
 
-        const ptr_int = packed_result >> 32;
-        const len = packed_result & 0xFFFFFFFF;
+        /// The value of property `name` as text (non-string values are JSON), or null.
+        pub fn property(self: MapObject, name: []const u8) ?[]const u8 {
+            var it = MapObjectIterator{ .data = self.properties };
+            var i: u32 = 0;
+            while (i < self.property_count) : (i += 1) {
+                const k = it.text() orelse return null;
+                const v = it.text() orelse return null;
+                if (std.mem.eql(u8, k, name)) return v;
+            }
+            return null;
+        }
+    };
 
-        const ptr = @as([*]const u8, @ptrFromInt(ptr_int));
+    /// Copy a map's encoded objects into allocator-owned memory (null if it has none). Walk
+    /// them with `MapObjectIterator`.
+    pub fn mapObjects(allocator: std.mem.Allocator, key: []const u8) !?[]u8 {
+        return system.takeBlob(allocator, sys.wasm96_graphics_map_objects(hashKey(key)));
+    }
 
-        // Copy data from guest memory
-        const data = try allocator.alloc(u8, @as(usize, @intCast(len)));
-        @memcpy(data, ptr[0..@as(usize, @intCast(len))]);
+    /// Iterates the objects returned by `mapObjects`, in file order.
+    pub const MapObjectIterator = struct {
+        data: []const u8,
+        pos: usize = 0,
 
-        // Free the memory in guest space
-        sys.wasm96_storage_free(ptr, @as(usize, @intCast(len)));
+        fn take(self: *MapObjectIterator, n: usize) ?[]const u8 {
+            if (self.data.len - self.pos < n) return null;
+            defer self.pos += n;
+            return self.data[self.pos .. self.pos + n];
+        }
 
-        return data;
+        fn word(self: *MapObjectIterator) ?u32 {
+            return std.mem.readInt(u32, (self.take(4) orelse return null)[0..4], .little);
+        }
+
+        fn text(self: *MapObjectIterator) ?[]const u8 {
+            const len = self.word() orelse return null;
+            return self.take(len);
+        }
+
+        pub fn next(self: *MapObjectIterator) ?MapObject {
+            const id = self.word() orelse return null;
+            var box: [4]f32 = undefined;
+            for (&box) |*v| v.* = @bitCast(self.word() orelse return null);
+            const layer = self.text() orelse return null;
+            const name = self.text() orelse return null;
+            const kind = self.text() orelse return null;
+            const count = self.word() orelse return null;
+            const start = self.pos;
+            var i: u32 = 0;
+            while (i < count * 2) : (i += 1) _ = self.text() orelse return null;
+            return .{
+                .id = id,
+                .layer = layer,
+                .name = name,
+                .kind = kind,
+                .x = box[0],
+                .y = box[1],
+                .width = box[2],
+                .height = box[3],
+                .property_count = count,
+                .properties = self.data[start..self.pos],
+            };
+        }
+    };
+
+    /// Draw a region of a registered PNG/JPEG (e.g. a sprite-sheet cell), scaled to `w`x`h`
+    /// (the region's size if either is 0).
+    pub fn imageDrawRegion(key: []const u8, sx: i32, sy: i32, sw: u32, sh: u32, x: i32, y: i32, w: u32, h: u32) void {
+        sys.wasm96_graphics_image_draw_region(hashKey(key), sx, sy, sw, sh, x, y, w, h);
     }
-};
 
-/// System API.
-pub const system = struct {
-    /// Log a message to the host console.
-    pub fn log(message: []const u8) void {
-        sys.wasm96_system_log(message.ptr, message.len);
+    /// How `imageDrawEx`/`gifDrawEx` transform a sprite. `pivot` is measured from the unrotated
+    /// top-left; `angle` is radians clockwise. `w`/`h` of 0 means natural size.
+    pub const DrawEx = struct {
+        w: u32 = 0,
+        h: u32 = 0,
+        angle: f32 = 0,
+        flip_x: bool = false,
+        flip_y: bool = false,
+        pivot_x: i32 = 0,
+        pivot_y: i32 = 0,
+
+        fn flags(self: DrawEx) u32 {
+            return @as(u32, @intFromBool(self.flip_x)) | (@as(u32, @intFromBool(self.flip_y)) << 1);
+        }
+    };
+
+    /// Draw a registered PNG/JPEG scaled, mirrored and/or rotated.
+    pub fn imageDrawEx(key: []const u8, x: i32, y: i32, opts: DrawEx) void {
+        sys.wasm96_graphics_image_draw_ex(hashKey(key), x, y, opts.w, opts.h, opts.angle, opts.flags(), opts.pivot_x, opts.pivot_y);
     }
 
-    /// Get the number of milliseconds since the app started.
-    pub fn millis() u64 {
-        return sys.wasm96_system_millis();
+    /// Draw a registered PNG/JPEG as a `w`x`h` nine-slice panel. Borders are in source pixels;
+    /// corners keep their size while edges and center stretch.
+    pub fn imageDrawNineSlice(key: []const u8, x: i32, y: i32, w: u32, h: u32, left: u32, top: u32, right: u32, bottom: u32) void {
+        sys.wasm96_graphics_image_draw_nine_slice(hashKey(key), x, y, w, h, left, top, right, bottom);
+    }
+
+    /// Draw many copies of a registered PNG/JPEG in one host call.
+    pub fn imageDrawBatch(key: []const u8, instances: []const DrawInstance) void {
+        sys.wasm96_graphics_image_draw_batch(hashKey(key), instances.ptr, instances.len);
+    }
+
+    /// Create (or replace) a host-simulated particle system under `key`.
+    pub fn particlesCreate(key: []const u8, config: ParticleConfig) bool {
+        return sys.wasm96_graphics_particles_create(hashKey(key), &config, @sizeOf(ParticleConfig)) != 0;
+    }
+
+    /// Spawn `count` particles at (x, y).
+    pub fn particlesEmit(key: []const u8, x: i32, y: i32, count: u32) void {
+        sys.wasm96_graphics_particles_emit(hashKey(key), x, y, count);
+    }
+
+    /// Step the system by this tick's delta time and draw it. Call once per frame.
+    pub fn particlesUpdateAndDraw(key: []const u8) void {
+        sys.wasm96_graphics_particles_update_and_draw(hashKey(key));
+    }
+
+    pub fn particlesCount(key: []const u8) u32 {
+        return sys.wasm96_graphics_particles_count(hashKey(key));
+    }
+
+    pub fn particlesClear(key: []const u8) void {
+        sys.wasm96_graphics_particles_clear(hashKey(key));
+    }
+
+    pub fn particlesDestroy(key: []const u8) void {
+        sys.wasm96_graphics_particles_destroy(hashKey(key));
+    }
+
+    /// Draw in world coordinates until `cameraReset`: world (x, y) lands at the screen center,
+    /// scaled by `zoom` and rotated by `rotation` radians clockwise.
+    pub fn cameraSet(x: f32, y: f32, zoom: f32, rotation: f32) void {
+        sys.wasm96_graphics_camera_set(x, y, zoom, rotation);
+    }
+
+    /// Keep the view inside a world rectangle; a zero size removes the bounds.
+    pub fn cameraSetBounds(x: i32, y: i32, w: u32, h: u32) void {
+        sys.wasm96_graphics_camera_set_bounds(x, y, w, h);
+    }
+
+    /// Shake the view by up to `magnitude` screen pixels, fading out over `duration_ms`.
+    pub fn cameraShake(magnitude: f32, duration_ms: u32) void {
+        sys.wasm96_graphics_camera_shake(magnitude, duration_ms);
+    }
+
+    /// Go back to screen coordinates.
+    pub fn cameraReset() void {
+        sys.wasm96_graphics_camera_reset();
+    }
+
+    fn unpackPoint(packed: u64) [2]f32 {
+        return .{
+            @bitCast(@as(u32, @truncate(packed >> 32))),
+            @bitCast(@as(u32, @truncate(packed))),
+        };
+    }
+
+    /// The world point under a screen position, through the current camera.
+    pub fn screenToWorld(x: f32, y: f32) [2]f32 {
+        return unpackPoint(sys.wasm96_graphics_screen_to_world(x, y));
+    }
+
+    /// Where a world point lands on screen through the current camera.
+    pub fn worldToScreen(x: f32, y: f32) [2]f32 {
+        return unpackPoint(sys.wasm96_graphics_world_to_screen(x, y));
+    }
+
+    /// Send the following 2D draws to layer `index` (0..16) until `layerEnd`.
+    pub fn layerBegin(index: u32) void {
+        sys.wasm96_graphics_layer_begin(index);
+    }
+
+    /// Go back to drawing on the screen, under every layer.
+    pub fn layerEnd() void {
+        sys.wasm96_graphics_layer_end();
+    }
+
+    pub fn layerSetVisible(index: u32, visible: bool) void {
+        sys.wasm96_graphics_layer_set_visible(index, @intFromBool(visible));
+    }
+
+    /// Fraction of the camera position the layer follows (0 = screen, 1 = world).
+    pub fn layerSetParallax(index: u32, factor: f32) void {
+        sys.wasm96_graphics_layer_set_parallax(index, factor);
+    }
+
+    /// Composite order; lower is further back.
+    pub fn layerSetOrder(index: u32, order: i32) void {
+        sys.wasm96_graphics_layer_set_order(index, order);
+    }
+
+    /// Following 2D draws mark the clip mask's pixels instead of drawing, until `maskEnd`.
+    pub fn maskBegin() void {
+        sys.wasm96_graphics_mask_begin();
+    }
+
+    pub fn maskEnd() void {
+        sys.wasm96_graphics_mask_end();
+    }
+
+    /// Clip following 2D draws to the mask, or to outside it when `invert` is set.
+    pub fn maskUse(invert: bool) void {
+        sys.wasm96_graphics_mask_use(@intFromBool(invert));
+    }
+
+    /// Stop clipping; the mask is kept.
+    pub fn maskOff() void {
+        sys.wasm96_graphics_mask_off();
+    }
+
+    /// Start a new vector path, forgetting the previous one.
+    pub fn pathBegin() void {
+        sys.wasm96_graphics_path_begin();
+    }
+
+    /// Start a subpath at (x, y).
+    pub fn pathMoveTo(x: f32, y: f32) void {
+        sys.wasm96_graphics_path_move_to(x, y);
+    }
+
+    pub fn pathLineTo(x: f32, y: f32) void {
+        sys.wasm96_graphics_path_line_to(x, y);
+    }
+
+    /// Cubic Bézier segment through control points (cx1, cy1) and (cx2, cy2) to (x, y).
+    pub fn pathCurveTo(cx1: f32, cy1: f32, cx2: f32, cy2: f32, x: f32, y: f32) void {
+        sys.wasm96_graphics_path_curve_to(cx1, cy1, cx2, cy2, x, y);
+    }
+
+    /// Join the current subpath back to its start.
+    pub fn pathClose() void {
+        sys.wasm96_graphics_path_close();
+    }
+
+    /// Fill the path with the draw color. The path is kept for `pathStroke`.
+    pub fn pathFill(rule: FillRule) void {
+        sys.wasm96_graphics_path_fill(@intFromEnum(rule));
+    }
+
+    /// Outline the path with the current line width and style.
+    pub fn pathStroke() void {
+        sys.wasm96_graphics_path_stroke();
+    }
+
+    /// Cover the screen with the draw color, then reveal it, over `duration_ms`.
+    pub fn transitionStart(kind: ScreenTransition, duration_ms: u32) void {
+        sys.wasm96_graphics_transition_start(@intFromEnum(kind), duration_ms);
+    }
+
+    pub fn transitionActive() bool {
+        return sys.wasm96_graphics_transition_active() != 0;
+    }
+
+    /// True for the one tick the screen is fully covered; swap scenes then.
+    pub fn transitionMidpoint() bool {
+        return sys.wasm96_graphics_transition_midpoint() != 0;
+    }
+
+    /// Set palette entry `index` to an RGB color.
+    pub fn paletteSet(index: u8, r: u8, g: u8, b: u8) void {
+        sys.wasm96_graphics_palette_set(@as(u32, index), @as(u32, r), @as(u32, g), @as(u32, b));
+    }
+
+    /// Draw index `from` with the color of index `to` until swapped back or reset.
+    pub fn paletteSwap(from: u8, to: u8) void {
+        sys.wasm96_graphics_palette_swap(@as(u32, from), @as(u32, to));
+    }
+
+    /// Choose whether `index` is left out of indexed image draws (only 0 by default).
+    pub fn paletteSetTransparent(index: u8, transparent: bool) void {
+        sys.wasm96_graphics_palette_set_transparent(@as(u32, index), @intFromBool(transparent));
+    }
+
+    /// Undo swaps and restore default transparency; colors are kept.
+    pub fn paletteReset() void {
+        sys.wasm96_graphics_palette_reset();
+    }
+
+    /// Set the drawing color to a palette entry.
+    pub fn setColorIndex(index: u8) void {
+        sys.wasm96_graphics_set_color_index(@as(u32, index));
+    }
+
+    /// Register an image of palette indices (one byte per pixel, row-major).
+    pub fn indexedRegister(key: []const u8, width: u32, height: u32, indices: []const u8) bool {
+        return sys.wasm96_graphics_indexed_register(hashKey(key), width, height, indices.ptr, indices.len) != 0;
+    }
+
+    /// Draw a registered indexed image through the current palette.
+    pub fn indexedDraw(key: []const u8, x: i32, y: i32) void {
+        sys.wasm96_graphics_indexed_draw(hashKey(key), x, y);
+    }
+
+    pub fn indexedUnregister(key: []const u8) void {
+        sys.wasm96_graphics_indexed_unregister(hashKey(key));
+    }
+
+    /// Draw a registered GIF's current frame scaled, mirrored and/or rotated.
+    pub fn gifDrawEx(key: []const u8, x: i32, y: i32, opts: DrawEx) void {
+        sys.wasm96_graphics_gif_draw_ex(hashKey(key), x, y, opts.w, opts.h, opts.angle, opts.flags(), opts.pivot_x, opts.pivot_y);
+    }
+
+    /// Frame-stepped playback over a registered GIF (using its frame delays) or a uniform
+    /// sprite-sheet grid. Call `update(dt)` each tick and `draw(x, y)` to render.
+    pub const Animation = struct {
+        const Source = union(enum) {
+            gif: u64,
+            grid: struct { key: u64, frame_w: u32, frame_h: u32, columns: u32, first: u32 },
+        };
+
+        source: Source,
+        count: u32,
+        frame_millis: u32 = 100,
+        frame: u32 = 0,
+        elapsed_ms: f32 = 0,
+        speed: f32 = 1,
+        playing: bool = true,
+        looping: bool = true,
+
+        /// Animate a registered GIF. Register it first: the frame count is read now.
+        pub fn gif(key: []const u8) Animation {
+            const k = hashKey(key);
+            return .{ .source = .{ .gif = k }, .count = sys.wasm96_graphics_gif_frame_count(k) };
+        }
+
+        /// Animate `count` cells of a sprite sheet, left to right, wrapping after `columns`.
+        pub fn grid(key: []const u8, frame_w: u32, frame_h: u32, columns: u32, first: u32, count: u32, frame_millis: u32) Animation {
+            return .{
+                .source = .{ .grid = .{ .key = hashKey(key), .frame_w = frame_w, .frame_h = frame_h, .columns = @max(columns, 1), .first = first } },
+                .count = count,
+                .frame_millis = frame_millis,
+            };
+        }
+
+        fn duration(self: *const Animation, frame: u32) f32 {
+            const ms = switch (self.source) {
+                .gif => |k| sys.wasm96_graphics_gif_frame_delay(k, frame),
+                .grid => self.frame_millis,
+            };
+            return @floatFromInt(@max(ms, 1));
+        }
+
+        pub fn play(self: *Animation) void {
+            if (self.isFinished()) self.restart();
+            self.playing = true;
+        }
+
+        pub fn pause(self: *Animation) void {
+            self.playing = false;
+        }
+
+        pub fn restart(self: *Animation) void {
+            self.frame = 0;
+            self.elapsed_ms = 0;
+        }
+
+        /// Playback rate multiplier (1 = normal). Negative values count as 0.
+        pub fn setSpeed(self: *Animation, speed: f32) void {
+            self.speed = @max(speed, 0);
+        }
+
+        pub fn setFrame(self: *Animation, frame: u32) void {
+            self.frame = @min(frame, self.count -| 1);
+            self.elapsed_ms = 0;
+        }
+
+        /// True once a non-looping animation has finished its last frame.
+        pub fn isFinished(self: *const Animation) bool {
+            return !self.looping and self.count > 0 and self.frame == self.count - 1 and
+                self.elapsed_ms >= self.duration(self.frame);
+        }
+
+        /// Advance by `dt` seconds.
+        pub fn update(self: *Animation, dt: f32) void {
+            if (!self.playing or self.count == 0) return;
+            self.elapsed_ms += dt * 1000 * self.speed;
+            while (true) {
+                const d = self.duration(self.frame);
+                if (self.elapsed_ms < d) break;
+                if (self.frame + 1 < self.count) {
+                    self.elapsed_ms -= d;
+                    self.frame += 1;
+                } else if (self.looping) {
+                    self.elapsed_ms -= d;
+                    self.frame = 0;
+                } else {
+                    self.elapsed_ms = d;
+                    break;
+                }
+            }
+        }
+
+        /// Draw the current frame at natural size.
+        pub fn draw(self: *const Animation, x: i32, y: i32) void {
+            self.drawScaled(x, y, 0, 0);
+        }
+
+        /// Draw the current frame scaled to `w`x`h` (natural size if either is 0).
+        pub fn drawScaled(self: *const Animation, x: i32, y: i32, w: u32, h: u32) void {
+            switch (self.source) {
+                .gif => |k| sys.wasm96_graphics_gif_draw_frame(k, self.frame, x, y, w, h),
+                .grid => |g| {
+                    const cell = g.first + self.frame;
+                    const sx: i32 = @intCast((cell % g.columns) * g.frame_w);
+                    const sy: i32 = @intCast((cell / g.columns) * g.frame_h);
+                    sys.wasm96_graphics_image_draw_region(g.key, sx, sy, g.frame_w, g.frame_h, x, y, w, h);
+                },
+            }
+        }
+    };
+
+    /// Register a PNG resource under a string key.
+    pub fn pngRegister(key: []const u8, data: []const u8) bool {
+        return sys.wasm96_graphics_png_register(hashKey(key), data.ptr, data.len) != 0;
+    }
+
+    pub fn jpegRegister(key: []const u8, data: []const u8) bool {
+        return sys.wasm96_graphics_jpeg_register(hashKey(key), data.ptr, data.len) != 0;
+    }
+
+    /// Register a PNG or JPEG under `key`, decoded in the background. Returns a load handle for
+    /// `system.isReady` (null if the bytes couldn't be handed over); the key draws nothing until then.
+    pub fn imageRegisterAsync(key: []const u8, data: []const u8) ?u32 {
+        const handle = sys.wasm96_graphics_image_register_async(hashKey(key), data.ptr, data.len);
+        return if (handle == 0) null else handle;
+    }
+
+    /// Draw a registered PNG by key at natural size.
+    pub fn pngDrawKey(key: []const u8, x: i32, y: i32) void {
+        sys.wasm96_graphics_png_draw_key(hashKey(key), x, y);
+    }
+
+    pub fn jpegDrawKey(key: []const u8, x: i32, y: i32) void {
+        sys.wasm96_graphics_jpeg_draw_key(hashKey(key), x, y);
+    }
+
+    /// Draw a registered PNG by key scaled.
+    pub fn pngDrawKeyScaled(key: []const u8, x: i32, y: i32, w: u32, h: u32) void {
+        sys.wasm96_graphics_png_draw_key_scaled(hashKey(key), x, y, w, h);
+    }
+
+    pub fn jpegDrawKeyScaled(key: []const u8, x: i32, y: i32, w: u32, h: u32) void {
+        sys.wasm96_graphics_jpeg_draw_key_scaled(hashKey(key), x, y, w, h);
+    }
+
+    /// Unregister a PNG by key.
+    pub fn pngUnregister(key: []const u8) void {
+        sys.wasm96_graphics_png_unregister(hashKey(key));
+    }
+
+    pub fn jpegUnregister(key: []const u8) void {
+        sys.wasm96_graphics_jpeg_unregister(hashKey(key));
+    }
+
+    /// Register a TTF font under a string key.
+    pub fn fontRegisterTtf(key: []const u8, data: []const u8) bool {
+        return sys.wasm96_graphics_font_register_ttf(hashKey(key), data.ptr, data.len) != 0;
+    }
+
+    /// Register a BDF font under a string key.
+    pub fn fontRegisterBdf(key: []const u8, data: []const u8) bool {
+        return sys.wasm96_graphics_font_register_bdf(hashKey(key), data.ptr, data.len) != 0;
+    }
+
+    /// Register an AngelCode BMFont (text `.fnt`) whose page image is registered under `atlas_key`.
+    pub fn fontRegisterFnt(key: []const u8, fnt: []const u8, atlas_key: []const u8) bool {
+        return sys.wasm96_graphics_font_register_fnt(hashKey(key), fnt.ptr, fnt.len, hashKey(atlas_key)) != 0;
+    }
+
+    /// Register a built-in Spleen font under a string key.
+    pub fn fontRegisterSpleen(key: []const u8, size: u32) bool {
+        return sys.wasm96_graphics_font_register_spleen(hashKey(key), size) != 0;
+    }
+
+    /// Unregister a font by key.
+    pub fn fontUnregister(key: []const u8) void {
+        sys.wasm96_graphics_font_unregister(hashKey(key));
+    }
+
+    /// Draw characters the `primary` font lacks with the `fallback` font (up to 8 per font,
+    /// tried in order). False if either isn't registered or there is no room left.
+    pub fn fontAddFallback(primary: []const u8, fallback: []const u8) bool {
+        return sys.wasm96_graphics_font_add_fallback(hashKey(primary), hashKey(fallback)) != 0;
+    }
+
+    /// Draw text using a font referenced by key.
+    pub fn textKey(x: i32, y: i32, font_key: []const u8, string: []const u8) void {
+        sys.wasm96_graphics_text_key(x, y, hashKey(font_key), string.ptr, string.len);
+    }
+
+    /// Measure text using a font referenced by key.
+    pub fn textMeasureKey(font_key: []const u8, str: []const u8) TextSize {
+        const result = sys.wasm96_graphics_text_measure_key(hashKey(font_key), str.ptr, str.len);
+        return TextSize{
+            .width = @as(u32, @intCast(result >> 32)),
+            .height = @as(u32, @intCast(result & 0xFFFFFFFF)),
+        };
+    }
+
+    /// Draw text at `size_px` pixels with one registered font. TTF is rasterized at that size,
+    /// bitmap fonts are scaled; 0 uses the font's native size.
+    pub fn textSized(x: i32, y: i32, font_key: []const u8, size_px: u32, string: []const u8) void {
+        sys.wasm96_graphics_text_sized_key(x, y, hashKey(font_key), size_px, string.ptr, string.len);
+    }
+
+    /// Measure text as `textSized` draws it.
+    pub fn textMeasureSized(font_key: []const u8, size_px: u32, str: []const u8) TextSize {
+        const result = sys.wasm96_graphics_text_measure_sized_key(hashKey(font_key), size_px, str.ptr, str.len);
+        return TextSize{
+            .width = @as(u32, @intCast(result >> 32)),
+            .height = @as(u32, @intCast(result & 0xFFFFFFFF)),
+        };
+    }
+
+    /// Width of `str[0..byte_offset]` (the caret x before that byte).
+    pub fn textMeasureUpTo(font_key: []const u8, str: []const u8, byte_offset: u32) u32 {
+        return sys.wasm96_graphics_text_measure_up_to_key(hashKey(font_key), str.ptr, str.len, byte_offset);
+    }
+
+    /// Ascent, descent and line gap of a keyed font.
+    pub fn fontMetrics(font_key: []const u8) FontMetrics {
+        const result = sys.wasm96_graphics_font_metrics_key(hashKey(font_key));
+        return FontMetrics{
+            .ascent = @as(u32, @intCast((result >> 32) & 0xFFFF)),
+            .descent = @as(u32, @intCast((result >> 16) & 0xFFFF)),
+            .line_gap = @as(u32, @intCast(result & 0xFFFF)),
+        };
+    }
+
+    /// Multiply the size of all text drawn and measured from now on, and of `fontMetrics`.
+    /// Clamped to 0.25..=8; 1.0 restores normal sizes. Pass
+    /// `system.accessibilitySettings().text_scale` to honor the player's preference.
+    pub fn setTextScale(multiplier: f32) void {
+        sys.wasm96_graphics_set_text_scale(multiplier);
+    }
+
+    /// Register a TTF/OTF font drawn through signed distance fields, sharp at any size and
+    /// angle. Works with every keyed text function; `textSdf` adds rotation and effects.
+    pub fn fontRegisterTtfSdf(key: []const u8, data: []const u8) bool {
+        return sys.wasm96_graphics_font_register_ttf_sdf(hashKey(key), data.ptr, data.len) != 0;
+    }
+
+    /// Draw text with an SDF font, rotated `angle` radians clockwise around its top-left.
+    pub fn textSdf(x: f32, y: f32, font_key: []const u8, size_px: f32, angle: f32, string: []const u8, style: TextStyle) void {
+        sys.wasm96_graphics_text_sdf_key(x, y, hashKey(font_key), size_px, angle, string.ptr, string.len, &style);
+    }
+
+    /// Why a resource failed to register.
+    pub const ResourceError = error{ GuestMemory, InvalidData, MissingDependency, Unsupported, Unknown };
+
+    /// The error behind the most recent failed register call.
+    pub fn lastError() ResourceError {
+        return switch (sys.wasm96_graphics_last_error()) {
+            1 => error.GuestMemory,
+            2 => error.InvalidData,
+            3 => error.MissingDependency,
+            4 => error.Unsupported,
+            else => error.Unknown,
+        };
+    }
+
+    /// A registered SVG. `load` reports why registration failed; `close` unregisters it.
+    pub const SvgHandle = struct {
+        key: u64,
+
+        pub fn load(key: []const u8, data: []const u8) ResourceError!SvgHandle {
+            if (!svgRegister(key, data)) return lastError();
+            return .{ .key = hashKey(key) };
+        }
+
+        pub fn draw(self: SvgHandle, x: i32, y: i32, w: u32, h: u32) void {
+            sys.wasm96_graphics_svg_draw_key(self.key, x, y, w, h);
+        }
+
+        pub fn size(self: SvgHandle) [2]u32 {
+            const packed = sys.wasm96_graphics_svg_size(self.key);
+            return .{ @truncate(packed >> 32), @truncate(packed) };
+        }
+
+        pub fn setFill(self: SvgHandle, selector: []const u8, color: Color) u32 {
+            return sys.wasm96_graphics_svg_set_fill(self.key, selector.ptr, selector.len, color.toU32());
+        }
+
+        pub fn close(self: SvgHandle) void {
+            sys.wasm96_graphics_svg_unregister(self.key);
+        }
+    };
+
+    /// A registered animated GIF.
+    pub const GifHandle = struct {
+        key: u64,
+
+        pub fn load(key: []const u8, data: []const u8) ResourceError!GifHandle {
+            if (!gifRegister(key, data)) return lastError();
+            return .{ .key = hashKey(key) };
+        }
+
+        pub fn draw(self: GifHandle, x: i32, y: i32) void {
+            sys.wasm96_graphics_gif_draw_key(self.key, x, y);
+        }
+
+        pub fn drawScaled(self: GifHandle, x: i32, y: i32, w: u32, h: u32) void {
+            sys.wasm96_graphics_gif_draw_key_scaled(self.key, x, y, w, h);
+        }
+
+        pub fn frameCount(self: GifHandle) u32 {
+            return sys.wasm96_graphics_gif_frame_count(self.key);
+        }
+
+        pub fn setFrame(self: GifHandle, frame: u32) void {
+            sys.wasm96_graphics_gif_set_frame(self.key, frame);
+        }
+
+        pub fn setSpeed(self: GifHandle, multiplier: f32) void {
+            sys.wasm96_graphics_gif_set_speed(self.key, multiplier);
+        }
+
+        pub fn pause(self: GifHandle, paused: bool) void {
+            sys.wasm96_graphics_gif_pause(self.key, @intFromBool(paused));
+        }
+
+        pub fn close(self: GifHandle) void {
+            sys.wasm96_graphics_gif_unregister(self.key);
+        }
+    };
+
+    /// A registered font.
+    pub const FontHandle = struct {
+        key: u64,
+
+        pub fn loadTtf(key: []const u8, data: []const u8) ResourceError!FontHandle {
+            if (!fontRegisterTtf(key, data)) return lastError();
+            return .{ .key = hashKey(key) };
+        }
+
+        pub fn loadBdf(key: []const u8, data: []const u8) ResourceError!FontHandle {
+            if (!fontRegisterBdf(key, data)) return lastError();
+            return .{ .key = hashKey(key) };
+        }
+
+        pub fn loadFnt(key: []const u8, fnt: []const u8, atlas_key: []const u8) ResourceError!FontHandle {
+            if (!fontRegisterFnt(key, fnt, atlas_key)) return lastError();
+            return .{ .key = hashKey(key) };
+        }
+
+        pub fn spleen(key: []const u8, size: u32) ResourceError!FontHandle {
+            if (!fontRegisterSpleen(key, size)) return lastError();
+            return .{ .key = hashKey(key) };
+        }
+
+        pub fn text(self: FontHandle, x: i32, y: i32, string: []const u8) void {
+            sys.wasm96_graphics_text_key(x, y, self.key, string.ptr, string.len);
+        }
+
+        pub fn measure(self: FontHandle, string: []const u8) TextSize {
+            const result = sys.wasm96_graphics_text_measure_key(self.key, string.ptr, string.len);
+            return TextSize{
+                .width = @as(u32, @intCast(result >> 32)),
+                .height = @as(u32, @intCast(result & 0xFFFFFFFF)),
+            };
+        }
+
+        pub fn textSized(self: FontHandle, x: i32, y: i32, size_px: u32, string: []const u8) void {
+            sys.wasm96_graphics_text_sized_key(x, y, self.key, size_px, string.ptr, string.len);
+        }
+
+        pub fn measureSized(self: FontHandle, size_px: u32, string: []const u8) TextSize {
+            const result = sys.wasm96_graphics_text_measure_sized_key(self.key, size_px, string.ptr, string.len);
+            return TextSize{
+                .width = @as(u32, @intCast(result >> 32)),
+                .height = @as(u32, @intCast(result & 0xFFFFFFFF)),
+            };
+        }
+
+        pub fn metrics(self: FontHandle) FontMetrics {
+            const result = sys.wasm96_graphics_font_metrics_key(self.key);
+            return FontMetrics{
+                .ascent = @as(u32, @intCast((result >> 32) & 0xFFFF)),
+                .descent = @as(u32, @intCast((result >> 16) & 0xFFFF)),
+                .line_gap = @as(u32, @intCast(result & 0xFFFF)),
+            };
+        }
+
+        pub fn addFallback(self: FontHandle, fallback: FontHandle) ResourceError!void {
+            if (sys.wasm96_graphics_font_add_fallback(self.key, fallback.key) == 0) return lastError();
+        }
+
+        pub fn close(self: FontHandle) void {
+            sys.wasm96_graphics_font_unregister(self.key);
+        }
+    };
+};
+
+/// Input API.
+pub const input = struct {
+    /// Returns true if the specified button is currently held down.
+    pub fn isButtonDown(port: u32, btn: Button) bool {
+        return sys.wasm96_input_is_button_down(port, @intFromEnum(btn)) != 0;
+    }
+
+    /// Returns true if the specified key is currently held down.
+    pub fn isKeyDown(key: u32) bool {
+        return sys.wasm96_input_is_key_down(key) != 0;
+    }
+
+    /// Get current mouse X position.
+    pub fn getMouseX() i32 {
+        return sys.wasm96_input_get_mouse_x();
+    }
+
+    /// Get current mouse Y position.
+    pub fn getMouseY() i32 {
+        return sys.wasm96_input_get_mouse_y();
+    }
+
+    /// Returns true if the specified mouse button is held down.
+    /// 0 = Left, 1 = Right, 2 = Middle.
+    pub fn isMouseDown(btn: u32) bool {
+        return sys.wasm96_input_is_mouse_down(btn) != 0;
+    }
+
+    /// Bitmask of ports with a controller connected (bit N = port N).
+    pub fn getConnectedPorts() u32 {
+        return sys.wasm96_input_get_connected_ports();
+    }
+
+    /// Returns true if a controller is connected to `port`.
+    pub fn isConnected(port: u32) bool {
+        return port < 32 and (getConnectedPorts() & (@as(u32, 1) << @intCast(port))) != 0;
+    }
+
+    /// Name of the controller in `port` (owned by `allocator`), or null if nothing is connected.
+    pub fn getControllerName(allocator: std.mem.Allocator, port: u32) !?[]u8 {
+        return system.takeBlob(allocator, sys.wasm96_input_get_controller_name(port));
+    }
+
+    /// Returns true for the one frame after a controller was connected, removed, or swapped.
+    pub fn portsChanged() bool {
+        return sys.wasm96_input_ports_changed() != 0;
+    }
+
+    /// Milliseconds `btn` on `port` has been held; 0 on the tick it went down and while released.
+    pub fn buttonHeldMillis(port: u32, btn: Button) u32 {
+        return sys.wasm96_input_button_held_millis(port, @intFromEnum(btn));
+    }
+
+    /// Milliseconds `key` has been held; 0 on the tick it went down and while released.
+    pub fn keyHeldMillis(key: u32) u32 {
+        return sys.wasm96_input_key_held_millis(key);
+    }
+
+    /// True on the tick `btn` goes down, then after `initial_delay_ms` and every `interval_ms`
+    /// while held (auto-repeat for menus).
+    pub fn buttonRepeat(port: u32, btn: Button, initial_delay_ms: u32, interval_ms: u32) bool {
+        return repeatFires(isButtonDown(port, btn), buttonHeldMillis(port, btn), initial_delay_ms, interval_ms);
+    }
+
+    /// `buttonRepeat` for a keyboard key.
+    pub fn keyRepeat(key: u32, initial_delay_ms: u32, interval_ms: u32) bool {
+        return repeatFires(isKeyDown(key), keyHeldMillis(key), initial_delay_ms, interval_ms);
+    }
+
+    /// The whole input state for one tick, read with a single import call by `snapshot`.
+    pub const Snapshot = struct {
+        bytes: [144]u8 = [_]u8{0} ** 144,
+
+        fn portMask(self: *const Snapshot, offset: usize, port: u32) u16 {
+            if (port >= 8) return 0;
+            const i = offset + @as(usize, port) * 2;
+            return std.mem.readInt(u16, self.bytes[i..][0..2], .little);
+        }
+
+        fn word(self: *const Snapshot, offset: usize) u32 {
+            return std.mem.readInt(u32, self.bytes[offset..][0..4], .little);
+        }
+
+        fn keyBit(self: *const Snapshot, offset: usize, key: u32) bool {
+            if (key >= 48 * 8) return false;
+            const bit: u3 = @intCast(key % 8);
+            return self.bytes[offset + key / 8] & (@as(u8, 1) << bit) != 0;
+        }
+
+        /// Buttons held on `port`, bit N = `Button` N.
+        pub fn buttons(self: *const Snapshot, port: u32) u16 {
+            return self.portMask(0, port);
+        }
+
+        pub fn isButtonDown(self: *const Snapshot, port: u32, btn: Button) bool {
+            return self.buttons(port) & (@as(u16, 1) << @intCast(@intFromEnum(btn))) != 0;
+        }
+
+        /// True if `btn` on `port` went down this tick.
+        pub fn isButtonPressed(self: *const Snapshot, port: u32, btn: Button) bool {
+            return self.portMask(16, port) & (@as(u16, 1) << @intCast(@intFromEnum(btn))) != 0;
+        }
+
+        pub fn connectedPorts(self: *const Snapshot) u32 {
+            return self.word(32);
+        }
+
+        pub fn isConnected(self: *const Snapshot, port: u32) bool {
+            return port < 32 and (self.connectedPorts() & (@as(u32, 1) << @intCast(port))) != 0;
+        }
+
+        pub fn mouseX(self: *const Snapshot) i32 {
+            return @bitCast(self.word(36));
+        }
+
+        pub fn mouseY(self: *const Snapshot) i32 {
+            return @bitCast(self.word(40));
+        }
+
+        /// 0 = Left, 1 = Right, 2 = Middle.
+        pub fn isMouseDown(self: *const Snapshot, btn: u32) bool {
+            return btn < 32 and (self.word(44) & (@as(u32, 1) << @intCast(btn))) != 0;
+        }
+
+        pub fn isKeyDown(self: *const Snapshot, key: u32) bool {
+            return self.keyBit(48, key);
+        }
+
+        /// True if `key` went down this tick.
+        pub fn isKeyPressed(self: *const Snapshot, key: u32) bool {
+            return self.keyBit(96, key);
+        }
+    };
+
+    /// Read every button, key and the mouse for this tick in one call.
+    pub fn snapshot() Snapshot {
+        var snap = Snapshot{};
+        if (sys.wasm96_input_snapshot(&snap.bytes, snap.bytes.len) == 0) return .{};
+        return snap;
+    }
+
+    fn repeatFires(down: bool, held: u32, delay: u32, interval: u32) bool {
+        if (!down) return false;
+        if (held == 0) return true;
+        const dt: u32 = @intCast(@min(system.deltaMillis(), std.math.maxInt(u32)));
+        return repeatsDue(held, delay, interval) > repeatsDue(held -| dt, delay, interval);
+    }
+
+    fn repeatsDue(t: u32, delay: u32, interval: u32) u32 {
+        if (t < delay) return 0;
+        if (interval == 0) return 1;
+        return 1 + (t - delay) / interval;
+    }
+
+    pub const TouchPhase = enum(u32) {
+        began = 0,
+        moved = 1,
+        stationary = 2,
+        /// The finger lifted since the last frame; reported once, at its last position.
+        ended = 3,
+    };
+
+    /// A touch point in screen pixels.
+    pub const Touch = struct {
+        /// Stable while the finger stays down; never reused.
+        id: u32,
+        x: i32,
+        y: i32,
+        phase: TouchPhase,
+    };
+
+    /// Number of touches this frame (including ones that just ended).
+    pub fn getTouchCount() u32 {
+        return sys.wasm96_input_get_touch_count();
+    }
+
+    /// Touch `index` (`0..getTouchCount()`) this frame.
+    pub fn getTouch(index: u32) ?Touch {
+        const id = sys.wasm96_input_get_touch_id(index);
+        if (id == 0) return null;
+        const phase: TouchPhase = switch (sys.wasm96_input_get_touch_phase(index)) {
+            0 => .began,
+            1 => .moved,
+            2 => .stationary,
+            else => .ended,
+        };
+        return Touch{
+            .id = id,
+            .x = sys.wasm96_input_get_touch_x(index),
+            .y = sys.wasm96_input_get_touch_y(index),
+            .phase = phase,
+        };
+    }
+
+    /// Mirror the first touch to the mouse position and left button (on by default).
+    pub fn setTouchMouse(enabled: bool) void {
+        sys.wasm96_input_set_touch_mouse(@intFromBool(enabled));
+    }
+
+    /// Start collecting typed text (e.g. when a name-entry field gains focus).
+    pub fn textInputStart() void {
+        sys.wasm96_input_text_input_start();
+    }
+
+    /// Stop collecting typed text; anything not yet read is dropped.
+    pub fn textInputStop() void {
+        sys.wasm96_input_text_input_stop();
+    }
+
+    /// UTF-8 text typed since the last call (owned by `allocator`), or null if none.
+    /// Backspace arrives as 0x08 and Enter as '\n'.
+    pub fn getTextInput(allocator: std.mem.Allocator) !?[]u8 {
+        return system.takeBlob(allocator, sys.wasm96_input_get_text_input());
+    }
+
+    /// Start recording the input seen on each tick. Reseeds the host RNG and stores the seed.
+    pub fn recordStart() void {
+        sys.wasm96_input_record_start();
+    }
+
+    /// Stop recording and return the trace (caller frees), or null if not recording.
+    pub fn recordStop(allocator: std.mem.Allocator) !?[]u8 {
+        return system.takeBlob(allocator, sys.wasm96_input_record_stop());
+    }
+
+    /// Replay a trace in place of live input, starting next tick. False if it isn't a trace.
+    pub fn replay(trace: []const u8) bool {
+        return sys.wasm96_input_replay(trace.ptr, trace.len) != 0;
+    }
+
+    /// True while a replay is playing; live input resumes when it ends.
+    pub fn isReplaying() bool {
+        return sys.wasm96_input_is_replaying() != 0;
+    }
+};
+
+/// Audio API.
+pub const audio = struct {
+    /// Initialize audio system.
+    pub fn init(sample_rate: u32) u32 {
+        return sys.wasm96_audio_init(sample_rate);
+    }
+
+    /// Push a chunk of audio samples.
+    /// Samples are interleaved stereo (L, R, L, R...) signed 16-bit integers.
+    pub fn pushSamples(samples: []const i16) void {
+        sys.wasm96_audio_push_samples(samples.ptr, samples.len);
+    }
+
+    /// Number of pushed samples (i16 values, not frames) still waiting to be played.
+    pub fn getQueuedSamples() u32 {
+        return sys.wasm96_audio_get_queued_samples();
+    }
+
+    /// Capacity of the push queue in i16 samples. Samples pushed beyond it are dropped.
+    pub fn getBufferCapacity() u32 {
+        return sys.wasm96_audio_get_buffer_capacity();
+    }
+
+    /// Play a WAV file.
+    /// The WAV data is decoded and played as a one-shot audio channel.
+    pub fn playWav(data: []const u8) void {
+        sys.wasm96_audio_play_wav(data.ptr, data.len);
+    }
+
+    /// Play a QOA file.
+    /// The QOA data is decoded and played as a looping audio channel.
+    pub fn playQoa(data: []const u8) void {
+        sys.wasm96_audio_play_qoa(data.ptr, data.len);
+    }
+
+    /// Play an XM file.
+    /// The XM data is decoded using xmrsplayer and played as a looping audio channel.
+    pub fn playXm(data: []const u8) void {
+        sys.wasm96_audio_play_xm(data.ptr, data.len);
+    }
+
+    /// A position in tracker music: index into the song's order table, and row within it.
+    pub const XmPosition = struct {
+        order: u16,
+        row: u16,
+    };
+
+    /// A playing XM song with playback control.
+    pub const XmSong = struct {
+        handle: u32,
+
+        /// Start playing an XM module (looping). Returns null if it can't be decoded.
+        pub fn play(data: []const u8) ?XmSong {
+            const handle = sys.wasm96_audio_xm_play(data.ptr, data.len);
+            if (handle == 0) return null;
+            return .{ .handle = handle };
+        }
+
+        pub fn stop(self: XmSong) void {
+            sys.wasm96_audio_xm_stop(self.handle);
+        }
+
+        pub fn pause(self: XmSong) void {
+            sys.wasm96_audio_xm_pause(self.handle, 1);
+        }
+
+        pub fn unpause(self: XmSong) void {
+            sys.wasm96_audio_xm_pause(self.handle, 0);
+        }
+
+        /// Jump to the start of a row. Returns false if the song never reaches it.
+        pub fn setPosition(self: XmSong, pos: XmPosition) bool {
+            return sys.wasm96_audio_xm_set_position(self.handle, pos.order, pos.row) != 0;
+        }
+
+        /// The row currently playing.
+        pub fn position(self: XmSong) XmPosition {
+            const packed_pos = sys.wasm96_audio_xm_get_position(self.handle);
+            return .{ .order = @truncate(packed_pos >> 16), .row = @truncate(packed_pos) };
+        }
+
+        /// Loop from the start of `end` back to `start`. Pass null to loop at the song's end.
+        pub fn setLoop(self: XmSong, start: XmPosition, end: ?XmPosition) bool {
+            const end_order: u32 = if (end) |e| e.order else std.math.maxInt(u32);
+            const end_row: u32 = if (end) |e| e.row else std.math.maxInt(u32);
+            return sys.wasm96_audio_xm_set_loop(self.handle, start.order, start.row, end_order, end_row) != 0;
+        }
+
+        /// Enable or disable looping. A non-looping song stops at its end (or loop end).
+        pub fn setLooping(self: XmSong, enabled: bool) void {
+            sys.wasm96_audio_xm_set_looping(self.handle, @intFromBool(enabled));
+        }
+
+        /// Move the song to another mixer group (songs start in `group_music`).
+        pub fn setGroup(self: XmSong, group: u32) void {
+            sys.wasm96_audio_xm_set_group(self.handle, group);
+        }
+
+        /// Set the stereo position (-1.0 = left, 0.0 = centre, 1.0 = right).
+        pub fn setPan(self: XmSong, pan: f32) void {
+            sys.wasm96_audio_set_pan(self.handle, pan);
+        }
+
+        /// Set the playback speed ratio; tempo and key change together.
+        pub fn setPitch(self: XmSong, ratio: f32) void {
+            sys.wasm96_audio_set_pitch(self.handle, ratio);
+        }
+
+        /// Send some of the song (0.0..=1.0) to a mixer effect.
+        pub fn setSend(self: XmSong, effect: Effect, level: f32) void {
+            sys.wasm96_audio_set_send(self.handle, @intFromEnum(effect), level);
+        }
+    };
+
+    /// Compressed formats `Music` can stream.
+    pub const MusicFormat = enum(u32) {
+        ogg_vorbis = 0,
+    };
+
+    /// A long music track decoded on the host while it plays. Call `deinit` to free it.
+    pub const Music = struct {
+        handle: u32,
+
+        /// Load a track (paused, looping, in `group_music`); the host copies `data`.
+        /// Returns null if it can't be decoded.
+        pub fn init(data: []const u8, format: MusicFormat) ?Music {
+            const handle = sys.wasm96_audio_music_create(data.ptr, data.len, @intFromEnum(format));
+            if (handle == 0) return null;
+            return .{ .handle = handle };
+        }
+
+        /// Start a Standard MIDI File played with `font` (playing, looping, in `group_music`).
+        /// Returns null if the file can't be parsed.
+        pub fn playMidi(data: []const u8, font: SoundFont) ?Music {
+            const handle = sys.wasm96_audio_midi_play(data.ptr, data.len, font.id);
+            if (handle == 0) return null;
+            return .{ .handle = handle };
+        }
+
+        pub fn deinit(self: Music) void {
+            sys.wasm96_audio_music_destroy(self.handle);
+        }
+
+        pub fn play(self: Music) void {
+            sys.wasm96_audio_music_play(self.handle);
+        }
+
+        pub fn pause(self: Music) void {
+            sys.wasm96_audio_music_pause(self.handle);
+        }
+
+        /// Stop and rewind to the start.
+        pub fn stop(self: Music) void {
+            sys.wasm96_audio_music_stop(self.handle);
+        }
+
+        /// Jump to `millis` from the start (Ogg Vorbis lands a little early, on a page start).
+        pub fn seek(self: Music, millis: u32) bool {
+            return sys.wasm96_audio_music_seek(self.handle, millis) != 0;
+        }
+
+        pub fn positionMillis(self: Music) u32 {
+            return sys.wasm96_audio_music_position(self.handle);
+        }
+
+        pub fn setVolume(self: Music, vol: f32) void {
+            sys.wasm96_audio_music_set_volume(self.handle, vol);
+        }
+
+        pub fn setLooping(self: Music, enabled: bool) void {
+            sys.wasm96_audio_music_set_looping(self.handle, @intFromBool(enabled));
+        }
+
+        pub fn setGroup(self: Music, group: u32) void {
+            sys.wasm96_audio_music_set_group(self.handle, group);
+        }
+
+        /// Fade this track out (stopping it) while `next` starts and fades in.
+        pub fn crossfadeTo(self: Music, next: Music, millis: u32) void {
+            sys.wasm96_audio_music_crossfade(self.handle, next.handle, millis);
+        }
+
+        pub fn fadeIn(self: Music, millis: u32) void {
+            sys.wasm96_audio_music_crossfade(0, self.handle, millis);
+        }
+
+        pub fn fadeOut(self: Music, millis: u32) void {
+            sys.wasm96_audio_music_crossfade(self.handle, 0, millis);
+        }
+
+        /// Speed a MIDI track up or down (1.0 = as written, 0.1..4.0) without changing pitch.
+        pub fn setTempo(self: Music, scale: f32) void {
+            sys.wasm96_audio_midi_set_tempo(self.handle, scale);
+        }
+
+        /// Volume (0.0..1.0) of one channel of a MIDI track (0..15; 9 is drums).
+        pub fn setChannelVolume(self: Music, channel: u32, vol: f32) void {
+            sys.wasm96_audio_midi_set_channel_volume(self.handle, channel, vol);
+        }
+    };
+
+    /// A SoundFont 2 (`.sf2`) bank for `Music.playMidi`. Call `deinit` to free it; tracks
+    /// already using it keep playing.
+    pub const SoundFont = struct {
+        id: u32,
+
+        /// Load a bank; the host copies `data`. Returns null if it isn't a SoundFont 2 file.
+        pub fn init(data: []const u8) ?SoundFont {
+            const id = sys.wasm96_audio_soundfont_create(data.ptr, data.len);
+            if (id == 0) return null;
+            return .{ .id = id };
+        }
+
+        pub fn deinit(self: SoundFont) void {
+            sys.wasm96_audio_soundfont_destroy(self.id);
+        }
+    };
+
+    /// What a `SoundPool` does with a new play when every voice is busy.
+    pub const StealPolicy = enum(u32) {
+        oldest = 0,
+        quietest = 1,
+        none = 2,
+    };
+
+    /// One sound effect (WAV or QOA) decoded once and played on a capped number of voices.
+    /// Call `deinit` to free it.
+    pub const SoundPool = struct {
+        handle: u32,
+        /// Made with `initAsync`, so `handle` is also a load handle.
+        loading: bool = false,
+
+        /// Decode `data` (copied by the host) for up to `max_voices` (1..=32) overlapping plays,
+        /// in `group_sfx`. Returns null if it can't be decoded.
+        pub fn init(data: []const u8, max_voices: u32, steal: StealPolicy) ?SoundPool {
+            const handle = sys.wasm96_audio_sound_pool_create(data.ptr, data.len, max_voices, @intFromEnum(steal));
+            if (handle == 0) return null;
+            return .{ .handle = handle };
+        }
+
+        /// Like `init`, but decodes in the background and returns at once. Plays are dropped
+        /// until `isReady`.
+        pub fn initAsync(data: []const u8, max_voices: u32, steal: StealPolicy) ?SoundPool {
+            const handle = sys.wasm96_audio_sound_pool_create_async(data.ptr, data.len, max_voices, @intFromEnum(steal));
+            if (handle == 0) return null;
+            return .{ .handle = handle, .loading = true };
+        }
+
+        /// Whether the sound has finished loading (always true for `init`).
+        pub fn isReady(self: SoundPool) bool {
+            return !self.loading or system.isReady(self.handle);
+        }
+
+        pub fn deinit(self: SoundPool) void {
+            sys.wasm96_audio_sound_pool_destroy(self.handle);
+        }
+
+        /// Play at `vol` (0.0..=1.0) and `pan` (-1.0 = left, 1.0 = right). Returns false if dropped.
+        pub fn play(self: SoundPool, vol: f32, pan: f32) bool {
+            return sys.wasm96_audio_sound_pool_play(self.handle, vol, pan) != 0;
+        }
+
+        /// Vary each play's pitch by up to `amount` either way (0.05 = +/-5%, max 0.5).
+        pub fn setPitchVariation(self: SoundPool, amount: f32) void {
+            sys.wasm96_audio_sound_pool_set_pitch_variation(self.handle, amount);
+        }
+
+        pub fn setGroup(self: SoundPool, group: u32) void {
+            sys.wasm96_audio_sound_pool_set_group(self.handle, group);
+        }
+
+        pub fn activeVoices(self: SoundPool) u32 {
+            return sys.wasm96_audio_sound_pool_active(self.handle);
+        }
+
+        pub fn stop(self: SoundPool) void {
+            sys.wasm96_audio_sound_pool_stop(self.handle);
+        }
+    };
+
+    /// Default mixer group for WAV/QOA playback and synth voices.
+    pub const group_sfx: u32 = 0;
+    /// Default mixer group for XM songs.
+    pub const group_music: u32 = 1;
+
+    /// Set the volume of everything the core outputs (0.0..=1.0).
+    pub fn setMasterVolume(vol: f32) void {
+        sys.wasm96_audio_set_master_volume(vol);
+    }
+
+    pub fn getMasterVolume() f32 {
+        return sys.wasm96_audio_get_master_volume();
+    }
+
+    /// Set a mixer group's volume (0.0..=1.0); groups are 0..8.
+    pub fn setGroupVolume(group: u32, vol: f32) void {
+        sys.wasm96_audio_set_group_volume(group, vol);
+    }
+
+    pub fn getGroupVolume(group: u32) f32 {
+        return sys.wasm96_audio_get_group_volume(group);
+    }
+
+    /// A sound started with `playWavAt` or `playWavPitched`. It plays once; the handle only
+    /// adjusts it.
+    pub const Sound = struct {
+        handle: u32,
+
+        /// Set the stereo position (-1.0 = left, 0.0 = centre, 1.0 = right).
+        pub fn setPan(self: Sound, pan: f32) void {
+            sys.wasm96_audio_set_pan(self.handle, pan);
+        }
+
+        /// Set the playback speed ratio (2.0 = an octave up and twice as fast; 0.125..=8.0).
+        pub fn setPitch(self: Sound, ratio: f32) void {
+            sys.wasm96_audio_set_pitch(self.handle, ratio);
+        }
+
+        /// Send some of the sound (0.0..=1.0) to a mixer effect.
+        pub fn setSend(self: Sound, effect: Effect, level: f32) void {
+            sys.wasm96_audio_set_send(self.handle, @intFromEnum(effect), level);
+        }
+    };
+
+    /// Set the listener position for positional playback, in screen coordinates.
+    /// Until this is called, the listener is at the centre of the screen.
+    pub fn setListener(x: f32, y: f32) void {
+        sys.wasm96_audio_set_listener(x, y);
+    }
+
+    /// Play a WAV once at a screen position, panned and attenuated relative to the listener.
+    pub fn playWavAt(data: []const u8, x: f32, y: f32) ?Sound {
+        const handle = sys.wasm96_audio_play_wav_at(data.ptr, data.len, x, y);
+        if (handle == 0) return null;
+        return .{ .handle = handle };
+    }
+
+    /// Play a WAV once at a playback speed ratio (0.5 = slow motion, an octave down).
+    pub fn playWavPitched(data: []const u8, ratio: f32) ?Sound {
+        const handle = sys.wasm96_audio_play_wav_pitched(data.ptr, data.len, ratio);
+        if (handle == 0) return null;
+        return .{ .handle = handle };
+    }
+
+    /// Oscillator shape for a `SynthVoice`.
+    pub const Waveform = enum(u32) {
+        square = 0,
+        triangle = 1,
+        saw = 2,
+        noise = 3,
+    };
+
+    /// ADSR envelope for a `SynthVoice`.
+    pub const Envelope = struct {
+        attack_ms: u32 = 5,
+        decay_ms: u32 = 50,
+        /// Level held while the note is on, 0.0..=1.0.
+        sustain: f32 = 0.7,
+        release_ms: u32 = 100,
+    };
+
+    /// A host-rendered chiptune oscillator. Call `destroy` to free it.
+    pub const SynthVoice = struct {
+        id: u32,
+
+        pub fn create(waveform: Waveform) SynthVoice {
+            return .{ .id = sys.wasm96_audio_synth_voice_create(@intFromEnum(waveform)) };
+        }
+
+        pub fn destroy(self: SynthVoice) void {
+            sys.wasm96_audio_synth_voice_destroy(self.id);
+        }
+
+        pub fn setEnvelope(self: SynthVoice, env: Envelope) void {
+            sys.wasm96_audio_synth_set_envelope(self.id, env.attack_ms, env.decay_ms, env.sustain, env.release_ms);
+        }
+
+        /// Start (or retrigger) a note. `freq` is in Hz, `volume` in 0.0..=1.0.
+        pub fn noteOn(self: SynthVoice, freq: f32, volume: f32) void {
+            sys.wasm96_audio_synth_note_on(self.id, freq, volume);
+        }
+
+        /// Release the note; it fades out over the envelope's release time.
+        pub fn noteOff(self: SynthVoice) void {
+            sys.wasm96_audio_synth_note_off(self.id);
+        }
+
+        /// Move the voice to another mixer group (voices start in `group_sfx`).
+        pub fn setGroup(self: SynthVoice, group: u32) void {
+            sys.wasm96_audio_synth_set_group(self.id, group);
+        }
+
+        /// Set the stereo position (-1.0 = left, 0.0 = centre, 1.0 = right).
+        pub fn setPan(self: SynthVoice, pan: f32) void {
+            sys.wasm96_audio_synth_set_pan(self.id, pan);
+        }
+
+        /// Send some of the voice (0.0..=1.0) to a mixer effect.
+        pub fn setSend(self: SynthVoice, effect: Effect, level: f32) void {
+            sys.wasm96_audio_synth_set_send(self.id, @intFromEnum(effect), level);
+        }
+    };
+
+    /// A mixer effect. A low-pass send crossfades a source to its filtered version; a reverb
+    /// send adds reverb on top of it.
+    pub const Effect = enum(u32) {
+        low_pass = 0,
+        reverb = 1,
+    };
+
+    /// Enable the low-pass effect, or change its cutoff (20..=20000 Hz).
+    pub fn enableLowPass(cutoff_hz: f32) void {
+        _ = sys.wasm96_audio_effect_enable(@intFromEnum(Effect.low_pass), cutoff_hz, 0.0);
+    }
+
+    /// Enable the reverb, or re-tune it (room size and damping in 0.0..=1.0).
+    pub fn enableReverb(room_size: f32, damping: f32) void {
+        _ = sys.wasm96_audio_effect_enable(@intFromEnum(Effect.reverb), room_size, damping);
+    }
+
+    pub fn disableEffect(effect: Effect) void {
+        sys.wasm96_audio_effect_disable(@intFromEnum(effect));
+    }
+
+    /// Send some of everything in `group` to an effect, on top of each source's own send.
+    pub fn setGroupSend(group: u32, effect: Effect, level: f32) void {
+        sys.wasm96_audio_group_set_send(group, @intFromEnum(effect), level);
+    }
+
+    /// Start capturing mono microphone samples (0 = the frontend's default rate). Returns the
+    /// actual rate, or null if the player hasn't allowed it or the frontend can't capture.
+    pub fn captureStart(sample_rate: u32) ?u32 {
+        const rate = sys.wasm96_audio_capture_start(sample_rate);
+        if (rate == 0) return null;
+        return rate;
+    }
+
+    /// Read captured samples into `buf`; returns how many were written. Call every tick.
+    pub fn captureRead(buf: []i16) usize {
+        return sys.wasm96_audio_capture_read(buf.ptr, buf.len);
+    }
+
+    pub fn captureStop() void {
+        sys.wasm96_audio_capture_stop();
+    }
+};
+
+/// Storage API.
+pub const storage = struct {
+    /// Save data to persistent storage.
+    pub fn save(key: []const u8, data: []const u8) void {
+        sys.wasm96_storage_save(graphics.hashKey(key), data.ptr, data.len);
+    }
+
+    /// Load data from persistent storage.
+    /// Returns the data if found, null otherwise.
+    pub fn load(allocator: std.mem.Allocator, key: []const u8) !?[]u8 {
+        const packed_result = sys.wasm96_storage_load(graphics.hashKey(key));
+        if (packed_result == 0) return null;
+
+        const ptr_int = packed_result >> 32;
+        const len = packed_result & 0xFFFFFFFF;
+
+        const ptr = @as([*]const u8, @ptrFromInt(ptr_int));
+
+        // Copy data from guest memory
+        const data = try allocator.alloc(u8, @as(usize, @intCast(len)));
+        @memcpy(data, ptr[0..@as(usize, @intCast(len))]);
+
+        // Free the memory in guest space
+        sys.wasm96_storage_free(ptr, @as(usize, @intCast(len)));
+
+        return data;
+    }
+};
+
+/// Networking API (outbound HTTP).
+///
+/// Requests only succeed for hosts allowlisted on the host side (`WASM96_NET_ALLOW`).
+/// Requests run in the background: keep the `Request` and call `poll` from `update`.
+pub const net = struct {
+    pub const Header = struct {
+        name: []const u8,
+        value: []const u8,
+    };
+
+    pub const FetchOptions = struct {
+        /// HTTP method; empty means GET.
+        method: []const u8 = "GET",
+        headers: []const Header = &.{},
+        body: []const u8 = "",
+    };
+
+    /// A completed HTTP response (any status code). `body` is owned by the poll allocator.
+    pub const Response = struct {
+        status: u32,
+        body: []u8,
+    };
+
+    pub const PollResult = union(enum) {
+        pending,
+        ready: Response,
+        /// Transport error, or the handle was already consumed.
+        failed,
+    };
+
+    pub const Request = struct {
+        id: u32,
+
+        /// Check on the request. After `ready` or `failed` the handle is spent.
+        pub fn poll(self: *Request, allocator: std.mem.Allocator) !PollResult {
+            if (self.id == 0) return .failed;
+            switch (sys.wasm96_net_poll(self.id)) {
+                1 => return .pending,
+                2 => {
+                    const status = sys.wasm96_net_status(self.id);
+                    const body = try system.takeBlob(allocator, sys.wasm96_net_take_body(self.id));
+                    self.id = 0;
+                    return .{ .ready = .{ .status = status, .body = body orelse try allocator.alloc(u8, 0) } };
+                },
+                else => {
+                    self.cancel();
+                    return .failed;
+                },
+            }
+        }
+
+        /// Forget the request; a running request finishes in the background and is discarded.
+        pub fn cancel(self: *Request) void {
+            if (self.id != 0) sys.wasm96_net_cancel(self.id);
+            self.id = 0;
+        }
+    };
+
+    /// Start an HTTP request. Returns null if the URL is invalid or its host isn't allowlisted.
+    pub fn fetch(allocator: std.mem.Allocator, url: []const u8, opts: FetchOptions) !?Request {
+        // Headers cross the ABI as `Name: value` lines.
+        var total: usize = 0;
+        for (opts.headers) |h| total += h.name.len + h.value.len + 3;
+        const headers = try allocator.alloc(u8, total);
+        defer allocator.free(headers);
+        var i: usize = 0;
+        for (opts.headers) |h| {
+            @memcpy(headers[i .. i + h.name.len], h.name);
+            i += h.name.len;
+            @memcpy(headers[i .. i + 2], ": ");
+            i += 2;
+            @memcpy(headers[i .. i + h.value.len], h.value);
+            i += h.value.len;
+            headers[i] = '\n';
+            i += 1;
+        }
+        const id = sys.wasm96_net_fetch(opts.method.ptr, opts.method.len, url.ptr, url.len, headers.ptr, headers.len, opts.body.ptr, opts.body.len);
+        if (id == 0) return null;
+        return Request{ .id = id };
+    }
+
+    /// Start a GET request.
+    pub fn get(allocator: std.mem.Allocator, url: []const u8) !?Request {
+        return fetch(allocator, url, .{});
+    }
+
+    /// One leaderboard row. `name` and `meta` point into the response body.
+    pub const ScoreEntry = struct {
+        rank: u32,
+        score: i64,
+        name: []const u8,
+        meta: []const u8,
+    };
+
+    /// Iterates the entries of a `fetchScores` response body, best first.
+    pub const ScoreIterator = struct {
+        body: []const u8,
+        pos: usize = 0,
+
+        fn take(self: *ScoreIterator, n: usize) ?[]const u8 {
+            if (self.body.len - self.pos < n) return null;
+            defer self.pos += n;
+            return self.body[self.pos .. self.pos + n];
+        }
+
+        pub fn next(self: *ScoreIterator) ?ScoreEntry {
+            const rank = std.mem.readInt(u32, (self.take(4) orelse return null)[0..4], .little);
+            const score = std.mem.readInt(i64, (self.take(8) orelse return null)[0..8], .little);
+            const name_len = std.mem.readInt(u32, (self.take(4) orelse return null)[0..4], .little);
+            const name = self.take(name_len) orelse return null;
+            const meta_len = std.mem.readInt(u32, (self.take(4) orelse return null)[0..4], .little);
+            const meta = self.take(meta_len) orelse return null;
+            return .{ .rank = rank, .score = score, .name = name, .meta = meta };
+        }
+    };
+
+    /// Submit a score to `board` with up to 1 KiB of `meta`. Higher scores rank first. The host
+    /// owns the backend and the player's identity; poll the request to see if it was accepted.
+    pub fn submitScore(board: []const u8, score: i64, meta: []const u8) ?Request {
+        const id = sys.wasm96_net_score_submit(board.ptr, board.len, score, meta.ptr, meta.len);
+        if (id == 0) return null;
+        return Request{ .id = id };
+    }
+
+    /// Fetch the top `count` entries (at most 100) of `board`. Read a ready response's body
+    /// with `ScoreIterator`.
+    pub fn fetchScores(board: []const u8, count: u32) ?Request {
+        const id = sys.wasm96_net_score_fetch(board.ptr, board.len, count);
+        if (id == 0) return null;
+        return Request{ .id = id };
+    }
+
+    pub const SocketState = enum {
+        connecting,
+        open,
+        /// Closed by either side or failed to connect. Already-received messages can still be read.
+        closed,
+    };
+
+    /// A WebSocket connection. The host buffers messages in both directions; call `receive`
+    /// from `update` to drain incoming ones.
+    pub const WebSocket = struct {
+        id: u32,
+
+        /// Connect to a `ws://` or `wss://` URL. Returns null if the URL is invalid or its host
+        /// isn't allowlisted. The connection opens in the background.
+        pub fn open(url: []const u8) ?WebSocket {
+            const id = sys.wasm96_net_ws_open(url.ptr, url.len);
+            if (id == 0) return null;
+            return WebSocket{ .id = id };
+        }
+
+        pub fn state(self: WebSocket) SocketState {
+            return switch (sys.wasm96_net_ws_state(self.id)) {
+                1 => .connecting,
+                2 => .open,
+                else => .closed,
+            };
+        }
+
+        /// Queue a binary message. Returns false if the connection is closed.
+        pub fn send(self: WebSocket, data: []const u8) bool {
+            return sys.wasm96_net_ws_send(self.id, data.ptr, data.len, 0) != 0;
+        }
+
+        /// Queue a UTF-8 text message.
+        pub fn sendText(self: WebSocket, text: []const u8) bool {
+            return sys.wasm96_net_ws_send(self.id, text.ptr, text.len, 1) != 0;
+        }
+
+        /// Take the oldest received message, if any (owned by `allocator`).
+        pub fn receive(self: WebSocket, allocator: std.mem.Allocator) !?[]u8 {
+            return system.takeBlob(allocator, sys.wasm96_net_ws_receive(self.id));
+        }
+
+        /// Close the connection and drop unread messages.
+        pub fn close(self: WebSocket) void {
+            sys.wasm96_net_ws_close(self.id);
+        }
+    };
+
+    pub const SessionStatus = enum {
+        /// Waiting to hear from every peer; no inputs are synced yet.
+        connecting,
+        running,
+        /// A peer stopped responding; its last input repeats from now on.
+        peer_dropped,
+        closed,
+    };
+
+    /// One player's input for the current tick. `confirmed` is false for a prediction.
+    pub const PlayerInput = struct {
+        bytes: []const u8,
+        confirmed: bool,
+    };
+
+    /// Every player's input for a tick, in player order.
+    pub const SyncedInputs = struct {
+        data: []u8,
+        pos: usize = 0,
+
+        pub fn next(self: *SyncedInputs) ?PlayerInput {
+            if (self.pos + 2 > self.data.len) return null;
+            const confirmed = self.data[self.pos] != 0;
+            const start = self.pos + 2;
+            const end = @min(start + self.data[self.pos + 1], self.data.len);
+            self.pos = end;
+            return .{ .bytes = self.data[start..end], .confirmed = confirmed };
+        }
+
+        pub fn deinit(self: SyncedInputs, allocator: std.mem.Allocator) void {
+            allocator.free(self.data);
+        }
+    };
+
+    /// A rollback netplay session. Each machine runs the same cart and adds its own input every
+    /// tick; the host predicts late remote inputs and, when a prediction was wrong, restores an
+    /// earlier save state and re-runs `update` (see `isResimulating` and `system.onRollback`).
+    pub const Session = struct {
+        id: u32,
+
+        /// Open a session for `players` players (2-8) on UDP `port` (0 = any), this machine
+        /// playing `local_player`. Local inputs apply `input_delay` ticks later (at most 8).
+        pub fn create(players: u32, input_delay: u32, local_player: u32, port: u16) ?Session {
+            const id = sys.wasm96_net_session_create(players, input_delay, local_player, port);
+            if (id == 0) return null;
+            return Session{ .id = id };
+        }
+
+        /// Exchange inputs with `player` at `addr` (`host:port`, allowlisted host).
+        pub fn addPeer(self: Session, player: u32, addr: []const u8) bool {
+            return sys.wasm96_net_session_add_peer(self.id, player, addr.ptr, addr.len) != 0;
+        }
+
+        /// This tick's local input (at most 64 bytes); call before `syncedInputs`.
+        pub fn addLocalInput(self: Session, input: []const u8) bool {
+            return sys.wasm96_net_session_add_local_input(self.id, input.ptr, input.len) != 0;
+        }
+
+        /// Every player's input for this tick, or null while connecting.
+        pub fn syncedInputs(self: Session, allocator: std.mem.Allocator) !?SyncedInputs {
+            const data = try system.takeBlob(allocator, sys.wasm96_net_session_synced_inputs(self.id)) orelse return null;
+            return SyncedInputs{ .data = data };
+        }
+
+        pub fn status(self: Session) SessionStatus {
+            return switch (sys.wasm96_net_session_status(self.id)) {
+                1 => .connecting,
+                2 => .running,
+                3 => .peer_dropped,
+                else => .closed,
+            };
+        }
+
+        /// The tick being simulated, counted from the start of the session.
+        pub fn frame(self: Session) u32 {
+            return sys.wasm96_net_session_frame(self.id);
+        }
+
+        /// True while `update` re-runs rolled-back ticks; skip sounds and other effects.
+        pub fn isResimulating(self: Session) bool {
+            return sys.wasm96_net_session_is_resimulating(self.id) != 0;
+        }
+
+        pub fn localPort(self: Session) u16 {
+            return @intCast(sys.wasm96_net_session_local_port(self.id) & 0xFFFF);
+        }
+
+        /// Exchange inputs with `player` over an open LAN connection (no allowlist needed).
+        pub fn addLanPeer(self: Session, player: u32, conn: LanConnection) bool {
+            return sys.wasm96_net_session_add_lan_peer(self.id, player, conn.id) != 0;
+        }
+
+        pub fn close(self: Session) void {
+            sys.wasm96_net_session_close(self.id);
+        }
+    };
+
+    /// Another machine on the local network running this cart. `address` is `ip:port`.
+    pub const LanPeer = struct {
+        id: u32,
+        address: []const u8,
+    };
+
+    /// The peers found by `lanDiscover`.
+    pub const LanPeers = struct {
+        data: []u8,
+        pos: usize = 0,
+
+        pub fn next(self: *LanPeers) ?LanPeer {
+            if (self.pos + 5 > self.data.len) return null;
+            const id = std.mem.readInt(u32, self.data[self.pos..][0..4], .little);
+            const start = self.pos + 5;
+            const end = @min(start + self.data[self.pos + 4], self.data.len);
+            self.pos = end;
+            return .{ .id = id, .address = self.data[start..end] };
+        }
+
+        pub fn deinit(self: LanPeers, allocator: std.mem.Allocator) void {
+            allocator.free(self.data);
+        }
+    };
+
+    /// Look for other machines on the local network running this cart; call it regularly
+    /// while in a lobby. Null unless the player turned LAN play on.
+    pub fn lanDiscover(allocator: std.mem.Allocator) !?LanPeers {
+        const data = try system.takeBlob(allocator, sys.wasm96_net_lan_discover()) orelse return null;
+        return LanPeers{ .data = data };
+    }
+
+    pub const SendMode = enum(u32) {
+        /// Sent once; may be lost or reordered.
+        unreliable = 0,
+        /// Resent until acknowledged; delivered once and in order.
+        reliable = 1,
+    };
+
+    /// A direct connection to a `LanPeer`. One side connects and the other accepts.
+    pub const LanConnection = struct {
+        id: u32,
+
+        pub fn connect(peer: LanPeer) ?LanConnection {
+            const id = sys.wasm96_net_lan_connect(peer.id);
+            if (id == 0) return null;
+            return LanConnection{ .id = id };
+        }
+
+        /// The next connection a peer opened to this machine, if any.
+        pub fn accept() ?LanConnection {
+            const id = sys.wasm96_net_lan_accept();
+            if (id == 0) return null;
+            return LanConnection{ .id = id };
+        }
+
+        pub fn state(self: LanConnection) SocketState {
+            return switch (sys.wasm96_net_lan_state(self.id)) {
+                1 => .connecting,
+                2 => .open,
+                else => .closed,
+            };
+        }
+
+        /// Send a message of at most 1200 bytes. Returns false if the connection is closed,
+        /// the message is too big or too many reliable messages are unacknowledged.
+        pub fn send(self: LanConnection, data: []const u8, mode: SendMode) bool {
+            return sys.wasm96_net_lan_send(self.id, data.ptr, data.len, @intFromEnum(mode)) != 0;
+        }
+
+        /// Take the oldest received message, if any (owned by `allocator`).
+        pub fn receive(self: LanConnection, allocator: std.mem.Allocator) !?[]u8 {
+            return system.takeBlob(allocator, sys.wasm96_net_lan_receive(self.id));
+        }
+
+        pub fn close(self: LanConnection) void {
+            sys.wasm96_net_lan_close(self.id);
+        }
+    };
+};
+
+/// System API.
+pub const system = struct {
+    /// Log a message to the host console.
+    pub fn log(message: []const u8) void {
+        sys.wasm96_system_log(message.ptr, message.len);
+    }
+
+    /// Severity of a log message. Maps onto the frontend's log levels.
+    pub const LogLevel = enum(u32) {
+        debug = 0,
+        info = 1,
+        warn = 2,
+        err = 3,
+    };
+
+    // Mirror of the host filter so `logf` can skip formatting messages that would be dropped.
+    var log_level: LogLevel = .debug;
+
+    /// Log a message at `level`.
+    pub fn logAt(level: LogLevel, message: []const u8) void {
+        sys.wasm96_system_log_at(@intFromEnum(level), message.ptr, message.len);
+    }
+
+    /// Format and log a message at `level`. Output longer than 512 bytes is truncated.
+    pub fn logf(level: LogLevel, comptime fmt: []const u8, args: anytype) void {
+        if (@intFromEnum(level) < @intFromEnum(log_level)) return;
+        var buf: [512]u8 = undefined;
+        const msg = std.fmt.bufPrint(&buf, fmt, args) catch buf[0..];
+        logAt(level, msg);
+    }
+
+    pub fn debug(message: []const u8) void {
+        logAt(.debug, message);
+    }
+
+    pub fn info(message: []const u8) void {
+        logAt(.info, message);
+    }
+
+    pub fn warn(message: []const u8) void {
+        logAt(.warn, message);
+    }
+
+    pub fn err(message: []const u8) void {
+        logAt(.err, message);
+    }
+
+    /// Drop messages below `level`, e.g. `.info` to silence debug output in release carts.
+    pub fn setLogLevel(level: LogLevel) void {
+        log_level = level;
+        sys.wasm96_system_set_log_level(@intFromEnum(level));
+    }
+
+    /// Report a crash to the host console. `stack` may be empty.
+    pub fn reportError(message: []const u8, stack: []const u8) void {
+        sys.wasm96_system_report_error(message.ptr, message.len, stack.ptr, stack.len);
+    }
+
+    /// Panic handler that reports the message to the host before trapping. Install it in your
+    /// root source file:
+    ///
+    ///     pub const panic = std.debug.FullPanic(wasm96.system.panicHandler);
+    pub fn panicHandler(message: []const u8, first_trace_addr: ?usize) noreturn {
+        var buf: [32]u8 = undefined;
+        const stack = if (first_trace_addr) |addr|
+            std.fmt.bufPrint(&buf, "at 0x{x}", .{addr}) catch ""
+        else
+            "";
+        reportError(message, stack);
+        @trap();
+    }
+
+    /// Get the number of milliseconds since the app started.
+    pub fn millis() u64 {
+        return sys.wasm96_system_millis();
+    }
+
+    /// Wall-clock seconds since 1970-01-01 UTC. See `DateTime` for the calendar date.
+    pub fn unixTime() i64 {
+        return sys.wasm96_system_unix_time();
+    }
+
+    /// The player's current UTC offset in minutes east of UTC; 0 if the host doesn't know it.
+    pub fn localTimeOffsetMinutes() i32 {
+        return sys.wasm96_system_local_time_offset_minutes();
+    }
+
+    /// The player's language as a BCP-47 tag (e.g. "en-US"), owned by `allocator`. "en" when
+    /// neither the frontend nor the host names one.
+    pub fn locale(allocator: std.mem.Allocator) ![]u8 {
+        if (try takeBlob(allocator, sys.wasm96_system_get_locale())) |tag| return tag;
+        return allocator.dupe(u8, "en");
+    }
+
+    /// A wall-clock date and time at a fixed UTC offset (proleptic Gregorian calendar).
+    pub const DateTime = struct {
+        year: i32,
+        month: u8,
+        day: u8,
+        hour: u8,
+        minute: u8,
+        second: u8,
+        offset_minutes: i32,
+
+        /// The date and time `unix_time` reads as at `offset_minutes` east of UTC.
+        pub fn fromUnix(unix_time: i64, offset_minutes: i32) DateTime {
+            const local = unix_time + @as(i64, offset_minutes) * 60;
+            const secs = @mod(local, 86_400);
+            // Howard Hinnant's civil_from_days.
+            const z = @divFloor(local, 86_400) + 719_468;
+            const era = @divFloor(z, 146_097);
+            const doe = z - era * 146_097;
+            const yoe = @divTrunc(doe - @divTrunc(doe, 1460) + @divTrunc(doe, 36_524) - @divTrunc(doe, 146_096), 365);
+            const doy = doe - (365 * yoe + @divTrunc(yoe, 4) - @divTrunc(yoe, 100));
+            const mp = @divTrunc(5 * doy + 2, 153);
+            const month: i64 = if (mp < 10) mp + 3 else mp - 9;
+            return .{
+                .year = @intCast(yoe + era * 400 + @as(i64, if (month <= 2) 1 else 0)),
+                .month = @intCast(month),
+                .day = @intCast(doy - @divTrunc(153 * mp + 2, 5) + 1),
+                .hour = @intCast(@divTrunc(secs, 3600)),
+                .minute = @intCast(@mod(@divTrunc(secs, 60), 60)),
+                .second = @intCast(@mod(secs, 60)),
+                .offset_minutes = offset_minutes,
+            };
+        }
+
+        pub fn nowUtc() DateTime {
+            return fromUnix(unixTime(), 0);
+        }
+
+        /// The current time in the player's time zone.
+        pub fn nowLocal() DateTime {
+            return fromUnix(unixTime(), localTimeOffsetMinutes());
+        }
+
+        /// Days from 1970-01-01 to this date, ignoring the time of day (a handy daily seed).
+        pub fn dayNumber(self: DateTime) i64 {
+            const y: i64 = if (self.month <= 2) @as(i64, self.year) - 1 else self.year;
+            const era = @divFloor(y, 400);
+            const yoe = y - era * 400;
+            const m: i64 = self.month;
+            const doy = @divTrunc(153 * (if (m > 2) m - 3 else m + 9) + 2, 5) + @as(i64, self.day) - 1;
+            const doe = yoe * 365 + @divTrunc(yoe, 4) - @divTrunc(yoe, 100) + doy;
+            return era * 146_097 + doe - 719_468;
+        }
+
+        /// Day of the week, 0 = Sunday through 6 = Saturday.
+        pub fn weekday(self: DateTime) u8 {
+            return @intCast(@mod(self.dayNumber() + 4, 7));
+        }
+    };
+
+    /// Milliseconds between the previous tick and this one (0 on the first tick).
+    pub fn deltaMillis() u64 {
+        return sys.wasm96_system_delta_millis();
+    }
+
+    /// Limit update/draw to at most `fps` ticks per second. 0 ticks every host frame.
+    pub fn setTargetFps(fps: u32) void {
+        sys.wasm96_system_set_target_fps(fps);
+    }
+
+    /// Ticks per second measured over the last full second.
+    pub fn getFps() u32 {
+        return sys.wasm96_system_get_fps();
+    }
+
+    /// Run `update` `hz` times per second, independently of `draw`: each tick runs the updates
+    /// that have come due (none, one or several) before drawing once. `0` restores one
+    /// `update` per tick.
+    pub fn setUpdateRate(hz: u32) void {
+        sys.wasm96_system_set_update_rate(hz);
+    }
+
+    /// How far this tick's `draw` is between the last `update` and the next, in `0..1`
+    /// (1 without `setUpdateRate`).
+    pub fn interpolationAlpha() f32 {
+        return sys.wasm96_system_interpolation_alpha();
+    }
+
+    /// Next value from the host random number generator.
+    pub fn random() u64 {
+        return sys.wasm96_system_random();
+    }
+
+    /// Fresh entropy from the host, for seeding a guest-side generator.
+    pub fn randomSeed() u64 {
+        return sys.wasm96_system_random_seed();
+    }
+
+    var pause_hook: ?*const fn () void = null;
+    var resume_hook: ?*const fn () void = null;
+    var quit_hook: ?*const fn () void = null;
+    var rollback_hook: ?*const fn () void = null;
+
+    /// Run `hook` when the frontend pauses and steps single frames. Most frontends don't run
+    /// the cart at all while paused; then only `onResume` is called, once frames come back.
+    /// Hooks only run in carts that call `exportHooks`.
+    pub fn onPause(hook: *const fn () void) void {
+        pause_hook = hook;
+    }
+
+    /// Run `hook` when frames resume after a pause or after the frontend stopped running the
+    /// cart for a while.
+    pub fn onResume(hook: *const fn () void) void {
+        resume_hook = hook;
+    }
+
+    /// Run `hook` before the cart is unloaded, e.g. to flush saves.
+    pub fn onQuit(hook: *const fn () void) void {
+        quit_hook = hook;
+    }
+
+    /// Run `hook` when a netplay session rolls back, after memory is restored to an earlier
+    /// tick and before `update` runs again from there.
+    pub fn onRollback(hook: *const fn () void) void {
+        rollback_hook = hook;
+    }
+
+    /// Export `on_pause`, `on_resume`, `on_quit` and `on_rollback`, running the hooks set above.
+    /// Carts that export these themselves leave it out. Call it at comptime:
+    /// `comptime { wasm96.system.exportHooks(); }`.
+    pub fn exportHooks() void {
+        @export(&exportPause, .{ .name = "on_pause" });
+        @export(&exportResume, .{ .name = "on_resume" });
+        @export(&exportQuit, .{ .name = "on_quit" });
+        @export(&exportRollback, .{ .name = "on_rollback" });
+    }
+
+    fn exportPause() callconv(.c) void {
+        if (pause_hook) |hook| hook();
+    }
+
+    fn exportResume() callconv(.c) void {
+        if (resume_hook) |hook| hook();
+    }
+
+    fn exportQuit() callconv(.c) void {
+        if (quit_hook) |hook| hook();
+    }
+
+    fn exportRollback() callconv(.c) void {
+        if (rollback_hook) |hook| hook();
+    }
+
+    /// Exit back to the frontend once the current tick returns (after `on_quit`).
+    pub fn quit() void {
+        sys.wasm96_system_quit();
+    }
+
+    /// Restart the cart cleanly once the current tick returns: fresh memory, then `setup` again.
+    pub fn reset() void {
+        sys.wasm96_system_reset();
+    }
+
+    pub const ClipboardPoll = union(enum) {
+        pending,
+        /// The clipboard's text (empty if it holds none); owned by the caller.
+        ready: []u8,
+        /// No clipboard tool worked, or the handle was already consumed.
+        failed,
+    };
+
+    /// A clipboard read running in the background.
+    pub const ClipboardRead = struct {
+        id: u32,
+
+        /// Check on the read. After `ready` or `failed` the handle is spent.
+        pub fn poll(self: *ClipboardRead, allocator: std.mem.Allocator) !ClipboardPoll {
+            if (self.id == 0) return .failed;
+            switch (sys.wasm96_system_clipboard_poll(self.id)) {
+                1 => return .pending,
+                2 => {
+                    const text = try takeBlob(allocator, sys.wasm96_system_clipboard_take(self.id));
+                    self.id = 0;
+                    return .{ .ready = text orelse try allocator.alloc(u8, 0) };
+                },
+                else => {
+                    self.cancel();
+                    return .failed;
+                },
+            }
+        }
+
+        /// Forget the read; a running read finishes in the background and is discarded.
+        pub fn cancel(self: *ClipboardRead) void {
+            if (self.id != 0) sys.wasm96_system_clipboard_cancel(self.id);
+            self.id = 0;
+        }
+    };
+
+    /// Start reading the clipboard's text in the background; poll it on later ticks. Null if
+    /// not allowed (`WASM96_CLIPBOARD=read`) or a few reads are already pending.
+    pub fn clipboardGet() ?ClipboardRead {
+        const id = sys.wasm96_system_clipboard_get();
+        if (id == 0) return null;
+        return ClipboardRead{ .id = id };
+    }
+
+    /// Copy text to the clipboard. False if not allowed (`WASM96_CLIPBOARD=write`).
+    pub fn clipboardSet(text: []const u8) bool {
+        return sys.wasm96_system_clipboard_set(text.ptr, text.len) != 0;
+    }
+
+    /// A value from the cart's `wasm96.meta` section (`title`, `version`, `author`, ...), or null.
+    pub fn cartMeta(allocator: std.mem.Allocator, key: []const u8) !?[]u8 {
+        return takeBlob(allocator, sys.wasm96_system_cart_meta(key.ptr, key.len));
+    }
+
+    /// A launch parameter from the player or frontend (flags without a value read as "1"), or null.
+    pub fn launchArg(allocator: std.mem.Allocator, key: []const u8) !?[]u8 {
+        return takeBlob(allocator, sys.wasm96_system_launch_arg(key.ptr, key.len));
+    }
+
+    /// Unlock an achievement; the frontend shows a notification the first time. False if the
+    /// cart's `achievements` metadata doesn't list `id`.
+    pub fn achievementUnlock(id: []const u8) bool {
+        return sys.wasm96_system_achievement_unlock(id.ptr, id.len) != 0;
+    }
+
+    /// Report progress towards an achievement; every quarter is announced and `max` unlocks it.
+    /// False for an undeclared id or a `max` of 0.
+    pub fn achievementProgress(id: []const u8, value: u32, max: u32) bool {
+        return sys.wasm96_system_achievement_progress(id.ptr, id.len, value, max) != 0;
+    }
+
+    /// Whether the cart was just hot-reloaded (`WASM96_HOT_RELOAD`). A new module re-runs
+    /// `setup` with storage kept; new assets alone keep running, so re-read them in `update`.
+    pub fn devReloadRequested() bool {
+        return sys.wasm96_system_dev_reload_requested() != 0;
+    }
+
+    /// The bytes of an asset in this cart's `.w96` bundle (e.g. "sprites/ship.png"), or null.
+    pub fn assetRead(allocator: std.mem.Allocator, path: []const u8) !?[]u8 {
+        return takeBlob(allocator, sys.wasm96_system_asset_read(path.ptr, path.len));
+    }
+
+    /// Sorted bundle asset paths starting with `prefix` ("" = all), one per line, or null if
+    /// none match. Split with `std.mem.splitScalar(u8, list, '\n')`.
+    pub fn assetList(allocator: std.mem.Allocator, prefix: []const u8) !?[]u8 {
+        return takeBlob(allocator, sys.wasm96_system_asset_list(prefix.ptr, prefix.len));
+    }
+
+    pub const ColorBlindMode = enum(u32) { off = 0, protanopia = 1, deuteranopia = 2, tritanopia = 3 };
+
+    /// The player's accessibility preferences, from the frontend's core options.
+    pub const AccessibilitySettings = struct {
+        reduce_flashing: bool = false,
+        high_contrast: bool = false,
+        text_scale: f32 = 1.0,
+        color_blind_mode: ColorBlindMode = .off,
+    };
+
+    /// The player's accessibility preferences. They can change while the cart runs.
+    pub fn accessibilitySettings() AccessibilitySettings {
+        var buf: [12]u8 = undefined;
+        if (sys.wasm96_system_accessibility_settings(&buf, buf.len) == 0) return .{};
+        const flags = std.mem.readInt(u32, buf[0..4], .little);
+        return .{
+            .reduce_flashing = flags & 1 != 0,
+            .high_contrast = flags & 2 != 0,
+            .text_scale = @bitCast(std.mem.readInt(u32, buf[4..8], .little)),
+            .color_blind_mode = switch (std.mem.readInt(u32, buf[8..12], .little)) {
+                1 => .protanopia,
+                2 => .deuteranopia,
+                3 => .tritanopia,
+                else => .off,
+            },
+        };
+    }
+
+    /// Profiling figures for the previous tick (times in microseconds).
+    pub const Stats = struct {
+        draw_calls: u32 = 0,
+        update_micros: u32 = 0,
+        draw_micros: u32 = 0,
+        render_micros: u32 = 0,
+        memory_bytes: u64 = 0,
+        images: u32 = 0,
+        fonts: u32 = 0,
+        meshes: u32 = 0,
+    };
+
+    /// Draw calls, timings, resource counts and memory use of the previous tick.
+    pub fn stats() Stats {
+        var buf: [36]u8 = undefined;
+        if (sys.wasm96_system_stats(&buf, buf.len) == 0) return .{};
+        const word = struct {
+            fn at(b: *const [36]u8, i: usize) u32 {
+                return std.mem.readInt(u32, b[i..][0..4], .little);
+            }
+        }.at;
+        return .{
+            .draw_calls = word(&buf, 0),
+            .update_micros = word(&buf, 4),
+            .draw_micros = word(&buf, 8),
+            .render_micros = word(&buf, 12),
+            .memory_bytes = std.mem.readInt(u64, buf[16..24], .little),
+            .images = word(&buf, 24),
+            .fonts = word(&buf, 28),
+            .meshes = word(&buf, 32),
+        };
+    }
+
+    /// Where an async load (`graphics.imageRegisterAsync`, `audio.SoundPool.initAsync`) is.
+    pub const LoadStatus = enum(u32) { unknown = 0, pending = 1, ready = 2, failed = 3 };
+
+    /// Status of an async load. Decoded assets become ready at the start of a tick.
+    pub fn loadStatus(handle: u32) LoadStatus {
+        return switch (sys.wasm96_system_load_status(handle)) {
+            1 => .pending,
+            2 => .ready,
+            3 => .failed,
+            else => .unknown,
+        };
+    }
+
+    pub fn isReady(handle: u32) bool {
+        return loadStatus(handle) == .ready;
+    }
+
+    /// Finished fraction (0.0..=1.0) of the loads started since nothing was last loading; 1.0 when idle.
+    pub fn loadProgress() f32 {
+        return sys.wasm96_system_load_progress();
+    }
+
+    pub const JobStatus = enum { running, done, failed };
+
+    /// An export of this cart running on a worker instance with its own memory. Workers only get
+    /// the job imports (`jobInput`, `jobOutput`); other host calls fail the job.
+    pub const Job = struct {
+        id: u32,
+
+        /// Run export `name` (`fn(u32) u32` or `fn(u32) void`) with `arg` and `input`
+        /// (up to 16 MiB). Null if there's no such export or too many jobs are running.
+        pub fn spawn(name: []const u8, arg: u32, input: []const u8) ?Job {
+            const id = sys.wasm96_system_job_spawn(name.ptr, name.len, arg, input.ptr, input.len);
+            if (id == 0) return null;
+            return .{ .id = id };
+        }
+
+        /// Forget the job, stopping it if it's still running.
+        pub fn deinit(self: Job) void {
+            sys.wasm96_system_job_free(self.id);
+        }
+
+        pub fn status(self: Job) JobStatus {
+            return switch (sys.wasm96_system_job_status(self.id)) {
+                1 => .running,
+                2 => .done,
+                else => .failed,
+            };
+        }
+
+        pub fn isDone(self: Job) bool {
+            return self.status() != .running;
+        }
+
+        /// The export's return value, once done.
+        pub fn result(self: Job) ?u32 {
+            if (self.status() != .done) return null;
+            return sys.wasm96_system_job_result(self.id);
+        }
+
+        /// The bytes the job wrote with `jobOutput`, once done. Handed over once.
+        pub fn takeOutput(self: Job, allocator: std.mem.Allocator) !?[]u8 {
+            return takeBlob(allocator, sys.wasm96_system_job_output(self.id));
+        }
+    };
+
+    /// Inside a job: the input bytes it was spawned with (empty outside a job).
+    pub fn jobInput(allocator: std.mem.Allocator) ![]u8 {
+        const len = sys.wasm96_system_job_input_len();
+        const data = try allocator.alloc(u8, len);
+        const n = sys.wasm96_system_job_input_read(data.ptr, data.len);
+        return allocator.realloc(data, n);
+    }
+
+    /// Inside a job: append bytes to its output (discarded outside a job).
+    pub fn jobOutput(bytes: []const u8) bool {
+        return sys.wasm96_system_job_output_write(bytes.ptr, bytes.len) != 0;
+    }
+
+    /// Copy a host blob into allocator-owned memory and release it.
+    /// Returns null for id 0 or a missing blob.
+    pub fn takeBlob(allocator: std.mem.Allocator, id: u32) !?[]u8 {
+        if (id == 0) return null;
+        const len = sys.wasm96_system_blob_len(id);
+        defer sys.wasm96_system_blob_free(id);
+        const data = try allocator.alloc(u8, len);
+        if (sys.wasm96_system_blob_read(id, data.ptr, data.len) != len) {
+            allocator.free(data);
+            return null;
+        }
+        return data;
+    }
+
+    /// Capture the current framebuffer as PNG bytes (2D layer only).
+    pub fn screenshot(allocator: std.mem.Allocator) !?[]u8 {
+        return takeBlob(allocator, sys.wasm96_system_screenshot());
+    }
+
+    /// Start recording drawn frames for a GIF. Restarts any recording in progress.
+    pub fn recordGifStart() void {
+        sys.wasm96_system_record_gif_start();
+    }
+
+    /// Stop recording and return the encoded GIF bytes, or null if nothing was recorded.
+    pub fn recordGifStop(allocator: std.mem.Allocator) !?[]u8 {
+        return takeBlob(allocator, sys.wasm96_system_record_gif_stop());
+    }
+
+    /// Snapshot guest memory plus drawing state, framebuffer, host RNG and mixer volumes.
+    pub fn stateSave(allocator: std.mem.Allocator) !?[]u8 {
+        return takeBlob(allocator, sys.wasm96_system_state_save());
+    }
+
+    /// Restore a snapshot once the current tick returns. False if `data` isn't a snapshot.
+    pub fn stateLoad(data: []const u8) bool {
+        return sys.wasm96_system_state_load(data.ptr, data.len) != 0;
+    }
+
+    /// `std.Random` source backed by the host generator.
+    ///
+    /// Usage: `var src = system.HostRandom{}; const rng = src.random();`
+    /// For reproducible sequences, seed a std PRNG instead:
+    /// `var prng = std.Random.DefaultPrng.init(system.randomSeed());`
+    pub const HostRandom = struct {
+        pub fn random(self: *HostRandom) std.Random {
+            return std.Random.init(self, fill);
+        }
+
+        fn fill(_: *HostRandom, buf: []u8) void {
+            var i: usize = 0;
+            while (i < buf.len) {
+                var bits = sys.wasm96_system_random();
+                var j: usize = 0;
+                while (j < 8 and i < buf.len) : (j += 1) {
+                    buf[i] = @truncate(bits);
+                    bits >>= 8;
+                    i += 1;
+                }
+            }
+        }
+    };
+};
+
+/// 2D game math: vectors, rectangles, interpolation and intersection tests (f32 only).
+pub const math = struct {
+    pub fn lerp(a: f32, b: f32, t: f32) f32 {
+        return a + (b - a) * t;
+    }
+
+    pub fn inverseLerp(a: f32, b: f32, v: f32) f32 {
+        return if (a == b) 0 else (v - a) / (b - a);
+    }
+
+    pub fn clamp(v: f32, lo: f32, hi: f32) f32 {
+        return @min(@max(v, lo), hi);
+    }
+
+    pub fn degToRad(deg: f32) f32 {
+        return deg * (std.math.pi / 180.0);
+    }
+
+    pub fn radToDeg(rad: f32) f32 {
+        return rad * (180.0 / std.math.pi);
+    }
+
+    /// Wrap an angle in radians to `-pi..pi`.
+    pub fn wrapAngle(rad: f32) f32 {
+        const tau = 2.0 * std.math.pi;
+        const a = rad + std.math.pi;
+        return a - tau * @floor(a / tau) - std.math.pi;
+    }
+
+    pub const Vec2 = struct {
+        x: f32 = 0,
+        y: f32 = 0,
+
+        pub const zero = Vec2{};
+
+        pub fn init(x: f32, y: f32) Vec2 {
+            return .{ .x = x, .y = y };
+        }
+
+        /// Unit vector at `angle` radians (clockwise on screen, since y points down).
+        pub fn fromAngle(angle: f32) Vec2 {
+            return .{ .x = @cos(angle), .y = @sin(angle) };
+        }
+
+        pub fn fromPoint(p: Point) Vec2 {
+            return .{ .x = @floatFromInt(p.x), .y = @floatFromInt(p.y) };
+        }
+
+        /// Round to the nearest pixel.
+        pub fn toPoint(v: Vec2) Point {
+            return .{ .x = @intFromFloat(@round(v.x)), .y = @intFromFloat(@round(v.y)) };
+        }
+
+        pub fn add(a: Vec2, b: Vec2) Vec2 {
+            return .{ .x = a.x + b.x, .y = a.y + b.y };
+        }
+
+        pub fn sub(a: Vec2, b: Vec2) Vec2 {
+            return .{ .x = a.x - b.x, .y = a.y - b.y };
+        }
+
+        pub fn scale(v: Vec2, s: f32) Vec2 {
+            return .{ .x = v.x * s, .y = v.y * s };
+        }
+
+        pub fn dot(a: Vec2, b: Vec2) f32 {
+            return a.x * b.x + a.y * b.y;
+        }
+
+        pub fn cross(a: Vec2, b: Vec2) f32 {
+            return a.x * b.y - a.y * b.x;
+        }
+
+        pub fn length(v: Vec2) f32 {
+            return @sqrt(v.dot(v));
+        }
+
+        pub fn distance(a: Vec2, b: Vec2) f32 {
+            return b.sub(a).length();
+        }
+
+        /// Unit vector in the same direction, or zero for the zero vector.
+        pub fn normalize(v: Vec2) Vec2 {
+            const len = v.length();
+            return if (len == 0) zero else v.scale(1.0 / len);
+        }
+
+        pub fn angle(v: Vec2) f32 {
+            return std.math.atan2(v.y, v.x);
+        }
+
+        pub fn rotate(v: Vec2, rad: f32) Vec2 {
+            const s = @sin(rad);
+            const c = @cos(rad);
+            return .{ .x = v.x * c - v.y * s, .y = v.x * s + v.y * c };
+        }
+
+        pub fn lerp(a: Vec2, b: Vec2, t: f32) Vec2 {
+            return .{ .x = math.lerp(a.x, b.x, t), .y = math.lerp(a.y, b.y, t) };
+        }
+    };
+
+    /// Axis-aligned rectangle: top-left corner plus size.
+    pub const Rect = struct {
+        x: f32,
+        y: f32,
+        w: f32,
+        h: f32,
+
+        pub fn init(x: f32, y: f32, w: f32, h: f32) Rect {
+            return .{ .x = x, .y = y, .w = w, .h = h };
+        }
+
+        pub fn right(r: Rect) f32 {
+            return r.x + r.w;
+        }
+
+        pub fn bottom(r: Rect) f32 {
+            return r.y + r.h;
+        }
+
+        pub fn center(r: Rect) Vec2 {
+            return .{ .x = r.x + r.w / 2, .y = r.y + r.h / 2 };
+        }
+
+        pub fn translate(r: Rect, by: Vec2) Rect {
+            return .{ .x = r.x + by.x, .y = r.y + by.y, .w = r.w, .h = r.h };
+        }
+
+        /// Left/top edges inclusive, right/bottom exclusive.
+        pub fn contains(r: Rect, p: Vec2) bool {
+            return p.x >= r.x and p.x < r.right() and p.y >= r.y and p.y < r.bottom();
+        }
+
+        /// True if the rectangles overlap by a non-zero area.
+        pub fn intersects(a: Rect, b: Rect) bool {
+            return a.x < b.right() and b.x < a.right() and a.y < b.bottom() and b.y < a.bottom();
+        }
+
+        pub fn intersection(a: Rect, b: Rect) ?Rect {
+            if (!a.intersects(b)) return null;
+            const x = @max(a.x, b.x);
+            const y = @max(a.y, b.y);
+            return .{ .x = x, .y = y, .w = @min(a.right(), b.right()) - x, .h = @min(a.bottom(), b.bottom()) - y };
+        }
+
+        /// True if the circle at `c` with radius `radius` overlaps the rectangle.
+        pub fn intersectsCircle(r: Rect, c: Vec2, radius: f32) bool {
+            const nearest = Vec2.init(clamp(c.x, r.x, r.right()), clamp(c.y, r.y, r.bottom()));
+            const d = c.sub(nearest);
+            return d.dot(d) < radius * radius;
+        }
+
+        fn pixels(r: Rect) struct { x: i32, y: i32, w: u32, h: u32 } {
+            const min = Vec2.init(r.x, r.y).toPoint();
+            const max = Vec2.init(r.right(), r.bottom()).toPoint();
+            return .{ .x = min.x, .y = min.y, .w = @intCast(@max(max.x - min.x, 0)), .h = @intCast(@max(max.y - min.y, 0)) };
+        }
+    };
+};
+
+/// QOI ("Quite OK Image") encoding and decoding in the guest, for pixels a cart makes itself:
+/// generated textures, in-guest screenshots, thumbnails kept in `storage`. Pixels are RGBA8888
+/// like `graphics.image` and `graphics.framebufferRead`; files follow the QOI specification.
+pub const qoi = struct {
+    pub const magic = "qoif";
+    pub const header_len = 14;
+    /// Largest image accepted, in pixels (as in the reference implementation).
+    pub const max_pixels: u64 = 400_000_000;
+    const end_marker = [8]u8{ 0, 0, 0, 0, 0, 0, 0, 1 };
+
+    const op_index: u8 = 0x00;
+    const op_diff: u8 = 0x40;
+    const op_luma: u8 = 0x80;
+    const op_run: u8 = 0xC0;
+    const op_rgb: u8 = 0xFE;
+    const op_rgba: u8 = 0xFF;
+
+    pub const Size = struct {
+        width: u32,
+        height: u32,
+    };
+
+    pub const Image = struct {
+        width: u32,
+        height: u32,
+        /// `width * height * 4` bytes, owned by the allocator passed to `decode`.
+        pixels: []u8,
+    };
+
+    fn hash(px: [4]u8) usize {
+        return (@as(usize, px[0]) * 3 + @as(usize, px[1]) * 5 + @as(usize, px[2]) * 7 + @as(usize, px[3]) * 11) % 64;
+    }
+
+    fn validSize(width: u32, height: u32, pixels_len: usize) bool {
+        const count = @as(u64, width) * height;
+        return count != 0 and count <= max_pixels and pixels_len == count * 4;
+    }
+
+    /// Width and height from a QOI header, or null if `data` isn't QOI.
+    pub fn size(data: []const u8) ?Size {
+        if (data.len < header_len or !std.mem.eql(u8, data[0..4], magic)) return null;
+        return .{
+            .width = std.mem.readInt(u32, data[4..8], .big),
+            .height = std.mem.readInt(u32, data[8..12], .big),
+        };
+    }
+
+    /// Bytes `encode` may need for a `width` x `height` image.
+    pub fn maxEncodedLen(width: u32, height: u32) usize {
+        const len = header_len + @as(u64, width) * height * 5 + end_marker.len;
+        return @intCast(@min(len, std.math.maxInt(usize)));
+    }
+
+    /// Encode RGBA8888 `pixels` into `out` (at least `maxEncodedLen` bytes) and return the
+    /// encoded length; null if the size is zero, too large, or doesn't match `pixels`.
+    pub fn encode(out: []u8, width: u32, height: u32, pixels: []const u8) ?usize {
+        if (!validSize(width, height, pixels.len) or out.len < maxEncodedLen(width, height)) return null;
+        @memcpy(out[0..4], magic);
+        std.mem.writeInt(u32, out[4..8], width, .big);
+        std.mem.writeInt(u32, out[8..12], height, .big);
+        // Four channels, sRGB with linear alpha.
+        out[12] = 4;
+        out[13] = 0;
+        var o: usize = header_len;
+
+        var index = [_][4]u8{.{ 0, 0, 0, 0 }} ** 64;
+        var prev = [4]u8{ 0, 0, 0, 255 };
+        var run: u8 = 0;
+        const last = pixels.len / 4 - 1;
+        var i: usize = 0;
+        while (i <= last) : (i += 1) {
+            const px = pixels[i * 4 ..][0..4].*;
+            if (std.mem.eql(u8, &px, &prev)) {
+                run += 1;
+                if (run == 62 or i == last) {
+                    out[o] = op_run | (run - 1);
+                    o += 1;
+                    run = 0;
+                }
+                continue;
+            }
+            if (run > 0) {
+                out[o] = op_run | (run - 1);
+                o += 1;
+                run = 0;
+            }
+            const h = hash(px);
+            if (std.mem.eql(u8, &index[h], &px)) {
+                out[o] = op_index | @as(u8, @intCast(h));
+                o += 1;
+            } else if (px[3] == prev[3]) {
+                index[h] = px;
+                const dr: i8 = @bitCast(px[0] -% prev[0]);
+                const dg: i8 = @bitCast(px[1] -% prev[1]);
+                const db: i8 = @bitCast(px[2] -% prev[2]);
+                const dr_dg = dr -% dg;
+                const db_dg = db -% dg;
+                if (dr >= -2 and dr <= 1 and dg >= -2 and dg <= 1 and db >= -2 and db <= 1) {
+                    out[o] = op_diff | @as(u8, @intCast(dr + 2)) << 4 | @as(u8, @intCast(dg + 2)) << 2 | @as(u8, @intCast(db + 2));
+                    o += 1;
+                } else if (dg >= -32 and dg <= 31 and dr_dg >= -8 and dr_dg <= 7 and db_dg >= -8 and db_dg <= 7) {
+                    out[o] = op_luma | @as(u8, @intCast(dg + 32));
+                    out[o + 1] = @as(u8, @intCast(dr_dg + 8)) << 4 | @as(u8, @intCast(db_dg + 8));
+                    o += 2;
+                } else {
+                    out[o..][0..4].* = .{ op_rgb, px[0], px[1], px[2] };
+                    o += 4;
+                }
+            } else {
+                index[h] = px;
+                out[o..][0..5].* = .{ op_rgba, px[0], px[1], px[2], px[3] };
+                o += 5;
+            }
+            prev = px;
+        }
+        out[o..][0..8].* = end_marker;
+        return o + end_marker.len;
+    }
+
+    /// `encode` into memory owned by `allocator`; null if the size is bad.
+    pub fn encodeAlloc(allocator: std.mem.Allocator, width: u32, height: u32, pixels: []const u8) !?[]u8 {
+        if (!validSize(width, height, pixels.len)) return null;
+        const buf = try allocator.alloc(u8, maxEncodedLen(width, height));
+        errdefer allocator.free(buf);
+        const len = encode(buf, width, height, pixels).?;
+        return try allocator.realloc(buf, len);
+    }
+
+    /// Decode a QOI file to RGBA8888 pixels owned by `allocator`. RGB files come out with
+    /// opaque alpha. Null if `data` isn't QOI, is larger than `max_pixels`, or is cut short.
+    pub fn decode(allocator: std.mem.Allocator, data: []const u8) !?Image {
+        const s = size(data) orelse return null;
+        const count = @as(u64, s.width) * s.height;
+        if (count == 0 or count > max_pixels or data[12] < 3 or data[12] > 4 or data[13] > 1) return null;
+        if (data.len < header_len + end_marker.len or count * 4 > std.math.maxInt(usize)) return null;
+        const pixels = try allocator.alloc(u8, @intCast(count * 4));
+        if (!decodeInto(data[header_len .. data.len - end_marker.len], pixels)) {
+            allocator.free(pixels);
+            return null;
+        }
+        return .{ .width = s.width, .height = s.height, .pixels = pixels };
+    }
+
+    fn decodeInto(body: []const u8, pixels: []u8) bool {
+        var index = [_][4]u8{.{ 0, 0, 0, 0 }} ** 64;
+        var px = [4]u8{ 0, 0, 0, 255 };
+        var run: u8 = 0;
+        var p: usize = 0;
+        var i: usize = 0;
+        while (i < pixels.len) : (i += 4) {
+            if (run > 0) {
+                run -= 1;
+            } else {
+                if (p >= body.len) return false;
+                const op = body[p];
+                p += 1;
+                if (op == op_rgb or op == op_rgba) {
+                    const n: usize = if (op == op_rgb) 3 else 4;
+                    if (p + n > body.len) return false;
+                    @memcpy(px[0..n], body[p .. p + n]);
+                    p += n;
+                } else switch (op & 0xC0) {
+                    op_index => px = index[op],
+                    op_diff => {
+                        px[0] +%= (op >> 4 & 3) -% 2;
+                        px[1] +%= (op >> 2 & 3) -% 2;
+                        px[2] +%= (op & 3) -% 2;
+                    },
+                    op_luma => {
+                        if (p >= body.len) return false;
+                        const second = body[p];
+                        p += 1;
+                        const dg = (op & 0x3F) -% 32;
+                        px[0] +%= dg -% 8 +% (second >> 4);
+                        px[1] +%= dg;
+                        px[2] +%= dg -% 8 +% (second & 15);
+                    },
+                    else => run = op & 0x3F,
+                }
+                index[hash(px)] = px;
+            }
+            @memcpy(pixels[i .. i + 4], &px);
+        }
+        return true;
+    }
+};
+
+/// Compact binary encoding and LZ4 compression for save games and level data, matching the
+/// Rust SDK's `pack` module byte for byte. Integers are LEB128 varints (signed ones zigzagged),
+/// floats little-endian bits, and byte strings length-prefixed; read values back with `Reader`
+/// in the order `Writer` wrote them.
+pub const pack = struct {
+    const min_match = 4;
+    const last_literals = 5;
+    const match_find_limit = 12;
+    const max_offset = 65535;
+    const hash_bits = 12;
+
+    /// Writes values into a caller-owned buffer. Writes past the end are dropped and make
+    /// `written` return null.
+    pub const Writer = struct {
+        buf: []u8,
+        len: usize = 0,
+        overflow: bool = false,
+
+        pub fn init(buf: []u8) Writer {
+            return .{ .buf = buf };
+        }
+
+        /// The bytes written, or null if the buffer was too small.
+        pub fn written(self: *const Writer) ?[]const u8 {
+            if (self.overflow) return null;
+            return self.buf[0..self.len];
+        }
+
+        pub fn raw(self: *Writer, data: []const u8) void {
+            if (self.overflow or self.buf.len - self.len < data.len) {
+                self.overflow = true;
+                return;
+            }
+            @memcpy(self.buf[self.len..][0..data.len], data);
+            self.len += data.len;
+        }
+
+        pub fn byte(self: *Writer, value: u8) void {
+            self.raw(&[_]u8{value});
+        }
+
+        pub fn uint(self: *Writer, value: u64) void {
+            var tmp: [10]u8 = undefined;
+            self.raw(tmp[0..writeVarint(&tmp, value)]);
+        }
+
+        pub fn int(self: *Writer, value: i64) void {
+            self.uint(zigzag(value));
+        }
+
+        pub fn boolean(self: *Writer, value: bool) void {
+            self.byte(@intFromBool(value));
+        }
+
+        pub fn float32(self: *Writer, value: f32) void {
+            var tmp: [4]u8 = undefined;
+            std.mem.writeInt(u32, &tmp, @bitCast(value), .little);
+            self.raw(&tmp);
+        }
+
+        pub fn float64(self: *Writer, value: f64) void {
+            var tmp: [8]u8 = undefined;
+            std.mem.writeInt(u64, &tmp, @bitCast(value), .little);
+            self.raw(&tmp);
+        }
+
+        /// Length-prefixed bytes (also used for strings).
+        pub fn bytes(self: *Writer, value: []const u8) void {
+            self.uint(value.len);
+            self.raw(value);
+        }
+    };
+
+    /// Reads values back in the order they were written. Every read returns null once the
+    /// data runs out or doesn't fit the type.
+    pub const Reader = struct {
+        data: []const u8,
+        pos: usize = 0,
+
+        pub fn init(data: []const u8) Reader {
+            return .{ .data = data };
+        }
+
+        /// Bytes not read yet.
+        pub fn remaining(self: *const Reader) usize {
+            return self.data.len - self.pos;
+        }
+
+        pub fn raw(self: *Reader, len: usize) ?[]const u8 {
+            if (self.remaining() < len) return null;
+            defer self.pos += len;
+            return self.data[self.pos..][0..len];
+        }
+
+        pub fn byte(self: *Reader) ?u8 {
+            return (self.raw(1) orelse return null)[0];
+        }
+
+        pub fn uint(self: *Reader) ?u64 {
+            const v = readVarint(self.data[self.pos..]) orelse return null;
+            self.pos += v.len;
+            return v.value;
+        }
+
+        pub fn int(self: *Reader) ?i64 {
+            return unzigzag(self.uint() orelse return null);
+        }
+
+        pub fn boolean(self: *Reader) ?bool {
+            return switch (self.byte() orelse return null) {
+                0 => false,
+                1 => true,
+                else => null,
+            };
+        }
+
+        pub fn float32(self: *Reader) ?f32 {
+            const b = self.raw(4) orelse return null;
+            return @bitCast(std.mem.readInt(u32, b[0..4], .little));
+        }
+
+        pub fn float64(self: *Reader) ?f64 {
+            const b = self.raw(8) orelse return null;
+            return @bitCast(std.mem.readInt(u64, b[0..8], .little));
+        }
+
+        /// Length-prefixed bytes, borrowed from the data.
+        pub fn bytes(self: *Reader) ?[]const u8 {
+            const len = self.uint() orelse return null;
+            if (len > self.remaining()) return null;
+            return self.raw(@intCast(len));
+        }
+    };
+
+    /// Write LEB128 `value` to `out` (at least 10 bytes) and return its length.
+    pub fn writeVarint(out: []u8, value: u64) usize {
+        var v = value;
+        var i: usize = 0;
+        while (v >= 0x80) : (i += 1) {
+            out[i] = @as(u8, @truncate(v)) | 0x80;
+            v >>= 7;
+        }
+        out[i] = @truncate(v);
+        return i + 1;
+    }
+
+    pub const Varint = struct {
+        value: u64,
+        len: usize,
+    };
+
+    /// A LEB128 value from the start of `data`, or null if it's cut short.
+    pub fn readVarint(data: []const u8) ?Varint {
+        var value: u64 = 0;
+        for (data[0..@min(data.len, 10)], 0..) |b, i| {
+            value |= @as(u64, b & 0x7F) << @intCast(7 * i);
+            if (b & 0x80 == 0) return .{ .value = value, .len = i + 1 };
+        }
+        return null;
+    }
+
+    fn zigzag(value: i64) u64 {
+        return @bitCast((value << 1) ^ (value >> 63));
+    }
+
+    fn unzigzag(value: u64) i64 {
+        return @as(i64, @bitCast(value >> 1)) ^ -@as(i64, @intCast(value & 1));
+    }
+
+    /// Bytes `compress` may need for `len` bytes of input.
+    pub fn maxCompressedLen(len: usize) usize {
+        return 10 + len + len / 255 + 16;
+    }
+
+    /// The uncompressed length stored in `compress` output, or null if it has none.
+    pub fn decompressedLen(data: []const u8) ?u64 {
+        return (readVarint(data) orelse return null).value;
+    }
+
+    fn writeLength(out: []u8, o: *usize, len: usize) void {
+        var n = len;
+        while (n >= 255) : (n -= 255) {
+            out[o.*] = 255;
+            o.* += 1;
+        }
+        out[o.*] = @intCast(n);
+        o.* += 1;
+    }
+
+    fn writeSequence(out: []u8, o: *usize, literals: []const u8, offset: usize, match_len: usize) void {
+        const extra: usize = if (match_len == 0) 0 else match_len - min_match;
+        const literal_bits: u8 = @intCast(@min(literals.len, 15));
+        const match_bits: u8 = @intCast(@min(extra, 15));
+        out[o.*] = literal_bits << 4 | match_bits;
+        o.* += 1;
+        if (literals.len >= 15) writeLength(out, o, literals.len - 15);
+        @memcpy(out[o.*..][0..literals.len], literals);
+        o.* += literals.len;
+        if (match_len == 0) return;
+        std.mem.writeInt(u16, out[o.*..][0..2], @intCast(offset), .little);
+        o.* += 2;
+        if (extra >= 15) writeLength(out, o, extra - 15);
+    }
+
+    /// LZ4-compress `data` into `out` (at least `maxCompressedLen(data.len)` bytes): a varint
+    /// of the length, then one LZ4 block. Returns the compressed length, or null if `out` is
+    /// too small.
+    pub fn compress(out: []u8, data: []const u8) ?usize {
+        if (out.len < maxCompressedLen(data.len)) return null;
+        var o = writeVarint(out, data.len);
+
+        // Position + 1 of the last 4 bytes seen with each hash (0 = none).
+        var table = [_]u32{0} ** (1 << hash_bits);
+        var anchor: usize = 0;
+        var i: usize = 0;
+        const match_end = data.len -| last_literals;
+        while (i + match_find_limit < data.len) {
+            const seq = std.mem.readInt(u32, data[i..][0..4], .little);
+            const h = (seq *% 2654435761) >> (32 - hash_bits);
+            const candidate: usize = table[h];
+            table[h] = @intCast(i + 1);
+            if (candidate == 0 or i - (candidate - 1) > max_offset or
+                std.mem.readInt(u32, data[candidate - 1 ..][0..4], .little) != seq)
+            {
+                i += 1;
+                continue;
+            }
+            const from = candidate - 1;
+            var len: usize = min_match;
+            while (i + len < match_end and data[from + len] == data[i + len]) len += 1;
+            writeSequence(out, &o, data[anchor..i], i - from, len);
+            i += len;
+            anchor = i;
+        }
+        writeSequence(out, &o, data[anchor..], 0, 0);
+        return o;
+    }
+
+    /// `compress` into memory owned by `allocator`.
+    pub fn compressAlloc(allocator: std.mem.Allocator, data: []const u8) ![]u8 {
+        const buf = try allocator.alloc(u8, maxCompressedLen(data.len));
+        const len = compress(buf, data).?;
+        return try allocator.realloc(buf, len);
+    }
+
+    fn readLength(data: []const u8, p: *usize) ?usize {
+        var len: usize = 0;
+        while (true) {
+            if (p.* >= data.len) return null;
+            const b = data[p.*];
+            p.* += 1;
+            len = std.math.add(usize, len, b) catch return null;
+            if (b != 255) return len;
+        }
+    }
+
+    /// Undo `compress` into memory owned by `allocator`. Null if `data` is corrupt or cut
+    /// short.
+    pub fn decompress(allocator: std.mem.Allocator, data: []const u8) !?[]u8 {
+        const v = readVarint(data) orelse return null;
+        // LZ4 can't expand a byte into more than 255, so a larger size is corrupt.
+        if (v.value > @as(u64, data.len) * 255) return null;
+        const out = try allocator.alloc(u8, @intCast(v.value));
+        if (decompressInto(data[v.len..], out)) return out;
+        allocator.free(out);
+        return null;
+    }
+
+    /// Decompress an LZ4 block into exactly `out.len` bytes.
+    fn decompressInto(data: []const u8, out: []u8) bool {
+        var p: usize = 0;
+        var o: usize = 0;
+        while (true) {
+            if (p >= data.len) return false;
+            const token = data[p];
+            p += 1;
+            var literals: usize = token >> 4;
+            if (literals == 15) literals += readLength(data, &p) orelse return false;
+            if (literals > data.len - p or literals > out.len - o) return false;
+            @memcpy(out[o..][0..literals], data[p..][0..literals]);
+            p += literals;
+            o += literals;
+            if (p == data.len) break;
+
+            if (data.len - p < 2) return false;
+            const offset: usize = std.mem.readInt(u16, data[p..][0..2], .little);
+            p += 2;
+            var len: usize = token & 15;
+            if (len == 15) len += readLength(data, &p) orelse return false;
+            len += min_match;
+            if (offset == 0 or offset > o or len > out.len - o) return false;
+            // Byte by byte: the match may overlap what it's copying.
+            for (0..len) |k| out[o + k] = out[o - offset + k];
+            o += len;
+        }
+        return o == out.len;
+    }
+};
+
+/// Versioned save games on top of `storage`, matching the Rust SDK's `save` module. A save
+/// type `T` declares its schema and version and packs itself:
+///
+///     pub const schema = "progress";
+///     pub const version: u32 = 2;
+///     pub fn pack(self: T, w: *pack.Writer) void
+///     pub fn unpack(r: *pack.Reader) ?T
+///     // Optional: read a payload written as an older version.
+///     pub fn migrate(old_version: u32, r: *pack.Reader) ?T
+///
+/// Saves are a header (magic, schema, version) ahead of the LZ4-compressed payload.
+pub const save = struct {
+    pub const magic = "w96s";
+
+    pub const Error = error{
+        /// Nothing is saved under the key.
+        Missing,
+        /// The data isn't a save, or is damaged.
+        Corrupt,
+        /// The save holds another schema.
+        WrongSchema,
+        /// The save was written by a newer version of the cart.
+        TooNew,
+        /// `migrate` refused (or is missing for) the save's older version.
+        NoMigration,
+    };
+
+    /// The schema and version at the start of a save. Slices borrow from the data.
+    pub const Header = struct {
+        schema: []const u8,
+        version: u32,
+        /// The compressed fields after the header.
+        payload: []const u8,
+    };
+
+    /// The header of `data`, or null if it isn't a save.
+    pub fn header(data: []const u8) ?Header {
+        if (data.len < magic.len or !std.mem.eql(u8, data[0..magic.len], magic)) return null;
+        var r = pack.Reader.init(data[magic.len..]);
+        const schema = r.bytes() orelse return null;
+        const version = r.uint() orelse return null;
+        if (version > std.math.maxInt(u32)) return null;
+        return .{ .schema = schema, .version = @intCast(version), .payload = r.data[r.pos..] };
+    }
+
+    /// `value` packed into memory owned by `allocator`.
+    fn packAlloc(comptime T: type, allocator: std.mem.Allocator, value: T) ![]u8 {
+        var size: usize = 256;
+        while (true) : (size *= 2) {
+            const buf = try allocator.alloc(u8, size);
+            var w = pack.Writer.init(buf);
+            value.pack(&w);
+            if (w.written()) |bytes| return try allocator.realloc(buf, bytes.len);
+            allocator.free(buf);
+        }
+    }
+
+    /// `value` as save bytes owned by `allocator`.
+    pub fn encode(comptime T: type, allocator: std.mem.Allocator, value: T) ![]u8 {
+        const payload = try packAlloc(T, allocator, value);
+        defer allocator.free(payload);
+        const head_len = magic.len + 10 + T.schema.len + 10;
+        const out = try allocator.alloc(u8, head_len + pack.maxCompressedLen(payload.len));
+        errdefer allocator.free(out);
+        var w = pack.Writer.init(out[0..head_len]);
+        w.raw(magic);
+        w.bytes(T.schema);
+        w.uint(T.version);
+        const o = w.len;
+        const len = pack.compress(out[o..], payload).?;
+        return try allocator.realloc(out, o + len);
+    }
+
+    /// Read save bytes as a `T`, migrating older versions. The decompressed payload is freed
+    /// before it returns, so `unpack` and `migrate` must copy any slices they keep.
+    pub fn decode(comptime T: type, allocator: std.mem.Allocator, data: []const u8) !T {
+        const h = header(data) orelse return Error.Corrupt;
+        if (!std.mem.eql(u8, h.schema, T.schema)) return Error.WrongSchema;
+        if (h.version > T.version) return Error.TooNew;
+        const payload = (try pack.decompress(allocator, h.payload)) orelse return Error.Corrupt;
+        defer allocator.free(payload);
+        var r = pack.Reader.init(payload);
+        const value = if (h.version == T.version)
+            T.unpack(&r) orelse return Error.Corrupt
+        else if (@hasDecl(T, "migrate"))
+            T.migrate(h.version, &r) orelse return Error.NoMigration
+        else
+            return Error.NoMigration;
+        if (r.remaining() != 0) return Error.Corrupt;
+        return value;
+    }
+
+    /// Save `value` under `key` in persistent storage.
+    pub fn write(comptime T: type, allocator: std.mem.Allocator, key: []const u8, value: T) !void {
+        const data = try encode(T, allocator, value);
+        defer allocator.free(data);
+        storage.save(key, data);
+    }
+
+    /// Load the save under `key` from persistent storage.
+    pub fn read(comptime T: type, allocator: std.mem.Allocator, key: []const u8) !T {
+        const data = (try storage.load(allocator, key)) orelse return Error.Missing;
+        defer allocator.free(data);
+        return decode(T, allocator, data);
+    }
+};
+
+/// Localized text: `key = value` tables per locale, with plural forms (`coins.one`,
+/// `coins.other`) and `{name}` arguments. Same text format as the Rust SDK's `i18n` module.
+pub const i18n = struct {
+    pub const Plural = enum { zero, one, two, few, many, other };
+
+    /// The language subtag of a BCP-47 tag ("pt" for "pt-BR").
+    fn language(tag: []const u8) []const u8 {
+        const end = std.mem.indexOfAny(u8, tag, "-_") orelse tag.len;
+        return tag[0..end];
+    }
+
+    fn isAny(lang: []const u8, comptime names: []const []const u8) bool {
+        inline for (names) |name| {
+            if (std.mem.eql(u8, lang, name)) return true;
+        }
+        return false;
+    }
+
+    /// The CLDR plural category of the count `n` in the language of `tag`. Languages without
+    /// a rule here use the English one.
+    pub fn pluralFor(tag: []const u8, n: u64) Plural {
+        const lang = language(tag);
+        const n10 = n % 10;
+        const n100 = n % 100;
+        const slavic_few = n10 >= 2 and n10 <= 4 and !(n100 >= 12 and n100 <= 14);
+        if (isAny(lang, &.{ "ja", "zh", "ko", "vi", "id", "th", "ms" })) return .other;
+        if (isAny(lang, &.{ "fr", "fa", "hi" })) return if (n <= 1) .one else .other;
+        if (std.mem.eql(u8, lang, "pt") and n <= 1 and !std.ascii.eqlIgnoreCase(tag, "pt-PT")) return .one;
+        if (isAny(lang, &.{ "ru", "uk", "be", "pl" })) {
+            if (n == 1) return .one;
+            if (!std.mem.eql(u8, lang, "pl") and n10 == 1 and n100 != 11) return .one;
+            return if (slavic_few) .few else .many;
+        }
+        if (isAny(lang, &.{ "cs", "sk" }) and n >= 2 and n <= 4) return .few;
+        if (std.mem.eql(u8, lang, "ar")) {
+            if (n == 0) return .zero;
+            if (n == 1) return .one;
+            if (n == 2) return .two;
+            if (n100 >= 3 and n100 <= 10) return .few;
+            if (n100 >= 11) return .many;
+            return .other;
+        }
+        if (std.mem.eql(u8, lang, "he") and n == 2) return .two;
+        return if (n == 1) .one else .other;
+    }
+
+    pub const Entry = struct { key: []const u8, value: []const u8 };
+
+    /// The key and raw value of a table line, or null for blank lines, comments and lines
+    /// without `=`.
+    fn entryLine(line: []const u8) ?Entry {
+        const trimmed = std.mem.trim(u8, line, " \t\r");
+        if (trimmed.len == 0 or trimmed[0] == '#') return null;
+        const eq = std.mem.indexOfScalar(u8, trimmed, '=') orelse return null;
+        return .{
+            .key = std.mem.trim(u8, trimmed[0..eq], " \t"),
+            .value = std.mem.trim(u8, trimmed[eq + 1 ..], " \t"),
+        };
+    }
+
+    /// Copy `value` into `out` with `\n`, `\t` and `\\` unescaped. Returns the length.
+    fn unescape(out: []u8, value: []const u8) usize {
+        var len: usize = 0;
+        var i: usize = 0;
+        while (i < value.len) : (i += 1) {
+            var c = value[i];
+            if (c == '\\' and i + 1 < value.len) {
+                i += 1;
+                c = switch (value[i]) {
+                    'n' => '\n',
+                    't' => '\t',
+                    else => value[i],
+                };
+            }
+            out[len] = c;
+            len += 1;
+        }
+        return len;
+    }
+
+    /// One locale's key -> string table. Keys and values live in memory owned by the catalog.
+    pub const Catalog = struct {
+        entries: []Entry,
+        storage: []u8,
+
+        /// Read a table in the text format; `text` can be freed afterwards. A repeated key
+        /// keeps its last value. Free with `deinit`.
+        pub fn parse(allocator: std.mem.Allocator, text: []const u8) !Catalog {
+            var count: usize = 0;
+            var lines = std.mem.splitScalar(u8, text, '\n');
+            while (lines.next()) |line| {
+                if (entryLine(line) != null) count += 1;
+            }
+            const entries = try allocator.alloc(Entry, count);
+            errdefer allocator.free(entries);
+            const storage = try allocator.alloc(u8, text.len);
+            var used: usize = 0;
+            var i: usize = 0;
+            lines = std.mem.splitScalar(u8, text, '\n');
+            while (lines.next()) |line| {
+                const raw = entryLine(line) orelse continue;
+                const k = storage[used..][0..raw.key.len];
+                @memcpy(k, raw.key);
+                used += k.len;
+                const value_len = unescape(storage[used..], raw.value);
+                entries[i] = .{ .key = k, .value = storage[used..][0..value_len] };
+                used += value_len;
+                i += 1;
+            }
+            return .{ .entries = entries, .storage = storage };
+        }
+
+        pub fn deinit(self: *Catalog, allocator: std.mem.Allocator) void {
+            allocator.free(self.entries);
+            allocator.free(self.storage);
+            self.* = undefined;
+        }
+
+        /// The string under `key`.
+        pub fn get(self: *const Catalog, key: []const u8) ?[]const u8 {
+            var i = self.entries.len;
+            while (i > 0) {
+                i -= 1;
+                if (std.mem.eql(u8, self.entries[i].key, key)) return self.entries[i].value;
+            }
+            return null;
+        }
+    };
+
+    pub const Arg = struct { name: []const u8, value: []const u8 };
+
+    /// Write `template` to `out` with each `{name}` replaced by the matching argument. Unknown
+    /// names are left as written; `{{` and `}}` are literal braces. Null if `out` is too small.
+    pub fn format(out: []u8, template: []const u8, args: []const Arg) ?[]u8 {
+        var len: usize = 0;
+        var i: usize = 0;
+        while (i < template.len) {
+            const c = template[i];
+            var piece = template[i .. i + 1];
+            var step: usize = 1;
+            if ((c == '{' or c == '}') and i + 1 < template.len and template[i + 1] == c) {
+                step = 2;
+            } else if (c == '{') {
+                if (std.mem.indexOfScalarPos(u8, template, i + 1, '}')) |end| {
+                    for (args) |arg| {
+                        if (std.mem.eql(u8, arg.name, template[i + 1 .. end])) {
+                            piece = arg.value;
+                            step = end + 1 - i;
+                            break;
+                        }
+                    }
+                }
+            }
+            if (len + piece.len > out.len) return null;
+            @memcpy(out[len..][0..piece.len], piece);
+            len += piece.len;
+            i += step;
+        }
+        return out[0..len];
+    }
+
+    /// Tables for up to `max_locales` locales, a current one, and a fallback for keys it lacks.
+    pub fn I18n(comptime max_locales: usize) type {
+        return struct {
+            const Self = @This();
+
+            tags: [max_locales][]const u8 = undefined,
+            catalogs: [max_locales]Catalog = undefined,
+            count: usize = 0,
+            current: ?usize = null,
+            fallback: ?usize = null,
+
+            /// Add `catalog` for the locale `tag` (not copied; it must outlive this). The first
+            /// one added becomes current. False when full; the catalog is still the caller's.
+            pub fn add(self: *Self, tag: []const u8, catalog: Catalog) bool {
+                if (self.count == max_locales) return false;
+                self.tags[self.count] = tag;
+                self.catalogs[self.count] = catalog;
+                if (self.current == null) self.current = self.count;
+                self.count += 1;
+                return true;
+            }
+
+            /// Free every added catalog.
+            pub fn deinit(self: *Self, allocator: std.mem.Allocator) void {
+                for (self.catalogs[0..self.count]) |*c| c.deinit(allocator);
+                self.count = 0;
+                self.current = null;
+                self.fallback = null;
+            }
+
+            /// Exact match first (ignoring case), then the same language.
+            fn bestMatch(self: *const Self, tag: []const u8) ?usize {
+                for (self.tags[0..self.count], 0..) |known, i| {
+                    if (std.ascii.eqlIgnoreCase(known, tag)) return i;
+                }
+                for (self.tags[0..self.count], 0..) |known, i| {
+                    if (std.ascii.eqlIgnoreCase(language(known), language(tag))) return i;
+                }
+                return null;
+            }
+
+            /// Switch to the table that best matches `tag`. False, keeping the current table,
+            /// when no table has the same language.
+            pub fn setLocale(self: *Self, tag: []const u8) bool {
+                self.current = self.bestMatch(tag) orelse return false;
+                return true;
+            }
+
+            /// `setLocale` with the player's locale from `system.locale`.
+            pub fn useSystemLocale(self: *Self, allocator: std.mem.Allocator) !bool {
+                const tag = try system.locale(allocator);
+                defer allocator.free(tag);
+                return self.setLocale(tag);
+            }
+
+            /// Look keys the current table lacks up in the table best matching `tag`.
+            pub fn setFallback(self: *Self, tag: []const u8) void {
+                self.fallback = self.bestMatch(tag);
+            }
+
+            /// The current locale's tag, if any table was added.
+            pub fn currentLocale(self: *const Self) ?[]const u8 {
+                return if (self.current) |i| self.tags[i] else null;
+            }
+
+            /// The current table, then the fallback when it's a different one.
+            fn lookupOrder(self: *const Self) [2]?usize {
+                var order = [2]?usize{ self.current, self.fallback };
+                if (self.current) |c| {
+                    if (self.fallback) |f| {
+                        if (c == f) order[1] = null;
+                    }
+                }
+                return order;
+            }
+
+            /// The string under `key` in the current or fallback table.
+            pub fn get(self: *const Self, key: []const u8) ?[]const u8 {
+                for (self.lookupOrder()) |slot| {
+                    const i = slot orelse continue;
+                    if (self.catalogs[i].get(key)) |value| return value;
+                }
+                return null;
+            }
+
+            /// The string under `key`, or the key itself.
+            pub fn t(self: *const Self, key: []const u8) []const u8 {
+                return self.get(key) orelse key;
+            }
+
+            /// The string under `key` with its arguments filled in, written to `out`.
+            pub fn fmt(self: *const Self, out: []u8, key: []const u8, args: []const Arg) ?[]u8 {
+                return i18n.format(out, self.t(key), args);
+            }
+
+            /// The plural form of `key` for the count `n` with `{n}` and up to 15 `args`
+            /// filled in, written to `out`. Tries `key.<category>`, `key.other`, then `key`,
+            /// in the current table and then the fallback.
+            pub fn plural(self: *const Self, out: []u8, key: []const u8, n: u64, args: []const Arg) ?[]u8 {
+                var template: []const u8 = key;
+                var key_buf: [128]u8 = undefined;
+                find: for (self.lookupOrder()) |slot| {
+                    const i = slot orelse continue;
+                    const suffixes = [_][]const u8{ @tagName(pluralFor(self.tags[i], n)), "other" };
+                    for (suffixes) |suffix| {
+                        const full = std.fmt.bufPrint(&key_buf, "{s}.{s}", .{ key, suffix }) catch continue;
+                        if (self.catalogs[i].get(full)) |value| {
+                            template = value;
+                            break :find;
+                        }
+                    }
+                    if (self.catalogs[i].get(key)) |value| {
+                        template = value;
+                        break :find;
+                    }
+                }
+                var n_buf: [20]u8 = undefined;
+                var all: [16]Arg = undefined;
+                all[0] = .{ .name = "n", .value = std.fmt.bufPrint(&n_buf, "{d}", .{n}) catch unreachable };
+                const extra = @min(args.len, all.len - 1);
+                @memcpy(all[1..][0..extra], args[0..extra]);
+                return i18n.format(out, template, all[0 .. extra + 1]);
+            }
+        };
+    }
+};
+
+/// Deterministic Q16.16 fixed-point math for game state that must match bit for bit across
+/// machines (netplay, replays checked by hash). Integer-only; arithmetic saturates.
+pub const fixed = struct {
+    pub const frac_bits = 16;
+
+    const quarter = 256;
+    const steps: i64 = 4 * quarter;
+
+    /// Sine of `i / quarter` of a quarter turn for `i` in `0..=quarter`, in Q16.16.
+    const sin_table: [quarter + 1]i32 = blk: {
+        @setEvalBranchQuota(100_000);
+        // pi/2 in Q30; a Taylor series in Q30 with eight terms.
+        const half_pi_q30: i64 = 1_686_629_713;
+        var table: [quarter + 1]i32 = undefined;
+        for (0..quarter + 1) |i| {
+            const x = @divTrunc(half_pi_q30 * @as(i64, @intCast(i)), quarter);
+            var term = x;
+            var sum = x;
+            var k: i64 = 1;
+            while (k <= 8) : (k += 1) {
+                term = (term * x) >> 30;
+                term = (term * x) >> 30;
+                term = -@divTrunc(term, (2 * k) * (2 * k + 1));
+                sum += term;
+            }
+            table[i] = @intCast((sum + (1 << 13)) >> 14);
+        }
+        break :blk table;
+    };
+
+    /// `atan(2^-i)` in Q16.16 radians, for CORDIC.
+    const atan_table = [16]i64{ 51472, 30386, 16055, 8150, 4091, 2047, 1024, 512, 256, 128, 64, 32, 16, 8, 4, 2 };
+
+    fn saturate(v: i64) Fixed {
+        return .{ .bits = @intCast(std.math.clamp(v, std.math.minInt(i32), std.math.maxInt(i32))) };
+    }
+
+    /// A Q16.16 fixed-point number.
+    pub const Fixed = struct {
+        bits: i32 = 0,
+
+        pub const zero = Fixed{ .bits = 0 };
+        pub const one = Fixed{ .bits = 1 << frac_bits };
+        pub const half = Fixed{ .bits = 1 << (frac_bits - 1) };
+        pub const epsilon = Fixed{ .bits = 1 };
+        pub const max_value = Fixed{ .bits = std.math.maxInt(i32) };
+        pub const min_value = Fixed{ .bits = std.math.minInt(i32) };
+        pub const pi = Fixed{ .bits = 205_887 };
+        pub const half_pi = Fixed{ .bits = 102_944 };
+        pub const tau = Fixed{ .bits = 411_775 };
+
+        pub fn fromBits(bits: i32) Fixed {
+            return .{ .bits = bits };
+        }
+
+        pub fn fromInt(n: i32) Fixed {
+            return saturate(@as(i64, n) << frac_bits);
+        }
+
+        /// `num / den`, rounded toward zero. Saturates when `den` is 0.
+        pub fn fromRatio(num: i32, den: i32) Fixed {
+            if (den == 0) return if (num < 0) min_value else max_value;
+            return saturate(@divTrunc(@as(i64, num) << frac_bits, den));
+        }
+
+        /// Only for values that don't feed back into the simulation; prefer `fromRatio`.
+        pub fn fromFloat(v: f32) Fixed {
+            return saturate(@intFromFloat(std.math.clamp(v * 65536.0, -2147483648.0, 2147483647.0)));
+        }
+
+        /// For drawing and display.
+        pub fn toFloat(self: Fixed) f32 {
+            return @as(f32, @floatFromInt(self.bits)) / 65536.0;
+        }
+
+        /// Largest integer not greater than `self`.
+        pub fn toInt(self: Fixed) i32 {
+            return self.bits >> frac_bits;
+        }
+
+        /// Nearest integer, halves rounding up.
+        pub fn roundToInt(self: Fixed) i32 {
+            return @intCast((@as(i64, self.bits) + (1 << (frac_bits - 1))) >> frac_bits);
+        }
+
+        pub fn floor(self: Fixed) Fixed {
+            return .{ .bits = self.bits & ~@as(i32, (1 << frac_bits) - 1) };
+        }
+
+        /// `self - self.floor()` (always non-negative).
+        pub fn fract(self: Fixed) Fixed {
+            return .{ .bits = self.bits & ((1 << frac_bits) - 1) };
+        }
+
+        pub fn abs(self: Fixed) Fixed {
+            const v: i64 = self.bits;
+            return saturate(if (v < 0) -v else v);
+        }
+
+        pub fn add(a: Fixed, b: Fixed) Fixed {
+            return .{ .bits = a.bits +| b.bits };
+        }
+
+        pub fn sub(a: Fixed, b: Fixed) Fixed {
+            return .{ .bits = a.bits -| b.bits };
+        }
+
+        pub fn mul(a: Fixed, b: Fixed) Fixed {
+            return saturate((@as(i64, a.bits) * b.bits) >> frac_bits);
+        }
+
+        /// Saturates on division by zero.
+        pub fn div(a: Fixed, b: Fixed) Fixed {
+            if (b.bits == 0) return if (a.bits < 0) min_value else max_value;
+            return saturate(@divTrunc(@as(i64, a.bits) << frac_bits, b.bits));
+        }
+
+        pub fn neg(self: Fixed) Fixed {
+            return saturate(-@as(i64, self.bits));
+        }
+
+        pub fn lessThan(a: Fixed, b: Fixed) bool {
+            return a.bits < b.bits;
+        }
+
+        pub fn min(a: Fixed, b: Fixed) Fixed {
+            return if (b.bits < a.bits) b else a;
+        }
+
+        pub fn max(a: Fixed, b: Fixed) Fixed {
+            return if (b.bits > a.bits) b else a;
+        }
+
+        pub fn clamp(self: Fixed, lo: Fixed, hi: Fixed) Fixed {
+            return self.max(lo).min(hi);
+        }
+
+        /// `a` at `t = 0`, `b` at `t = 1`; `t` is not clamped.
+        pub fn lerp(a: Fixed, b: Fixed, t: Fixed) Fixed {
+            return a.add(b.sub(a).mul(t));
+        }
+
+        /// Square root; 0 for non-positive values.
+        pub fn sqrt(self: Fixed) Fixed {
+            if (self.bits <= 0) return zero;
+            return .{ .bits = @intCast(std.math.sqrt(@as(u64, @intCast(self.bits)) << frac_bits)) };
+        }
+
+        /// `sqrt(x² + y²)` without intermediate overflow.
+        pub fn hypot(x: Fixed, y: Fixed) Fixed {
+            const xx: u64 = @intCast(@as(i64, x.bits) * x.bits);
+            const yy: u64 = @intCast(@as(i64, y.bits) * y.bits);
+            return saturate(@intCast(std.math.sqrt(xx + yy)));
+        }
+
+        fn sinSteps(p: i64) Fixed {
+            const wrapped = @mod(p, steps << frac_bits);
+            const step = wrapped >> frac_bits;
+            const frac = wrapped & ((1 << frac_bits) - 1);
+            const a = tableAt(step);
+            const b = tableAt(step + 1);
+            return .{ .bits = @intCast(a + ((b - a) * frac >> frac_bits)) };
+        }
+
+        fn tableAt(step_in: i64) i64 {
+            const step: usize = @intCast(@mod(step_in, steps));
+            const i = step % quarter;
+            return switch (step / quarter) {
+                0 => sin_table[i],
+                1 => sin_table[quarter - i],
+                2 => -@as(i64, sin_table[i]),
+                else => -@as(i64, sin_table[quarter - i]),
+            };
+        }
+
+        fn phase(self: Fixed) i64 {
+            return @divFloor(@as(i64, self.bits) * (steps << frac_bits), tau.bits);
+        }
+
+        /// Sine of `self` radians.
+        pub fn sin(self: Fixed) Fixed {
+            return sinSteps(self.phase());
+        }
+
+        /// Cosine of `self` radians.
+        pub fn cos(self: Fixed) Fixed {
+            return sinSteps(self.phase() + (quarter << frac_bits));
+        }
+
+        /// Angle of `(x, y)` in radians, in `-pi..=pi`; 0 for the zero vector.
+        pub fn atan2(y_in: Fixed, x_in: Fixed) Fixed {
+            var x: i64 = x_in.bits;
+            var y: i64 = y_in.bits;
+            if (x == 0 and y == 0) return zero;
+            var angle: i64 = 0;
+            if (x < 0) {
+                const ox = x;
+                if (y >= 0) {
+                    x = y;
+                    y = -ox;
+                    angle = half_pi.bits;
+                } else {
+                    x = -y;
+                    y = ox;
+                    angle = -@as(i64, half_pi.bits);
+                }
+            }
+            const big: u64 = @max(@abs(x), @abs(y));
+            const shift: u6 = @intCast(@max(@as(i64, @clz(big)) - 24, 0));
+            x <<= shift;
+            y <<= shift;
+            for (atan_table, 0..) |atan, i| {
+                const s: u6 = @intCast(i);
+                const dx = y >> s;
+                const dy = x >> s;
+                if (y > 0) {
+                    x += dx;
+                    y -= dy;
+                    angle += atan;
+                } else {
+                    x -= dx;
+                    y += dy;
+                    angle -= atan;
+                }
+            }
+            return saturate(angle);
+        }
+    };
+};
+
+/// Collision helpers: overlap contacts, raycasts, swept boxes and a fixed-size spatial hash.
+/// Nothing here allocates.
+pub const collide = struct {
+    const Vec2 = math.Vec2;
+    const Rect = math.Rect;
+
+    /// Separate overlapping shapes by moving the first by `normal * depth`.
+    pub const Contact = struct {
+        /// Unit vector from the second shape towards the first.
+        normal: Vec2,
+        depth: f32,
+    };
+
+    /// Where a moving point or box first touches a target.
+    pub const Hit = struct {
+        /// Fraction of the motion completed at impact, 0..1.
+        time: f32,
+        point: Vec2,
+        normal: Vec2,
+    };
+
+    /// Overlap of two boxes along the axis of least overlap; touching edges don't count.
+    pub fn aabbAabb(a: Rect, b: Rect) ?Contact {
+        const overlap = a.intersection(b) orelse return null;
+        const d = a.center().sub(b.center());
+        if (overlap.w < overlap.h) {
+            return .{ .normal = Vec2.init(if (d.x < 0) -1 else 1, 0), .depth = overlap.w };
+        }
+        return .{ .normal = Vec2.init(0, if (d.y < 0) -1 else 1), .depth = overlap.h };
+    }
+
+    /// Overlap of two circles; concentric circles separate upwards.
+    pub fn circleCircle(a: Vec2, ra: f32, b: Vec2, rb: f32) ?Contact {
+        const d = a.sub(b);
+        const r = ra + rb;
+        const dist_sq = d.dot(d);
+        if (dist_sq >= r * r) return null;
+        const dist = @sqrt(dist_sq);
+        return .{ .normal = if (dist > 0) d.scale(1 / dist) else Vec2.init(0, -1), .depth = r - dist };
+    }
+
+    /// Overlap of a circle and a box; the contact moves the circle out of the box.
+    pub fn circleAabb(c: Vec2, radius: f32, r: Rect) ?Contact {
+        const nearest = Vec2.init(math.clamp(c.x, r.x, r.right()), math.clamp(c.y, r.y, r.bottom()));
+        const d = c.sub(nearest);
+        const dist_sq = d.dot(d);
+        if (dist_sq > 0) {
+            if (dist_sq >= radius * radius) return null;
+            const dist = @sqrt(dist_sq);
+            return .{ .normal = d.scale(1 / dist), .depth = radius - dist };
+        }
+        // Center inside the box: leave through the nearest edge.
+        var best = Contact{ .normal = Vec2.init(-1, 0), .depth = c.x - r.x };
+        const exits = [_]Contact{
+            .{ .normal = Vec2.init(1, 0), .depth = r.right() - c.x },
+            .{ .normal = Vec2.init(0, -1), .depth = c.y - r.y },
+            .{ .normal = Vec2.init(0, 1), .depth = r.bottom() - c.y },
+        };
+        for (exits) |e| {
+            if (e.depth < best.depth) best = e;
+        }
+        best.depth += radius;
+        return best;
+    }
+
+    /// First point where the segment `from..to` enters `r`. Starting inside, or sliding along
+    /// an edge, is not a hit.
+    pub fn segmentAabb(from: Vec2, to: Vec2, r: Rect) ?Hit {
+        const d = to.sub(from);
+        var t_near = -std.math.inf(f32);
+        var t_far = std.math.inf(f32);
+        var normal = Vec2.zero;
+        const axes = [_]struct { o: f32, dir: f32, min: f32, max: f32, n: Vec2 }{
+            .{ .o = from.x, .dir = d.x, .min = r.x, .max = r.right(), .n = Vec2.init(1, 0) },
+            .{ .o = from.y, .dir = d.y, .min = r.y, .max = r.bottom(), .n = Vec2.init(0, 1) },
+        };
+        for (axes) |a| {
+            if (a.dir == 0) {
+                if (a.o <= a.min or a.o >= a.max) return null;
+                continue;
+            }
+            const t1 = (a.min - a.o) / a.dir;
+            const t2 = (a.max - a.o) / a.dir;
+            const lo = @min(t1, t2);
+            if (lo > t_near) {
+                t_near = lo;
+                normal = if (a.dir > 0) a.n.scale(-1) else a.n;
+            }
+            t_far = @min(t_far, @max(t1, t2));
+        }
+        if (t_near >= t_far or t_near < 0 or t_near > 1) return null;
+        return .{ .time = t_near, .point = from.add(d.scale(t_near)), .normal = normal };
+    }
+
+    /// First point where the segment `from..to` enters the circle; starting inside is not a hit.
+    pub fn segmentCircle(from: Vec2, to: Vec2, c: Vec2, radius: f32) ?Hit {
+        const d = to.sub(from);
+        const f = from.sub(c);
+        const a = d.dot(d);
+        const cc = f.dot(f) - radius * radius;
+        if (a == 0 or cc <= 0) return null;
+        const b = f.dot(d);
+        const disc = b * b - a * cc;
+        if (disc < 0) return null;
+        const t = (-b - @sqrt(disc)) / a;
+        if (t < 0 or t > 1) return null;
+        const point = from.add(d.scale(t));
+        return .{ .time = t, .point = point, .normal = point.sub(c).normalize() };
+    }
+
+    /// When `moving`, travelling by `delta`, first touches `target`.
+    pub fn sweepAabb(moving: Rect, delta: Vec2, target: Rect) ?Hit {
+        const expanded = Rect.init(target.x - moving.w, target.y - moving.h, target.w + moving.w, target.h + moving.h);
+        const from = Vec2.init(moving.x, moving.y);
+        return segmentAabb(from, from.add(delta), expanded);
+    }
+
+    pub const Move = struct {
+        rect: Rect,
+        blocked_x: bool,
+        blocked_y: bool,
+    };
+
+    /// Move `r` by `delta` through `solids`, x then y, stopping flush against the first solid
+    /// on each axis (the platformer step). Solids already overlapped are ignored.
+    pub fn moveAabb(r: Rect, delta: Vec2, solids: []const Rect) Move {
+        var rect = r;
+        var blocked = [2]bool{ false, false };
+        const steps = [2]Vec2{ Vec2.init(delta.x, 0), Vec2.init(0, delta.y) };
+        for (steps, 0..) |step, axis| {
+            if (step.x == 0 and step.y == 0) continue;
+            var first: f32 = 1;
+            for (solids) |solid| {
+                if (sweepAabb(rect, step, solid)) |hit| {
+                    first = @min(first, hit.time);
+                    blocked[axis] = true;
+                }
+            }
+            rect = rect.translate(step.scale(first));
+        }
+        return .{ .rect = rect, .blocked_x = blocked[0], .blocked_y = blocked[1] };
+    }
+
+    /// A uniform grid hashed into `bucket_count` buckets (a power of two) holding up to
+    /// `max_items` boxes and `max_refs` item-in-bucket references, all in fixed arrays.
+    pub fn SpatialHash(comptime max_items: usize, comptime bucket_count: usize, comptime max_refs: usize) type {
+        comptime std.debug.assert(std.math.isPowerOfTwo(bucket_count));
+        return struct {
+            const Self = @This();
+            const none = std.math.maxInt(u32);
+
+            cell_size: f32,
+            heads: [bucket_count]u32 = [_]u32{none} ** bucket_count,
+            ref_item: [max_refs]u32 = undefined,
+            ref_next: [max_refs]u32 = undefined,
+            refs: usize = 0,
+            ids: [max_items]u32 = undefined,
+            bounds: [max_items]Rect = undefined,
+            seen: [max_items]u32 = undefined,
+            items: usize = 0,
+            generation: u32 = 0,
+
+            pub fn init(cell_size: f32) Self {
+                return .{ .cell_size = if (cell_size > 0) cell_size else 1 };
+            }
+
+            pub fn clear(self: *Self) void {
+                self.heads = [_]u32{none} ** bucket_count;
+                self.refs = 0;
+                self.items = 0;
+            }
+
+            /// Add a box under `id`. False if the grid is full.
+            pub fn insert(self: *Self, id: u32, r: Rect) bool {
+                if (self.items == max_items) return false;
+                const index: u32 = @intCast(self.items);
+                var it = self.cells(r);
+                while (it.next()) |b| {
+                    if (self.heads[b] != none and self.ref_item[self.heads[b]] == index) continue;
+                    if (self.refs == max_refs) return false;
+                    self.ref_item[self.refs] = index;
+                    self.ref_next[self.refs] = self.heads[b];
+                    self.heads[b] = @intCast(self.refs);
+                    self.refs += 1;
+                }
+                self.ids[self.items] = id;
+                self.bounds[self.items] = r;
+                self.seen[self.items] = self.generation;
+                self.items += 1;
+                return true;
+            }
+
+            /// Write the ids of items overlapping `area` to `out`, each once; returns how many.
+            pub fn query(self: *Self, area: Rect, out: []u32) usize {
+                self.generation +%= 1;
+                if (self.generation == 0) {
+                    @memset(self.seen[0..self.items], 0);
+                    self.generation = 1;
+                }
+                var n: usize = 0;
+                var it = self.cells(area);
+                while (it.next()) |b| {
+                    var ref = self.heads[b];
+                    while (ref != none and n < out.len) : (ref = self.ref_next[ref]) {
+                        const i = self.ref_item[ref];
+                        if (self.seen[i] != self.generation and self.bounds[i].intersects(area)) {
+                            self.seen[i] = self.generation;
+                            out[n] = self.ids[i];
+                            n += 1;
+                        }
+                    }
+                }
+                return n;
+            }
+
+            const Cells = struct {
+                x0: i32,
+                x1: i32,
+                y1: i32,
+                x: i32,
+                y: i32,
+                /// Covers too many cells: walk every bucket instead.
+                all: bool,
+                bucket: usize = 0,
+
+                fn next(c: *Cells) ?usize {
+                    if (c.all) {
+                        if (c.bucket == bucket_count) return null;
+                        c.bucket += 1;
+                        return c.bucket - 1;
+                    }
+                    if (c.y > c.y1) return null;
+                    const b = bucketIndex(c.x, c.y);
+                    c.x += 1;
+                    if (c.x > c.x1) {
+                        c.x = c.x0;
+                        c.y += 1;
+                    }
+                    return b;
+                }
+            };
+
+            fn cells(self: *const Self, r: Rect) Cells {
+                const limit = @as(f32, @floatFromInt(std.math.maxInt(i32)));
+                const x0 = @floor(r.x / self.cell_size);
+                const y0 = @floor(r.y / self.cell_size);
+                const x1 = @floor(r.right() / self.cell_size);
+                const y1 = @floor(r.bottom() / self.cell_size);
+                const fits = @abs(x0) < limit and @abs(y0) < limit and @abs(x1) < limit and @abs(y1) < limit;
+                if (!fits or (x1 - x0 + 1) * (y1 - y0 + 1) >= bucket_count) {
+                    return .{ .x0 = 0, .x1 = 0, .y1 = 0, .x = 0, .y = 0, .all = true };
+                }
+                return .{
+                    .x0 = @intFromFloat(x0),
+                    .x1 = @intFromFloat(x1),
+                    .y1 = @intFromFloat(y1),
+                    .x = @intFromFloat(x0),
+                    .y = @intFromFloat(y0),
+                    .all = false,
+                };
+            }
+
+            fn bucketIndex(cx: i32, cy: i32) usize {
+                const h = @as(u32, @bitCast(cx)) *% 0x9E3779B1 ^ @as(u32, @bitCast(cy)) *% 0x85EBCA77;
+                return h & (bucket_count - 1);
+            }
+        };
+    }
+};
+
+/// A small entity-component registry with fixed capacity; nothing here allocates.
+///
+/// `World(max)` hands out generational `Entity` ids and each component type lives in its own
+/// `Storage(T, max)` sparse set. Queries iterate one storage and look entities up in others.
+/// Changes made while iterating go through `despawnLater`/`insertLater`/`removeLater` and apply at
+/// `world.flush()` followed by `storage.flush(&world)` on every storage.
+pub const ecs = struct {
+    pub const Entity = struct {
+        index: u32,
+        generation: u32,
+
+        pub fn eql(a: Entity, b: Entity) bool {
+            return a.index == b.index and a.generation == b.generation;
+        }
+    };
+
+    pub fn World(comptime max_entities: u32) type {
+        return struct {
+            const Self = @This();
+
+            generations: [max_entities]u32 = [_]u32{0} ** max_entities,
+            alive: [max_entities]bool = [_]bool{false} ** max_entities,
+            /// Slots ever handed out; free slots below this are found by scanning `alive`.
+            high: u32 = 0,
+            count: u32 = 0,
+            doomed: [max_entities]Entity = undefined,
+            doomed_len: u32 = 0,
+            /// Bumped whenever an entity is despawned, so storages know when to sweep.
+            despawns: u32 = 0,
+
+            /// A new live entity, or null when all `max_entities` are alive.
+            pub fn spawn(self: *Self) ?Entity {
+                var i: u32 = 0;
+                while (i < self.high and self.alive[i]) : (i += 1) {}
+                if (i == self.high) {
+                    if (self.high == max_entities) return null;
+                    self.high += 1;
+                }
+                self.alive[i] = true;
+                self.count += 1;
+                return .{ .index = i, .generation = self.generations[i] };
+            }
+
+            pub fn isAlive(self: *const Self, e: Entity) bool {
+                return e.index < self.high and self.alive[e.index] and self.generations[e.index] == e.generation;
+            }
+
+            /// Despawn `e` now. Returns false if it was already gone.
+            pub fn despawn(self: *Self, e: Entity) bool {
+                if (!self.isAlive(e)) return false;
+                self.alive[e.index] = false;
+                self.generations[e.index] +%= 1;
+                self.count -= 1;
+                self.despawns +%= 1;
+                return true;
+            }
+
+            /// Despawn `e` at the next `flush`; safe to call while iterating.
+            pub fn despawnLater(self: *Self, e: Entity) void {
+                if (self.doomed_len < max_entities) {
+                    self.doomed[self.doomed_len] = e;
+                    self.doomed_len += 1;
+                }
+            }
+
+            pub fn flush(self: *Self) void {
+                for (self.doomed[0..self.doomed_len]) |e| _ = self.despawn(e);
+                self.doomed_len = 0;
+            }
+
+            pub fn len(self: *const Self) u32 {
+                return self.count;
+            }
+        };
+    }
+
+    pub fn Storage(comptime T: type, comptime max_entities: u32) type {
+        return struct {
+            const Self = @This();
+            const empty = std.math.maxInt(u32);
+
+            sparse: [max_entities]u32 = [_]u32{empty} ** max_entities,
+            dense: [max_entities]Entity = undefined,
+            data: [max_entities]T = undefined,
+            count: u32 = 0,
+            pending: [max_entities]Pending = undefined,
+            pending_len: u32 = 0,
+            swept: u32 = 0,
+
+            const Pending = struct { entity: Entity, value: ?T };
+
+            fn slot(self: *const Self, e: Entity) ?u32 {
+                if (e.index >= max_entities) return null;
+                const s = self.sparse[e.index];
+                return if (s != empty and self.dense[s].eql(e)) s else null;
+            }
+
+            /// Attach `value` to `e`, replacing any component it (or a stale id in its slot) had.
+            pub fn insert(self: *Self, e: Entity, value: T) void {
+                if (e.index >= max_entities) return;
+                const s = self.sparse[e.index];
+                if (s != empty) {
+                    self.dense[s] = e;
+                    self.data[s] = value;
+                    return;
+                }
+                self.sparse[e.index] = self.count;
+                self.dense[self.count] = e;
+                self.data[self.count] = value;
+                self.count += 1;
+            }
+
+            pub fn remove(self: *Self, e: Entity) bool {
+                const s = self.slot(e) orelse return false;
+                self.removeSlot(s);
+                return true;
+            }
+
+            fn removeSlot(self: *Self, s: u32) void {
+                self.sparse[self.dense[s].index] = empty;
+                self.count -= 1;
+                if (s != self.count) {
+                    self.dense[s] = self.dense[self.count];
+                    self.data[s] = self.data[self.count];
+                    self.sparse[self.dense[s].index] = s;
+                }
+            }
+
+            pub fn get(self: *Self, e: Entity) ?*T {
+                const s = self.slot(e) orelse return null;
+                return &self.data[s];
+            }
+
+            pub fn contains(self: *const Self, e: Entity) bool {
+                return self.slot(e) != null;
+            }
+
+            /// Entities with this component, parallel to `values()`.
+            pub fn entities(self: *const Self) []const Entity {
+                return self.dense[0..self.count];
+            }
+
+            pub fn values(self: *Self) []T {
+                return self.data[0..self.count];
+            }
+
+            pub fn insertLater(self: *Self, e: Entity, value: T) void {
+                self.queue(.{ .entity = e, .value = value });
+            }
+
+            pub fn removeLater(self: *Self, e: Entity) void {
+                self.queue(.{ .entity = e, .value = null });
+            }
+
+            fn queue(self: *Self, p: Pending) void {
+                if (self.pending_len < max_entities) {
+                    self.pending[self.pending_len] = p;
+                    self.pending_len += 1;
+                }
+            }
+
+            /// Apply queued inserts/removes, then drop components of entities `world` no longer has.
+            /// Call after `world.flush()`.
+            pub fn flush(self: *Self, world: anytype) void {
+                for (self.pending[0..self.pending_len]) |p| {
+                    if (p.value) |v| {
+                        if (world.isAlive(p.entity)) self.insert(p.entity, v);
+                    } else {
+                        _ = self.remove(p.entity);
+                    }
+                }
+                self.pending_len = 0;
+                if (self.swept != world.despawns) {
+                    self.swept = world.despawns;
+                    var s: u32 = 0;
+                    while (s < self.count) {
+                        if (world.isAlive(self.dense[s])) s += 1 else self.removeSlot(s);
+                    }
+                }
+            }
+        };
+    }
+};
+
+/// Easing curves, tweens and sequence/parallel groups for UI transitions and juice.
+pub const tween = struct {
+    /// An easing curve: maps linear progress `0..1` to eased progress (`back`/`elastic` overshoot).
+    pub const Ease = enum {
+        linear,
+        quad_in,
+        quad_out,
+        quad_in_out,
+        cubic_in,
+        cubic_out,
+        cubic_in_out,
+        sine_in,
+        sine_out,
+        sine_in_out,
+        expo_in,
+        expo_out,
+        expo_in_out,
+        back_in,
+        back_out,
+        back_in_out,
+        elastic_in,
+        elastic_out,
+        elastic_in_out,
+        bounce_in,
+        bounce_out,
+        bounce_in_out,
+
+        /// Eased progress at `t` (clamped to `0..1`). Every curve maps 0 to 0 and 1 to 1.
+        pub fn apply(self: Ease, t_in: f32) f32 {
+            const t = math.clamp(t_in, 0, 1);
+            return switch (self) {
+                .linear => t,
+                .quad_in => quad(t),
+                .quad_out => 1 - quad(1 - t),
+                .quad_in_out => inOut(quad, t),
+                .cubic_in => cubic(t),
+                .cubic_out => 1 - cubic(1 - t),
+                .cubic_in_out => inOut(cubic, t),
+                .sine_in => sine(t),
+                .sine_out => 1 - sine(1 - t),
+                .sine_in_out => inOut(sine, t),
+                .expo_in => expo(t),
+                .expo_out => 1 - expo(1 - t),
+                .expo_in_out => inOut(expo, t),
+                .back_in => back(t),
+                .back_out => 1 - back(1 - t),
+                .back_in_out => inOut(back, t),
+                .elastic_in => elastic(t),
+                .elastic_out => 1 - elastic(1 - t),
+                .elastic_in_out => inOut(elastic, t),
+                .bounce_in => bounceIn(t),
+                .bounce_out => bounceOut(t),
+                .bounce_in_out => inOut(bounceIn, t),
+            };
+        }
+    };
+
+    /// Mirror an ease-in curve into the matching in-out curve.
+    fn inOut(comptime f: fn (f32) f32, t: f32) f32 {
+        return if (t < 0.5) f(t * 2) / 2 else 1 - f((1 - t) * 2) / 2;
+    }
+
+    fn quad(t: f32) f32 {
+        return t * t;
+    }
+
+    fn cubic(t: f32) f32 {
+        return t * t * t;
+    }
+
+    fn sine(t: f32) f32 {
+        return 1 - @cos(t * std.math.pi / 2);
+    }
+
+    fn expo(t: f32) f32 {
+        return if (t <= 0) 0 else std.math.pow(f32, 2, 10 * t - 10);
+    }
+
+    fn back(t: f32) f32 {
+        const c1: f32 = 1.70158;
+        return (c1 + 1) * t * t * t - c1 * t * t;
+    }
+
+    fn elastic(t: f32) f32 {
+        if (t <= 0 or t >= 1) return t;
+        return -std.math.pow(f32, 2, 10 * t - 10) * @sin((t * 10 - 10.75) * (2 * std.math.pi / 3));
+    }
+
+    fn bounceIn(t: f32) f32 {
+        return 1 - bounceOut(1 - t);
+    }
+
+    fn bounceOut(t_in: f32) f32 {
+        const n: f32 = 7.5625;
+        const d: f32 = 2.75;
+        var t = t_in;
+        if (t < 1 / d) return n * t * t;
+        if (t < 2 / d) {
+            t -= 1.5 / d;
+            return n * t * t + 0.75;
+        }
+        if (t < 2.5 / d) {
+            t -= 2.25 / d;
+            return n * t * t + 0.9375;
+        }
+        t -= 2.625 / d;
+        return n * t * t + 0.984375;
+    }
+
+    /// One `f32` animated from `from` to `to` over `duration` seconds, after `delay` seconds.
+    pub const Tween = struct {
+        from: f32,
+        to: f32,
+        duration: f32,
+        ease: Ease = .linear,
+        delay: f32 = 0,
+        elapsed: f32 = 0,
+
+        pub fn init(from: f32, to: f32, duration: f32, ease: Ease) Tween {
+            return .{ .from = from, .to = to, .duration = @max(duration, 0), .ease = ease };
+        }
+
+        /// Advance by `dt` seconds and return the new value.
+        pub fn update(self: *Tween, dt: f32) f32 {
+            _ = self.advance(dt);
+            return self.value();
+        }
+
+        /// Advance by `dt` seconds; returns the part of `dt` left over after finishing.
+        fn advance(self: *Tween, dt: f32) f32 {
+            const next = self.elapsed + @max(dt, 0);
+            self.elapsed = @min(next, self.delay + self.duration);
+            return next - self.elapsed;
+        }
+
+        /// Linear progress `0..1`, ignoring the ease.
+        pub fn progress(self: Tween) f32 {
+            if (self.duration <= 0) return if (self.elapsed >= self.delay) 1 else 0;
+            return math.clamp((self.elapsed - self.delay) / self.duration, 0, 1);
+        }
+
+        /// Eased progress, for driving values other than `from..to` (positions, colors).
+        pub fn eased(self: Tween) f32 {
+            return self.ease.apply(self.progress());
+        }
+
+        pub fn value(self: Tween) f32 {
+            return math.lerp(self.from, self.to, self.eased());
+        }
+
+        pub fn isFinished(self: Tween) bool {
+            return self.elapsed >= self.delay + self.duration;
+        }
+
+        pub fn reset(self: *Tween) void {
+            self.elapsed = 0;
+        }
+    };
+
+    /// Tweens played in order (`sequence`) or together (`parallel`). The slice is borrowed.
+    pub const Group = struct {
+        tweens: []Tween,
+        is_parallel: bool = false,
+        looping: bool = false,
+        current: usize = 0,
+
+        /// Play `tweens` one after another; time left over when one finishes carries into the next.
+        pub fn sequence(tweens: []Tween) Group {
+            return .{ .tweens = tweens };
+        }
+
+        /// Play `tweens` at the same time; set `delay` on them to stagger.
+        pub fn parallel(tweens: []Tween) Group {
+            return .{ .tweens = tweens, .is_parallel = true };
+        }
+
+        pub fn update(self: *Group, dt: f32) void {
+            var left = @max(dt, 0);
+            // A looping group of zero-length tweens would never use up `dt`; stop after a lap.
+            var laps: u32 = 0;
+            while (true) {
+                if (self.is_parallel) {
+                    var rest = left;
+                    for (self.tweens) |*t| rest = @min(rest, t.advance(left));
+                    left = rest;
+                } else {
+                    while (self.current < self.tweens.len) {
+                        const t = &self.tweens[self.current];
+                        left = t.advance(left);
+                        if (!t.isFinished()) break;
+                        self.current += 1;
+                    }
+                }
+                if (!(self.looping and self.isFinished() and left > 0 and laps < 1)) break;
+                self.reset();
+                laps += 1;
+            }
+        }
+
+        /// The value of the playing tween in a sequence (the last once finished), or of the
+        /// first tween in a parallel group.
+        pub fn value(self: Group) f32 {
+            if (self.tweens.len == 0) return 0;
+            const index = if (self.is_parallel) 0 else @min(self.current, self.tweens.len - 1);
+            return self.tweens[index].value();
+        }
+
+        pub fn isFinished(self: Group) bool {
+            for (self.tweens) |t| {
+                if (!t.isFinished()) return false;
+            }
+            return true;
+        }
+
+        pub fn reset(self: *Group) void {
+            for (self.tweens) |*t| t.reset();
+            self.current = 0;
+        }
+    };
+};
+
+/// Delayed and repeating callbacks, advanced once per tick from `update`.
+pub const timer = struct {
+    /// Identifies a scheduled timer, for `cancel`.
+    pub const Handle = struct { id: u32 };
+
+    /// Called with the context pointer given when the timer was scheduled.
+    pub const Callback = *const fn (ctx: ?*anyopaque) void;
+
+    const Timer = struct {
+        handle: Handle,
+        remaining: u64,
+        /// 0 fires once.
+        interval: u64,
+        callback: Callback,
+        ctx: ?*anyopaque,
+    };
+
+    /// Up to `max_timers` scheduled callbacks. Timers only move when `update` or `advance` is
+    /// called; a repeating timer fires once for every whole interval that passed.
+    pub fn Timers(comptime max_timers: usize) type {
+        return struct {
+            const Self = @This();
+
+            timers: [max_timers]Timer = undefined,
+            len: usize = 0,
+            next: u32 = 0,
+
+            fn schedule(self: *Self, delay: u64, interval: u64, callback: Callback, ctx: ?*anyopaque) ?Handle {
+                if (self.len == max_timers) return null;
+                const handle = Handle{ .id = self.next };
+                self.next +%= 1;
+                self.timers[self.len] = .{ .handle = handle, .remaining = delay, .interval = interval, .callback = callback, .ctx = ctx };
+                self.len += 1;
+                return handle;
+            }
+
+            /// Call `callback(ctx)` once, `ms` milliseconds from now. Null when full.
+            pub fn after(self: *Self, ms: u64, callback: Callback, ctx: ?*anyopaque) ?Handle {
+                return self.schedule(ms, 0, callback, ctx);
+            }
+
+            /// Call `callback(ctx)` every `ms` milliseconds (at least 1) until cancelled.
+            pub fn every(self: *Self, ms: u64, callback: Callback, ctx: ?*anyopaque) ?Handle {
+                const interval = @max(ms, 1);
+                return self.schedule(interval, interval, callback, ctx);
+            }
+
+            fn find(self: *const Self, handle: Handle) ?usize {
+                for (self.timers[0..self.len], 0..) |t, i| {
+                    if (t.handle.id == handle.id) return i;
+                }
+                return null;
+            }
+
+            /// Stop a timer. False if it already finished or was cancelled.
+            pub fn cancel(self: *Self, handle: Handle) bool {
+                const i = self.find(handle) orelse return false;
+                std.mem.copyForwards(Timer, self.timers[i .. self.len - 1], self.timers[i + 1 .. self.len]);
+                self.len -= 1;
+                return true;
+            }
+
+            pub fn isActive(self: *const Self, handle: Handle) bool {
+                return self.find(handle) != null;
+            }
+
+            /// Milliseconds until the timer next fires, or null if it isn't active.
+            pub fn remaining(self: *const Self, handle: Handle) ?u64 {
+                const i = self.find(handle) orelse return null;
+                return self.timers[i].remaining;
+            }
+
+            /// Cancel every timer.
+            pub fn clear(self: *Self) void {
+                self.len = 0;
+            }
+
+            /// Advance by this tick's `system.deltaMillis()` and fire what's due.
+            pub fn update(self: *Self) void {
+                self.advance(system.deltaMillis());
+            }
+
+            /// Advance by `ms` and fire what's due, in the order the timers were scheduled.
+            /// Callbacks must not schedule or cancel timers on this set.
+            pub fn advance(self: *Self, ms: u64) void {
+                var kept: usize = 0;
+                for (self.timers[0..self.len]) |t_in| {
+                    var t = t_in;
+                    var elapsed = ms;
+                    var done = false;
+                    while (elapsed >= t.remaining) {
+                        elapsed -= t.remaining;
+                        t.callback(t.ctx);
+                        if (t.interval == 0) {
+                            done = true;
+                            break;
+                        }
+                        t.remaining = t.interval;
+                    }
+                    if (done) continue;
+                    t.remaining -= elapsed;
+                    self.timers[kept] = t;
+                    kept += 1;
+                }
+                self.len = kept;
+            }
+        };
+    }
+};
+
+/// Named input actions with remappable bindings, saved to storage as text.
+///
+/// `ActionMap(max_actions, max_bindings)` is fixed-size; action names are borrowed, so use string
+/// literals. Call `update()` once per tick, then ask `down`/`pressed`/`released`.
+pub const actions = struct {
+    /// One physical input an action can be bound to.
+    pub const Binding = union(enum) {
+        button: struct { port: u32, button: Button },
+        key: u32,
+        /// 0 = left, 1 = right, 2 = middle.
+        mouse: u32,
+
+        pub fn pad(port: u32, button: Button) Binding {
+            return .{ .button = .{ .port = port, .button = button } };
+        }
+
+        pub fn eql(a: Binding, b: Binding) bool {
+            return switch (a) {
+                .button => |x| b == .button and b.button.port == x.port and b.button.button == x.button,
+                .key => |k| b == .key and b.key == k,
+                .mouse => |m| b == .mouse and b.mouse == m,
+            };
+        }
+
+        pub fn isDown(self: Binding) bool {
+            return switch (self) {
+                .button => |x| input.isButtonDown(x.port, x.button),
+                .key => |k| input.isKeyDown(k),
+                .mouse => |m| input.isMouseDown(m),
+            };
+        }
+
+        /// The first input currently held (joypads, then mouse buttons, then keys), for
+        /// "press a button to rebind" screens. Wait for null first so the confirm press isn't
+        /// captured.
+        pub fn held() ?Binding {
+            var port: u32 = 0;
+            while (port < 8) : (port += 1) {
+                if (!input.isConnected(port)) continue;
+                for (std.enums.values(Button)) |b| {
+                    if (input.isButtonDown(port, b)) return pad(port, b);
+                }
+            }
+            var m: u32 = 0;
+            while (m < 3) : (m += 1) {
+                if (input.isMouseDown(m)) return .{ .mouse = m };
+            }
+            var k: u32 = 0;
+            while (k < 324) : (k += 1) {
+                if (input.isKeyDown(k)) return .{ .key = k };
+            }
+            return null;
+        }
+
+        /// Parse `pad0:a`, `key:32` or `mouse:0`.
+        pub fn parse(s: []const u8) ?Binding {
+            const colon = std.mem.indexOfScalar(u8, s, ':') orelse return null;
+            const kind = s[0..colon];
+            const value = s[colon + 1 ..];
+            if (std.mem.eql(u8, kind, "key")) {
+                return .{ .key = std.fmt.parseInt(u32, value, 10) catch return null };
+            }
+            if (std.mem.eql(u8, kind, "mouse")) {
+                return .{ .mouse = std.fmt.parseInt(u32, value, 10) catch return null };
+            }
+            if (!std.mem.startsWith(u8, kind, "pad")) return null;
+            const port = std.fmt.parseInt(u32, kind[3..], 10) catch return null;
+            for (std.enums.values(Button)) |b| {
+                if (std.ascii.eqlIgnoreCase(@tagName(b), value)) return pad(port, b);
+            }
+            return null;
+        }
+
+        pub fn write(self: Binding, writer: anytype) !void {
+            switch (self) {
+                .button => |x| try writer.print("pad{d}:{s}", .{ x.port, @tagName(x.button) }),
+                .key => |k| try writer.print("key:{d}", .{k}),
+                .mouse => |m| try writer.print("mouse:{d}", .{m}),
+            }
+        }
+    };
+
+    pub fn ActionMap(comptime max_actions: usize, comptime max_bindings: usize) type {
+        return struct {
+            const Self = @This();
+
+            const Action = struct {
+                name: []const u8,
+                bindings: [max_bindings]Binding = undefined,
+                len: usize = 0,
+                down: bool = false,
+                was_down: bool = false,
+            };
+
+            items: [max_actions]Action = undefined,
+            count: usize = 0,
+
+            fn find(self: anytype, name: []const u8) ?usize {
+                for (self.items[0..self.count], 0..) |a, i| {
+                    if (std.mem.eql(u8, a.name, name)) return i;
+                }
+                return null;
+            }
+
+            fn entry(self: *Self, name: []const u8) ?*Action {
+                if (self.find(name)) |i| return &self.items[i];
+                if (self.count == max_actions) return null;
+                self.items[self.count] = .{ .name = name };
+                self.count += 1;
+                return &self.items[self.count - 1];
+            }
+
+            /// Set the inputs for `name`, replacing any it had (extra inputs past `max_bindings` are dropped).
+            pub fn bind(self: *Self, name: []const u8, inputs: []const Binding) void {
+                const a = self.entry(name) orelse return;
+                a.len = @min(inputs.len, max_bindings);
+                @memcpy(a.bindings[0..a.len], inputs[0..a.len]);
+            }
+
+            pub fn addBinding(self: *Self, name: []const u8, b: Binding) void {
+                const a = self.entry(name) orelse return;
+                for (a.bindings[0..a.len]) |x| {
+                    if (x.eql(b)) return;
+                }
+                if (a.len == max_bindings) return;
+                a.bindings[a.len] = b;
+                a.len += 1;
+            }
+
+            /// Remove `b` from every action.
+            pub fn unbindInput(self: *Self, b: Binding) void {
+                for (self.items[0..self.count]) |*a| {
+                    var n: usize = 0;
+                    for (a.bindings[0..a.len]) |x| {
+                        if (x.eql(b)) continue;
+                        a.bindings[n] = x;
+                        n += 1;
+                    }
+                    a.len = n;
+                }
+            }
+
+            pub fn bindings(self: *const Self, name: []const u8) []const Binding {
+                const i = self.find(name) orelse return &.{};
+                return self.items[i].bindings[0..self.items[i].len];
+            }
+
+            /// Sample every action's inputs for this tick.
+            pub fn update(self: *Self) void {
+                for (self.items[0..self.count]) |*a| {
+                    a.was_down = a.down;
+                    a.down = false;
+                    for (a.bindings[0..a.len]) |b| {
+                        if (b.isDown()) a.down = true;
+                    }
+                }
+            }
+
+            pub fn down(self: *const Self, name: []const u8) bool {
+                const i = self.find(name) orelse return false;
+                return self.items[i].down;
+            }
+
+            pub fn pressed(self: *const Self, name: []const u8) bool {
+                const i = self.find(name) orelse return false;
+                return self.items[i].down and !self.items[i].was_down;
+            }
+
+            pub fn released(self: *const Self, name: []const u8) bool {
+                const i = self.find(name) orelse return false;
+                return !self.items[i].down and self.items[i].was_down;
+            }
+
+            /// One line per action: `jump = pad0:a key:32`.
+            pub fn writeText(self: *const Self, writer: anytype) !void {
+                for (self.items[0..self.count]) |a| {
+                    try writer.print("{s} =", .{a.name});
+                    for (a.bindings[0..a.len]) |b| {
+                        try writer.writeByte(' ');
+                        try b.write(writer);
+                    }
+                    try writer.writeByte('\n');
+                }
+            }
+
+            /// Rebind actions listed in `writeText` output. Only actions already in the map are
+            /// touched, since names are borrowed.
+            pub fn loadText(self: *Self, text: []const u8) void {
+                var lines = std.mem.tokenizeScalar(u8, text, '\n');
+                while (lines.next()) |line| {
+                    const eq = std.mem.indexOfScalar(u8, line, '=') orelse continue;
+                    const name = std.mem.trim(u8, line[0..eq], " \t\r");
+                    const i = self.find(name) orelse continue;
+                    const a = &self.items[i];
+                    a.len = 0;
+                    var it = std.mem.tokenizeAny(u8, line[eq + 1 ..], " \t\r");
+                    while (it.next()) |tok| {
+                        const b = Binding.parse(tok) orelse continue;
+                        if (a.len == max_bindings) break;
+                        a.bindings[a.len] = b;
+                        a.len += 1;
+                    }
+                }
+            }
+
+            /// Save the bindings to persistent storage under `key`, using `buf` to format them.
+            pub fn save(self: *const Self, key: []const u8, buf: []u8) !void {
+                var stream = std.io.fixedBufferStream(buf);
+                try self.writeText(stream.writer());
+                storage.save(key, stream.getWritten());
+            }
+
+            /// Load bindings saved with `save`. Returns false if nothing was saved under `key`.
+            pub fn load(self: *Self, allocator: std.mem.Allocator, key: []const u8) !bool {
+                const data = (try storage.load(allocator, key)) orelse return false;
+                defer allocator.free(data);
+                self.loadText(data);
+                return true;
+            }
+        };
+    }
+};
+
+/// Immediate-mode UI: buttons, checkboxes, sliders and text fields for options menus and
+/// editors, matching the Rust SDK's `ui` module.
+///
+/// `ui.Ui(max_widgets)` is fixed-size. Call `begin()` once per frame, then widgets, each of
+/// which draws itself and reports what happened this frame. The mouse clicks and drags; up/down
+/// (arrows, Tab, d-pad) move focus in draw order, left/right move a focused slider, and A, Enter
+/// or Space presses. Widgets are told apart by label; text after `##` is an id that isn't drawn.
+pub const ui = struct {
+    const key_tab = 9;
+    const key_return = 13;
+    const key_space = 32;
+    const key_up = 273;
+    const key_down = 274;
+    const key_right = 275;
+    const key_left = 276;
+    const repeat_delay = 300;
+    const repeat_interval = 80;
+    const slider_step: f32 = 1.0 / 20.0;
+    const caret_blink = 500;
+
+    pub const Theme = struct {
+        /// Unregistered keys draw with the built-in Spleen 16.
+        font: []const u8 = "ui",
+        text: Color = Color.white,
+        placeholder: Color = Color.rgb(140, 140, 150),
+        background: Color = Color.rgb(48, 48, 56),
+        hovered: Color = Color.rgb(72, 72, 84),
+        pressed: Color = Color.rgb(32, 32, 40),
+        accent: Color = Color.rgb(90, 160, 255),
+        focus: Color = Color.white,
+        padding: f32 = 4,
+    };
+
+    /// The input a frame of UI reacts to.
+    pub const Input = struct {
+        mouse: math.Vec2 = .{ .x = 0, .y = 0 },
+        mouse_down: bool = false,
+        up: bool = false,
+        down: bool = false,
+        left: bool = false,
+        right: bool = false,
+        activate: bool = false,
+
+        /// Read the mouse, the keyboard and the joypad on `port`. Held directions auto-repeat.
+        pub fn read(port: u32) Input {
+            return .{
+                .mouse = .{ .x = @floatFromInt(input.getMouseX()), .y = @floatFromInt(input.getMouseY()) },
+                .mouse_down = input.isMouseDown(0),
+                .up = nav(port, .up, key_up),
+                .down = nav(port, .down, key_down) or input.keyRepeat(key_tab, repeat_delay, repeat_interval),
+                .left = nav(port, .left, key_left),
+                .right = nav(port, .right, key_right),
+                .activate = (input.isButtonDown(port, .a) and input.buttonHeldMillis(port, .a) == 0) or
+                    keyPressed(key_return) or keyPressed(key_space),
+            };
+        }
+
+        fn nav(port: u32, button: Button, key: u32) bool {
+            return input.buttonRepeat(port, button, repeat_delay, repeat_interval) or
+                input.keyRepeat(key, repeat_delay, repeat_interval);
+        }
+
+        fn keyPressed(key: u32) bool {
+            return input.isKeyDown(key) and input.keyHeldMillis(key) == 0;
+        }
+    };
+
+    const Label = struct {
+        shown: []const u8,
+        id: u64,
+    };
+
+    fn splitLabel(label: []const u8) Label {
+        if (std.mem.indexOf(u8, label, "##")) |i| {
+            return .{ .shown = label[0..i], .id = graphics.hashKey(label[i + 2 ..]) };
+        }
+        return .{ .shown = label, .id = graphics.hashKey(label) };
+    }
+
+    fn fill(color: Color, r: math.Rect) void {
+        graphics.setColor(color.r, color.g, color.b, color.a);
+        graphics.rectOf(r);
+    }
+
+    fn outline(color: Color, r: math.Rect) void {
+        graphics.setColor(color.r, color.g, color.b, color.a);
+        graphics.rectOutlineOf(r);
+    }
+
+    pub fn Ui(comptime max_widgets: usize) type {
+        return struct {
+            const Self = @This();
+            const Hit = struct { hovered: bool, focused: bool, clicked: bool };
+
+            theme: Theme = .{},
+            port: u32 = 0,
+            frame: Input = .{},
+            mouse_pressed: bool = false,
+            mouse_released: bool = false,
+            focus: ?u64 = null,
+            order: [max_widgets]u64 = undefined,
+            order_len: usize = 0,
+            last_order: [max_widgets]u64 = undefined,
+            last_order_len: usize = 0,
+            pressed_on: ?u64 = null,
+            editing: ?u64 = null,
+            typed: [256]u8 = undefined,
+            typed_len: usize = 0,
+
+            /// Start a frame of UI, reading input from the host.
+            pub fn begin(self: *Self) void {
+                var typed: []const u8 = "";
+                var buf: [256]u8 = undefined;
+                var fba = std.heap.FixedBufferAllocator.init(&buf);
+                if (self.editing != null) {
+                    if (input.getTextInput(fba.allocator()) catch null) |t| typed = t;
+                }
+                self.beginWith(Input.read(self.port), typed);
+            }
+
+            /// `begin` with the given input and text typed since the last frame.
+            pub fn beginWith(self: *Self, frame: Input, typed: []const u8) void {
+                const was_down = self.frame.mouse_down;
+                if (!was_down) self.pressed_on = null;
+                self.mouse_pressed = frame.mouse_down and !was_down;
+                self.mouse_released = !frame.mouse_down and was_down;
+                self.frame = frame;
+                self.typed_len = @min(typed.len, self.typed.len);
+                @memcpy(self.typed[0..self.typed_len], typed[0..self.typed_len]);
+
+                self.last_order = self.order;
+                self.last_order_len = self.order_len;
+                self.order_len = 0;
+                const last = self.last_order[0..self.last_order_len];
+                if (self.focus) |id| {
+                    if (std.mem.indexOfScalar(u64, last, id) == null) self.focus = null;
+                }
+                if (self.editing == null and last.len > 0) {
+                    const step = @as(i32, @intFromBool(frame.down)) - @intFromBool(frame.up);
+                    if (step != 0) {
+                        const len: i32 = @intCast(last.len);
+                        const next = if (self.focus) |id|
+                            @mod(@as(i32, @intCast(std.mem.indexOfScalar(u64, last, id).?)) + step, len)
+                        else if (step > 0) 0 else len - 1;
+                        self.focus = last[@intCast(next)];
+                    }
+                }
+                if (self.editing != null and self.editing != self.focus) self.stopEditing();
+            }
+
+            /// Whether a text field is collecting typed text.
+            pub fn isEditing(self: *const Self) bool {
+                return self.editing != null;
+            }
+
+            /// Focus the widget with `label`, or clear focus with null.
+            pub fn setFocus(self: *Self, name: ?[]const u8) void {
+                self.focus = if (name) |n| splitLabel(n).id else null;
+            }
+
+            fn stopEditing(self: *Self) void {
+                self.editing = null;
+                input.textInputStop();
+            }
+
+            fn widget(self: *Self, id: u64, r: math.Rect) Hit {
+                if (self.order_len < max_widgets) {
+                    self.order[self.order_len] = id;
+                    self.order_len += 1;
+                }
+                const hovered = r.contains(self.frame.mouse);
+                if (hovered and self.mouse_pressed) {
+                    self.pressed_on = id;
+                    self.focus = id;
+                }
+                const focused = self.focus == id;
+                const clicked = (self.mouse_released and hovered and self.pressed_on == id) or
+                    (focused and self.frame.activate and self.editing == null);
+                return .{ .hovered = hovered, .focused = focused, .clicked = clicked };
+            }
+
+            fn held(self: *const Self, id: u64) bool {
+                return self.frame.mouse_down and self.pressed_on == id;
+            }
+
+            fn background(self: *const Self, id: u64, hovered: bool) Color {
+                if (self.held(id)) return self.theme.pressed;
+                return if (hovered) self.theme.hovered else self.theme.background;
+            }
+
+            fn textIn(self: *const Self, color: Color, x: f32, r: math.Rect, text: []const u8) void {
+                const size = graphics.textMeasureKey(self.theme.font, text);
+                const y = r.y + (r.h - @as(f32, @floatFromInt(size.height))) / 2;
+                graphics.setColor(color.r, color.g, color.b, color.a);
+                graphics.textKey(@intFromFloat(x), @intFromFloat(y), self.theme.font, text);
+            }
+
+            fn textCentered(self: *const Self, r: math.Rect, text: []const u8) void {
+                const width: f32 = @floatFromInt(graphics.textMeasureKey(self.theme.font, text).width);
+                self.textIn(self.theme.text, r.x + (r.w - width) / 2, r, text);
+            }
+
+            /// Draw `text` with its top left at (`x`, `y`).
+            pub fn label(self: *const Self, x: f32, y: f32, text: []const u8) void {
+                const c = self.theme.text;
+                graphics.setColor(c.r, c.g, c.b, c.a);
+                graphics.textKey(@intFromFloat(x), @intFromFloat(y), self.theme.font, text);
+            }
+
+            /// A push button filling `r`; true on the frame it's clicked or activated.
+            pub fn button(self: *Self, text: []const u8, r: math.Rect) bool {
+                const l = splitLabel(text);
+                const hit = self.widget(l.id, r);
+                fill(self.background(l.id, hit.hovered), r);
+                if (hit.focused) outline(self.theme.focus, r);
+                self.textCentered(r, l.shown);
+                return hit.clicked;
+            }
+
+            /// A checkbox with its label to the right; true when `value` changes.
+            pub fn checkbox(self: *Self, text: []const u8, r: math.Rect, value: *bool) bool {
+                const l = splitLabel(text);
+                const hit = self.widget(l.id, r);
+                if (hit.clicked) value.* = !value.*;
+                const pad = self.theme.padding;
+                const check = math.Rect.init(r.x, r.y, r.h, r.h);
+                fill(self.background(l.id, hit.hovered), check);
+                if (value.*) {
+                    const inset = @min(pad, r.h / 4);
+                    fill(self.theme.accent, math.Rect.init(check.x + inset, check.y + inset, check.w - inset * 2, check.h - inset * 2));
+                }
+                if (hit.focused) outline(self.theme.focus, r);
+                self.textIn(self.theme.text, r.x + r.h + pad, r, l.shown);
+                return hit.clicked;
+            }
+
+            /// A horizontal slider for `value` in `min..max`; true when it changes.
+            pub fn slider(self: *Self, text: []const u8, r: math.Rect, value: *f32, min: f32, max: f32) bool {
+                const l = splitLabel(text);
+                const hit = self.widget(l.id, r);
+                const old = value.*;
+                if (self.held(l.id) and r.w > 0) {
+                    value.* = min + (self.frame.mouse.x - r.x) / r.w * (max - min);
+                } else if (hit.focused and self.editing == null) {
+                    const step: f32 = @floatFromInt(@as(i32, @intFromBool(self.frame.right)) - @intFromBool(self.frame.left));
+                    value.* += step * (max - min) * slider_step;
+                }
+                value.* = std.math.clamp(value.*, @min(min, max), @max(min, max));
+
+                fill(self.background(l.id, hit.hovered), r);
+                const t = if (max != min) (value.* - min) / (max - min) else 0;
+                fill(self.theme.accent, math.Rect.init(r.x, r.y, r.w * t, r.h));
+                if (hit.focused) outline(self.theme.focus, r);
+                self.textCentered(r, l.shown);
+                return value.* != old;
+            }
+
+            /// A one-line text field editing `buf[0..len.*]`. Clicking or activating starts
+            /// editing; Enter, clicking elsewhere or moving focus stops. True on the frame Enter
+            /// finishes editing.
+            pub fn textField(self: *Self, text: []const u8, r: math.Rect, buf: []u8, len: *usize) bool {
+                const l = splitLabel(text);
+                const hit = self.widget(l.id, r);
+                if (self.editing == l.id and self.mouse_pressed and !hit.hovered) {
+                    self.stopEditing();
+                } else if (hit.clicked and self.editing == null) {
+                    self.editing = l.id;
+                    self.focus = l.id;
+                    input.textInputStart();
+                }
+
+                var submitted = false;
+                const editing = self.editing == l.id;
+                if (editing) {
+                    for (self.typed[0..self.typed_len]) |c| {
+                        switch (c) {
+                            0x08 => {
+                                // Drop the last UTF-8 character.
+                                while (len.* > 0) {
+                                    len.* -= 1;
+                                    if (buf[len.*] & 0xC0 != 0x80) break;
+                                }
+                            },
+                            '\n', '\r' => {
+                                submitted = true;
+                                break;
+                            },
+                            else => if (c >= 0x20 and c != 0x7F and len.* < buf.len) {
+                                buf[len.*] = c;
+                                len.* += 1;
+                            },
+                        }
+                    }
+                    self.typed_len = 0;
+                    if (submitted) self.stopEditing();
+                }
+
+                fill(self.background(l.id, hit.hovered), r);
+                if (editing) {
+                    outline(self.theme.accent, r);
+                } else if (hit.focused) {
+                    outline(self.theme.focus, r);
+                }
+                const x = r.x + self.theme.padding;
+                const value = buf[0..len.*];
+                if (value.len == 0 and !editing) {
+                    self.textIn(self.theme.placeholder, x, r, l.shown);
+                } else {
+                    self.textIn(self.theme.text, x, r, value);
+                }
+                if (editing and system.millis() / caret_blink % 2 == 0) {
+                    const width: f32 = @floatFromInt(graphics.textMeasureKey(self.theme.font, value).width);
+                    const pad = self.theme.padding;
+                    fill(self.theme.text, math.Rect.init(x + width, r.y + pad / 2, 1, r.h - pad));
+                }
+                return submitted;
+            }
+        };
+    }
+};
+
+/// A stack of game scenes with fade/wipe transitions.
+///
+/// Any struct with `draw(self: *T) void` can be a scene; it may also declare
+/// `enter(self: *T) void`, `exit(self: *T) void`, `update(self: *T, scenes: *SceneManager, dt: f32) void`
+/// and `pub const is_overlay = true` (draw the scene below first). Scenes are borrowed, not copied:
+/// keep them alive while they're on the stack. `push`/`pop`/`replace` are applied when the current
+/// scene's `update` returns (or at the next `SceneManager.update` if called from elsewhere); with a
+/// transition they happen at its halfway point.
+pub const SceneManager = struct {
+    pub const max_scenes = 16;
+
+    pub const Scene = struct {
+        ptr: *anyopaque,
+        vtable: *const VTable,
+
+        pub const VTable = struct {
+            enter: ?*const fn (*anyopaque) void,
+            exit: ?*const fn (*anyopaque) void,
+            update: ?*const fn (*anyopaque, *SceneManager, f32) void,
+            draw: *const fn (*anyopaque) void,
+            is_overlay: bool,
+        };
+
+        /// Wrap a pointer to any scene struct.
+        pub fn of(scene: anytype) Scene {
+            const T = @typeInfo(@TypeOf(scene)).pointer.child;
+            const Gen = struct {
+                fn enter(p: *anyopaque) void {
+                    @as(*T, @ptrCast(@alignCast(p))).enter();
+                }
+                fn exit(p: *anyopaque) void {
+                    @as(*T, @ptrCast(@alignCast(p))).exit();
+                }
+                fn update(p: *anyopaque, m: *SceneManager, dt: f32) void {
+                    @as(*T, @ptrCast(@alignCast(p))).update(m, dt);
+                }
+                fn draw(p: *anyopaque) void {
+                    @as(*T, @ptrCast(@alignCast(p))).draw();
+                }
+                const vtable = VTable{
+                    .enter = if (@hasDecl(T, "enter")) enter else null,
+                    .exit = if (@hasDecl(T, "exit")) exit else null,
+                    .update = if (@hasDecl(T, "update")) update else null,
+                    .draw = draw,
+                    .is_overlay = @hasDecl(T, "is_overlay") and T.is_overlay,
+                };
+            };
+            return .{ .ptr = scene, .vtable = &Gen.vtable };
+        }
+    };
+
+    pub const WipeFrom = enum { left, right, top, bottom };
+
+    /// `millis` is the total duration; the stack changes halfway through.
+    pub const Transition = union(enum) {
+        none,
+        fade: struct { color: Color, millis: u32 },
+        wipe: struct { color: Color, millis: u32, from: WipeFrom },
+
+        fn millis(self: Transition) u32 {
+            return switch (self) {
+                .none => 0,
+                .fade => |f| f.millis,
+                .wipe => |w| w.millis,
+            };
+        }
+    };
+
+    const Action = union(enum) { push: Scene, pop, replace: Scene };
+
+    stack: [max_scenes]Scene = undefined,
+    len: usize = 0,
+    width: u32,
+    height: u32,
+    queued: ?struct { action: Action, transition: Transition } = null,
+    transition: Transition = .none,
+    elapsed_ms: f32 = 0,
+    pending: ?Action = null,
+
+    /// Start with `first` on the stack. `width`/`height` is the screen size transitions cover.
+    pub fn init(width: u32, height: u32, first: Scene) SceneManager {
+        var m = SceneManager{ .width = width, .height = height };
+        m.apply(.{ .push = first });
+        return m;
+    }
+
+    /// Push a scene. Requests made while a transition plays are dropped.
+    pub fn push(self: *SceneManager, scene: Scene, transition: Transition) void {
+        self.request(.{ .push = scene }, transition);
+    }
+
+    pub fn pop(self: *SceneManager, transition: Transition) void {
+        self.request(.pop, transition);
+    }
+
+    pub fn replace(self: *SceneManager, scene: Scene, transition: Transition) void {
+        self.request(.{ .replace = scene }, transition);
+    }
+
+    pub fn isTransitioning(self: *const SceneManager) bool {
+        return self.transition != .none;
+    }
+
+    fn request(self: *SceneManager, action: Action, transition: Transition) void {
+        if (self.isTransitioning() or self.queued != null) return;
+        self.queued = .{ .action = action, .transition = transition };
+    }
+
+    fn apply(self: *SceneManager, action: Action) void {
+        switch (action) {
+            .push => |s| {
+                if (self.len == max_scenes) return;
+                if (s.vtable.enter) |f| f(s.ptr);
+                self.stack[self.len] = s;
+                self.len += 1;
+            },
+            .pop => {
+                if (self.len == 0) return;
+                self.len -= 1;
+                const s = self.stack[self.len];
+                if (s.vtable.exit) |f| f(s.ptr);
+            },
+            .replace => |s| {
+                self.apply(.pop);
+                self.apply(.{ .push = s });
+            },
+        }
+    }
+
+    fn flushQueued(self: *SceneManager) void {
+        const q = self.queued orelse return;
+        self.queued = null;
+        if (q.transition.millis() == 0) {
+            self.apply(q.action);
+        } else {
+            self.transition = q.transition;
+            self.elapsed_ms = 0;
+            self.pending = q.action;
+        }
+    }
+
+    /// Advance the transition, or update the top scene and apply what it requested.
+    pub fn update(self: *SceneManager, dt: f32) void {
+        self.flushQueued();
+        if (self.isTransitioning()) {
+            self.elapsed_ms += dt * 1000;
+            const total: f32 = @floatFromInt(self.transition.millis());
+            if (self.elapsed_ms >= total / 2) {
+                if (self.pending) |a| {
+                    self.pending = null;
+                    self.apply(a);
+                }
+            }
+            if (self.elapsed_ms >= total) self.transition = .none;
+            return;
+        }
+        if (self.len == 0) return;
+        const top = self.stack[self.len - 1];
+        if (top.vtable.update) |f| f(top.ptr, self, dt);
+        self.flushQueued();
+    }
+
+    /// Draw the visible scenes, then the transition.
+    pub fn draw(self: *SceneManager) void {
+        var base = self.len;
+        while (base > 0) {
+            base -= 1;
+            if (!self.stack[base].vtable.is_overlay) break;
+        }
+        for (self.stack[base..self.len]) |s| s.vtable.draw(s.ptr);
+        self.drawTransition();
+    }
+
+    fn coverage(self: *const SceneManager) f32 {
+        const total: f32 = @floatFromInt(@max(self.transition.millis(), 1));
+        const t = math.clamp(self.elapsed_ms / total, 0, 1);
+        return if (t < 0.5) t * 2 else (1 - t) * 2;
+    }
+
+    fn drawTransition(self: *const SceneManager) void {
+        const c = self.coverage();
+        switch (self.transition) {
+            .none => {},
+            .fade => |f| {
+                // Colors aren't blended when drawn, so mix the finished frame a row at a time.
+                var row: [4096]u8 = undefined;
+                const w = @min(self.width, row.len / 4);
+                const bytes = row[0 .. w * 4];
+                var y: u32 = 0;
+                while (y < self.height) : (y += 1) {
+                    _ = graphics.framebufferRead(0, @intCast(y), w, 1, bytes);
+                    var i: usize = 0;
+                    while (i < bytes.len) : (i += 4) {
+                        bytes[i] = mix(bytes[i], f.color.r, c);
+                        bytes[i + 1] = mix(bytes[i + 1], f.color.g, c);
+                        bytes[i + 2] = mix(bytes[i + 2], f.color.b, c);
+                        bytes[i + 3] = mix(bytes[i + 3], 255, c);
+                    }
+                    graphics.framebufferWrite(0, @intCast(y), w, 1, bytes);
+                }
+            },
+            .wipe => |wp| {
+                const entering = self.pending != null;
+                const w = self.width;
+                const h = self.height;
+                const cw: u32 = @intFromFloat(@as(f32, @floatFromInt(w)) * c);
+                const ch: u32 = @intFromFloat(@as(f32, @floatFromInt(h)) * c);
+                const from: WipeFrom = if (entering) wp.from else switch (wp.from) {
+                    .left => .right,
+                    .right => .left,
+                    .top => .bottom,
+                    .bottom => .top,
+                };
+                graphics.setColor(wp.color.r, wp.color.g, wp.color.b, wp.color.a);
+                switch (from) {
+                    .left => graphics.rect(0, 0, cw, h),
+                    .right => graphics.rect(@intCast(w - cw), 0, cw, h),
+                    .top => graphics.rect(0, 0, w, ch),
+                    .bottom => graphics.rect(0, @intCast(h - ch), w, ch),
+                }
+            },
+        }
+    }
+
+    fn mix(from: u8, to: u8, t: f32) u8 {
+        const a: f32 = @floatFromInt(from);
+        const b: f32 = @floatFromInt(to);
+        return @intFromFloat(a + (b - a) * t);
     }
 };